@@ -0,0 +1,1467 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountimport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/apikey"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobbackfill"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/deadletter"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/pluginlatency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"github.com/jarrod-lowe/jmap-service-libs/tracing"
+)
+
+var logger = loglevel.New()
+
+// AccountStore handles administrative account META# operations
+type AccountStore interface {
+	GetMeta(ctx context.Context, accountID string) (*account.Meta, error)
+	ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error)
+	GetBlobUsage(ctx context.Context, accountID string) (*account.BlobUsage, error)
+	SetSuspended(ctx context.Context, accountID string, suspended bool, reason string) (*account.Meta, error)
+	SetWritesDisabled(ctx context.Context, accountID string, disabled bool, reason string) (*account.Meta, error)
+	SetCapabilityOverrides(ctx context.Context, accountID string, overrides map[string]map[string]any) (*account.Meta, error)
+	SetQuota(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPendingAllocations int) (*account.QuotaChange, error)
+	CreateMeta(ctx context.Context, meta account.Meta) (*account.Meta, error)
+	ListAliases(ctx context.Context, accountID string) ([]account.Alias, error)
+	PutAlias(ctx context.Context, accountID, alias string) (*account.Alias, error)
+	DeleteAlias(ctx context.Context, accountID, alias string) error
+}
+
+// EventPublisher publishes events to subscribed plugins
+type EventPublisher interface {
+	Publish(ctx context.Context, payload publisher.EventPayload) error
+}
+
+// Importer starts and reports on account import jobs
+type Importer interface {
+	Start(ctx context.Context, accountID, archiveBlobID string) (*accountimport.Job, error)
+	Get(ctx context.Context, accountID, importID string) (*accountimport.Job, error)
+}
+
+// Backfiller registers existing S3 objects as blobs of an account
+type Backfiller interface {
+	Import(ctx context.Context, accountID string, objects []blobbackfill.Object) ([]blobbackfill.Result, error)
+}
+
+// APIKeyStore mints, lists and revokes an account's API keys
+type APIKeyStore interface {
+	Create(ctx context.Context, accountID, name string, scopes []string) (*apikey.Key, string, error)
+	List(ctx context.Context, accountID string) ([]apikey.Key, error)
+	Revoke(ctx context.Context, accountID, keyID string) error
+}
+
+// BindingStore manages the accounts IAM principals are bound to
+type BindingStore interface {
+	Put(ctx context.Context, principalARN, accountID string) (*binding.Binding, error)
+	Delete(ctx context.Context, principalARN, accountID string) error
+	List(ctx context.Context, principalARN string) ([]string, error)
+}
+
+// PluginLatencyReader reads the plugin latency statistics jmap-api instances
+// have flushed
+type PluginLatencyReader interface {
+	List(ctx context.Context) ([]pluginlatency.Stats, error)
+}
+
+// PluginRegistry is the plugin registry account-admin loaded at startup,
+// which it publishes events through
+type PluginRegistry interface {
+	Inspect() plugin.Inspection
+	Refresh(ctx context.Context) error
+}
+
+// DefaultProvisionedAccountType is the accountType of provisioned accounts
+// when the request does not name one
+const DefaultProvisionedAccountType = "service"
+
+// MaxBackfillObjects is the most objects a backfill request may name. The
+// bytes a request copies are capped by blobbackfill.MaxBatchBytes.
+const MaxBackfillObjects = 10
+
+// Pagination limits for account listing
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 100
+)
+
+// AccountSummary describes an account and its storage usage
+type AccountSummary struct {
+	AccountID          string `json:"accountId"`
+	AccountType        string `json:"accountType,omitempty"`
+	Tier               string `json:"tier,omitempty"`
+	QuotaBytes         int64  `json:"quotaBytes"`
+	QuotaRemaining     int64  `json:"quotaRemaining"`
+	UsedBytes          int64  `json:"usedBytes"`
+	BlobCount          int64  `json:"blobCount"`
+	PendingAllocations int    `json:"pendingAllocations"`
+	MaxPendingAllocs   int    `json:"maxPendingAllocations,omitempty"`
+	Suspended          bool   `json:"suspended"`
+	WritesDisabled     bool   `json:"writesDisabled"`
+	CreatedAt          string `json:"createdAt,omitempty"`
+	UpdatedAt          string `json:"updatedAt,omitempty"`
+	LastAccessAt       string `json:"lastAccessAt,omitempty"`
+}
+
+// AccountDetail extends AccountSummary with a per-status blob breakdown
+type AccountDetail struct {
+	AccountSummary
+	Owner                string                    `json:"owner,omitempty"`
+	SuspendedAt          string                    `json:"suspendedAt,omitempty"`
+	SuspendedReason      string                    `json:"suspendedReason,omitempty"`
+	WritesDisabledAt     string                    `json:"writesDisabledAt,omitempty"`
+	WritesDisabledReason string                    `json:"writesDisabledReason,omitempty"`
+	CapabilityOverrides  map[string]map[string]any `json:"capabilityOverrides,omitempty"`
+	QuotaGraceExpiresAt  string                    `json:"quotaGraceExpiresAt,omitempty"`
+	LastActivityAt       string                    `json:"lastActivityAt,omitempty"`
+	InactiveAt           string                    `json:"inactiveAt,omitempty"`
+	DeletionScheduledAt  string                    `json:"deletionScheduledAt,omitempty"`
+	ConfirmedBlobs       int64                     `json:"confirmedBlobs"`
+	ConfirmedBlobBytes   int64                     `json:"confirmedBlobBytes"`
+	PendingBlobs         int64                     `json:"pendingBlobs"`
+	DeletedBlobs         int64                     `json:"deletedBlobs"`
+}
+
+// AccountListResponse is the response body for account listing
+type AccountListResponse struct {
+	Accounts   []AccountSummary `json:"accounts"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// ProvisionRequest is the request body for provisioning an account without a
+// Cognito login. At most one of QuotaBytes or Tier may be set; with neither
+// the default quota applies.
+type ProvisionRequest struct {
+	AccountID   string `json:"accountId"`
+	AccountType string `json:"accountType,omitempty"`
+	Owner       string `json:"owner,omitempty"`
+	QuotaBytes  *int64 `json:"quotaBytes"`
+	Tier        string `json:"tier,omitempty"`
+}
+
+// SuspensionRequest is the request body for updating account suspension
+type SuspensionRequest struct {
+	Suspended *bool  `json:"suspended"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// SuspensionResponse is the response body for account suspension updates
+type SuspensionResponse struct {
+	AccountID       string `json:"accountId"`
+	Suspended       bool   `json:"suspended"`
+	SuspendedAt     string `json:"suspendedAt,omitempty"`
+	SuspendedReason string `json:"suspendedReason,omitempty"`
+}
+
+// WritesRequest is the request body for disabling or re-enabling writes to
+// an account
+type WritesRequest struct {
+	WritesDisabled *bool  `json:"writesDisabled"`
+	Reason         string `json:"reason,omitempty"`
+}
+
+// WritesResponse is the response body for account write updates
+type WritesResponse struct {
+	AccountID            string `json:"accountId"`
+	WritesDisabled       bool   `json:"writesDisabled"`
+	WritesDisabledAt     string `json:"writesDisabledAt,omitempty"`
+	WritesDisabledReason string `json:"writesDisabledReason,omitempty"`
+}
+
+// CapabilitiesRequest is the request body for replacing an account's
+// capability overrides. An empty object removes them.
+type CapabilitiesRequest struct {
+	CapabilityOverrides map[string]map[string]any `json:"capabilityOverrides"`
+}
+
+// CapabilitiesResponse is the response body for capability override updates
+type CapabilitiesResponse struct {
+	AccountID           string                    `json:"accountId"`
+	CapabilityOverrides map[string]map[string]any `json:"capabilityOverrides"`
+}
+
+// QuotaRequest is the request body for updating an account's quota.
+// Exactly one of QuotaBytes or Tier must be set.
+type QuotaRequest struct {
+	QuotaBytes *int64 `json:"quotaBytes"`
+	Tier       string `json:"tier,omitempty"`
+}
+
+// QuotaResponse is the response body for account quota updates
+type QuotaResponse struct {
+	AccountID          string `json:"accountId"`
+	Tier               string `json:"tier,omitempty"`
+	QuotaBytes         int64  `json:"quotaBytes"`
+	QuotaRemaining     int64  `json:"quotaRemaining"`
+	PreviousQuotaBytes int64  `json:"previousQuotaBytes"`
+}
+
+// ImportRequest is the request body for starting an account import
+type ImportRequest struct {
+	BlobID string `json:"blobId"`
+}
+
+// BackfillRequest is the request body for backfilling existing objects
+type BackfillRequest struct {
+	Objects []blobbackfill.Object `json:"objects"`
+}
+
+// BackfillResponse is the response body for a backfill, with a result for
+// each object in request order
+type BackfillResponse struct {
+	AccountID string                `json:"accountId"`
+	Results   []blobbackfill.Result `json:"results"`
+}
+
+// AliasList is the response body for listing an account's aliases
+type AliasList struct {
+	AccountID string          `json:"accountId"`
+	Aliases   []account.Alias `json:"aliases"`
+}
+
+// APIKeyRequest is the request body for creating an API key
+type APIKeyRequest struct {
+	Name   string   `json:"name,omitempty"`
+	Scopes []string `json:"scopes"`
+}
+
+// CreatedAPIKey is the response body for a new API key. Secret is the key
+// itself, which is only returned here and cannot be retrieved again.
+type CreatedAPIKey struct {
+	apikey.Key
+	Secret string `json:"key"`
+}
+
+// APIKeyList is the response body for listing an account's API keys
+type APIKeyList struct {
+	AccountID string       `json:"accountId"`
+	APIKeys   []apikey.Key `json:"apiKeys"`
+}
+
+// BindingList is the response body for listing a principal's bindings
+type BindingList struct {
+	PrincipalARN string   `json:"principalArn"`
+	AccountIDs   []string `json:"accountIds"`
+}
+
+// PluginLatencyList is the response body for plugin latency statistics
+type PluginLatencyList struct {
+	Targets []pluginlatency.TargetSummary `json:"targets"`
+}
+
+// ErrorResponse is the error response format
+type ErrorResponse struct {
+	Type        string `json:"type"`
+	Code        string `json:"code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Response is the API Gateway proxy response
+type Response struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Accounts       AccountStore
+	EventPublisher EventPublisher
+	Importer       Importer
+	// Backfiller is nil when no blob bucket is configured, disabling the
+	// backfill route
+	Backfiller      Backfiller
+	APIKeys         APIKeyStore
+	Bindings        BindingStore
+	PluginLatency   PluginLatencyReader
+	Registry        PluginRegistry
+	QuotaTiers      account.Tiers
+	DefaultQuota    int64
+	AdminPrincipals []string
+	// AdminGroup is the Cognito group whose members may use the /admin
+	// routes; empty denies all Cognito admin access
+	AdminGroup string
+}
+
+var deps *Dependencies
+
+// Path prefixes of the IAM and Cognito admin routes. Cognito routes mirror a
+// subset of the IAM routes and are handled as the IAM route they mirror.
+const (
+	iamAdminPrefix     = "/admin-iam/"
+	cognitoAdminPrefix = "/admin/"
+)
+
+// Route keys for the admin API (HTTP method + API Gateway resource path)
+const (
+	routeListAccounts    = "GET /admin-iam/accounts"
+	routeCreateAccount   = "POST /admin-iam/accounts"
+	routeGetAccount      = "GET /admin-iam/accounts/{accountId}"
+	routeSetSuspension   = "PUT /admin-iam/accounts/{accountId}/suspension"
+	routeSetWrites       = "PUT /admin-iam/accounts/{accountId}/writes"
+	routeSetCapabilities = "PUT /admin-iam/accounts/{accountId}/capabilities"
+	routeSetQuota        = "PUT /admin-iam/accounts/{accountId}/quota"
+	routeStartImport     = "POST /admin-iam/accounts/{accountId}/imports"
+	routeGetImport       = "GET /admin-iam/accounts/{accountId}/imports/{importId}"
+	routeBackfill        = "POST /admin-iam/accounts/{accountId}/backfill"
+	routeListAliases     = "GET /admin-iam/accounts/{accountId}/aliases"
+	routePutAlias        = "PUT /admin-iam/accounts/{accountId}/aliases/{alias}"
+	routeDeleteAlias     = "DELETE /admin-iam/accounts/{accountId}/aliases/{alias}"
+	routeListAPIKeys     = "GET /admin-iam/accounts/{accountId}/api-keys"
+	routeCreateAPIKey    = "POST /admin-iam/accounts/{accountId}/api-keys"
+	routeRevokeAPIKey    = "DELETE /admin-iam/accounts/{accountId}/api-keys/{keyId}"
+	routeListBindings    = "GET /admin-iam/principal-bindings"
+	routePutBinding      = "PUT /admin-iam/accounts/{accountId}/principal-bindings"
+	routeDeleteBinding   = "DELETE /admin-iam/accounts/{accountId}/principal-bindings"
+	routePluginLatency   = "GET /admin-iam/plugins/latency"
+	routePluginRegistry  = "GET /admin-iam/plugins/registry"
+)
+
+// correlatedHandler gives each request a correlation ID and adds it to the
+// handler's response
+func correlatedHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(resp.Headers, correlationID)
+	return resp, err
+}
+
+// handler processes administrative account requests
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
+	ctx, span := tracing.StartHandlerSpan(ctx, "AccountAdminHandler",
+		tracing.Function("account-admin"),
+		tracing.RequestID(request.RequestContext.RequestID),
+	)
+	defer span.End()
+
+	// /admin-iam routes take admin IAM principals; /admin routes take
+	// members of the admin Cognito group
+	resource := request.Resource
+	callerPrincipal := extractCallerPrincipal(request)
+	if callerPrincipal == "" {
+		logger.WarnContext(ctx, "Admin request without caller identity",
+			slog.String("request_id", request.RequestContext.RequestID),
+		)
+		return errorResponse(401, "unauthorized", "Missing or invalid authentication")
+	}
+
+	if strings.HasPrefix(resource, cognitoAdminPrefix) {
+		if request.RequestContext.Identity.UserArn != "" || !auth.HasGroup(request.RequestContext.Authorizer, deps.AdminGroup) {
+			logger.WarnContext(ctx, "Unauthorized admin user",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("caller_principal", callerPrincipal),
+			)
+			return errorResponse(403, "forbidden", "User not authorized for admin access")
+		}
+		resource = iamAdminPrefix + strings.TrimPrefix(resource, cognitoAdminPrefix)
+	} else if !plugin.IsAllowedARN(deps.AdminPrincipals, callerPrincipal) {
+		logger.WarnContext(ctx, "Unauthorized admin principal",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("caller_principal", callerPrincipal),
+		)
+		return errorResponse(403, "forbidden", "Principal not authorized for admin access")
+	}
+
+	switch request.HTTPMethod + " " + resource {
+	case routeListAccounts:
+		return handleListAccounts(ctx, request)
+	case routeCreateAccount:
+		return handleCreateAccount(ctx, request)
+	case routeGetAccount:
+		return handleGetAccount(ctx, request)
+	case routeSetSuspension:
+		return handleSetSuspension(ctx, request)
+	case routeSetWrites:
+		return handleSetWrites(ctx, request)
+	case routeSetCapabilities:
+		return handleSetCapabilities(ctx, request)
+	case routeSetQuota:
+		return handleSetQuota(ctx, request)
+	case routeStartImport:
+		return handleStartImport(ctx, request)
+	case routeGetImport:
+		return handleGetImport(ctx, request)
+	case routeBackfill:
+		return handleBackfill(ctx, request)
+	case routeListAliases:
+		return handleListAliases(ctx, request)
+	case routePutAlias:
+		return handlePutAlias(ctx, request)
+	case routeDeleteAlias:
+		return handleDeleteAlias(ctx, request)
+	case routeListAPIKeys:
+		return handleListAPIKeys(ctx, request)
+	case routeCreateAPIKey:
+		return handleCreateAPIKey(ctx, request)
+	case routeRevokeAPIKey:
+		return handleRevokeAPIKey(ctx, request)
+	case routeListBindings:
+		return handleListBindings(ctx, request)
+	case routePutBinding:
+		return handlePutBinding(ctx, request)
+	case routeDeleteBinding:
+		return handleDeleteBinding(ctx, request)
+	case routePluginLatency:
+		return handlePluginLatency(ctx, request)
+	case routePluginRegistry:
+		return handlePluginRegistry(ctx, request)
+	default:
+		return errorResponse(404, "notFound", "Unknown admin route")
+	}
+}
+
+// handleListAccounts returns a page of accounts with their storage usage
+func handleListAccounts(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	limit := DefaultListLimit
+	if limitStr := request.QueryStringParameters["limit"]; limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 || parsed > MaxListLimit {
+			return errorResponse(400, "invalidArguments", "limit must be between 1 and "+strconv.Itoa(MaxListLimit))
+		}
+		limit = parsed
+	}
+
+	metas, nextCursor, err := deps.Accounts.ListMeta(ctx, int32(limit), request.QueryStringParameters["cursor"])
+	if err != nil {
+		if errors.Is(err, account.ErrInvalidCursor) {
+			return errorResponse(400, "invalidArguments", "Invalid cursor")
+		}
+		logger.ErrorContext(ctx, "Failed to list accounts",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to list accounts")
+	}
+
+	accounts := make([]AccountSummary, 0, len(metas))
+	for i := range metas {
+		usage, err := deps.Accounts.GetBlobUsage(ctx, metas[i].AccountID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to get blob usage",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", metas[i].AccountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(500, "serverFail", "Failed to get account usage")
+		}
+		accounts = append(accounts, buildSummary(&metas[i], usage))
+	}
+
+	return jsonResponse(200, AccountListResponse{
+		Accounts:   accounts,
+		NextCursor: nextCursor,
+	})
+}
+
+// handleCreateAccount provisions an account that has no Cognito user, such as
+// a shared mailbox or an ingestion-only account, and publishes account.created
+func handleCreateAccount(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	var req ProvisionRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if !account.IsValidID(req.AccountID) {
+		return errorResponse(400, "invalidArguments", "accountId must be 1-128 letters, digits, '.', '_' or '-'")
+	}
+
+	quotaBytes, problem := resolveQuota(req.QuotaBytes, req.Tier)
+	if problem != "" {
+		return errorResponse(400, "invalidArguments", problem)
+	}
+
+	accountType := req.AccountType
+	if accountType == "" {
+		accountType = DefaultProvisionedAccountType
+	}
+
+	meta, err := deps.Accounts.CreateMeta(ctx, account.Meta{
+		AccountID:             req.AccountID,
+		AccountType:           accountType,
+		Owner:                 req.Owner,
+		Tier:                  req.Tier,
+		QuotaBytes:            quotaBytes,
+		MaxPendingAllocations: deps.QuotaTiers[req.Tier].MaxPendingAllocations,
+	})
+	if err != nil {
+		if errors.Is(err, account.ErrAccountExists) {
+			return errorResponse(409, "conflict", "Account already exists")
+		}
+		logger.ErrorContext(ctx, "Failed to provision account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", req.AccountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to create account")
+	}
+
+	logger.InfoContext(ctx, "Account provisioned",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", meta.AccountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("account_type", meta.AccountType),
+		slog.Int64("quota_bytes", meta.QuotaBytes),
+	)
+
+	eventPayload := publisher.EventPayload{
+		EventType:     publisher.EventAccountCreated,
+		OccurredAt:    time.Now().UTC().Format(time.RFC3339),
+		CorrelationID: correlation.FromContext(ctx),
+		AccountID:     meta.AccountID,
+		Data: map[string]any{
+			"quotaBytes":  meta.QuotaBytes,
+			"accountType": meta.AccountType,
+		},
+	}
+	if meta.Tier != "" {
+		eventPayload.Data["tier"] = meta.Tier
+	}
+	if err := deps.EventPublisher.Publish(ctx, eventPayload); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish account.created event",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", meta.AccountID),
+			slog.String("error", err.Error()),
+		)
+		// The account exists; don't fail the request
+	}
+
+	detail := AccountDetail{
+		AccountSummary: buildSummary(meta, &account.BlobUsage{}),
+		Owner:          meta.Owner,
+	}
+	return jsonResponse(201, detail)
+}
+
+// handleGetAccount returns a single account with a per-status blob breakdown
+func handleGetAccount(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	meta, err := deps.Accounts.GetMeta(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get account meta",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to get account")
+	}
+	if meta == nil {
+		return errorResponse(404, "notFound", "Account not found")
+	}
+
+	usage, err := deps.Accounts.GetBlobUsage(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get blob usage",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to get account usage")
+	}
+
+	return jsonResponse(200, AccountDetail{
+		AccountSummary:       buildSummary(meta, usage),
+		Owner:                meta.Owner,
+		SuspendedAt:          meta.SuspendedAt,
+		SuspendedReason:      meta.SuspendedReason,
+		WritesDisabledAt:     meta.WritesDisabledAt,
+		WritesDisabledReason: meta.WritesDisabledReason,
+		CapabilityOverrides:  meta.CapabilityOverrides,
+		QuotaGraceExpiresAt:  meta.QuotaGraceExpiresAt,
+		LastActivityAt:       meta.LastActivityAt,
+		InactiveAt:           meta.InactiveAt,
+		DeletionScheduledAt:  meta.DeletionScheduledAt,
+		ConfirmedBlobs:       usage.ConfirmedCount,
+		ConfirmedBlobBytes:   usage.ConfirmedBytes,
+		PendingBlobs:         usage.PendingCount,
+		DeletedBlobs:         usage.DeletedCount,
+	})
+}
+
+// buildSummary combines an account's META# record and blob usage.
+// usedBytes is derived from the quota counters so it includes reserved allocations.
+func buildSummary(meta *account.Meta, usage *account.BlobUsage) AccountSummary {
+	return AccountSummary{
+		AccountID:          meta.AccountID,
+		AccountType:        meta.AccountType,
+		Tier:               meta.Tier,
+		QuotaBytes:         meta.QuotaBytes,
+		QuotaRemaining:     meta.QuotaRemaining,
+		UsedBytes:          meta.QuotaBytes - meta.QuotaRemaining,
+		BlobCount:          usage.Count,
+		PendingAllocations: meta.PendingAllocationsCount,
+		MaxPendingAllocs:   meta.MaxPendingAllocations,
+		Suspended:          meta.Suspended,
+		WritesDisabled:     meta.WritesDisabled,
+		CreatedAt:          meta.CreatedAt,
+		UpdatedAt:          meta.UpdatedAt,
+		LastAccessAt:       meta.LastDiscoveryAccess,
+	}
+}
+
+// handleSetSuspension sets or clears the suspended flag on an account
+func handleSetSuspension(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req SuspensionRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if req.Suspended == nil {
+		return errorResponse(400, "invalidArguments", "suspended is required")
+	}
+
+	meta, err := deps.Accounts.SetSuspended(ctx, accountID, *req.Suspended, req.Reason)
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to update account suspension",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to update account")
+	}
+
+	logger.InfoContext(ctx, "Account suspension updated",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.Bool("suspended", meta.Suspended),
+	)
+
+	return jsonResponse(200, SuspensionResponse{
+		AccountID:       accountID,
+		Suspended:       meta.Suspended,
+		SuspendedAt:     meta.SuspendedAt,
+		SuspendedReason: meta.SuspendedReason,
+	})
+}
+
+// handleSetWrites disables or re-enables writes to an account. While writes
+// are disabled uploads and write methods are refused, but reads and
+// downloads still work.
+func handleSetWrites(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req WritesRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if req.WritesDisabled == nil {
+		return errorResponse(400, "invalidArguments", "writesDisabled is required")
+	}
+
+	meta, err := deps.Accounts.SetWritesDisabled(ctx, accountID, *req.WritesDisabled, req.Reason)
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to update account writes",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to update account")
+	}
+
+	logger.InfoContext(ctx, "Account writes updated",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.Bool("writes_disabled", meta.WritesDisabled),
+	)
+
+	return jsonResponse(200, WritesResponse{
+		AccountID:            accountID,
+		WritesDisabled:       meta.WritesDisabled,
+		WritesDisabledAt:     meta.WritesDisabledAt,
+		WritesDisabledReason: meta.WritesDisabledReason,
+	})
+}
+
+// handleSetCapabilities replaces the settings an account's session
+// accountCapabilities are overridden with
+func handleSetCapabilities(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req CapabilitiesRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if req.CapabilityOverrides == nil {
+		return errorResponse(400, "invalidArguments", "capabilityOverrides is required")
+	}
+	for capability, settings := range req.CapabilityOverrides {
+		if capability == "" || settings == nil {
+			return errorResponse(400, "invalidArguments", "capabilityOverrides must map capability URIs to objects")
+		}
+	}
+
+	meta, err := deps.Accounts.SetCapabilityOverrides(ctx, accountID, req.CapabilityOverrides)
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to update account capability overrides",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to update account")
+	}
+
+	logger.InfoContext(ctx, "Account capability overrides updated",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.Int("capabilities", len(meta.CapabilityOverrides)),
+	)
+
+	overrides := meta.CapabilityOverrides
+	if overrides == nil {
+		overrides = map[string]map[string]any{}
+	}
+	return jsonResponse(200, CapabilitiesResponse{
+		AccountID:           accountID,
+		CapabilityOverrides: overrides,
+	})
+}
+
+// handleSetQuota changes an account's quota, either to an explicit size or to
+// a configured tier preset, and publishes a quota.updated event
+func handleSetQuota(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req QuotaRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+
+	if req.QuotaBytes == nil && req.Tier == "" {
+		return errorResponse(400, "invalidArguments", "quotaBytes or tier is required")
+	}
+	quotaBytes, problem := resolveQuota(req.QuotaBytes, req.Tier)
+	if problem != "" {
+		return errorResponse(400, "invalidArguments", problem)
+	}
+
+	change, err := deps.Accounts.SetQuota(ctx, accountID, quotaBytes, req.Tier, deps.QuotaTiers[req.Tier].MaxPendingAllocations)
+	if err != nil {
+		if errors.Is(err, account.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		if errors.Is(err, account.ErrConcurrentUpdate) {
+			return errorResponse(409, "conflict", "Account was modified concurrently, retry the request")
+		}
+		logger.ErrorContext(ctx, "Failed to update account quota",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to update account")
+	}
+
+	logger.InfoContext(ctx, "Account quota updated",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.Int64("quota_bytes", change.Meta.QuotaBytes),
+		slog.Int64("previous_quota_bytes", change.PreviousQuotaBytes),
+	)
+
+	eventPayload := publisher.EventPayload{
+		EventType:     publisher.EventQuotaUpdated,
+		OccurredAt:    time.Now().UTC().Format(time.RFC3339),
+		CorrelationID: correlation.FromContext(ctx),
+		AccountID:     accountID,
+		Data: map[string]any{
+			"quotaBytes":         change.Meta.QuotaBytes,
+			"quotaRemaining":     change.Meta.QuotaRemaining,
+			"previousQuotaBytes": change.PreviousQuotaBytes,
+		},
+	}
+	if change.Meta.Tier != "" {
+		eventPayload.Data["tier"] = change.Meta.Tier
+	}
+	if err := deps.EventPublisher.Publish(ctx, eventPayload); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish quota.updated event",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		// The quota change has been applied; don't fail the request
+	}
+
+	return jsonResponse(200, QuotaResponse{
+		AccountID:          accountID,
+		Tier:               change.Meta.Tier,
+		QuotaBytes:         change.Meta.QuotaBytes,
+		QuotaRemaining:     change.Meta.QuotaRemaining,
+		PreviousQuotaBytes: change.PreviousQuotaBytes,
+	})
+}
+
+// handleStartImport starts restoring an export archive into an account.
+// Starting an import that already exists returns its progress, resuming it
+// if it had failed.
+func handleStartImport(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req ImportRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if req.BlobID == "" {
+		return errorResponse(400, "invalidArguments", "blobId is required")
+	}
+
+	job, err := deps.Importer.Start(ctx, accountID, req.BlobID)
+	if err != nil {
+		return importErrorResponse(ctx, request, accountID, err)
+	}
+
+	logger.InfoContext(ctx, "Account import requested",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("import_id", job.ImportID),
+		slog.String("status", job.Status),
+	)
+
+	statusCode := 200
+	if job.Status == accountimport.StatusPending {
+		statusCode = 202
+	}
+	return jsonResponse(statusCode, job)
+}
+
+// handleGetImport returns an import job's status and progress
+func handleGetImport(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	importID := request.PathParameters["importId"]
+	if accountID == "" || importID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId or importId in path")
+	}
+
+	job, err := deps.Importer.Get(ctx, accountID, importID)
+	if err != nil {
+		return importErrorResponse(ctx, request, accountID, err)
+	}
+	return jsonResponse(200, job)
+}
+
+// importErrorResponse maps an import error to an HTTP response
+func importErrorResponse(ctx context.Context, request events.APIGatewayProxyRequest, accountID string, err error) (Response, error) {
+	var importErr *accountimport.ImportError
+	if errors.As(err, &importErr) && importErr.Type == "notFound" {
+		return errorResponse(404, "notFound", importErr.Message)
+	}
+	logger.ErrorContext(ctx, "Account import request failed",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("error", err.Error()),
+	)
+	return errorResponse(500, "serverFail", "Failed to process import")
+}
+
+// handleBackfill registers existing S3 objects as blobs of an account. Each
+// object's result reports its blob or why it was not registered; objects
+// already registered are reported as existing, so a failed batch can be sent
+// again.
+func handleBackfill(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	if deps.Backfiller == nil {
+		return errorResponse(404, "notFound", "Backfill is not enabled")
+	}
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req BackfillRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if len(req.Objects) == 0 {
+		return errorResponse(400, "invalidArguments", "objects is required")
+	}
+	if len(req.Objects) > MaxBackfillObjects {
+		return errorResponse(400, "invalidArguments", fmt.Sprintf("At most %d objects may be backfilled per request", MaxBackfillObjects))
+	}
+
+	results, err := deps.Backfiller.Import(ctx, accountID, req.Objects)
+	if errors.Is(err, store.ErrAccountNotProvisioned) {
+		return errorResponse(404, "notFound", "Account not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Backfill failed",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to backfill objects")
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Error != nil {
+			failed++
+		}
+	}
+	logger.InfoContext(ctx, "Objects backfilled",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.Int("objects", len(results)),
+		slog.Int("failed", failed),
+	)
+	return jsonResponse(200, BackfillResponse{AccountID: accountID, Results: results})
+}
+
+// handleListAliases returns the aliases registered for an account
+func handleListAliases(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	aliases, err := deps.Accounts.ListAliases(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list account aliases",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to list aliases")
+	}
+
+	return jsonResponse(200, AliasList{AccountID: accountID, Aliases: aliases})
+}
+
+// handlePutAlias registers an alias for an account. Aliases must contain '@'
+// and are stored lowercased; an alias already registered to any account
+// returns 409.
+func handlePutAlias(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	alias := request.PathParameters["alias"]
+	if accountID == "" || alias == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId or alias in path")
+	}
+	if !account.IsValidAlias(alias) {
+		return errorResponse(400, "invalidArguments", "alias must contain '@' and no whitespace or '/'")
+	}
+
+	created, err := deps.Accounts.PutAlias(ctx, accountID, alias)
+	if err != nil {
+		switch {
+		case errors.Is(err, account.ErrAccountNotFound):
+			return errorResponse(404, "notFound", "Account not found")
+		case errors.Is(err, account.ErrAliasExists):
+			return errorResponse(409, "conflict", "Alias already exists")
+		}
+		logger.ErrorContext(ctx, "Failed to create account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to create alias")
+	}
+
+	logger.InfoContext(ctx, "Account alias created",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("alias", created.Alias),
+	)
+
+	return jsonResponse(201, created)
+}
+
+// handleDeleteAlias removes an alias from an account
+func handleDeleteAlias(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	alias := request.PathParameters["alias"]
+	if accountID == "" || alias == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId or alias in path")
+	}
+
+	if err := deps.Accounts.DeleteAlias(ctx, accountID, alias); err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			return errorResponse(404, "notFound", "Alias not found")
+		}
+		logger.ErrorContext(ctx, "Failed to delete account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to delete alias")
+	}
+
+	logger.InfoContext(ctx, "Account alias deleted",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("alias", account.NormalizeAlias(alias)),
+	)
+
+	return Response{
+		StatusCode: 204,
+		Headers:    map[string]string{},
+		Body:       "",
+	}, nil
+}
+
+// handleListAPIKeys returns the API keys created for an account, including
+// revoked keys. Keys themselves are never returned.
+func handleListAPIKeys(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	keys, err := deps.APIKeys.List(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list API keys",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to list API keys")
+	}
+
+	return jsonResponse(200, APIKeyList{AccountID: accountID, APIKeys: keys})
+}
+
+// handleCreateAPIKey mints an API key for an account with the requested
+// scopes. The key is in the response and cannot be retrieved again.
+func handleCreateAPIKey(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+
+	var req APIKeyRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+	if len(req.Scopes) == 0 {
+		return errorResponse(400, "invalidArguments", "scopes is required")
+	}
+	for _, scope := range req.Scopes {
+		if !apikey.IsValidScope(scope) {
+			return errorResponse(400, "invalidArguments", "Unknown scope: "+scope)
+		}
+	}
+
+	key, token, err := deps.APIKeys.Create(ctx, accountID, req.Name, req.Scopes)
+	if err != nil {
+		if errors.Is(err, apikey.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to create API key",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to create API key")
+	}
+
+	logger.InfoContext(ctx, "API key created",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("api_key_id", key.KeyID),
+		slog.String("scopes", strings.Join(key.Scopes, ",")),
+	)
+
+	return jsonResponse(201, CreatedAPIKey{Key: *key, Secret: token})
+}
+
+// handleRevokeAPIKey revokes an account's API key. Revocation takes effect
+// on the key's next request.
+func handleRevokeAPIKey(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	keyID := request.PathParameters["keyId"]
+	if accountID == "" || keyID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId or keyId in path")
+	}
+
+	if err := deps.APIKeys.Revoke(ctx, accountID, keyID); err != nil {
+		if errors.Is(err, apikey.ErrKeyNotFound) {
+			return errorResponse(404, "notFound", "API key not found")
+		}
+		logger.ErrorContext(ctx, "Failed to revoke API key",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to revoke API key")
+	}
+
+	logger.InfoContext(ctx, "API key revoked",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("api_key_id", keyID),
+	)
+
+	return Response{
+		StatusCode: 204,
+		Headers:    map[string]string{},
+		Body:       "",
+	}, nil
+}
+
+// handleListBindings returns the accounts a principal is bound to. An empty
+// list means the principal is not restricted to any account.
+func handleListBindings(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	principalARN := request.QueryStringParameters["principalArn"]
+	if principalARN == "" {
+		return errorResponse(400, "invalidArguments", "principalArn is required")
+	}
+
+	accountIDs, err := deps.Bindings.List(ctx, principalARN)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list principal bindings",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("principal_arn", principalARN),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to list principal bindings")
+	}
+
+	return jsonResponse(200, BindingList{PrincipalARN: plugin.NormalizeARN(principalARN), AccountIDs: accountIDs})
+}
+
+// handlePluginLatency returns each plugin invoke target's recent latency, as
+// flushed by the jmap-api instances that called it
+func handlePluginLatency(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	stats, err := deps.PluginLatency.List(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list plugin latency",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to list plugin latency")
+	}
+
+	return jsonResponse(200, PluginLatencyList{Targets: pluginlatency.Summarize(stats)})
+}
+
+// handlePluginRegistry returns what the plugin registry contains: the
+// capabilities, method targets, event subscriptions and principals it
+// serves, with when and from where it was loaded. With refresh=true it first
+// reloads the registry from DynamoDB, as jmap-api instances do in the
+// background, to show what they will converge on.
+func handlePluginRegistry(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	switch request.QueryStringParameters["refresh"] {
+	case "", "false":
+	case "true":
+		if err := deps.Registry.Refresh(ctx); err != nil {
+			logger.ErrorContext(ctx, "Failed to refresh plugin registry",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(500, "serverFail", "Failed to refresh plugin registry")
+		}
+	default:
+		return errorResponse(400, "invalidArguments", "refresh must be true or false")
+	}
+
+	return jsonResponse(200, deps.Registry.Inspect())
+}
+
+// handlePutBinding binds a principal to an account. Once bound, the principal
+// may only act on the accounts it is bound to.
+func handlePutBinding(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+	principalARN := request.QueryStringParameters["principalArn"]
+	if !strings.HasPrefix(principalARN, "arn:") {
+		return errorResponse(400, "invalidArguments", "principalArn must be an ARN")
+	}
+
+	created, err := deps.Bindings.Put(ctx, principalARN, accountID)
+	if err != nil {
+		if errors.Is(err, binding.ErrAccountNotFound) {
+			return errorResponse(404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to create principal binding",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to create principal binding")
+	}
+
+	logger.InfoContext(ctx, "Principal binding created",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("principal_arn", created.PrincipalARN),
+	)
+
+	return jsonResponse(201, created)
+}
+
+// handleDeleteBinding removes a principal's binding to an account. Removing
+// the last binding leaves the principal unrestricted.
+func handleDeleteBinding(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	accountID := request.PathParameters["accountId"]
+	if accountID == "" {
+		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+	}
+	principalARN := request.QueryStringParameters["principalArn"]
+	if principalARN == "" {
+		return errorResponse(400, "invalidArguments", "principalArn is required")
+	}
+
+	if err := deps.Bindings.Delete(ctx, principalARN, accountID); err != nil {
+		if errors.Is(err, binding.ErrBindingNotFound) {
+			return errorResponse(404, "notFound", "Principal binding not found")
+		}
+		logger.ErrorContext(ctx, "Failed to delete principal binding",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to delete principal binding")
+	}
+
+	logger.InfoContext(ctx, "Principal binding deleted",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("caller_principal", extractCallerPrincipal(request)),
+		slog.String("principal_arn", plugin.NormalizeARN(principalARN)),
+	)
+
+	return Response{
+		StatusCode: 204,
+		Headers:    map[string]string{},
+		Body:       "",
+	}, nil
+}
+
+// resolveQuota returns the quota for an explicit size or a tier preset, or
+// the default quota when neither is given. A non-empty problem describes an
+// invalid request.
+func resolveQuota(quotaBytes *int64, tier string) (int64, string) {
+	switch {
+	case quotaBytes != nil && tier != "":
+		return 0, "Specify only one of quotaBytes or tier"
+	case quotaBytes != nil:
+		if *quotaBytes <= 0 {
+			return 0, "quotaBytes must be positive"
+		}
+		return *quotaBytes, ""
+	case tier != "":
+		preset, ok := deps.QuotaTiers[tier]
+		if !ok {
+			return 0, "Unknown tier"
+		}
+		return preset.QuotaBytes, ""
+	default:
+		return deps.DefaultQuota, ""
+	}
+}
+
+// extractCallerPrincipal extracts the caller's IAM principal ARN from the
+// request, or "cognito:{sub}" for a Cognito user
+func extractCallerPrincipal(request events.APIGatewayProxyRequest) string {
+	if arn := request.RequestContext.Identity.UserArn; arn != "" {
+		return arn
+	}
+	if sub, err := auth.AccountIDFromAuthorizer(request.RequestContext.Authorizer, auth.DefaultAccountIDClaim); err == nil {
+		return "cognito:" + sub
+	}
+	return ""
+}
+
+// jsonResponse builds a JSON success response
+func jsonResponse(statusCode int, body any) (Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errorResponse(500, "serverFail", "Failed to build response")
+	}
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(data),
+	}, nil
+}
+
+// errorResponse builds an error response with the error type's code
+func errorResponse(statusCode int, errorType, description string) (Response, error) {
+	body, _ := json.Marshal(ErrorResponse{Type: errorType, Code: string(errcode.ForType(errorType)), Description: description})
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}, nil
+}
+
+// loadedRegistry is the plugin registry with the table it is refreshed from
+type loadedRegistry struct {
+	*plugin.Registry
+	querier plugin.PluginQuerier
+}
+
+// Refresh reloads the registry from its table
+func (r loadedRegistry) Refresh(ctx context.Context) error {
+	return r.Registry.Refresh(ctx, r.querier)
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx, awsinit.WithHTTPHandler("account-admin"))
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadAccountAdmin(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+	quotaTiers := cfg.QuotaTiers
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+	accounts := account.NewDynamoDBStore(dynamoClient, tableName)
+
+	// Tiers in the CONFIG# record override environment tiers of the same name
+	configTiers, err := accounts.LoadTiers(result.Ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to load quota tiers config",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	quotaTiers = quotaTiers.Merge(configTiers)
+
+	// Load plugin registry for event publishing
+	dbClient := db.NewClientFromConfig(result.Config, tableName)
+
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	eventPublisher := publisher.FromConfig(result.Config, registry).
+		WithDeadLetters(deadletter.NewDynamoDBStore(dynamoClient, tableName)).
+		WithEventLog(eventlog.NewDynamoDBStore(dynamoClient, tableName))
+
+	// Backfill copies objects into the blob bucket, so is only enabled with one
+	var backfiller Backfiller
+	if cfg.Bucket != "" {
+		metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+		blobStore := store.NewBlobStore(dynamoClient, tableName).WithEncryption(metadataEnvelope)
+		if cfg.ScanBlobs {
+			blobStore = blobStore.WithScanRequests()
+		}
+		backfiller = &blobbackfill.Handler{
+			DB:      blobStore,
+			Storage: blobbackfill.NewS3Storage(s3.NewFromConfig(result.Config), cfg.Bucket),
+		}
+	}
+
+	deps = &Dependencies{
+		Accounts:        accounts,
+		EventPublisher:  eventPublisher,
+		Importer:        &accountimport.Handler{DB: accountimport.NewDynamoDBStore(dynamoClient, tableName)},
+		Backfiller:      backfiller,
+		APIKeys:         apikey.NewDynamoDBStore(dynamoClient, tableName),
+		Bindings:        binding.NewDynamoDBStore(dynamoClient, tableName),
+		PluginLatency:   pluginlatency.NewDynamoDBStore(dynamoClient, tableName),
+		Registry:        loadedRegistry{Registry: registry, querier: dbClient},
+		QuotaTiers:      quotaTiers,
+		DefaultQuota:    cfg.DefaultQuota,
+		AdminPrincipals: cfg.AdminPrincipals,
+		AdminGroup:      cfg.AdminGroup,
+	}
+
+	result.Start(correlatedHandler)
+}
@@ -0,0 +1,1722 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountimport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/apikey"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobbackfill"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/pluginlatency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const testAdminARN = "arn:aws:iam::123456789012:role/AdminRole"
+
+type mockAccountStore struct {
+	metas            map[string]*account.Meta
+	usage            map[string]*account.BlobUsage
+	nextCursor       string
+	listErr          error
+	lastLimit        int32
+	lastCursor       string
+	setSuspendedFunc func(ctx context.Context, accountID string, suspended bool, reason string) (*account.Meta, error)
+	lastAccountID    string
+	lastSuspended    bool
+	lastReason       string
+	setWritesFunc    func(ctx context.Context, accountID string, disabled bool, reason string) (*account.Meta, error)
+	lastWritesOff    bool
+	lastOverrides    map[string]map[string]any
+	setQuotaFunc     func(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPending int) (*account.QuotaChange, error)
+	lastQuotaBytes   int64
+	lastTier         string
+	lastMaxPending   int
+	createdMeta      *account.Meta
+	createErr        error
+	aliases          []account.Alias
+	aliasErr         error
+	lastAlias        string
+}
+
+func (m *mockAccountStore) ListAliases(ctx context.Context, accountID string) ([]account.Alias, error) {
+	return m.aliases, m.aliasErr
+}
+
+func (m *mockAccountStore) PutAlias(ctx context.Context, accountID, alias string) (*account.Alias, error) {
+	m.lastAccountID = accountID
+	m.lastAlias = alias
+	if m.aliasErr != nil {
+		return nil, m.aliasErr
+	}
+	return &account.Alias{Alias: account.NormalizeAlias(alias), AccountID: accountID, CreatedAt: "2025-01-01T00:00:00Z"}, nil
+}
+
+func (m *mockAccountStore) DeleteAlias(ctx context.Context, accountID, alias string) error {
+	m.lastAccountID = accountID
+	m.lastAlias = alias
+	return m.aliasErr
+}
+
+func (m *mockAccountStore) CreateMeta(ctx context.Context, meta account.Meta) (*account.Meta, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	meta.QuotaRemaining = meta.QuotaBytes
+	m.createdMeta = &meta
+	return &meta, nil
+}
+
+func (m *mockAccountStore) GetMeta(ctx context.Context, accountID string) (*account.Meta, error) {
+	return m.metas[accountID], nil
+}
+
+func (m *mockAccountStore) ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error) {
+	m.lastLimit = limit
+	m.lastCursor = cursor
+	if m.listErr != nil {
+		return nil, "", m.listErr
+	}
+	var metas []account.Meta
+	for _, meta := range m.metas {
+		metas = append(metas, *meta)
+	}
+	return metas, m.nextCursor, nil
+}
+
+func (m *mockAccountStore) GetBlobUsage(ctx context.Context, accountID string) (*account.BlobUsage, error) {
+	if usage, ok := m.usage[accountID]; ok {
+		return usage, nil
+	}
+	return &account.BlobUsage{}, nil
+}
+
+func (m *mockAccountStore) SetSuspended(ctx context.Context, accountID string, suspended bool, reason string) (*account.Meta, error) {
+	m.lastAccountID = accountID
+	m.lastSuspended = suspended
+	m.lastReason = reason
+	if m.setSuspendedFunc != nil {
+		return m.setSuspendedFunc(ctx, accountID, suspended, reason)
+	}
+	meta := &account.Meta{AccountID: accountID, Suspended: suspended}
+	if suspended {
+		meta.SuspendedAt = "2025-01-01T00:00:00Z"
+		meta.SuspendedReason = reason
+	}
+	return meta, nil
+}
+
+func (m *mockAccountStore) SetWritesDisabled(ctx context.Context, accountID string, disabled bool, reason string) (*account.Meta, error) {
+	m.lastAccountID = accountID
+	m.lastWritesOff = disabled
+	m.lastReason = reason
+	if m.setWritesFunc != nil {
+		return m.setWritesFunc(ctx, accountID, disabled, reason)
+	}
+	meta := &account.Meta{AccountID: accountID, WritesDisabled: disabled}
+	if disabled {
+		meta.WritesDisabledAt = "2025-01-01T00:00:00Z"
+		meta.WritesDisabledReason = reason
+	}
+	return meta, nil
+}
+
+func (m *mockAccountStore) SetCapabilityOverrides(ctx context.Context, accountID string, overrides map[string]map[string]any) (*account.Meta, error) {
+	m.lastAccountID = accountID
+	m.lastOverrides = overrides
+	if _, ok := m.metas[accountID]; !ok && m.metas != nil {
+		return nil, account.ErrAccountNotFound
+	}
+	meta := &account.Meta{AccountID: accountID}
+	if len(overrides) > 0 {
+		meta.CapabilityOverrides = overrides
+	}
+	return meta, nil
+}
+
+func (m *mockAccountStore) SetQuota(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPending int) (*account.QuotaChange, error) {
+	m.lastAccountID = accountID
+	m.lastQuotaBytes = quotaBytes
+	m.lastTier = tier
+	m.lastMaxPending = maxPending
+	if m.setQuotaFunc != nil {
+		return m.setQuotaFunc(ctx, accountID, quotaBytes, tier, maxPending)
+	}
+	return &account.QuotaChange{
+		Meta:               &account.Meta{AccountID: accountID, Tier: tier, QuotaBytes: quotaBytes, QuotaRemaining: quotaBytes - 100},
+		PreviousQuotaBytes: 1000,
+	}, nil
+}
+
+type mockEventPublisher struct {
+	published  []publisher.EventPayload
+	publishErr error
+}
+
+func (m *mockEventPublisher) Publish(ctx context.Context, payload publisher.EventPayload) error {
+	m.published = append(m.published, payload)
+	return m.publishErr
+}
+
+type mockImporter struct {
+	jobs        map[string]*accountimport.Job
+	startErr    error
+	lastBlobID  string
+	lastAccount string
+}
+
+func (m *mockImporter) Start(ctx context.Context, accountID, archiveBlobID string) (*accountimport.Job, error) {
+	m.lastAccount = accountID
+	m.lastBlobID = archiveBlobID
+	if m.startErr != nil {
+		return nil, m.startErr
+	}
+	if job, ok := m.jobs[archiveBlobID]; ok {
+		return job, nil
+	}
+	return &accountimport.Job{AccountID: accountID, ImportID: archiveBlobID, Status: accountimport.StatusPending}, nil
+}
+
+func (m *mockImporter) Get(ctx context.Context, accountID, importID string) (*accountimport.Job, error) {
+	job, ok := m.jobs[importID]
+	if !ok {
+		return nil, &accountimport.ImportError{Type: "notFound", Message: "import not found"}
+	}
+	return job, nil
+}
+
+type mockBackfiller struct {
+	objects     []blobbackfill.Object
+	lastAccount string
+	err         error
+}
+
+func (m *mockBackfiller) Import(ctx context.Context, accountID string, objects []blobbackfill.Object) ([]blobbackfill.Result, error) {
+	m.lastAccount = accountID
+	m.objects = objects
+	if m.err != nil {
+		return nil, m.err
+	}
+	results := make([]blobbackfill.Result, len(objects))
+	for i, object := range objects {
+		results[i] = blobbackfill.Result{Bucket: object.Bucket, Key: object.Key, BlobID: "blob-" + object.Key}
+	}
+	return results, nil
+}
+
+func setupTestDeps(store *mockAccountStore) {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	deps = &Dependencies{
+		Accounts:        store,
+		EventPublisher:  &mockEventPublisher{},
+		Importer:        &mockImporter{},
+		APIKeys:         &mockAPIKeyStore{},
+		Bindings:        &mockBindingStore{},
+		PluginLatency:   &mockPluginLatencyReader{},
+		Registry:        &mockPluginRegistry{registry: plugin.NewRegistry()},
+		QuotaTiers:      account.Tiers{"pro": {QuotaBytes: 5000, MaxPendingAllocations: 7}},
+		DefaultQuota:    1000,
+		AdminPrincipals: []string{testAdminARN},
+	}
+}
+
+func suspensionRequest(callerARN, accountID, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: "PUT",
+		Resource:   "/admin-iam/accounts/{accountId}/suspension",
+		PathParameters: map[string]string{
+			"accountId": accountID,
+		},
+		Body: body,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-admin",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: callerARN,
+			},
+		},
+	}
+}
+
+// Test: Admin can suspend an account
+func TestSetSuspension_Suspend_Returns200(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, err := handler(context.Background(), suspensionRequest(testAdminARN, "user-123", `{"suspended":true,"reason":"abuse"}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastAccountID != "user-123" || !store.lastSuspended || store.lastReason != "abuse" {
+		t.Errorf("unexpected store call: %s %v %s", store.lastAccountID, store.lastSuspended, store.lastReason)
+	}
+
+	var resp SuspensionResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !resp.Suspended || resp.SuspendedReason != "abuse" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// Test: Admin can lift a suspension
+func TestSetSuspension_Unsuspend_Returns200(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), suspensionRequest(testAdminARN, "user-123", `{"suspended":false}`))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if store.lastSuspended {
+		t.Error("expected suspended=false to be passed to store")
+	}
+}
+
+// Test: Assumed-role sessions of an admin role are accepted
+func TestSetSuspension_AssumedRole_Allowed(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	caller := "arn:aws:sts::123456789012:assumed-role/AdminRole/session-1"
+	response, _ := handler(context.Background(), suspensionRequest(caller, "user-123", `{"suspended":true}`))
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+}
+
+// Test: Non-admin principal is rejected
+func TestSetSuspension_NonAdminPrincipal_Returns403(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), suspensionRequest("arn:aws:iam::123456789012:role/PluginRole", "user-123", `{"suspended":true}`))
+
+	if response.StatusCode != 403 {
+		t.Errorf("expected status code 403, got %d", response.StatusCode)
+	}
+	if store.lastAccountID != "" {
+		t.Error("expected store not to be called")
+	}
+}
+
+// Test: Missing IAM identity is rejected
+func TestSetSuspension_NoPrincipal_Returns401(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), suspensionRequest("", "user-123", `{"suspended":true}`))
+
+	if response.StatusCode != 401 {
+		t.Errorf("expected status code 401, got %d", response.StatusCode)
+	}
+}
+
+// Test: Missing suspended field is rejected
+func TestSetSuspension_MissingSuspended_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), suspensionRequest(testAdminARN, "user-123", `{"reason":"abuse"}`))
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+}
+
+// Test: Unknown account returns 404
+func TestSetSuspension_UnknownAccount_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{
+		setSuspendedFunc: func(ctx context.Context, accountID string, suspended bool, reason string) (*account.Meta, error) {
+			return nil, account.ErrAccountNotFound
+		},
+	})
+
+	response, _ := handler(context.Background(), suspensionRequest(testAdminARN, "missing", `{"suspended":true}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Store failure returns 500
+func TestSetSuspension_StoreError_Returns500(t *testing.T) {
+	setupTestDeps(&mockAccountStore{
+		setSuspendedFunc: func(ctx context.Context, accountID string, suspended bool, reason string) (*account.Meta, error) {
+			return nil, errors.New("dynamo down")
+		},
+	})
+
+	response, _ := handler(context.Background(), suspensionRequest(testAdminARN, "user-123", `{"suspended":true}`))
+
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+func writesRequest(callerARN, accountID, body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(callerARN, accountID, body)
+	request.Resource = "/admin-iam/accounts/{accountId}/writes"
+	return request
+}
+
+// Test: Admin can disable writes to an account
+func TestSetWrites_Disable_Returns200(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, err := handler(context.Background(), writesRequest(testAdminARN, "user-123", `{"writesDisabled":true,"reason":"migration"}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastAccountID != "user-123" || !store.lastWritesOff || store.lastReason != "migration" {
+		t.Errorf("unexpected store call: %s %v %s", store.lastAccountID, store.lastWritesOff, store.lastReason)
+	}
+
+	var resp WritesResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if !resp.WritesDisabled || resp.WritesDisabledReason != "migration" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// Test: Admin can re-enable writes
+func TestSetWrites_Enable_Returns200(t *testing.T) {
+	store := &mockAccountStore{lastWritesOff: true}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), writesRequest(testAdminARN, "user-123", `{"writesDisabled":false}`))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if store.lastWritesOff {
+		t.Error("expected writesDisabled=false to be passed to store")
+	}
+}
+
+// Test: Missing writesDisabled field is rejected
+func TestSetWrites_MissingWritesDisabled_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), writesRequest(testAdminARN, "user-123", `{"reason":"migration"}`))
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+}
+
+// Test: Unknown account returns 404
+func TestSetWrites_UnknownAccount_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{
+		setWritesFunc: func(ctx context.Context, accountID string, disabled bool, reason string) (*account.Meta, error) {
+			return nil, account.ErrAccountNotFound
+		},
+	})
+
+	response, _ := handler(context.Background(), writesRequest(testAdminARN, "missing", `{"writesDisabled":true}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+func capabilitiesRequest(accountID, body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, accountID, body)
+	request.Resource = "/admin-iam/accounts/{accountId}/capabilities"
+	return request
+}
+
+// Test: Admin can set capability overrides
+func TestSetCapabilities_SetsOverrides(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	body := `{"capabilityOverrides":{"https://jmap.rrod.net/extensions/upload-put":{"maxSizeUploadPut":1000}}}`
+	response, err := handler(context.Background(), capabilitiesRequest("user-123", body))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastOverrides["https://jmap.rrod.net/extensions/upload-put"]["maxSizeUploadPut"] != float64(1000) {
+		t.Errorf("unexpected overrides passed to store: %v", store.lastOverrides)
+	}
+
+	var resp CapabilitiesResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.AccountID != "user-123" || len(resp.CapabilityOverrides) != 1 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// Test: An empty object clears the overrides
+func TestSetCapabilities_EmptyClearsOverrides(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), capabilitiesRequest("user-123", `{"capabilityOverrides":{}}`))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if store.lastOverrides == nil || len(store.lastOverrides) != 0 {
+		t.Errorf("expected empty overrides to be passed to store, got %v", store.lastOverrides)
+	}
+	if response.Body != `{"accountId":"user-123","capabilityOverrides":{}}` {
+		t.Errorf("unexpected body: %s", response.Body)
+	}
+}
+
+// Test: Invalid overrides are rejected
+func TestSetCapabilities_Invalid_Returns400(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "missing", body: `{}`},
+		{name: "null settings", body: `{"capabilityOverrides":{"urn:ietf:params:jmap:core":null}}`},
+		{name: "empty capability", body: `{"capabilityOverrides":{"":{"a":1}}}`},
+		{name: "settings not an object", body: `{"capabilityOverrides":{"urn:ietf:params:jmap:core":5}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &mockAccountStore{}
+			setupTestDeps(store)
+
+			response, _ := handler(context.Background(), capabilitiesRequest("user-123", tt.body))
+
+			if response.StatusCode != 400 {
+				t.Errorf("expected status code 400, got %d", response.StatusCode)
+			}
+			if store.lastAccountID != "" {
+				t.Error("expected store not to be called")
+			}
+		})
+	}
+}
+
+// Test: Unknown account returns 404
+func TestSetCapabilities_UnknownAccount_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{metas: map[string]*account.Meta{}})
+
+	response, _ := handler(context.Background(), capabilitiesRequest("missing", `{"capabilityOverrides":{}}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Unknown route returns 404
+func TestHandler_UnknownRoute_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	request := suspensionRequest(testAdminARN, "user-123", "")
+	request.HTTPMethod = "DELETE"
+
+	response, _ := handler(context.Background(), request)
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+func adminGetRequest(resource string, pathParams, query map[string]string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:            "GET",
+		Resource:              resource,
+		PathParameters:        pathParams,
+		QueryStringParameters: query,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-admin",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: testAdminARN,
+			},
+		},
+	}
+}
+
+// Test: Listing returns accounts with usage and next cursor
+func TestListAccounts_ReturnsSummaries(t *testing.T) {
+	store := &mockAccountStore{
+		metas: map[string]*account.Meta{
+			"user-1": {AccountID: "user-1", QuotaBytes: 1000, QuotaRemaining: 250, LastDiscoveryAccess: "2025-02-01T00:00:00Z"},
+		},
+		usage: map[string]*account.BlobUsage{
+			"user-1": {Count: 3, ConfirmedCount: 2, PendingCount: 1},
+		},
+		nextCursor: "next-page",
+	}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts", nil, map[string]string{"limit": "10", "cursor": "abc"}))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastLimit != 10 || store.lastCursor != "abc" {
+		t.Errorf("expected limit 10 and cursor abc, got %d and %s", store.lastLimit, store.lastCursor)
+	}
+
+	var resp AccountListResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.NextCursor != "next-page" {
+		t.Errorf("expected nextCursor next-page, got %s", resp.NextCursor)
+	}
+	if len(resp.Accounts) != 1 {
+		t.Fatalf("expected 1 account, got %d", len(resp.Accounts))
+	}
+	got := resp.Accounts[0]
+	if got.UsedBytes != 750 || got.BlobCount != 3 || got.LastAccessAt != "2025-02-01T00:00:00Z" {
+		t.Errorf("unexpected summary: %+v", got)
+	}
+}
+
+// Test: Listing uses the default limit when none is supplied
+func TestListAccounts_DefaultLimit(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts", nil, nil))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if store.lastLimit != DefaultListLimit {
+		t.Errorf("expected default limit %d, got %d", DefaultListLimit, store.lastLimit)
+	}
+}
+
+// Test: Out-of-range limit is rejected
+func TestListAccounts_InvalidLimit_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts", nil, map[string]string{"limit": "1000"}))
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+}
+
+// Test: Invalid cursor is rejected
+func TestListAccounts_InvalidCursor_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{listErr: account.ErrInvalidCursor})
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts", nil, map[string]string{"cursor": "!!"}))
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+}
+
+// Test: Drill-down returns blob breakdown
+func TestGetAccount_ReturnsDetail(t *testing.T) {
+	setupTestDeps(&mockAccountStore{
+		metas: map[string]*account.Meta{
+			"user-1": {
+				AccountID: "user-1", QuotaBytes: 1000, QuotaRemaining: 400, Owner: "USER#user-1",
+				LastActivityAt: "2026-01-01T00:00:00Z", InactiveAt: "2027-01-02T00:00:00Z", DeletionScheduledAt: "2027-02-01T00:00:00Z",
+			},
+		},
+		usage: map[string]*account.BlobUsage{
+			"user-1": {Count: 4, ConfirmedCount: 2, ConfirmedBytes: 600, PendingCount: 1, DeletedCount: 1},
+		},
+	})
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts/{accountId}", map[string]string{"accountId": "user-1"}, nil))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var resp AccountDetail
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.AccountID != "user-1" || resp.ConfirmedBlobBytes != 600 || resp.PendingBlobs != 1 || resp.DeletedBlobs != 1 {
+		t.Errorf("unexpected detail: %+v", resp)
+	}
+	if resp.LastActivityAt != "2026-01-01T00:00:00Z" || resp.InactiveAt == "" || resp.DeletionScheduledAt != "2027-02-01T00:00:00Z" {
+		t.Errorf("expected activity fields in detail, got %+v", resp)
+	}
+}
+
+// Test: Drill-down for unknown account returns 404
+func TestGetAccount_Unknown_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts/{accountId}", map[string]string{"accountId": "missing"}, nil))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+func quotaRequest(accountID, body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, accountID, body)
+	request.Resource = "/admin-iam/accounts/{accountId}/quota"
+	return request
+}
+
+// Test: Admin can set an explicit quota and a quota.updated event is published
+func TestSetQuota_Bytes_Returns200AndPublishes(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+	pub := &mockEventPublisher{}
+	deps.EventPublisher = pub
+
+	response, err := handler(context.Background(), quotaRequest("user-123", `{"quotaBytes":3000}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastAccountID != "user-123" || store.lastQuotaBytes != 3000 || store.lastTier != "" {
+		t.Errorf("unexpected store call: %s %d %q", store.lastAccountID, store.lastQuotaBytes, store.lastTier)
+	}
+
+	var resp QuotaResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if resp.QuotaBytes != 3000 || resp.QuotaRemaining != 2900 || resp.PreviousQuotaBytes != 1000 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if len(pub.published) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(pub.published))
+	}
+	event := pub.published[0]
+	if event.EventType != "quota.updated" || event.AccountID != "user-123" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if event.Data["quotaBytes"] != int64(3000) || event.Data["previousQuotaBytes"] != int64(1000) {
+		t.Errorf("unexpected event data: %v", event.Data)
+	}
+}
+
+// Test: Admin can move an account to a tier preset
+func TestSetQuota_Tier_UsesTierQuota(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), quotaRequest("user-123", `{"tier":"pro"}`))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.lastQuotaBytes != 5000 || store.lastTier != "pro" || store.lastMaxPending != 7 {
+		t.Errorf("expected pro/5000/7, got %q/%d/%d", store.lastTier, store.lastQuotaBytes, store.lastMaxPending)
+	}
+}
+
+// Test: Invalid quota requests are rejected before touching the store
+func TestSetQuota_InvalidRequest_Returns400(t *testing.T) {
+	tests := map[string]string{
+		"invalid json":  `{`,
+		"missing":       `{}`,
+		"zero":          `{"quotaBytes":0}`,
+		"negative":      `{"quotaBytes":-5}`,
+		"unknown tier":  `{"tier":"platinum"}`,
+		"both provided": `{"quotaBytes":3000,"tier":"pro"}`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := &mockAccountStore{}
+			setupTestDeps(store)
+
+			response, _ := handler(context.Background(), quotaRequest("user-123", body))
+
+			if response.StatusCode != 400 {
+				t.Errorf("expected status code 400, got %d. Body: %s", response.StatusCode, response.Body)
+			}
+			if store.lastAccountID != "" {
+				t.Error("expected store not to be called")
+			}
+		})
+	}
+}
+
+// Test: Quota update for a missing account returns 404
+func TestSetQuota_MissingAccount_Returns404(t *testing.T) {
+	store := &mockAccountStore{
+		setQuotaFunc: func(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPending int) (*account.QuotaChange, error) {
+			return nil, account.ErrAccountNotFound
+		},
+	}
+	setupTestDeps(store)
+	pub := &mockEventPublisher{}
+	deps.EventPublisher = pub
+
+	response, _ := handler(context.Background(), quotaRequest("missing", `{"quotaBytes":3000}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+	if len(pub.published) != 0 {
+		t.Error("expected no event to be published")
+	}
+}
+
+// Test: Losing repeated races returns 409 so the caller can retry
+func TestSetQuota_ConcurrentUpdate_Returns409(t *testing.T) {
+	store := &mockAccountStore{
+		setQuotaFunc: func(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPending int) (*account.QuotaChange, error) {
+			return nil, account.ErrConcurrentUpdate
+		},
+	}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), quotaRequest("user-123", `{"quotaBytes":3000}`))
+
+	if response.StatusCode != 409 {
+		t.Errorf("expected status code 409, got %d", response.StatusCode)
+	}
+}
+
+// Test: A publishing failure does not fail the applied quota change
+func TestSetQuota_PublishError_StillReturns200(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+	deps.EventPublisher = &mockEventPublisher{publishErr: errors.New("sqs down")}
+
+	response, _ := handler(context.Background(), quotaRequest("user-123", `{"quotaBytes":3000}`))
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+}
+
+func importRequest(accountID, body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, accountID, body)
+	request.HTTPMethod = "POST"
+	request.Resource = "/admin-iam/accounts/{accountId}/imports"
+	return request
+}
+
+// Test: Starting an import returns 202 with the pending job
+func TestStartImport_Returns202(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	importer := &mockImporter{}
+	deps.Importer = importer
+
+	response, err := handler(context.Background(), importRequest("user-123", `{"blobId":"archive-1"}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 202 {
+		t.Fatalf("expected status code 202, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if importer.lastAccount != "user-123" || importer.lastBlobID != "archive-1" {
+		t.Errorf("unexpected importer call: %s %s", importer.lastAccount, importer.lastBlobID)
+	}
+
+	var job accountimport.Job
+	if err := json.Unmarshal([]byte(response.Body), &job); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if job.ImportID != "archive-1" || job.Status != accountimport.StatusPending {
+		t.Errorf("unexpected job: %+v", job)
+	}
+}
+
+// Test: Starting an import that is already running returns its progress
+func TestStartImport_Existing_Returns200(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Importer = &mockImporter{jobs: map[string]*accountimport.Job{
+		"archive-1": {AccountID: "user-123", ImportID: "archive-1", Status: accountimport.StatusRunning, BlobsImported: 4},
+	}}
+
+	response, _ := handler(context.Background(), importRequest("user-123", `{"blobId":"archive-1"}`))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+// Test: Starting an import requires a blobId
+func TestStartImport_MissingBlobID_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), importRequest("user-123", `{}`))
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+}
+
+// Test: Starting an import of an unknown archive returns 404
+func TestStartImport_ArchiveNotFound_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Importer = &mockImporter{startErr: &accountimport.ImportError{Type: "notFound", Message: "archive blob not found"}}
+
+	response, _ := handler(context.Background(), importRequest("user-123", `{"blobId":"missing"}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Import store failures return 500
+func TestStartImport_StoreError_Returns500(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Importer = &mockImporter{startErr: &accountimport.ImportError{Type: "serverFail", Message: "dynamo down"}}
+
+	response, _ := handler(context.Background(), importRequest("user-123", `{"blobId":"archive-1"}`))
+
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+// Test: Import progress can be read back
+func TestGetImport_Returns200WithProgress(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Importer = &mockImporter{jobs: map[string]*accountimport.Job{
+		"archive-1": {AccountID: "user-123", ImportID: "archive-1", Status: accountimport.StatusRunning, BlobsTotal: 10, BlobsImported: 4},
+	}}
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts/{accountId}/imports/{importId}",
+		map[string]string{"accountId": "user-123", "importId": "archive-1"}, nil))
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var job accountimport.Job
+	if err := json.Unmarshal([]byte(response.Body), &job); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if job.BlobsTotal != 10 || job.BlobsImported != 4 {
+		t.Errorf("unexpected progress: %+v", job)
+	}
+}
+
+// Test: Unknown import returns 404
+func TestGetImport_NotFound_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), adminGetRequest("/admin-iam/accounts/{accountId}/imports/{importId}",
+		map[string]string{"accountId": "user-123", "importId": "missing"}, nil))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+func backfillRequest(accountID, body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, accountID, body)
+	request.HTTPMethod = "POST"
+	request.Resource = "/admin-iam/accounts/{accountId}/backfill"
+	return request
+}
+
+// Test: Backfilling returns a result for each object
+func TestBackfill_Returns200WithResults(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	backfiller := &mockBackfiller{}
+	deps.Backfiller = backfiller
+
+	response, err := handler(context.Background(), backfillRequest("user-123",
+		`{"objects":[{"bucket":"archive","key":"a"},{"bucket":"archive","key":"b","contentType":"text/plain"}]}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if backfiller.lastAccount != "user-123" || len(backfiller.objects) != 2 || backfiller.objects[1].ContentType != "text/plain" {
+		t.Errorf("unexpected backfiller call: %s %+v", backfiller.lastAccount, backfiller.objects)
+	}
+
+	var body BackfillResponse
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if body.AccountID != "user-123" || len(body.Results) != 2 || body.Results[0].BlobID != "blob-a" {
+		t.Errorf("unexpected response: %+v", body)
+	}
+}
+
+// Test: Backfill requests must name between one and MaxBackfillObjects objects
+func TestBackfill_InvalidObjects_Returns400(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Backfiller = &mockBackfiller{}
+
+	tooMany := make([]blobbackfill.Object, MaxBackfillObjects+1)
+	for i := range tooMany {
+		tooMany[i] = blobbackfill.Object{Bucket: "archive", Key: "a"}
+	}
+	tooManyBody, _ := json.Marshal(BackfillRequest{Objects: tooMany})
+
+	for _, body := range []string{`{}`, `{"objects":[]}`, `not json`, string(tooManyBody)} {
+		response, _ := handler(context.Background(), backfillRequest("user-123", body))
+		if response.StatusCode != 400 {
+			t.Errorf("expected status code 400 for %.40s, got %d", body, response.StatusCode)
+		}
+	}
+}
+
+// Test: Backfilling into an unknown account returns 404
+func TestBackfill_AccountNotFound_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Backfiller = &mockBackfiller{err: store.ErrAccountNotProvisioned}
+
+	response, _ := handler(context.Background(), backfillRequest("user-123", `{"objects":[{"bucket":"archive","key":"a"}]}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Backfill is not found when no blob bucket is configured
+func TestBackfill_Disabled_Returns404(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+
+	response, _ := handler(context.Background(), backfillRequest("user-123", `{"objects":[{"bucket":"archive","key":"a"}]}`))
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Backfill failures return 500
+func TestBackfill_Error_Returns500(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Backfiller = &mockBackfiller{err: errors.New("dynamo down")}
+
+	response, _ := handler(context.Background(), backfillRequest("user-123", `{"objects":[{"bucket":"archive","key":"a"}]}`))
+
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+func createAccountRequest(body string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, "", body)
+	request.HTTPMethod = "POST"
+	request.Resource = "/admin-iam/accounts"
+	request.PathParameters = nil
+	return request
+}
+
+// Test: Provisioning an account with the default quota returns 201 and publishes account.created
+func TestCreateAccount_DefaultQuota_Returns201AndPublishes(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+	pub := &mockEventPublisher{}
+	deps.EventPublisher = pub
+
+	response, err := handler(context.Background(), createAccountRequest(`{"accountId":"shared-support","owner":"ops"}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 201 {
+		t.Fatalf("expected status code 201, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.createdMeta == nil || store.createdMeta.QuotaBytes != 1000 || store.createdMeta.AccountType != "service" || store.createdMeta.Owner != "ops" {
+		t.Errorf("unexpected created meta: %+v", store.createdMeta)
+	}
+
+	var resp AccountDetail
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.AccountID != "shared-support" || resp.QuotaRemaining != 1000 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	if len(pub.published) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(pub.published))
+	}
+	event := pub.published[0]
+	if event.EventType != "account.created" || event.AccountID != "shared-support" || event.Data["accountType"] != "service" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+// Test: Provisioning with a tier uses the tier's quota
+func TestCreateAccount_Tier_UsesTierQuota(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, _ := handler(context.Background(), createAccountRequest(`{"accountId":"ingest-1","accountType":"ingest","tier":"pro"}`))
+
+	if response.StatusCode != 201 {
+		t.Fatalf("expected status code 201, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if store.createdMeta.QuotaBytes != 5000 || store.createdMeta.Tier != "pro" || store.createdMeta.AccountType != "ingest" {
+		t.Errorf("unexpected created meta: %+v", store.createdMeta)
+	}
+	if store.createdMeta.MaxPendingAllocations != 7 {
+		t.Errorf("expected tier pending allocation limit 7, got %d", store.createdMeta.MaxPendingAllocations)
+	}
+}
+
+// Test: Invalid provisioning requests return 400
+func TestCreateAccount_InvalidRequest_Returns400(t *testing.T) {
+	tests := map[string]string{
+		"missing accountId": `{}`,
+		"invalid accountId": `{"accountId":"a/b"}`,
+		"both quota fields": `{"accountId":"a","quotaBytes":10,"tier":"pro"}`,
+		"unknown tier":      `{"accountId":"a","tier":"gold"}`,
+		"zero quota":        `{"accountId":"a","quotaBytes":0}`,
+		"invalid JSON":      `{`,
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			store := &mockAccountStore{}
+			setupTestDeps(store)
+
+			response, _ := handler(context.Background(), createAccountRequest(body))
+
+			if response.StatusCode != 400 {
+				t.Errorf("expected status code 400, got %d", response.StatusCode)
+			}
+			if store.createdMeta != nil {
+				t.Error("expected no account to be created")
+			}
+		})
+	}
+}
+
+// Test: Provisioning an existing account returns 409 without publishing
+func TestCreateAccount_Exists_Returns409(t *testing.T) {
+	setupTestDeps(&mockAccountStore{createErr: account.ErrAccountExists})
+	pub := &mockEventPublisher{}
+	deps.EventPublisher = pub
+
+	response, _ := handler(context.Background(), createAccountRequest(`{"accountId":"user-123"}`))
+
+	if response.StatusCode != 409 {
+		t.Errorf("expected status code 409, got %d", response.StatusCode)
+	}
+	if len(pub.published) != 0 {
+		t.Errorf("expected no events, got %d", len(pub.published))
+	}
+}
+
+func aliasRequest(method, accountID, alias string) events.APIGatewayProxyRequest {
+	request := suspensionRequest(testAdminARN, accountID, "")
+	request.HTTPMethod = method
+	request.Resource = "/admin-iam/accounts/{accountId}/aliases/{alias}"
+	request.PathParameters["alias"] = alias
+	return request
+}
+
+// Test: Registering an alias returns 201 with the normalized alias
+func TestPutAlias_Returns201(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, err := handler(context.Background(), aliasRequest("PUT", "user-1", "Alice@Example.com"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 201 {
+		t.Fatalf("expected status code 201, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var resp account.Alias
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Alias != "alice@example.com" || resp.AccountID != "user-1" {
+		t.Errorf("unexpected alias: %+v", resp)
+	}
+}
+
+// Test: Invalid aliases are rejected before reaching the store
+func TestPutAlias_InvalidAlias_Returns400(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, err := handler(context.Background(), aliasRequest("PUT", "user-1", "not-an-email"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400, got %d", response.StatusCode)
+	}
+	if store.lastAlias != "" {
+		t.Error("expected store not to be called")
+	}
+}
+
+// Test: Store errors map to 404 and 409
+func TestPutAlias_MapsStoreErrors(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{account.ErrAccountNotFound, 404},
+		{account.ErrAliasExists, 409},
+		{errors.New("dynamo down"), 500},
+	}
+	for _, tc := range tests {
+		setupTestDeps(&mockAccountStore{aliasErr: tc.err})
+
+		response, err := handler(context.Background(), aliasRequest("PUT", "user-1", "alice@example.com"))
+		if err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		if response.StatusCode != tc.status {
+			t.Errorf("%v: expected status code %d, got %d", tc.err, tc.status, response.StatusCode)
+		}
+	}
+}
+
+// Test: Deleting an alias returns 204, or 404 when it is not the account's
+func TestDeleteAlias(t *testing.T) {
+	store := &mockAccountStore{}
+	setupTestDeps(store)
+
+	response, err := handler(context.Background(), aliasRequest("DELETE", "user-1", "alice@example.com"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 204 {
+		t.Errorf("expected status code 204, got %d", response.StatusCode)
+	}
+	if store.lastAccountID != "user-1" || store.lastAlias != "alice@example.com" {
+		t.Errorf("unexpected delete: %s %s", store.lastAccountID, store.lastAlias)
+	}
+
+	setupTestDeps(&mockAccountStore{aliasErr: account.ErrAliasNotFound})
+	response, err = handler(context.Background(), aliasRequest("DELETE", "user-2", "alice@example.com"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Listing aliases returns the account's aliases
+func TestListAliases_ReturnsAliases(t *testing.T) {
+	store := &mockAccountStore{aliases: []account.Alias{{Alias: "alice@example.com", AccountID: "user-1"}}}
+	setupTestDeps(store)
+
+	request := adminGetRequest("/admin-iam/accounts/{accountId}/aliases", map[string]string{"accountId": "user-1"}, nil)
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	var resp AliasList
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.AccountID != "user-1" || len(resp.Aliases) != 1 || resp.Aliases[0].Alias != "alice@example.com" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+type mockAPIKeyStore struct {
+	keys          []apikey.Key
+	err           error
+	lastAccountID string
+	lastKeyID     string
+	lastScopes    []string
+}
+
+func (m *mockAPIKeyStore) Create(ctx context.Context, accountID, name string, scopes []string) (*apikey.Key, string, error) {
+	m.lastAccountID = accountID
+	m.lastScopes = scopes
+	if m.err != nil {
+		return nil, "", m.err
+	}
+	return &apikey.Key{KeyID: "abc", AccountID: accountID, Name: name, Scopes: scopes, CreatedAt: "2025-01-01T00:00:00Z"}, "jmk.abc.s3cret", nil
+}
+
+func (m *mockAPIKeyStore) List(ctx context.Context, accountID string) ([]apikey.Key, error) {
+	m.lastAccountID = accountID
+	return m.keys, m.err
+}
+
+func (m *mockAPIKeyStore) Revoke(ctx context.Context, accountID, keyID string) error {
+	m.lastAccountID = accountID
+	m.lastKeyID = keyID
+	return m.err
+}
+
+func apiKeyRequest(method, resource string, params map[string]string, body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:     method,
+		Resource:       resource,
+		PathParameters: params,
+		Body:           body,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-admin",
+			Identity:  events.APIGatewayRequestIdentity{UserArn: testAdminARN},
+		},
+	}
+}
+
+// Test: Creating an API key returns the key once
+func TestCreateAPIKey_ReturnsKey(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	keys := &mockAPIKeyStore{}
+	deps.APIKeys = keys
+
+	request := apiKeyRequest("POST", "/admin-iam/accounts/{accountId}/api-keys", map[string]string{"accountId": "user-1"}, `{"name":"crm","scopes":["upload"]}`)
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 201 {
+		t.Fatalf("expected status code 201, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var resp map[string]any
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp["key"] != "jmk.abc.s3cret" || resp["keyId"] != "abc" || resp["accountId"] != "user-1" {
+		t.Errorf("unexpected response: %v", resp)
+	}
+	if keys.lastAccountID != "user-1" || len(keys.lastScopes) != 1 || keys.lastScopes[0] != "upload" {
+		t.Errorf("unexpected create: %s %v", keys.lastAccountID, keys.lastScopes)
+	}
+}
+
+// Test: API key creation validates scopes and maps store errors
+func TestCreateAPIKey_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		err    error
+		status int
+	}{
+		{name: "no scopes", body: `{"name":"crm"}`, status: 400},
+		{name: "unknown scope", body: `{"scopes":["admin"]}`, status: 400},
+		{name: "invalid json", body: `{`, status: 400},
+		{name: "missing account", body: `{"scopes":["read"]}`, err: apikey.ErrAccountNotFound, status: 404},
+		{name: "store failure", body: `{"scopes":["read"]}`, err: errors.New("boom"), status: 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDeps(&mockAccountStore{})
+			deps.APIKeys = &mockAPIKeyStore{err: tc.err}
+
+			request := apiKeyRequest("POST", "/admin-iam/accounts/{accountId}/api-keys", map[string]string{"accountId": "user-1"}, tc.body)
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.status {
+				t.Errorf("expected status code %d, got %d", tc.status, response.StatusCode)
+			}
+		})
+	}
+}
+
+// Test: Listing API keys never returns the keys themselves
+func TestListAPIKeys_ReturnsMetadata(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.APIKeys = &mockAPIKeyStore{keys: []apikey.Key{{KeyID: "abc", AccountID: "user-1", Scopes: []string{"read"}, RevokedAt: "2025-02-01T00:00:00Z"}}}
+
+	request := apiKeyRequest("GET", "/admin-iam/accounts/{accountId}/api-keys", map[string]string{"accountId": "user-1"}, "")
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	var resp APIKeyList
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.AccountID != "user-1" || len(resp.APIKeys) != 1 || resp.APIKeys[0].RevokedAt == "" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+}
+
+// Test: Revoking an API key returns 204, or 404 when it is not the account's
+func TestRevokeAPIKey(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	keys := &mockAPIKeyStore{}
+	deps.APIKeys = keys
+
+	params := map[string]string{"accountId": "user-1", "keyId": "abc"}
+	response, err := handler(context.Background(), apiKeyRequest("DELETE", "/admin-iam/accounts/{accountId}/api-keys/{keyId}", params, ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 204 {
+		t.Errorf("expected status code 204, got %d", response.StatusCode)
+	}
+	if keys.lastAccountID != "user-1" || keys.lastKeyID != "abc" {
+		t.Errorf("unexpected revoke: %s %s", keys.lastAccountID, keys.lastKeyID)
+	}
+
+	deps.APIKeys = &mockAPIKeyStore{err: apikey.ErrKeyNotFound}
+	response, err = handler(context.Background(), apiKeyRequest("DELETE", "/admin-iam/accounts/{accountId}/api-keys/{keyId}", params, ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+type mockBindingStore struct {
+	accountIDs       []string
+	err              error
+	lastPrincipalARN string
+	lastAccountID    string
+}
+
+func (m *mockBindingStore) Put(ctx context.Context, principalARN, accountID string) (*binding.Binding, error) {
+	m.lastPrincipalARN = principalARN
+	m.lastAccountID = accountID
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &binding.Binding{PrincipalARN: principalARN, AccountID: accountID, CreatedAt: "2025-01-01T00:00:00Z"}, nil
+}
+
+func (m *mockBindingStore) Delete(ctx context.Context, principalARN, accountID string) error {
+	m.lastPrincipalARN = principalARN
+	m.lastAccountID = accountID
+	return m.err
+}
+
+func (m *mockBindingStore) List(ctx context.Context, principalARN string) ([]string, error) {
+	m.lastPrincipalARN = principalARN
+	return m.accountIDs, m.err
+}
+
+func bindingRequest(method, resource, accountID, principalARN string) events.APIGatewayProxyRequest {
+	request := apiKeyRequest(method, resource, map[string]string{"accountId": accountID}, "")
+	request.QueryStringParameters = map[string]string{"principalArn": principalARN}
+	return request
+}
+
+const testIngestARN = "arn:aws:iam::123456789012:role/IngestRole"
+
+// Test: Binding a principal to an account returns 201
+func TestPutBinding(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal string
+		err       error
+		status    int
+	}{
+		{name: "created", principal: testIngestARN, status: 201},
+		{name: "not an ARN", principal: "IngestRole", status: 400},
+		{name: "missing account", principal: testIngestARN, err: binding.ErrAccountNotFound, status: 404},
+		{name: "store failure", principal: testIngestARN, err: errors.New("boom"), status: 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDeps(&mockAccountStore{})
+			bindings := &mockBindingStore{err: tc.err}
+			deps.Bindings = bindings
+
+			request := bindingRequest("PUT", "/admin-iam/accounts/{accountId}/principal-bindings", "user-1", tc.principal)
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.status {
+				t.Errorf("expected status code %d, got %d. Body: %s", tc.status, response.StatusCode, response.Body)
+			}
+			if tc.status == 201 && (bindings.lastAccountID != "user-1" || bindings.lastPrincipalARN != testIngestARN) {
+				t.Errorf("unexpected binding: %s %s", bindings.lastPrincipalARN, bindings.lastAccountID)
+			}
+		})
+	}
+}
+
+// Test: Deleting a binding returns 204, or 404 when it does not exist
+func TestDeleteBinding(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Bindings = &mockBindingStore{}
+
+	request := bindingRequest("DELETE", "/admin-iam/accounts/{accountId}/principal-bindings", "user-1", testIngestARN)
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 204 {
+		t.Errorf("expected status code 204, got %d", response.StatusCode)
+	}
+
+	deps.Bindings = &mockBindingStore{err: binding.ErrBindingNotFound}
+	response, err = handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// Test: Listing a principal's bindings reports the role they are keyed by
+func TestListBindings(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.Bindings = &mockBindingStore{accountIDs: []string{"user-1", "user-2"}}
+
+	request := bindingRequest("GET", "/admin-iam/principal-bindings", "", "arn:aws:sts::123456789012:assumed-role/IngestRole/session-1")
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var resp BindingList
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.PrincipalARN != testIngestARN || len(resp.AccountIDs) != 2 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	request.QueryStringParameters = nil
+	response, err = handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 400 {
+		t.Errorf("expected status code 400 without principalArn, got %d", response.StatusCode)
+	}
+}
+
+func cognitoSuspensionRequest(resource, groups string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod:     "PUT",
+		Resource:       resource,
+		PathParameters: map[string]string{"accountId": "user-123"},
+		Body:           `{"suspended":true,"reason":"abuse"}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-admin",
+			Authorizer: map[string]any{
+				"claims": map[string]any{"sub": "operator-1", "cognito:groups": groups},
+			},
+		},
+	}
+}
+
+func TestHandler_CognitoAdminGroup(t *testing.T) {
+	tests := []struct {
+		name       string
+		adminGroup string
+		resource   string
+		groups     string
+		wantStatus int
+	}{
+		{name: "group member", adminGroup: "admins", resource: "/admin/accounts/{accountId}/suspension", groups: "admins,users", wantStatus: 200},
+		{name: "not a member", adminGroup: "admins", resource: "/admin/accounts/{accountId}/suspension", groups: "users", wantStatus: 403},
+		{name: "no admin group configured", adminGroup: "", resource: "/admin/accounts/{accountId}/suspension", groups: "admins", wantStatus: 403},
+		{name: "member on IAM route", adminGroup: "admins", resource: "/admin-iam/accounts/{accountId}/suspension", groups: "admins", wantStatus: 403},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := &mockAccountStore{}
+			setupTestDeps(store)
+			deps.AdminGroup = tc.adminGroup
+
+			response, err := handler(context.Background(), cognitoSuspensionRequest(tc.resource, tc.groups))
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.wantStatus {
+				t.Errorf("expected status %d, got %d: %s", tc.wantStatus, response.StatusCode, response.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_CognitoAdminRoute_RejectsIAMCaller(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.AdminGroup = "admins"
+
+	request := suspensionRequest(testAdminARN, "user-123", `{"suspended":true}`)
+	request.Resource = "/admin/accounts/{accountId}/suspension"
+	request.RequestContext.Authorizer = map[string]any{"claims": map[string]any{"cognito:groups": "admins"}}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 403 {
+		t.Errorf("expected status 403, got %d", response.StatusCode)
+	}
+}
+
+// mockPluginLatencyReader serves fixed plugin latency statistics
+type mockPluginLatencyReader struct {
+	stats []pluginlatency.Stats
+	err   error
+}
+
+func (m *mockPluginLatencyReader) List(ctx context.Context) ([]pluginlatency.Stats, error) {
+	return m.stats, m.err
+}
+
+// Test: Plugin latency is summarized by invoke target
+func TestPluginLatency(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.PluginLatency = &mockPluginLatencyReader{stats: []pluginlatency.Stats{
+		{Target: "fn-mail", Instance: "i-1", Calls: 3, P99Ms: 120},
+		{Target: "fn-mail", Instance: "i-2", Calls: 2, Errors: 1, P99Ms: 450},
+	}}
+
+	request := apiKeyRequest("GET", "/admin-iam/plugins/latency", nil, "")
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var resp PluginLatencyList
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Targets) != 1 || resp.Targets[0].Calls != 5 || resp.Targets[0].Errors != 1 || resp.Targets[0].P99Ms != 450 || len(resp.Targets[0].Instances) != 2 {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	deps.PluginLatency = &mockPluginLatencyReader{err: errors.New("throttled")}
+	response, err = handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+// mockPluginRegistry serves a built registry and counts refreshes
+type mockPluginRegistry struct {
+	registry  *plugin.Registry
+	refreshes int
+	err       error
+}
+
+func (m *mockPluginRegistry) Inspect() plugin.Inspection {
+	return m.registry.Inspect()
+}
+
+func (m *mockPluginRegistry) Refresh(ctx context.Context) error {
+	m.refreshes++
+	return m.err
+}
+
+// Test: The plugin registry is dumped, and refreshed first on request
+func TestPluginRegistry(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	registry := plugin.NewRegistry()
+	registry.AddCapabilityConfig("urn:ietf:params:jmap:mail", map[string]any{"maxMailboxDepth": 10})
+	registry.AddMethod("Email/get", plugin.MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:mail-get", Paging: true})
+	mock := &mockPluginRegistry{registry: registry}
+	deps.Registry = mock
+
+	request := apiKeyRequest("GET", "/admin-iam/plugins/registry", nil, "")
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var resp plugin.Inspection
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.SnapshotVersion != plugin.SnapshotVersion || resp.Methods["Email/get"].InvokeTarget != "arn:mail-get" || resp.Capabilities["urn:ietf:params:jmap:mail"] == nil {
+		t.Errorf("unexpected response: %s", response.Body)
+	}
+	if mock.refreshes != 0 {
+		t.Errorf("expected no refresh, got %d", mock.refreshes)
+	}
+
+	request.QueryStringParameters = map[string]string{"refresh": "true"}
+	if response, _ = handler(context.Background(), request); response.StatusCode != 200 || mock.refreshes != 1 {
+		t.Errorf("expected a refresh and status 200, got %d refreshes and status %d", mock.refreshes, response.StatusCode)
+	}
+
+	mock.err = errors.New("throttled")
+	if response, _ = handler(context.Background(), request); response.StatusCode != 500 {
+		t.Errorf("expected status code 500 when the refresh fails, got %d", response.StatusCode)
+	}
+
+	request.QueryStringParameters = map[string]string{"refresh": "yes"}
+	if response, _ = handler(context.Background(), request); response.StatusCode != 400 {
+		t.Errorf("expected status code 400 for an invalid refresh, got %d", response.StatusCode)
+	}
+}
+
+// Test: Admin group members can inspect the registry through the Cognito route
+func TestPluginRegistry_CognitoAdminGroup(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	deps.AdminGroup = "admins"
+
+	for groups, wantStatus := range map[string]int{"admins": 200, "users": 403} {
+		request := cognitoSuspensionRequest("/admin/plugins/registry", groups)
+		request.HTTPMethod = "GET"
+		request.PathParameters = nil
+		request.Body = ""
+
+		response, err := handler(context.Background(), request)
+		if err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		if response.StatusCode != wantStatus {
+			t.Errorf("groups %q: expected status %d, got %d: %s", groups, wantStatus, response.StatusCode, response.Body)
+		}
+	}
+}
+
+// Test: The plugin registry is only shown to admin principals
+func TestPluginRegistry_NonAdminForbidden(t *testing.T) {
+	setupTestDeps(&mockAccountStore{})
+	request := apiKeyRequest("GET", "/admin-iam/plugins/registry", nil, "")
+	request.RequestContext.Identity.UserArn = "arn:aws:iam::123456789012:role/NotAdmin"
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 403 {
+		t.Errorf("expected status code 403, got %d", response.StatusCode)
+	}
+}
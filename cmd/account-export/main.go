@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// Exporter runs account export jobs
+type Exporter interface {
+	Run(ctx context.Context, accountID, exportID string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Exporter Exporter
+}
+
+var deps *Dependencies
+
+// handler processes DynamoDB stream events for new export jobs
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		if err := processRecord(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processRecord runs the export job created by a single stream record
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+	// Only process INSERT events
+	if record.EventName != "INSERT" {
+		return nil
+	}
+
+	newImage := record.Change.NewImage
+
+	sk, ok := extractStringAttribute(newImage, "sk")
+	if !ok || !strings.HasPrefix(sk, accountexport.SKPrefixExport) {
+		return nil
+	}
+
+	accountID, ok := extractStringAttribute(newImage, "accountId")
+	if !ok {
+		logger.WarnContext(ctx, "Missing accountId in stream record")
+		return fmt.Errorf("missing accountId in stream record")
+	}
+
+	exportID, ok := extractStringAttribute(newImage, "exportId")
+	if !ok {
+		logger.WarnContext(ctx, "Missing exportId in stream record",
+			slog.String("account_id", accountID),
+		)
+		return fmt.Errorf("missing exportId in stream record")
+	}
+
+	logger.InfoContext(ctx, "Running account export",
+		slog.String("account_id", accountID),
+		slog.String("export_id", exportID),
+	)
+
+	if err := deps.Exporter.Run(ctx, accountID, exportID); err != nil {
+		logger.ErrorContext(ctx, "Account export failed",
+			slog.String("account_id", accountID),
+			slog.String("export_id", exportID),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to run export %s: %w", exportID, err)
+	}
+
+	return nil
+}
+
+// extractStringAttribute extracts a string value from a DynamoDB stream attribute map
+func extractStringAttribute(image map[string]events.DynamoDBAttributeValue, key string) (string, bool) {
+	attr, ok := image[key]
+	if !ok {
+		return "", false
+	}
+	if attr.DataType() != events.DataTypeString {
+		return "", false
+	}
+	val := attr.String()
+	if val == "" {
+		return "", false
+	}
+	return val, true
+}
+
+// RealUUIDGenerator generates real UUIDs
+type RealUUIDGenerator struct{}
+
+// Generate generates a new UUID v4
+func (r *RealUUIDGenerator) Generate() string {
+	return uuid.New().String()
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobStore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+	blobBucket := cfg.Bucket
+
+	// Load plugin registry for export callbacks
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional envelope encryption of blob record metadata
+	metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+
+	deps = &Dependencies{
+		Exporter: &accountexport.Handler{
+			DB:          accountexport.NewDynamoDBStore(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), tableName).WithEncryption(metadataEnvelope),
+			Storage:     accountexport.NewS3Storage(s3.NewFromConfig(result.Config), blobBucket),
+			Contributor: accountexport.NewLambdaContributor(lambdasvc.NewFromConfig(result.Config), registry),
+			UUIDGen:     &RealUUIDGenerator{},
+		},
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type mockExporter struct {
+	runErr error
+	calls  []exportCall
+}
+
+type exportCall struct {
+	AccountID string
+	ExportID  string
+}
+
+func (m *mockExporter) Run(ctx context.Context, accountID, exportID string) error {
+	m.calls = append(m.calls, exportCall{AccountID: accountID, ExportID: exportID})
+	return m.runErr
+}
+
+func exportInsertRecord(accountID, exportID string) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"pk":        events.NewStringAttribute("ACCOUNT#" + accountID),
+				"sk":        events.NewStringAttribute("EXPORT#" + exportID),
+				"accountId": events.NewStringAttribute(accountID),
+				"exportId":  events.NewStringAttribute(exportID),
+				"status":    events.NewStringAttribute("pending"),
+			},
+		},
+	}
+}
+
+func TestHandler_InsertedExportJob_RunsExport(t *testing.T) {
+	exporter := &mockExporter{}
+	deps = &Dependencies{Exporter: exporter}
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{exportInsertRecord("user-1", "exp-1")}}
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(exporter.calls) != 1 {
+		t.Fatalf("expected 1 export run, got %d", len(exporter.calls))
+	}
+	if exporter.calls[0] != (exportCall{AccountID: "user-1", ExportID: "exp-1"}) {
+		t.Errorf("unexpected call: %+v", exporter.calls[0])
+	}
+}
+
+func TestHandler_IgnoresModifyAndOtherRecords(t *testing.T) {
+	exporter := &mockExporter{}
+	deps = &Dependencies{Exporter: exporter}
+
+	modify := exportInsertRecord("user-1", "exp-1")
+	modify.EventName = "MODIFY"
+
+	blob := exportInsertRecord("user-1", "exp-1")
+	blob.Change.NewImage["sk"] = events.NewStringAttribute("BLOB#b1")
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{modify, blob}}
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(exporter.calls) != 0 {
+		t.Errorf("expected no export runs, got %d", len(exporter.calls))
+	}
+}
+
+func TestHandler_MissingExportID_ReturnsError(t *testing.T) {
+	deps = &Dependencies{Exporter: &mockExporter{}}
+
+	record := exportInsertRecord("user-1", "exp-1")
+	delete(record.Change.NewImage, "exportId")
+
+	if err := handler(context.Background(), events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{record}}); err == nil {
+		t.Fatal("expected error for missing exportId")
+	}
+}
+
+func TestHandler_RunError_ReturnsError(t *testing.T) {
+	deps = &Dependencies{Exporter: &mockExporter{runErr: errors.New("dynamo down")}}
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{exportInsertRecord("user-1", "exp-1")}}
+	if err := handler(context.Background(), event); err == nil {
+		t.Fatal("expected error so the batch is retried")
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountimport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// Importer runs account import jobs
+type Importer interface {
+	Run(ctx context.Context, accountID, importID string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Importer Importer
+}
+
+var deps *Dependencies
+
+// handler processes DynamoDB stream events for pending import jobs
+func handler(ctx context.Context, event events.DynamoDBEvent) error {
+	for _, record := range event.Records {
+		if err := processRecord(ctx, record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processRecord runs the import job in a single stream record. Jobs become
+// pending when created, when a failed import is resumed, and when a running
+// import yields before the Lambda timeout.
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+	if record.EventName != "INSERT" && record.EventName != "MODIFY" {
+		return nil
+	}
+
+	newImage := record.Change.NewImage
+
+	sk, ok := extractStringAttribute(newImage, "sk")
+	if !ok || !strings.HasPrefix(sk, accountimport.SKPrefixImport) {
+		return nil
+	}
+
+	if status, _ := extractStringAttribute(newImage, "status"); status != accountimport.StatusPending {
+		return nil
+	}
+
+	accountID, ok := extractStringAttribute(newImage, "accountId")
+	if !ok {
+		logger.WarnContext(ctx, "Missing accountId in stream record")
+		return fmt.Errorf("missing accountId in stream record")
+	}
+
+	importID, ok := extractStringAttribute(newImage, "importId")
+	if !ok {
+		logger.WarnContext(ctx, "Missing importId in stream record",
+			slog.String("account_id", accountID),
+		)
+		return fmt.Errorf("missing importId in stream record")
+	}
+
+	logger.InfoContext(ctx, "Running account import",
+		slog.String("account_id", accountID),
+		slog.String("import_id", importID),
+	)
+
+	if err := deps.Importer.Run(ctx, accountID, importID); err != nil {
+		logger.ErrorContext(ctx, "Account import failed",
+			slog.String("account_id", accountID),
+			slog.String("import_id", importID),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to run import %s: %w", importID, err)
+	}
+
+	return nil
+}
+
+// extractStringAttribute extracts a string value from a DynamoDB stream attribute map
+func extractStringAttribute(image map[string]events.DynamoDBAttributeValue, key string) (string, bool) {
+	attr, ok := image[key]
+	if !ok {
+		return "", false
+	}
+	if attr.DataType() != events.DataTypeString {
+		return "", false
+	}
+	val := attr.String()
+	if val == "" {
+		return "", false
+	}
+	return val, true
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobStore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+	blobBucket := cfg.Bucket
+
+	// Load plugin registry for import callbacks
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional envelope encryption of blob record metadata
+	metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+
+	deps = &Dependencies{
+		Importer: &accountimport.Handler{
+			DB:         accountimport.NewDynamoDBStore(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), tableName).WithEncryption(metadataEnvelope),
+			Storage:    accountimport.NewS3Storage(s3.NewFromConfig(result.Config), blobBucket),
+			Dispatcher: accountimport.NewLambdaDispatcher(lambdasvc.NewFromConfig(result.Config), registry),
+		},
+	}
+
+	result.Start(handler)
+}
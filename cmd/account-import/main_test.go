@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type mockImporter struct {
+	runErr error
+	calls  []importCall
+}
+
+type importCall struct {
+	AccountID string
+	ImportID  string
+}
+
+func (m *mockImporter) Run(ctx context.Context, accountID, importID string) error {
+	m.calls = append(m.calls, importCall{AccountID: accountID, ImportID: importID})
+	return m.runErr
+}
+
+func importRecord(eventName, accountID, importID, status string) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName: eventName,
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"pk":        events.NewStringAttribute("ACCOUNT#" + accountID),
+				"sk":        events.NewStringAttribute("IMPORT#" + importID),
+				"accountId": events.NewStringAttribute(accountID),
+				"importId":  events.NewStringAttribute(importID),
+				"status":    events.NewStringAttribute(status),
+			},
+		},
+	}
+}
+
+func TestHandler_PendingImportJob_RunsImport(t *testing.T) {
+	importer := &mockImporter{}
+	deps = &Dependencies{Importer: importer}
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+		importRecord("INSERT", "user-1", "archive-1", "pending"),
+		importRecord("MODIFY", "user-1", "archive-2", "pending"),
+	}}
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(importer.calls) != 2 {
+		t.Fatalf("expected 2 import runs, got %d", len(importer.calls))
+	}
+	if importer.calls[1] != (importCall{AccountID: "user-1", ImportID: "archive-2"}) {
+		t.Errorf("unexpected call: %+v", importer.calls[1])
+	}
+}
+
+func TestHandler_IgnoresNonPendingAndOtherRecords(t *testing.T) {
+	importer := &mockImporter{}
+	deps = &Dependencies{Importer: importer}
+
+	running := importRecord("MODIFY", "user-1", "archive-1", "running")
+	removed := importRecord("REMOVE", "user-1", "archive-1", "pending")
+	blob := importRecord("INSERT", "user-1", "archive-1", "pending")
+	blob.Change.NewImage["sk"] = events.NewStringAttribute("BLOB#b1")
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{running, removed, blob}}
+	if err := handler(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(importer.calls) != 0 {
+		t.Errorf("expected no import runs, got %d", len(importer.calls))
+	}
+}
+
+func TestHandler_MissingImportID_ReturnsError(t *testing.T) {
+	deps = &Dependencies{Importer: &mockImporter{}}
+
+	record := importRecord("INSERT", "user-1", "archive-1", "pending")
+	delete(record.Change.NewImage, "importId")
+
+	if err := handler(context.Background(), events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{record}}); err == nil {
+		t.Fatal("expected error for missing importId")
+	}
+}
+
+func TestHandler_RunError_ReturnsError(t *testing.T) {
+	deps = &Dependencies{Importer: &mockImporter{runErr: errors.New("dynamo down")}}
+
+	event := events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{importRecord("INSERT", "user-1", "archive-1", "pending")}}
+	if err := handler(context.Background(), event); err == nil {
+		t.Fatal("expected error so the batch is retried")
+	}
+}
@@ -2,13 +2,9 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"strconv"
-	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -18,103 +14,38 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cognitoidentityprovider/types"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	ddbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/jarrod-lowe/jmap-service-core/internal/db"
-	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // AccountDB handles DynamoDB operations for account metadata
 type AccountDB interface {
-	CreateAccountMeta(ctx context.Context, accountID string, quotaBytes int64) error
+	CreateAccountMeta(ctx context.Context, accountID, tier string, preset account.Tier, event publisher.EventPayload) error
 }
 
 // CognitoClient handles Cognito operations
 type CognitoClient interface {
 	SetUserAttribute(ctx context.Context, userPoolID, username, attrName, attrValue string) error
-}
-
-// EventPayload represents a system event notification sent to plugin SQS queues
-type EventPayload struct {
-	EventType  string         `json:"eventType"`
-	OccurredAt string         `json:"occurredAt"`
-	AccountID  string         `json:"accountId"`
-	Data       map[string]any `json:"data,omitempty"`
-}
-
-// EventPublisher publishes events to subscribed plugins
-type EventPublisher interface {
-	Publish(ctx context.Context, payload EventPayload) error
-}
-
-// SQSClient is the interface for SQS operations
-type SQSClient interface {
-	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
-}
-
-// EventTargetGetter provides event targets from the plugin registry
-type EventTargetGetter interface {
-	GetEventTargets(eventType string) []plugin.AggregatedEventTarget
-}
-
-// SQSEventPublisher publishes events to SQS queues
-type SQSEventPublisher struct {
-	sqsClient SQSClient
-	registry  EventTargetGetter
-}
-
-// Publish sends the event to all registered SQS targets
-func (p *SQSEventPublisher) Publish(ctx context.Context, payload EventPayload) error {
-	targets := p.registry.GetEventTargets(payload.EventType)
-	if len(targets) == 0 {
-		logger.InfoContext(ctx, "No event targets registered",
-			slog.String("event_type", payload.EventType))
-		return nil
-	}
-
-	body, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal event payload: %w", err)
-	}
-
-	for _, target := range targets {
-		if target.TargetType != "sqs" {
-			logger.WarnContext(ctx, "Unknown target type, skipping",
-				slog.String("target_type", target.TargetType),
-				slog.String("plugin_id", target.PluginID))
-			continue
-		}
-
-		queueURL := arnToQueueURL(target.TargetArn)
-
-		_, err := p.sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
-			QueueUrl:    aws.String(queueURL),
-			MessageBody: aws.String(string(body)),
-		})
-		if err != nil {
-			logger.ErrorContext(ctx, "Failed to publish event",
-				slog.String("plugin_id", target.PluginID),
-				slog.String("queue_url", queueURL),
-				slog.String("error", err.Error()))
-			// Continue to other targets, don't fail the account init
-		} else {
-			logger.InfoContext(ctx, "Published event",
-				slog.String("event_type", payload.EventType),
-				slog.String("plugin_id", target.PluginID))
-		}
-	}
-	return nil
+	ListUserGroups(ctx context.Context, userPoolID, username string) ([]string, error)
 }
 
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
-	DB             AccountDB
-	Cognito        CognitoClient
-	EventPublisher EventPublisher
-	DefaultQuota   int64
+	DB           AccountDB
+	Cognito      CognitoClient
+	DefaultQuota int64
+	QuotaTiers   account.Tiers
 }
 
 var deps *Dependencies
@@ -143,8 +74,50 @@ func handler(ctx context.Context, event events.CognitoEventUserPoolsPostAuthenti
 		slog.String("username", event.UserName),
 	)
 
+	// Select a tier preset from the user's Cognito groups, if tiers are configured.
+	// Post Authentication events don't carry group memberships, so they are
+	// read from the user pool.
+	preset := account.Tier{QuotaBytes: deps.DefaultQuota}
+	var tier string
+	if len(deps.QuotaTiers) > 0 {
+		groups, err := deps.Cognito.ListUserGroups(ctx, event.UserPoolID, event.UserName)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to list user groups",
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return event, fmt.Errorf("failed to list user groups: %w", err)
+		}
+		if name, selected, ok := deps.QuotaTiers.ForGroups(groups); ok {
+			tier, preset = name, selected
+			logger.InfoContext(ctx, "Selected quota tier",
+				slog.String("account_id", accountID),
+				slog.String("tier", tier),
+				slog.Int64("quota_bytes", preset.QuotaBytes),
+				slog.Int("max_pending_allocations", preset.MaxPendingAllocations),
+			)
+		}
+	}
+
+	// The account.created event is written to the outbox with the META#
+	// record and delivered by outbox-publisher
+	eventPayload := publisher.EventPayload{
+		EventType:  publisher.EventAccountCreated,
+		OccurredAt: time.Now().UTC().Format(time.RFC3339),
+		AccountID:  accountID,
+		Data: map[string]any{
+			"quotaBytes": preset.QuotaBytes,
+		},
+	}
+	if tier != "" {
+		eventPayload.Data["tier"] = tier
+	}
+	if preset.MaxPendingAllocations > 0 {
+		eventPayload.Data["maxPendingAllocations"] = preset.MaxPendingAllocations
+	}
+
 	// Create account META# record in DynamoDB
-	if err := deps.DB.CreateAccountMeta(ctx, accountID, deps.DefaultQuota); err != nil {
+	if err := deps.DB.CreateAccountMeta(ctx, accountID, tier, preset, eventPayload); err != nil {
 		logger.ErrorContext(ctx, "Failed to create account metadata",
 			slog.String("account_id", accountID),
 			slog.String("error", err.Error()),
@@ -152,25 +125,6 @@ func handler(ctx context.Context, event events.CognitoEventUserPoolsPostAuthenti
 		return event, fmt.Errorf("failed to create account metadata: %w", err)
 	}
 
-	// Publish account.created event to subscribed plugins
-	if deps.EventPublisher != nil {
-		eventPayload := EventPayload{
-			EventType:  "account.created",
-			OccurredAt: time.Now().UTC().Format(time.RFC3339),
-			AccountID:  accountID,
-			Data: map[string]any{
-				"quotaBytes": deps.DefaultQuota,
-			},
-		}
-		if err := deps.EventPublisher.Publish(ctx, eventPayload); err != nil {
-			logger.ErrorContext(ctx, "Failed to publish account.created event",
-				slog.String("account_id", accountID),
-				slog.String("error", err.Error()),
-			)
-			// Don't fail account init if event publishing fails
-		}
-	}
-
 	// Set account_initialized attribute in Cognito
 	if err := deps.Cognito.SetUserAttribute(ctx, event.UserPoolID, event.UserName, "custom:account_initialized", "true"); err != nil {
 		logger.ErrorContext(ctx, "Failed to set account_initialized attribute",
@@ -189,48 +143,69 @@ func handler(ctx context.Context, event events.CognitoEventUserPoolsPostAuthenti
 
 // DynamoDBAccountDB implements AccountDB using AWS DynamoDB
 type DynamoDBAccountDB struct {
-	client    *dynamodb.Client
+	client    dbclient.DynamoDBClient
 	tableName string
 }
 
 // NewDynamoDBAccountDB creates a new DynamoDBAccountDB
-func NewDynamoDBAccountDB(client *dynamodb.Client, tableName string) *DynamoDBAccountDB {
+func NewDynamoDBAccountDB(client dbclient.DynamoDBClient, tableName string) *DynamoDBAccountDB {
 	return &DynamoDBAccountDB{
 		client:    client,
 		tableName: tableName,
 	}
 }
 
-// CreateAccountMeta creates the account META# record with default quota
-func (d *DynamoDBAccountDB) CreateAccountMeta(ctx context.Context, accountID string, quotaBytes int64) error {
-	now := time.Now().UTC().Format(time.RFC3339)
+// CreateAccountMeta creates the account META# record with the preset's quota
+// and limits, and writes event to the outbox in the same transaction. tier is
+// recorded when the preset came from a tier.
+func (d *DynamoDBAccountDB) CreateAccountMeta(ctx context.Context, accountID, tier string, preset account.Tier, event publisher.EventPayload) error {
+	createdAt := time.Now()
+	now := createdAt.UTC().Format(time.RFC3339)
 
 	item := map[string]any{
 		"pk":                       fmt.Sprintf("ACCOUNT#%s", accountID),
 		"sk":                       "META#",
-		"accountType":              "default",
+		"accountType":              account.DefaultAccountType,
 		"pendingAllocationsCount":  0,
-		"quotaBytes":               quotaBytes,
-		"quotaRemaining":           quotaBytes,
+		"quotaBytes":               preset.QuotaBytes,
+		"quotaRemaining":           preset.QuotaBytes,
 		"createdAt":                now,
 		"updatedAt":                now,
 	}
+	if tier != "" {
+		item["tier"] = tier
+	}
+	if preset.MaxPendingAllocations > 0 {
+		item["maxPendingAllocations"] = preset.MaxPendingAllocations
+	}
 
 	av, err := attributevalue.MarshalMap(item)
 	if err != nil {
 		return fmt.Errorf("failed to marshal item: %w", err)
 	}
 
+	outboxItem, err := outbox.Put(d.tableName, uuid.New().String(), event, createdAt)
+	if err != nil {
+		return err
+	}
+
 	// Use condition to prevent overwriting existing record
-	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName:           aws.String(d.tableName),
-		Item:                av,
-		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []ddbtypes.TransactWriteItem{
+			{
+				Put: &ddbtypes.Put{
+					TableName:           aws.String(d.tableName),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+			outboxItem,
+		},
 	})
 	if err != nil {
-		// Check if it's a condition check failure (record already exists)
-		var ccf *ddbtypes.ConditionalCheckFailedException
-		if ok := errors.As(err, &ccf); ok {
+		// Check if the META# condition failed (record already exists). The
+		// event was written when the account was first created.
+		if dbclient.GetConditionalCheckFailureIndex(err) == 0 {
 			// Record already exists, this is OK (idempotent)
 			logger.InfoContext(ctx, "Account metadata already exists",
 				slog.String("account_id", accountID),
@@ -268,17 +243,27 @@ func (c *CognitoIDP) SetUserAttribute(ctx context.Context, userPoolID, username,
 	return err
 }
 
-// arnToQueueURL converts an SQS ARN to a queue URL
-// arn:aws:sqs:region:account:queue-name -> https://sqs.region.amazonaws.com/account/queue-name
-func arnToQueueURL(arn string) string {
-	parts := strings.Split(arn, ":")
-	if len(parts) != 6 {
-		return ""
+// ListUserGroups returns the names of the Cognito groups a user belongs to
+func (c *CognitoIDP) ListUserGroups(ctx context.Context, userPoolID, username string) ([]string, error) {
+	var groups []string
+	var nextToken *string
+	for {
+		output, err := c.client.AdminListGroupsForUser(ctx, &cognitoidentityprovider.AdminListGroupsForUserInput{
+			UserPoolId: aws.String(userPoolID),
+			Username:   aws.String(username),
+			NextToken:  nextToken,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, group := range output.Groups {
+			groups = append(groups, aws.ToString(group.GroupName))
+		}
+		if output.NextToken == nil {
+			return groups, nil
+		}
+		nextToken = output.NextToken
 	}
-	region := parts[3]
-	account := parts[4]
-	queueName := parts[5]
-	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", region, account, queueName)
 }
 
 func main() {
@@ -293,48 +278,61 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	defaultQuotaStr := os.Getenv("DEFAULT_QUOTA_BYTES")
-	if defaultQuotaStr == "" {
-		logger.Error("FATAL: DEFAULT_QUOTA_BYTES environment variable is required")
-		panic("DEFAULT_QUOTA_BYTES environment variable is required")
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	defaultQuota, err := strconv.ParseInt(defaultQuotaStr, 10, 64)
-	if err != nil {
-		logger.Error("FATAL: DEFAULT_QUOTA_BYTES must be a valid integer",
-			slog.String("value", defaultQuotaStr),
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
 			slog.String("error", err.Error()),
 		)
-		panic("DEFAULT_QUOTA_BYTES must be a valid integer")
+		panic(err)
 	}
 
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
-	cognitoClient := cognitoidentityprovider.NewFromConfig(result.Config)
-	sqsClient := sqs.NewFromConfig(result.Config)
+	// Load configuration from environment variables
+	cfg, err := config.LoadAccountInit(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+	defaultQuota := cfg.DefaultQuota
+	quotaTiers := cfg.QuotaTiers
 
-	// Load plugin registry for event publishing
-	dbClient := db.NewClientFromConfig(result.Config, tableName)
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 
-	registry := plugin.NewRegistry()
-	if err := registry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
-		logger.Error("FATAL: Failed to load plugin registry",
+	// Tiers in the CONFIG# record override environment tiers of the same name
+	configTiers, err := account.NewDynamoDBStore(dynamoClient, tableName).LoadTiers(result.Ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to load quota tiers config",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
+	quotaTiers = quotaTiers.Merge(configTiers)
+
+	cognitoClient := cognitoidentityprovider.NewFromConfig(result.Config)
 
 	deps = &Dependencies{
-		DB:             NewDynamoDBAccountDB(dynamoClient, tableName),
-		Cognito:        NewCognitoIDP(cognitoClient),
-		EventPublisher: &SQSEventPublisher{sqsClient: sqsClient, registry: registry},
-		DefaultQuota:   defaultQuota,
+		DB:           NewDynamoDBAccountDB(dynamoClient, tableName),
+		Cognito:      NewCognitoIDP(cognitoClient),
+		DefaultQuota: defaultQuota,
+		QuotaTiers:   quotaTiers,
 	}
 
 	result.Start(handler)
@@ -6,8 +6,14 @@ import (
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/service/sqs"
-	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+// The in-memory fakes satisfy this Lambda's storage interfaces
+var (
+	_ AccountDB = (*fakes.Table)(nil)
 )
 
 // MockDynamoDB implements AccountDB for testing
@@ -15,6 +21,7 @@ type MockDynamoDB struct {
 	CreateAccountMetaCalled bool
 	CreateAccountMetaInput  CreateAccountMetaInput
 	CreateAccountMetaErr    error
+	Event                   publisher.EventPayload
 }
 
 type CreateAccountMetaInput struct {
@@ -22,14 +29,19 @@ type CreateAccountMetaInput struct {
 	QuotaBytes      int64
 	QuotaRemaining  int64
 	AccountType     string
+	Tier            string
+	MaxPending      int
 }
 
-func (m *MockDynamoDB) CreateAccountMeta(ctx context.Context, accountID string, quotaBytes int64) error {
+func (m *MockDynamoDB) CreateAccountMeta(ctx context.Context, accountID, tier string, preset account.Tier, event publisher.EventPayload) error {
 	m.CreateAccountMetaCalled = true
+	m.Event = event
 	m.CreateAccountMetaInput = CreateAccountMetaInput{
 		AccountID:      accountID,
-		QuotaBytes:     quotaBytes,
-		QuotaRemaining: quotaBytes,
+		QuotaBytes:     preset.QuotaBytes,
+		QuotaRemaining: preset.QuotaBytes,
+		Tier:           tier,
+		MaxPending:     preset.MaxPendingAllocations,
 	}
 	return m.CreateAccountMetaErr
 }
@@ -39,6 +51,9 @@ type MockCognito struct {
 	SetUserAttributeCalled bool
 	SetUserAttributeInput  SetUserAttributeInput
 	SetUserAttributeErr    error
+	Groups                 []string
+	ListUserGroupsCalled   bool
+	ListUserGroupsErr      error
 }
 
 type SetUserAttributeInput struct {
@@ -59,6 +74,11 @@ func (m *MockCognito) SetUserAttribute(ctx context.Context, userPoolID, username
 	return m.SetUserAttributeErr
 }
 
+func (m *MockCognito) ListUserGroups(ctx context.Context, userPoolID, username string) ([]string, error) {
+	m.ListUserGroupsCalled = true
+	return m.Groups, m.ListUserGroupsErr
+}
+
 func TestHandler_AlreadyInitialized(t *testing.T) {
 	mockDB := &MockDynamoDB{}
 	mockCognito := &MockCognito{}
@@ -257,39 +277,14 @@ func TestHandler_MissingSub(t *testing.T) {
 	}
 }
 
-// MockEventPublisher implements EventPublisher for testing
-type MockEventPublisher struct {
-	PublishCalled bool
-	PublishInputs []PublishInput
-	PublishErr    error
-}
-
-type PublishInput struct {
-	EventType string
-	AccountID string
-	Data      map[string]any
-}
-
-func (m *MockEventPublisher) Publish(ctx context.Context, payload EventPayload) error {
-	m.PublishCalled = true
-	m.PublishInputs = append(m.PublishInputs, PublishInput{
-		EventType: payload.EventType,
-		AccountID: payload.AccountID,
-		Data:      payload.Data,
-	})
-	return m.PublishErr
-}
-
-func TestHandler_PublishesAccountCreatedEvent(t *testing.T) {
+func TestHandler_WritesAccountCreatedEventToOutbox(t *testing.T) {
 	mockDB := &MockDynamoDB{}
 	mockCognito := &MockCognito{}
-	mockPublisher := &MockEventPublisher{}
 
 	deps = &Dependencies{
-		DB:             mockDB,
-		Cognito:        mockCognito,
-		EventPublisher: mockPublisher,
-		DefaultQuota:   1073741824,
+		DB:           mockDB,
+		Cognito:      mockCognito,
+		DefaultQuota: 1073741824,
 	}
 
 	event := events.CognitoEventUserPoolsPostAuthentication{
@@ -309,16 +304,8 @@ func TestHandler_PublishesAccountCreatedEvent(t *testing.T) {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Should publish account.created event
-	if !mockPublisher.PublishCalled {
-		t.Fatal("expected EventPublisher.Publish to be called")
-	}
-
-	if len(mockPublisher.PublishInputs) != 1 {
-		t.Fatalf("expected 1 publish call, got %d", len(mockPublisher.PublishInputs))
-	}
-
-	published := mockPublisher.PublishInputs[0]
+	// The account.created event is written with the META# record
+	published := mockDB.Event
 	if published.EventType != "account.created" {
 		t.Errorf("expected eventType 'account.created', got %q", published.EventType)
 	}
@@ -330,319 +317,132 @@ func TestHandler_PublishesAccountCreatedEvent(t *testing.T) {
 	}
 }
 
-func TestHandler_DoesNotPublishEventWhenAlreadyInitialized(t *testing.T) {
-	mockDB := &MockDynamoDB{}
-	mockCognito := &MockCognito{}
-	mockPublisher := &MockEventPublisher{}
-
-	deps = &Dependencies{
-		DB:             mockDB,
-		Cognito:        mockCognito,
-		EventPublisher: mockPublisher,
-		DefaultQuota:   1073741824,
-	}
-
-	event := events.CognitoEventUserPoolsPostAuthentication{
+func tierTestEvent() events.CognitoEventUserPoolsPostAuthentication {
+	return events.CognitoEventUserPoolsPostAuthentication{
 		CognitoEventUserPoolsHeader: events.CognitoEventUserPoolsHeader{
 			UserPoolID: "ap-southeast-2_abc123",
 			UserName:   "testuser",
 		},
 		Request: events.CognitoEventUserPoolsPostAuthenticationRequest{
 			UserAttributes: map[string]string{
-				"sub":                        "user-123",
-				"custom:account_initialized": "true",
+				"sub": "user-123",
 			},
 		},
 	}
-
-	_, err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("expected no error, got %v", err)
-	}
-
-	// Should NOT publish event when already initialized
-	if mockPublisher.PublishCalled {
-		t.Error("expected EventPublisher.Publish NOT to be called when already initialized")
-	}
 }
 
-func TestHandler_ContinuesOnEventPublishError(t *testing.T) {
+func TestHandler_QuotaTier_SelectedByGroup(t *testing.T) {
 	mockDB := &MockDynamoDB{}
-	mockCognito := &MockCognito{}
-	mockPublisher := &MockEventPublisher{
-		PublishErr: errors.New("SQS error"),
-	}
+	mockCognito := &MockCognito{Groups: []string{"beta-testers", "pro"}}
 
 	deps = &Dependencies{
-		DB:             mockDB,
-		Cognito:        mockCognito,
-		EventPublisher: mockPublisher,
-		DefaultQuota:   1073741824,
+		DB:           mockDB,
+		Cognito:      mockCognito,
+		DefaultQuota: 1073741824,
+		QuotaTiers:   account.Tiers{"pro": {QuotaBytes: 10737418240}},
 	}
 
-	event := events.CognitoEventUserPoolsPostAuthentication{
-		CognitoEventUserPoolsHeader: events.CognitoEventUserPoolsHeader{
-			UserPoolID: "ap-southeast-2_abc123",
-			UserName:   "testuser",
-		},
-		Request: events.CognitoEventUserPoolsPostAuthenticationRequest{
-			UserAttributes: map[string]string{
-				"sub": "user-123",
-			},
-		},
+	if _, err := handler(context.Background(), tierTestEvent()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Should NOT fail the handler even if event publishing fails
-	_, err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("expected no error even when event publishing fails, got %v", err)
+	if mockDB.CreateAccountMetaInput.QuotaBytes != 10737418240 {
+		t.Errorf("expected tier quota 10737418240, got %d", mockDB.CreateAccountMetaInput.QuotaBytes)
 	}
-
-	// Verify publish was attempted
-	if !mockPublisher.PublishCalled {
-		t.Error("expected EventPublisher.Publish to be called")
+	if mockDB.CreateAccountMetaInput.Tier != "pro" {
+		t.Errorf("expected tier pro, got %q", mockDB.CreateAccountMetaInput.Tier)
 	}
-}
 
-func TestArnToQueueURL(t *testing.T) {
-	tests := []struct {
-		name     string
-		arn      string
-		expected string
-	}{
-		{
-			name:     "valid SQS ARN",
-			arn:      "arn:aws:sqs:ap-southeast-2:123456789012:my-queue",
-			expected: "https://sqs.ap-southeast-2.amazonaws.com/123456789012/my-queue",
-		},
-		{
-			name:     "us-east-1 region",
-			arn:      "arn:aws:sqs:us-east-1:999888777666:another-queue",
-			expected: "https://sqs.us-east-1.amazonaws.com/999888777666/another-queue",
-		},
-		{
-			name:     "invalid ARN - too few parts",
-			arn:      "arn:aws:sqs:region",
-			expected: "",
-		},
-		{
-			name:     "empty ARN",
-			arn:      "",
-			expected: "",
-		},
+	published := mockDB.Event
+	if published.Data["quotaBytes"] != int64(10737418240) {
+		t.Errorf("expected data.quotaBytes 10737418240, got %v", published.Data["quotaBytes"])
 	}
-
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			result := arnToQueueURL(tc.arn)
-			if result != tc.expected {
-				t.Errorf("arnToQueueURL(%q) = %q, want %q", tc.arn, result, tc.expected)
-			}
-		})
+	if published.Data["tier"] != "pro" {
+		t.Errorf("expected data.tier pro, got %v", published.Data["tier"])
 	}
 }
 
-// MockSQSClient implements SQSClient for testing
-type MockSQSClient struct {
-	SendMessageCalled  bool
-	SendMessageInputs  []MockSendMessageInput
-	SendMessageErr     error
-	SendMessageResults []*sqs.SendMessageOutput
-	callIndex          int
-}
-
-type MockSendMessageInput struct {
-	QueueURL    string
-	MessageBody string
-}
-
-func (m *MockSQSClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
-	m.SendMessageCalled = true
-	m.SendMessageInputs = append(m.SendMessageInputs, MockSendMessageInput{
-		QueueURL:    *input.QueueUrl,
-		MessageBody: *input.MessageBody,
-	})
-	if m.SendMessageErr != nil {
-		return nil, m.SendMessageErr
-	}
-	if m.callIndex < len(m.SendMessageResults) {
-		result := m.SendMessageResults[m.callIndex]
-		m.callIndex++
-		return result, nil
-	}
-	return &sqs.SendMessageOutput{}, nil
-}
-
-// MockEventTargetGetter implements EventTargetGetter for testing
-type MockEventTargetGetter struct {
-	Targets []plugin.AggregatedEventTarget
-}
-
-func (m *MockEventTargetGetter) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
-	return m.Targets
-}
-
-func TestSQSEventPublisher_Publish_SendsToAllTargets(t *testing.T) {
-	mockSQS := &MockSQSClient{}
-	mockRegistry := &MockEventTargetGetter{
-		Targets: []plugin.AggregatedEventTarget{
-			{
-				PluginID:   "plugin-a",
-				TargetType: "sqs",
-				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-a",
-			},
-			{
-				PluginID:   "plugin-b",
-				TargetType: "sqs",
-				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
-			},
-		},
-	}
-
-	publisher := &SQSEventPublisher{
-		sqsClient: mockSQS,
-		registry:  mockRegistry,
-	}
+func TestHandler_QuotaTier_NoMatchingGroup_UsesDefault(t *testing.T) {
+	mockDB := &MockDynamoDB{}
+	mockCognito := &MockCognito{Groups: []string{"beta-testers"}}
 
-	payload := EventPayload{
-		EventType:  "account.created",
-		OccurredAt: "2026-02-01T00:00:00Z",
-		AccountID:  "user-123",
-		Data: map[string]any{
-			"quotaBytes": int64(1073741824),
-		},
+	deps = &Dependencies{
+		DB:           mockDB,
+		Cognito:      mockCognito,
+		DefaultQuota: 1073741824,
+		QuotaTiers:   account.Tiers{"pro": {QuotaBytes: 10737418240}},
 	}
 
-	err := publisher.Publish(context.Background(), payload)
-	if err != nil {
+	if _, err := handler(context.Background(), tierTestEvent()); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	if !mockSQS.SendMessageCalled {
-		t.Fatal("expected SQS.SendMessage to be called")
-	}
-
-	if len(mockSQS.SendMessageInputs) != 2 {
-		t.Fatalf("expected 2 SendMessage calls, got %d", len(mockSQS.SendMessageInputs))
+	if mockDB.CreateAccountMetaInput.QuotaBytes != 1073741824 {
+		t.Errorf("expected default quota, got %d", mockDB.CreateAccountMetaInput.QuotaBytes)
 	}
-
-	// Verify first message
-	if mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-a" {
-		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[0].QueueURL)
-	}
-
-	// Verify second message
-	if mockSQS.SendMessageInputs[1].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-b" {
-		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[1].QueueURL)
+	if mockDB.CreateAccountMetaInput.Tier != "" {
+		t.Errorf("expected no tier, got %q", mockDB.CreateAccountMetaInput.Tier)
 	}
 }
 
-func TestSQSEventPublisher_Publish_NoTargets(t *testing.T) {
-	mockSQS := &MockSQSClient{}
-	mockRegistry := &MockEventTargetGetter{
-		Targets: []plugin.AggregatedEventTarget{},
-	}
-
-	publisher := &SQSEventPublisher{
-		sqsClient: mockSQS,
-		registry:  mockRegistry,
-	}
+func TestHandler_NoQuotaTiers_DoesNotListGroups(t *testing.T) {
+	mockCognito := &MockCognito{}
 
-	payload := EventPayload{
-		EventType: "account.created",
-		AccountID: "user-123",
+	deps = &Dependencies{
+		DB:           &MockDynamoDB{},
+		Cognito:      mockCognito,
+		DefaultQuota: 1073741824,
 	}
 
-	err := publisher.Publish(context.Background(), payload)
-	if err != nil {
+	if _, err := handler(context.Background(), tierTestEvent()); err != nil {
 		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Should not call SQS when no targets
-	if mockSQS.SendMessageCalled {
-		t.Error("expected SQS.SendMessage NOT to be called when no targets")
+	if mockCognito.ListUserGroupsCalled {
+		t.Error("expected groups not to be listed when no tiers are configured")
 	}
 }
 
-func TestSQSEventPublisher_Publish_SkipsNonSQSTargets(t *testing.T) {
-	mockSQS := &MockSQSClient{}
-	mockRegistry := &MockEventTargetGetter{
-		Targets: []plugin.AggregatedEventTarget{
-			{
-				PluginID:   "plugin-a",
-				TargetType: "lambda", // Not SQS
-				TargetArn:  "arn:aws:lambda:ap-southeast-2:123456789012:function:my-func",
-			},
-			{
-				PluginID:   "plugin-b",
-				TargetType: "sqs",
-				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
-			},
-		},
-	}
-
-	publisher := &SQSEventPublisher{
-		sqsClient: mockSQS,
-		registry:  mockRegistry,
-	}
-
-	payload := EventPayload{
-		EventType: "account.created",
-		AccountID: "user-123",
-	}
+func TestHandler_QuotaTier_ListGroupsError(t *testing.T) {
+	mockDB := &MockDynamoDB{}
 
-	err := publisher.Publish(context.Background(), payload)
-	if err != nil {
-		t.Fatalf("expected no error, got %v", err)
+	deps = &Dependencies{
+		DB:           mockDB,
+		Cognito:      &MockCognito{ListUserGroupsErr: errors.New("Cognito error")},
+		DefaultQuota: 1073741824,
+		QuotaTiers:   account.Tiers{"pro": {QuotaBytes: 10737418240}},
 	}
 
-	// Should only call SQS once (for the SQS target)
-	if len(mockSQS.SendMessageInputs) != 1 {
-		t.Errorf("expected 1 SendMessage call, got %d", len(mockSQS.SendMessageInputs))
+	if _, err := handler(context.Background(), tierTestEvent()); err == nil {
+		t.Fatal("expected error when groups cannot be listed")
 	}
 
-	if mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-b" {
-		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[0].QueueURL)
+	if mockDB.CreateAccountMetaCalled {
+		t.Error("expected account not to be created when tier selection fails")
 	}
 }
 
-func TestSQSEventPublisher_Publish_ContinuesOnSQSError(t *testing.T) {
-	mockSQS := &MockSQSClient{
-		SendMessageErr: errors.New("SQS error"),
-	}
-	mockRegistry := &MockEventTargetGetter{
-		Targets: []plugin.AggregatedEventTarget{
-			{
-				PluginID:   "plugin-a",
-				TargetType: "sqs",
-				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-a",
-			},
-			{
-				PluginID:   "plugin-b",
-				TargetType: "sqs",
-				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
-			},
-		},
-	}
+func TestHandler_QuotaTier_AppliesPresetLimits(t *testing.T) {
+	mockDB := &MockDynamoDB{}
 
-	publisher := &SQSEventPublisher{
-		sqsClient: mockSQS,
-		registry:  mockRegistry,
+	deps = &Dependencies{
+		DB:           mockDB,
+		Cognito:      &MockCognito{Groups: []string{"standard", "pro"}},
+		DefaultQuota: 1073741824,
+		QuotaTiers: account.Tiers{
+			"standard": {QuotaBytes: 1073741824},
+			"pro":      {QuotaBytes: 10737418240, MaxPendingAllocations: 20},
+		},
 	}
 
-	payload := EventPayload{
-		EventType: "account.created",
-		AccountID: "user-123",
+	if _, err := handler(context.Background(), tierTestEvent()); err != nil {
+		t.Fatalf("expected no error, got %v", err)
 	}
 
-	// Should not return error even if SQS fails
-	err := publisher.Publish(context.Background(), payload)
-	if err != nil {
-		t.Fatalf("expected no error even on SQS failures, got %v", err)
+	if mockDB.CreateAccountMetaInput.Tier != "pro" || mockDB.CreateAccountMetaInput.MaxPending != 20 {
+		t.Errorf("expected pro tier with 20 pending allocations, got %+v", mockDB.CreateAccountMetaInput)
 	}
-
-	// Should still attempt both targets
-	if len(mockSQS.SendMessageInputs) != 2 {
-		t.Errorf("expected 2 SendMessage attempts, got %d", len(mockSQS.SendMessageInputs))
+	if mockDB.Event.Data["maxPendingAllocations"] != 20 {
+		t.Errorf("expected data.maxPendingAllocations 20, got %v", mockDB.Event.Data["maxPendingAllocations"])
 	}
 }
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// pageSize is how many items each scan of the table reads
+const pageSize = 100
+
+// stopMargin is how long before the invocation deadline the run stops
+// taking new pages, leaving the rest of the table for the next run
+const stopMargin = 30 * time.Second
+
+// AccountStore lists accounts and marks inactive ones
+type AccountStore interface {
+	ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error)
+	MarkInactive(ctx context.Context, accountID, action string, cutoff, deletionAt time.Time, event publisher.EventPayload) (bool, error)
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Accounts AccountStore
+	Config   config.AccountReaper
+	Now      func() time.Time
+}
+
+var deps *Dependencies
+
+// runResult counts what a run did
+type runResult struct {
+	Scanned int
+	Marked  int
+	Failed  int
+}
+
+// handler flags accounts that have not been used within the inactivity
+// threshold, taking the configured action on each. A run that fails to mark
+// an account returns an error once the rest have been processed.
+func handler(ctx context.Context) error {
+	now := deps.Now()
+	cutoff := now.Add(-deps.Config.InactiveAfter)
+
+	var result runResult
+	cursor := ""
+	for {
+		metas, next, err := deps.Accounts.ListMeta(ctx, pageSize, cursor)
+		if err != nil {
+			return fmt.Errorf("failed to list accounts: %w", err)
+		}
+		for i := range metas {
+			result.Scanned++
+			reapAccount(ctx, &metas[i], now, cutoff, &result)
+		}
+		if next == "" {
+			break
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < stopMargin {
+			logger.WarnContext(ctx, "Stopping before the end of the account table",
+				slog.Int("scanned", result.Scanned),
+			)
+			break
+		}
+		cursor = next
+	}
+
+	logger.InfoContext(ctx, "Account reaper run completed",
+		slog.String("action", deps.Config.Action),
+		slog.String("cutoff", cutoff.UTC().Format(time.RFC3339)),
+		slog.Int("scanned", result.Scanned),
+		slog.Int("marked", result.Marked),
+		slog.Int("failed", result.Failed),
+	)
+
+	if result.Failed > 0 {
+		return fmt.Errorf("failed to mark %d inactive accounts", result.Failed)
+	}
+	return nil
+}
+
+// reapAccount marks the account inactive if it was last active before cutoff.
+// Accounts already flagged, or with no recorded activity at all, are skipped.
+func reapAccount(ctx context.Context, meta *account.Meta, now, cutoff time.Time, result *runResult) {
+	if meta.InactiveAt != "" {
+		return
+	}
+	lastActive := meta.LastActive()
+	if lastActive.IsZero() || !lastActive.Before(cutoff) {
+		return
+	}
+
+	action := deps.Config.Action
+	data := map[string]any{
+		"lastActiveAt": lastActive.UTC().Format(time.RFC3339),
+		"action":       action,
+	}
+	var deletionAt time.Time
+	if action == account.InactiveDeletion {
+		deletionAt = now.Add(deps.Config.DeletionDelay)
+		data["deletionScheduledAt"] = deletionAt.UTC().Format(time.RFC3339)
+	}
+	event := publisher.EventPayload{
+		EventType:  publisher.EventAccountInactive,
+		OccurredAt: now.UTC().Format(time.RFC3339),
+		AccountID:  meta.AccountID,
+		Data:       data,
+	}
+
+	marked, err := deps.Accounts.MarkInactive(ctx, meta.AccountID, action, cutoff, deletionAt, event)
+	if err != nil {
+		result.Failed++
+		logger.ErrorContext(ctx, "Failed to mark account inactive",
+			slog.String("account_id", meta.AccountID),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	if !marked {
+		// Active again, or flagged, since it was listed
+		return
+	}
+
+	result.Marked++
+	logger.InfoContext(ctx, "Account marked inactive",
+		slog.String("account_id", meta.AccountID),
+		slog.String("action", action),
+		slog.String("last_active_at", lastActive.UTC().Format(time.RFC3339)),
+	)
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadAccountReaper(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	dynamoClient := dynamodb.NewFromConfig(result.Config)
+
+	deps = &Dependencies{
+		Accounts: account.NewDynamoDBStore(dynamoClient, cfg.Table),
+		Config:   cfg,
+		Now:      time.Now,
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+var testNow = time.Date(2026, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// markCall records a MarkInactive call
+type markCall struct {
+	accountID  string
+	action     string
+	cutoff     time.Time
+	deletionAt time.Time
+	event      publisher.EventPayload
+}
+
+// mockAccountStore returns queued pages of accounts and records marks
+type mockAccountStore struct {
+	pages   [][]account.Meta
+	cursors []string
+	listErr error
+	marked  bool
+	markErr error
+	marks   []markCall
+}
+
+func (m *mockAccountStore) ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error) {
+	if m.listErr != nil {
+		return nil, "", m.listErr
+	}
+	m.cursors = append(m.cursors, cursor)
+	page := m.pages[0]
+	m.pages = m.pages[1:]
+	next := ""
+	if len(m.pages) > 0 {
+		next = "next"
+	}
+	return page, next, nil
+}
+
+func (m *mockAccountStore) MarkInactive(ctx context.Context, accountID, action string, cutoff, deletionAt time.Time, event publisher.EventPayload) (bool, error) {
+	m.marks = append(m.marks, markCall{accountID, action, cutoff, deletionAt, event})
+	return m.marked, m.markErr
+}
+
+func setupTestDeps(store *mockAccountStore, action string) {
+	deps = &Dependencies{
+		Accounts: store,
+		Config: config.AccountReaper{
+			Table:         "jmap",
+			InactiveAfter: 90 * 24 * time.Hour,
+			Action:        action,
+			DeletionDelay: 30 * 24 * time.Hour,
+		},
+		Now: func() time.Time { return testNow },
+	}
+}
+
+func TestHandler_MarksStaleAccounts(t *testing.T) {
+	store := &mockAccountStore{
+		marked: true,
+		pages: [][]account.Meta{
+			{
+				{AccountID: "stale", CreatedAt: "2025-01-01T00:00:00Z", LastActivityAt: "2026-01-01T00:00:00Z"},
+				{AccountID: "recent", CreatedAt: "2025-01-01T00:00:00Z", LastActivityAt: "2026-05-01T00:00:00Z"},
+			},
+			{
+				{AccountID: "discovered", CreatedAt: "2025-01-01T00:00:00Z", LastDiscoveryAccess: "2026-05-30T00:00:00Z"},
+				{AccountID: "flagged", CreatedAt: "2025-01-01T00:00:00Z", InactiveAt: "2026-05-01T00:00:00Z"},
+				{AccountID: "unknown"},
+			},
+		},
+	}
+	setupTestDeps(store, account.InactiveFlag)
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(store.cursors, []string{"", "next"}) {
+		t.Errorf("expected both pages read, got cursors %v", store.cursors)
+	}
+	if len(store.marks) != 1 || store.marks[0].accountID != "stale" {
+		t.Fatalf("expected only the stale account marked, got %+v", store.marks)
+	}
+
+	mark := store.marks[0]
+	if !mark.cutoff.Equal(testNow.Add(-90*24*time.Hour)) || !mark.deletionAt.IsZero() {
+		t.Errorf("unexpected cutoff %v or deletion %v", mark.cutoff, mark.deletionAt)
+	}
+	if mark.event.EventType != publisher.EventAccountInactive || mark.event.AccountID != "stale" {
+		t.Errorf("unexpected event %+v", mark.event)
+	}
+	if mark.event.Data["lastActiveAt"] != "2026-01-01T00:00:00Z" || mark.event.Data["action"] != "flag" {
+		t.Errorf("unexpected event data %v", mark.event.Data)
+	}
+	if _, ok := mark.event.Data["deletionScheduledAt"]; ok {
+		t.Error("expected no deletionScheduledAt for the flag action")
+	}
+}
+
+func TestHandler_ScheduleDeletion(t *testing.T) {
+	store := &mockAccountStore{
+		marked: true,
+		pages:  [][]account.Meta{{{AccountID: "stale", CreatedAt: "2025-01-01T00:00:00Z"}}},
+	}
+	setupTestDeps(store, account.InactiveDeletion)
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.marks) != 1 {
+		t.Fatalf("expected one mark, got %d", len(store.marks))
+	}
+	mark := store.marks[0]
+	if !mark.deletionAt.Equal(testNow.Add(30*24*time.Hour)) || mark.action != account.InactiveDeletion {
+		t.Errorf("unexpected mark %+v", mark)
+	}
+	if mark.event.Data["deletionScheduledAt"] != "2026-07-01T00:00:00Z" {
+		t.Errorf("unexpected event data %v", mark.event.Data)
+	}
+}
+
+func TestHandler_MarkFailure_ContinuesAndReturnsError(t *testing.T) {
+	store := &mockAccountStore{
+		markErr: errors.New("dynamo down"),
+		pages: [][]account.Meta{{
+			{AccountID: "stale-1", CreatedAt: "2025-01-01T00:00:00Z"},
+			{AccountID: "stale-2", CreatedAt: "2025-01-01T00:00:00Z"},
+		}},
+	}
+	setupTestDeps(store, account.InactiveSuspend)
+
+	if err := handler(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+	if len(store.marks) != 2 {
+		t.Errorf("expected both accounts tried, got %d", len(store.marks))
+	}
+}
+
+func TestHandler_ListFailure_ReturnsError(t *testing.T) {
+	store := &mockAccountStore{listErr: errors.New("dynamo down")}
+	setupTestDeps(store, account.InactiveFlag)
+
+	if err := handler(context.Background()); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestHandler_StopsNearDeadline(t *testing.T) {
+	store := &mockAccountStore{
+		pages: [][]account.Meta{{}, {}},
+	}
+	setupTestDeps(store, account.InactiveFlag)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := handler(ctx); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.cursors) != 1 {
+		t.Errorf("expected one page read before stopping, got %d", len(store.cursors))
+	}
+}
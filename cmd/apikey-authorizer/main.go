@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/apikey"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// KeyAuthenticator validates presented API keys
+type KeyAuthenticator interface {
+	Authenticate(ctx context.Context, token string) (*apikey.Key, error)
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Keys KeyAuthenticator
+}
+
+var deps *Dependencies
+
+// errUnauthorized makes API Gateway respond 401 without invoking the route
+var errUnauthorized = errors.New("Unauthorized")
+
+// routeScopes maps each key-authenticated route (HTTP method + API Gateway
+// resource path) to the scope a key needs to call it
+var routeScopes = map[string]string{
+	"POST /upload-key/{accountId}":           apikey.ScopeUpload,
+	"GET /download-key/{accountId}/{blobId}": apikey.ScopeRead,
+}
+
+// handler validates the API key in the Authorization header and allows the
+// request if the key has the scope the route needs. The key's account is
+// passed to the route in the authorizer context; the route checks it against
+// the account in the path.
+func handler(ctx context.Context, request events.APIGatewayCustomAuthorizerRequestTypeRequest) (events.APIGatewayCustomAuthorizerResponse, error) {
+	token := bearerToken(request.Headers)
+	if token == "" {
+		return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+	}
+
+	key, err := deps.Keys.Authenticate(ctx, token)
+	if err != nil {
+		if errors.Is(err, apikey.ErrInvalidKey) {
+			logger.WarnContext(ctx, "Invalid API key presented",
+				slog.String("resource", request.Resource),
+			)
+			return events.APIGatewayCustomAuthorizerResponse{}, errUnauthorized
+		}
+		logger.ErrorContext(ctx, "Failed to validate API key",
+			slog.String("error", err.Error()),
+		)
+		return events.APIGatewayCustomAuthorizerResponse{}, err
+	}
+
+	effect := "Allow"
+	scope, ok := routeScopes[request.HTTPMethod+" "+request.Resource]
+	if !ok || !key.HasScope(scope) {
+		logger.WarnContext(ctx, "API key lacks scope for route",
+			slog.String("account_id", key.AccountID),
+			slog.String("api_key_id", key.KeyID),
+			slog.String("resource", request.Resource),
+			slog.String("scope", scope),
+		)
+		effect = "Deny"
+	}
+
+	return events.APIGatewayCustomAuthorizerResponse{
+		PrincipalID: key.AccountID,
+		PolicyDocument: events.APIGatewayCustomAuthorizerPolicy{
+			Version: "2012-10-17",
+			Statement: []events.IAMPolicyStatement{
+				{
+					Action:   []string{"execute-api:Invoke"},
+					Effect:   effect,
+					Resource: []string{request.MethodArn},
+				},
+			},
+		},
+		Context: map[string]any{
+			auth.APIKeyIDField:        key.KeyID,
+			auth.APIKeyAccountIDField: key.AccountID,
+			auth.APIKeyScopesField:    strings.Join(key.Scopes, ","),
+		},
+	}, nil
+}
+
+// bearerToken returns the token from an "Authorization: Bearer" header
+func bearerToken(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Authorization") {
+			scheme, token, ok := strings.Cut(value, " ")
+			if ok && strings.EqualFold(scheme, "Bearer") {
+				return strings.TrimSpace(token)
+			}
+		}
+	}
+	return ""
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadCore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	deps = &Dependencies{
+		Keys: apikey.NewDynamoDBStore(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), tableName),
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/apikey"
+)
+
+// mockKeys authenticates a single known token
+type mockKeys struct {
+	token string
+	key   *apikey.Key
+	err   error
+}
+
+func (m *mockKeys) Authenticate(ctx context.Context, token string) (*apikey.Key, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	if token != m.token {
+		return nil, apikey.ErrInvalidKey
+	}
+	return m.key, nil
+}
+
+func setupKeys(scopes ...string) {
+	deps = &Dependencies{Keys: &mockKeys{
+		token: "jmk.abc.s3cret",
+		key:   &apikey.Key{KeyID: "abc", AccountID: "user-1", Scopes: scopes},
+	}}
+}
+
+func uploadRequest(authorization string) events.APIGatewayCustomAuthorizerRequestTypeRequest {
+	return events.APIGatewayCustomAuthorizerRequestTypeRequest{
+		MethodArn:  "arn:aws:execute-api:ap-southeast-2:123456789012:api/v1/POST/upload-key/user-1",
+		Resource:   "/upload-key/{accountId}",
+		HTTPMethod: "POST",
+		Headers:    map[string]string{"authorization": authorization},
+	}
+}
+
+func TestHandler_AllowsKeyWithScope(t *testing.T) {
+	setupKeys(apikey.ScopeUpload)
+
+	response, err := handler(context.Background(), uploadRequest("Bearer jmk.abc.s3cret"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	statement := response.PolicyDocument.Statement[0]
+	if statement.Effect != "Allow" || statement.Resource[0] != "arn:aws:execute-api:ap-southeast-2:123456789012:api/v1/POST/upload-key/user-1" {
+		t.Errorf("unexpected policy statement: %+v", statement)
+	}
+	if response.Context["accountId"] != "user-1" || response.Context["apiKeyId"] != "abc" || response.Context["scopes"] != "upload" {
+		t.Errorf("unexpected context: %v", response.Context)
+	}
+}
+
+func TestHandler_DeniesKeyWithoutScope(t *testing.T) {
+	setupKeys(apikey.ScopeRead)
+
+	response, err := handler(context.Background(), uploadRequest("Bearer jmk.abc.s3cret"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if effect := response.PolicyDocument.Statement[0].Effect; effect != "Deny" {
+		t.Errorf("expected a read-only key to be denied upload, got %s", effect)
+	}
+}
+
+func TestHandler_UnauthorizedKeys(t *testing.T) {
+	setupKeys(apikey.ScopeUpload)
+
+	for _, authorization := range []string{"", "jmk.abc.s3cret", "Bearer jmk.abc.wrong", "Basic dXNlcjpwYXNz"} {
+		if _, err := handler(context.Background(), uploadRequest(authorization)); !errors.Is(err, errUnauthorized) {
+			t.Errorf("expected Unauthorized for %q, got %v", authorization, err)
+		}
+	}
+}
+
+func TestHandler_StoreError(t *testing.T) {
+	deps = &Dependencies{Keys: &mockKeys{err: errors.New("throttled")}}
+
+	_, err := handler(context.Background(), uploadRequest("Bearer jmk.abc.s3cret"))
+	if err == nil || errors.Is(err, errUnauthorized) {
+		t.Errorf("expected a server error, got %v", err)
+	}
+}
@@ -2,30 +2,28 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
-	"strconv"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // PendingAllocation represents an expired pending allocation record
-type PendingAllocation struct {
-	AccountID string
-	BlobID    string
-	S3Key     string
-	Size      int64
-	IAMAuth   bool
-}
+type PendingAllocation = blobmeta.PendingAllocation
 
 // CleanupStorage handles S3 operations for cleanup
 type CleanupStorage interface {
@@ -38,13 +36,22 @@ type CleanupDB interface {
 	CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error
 }
 
+// RunMetrics records per-run cleanup metrics
+type RunMetrics interface {
+	RecordCleanupRun(run metrics.CleanupRun)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
 	Storage     CleanupStorage
 	DB          CleanupDB
+	Metrics     RunMetrics
 	BufferHours int
 }
 
+// functionName is the Function dimension of this Lambda's run metrics
+const functionName = "blob-alloc-cleanup"
+
 var deps *Dependencies
 
 // handler processes scheduled cleanup events
@@ -57,12 +64,20 @@ func handler(ctx context.Context) error {
 		slog.Int("buffer_hours", deps.BufferHours),
 	)
 
+	run := metrics.CleanupRun{Function: functionName}
+	defer func() {
+		if deps.Metrics != nil {
+			deps.Metrics.RecordCleanupRun(run)
+		}
+	}()
+
 	// Query for expired pending allocations
 	allocations, err := deps.DB.GetExpiredPendingAllocations(ctx, cutoff)
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to query expired allocations",
 			slog.String("error", err.Error()),
 		)
+		run.Errored = 1
 		return fmt.Errorf("failed to query expired allocations: %w", err)
 	}
 
@@ -71,8 +86,7 @@ func handler(ctx context.Context) error {
 	)
 
 	// Process each expired allocation
-	cleanedCount := 0
-	errorCount := 0
+	run.Scanned = len(allocations)
 	for _, alloc := range allocations {
 		// Delete S3 object first (idempotent - already gone is success)
 		if err := deps.Storage.DeleteObject(ctx, alloc.S3Key); err != nil {
@@ -82,22 +96,32 @@ func handler(ctx context.Context) error {
 				slog.String("s3_key", alloc.S3Key),
 				slog.String("error", err.Error()),
 			)
-			errorCount++
+			run.Errored++
 			continue // Don't clean up DynamoDB if S3 delete failed
 		}
 
-		// Clean up DynamoDB (delete blob record, restore quota)
-		if err := deps.DB.CleanupAllocation(ctx, alloc.AccountID, alloc.BlobID, alloc.Size, alloc.IAMAuth); err != nil {
+		// Clean up DynamoDB (delete blob record, restore quota). A blob no
+		// longer pending was confirmed or cleaned up by an earlier run.
+		err := deps.DB.CleanupAllocation(ctx, alloc.AccountID, alloc.BlobID, alloc.Size, alloc.IAMAuth)
+		if errors.Is(err, store.ErrNotPending) {
+			logger.InfoContext(ctx, "Allocation no longer pending",
+				slog.String("account_id", alloc.AccountID),
+				slog.String("blob_id", alloc.BlobID),
+			)
+			continue
+		}
+		if err != nil {
 			logger.ErrorContext(ctx, "Failed to cleanup DynamoDB record",
 				slog.String("account_id", alloc.AccountID),
 				slog.String("blob_id", alloc.BlobID),
 				slog.String("error", err.Error()),
 			)
-			errorCount++
+			run.Errored++
 			continue
 		}
 
-		cleanedCount++
+		run.Cleaned++
+		run.QuotaRestoredBytes += alloc.Size
 		logger.InfoContext(ctx, "Cleaned up expired allocation",
 			slog.String("account_id", alloc.AccountID),
 			slog.String("blob_id", alloc.BlobID),
@@ -106,210 +130,79 @@ func handler(ctx context.Context) error {
 
 	logger.InfoContext(ctx, "Blob allocation cleanup completed",
 		slog.Int("total", len(allocations)),
-		slog.Int("cleaned", cleanedCount),
-		slog.Int("errors", errorCount),
+		slog.Int("cleaned", run.Cleaned),
+		slog.Int("errors", run.Errored),
+		slog.Int64("quota_restored_bytes", run.QuotaRestoredBytes),
 	)
 
 	return nil
 }
 
-// S3CleanupStorage implements CleanupStorage using AWS S3
-type S3CleanupStorage struct {
-	client     *s3.Client
-	bucketName string
-}
-
-// NewS3CleanupStorage creates a new S3CleanupStorage
-func NewS3CleanupStorage(client *s3.Client, bucketName string) *S3CleanupStorage {
-	return &S3CleanupStorage{
-		client:     client,
-		bucketName: bucketName,
-	}
-}
-
-// DeleteObject deletes an S3 object
-func (s *S3CleanupStorage) DeleteObject(ctx context.Context, key string) error {
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-	})
-	return err
-}
-
-// DynamoDBCleanupStore implements CleanupDB using AWS DynamoDB
-type DynamoDBCleanupStore struct {
-	client    *dynamodb.Client
-	tableName string
-}
-
-// NewDynamoDBCleanupStore creates a new DynamoDBCleanupStore
-func NewDynamoDBCleanupStore(client *dynamodb.Client, tableName string) *DynamoDBCleanupStore {
-	return &DynamoDBCleanupStore{
-		client:    client,
-		tableName: tableName,
-	}
-}
-
-// GetExpiredPendingAllocations queries the GSI for expired pending allocations
-func (d *DynamoDBCleanupStore) GetExpiredPendingAllocations(ctx context.Context, cutoff time.Time) ([]PendingAllocation, error) {
-	// Build cutoff string for GSI query
-	// GSI1SK format: EXPIRES#{urlExpiresAt}#{accountId}#{blobId}
-	cutoffStr := fmt.Sprintf("EXPIRES#%s#", cutoff.UTC().Format(time.RFC3339))
+func main() {
+	ctx := context.Background()
 
-	result, err := d.client.Query(ctx, &dynamodb.QueryInput{
-		TableName:              aws.String(d.tableName),
-		IndexName:              aws.String("gsi1"),
-		KeyConditionExpression: aws.String("gsi1pk = :pending AND gsi1sk < :cutoff"),
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":pending": &types.AttributeValueMemberS{Value: "PENDING"},
-			":cutoff":  &types.AttributeValueMemberS{Value: cutoffStr},
-		},
-	})
+	result, err := awsinit.Init(ctx)
 	if err != nil {
-		return nil, err
-	}
-
-	allocations := make([]PendingAllocation, 0, len(result.Items))
-	for _, item := range result.Items {
-		alloc := PendingAllocation{}
-
-		// Extract accountId from pk (ACCOUNT#{accountId})
-		if pkAttr, ok := item["pk"].(*types.AttributeValueMemberS); ok {
-			if len(pkAttr.Value) > 8 {
-				alloc.AccountID = pkAttr.Value[8:] // Skip "ACCOUNT#"
-			}
-		}
-
-		// Extract blobId from sk (BLOB#{blobId})
-		if skAttr, ok := item["sk"].(*types.AttributeValueMemberS); ok {
-			if len(skAttr.Value) > 5 {
-				alloc.BlobID = skAttr.Value[5:] // Skip "BLOB#"
-			}
-		}
-
-		// Extract s3Key
-		if s3KeyAttr, ok := item["s3Key"].(*types.AttributeValueMemberS); ok {
-			alloc.S3Key = s3KeyAttr.Value
-		}
-
-		// Extract size
-		if sizeAttr, ok := item["size"].(*types.AttributeValueMemberN); ok {
-			alloc.Size, _ = strconv.ParseInt(sizeAttr.Value, 10, 64)
-		}
-
-		// Extract iamAuth flag
-		if iaAttr, ok := item["iamAuth"].(*types.AttributeValueMemberBOOL); ok {
-			alloc.IAMAuth = iaAttr.Value
-		}
-
-		if alloc.AccountID != "" && alloc.BlobID != "" {
-			allocations = append(allocations, alloc)
-		}
-	}
-
-	return allocations, nil
-}
-
-// CleanupAllocation deletes the blob record and restores quota atomically.
-// When iamAuth is true, skips pending allocations count decrement.
-func (d *DynamoDBCleanupStore) CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-
-	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{
-			{
-				Delete: &types.Delete{
-					TableName: aws.String(d.tableName),
-					Key: map[string]types.AttributeValue{
-						"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-						"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-					},
-					// Only delete if still pending
-					ConditionExpression: aws.String("#status = :pending"),
-					ExpressionAttributeNames: map[string]string{
-						"#status": "status",
-					},
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":pending": &types.AttributeValueMemberS{Value: "pending"},
-					},
-				},
-			},
-			d.buildCleanupMetaUpdate(accountID, now, size, iamAuth),
-		},
-	})
-
-	return err
-}
-
-// buildCleanupMetaUpdate builds the META# update for cleanup.
-// IAM auth: only restore quota (no pending count to decrement).
-// Non-IAM: decrement pending count and restore quota.
-func (d *DynamoDBCleanupStore) buildCleanupMetaUpdate(accountID, now string, size int64, iamAuth bool) types.TransactWriteItem {
-	metaKey := map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-		"sk": &types.AttributeValueMemberS{Value: "META#"},
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	defer result.Cleanup()
 
-	var updateExpr string
-	exprValues := map[string]types.AttributeValue{
-		":size": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", size)},
-		":now":  &types.AttributeValueMemberS{Value: now},
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	if iamAuth {
-		updateExpr = "ADD quotaRemaining :size SET updatedAt = :now"
-	} else {
-		updateExpr = "ADD pendingAllocationsCount :negOne, quotaRemaining :size SET updatedAt = :now"
-		exprValues[":negOne"] = &types.AttributeValueMemberN{Value: "-1"}
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	return types.TransactWriteItem{
-		Update: &types.Update{
-			TableName:                 aws.String(d.tableName),
-			Key:                       metaKey,
-			UpdateExpression:          aws.String(updateExpr),
-			ExpressionAttributeValues: exprValues,
-		},
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
-}
 
-func main() {
-	ctx := context.Background()
-
-	result, err := awsinit.Init(ctx)
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobCleanup(os.Getenv)
 	if err != nil {
-		logger.Error("FATAL: Failed to initialize AWS",
+		logger.Error("FATAL: Invalid configuration",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
-	defer result.Cleanup()
+	tableName := cfg.Table
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	storage, err := blobstore.Open(result.Config, cfg.Storage)
+	if err != nil {
+		logger.Error("FATAL: Failed to open blob storage",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	bucketName := os.Getenv("BLOB_BUCKET")
-	if bucketName == "" {
-		logger.Error("FATAL: BLOB_BUCKET environment variable is required")
-		panic("BLOB_BUCKET environment variable is required")
-	}
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 
-	bufferHours, _ := strconv.Atoi(os.Getenv("CLEANUP_BUFFER_HOURS"))
-	if bufferHours == 0 {
-		bufferHours = 72 // Default 3 days
+	deps = &Dependencies{
+		Storage:     storage,
+		DB:          store.NewBlobStore(dynamoClient, tableName),
+		BufferHours: cfg.BufferHours,
 	}
 
-	s3Client := s3.NewFromConfig(result.Config)
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
-
-	deps = &Dependencies{
-		Storage:     NewS3CleanupStorage(s3Client, bucketName),
-		DB:          NewDynamoDBCleanupStore(dynamoClient, tableName),
-		BufferHours: bufferHours,
+	// Per-run metrics are written to the function log in EMF
+	if cfg.MetricNamespace != "" {
+		deps.Metrics = metrics.NewEMF(os.Stdout, cfg.MetricNamespace)
 	}
 
 	result.Start(handler)
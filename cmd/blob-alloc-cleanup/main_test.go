@@ -5,6 +5,17 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// The in-memory fakes satisfy this Lambda's storage interfaces
+var (
+	_ CleanupStorage = (*fakes.Bucket)(nil)
+	_ CleanupDB      = (*fakes.Table)(nil)
 )
 
 // MockStorage implements CleanupStorage for testing
@@ -246,3 +257,124 @@ func TestHandler_GetExpiredFails_ReturnsError(t *testing.T) {
 		t.Fatal("expected error when GetExpiredPendingAllocations fails")
 	}
 }
+
+// MockRunMetrics implements RunMetrics for testing
+type MockRunMetrics struct {
+	Runs []metrics.CleanupRun
+}
+
+func (m *MockRunMetrics) RecordCleanupRun(run metrics.CleanupRun) {
+	m.Runs = append(m.Runs, run)
+}
+
+func TestHandler_RecordsRunMetrics(t *testing.T) {
+	mockMetrics := &MockRunMetrics{}
+	deps = &Dependencies{
+		Storage: &MockStorage{},
+		DB: &MockDB{
+			GetExpiredPendingResult: []PendingAllocation{
+				{AccountID: "account-1", BlobID: "blob-1", S3Key: "account-1/blob-1", Size: 1024},
+				{AccountID: "account-1", BlobID: "blob-2", S3Key: "account-1/blob-2", Size: 2048},
+			},
+		},
+		Metrics:     mockMetrics,
+		BufferHours: 72,
+	}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := metrics.CleanupRun{Function: "blob-alloc-cleanup", Scanned: 2, Cleaned: 2, QuotaRestoredBytes: 3072}
+	if len(mockMetrics.Runs) != 1 || mockMetrics.Runs[0] != want {
+		t.Errorf("expected run %+v, got %+v", want, mockMetrics.Runs)
+	}
+}
+
+func TestHandler_RecordsRunMetrics_Errors(t *testing.T) {
+	mockMetrics := &MockRunMetrics{}
+	deps = &Dependencies{
+		Storage: &MockStorage{},
+		DB: &MockDB{
+			GetExpiredPendingResult: []PendingAllocation{
+				{AccountID: "account-1", BlobID: "blob-1", S3Key: "account-1/blob-1", Size: 1024},
+			},
+			CleanupAllocationErr: errors.New("transaction cancelled"),
+		},
+		Metrics:     mockMetrics,
+		BufferHours: 72,
+	}
+	_ = handler(context.Background())
+
+	deps.DB = &MockDB{GetExpiredPendingErr: errors.New("throttled")}
+	_ = handler(context.Background())
+
+	if len(mockMetrics.Runs) != 2 {
+		t.Fatalf("expected two runs, got %+v", mockMetrics.Runs)
+	}
+	if run := mockMetrics.Runs[0]; run.Scanned != 1 || run.Errored != 1 || run.Cleaned != 0 || run.QuotaRestoredBytes != 0 {
+		t.Errorf("unexpected run %+v", run)
+	}
+	if run := mockMetrics.Runs[1]; run.Errored != 1 {
+		t.Errorf("expected failed query to count as an error, got %+v", run)
+	}
+}
+
+func TestHandler_NoLongerPending_Skipped(t *testing.T) {
+	mockMetrics := &MockRunMetrics{}
+	deps = &Dependencies{
+		Storage: &MockStorage{},
+		DB: &MockDB{
+			GetExpiredPendingResult: []PendingAllocation{
+				{AccountID: "account-1", BlobID: "blob-1", S3Key: "account-1/blob-1", Size: 1024},
+			},
+			CleanupAllocationErr: store.ErrNotPending,
+		},
+		Metrics:     mockMetrics,
+		BufferHours: 72,
+	}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := metrics.CleanupRun{Function: "blob-alloc-cleanup", Scanned: 1}
+	if len(mockMetrics.Runs) != 1 || mockMetrics.Runs[0] != want {
+		t.Errorf("expected run %+v, got %+v", want, mockMetrics.Runs)
+	}
+}
+
+func TestHandler_WithFakes_RestoresQuota(t *testing.T) {
+	ctx := context.Background()
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 4096, QuotaRemaining: 4096})
+
+	expired := time.Now().Add(-100 * time.Hour)
+	if err := table.AllocateBlob(ctx, "account-1", "blob-1", 1024, "text/plain", expired, 10, "account-1/blob-1", false, "", false, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected allocate error: %v", err)
+	}
+	if err := table.AllocateBlob(ctx, "account-1", "blob-2", 2048, "text/plain", time.Now().Add(time.Hour), 10, "account-1/blob-2", false, "", false, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected allocate error: %v", err)
+	}
+	bucket.PutObject("account-1/blob-1", []byte("abandoned"), "text/plain")
+
+	deps = &Dependencies{Storage: bucket, DB: table, BufferHours: 72}
+	if err := handler(ctx); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := bucket.Object("account-1/blob-1"); ok {
+		t.Error("expected expired object to be deleted")
+	}
+	if _, ok := table.Blob("account-1", "blob-1"); ok {
+		t.Error("expected expired blob record to be deleted")
+	}
+	if _, ok := table.Blob("account-1", "blob-2"); !ok {
+		t.Error("expected unexpired blob record to be kept")
+	}
+	meta, _ := table.Account("account-1")
+	if meta.QuotaRemaining != 2048 || meta.PendingAllocationsCount != 1 {
+		t.Errorf("expected quota 2048 and 1 pending, got %+v", meta)
+	}
+}
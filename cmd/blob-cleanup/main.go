@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -9,13 +10,17 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // BlobDeleter deletes blob objects from S3
 type BlobDeleter interface {
@@ -27,27 +32,55 @@ type BlobDBDeleter interface {
 	DeleteBlobRecord(ctx context.Context, pk, sk string, accountID string, size int64) error
 }
 
+// RunMetrics records per-run cleanup metrics
+type RunMetrics interface {
+	RecordCleanupRun(run metrics.CleanupRun)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
 	S3Deleter  BlobDeleter
 	DBDeleter  BlobDBDeleter
+	Metrics    RunMetrics
 	BlobBucket string
 }
 
 var deps *Dependencies
 
-// handler processes DynamoDB stream events for blob cleanup
-func handler(ctx context.Context, event events.DynamoDBEvent) error {
+// functionName is the Function dimension of this Lambda's run metrics
+const functionName = "blob-cleanup"
+
+// handler processes DynamoDB stream events for blob cleanup. Each record is
+// processed on its own, and those that fail are reported back so the stream
+// retries them without repeating the records that succeeded.
+func handler(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	run := metrics.CleanupRun{Function: functionName}
+	defer func() {
+		if deps.Metrics != nil {
+			deps.Metrics.RecordCleanupRun(run)
+		}
+	}()
+
+	var response events.DynamoDBEventResponse
 	for _, record := range event.Records {
-		if err := processRecord(ctx, record); err != nil {
-			return err
+		run.Scanned++
+		if err := processRecord(ctx, record, &run); err != nil {
+			run.Errored++
+			logger.ErrorContext(ctx, "Blob cleanup failed, record will be retried",
+				slog.String("sequence_number", record.Change.SequenceNumber),
+				slog.String("error", err.Error()),
+			)
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
 		}
 	}
-	return nil
+	return response, nil
 }
 
-// processRecord handles a single DynamoDB stream record
-func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+// processRecord handles a single DynamoDB stream record, adding deletions to
+// the run's counts
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord, run *metrics.CleanupRun) error {
 	// Only process MODIFY events
 	if record.EventName != "MODIFY" {
 		return nil
@@ -103,8 +136,17 @@ func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error
 		return fmt.Errorf("failed to delete S3 object %s: %w", s3Key, err)
 	}
 
-	// Delete DynamoDB record and restore quota
-	if err := deps.DBDeleter.DeleteBlobRecord(ctx, pk, sk, accountID, size); err != nil {
+	// Delete DynamoDB record and restore quota. A record already removed means
+	// this event was delivered before and its quota already restored.
+	err := deps.DBDeleter.DeleteBlobRecord(ctx, pk, sk, accountID, size)
+	if errors.Is(err, store.ErrAlreadyDeleted) {
+		logger.InfoContext(ctx, "Blob record already cleaned up",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return nil
+	}
+	if err != nil {
 		logger.ErrorContext(ctx, "Failed to delete DynamoDB record",
 			slog.String("pk", pk),
 			slog.String("sk", sk),
@@ -113,6 +155,11 @@ func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error
 		return fmt.Errorf("failed to delete DynamoDB record %s/%s: %w", pk, sk, err)
 	}
 
+	run.Cleaned++
+	if accountID != "" {
+		run.QuotaRestoredBytes += size
+	}
+
 	logger.InfoContext(ctx, "Blob cleanup complete",
 		slog.String("account_id", accountID),
 		slog.String("blob_id", blobID),
@@ -173,64 +220,6 @@ func (d *S3BlobDeleter) DeleteObject(ctx context.Context, bucket, key string) er
 	return err
 }
 
-// DynamoDBBlobDeleter implements BlobDBDeleter using AWS DynamoDB
-type DynamoDBBlobDeleter struct {
-	client    *dynamodb.Client
-	tableName string
-}
-
-// NewDynamoDBBlobDeleter creates a new DynamoDBBlobDeleter
-func NewDynamoDBBlobDeleter(client *dynamodb.Client, tableName string) *DynamoDBBlobDeleter {
-	return &DynamoDBBlobDeleter{
-		client:    client,
-		tableName: tableName,
-	}
-}
-
-// DeleteBlobRecord deletes a blob record from DynamoDB and restores quota to META#
-func (d *DynamoDBBlobDeleter) DeleteBlobRecord(ctx context.Context, pk, sk string, accountID string, size int64) error {
-	// If we don't have accountID or size, fall back to simple delete
-	if accountID == "" || size == 0 {
-		_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
-			TableName: aws.String(d.tableName),
-			Key: map[string]types.AttributeValue{
-				"pk": &types.AttributeValueMemberS{Value: pk},
-				"sk": &types.AttributeValueMemberS{Value: sk},
-			},
-		})
-		return err
-	}
-
-	// Use transaction to delete blob and restore quota atomically
-	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{
-			{
-				Delete: &types.Delete{
-					TableName: aws.String(d.tableName),
-					Key: map[string]types.AttributeValue{
-						"pk": &types.AttributeValueMemberS{Value: pk},
-						"sk": &types.AttributeValueMemberS{Value: sk},
-					},
-				},
-			},
-			{
-				Update: &types.Update{
-					TableName: aws.String(d.tableName),
-					Key: map[string]types.AttributeValue{
-						"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-						"sk": &types.AttributeValueMemberS{Value: "META#"},
-					},
-					UpdateExpression: aws.String("ADD quotaRemaining :size"),
-					ExpressionAttributeValues: map[string]types.AttributeValue{
-						":size": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", size)},
-					},
-				},
-			},
-		},
-	})
-	return err
-}
-
 func main() {
 	ctx := context.Background()
 
@@ -243,26 +232,54 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	blobBucket := os.Getenv("BLOB_BUCKET")
-	if blobBucket == "" {
-		logger.Error("FATAL: BLOB_BUCKET environment variable is required")
-		panic("BLOB_BUCKET environment variable is required")
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobCleanup(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	tableName := cfg.Table
+	blobBucket := cfg.Bucket
 
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 	s3Client := s3.NewFromConfig(result.Config)
 
 	deps = &Dependencies{
 		S3Deleter:  NewS3BlobDeleter(s3Client),
-		DBDeleter:  NewDynamoDBBlobDeleter(dynamoClient, tableName),
+		DBDeleter:  store.NewBlobStore(dynamoClient, tableName),
 		BlobBucket: blobBucket,
 	}
 
+	// Per-run metrics are written to the function log in EMF
+	if cfg.MetricNamespace != "" {
+		deps.Metrics = metrics.NewEMF(os.Stdout, cfg.MetricNamespace)
+	}
+
 	result.Start(handler)
 }
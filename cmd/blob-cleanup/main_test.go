@@ -7,6 +7,8 @@ import (
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
 )
 
 // Mock implementations
@@ -112,9 +114,9 @@ func TestCleanup_DeletedAtAdded_DeletesS3AndDB(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 1 {
@@ -155,9 +157,9 @@ func TestCleanup_InsertEvent_Ignored(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 0 {
@@ -177,9 +179,9 @@ func TestCleanup_RemoveEvent_Ignored(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 0 {
@@ -203,9 +205,9 @@ func TestCleanup_ModifyWithoutDeletedAt_Ignored(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 0 {
@@ -228,9 +230,9 @@ func TestCleanup_DeletedAtAlreadyExisted_Ignored(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 0 {
@@ -238,8 +240,8 @@ func TestCleanup_DeletedAtAlreadyExisted_Ignored(t *testing.T) {
 	}
 }
 
-// Test: S3 delete failure returns error (triggers Lambda retry)
-func TestCleanup_S3DeleteFailure_ReturnsError(t *testing.T) {
+// Test: S3 delete failure is reported for retry
+func TestCleanup_S3DeleteFailure_ReportsFailure(t *testing.T) {
 	s3d := &mockS3Deleter{deleteErr: errors.New("s3 error")}
 	dbd := &mockDBDeleter{}
 	setupTestDeps(s3d, dbd)
@@ -250,14 +252,14 @@ func TestCleanup_S3DeleteFailure_ReturnsError(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error from S3 delete failure")
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 1 {
+		t.Fatalf("expected the record to be retried, got %+v", resp.BatchItemFailures)
 	}
 }
 
-// Test: DB delete failure returns error (triggers Lambda retry)
-func TestCleanup_DBDeleteFailure_ReturnsError(t *testing.T) {
+// Test: DB delete failure is reported for retry
+func TestCleanup_DBDeleteFailure_ReportsFailure(t *testing.T) {
 	s3d := &mockS3Deleter{}
 	dbd := &mockDBDeleter{deleteErr: errors.New("db error")}
 	setupTestDeps(s3d, dbd)
@@ -268,14 +270,34 @@ func TestCleanup_DBDeleteFailure_ReturnsError(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error from DB delete failure")
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 1 {
+		t.Fatalf("expected the record to be retried, got %+v", resp.BatchItemFailures)
 	}
 }
 
-// Test: Missing pk in stream record returns error
-func TestCleanup_MissingPK_ReturnsError(t *testing.T) {
+// Test: a record already removed by an earlier delivery is not an error and
+// restores no quota
+func TestCleanup_AlreadyDeleted_Succeeds(t *testing.T) {
+	setupTestDeps(&mockS3Deleter{}, &mockDBDeleter{deleteErr: store.ErrAlreadyDeleted})
+	recorder := &mockRunMetrics{}
+	deps.Metrics = recorder
+
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{makeModifyRecord(blobOldImage(), blobNewImage())},
+	}
+	if resp, _ := handler(context.Background(), event); len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("expected redelivery to succeed, got %+v", resp.BatchItemFailures)
+	}
+
+	want := metrics.CleanupRun{Function: "blob-cleanup", Scanned: 1}
+	if len(recorder.runs) != 1 || recorder.runs[0] != want {
+		t.Errorf("expected run %+v, got %+v", want, recorder.runs)
+	}
+}
+
+// Test: Missing pk in stream record is reported for retry
+func TestCleanup_MissingPK_ReportsFailure(t *testing.T) {
 	s3d := &mockS3Deleter{}
 	dbd := &mockDBDeleter{}
 	setupTestDeps(s3d, dbd)
@@ -289,14 +311,14 @@ func TestCleanup_MissingPK_ReturnsError(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error for missing pk")
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 1 {
+		t.Fatalf("expected the record to be retried, got %+v", resp.BatchItemFailures)
 	}
 }
 
-// Test: Missing s3Key in stream record returns error
-func TestCleanup_MissingS3Key_ReturnsError(t *testing.T) {
+// Test: Missing s3Key in stream record is reported for retry
+func TestCleanup_MissingS3Key_ReportsFailure(t *testing.T) {
 	s3d := &mockS3Deleter{}
 	dbd := &mockDBDeleter{}
 	setupTestDeps(s3d, dbd)
@@ -310,9 +332,9 @@ func TestCleanup_MissingS3Key_ReturnsError(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error for missing s3Key")
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 1 {
+		t.Fatalf("expected the record to be retried, got %+v", resp.BatchItemFailures)
 	}
 }
 
@@ -347,9 +369,9 @@ func TestCleanup_MultipleRecords_AllProcessed(t *testing.T) {
 		},
 	}
 
-	err := handler(context.Background(), event)
-	if err != nil {
-		t.Fatalf("unexpected error: %v", err)
+	resp, _ := handler(context.Background(), event)
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
 	}
 
 	if len(s3d.calls) != 2 {
@@ -360,26 +382,90 @@ func TestCleanup_MultipleRecords_AllProcessed(t *testing.T) {
 	}
 }
 
-// Test: Error on first record stops processing (returns error for retry)
-func TestCleanup_ErrorOnFirstRecord_StopsProcessing(t *testing.T) {
-	s3d := &mockS3Deleter{deleteErr: errors.New("s3 error")}
+// Test: a failed record is reported on its own and later records are still
+// processed
+func TestCleanup_FailedRecord_OthersProcessed(t *testing.T) {
+	s3d := &mockS3Deleter{deleteFunc: func(ctx context.Context, bucket, key string) error {
+		if key == "user-456/blob-123" {
+			return errors.New("s3 error")
+		}
+		return nil
+	}}
 	dbd := &mockDBDeleter{}
 	setupTestDeps(s3d, dbd)
 
+	failing := makeModifyRecord(blobOldImage(), blobNewImage())
+	failing.Change.SequenceNumber = "100"
+	newImg := blobNewImage()
+	newImg["sk"] = newStringAttr("BLOB#blob-999")
+	newImg["s3Key"] = newStringAttr("user-456/blob-999")
+	succeeding := makeModifyRecord(blobOldImage(), newImg)
+	succeeding.Change.SequenceNumber = "200"
+
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{failing, succeeding},
+	}
+
+	resp, err := handler(context.Background(), event)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(resp.BatchItemFailures) != 1 || resp.BatchItemFailures[0].ItemIdentifier != "100" {
+		t.Fatalf("expected only the first record to be retried, got %+v", resp.BatchItemFailures)
+	}
+	if len(s3d.calls) != 2 {
+		t.Errorf("expected 2 S3 delete calls, got %d", len(s3d.calls))
+	}
+	if len(dbd.calls) != 1 || dbd.calls[0].SK != "BLOB#blob-999" {
+		t.Errorf("expected only the second record deleted from DynamoDB, got %+v", dbd.calls)
+	}
+}
+
+type mockRunMetrics struct {
+	runs []metrics.CleanupRun
+}
+
+func (m *mockRunMetrics) RecordCleanupRun(run metrics.CleanupRun) {
+	m.runs = append(m.runs, run)
+}
+
+// Test: each invocation records scanned, cleaned and restored quota
+func TestCleanup_RecordsRunMetrics(t *testing.T) {
+	setupTestDeps(&mockS3Deleter{}, &mockDBDeleter{})
+	recorder := &mockRunMetrics{}
+	deps.Metrics = recorder
+
 	event := events.DynamoDBEvent{
 		Records: []events.DynamoDBEventRecord{
 			makeModifyRecord(blobOldImage(), blobNewImage()),
-			makeModifyRecord(blobOldImage(), blobNewImage()),
+			{EventName: "INSERT"},
 		},
 	}
+	if resp, _ := handler(context.Background(), event); len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
+	}
+
+	want := metrics.CleanupRun{Function: "blob-cleanup", Scanned: 2, Cleaned: 1, QuotaRestoredBytes: 1024}
+	if len(recorder.runs) != 1 || recorder.runs[0] != want {
+		t.Errorf("expected run %+v, got %+v", want, recorder.runs)
+	}
+}
+
+// Test: a failed record is counted as an error
+func TestCleanup_RecordsRunMetrics_Error(t *testing.T) {
+	setupTestDeps(&mockS3Deleter{deleteErr: errors.New("access denied")}, &mockDBDeleter{})
+	recorder := &mockRunMetrics{}
+	deps.Metrics = recorder
 
-	err := handler(context.Background(), event)
-	if err == nil {
-		t.Fatal("expected error")
+	event := events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{makeModifyRecord(blobOldImage(), blobNewImage())},
+	}
+	if resp, _ := handler(context.Background(), event); len(resp.BatchItemFailures) != 1 {
+		t.Fatalf("expected the record to be retried, got %+v", resp.BatchItemFailures)
 	}
 
-	// Only one S3 call should have been made before the error
-	if len(s3d.calls) != 1 {
-		t.Errorf("expected 1 S3 delete call, got %d", len(s3d.calls))
+	want := metrics.CleanupRun{Function: "blob-cleanup", Scanned: 1, Errored: 1}
+	if len(recorder.runs) != 1 || recorder.runs[0] != want {
+		t.Errorf("expected run %+v, got %+v", want, recorder.runs)
 	}
 }
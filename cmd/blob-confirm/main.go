@@ -7,34 +7,33 @@ import (
 	"log/slog"
 	"os"
 	"strings"
-	"time"
+	"sync"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // ConfirmStorage handles S3 operations for blob confirmation
 type ConfirmStorage interface {
-	ConfirmTag(ctx context.Context, key string) error
+	ConfirmTag(ctx context.Context, key string, extra map[string]string) error
 	DeleteObject(ctx context.Context, key string) error
 }
 
 // BlobInfo holds status and metadata about a blob record
-type BlobInfo struct {
-	Status      string
-	SizeUnknown bool
-	IAMAuth     bool
-}
+type BlobInfo = blobmeta.Info
 
 // ConfirmDB handles DynamoDB operations for blob confirmation
 type ConfirmDB interface {
@@ -42,315 +41,322 @@ type ConfirmDB interface {
 	ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error
 }
 
+// HeadReader reads the first bytes of an uploaded object
+type HeadReader interface {
+	ReadHead(ctx context.Context, key string, n int64) ([]byte, error)
+}
+
+// TypeDB records the media type sniffed from a blob's content
+type TypeDB interface {
+	RecordSniffedType(ctx context.Context, accountID, blobID string, result sniff.Result, correct bool) error
+}
+
+// ChecksumReader reads the SHA-256 checksum the storage holds for an object
+type ChecksumReader interface {
+	Checksum(ctx context.Context, key string) (string, error)
+}
+
+// ChecksumDB records a blob's verified checksum
+type ChecksumDB interface {
+	RecordChecksum(ctx context.Context, accountID, blobID, checksum string) error
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
 	Storage ConfirmStorage
 	DB      ConfirmDB
+	// Sniffing is the content sniffing mode; Head and Types are only
+	// needed when it is flag or correct
+	Sniffing string
+	Head     HeadReader
+	Types    TypeDB
+	// Checksums and ChecksumDB verify and record the checksum of blobs
+	// allocated with one
+	Checksums  ChecksumReader
+	ChecksumDB ChecksumDB
 }
 
 var deps *Dependencies
 
-// handler processes S3 ObjectCreated events to confirm blob uploads
+// maxConcurrentConfirms bounds how many records of an event are confirmed at once
+const maxConcurrentConfirms = 8
+
+// handler processes S3 ObjectCreated events to confirm blob uploads. Records
+// are confirmed in parallel, and a record that fails does not stop the
+// others. S3 invokes the function asynchronously, which has no partial batch
+// response, so any failure fails the event as a whole; when it is retried,
+// the records already confirmed are skipped.
 func handler(ctx context.Context, event events.S3Event) error {
 	ctx, span := tracing.StartHandlerSpan(ctx, "BlobConfirmHandler",
 		tracing.Function("blob-confirm"),
 	)
 	defer span.End()
+	span.SetAttributes(attribute.Int("s3.records", len(event.Records)))
+
+	errs := make([]error, len(event.Records))
+	sem := make(chan struct{}, maxConcurrentConfirms)
+	var wg sync.WaitGroup
+	for i, record := range event.Records {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			// Each goroutine writes only its own record's error
+			errs[i] = confirmRecord(ctx, record)
+		}()
+	}
+	wg.Wait()
 
-	for _, record := range event.Records {
-		key := record.S3.Object.Key
-		span.SetAttributes(
-			attribute.String("s3.bucket", record.S3.Bucket.Name),
-			attribute.String("s3.key", key),
-		)
-		logger.InfoContext(ctx, "Processing S3 event",
-			slog.String("bucket", record.S3.Bucket.Name),
-			slog.String("key", key),
-		)
-
-		// Parse key to get accountID and blobID
-		accountID, blobID, err := parseS3Key(key)
+	var failed []error
+	for i, err := range errs {
 		if err != nil {
-			logger.ErrorContext(ctx, "Invalid S3 key format",
-				slog.String("key", key),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("invalid S3 key format: %w", err)
+			failed = append(failed, fmt.Errorf("%s: %w", event.Records[i].S3.Object.Key, err))
 		}
-		span.SetAttributes(tracing.AccountID(accountID), tracing.BlobID(blobID))
-
-		// Check blob record status
-		blobInfo, err := deps.DB.GetBlobInfo(ctx, accountID, blobID)
-		if err != nil {
-			logger.ErrorContext(ctx, "Failed to get blob info",
-				slog.String("account_id", accountID),
-				slog.String("blob_id", blobID),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("failed to get blob info: %w", err)
-		}
-
-		// If record not found, skip - this object may be from a different upload path
-		// (e.g., traditional /upload/ endpoint) or the record may have been cleaned up.
-		// The blob-alloc-cleanup Lambda handles expired pending allocations.
-		if blobInfo == nil {
-			logger.WarnContext(ctx, "Blob record not found, skipping (may be traditional upload)",
-				slog.String("account_id", accountID),
-				slog.String("blob_id", blobID),
-			)
-			continue
-		}
-
-		// If already confirmed, skip (idempotent)
-		if blobInfo.Status == "confirmed" {
-			logger.InfoContext(ctx, "Blob already confirmed, skipping",
-				slog.String("account_id", accountID),
-				slog.String("blob_id", blobID),
-			)
-			continue
-		}
-
-		// IMPORTANT: Operation order is intentional for data safety.
-		//
-		// 1. S3 tag update FIRST: Protects blob from lifecycle deletion. If this
-		//    fails, we return an error and retry - the blob remains "pending" but
-		//    safe (lifecycle only expires untagged pending blobs after 7 days).
-		//
-		// 2. DynamoDB confirmation SECOND: Updates status and quota. If this fails
-		//    after S3 succeeds:
-		//    - The blob is already protected in S3 (tagged as confirmed)
-		//    - Lambda retry will succeed (DynamoDB uses conditional writes for idempotency)
-		//    - No data loss occurs
-		//
-		// The reverse order would risk: DynamoDB confirms → S3 tag fails → lifecycle
-		// deletes the blob before retry → data loss.
-		//
-		// On persistent failure: After Lambda retries are exhausted, the S3 event goes
-		// to the DLQ (blob_confirm_dlq) and triggers a CloudWatch alarm for investigation.
-		if err := deps.Storage.ConfirmTag(ctx, key); err != nil {
-			logger.ErrorContext(ctx, "Failed to update S3 tag",
-				slog.String("key", key),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("failed to update S3 tag: %w", err)
-		}
-
-		// Confirm blob in DynamoDB (update status, remove GSI keys, decrement pending count)
-		actualSize := record.S3.Object.Size
-		if err := deps.DB.ConfirmBlob(ctx, accountID, blobID, actualSize, blobInfo.SizeUnknown, blobInfo.IAMAuth); err != nil {
-			logger.ErrorContext(ctx, "Failed to confirm blob in DynamoDB",
-				slog.String("account_id", accountID),
-				slog.String("blob_id", blobID),
-				slog.String("error", err.Error()),
-			)
-			return fmt.Errorf("failed to confirm blob: %w", err)
-		}
-
-		logger.InfoContext(ctx, "Blob confirmed successfully",
-			slog.String("account_id", accountID),
-			slog.String("blob_id", blobID),
+	}
+	if len(failed) > 0 {
+		err := errors.Join(failed...)
+		logger.ErrorContext(ctx, "Failed to confirm blobs",
+			slog.Int("failed", len(failed)),
+			slog.Int("records", len(event.Records)),
 		)
+		tracing.RecordError(span, err)
+		return err
 	}
-
 	return nil
 }
 
-// parseS3Key extracts accountID and blobID from S3 key (format: {accountId}/{blobId})
-func parseS3Key(key string) (accountID, blobID string, err error) {
-	parts := strings.SplitN(key, "/", 2)
-	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
-		return "", "", fmt.Errorf("invalid key format: expected {accountId}/{blobId}")
-	}
-	return parts[0], parts[1], nil
-}
-
-// S3ConfirmStorage implements ConfirmStorage using AWS S3
-type S3ConfirmStorage struct {
-	client     *s3.Client
-	bucketName string
-}
-
-// NewS3ConfirmStorage creates a new S3ConfirmStorage
-func NewS3ConfirmStorage(client *s3.Client, bucketName string) *S3ConfirmStorage {
-	return &S3ConfirmStorage{
-		client:     client,
-		bucketName: bucketName,
-	}
-}
-
-// ConfirmTag updates the S3 object tag to confirmed
-func (s *S3ConfirmStorage) ConfirmTag(ctx context.Context, key string) error {
-	// Parse key to get accountID for tag
-	accountID, _, _ := parseS3Key(key)
-
-	_, err := s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-		Tagging: &s3types.Tagging{
-			TagSet: []s3types.Tag{
-				{Key: aws.String("Account"), Value: aws.String(accountID)},
-				{Key: aws.String("Status"), Value: aws.String("confirmed")},
-			},
-		},
-	})
-	return err
-}
-
-// DeleteObject deletes an S3 object
-func (s *S3ConfirmStorage) DeleteObject(ctx context.Context, key string) error {
-	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-	})
-	return err
-}
-
-// DynamoDBConfirmStore implements ConfirmDB using AWS DynamoDB
-type DynamoDBConfirmStore struct {
-	client    *dynamodb.Client
-	tableName string
-}
+// confirmRecord confirms the blob uploaded in a single S3 event record
+func confirmRecord(ctx context.Context, record events.S3EventRecord) error {
+	key := record.S3.Object.Key
+	ctx, span := tracing.Tracer("blob-confirm").Start(ctx, "ConfirmRecord")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("s3.bucket", record.S3.Bucket.Name),
+		attribute.String("s3.key", key),
+	)
+	logger.InfoContext(ctx, "Processing S3 event",
+		slog.String("bucket", record.S3.Bucket.Name),
+		slog.String("key", key),
+	)
 
-// NewDynamoDBConfirmStore creates a new DynamoDBConfirmStore
-func NewDynamoDBConfirmStore(client *dynamodb.Client, tableName string) *DynamoDBConfirmStore {
-	return &DynamoDBConfirmStore{
-		client:    client,
-		tableName: tableName,
+	// Parse key to get accountID and blobID
+	accountID, blobID, err := parseS3Key(key)
+	if err != nil {
+		logger.ErrorContext(ctx, "Invalid S3 key format",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("invalid S3 key format: %w", err)
 	}
-}
+	span.SetAttributes(tracing.AccountID(accountID), tracing.BlobID(blobID))
 
-// GetBlobInfo returns status and metadata for a blob record.
-// Returns nil if not found.
-func (d *DynamoDBConfirmStore) GetBlobInfo(ctx context.Context, accountID, blobID string) (*BlobInfo, error) {
-	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-		},
-		ProjectionExpression: aws.String("#status, sizeUnknown, iamAuth"),
-		ExpressionAttributeNames: map[string]string{
-			"#status": "status",
-		},
-	})
+	// Check blob record status
+	blobInfo, err := deps.DB.GetBlobInfo(ctx, accountID, blobID)
 	if err != nil {
-		return nil, err
+		logger.ErrorContext(ctx, "Failed to get blob info",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to get blob info: %w", err)
 	}
 
-	if result.Item == nil {
-		return nil, nil // Not found
+	// Every direct upload reserves a pending record first, so a missing
+	// record means blob-alloc-cleanup removed the expired allocation before
+	// the upload finished
+	if blobInfo == nil {
+		logger.WarnContext(ctx, "Blob record not found, skipping (allocation expired before the upload completed)",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return nil
 	}
 
-	info := &BlobInfo{}
-
-	if statusAttr, ok := result.Item["status"].(*types.AttributeValueMemberS); ok {
-		info.Status = statusAttr.Value
+	// If already confirmed, skip (idempotent)
+	if blobInfo.Status == "confirmed" {
+		logger.InfoContext(ctx, "Blob already confirmed, skipping",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return nil
 	}
 
-	if suAttr, ok := result.Item["sizeUnknown"].(*types.AttributeValueMemberBOOL); ok {
-		info.SizeUnknown = suAttr.Value
+	// An upload of unknown size is held to the limit recorded at allocation.
+	// An object over it is deleted and its allocation left to expire.
+	if blobInfo.SizeUnknown && blobInfo.MaxSize > 0 && record.S3.Object.Size > blobInfo.MaxSize {
+		logger.WarnContext(ctx, "Blob exceeds its maximum size, deleting",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.Int64("size", record.S3.Object.Size),
+			slog.Int64("max_size", blobInfo.MaxSize),
+		)
+		if err := deps.Storage.DeleteObject(ctx, key); err != nil {
+			logger.ErrorContext(ctx, "Failed to delete oversize blob",
+				slog.String("key", key),
+				slog.String("error", err.Error()),
+			)
+			return fmt.Errorf("failed to delete oversize blob: %w", err)
+		}
+		return nil
 	}
 
-	if iaAttr, ok := result.Item["iamAuth"].(*types.AttributeValueMemberBOOL); ok {
-		info.IAMAuth = iaAttr.Value
+	// Verify a declared checksum before the object is protected. An object
+	// that does not match is deleted and its allocation left to expire.
+	if blobInfo.Checksum != "" {
+		verified, err := verifyChecksum(ctx, key, accountID, blobID, blobInfo.Checksum)
+		if err != nil || !verified {
+			return err
+		}
 	}
 
-	return info, nil
-}
-
-// ConfirmBlob updates the blob status to confirmed and decrements the pending count.
-// When sizeUnknown is true, it also sets the actual size and deducts quota.
-// When iamAuth is true, skips pending allocations count decrement.
-func (d *DynamoDBConfirmStore) ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error {
-	now := time.Now().UTC().Format(time.RFC3339)
-
-	blobKey := map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-		"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-	}
-	metaKey := map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-		"sk": &types.AttributeValueMemberS{Value: "META#"},
+	// IMPORTANT: Operation order is intentional for data safety.
+	//
+	// 1. S3 tag update FIRST: Protects blob from lifecycle deletion. If this
+	//    fails, we return an error and retry - the blob remains "pending" but
+	//    safe (lifecycle only expires untagged pending blobs after 7 days).
+	//
+	// 2. DynamoDB confirmation SECOND: Updates status and quota. If this fails
+	//    after S3 succeeds:
+	//    - The blob is already protected in S3 (tagged as confirmed)
+	//    - Lambda retry will succeed (DynamoDB uses conditional writes for idempotency)
+	//    - No data loss occurs
+	//
+	// The reverse order would risk: DynamoDB confirms → S3 tag fails → lifecycle
+	// deletes the blob before retry → data loss.
+	//
+	// On persistent failure: After Lambda retries are exhausted, the S3 event goes
+	// to the DLQ (blob_confirm_dlq) and triggers a CloudWatch alarm. dlq-redrive
+	// sends it back through this handler, and parks it if it keeps failing.
+	//
+	// The tag update also applies any approved tags the allocation asked for,
+	// since presigned uploads are not tagged with them.
+	if err := deps.Storage.ConfirmTag(ctx, key, blobInfo.Tags); err != nil {
+		logger.ErrorContext(ctx, "Failed to update S3 tag",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to update S3 tag: %w", err)
 	}
 
-	// Build blob record update: confirm status, remove GSI keys
-	blobUpdateExpr := "SET #status = :confirmed, confirmedAt = :now REMOVE gsi1pk, gsi1sk"
-	blobExprNames := map[string]string{"#status": "status"}
-	blobExprValues := map[string]types.AttributeValue{
-		":confirmed": &types.AttributeValueMemberS{Value: "confirmed"},
-		":pending":   &types.AttributeValueMemberS{Value: "pending"},
-		":now":       &types.AttributeValueMemberS{Value: now},
+	// Check the declared type against the content before confirming, so a
+	// failure is retried with the blob still pending
+	actualSize := record.S3.Object.Size
+	if err := sniffType(ctx, key, accountID, blobID, blobInfo.ContentType, actualSize); err != nil {
+		return err
 	}
 
-	// When size was unknown, also set actual size and remove sizeUnknown attr
-	if sizeUnknown {
-		blobUpdateExpr = "SET #status = :confirmed, confirmedAt = :now, #size = :actualSize REMOVE gsi1pk, gsi1sk, sizeUnknown"
-		blobExprNames["#size"] = "size"
-		blobExprValues[":actualSize"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", actualSize)}
+	// Confirm blob in DynamoDB (update status, remove GSI keys, decrement pending count)
+	if err := deps.DB.ConfirmBlob(ctx, accountID, blobID, actualSize, blobInfo.SizeUnknown, blobInfo.IAMAuth); err != nil {
+		logger.ErrorContext(ctx, "Failed to confirm blob in DynamoDB",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to confirm blob: %w", err)
 	}
 
-	blobUpdate := &types.Update{
-		TableName:                 aws.String(d.tableName),
-		Key:                       blobKey,
-		UpdateExpression:          aws.String(blobUpdateExpr),
-		ConditionExpression:       aws.String("#status = :pending"),
-		ExpressionAttributeNames:  blobExprNames,
-		ExpressionAttributeValues: blobExprValues,
-	}
+	logger.InfoContext(ctx, "Blob confirmed successfully",
+		slog.String("account_id", accountID),
+		slog.String("blob_id", blobID),
+	)
+	return nil
+}
 
-	// Build META# update: decrement pending count (unless IAM auth), and deduct quota if size was unknown
-	var metaUpdateExpr string
-	metaValues := map[string]types.AttributeValue{
-		":now": &types.AttributeValueMemberS{Value: now},
+// verifyChecksum compares the checksum the storage holds for an object with
+// the one declared at allocation, reporting whether they match. A match is
+// recorded on the blob; an object that does not match is deleted. S3 rejects
+// mismatched uploads itself, so a mismatch here means the object was written
+// some other way.
+func verifyChecksum(ctx context.Context, key, accountID, blobID, declared string) (bool, error) {
+	checksum, err := deps.Checksums.Checksum(ctx, key)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to read blob checksum",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return false, fmt.Errorf("failed to read blob checksum: %w", err)
 	}
 
-	if iamAuth {
-		// IAM auth: no pending count to decrement
-		metaUpdateExpr = "SET updatedAt = :now"
-		if sizeUnknown {
-			metaUpdateExpr = "ADD quotaRemaining :negSize SET updatedAt = :now"
-			metaValues[":negSize"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("-%d", actualSize)}
-		}
-	} else {
-		metaUpdateExpr = "ADD pendingAllocationsCount :negOne SET updatedAt = :now"
-		metaValues[":negOne"] = &types.AttributeValueMemberN{Value: "-1"}
-		if sizeUnknown {
-			metaUpdateExpr = "ADD pendingAllocationsCount :negOne, quotaRemaining :negSize SET updatedAt = :now"
-			metaValues[":negSize"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("-%d", actualSize)}
+	if checksum != declared {
+		logger.ErrorContext(ctx, "Blob content does not match its declared checksum, deleting",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("declared_checksum", declared),
+			slog.String("checksum", checksum),
+		)
+		if err := deps.Storage.DeleteObject(ctx, key); err != nil {
+			logger.ErrorContext(ctx, "Failed to delete mismatched blob",
+				slog.String("key", key),
+				slog.String("error", err.Error()),
+			)
+			return false, fmt.Errorf("failed to delete mismatched blob: %w", err)
 		}
+		return false, nil
 	}
 
-	metaUpdate := &types.Update{
-		TableName:                 aws.String(d.tableName),
-		Key:                       metaKey,
-		UpdateExpression:          aws.String(metaUpdateExpr),
-		ExpressionAttributeValues: metaValues,
+	if err := deps.ChecksumDB.RecordChecksum(ctx, accountID, blobID, checksum); err != nil {
+		logger.ErrorContext(ctx, "Failed to record blob checksum",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return false, fmt.Errorf("failed to record blob checksum: %w", err)
 	}
+	return true, nil
+}
 
-	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: []types.TransactWriteItem{
-			{Update: blobUpdate},
-			{Update: metaUpdate},
-		},
-	})
+// sniffType detects a blob's media type from its first bytes and records it
+// next to the declared type, flagging or correcting a gross mismatch as
+// configured. Empty blobs, and blobs whose declared type is encrypted, are
+// not checked.
+func sniffType(ctx context.Context, key, accountID, blobID, declared string, size int64) error {
+	if deps.Sniffing != sniff.ModeFlag && deps.Sniffing != sniff.ModeCorrect {
+		return nil
+	}
+	if declared == "" || size == 0 {
+		return nil
+	}
 
+	head, err := deps.Head.ReadHead(ctx, key, sniff.HeadSize)
 	if err != nil {
-		// Check for condition check failure (already confirmed)
-		var txCanceled *types.TransactionCanceledException
-		if errors.As(err, &txCanceled) {
-			for _, reason := range txCanceled.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					// Already confirmed, this is OK (idempotent)
-					return nil
-				}
-			}
-		}
-		return err
+		logger.ErrorContext(ctx, "Failed to read blob content",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to read blob content: %w", err)
 	}
 
+	result := sniff.Check(declared, head)
+	if result.Mismatch {
+		logger.WarnContext(ctx, "Blob content does not match its declared type",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("declared_type", result.Declared),
+			slog.String("detected_type", result.Detected),
+			slog.Bool("corrected", deps.Sniffing == sniff.ModeCorrect),
+		)
+	}
+	if err := deps.Types.RecordSniffedType(ctx, accountID, blobID, result, deps.Sniffing == sniff.ModeCorrect); err != nil {
+		logger.ErrorContext(ctx, "Failed to record sniffed type",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to record sniffed type: %w", err)
+	}
 	return nil
 }
 
+// parseS3Key extracts accountID and blobID from S3 key (format: {accountId}/{blobId})
+func parseS3Key(key string) (accountID, blobID string, err error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid key format: expected {accountId}/{blobId}")
+	}
+	return parts[0], parts[1], nil
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -363,25 +369,64 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	bucketName := os.Getenv("BLOB_BUCKET")
-	if bucketName == "" {
-		logger.Error("FATAL: BLOB_BUCKET environment variable is required")
-		panic("BLOB_BUCKET environment variable is required")
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	s3Client := s3.NewFromConfig(result.Config)
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobStore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+
+	// Optionally request a content scan of each blob as it is confirmed
+	blobStore := store.NewBlobStore(dynamoClient, tableName)
+	if cfg.ScanBlobs {
+		blobStore = blobStore.WithScanRequests()
+	}
 
+	storage, err := blobstore.Open(result.Config, cfg.Storage)
+	if err != nil {
+		logger.Error("FATAL: Failed to open blob storage",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
 	deps = &Dependencies{
-		Storage: NewS3ConfirmStorage(s3Client, bucketName),
-		DB:      NewDynamoDBConfirmStore(dynamoClient, tableName),
+		Storage:  storage,
+		DB:       blobStore,
+		Sniffing: cfg.ContentSniffing,
+		Head:     storage,
+		Types:    blobStore,
+
+		Checksums:  storage,
+		ChecksumDB: blobStore,
 	}
 
 	result.Start(handler)
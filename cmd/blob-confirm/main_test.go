@@ -3,24 +3,40 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
+)
+
+// The in-memory fakes satisfy this Lambda's storage interfaces
+var (
+	_ ConfirmStorage = (*fakes.Bucket)(nil)
+	_ ConfirmDB      = (*fakes.Table)(nil)
+	_ HeadReader     = (*fakes.Bucket)(nil)
+	_ TypeDB         = (*fakes.Table)(nil)
 )
 
 // MockStorage implements ConfirmStorage for testing
 type MockStorage struct {
 	ConfirmTagCalled bool
 	ConfirmTagKey    string
+	ConfirmTagExtra  map[string]string
 	ConfirmTagErr    error
 	DeleteObjectCalled bool
 	DeleteObjectKey  string
 	DeleteObjectErr  error
 }
 
-func (m *MockStorage) ConfirmTag(ctx context.Context, key string) error {
+func (m *MockStorage) ConfirmTag(ctx context.Context, key string, extra map[string]string) error {
 	m.ConfirmTagCalled = true
 	m.ConfirmTagKey = key
+	m.ConfirmTagExtra = extra
 	return m.ConfirmTagErr
 }
 
@@ -119,7 +135,7 @@ func TestHandler_ConfirmSuccess(t *testing.T) {
 
 func TestHandler_BlobNotFound_Skips(t *testing.T) {
 	mockStorage := &MockStorage{}
-	mockDB := &MockDB{GetBlobInfoResult: nil} // Not found (may be traditional upload)
+	mockDB := &MockDB{GetBlobInfoResult: nil} // Not found (allocation expired and cleaned up)
 
 	deps = &Dependencies{
 		Storage: mockStorage,
@@ -461,3 +477,259 @@ func TestParseS3Key(t *testing.T) {
 		})
 	}
 }
+
+func TestHandler_WithFakes_ConfirmsRemainingRecordsAfterFailure(t *testing.T) {
+	ctx := context.Background()
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+
+	var records []events.S3EventRecord
+	for i := range 20 {
+		blobID := fmt.Sprintf("blob-%d", i)
+		key := "account-1/" + blobID
+		if err := table.AllocateBlob(ctx, "account-1", blobID, 10, "text/plain", time.Now().Add(time.Hour), 100, key, false, "", false, "", nil, nil, "", 0); err != nil {
+			t.Fatalf("unexpected allocate error: %v", err)
+		}
+		// blob-3's object is missing, so tagging it fails
+		if i != 3 {
+			bucket.PutObject(key, []byte("0123456789"), "text/plain")
+		}
+		records = append(records, events.S3EventRecord{S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: "test-bucket"},
+			Object: events.S3Object{Key: key, Size: 10},
+		}})
+	}
+
+	deps = &Dependencies{Storage: bucket, DB: table}
+	err := handler(ctx, events.S3Event{Records: records})
+	if err == nil || !strings.Contains(err.Error(), "account-1/blob-3") {
+		t.Fatalf("expected an error naming the failed record, got %v", err)
+	}
+	if strings.Contains(err.Error(), "account-1/blob-4:") {
+		t.Errorf("expected only the failed record in the error, got %v", err)
+	}
+
+	for i := range 20 {
+		blob, _ := table.Blob("account-1", fmt.Sprintf("blob-%d", i))
+		want := fakes.StatusConfirmed
+		if i == 3 {
+			want = fakes.StatusPending
+		}
+		if blob.Status != want {
+			t.Errorf("blob-%d: expected status %q, got %q", i, want, blob.Status)
+		}
+	}
+
+	// Redelivery skips the records already confirmed
+	bucket.PutObject("account-1/blob-3", []byte("0123456789"), "text/plain")
+	if err := handler(ctx, events.S3Event{Records: records}); err != nil {
+		t.Fatalf("expected redelivery to succeed, got %v", err)
+	}
+	if blob, _ := table.Blob("account-1", "blob-3"); blob.Status != fakes.StatusConfirmed {
+		t.Errorf("expected blob-3 to be confirmed, got %q", blob.Status)
+	}
+}
+
+func TestHandler_WithFakes_OverMaxSize_DeletesObject(t *testing.T) {
+	ctx := context.Background()
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+
+	for blobID, maxSize := range map[string]int64{"blob-1": 5, "blob-2": 10} {
+		key := "account-1/" + blobID
+		if err := table.AllocateBlob(ctx, "account-1", blobID, 0, "text/plain", time.Now().Add(time.Hour), 100, key, true, "", true, "", nil, nil, "", maxSize); err != nil {
+			t.Fatalf("unexpected allocate error: %v", err)
+		}
+		bucket.PutObject(key, []byte("0123456789"), "text/plain")
+	}
+
+	deps = &Dependencies{Storage: bucket, DB: table}
+	event := events.S3Event{Records: []events.S3EventRecord{
+		{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "test-bucket"}, Object: events.S3Object{Key: "account-1/blob-1", Size: 10}}},
+		{S3: events.S3Entity{Bucket: events.S3Bucket{Name: "test-bucket"}, Object: events.S3Object{Key: "account-1/blob-2", Size: 10}}},
+	}}
+	if err := handler(ctx, event); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, ok := bucket.Object("account-1/blob-1"); ok {
+		t.Error("expected the oversize object deleted")
+	}
+	if blob, _ := table.Blob("account-1", "blob-1"); blob.Status != fakes.StatusPending {
+		t.Errorf("expected the oversize allocation left pending, got %q", blob.Status)
+	}
+	if blob, _ := table.Blob("account-1", "blob-2"); blob.Status != fakes.StatusConfirmed {
+		t.Errorf("expected the blob at its limit confirmed, got %q", blob.Status)
+	}
+}
+
+func TestHandler_WithFakes_AppliesAllocationTags(t *testing.T) {
+	ctx := context.Background()
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+
+	key := "account-1/blob-1"
+	if err := table.AllocateBlob(ctx, "account-1", "blob-1", 10, "text/plain", time.Now().Add(time.Hour), 100, key, false, "", false, "", map[string]string{"Source": "scanner"}, nil, "", 0); err != nil {
+		t.Fatalf("unexpected allocate error: %v", err)
+	}
+	bucket.PutObject(key, []byte("0123456789"), "text/plain")
+
+	deps = &Dependencies{Storage: bucket, DB: table}
+	event := events.S3Event{Records: []events.S3EventRecord{{S3: events.S3Entity{
+		Bucket: events.S3Bucket{Name: "test-bucket"},
+		Object: events.S3Object{Key: key, Size: 10},
+	}}}}
+	if err := handler(ctx, event); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	object, _ := bucket.Object(key)
+	if object.Tags["Status"] != fakes.StatusConfirmed || object.Tags["Source"] != "scanner" {
+		t.Errorf("expected confirmed object tagged Source=scanner, got %v", object.Tags)
+	}
+}
+
+// allocatePNG allocates a blob declared as declared and uploads PNG content
+// for it, returning its S3 event record
+func allocatePNG(t *testing.T, table *fakes.Table, bucket *fakes.Bucket, blobID, declared string) events.S3EventRecord {
+	t.Helper()
+	key := "account-1/" + blobID
+	if err := table.AllocateBlob(context.Background(), "account-1", blobID, 16, declared, time.Now().Add(time.Hour), 100, key, false, "", false, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected allocate error: %v", err)
+	}
+	bucket.PutObject(key, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), declared)
+	return events.S3EventRecord{S3: events.S3Entity{
+		Bucket: events.S3Bucket{Name: "test-bucket"},
+		Object: events.S3Object{Key: key, Size: 16},
+	}}
+}
+
+func TestHandler_ContentSniffing(t *testing.T) {
+	tests := []struct {
+		mode         string
+		declared     string
+		wantType     string
+		wantDetected string
+		wantMismatch bool
+	}{
+		{"off", "text/plain", "text/plain", "", false},
+		{"flag", "image/png", "image/png", "image/png", false},
+		{"flag", "text/plain", "text/plain", "image/png", true},
+		{"correct", "text/plain", "image/png", "image/png", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode+" "+tt.declared, func(t *testing.T) {
+			table := fakes.NewTable()
+			bucket := fakes.NewBucket()
+			table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+			record := allocatePNG(t, table, bucket, "blob-1", tt.declared)
+
+			deps = &Dependencies{Storage: bucket, DB: table, Sniffing: tt.mode, Head: bucket, Types: table}
+			if err := handler(context.Background(), events.S3Event{Records: []events.S3EventRecord{record}}); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			blob, _ := table.Blob("account-1", "blob-1")
+			if blob.Status != fakes.StatusConfirmed {
+				t.Errorf("expected the blob confirmed, got %q", blob.Status)
+			}
+			if blob.ContentType != tt.wantType || blob.DetectedType != tt.wantDetected || blob.TypeMismatch != tt.wantMismatch {
+				t.Errorf("unexpected types: content %q, detected %q, mismatch %v", blob.ContentType, blob.DetectedType, blob.TypeMismatch)
+			}
+			if tt.wantDetected != "" && blob.DeclaredType != tt.declared {
+				t.Errorf("expected declared type %q recorded, got %q", tt.declared, blob.DeclaredType)
+			}
+		})
+	}
+}
+
+func TestHandler_ContentSniffing_ReadFailureLeavesPending(t *testing.T) {
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+	record := allocatePNG(t, table, bucket, "blob-1", "text/plain")
+	bucket.FailOn("ReadHead", errors.New("S3 error"))
+
+	deps = &Dependencies{Storage: bucket, DB: table, Sniffing: "flag", Head: bucket, Types: table}
+	if err := handler(context.Background(), events.S3Event{Records: []events.S3EventRecord{record}}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if blob, _ := table.Blob("account-1", "blob-1"); blob.Status != fakes.StatusPending {
+		t.Errorf("expected the blob left pending for a retry, got %q", blob.Status)
+	}
+}
+
+// allocateWithChecksum allocates a blob declaring checksum and uploads
+// content for it, returning its S3 event record
+func allocateWithChecksum(t *testing.T, table *fakes.Table, bucket *fakes.Bucket, checksum, content string) events.S3EventRecord {
+	t.Helper()
+	key := "account-1/blob-1"
+	if err := table.AllocateBlob(context.Background(), "account-1", "blob-1", int64(len(content)), "text/plain", time.Now().Add(time.Hour), 100, key, false, "", false, "", nil, nil, checksum, 0); err != nil {
+		t.Fatalf("unexpected allocate error: %v", err)
+	}
+	bucket.PutObject(key, []byte(content), "text/plain")
+	return events.S3EventRecord{S3: events.S3Entity{
+		Bucket: events.S3Bucket{Name: "test-bucket"},
+		Object: events.S3Object{Key: key, Size: int64(len(content))},
+	}}
+}
+
+func TestHandler_Checksum_RecordedWhenVerified(t *testing.T) {
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+	checksum, _ := blobchecksum.Sum(strings.NewReader("hello"))
+	record := allocateWithChecksum(t, table, bucket, checksum, "hello")
+
+	deps = &Dependencies{Storage: bucket, DB: table, Checksums: bucket, ChecksumDB: table}
+	if err := handler(context.Background(), events.S3Event{Records: []events.S3EventRecord{record}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blob, _ := table.Blob("account-1", "blob-1")
+	if blob.Status != fakes.StatusConfirmed || blob.ChecksumSHA256 != checksum {
+		t.Errorf("expected the blob confirmed with its checksum, got %q, %q", blob.Status, blob.ChecksumSHA256)
+	}
+}
+
+func TestHandler_Checksum_MismatchDeletesObject(t *testing.T) {
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+	checksum, _ := blobchecksum.Sum(strings.NewReader("hello"))
+	record := allocateWithChecksum(t, table, bucket, checksum, "jello")
+
+	deps = &Dependencies{Storage: bucket, DB: table, Checksums: bucket, ChecksumDB: table}
+	if err := handler(context.Background(), events.S3Event{Records: []events.S3EventRecord{record}}); err != nil {
+		t.Fatalf("expected a mismatch not to be retried, got %v", err)
+	}
+	if _, ok := bucket.Object("account-1/blob-1"); ok {
+		t.Error("expected the mismatched object to be deleted")
+	}
+	blob, _ := table.Blob("account-1", "blob-1")
+	if blob.Status != fakes.StatusPending || blob.ChecksumSHA256 != "" {
+		t.Errorf("expected the allocation left pending to expire, got %q, %q", blob.Status, blob.ChecksumSHA256)
+	}
+}
+
+func TestHandler_Checksum_ReadFailureLeavesPending(t *testing.T) {
+	table := fakes.NewTable()
+	bucket := fakes.NewBucket()
+	table.PutAccount(account.Meta{AccountID: "account-1", QuotaBytes: 1 << 20, QuotaRemaining: 1 << 20})
+	checksum, _ := blobchecksum.Sum(strings.NewReader("hello"))
+	record := allocateWithChecksum(t, table, bucket, checksum, "hello")
+	bucket.FailOn("Checksum", errors.New("S3 error"))
+
+	deps = &Dependencies{Storage: bucket, DB: table, Checksums: bucket, ChecksumDB: table}
+	if err := handler(context.Background(), events.S3Event{Records: []events.S3EventRecord{record}}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if _, ok := bucket.Object("account-1/blob-1"); !ok {
+		t.Error("expected the object to be kept for a retry")
+	}
+	if blob, _ := table.Blob("account-1", "blob-1"); blob.Status != fakes.StatusPending {
+		t.Errorf("expected the blob left pending for a retry, got %q", blob.Status)
+	}
+}
@@ -3,51 +3,79 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmirror"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // BlobRecord represents a blob record from DynamoDB
-type BlobRecord struct {
-	BlobID      string `dynamodbav:"blobId"`
-	AccountID   string `dynamodbav:"accountId"`
-	Size        int64  `dynamodbav:"size"`
-	ContentType string `dynamodbav:"contentType"`
-	S3Key       string `dynamodbav:"s3Key"`
-	CreatedAt   string `dynamodbav:"createdAt"`
-	DeletedAt   string `dynamodbav:"deletedAt,omitempty"`
-}
+type BlobRecord = blobmeta.Record
 
 // BlobDB handles DynamoDB operations for blob metadata
 type BlobDB interface {
 	GetBlob(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
 	MarkBlobDeleted(ctx context.Context, accountID, blobID string, deletedAt string) error
+	SetScanStatus(ctx context.Context, accountID, blobID, status string) error
 }
 
-// PrincipalChecker checks if a caller is allowed to access IAM endpoints
+// routeScanVerdict is the route scanner plugins report verdicts to (HTTP
+// method + API Gateway resource path)
+const routeScanVerdict = "PUT /scan-iam/{accountId}/{blobId}"
+
+// ScanVerdictRequest is the body of a scan verdict
+type ScanVerdictRequest struct {
+	Verdict string `json:"verdict"`
+}
+
+// PrincipalChecker checks if a caller is allowed to access IAM endpoints,
+// and which principals belong to the plugins subscribed to an event
 type PrincipalChecker interface {
 	IsAllowedPrincipal(callerARN string) bool
+	EventPrincipals(eventType string) []string
 }
 
-// ErrorResponse is the error response format
-type ErrorResponse struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
+// AliasResolver resolves account aliases to account IDs
+type AliasResolver interface {
+	ResolveAlias(ctx context.Context, alias string) (string, error)
+}
+
+// PrincipalBindings restricts IAM principals to the accounts they are bound to
+type PrincipalBindings interface {
+	IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error)
+}
+
+// ObjectTagger retags a blob's object so blob-mirror copies its record again
+type ObjectTagger interface {
+	Retag(ctx context.Context, key string) error
 }
 
 // Response is the API Gateway proxy response
@@ -57,55 +85,125 @@ type Response struct {
 	Body       string            `json:"body"`
 }
 
+// DelegationVerifier verifies the delegation tokens plugins present when
+// calling back into core
+type DelegationVerifier interface {
+	Verify(token string) (*delegation.Claims, error)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
-	DB       BlobDB
-	Registry PrincipalChecker
+	DB         BlobDB
+	Registry   PrincipalChecker
+	Aliases    AliasResolver
+	Bindings   PrincipalBindings
+	Delegation DelegationVerifier
+	// AccountIDClaim names the authorizer claim holding a user's account ID
+	AccountIDClaim string
+	// Mirror, set while blobs are mirrored, carries verdicts to the replica
+	Mirror ObjectTagger
 }
 
 var deps *Dependencies
 
-// handler processes blob delete requests
+// correlatedHandler gives each request a correlation ID and adds it to the
+// handler's response
+func correlatedHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(resp.Headers, correlationID)
+	return resp, err
+}
+
+// handler processes blob delete requests and scan verdicts
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
 	ctx, span := tracing.StartHandlerSpan(ctx, "BlobDeleteHandler",
 		tracing.Function("blob-delete"),
 		tracing.RequestID(request.RequestContext.RequestID),
 	)
 	defer span.End()
 
+	// Scan verdicts share the route shape but none of the delete's checks
+	if request.HTTPMethod+" "+request.Resource == routeScanVerdict {
+		return handleScanVerdict(ctx, request)
+	}
+
 	// Extract accountId from path
 	pathAccountID := request.PathParameters["accountId"]
 	if pathAccountID == "" {
-		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+		return errorResponse(ctx, 400, "invalidArguments", "Missing accountId in path")
+	}
+
+	// Resolve an alias in the path to the account it belongs to
+	resolvedID, err := resolveAccountID(ctx, pathAccountID)
+	if err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			logger.WarnContext(ctx, "Unknown account alias",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("alias", pathAccountID),
+			)
+			return errorResponse(ctx, 404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to resolve account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to resolve account")
 	}
+	pathAccountID = resolvedID
 	span.SetAttributes(tracing.AccountID(pathAccountID))
 
 	// Extract blobId from path
 	blobID := request.PathParameters["blobId"]
 	if blobID == "" {
-		return errorResponse(400, "invalidArguments", "Missing blobId in path")
+		return errorResponse(ctx, 400, "invalidArguments", "Missing blobId in path")
 	}
 	span.SetAttributes(tracing.BlobID(blobID))
 
 	// Extract authenticated account ID (from JWT or path for IAM)
-	authAccountID, err := extractAccountID(request)
+	authAccountID, err := extractAccountID(request, deps.AccountIDClaim)
 	if err != nil {
 		logger.WarnContext(ctx, "Failed to extract account ID",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(401, "unauthorized", "Missing or invalid authentication")
+		return errorResponse(ctx, 401, "unauthorized", "Missing or invalid authentication")
+	}
+	// IAM requests take their account from the path, already resolved above
+	if authAccountID == request.PathParameters["accountId"] {
+		authAccountID = pathAccountID
 	}
 
 	// Check principal authorization for IAM-authenticated requests
 	if isIAMAuthenticatedRequest(request) {
 		callerPrincipal := extractCallerPrincipal(request)
-		if !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
+		// A delegation token stands in for registry trust, for its account and
+		// plugin only; principal bindings still apply
+		delegated := delegation.IsDelegated(ctx, deps.Delegation, request, pathAccountID)
+		if !delegated && !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
 			logger.WarnContext(ctx, "Unauthorized IAM principal",
 				slog.String("request_id", request.RequestContext.RequestID),
 				slog.String("caller_principal", callerPrincipal),
 			)
-			return errorResponse(403, "forbidden", "Principal not authorized for IAM access")
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for IAM access")
+		}
+		allowed, err := deps.Bindings.IsAllowed(ctx, callerPrincipal, pathAccountID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check principal bindings",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to check principal bindings")
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "IAM principal not bound to account",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("caller_principal", callerPrincipal),
+			)
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for this account")
 		}
 	}
 
@@ -116,7 +214,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("path_account_id", pathAccountID),
 			slog.String("auth_account_id", authAccountID),
 		)
-		return errorResponse(403, "forbidden", "Account ID mismatch")
+		return errorResponse(ctx, 403, "forbidden", "Account ID mismatch")
 	}
 
 	// Look up blob in DynamoDB
@@ -126,7 +224,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to retrieve blob metadata")
+		return errorResponse(ctx, 500, "serverFail", "Failed to retrieve blob metadata")
 	}
 
 	// Check if blob exists
@@ -136,7 +234,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("account_id", pathAccountID),
 			slog.String("blob_id", blobID),
 		)
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
 	}
 
 	// Verify blob ownership (defense in depth)
@@ -146,22 +244,26 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("blob_account_id", blob.AccountID),
 			slog.String("request_account_id", pathAccountID),
 		)
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
 	}
 
 	// Check if already deleted
 	if blob.DeletedAt != "" {
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
 	}
 
 	// Mark blob as deleted
 	deletedAt := time.Now().UTC().Format(time.RFC3339)
 	if err := deps.DB.MarkBlobDeleted(ctx, pathAccountID, blobID, deletedAt); err != nil {
+		// A concurrent delete got there first
+		if errors.Is(err, store.ErrAlreadyDeleted) {
+			return errorResponse(ctx, 404, "notFound", "Blob not found")
+		}
 		logger.ErrorContext(ctx, "Failed to mark blob as deleted",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to delete blob")
+		return errorResponse(ctx, 500, "serverFail", "Failed to delete blob")
 	}
 
 	logger.InfoContext(ctx, "Blob marked as deleted",
@@ -177,11 +279,116 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	}, nil
 }
 
+// handleScanVerdict records a scanner plugin's verdict on a blob. Only the
+// principals of plugins subscribed to blob.scan.requested may report
+// verdicts; other plugins, users and delegated callbacks are refused, so
+// neither an account nor an unrelated plugin can clear a blob.
+func handleScanVerdict(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	callerPrincipal := extractCallerPrincipal(request)
+	if !isIAMAuthenticatedRequest(request) || !plugin.IsAllowedARN(deps.Registry.EventPrincipals(publisher.EventBlobScanRequested), callerPrincipal) {
+		logger.WarnContext(ctx, "Scan verdict from a caller that is not a scanner",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("caller_principal", callerPrincipal),
+		)
+		return errorResponse(ctx, 403, "forbidden", "Only scanner plugins may report scan verdicts")
+	}
+
+	accountID, err := resolveAccountID(ctx, request.PathParameters["accountId"])
+	if errors.Is(err, account.ErrAliasNotFound) {
+		return errorResponse(ctx, 404, "notFound", "Account not found")
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to resolve account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to resolve account")
+	}
+	blobID := request.PathParameters["blobId"]
+	if accountID == "" || blobID == "" {
+		return errorResponse(ctx, 400, "invalidArguments", "Missing accountId or blobId in path")
+	}
+
+	allowed, err := deps.Bindings.IsAllowed(ctx, callerPrincipal, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to check principal bindings",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to check principal bindings")
+	}
+	if !allowed {
+		logger.WarnContext(ctx, "IAM principal not bound to account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("caller_principal", callerPrincipal),
+		)
+		return errorResponse(ctx, 403, "forbidden", "Principal not authorized for this account")
+	}
+
+	var verdict ScanVerdictRequest
+	if err := json.Unmarshal([]byte(request.Body), &verdict); err != nil {
+		return errorResponse(ctx, 400, "invalidArguments", "Request body must be a JSON object")
+	}
+	if verdict.Verdict != store.ScanClean && verdict.Verdict != store.ScanInfected {
+		return errorResponse(ctx, 400, "invalidArguments", "verdict must be clean or infected")
+	}
+
+	if err := deps.DB.SetScanStatus(ctx, accountID, blobID, verdict.Verdict); err != nil {
+		if errors.Is(err, store.ErrBlobNotFound) {
+			return errorResponse(ctx, 404, "notFound", "Blob not found")
+		}
+		logger.ErrorContext(ctx, "Failed to record scan verdict",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to record scan verdict")
+	}
+
+	// The replica's record was copied when the blob was confirmed; a failure
+	// here is retried by the scanner, and recording the verdict again is
+	// harmless
+	if deps.Mirror != nil {
+		if err := deps.Mirror.Retag(ctx, blobstore.Key(accountID, blobID)); err != nil {
+			logger.ErrorContext(ctx, "Failed to mirror scan verdict",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("blob_id", blobID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to mirror scan verdict")
+		}
+	}
+
+	logger.InfoContext(ctx, "Blob scan verdict recorded",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("blob_id", blobID),
+		slog.String("verdict", verdict.Verdict),
+	)
+
+	return Response{
+		StatusCode: 204,
+		Headers:    map[string]string{},
+		Body:       "",
+	}, nil
+}
+
+// resolveAccountID maps an account alias to its account ID. Identifiers that
+// are not aliases are returned unchanged.
+func resolveAccountID(ctx context.Context, id string) (string, error) {
+	if deps.Aliases == nil || !account.IsAlias(id) {
+		return id, nil
+	}
+	return deps.Aliases.ResolveAlias(ctx, id)
+}
+
 // extractAccountID extracts account ID using authoritative API Gateway signals.
 // - IAM auth: Identity.UserArn or Identity.Caller is populated → use path param
-// - Cognito auth: Authorizer["claims"]["sub"] is populated → use JWT sub claim
+// - User auth: Authorizer holds the OIDC claims → use the account ID claim (sub by default)
 // These fields are populated by API Gateway and cannot be spoofed by clients.
-func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
+func extractAccountID(request events.APIGatewayProxyRequest, claim string) (string, error) {
 	identity := request.RequestContext.Identity
 
 	// IAM auth: API Gateway populates Identity.UserArn and/or Identity.Caller
@@ -194,23 +401,13 @@ func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
 		return accountID, nil
 	}
 
-	// Cognito auth: API Gateway populates Authorizer with claims
+	// User auth: API Gateway populates Authorizer with claims
 	authorizer := request.RequestContext.Authorizer
 	if authorizer == nil {
 		return "", fmt.Errorf("no authentication context (neither IAM nor Cognito)")
 	}
 
-	claims, ok := authorizer["claims"].(map[string]any)
-	if !ok {
-		return "", fmt.Errorf("no claims in authorizer")
-	}
-
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("sub claim not found or empty")
-	}
-
-	return sub, nil
+	return auth.AccountIDFromAuthorizer(authorizer, claim)
 }
 
 // isIAMAuthenticatedRequest checks if the request is IAM-authenticated
@@ -224,98 +421,62 @@ func extractCallerPrincipal(request events.APIGatewayProxyRequest) string {
 	return request.RequestContext.Identity.UserArn
 }
 
-// errorResponse builds an error response
-func errorResponse(statusCode int, errorType, description string) (Response, error) {
-	body, _ := json.Marshal(ErrorResponse{Type: errorType, Description: description})
+// errorResponse builds a problem response with the error type's code
+func errorResponse(ctx context.Context, statusCode int, errorType, description string) (Response, error) {
 	return Response{
 		StatusCode: statusCode,
-		Headers:    map[string]string{"Content-Type": "application/json"},
-		Body:       string(body),
+		Headers:    problem.Headers(),
+		Body:       problem.New(statusCode, errorType, description).Body(ctx),
 	}, nil
 }
 
-// =============================================================================
-// Real implementations
-// =============================================================================
-
-// DynamoDBBlobDB implements BlobDB using AWS DynamoDB
-type DynamoDBBlobDB struct {
-	client    *dynamodb.Client
-	tableName string
-}
-
-// NewDynamoDBBlobDB creates a new DynamoDBBlobDB
-func NewDynamoDBBlobDB(client *dynamodb.Client, tableName string) *DynamoDBBlobDB {
-	return &DynamoDBBlobDB{
-		client:    client,
-		tableName: tableName,
-	}
-}
+func main() {
+	ctx := context.Background()
 
-// GetBlob retrieves a blob record from DynamoDB
-func (d *DynamoDBBlobDB) GetBlob(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
-	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-		},
-	})
+	result, err := awsinit.Init(ctx, awsinit.WithHTTPHandler("blob-delete"))
 	if err != nil {
-		return nil, err
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	defer result.Cleanup()
 
-	if result.Item == nil {
-		return nil, nil
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	var record BlobRecord
-	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
-		return nil, err
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	return &record, nil
-}
-
-// MarkBlobDeleted sets the deletedAt attribute on a blob record
-func (d *DynamoDBBlobDB) MarkBlobDeleted(ctx context.Context, accountID, blobID string, deletedAt string) error {
-	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-		},
-		UpdateExpression: aws.String("SET #deletedAt = :deletedAt"),
-		ExpressionAttributeNames: map[string]string{
-			"#deletedAt": "deletedAt",
-		},
-		ExpressionAttributeValues: map[string]types.AttributeValue{
-			":deletedAt": &types.AttributeValueMemberS{Value: deletedAt},
-		},
-	})
-	return err
-}
-
-func main() {
-	ctx := context.Background()
-
-	result, err := awsinit.Init(ctx, awsinit.WithHTTPHandler("blob-delete"))
-	if err != nil {
-		logger.Error("FATAL: Failed to initialize AWS",
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
-	defer result.Cleanup()
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobDelete(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	tableName := cfg.Table
 
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 
 	// Initialize database client for plugin registry
 	dbClient := db.NewClientFromConfig(result.Config, tableName)
@@ -329,10 +490,41 @@ func main() {
 		panic(err)
 	}
 
+	// Load the key that verifies plugin delegation tokens
+	delegationKey, err := delegation.LoadKey(result.Ctx, secretsmanager.NewFromConfig(result.Config), cfg.DelegationSecretARN)
+	if err != nil {
+		logger.Error("FATAL: Failed to load delegation key",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional envelope encryption of blob record metadata
+	metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+
 	deps = &Dependencies{
-		DB:       NewDynamoDBBlobDB(dynamoClient, tableName),
-		Registry: registry,
+		DB:             store.NewBlobStore(dynamoClient, tableName).WithEncryption(metadataEnvelope),
+		Registry:       registry,
+		Aliases:        account.NewDynamoDBStore(dynamoClient, tableName),
+		Bindings:       binding.NewDynamoDBStore(dynamoClient, tableName),
+		Delegation:     delegation.NewSigner(delegationKey, delegation.DefaultTTL),
+		AccountIDClaim: cfg.AccountIDClaim,
+	}
+
+	// Optional retagging of scanned blobs, so blob-mirror copies verdicts
+	if cfg.MirrorBucket != "" {
+		deps.Mirror = blobmirror.NewRetagger(s3.NewFromConfig(result.Config), cfg.MirrorBucket)
+	}
+
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, correlatedHandler, "DELETE /delete/{accountId}/{blobId}", "DELETE /delete-iam/{accountId}/{blobId}", "PUT /scan-iam/{accountId}/{blobId}")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	result.Start(handler)
+	result.Start(correlatedHandler)
 }
@@ -7,7 +7,19 @@ import (
 	"testing"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmirror"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// The in-memory fakes and blobmirror's Retagger satisfy this Lambda's interfaces
+var (
+	_ BlobDB       = (*fakes.Table)(nil)
+	_ ObjectTagger = (*blobmirror.Retagger)(nil)
 )
 
 // Mock implementations for testing
@@ -18,6 +30,8 @@ type mockBlobDB struct {
 	blob           *BlobRecord
 	getErr         error
 	markErr        error
+	scanErr        error
+	scanStatus     string
 }
 
 func (m *mockBlobDB) GetBlob(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
@@ -34,10 +48,20 @@ func (m *mockBlobDB) MarkBlobDeleted(ctx context.Context, accountID, blobID stri
 	return m.markErr
 }
 
+func (m *mockBlobDB) SetScanStatus(ctx context.Context, accountID, blobID, status string) error {
+	if m.scanErr != nil {
+		return m.scanErr
+	}
+	m.scanStatus = status
+	return nil
+}
+
 func setupTestDeps(db *mockBlobDB, principals []string) {
 	deps = &Dependencies{
-		DB:       db,
-		Registry: plugin.NewRegistryWithPrincipals(principals),
+		DB:             db,
+		Registry:       plugin.NewRegistryWithPrincipals(principals),
+		Bindings:       &mockPrincipalBindings{},
+		AccountIDClaim: "sub",
 	}
 }
 
@@ -145,6 +169,23 @@ func TestDelete_AlreadyDeleted_Returns404(t *testing.T) {
 	}
 }
 
+// Test: A delete racing another delete returns 404
+func TestDelete_ConcurrentDelete_Returns404(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob(), markErr: store.ErrAlreadyDeleted}
+	setupTestDeps(db, []string{testPrincipal})
+
+	request := iamRequest("user-456", "blob-123", testPrincipal)
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected 404, got %d", response.StatusCode)
+	}
+}
+
 // Test: Missing accountId returns 400
 func TestDelete_MissingAccountId_Returns400(t *testing.T) {
 	db := &mockBlobDB{}
@@ -423,12 +464,314 @@ func TestDelete_ErrorResponseFormat(t *testing.T) {
 		t.Fatalf("handler returned error: %v", err)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "notFound" {
+	if errResp.Type != problem.TypeURI("notFound") {
 		t.Errorf("expected error type 'notFound', got %q", errResp.Type)
 	}
 }
+
+// mockAliasResolver implements AliasResolver for testing
+type mockAliasResolver struct {
+	aliases map[string]string
+}
+
+func (m *mockAliasResolver) ResolveAlias(ctx context.Context, alias string) (string, error) {
+	accountID, ok := m.aliases[alias]
+	if !ok {
+		return "", account.ErrAliasNotFound
+	}
+	return accountID, nil
+}
+
+// Test: Alias in the path deletes from the resolved account
+func TestDelete_AliasPath_DeletesFromResolvedAccount(t *testing.T) {
+	var markedAccountID string
+	db := &mockBlobDB{
+		blob: testBlob(),
+		markDeleteFunc: func(ctx context.Context, accountID, blobID string, deletedAt string) error {
+			markedAccountID = accountID
+			return nil
+		},
+	}
+	setupTestDeps(db, []string{testPrincipal})
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"alice@example.com": "user-456"}}
+
+	response, err := handler(context.Background(), iamRequest("alice@example.com", "blob-123", testPrincipal))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 204 {
+		t.Errorf("expected 204, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if markedAccountID != "user-456" {
+		t.Errorf("expected delete under user-456, got %q", markedAccountID)
+	}
+}
+
+// Test: Unknown alias in the path returns 404
+func TestDelete_UnknownAliasPath_Returns404(t *testing.T) {
+	setupTestDeps(&mockBlobDB{blob: testBlob()}, []string{testPrincipal})
+	deps.Aliases = &mockAliasResolver{}
+
+	response, err := handler(context.Background(), iamRequest("nobody@example.com", "blob-123", testPrincipal))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected 404, got %d", response.StatusCode)
+	}
+}
+
+// mockPrincipalBindings implements PrincipalBindings for testing. A nil
+// allowed map is a principal with no bindings, which may act on any account.
+type mockPrincipalBindings struct {
+	allowed map[string]bool
+}
+
+func (m *mockPrincipalBindings) IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error) {
+	if m.allowed == nil {
+		return true, nil
+	}
+	return m.allowed[accountID], nil
+}
+
+// Test: A principal bound to other accounts cannot delete from this one
+func TestDelete_UnboundAccount_Returns403(t *testing.T) {
+	marked := false
+	db := &mockBlobDB{
+		blob: testBlob(),
+		markDeleteFunc: func(ctx context.Context, accountID, blobID string, deletedAt string) error {
+			marked = true
+			return nil
+		},
+	}
+	setupTestDeps(db, []string{testPrincipal})
+	deps.Bindings = &mockPrincipalBindings{allowed: map[string]bool{"user-999": true}}
+
+	response, err := handler(context.Background(), iamRequest("user-456", "blob-123", testPrincipal))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 403 {
+		t.Errorf("expected 403, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if marked {
+		t.Error("expected blob not to be deleted")
+	}
+}
+
+// Test: Bindings are checked against the account an alias resolves to
+func TestDelete_AliasPath_ChecksBindingOfResolvedAccount(t *testing.T) {
+	setupTestDeps(&mockBlobDB{blob: testBlob()}, []string{testPrincipal})
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"alice@example.com": "user-456"}}
+	deps.Bindings = &mockPrincipalBindings{allowed: map[string]bool{"user-456": true}}
+
+	response, err := handler(context.Background(), iamRequest("alice@example.com", "blob-123", testPrincipal))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 204 {
+		t.Errorf("expected 204, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+// Test: A delegation token authorizes an unregistered principal for its account only
+func TestDelete_DelegationToken(t *testing.T) {
+	signer := delegation.NewSigner([]byte("test-key"), delegation.DefaultTTL)
+	pluginRoles := []string{"arn:aws:iam::123456789012:role/MailPlugin"}
+	token, _ := signer.Mint("user-456", "req-origin", "Email/destroy", pluginRoles)
+	otherToken, _ := signer.Mint("user-999", "req-origin", "Email/destroy", pluginRoles)
+	pluginRole := "arn:aws:sts::123456789012:assumed-role/MailPlugin/session-1"
+
+	tests := []struct {
+		name     string
+		token    string
+		bindings map[string]bool
+		status   int
+	}{
+		{name: "token for the path account", token: token, status: 204},
+		{name: "token for another account", token: otherToken, status: 403},
+		{name: "plugin bound to other accounts", token: token, bindings: map[string]bool{"user-999": true}, status: 403},
+		{name: "no token", status: 403},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDeps(&mockBlobDB{blob: testBlob()}, []string{testPrincipal})
+			deps.Delegation = signer
+			// Bindings apply to delegated calls as to any other
+			deps.Bindings = &mockPrincipalBindings{allowed: tc.bindings}
+
+			request := iamRequest("user-456", "blob-123", pluginRole)
+			request.Headers = map[string]string{"x-jmap-delegation-token": tc.token}
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+
+			if response.StatusCode != tc.status {
+				t.Errorf("expected %d, got %d. Body: %s", tc.status, response.StatusCode, response.Body)
+			}
+		})
+	}
+}
+
+var scannerPrincipal = "arn:aws:iam::123456789012:role/ScannerRole"
+
+// setupScannerDeps registers a scanner plugin, subscribed to scan requests,
+// alongside the test principal's plugin
+func setupScannerDeps(db *mockBlobDB) {
+	setupTestDeps(db, nil)
+	registry := plugin.NewRegistry()
+	registry.AddPlugin(plugin.PluginRecord{
+		PluginID:         "scanner",
+		Events:           map[string]plugin.EventTarget{"blob.scan.requested": {TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:scans"}},
+		ClientPrincipals: []string{scannerPrincipal},
+	})
+	registry.AddPlugin(plugin.PluginRecord{
+		PluginID:         "ingest",
+		ClientPrincipals: []string{testPrincipal},
+	})
+	deps.Registry = registry
+}
+
+func scanVerdictRequest(userArn, body string) events.APIGatewayProxyRequest {
+	request := iamRequest("user-456", "blob-123", userArn)
+	request.Resource = "/scan-iam/{accountId}/{blobId}"
+	request.HTTPMethod = "PUT"
+	request.Body = body
+	return request
+}
+
+func TestScanVerdict_RecordsStatus(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob()}
+	setupScannerDeps(db)
+
+	response, err := handler(context.Background(), scanVerdictRequest(scannerPrincipal, `{"verdict": "infected"}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 204 {
+		t.Fatalf("expected 204, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if db.scanStatus != "infected" {
+		t.Errorf("expected infected to be recorded, got %q", db.scanStatus)
+	}
+}
+
+func TestScanVerdict_InvalidVerdict_Returns400(t *testing.T) {
+	for _, body := range []string{`{"verdict": "maybe"}`, `{}`, `not json`} {
+		db := &mockBlobDB{blob: testBlob()}
+		setupScannerDeps(db)
+
+		response, _ := handler(context.Background(), scanVerdictRequest(scannerPrincipal, body))
+		if response.StatusCode != 400 || db.scanStatus != "" {
+			t.Errorf("%s: expected 400 and nothing recorded, got %d", body, response.StatusCode)
+		}
+	}
+}
+
+func TestScanVerdict_UntrustedCallers_Return403(t *testing.T) {
+	signer := delegation.NewSigner([]byte("test-key"), delegation.DefaultTTL)
+	token, _ := signer.Mint("user-456", "req-origin", "Email/import", []string{"arn:aws:iam::123456789012:role/Other"})
+
+	// A delegated callback from an unregistered role
+	db := &mockBlobDB{blob: testBlob()}
+	setupScannerDeps(db)
+	deps.Delegation = signer
+	request := scanVerdictRequest("arn:aws:sts::123456789012:assumed-role/Other/session-1", `{"verdict": "clean"}`)
+	request.Headers = map[string]string{"x-jmap-delegation-token": token}
+	if response, _ := handler(context.Background(), request); response.StatusCode != 403 {
+		t.Errorf("expected 403 for a delegated caller, got %d", response.StatusCode)
+	}
+
+	// The account's own user
+	request = cognitoRequest("user-456", "blob-123", "user-456")
+	request.Resource = "/scan-iam/{accountId}/{blobId}"
+	request.HTTPMethod = "PUT"
+	request.Body = `{"verdict": "clean"}`
+	if response, _ := handler(context.Background(), request); response.StatusCode != 403 {
+		t.Errorf("expected 403 for a user, got %d", response.StatusCode)
+	}
+
+	// A registered plugin that is not a scanner
+	if response, _ := handler(context.Background(), scanVerdictRequest(testPrincipal, `{"verdict": "clean"}`)); response.StatusCode != 403 {
+		t.Errorf("expected 403 for a plugin not subscribed to scan requests, got %d", response.StatusCode)
+	}
+	if db.scanStatus != "" {
+		t.Errorf("expected nothing recorded, got %q", db.scanStatus)
+	}
+}
+
+func TestScanVerdict_BlobNotFound_Returns404(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob(), scanErr: store.ErrBlobNotFound}
+	setupScannerDeps(db)
+
+	response, _ := handler(context.Background(), scanVerdictRequest(scannerPrincipal, `{"verdict": "clean"}`))
+	if response.StatusCode != 404 {
+		t.Errorf("expected 404, got %d", response.StatusCode)
+	}
+}
+
+func TestScanVerdict_UnboundAccount_Returns403(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob()}
+	setupScannerDeps(db)
+	deps.Bindings = &mockPrincipalBindings{allowed: map[string]bool{}}
+
+	response, _ := handler(context.Background(), scanVerdictRequest(scannerPrincipal, `{"verdict": "clean"}`))
+	if response.StatusCode != 403 || db.scanStatus != "" {
+		t.Errorf("expected 403 and nothing recorded, got %d", response.StatusCode)
+	}
+}
+
+// mockTagger implements ObjectTagger for testing, recording the scan status
+// each retagged blob had when it was retagged
+type mockTagger struct {
+	db     *mockBlobDB
+	retags map[string]string
+	err    error
+}
+
+func (m *mockTagger) Retag(ctx context.Context, key string) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.retags[key] = m.db.scanStatus
+	return nil
+}
+
+// Test: A verdict on a mirrored blob retags its object after recording the
+// verdict, so blob-mirror copies the record with the verdict to the replica
+func TestScanVerdict_RetagsMirroredBlob(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob()}
+	setupScannerDeps(db)
+	tagger := &mockTagger{db: db, retags: map[string]string{}}
+	deps.Mirror = tagger
+
+	response, _ := handler(context.Background(), scanVerdictRequest(scannerPrincipal, `{"verdict": "clean"}`))
+	if response.StatusCode != 204 {
+		t.Fatalf("expected 204, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if status, ok := tagger.retags["user-456/blob-123"]; !ok || status != "clean" {
+		t.Errorf("expected the object retagged after the verdict was recorded, got %v", tagger.retags)
+	}
+}
+
+func TestScanVerdict_RetagFailure_Returns500(t *testing.T) {
+	db := &mockBlobDB{blob: testBlob()}
+	setupScannerDeps(db)
+	deps.Mirror = &mockTagger{db: db, err: errors.New("slow down")}
+
+	response, _ := handler(context.Background(), scanVerdictRequest(scannerPrincipal, `{"verdict": "clean"}`))
+	if response.StatusCode != 500 {
+		t.Errorf("expected 500 so the scanner retries, got %d", response.StatusCode)
+	}
+}
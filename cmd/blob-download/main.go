@@ -4,10 +4,12 @@ import (
 	"context"
 	"crypto/rsa"
 	"crypto/x509"
-	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -16,27 +18,52 @@ import (
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/cloudfront/sign"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobname"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/downloadregion"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-core/internal/usage"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
+
+// scanStatusHeader carries a scanned blob's scan status on download redirects
+const scanStatusHeader = "X-Blob-Scan-Status"
+
+// rangeQueryParam carries a ranged download's inclusive byte range,
+// "start-end", in the signed URL. The blob-path-rewrite CloudFront function
+// turns it into the Range header of the request to S3.
+const rangeQueryParam = "range"
 
 // BlobDB handles DynamoDB operations for blob metadata
 type BlobDB interface {
 	GetBlob(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
 }
 
-// URLSigner generates CloudFront signed URLs
+// URLSigner generates CloudFront signed URLs. A non-empty sourceCIDR
+// restricts the URL to requests from that address range.
 type URLSigner interface {
-	Sign(url string, expiry time.Time) (string, error)
+	Sign(url string, expiry time.Time, sourceCIDR string) (string, error)
 }
 
 // SecretsReader reads secrets from Secrets Manager
@@ -45,15 +72,7 @@ type SecretsReader interface {
 }
 
 // BlobRecord represents a blob record from DynamoDB
-type BlobRecord struct {
-	BlobID      string `dynamodbav:"blobId"`
-	AccountID   string `dynamodbav:"accountId"`
-	Size        int64  `dynamodbav:"size"`
-	ContentType string `dynamodbav:"contentType"`
-	S3Key       string `dynamodbav:"s3Key"`
-	CreatedAt   string `dynamodbav:"createdAt"`
-	DeletedAt   string `dynamodbav:"deletedAt,omitempty"`
-}
+type BlobRecord = blobmeta.Record
 
 // ParsedBlobID contains the parsed components of a potentially composite blobId
 type ParsedBlobID struct {
@@ -108,12 +127,6 @@ func ParseBlobID(blobID string) (ParsedBlobID, error) {
 	}
 }
 
-// ErrorResponse is the error response format
-type ErrorResponse struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
-}
-
 // Response is the API Gateway proxy response
 type Response struct {
 	StatusCode int               `json:"statusCode"`
@@ -127,6 +140,17 @@ type Config struct {
 	CloudFrontKeyPairID string
 	PrivateKeySecretARN string
 	SignedURLExpiry    time.Duration
+	// Prefix lengths the requester's address is bound to in signed URLs;
+	// 0 leaves URLs for that address family unbound
+	SourceIPv4Prefix int
+	SourceIPv6Prefix int
+	// Regions serves downloads from a replica region's domain when the
+	// caller hints at or is near one, falling back to CloudFrontDomain
+	Regions downloadregion.Regions
+	// FailoverDomain, when set, serves every download from the blob-mirror
+	// replica in FailoverRegion instead
+	FailoverDomain string
+	FailoverRegion string
 }
 
 // PrincipalChecker checks if a caller is allowed to access IAM endpoints
@@ -134,19 +158,80 @@ type PrincipalChecker interface {
 	IsAllowedPrincipal(callerARN string) bool
 }
 
+// AccountReader reads account META# records
+type AccountReader interface {
+	GetMeta(ctx context.Context, accountID string) (*account.Meta, error)
+}
+
+// ActivityRecorder records that an account is in use, for the
+// account-reaper
+type ActivityRecorder interface {
+	RecordActivity(ctx context.Context, accountID string, now time.Time) error
+}
+
+// AliasResolver resolves account aliases to account IDs
+type AliasResolver interface {
+	ResolveAlias(ctx context.Context, alias string) (string, error)
+}
+
+// PrincipalBindings restricts IAM principals to the accounts they are bound to
+type PrincipalBindings interface {
+	IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error)
+}
+
+// RateLimiter takes a token from each key's bucket, using the tier's limit
+// for account keys
+type RateLimiter interface {
+	AllowTier(ctx context.Context, tier string, keys ...string) (ratelimit.Decision, error)
+}
+
+// UsageRecorder records per-account usage for metering
+type UsageRecorder interface {
+	RecordDownload(ctx context.Context, accountID string, bytes int64) error
+}
+
+// DelegationVerifier verifies the delegation tokens plugins present when
+// calling back into core
+type DelegationVerifier interface {
+	Verify(token string) (*delegation.Claims, error)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
 	DB            BlobDB
 	Signer        URLSigner
 	SecretsReader SecretsReader
 	Registry      PrincipalChecker
+	Accounts      AccountReader
+	Aliases       AliasResolver
+	Activity      ActivityRecorder
+	Bindings      PrincipalBindings
+	Delegation    DelegationVerifier
+	RateLimiter   RateLimiter
+	Usage         UsageRecorder
+	CORS          *cors.Policy
 	Config        Config
+	// AccountIDClaim names the authorizer claim holding a user's account ID
+	AccountIDClaim string
 }
 
 var deps *Dependencies
 
+// corsHandler answers CORS preflights, gives each request a correlation ID,
+// and adds CORS headers and the correlation ID to the handler's responses
+func corsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	if cors.IsPreflight(request.HTTPMethod) {
+		return Response{StatusCode: 204, Headers: deps.CORS.Preflight(request.Headers)}, nil
+	}
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(deps.CORS.Apply(request.Headers, resp.Headers), correlationID)
+	return resp, err
+}
+
 // handler processes blob download requests
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
 	ctx, span := tracing.StartHandlerSpan(ctx, "BlobDownloadHandler",
 		tracing.Function("blob-download"),
 		tracing.RequestID(request.RequestContext.RequestID),
@@ -156,14 +241,32 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	// Extract accountId from path
 	pathAccountID := request.PathParameters["accountId"]
 	if pathAccountID == "" {
-		return errorResponse(400, "invalidArguments", "Missing accountId in path")
+		return errorResponse(ctx, 400, "invalidArguments", "Missing accountId in path")
 	}
+
+	// Resolve an alias in the path to the account it belongs to
+	resolvedID, err := resolveAccountID(ctx, pathAccountID)
+	if err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			logger.WarnContext(ctx, "Unknown account alias",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("alias", pathAccountID),
+			)
+			return errorResponse(ctx, 404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to resolve account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to resolve account")
+	}
+	pathAccountID = resolvedID
 	span.SetAttributes(tracing.AccountID(pathAccountID))
 
 	// Extract blobId from path
 	blobID := request.PathParameters["blobId"]
 	if blobID == "" {
-		return errorResponse(400, "invalidArguments", "Missing blobId in path")
+		return errorResponse(ctx, 400, "invalidArguments", "Missing blobId in path")
 	}
 	span.SetAttributes(tracing.BlobID(blobID))
 
@@ -175,29 +278,55 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("blob_id", blobID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(400, "invalidArguments", "Invalid blobId format")
+		return errorResponse(ctx, 400, "invalidArguments", "Invalid blobId format")
 	}
 
 	// Extract authenticated account ID (from JWT or path for IAM)
-	authAccountID, err := extractAccountID(request)
+	authAccountID, err := extractAccountID(request, deps.AccountIDClaim)
 	if err != nil {
 		logger.WarnContext(ctx, "Failed to extract account ID",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(401, "unauthorized", "Missing or invalid authentication")
+		return errorResponse(ctx, 401, "unauthorized", "Missing or invalid authentication")
+	}
+	// IAM requests take their account from the path, already resolved above
+	if authAccountID == request.PathParameters["accountId"] {
+		authAccountID = pathAccountID
 	}
 
 	// Check principal authorization for IAM-authenticated requests
+	rateLimitKeys := []string{ratelimit.AccountKey(pathAccountID)}
 	if isIAMAuthenticatedRequest(request) {
 		callerPrincipal := extractCallerPrincipal(request)
-		if !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
+		// A delegation token stands in for registry trust, for its account and
+		// plugin only; principal bindings still apply
+		delegated := delegation.IsDelegated(ctx, deps.Delegation, request, pathAccountID)
+		if !delegated && !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
 			logger.WarnContext(ctx, "Unauthorized IAM principal",
 				slog.String("request_id", request.RequestContext.RequestID),
 				slog.String("caller_principal", callerPrincipal),
 			)
-			return errorResponse(403, "forbidden", "Principal not authorized for IAM access")
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for IAM access")
+		}
+		allowed, err := deps.Bindings.IsAllowed(ctx, callerPrincipal, pathAccountID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check principal bindings",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to check principal bindings")
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "IAM principal not bound to account",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("caller_principal", callerPrincipal),
+			)
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for this account")
 		}
+		rateLimitKeys = append(rateLimitKeys, ratelimit.PrincipalKey(callerPrincipal))
 	}
 
 	// Validate path accountId matches authenticated accountId
@@ -207,7 +336,53 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("path_account_id", pathAccountID),
 			slog.String("auth_account_id", authAccountID),
 		)
-		return errorResponse(403, "forbidden", "Account ID mismatch")
+		return errorResponse(ctx, 403, "forbidden", "Account ID mismatch")
+	}
+
+	// Reject downloads for suspended accounts
+	meta, err := deps.Accounts.GetMeta(ctx, pathAccountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get account meta",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to retrieve account")
+	}
+	if meta != nil && meta.Suspended {
+		logger.WarnContext(ctx, "Download for suspended account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", pathAccountID),
+		)
+		return codedErrorResponse(ctx, 403, "forbidden", errcode.AccountSuspended, "Account is suspended")
+	}
+	recordActivity(ctx, pathAccountID, meta)
+
+	// Enforce per-account and per-principal request rates, with the
+	// account's tier choosing its limit
+	if deps.RateLimiter != nil {
+		var tier string
+		if meta != nil {
+			tier = meta.Tier
+		}
+		decision, err := deps.RateLimiter.AllowTier(ctx, tier, rateLimitKeys...)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check rate limit",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to check rate limit")
+		}
+		if !decision.Allowed {
+			logger.WarnContext(ctx, "Download rate limited",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("rate_limit_key", decision.Key),
+			)
+			response, err := errorResponse(ctx, 429, "rateLimited", "Too many requests")
+			response.Headers["Retry-After"] = decision.RetryAfterSeconds()
+			return response, err
+		}
 	}
 
 	// Look up blob in DynamoDB using base blob ID (without range suffix)
@@ -217,7 +392,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to retrieve blob metadata")
+		return errorResponse(ctx, 500, "serverFail", "Failed to retrieve blob metadata")
 	}
 
 	// Check if blob exists
@@ -227,7 +402,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("account_id", pathAccountID),
 			slog.String("blob_id", blobID),
 		)
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
 	}
 
 	// Verify blob ownership (defense in depth - should match since we query by account)
@@ -237,7 +412,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("blob_account_id", blob.AccountID),
 			slog.String("request_account_id", pathAccountID),
 		)
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
 	}
 
 	// Check if blob has been marked as deleted
@@ -247,44 +422,178 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("account_id", pathAccountID),
 			slog.String("blob_id", blobID),
 		)
-		return errorResponse(404, "notFound", "Blob not found")
+		return errorResponse(ctx, 404, "notFound", "Blob not found")
+	}
+
+	// Refuse blobs the scanner found infected
+	if blob.ScanStatus == store.ScanInfected {
+		logger.WarnContext(ctx, "Blob is infected",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", pathAccountID),
+			slog.String("blob_id", blobID),
+		)
+		return codedErrorResponse(ctx, 403, "forbidden", errcode.BlobInfected, "Blob failed content scanning")
+	}
+
+	// The replica's records are mirrored when blobs are confirmed and never
+	// receive the scan verdict, so during failover a pending blob may be one
+	// the scanner has since found infected
+	if deps.Config.FailoverDomain != "" && blob.ScanStatus == store.ScanPending {
+		logger.WarnContext(ctx, "Refusing unscanned blob during failover",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", pathAccountID),
+			slog.String("blob_id", blobID),
+		)
+		return codedErrorResponse(ctx, 403, "forbidden", errcode.BlobScanPending, "Blob has not passed content scanning")
+	}
+
+	// Check a composite blobId's range against the blob
+	var query []string
+	if parsedBlobID.HasRange {
+		start, end, err := downloadRange(blob, parsedBlobID)
+		if err != nil {
+			logger.WarnContext(ctx, "Byte range outside blob",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("blob_id", blobID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 400, "invalidArguments", "Byte range is outside the blob")
+		}
+		query = append(query, fmt.Sprintf("%s=%d-%d", rangeQueryParam, start, end))
 	}
 
-	// Generate CloudFront signed URL
-	// Use the original blobId (which may include range suffix) so CloudFront function can extract it
-	blobURL := fmt.Sprintf("https://%s/blobs/%s/%s", deps.Config.CloudFrontDomain, pathAccountID, blobID)
+	// Generate CloudFront signed URL for the base blob. The range is part of
+	// the signed URL, so the edge applies the range checked here rather than
+	// parsing one out of the blobId, and clients cannot change it.
+	domain, region := deps.Config.Regions.FromHeaders(request.Headers, deps.Config.CloudFrontDomain)
+	if deps.Config.FailoverDomain != "" {
+		domain, region = deps.Config.FailoverDomain, deps.Config.FailoverRegion
+	}
+	blobURL := fmt.Sprintf("https://%s/blobs/%s/%s", domain, pathAccountID, parsedBlobID.BaseBlobID)
+	// S3 serves a named blob under its original filename. The override is
+	// part of the signed URL, so clients cannot change it.
+	if blob.Name != "" {
+		disposition := blobname.ContentDisposition(dispositionType(request.QueryStringParameters), blob.Name)
+		query = append(query, "response-content-disposition="+url.QueryEscape(disposition))
+	}
+	if len(query) > 0 {
+		blobURL += "?" + strings.Join(query, "&")
+	}
 	expiry := time.Now().Add(deps.Config.SignedURLExpiry)
 
-	signedURL, err := deps.Signer.Sign(blobURL, expiry)
+	sourceCIDR := bindSourceIP(request.RequestContext.Identity.SourceIP, deps.Config.SourceIPv4Prefix, deps.Config.SourceIPv6Prefix)
+	signedURL, err := deps.Signer.Sign(blobURL, expiry, sourceCIDR)
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to sign URL",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to generate download URL")
+		return errorResponse(ctx, 500, "serverFail", "Failed to generate download URL")
+	}
+
+	// Downloads are metered when the redirect is issued, since the bytes are
+	// served by CloudFront. Recording is best-effort.
+	if deps.Usage != nil {
+		if err := deps.Usage.RecordDownload(ctx, pathAccountID, downloadSize(blob, parsedBlobID)); err != nil {
+			logger.WarnContext(ctx, "Failed to record usage",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", pathAccountID),
+				slog.String("error", err.Error()),
+			)
+		}
 	}
 
 	logger.InfoContext(ctx, "Blob download redirect",
 		slog.String("request_id", request.RequestContext.RequestID),
 		slog.String("account_id", pathAccountID),
 		slog.String("blob_id", blobID),
+		slog.String("region", region),
 	)
 
+	headers := map[string]string{
+		"Location":      signedURL,
+		"Cache-Control": "no-store",
+	}
+	// Tell the caller which replica region serves the download
+	if region != "" {
+		headers[downloadregion.HintHeader] = region
+	}
+	// Let callers such as a Blob/get plugin report the scan status
+	if blob.ScanStatus != "" {
+		headers[scanStatusHeader] = blob.ScanStatus
+	}
+
 	return Response{
 		StatusCode: 302,
-		Headers: map[string]string{
-			"Location":      signedURL,
-			"Cache-Control": "no-store",
-		},
-		Body: "",
+		Headers:    headers,
+		Body:       "",
 	}, nil
 }
 
+// dispositionType returns the Content-Disposition type a download asked for
+// with the disposition query parameter, "attachment" unless it asked for
+// "inline"
+func dispositionType(query map[string]string) string {
+	if query["disposition"] == "inline" {
+		return "inline"
+	}
+	return "attachment"
+}
+
+// downloadRange returns the inclusive byte range a composite blobId serves,
+// with the end clamped to the blob's last byte, as S3 would. A range
+// starting past the end of the blob serves nothing and is an error.
+func downloadRange(blob *BlobRecord, parsed ParsedBlobID) (int64, int64, error) {
+	if parsed.StartByte >= blob.Size {
+		return 0, 0, fmt.Errorf("start byte %d is past the end of the %d byte blob", parsed.StartByte, blob.Size)
+	}
+	return parsed.StartByte, min(parsed.EndByte, blob.Size-1), nil
+}
+
+// downloadSize is the number of bytes a download will serve. The range has
+// already been checked by downloadRange.
+func downloadSize(blob *BlobRecord, parsed ParsedBlobID) int64 {
+	if !parsed.HasRange {
+		return blob.Size
+	}
+	start, end, err := downloadRange(blob, parsed)
+	if err != nil {
+		return 0
+	}
+	return end - start + 1
+}
+
+// recordActivity updates the account's lastActivityAt when it is due. A
+// failure is logged rather than failing the request.
+func recordActivity(ctx context.Context, accountID string, meta *account.Meta) {
+	now := time.Now()
+	if deps.Activity == nil || !account.ActivityDue(meta, now) {
+		return
+	}
+	if err := deps.Activity.RecordActivity(ctx, accountID, now); err != nil {
+		logger.WarnContext(ctx, "Failed to record account activity",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// resolveAccountID maps an account alias to its account ID. Identifiers that
+// are not aliases are returned unchanged.
+func resolveAccountID(ctx context.Context, id string) (string, error) {
+	if deps.Aliases == nil || !account.IsAlias(id) {
+		return id, nil
+	}
+	return deps.Aliases.ResolveAlias(ctx, id)
+}
+
 // extractAccountID extracts account ID using authoritative API Gateway signals.
 // - IAM auth: Identity.UserArn or Identity.Caller is populated → use path param
-// - Cognito auth: Authorizer["claims"]["sub"] is populated → use JWT sub claim
+// - API key auth: the API key authorizer sets the key's account → use it
+// - User auth: Authorizer holds the OIDC claims → use the account ID claim (sub by default)
 // These fields are populated by API Gateway and cannot be spoofed by clients.
-func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
+func extractAccountID(request events.APIGatewayProxyRequest, claim string) (string, error) {
 	identity := request.RequestContext.Identity
 
 	// IAM auth: API Gateway populates Identity.UserArn and/or Identity.Caller
@@ -297,23 +606,18 @@ func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
 		return accountID, nil
 	}
 
-	// Cognito auth: API Gateway populates Authorizer with claims
+	// User auth: API Gateway populates Authorizer with claims
 	authorizer := request.RequestContext.Authorizer
 	if authorizer == nil {
 		return "", fmt.Errorf("no authentication context (neither IAM nor Cognito)")
 	}
 
-	claims, ok := authorizer["claims"].(map[string]any)
-	if !ok {
-		return "", fmt.Errorf("no claims in authorizer")
-	}
-
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("sub claim not found or empty")
+	// API key auth: the API key authorizer sets the key's account
+	if accountID, _, ok := auth.APIKeyFromAuthorizer(authorizer); ok {
+		return accountID, nil
 	}
 
-	return sub, nil
+	return auth.AccountIDFromAuthorizer(authorizer, claim)
 }
 
 // isIAMAuthenticatedRequest checks if the request is IAM-authenticated
@@ -327,59 +631,54 @@ func extractCallerPrincipal(request events.APIGatewayProxyRequest) string {
 	return request.RequestContext.Identity.UserArn
 }
 
-// errorResponse builds an error response
-func errorResponse(statusCode int, errorType, description string) (Response, error) {
-	body, _ := json.Marshal(ErrorResponse{Type: errorType, Description: description})
-	return Response{
-		StatusCode: statusCode,
-		Headers:    map[string]string{"Content-Type": "application/json"},
-		Body:       string(body),
-	}, nil
+// errorResponse builds a problem response with the error type's code
+func errorResponse(ctx context.Context, statusCode int, errorType, description string) (Response, error) {
+	return problemResponse(ctx, problem.New(statusCode, errorType, description))
 }
 
-// =============================================================================
-// Real implementations
-// =============================================================================
-
-// DynamoDBBlobDB implements BlobDB using AWS DynamoDB
-type DynamoDBBlobDB struct {
-	client    *dynamodb.Client
-	tableName string
+// codedErrorResponse builds a problem response with a specific code
+func codedErrorResponse(ctx context.Context, statusCode int, errorType string, code errcode.Code, description string) (Response, error) {
+	return problemResponse(ctx, problem.New(statusCode, errorType, description).WithCode(code))
 }
 
-// NewDynamoDBBlobDB creates a new DynamoDBBlobDB
-func NewDynamoDBBlobDB(client *dynamodb.Client, tableName string) *DynamoDBBlobDB {
-	return &DynamoDBBlobDB{
-		client:    client,
-		tableName: tableName,
-	}
+// problemResponse builds a response carrying a problem
+func problemResponse(ctx context.Context, p *problem.Problem) (Response, error) {
+	return Response{
+		StatusCode: p.Status,
+		Headers:    problem.Headers(),
+		Body:       p.Body(ctx),
+	}, nil
 }
 
-// GetBlob retrieves a blob record from DynamoDB
-func (d *DynamoDBBlobDB) GetBlob(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
-	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-		},
-	})
+// bindSourceIP returns the range of the given prefix length around the
+// requester's address, so a leaked URL only works from nearby addresses.
+// Returns "" when binding is off for the address family or the address
+// can't be parsed.
+func bindSourceIP(sourceIP string, ipv4Prefix, ipv6Prefix int) string {
+	addr, err := netip.ParseAddr(sourceIP)
 	if err != nil {
-		return nil, err
+		return ""
 	}
+	addr = addr.Unmap()
 
-	if result.Item == nil {
-		return nil, nil
+	bits := ipv6Prefix
+	if addr.Is4() {
+		bits = ipv4Prefix
 	}
-
-	var record BlobRecord
-	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
-		return nil, err
+	if bits <= 0 {
+		return ""
 	}
-
-	return &record, nil
+	prefix, err := addr.Prefix(bits)
+	if err != nil {
+		return ""
+	}
+	return prefix.String()
 }
 
+// =============================================================================
+// Real implementations
+// =============================================================================
+
 // CloudFrontURLSigner implements URLSigner using CloudFront SDK
 type CloudFrontURLSigner struct {
 	signer *sign.URLSigner
@@ -415,9 +714,26 @@ func NewCloudFrontURLSigner(keyPairID, privateKeyPEM string) (*CloudFrontURLSign
 	return &CloudFrontURLSigner{signer: signer}, nil
 }
 
-// Sign generates a signed URL for the given resource
-func (s *CloudFrontURLSigner) Sign(url string, expiry time.Time) (string, error) {
-	signedURL, err := s.signer.Sign(url, expiry)
+// Sign generates a signed URL for the given resource. Unbound URLs use a
+// canned policy; bound URLs need a custom policy with an IpAddress condition.
+func (s *CloudFrontURLSigner) Sign(url string, expiry time.Time, sourceCIDR string) (string, error) {
+	if sourceCIDR == "" {
+		signedURL, err := s.signer.Sign(url, expiry)
+		if err != nil {
+			return "", fmt.Errorf("failed to generate signed URL: %w", err)
+		}
+		return signedURL, nil
+	}
+
+	signedURL, err := s.signer.SignWithPolicy(url, &sign.Policy{
+		Statements: []sign.Statement{{
+			Resource: url,
+			Condition: sign.Condition{
+				DateLessThan: sign.NewAWSEpochTime(expiry),
+				IPAddress:    &sign.IPAddress{SourceIP: sourceCIDR},
+			},
+		}},
+	})
 	if err != nil {
 		return "", fmt.Errorf("failed to generate signed URL: %w", err)
 	}
@@ -463,44 +779,46 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
-	}
-
-	cloudfrontDomain := os.Getenv("CLOUDFRONT_DOMAIN")
-	if cloudfrontDomain == "" {
-		logger.Error("FATAL: CLOUDFRONT_DOMAIN environment variable is required")
-		panic("CLOUDFRONT_DOMAIN environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	keyPairID := os.Getenv("CLOUDFRONT_KEY_PAIR_ID")
-	if keyPairID == "" {
-		logger.Error("FATAL: CLOUDFRONT_KEY_PAIR_ID environment variable is required")
-		panic("CLOUDFRONT_KEY_PAIR_ID environment variable is required")
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	privateKeySecretARN := os.Getenv("PRIVATE_KEY_SECRET_ARN")
-	if privateKeySecretARN == "" {
-		logger.Error("FATAL: PRIVATE_KEY_SECRET_ARN environment variable is required")
-		panic("PRIVATE_KEY_SECRET_ARN environment variable is required")
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	expirySeconds := 300 // default 5 minutes
-	if expiryStr := os.Getenv("SIGNED_URL_EXPIRY_SECONDS"); expiryStr != "" {
-		if parsed, err := strconv.Atoi(expiryStr); err == nil {
-			expirySeconds = parsed
-		}
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobDownload(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	tableName := cfg.Table
 
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 	secretsClient := secretsmanager.NewFromConfig(result.Config)
 
 	// Read private key from Secrets Manager
 	secretsReader := NewSecretsManagerReader(secretsClient)
-	privateKey, err := secretsReader.GetPrivateKey(result.Ctx, privateKeySecretARN)
+	privateKey, err := secretsReader.GetPrivateKey(result.Ctx, cfg.PrivateKeySecretARN)
 	if err != nil {
 		logger.Error("FATAL: Failed to read private key from Secrets Manager",
 			slog.String("error", err.Error()),
@@ -509,7 +827,7 @@ func main() {
 	}
 
 	// Create CloudFront URL signer
-	signer, err := NewCloudFrontURLSigner(keyPairID, privateKey)
+	signer, err := NewCloudFrontURLSigner(cfg.CloudFrontKeyPairID, privateKey)
 	if err != nil {
 		logger.Error("FATAL: Failed to create CloudFront signer",
 			slog.String("error", err.Error()),
@@ -520,27 +838,91 @@ func main() {
 	// Initialize database client for plugin registry
 	dbClient := db.NewClientFromConfig(result.Config, tableName)
 
-	// Load plugin registry for IAM principal authorization
-	registry := plugin.NewRegistry()
-	if err := registry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
+	// Load plugin registry for IAM principal authorization, from this environment's snapshot when
+	// there is one, refreshing it from DynamoDB in the background
+	registry, err := plugin.LoadWithSnapshot(result.Ctx, dbClient, plugin.SnapshotPath(tableName), func(err error) {
+		logger.Warn("Plugin registry snapshot failed",
+			slog.String("error", err.Error()),
+		)
+	})
+	if err != nil {
 		logger.Error("FATAL: Failed to load plugin registry",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
 
+	// Initialize rate limiter; a rate of zero disables limiting, except for
+	// tiers with their own limit
+	var rateLimiter RateLimiter
+	if cfg.RateLimit.Active() {
+		rateLimiter = ratelimit.NewLimiter(dynamoClient, tableName, cfg.RateLimit.Limit).WithTierLimits(cfg.RateLimit.Tiers)
+	}
+
+	// Load the key that verifies plugin delegation tokens
+	delegationKey, err := delegation.LoadKey(result.Ctx, secretsClient, cfg.DelegationSecretARN)
+	if err != nil {
+		logger.Error("FATAL: Failed to load delegation key",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional envelope encryption of blob record metadata
+	metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+
+	// Blob records come from the blob-mirror replica's table during a
+	// failover; everything else stays on the primary table
+	blobTable, blobClient := tableName, dynamoClient
+	if cfg.Failover {
+		blobTable = cfg.FailoverTable
+		blobClient = store.NewRetryClient(dynamodb.NewFromConfig(result.Config, func(o *dynamodb.Options) { o.Region = cfg.FailoverRegion }))
+	}
+
+	// Popular blobs are fetched repeatedly; keep their records in memory
+	var blobDB BlobDB = store.NewBlobStore(blobClient, blobTable).WithEncryption(metadataEnvelope)
+	if cfg.BlobCacheSize > 0 {
+		blobDB = store.NewBlobCache(blobDB, cfg.BlobCacheSize, cfg.BlobCacheTTL)
+	}
+
+	accounts := account.NewDynamoDBStore(dynamoClient, tableName)
+
 	deps = &Dependencies{
-		DB:            NewDynamoDBBlobDB(dynamoClient, tableName),
+		DB:            blobDB,
 		Signer:        signer,
 		SecretsReader: secretsReader,
 		Registry:      registry,
+		Accounts:      accounts,
+		Aliases:       accounts,
+		Activity:      accounts,
+		Bindings:      binding.NewDynamoDBStore(dynamoClient, tableName),
+		Delegation:    delegation.NewSigner(delegationKey, delegation.DefaultTTL),
+		RateLimiter:   rateLimiter,
+		Usage:         usage.NewDynamoDBStore(dynamoClient, tableName),
+		CORS:          cors.New(cfg.CORSOrigins, "GET"),
 		Config: Config{
-			CloudFrontDomain:    cloudfrontDomain,
-			CloudFrontKeyPairID: keyPairID,
-			PrivateKeySecretARN: privateKeySecretARN,
-			SignedURLExpiry:     time.Duration(expirySeconds) * time.Second,
+			CloudFrontDomain:    cfg.CloudFrontDomain,
+			CloudFrontKeyPairID: cfg.CloudFrontKeyPairID,
+			PrivateKeySecretARN: cfg.PrivateKeySecretARN,
+			SignedURLExpiry:     cfg.SignedURLExpiry,
+			SourceIPv4Prefix:    cfg.SourceIPv4Prefix,
+			SourceIPv6Prefix:    cfg.SourceIPv6Prefix,
+			Regions:             cfg.Regions,
+			FailoverDomain:      cfg.FailoverDomain,
+			FailoverRegion:      cfg.FailoverRegion,
 		},
+		AccountIDClaim: cfg.AccountIDClaim,
+	}
+
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, corsHandler, "GET /download/{accountId}/{blobId}", "OPTIONS /download/{accountId}/{blobId}", "GET /download-iam/{accountId}/{blobId}")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	result.Start(handler)
+	result.Start(corsHandler)
 }
@@ -2,14 +2,30 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
+	"github.com/jarrod-lowe/jmap-service-core/internal/downloadregion"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+)
+
+// The in-memory fakes satisfy this Lambda's storage interfaces
+var (
+	_ BlobDB        = (*fakes.Table)(nil)
+	_ AccountReader = (*fakes.Table)(nil)
 )
 
 // =============================================================================
@@ -138,11 +154,13 @@ type mockURLSigner struct {
 	signedURL string
 	lastURL   string
 	lastExpiry time.Time
+	lastSourceCIDR string
 }
 
-func (m *mockURLSigner) Sign(url string, expiry time.Time) (string, error) {
+func (m *mockURLSigner) Sign(url string, expiry time.Time, sourceCIDR string) (string, error) {
 	m.lastURL = url
 	m.lastExpiry = expiry
+	m.lastSourceCIDR = sourceCIDR
 	if m.signFunc != nil {
 		return m.signFunc(url, expiry)
 	}
@@ -165,17 +183,29 @@ func (m *mockSecretsReader) GetPrivateKey(ctx context.Context, secretARN string)
 	return m.privateKey, m.getErr
 }
 
+type mockAccountReader struct {
+	meta *account.Meta
+	err  error
+}
+
+func (m *mockAccountReader) GetMeta(ctx context.Context, accountID string) (*account.Meta, error) {
+	return m.meta, m.err
+}
+
 func setupTestDeps(db *mockBlobDB, signer *mockURLSigner, secrets *mockSecretsReader) {
 	deps = &Dependencies{
 		DB:            db,
 		Signer:        signer,
 		SecretsReader: secrets,
+		Accounts:      &mockAccountReader{},
 		Config: Config{
 			CloudFrontDomain:    "cdn.example.com",
 			CloudFrontKeyPairID: "KEYPAIRID123",
 			PrivateKeySecretARN: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test",
 			SignedURLExpiry:     5 * time.Minute,
 		},
+		Bindings:       &mockPrincipalBindings{},
+		AccountIDClaim: "sub",
 	}
 }
 
@@ -266,16 +296,160 @@ func TestDownload_BlobNotFound(t *testing.T) {
 		t.Errorf("expected status code 404, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "notFound" {
+	if errResp.Type != problem.TypeURI("notFound") {
 		t.Errorf("expected error type 'notFound', got '%s'", errResp.Type)
 	}
 }
 
+// Test: Suspended account returns 403 without looking up the blob
+func TestDownload_SuspendedAccount_Returns403(t *testing.T) {
+	db := &mockBlobDB{blob: nil}
+	signer := &mockURLSigner{}
+	secrets := &mockSecretsReader{}
+	setupTestDeps(db, signer, secrets)
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-456", Suspended: true}}
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 403 {
+		t.Errorf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var errResp problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
+		t.Fatalf("failed to unmarshal error response: %v", err)
+	}
+	if errResp.Type != problem.TypeURI("forbidden") {
+		t.Errorf("expected error type 'forbidden', got '%s'", errResp.Type)
+	}
+}
+
+// Test: a request for an active account records activity, a suspended one does not
+func TestDownload_RecordsActivity(t *testing.T) {
+	for _, tt := range []struct {
+		name      string
+		suspended bool
+		want      int
+	}{
+		{"active", false, 1},
+		{"suspended", true, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDeps(&mockBlobDB{blob: nil}, &mockURLSigner{}, &mockSecretsReader{})
+			deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-456", Suspended: tt.suspended}}
+			activity := &mockActivityRecorder{}
+			deps.Activity = activity
+
+			request := events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{
+					"accountId": "user-456",
+					"blobId":    "blob-123",
+				},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID: "req-abc",
+					Authorizer: map[string]any{
+						"claims": map[string]any{
+							"sub": "user-456",
+						},
+					},
+				},
+			}
+
+			if _, err := handler(context.Background(), request); err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if len(activity.recorded) != tt.want {
+				t.Errorf("expected %d activity records, got %v", tt.want, activity.recorded)
+			}
+		})
+	}
+}
+
+// mockActivityRecorder implements ActivityRecorder for testing
+type mockActivityRecorder struct {
+	recorded []string
+}
+
+func (m *mockActivityRecorder) RecordActivity(ctx context.Context, accountID string, now time.Time) error {
+	m.recorded = append(m.recorded, accountID)
+	return nil
+}
+
+// mockRateLimiter implements RateLimiter for testing
+type mockRateLimiter struct {
+	decision ratelimit.Decision
+	tier     string
+	keys     []string
+}
+
+func (m *mockRateLimiter) AllowTier(ctx context.Context, tier string, keys ...string) (ratelimit.Decision, error) {
+	m.tier = tier
+	m.keys = keys
+	return m.decision, nil
+}
+
+func TestDownload_RateLimited_Returns429WithRetryAfter(t *testing.T) {
+	db := &mockBlobDB{blob: &BlobRecord{AccountID: "user-456", BlobID: "blob-123"}}
+	signer := &mockURLSigner{}
+	setupTestDeps(db, signer, &mockSecretsReader{})
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-456", Tier: "pro"}}
+	limiter := &mockRateLimiter{decision: ratelimit.Decision{Key: "account#user-456", RetryAfter: 2 * time.Second}}
+	deps.RateLimiter = limiter
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 429 {
+		t.Errorf("expected status code 429, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if response.Headers["Retry-After"] != "2" {
+		t.Errorf("expected Retry-After 2, got %q", response.Headers["Retry-After"])
+	}
+	if limiter.tier != "pro" || len(limiter.keys) != 1 || limiter.keys[0] != "account#user-456" {
+		t.Errorf("expected the account key at the account's tier, got %q %v", limiter.tier, limiter.keys)
+	}
+}
+
 // Test 3: Blob exists but different owner returns 404 (not 403 to avoid information leakage)
 func TestDownload_WrongAccount(t *testing.T) {
 	// Blob belongs to a different account
@@ -352,12 +526,12 @@ func TestDownload_AccountMismatch(t *testing.T) {
 		t.Errorf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "forbidden" {
+	if errResp.Type != problem.TypeURI("forbidden") {
 		t.Errorf("expected error type 'forbidden', got '%s'", errResp.Type)
 	}
 }
@@ -394,12 +568,12 @@ func TestDownload_DynamoDBFailure(t *testing.T) {
 		t.Errorf("expected status code 500, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "serverFail" {
+	if errResp.Type != problem.TypeURI("serverFail") {
 		t.Errorf("expected error type 'serverFail', got '%s'", errResp.Type)
 	}
 }
@@ -446,16 +620,93 @@ func TestDownload_DeletedBlob_Returns404(t *testing.T) {
 		t.Errorf("expected status code 404, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "notFound" {
+	if errResp.Type != problem.TypeURI("notFound") {
 		t.Errorf("expected error type 'notFound', got '%s'", errResp.Type)
 	}
 }
 
+func TestDownload_InfectedBlob_Returns403(t *testing.T) {
+	blob := &BlobRecord{
+		BlobID:     "blob-123",
+		AccountID:  "user-456",
+		Size:       1024,
+		S3Key:      "user-456/blob-123",
+		ScanStatus: "infected",
+	}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 403 {
+		t.Fatalf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var errResp problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
+		t.Fatalf("failed to unmarshal error response: %v", err)
+	}
+	if errResp.Type != problem.TypeURI("forbidden") || errResp.Code != "CORE-3006" {
+		t.Errorf("expected forbidden with CORE-3006, got %+v", errResp)
+	}
+}
+
+func TestDownload_ScanStatusHeader(t *testing.T) {
+	blob := &BlobRecord{
+		BlobID:     "blob-123",
+		AccountID:  "user-456",
+		Size:       1024,
+		S3Key:      "user-456/blob-123",
+		ScanStatus: "clean",
+	}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 302 || response.Headers["X-Blob-Scan-Status"] != "clean" {
+		t.Errorf("expected a redirect with the scan status, got %d %v", response.StatusCode, response.Headers)
+	}
+}
+
 // Test 6: URL signing failure returns 500
 func TestDownload_SigningFailure(t *testing.T) {
 	blob := &BlobRecord{
@@ -497,12 +748,12 @@ func TestDownload_SigningFailure(t *testing.T) {
 		t.Errorf("expected status code 500, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "serverFail" {
+	if errResp.Type != problem.TypeURI("serverFail") {
 		t.Errorf("expected error type 'serverFail', got '%s'", errResp.Type)
 	}
 }
@@ -745,7 +996,7 @@ func TestDownload_RedirectBodyEmpty(t *testing.T) {
 // Composite blobId integration tests
 // =============================================================================
 
-// Test 13: Composite blobId returns 302 with signed URL containing full composite blobId
+// Test 13: Composite blobId returns 302 with the base blob's signed URL carrying its range
 func TestDownload_CompositeBlobID_Success(t *testing.T) {
 	blob := &BlobRecord{
 		BlobID:      "blob-123", // Base blob ID
@@ -786,10 +1037,59 @@ func TestDownload_CompositeBlobID_Success(t *testing.T) {
 		t.Errorf("expected status code 302, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	// Verify the URL passed to signer contains the full composite blobId
-	expectedURL := "https://cdn.example.com/blobs/user-456/blob-123,1024,5120"
+	// Verify the URL passed to signer names the base blob and signs the range
+	expectedURL := "https://cdn.example.com/blobs/user-456/blob-123?range=1024-5120"
 	if signer.lastURL != expectedURL {
-		t.Errorf("expected signed URL to contain composite blobId\nexpected: %s\ngot: %s", expectedURL, signer.lastURL)
+		t.Errorf("expected signed URL to carry the range\nexpected: %s\ngot: %s", expectedURL, signer.lastURL)
+	}
+}
+
+func TestDownload_CompositeBlobID_RangeCheckedAgainstBlob(t *testing.T) {
+	tests := map[string]struct {
+		blobID     string
+		wantStatus int
+		wantURL    string
+	}{
+		"end clamped to the last byte": {blobID: "blob-123,10000,20000", wantStatus: 302, wantURL: "https://cdn.example.com/blobs/user-456/blob-123?range=10000-10239"},
+		"last byte":                    {blobID: "blob-123,10239,10240", wantStatus: 302, wantURL: "https://cdn.example.com/blobs/user-456/blob-123?range=10239-10239"},
+		"start at the end":             {blobID: "blob-123,10240,20000", wantStatus: 400},
+		"start past the end":           {blobID: "blob-123,50000,60000", wantStatus: 400},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 10240}
+			signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+			setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+			response, err := handler(context.Background(), usageDownloadRequest(tc.blobID))
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.wantStatus {
+				t.Fatalf("expected status code %d, got %d. Body: %s", tc.wantStatus, response.StatusCode, response.Body)
+			}
+			if signer.lastURL != tc.wantURL {
+				t.Errorf("expected signed URL %q, got %q", tc.wantURL, signer.lastURL)
+			}
+		})
+	}
+}
+
+func TestDownload_CompositeBlobID_NamedBlob(t *testing.T) {
+	blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 10240, Name: "report.pdf"}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+	response, err := handler(context.Background(), usageDownloadRequest("blob-123,0,99"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 302 {
+		t.Fatalf("expected status code 302, got %d", response.StatusCode)
+	}
+	expectedURL := "https://cdn.example.com/blobs/user-456/blob-123?range=0-99&response-content-disposition=attachment%3B+filename%3Dreport.pdf"
+	if signer.lastURL != expectedURL {
+		t.Errorf("expected signed URL %q, got %q", expectedURL, signer.lastURL)
 	}
 }
 
@@ -825,12 +1125,12 @@ func TestDownload_CompositeBlobID_NotFound(t *testing.T) {
 		t.Errorf("expected status code 404, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "notFound" {
+	if errResp.Type != problem.TypeURI("notFound") {
 		t.Errorf("expected error type 'notFound', got '%s'", errResp.Type)
 	}
 }
@@ -867,12 +1167,12 @@ func TestDownload_CompositeBlobID_WrongAccount(t *testing.T) {
 		t.Errorf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	var errResp ErrorResponse
+	var errResp problem.Problem
 	if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 		t.Fatalf("failed to unmarshal error response: %v", err)
 	}
 
-	if errResp.Type != "forbidden" {
+	if errResp.Type != problem.TypeURI("forbidden") {
 		t.Errorf("expected error type 'forbidden', got '%s'", errResp.Type)
 	}
 }
@@ -921,12 +1221,12 @@ func TestDownload_CompositeBlobID_InvalidFormat(t *testing.T) {
 				t.Errorf("expected status code 400, got %d. Body: %s", response.StatusCode, response.Body)
 			}
 
-			var errResp ErrorResponse
+			var errResp problem.Problem
 			if err := json.Unmarshal([]byte(response.Body), &errResp); err != nil {
 				t.Fatalf("failed to unmarshal error response: %v", err)
 			}
 
-			if errResp.Type != "invalidArguments" {
+			if errResp.Type != problem.TypeURI("invalidArguments") {
 				t.Errorf("expected error type 'invalidArguments', got '%s'", errResp.Type)
 			}
 		})
@@ -950,7 +1250,7 @@ func TestExtractAccountID_IAMAuth_UsesPathParam(t *testing.T) {
 		},
 	}
 
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, "sub")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -970,7 +1270,7 @@ func TestExtractAccountID_IAMAuth_CallerOnly(t *testing.T) {
 		},
 	}
 
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, "sub")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -993,7 +1293,7 @@ func TestExtractAccountID_IAMAuth_WithAuthorizerNoClaims(t *testing.T) {
 		},
 	}
 
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, "sub")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1013,7 +1313,7 @@ func TestExtractAccountID_IAMAuth_MissingPathParam(t *testing.T) {
 		},
 	}
 
-	_, err := extractAccountID(request)
+	_, err := extractAccountID(request, "sub")
 	if err == nil {
 		t.Error("expected error for missing accountId on IAM auth")
 	}
@@ -1036,7 +1336,7 @@ func TestExtractAccountID_CognitoAuth_UsesJWTClaims(t *testing.T) {
 		},
 	}
 
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, "sub")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -1055,7 +1355,7 @@ func TestExtractAccountID_NoAuth_ReturnsError(t *testing.T) {
 		},
 	}
 
-	_, err := extractAccountID(request)
+	_, err := extractAccountID(request, "sub")
 	if err == nil {
 		t.Error("expected error for no authentication context")
 	}
@@ -1078,7 +1378,7 @@ func TestExtractAccountID_CognitoAuth_NoSubClaim(t *testing.T) {
 		},
 	}
 
-	_, err := extractAccountID(request)
+	_, err := extractAccountID(request, "sub")
 	if err == nil {
 		t.Error("expected error for Cognito auth without sub claim")
 	}
@@ -1098,7 +1398,7 @@ func TestExtractAccountID_CognitoAuth_EmptySubClaim(t *testing.T) {
 		},
 	}
 
-	_, err := extractAccountID(request)
+	_, err := extractAccountID(request, "sub")
 	if err == nil {
 		t.Error("expected error for empty sub claim")
 	}
@@ -1116,7 +1416,7 @@ func TestExtractAccountID_AuthorizerWithoutClaims(t *testing.T) {
 		},
 	}
 
-	_, err := extractAccountID(request)
+	_, err := extractAccountID(request, "sub")
 	if err == nil {
 		t.Error("expected error for authorizer without claims")
 	}
@@ -1180,12 +1480,15 @@ func setupTestDepsWithPrincipals(db *mockBlobDB, signer *mockURLSigner, secrets
 		Signer:        signer,
 		SecretsReader: secrets,
 		Registry:      plugin.NewRegistryWithPrincipals(principals),
+		Accounts:      &mockAccountReader{},
 		Config: Config{
 			CloudFrontDomain:    "cdn.example.com",
 			CloudFrontKeyPairID: "KEYPAIRID123",
 			PrivateKeySecretARN: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test",
 			SignedURLExpiry:     5 * time.Minute,
 		},
+		Bindings:       &mockPrincipalBindings{},
+		AccountIDClaim: "sub",
 	}
 }
 
@@ -1229,6 +1532,42 @@ func TestHandler_IAMAuth_RegisteredPrincipal_Succeeds(t *testing.T) {
 	}
 }
 
+func TestHandler_IAMAuth_UnboundAccount_Returns403(t *testing.T) {
+	db := &mockBlobDB{
+		blob: &BlobRecord{
+			BlobID:    "blob-123",
+			AccountID: "user-456",
+			Size:      1024,
+			S3Key:     "user-456/blob-123",
+		},
+	}
+	setupTestDepsWithPrincipals(db, &mockURLSigner{signedURL: "https://cdn.example.com/signed"}, &mockSecretsReader{}, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.Bindings = &mockPrincipalBindings{allowed: map[string]bool{"user-999": true}}
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/download-iam/user-456/blob-123",
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 403 {
+		t.Errorf("expected 403, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
 func TestHandler_IAMAuth_UnregisteredPrincipal_Returns403(t *testing.T) {
 	db := &mockBlobDB{}
 	signer := &mockURLSigner{}
@@ -1302,3 +1641,513 @@ func TestHandler_CognitoAuth_BypassesPrincipalCheck(t *testing.T) {
 		t.Errorf("expected status code 302, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 }
+
+// mockPrincipalBindings implements PrincipalBindings for testing. A nil
+// allowed map is a principal with no bindings, which may act on any account.
+type mockPrincipalBindings struct {
+	allowed map[string]bool
+}
+
+func (m *mockPrincipalBindings) IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error) {
+	if m.allowed == nil {
+		return true, nil
+	}
+	return m.allowed[accountID], nil
+}
+
+// mockAliasResolver implements AliasResolver for testing
+type mockAliasResolver struct {
+	aliases map[string]string
+}
+
+func (m *mockAliasResolver) ResolveAlias(ctx context.Context, alias string) (string, error) {
+	accountID, ok := m.aliases[alias]
+	if !ok {
+		return "", account.ErrAliasNotFound
+	}
+	return accountID, nil
+}
+
+func TestDownload_CognitoAliasPath_MatchesSub(t *testing.T) {
+	var capturedAccountID string
+	db := &mockBlobDB{getFunc: func(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+		capturedAccountID = accountID
+		return &BlobRecord{BlobID: blobID, AccountID: accountID, Size: 10, S3Key: accountID + "/" + blobID}, nil
+	}}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(db, signer, &mockSecretsReader{})
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"alice@example.com": "user-456"}}
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "alice@example.com",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 302 {
+		t.Errorf("expected status code 302, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if capturedAccountID != "user-456" {
+		t.Errorf("expected blob lookup under user-456, got %q", capturedAccountID)
+	}
+}
+
+func TestDownload_IAMAliasPath_ResolvesAccount(t *testing.T) {
+	var capturedAccountID string
+	db := &mockBlobDB{getFunc: func(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+		capturedAccountID = accountID
+		return &BlobRecord{BlobID: blobID, AccountID: accountID, Size: 10, S3Key: accountID + "/" + blobID}, nil
+	}}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDepsWithPrincipals(db, signer, &mockSecretsReader{}, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"alice@example.com": "user-456"}}
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/download-iam/alice@example.com/blob-123",
+		PathParameters: map[string]string{
+			"accountId": "alice@example.com",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 302 {
+		t.Errorf("expected status code 302, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if capturedAccountID != "user-456" {
+		t.Errorf("expected blob lookup under user-456, got %q", capturedAccountID)
+	}
+}
+
+func TestDownload_UnknownAliasPath_Returns404(t *testing.T) {
+	setupTestDeps(&mockBlobDB{}, &mockURLSigner{}, &mockSecretsReader{})
+	deps.Aliases = &mockAliasResolver{}
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "nobody@example.com",
+			"blobId":    "blob-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+// mockUsageRecorder implements UsageRecorder for testing
+type mockUsageRecorder struct {
+	accountID string
+	bytes     int64
+	err       error
+}
+
+func (m *mockUsageRecorder) RecordDownload(ctx context.Context, accountID string, bytes int64) error {
+	m.accountID = accountID
+	m.bytes = bytes
+	return m.err
+}
+
+func usageDownloadRequest(blobID string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-456",
+			"blobId":    blobID,
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "req-abc",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-456",
+				},
+			},
+		},
+	}
+}
+
+func TestDownload_RecordsDownloadUsage(t *testing.T) {
+	tests := map[string]struct {
+		blobID string
+		want   int64
+	}{
+		"whole blob":          {blobID: "blob-123", want: 10240},
+		"inclusive range":     {blobID: "blob-123,1024,5119", want: 4096},
+		"range past blob end": {blobID: "blob-123,10000,20000", want: 240},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 10240}
+			setupTestDeps(&mockBlobDB{blob: blob}, &mockURLSigner{signedURL: "https://cdn.example.com/signed"}, &mockSecretsReader{})
+			recorder := &mockUsageRecorder{}
+			deps.Usage = recorder
+
+			response, err := handler(context.Background(), usageDownloadRequest(tc.blobID))
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != 302 {
+				t.Fatalf("expected status code 302, got %d", response.StatusCode)
+			}
+			if recorder.accountID != "user-456" || recorder.bytes != tc.want {
+				t.Errorf("expected %d bytes recorded for user-456, got %d for %q", tc.want, recorder.bytes, recorder.accountID)
+			}
+		})
+	}
+}
+
+func TestDownload_UsageRecordingFails_StillRedirects(t *testing.T) {
+	blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 10240}
+	setupTestDeps(&mockBlobDB{blob: blob}, &mockURLSigner{signedURL: "https://cdn.example.com/signed"}, &mockSecretsReader{})
+	deps.Usage = &mockUsageRecorder{err: errors.New("dynamo down")}
+
+	response, err := handler(context.Background(), usageDownloadRequest("blob-123"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 302 {
+		t.Errorf("expected status code 302, got %d", response.StatusCode)
+	}
+}
+
+// Test: API key auth uses the account the key was created for
+func TestExtractAccountID_APIKeyAuth_UsesKeyAccount(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"accountId": "someone-else"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]interface{}{
+				"principalId": "user-123",
+				"apiKeyId":    "abc",
+				"accountId":   "user-123",
+				"scopes":      "read",
+			},
+		},
+	}
+
+	accountID, err := extractAccountID(request, "sub")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accountID != "user-123" {
+		t.Errorf("expected 'user-123', got '%s'", accountID)
+	}
+}
+
+func TestCORSHandler_Preflight(t *testing.T) {
+	setupTestDeps(&mockBlobDB{}, &mockURLSigner{}, &mockSecretsReader{})
+	deps.CORS = cors.New([]string{"*"}, "GET")
+
+	response, err := corsHandler(context.Background(), events.APIGatewayProxyRequest{
+		HTTPMethod: "OPTIONS",
+		Headers:    map[string]string{"Origin": "https://app.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 204 {
+		t.Errorf("expected status code 204, got %d", response.StatusCode)
+	}
+	if response.Headers["Access-Control-Allow-Origin"] != "*" || response.Headers["Access-Control-Allow-Methods"] != "GET,OPTIONS" {
+		t.Errorf("unexpected preflight headers: %v", response.Headers)
+	}
+}
+
+func TestDownload_BindsURLToSourceIP(t *testing.T) {
+	tests := []struct {
+		name     string
+		sourceIP string
+		want     string
+	}{
+		{name: "ipv4", sourceIP: "203.0.113.77", want: "203.0.113.0/24"},
+		{name: "ipv6", sourceIP: "2001:db8:1:2:3::9", want: "2001:db8:1:2::/64"},
+		{name: "ipv4-mapped ipv6", sourceIP: "::ffff:203.0.113.77", want: "203.0.113.0/24"},
+		{name: "missing address", sourceIP: "", want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := &mockURLSigner{signedURL: "https://cdn.example.com/blobs/user-456/blob-123?Policy=abc"}
+			setupTestDeps(&mockBlobDB{blob: &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 10}}, signer, &mockSecretsReader{})
+			deps.Config.SourceIPv4Prefix = 24
+			deps.Config.SourceIPv6Prefix = 64
+
+			response, err := handler(context.Background(), events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{"accountId": "user-456", "blobId": "blob-123"},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					Identity:   events.APIGatewayRequestIdentity{SourceIP: tc.sourceIP},
+					Authorizer: map[string]any{"claims": map[string]any{"sub": "user-456"}},
+				},
+			})
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != 302 {
+				t.Fatalf("expected status code 302, got %d. Body: %s", response.StatusCode, response.Body)
+			}
+			if signer.lastSourceCIDR != tc.want {
+				t.Errorf("expected source range %q, got %q", tc.want, signer.lastSourceCIDR)
+			}
+		})
+	}
+}
+
+func TestBindSourceIP(t *testing.T) {
+	if got := bindSourceIP("203.0.113.77", 32, 0); got != "203.0.113.77/32" {
+		t.Errorf("expected exact address, got %q", got)
+	}
+	if got := bindSourceIP("2001:db8::1", 24, 0); got != "" {
+		t.Errorf("expected IPv6 to be unbound without an IPv6 prefix, got %q", got)
+	}
+	if got := bindSourceIP("203.0.113.77", 0, 64); got != "" {
+		t.Errorf("expected IPv4 to be unbound without an IPv4 prefix, got %q", got)
+	}
+}
+
+func TestCloudFrontURLSigner_BoundURLUsesCustomPolicy(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	signer, err := NewCloudFrontURLSigner("KEYPAIRID123", string(keyPEM))
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	expiry := time.Now().Add(5 * time.Minute)
+
+	unbound, err := signer.Sign("https://cdn.example.com/blobs/user-456/blob-123", expiry, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(unbound, "Expires=") || strings.Contains(unbound, "Policy=") {
+		t.Errorf("expected a canned policy URL, got %s", unbound)
+	}
+
+	bound, err := signer.Sign("https://cdn.example.com/blobs/user-456/blob-123", expiry, "203.0.113.0/24")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(bound, "Policy=") {
+		t.Errorf("expected a custom policy URL, got %s", bound)
+	}
+}
+
+func TestDownload_NamedBlob_SignsContentDisposition(t *testing.T) {
+	tests := []struct {
+		name  string
+		query map[string]string
+		want  string
+	}{
+		{"attachment by default", nil, "?response-content-disposition=attachment%3B+filename%3Dreport.pdf"},
+		{"inline on request", map[string]string{"disposition": "inline"}, "?response-content-disposition=inline%3B+filename%3Dreport.pdf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob := &BlobRecord{
+				BlobID:    "blob-123",
+				AccountID: "user-456",
+				Size:      1024,
+				S3Key:     "user-456/blob-123",
+				Name:      "report.pdf",
+			}
+			signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+			setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+			request := events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{
+					"accountId": "user-456",
+					"blobId":    "blob-123",
+				},
+				QueryStringParameters: tt.query,
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID: "req-abc",
+					Authorizer: map[string]any{
+						"claims": map[string]any{
+							"sub": "user-456",
+						},
+					},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil || response.StatusCode != 302 {
+				t.Fatalf("expected 302, got %d, %v", response.StatusCode, err)
+			}
+			if !strings.HasSuffix(signer.lastURL, "/blobs/user-456/blob-123"+tt.want) {
+				t.Errorf("unexpected signed URL %q", signer.lastURL)
+			}
+		})
+	}
+}
+
+func TestDownload_UnnamedBlob_NoContentDisposition(t *testing.T) {
+	blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 1024, S3Key: "user-456/blob-123"}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{"accountId": "user-456", "blobId": "blob-123"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "req-abc",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-456"}},
+		},
+	}
+
+	if _, err := handler(context.Background(), request); err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if strings.Contains(signer.lastURL, "?") {
+		t.Errorf("expected no query on the signed URL, got %q", signer.lastURL)
+	}
+}
+
+func TestDownload_RegionalDomain(t *testing.T) {
+	regions, err := downloadregion.Parse(`{"domains": {"eu-west-1": "eu.cdn.example.com"}, "countries": {"DE": "eu-west-1"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tests := []struct {
+		name       string
+		headers    map[string]string
+		wantURL    string
+		wantRegion string
+	}{
+		{"viewer country", map[string]string{"CloudFront-Viewer-Country": "DE"}, "https://eu.cdn.example.com/blobs/user-456/blob-123", "eu-west-1"},
+		{"region hint", map[string]string{"X-Blob-Region": "eu-west-1"}, "https://eu.cdn.example.com/blobs/user-456/blob-123", "eu-west-1"},
+		{"primary", map[string]string{"CloudFront-Viewer-Country": "US"}, "https://cdn.example.com/blobs/user-456/blob-123", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 1024, S3Key: "user-456/blob-123"}
+			signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+			setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+			deps.Config.Regions = regions
+
+			request := events.APIGatewayProxyRequest{
+				Headers:        tt.headers,
+				PathParameters: map[string]string{"accountId": "user-456", "blobId": "blob-123"},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID:  "req-abc",
+					Authorizer: map[string]any{"claims": map[string]any{"sub": "user-456"}},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil || response.StatusCode != 302 {
+				t.Fatalf("expected 302, got %d, %v", response.StatusCode, err)
+			}
+			if signer.lastURL != tt.wantURL {
+				t.Errorf("expected %q signed, got %q", tt.wantURL, signer.lastURL)
+			}
+			if response.Headers["X-Blob-Region"] != tt.wantRegion {
+				t.Errorf("expected region %q, got %q", tt.wantRegion, response.Headers["X-Blob-Region"])
+			}
+		})
+	}
+}
+
+func TestDownload_FailoverDomain(t *testing.T) {
+	regions, err := downloadregion.Parse(`{"domains": {"eu-west-1": "eu.cdn.example.com"}, "countries": {"DE": "eu-west-1"}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 1024, S3Key: "user-456/blob-123"}
+	signer := &mockURLSigner{signedURL: "https://cdn.example.com/signed"}
+	setupTestDeps(&mockBlobDB{blob: blob}, signer, &mockSecretsReader{})
+	deps.Config.Regions = regions
+	deps.Config.FailoverDomain = "dr.cdn.example.com"
+	deps.Config.FailoverRegion = "us-west-2"
+
+	request := events.APIGatewayProxyRequest{
+		Headers:        map[string]string{"CloudFront-Viewer-Country": "DE"},
+		PathParameters: map[string]string{"accountId": "user-456", "blobId": "blob-123"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "req-abc",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-456"}},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil || response.StatusCode != 302 {
+		t.Fatalf("expected 302, got %d, %v", response.StatusCode, err)
+	}
+	if signer.lastURL != "https://dr.cdn.example.com/blobs/user-456/blob-123" {
+		t.Errorf("expected the replica domain signed, got %q", signer.lastURL)
+	}
+	if response.Headers["X-Blob-Region"] != "us-west-2" {
+		t.Errorf("expected the replica region, got %q", response.Headers["X-Blob-Region"])
+	}
+}
+
+func TestDownload_FailoverRefusesScanPending(t *testing.T) {
+	tests := []struct {
+		name       string
+		scanStatus string
+		wantStatus int
+	}{
+		{name: "pending", scanStatus: "pending", wantStatus: 403},
+		{name: "clean", scanStatus: "clean", wantStatus: 302},
+		{name: "not scanned", wantStatus: 302},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			blob := &BlobRecord{BlobID: "blob-123", AccountID: "user-456", Size: 1024, S3Key: "user-456/blob-123", ScanStatus: tc.scanStatus}
+			setupTestDeps(&mockBlobDB{blob: blob}, &mockURLSigner{signedURL: "https://dr.cdn.example.com/signed"}, &mockSecretsReader{})
+			deps.Config.FailoverDomain = "dr.cdn.example.com"
+			deps.Config.FailoverRegion = "us-west-2"
+
+			request := events.APIGatewayProxyRequest{
+				PathParameters: map[string]string{"accountId": "user-456", "blobId": "blob-123"},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID:  "req-abc",
+					Authorizer: map[string]any{"claims": map[string]any{"sub": "user-456"}},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil || response.StatusCode != tc.wantStatus {
+				t.Fatalf("expected %d, got %d, %v. Body: %s", tc.wantStatus, response.StatusCode, err, response.Body)
+			}
+			if tc.wantStatus == 403 && !strings.Contains(response.Body, "CORE-3008") {
+				t.Errorf("expected CORE-3008, got %s", response.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmirror"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"github.com/jarrod-lowe/jmap-service-libs/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+var logger = loglevel.New()
+
+// errNotConfirmed is returned for a blob tagged confirmed whose record is
+// still pending. Objects are tagged before their records are confirmed, so
+// the event is failed and S3's retry finds the record confirmed.
+var errNotConfirmed = errors.New("blob record not confirmed yet")
+
+// SourceDB reads blob records from the primary table
+type SourceDB interface {
+	GetBlobItem(ctx context.Context, accountID, blobID string) (blobmirror.Item, error)
+}
+
+// Replica writes blobs and their records to the DR copy
+type Replica interface {
+	CopyObject(ctx context.Context, key string) error
+	PutBlobItem(ctx context.Context, item blobmirror.Item) error
+	DeleteObject(ctx context.Context, key string) error
+	DeleteBlobItem(ctx context.Context, accountID, blobID string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Source  SourceDB
+	Replica Replica
+}
+
+var deps *Dependencies
+
+// handler processes S3 ObjectTagging:Put and ObjectRemoved events for the
+// blob bucket. Any failed record fails the event, and S3 retries it; records
+// already mirrored are copied again, which is harmless and is how blob-delete
+// mirrors a scan verdict, by retagging the object.
+func handler(ctx context.Context, event events.S3Event) error {
+	ctx, span := tracing.StartHandlerSpan(ctx, "BlobMirrorHandler",
+		tracing.Function("blob-mirror"),
+	)
+	defer span.End()
+	span.SetAttributes(attribute.Int("s3.records", len(event.Records)))
+
+	var failed []error
+	for _, record := range event.Records {
+		if err := mirrorRecord(ctx, record); err != nil {
+			failed = append(failed, fmt.Errorf("%s: %w", record.S3.Object.Key, err))
+		}
+	}
+	if len(failed) > 0 {
+		err := errors.Join(failed...)
+		logger.ErrorContext(ctx, "Failed to mirror blobs",
+			slog.Int("failed", len(failed)),
+			slog.Int("records", len(event.Records)),
+		)
+		tracing.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// mirrorRecord mirrors or removes the blob named in a single S3 event record
+func mirrorRecord(ctx context.Context, record events.S3EventRecord) error {
+	key := record.S3.Object.Key
+	ctx, span := tracing.Tracer("blob-mirror").Start(ctx, "MirrorRecord")
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("s3.event", record.EventName),
+		attribute.String("s3.key", key),
+	)
+
+	accountID, blobID, err := parseS3Key(key)
+	if err != nil {
+		logger.ErrorContext(ctx, "Invalid S3 key format",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("invalid S3 key format: %w", err)
+	}
+	span.SetAttributes(tracing.AccountID(accountID), tracing.BlobID(blobID))
+
+	switch {
+	case strings.HasPrefix(record.EventName, "ObjectRemoved:"):
+		return removeBlob(ctx, key, accountID, blobID)
+	case strings.HasPrefix(record.EventName, "ObjectTagging:"):
+		return copyBlob(ctx, key, accountID, blobID)
+	default:
+		logger.WarnContext(ctx, "Ignoring unexpected S3 event",
+			slog.String("event", record.EventName),
+			slog.String("key", key),
+		)
+		return nil
+	}
+}
+
+// copyBlob copies a confirmed blob's object, then its record, to the
+// replica. The object goes first so a replica record always has its object.
+func copyBlob(ctx context.Context, key, accountID, blobID string) error {
+	item, err := deps.Source.GetBlobItem(ctx, accountID, blobID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to read blob record",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if item == nil {
+		logger.InfoContext(ctx, "Blob record not found, skipping",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return nil
+	}
+	if _, deleted := item["deletedAt"]; deleted {
+		logger.InfoContext(ctx, "Blob is deleted, skipping",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return nil
+	}
+	if !blobmirror.Confirmed(item) {
+		logger.WarnContext(ctx, "Blob record not confirmed yet, retrying",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+		)
+		return errNotConfirmed
+	}
+
+	if err := deps.Replica.CopyObject(ctx, key); err != nil {
+		if errors.Is(err, blobmirror.ErrSourceMissing) {
+			logger.InfoContext(ctx, "Blob object deleted before it was mirrored, skipping",
+				slog.String("account_id", accountID),
+				slog.String("blob_id", blobID),
+			)
+			return nil
+		}
+		logger.ErrorContext(ctx, "Failed to copy blob object",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if err := deps.Replica.PutBlobItem(ctx, item); err != nil {
+		logger.ErrorContext(ctx, "Failed to copy blob record",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	logger.InfoContext(ctx, "Blob mirrored",
+		slog.String("account_id", accountID),
+		slog.String("blob_id", blobID),
+	)
+	return nil
+}
+
+// removeBlob deletes a blob's object and record from the replica. blob-cleanup
+// deletes the object before the record, so the record is gone soon after.
+func removeBlob(ctx context.Context, key, accountID, blobID string) error {
+	if err := deps.Replica.DeleteObject(ctx, key); err != nil {
+		logger.ErrorContext(ctx, "Failed to delete mirrored object",
+			slog.String("key", key),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+	if err := deps.Replica.DeleteBlobItem(ctx, accountID, blobID); err != nil {
+		logger.ErrorContext(ctx, "Failed to delete mirrored record",
+			slog.String("account_id", accountID),
+			slog.String("blob_id", blobID),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	logger.InfoContext(ctx, "Mirrored blob removed",
+		slog.String("account_id", accountID),
+		slog.String("blob_id", blobID),
+	)
+	return nil
+}
+
+// parseS3Key extracts accountID and blobID from S3 key (format: {accountId}/{blobId})
+func parseS3Key(key string) (accountID, blobID string, err error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid key format: expected {accountId}/{blobId}")
+	}
+	return parts[0], parts[1], nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobMirror(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// The replica's clients are for its region; copies are pulled from the
+	// source bucket across regions
+	replicaRegion := func(o *s3.Options) { o.Region = cfg.Region }
+	replicaDB := dynamodb.NewFromConfig(result.Config, func(o *dynamodb.Options) { o.Region = cfg.Region })
+
+	deps = &Dependencies{
+		Source: blobmirror.NewSource(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), cfg.Table),
+		Replica: blobmirror.NewReplica(
+			s3.NewFromConfig(result.Config, replicaRegion),
+			store.NewRetryClient(replicaDB),
+			cfg.Bucket, cfg.ReplicaBucket, cfg.ReplicaTable,
+		),
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmirror"
+)
+
+// The blobmirror types satisfy this Lambda's interfaces
+var (
+	_ SourceDB = (*blobmirror.Source)(nil)
+	_ Replica  = (*blobmirror.Replica)(nil)
+)
+
+// MockSource implements SourceDB for testing
+type MockSource struct {
+	Item blobmirror.Item
+	Err  error
+}
+
+func (m *MockSource) GetBlobItem(ctx context.Context, accountID, blobID string) (blobmirror.Item, error) {
+	return m.Item, m.Err
+}
+
+// MockReplica implements Replica for testing, recording the calls in order
+type MockReplica struct {
+	Calls   []string
+	Item    blobmirror.Item
+	CopyErr error
+	PutErr  error
+}
+
+func (m *MockReplica) CopyObject(ctx context.Context, key string) error {
+	m.Calls = append(m.Calls, "copy "+key)
+	return m.CopyErr
+}
+
+func (m *MockReplica) PutBlobItem(ctx context.Context, item blobmirror.Item) error {
+	m.Calls = append(m.Calls, "put")
+	m.Item = item
+	return m.PutErr
+}
+
+func (m *MockReplica) DeleteObject(ctx context.Context, key string) error {
+	m.Calls = append(m.Calls, "delete "+key)
+	return nil
+}
+
+func (m *MockReplica) DeleteBlobItem(ctx context.Context, accountID, blobID string) error {
+	m.Calls = append(m.Calls, "delete record "+accountID+"/"+blobID)
+	return nil
+}
+
+func s3Event(eventName, key string) events.S3Event {
+	return events.S3Event{Records: []events.S3EventRecord{{
+		EventName: eventName,
+		S3: events.S3Entity{
+			Bucket: events.S3Bucket{Name: "blobs"},
+			Object: events.S3Object{Key: key},
+		},
+	}}}
+}
+
+func blobItem(status string) blobmirror.Item {
+	return blobmirror.Item{
+		"pk":     &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+		"sk":     &types.AttributeValueMemberS{Value: "BLOB#blob-1"},
+		"status": &types.AttributeValueMemberS{Value: status},
+	}
+}
+
+func TestHandler_MirrorsConfirmedBlob(t *testing.T) {
+	replica := &MockReplica{}
+	deps = &Dependencies{Source: &MockSource{Item: blobItem("confirmed")}, Replica: replica}
+
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replica.Calls) != 2 || replica.Calls[0] != "copy user-1/blob-1" || replica.Calls[1] != "put" {
+		t.Fatalf("expected the object then the record to be copied, got %v", replica.Calls)
+	}
+	if replica.Item["sk"] == nil {
+		t.Error("expected the record to be copied as stored")
+	}
+}
+
+func TestHandler_PendingBlobIsRetried(t *testing.T) {
+	replica := &MockReplica{}
+	deps = &Dependencies{Source: &MockSource{Item: blobItem("pending")}, Replica: replica}
+
+	err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1"))
+	if !errors.Is(err, errNotConfirmed) {
+		t.Fatalf("expected the event to fail until the record is confirmed, got %v", err)
+	}
+	if len(replica.Calls) != 0 {
+		t.Errorf("expected nothing copied, got %v", replica.Calls)
+	}
+}
+
+func TestHandler_SkipsMissingAndDeletedBlobs(t *testing.T) {
+	deleted := blobItem("confirmed")
+	deleted["deletedAt"] = &types.AttributeValueMemberS{Value: "2024-01-01T00:00:00Z"}
+
+	for name, item := range map[string]blobmirror.Item{"missing": nil, "deleted": deleted} {
+		replica := &MockReplica{}
+		deps = &Dependencies{Source: &MockSource{Item: item}, Replica: replica}
+
+		if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+		}
+		if len(replica.Calls) != 0 {
+			t.Errorf("%s: expected nothing copied, got %v", name, replica.Calls)
+		}
+	}
+}
+
+func TestHandler_SourceObjectGone(t *testing.T) {
+	replica := &MockReplica{CopyErr: blobmirror.ErrSourceMissing}
+	deps = &Dependencies{Source: &MockSource{Item: blobItem("confirmed")}, Replica: replica}
+
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err != nil {
+		t.Fatalf("expected a deleted object to be skipped, got %v", err)
+	}
+	if len(replica.Calls) != 1 {
+		t.Errorf("expected no record copied without its object, got %v", replica.Calls)
+	}
+}
+
+func TestHandler_Failures(t *testing.T) {
+	deps = &Dependencies{Source: &MockSource{Err: errors.New("throttled")}, Replica: &MockReplica{}}
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err == nil {
+		t.Error("expected an error when the record cannot be read")
+	}
+
+	replica := &MockReplica{CopyErr: errors.New("slow down")}
+	deps = &Dependencies{Source: &MockSource{Item: blobItem("confirmed")}, Replica: replica}
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err == nil {
+		t.Error("expected an error when the copy fails")
+	}
+	if len(replica.Calls) != 1 {
+		t.Errorf("expected no record copied after a failed copy, got %v", replica.Calls)
+	}
+
+	deps.Replica = &MockReplica{PutErr: errors.New("throttled")}
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err == nil {
+		t.Error("expected an error when the record cannot be written")
+	}
+
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "no-slash")); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+}
+
+func TestHandler_RemovesDeletedBlob(t *testing.T) {
+	replica := &MockReplica{}
+	deps = &Dependencies{Source: &MockSource{}, Replica: replica}
+
+	if err := handler(context.Background(), s3Event("ObjectRemoved:Delete", "user-1/blob-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replica.Calls) != 2 || replica.Calls[0] != "delete user-1/blob-1" || replica.Calls[1] != "delete record user-1/blob-1" {
+		t.Errorf("expected the object then the record to be deleted, got %v", replica.Calls)
+	}
+}
+
+func TestHandler_IgnoresOtherEvents(t *testing.T) {
+	replica := &MockReplica{}
+	deps = &Dependencies{Source: &MockSource{}, Replica: replica}
+
+	if err := handler(context.Background(), s3Event("ObjectCreated:Put", "user-1/blob-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replica.Calls) != 0 {
+		t.Errorf("expected nothing mirrored, got %v", replica.Calls)
+	}
+}
+
+// Test: blob-delete retags a scanned blob's object after recording its
+// verdict, and the tagging event copies the record, verdict and all, over the
+// one copied at confirmation
+func TestHandler_ScanVerdictReachesReplica(t *testing.T) {
+	replica := &MockReplica{}
+	pending := blobItem("confirmed")
+	pending["scanStatus"] = &types.AttributeValueMemberS{Value: "pending"}
+	deps = &Dependencies{Source: &MockSource{Item: pending}, Replica: replica}
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	clean := blobItem("confirmed")
+	clean["scanStatus"] = &types.AttributeValueMemberS{Value: "clean"}
+	deps.Source = &MockSource{Item: clean}
+	if err := handler(context.Background(), s3Event("ObjectTagging:Put", "user-1/blob-1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	status, _ := replica.Item["scanStatus"].(*types.AttributeValueMemberS)
+	if status == nil || status.Value != "clean" {
+		t.Errorf("expected the replica record to hold the clean verdict, got %v", replica.Item["scanStatus"])
+	}
+}
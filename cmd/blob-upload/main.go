@@ -1,10 +1,10 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
@@ -12,56 +12,65 @@ import (
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobname"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobtag"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // BlobStorage handles S3 operations
 type BlobStorage interface {
 	Upload(ctx context.Context, req UploadRequest) error
-	ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string) error
+	ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string, extra map[string]string) error
 }
 
-// BlobDB handles DynamoDB operations
+// BlobDB handles DynamoDB operations. An upload reserves its size from the
+// account's quota before it is stored, then is confirmed, or released if it
+// could not be stored.
 type BlobDB interface {
-	CreateBlobRecord(ctx context.Context, record BlobRecord) error
+	ReserveBlob(ctx context.Context, record BlobRecord, expiresAt time.Time) error
+	ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error
+	CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error
 }
 
+// reservationTTL is how long an upload's quota reservation is held before
+// blob-alloc-cleanup may reclaim it, long enough for any invocation to finish
+const reservationTTL = 15 * time.Minute
+
 // UUIDGenerator generates unique IDs
 type UUIDGenerator interface {
 	Generate() string
 }
 
 // UploadRequest represents an S3 upload request
-type UploadRequest struct {
-	Key         string
-	Body        []byte
-	ContentType string
-	AccountID   string
-	ParentTag   string // Optional X-Parent header value
-}
+type UploadRequest = blobmeta.UploadRequest
 
 // BlobRecord represents a blob record in DynamoDB
-type BlobRecord struct {
-	BlobID      string
-	AccountID   string
-	Size        int64
-	ContentType string
-	S3Key       string
-	CreatedAt   string
-	Parent      string // Optional parent tag from X-Parent header
-}
+type BlobRecord = blobmeta.Record
 
 // BlobUploadResponse is the RFC 8620 blob upload response
 type BlobUploadResponse struct {
@@ -69,12 +78,7 @@ type BlobUploadResponse struct {
 	BlobID    string `json:"blobId"`
 	Type      string `json:"type"`
 	Size      int64  `json:"size"`
-}
-
-// ErrorResponse is the error response format
-type ErrorResponse struct {
-	Type        string `json:"type"`
-	Description string `json:"description,omitempty"`
+	Name      string `json:"name,omitempty"`
 }
 
 // Response is the API Gateway proxy response
@@ -89,18 +93,88 @@ type PrincipalChecker interface {
 	IsAllowedPrincipal(callerARN string) bool
 }
 
+// CapabilityLimits reports the upload size limit a capability declares
+type CapabilityLimits interface {
+	MaxSizeUpload(capability string) (int64, bool)
+}
+
+// AccountReader reads account META# records
+type AccountReader interface {
+	GetMeta(ctx context.Context, accountID string) (*account.Meta, error)
+}
+
+// ActivityRecorder records that an account is in use, for the
+// account-reaper
+type ActivityRecorder interface {
+	RecordActivity(ctx context.Context, accountID string, now time.Time) error
+}
+
+// AliasResolver resolves account aliases to account IDs
+type AliasResolver interface {
+	ResolveAlias(ctx context.Context, alias string) (string, error)
+}
+
+// PrincipalBindings restricts IAM principals to the accounts they are bound to
+type PrincipalBindings interface {
+	IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error)
+}
+
+// RateLimiter takes a token from each key's bucket, using the tier's limit
+// for account keys
+type RateLimiter interface {
+	AllowTier(ctx context.Context, tier string, keys ...string) (ratelimit.Decision, error)
+}
+
+// DelegationVerifier verifies the delegation tokens plugins present when
+// calling back into core
+type DelegationVerifier interface {
+	Verify(token string) (*delegation.Claims, error)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
-	Storage  BlobStorage
-	DB       BlobDB
-	UUIDGen  UUIDGenerator
-	Registry PrincipalChecker
+	Storage     BlobStorage
+	DB          BlobDB
+	UUIDGen     UUIDGenerator
+	Registry    PrincipalChecker
+	Accounts    AccountReader
+	Aliases     AliasResolver
+	Activity    ActivityRecorder
+	RateLimiter RateLimiter
+	Bindings    PrincipalBindings
+	Delegation  DelegationVerifier
+	Features    account.FeatureFlags
+	CORS        *cors.Policy
+	// MaxSizeUpload is the largest body accepted, advertised in the session
+	// as maxSizeUpload; 0 for no limit
+	MaxSizeUpload int64
+	// TagKeys are the extra S3 tag keys clients may set with X-Tag-{Key}
+	// headers; none when empty
+	TagKeys blobtag.Keys
+	// Capabilities limits uploads naming a capability in X-Capability to
+	// its maxSizeUpload; nil ignores the header
+	Capabilities CapabilityLimits
+	// AccountIDClaim names the authorizer claim holding a user's account ID
+	AccountIDClaim string
 }
 
 var deps *Dependencies
 
+// corsHandler answers CORS preflights, gives each request a correlation ID,
+// and adds CORS headers and the correlation ID to the handler's responses
+func corsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	if cors.IsPreflight(request.HTTPMethod) {
+		return Response{StatusCode: 204, Headers: deps.CORS.Preflight(request.Headers)}, nil
+	}
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(deps.CORS.Apply(request.Headers, resp.Headers), correlationID)
+	return resp, err
+}
+
 // handler processes blob upload requests
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
 	ctx, span := tracing.StartHandlerSpan(ctx, "BlobUploadHandler",
 		tracing.Function("blob-upload"),
 		tracing.RequestID(request.RequestContext.RequestID),
@@ -108,25 +182,128 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	defer span.End()
 
 	// Extract accountId
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, deps.AccountIDClaim)
 	if err != nil {
 		logger.WarnContext(ctx, "Failed to extract account ID",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(401, "unauthorized", "Missing or invalid authentication")
+		return errorResponse(ctx, 401, "unauthorized", "Missing or invalid authentication")
 	}
+
+	// Resolve an alias in the path to the account it belongs to
+	resolvedID, err := resolveAccountID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			logger.WarnContext(ctx, "Unknown account alias",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("alias", accountID),
+			)
+			return errorResponse(ctx, 404, "notFound", "Account not found")
+		}
+		logger.ErrorContext(ctx, "Failed to resolve account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to resolve account")
+	}
+	accountID = resolvedID
 	span.SetAttributes(tracing.AccountID(accountID))
 
+	// API keys may only upload to the account they were created for
+	if keyAccountID, keyID, ok := auth.APIKeyFromAuthorizer(request.RequestContext.Authorizer); ok && keyAccountID != accountID {
+		logger.WarnContext(ctx, "API key used for another account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("api_key_id", keyID),
+		)
+		return errorResponse(ctx, 403, "forbidden", "Account ID mismatch")
+	}
+
 	// Check principal authorization for IAM-authenticated requests
+	rateLimitKeys := []string{ratelimit.AccountKey(accountID)}
 	if isIAMAuthenticatedRequest(request) {
 		callerPrincipal := extractCallerPrincipal(request)
-		if !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
+		// A delegation token stands in for registry trust, for its account and
+		// plugin only; principal bindings still apply
+		delegated := delegation.IsDelegated(ctx, deps.Delegation, request, accountID)
+		if !delegated && !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
 			logger.WarnContext(ctx, "Unauthorized IAM principal",
 				slog.String("request_id", request.RequestContext.RequestID),
 				slog.String("caller_principal", callerPrincipal),
 			)
-			return errorResponse(403, "forbidden", "Principal not authorized for IAM access")
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for IAM access")
+		}
+		allowed, err := deps.Bindings.IsAllowed(ctx, callerPrincipal, accountID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check principal bindings",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to check principal bindings")
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "IAM principal not bound to account",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("caller_principal", callerPrincipal),
+			)
+			return errorResponse(ctx, 403, "forbidden", "Principal not authorized for this account")
+		}
+		rateLimitKeys = append(rateLimitKeys, ratelimit.PrincipalKey(callerPrincipal))
+	}
+
+	// Reject uploads for suspended accounts and those with writes disabled
+	meta, err := deps.Accounts.GetMeta(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get account meta",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to retrieve account")
+	}
+	if meta != nil && meta.Suspended {
+		logger.WarnContext(ctx, "Upload for suspended account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+		)
+		return codedErrorResponse(ctx, 403, "forbidden", errcode.AccountSuspended, "Account is suspended")
+	}
+	if meta != nil && meta.WritesDisabled {
+		logger.WarnContext(ctx, "Upload for account with writes disabled",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+		)
+		return errorResponse(ctx, 403, "accountReadOnly", "Account is read-only")
+	}
+	recordActivity(ctx, accountID, meta)
+
+	// Enforce per-account and per-principal request rates, with the
+	// account's tier choosing its limit
+	if deps.RateLimiter != nil {
+		var tier string
+		if meta != nil {
+			tier = meta.Tier
+		}
+		decision, err := deps.RateLimiter.AllowTier(ctx, tier, rateLimitKeys...)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check rate limit",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(ctx, 500, "serverFail", "Failed to check rate limit")
+		}
+		if !decision.Allowed {
+			logger.WarnContext(ctx, "Upload rate limited",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("rate_limit_key", decision.Key),
+			)
+			response, err := errorResponse(ctx, 429, "rateLimited", "Too many requests")
+			response.Headers["Retry-After"] = decision.RetryAfterSeconds()
+			return response, err
 		}
 	}
 
@@ -136,7 +313,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		logger.WarnContext(ctx, "Missing Content-Type header",
 			slog.String("request_id", request.RequestContext.RequestID),
 		)
-		return errorResponse(400, "invalidArguments", "Content-Type header is required")
+		return errorResponse(ctx, 400, "invalidArguments", "Content-Type header is required")
 	}
 
 	// Validate X-Parent header if present
@@ -146,7 +323,40 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("parent_tag", parentTag),
 		)
-		return errorResponse(400, "invalidArguments", "X-Parent header contains invalid characters or exceeds 128 characters")
+		return errorResponse(ctx, 400, "invalidArguments", "X-Parent header contains invalid characters or exceeds 128 characters")
+	}
+
+	// Read the original filename, if the client sent one
+	name, err := blobname.FromHeaders(request.Headers)
+	if err != nil {
+		logger.WarnContext(ctx, "Invalid filename header",
+			slog.String("request_id", request.RequestContext.RequestID),
+		)
+		return errorResponse(ctx, 400, "invalidArguments", "Content-Disposition or X-Filename header holds an invalid filename")
+	}
+
+	// Read any approved extra tags
+	tags, err := deps.TagKeys.FromHeaders(request.Headers)
+	if err != nil {
+		logger.WarnContext(ctx, "Invalid tag header",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 400, "invalidArguments", err.Error())
+	}
+
+	// Look up the size limit of the capability the blob is for, if named
+	var capabilityMax int64
+	if capability := getCapabilityHeader(request.Headers); capability != "" && deps.Capabilities != nil {
+		limit, ok := deps.Capabilities.MaxSizeUpload(capability)
+		if !ok {
+			logger.WarnContext(ctx, "Upload names an unknown capability",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("capability", capability),
+			)
+			return errorResponse(ctx, 400, "invalidArguments", "X-Capability header names an unknown capability")
+		}
+		capabilityMax = limit
 	}
 
 	// Decode body
@@ -156,7 +366,44 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(400, "invalidArguments", "Invalid request body")
+		return errorResponse(ctx, 400, "invalidArguments", "Invalid request body")
+	}
+
+	// Enforce the advertised upload size limit
+	if maxSize := deps.MaxSizeUpload; maxSize > 0 && int64(len(body)) > maxSize {
+		logger.WarnContext(ctx, "Upload exceeds maxSizeUpload",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.Int("size", len(body)),
+			slog.Int64("max_size", maxSize),
+		)
+		return tooLargeResponse(ctx, "maxSizeUpload", maxSize)
+	}
+
+	// Enforce the account type's blob size limit
+	var accountType string
+	if meta != nil {
+		accountType = meta.AccountType
+	}
+	if maxSize := deps.Features.For(accountType).MaxBlobSize; maxSize > 0 && int64(len(body)) > maxSize {
+		logger.WarnContext(ctx, "Upload exceeds account type blob size limit",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.Int("size", len(body)),
+			slog.Int64("max_size", maxSize),
+		)
+		return tooLargeResponse(ctx, "maxBlobSize", maxSize)
+	}
+
+	// Enforce the named capability's limit
+	if capabilityMax > 0 && int64(len(body)) > capabilityMax {
+		logger.WarnContext(ctx, "Upload exceeds capability maxSizeUpload",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.Int("size", len(body)),
+			slog.Int64("max_size", capabilityMax),
+		)
+		return tooLargeResponse(ctx, "maxSizeUpload", capabilityMax)
 	}
 
 	// Generate blobId
@@ -164,48 +411,88 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	span.SetAttributes(tracing.BlobID(blobID))
 	s3Key := fmt.Sprintf("%s/%s", accountID, blobID)
 
-	// Upload to S3 with pending status
+	// Reserve quota for the blob. The record stays pending until the upload
+	// is confirmed; direct uploads are not counted as pending allocations, so
+	// it is confirmed and released as an IAM allocation is.
+	size := int64(len(body))
+	record := BlobRecord{
+		BlobID:      blobID,
+		AccountID:   accountID,
+		Size:        size,
+		ContentType: contentType,
+		S3Key:       s3Key,
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+		Parent:      parentTag,
+		Name:        name,
+		Tags:        tags,
+	}
+	if err := deps.DB.ReserveBlob(ctx, record, time.Now().Add(reservationTTL)); err != nil {
+		switch {
+		case errors.Is(err, store.ErrOverQuota):
+			logger.WarnContext(ctx, "Upload exceeds remaining quota",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.Int64("size", size),
+			)
+			return errorResponse(ctx, 403, "overQuota", "Insufficient quota remaining for this blob")
+		case errors.Is(err, store.ErrAccountNotProvisioned):
+			logger.WarnContext(ctx, "Upload for account that is not provisioned",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+			)
+			return errorResponse(ctx, 403, "accountNotProvisioned", "Account is not provisioned")
+		}
+		logger.ErrorContext(ctx, "Failed to reserve quota",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(ctx, 500, "serverFail", "Failed to record blob metadata")
+	}
+
+	// Upload to S3 with pending status, releasing the reservation on failure
 	uploadReq := UploadRequest{
 		Key:         s3Key,
 		Body:        body,
 		ContentType: contentType,
 		AccountID:   accountID,
 		ParentTag:   parentTag,
+		Tags:        tags,
 	}
 	if err := deps.Storage.Upload(ctx, uploadReq); err != nil {
 		logger.ErrorContext(ctx, "Failed to upload to S3",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to store blob")
+		if err := deps.DB.CleanupAllocation(ctx, accountID, blobID, size, true); err != nil {
+			// blob-alloc-cleanup releases it once the reservation expires
+			logger.ErrorContext(ctx, "Failed to release quota reservation",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("blob_id", blobID),
+				slog.String("error", err.Error()),
+			)
+		}
+		return errorResponse(ctx, 500, "serverFail", "Failed to store blob")
 	}
 
-	// Create DynamoDB record
-	record := BlobRecord{
-		BlobID:      blobID,
-		AccountID:   accountID,
-		Size:        int64(len(body)),
-		ContentType: contentType,
-		S3Key:       s3Key,
-		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
-		Parent:      parentTag,
-	}
-	if err := deps.DB.CreateBlobRecord(ctx, record); err != nil {
-		logger.ErrorContext(ctx, "Failed to create DynamoDB record",
+	// Confirm upload (update S3 tag to confirmed)
+	if err := deps.Storage.ConfirmUpload(ctx, accountID, blobID, parentTag, tags); err != nil {
+		logger.ErrorContext(ctx, "Failed to confirm upload",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to record blob metadata")
+		// Note: We don't return error here - the blob is uploaded and recorded
+		// The lifecycle policy will handle cleanup if needed
 	}
 
-	// Confirm upload (update S3 tag to confirmed)
-	if err := deps.Storage.ConfirmUpload(ctx, accountID, blobID, parentTag); err != nil {
-		logger.ErrorContext(ctx, "Failed to confirm upload",
+	// Confirm the reservation. If this fails, blob-confirm confirms it from
+	// the S3 event, or blob-alloc-cleanup reclaims it once it expires.
+	if err := deps.DB.ConfirmBlob(ctx, accountID, blobID, size, false, true); err != nil {
+		logger.ErrorContext(ctx, "Failed to confirm blob record",
 			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("blob_id", blobID),
 			slog.String("error", err.Error()),
 		)
-		// Note: We don't return error here - the blob is uploaded and recorded
-		// The lifecycle policy will handle cleanup if needed
+		return errorResponse(ctx, 500, "serverFail", "Failed to record blob metadata")
 	}
 
 	// Build success response
@@ -214,6 +501,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		BlobID:    blobID,
 		Type:      contentType,
 		Size:      int64(len(body)),
+		Name:      name,
 	}
 
 	responseBody, err := json.Marshal(response)
@@ -222,7 +510,7 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return errorResponse(500, "serverFail", "Failed to build response")
+		return errorResponse(ctx, 500, "serverFail", "Failed to build response")
 	}
 
 	logger.InfoContext(ctx, "Blob upload completed",
@@ -240,29 +528,43 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 }
 
 // extractAccountID extracts account ID from path parameter or JWT claims
-func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
+func extractAccountID(request events.APIGatewayProxyRequest, claim string) (string, error) {
 	// Check path parameter first (IAM auth)
 	if accountID, ok := request.PathParameters["accountId"]; ok && accountID != "" {
 		return accountID, nil
 	}
 
-	// Fall back to Cognito JWT claims
+	// Fall back to the user authorizer's claims
 	authorizer := request.RequestContext.Authorizer
 	if authorizer == nil {
 		return "", fmt.Errorf("no authorizer context")
 	}
 
-	claims, ok := authorizer["claims"].(map[string]any)
-	if !ok {
-		return "", fmt.Errorf("no claims in authorizer")
-	}
+	return auth.AccountIDFromAuthorizer(authorizer, claim)
+}
 
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("sub claim not found or empty")
+// recordActivity updates the account's lastActivityAt when it is due. A
+// failure is logged rather than failing the request.
+func recordActivity(ctx context.Context, accountID string, meta *account.Meta) {
+	now := time.Now()
+	if deps.Activity == nil || !account.ActivityDue(meta, now) {
+		return
 	}
+	if err := deps.Activity.RecordActivity(ctx, accountID, now); err != nil {
+		logger.WarnContext(ctx, "Failed to record account activity",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
 
-	return sub, nil
+// resolveAccountID maps an account alias to its account ID. Identifiers that
+// are not aliases are returned unchanged.
+func resolveAccountID(ctx context.Context, id string) (string, error) {
+	if deps.Aliases == nil || !account.IsAlias(id) {
+		return id, nil
+	}
+	return deps.Aliases.ResolveAlias(ctx, id)
 }
 
 // isValidParentTag validates the X-Parent header value against AWS tag rules
@@ -308,6 +610,17 @@ func getParentHeader(headers map[string]string) string {
 	return ""
 }
 
+// getCapabilityHeader extracts the X-Capability header value, naming the
+// capability a blob is uploaded for (case-insensitive)
+func getCapabilityHeader(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, "X-Capability") {
+			return v
+		}
+	}
+	return ""
+}
+
 // getContentType extracts Content-Type from headers (case-insensitive)
 func getContentType(headers map[string]string) string {
 	for k, v := range headers {
@@ -337,106 +650,29 @@ func decodeBody(request events.APIGatewayProxyRequest) ([]byte, error) {
 	return []byte(request.Body), nil
 }
 
-// errorResponse builds an error response
-func errorResponse(statusCode int, errorType, description string) (Response, error) {
-	body, _ := json.Marshal(ErrorResponse{Type: errorType, Description: description})
-	return Response{
-		StatusCode: statusCode,
-		Headers:    map[string]string{"Content-Type": "application/json"},
-		Body:       string(body),
-	}, nil
-}
-
-// S3BlobStorage implements BlobStorage using AWS S3
-type S3BlobStorage struct {
-	client     *s3.Client
-	bucketName string
+// errorResponse builds a problem response with the error type's code
+func errorResponse(ctx context.Context, statusCode int, errorType, description string) (Response, error) {
+	return problemResponse(ctx, problem.New(statusCode, errorType, description))
 }
 
-// NewS3BlobStorage creates a new S3BlobStorage
-func NewS3BlobStorage(client *s3.Client, bucketName string) *S3BlobStorage {
-	return &S3BlobStorage{
-		client:     client,
-		bucketName: bucketName,
-	}
-}
-
-// Upload uploads a blob to S3 with pending status tag
-func (s *S3BlobStorage) Upload(ctx context.Context, req UploadRequest) error {
-	tagging := fmt.Sprintf("Account=%s&Status=pending", req.AccountID)
-	if req.ParentTag != "" {
-		tagging += fmt.Sprintf("&Parent=%s", req.ParentTag)
-	}
-	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucketName),
-		Key:         aws.String(req.Key),
-		Body:        bytes.NewReader(req.Body),
-		ContentType: aws.String(req.ContentType),
-		Tagging:     aws.String(tagging),
-	})
-	return err
+// codedErrorResponse builds a problem response with a specific code
+func codedErrorResponse(ctx context.Context, statusCode int, errorType string, code errcode.Code, description string) (Response, error) {
+	return problemResponse(ctx, problem.New(statusCode, errorType, description).WithCode(code))
 }
 
-// ConfirmUpload updates the S3 object tag to confirmed
-func (s *S3BlobStorage) ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string) error {
-	key := fmt.Sprintf("%s/%s", accountID, blobID)
-	tagSet := []types.Tag{
-		{Key: aws.String("Account"), Value: aws.String(accountID)},
-		{Key: aws.String("Status"), Value: aws.String("confirmed")},
-	}
-	if parentTag != "" {
-		tagSet = append(tagSet, types.Tag{Key: aws.String("Parent"), Value: aws.String(parentTag)})
-	}
-	_, err := s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
-		Bucket: aws.String(s.bucketName),
-		Key:    aws.String(key),
-		Tagging: &types.Tagging{
-			TagSet: tagSet,
-		},
-	})
-	return err
-}
-
-// DynamoDBBlobDB implements BlobDB using AWS DynamoDB
-type DynamoDBBlobDB struct {
-	client    *dynamodb.Client
-	tableName string
-}
-
-// NewDynamoDBBlobDB creates a new DynamoDBBlobDB
-func NewDynamoDBBlobDB(client *dynamodb.Client, tableName string) *DynamoDBBlobDB {
-	return &DynamoDBBlobDB{
-		client:    client,
-		tableName: tableName,
-	}
+// problemResponse builds a response carrying a problem
+func problemResponse(ctx context.Context, p *problem.Problem) (Response, error) {
+	return Response{
+		StatusCode: p.Status,
+		Headers:    problem.Headers(),
+		Body:       p.Body(ctx),
+	}, nil
 }
 
-// CreateBlobRecord creates a blob record in DynamoDB
-func (d *DynamoDBBlobDB) CreateBlobRecord(ctx context.Context, record BlobRecord) error {
-	item := map[string]any{
-		"pk":          fmt.Sprintf("ACCOUNT#%s", record.AccountID),
-		"sk":          fmt.Sprintf("BLOB#%s", record.BlobID),
-		"blobId":      record.BlobID,
-		"accountId":   record.AccountID,
-		"size":        record.Size,
-		"contentType": record.ContentType,
-		"s3Key":       record.S3Key,
-		"createdAt":   record.CreatedAt,
-	}
-	if record.Parent != "" {
-		item["parent"] = record.Parent
-	}
-
-	av, err := attributevalue.MarshalMap(item)
-	if err != nil {
-		return err
-	}
-
-	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
-		TableName: aws.String(d.tableName),
-		Item:      av,
-	})
-	return err
+// tooLargeResponse builds a 413 response naming the size limit exceeded and
+// its value in bytes
+func tooLargeResponse(ctx context.Context, limit string, maxSize int64) (Response, error) {
+	return problemResponse(ctx, problem.New(413, "tooLarge", fmt.Sprintf("Blob exceeds maximum size of %d bytes", maxSize)).WithLimit(limit, maxSize))
 }
 
 // RealUUIDGenerator generates real UUIDs
@@ -459,40 +695,121 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Get required environment variables
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	bucketName := os.Getenv("BLOB_BUCKET")
-	if bucketName == "" {
-		logger.Error("FATAL: BLOB_BUCKET environment variable is required")
-		panic("BLOB_BUCKET environment variable is required")
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadBlobUpload(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	tableName := cfg.Table
 
-	s3Client := s3.NewFromConfig(result.Config)
-	dynamoClient := dynamodb.NewFromConfig(result.Config)
+	storage, err := blobstore.Open(result.Config, cfg.Storage)
+	if err != nil {
+		logger.Error("FATAL: Failed to open blob storage",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 
 	// Initialize database client for plugin registry
 	dbClient := db.NewClientFromConfig(result.Config, tableName)
 
-	// Load plugin registry for IAM principal authorization
-	registry := plugin.NewRegistry()
-	if err := registry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
+	// Load plugin registry for IAM principal authorization, from this environment's snapshot when
+	// there is one, refreshing it from DynamoDB in the background
+	registry, err := plugin.LoadWithSnapshot(result.Ctx, dbClient, plugin.SnapshotPath(tableName), func(err error) {
+		logger.Warn("Plugin registry snapshot failed",
+			slog.String("error", err.Error()),
+		)
+	})
+	if err != nil {
 		logger.Error("FATAL: Failed to load plugin registry",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
 
+	// Initialize rate limiter; a rate of zero disables limiting, except for
+	// tiers with their own limit
+	var rateLimiter RateLimiter
+	if cfg.RateLimit.Active() {
+		rateLimiter = ratelimit.NewLimiter(dynamoClient, tableName, cfg.RateLimit.Limit).WithTierLimits(cfg.RateLimit.Tiers)
+	}
+
+	// Load the key that verifies plugin delegation tokens
+	delegationKey, err := delegation.LoadKey(result.Ctx, secretsmanager.NewFromConfig(result.Config), cfg.DelegationSecretARN)
+	if err != nil {
+		logger.Error("FATAL: Failed to load delegation key",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional envelope encryption of blob record metadata
+	metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
+
+	// Optionally request a content scan of each blob as it is confirmed
+	blobStore := store.NewBlobStore(dynamoClient, tableName).WithEncryption(metadataEnvelope)
+	if cfg.ScanBlobs {
+		blobStore = blobStore.WithScanRequests()
+	}
+
+	accounts := account.NewDynamoDBStore(dynamoClient, tableName)
+
 	deps = &Dependencies{
-		Storage:  NewS3BlobStorage(s3Client, bucketName),
-		DB:       NewDynamoDBBlobDB(dynamoClient, tableName),
-		UUIDGen:  &RealUUIDGenerator{},
-		Registry: registry,
+		Storage:        storage,
+		DB:             blobStore,
+		UUIDGen:        &RealUUIDGenerator{},
+		Registry:       registry,
+		Accounts:       accounts,
+		Aliases:        accounts,
+		Activity:       accounts,
+		RateLimiter:    rateLimiter,
+		Bindings:       binding.NewDynamoDBStore(dynamoClient, tableName),
+		Delegation:     delegation.NewSigner(delegationKey, delegation.DefaultTTL),
+		Features:       cfg.Features,
+		CORS:           cors.New(cfg.CORSOrigins, "POST"),
+		MaxSizeUpload:  cfg.MaxSizeUpload,
+		TagKeys:        cfg.TagKeys,
+		Capabilities:   registry,
+		AccountIDClaim: cfg.AccountIDClaim,
+	}
+
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, corsHandler, "POST /upload/{accountId}", "OPTIONS /upload/{accountId}", "POST /upload-iam/{accountId}")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	result.Start(handler)
+	result.Start(corsHandler)
 }
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// pingRequest calls Core/ping, invoking the Core/echo plugin so the whole
+// request path is exercised
+const pingRequest = `{"using":["urn:ietf:params:jmap:core"],"methodCalls":[["Core/ping",{"invoke":true},"c0"]]}`
+
+// timingMetrics maps Core/ping timings to the metrics they are published as
+var timingMetrics = map[string]string{
+	"registryLookupMs": "CanaryRegistryLookupLatency",
+	"dynamodbReadMs":   "CanaryDynamoDBReadLatency",
+	"pluginInvokeMs":   "CanaryPluginInvokeLatency",
+}
+
+// HTTPDoer sends HTTP requests
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// RequestSigner signs requests to the IAM-authenticated API
+type RequestSigner interface {
+	Sign(ctx context.Context, req *http.Request, body []byte) error
+}
+
+// MetricsPublisher publishes metrics to CloudWatch
+type MetricsPublisher interface {
+	PublishMetrics(ctx context.Context, values map[string]float64) error
+}
+
+// Config holds application configuration
+type Config struct {
+	APIURL    string
+	AccountID string
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	HTTPClient       HTTPDoer
+	Signer           RequestSigner
+	MetricsPublisher MetricsPublisher
+	Config           Config
+}
+
+var deps *Dependencies
+
+// pingResponse is the part of the JMAP response the canary reads
+type pingResponse struct {
+	MethodResponses [][]json.RawMessage `json:"methodResponses"`
+}
+
+// pingResult is the Core/ping response arguments
+type pingResult struct {
+	Timings map[string]float64 `json:"timings"`
+	TotalMs float64            `json:"totalMs"`
+}
+
+// runCanary calls Core/ping end to end and publishes CanarySuccess (1 or 0),
+// CanaryLatency and the timing breakdown. A failed ping is recorded rather
+// than returned, so EventBridge doesn't retry it.
+func runCanary(ctx context.Context) error {
+	start := time.Now()
+	result, err := ping(ctx)
+	latency := time.Since(start)
+
+	values := map[string]float64{"CanarySuccess": 1}
+	if err != nil {
+		logger.ErrorContext(ctx, "Canary ping failed",
+			slog.String("account_id", deps.Config.AccountID),
+			slog.String("error", err.Error()),
+		)
+		values["CanarySuccess"] = 0
+	} else {
+		values["CanaryLatency"] = float64(latency.Milliseconds())
+		for timing, metric := range timingMetrics {
+			if value, ok := result.Timings[timing]; ok {
+				values[metric] = value
+			}
+		}
+		logger.InfoContext(ctx, "Canary ping succeeded",
+			slog.String("account_id", deps.Config.AccountID),
+			slog.Int64("latency_ms", latency.Milliseconds()),
+			slog.Float64("server_ms", result.TotalMs),
+		)
+	}
+
+	if err := deps.MetricsPublisher.PublishMetrics(ctx, values); err != nil {
+		return fmt.Errorf("failed to publish metrics: %w", err)
+	}
+	return nil
+}
+
+// ping sends a signed Core/ping request and returns its result
+func ping(ctx context.Context) (*pingResult, error) {
+	body := []byte(pingRequest)
+	url := strings.TrimSuffix(deps.Config.APIURL, "/") + "/jmap-iam/" + deps.Config.AccountID
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if err := deps.Signer.Sign(ctx, req, body); err != nil {
+		return nil, fmt.Errorf("failed to sign request: %w", err)
+	}
+
+	resp, err := deps.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, respBody)
+	}
+
+	var jmapResp pingResponse
+	if err := json.Unmarshal(respBody, &jmapResp); err != nil {
+		return nil, fmt.Errorf("invalid JMAP response: %w", err)
+	}
+	if len(jmapResp.MethodResponses) != 1 || len(jmapResp.MethodResponses[0]) != 3 {
+		return nil, fmt.Errorf("unexpected method responses: %s", respBody)
+	}
+	var name string
+	if err := json.Unmarshal(jmapResp.MethodResponses[0][0], &name); err != nil || name != "Core/ping" {
+		return nil, fmt.Errorf("Core/ping failed: %s", respBody)
+	}
+	var result pingResult
+	if err := json.Unmarshal(jmapResp.MethodResponses[0][1], &result); err != nil {
+		return nil, fmt.Errorf("invalid Core/ping response: %w", err)
+	}
+	return &result, nil
+}
+
+// handler is the Lambda entry point
+func handler(ctx context.Context) error {
+	return runCanary(ctx)
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// SigV4Signer signs requests for execute-api with the Lambda's credentials
+type SigV4Signer struct {
+	signer      *v4.Signer
+	credentials aws.CredentialsProvider
+	region      string
+}
+
+// NewSigV4Signer creates a new SigV4Signer
+func NewSigV4Signer(cfg aws.Config) *SigV4Signer {
+	return &SigV4Signer{
+		signer:      v4.NewSigner(),
+		credentials: cfg.Credentials,
+		region:      cfg.Region,
+	}
+}
+
+// Sign signs the request in place
+func (s *SigV4Signer) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	return s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "execute-api", s.region, time.Now())
+}
+
+// CloudWatchMetricsPublisher implements MetricsPublisher using CloudWatch
+type CloudWatchMetricsPublisher struct {
+	client    *cloudwatch.Client
+	namespace string
+}
+
+// NewCloudWatchMetricsPublisher creates a new CloudWatchMetricsPublisher
+func NewCloudWatchMetricsPublisher(client *cloudwatch.Client, namespace string) *CloudWatchMetricsPublisher {
+	return &CloudWatchMetricsPublisher{
+		client:    client,
+		namespace: namespace,
+	}
+}
+
+// PublishMetrics publishes the values in one PutMetricData call. CanarySuccess
+// is a count; the rest are latencies in milliseconds.
+func (p *CloudWatchMetricsPublisher) PublishMetrics(ctx context.Context, values map[string]float64) error {
+	data := make([]types.MetricDatum, 0, len(values))
+	for name, value := range values {
+		unit := types.StandardUnitMilliseconds
+		if name == "CanarySuccess" {
+			unit = types.StandardUnitCount
+		}
+		data = append(data, types.MetricDatum{
+			MetricName: aws.String(name),
+			Value:      aws.Float64(value),
+			Unit:       unit,
+		})
+	}
+	_, err := p.client.PutMetricData(ctx, &cloudwatch.PutMetricDataInput{
+		Namespace:  aws.String(p.namespace),
+		MetricData: data,
+	})
+	return err
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadCanary(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	apiURL := cfg.APIURL
+	accountID := cfg.AccountID
+	metricNamespace := cfg.MetricNamespace
+
+	deps = &Dependencies{
+		HTTPClient:       &http.Client{Timeout: 20 * time.Second},
+		Signer:           NewSigV4Signer(result.Config),
+		MetricsPublisher: NewCloudWatchMetricsPublisher(cloudwatch.NewFromConfig(result.Config), metricNamespace),
+		Config: Config{
+			APIURL:    apiURL,
+			AccountID: accountID,
+		},
+	}
+
+	result.Start(handler)
+}
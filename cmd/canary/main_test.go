@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mockHTTPClient returns a canned response and records the request
+type mockHTTPClient struct {
+	statusCode int
+	body       string
+	err        error
+	request    *http.Request
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.request = req
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &http.Response{
+		StatusCode: m.statusCode,
+		Body:       io.NopCloser(strings.NewReader(m.body)),
+	}, nil
+}
+
+type mockSigner struct {
+	signed bool
+	err    error
+}
+
+func (m *mockSigner) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	m.signed = true
+	return m.err
+}
+
+type mockMetricsPublisher struct {
+	values map[string]float64
+	err    error
+}
+
+func (m *mockMetricsPublisher) PublishMetrics(ctx context.Context, values map[string]float64) error {
+	m.values = values
+	return m.err
+}
+
+func setupTestDeps(client *mockHTTPClient, signer *mockSigner, metrics *mockMetricsPublisher) {
+	deps = &Dependencies{
+		HTTPClient:       client,
+		Signer:           signer,
+		MetricsPublisher: metrics,
+		Config: Config{
+			APIURL:    "https://jmap.example.com/",
+			AccountID: "canary",
+		},
+	}
+}
+
+const pingOK = `{"methodResponses":[["Core/ping",{"accountId":"canary","timings":{"registryLookupMs":0.01,"dynamodbReadMs":4.5,"pluginInvokeMs":20.25},"totalMs":25}, "c0"]],"sessionState":"s"}`
+
+func TestRunCanary_Success(t *testing.T) {
+	client := &mockHTTPClient{statusCode: 200, body: pingOK}
+	signer := &mockSigner{}
+	metrics := &mockMetricsPublisher{}
+	setupTestDeps(client, signer, metrics)
+
+	if err := runCanary(context.Background()); err != nil {
+		t.Fatalf("runCanary returned error: %v", err)
+	}
+
+	if !signer.signed {
+		t.Error("expected request to be signed")
+	}
+	if got := client.request.URL.String(); got != "https://jmap.example.com/jmap-iam/canary" {
+		t.Errorf("unexpected URL %s", got)
+	}
+	if client.request.Method != http.MethodPost {
+		t.Errorf("expected POST, got %s", client.request.Method)
+	}
+	if metrics.values["CanarySuccess"] != 1 {
+		t.Errorf("expected CanarySuccess 1, got %v", metrics.values)
+	}
+	if metrics.values["CanaryDynamoDBReadLatency"] != 4.5 || metrics.values["CanaryPluginInvokeLatency"] != 20.25 {
+		t.Errorf("expected timing breakdown, got %v", metrics.values)
+	}
+	if _, ok := metrics.values["CanaryLatency"]; !ok {
+		t.Error("expected CanaryLatency")
+	}
+}
+
+func TestRunCanary_FailuresRecordZero(t *testing.T) {
+	tests := []struct {
+		name   string
+		client *mockHTTPClient
+		signer *mockSigner
+	}{
+		{"request error", &mockHTTPClient{err: errors.New("timeout")}, &mockSigner{}},
+		{"signing error", &mockHTTPClient{statusCode: 200, body: pingOK}, &mockSigner{err: errors.New("no credentials")}},
+		{"http error", &mockHTTPClient{statusCode: 403, body: `{"type":"forbidden"}`}, &mockSigner{}},
+		{"method error", &mockHTTPClient{statusCode: 200, body: `{"methodResponses":[["error",{"type":"serverFail"},"c0"]]}`}, &mockSigner{}},
+		{"not JSON", &mockHTTPClient{statusCode: 200, body: `<html>`}, &mockSigner{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			metrics := &mockMetricsPublisher{}
+			setupTestDeps(tt.client, tt.signer, metrics)
+
+			if err := runCanary(context.Background()); err != nil {
+				t.Fatalf("expected failure to be recorded, not returned: %v", err)
+			}
+			if metrics.values["CanarySuccess"] != 0 {
+				t.Errorf("expected CanarySuccess 0, got %v", metrics.values)
+			}
+			if _, ok := metrics.values["CanaryLatency"]; ok {
+				t.Error("expected no latency for a failed ping")
+			}
+		})
+	}
+}
+
+func TestRunCanary_PublishFails_ReturnsError(t *testing.T) {
+	setupTestDeps(&mockHTTPClient{statusCode: 200, body: pingOK}, &mockSigner{}, &mockMetricsPublisher{err: errors.New("throttled")})
+
+	if err := runCanary(context.Background()); err == nil {
+		t.Error("expected error when metrics cannot be published")
+	}
+}
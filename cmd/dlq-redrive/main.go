@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// maxMessages bounds how many messages one invocation takes from each queue,
+// so a large backlog is worked through over several runs
+const maxMessages = 100
+
+// visibilityTimeout hides a received message until after this run, so a
+// message left for the next run is not received again in this one
+const visibilityTimeout = 600
+
+// Queue names, used as the Queue metric dimension and on parked messages
+const (
+	queueBlobConfirm = "blob-confirm"
+	queueBlobCleanup = "blob-cleanup"
+)
+
+// errUnrecoverable marks a message that cannot be redriven however often it
+// is tried, so it is parked straight away
+var errUnrecoverable = errors.New("message cannot be redriven")
+
+// ErrStreamExpired is returned when a stream batch is no longer in the
+// stream, which keeps records for 24 hours
+var ErrStreamExpired = errors.New("stream records have expired")
+
+// QueueClient receives, deletes and parks dead letter queue messages
+type QueueClient interface {
+	ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error)
+	DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error)
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+}
+
+// LambdaClient invokes the handler a message is redriven through
+type LambdaClient interface {
+	Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error)
+}
+
+// StreamReader reads a failed batch back from the table stream
+type StreamReader interface {
+	ReadBatch(ctx context.Context, batch StreamBatch) ([]events.DynamoDBEventRecord, error)
+}
+
+// RunMetrics records per-queue redrive metrics
+type RunMetrics interface {
+	RecordDLQRedrive(run metrics.DLQRedrive)
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Queues  QueueClient
+	Lambda  LambdaClient
+	Stream  StreamReader
+	Metrics RunMetrics
+
+	ConfirmQueueURL string
+	CleanupQueueURL string
+	ParkedQueueURL  string
+	ConfirmFunction string
+	CleanupFunction string
+	Bucket          string
+	StreamARN       string
+	MaxAttempts     int
+}
+
+var deps *Dependencies
+
+// source is a dead letter queue and how its messages are redriven
+type source struct {
+	name    string
+	url     string
+	redrive func(ctx context.Context, body string) error
+}
+
+// handler redrives the blob-confirm and blob-cleanup dead letter queues on a
+// schedule. Each message is checked and sent back through its handler; one
+// that fails again is left for the next run, and one that is invalid or has
+// failed MaxAttempts runs is parked for an operator.
+func handler(ctx context.Context) error {
+	sources := []source{
+		{name: queueBlobConfirm, url: deps.ConfirmQueueURL, redrive: redriveConfirm},
+		{name: queueBlobCleanup, url: deps.CleanupQueueURL, redrive: redriveCleanup},
+	}
+
+	var errs []error
+	for _, src := range sources {
+		run, err := drain(ctx, src)
+		if deps.Metrics != nil {
+			deps.Metrics.RecordDLQRedrive(run)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", src.name, err))
+		}
+		logger.InfoContext(ctx, "DLQ redrive completed",
+			slog.String("queue", src.name),
+			slog.Int("received", run.Received),
+			slog.Int("redriven", run.Redriven),
+			slog.Int("retained", run.Retained),
+			slog.Int("parked", run.Parked),
+		)
+	}
+	return errors.Join(errs...)
+}
+
+// drain works through up to maxMessages messages of a queue
+func drain(ctx context.Context, src source) (metrics.DLQRedrive, error) {
+	run := metrics.DLQRedrive{Queue: src.name}
+	for run.Received < maxMessages {
+		output, err := deps.Queues.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(src.url),
+			MaxNumberOfMessages:         int32(min(10, maxMessages-run.Received)),
+			VisibilityTimeout:           visibilityTimeout,
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameApproximateReceiveCount},
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to receive dead letters",
+				slog.String("queue", src.name),
+				slog.String("error", err.Error()),
+			)
+			return run, fmt.Errorf("failed to receive messages: %w", err)
+		}
+		if len(output.Messages) == 0 {
+			return run, nil
+		}
+		for _, message := range output.Messages {
+			run.Received++
+			process(ctx, src, message, &run)
+		}
+	}
+	return run, nil
+}
+
+// process redrives one message, then deletes, keeps or parks it, adding the
+// outcome to the run's counts
+func process(ctx context.Context, src source, message sqstypes.Message, run *metrics.DLQRedrive) {
+	err := src.redrive(ctx, aws.ToString(message.Body))
+	if err == nil {
+		deleteMessage(ctx, src, message)
+		run.Redriven++
+		logger.InfoContext(ctx, "Redrove dead letter",
+			slog.String("queue", src.name),
+			slog.String("message_id", aws.ToString(message.MessageId)),
+		)
+		return
+	}
+
+	attempts := receiveCount(message)
+	if !errors.Is(err, errUnrecoverable) && attempts < deps.MaxAttempts {
+		run.Retained++
+		logger.WarnContext(ctx, "Failed to redrive dead letter, will retry",
+			slog.String("queue", src.name),
+			slog.String("message_id", aws.ToString(message.MessageId)),
+			slog.Int("attempts", attempts),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+
+	if !park(ctx, src, message, err) {
+		run.Retained++
+		return
+	}
+	deleteMessage(ctx, src, message)
+	run.Parked++
+}
+
+// park copies a message to the parked queue with why it could not be
+// redriven, returning true if it was copied
+func park(ctx context.Context, src source, message sqstypes.Message, reason error) bool {
+	_, err := deps.Queues.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(deps.ParkedQueueURL),
+		MessageBody: message.Body,
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			"SourceQueue": {DataType: aws.String("String"), StringValue: aws.String(src.name)},
+			"Reason":      {DataType: aws.String("String"), StringValue: aws.String(reason.Error())},
+		},
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to park dead letter",
+			slog.String("queue", src.name),
+			slog.String("message_id", aws.ToString(message.MessageId)),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	logger.WarnContext(ctx, "Parked dead letter",
+		slog.String("queue", src.name),
+		slog.String("message_id", aws.ToString(message.MessageId)),
+		slog.String("reason", reason.Error()),
+	)
+	return true
+}
+
+// deleteMessage removes a message that was redriven or parked. A failed
+// delete redrives it again next run, which the handlers tolerate.
+func deleteMessage(ctx context.Context, src source, message sqstypes.Message) {
+	if _, err := deps.Queues.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+		QueueUrl:      aws.String(src.url),
+		ReceiptHandle: message.ReceiptHandle,
+	}); err != nil {
+		logger.WarnContext(ctx, "Failed to delete dead letter",
+			slog.String("queue", src.name),
+			slog.String("message_id", aws.ToString(message.MessageId)),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// receiveCount returns how many times a message has been received, which
+// counts this run
+func receiveCount(message sqstypes.Message) int {
+	count, _ := strconv.Atoi(message.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)])
+	return count
+}
+
+// =============================================================================
+// blob-confirm
+// =============================================================================
+
+// redriveConfirm checks that a blob-confirm dead letter, the S3 event the
+// function failed on, is for the blob bucket and upload keys, and invokes
+// blob-confirm with it again
+func redriveConfirm(ctx context.Context, body string) error {
+	var event events.S3Event
+	if err := json.Unmarshal([]byte(body), &event); err != nil {
+		return fmt.Errorf("%w: not an S3 event: %v", errUnrecoverable, err)
+	}
+	if len(event.Records) == 0 {
+		return fmt.Errorf("%w: S3 event has no records", errUnrecoverable)
+	}
+	for _, record := range event.Records {
+		if record.EventSource != "aws:s3" || record.S3.Bucket.Name != deps.Bucket {
+			return fmt.Errorf("%w: event is not from the blob bucket", errUnrecoverable)
+		}
+		parts := strings.SplitN(record.S3.Object.Key, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("%w: invalid key %q", errUnrecoverable, record.S3.Object.Key)
+		}
+	}
+
+	_, err := invoke(ctx, deps.ConfirmFunction, []byte(body))
+	return err
+}
+
+// =============================================================================
+// blob-cleanup
+// =============================================================================
+
+// StreamBatch locates a failed batch in the table stream
+type StreamBatch struct {
+	ShardID             string `json:"shardId"`
+	StartSequenceNumber string `json:"startSequenceNumber"`
+	EndSequenceNumber   string `json:"endSequenceNumber"`
+	StreamArn           string `json:"streamArn"`
+}
+
+// cleanupFailure is the record Lambda sends to the blob-cleanup dead letter
+// queue when a stream batch fails every retry. It does not carry the
+// batch's records, only where they are in the stream.
+type cleanupFailure struct {
+	Batch *StreamBatch `json:"DDBStreamBatchInfo"`
+}
+
+// redriveCleanup checks that a blob-cleanup dead letter is for the table's
+// stream, reads its batch back, and invokes blob-cleanup with the records
+// that still need cleaning up
+func redriveCleanup(ctx context.Context, body string) error {
+	var failure cleanupFailure
+	if err := json.Unmarshal([]byte(body), &failure); err != nil {
+		return fmt.Errorf("%w: not a stream failure record: %v", errUnrecoverable, err)
+	}
+	batch := failure.Batch
+	if batch == nil || batch.ShardID == "" || batch.StartSequenceNumber == "" || batch.EndSequenceNumber == "" {
+		return fmt.Errorf("%w: stream failure record has no batch", errUnrecoverable)
+	}
+	if batch.StreamArn != deps.StreamARN {
+		return fmt.Errorf("%w: batch is not from the table stream", errUnrecoverable)
+	}
+
+	records, err := deps.Stream.ReadBatch(ctx, *batch)
+	if errors.Is(err, ErrStreamExpired) {
+		return fmt.Errorf("%w: %v", errUnrecoverable, err)
+	}
+	if err != nil {
+		return err
+	}
+
+	// The stream holds every change in the range, not only those the event
+	// source mapping's filter passed to blob-cleanup
+	var event events.DynamoDBEvent
+	for _, record := range records {
+		if pendingCleanup(record) {
+			event.Records = append(event.Records, record)
+		}
+	}
+	if len(event.Records) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal stream event: %w", err)
+	}
+	output, err := invoke(ctx, deps.CleanupFunction, payload)
+	if err != nil {
+		return err
+	}
+	var response events.DynamoDBEventResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		return fmt.Errorf("failed to parse %s response: %w", deps.CleanupFunction, err)
+	}
+	if len(response.BatchItemFailures) > 0 {
+		return fmt.Errorf("%d of %d records failed again", len(response.BatchItemFailures), len(event.Records))
+	}
+	return nil
+}
+
+// pendingCleanup matches the blob-cleanup event source mapping's filter: a
+// blob record that has just been marked deleted
+func pendingCleanup(record events.DynamoDBEventRecord) bool {
+	if record.EventName != "MODIFY" {
+		return false
+	}
+	_, deleted := record.Change.NewImage["deletedAt"]
+	_, wasDeleted := record.Change.OldImage["deletedAt"]
+	sk, ok := record.Change.NewImage["sk"]
+	return deleted && !wasDeleted && ok && sk.DataType() == events.DataTypeString && strings.HasPrefix(sk.String(), "BLOB#")
+}
+
+// invoke calls a handler synchronously, returning its response
+func invoke(ctx context.Context, function string, payload []byte) ([]byte, error) {
+	output, err := deps.Lambda.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(function),
+		Payload:      payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to invoke %s: %w", function, err)
+	}
+	if output.FunctionError != nil {
+		return nil, fmt.Errorf("%s failed: %s", function, output.Payload)
+	}
+	return output.Payload, nil
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// streamReadLimit bounds the GetRecords calls for one batch
+const streamReadLimit = 10
+
+// DynamoDBStreamsClient defines the stream operations needed to read a batch
+type DynamoDBStreamsClient interface {
+	GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error)
+	GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error)
+}
+
+// DynamoDBStreamReader implements StreamReader using DynamoDB Streams
+type DynamoDBStreamReader struct {
+	client DynamoDBStreamsClient
+}
+
+// NewDynamoDBStreamReader creates a new DynamoDBStreamReader
+func NewDynamoDBStreamReader(client DynamoDBStreamsClient) *DynamoDBStreamReader {
+	return &DynamoDBStreamReader{client: client}
+}
+
+// ReadBatch returns the records from a batch's start to end sequence
+// numbers, in the shape Lambda delivers them
+func (r *DynamoDBStreamReader) ReadBatch(ctx context.Context, batch StreamBatch) ([]events.DynamoDBEventRecord, error) {
+	iterator, err := r.client.GetShardIterator(ctx, &dynamodbstreams.GetShardIteratorInput{
+		StreamArn:         aws.String(batch.StreamArn),
+		ShardId:           aws.String(batch.ShardID),
+		ShardIteratorType: streamtypes.ShardIteratorTypeAtSequenceNumber,
+		SequenceNumber:    aws.String(batch.StartSequenceNumber),
+	})
+	if err != nil {
+		return nil, streamError(err)
+	}
+
+	var records []events.DynamoDBEventRecord
+	next := iterator.ShardIterator
+	for range streamReadLimit {
+		output, err := r.client.GetRecords(ctx, &dynamodbstreams.GetRecordsInput{ShardIterator: next})
+		if err != nil {
+			return nil, streamError(err)
+		}
+		for _, record := range output.Records {
+			if record.Dynamodb == nil {
+				continue
+			}
+			if sequenceAfter(aws.ToString(record.Dynamodb.SequenceNumber), batch.EndSequenceNumber) {
+				return records, nil
+			}
+			records = append(records, eventRecord(record, batch.StreamArn))
+		}
+		if len(output.Records) == 0 || output.NextShardIterator == nil {
+			break
+		}
+		next = output.NextShardIterator
+	}
+	return records, nil
+}
+
+// streamError maps the errors for records no longer in the stream to
+// ErrStreamExpired
+func streamError(err error) error {
+	var trimmed *streamtypes.TrimmedDataAccessException
+	var notFound *streamtypes.ResourceNotFoundException
+	if errors.As(err, &trimmed) || errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %v", ErrStreamExpired, err)
+	}
+	return fmt.Errorf("failed to read stream: %w", err)
+}
+
+// sequenceAfter reports whether stream sequence number a comes after b.
+// They are decimal strings too long for an integer.
+func sequenceAfter(a, b string) bool {
+	if len(a) != len(b) {
+		return len(a) > len(b)
+	}
+	return a > b
+}
+
+// eventRecord converts a stream record to the form Lambda delivers
+func eventRecord(record streamtypes.Record, streamArn string) events.DynamoDBEventRecord {
+	change := record.Dynamodb
+	converted := events.DynamoDBEventRecord{
+		AWSRegion:      aws.ToString(record.AwsRegion),
+		EventID:        aws.ToString(record.EventID),
+		EventName:      string(record.EventName),
+		EventSource:    aws.ToString(record.EventSource),
+		EventVersion:   aws.ToString(record.EventVersion),
+		EventSourceArn: streamArn,
+		Change: events.DynamoDBStreamRecord{
+			Keys:           eventImage(change.Keys),
+			NewImage:       eventImage(change.NewImage),
+			OldImage:       eventImage(change.OldImage),
+			SequenceNumber: aws.ToString(change.SequenceNumber),
+			SizeBytes:      aws.ToInt64(change.SizeBytes),
+			StreamViewType: string(change.StreamViewType),
+		},
+	}
+	if change.ApproximateCreationDateTime != nil {
+		converted.Change.ApproximateCreationDateTime = events.SecondsEpochTime{Time: *change.ApproximateCreationDateTime}
+	}
+	return converted
+}
+
+// eventImage converts a stream item image
+func eventImage(image map[string]streamtypes.AttributeValue) map[string]events.DynamoDBAttributeValue {
+	if image == nil {
+		return nil
+	}
+	converted := make(map[string]events.DynamoDBAttributeValue, len(image))
+	for name, value := range image {
+		converted[name] = eventAttribute(value)
+	}
+	return converted
+}
+
+// eventAttribute converts a stream attribute value
+func eventAttribute(value streamtypes.AttributeValue) events.DynamoDBAttributeValue {
+	switch v := value.(type) {
+	case *streamtypes.AttributeValueMemberS:
+		return events.NewStringAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberN:
+		return events.NewNumberAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberB:
+		return events.NewBinaryAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberBOOL:
+		return events.NewBooleanAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberSS:
+		return events.NewStringSetAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberNS:
+		return events.NewNumberSetAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberBS:
+		return events.NewBinarySetAttribute(v.Value)
+	case *streamtypes.AttributeValueMemberL:
+		list := make([]events.DynamoDBAttributeValue, len(v.Value))
+		for i, item := range v.Value {
+			list[i] = eventAttribute(item)
+		}
+		return events.NewListAttribute(list)
+	case *streamtypes.AttributeValueMemberM:
+		return events.NewMapAttribute(eventImage(v.Value))
+	default:
+		return events.NewNullAttribute()
+	}
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadDLQRedrive(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	deps = &Dependencies{
+		Queues:          sqs.NewFromConfig(result.Config),
+		Lambda:          lambda.NewFromConfig(result.Config),
+		Stream:          NewDynamoDBStreamReader(dynamodbstreams.NewFromConfig(result.Config)),
+		ConfirmQueueURL: cfg.ConfirmQueueURL,
+		CleanupQueueURL: cfg.CleanupQueueURL,
+		ParkedQueueURL:  cfg.ParkedQueueURL,
+		ConfirmFunction: cfg.ConfirmFunction,
+		CleanupFunction: cfg.CleanupFunction,
+		Bucket:          cfg.Bucket,
+		StreamARN:       cfg.StreamARN,
+		MaxAttempts:     cfg.MaxAttempts,
+	}
+
+	// Per-run metrics are written to the function log in EMF
+	if cfg.MetricNamespace != "" {
+		deps.Metrics = metrics.NewEMF(os.Stdout, cfg.MetricNamespace)
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,475 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodbstreams"
+	streamtypes "github.com/aws/aws-sdk-go-v2/service/dynamodbstreams/types"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+)
+
+const (
+	confirmQueue = "https://sqs.example/confirm-dlq"
+	cleanupQueue = "https://sqs.example/cleanup-dlq"
+	parkedQueue  = "https://sqs.example/parked"
+	streamARN    = "arn:aws:dynamodb:us-east-1:123456789012:table/jmap/stream/2024-01-01T00:00:00.000"
+)
+
+// Mock implementations
+
+type mockQueues struct {
+	messages map[string][]sqstypes.Message
+	deleted  map[string][]string
+	parked   []*sqs.SendMessageInput
+	parkErr  error
+}
+
+func (m *mockQueues) ReceiveMessage(ctx context.Context, params *sqs.ReceiveMessageInput, optFns ...func(*sqs.Options)) (*sqs.ReceiveMessageOutput, error) {
+	url := aws.ToString(params.QueueUrl)
+	messages := m.messages[url]
+	n := min(len(messages), int(params.MaxNumberOfMessages))
+	m.messages[url] = messages[n:]
+	return &sqs.ReceiveMessageOutput{Messages: messages[:n]}, nil
+}
+
+func (m *mockQueues) DeleteMessage(ctx context.Context, params *sqs.DeleteMessageInput, optFns ...func(*sqs.Options)) (*sqs.DeleteMessageOutput, error) {
+	if m.deleted == nil {
+		m.deleted = map[string][]string{}
+	}
+	url := aws.ToString(params.QueueUrl)
+	m.deleted[url] = append(m.deleted[url], aws.ToString(params.ReceiptHandle))
+	return &sqs.DeleteMessageOutput{}, nil
+}
+
+func (m *mockQueues) SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	if m.parkErr != nil {
+		return nil, m.parkErr
+	}
+	m.parked = append(m.parked, params)
+	return &sqs.SendMessageOutput{}, nil
+}
+
+type mockLambda struct {
+	calls    []*lambda.InvokeInput
+	response string
+	funcErr  bool
+	err      error
+}
+
+func (m *mockLambda) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	m.calls = append(m.calls, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	output := &lambda.InvokeOutput{Payload: []byte(m.response)}
+	if m.funcErr {
+		output.FunctionError = aws.String("Unhandled")
+	}
+	return output, nil
+}
+
+type mockStream struct {
+	records []events.DynamoDBEventRecord
+	err     error
+}
+
+func (m *mockStream) ReadBatch(ctx context.Context, batch StreamBatch) ([]events.DynamoDBEventRecord, error) {
+	return m.records, m.err
+}
+
+type mockMetrics struct {
+	runs []metrics.DLQRedrive
+}
+
+func (m *mockMetrics) RecordDLQRedrive(run metrics.DLQRedrive) {
+	m.runs = append(m.runs, run)
+}
+
+func setupTestDeps(queues *mockQueues, invoker *mockLambda, stream *mockStream) *mockMetrics {
+	if queues.messages == nil {
+		queues.messages = map[string][]sqstypes.Message{}
+	}
+	runMetrics := &mockMetrics{}
+	deps = &Dependencies{
+		Queues:          queues,
+		Lambda:          invoker,
+		Stream:          stream,
+		Metrics:         runMetrics,
+		ConfirmQueueURL: confirmQueue,
+		CleanupQueueURL: cleanupQueue,
+		ParkedQueueURL:  parkedQueue,
+		ConfirmFunction: "blob-confirm",
+		CleanupFunction: "blob-cleanup",
+		Bucket:          "blobs",
+		StreamARN:       streamARN,
+		MaxAttempts:     3,
+	}
+	return runMetrics
+}
+
+func message(id, body string, receives int) sqstypes.Message {
+	return sqstypes.Message{
+		MessageId:     aws.String(id),
+		ReceiptHandle: aws.String("rh-" + id),
+		Body:          aws.String(body),
+		Attributes:    map[string]string{"ApproximateReceiveCount": fmt.Sprint(receives)},
+	}
+}
+
+func s3Event(bucket, key string) string {
+	return fmt.Sprintf(`{"Records":[{"eventSource":"aws:s3","s3":{"bucket":{"name":%q},"object":{"key":%q,"size":5}}}]}`, bucket, key)
+}
+
+func streamFailure(arn string) string {
+	return fmt.Sprintf(`{"requestContext":{"condition":"RetryAttemptsExhausted"},"DDBStreamBatchInfo":{"shardId":"shardId-1","startSequenceNumber":"100","endSequenceNumber":"200","batchSize":1,"streamArn":%q}}`, arn)
+}
+
+func deletedBlob(sk string) events.DynamoDBEventRecord {
+	return events.DynamoDBEventRecord{
+		EventName: "MODIFY",
+		Change: events.DynamoDBStreamRecord{
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"pk":        events.NewStringAttribute("ACCOUNT#user-1"),
+				"sk":        events.NewStringAttribute(sk),
+				"deletedAt": events.NewStringAttribute("2024-01-01T00:00:00Z"),
+			},
+			OldImage: map[string]events.DynamoDBAttributeValue{
+				"sk": events.NewStringAttribute(sk),
+			},
+			SequenceNumber: "150",
+		},
+	}
+}
+
+func TestHandler_RedrivesConfirm(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		confirmQueue: {message("m1", s3Event("blobs", "user-1/blob-1"), 1)},
+	}}
+	invoker := &mockLambda{response: "null"}
+	runMetrics := setupTestDeps(queues, invoker, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invoker.calls) != 1 || aws.ToString(invoker.calls[0].FunctionName) != "blob-confirm" {
+		t.Fatalf("expected blob-confirm to be invoked, got %v", invoker.calls)
+	}
+	if string(invoker.calls[0].Payload) != s3Event("blobs", "user-1/blob-1") {
+		t.Errorf("expected the original event, got %s", invoker.calls[0].Payload)
+	}
+	if len(queues.deleted[confirmQueue]) != 1 {
+		t.Errorf("expected the message to be deleted, got %v", queues.deleted)
+	}
+	if runMetrics.runs[0] != (metrics.DLQRedrive{Queue: "blob-confirm", Received: 1, Redriven: 1}) {
+		t.Errorf("unexpected metrics %+v", runMetrics.runs)
+	}
+}
+
+func TestHandler_ParksInvalidConfirm(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not JSON", "nope"},
+		{"no records", `{"Records":[]}`},
+		{"other bucket", s3Event("other", "user-1/blob-1")},
+		{"bad key", s3Event("blobs", "no-slash")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queues := &mockQueues{messages: map[string][]sqstypes.Message{
+				confirmQueue: {message("m1", tt.body, 1)},
+			}}
+			invoker := &mockLambda{}
+			runMetrics := setupTestDeps(queues, invoker, &mockStream{})
+
+			if err := handler(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(invoker.calls) != 0 {
+				t.Errorf("expected no invocation, got %d", len(invoker.calls))
+			}
+			if len(queues.parked) != 1 || aws.ToString(queues.parked[0].MessageBody) != tt.body {
+				t.Fatalf("expected the message to be parked, got %v", queues.parked)
+			}
+			if got := aws.ToString(queues.parked[0].MessageAttributes["SourceQueue"].StringValue); got != "blob-confirm" {
+				t.Errorf("expected source queue blob-confirm, got %q", got)
+			}
+			if len(queues.deleted[confirmQueue]) != 1 {
+				t.Errorf("expected the message to be deleted, got %v", queues.deleted)
+			}
+			if runMetrics.runs[0].Parked != 1 {
+				t.Errorf("expected one parked message, got %+v", runMetrics.runs[0])
+			}
+		})
+	}
+}
+
+func TestHandler_RetainsFailedRedrive(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		confirmQueue: {message("m1", s3Event("blobs", "user-1/blob-1"), 2)},
+	}}
+	runMetrics := setupTestDeps(queues, &mockLambda{response: `{"errorMessage":"boom"}`, funcErr: true}, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queues.deleted) != 0 || len(queues.parked) != 0 {
+		t.Errorf("expected the message to be left in the queue, deleted %v, parked %d", queues.deleted, len(queues.parked))
+	}
+	if runMetrics.runs[0].Retained != 1 {
+		t.Errorf("expected one retained message, got %+v", runMetrics.runs[0])
+	}
+}
+
+func TestHandler_ParksAfterMaxAttempts(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		confirmQueue: {message("m1", s3Event("blobs", "user-1/blob-1"), 3)},
+	}}
+	runMetrics := setupTestDeps(queues, &mockLambda{err: errors.New("throttled")}, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queues.parked) != 1 {
+		t.Fatalf("expected the message to be parked, got %d", len(queues.parked))
+	}
+	if reason := aws.ToString(queues.parked[0].MessageAttributes["Reason"].StringValue); !strings.Contains(reason, "throttled") {
+		t.Errorf("expected the last error as the reason, got %q", reason)
+	}
+	if runMetrics.runs[0].Parked != 1 {
+		t.Errorf("expected one parked message, got %+v", runMetrics.runs[0])
+	}
+}
+
+func TestHandler_KeepsMessageWhenParkingFails(t *testing.T) {
+	queues := &mockQueues{
+		messages: map[string][]sqstypes.Message{confirmQueue: {message("m1", "nope", 1)}},
+		parkErr:  errors.New("access denied"),
+	}
+	runMetrics := setupTestDeps(queues, &mockLambda{}, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(queues.deleted) != 0 {
+		t.Errorf("expected the message to be kept, got %v", queues.deleted)
+	}
+	if runMetrics.runs[0].Retained != 1 || runMetrics.runs[0].Parked != 0 {
+		t.Errorf("unexpected metrics %+v", runMetrics.runs[0])
+	}
+}
+
+func TestHandler_RedrivesCleanup(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		cleanupQueue: {message("m1", streamFailure(streamARN), 1)},
+	}}
+	other := deletedBlob("META#")
+	invoker := &mockLambda{response: `{"batchItemFailures":[]}`}
+	stream := &mockStream{records: []events.DynamoDBEventRecord{deletedBlob("BLOB#blob-1"), other}}
+	runMetrics := setupTestDeps(queues, invoker, stream)
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invoker.calls) != 1 || aws.ToString(invoker.calls[0].FunctionName) != "blob-cleanup" {
+		t.Fatalf("expected blob-cleanup to be invoked, got %v", invoker.calls)
+	}
+	var event events.DynamoDBEvent
+	if err := json.Unmarshal(invoker.calls[0].Payload, &event); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if len(event.Records) != 1 || event.Records[0].Change.NewImage["sk"].String() != "BLOB#blob-1" {
+		t.Errorf("expected only the blob record, got %+v", event.Records)
+	}
+	if len(queues.deleted[cleanupQueue]) != 1 {
+		t.Errorf("expected the message to be deleted, got %v", queues.deleted)
+	}
+	if runMetrics.runs[1] != (metrics.DLQRedrive{Queue: "blob-cleanup", Received: 1, Redriven: 1}) {
+		t.Errorf("unexpected metrics %+v", runMetrics.runs)
+	}
+}
+
+func TestHandler_CleanupWithNothingLeftToClean(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		cleanupQueue: {message("m1", streamFailure(streamARN), 1)},
+	}}
+	invoker := &mockLambda{}
+	setupTestDeps(queues, invoker, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(invoker.calls) != 0 {
+		t.Errorf("expected no invocation, got %d", len(invoker.calls))
+	}
+	if len(queues.deleted[cleanupQueue]) != 1 {
+		t.Errorf("expected the message to be deleted, got %v", queues.deleted)
+	}
+}
+
+func TestHandler_RetainsCleanupWithFailedItems(t *testing.T) {
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{
+		cleanupQueue: {message("m1", streamFailure(streamARN), 1)},
+	}}
+	invoker := &mockLambda{response: `{"batchItemFailures":[{"itemIdentifier":"150"}]}`}
+	stream := &mockStream{records: []events.DynamoDBEventRecord{deletedBlob("BLOB#blob-1")}}
+	runMetrics := setupTestDeps(queues, invoker, stream)
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runMetrics.runs[1].Retained != 1 {
+		t.Errorf("expected one retained message, got %+v", runMetrics.runs[1])
+	}
+}
+
+func TestHandler_ParksInvalidCleanup(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		stream *mockStream
+	}{
+		{"not JSON", "nope", &mockStream{}},
+		{"no batch", `{"requestContext":{}}`, &mockStream{}},
+		{"other stream", streamFailure("arn:aws:dynamodb:us-east-1:123456789012:table/other/stream/1"), &mockStream{}},
+		{"expired", streamFailure(streamARN), &mockStream{err: fmt.Errorf("%w: trimmed", ErrStreamExpired)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queues := &mockQueues{messages: map[string][]sqstypes.Message{
+				cleanupQueue: {message("m1", tt.body, 1)},
+			}}
+			runMetrics := setupTestDeps(queues, &mockLambda{}, tt.stream)
+
+			if err := handler(context.Background()); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(queues.parked) != 1 {
+				t.Fatalf("expected the message to be parked, got %d", len(queues.parked))
+			}
+			if runMetrics.runs[1].Parked != 1 {
+				t.Errorf("expected one parked message, got %+v", runMetrics.runs[1])
+			}
+		})
+	}
+}
+
+func TestHandler_StopsAtMaxMessages(t *testing.T) {
+	var messages []sqstypes.Message
+	for i := range maxMessages + 5 {
+		messages = append(messages, message(fmt.Sprint(i), s3Event("blobs", "user-1/blob-1"), 1))
+	}
+	queues := &mockQueues{messages: map[string][]sqstypes.Message{confirmQueue: messages}}
+	runMetrics := setupTestDeps(queues, &mockLambda{response: "null"}, &mockStream{})
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if runMetrics.runs[0].Received != maxMessages || len(queues.messages[confirmQueue]) != 5 {
+		t.Errorf("expected %d messages to be received, got %d", maxMessages, runMetrics.runs[0].Received)
+	}
+}
+
+// Stream reader
+
+type mockStreamsClient struct {
+	pages       [][]streamtypes.Record
+	iteratorErr error
+	calls       int
+}
+
+func (m *mockStreamsClient) GetShardIterator(ctx context.Context, params *dynamodbstreams.GetShardIteratorInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetShardIteratorOutput, error) {
+	if m.iteratorErr != nil {
+		return nil, m.iteratorErr
+	}
+	return &dynamodbstreams.GetShardIteratorOutput{ShardIterator: aws.String("it-0")}, nil
+}
+
+func (m *mockStreamsClient) GetRecords(ctx context.Context, params *dynamodbstreams.GetRecordsInput, optFns ...func(*dynamodbstreams.Options)) (*dynamodbstreams.GetRecordsOutput, error) {
+	if m.calls >= len(m.pages) {
+		return &dynamodbstreams.GetRecordsOutput{NextShardIterator: aws.String("it-end")}, nil
+	}
+	page := m.pages[m.calls]
+	m.calls++
+	return &dynamodbstreams.GetRecordsOutput{Records: page, NextShardIterator: aws.String(fmt.Sprint("it-", m.calls))}, nil
+}
+
+func streamRecord(sequence string) streamtypes.Record {
+	return streamtypes.Record{
+		EventName: streamtypes.OperationTypeModify,
+		Dynamodb: &streamtypes.StreamRecord{
+			SequenceNumber: aws.String(sequence),
+			NewImage: map[string]streamtypes.AttributeValue{
+				"sk":   &streamtypes.AttributeValueMemberS{Value: "BLOB#blob-1"},
+				"size": &streamtypes.AttributeValueMemberN{Value: "42"},
+				"tags": &streamtypes.AttributeValueMemberM{Value: map[string]streamtypes.AttributeValue{
+					"scan": &streamtypes.AttributeValueMemberL{Value: []streamtypes.AttributeValue{&streamtypes.AttributeValueMemberBOOL{Value: true}}},
+				}},
+			},
+		},
+	}
+}
+
+func TestDynamoDBStreamReader_ReadsBatchRange(t *testing.T) {
+	client := &mockStreamsClient{pages: [][]streamtypes.Record{
+		{streamRecord("100"), streamRecord("150")},
+		{streamRecord("200"), streamRecord("1000")},
+	}}
+	reader := NewDynamoDBStreamReader(client)
+
+	records, err := reader.ReadBatch(context.Background(), StreamBatch{ShardID: "s", StartSequenceNumber: "100", EndSequenceNumber: "200", StreamArn: streamARN})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 3 || records[2].Change.SequenceNumber != "200" {
+		t.Fatalf("expected records 100 to 200, got %+v", records)
+	}
+	image := records[0].Change.NewImage
+	if image["sk"].String() != "BLOB#blob-1" || image["size"].Number() != "42" {
+		t.Errorf("unexpected image %v", image)
+	}
+	if !image["tags"].Map()["scan"].List()[0].Boolean() {
+		t.Errorf("expected nested attributes to be converted, got %v", image["tags"])
+	}
+	if records[0].EventName != "MODIFY" || records[0].EventSourceArn != streamARN {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+}
+
+func TestDynamoDBStreamReader_Expired(t *testing.T) {
+	reader := NewDynamoDBStreamReader(&mockStreamsClient{iteratorErr: &streamtypes.TrimmedDataAccessException{}})
+
+	_, err := reader.ReadBatch(context.Background(), StreamBatch{ShardID: "s", StartSequenceNumber: "1", EndSequenceNumber: "2", StreamArn: streamARN})
+	if !errors.Is(err, ErrStreamExpired) {
+		t.Errorf("expected ErrStreamExpired, got %v", err)
+	}
+}
+
+func TestSequenceAfter(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"200", "100", true},
+		{"100", "200", false},
+		{"100", "100", false},
+		{"1000", "999", true},
+		{"999", "1000", false},
+	}
+	for _, tt := range tests {
+		if got := sequenceAfter(tt.a, tt.b); got != tt.want {
+			t.Errorf("sequenceAfter(%s, %s) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
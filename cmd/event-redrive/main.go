@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/deadletter"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// batchSize bounds how many dead letters one invocation redrives, so a large
+// backlog is worked through over several runs
+const batchSize = 500
+
+// DeadLetterStore reads and resolves dead-lettered events
+type DeadLetterStore interface {
+	List(ctx context.Context, limit int) ([]deadletter.Record, error)
+	Delete(ctx context.Context, sk string) error
+	RecordRedriveFailure(ctx context.Context, sk, lastError string) error
+}
+
+// EventSender sends an event to a single target
+type EventSender interface {
+	SendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload publisher.EventPayload) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	DeadLetters DeadLetterStore
+	Sender      EventSender
+	Registry    publisher.EventTargetGetter
+}
+
+var deps *Dependencies
+
+// handler redrives dead-lettered events on a schedule. Events that still
+// cannot be sent are kept for the next run.
+func handler(ctx context.Context) error {
+	records, err := deps.DeadLetters.List(ctx, batchSize)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to list dead letters",
+			slog.String("error", err.Error()),
+		)
+		return fmt.Errorf("failed to list dead letters: %w", err)
+	}
+
+	redriven := 0
+	dropped := 0
+	errorCount := 0
+	for _, record := range records {
+		if !subscribed(record) {
+			drop(ctx, record)
+			dropped++
+			continue
+		}
+		if redrive(ctx, record) {
+			redriven++
+		} else {
+			errorCount++
+		}
+	}
+
+	logger.InfoContext(ctx, "Event redrive completed",
+		slog.Int("total", len(records)),
+		slog.Int("redriven", redriven),
+		slog.Int("dropped", dropped),
+		slog.Int("errors", errorCount),
+	)
+	return nil
+}
+
+// subscribed reports whether the dead letter's target is still registered for
+// its event, so events are not sent to plugins that have since unsubscribed
+func subscribed(record deadletter.Record) bool {
+	for _, target := range deps.Registry.GetEventTargets(record.EventType) {
+		if target.PluginID == record.PluginID && target.TargetArn == record.TargetArn {
+			return true
+		}
+	}
+	return false
+}
+
+// drop deletes a dead letter whose target is no longer subscribed
+func drop(ctx context.Context, record deadletter.Record) {
+	logger.WarnContext(ctx, "Dropping dead letter for unsubscribed target",
+		slog.String("account_id", record.AccountID),
+		slog.String("event_type", record.EventType),
+		slog.String("plugin_id", record.PluginID),
+		slog.String("target_arn", record.TargetArn),
+	)
+	if err := deps.DeadLetters.Delete(ctx, record.SK); err != nil {
+		logger.WarnContext(ctx, "Failed to delete dead letter",
+			slog.String("account_id", record.AccountID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// redrive sends one dead letter to its target, returning true if it was sent
+func redrive(ctx context.Context, record deadletter.Record) bool {
+	payload, err := record.Event()
+	if err == nil {
+		err = deps.Sender.SendTo(ctx, record.Target(), payload)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to redrive event",
+			slog.String("account_id", record.AccountID),
+			slog.String("event_type", record.EventType),
+			slog.String("plugin_id", record.PluginID),
+			slog.Int("redrives", record.Redrives+1),
+			slog.String("error", err.Error()),
+		)
+		if err := deps.DeadLetters.RecordRedriveFailure(ctx, record.SK, err.Error()); err != nil {
+			logger.WarnContext(ctx, "Failed to record redrive failure",
+				slog.String("account_id", record.AccountID),
+				slog.String("error", err.Error()),
+			)
+		}
+		return false
+	}
+
+	// A failed delete redrives the event again next run, so targets see a duplicate
+	if err := deps.DeadLetters.Delete(ctx, record.SK); err != nil {
+		logger.WarnContext(ctx, "Failed to delete redriven dead letter",
+			slog.String("account_id", record.AccountID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	logger.InfoContext(ctx, "Redrove event",
+		slog.String("account_id", record.AccountID),
+		slog.String("event_type", record.EventType),
+		slog.String("plugin_id", record.PluginID),
+	)
+	return true
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadCore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	// Load plugin registry to skip targets that have unsubscribed
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	eventPublisher := publisher.FromConfig(result.Config, registry)
+
+	deps = &Dependencies{
+		DeadLetters: deadletter.NewDynamoDBStore(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), tableName),
+		Sender:      eventPublisher,
+		Registry:    registry,
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/deadletter"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockDeadLetterStore struct {
+	records  []deadletter.Record
+	listErr  error
+	deleted  []string
+	failures map[string]string
+}
+
+func (m *mockDeadLetterStore) List(ctx context.Context, limit int) ([]deadletter.Record, error) {
+	return m.records, m.listErr
+}
+
+func (m *mockDeadLetterStore) Delete(ctx context.Context, sk string) error {
+	m.deleted = append(m.deleted, sk)
+	return nil
+}
+
+func (m *mockDeadLetterStore) RecordRedriveFailure(ctx context.Context, sk, lastError string) error {
+	if m.failures == nil {
+		m.failures = map[string]string{}
+	}
+	m.failures[sk] = lastError
+	return nil
+}
+
+type mockSender struct {
+	sent []plugin.AggregatedEventTarget
+	err  error
+}
+
+func (m *mockSender) SendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload publisher.EventPayload) error {
+	m.sent = append(m.sent, target)
+	return m.err
+}
+
+type mockRegistry struct {
+	targets []plugin.AggregatedEventTarget
+}
+
+func (m *mockRegistry) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
+	return m.targets
+}
+
+var billingTarget = plugin.AggregatedEventTarget{
+	PluginID:   "billing",
+	TargetType: "sqs",
+	TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:billing",
+}
+
+func deadLetter(sk string) deadletter.Record {
+	return deadletter.Record{
+		PK:         deadletter.PK,
+		SK:         sk,
+		AccountID:  "user-123",
+		EventType:  "account.created",
+		Payload:    `{"eventType":"account.created","accountId":"user-123"}`,
+		PluginID:   billingTarget.PluginID,
+		TargetType: billingTarget.TargetType,
+		TargetArn:  billingTarget.TargetArn,
+	}
+}
+
+func TestHandler_RedrivesAndDeletes(t *testing.T) {
+	store := &mockDeadLetterStore{records: []deadletter.Record{deadLetter("a")}}
+	sender := &mockSender{}
+	deps = &Dependencies{DeadLetters: store, Sender: sender, Registry: &mockRegistry{targets: []plugin.AggregatedEventTarget{billingTarget}}}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != billingTarget {
+		t.Errorf("expected redrive to the stored target, got %+v", sender.sent)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "a" {
+		t.Errorf("expected redriven dead letter to be deleted, got %v", store.deleted)
+	}
+}
+
+func TestHandler_SendFails_KeepsDeadLetter(t *testing.T) {
+	store := &mockDeadLetterStore{records: []deadletter.Record{deadLetter("a")}}
+	deps = &Dependencies{
+		DeadLetters: store,
+		Sender:      &mockSender{err: errors.New("SQS error")},
+		Registry:    &mockRegistry{targets: []plugin.AggregatedEventTarget{billingTarget}},
+	}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.deleted) != 0 {
+		t.Error("expected dead letter to be kept")
+	}
+	if store.failures["a"] != "SQS error" {
+		t.Errorf("expected redrive failure to be recorded, got %v", store.failures)
+	}
+}
+
+func TestHandler_UnsubscribedTarget_Dropped(t *testing.T) {
+	store := &mockDeadLetterStore{records: []deadletter.Record{deadLetter("a")}}
+	sender := &mockSender{}
+	deps = &Dependencies{DeadLetters: store, Sender: sender, Registry: &mockRegistry{}}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(sender.sent) != 0 {
+		t.Error("expected no send to an unsubscribed target")
+	}
+	if len(store.deleted) != 1 {
+		t.Error("expected dead letter to be deleted")
+	}
+}
+
+func TestHandler_ListFails_ReturnsError(t *testing.T) {
+	deps = &Dependencies{
+		DeadLetters: &mockDeadLetterStore{listErr: errors.New("DynamoDB error")},
+		Sender:      &mockSender{},
+		Registry:    &mockRegistry{},
+	}
+
+	if err := handler(context.Background()); err == nil {
+		t.Error("expected error when dead letters cannot be listed")
+	}
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/callbacksig"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"github.com/jarrod-lowe/jmap-service-libs/tracing"
+)
+
+var logger = loglevel.New()
+
+// MaxReplayPerRequest bounds how many events one request replays, so a
+// request finishes within the API Gateway timeout. Events are sent one at a
+// time with retries, so a page must stay small enough for a slow target.
+// Larger replays continue with the returned cursor.
+const MaxReplayPerRequest = 50
+
+// EventLog reads logged events
+type EventLog interface {
+	Query(ctx context.Context, filter eventlog.Filter, cursor string, limit int) ([]publisher.EventPayload, string, error)
+}
+
+// EventSender sends an event to a single target
+type EventSender interface {
+	SendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload publisher.EventPayload) error
+}
+
+// PluginRegistry identifies the calling plugin and its event targets
+type PluginRegistry interface {
+	PluginIDsForPrincipal(callerARN string) []string
+	GetEventTargets(eventType string) []plugin.AggregatedEventTarget
+	CallbackSecretArn(pluginID string) string
+}
+
+// CallbackVerifier checks a callback's signature and rejects replays
+type CallbackVerifier interface {
+	Verify(ctx context.Context, headers map[string]string, body, secretArn string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	EventLog  EventLog
+	Sender    EventSender
+	Registry  PluginRegistry
+	Callbacks CallbackVerifier
+	Now       func() time.Time
+}
+
+var deps *Dependencies
+
+// ReplayRequest is the request body for replaying events. From and To
+// default to the whole retention period, and EventTypes to every event the
+// plugin subscribes to. PluginID is only needed when the caller is a client
+// principal of more than one plugin.
+type ReplayRequest struct {
+	PluginID   string   `json:"pluginId,omitempty"`
+	EventTypes []string `json:"eventTypes,omitempty"`
+	AccountID  string   `json:"accountId,omitempty"`
+	From       string   `json:"from,omitempty"`
+	To         string   `json:"to,omitempty"`
+	Cursor     string   `json:"cursor,omitempty"`
+}
+
+// ReplayResponse reports a replay. Failed events were not sent and are not
+// retried; the caller can repeat the request to send them again.
+type ReplayResponse struct {
+	Replayed   int    `json:"replayed"`
+	Failed     int    `json:"failed"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// ErrorResponse represents an error response
+type ErrorResponse struct {
+	Type        string `json:"type"`
+	Code        string `json:"code,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Response is the API Gateway proxy response
+type Response struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// correlatedHandler gives each request a correlation ID and adds it to the
+// handler's response
+func correlatedHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(resp.Headers, correlationID)
+	return resp, err
+}
+
+// handler replays logged events to the calling plugin's registered targets
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
+	ctx, span := tracing.StartHandlerSpan(ctx, "EventReplayHandler",
+		tracing.Function("event-replay"),
+		tracing.RequestID(request.RequestContext.RequestID),
+	)
+	defer span.End()
+
+	callerPrincipal := request.RequestContext.Identity.UserArn
+	if callerPrincipal == "" {
+		return errorResponse(401, "unauthorized", "Missing or invalid authentication")
+	}
+
+	var req ReplayRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return errorResponse(400, "invalidArguments", "Invalid JSON in request body")
+	}
+
+	pluginIDs := deps.Registry.PluginIDsForPrincipal(callerPrincipal)
+	pluginID := req.PluginID
+	switch {
+	case len(pluginIDs) == 0:
+		logger.WarnContext(ctx, "Unauthorized IAM principal",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("caller_principal", callerPrincipal),
+		)
+		return errorResponse(403, "forbidden", "Principal not authorized for IAM access")
+	case pluginID == "" && len(pluginIDs) > 1:
+		return errorResponse(400, "invalidArguments", "pluginId is required when the principal belongs to more than one plugin")
+	case pluginID == "":
+		pluginID = pluginIDs[0]
+	case !slices.Contains(pluginIDs, pluginID):
+		return errorResponse(403, "forbidden", "Principal not authorized for plugin")
+	}
+
+	if err := deps.Callbacks.Verify(ctx, request.Headers, request.Body, deps.Registry.CallbackSecretArn(pluginID)); err != nil {
+		if errors.Is(err, callbacksig.ErrInvalidSignature) || errors.Is(err, callbacksig.ErrReplayed) {
+			logger.WarnContext(ctx, "Rejected plugin callback",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("plugin_id", pluginID),
+				slog.String("error", err.Error()),
+			)
+			return errorResponse(401, "unauthorized", "Invalid or replayed request signature")
+		}
+		logger.ErrorContext(ctx, "Failed to verify plugin callback",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("plugin_id", pluginID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to verify request signature")
+	}
+
+	filter, errResp := buildFilter(req, pluginID)
+	if errResp != nil {
+		return *errResp, nil
+	}
+
+	if len(filter.EventTypes) == 0 {
+		return errorResponse(400, "invalidArguments", "Plugin is not subscribed to any events")
+	}
+
+	// Find the plugin's target for each event type
+	targets := make(map[string]plugin.AggregatedEventTarget)
+	for _, eventType := range filter.EventTypes {
+		for _, target := range deps.Registry.GetEventTargets(eventType) {
+			if target.PluginID == pluginID {
+				targets[eventType] = target
+			}
+		}
+		if _, ok := targets[eventType]; !ok {
+			return errorResponse(400, "invalidArguments", "Plugin is not subscribed to "+eventType)
+		}
+	}
+
+	payloads, nextCursor, err := deps.EventLog.Query(ctx, filter, req.Cursor, MaxReplayPerRequest)
+	if err != nil {
+		if errors.Is(err, eventlog.ErrInvalidCursor) {
+			return errorResponse(400, "invalidArguments", "Invalid cursor")
+		}
+		logger.ErrorContext(ctx, "Failed to query event log",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return errorResponse(500, "serverFail", "Failed to read event log")
+	}
+
+	response := ReplayResponse{NextCursor: nextCursor}
+	for _, payload := range payloads {
+		if err := deps.Sender.SendTo(ctx, targets[payload.EventType], payload); err != nil {
+			response.Failed++
+			logger.ErrorContext(ctx, "Failed to replay event",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", payload.AccountID),
+				slog.String("event_type", payload.EventType),
+				slog.String("plugin_id", pluginID),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		response.Replayed++
+	}
+
+	logger.InfoContext(ctx, "Replayed events",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("plugin_id", pluginID),
+		slog.Int("replayed", response.Replayed),
+		slog.Int("failed", response.Failed),
+	)
+	return jsonResponse(200, response)
+}
+
+// buildFilter validates the request and applies its defaults
+func buildFilter(req ReplayRequest, pluginID string) (eventlog.Filter, *Response) {
+	now := deps.Now().UTC()
+	filter := eventlog.Filter{
+		EventTypes: req.EventTypes,
+		AccountID:  req.AccountID,
+		From:       now.Add(-eventlog.Retention),
+		To:         now,
+	}
+
+	if req.From != "" {
+		from, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			resp, _ := errorResponse(400, "invalidArguments", "from must be an RFC 3339 timestamp")
+			return filter, &resp
+		}
+		// Events older than the retention period have expired
+		if from.After(filter.From) {
+			filter.From = from
+		}
+	}
+	if req.To != "" {
+		to, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			resp, _ := errorResponse(400, "invalidArguments", "to must be an RFC 3339 timestamp")
+			return filter, &resp
+		}
+		if to.Before(filter.To) {
+			filter.To = to
+		}
+	}
+	if filter.From.After(filter.To) {
+		resp, _ := errorResponse(400, "invalidArguments", "from must not be after to")
+		return filter, &resp
+	}
+
+	if len(filter.EventTypes) == 0 {
+		filter.EventTypes = subscribedEventTypes(pluginID)
+	}
+	return filter, nil
+}
+
+// subscribedEventTypes returns the event types a plugin subscribes to
+func subscribedEventTypes(pluginID string) []string {
+	var eventTypes []string
+	for _, eventType := range replayableEventTypes {
+		for _, target := range deps.Registry.GetEventTargets(eventType) {
+			if target.PluginID == pluginID {
+				eventTypes = append(eventTypes, eventType)
+				break
+			}
+		}
+	}
+	return eventTypes
+}
+
+// replayableEventTypes are the events the publisher logs
+var replayableEventTypes = []string{
+	publisher.EventAccountCreated,
+	publisher.EventQuotaUpdated,
+	publisher.EventUsageReport,
+	publisher.EventUsageThreshold,
+	publisher.EventQuotaWarning,
+	publisher.EventQuotaExceeded,
+	publisher.EventBlobScanRequested,
+	publisher.EventAccountInactive,
+}
+
+// jsonResponse builds a JSON success response
+func jsonResponse(statusCode int, body any) (Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errorResponse(500, "serverFail", "Failed to build response")
+	}
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(data),
+	}, nil
+}
+
+// errorResponse builds an error response with the error type's code
+func errorResponse(statusCode int, errorType, description string) (Response, error) {
+	body, _ := json.Marshal(ErrorResponse{Type: errorType, Code: string(errcode.ForType(errorType)), Description: description})
+	return Response{
+		StatusCode: statusCode,
+		Headers:    map[string]string{"Content-Type": "application/json"},
+		Body:       string(body),
+	}, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx, awsinit.WithHTTPHandler("event-replay"))
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadCore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	// Load plugin registry for client principals and event targets
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	eventPublisher := publisher.FromConfig(result.Config, registry)
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+	deps = &Dependencies{
+		EventLog: eventlog.NewDynamoDBStore(dynamoClient, tableName),
+		Sender:   eventPublisher,
+		Registry: registry,
+		Callbacks: callbacksig.NewVerifier(
+			callbacksig.NewDynamoDBNonceStore(dynamoClient, tableName),
+			secretsmanager.NewFromConfig(result.Config),
+		),
+		Now: time.Now,
+	}
+
+	result.Start(correlatedHandler)
+}
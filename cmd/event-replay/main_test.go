@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/callbacksig"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+const callerARN = "arn:aws:iam::123456789012:role/BillingRole"
+
+type mockEventLog struct {
+	events     []publisher.EventPayload
+	nextCursor string
+	err        error
+	filter     eventlog.Filter
+	cursor     string
+}
+
+func (m *mockEventLog) Query(ctx context.Context, filter eventlog.Filter, cursor string, limit int) ([]publisher.EventPayload, string, error) {
+	m.filter = filter
+	m.cursor = cursor
+	return m.events, m.nextCursor, m.err
+}
+
+type mockSender struct {
+	sent []plugin.AggregatedEventTarget
+	err  error
+}
+
+func (m *mockSender) SendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload publisher.EventPayload) error {
+	m.sent = append(m.sent, target)
+	return m.err
+}
+
+type mockRegistry struct {
+	principals      map[string][]string
+	targets         map[string][]plugin.AggregatedEventTarget
+	callbackSecrets map[string]string
+}
+
+func (m *mockRegistry) PluginIDsForPrincipal(callerARN string) []string {
+	return m.principals[callerARN]
+}
+
+func (m *mockRegistry) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
+	return m.targets[eventType]
+}
+
+func (m *mockRegistry) CallbackSecretArn(pluginID string) string {
+	return m.callbackSecrets[pluginID]
+}
+
+type mockVerifier struct {
+	err       error
+	secretArn string
+}
+
+func (m *mockVerifier) Verify(ctx context.Context, headers map[string]string, body, secretArn string) error {
+	m.secretArn = secretArn
+	return m.err
+}
+
+var billingQueue = plugin.AggregatedEventTarget{
+	PluginID:   "billing",
+	TargetType: "sqs",
+	TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:billing",
+}
+
+var now = time.Date(2026, 3, 20, 0, 0, 0, 0, time.UTC)
+
+func setup(eventLog *mockEventLog, sender *mockSender) {
+	setupWithVerifier(eventLog, sender, &mockVerifier{})
+}
+
+func setupWithVerifier(eventLog *mockEventLog, sender *mockSender, verifier *mockVerifier) {
+	deps = &Dependencies{
+		EventLog: eventLog,
+		Sender:   sender,
+		Registry: &mockRegistry{
+			principals: map[string][]string{callerARN: {"billing"}},
+			targets: map[string][]plugin.AggregatedEventTarget{
+				publisher.EventAccountCreated: {billingQueue, {PluginID: "crm", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:crm"}},
+				publisher.EventUsageReport:    {billingQueue},
+			},
+			callbackSecrets: map[string]string{"billing": "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:jmap-plugin-callback-billing"},
+		},
+		Callbacks: verifier,
+		Now:       func() time.Time { return now },
+	}
+}
+
+func replayRequest(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		HTTPMethod: "POST",
+		Body:       body,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{UserArn: callerARN},
+		},
+	}
+}
+
+func TestHandler_ReplaysToCallersTarget(t *testing.T) {
+	eventLog := &mockEventLog{
+		events:     []publisher.EventPayload{{EventType: publisher.EventAccountCreated, AccountID: "user-123"}},
+		nextCursor: "next",
+	}
+	sender := &mockSender{}
+	setup(eventLog, sender)
+
+	resp, _ := handler(context.Background(), replayRequest(`{"eventTypes":["account.created"],"accountId":"user-123","from":"2026-03-19T00:00:00Z","cursor":"page-2"}`))
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+
+	var body ReplayResponse
+	if err := json.Unmarshal([]byte(resp.Body), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Replayed != 1 || body.Failed != 0 || body.NextCursor != "next" {
+		t.Errorf("unexpected response: %+v", body)
+	}
+	if len(sender.sent) != 1 || sender.sent[0] != billingQueue {
+		t.Errorf("expected replay only to the caller's queue, got %+v", sender.sent)
+	}
+	if eventLog.filter.AccountID != "user-123" || !eventLog.filter.From.Equal(time.Date(2026, 3, 19, 0, 0, 0, 0, time.UTC)) || !eventLog.filter.To.Equal(now) {
+		t.Errorf("unexpected filter: %+v", eventLog.filter)
+	}
+	if eventLog.cursor != "page-2" {
+		t.Errorf("expected cursor to be passed through, got %q", eventLog.cursor)
+	}
+}
+
+func TestHandler_DefaultsToSubscribedEventsAndRetention(t *testing.T) {
+	eventLog := &mockEventLog{}
+	setup(eventLog, &mockSender{})
+
+	resp, _ := handler(context.Background(), replayRequest(`{"from":"2020-01-01T00:00:00Z"}`))
+	if resp.StatusCode != 200 {
+		t.Fatalf("expected 200, got %d: %s", resp.StatusCode, resp.Body)
+	}
+	if len(eventLog.filter.EventTypes) != 2 {
+		t.Errorf("expected the plugin's subscribed event types, got %v", eventLog.filter.EventTypes)
+	}
+	if !eventLog.filter.From.Equal(now.Add(-eventlog.Retention)) {
+		t.Errorf("expected from to be clamped to retention, got %v", eventLog.filter.From)
+	}
+}
+
+func TestHandler_SendFailures_ReportedAsPartial(t *testing.T) {
+	eventLog := &mockEventLog{events: []publisher.EventPayload{
+		{EventType: publisher.EventAccountCreated},
+		{EventType: publisher.EventAccountCreated},
+	}}
+	setup(eventLog, &mockSender{err: errors.New("SQS error")})
+
+	resp, _ := handler(context.Background(), replayRequest(`{"eventTypes":["account.created"]}`))
+	var body ReplayResponse
+	_ = json.Unmarshal([]byte(resp.Body), &body)
+	if resp.StatusCode != 200 || body.Failed != 2 || body.Replayed != 0 {
+		t.Errorf("expected failures to be reported, got %d %+v", resp.StatusCode, body)
+	}
+}
+
+func TestHandler_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		request events.APIGatewayProxyRequest
+		logErr  error
+		status  int
+	}{
+		{name: "no principal", request: events.APIGatewayProxyRequest{Body: `{}`}, status: 401},
+		{name: "unknown principal", request: func() events.APIGatewayProxyRequest {
+			r := replayRequest(`{}`)
+			r.RequestContext.Identity.UserArn = "arn:aws:iam::123456789012:role/Other"
+			return r
+		}(), status: 403},
+		{name: "other plugin", request: replayRequest(`{"pluginId":"crm"}`), status: 403},
+		{name: "invalid JSON", request: replayRequest(`{`), status: 400},
+		{name: "unsubscribed event", request: replayRequest(`{"eventTypes":["quota.updated"]}`), status: 400},
+		{name: "invalid from", request: replayRequest(`{"from":"yesterday"}`), status: 400},
+		{name: "from after to", request: replayRequest(`{"from":"2026-03-19T00:00:00Z","to":"2026-03-18T00:00:00Z"}`), status: 400},
+		{name: "invalid cursor", request: replayRequest(`{"cursor":"bad"}`), logErr: eventlog.ErrInvalidCursor, status: 400},
+		{name: "query failure", request: replayRequest(`{}`), logErr: errors.New("DynamoDB error"), status: 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setup(&mockEventLog{err: tc.logErr}, &mockSender{})
+
+			resp, _ := handler(context.Background(), tc.request)
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected %d, got %d: %s", tc.status, resp.StatusCode, resp.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_VerifiesCallbackSignature(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+	}{
+		{name: "valid", status: 200},
+		{name: "bad signature", err: callbacksig.ErrInvalidSignature, status: 401},
+		{name: "replayed", err: callbacksig.ErrReplayed, status: 401},
+		{name: "verification failure", err: errors.New("DynamoDB error"), status: 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := &mockSender{}
+			verifier := &mockVerifier{err: tc.err}
+			setupWithVerifier(&mockEventLog{events: []publisher.EventPayload{{EventType: publisher.EventAccountCreated}}}, sender, verifier)
+
+			resp, _ := handler(context.Background(), replayRequest(`{"eventTypes":["account.created"]}`))
+			if resp.StatusCode != tc.status {
+				t.Errorf("expected %d, got %d: %s", tc.status, resp.StatusCode, resp.Body)
+			}
+			if verifier.secretArn != "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:jmap-plugin-callback-billing" {
+				t.Errorf("expected the plugin's callback secret, got %q", verifier.secretArn)
+			}
+			if tc.status != 200 && len(sender.sent) != 0 {
+				t.Errorf("expected nothing replayed, got %+v", sender.sent)
+			}
+		})
+	}
+}
@@ -5,17 +5,33 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sessionstate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // AccountStore defines the interface for account operations
 type AccountStore interface {
@@ -25,9 +41,58 @@ type AccountStore interface {
 // accountStore is the package-level account store (injectable for testing)
 var accountStore AccountStore
 
+// AliasLister lists the aliases registered for an account
+type AliasLister interface {
+	ListAliases(ctx context.Context, accountID string) ([]account.Alias, error)
+}
+
+// aliasStore is the package-level alias store (injectable for testing)
+var aliasStore AliasLister
+
+// MetaReader reads an account's META# record
+type MetaReader interface {
+	GetMeta(ctx context.Context, accountID string) (*account.Meta, error)
+}
+
+// metaStore is the package-level account record reader long-polls re-read
+// the account with (injectable for testing)
+var metaStore MetaReader
+
+// maxWait is the longest a long-polling client is held; zero disables long
+// polling (set in main, injectable for testing)
+var maxWait time.Duration
+
+// statePollInterval is how often a long poll re-reads the account
+// (injectable for testing)
+var statePollInterval = 2 * time.Second
+
 // pluginRegistry holds loaded plugin configuration (injectable for testing)
 var pluginRegistry *plugin.Registry
 
+// accountFeatures holds per-accountType features (injectable for testing)
+var accountFeatures account.FeatureFlags
+
+// corsPolicy decides which browser origins may fetch the session (injectable for testing)
+var corsPolicy *cors.Policy
+
+// Clients name a session client profile with the profile query parameter or
+// the X-JMAP-Client-Profile header; the query parameter wins if both are set
+const (
+	clientProfileParam  = "profile"
+	clientProfileHeader = "X-JMAP-Client-Profile"
+)
+
+// A client long-polls by sending the session state it has in the state
+// query parameter and the seconds it will wait for a change in wait
+const (
+	stateParam = "state"
+	waitParam  = "wait"
+)
+
+// deadlineMargin is kept free before the invocation deadline when a long
+// poll is limited by it, to build and return the session
+const deadlineMargin = time.Second
+
 // JMAPSession represents the JMAP Session object per RFC 8620
 type JMAPSession struct {
 	Capabilities    map[string]any     `json:"capabilities"`
@@ -61,18 +126,27 @@ type Config struct {
 	APIDomain string
 }
 
-// LoadConfig loads configuration from environment variables
-func LoadConfig() Config {
-	domain := os.Getenv("API_DOMAIN")
-	if domain == "" {
-		domain = "localhost"
+// sessionConfig holds the session settings (set in main, injectable for testing)
+var sessionConfig = Config{APIDomain: "localhost"}
+
+// accountIDClaim names the authorizer claim holding a user's account ID
+// (set in main, injectable for testing)
+var accountIDClaim = auth.DefaultAccountIDClaim
+
+// corsHandler answers CORS preflights, gives each request a correlation ID,
+// and adds CORS headers and the correlation ID to the handler's responses
+func corsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	if cors.IsPreflight(request.HTTPMethod) {
+		return Response{StatusCode: 204, Headers: corsPolicy.Preflight(request.Headers)}, nil
 	}
-	return Config{APIDomain: domain}
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(corsPolicy.Apply(request.Headers, resp.Headers), correlationID)
+	return resp, err
 }
 
-var config = LoadConfig()
-
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
 	ctx, span := tracing.StartHandlerSpan(ctx, "GetJmapSessionHandler",
 		tracing.Function("get-jmap-session"),
 		tracing.RequestID(request.RequestContext.RequestID),
@@ -80,39 +154,74 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	defer span.End()
 
 	// Extract sub claim from Cognito authorizer
-	userID, err := extractSubClaim(request)
+	userID, err := extractSubClaim(request, accountIDClaim)
 	if err != nil {
 		logger.WarnContext(ctx, "Missing or invalid sub claim",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return Response{
-			StatusCode: 401,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-			Body:       `{"error":"Unauthorized","message":"Missing or invalid authentication"}`,
-		}, nil
+		return problemResponse(ctx, problem.New(401, "unauthorized", "Missing or invalid authentication")), nil
 	}
 
 	span.SetAttributes(tracing.AccountID(userID))
 
+	// A client profile limits the session to the capabilities it lists
+	profileName := clientProfileName(request)
+	var profile []string
+	if profileName != "" {
+		var ok bool
+		if pluginRegistry != nil {
+			profile, ok = pluginRegistry.ClientProfile(profileName)
+		}
+		if !ok {
+			logger.WarnContext(ctx, "Unknown client profile",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", userID),
+				slog.String("client_profile", profileName),
+			)
+			return problemResponse(ctx, problem.New(400, "invalidArguments", fmt.Sprintf("Unknown client profile %q", profileName))), nil
+		}
+	}
+
+	wait, err := waitDuration(ctx, request)
+	if err != nil {
+		return problemResponse(ctx, problem.New(400, "invalidArguments", err.Error())), nil
+	}
+
 	logger.InfoContext(ctx, "Processing session request",
 		slog.String("request_id", request.RequestContext.RequestID),
 		slog.String("account_id", userID),
 	)
 
 	// Ensure account exists and update lastDiscoveryAccess
-	_, err = accountStore.EnsureAccount(ctx, userID)
+	acct, err := accountStore.EnsureAccount(ctx, userID)
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to ensure account",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("account_id", userID),
 			slog.String("error", err.Error()),
 		)
-		return Response{
-			StatusCode: 500,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-			Body:       `{"error":"Internal server error"}`,
-		}, nil
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to retrieve account")), nil
+	}
+
+	settings := sessionstate.Account{
+		AccountType:         acct.AccountType,
+		WritesDisabled:      acct.WritesDisabled,
+		CapabilityOverrides: acct.CapabilityOverrides,
+	}
+
+	// A long-polling client that already has the current state is held
+	// until the state changes or its wait is over
+	if wait > 0 && request.QueryStringParameters[stateParam] == sessionState(settings) {
+		settings, err = waitForStateChange(ctx, userID, settings, wait)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to read account while waiting for a session change",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", userID),
+				slog.String("error", err.Error()),
+			)
+			return problemResponse(ctx, problem.New(500, "serverFail", "Failed to retrieve account")), nil
+		}
 	}
 
 	stage := request.RequestContext.Stage
@@ -120,18 +229,45 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		stage = "v1"
 	}
 
-	session := buildSession(userID, config, pluginRegistry, stage)
+	session := buildSession(userID, sessionConfig, pluginRegistry, stage, accountFeatures.For(settings.AccountType))
+	session.State = sessionState(settings)
+
+	// Tell clients up front when the account's writes are disabled, and
+	// apply the account's own capability settings
+	sessionAccount := session.Accounts[userID]
+	sessionAccount.IsReadOnly = settings.WritesDisabled
+	applyCapabilityOverrides(sessionAccount.AccountCapabilities, settings.CapabilityOverrides)
+	session.Accounts[userID] = sessionAccount
+
+	if profileName != "" {
+		applyClientProfile(&session, profile)
+	}
+
+	// Name the account by its first alias so clients can show something
+	// friendlier than the Cognito sub
+	if aliasStore != nil {
+		aliases, err := aliasStore.ListAliases(ctx, userID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to list account aliases",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", userID),
+				slog.String("error", err.Error()),
+			)
+			return problemResponse(ctx, problem.New(500, "serverFail", "Failed to list account aliases")), nil
+		}
+		if len(aliases) > 0 {
+			sessionAccount := session.Accounts[userID]
+			sessionAccount.Name = aliases[0].Alias
+			session.Accounts[userID] = sessionAccount
+		}
+	}
 
 	bodyJSON, err := json.Marshal(session)
 	if err != nil {
 		logger.ErrorContext(ctx, "Failed to marshal session",
 			slog.String("error", err.Error()),
 		)
-		return Response{
-			StatusCode: 500,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-			Body:       `{"error":"Internal server error"}`,
-		}, nil
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to build session")), nil
 	}
 
 	logger.InfoContext(ctx, "Session request completed",
@@ -146,26 +282,144 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	}, nil
 }
 
-func extractSubClaim(request events.APIGatewayProxyRequest) (string, error) {
+// problemResponse builds a response carrying a problem
+func problemResponse(ctx context.Context, p *problem.Problem) Response {
+	return Response{
+		StatusCode: p.Status,
+		Headers:    problem.Headers(),
+		Body:       p.Body(ctx),
+	}
+}
+
+func extractSubClaim(request events.APIGatewayProxyRequest, claim string) (string, error) {
 	authorizer := request.RequestContext.Authorizer
 	if authorizer == nil {
 		return "", fmt.Errorf("no authorizer context")
 	}
 
-	claims, ok := authorizer["claims"].(map[string]any)
-	if !ok {
-		return "", fmt.Errorf("no claims in authorizer")
+	return auth.AccountIDFromAuthorizer(authorizer, claim)
+}
+
+// waitDuration returns how long the request asks to wait for a session
+// change, limited to maxWait and to the invocation's deadline. Zero means
+// answer straight away.
+func waitDuration(ctx context.Context, request events.APIGatewayProxyRequest) (time.Duration, error) {
+	value := strings.TrimSpace(request.QueryStringParameters[waitParam])
+	if value == "" {
+		return 0, nil
+	}
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative number of seconds", waitParam)
+	}
+
+	wait := min(time.Duration(seconds)*time.Second, maxWait)
+	if deadline, ok := ctx.Deadline(); ok {
+		wait = min(wait, time.Until(deadline)-deadlineMargin)
+	}
+	return max(wait, 0), nil
+}
+
+// sessionState returns the session state for an account's settings and the
+// loaded registry
+func sessionState(settings sessionstate.Account) string {
+	fingerprint := ""
+	if pluginRegistry != nil {
+		fingerprint = pluginRegistry.Fingerprint()
+	}
+	return sessionstate.Compute(fingerprint, settings)
+}
+
+// waitForStateChange re-reads the account every statePollInterval until its
+// session state differs from the one for settings, or wait has passed, and
+// returns the settings last read. A registry refreshed in the background
+// while waiting changes the state too.
+func waitForStateChange(ctx context.Context, userID string, settings sessionstate.Account, wait time.Duration) (sessionstate.Account, error) {
+	known := sessionState(settings)
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	ticker := time.NewTicker(statePollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return settings, nil
+		case <-timeout.C:
+			return settings, nil
+		case <-ticker.C:
+		}
+
+		meta, err := metaStore.GetMeta(ctx, userID)
+		if err != nil {
+			return settings, err
+		}
+		if meta != nil {
+			settings = sessionstate.FromMeta(meta)
+		}
+		if sessionState(settings) != known {
+			return settings, nil
+		}
+	}
+}
+
+// applyCapabilityOverrides merges an account's capability overrides into its
+// accountCapabilities. Overrides for capabilities the session does not offer
+// are ignored. Settings are copied, so the registry's config is unchanged.
+func applyCapabilityOverrides(accountCapabilities map[string]any, overrides map[string]map[string]any) {
+	for cap, settings := range overrides {
+		current, ok := accountCapabilities[cap]
+		if !ok {
+			continue
+		}
+		merged := make(map[string]any)
+		if currentSettings, ok := current.(map[string]any); ok {
+			maps.Copy(merged, currentSettings)
+		}
+		maps.Copy(merged, settings)
+		accountCapabilities[cap] = merged
 	}
+}
 
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("sub claim not found or empty")
+// clientProfileName returns the session client profile the request names,
+// or "" if it names none
+func clientProfileName(request events.APIGatewayProxyRequest) string {
+	if name := strings.TrimSpace(request.QueryStringParameters[clientProfileParam]); name != "" {
+		return name
 	}
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, clientProfileHeader) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
 
-	return sub, nil
+// applyClientProfile removes the capabilities a client profile does not list
+// from the session's capabilities, accountCapabilities and primaryAccounts.
+// The core capability is always kept, as RFC 8620 requires it.
+func applyClientProfile(session *JMAPSession, profile []string) {
+	keep := func(capability string) bool {
+		return capability == account.CoreCapability || slices.Contains(profile, capability)
+	}
+	for capability := range session.Capabilities {
+		if !keep(capability) {
+			delete(session.Capabilities, capability)
+			delete(session.PrimaryAccounts, capability)
+		}
+	}
+	for _, sessionAccount := range session.Accounts {
+		for capability := range sessionAccount.AccountCapabilities {
+			if !keep(capability) {
+				delete(sessionAccount.AccountCapabilities, capability)
+			}
+		}
+	}
 }
 
-func buildSession(userID string, cfg Config, registry *plugin.Registry, stage string) JMAPSession {
+// buildSession builds the session for a user, offering only the capabilities
+// and blob sizes their account type's features allow
+func buildSession(userID string, cfg Config, registry *plugin.Registry, stage string, features account.Features) JMAPSession {
 	if stage == "" {
 		stage = "v1"
 	}
@@ -178,10 +432,19 @@ func buildSession(userID string, cfg Config, registry *plugin.Registry, stage st
 
 	if registry != nil {
 		for _, cap := range registry.GetCapabilities() {
+			if !features.AllowsCapability(cap) {
+				continue
+			}
 			capConfig := registry.GetCapabilityConfig(cap)
 			if capConfig == nil {
 				capConfig = map[string]any{}
 			}
+			switch cap {
+			case account.CoreCapability:
+				capConfig = limitSize(capConfig, "maxSizeUpload", features)
+			case "https://jmap.rrod.net/extensions/upload-put":
+				capConfig = limitSize(capConfig, "maxSizeUploadPut", features)
+			}
 			capabilities[cap] = capConfig
 			// For upload-put extension, include config in account capabilities
 			// so clients know the limits for this account
@@ -213,6 +476,32 @@ func buildSession(userID string, cfg Config, registry *plugin.Registry, stage st
 	}
 }
 
+// limitSize returns a copy of a capability config with a size limit lowered to
+// the account type's MaxBlobSize. The registry's config is shared between
+// requests, so it is never modified in place.
+func limitSize(capConfig map[string]any, key string, features account.Features) map[string]any {
+	if features.MaxBlobSize == 0 {
+		return capConfig
+	}
+
+	var current int64
+	switch v := capConfig[key].(type) {
+	case float64:
+		current = int64(v)
+	case int64:
+		current = v
+	case int:
+		current = int64(v)
+	}
+
+	limited := make(map[string]any, len(capConfig)+1)
+	for k, v := range capConfig {
+		limited[k] = v
+	}
+	limited[key] = features.BlobSizeLimit(current)
+	return limited
+}
+
 func main() {
 	ctx := context.Background()
 
@@ -225,23 +514,75 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Initialize DynamoDB client with OTel instrumentation
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadSession(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	tableName := cfg.Table
+	sessionConfig = Config{APIDomain: cfg.APIDomain}
+	accountIDClaim = cfg.AccountIDClaim
+	accountFeatures = cfg.Features
+	corsPolicy = cors.New(cfg.CORSOrigins, "GET")
+	maxWait = cfg.MaxWait
+
+	// Initialize DynamoDB client with OTel instrumentation
 	dbClient := db.NewClientFromConfig(result.Config, tableName)
 	accountStore = dbClient
-
-	// Load plugin registry
-	pluginRegistry = plugin.NewRegistry()
-	if err := pluginRegistry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
+	accounts := account.NewDynamoDBStore(store.NewRetryClient(dynamodb.NewFromConfig(result.Config)), tableName)
+	aliasStore = accounts
+	metaStore = accounts
+
+	// Load plugin registry, from this environment's snapshot when
+	// there is one, refreshing it from DynamoDB in the background
+	pluginRegistry, err = plugin.LoadWithSnapshot(result.Ctx, dbClient, plugin.SnapshotPath(tableName), func(err error) {
+		logger.Warn("Plugin registry snapshot failed",
+			slog.String("error", err.Error()),
+		)
+	})
+	if err != nil {
 		logger.Error("FATAL: Failed to load plugin registry",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
 
-	result.Start(handler)
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, corsHandler, "GET /.well-known/jmap", "OPTIONS /.well-known/jmap")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	result.Start(corsHandler)
 }
@@ -4,13 +4,19 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sessionstate"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace/noop"
 )
@@ -74,6 +80,10 @@ func setupTest() {
 	otel.SetTracerProvider(tp)
 	// Use a mock account store for tests
 	accountStore = &mockAccountStore{}
+	aliasStore = nil
+	metaStore = nil
+	maxWait = 0
+	accountFeatures = nil
 	// Create a registry with core capability loaded
 	pluginRegistry = plugin.NewRegistry()
 	mock := &mockPluginQuerier{
@@ -161,6 +171,16 @@ func TestHandler_MissingSub_Returns401(t *testing.T) {
 	if response.StatusCode != 401 {
 		t.Errorf("expected status code 401, got %d", response.StatusCode)
 	}
+	if response.Headers["Content-Type"] != problem.ContentType {
+		t.Errorf("expected a problem content type, got %q", response.Headers["Content-Type"])
+	}
+	var body problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if body.Type != problem.TypeURI("unauthorized") || body.Status != 401 || body.Code != "CORE-3001" {
+		t.Errorf("unexpected problem %+v", body)
+	}
 }
 
 func TestHandler_ResponseContentType(t *testing.T) {
@@ -330,7 +350,7 @@ func TestHandler_CoreCapabilityValues(t *testing.T) {
 // This test uses direct Config injection - no environment variables needed
 func TestBuildSession_WithInjectedConfig(t *testing.T) {
 	cfg := Config{APIDomain: "test.example.com"}
-	session := buildSession("user-123", cfg, nil, "v1")
+	session := buildSession("user-123", cfg, nil, "v1", account.Features{})
 
 	// Verify URLs use the injected domain
 	expectedAPIUrl := "https://test.example.com/v1/jmap"
@@ -365,7 +385,7 @@ func TestBuildSession_WithInjectedConfig(t *testing.T) {
 
 func TestBuildSession_E2EStage(t *testing.T) {
 	cfg := Config{APIDomain: "test.example.com"}
-	session := buildSession("user-123", cfg, nil, "e2e")
+	session := buildSession("user-123", cfg, nil, "e2e", account.Features{})
 
 	expectedAPIUrl := "https://test.example.com/e2e/jmap"
 	if session.APIUrl != expectedAPIUrl {
@@ -385,7 +405,7 @@ func TestBuildSession_E2EStage(t *testing.T) {
 
 func TestBuildSession_EmptyStageDefaultsToV1(t *testing.T) {
 	cfg := Config{APIDomain: "test.example.com"}
-	session := buildSession("user-123", cfg, nil, "")
+	session := buildSession("user-123", cfg, nil, "", account.Features{})
 
 	expectedAPIUrl := "https://test.example.com/v1/jmap"
 	if session.APIUrl != expectedAPIUrl {
@@ -420,6 +440,101 @@ func TestHandler_CallsEnsureAccount(t *testing.T) {
 	}
 }
 
+func TestHandler_WritesDisabled_AccountIsReadOnly(t *testing.T) {
+	setupTest()
+	accountStore = &mockAccountStore{
+		ensureAccountFunc: func(ctx context.Context, userID string) (*db.Account, error) {
+			return &db.Account{UserID: userID, WritesDisabled: true}, nil
+		},
+	}
+
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to unmarshal response body: %v", err)
+	}
+	if !session.Accounts["user-123"].IsReadOnly {
+		t.Error("expected account to be read-only while writes are disabled")
+	}
+}
+
+func TestHandler_CapabilityOverrides_MergedIntoAccountCapabilities(t *testing.T) {
+	setupTest()
+	accountStore = &mockAccountStore{
+		ensureAccountFunc: func(ctx context.Context, userID string) (*db.Account, error) {
+			return &db.Account{UserID: userID, CapabilityOverrides: map[string]map[string]any{
+				"urn:ietf:params:jmap:core":         {"maxSizeUpload": float64(1000)},
+				"https://example.com/not-installed": {"enabled": true},
+			}}, nil
+		},
+	}
+
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to unmarshal response body: %v", err)
+	}
+	accountCaps := session.Accounts["user-123"].AccountCapabilities
+	core, _ := accountCaps["urn:ietf:params:jmap:core"].(map[string]any)
+	if core["maxSizeUpload"] != float64(1000) {
+		t.Errorf("expected overridden maxSizeUpload, got %v", core)
+	}
+	if _, ok := accountCaps["https://example.com/not-installed"]; ok {
+		t.Error("expected override for a capability not offered to be ignored")
+	}
+	sessionCore := session.Capabilities["urn:ietf:params:jmap:core"].(map[string]any)
+	if sessionCore["maxSizeUpload"] != float64(50000000) {
+		t.Errorf("expected session capability to be unchanged, got %v", sessionCore["maxSizeUpload"])
+	}
+}
+
+func TestApplyCapabilityOverrides_DoesNotModifySharedConfig(t *testing.T) {
+	shared := map[string]any{"maxSizeUploadPut": float64(5000), "other": "kept"}
+	accountCaps := map[string]any{"https://jmap.rrod.net/extensions/upload-put": shared}
+
+	applyCapabilityOverrides(accountCaps, map[string]map[string]any{
+		"https://jmap.rrod.net/extensions/upload-put": {"maxSizeUploadPut": float64(100)},
+	})
+
+	merged := accountCaps["https://jmap.rrod.net/extensions/upload-put"].(map[string]any)
+	if merged["maxSizeUploadPut"] != float64(100) || merged["other"] != "kept" {
+		t.Errorf("unexpected merged settings: %v", merged)
+	}
+	if shared["maxSizeUploadPut"] != float64(5000) {
+		t.Errorf("expected shared config to be unchanged, got %v", shared)
+	}
+}
+
 func TestHandler_EnsureAccountError_Returns500(t *testing.T) {
 	setupTest()
 	mock := &mockAccountStore{
@@ -453,3 +568,389 @@ func TestHandler_EnsureAccountError_Returns500(t *testing.T) {
 
 // Ensure errors import is used
 var _ = errors.New
+
+// mockAliasStore implements AliasLister for testing
+type mockAliasStore struct {
+	aliases []account.Alias
+	err     error
+}
+
+func (m *mockAliasStore) ListAliases(ctx context.Context, accountID string) ([]account.Alias, error) {
+	return m.aliases, m.err
+}
+
+func TestHandler_AccountWithAlias_UsesAliasAsName(t *testing.T) {
+	setupTest()
+	aliasStore = &mockAliasStore{aliases: []account.Alias{{Alias: "alice@example.com", AccountID: "user-123"}}}
+
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to parse session: %v", err)
+	}
+	if session.Accounts["user-123"].Name != "alice@example.com" {
+		t.Errorf("expected account name alice@example.com, got %q", session.Accounts["user-123"].Name)
+	}
+}
+
+func TestHandler_ListAliasesError_Returns500(t *testing.T) {
+	setupTest()
+	aliasStore = &mockAliasStore{err: errors.New("DynamoDB error")}
+
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+func TestHandler_AccountTypeFeatures_LimitSession(t *testing.T) {
+	setupTest()
+	pluginRegistry.AddCapability("urn:ietf:params:jmap:calendars")
+	accountStore = &mockAccountStore{
+		ensureAccountFunc: func(ctx context.Context, userID string) (*db.Account, error) {
+			return &db.Account{UserID: userID, AccountType: "trial"}, nil
+		},
+	}
+	accountFeatures = account.FeatureFlags{"trial": {MaxBlobSize: 1000, Capabilities: []string{"urn:ietf:params:jmap:mail"}}}
+
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to parse session: %v", err)
+	}
+	if _, ok := session.Capabilities["urn:ietf:params:jmap:calendars"]; ok {
+		t.Error("expected capability outside the account type subset to be hidden")
+	}
+	core, ok := session.Capabilities["urn:ietf:params:jmap:core"].(map[string]any)
+	if !ok {
+		t.Fatal("expected core capability to always be offered")
+	}
+	if core["maxSizeUpload"] != float64(1000) {
+		t.Errorf("expected maxSizeUpload lowered to 1000, got %v", core["maxSizeUpload"])
+	}
+
+	// The shared registry config must not be modified
+	if pluginRegistry.GetCapabilityConfig("urn:ietf:params:jmap:core")["maxSizeUpload"] != float64(50000000) {
+		t.Error("expected registry capability config to be unchanged")
+	}
+}
+
+func TestCORSHandler_PreflightAndResponseHeaders(t *testing.T) {
+	setupTest()
+	corsPolicy = cors.New([]string{"https://app.example.com"}, "GET")
+	ctx := context.Background()
+
+	preflight, err := corsHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "OPTIONS",
+		Headers:    map[string]string{"Origin": "https://app.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if preflight.StatusCode != 204 || preflight.Headers["Access-Control-Allow-Methods"] != "GET,OPTIONS" {
+		t.Errorf("unexpected preflight response: %d %v", preflight.StatusCode, preflight.Headers)
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Headers: map[string]string{"origin": "https://app.example.com"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
+	}
+	response, err := corsHandler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.Headers["Access-Control-Allow-Origin"] != "https://app.example.com" || response.Headers["Vary"] != "Origin" {
+		t.Errorf("expected CORS headers on the response, got %v", response.Headers)
+	}
+}
+
+// profileRequest is a session request naming a client profile in the query
+// string and, if set, the header
+func profileRequest(param, header string) events.APIGatewayProxyRequest {
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+	if param != "" {
+		request.QueryStringParameters = map[string]string{"profile": param}
+	}
+	if header != "" {
+		request.Headers = map[string]string{"x-jmap-client-profile": header}
+	}
+	return request
+}
+
+func setupProfileTest() {
+	setupTest()
+	pluginRegistry.AddCapabilityConfig("urn:ietf:params:jmap:mail", map[string]any{})
+	pluginRegistry.AddCapabilityConfig("https://jmap.rrod.net/extensions/upload-put", map[string]any{"maxSizeUploadPut": float64(1000)})
+	pluginRegistry.AddClientProfile("minimal", "urn:ietf:params:jmap:mail")
+}
+
+func TestHandler_ClientProfile_FiltersCapabilities(t *testing.T) {
+	for name, request := range map[string]events.APIGatewayProxyRequest{
+		"query parameter": profileRequest("minimal", ""),
+		"header":          profileRequest("", "minimal"),
+		"query wins":      profileRequest("minimal", "unknown"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			setupProfileTest()
+
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != 200 {
+				t.Fatalf("expected status code 200, got %d: %s", response.StatusCode, response.Body)
+			}
+
+			var session JMAPSession
+			if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+				t.Fatalf("failed to unmarshal response body: %v", err)
+			}
+			want := []string{"urn:ietf:params:jmap:core", "urn:ietf:params:jmap:mail"}
+			for _, caps := range []map[string]any{session.Capabilities, session.Accounts["user-123"].AccountCapabilities} {
+				if len(caps) != len(want) {
+					t.Errorf("expected only %v, got %v", want, caps)
+				}
+				for _, capability := range want {
+					if _, ok := caps[capability]; !ok {
+						t.Errorf("expected %s in %v", capability, caps)
+					}
+				}
+			}
+			if _, ok := session.PrimaryAccounts["https://jmap.rrod.net/extensions/upload-put"]; ok {
+				t.Error("expected upload-put removed from primaryAccounts")
+			}
+		})
+	}
+}
+
+func TestHandler_NoClientProfile_ListsAllCapabilities(t *testing.T) {
+	setupProfileTest()
+
+	response, err := handler(context.Background(), profileRequest("", ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to unmarshal response body: %v", err)
+	}
+	if len(session.Capabilities) != 3 {
+		t.Errorf("expected all three capabilities, got %v", session.Capabilities)
+	}
+}
+
+func TestHandler_UnknownClientProfile_Returns400(t *testing.T) {
+	setupProfileTest()
+	store := &mockAccountStore{}
+	accountStore = store
+
+	response, err := handler(context.Background(), profileRequest("unknown", ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 400 {
+		t.Fatalf("expected status code 400, got %d", response.StatusCode)
+	}
+	var body problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if body.Type != problem.TypeURI("invalidArguments") {
+		t.Errorf("expected invalidArguments, got %+v", body)
+	}
+	if store.calledWith != "" {
+		t.Error("expected the account not to be touched")
+	}
+}
+
+// mockMetaStore implements MetaReader, returning metas in turn and then the
+// last one
+type mockMetaStore struct {
+	mu    sync.Mutex
+	metas []*account.Meta
+	calls int
+}
+
+func (m *mockMetaStore) GetMeta(ctx context.Context, accountID string) (*account.Meta, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	meta := m.metas[min(m.calls, len(m.metas)-1)]
+	m.calls++
+	return meta, nil
+}
+
+func longPollRequest(state, wait string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		QueryStringParameters: map[string]string{"state": state, "wait": wait},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "test-request-id",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
+	}
+}
+
+func decodeSession(t *testing.T, response Response) JMAPSession {
+	t.Helper()
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d: %s", response.StatusCode, response.Body)
+	}
+	var session JMAPSession
+	if err := json.Unmarshal([]byte(response.Body), &session); err != nil {
+		t.Fatalf("failed to unmarshal response body: %v", err)
+	}
+	return session
+}
+
+func TestHandler_SessionState_TracksAccountSettings(t *testing.T) {
+	setupTest()
+
+	response, err := handler(context.Background(), longPollRequest("", ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	session := decodeSession(t, response)
+	if want := sessionstate.Compute(pluginRegistry.Fingerprint(), sessionstate.Account{}); session.State != want {
+		t.Errorf("expected state %q, got %q", want, session.State)
+	}
+
+	accountStore = &mockAccountStore{
+		ensureAccountFunc: func(ctx context.Context, userID string) (*db.Account, error) {
+			return &db.Account{UserID: userID, WritesDisabled: true}, nil
+		},
+	}
+	response, err = handler(context.Background(), longPollRequest("", ""))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if decodeSession(t, response).State == session.State {
+		t.Error("expected disabling writes to change the session state")
+	}
+}
+
+func TestHandler_LongPoll_ReturnsOnChange(t *testing.T) {
+	setupTest()
+	maxWait = 5 * time.Second
+	statePollInterval = time.Millisecond
+	store := &mockMetaStore{metas: []*account.Meta{{}, {WritesDisabled: true}}}
+	metaStore = store
+	current := sessionstate.Compute(pluginRegistry.Fingerprint(), sessionstate.Account{})
+
+	response, err := handler(context.Background(), longPollRequest(current, "5"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	session := decodeSession(t, response)
+	if session.State == current || !session.Accounts["user-123"].IsReadOnly {
+		t.Errorf("expected the changed session, got state %q and %+v", session.State, session.Accounts["user-123"])
+	}
+	if store.calls != 2 {
+		t.Errorf("expected the account read until it changed, got %d reads", store.calls)
+	}
+}
+
+func TestHandler_LongPoll_TimesOutWithSameState(t *testing.T) {
+	setupTest()
+	maxWait = 50 * time.Millisecond
+	statePollInterval = 5 * time.Millisecond
+	metaStore = &mockMetaStore{metas: []*account.Meta{{}}}
+	current := sessionstate.Compute(pluginRegistry.Fingerprint(), sessionstate.Account{})
+
+	start := time.Now()
+	response, err := handler(context.Background(), longPollRequest(current, "20"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if decodeSession(t, response).State != current {
+		t.Error("expected the unchanged state after the wait")
+	}
+	if elapsed := time.Since(start); elapsed < maxWait || elapsed > time.Second {
+		t.Errorf("expected the wait limited to %v, took %v", maxWait, elapsed)
+	}
+}
+
+func TestHandler_LongPoll_StaleStateAnswersAtOnce(t *testing.T) {
+	setupTest()
+	maxWait = 5 * time.Second
+	store := &mockMetaStore{metas: []*account.Meta{{}}}
+	metaStore = store
+
+	response, err := handler(context.Background(), longPollRequest("old-state", "5"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	decodeSession(t, response)
+	if store.calls != 0 {
+		t.Errorf("expected no wait for a client with an old state, got %d reads", store.calls)
+	}
+}
+
+func TestHandler_LongPoll_InvalidWait_Returns400(t *testing.T) {
+	setupTest()
+
+	for _, wait := range []string{"-1", "soon", "1.5"} {
+		response, err := handler(context.Background(), longPollRequest("", wait))
+		if err != nil {
+			t.Fatalf("handler returned error: %v", err)
+		}
+		if response.StatusCode != 400 {
+			t.Errorf("wait=%s: expected status code 400, got %d", wait, response.StatusCode)
+		}
+	}
+}
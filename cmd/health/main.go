@@ -0,0 +1,347 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"github.com/jarrod-lowe/jmap-service-libs/tracing"
+)
+
+var logger = loglevel.New()
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultCheckTimeout bounds each dependency check
+const DefaultCheckTimeout = 3 * time.Second
+
+// DefaultCacheTTL is how long a result is reused, so frequent unauthenticated
+// polling doesn't turn into a call to every dependency
+const DefaultCacheTTL = 10 * time.Second
+
+// Checker checks that one dependency is reachable. Details are included in
+// the response; errors are only logged, as the endpoint is unauthenticated.
+type Checker interface {
+	Check(ctx context.Context) (details map[string]any, err error)
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Checks   map[string]Checker
+	Timeout  time.Duration
+	CacheTTL time.Duration
+	Now      func() time.Time
+}
+
+var deps *Dependencies
+
+// CheckResult is the outcome of one dependency check
+type CheckResult struct {
+	Status    string         `json:"status"`
+	LatencyMs int64          `json:"latencyMs"`
+	Details   map[string]any `json:"details,omitempty"`
+}
+
+// HealthResponse reports the service's readiness. Status is ok only when
+// every check is ok.
+type HealthResponse struct {
+	Status    string                 `json:"status"`
+	CheckedAt string                 `json:"checkedAt"`
+	Checks    map[string]CheckResult `json:"checks"`
+}
+
+// Response is the API Gateway proxy response
+type Response struct {
+	StatusCode int               `json:"statusCode"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+}
+
+// cache holds the last result until it is older than the cache TTL
+var cache struct {
+	sync.Mutex
+	response  Response
+	checkedAt time.Time
+}
+
+// correlatedHandler gives each request a correlation ID and adds it to the
+// handler's response
+func correlatedHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(resp.Headers, correlationID)
+	return resp, err
+}
+
+// handler checks every dependency and reports their status: 200 when all
+// are ok, 503 otherwise
+func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
+	ctx, span := tracing.StartHandlerSpan(ctx, "HealthHandler",
+		tracing.Function("health"),
+		tracing.RequestID(request.RequestContext.RequestID),
+	)
+	defer span.End()
+
+	cache.Lock()
+	defer cache.Unlock()
+	now := deps.Now()
+	if !cache.checkedAt.IsZero() && now.Sub(cache.checkedAt) < deps.CacheTTL {
+		return cache.response, nil
+	}
+
+	health := runChecks(ctx, now)
+	statusCode := 200
+	if health.Status != StatusOK {
+		statusCode = 503
+	}
+	body, _ := json.Marshal(health)
+	cache.response = Response{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type":  "application/json",
+			"Cache-Control": "no-store",
+		},
+		Body: string(body),
+	}
+	cache.checkedAt = now
+	return cache.response, nil
+}
+
+// runChecks runs every check concurrently, each within the check timeout
+func runChecks(ctx context.Context, now time.Time) HealthResponse {
+	names := make([]string, 0, len(deps.Checks))
+	for name := range deps.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]CheckResult, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = runCheck(ctx, name, deps.Checks[name])
+		}()
+	}
+	wg.Wait()
+
+	health := HealthResponse{
+		Status:    StatusOK,
+		CheckedAt: now.UTC().Format(time.RFC3339),
+		Checks:    make(map[string]CheckResult, len(names)),
+	}
+	for i, name := range names {
+		health.Checks[name] = results[i]
+		if results[i].Status != StatusOK {
+			health.Status = StatusFail
+		}
+	}
+	return health
+}
+
+// runCheck runs one check within the check timeout
+func runCheck(ctx context.Context, name string, checker Checker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, deps.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	details, err := checker.Check(ctx)
+	result := CheckResult{
+		Status:    StatusOK,
+		LatencyMs: time.Since(start).Milliseconds(),
+		Details:   details,
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Health check failed",
+			slog.String("check", name),
+			slog.String("error", err.Error()),
+		)
+		result.Status = StatusFail
+	}
+	return result
+}
+
+// DynamoDBGetter reads an item from DynamoDB
+type DynamoDBGetter interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDBCheck reads a key that never exists, which succeeds when the
+// table is reachable and readable
+type DynamoDBCheck struct {
+	Client    DynamoDBGetter
+	TableName string
+}
+
+// Check implements Checker
+func (c *DynamoDBCheck) Check(ctx context.Context) (map[string]any, error) {
+	_, err := c.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(c.TableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "HEALTH#"},
+			"sk": &types.AttributeValueMemberS{Value: "HEALTH#"},
+		},
+	})
+	return nil, err
+}
+
+// RegistryCheck loads the plugin registry as jmap-api does at cold start
+type RegistryCheck struct {
+	Querier plugin.PluginQuerier
+}
+
+// Check implements Checker. It fails when no plugin is registered, since core
+// registers its own.
+func (c *RegistryCheck) Check(ctx context.Context) (map[string]any, error) {
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(ctx, c.Querier); err != nil {
+		return nil, err
+	}
+	details := map[string]any{
+		"plugins":          registry.PluginCount(),
+		"lastRegisteredAt": registry.LastRegisteredAt(),
+	}
+	if registry.PluginCount() == 0 {
+		return details, errNoPlugins
+	}
+	return details, nil
+}
+
+// errNoPlugins reports an empty plugin registry
+var errNoPlugins = errors.New("no plugins registered")
+
+// S3BucketHeader checks access to an S3 bucket
+type S3BucketHeader interface {
+	HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error)
+}
+
+// S3Check checks the blob bucket exists and is accessible
+type S3Check struct {
+	Client S3BucketHeader
+	Bucket string
+}
+
+// Check implements Checker
+func (c *S3Check) Check(ctx context.Context) (map[string]any, error) {
+	_, err := c.Client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(c.Bucket),
+	})
+	return nil, err
+}
+
+// SecretDescriber reads a secret's metadata
+type SecretDescriber interface {
+	DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error)
+}
+
+// SecretsCheck checks a secret can be reached, without reading its value
+type SecretsCheck struct {
+	Client    SecretDescriber
+	SecretARN string
+}
+
+// Check implements Checker
+func (c *SecretsCheck) Check(ctx context.Context) (map[string]any, error) {
+	_, err := c.Client.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(c.SecretARN),
+	})
+	return nil, err
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx, awsinit.WithHTTPHandler("health"))
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadHealth(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+	blobBucket := cfg.Bucket
+	delegationSecretARN := cfg.DelegationSecretARN
+
+	deps = &Dependencies{
+		Checks: map[string]Checker{
+			"dynamodb": &DynamoDBCheck{Client: dynamodb.NewFromConfig(result.Config), TableName: tableName},
+			"registry": &RegistryCheck{Querier: db.NewClientFromConfig(result.Config, tableName)},
+			"s3":       &S3Check{Client: s3.NewFromConfig(result.Config), Bucket: blobBucket},
+			"secrets":  &SecretsCheck{Client: secretsmanager.NewFromConfig(result.Config), SecretARN: delegationSecretARN},
+		},
+		Timeout:  DefaultCheckTimeout,
+		CacheTTL: DefaultCacheTTL,
+		Now:      time.Now,
+	}
+
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, correlatedHandler, "GET /health/ready")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	result.Start(correlatedHandler)
+}
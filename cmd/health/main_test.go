@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// mockChecker implements Checker for testing
+type mockChecker struct {
+	details map[string]any
+	err     error
+	calls   int
+}
+
+func (m *mockChecker) Check(ctx context.Context) (map[string]any, error) {
+	m.calls++
+	return m.details, m.err
+}
+
+// setupTestDeps creates test deps with the given checks
+func setupTestDeps(checks map[string]Checker, now time.Time) {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+	cache.checkedAt = time.Time{}
+	deps = &Dependencies{
+		Checks:   checks,
+		Timeout:  time.Second,
+		CacheTTL: DefaultCacheTTL,
+		Now:      func() time.Time { return now },
+	}
+}
+
+func decodeHealth(t *testing.T, response Response) HealthResponse {
+	t.Helper()
+	var health HealthResponse
+	if err := json.Unmarshal([]byte(response.Body), &health); err != nil {
+		t.Fatalf("invalid response body %q: %v", response.Body, err)
+	}
+	return health
+}
+
+func TestHandler_AllChecksOK_Returns200(t *testing.T) {
+	setupTestDeps(map[string]Checker{
+		"dynamodb": &mockChecker{},
+		"registry": &mockChecker{details: map[string]any{"plugins": 2}},
+	}, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC))
+
+	response, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+	health := decodeHealth(t, response)
+	if health.Status != StatusOK || health.CheckedAt != "2026-03-01T12:00:00Z" {
+		t.Errorf("unexpected health %+v", health)
+	}
+	if health.Checks["registry"].Details["plugins"] != 2.0 {
+		t.Errorf("expected registry details, got %+v", health.Checks["registry"])
+	}
+}
+
+func TestHandler_FailedCheck_Returns503WithoutError(t *testing.T) {
+	setupTestDeps(map[string]Checker{
+		"dynamodb": &mockChecker{},
+		"s3":       &mockChecker{err: errors.New("AccessDenied: internal detail")},
+	}, time.Now())
+
+	response, err := handler(context.Background(), events.APIGatewayProxyRequest{})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 503 {
+		t.Errorf("expected status code 503, got %d", response.StatusCode)
+	}
+	health := decodeHealth(t, response)
+	if health.Status != StatusFail || health.Checks["s3"].Status != StatusFail || health.Checks["dynamodb"].Status != StatusOK {
+		t.Errorf("unexpected health %+v", health)
+	}
+	if strings.Contains(response.Body, "internal detail") {
+		t.Error("expected error text to be kept out of the response")
+	}
+}
+
+func TestHandler_CachesResult(t *testing.T) {
+	now := time.Now()
+	checker := &mockChecker{}
+	setupTestDeps(map[string]Checker{"dynamodb": checker}, now)
+
+	_, _ = handler(context.Background(), events.APIGatewayProxyRequest{})
+	_, _ = handler(context.Background(), events.APIGatewayProxyRequest{})
+	if checker.calls != 1 {
+		t.Errorf("expected one check within the cache TTL, got %d", checker.calls)
+	}
+
+	deps.Now = func() time.Time { return now.Add(DefaultCacheTTL) }
+	_, _ = handler(context.Background(), events.APIGatewayProxyRequest{})
+	if checker.calls != 2 {
+		t.Errorf("expected a new check after the cache TTL, got %d", checker.calls)
+	}
+}
+
+// mockDynamoDB implements DynamoDBGetter for testing
+type mockDynamoDB struct {
+	input *dynamodb.GetItemInput
+	err   error
+}
+
+func (m *mockDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.input = params
+	return &dynamodb.GetItemOutput{}, m.err
+}
+
+func TestDynamoDBCheck(t *testing.T) {
+	client := &mockDynamoDB{}
+	check := &DynamoDBCheck{Client: client, TableName: "jmap-data"}
+
+	if _, err := check.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *client.input.TableName != "jmap-data" {
+		t.Errorf("expected table jmap-data, got %s", *client.input.TableName)
+	}
+
+	client.err = errors.New("unreachable")
+	if _, err := check.Check(context.Background()); err == nil {
+		t.Error("expected error when DynamoDB fails")
+	}
+}
+
+// mockQuerier implements plugin.PluginQuerier for testing
+type mockQuerier struct {
+	items []map[string]types.AttributeValue
+	err   error
+}
+
+func (m *mockQuerier) QueryByPK(ctx context.Context, pk string) ([]map[string]types.AttributeValue, error) {
+	return m.items, m.err
+}
+
+func TestRegistryCheck(t *testing.T) {
+	record, _ := attributevalue.MarshalMap(plugin.PluginRecord{
+		PK:           plugin.PluginPrefix,
+		SK:           plugin.PluginPrefix + "core",
+		PluginID:     "core",
+		RegisteredAt: "2026-01-02T03:04:05Z",
+	})
+
+	details, err := (&RegistryCheck{Querier: &mockQuerier{items: []map[string]types.AttributeValue{record}}}).Check(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if details["plugins"] != 1 || details["lastRegisteredAt"] != "2026-01-02T03:04:05Z" {
+		t.Errorf("unexpected details %v", details)
+	}
+
+	if _, err := (&RegistryCheck{Querier: &mockQuerier{}}).Check(context.Background()); !errors.Is(err, errNoPlugins) {
+		t.Errorf("expected errNoPlugins for an empty registry, got %v", err)
+	}
+	if _, err := (&RegistryCheck{Querier: &mockQuerier{err: errors.New("throttled")}}).Check(context.Background()); err == nil {
+		t.Error("expected error when the registry cannot be loaded")
+	}
+}
+
+// mockS3 implements S3BucketHeader for testing
+type mockS3 struct {
+	bucket string
+	err    error
+}
+
+func (m *mockS3) HeadBucket(ctx context.Context, params *s3.HeadBucketInput, optFns ...func(*s3.Options)) (*s3.HeadBucketOutput, error) {
+	m.bucket = *params.Bucket
+	return &s3.HeadBucketOutput{}, m.err
+}
+
+func TestS3Check(t *testing.T) {
+	client := &mockS3{}
+	if _, err := (&S3Check{Client: client, Bucket: "blobs"}).Check(context.Background()); err != nil || client.bucket != "blobs" {
+		t.Errorf("expected HeadBucket on blobs, got %q, %v", client.bucket, err)
+	}
+	client.err = errors.New("not found")
+	if _, err := (&S3Check{Client: client, Bucket: "blobs"}).Check(context.Background()); err == nil {
+		t.Error("expected error when HeadBucket fails")
+	}
+}
+
+// mockSecrets implements SecretDescriber for testing
+type mockSecrets struct {
+	secretID string
+	err      error
+}
+
+func (m *mockSecrets) DescribeSecret(ctx context.Context, params *secretsmanager.DescribeSecretInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.DescribeSecretOutput, error) {
+	m.secretID = *params.SecretId
+	return &secretsmanager.DescribeSecretOutput{}, m.err
+}
+
+func TestSecretsCheck(t *testing.T) {
+	client := &mockSecrets{}
+	if _, err := (&SecretsCheck{Client: client, SecretARN: "arn:secret"}).Check(context.Background()); err != nil || client.secretID != "arn:secret" {
+		t.Errorf("expected DescribeSecret on arn:secret, got %q, %v", client.secretID, err)
+	}
+	client.err = errors.New("access denied")
+	if _, err := (&SecretsCheck{Client: client, SecretARN: "arn:secret"}).Check(context.Background()); err == nil {
+		t.Error("expected error when DescribeSecret fails")
+	}
+}
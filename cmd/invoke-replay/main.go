@@ -0,0 +1,527 @@
+// Command invoke-replay re-sends a recorded plugin invocation request to a
+// plugin, in a sandbox account, and diffs the plugin's response against the
+// recorded one. It reproduces a plugin bug from the request that caused it
+// without going through jmap-api:
+//
+//	invoke-replay -function arn:aws:lambda:...:function:mail-email-get-dev \
+//	    -account sandbox-1 s3://bucket/recordings/req-1.json
+//
+// The recording is read from a file, stdin (-), or an s3:// object. It is a
+// PluginInvocationRequest, or a JSON object holding one under "request" and
+// optionally the plugin's response under "response", as in a structured log
+// line. A file of JSON lines is searched for the recording of -request-id.
+//
+// The request is replayed against the -account account, never the recorded
+// one, and without its delegation token, which is bound to the recorded
+// account. It exits 1 if the invocation fails or the responses differ.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// s3Scheme prefixes recordings read from S3
+const s3Scheme = "s3://"
+
+// accountArgs are the method arguments naming an account, which are moved
+// to the sandbox account when they name the recorded one
+var accountArgs = []string{"accountId", "fromAccountId"}
+
+// PluginTarget sends an invocation request payload to a plugin and returns
+// its response payload
+type PluginTarget interface {
+	Invoke(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// HTTPDoer sends HTTP requests
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ObjectGetter reads recordings from S3
+type ObjectGetter interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+}
+
+// Config holds the flags
+type Config struct {
+	Target    string // shown in the report
+	AccountID string // sandbox account the request is replayed in
+	RequestID string // recording to pick from a file of several
+	Ignore    []string
+	Timeout   time.Duration
+	JSON      bool
+}
+
+// Dependencies for the replay (injectable for testing)
+type Dependencies struct {
+	Plugin PluginTarget
+	Config Config
+	Stdout io.Writer
+}
+
+var deps *Dependencies
+
+// Recording is a recorded plugin invocation: the request core sent and, when
+// it was recorded too, the plugin's response
+type Recording struct {
+	Request  plugin.PluginInvocationRequest
+	Response *plugin.PluginInvocationResponse
+}
+
+// Difference is one value that differs between the recorded and replayed
+// method responses, by its path in the response
+type Difference struct {
+	Path     string `json:"path"`
+	Recorded any    `json:"recorded"`
+	Replayed any    `json:"replayed"`
+}
+
+// Report is the outcome of a replay
+type Report struct {
+	Target    string `json:"target"`
+	Method    string `json:"method"`
+	RequestID string `json:"requestId"`
+	AccountID string `json:"accountId"`
+	LatencyMs int64  `json:"latencyMs"`
+	// Error is why the invocation failed, if it did
+	Error string `json:"error,omitempty"`
+	// Compared is whether there was a recorded response to diff against
+	Compared    bool                             `json:"compared"`
+	Differences []Difference                     `json:"differences"`
+	Response    *plugin.PluginInvocationResponse `json:"response,omitempty"`
+}
+
+// Passed reports whether the plugin answered and matched any recorded
+// response
+func (r Report) Passed() bool {
+	return r.Error == "" && len(r.Differences) == 0
+}
+
+// readSource reads a recording from a file, stdin for "-", or an s3://
+// object
+func readSource(ctx context.Context, source string, stdin io.Reader, objects ObjectGetter) ([]byte, error) {
+	switch {
+	case source == "-":
+		return io.ReadAll(stdin)
+	case strings.HasPrefix(source, s3Scheme):
+		bucket, key, ok := strings.Cut(strings.TrimPrefix(source, s3Scheme), "/")
+		if !ok || bucket == "" || key == "" {
+			return nil, fmt.Errorf("invalid S3 location %q, want s3://bucket/key", source)
+		}
+		output, err := objects.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", source, err)
+		}
+		defer output.Body.Close()
+		return io.ReadAll(output.Body)
+	default:
+		return os.ReadFile(source)
+	}
+}
+
+// parseRecordings reads every recording from data, which holds one JSON
+// value or several, such as lines of a log
+func parseRecordings(data []byte) ([]Recording, error) {
+	var recordings []Recording
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for {
+		var value map[string]json.RawMessage
+		err := decoder.Decode(&value)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recording: %w", err)
+		}
+		recording, ok, err := parseRecording(value)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			recordings = append(recordings, recording)
+		}
+	}
+	return recordings, nil
+}
+
+// parseRecording reads a recording from one JSON object, which is a request
+// or holds one under "request". ok is false for an object that is neither,
+// such as an unrelated log line, which may name a method but has no args.
+func parseRecording(value map[string]json.RawMessage) (recording Recording, ok bool, err error) {
+	request, hasRequest := value["request"]
+	if !hasRequest {
+		_, hasMethod := value["method"]
+		_, hasArgs := value["args"]
+		if !hasMethod || !hasArgs {
+			return Recording{}, false, nil
+		}
+		data, _ := json.Marshal(value)
+		if err := json.Unmarshal(data, &recording.Request); err != nil {
+			return Recording{}, false, fmt.Errorf("invalid recorded request: %w", err)
+		}
+		return recording, true, nil
+	}
+
+	if err := unmarshalEmbedded(request, &recording.Request); err != nil {
+		return Recording{}, false, fmt.Errorf("invalid recorded request: %w", err)
+	}
+	if response, ok := value["response"]; ok && string(response) != "null" {
+		recording.Response = &plugin.PluginInvocationResponse{}
+		if err := unmarshalEmbedded(response, recording.Response); err != nil {
+			return Recording{}, false, fmt.Errorf("invalid recorded response: %w", err)
+		}
+	}
+	return recording, true, nil
+}
+
+// unmarshalEmbedded decodes a JSON object, or a string holding one, as log
+// lines may carry payloads either way
+func unmarshalEmbedded(data json.RawMessage, v any) error {
+	var embedded string
+	if err := json.Unmarshal(data, &embedded); err == nil {
+		data = json.RawMessage(embedded)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// pickRecording returns the recording of requestID, or the only recording
+// when requestID is empty
+func pickRecording(recordings []Recording, requestID string) (Recording, error) {
+	if requestID != "" {
+		recordings = slices.DeleteFunc(recordings, func(r Recording) bool {
+			return r.Request.RequestID != requestID
+		})
+	}
+	switch len(recordings) {
+	case 1:
+		return recordings[0], nil
+	case 0:
+		if requestID != "" {
+			return Recording{}, fmt.Errorf("no recording of request %s", requestID)
+		}
+		return Recording{}, errors.New("no recorded request found")
+	default:
+		return Recording{}, fmt.Errorf("%d recordings found; pick one with -request-id", len(recordings))
+	}
+}
+
+// sandboxArgs returns args with the arguments naming the recorded account
+// moved to the sandbox account
+func sandboxArgs(args map[string]any, recordedAccount string) map[string]any {
+	moved := make(map[string]any, len(args))
+	for key, value := range args {
+		if slices.Contains(accountArgs, key) && value == recordedAccount {
+			value = deps.Config.AccountID
+		}
+		moved[key] = value
+	}
+	return moved
+}
+
+// sandboxRequest returns the recorded request as it is replayed: in the
+// sandbox account, without the recorded account's delegation token, and
+// marked as a replay
+func sandboxRequest(recorded plugin.PluginInvocationRequest) plugin.PluginInvocationRequest {
+	request := recorded
+	request.AccountID = deps.Config.AccountID
+	request.Args = sandboxArgs(recorded.Args, recorded.AccountID)
+	request.RequestID = "replay-" + recorded.RequestID
+	request.DelegationToken = ""
+	request.CorrelationID = "invoke-replay"
+	return request
+}
+
+// normalise round-trips a method response through JSON so recorded and
+// replayed responses compare alike
+func normalise(response plugin.MethodResponse) any {
+	data, _ := json.Marshal(response)
+	var out any
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+// ignored reports whether path is, or is inside, an ignored path
+func ignored(path string) bool {
+	for _, ignore := range deps.Config.Ignore {
+		if path == ignore || strings.HasPrefix(path, ignore+".") || strings.HasPrefix(path, ignore+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// diff appends the differences between two decoded JSON values at path
+func diff(path string, recorded, replayed any, differences []Difference) []Difference {
+	if ignored(path) {
+		return differences
+	}
+	recordedMap, recordedIsMap := recorded.(map[string]any)
+	replayedMap, replayedIsMap := replayed.(map[string]any)
+	if recordedIsMap && replayedIsMap {
+		keys := make(map[string]bool, len(recordedMap)+len(replayedMap))
+		for key := range recordedMap {
+			keys[key] = true
+		}
+		for key := range replayedMap {
+			keys[key] = true
+		}
+		for _, key := range slices.Sorted(maps.Keys(keys)) {
+			child := key
+			if path != "" {
+				child = path + "." + key
+			}
+			differences = diff(child, recordedMap[key], replayedMap[key], differences)
+		}
+		return differences
+	}
+
+	recordedList, recordedIsList := recorded.([]any)
+	replayedList, replayedIsList := replayed.([]any)
+	if recordedIsList && replayedIsList {
+		for i := range max(len(recordedList), len(replayedList)) {
+			var recordedItem, replayedItem any
+			if i < len(recordedList) {
+				recordedItem = recordedList[i]
+			}
+			if i < len(replayedList) {
+				replayedItem = replayedList[i]
+			}
+			differences = diff(fmt.Sprintf("%s[%d]", path, i), recordedItem, replayedItem, differences)
+		}
+		return differences
+	}
+
+	if !reflect.DeepEqual(recorded, replayed) {
+		differences = append(differences, Difference{Path: path, Recorded: recorded, Replayed: replayed})
+	}
+	return differences
+}
+
+// replay sends the recording's request to the plugin and diffs the
+// response against the recorded one
+func replay(ctx context.Context, recording Recording) Report {
+	request := sandboxRequest(recording.Request)
+	report := Report{
+		Target:      deps.Config.Target,
+		Method:      request.Method,
+		RequestID:   recording.Request.RequestID,
+		AccountID:   request.AccountID,
+		Differences: []Difference{},
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		report.Error = fmt.Sprintf("failed to marshal request: %v", err)
+		return report
+	}
+	ctx, cancel := context.WithTimeout(ctx, deps.Config.Timeout)
+	defer cancel()
+	start := time.Now()
+	output, err := deps.Plugin.Invoke(ctx, payload)
+	report.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		report.Error = err.Error()
+		return report
+	}
+	var response plugin.PluginInvocationResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		report.Error = fmt.Sprintf("invalid response: %v", err)
+		return report
+	}
+	report.Response = &response
+
+	if recording.Response != nil {
+		// The recorded response names the recorded account where the
+		// replayed one names the sandbox
+		recorded := recording.Response.MethodResponse
+		recorded.Args = sandboxArgs(recorded.Args, recording.Request.AccountID)
+		report.Compared = true
+		report.Differences = diff("", normalise(recorded), normalise(response.MethodResponse), report.Differences)
+	}
+	return report
+}
+
+// writeReport writes the report as JSON or text
+func writeReport(report Report) error {
+	if deps.Config.JSON {
+		encoder := json.NewEncoder(deps.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Fprintf(deps.Stdout, "Replayed %s (request %s) against %s in account %s\n\n",
+		report.Method, report.RequestID, report.Target, report.AccountID)
+	if report.Error != "" {
+		_, err := fmt.Fprintf(deps.Stdout, "FAIL invocation failed after %dms: %s\n", report.LatencyMs, report.Error)
+		return err
+	}
+
+	response, err := json.MarshalIndent(report.Response, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(deps.Stdout, "Response (%dms):\n%s\n\n", report.LatencyMs, response)
+	switch {
+	case !report.Compared:
+		_, err = fmt.Fprintln(deps.Stdout, "No recorded response to compare")
+	case len(report.Differences) == 0:
+		_, err = fmt.Fprintln(deps.Stdout, "PASS response matches the recording")
+	default:
+		fmt.Fprintf(deps.Stdout, "FAIL %d differences from the recording:\n", len(report.Differences))
+		for _, difference := range report.Differences {
+			recorded, _ := json.Marshal(difference.Recorded)
+			replayed, _ := json.Marshal(difference.Replayed)
+			fmt.Fprintf(deps.Stdout, "  %s\n    - %s\n    + %s\n", difference.Path, recorded, replayed)
+		}
+	}
+	return err
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// LambdaTarget invokes a plugin Lambda function as core does
+type LambdaTarget struct {
+	client   plugin.LambdaClient
+	function string
+}
+
+// Invoke invokes the function, treating a function error as a failure
+func (t *LambdaTarget) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	output, err := t.client.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(t.function),
+		Payload:      payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lambda invocation failed: %w", err)
+	}
+	if output.FunctionError != nil {
+		return output.Payload, fmt.Errorf("function error %s: %s", *output.FunctionError, bytes.TrimSpace(output.Payload))
+	}
+	return output.Payload, nil
+}
+
+// HTTPTarget POSTs the invocation request to a plugin running behind HTTP,
+// such as the Lambda runtime interface emulator
+type HTTPTarget struct {
+	client HTTPDoer
+	url    string
+}
+
+// Invoke POSTs the payload, treating a non-2xx status as a failure
+func (t *HTTPTarget) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("invoke-replay", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: invoke-replay (-function name | -url endpoint) -account id [flags] recording")
+		flags.PrintDefaults()
+	}
+	function := flags.String("function", "", "plugin Lambda function name or ARN")
+	endpoint := flags.String("url", "", "plugin HTTP endpoint, in place of -function")
+	flags.StringVar(&cfg.AccountID, "account", "", "sandbox account ID to replay the request in (required)")
+	flags.StringVar(&cfg.RequestID, "request-id", "", "request ID of the recording to replay, when the input holds several")
+	ignore := flags.String("ignore", "", "comma-separated response paths to leave out of the diff, such as args.state")
+	flags.DurationVar(&cfg.Timeout, "timeout", 25*time.Second, "time the plugin has to answer")
+	flags.BoolVar(&cfg.JSON, "json", false, "write the report as JSON")
+	region := flags.String("region", "", "AWS region for -function and s3:// recordings (default from the AWS config)")
+	_ = flags.Parse(os.Args[1:])
+
+	fail := func(format string, args ...any) {
+		fmt.Fprintf(os.Stderr, "invoke-replay: "+format+"\n", args...)
+		os.Exit(2)
+	}
+	if flags.NArg() != 1 || cfg.AccountID == "" || (*function == "") == (*endpoint == "") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	if *ignore != "" {
+		cfg.Ignore = strings.Split(*ignore, ",")
+	}
+
+	// AWS is only needed for Lambda targets and S3 recordings
+	var awsConfig aws.Config
+	if *function != "" || strings.HasPrefix(flags.Arg(0), s3Scheme) {
+		var options []func(*config.LoadOptions) error
+		if *region != "" {
+			options = append(options, config.WithRegion(*region))
+		}
+		var err error
+		if awsConfig, err = config.LoadDefaultConfig(ctx, options...); err != nil {
+			fail("failed to load AWS config: %v", err)
+		}
+	}
+
+	deps = &Dependencies{Config: cfg, Stdout: os.Stdout}
+	if *function != "" {
+		deps.Plugin = &LambdaTarget{client: lambda.NewFromConfig(awsConfig), function: *function}
+		deps.Config.Target = *function
+	} else {
+		deps.Plugin = &HTTPTarget{client: &http.Client{}, url: *endpoint}
+		deps.Config.Target = *endpoint
+	}
+
+	data, err := readSource(ctx, flags.Arg(0), os.Stdin, s3.NewFromConfig(awsConfig))
+	if err != nil {
+		fail("%v", err)
+	}
+	recordings, err := parseRecordings(data)
+	if err != nil {
+		fail("%v", err)
+	}
+	recording, err := pickRecording(recordings, cfg.RequestID)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	report := replay(ctx, recording)
+	if err := writeReport(report); err != nil {
+		fail("%v", err)
+	}
+	if !report.Passed() {
+		os.Exit(1)
+	}
+}
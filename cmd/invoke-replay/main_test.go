@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// mockPlugin answers invocation requests with handle, defaulting to echoing
+// the arguments back
+type mockPlugin struct {
+	handle   func(request plugin.PluginInvocationRequest) (any, error)
+	requests []plugin.PluginInvocationRequest
+}
+
+func (m *mockPlugin) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var request plugin.PluginInvocationRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, err
+	}
+	m.requests = append(m.requests, request)
+	if m.handle == nil {
+		return json.Marshal(plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+			Name:     request.Method,
+			Args:     request.Args,
+			ClientID: request.ClientID,
+		}})
+	}
+	response, err := m.handle(request)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
+
+// mockObjects serves recordings from S3
+type mockObjects struct {
+	objects map[string]string
+	keys    []string
+}
+
+func (m *mockObjects) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	key := aws.ToString(params.Bucket) + "/" + aws.ToString(params.Key)
+	m.keys = append(m.keys, key)
+	body, ok := m.objects[key]
+	if !ok {
+		return nil, errors.New("NoSuchKey")
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body))}, nil
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(mock *mockPlugin, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	if cfg.AccountID == "" {
+		cfg.AccountID = "sandbox"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+	cfg.Target = "fn-mail"
+	deps = &Dependencies{Plugin: mock, Config: cfg, Stdout: &stdout}
+	return &stdout
+}
+
+// recordingOf parses a single recording
+func recordingOf(t *testing.T, data string) Recording {
+	t.Helper()
+	recordings, err := parseRecordings([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	recording, err := pickRecording(recordings, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return recording
+}
+
+const recordedRequest = `{"requestId":"req-1","callIndex":2,"accountId":"user-1","method":"Email/get","args":{"accountId":"user-1","ids":["M1"]},"clientId":"c1","delegationToken":"tok","correlationId":"corr-1"}`
+
+func TestParseRecordings_Formats(t *testing.T) {
+	bare := recordingOf(t, recordedRequest)
+	if bare.Request.Method != "Email/get" || bare.Request.CallIndex != 2 || bare.Response != nil {
+		t.Errorf("unexpected bare recording %+v", bare)
+	}
+
+	wrapped := recordingOf(t, `{"request":`+recordedRequest+`,"response":{"methodResponse":{"name":"Email/get","args":{"list":[]},"clientId":"c1"}}}`)
+	if wrapped.Request.RequestID != "req-1" || wrapped.Response == nil || wrapped.Response.MethodResponse.Name != "Email/get" {
+		t.Errorf("unexpected wrapped recording %+v", wrapped)
+	}
+
+	// A log line may carry the request as a string
+	quoted, _ := json.Marshal(recordedRequest)
+	logged := recordingOf(t, `{"level":"INFO","msg":"Plugin invocation","request":`+string(quoted)+`}`)
+	if logged.Request.AccountID != "user-1" || logged.Response != nil {
+		t.Errorf("unexpected logged recording %+v", logged)
+	}
+}
+
+func TestPickRecording_FromLogLines(t *testing.T) {
+	lines := strings.Join([]string{
+		`{"level":"INFO","msg":"Processing request","method":"Email/get"}`,
+		`{"request":{"requestId":"req-1","method":"Email/get","args":{}}}`,
+		`{"request":{"requestId":"req-2","method":"Email/set","args":{}}}`,
+	}, "\n")
+	recordings, err := parseRecordings([]byte(lines))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(recordings) != 2 {
+		t.Fatalf("expected the unrelated line to be skipped, got %d recordings", len(recordings))
+	}
+	if _, err := pickRecording(recordings, ""); err == nil || !strings.Contains(err.Error(), "-request-id") {
+		t.Errorf("expected a request to be asked for, got %v", err)
+	}
+	recording, err := pickRecording(recordings, "req-2")
+	if err != nil || recording.Request.Method != "Email/set" {
+		t.Errorf("unexpected recording %+v, %v", recording, err)
+	}
+	if _, err := pickRecording(recordings, "req-9"); err == nil {
+		t.Error("expected an error for a missing request")
+	}
+	if _, err := parseRecordings([]byte(`{"request":`)); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
+
+func TestReadSource(t *testing.T) {
+	objects := &mockObjects{objects: map[string]string{"bucket/recordings/req-1.json": recordedRequest}}
+	data, err := readSource(context.Background(), "s3://bucket/recordings/req-1.json", nil, objects)
+	if err != nil || string(data) != recordedRequest {
+		t.Errorf("unexpected S3 read %q, %v", data, err)
+	}
+	if _, err := readSource(context.Background(), "s3://bucket", nil, objects); err == nil {
+		t.Error("expected an error for an S3 location without a key")
+	}
+	if _, err := readSource(context.Background(), "s3://bucket/missing", nil, objects); err == nil {
+		t.Error("expected an error for a missing object")
+	}
+
+	data, err = readSource(context.Background(), "-", strings.NewReader("stdin"), objects)
+	if err != nil || string(data) != "stdin" {
+		t.Errorf("unexpected stdin read %q, %v", data, err)
+	}
+}
+
+func TestReplay_SandboxesTheRequest(t *testing.T) {
+	mock := &mockPlugin{}
+	setupTestDeps(mock, Config{})
+
+	report := replay(context.Background(), recordingOf(t, recordedRequest))
+	if !report.Passed() || report.Compared {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if len(mock.requests) != 1 {
+		t.Fatalf("expected one invocation, got %d", len(mock.requests))
+	}
+	sent := mock.requests[0]
+	if sent.AccountID != "sandbox" || sent.Args["accountId"] != "sandbox" {
+		t.Errorf("expected the sandbox account, got %q and %v", sent.AccountID, sent.Args["accountId"])
+	}
+	if sent.DelegationToken != "" || sent.RequestID != "replay-req-1" || sent.CorrelationID != "invoke-replay" {
+		t.Errorf("unexpected replayed request %+v", sent)
+	}
+	if sent.Method != "Email/get" || sent.ClientID != "c1" || sent.CallIndex != 2 {
+		t.Errorf("expected the recorded call, got %+v", sent)
+	}
+}
+
+func TestReplay_MatchingResponse(t *testing.T) {
+	setupTestDeps(&mockPlugin{}, Config{})
+
+	// The recorded response names the recorded account
+	recording := recordingOf(t, `{"request":`+recordedRequest+`,"response":{"methodResponse":{"name":"Email/get","args":{"accountId":"user-1","ids":["M1"]},"clientId":"c1"}}}`)
+	report := replay(context.Background(), recording)
+	if !report.Compared || !report.Passed() {
+		t.Errorf("expected a match, got %+v", report)
+	}
+}
+
+func TestReplay_Differences(t *testing.T) {
+	stdout := setupTestDeps(&mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		return plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+			Name:     "Email/get",
+			Args:     map[string]any{"accountId": "sandbox", "state": "s2", "list": []any{map[string]any{"id": "M1", "subject": "new"}}},
+			ClientID: "c1",
+		}}, nil
+	}}, Config{})
+
+	recording := recordingOf(t, `{"request":`+recordedRequest+`,"response":{"methodResponse":{"name":"Email/get","args":{"accountId":"user-1","state":"s1","list":[{"id":"M1","subject":"old"}],"notFound":[]},"clientId":"c1"}}}`)
+	report := replay(context.Background(), recording)
+	paths := make([]string, 0, len(report.Differences))
+	for _, difference := range report.Differences {
+		paths = append(paths, difference.Path)
+	}
+	if got := strings.Join(paths, ","); got != "args.list[0].subject,args.notFound,args.state" {
+		t.Errorf("unexpected differences %s", got)
+	}
+	if report.Passed() {
+		t.Error("expected differences to fail the replay")
+	}
+	if err := writeReport(report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "FAIL 3 differences") || !strings.Contains(stdout.String(), `- "old"`) {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+
+	// Ignored paths are left out of the diff
+	deps.Config.Ignore = []string{"args.state", "args.list", "args.notFound"}
+	if report := replay(context.Background(), recording); !report.Passed() {
+		t.Errorf("expected ignored differences to pass, got %+v", report.Differences)
+	}
+}
+
+func TestReplay_InvocationFailure(t *testing.T) {
+	stdout := setupTestDeps(&mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		return nil, errors.New("function error Unhandled")
+	}}, Config{JSON: true})
+
+	report := replay(context.Background(), recordingOf(t, recordedRequest))
+	if report.Passed() || report.Error != "function error Unhandled" {
+		t.Errorf("unexpected report %+v", report)
+	}
+	if err := writeReport(report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(stdout.Bytes(), &decoded); err != nil || decoded.Error == "" || decoded.AccountID != "sandbox" {
+		t.Errorf("unexpected JSON report %s, %v", stdout.String(), err)
+	}
+}
@@ -3,29 +3,67 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"math/rand/v2"
 	"os"
-	"strconv"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	lambdasvc "github.com/aws/aws-sdk-go-v2/service/lambda"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/binding"
 	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
 	"github.com/jarrod-lowe/jmap-service-core/internal/blobcomplete"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobindex"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobreallocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstatus"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
 	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
 	"github.com/jarrod-lowe/jmap-service-core/internal/dispatcher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+	"github.com/jarrod-lowe/jmap-service-core/internal/idempotency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/inflight"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/otelmetrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/pluginlatency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+	"github.com/jarrod-lowe/jmap-service-core/internal/redact"
+	"github.com/jarrod-lowe/jmap-service-core/internal/requestcheck"
+	"github.com/jarrod-lowe/jmap-service-core/internal/respbody"
 	"github.com/jarrod-lowe/jmap-service-core/internal/resultref"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sessionstate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-core/internal/usage"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/querypage"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/statetoken"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
 	"github.com/jarrod-lowe/jmap-service-libs/jmaperror"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
+	"github.com/jarrod-lowe/jmap-service-libs/plugincontract"
 	"github.com/jarrod-lowe/jmap-service-libs/tracing"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // JMAPRequest represents a JMAP request per RFC 8620
 type JMAPRequest struct {
@@ -51,19 +89,130 @@ type Response struct {
 // DefaultDispatcherPoolSize is the default number of concurrent workers for method dispatch
 const DefaultDispatcherPoolSize = 4
 
+// pluginPrewarmTimeout bounds how long a cold start waits on plugin prewarming
+const pluginPrewarmTimeout = 2 * time.Second
+
+// AccountReader reads account META# records
+type AccountReader interface {
+	GetMeta(ctx context.Context, accountID string) (*account.Meta, error)
+}
+
+// ActivityRecorder records that an account is in use, for the
+// account-reaper
+type ActivityRecorder interface {
+	RecordActivity(ctx context.Context, accountID string, now time.Time) error
+}
+
+// AliasResolver resolves account aliases to account IDs
+type AliasResolver interface {
+	ResolveAlias(ctx context.Context, alias string) (string, error)
+}
+
+// PrincipalBindings restricts IAM principals to the accounts they are bound to
+type PrincipalBindings interface {
+	IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error)
+}
+
+// DelegationSigner mints the delegation tokens passed to plugins and
+// verifies the ones they present when calling back
+type DelegationSigner interface {
+	Mint(accountID, requestID, method string, principals []string) (string, error)
+	Verify(token string) (*delegation.Claims, error)
+}
+
+// RateLimiter takes a token from each key's bucket, using the tier's limit
+// for account keys
+type RateLimiter interface {
+	AllowTier(ctx context.Context, tier string, keys ...string) (ratelimit.Decision, error)
+}
+
+// ConcurrencyLimiter holds a lease for each request in flight, up to a limit
+// per account
+type ConcurrencyLimiter interface {
+	Acquire(ctx context.Context, accountID, requestID string, limit int) (bool, error)
+	Release(ctx context.Context, accountID, requestID string) error
+}
+
+// UsageRecorder records per-account usage for metering
+type UsageRecorder interface {
+	RecordMethodCalls(ctx context.Context, accountID string, calls int) error
+}
+
+// IdempotencyStore holds response snapshots for Idempotency-Key replay
+type IdempotencyStore interface {
+	Claim(ctx context.Context, accountID, key, requestHash string) (*idempotency.Snapshot, error)
+	Complete(ctx context.Context, accountID, key string, snapshot idempotency.Snapshot) error
+	Release(ctx context.Context, accountID, key string) error
+}
+
+// MethodMetrics records per-method call metrics
+type MethodMetrics interface {
+	RecordMethodCall(call metrics.MethodCall)
+}
+
 // Dependencies for handler (injectable for testing)
 type Dependencies struct {
 	Registry             *plugin.Registry
 	Invoker              plugin.Invoker
+	Accounts             AccountReader
+	Aliases              AliasResolver
 	BlobAllocator        *bloballocate.Handler
 	BlobCompleter        *blobcomplete.Handler
+	BlobReallocator      *blobreallocate.Handler
+	BlobStatus           *blobstatus.Handler
+	BlobIndex            *blobindex.Handler
+	Activity             ActivityRecorder
+	AccountExporter      *accountexport.Handler
+	RateLimiter          RateLimiter
+	Concurrency          ConcurrencyLimiter
+	Bindings             PrincipalBindings
+	Delegation           DelegationSigner
+	Features             account.FeatureFlags
+	Usage                UsageRecorder
+	Idempotency          IdempotencyStore
+	Metrics              MethodMetrics
+	SamplePercent        float64
+	StrictValidation     bool          // check every method call before running any
+	StateTokenMaxAge     time.Duration // oldest state token passed to a /changes method; zero for no limit
 	DispatcherPoolSize   int
+	MaxResponseSize      int
+	PluginLatency        *pluginlatency.Flusher
+	CORS                 *cors.Policy
+	// AccountIDClaim names the authorizer claim holding a user's account ID
+	AccountIDClaim string
 }
 
 var deps *Dependencies
 
+// corsHandler answers CORS preflights, gives each request a correlation ID,
+// and adds CORS headers and the correlation ID to the handler's responses
+func corsHandler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	if cors.IsPreflight(request.HTTPMethod) {
+		return Response{StatusCode: 204, Headers: deps.CORS.Preflight(request.Headers)}, nil
+	}
+	ctx, correlationID := correlation.RequestContext(ctx, request)
+	resp, err := handler(ctx, request)
+	resp.Headers = correlation.SetHeader(deps.CORS.Apply(request.Headers, resp.Headers), correlationID)
+	flushPluginLatency(ctx)
+	return resp, err
+}
+
+// flushPluginLatency flushes plugin latency statistics when they are due.
+// Failures are logged and never fail the request.
+func flushPluginLatency(ctx context.Context) {
+	if deps.PluginLatency == nil {
+		return
+	}
+	if err := deps.PluginLatency.FlushIfDue(ctx); err != nil {
+		logger.WarnContext(ctx, "Failed to store plugin latency",
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
 // handler processes JMAP requests
 func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Response, error) {
+	ctx = loglevel.RequestContext(ctx, request)
 	ctx, span := tracing.StartHandlerSpan(ctx, "JmapApiHandler",
 		tracing.Function("jmap-api"),
 		tracing.RequestID(request.RequestContext.RequestID),
@@ -71,37 +220,131 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 	defer span.End()
 
 	// Extract accountId from request (JWT sub or path param)
-	accountID, err := extractAccountID(request)
+	accountID, err := extractAccountID(request, deps.AccountIDClaim)
 	if err != nil {
 		logger.WarnContext(ctx, "Failed to extract account ID",
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		return Response{
-			StatusCode: 401,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-			Body:       `{"error":"Unauthorized","message":"Missing or invalid authentication"}`,
-		}, nil
+		return problemResponse(ctx, problem.New(401, "unauthorized", "Missing or invalid authentication")), nil
+	}
+
+	// Resolve an alias in the path to the account it belongs to
+	resolvedID, err := resolveAccountID(ctx, accountID)
+	if err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			logger.WarnContext(ctx, "Unknown account alias",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("alias", accountID),
+			)
+			return problemResponse(ctx, problem.New(404, "notFound", "Account not found")), nil
+		}
+		logger.ErrorContext(ctx, "Failed to resolve account alias",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("error", err.Error()),
+		)
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to resolve account")), nil
 	}
+	accountID = resolvedID
 
 	span.SetAttributes(tracing.AccountID(accountID))
 
 	// Check principal authorization for IAM-authenticated requests
+	rateLimitKeys := []string{ratelimit.AccountKey(accountID)}
 	if isIAMAuthenticatedRequest(request) {
 		callerPrincipal := extractCallerPrincipal(request)
-		if !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
+		// A delegation token stands in for registry trust, for its account and
+		// plugin only; principal bindings still apply
+		delegated := delegation.IsDelegated(ctx, deps.Delegation, request, accountID)
+		if !delegated && !deps.Registry.IsAllowedPrincipal(callerPrincipal) {
 			logger.WarnContext(ctx, "Unauthorized IAM principal",
 				slog.String("request_id", request.RequestContext.RequestID),
 				slog.String("caller_principal", callerPrincipal),
 			)
-			return Response{
-				StatusCode: 403,
-				Headers:    map[string]string{"Content-Type": "application/json"},
-				Body:       `{"type":"forbidden","description":"Principal not authorized for IAM access"}`,
-			}, nil
+			return problemResponse(ctx, problem.New(403, "forbidden", "Principal not authorized for IAM access")), nil
+		}
+		allowed, err := deps.Bindings.IsAllowed(ctx, callerPrincipal, accountID)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check principal bindings",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return problemResponse(ctx, problem.New(500, "serverFail", "Failed to check principal bindings")), nil
+		}
+		if !allowed {
+			logger.WarnContext(ctx, "IAM principal not bound to account",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("caller_principal", callerPrincipal),
+			)
+			return problemResponse(ctx, problem.New(403, "forbidden", "Principal not authorized for this account")), nil
+		}
+		rateLimitKeys = append(rateLimitKeys, ratelimit.PrincipalKey(callerPrincipal))
+	}
+
+	// Reject requests for suspended accounts
+	meta, err := deps.Accounts.GetMeta(ctx, accountID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to get account meta",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to retrieve account")), nil
+	}
+	if meta != nil && meta.Suspended {
+		logger.WarnContext(ctx, "Request for suspended account",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+		)
+		return problemResponse(ctx, problem.New(403, "forbidden", "Account is suspended").WithCode(errcode.AccountSuspended)), nil
+	}
+	recordActivity(ctx, accountID, meta)
+
+	// Enforce per-account and per-principal request rates, with the
+	// account's tier choosing its limit
+	if deps.RateLimiter != nil {
+		var tier string
+		if meta != nil {
+			tier = meta.Tier
+		}
+		decision, err := deps.RateLimiter.AllowTier(ctx, tier, rateLimitKeys...)
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to check rate limit",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return problemResponse(ctx, problem.New(500, "serverFail", "Failed to check rate limit")), nil
+		}
+		if !decision.Allowed {
+			logger.WarnContext(ctx, "Request rate limited",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.String("rate_limit_key", decision.Key),
+			)
+			resp := problemResponse(ctx, problem.New(429, "rateLimited", "Too many requests"))
+			resp.Headers["Retry-After"] = decision.RetryAfterSeconds()
+			return resp, nil
 		}
 	}
 
+	// Hold one of the account's maxConcurrentRequests leases while the
+	// request runs
+	release, refused := acquireRequestLease(ctx, request, accountID)
+	if refused != nil {
+		return *refused, nil
+	}
+	defer release()
+
+	// Features and limits for the account's type
+	var accountType string
+	if meta != nil {
+		accountType = meta.AccountType
+	}
+	features := deps.Features.For(accountType)
+
 	// Parse JMAP request
 	var jmapReq JMAPRequest
 	if err := json.Unmarshal([]byte(request.Body), &jmapReq); err != nil {
@@ -109,23 +352,39 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 			slog.String("request_id", request.RequestContext.RequestID),
 			slog.String("error", err.Error()),
 		)
-		problemJSON, _ := json.Marshal(jmaperror.NotJSON("Invalid JSON in request body").ToMap())
-		return Response{
-			StatusCode: 400,
-			Headers:    map[string]string{"Content-Type": "application/problem+json"},
-			Body:       string(problemJSON),
-		}, nil
+		return problemResponse(ctx, problem.New(400, "notJSON", "Invalid JSON in request body")), nil
 	}
 
 	// Validate capabilities
 	for _, cap := range jmapReq.Using {
-		if !deps.Registry.HasCapability(cap) {
-			problemJSON, _ := json.Marshal(jmaperror.UnknownCapability("Unknown capability: " + cap).ToMap())
-			return Response{
-				StatusCode: 400,
-				Headers:    map[string]string{"Content-Type": "application/problem+json"},
-				Body:       string(problemJSON),
-			}, nil
+		if !deps.Registry.HasCapability(cap) || !features.AllowsCapability(cap) {
+			return problemResponse(ctx, problem.New(400, "unknownCapability", "Unknown capability: "+cap)), nil
+		}
+	}
+
+	// In strict mode a request with any invalid method call is rejected
+	// before the calls ahead of it invoke plugins
+	if deps.StrictValidation {
+		if failure := checkRequest(ctx, accountID, jmapReq); failure != nil {
+			logger.WarnContext(ctx, "Request failed strict validation",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.Int("method_call_index", failure.Index),
+				slog.String("error_type", failure.Type),
+			)
+			return problemResponse(ctx, problem.New(400, failure.Type, failure.Error()).WithMethodCall(failure.Index)), nil
+		}
+	}
+
+	// A request repeating an Idempotency-Key gets the first response for it
+	// rather than running its method calls again
+	idempotencyKey := ""
+	if deps.Idempotency != nil {
+		idempotencyKey = idempotency.FromHeaders(request.Headers)
+	}
+	if idempotencyKey != "" {
+		if resp, handled := claimIdempotencyKey(ctx, request, accountID, idempotencyKey); handled {
+			return resp, nil
 		}
 	}
 
@@ -139,12 +398,15 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 
 	// Process method calls in parallel with dependency tracking
 	processor := &JMAPCallProcessor{
-		AccountID: accountID,
-		RequestID: request.RequestContext.RequestID,
-		UsingCaps: jmapReq.Using,
-		CDNURL:    cdnURL,
-		APIURL:    apiURL,
-		IsIAMAuth: isIAMAuthenticatedRequest(request),
+		AccountID:      accountID,
+		RequestID:      request.RequestContext.RequestID,
+		UsingCaps:      jmapReq.Using,
+		CDNURL:         cdnURL,
+		APIURL:         apiURL,
+		IsIAMAuth:      isIAMAuthenticatedRequest(request),
+		Features:       features,
+		Sampled:        deps.SamplePercent > 0 && rand.Float64()*100 < deps.SamplePercent,
+		WritesDisabled: meta != nil && meta.WritesDisabled,
 	}
 
 	cfg := dispatcher.Config{
@@ -155,22 +417,40 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 
 	methodResponses := dispatcher.Execute(ctx, cfg)
 
-	// Build response
-	jmapResp := JMAPResponse{
-		MethodResponses: methodResponses,
-		SessionState:    "0",
+	// Usage recording is best-effort: a failed counter update must not fail
+	// a request that has already been processed
+	if deps.Usage != nil {
+		if err := deps.Usage.RecordMethodCalls(ctx, accountID, len(jmapReq.MethodCalls)); err != nil {
+			logger.WarnContext(ctx, "Failed to record usage",
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+		}
 	}
 
-	bodyJSON, err := json.Marshal(jmapResp)
+	// Build response, one method response at a time; responses that would
+	// not fit are replaced by errors. The session state matches the one
+	// get-jmap-session gives, so clients know when to refetch the session.
+	sessionState := sessionstate.Compute(deps.Registry.Fingerprint(), sessionstate.FromMeta(meta))
+	body, err := encodeResponse(ctx, methodResponses, sessionState)
 	if err != nil {
+		if idempotencyKey != "" {
+			releaseIdempotencyKey(ctx, accountID, idempotencyKey)
+		}
+		if errors.Is(err, respbody.ErrTooLarge) {
+			logger.WarnContext(ctx, "JMAP response too large",
+				slog.String("request_id", request.RequestContext.RequestID),
+				slog.String("account_id", accountID),
+				slog.Int("method_count", len(jmapReq.MethodCalls)),
+			)
+			return problemResponse(ctx, problem.New(500, "serverFail", "Response is too large; split the request into smaller requests").
+				WithCode(errcode.ResponseTooLarge).
+				WithLimit("maxSizeResponse", int64(maxResponseSize()))), nil
+		}
 		logger.ErrorContext(ctx, "Failed to marshal response",
 			slog.String("error", err.Error()),
 		)
-		return Response{
-			StatusCode: 500,
-			Headers:    map[string]string{"Content-Type": "application/json"},
-			Body:       `{"error":"Internal server error"}`,
-		}, nil
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to build response")), nil
 	}
 
 	logger.InfoContext(ctx, "JMAP request completed",
@@ -179,59 +459,468 @@ func handler(ctx context.Context, request events.APIGatewayProxyRequest) (Respon
 		slog.Int("method_count", len(jmapReq.MethodCalls)),
 	)
 
+	if idempotencyKey != "" {
+		completeIdempotencyKey(ctx, accountID, idempotencyKey, idempotency.Snapshot{
+			RequestHash: idempotency.Hash(request.Body),
+			StatusCode:  200,
+			ContentType: "application/json",
+			Body:        body,
+		})
+	}
+
 	return Response{
 		StatusCode: 200,
 		Headers:    map[string]string{"Content-Type": "application/json"},
-		Body:       string(bodyJSON),
+		Body:       body,
+	}, nil
+}
+
+// acquireRequestLease takes a lease for the request if the core capability
+// declares maxConcurrentRequests, so an account can't have more requests in
+// flight than that. It returns the function releasing the lease, or the
+// response to send instead when the account is at its limit or the lease
+// can't be taken.
+func acquireRequestLease(ctx context.Context, request events.APIGatewayProxyRequest, accountID string) (func(), *Response) {
+	limit := deps.Registry.MaxConcurrentRequests()
+	if deps.Concurrency == nil || limit == 0 {
+		return func() {}, nil
+	}
+	requestID := request.RequestContext.RequestID
+	acquired, err := deps.Concurrency.Acquire(ctx, accountID, requestID, int(limit))
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to check concurrent requests",
+			slog.String("request_id", requestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		resp := problemResponse(ctx, problem.New(500, "serverFail", "Failed to check concurrent requests"))
+		return nil, &resp
+	}
+	if !acquired {
+		logger.WarnContext(ctx, "Too many concurrent requests",
+			slog.String("request_id", requestID),
+			slog.String("account_id", accountID),
+			slog.Int64("max_concurrent_requests", limit),
+		)
+		resp := problemResponse(ctx, problem.New(429, "limit", "Too many concurrent requests").
+			WithLimit(plugin.MaxConcurrentRequestsKey, limit))
+		resp.Headers["Retry-After"] = "1"
+		return nil, &resp
+	}
+
+	return func() {
+		// Released even if the request's context was cancelled, so the
+		// lease isn't held until it expires
+		if err := deps.Concurrency.Release(context.WithoutCancel(ctx), accountID, requestID); err != nil {
+			logger.WarnContext(ctx, "Failed to release request lease",
+				slog.String("request_id", requestID),
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+		}
 	}, nil
 }
 
+// encodeResponse encodes a JMAP response body. A method response that
+// would take the body over the size limit is replaced by a requestTooLarge
+// error, so the other calls' responses still reach the client. It fails
+// with respbody.ErrTooLarge only if even that error does not fit.
+func encodeResponse(ctx context.Context, methodResponses [][]any, sessionState string) (string, error) {
+	w := respbody.NewWriter(maxResponseSize())
+	defer w.Release()
+	for _, response := range methodResponses {
+		err := w.Add(response)
+		if errors.Is(err, respbody.ErrTooLarge) {
+			logger.WarnContext(ctx, "Method response too large, replaced with an error",
+				slog.String("method", responseField(response, 0)),
+				slog.String("client_id", responseField(response, 2)),
+				slog.Int("body_size", w.Len()),
+			)
+			err = w.Add([]any{"error", responseTooLargeError(), responseField(response, 2)})
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return w.Finish(nil, sessionState)
+}
+
+// responseTooLargeError is the method error replacing a response that does
+// not fit in the body
+func responseTooLargeError() map[string]any {
+	return map[string]any{
+		"type":        "requestTooLarge",
+		"description": "The response to this method call would exceed the maximum response size; split it into smaller method calls or requests",
+		errcode.Field: string(errcode.ResponseTooLarge),
+		"limit":       "maxSizeResponse",
+		"maxSize":     maxResponseSize(),
+	}
+}
+
+// responseField returns the string at index i of a method response, or ""
+func responseField(response []any, i int) string {
+	if i >= len(response) {
+		return ""
+	}
+	s, _ := response[i].(string)
+	return s
+}
+
+// maxResponseSize returns the largest response body jmap-api returns;
+// deps.MaxResponseSize overrides respbody.MaxSize when set
+func maxResponseSize() int {
+	if deps.MaxResponseSize > 0 {
+		return deps.MaxResponseSize
+	}
+	return respbody.MaxSize
+}
+
+// claimIdempotencyKey claims key for the request. It returns handled true,
+// with the response to send, when the request must not be processed: the
+// key is invalid, already holds a response to replay, is held by a request
+// still running, or was used for a different request body.
+func claimIdempotencyKey(ctx context.Context, request events.APIGatewayProxyRequest, accountID, key string) (Response, bool) {
+	if err := idempotency.CheckKey(key); err != nil {
+		return problemResponse(ctx, problem.New(400, "invalidArguments", "Idempotency-Key must be 1 to 255 printable ASCII characters")), true
+	}
+
+	requestHash := idempotency.Hash(request.Body)
+	snapshot, err := deps.Idempotency.Claim(ctx, accountID, key, requestHash)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to claim idempotency key",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return problemResponse(ctx, problem.New(500, "serverFail", "Failed to check Idempotency-Key")), true
+	}
+	if snapshot == nil {
+		return Response{}, false
+	}
+
+	if snapshot.RequestHash != requestHash {
+		logger.WarnContext(ctx, "Idempotency key reused for a different request",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+		)
+		return problemResponse(ctx, problem.New(422, "invalidArguments", "Idempotency-Key was already used for a different request").WithCode(errcode.IdempotencyKeyReused)), true
+	}
+	if snapshot.Pending() {
+		resp := problemResponse(ctx, problem.New(409, "conflict", "A request with this Idempotency-Key is still in progress"))
+		resp.Headers["Retry-After"] = "1"
+		return resp, true
+	}
+
+	logger.InfoContext(ctx, "Replaying idempotent response",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+	)
+	return Response{
+		StatusCode: snapshot.StatusCode,
+		Headers: map[string]string{
+			"Content-Type":             snapshot.ContentType,
+			idempotency.ReplayedHeader: "true",
+		},
+		Body: snapshot.Body,
+	}, true
+}
+
+// completeIdempotencyKey stores the response for a claimed key. The
+// response has already been produced, so a failure only releases the key,
+// leaving a retry to run the request again.
+func completeIdempotencyKey(ctx context.Context, accountID, key string, snapshot idempotency.Snapshot) {
+	if err := deps.Idempotency.Complete(ctx, accountID, key, snapshot); err != nil {
+		logger.WarnContext(ctx, "Failed to store idempotent response",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		releaseIdempotencyKey(ctx, accountID, key)
+	}
+}
+
+// releaseIdempotencyKey gives up a claimed key; if that fails too, the
+// claim blocks retries until it expires
+func releaseIdempotencyKey(ctx context.Context, accountID, key string) {
+	if err := deps.Idempotency.Release(ctx, accountID, key); err != nil {
+		logger.WarnContext(ctx, "Failed to release idempotency key",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// problemResponse builds a response carrying a problem
+func problemResponse(ctx context.Context, p *problem.Problem) Response {
+	return Response{
+		StatusCode: p.Status,
+		Headers:    problem.Headers(),
+		Body:       p.Body(ctx),
+	}
+}
+
 // extractAccountID extracts account ID from JWT claims or path parameter
-func extractAccountID(request events.APIGatewayProxyRequest) (string, error) {
+func extractAccountID(request events.APIGatewayProxyRequest, claim string) (string, error) {
 	// Check path parameter first (IAM auth)
 	if accountID, ok := request.PathParameters["accountId"]; ok && accountID != "" {
 		return accountID, nil
 	}
 
-	// Fall back to Cognito JWT claims
+	// Fall back to the user authorizer's claims
 	authorizer := request.RequestContext.Authorizer
 	if authorizer == nil {
 		return "", fmt.Errorf("no authorizer context")
 	}
 
-	claims, ok := authorizer["claims"].(map[string]any)
-	if !ok {
-		return "", fmt.Errorf("no claims in authorizer")
+	return auth.AccountIDFromAuthorizer(authorizer, claim)
+}
+
+// resolveAccountID maps an account alias to its account ID. Identifiers that
+// are not aliases are returned unchanged.
+func resolveAccountID(ctx context.Context, id string) (string, error) {
+	if deps.Aliases == nil || !account.IsAlias(id) {
+		return id, nil
+	}
+	return deps.Aliases.ResolveAlias(ctx, id)
+}
+
+// canonicalizeArgsAccountID replaces an alias in the accountId argument with
+// the account ID it resolves to, so built-in methods and plugins only ever
+// see account IDs. Aliases for other accounts, and unknown aliases, are left
+// in place to fail the usual account check.
+func canonicalizeArgsAccountID(ctx context.Context, accountID string, args map[string]any) (map[string]any, error) {
+	argsAccountID, ok := args["accountId"].(string)
+	if !ok || argsAccountID == accountID || !account.IsAlias(argsAccountID) {
+		return args, nil
 	}
 
-	sub, ok := claims["sub"].(string)
-	if !ok || sub == "" {
-		return "", fmt.Errorf("sub claim not found or empty")
+	resolvedID, err := resolveAccountID(ctx, argsAccountID)
+	if err != nil {
+		if errors.Is(err, account.ErrAliasNotFound) {
+			return args, nil
+		}
+		return nil, err
+	}
+	if resolvedID != accountID {
+		return args, nil
 	}
 
-	return sub, nil
+	canonical := make(map[string]any, len(args))
+	for k, v := range args {
+		canonical[k] = v
+	}
+	canonical["accountId"] = accountID
+	return canonical, nil
 }
 
 // UploadPutCapability is the capability URN for the PUT upload extension
 const UploadPutCapability = "https://jmap.rrod.net/extensions/upload-put"
 
+// AccountExportCapability is the capability URN for the account export extension
+const AccountExportCapability = "https://jmap.rrod.net/extensions/account-export"
+
 // JMAPCallProcessor implements dispatcher.CallProcessor for JMAP method calls
 type JMAPCallProcessor struct {
-	AccountID string
-	RequestID string
-	UsingCaps []string
-	CDNURL    string
-	APIURL    string
-	IsIAMAuth bool
+	AccountID      string
+	RequestID      string
+	UsingCaps      []string
+	CDNURL         string
+	APIURL         string
+	IsIAMAuth      bool
+	Features       account.Features
+	Sampled        bool
+	WritesDisabled bool // refuse calls that would change the account
 }
 
 // Process implements dispatcher.CallProcessor
 func (p *JMAPCallProcessor) Process(ctx context.Context, idx int, call []any, depResponses []resultref.MethodResponse) []any {
-	return processMethodCall(ctx, p.AccountID, call, idx, p.RequestID, depResponses, p.UsingCaps, p.CDNURL, p.APIURL, p.IsIAMAuth)
+	start := time.Now()
+	var response []any
+	if p.WritesDisabled && isWriteCall(call) {
+		clientID, _ := call[2].(string)
+		response = []any{"error", (&jmaperror.MethodError{
+			ErrType:     "accountReadOnly",
+			Description: "Writes are disabled for this account",
+		}).ToMap(), clientID}
+	} else {
+		response = processMethodCall(ctx, p.AccountID, call, idx, p.RequestID, depResponses, p.UsingCaps, p.CDNURL, p.APIURL, p.IsIAMAuth, p.Features)
+	}
+	latency := time.Since(start)
+	if len(response) > 1 && response[0] == "error" {
+		if args, ok := response[1].(map[string]any); ok {
+			errcode.Attach(args)
+		}
+	}
+	if deps.Metrics != nil {
+		deps.Metrics.RecordMethodCall(methodCallMetrics(call, response, latency))
+	}
+	if len(call) > 0 && len(response) > 0 {
+		logger.DebugContext(ctx, "Method call processed",
+			slog.String("request_id", p.RequestID),
+			slog.String("account_id", p.AccountID),
+			slog.Any("method", call[0]),
+			slog.Any("response", response[0]),
+			slog.Int64("duration_ms", latency.Milliseconds()),
+		)
+	}
+	if p.Sampled && len(call) > 1 {
+		logger.InfoContext(ctx, "Sampled method call",
+			slog.String("request_id", p.RequestID),
+			slog.String("account_id", p.AccountID),
+			slog.Any("method", call[0]),
+			slog.Any("args", redact.Value(call[1])),
+			slog.Any("response", redact.Value(response)),
+		)
+	}
+	return response
+}
+
+// recordActivity updates the account's lastActivityAt when it is due. A
+// failure is logged rather than failing the request.
+func recordActivity(ctx context.Context, accountID string, meta *account.Meta) {
+	now := time.Now()
+	if deps.Activity == nil || !account.ActivityDue(meta, now) {
+		return
+	}
+	if err := deps.Activity.RecordActivity(ctx, accountID, now); err != nil {
+		logger.WarnContext(ctx, "Failed to record account activity",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// coreMethods are the methods core handles without a plugin
+var coreMethods = map[string]bool{
+	"Blob/allocate":         true,
+	"Blob/complete":         true,
+	"Blob/allocationStatus": true,
+	"Blob/reallocateParts":  true,
+	"Blob/queryByMetadata":  true,
+	"Account/export":        true,
+	"Core/ping":             true,
+}
+
+// coreMethodCapabilities are the capabilities core methods need in using;
+// core methods not listed need none
+var coreMethodCapabilities = map[string]string{
+	"Blob/allocate":         UploadPutCapability,
+	"Blob/complete":         UploadPutCapability,
+	"Blob/allocationStatus": UploadPutCapability,
+	"Blob/reallocateParts":  UploadPutCapability,
+	"Blob/queryByMetadata":  UploadPutCapability,
+	"Account/export":        AccountExportCapability,
+}
+
+// methodCapability returns the capability a method needs in using, or "" if
+// it needs none. Plugin methods need the capability their registration
+// says owns them.
+func methodCapability(name string) string {
+	if coreMethods[name] {
+		return coreMethodCapabilities[name]
+	}
+	if target := deps.Registry.GetMethodTarget(name); target != nil {
+		return target.Capability
+	}
+	return ""
+}
+
+// checkRequest runs the strict validation pass over the request's method
+// calls. An accountId that is an alias of the account passes; one whose
+// alias can't be resolved is left for the call itself to report.
+func checkRequest(ctx context.Context, accountID string, jmapReq JMAPRequest) *requestcheck.Failure {
+	return requestcheck.Check(jmapReq.MethodCalls, requestcheck.Rules{
+		Using: jmapReq.Using,
+		KnownMethod: func(name string) bool {
+			return coreMethods[name] || deps.Registry.GetMethodTarget(name) != nil
+		},
+		RequiredCapability: methodCapability,
+		AccountMatches: func(id string) bool {
+			if id == accountID || !account.IsAlias(id) {
+				return id == accountID
+			}
+			resolvedID, err := resolveAccountID(ctx, id)
+			if err != nil {
+				return !errors.Is(err, account.ErrAliasNotFound)
+			}
+			return resolvedID == accountID
+		},
+	})
+}
+
+// writeMethods are the core methods that create or change blobs
+var writeMethods = map[string]bool{
+	"Blob/allocate":        true,
+	"Blob/complete":        true,
+	"Blob/reallocateParts": true,
+}
+
+// writeMethodSuffixes end the names of the standard methods that change
+// data (RFC 8620 and RFC 9404), such as Email/set and Email/import
+var writeMethodSuffixes = []string{"/set", "/copy", "/import", "/upload"}
+
+// isWriteCall reports whether a well-formed method call would change the
+// account, and so is refused while its writes are disabled. Reads such as
+// /get, /query and /changes are always allowed.
+func isWriteCall(call []any) bool {
+	if len(call) != 3 {
+		return false
+	}
+	name, _ := call[0].(string)
+	if writeMethods[name] {
+		return true
+	}
+	for _, suffix := range writeMethodSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// unknownMethod is the Method and Plugin dimension of calls to methods no
+// plugin serves. Client-supplied names are not used, so clients can't create
+// arbitrary metrics.
+const unknownMethod = "unknown"
+
+// methodCallMetrics describes a method call and its response for metrics
+func methodCallMetrics(call, response []any, latency time.Duration) metrics.MethodCall {
+	result := metrics.MethodCall{Method: unknownMethod, Plugin: unknownMethod, Latency: latency}
+	if len(call) == 0 {
+		return result
+	}
+	if name, ok := call[0].(string); ok {
+		if coreMethods[name] {
+			result.Method, result.Plugin = name, metrics.CorePlugin
+		} else if deps.Registry != nil {
+			if pluginID := deps.Registry.MethodPlugin(name); pluginID != "" {
+				result.Method, result.Plugin = name, pluginID
+			}
+		}
+	}
+
+	if len(call) > 1 {
+		if data, err := json.Marshal(call[1]); err == nil {
+			result.RequestBytes = len(data)
+		}
+	}
+	if len(response) > 1 {
+		if data, err := json.Marshal(response[1]); err == nil {
+			result.ResponseBytes = len(data)
+		}
+		if name, _ := response[0].(string); name == "error" {
+			result.ErrorType = "unknown"
+			if args, ok := response[1].(map[string]any); ok {
+				if errType, ok := args["type"].(string); ok && errType != "" {
+					result.ErrorType = errType
+				}
+			}
+		}
+	}
+	return result
 }
 
 // processMethodCall dispatches a method call to the appropriate plugin
-func processMethodCall(ctx context.Context, accountID string, call []any, index int, requestID string, previousResponses []resultref.MethodResponse, usingCaps []string, cdnURL string, apiURL string, isIAMAuth bool) []any {
+func processMethodCall(ctx context.Context, accountID string, call []any, index int, requestID string, previousResponses []resultref.MethodResponse, usingCaps []string, cdnURL string, apiURL string, isIAMAuth bool, features account.Features) []any {
 	// Extract method name and clientID early for span attributes
 	var methodName, clientID string
 	if len(call) >= 1 {
@@ -274,13 +963,39 @@ func processMethodCall(ctx context.Context, accountID string, call []any, index
 		return []any{"error", jmaperror.ServerFail("Failed to resolve result references", err).ToMap(), clientID}
 	}
 
+	// Accept an alias of the authenticated account as the accountId argument
+	resolvedArgs, err = canonicalizeArgsAccountID(ctx, accountID, resolvedArgs)
+	if err != nil {
+		tracing.RecordError(span, err)
+		logger.ErrorContext(ctx, "Failed to resolve accountId alias",
+			slog.String("method", methodName),
+			slog.String("error", err.Error()),
+		)
+		return []any{"error", jmaperror.ServerFail("Failed to resolve accountId", err).ToMap(), clientID}
+	}
+
 	// Handle built-in methods before plugin dispatch
 	if methodName == "Blob/allocate" {
-		return handleBlobAllocate(ctx, accountID, resolvedArgs, clientID, usingCaps, isIAMAuth)
+		return handleBlobAllocate(ctx, accountID, resolvedArgs, clientID, usingCaps, isIAMAuth, features)
 	}
 	if methodName == "Blob/complete" {
 		return handleBlobComplete(ctx, accountID, resolvedArgs, clientID, usingCaps)
 	}
+	if methodName == "Blob/allocationStatus" {
+		return handleBlobAllocationStatus(ctx, accountID, resolvedArgs, clientID, usingCaps)
+	}
+	if methodName == "Blob/reallocateParts" {
+		return handleBlobReallocateParts(ctx, accountID, resolvedArgs, clientID, usingCaps)
+	}
+	if methodName == "Blob/queryByMetadata" {
+		return handleBlobQueryByMetadata(ctx, accountID, resolvedArgs, clientID, usingCaps)
+	}
+	if methodName == "Account/export" {
+		return handleAccountExport(ctx, accountID, resolvedArgs, clientID, usingCaps)
+	}
+	if methodName == "Core/ping" {
+		return handleCorePing(ctx, accountID, resolvedArgs, clientID, requestID, index)
+	}
 
 	// Look up method target
 	target := deps.Registry.GetMethodTarget(methodName)
@@ -288,6 +1003,12 @@ func processMethodCall(ctx context.Context, accountID string, call []any, index
 		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
 	}
 
+	// A method is only callable with the capability that owns it in using
+	// (RFC 8620 Section 3.6.2)
+	if target.Capability != "" && !slices.Contains(usingCaps, target.Capability) {
+		return []any{"error", jmaperror.UnknownMethod(methodName + " requires the " + target.Capability + " capability").ToMap(), clientID}
+	}
+
 	// Validate accountId in args matches authenticated accountId
 	if argsAccountID, ok := resolvedArgs["accountId"].(string); ok {
 		if argsAccountID != accountID {
@@ -295,16 +1016,64 @@ func processMethodCall(ctx context.Context, accountID string, call []any, index
 		}
 	}
 
+	// Check the arguments against the schema the plugin registered for the
+	// method, so it only sees arguments of the shape it expects
+	if schema := deps.Registry.ArgsSchema(methodName); schema != nil {
+		if schemaErr := schema.Validate(resolvedArgs); schemaErr != nil {
+			errMap := jmaperror.InvalidArguments(schemaErr.Error()).ToMap()
+			errMap["schemaPath"] = schemaErr.SchemaPath
+			return []any{"error", errMap, clientID}
+		}
+	}
+
+	// A /query method following the paging contract gets its paging
+	// arguments checked here, so every plugin rejects the same bad ones
+	var pageReq querypage.Request
+	if target.Paging {
+		if pageReq, err = querypage.ParseRequest(resolvedArgs); err != nil {
+			return []any{"error", jmaperror.InvalidArguments(err.Error()).ToMap(), clientID}
+		}
+	}
+
+	// A /changes method taking state tokens only sees tokens issued for
+	// this account that are intact and current
+	if name := statetoken.SinceArgument(methodName); target.StateTokens && name != "" {
+		since, ok := resolvedArgs[name].(string)
+		if !ok {
+			return []any{"error", jmaperror.InvalidArguments(name + " must be a string").ToMap(), clientID}
+		}
+		if _, err := statetoken.Verify(since, accountID, time.Now(), deps.StateTokenMaxAge); err != nil {
+			return []any{"error", jmaperror.CannotCalculateChanges(err.Error()).ToMap(), clientID}
+		}
+	}
+
 	// Build plugin request
 	pluginReq := plugin.PluginInvocationRequest{
-		RequestID: requestID,
-		CallIndex: index,
-		AccountID: accountID,
-		Method:    methodName,
-		Args:      resolvedArgs,
-		ClientID:  clientID,
-		CDNURL:    cdnURL,
-		APIURL:    apiURL,
+		PluginInvocationRequest: plugincontract.PluginInvocationRequest{
+			RequestID: requestID,
+			CallIndex: index,
+			AccountID: accountID,
+			Method:    methodName,
+			Args:      resolvedArgs,
+			ClientID:  clientID,
+			CDNURL:    cdnURL,
+			APIURL:    apiURL,
+		},
+		CorrelationID: correlation.FromContext(ctx),
+	}
+
+	// Let the plugin call back into core for this account only, as one of
+	// its own client principals
+	if deps.Delegation != nil {
+		token, err := deps.Delegation.Mint(accountID, requestID, methodName, deps.Registry.MethodPrincipals(methodName))
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to mint delegation token",
+				slog.String("method", methodName),
+				slog.String("error", err.Error()),
+			)
+			return []any{"error", jmaperror.ServerFail("Failed to mint delegation token", err).ToMap(), clientID}
+		}
+		pluginReq.DelegationToken = token
 	}
 
 	// Invoke plugin
@@ -318,6 +1087,23 @@ func processMethodCall(ctx context.Context, accountID string, call []any, index
 		return []any{"error", jmaperror.ServerFail("Plugin invocation failed", err).ToMap(), clientID}
 	}
 
+	// Async methods are answered as soon as Lambda has queued the call; the
+	// plugin's own response is never seen
+	if target.Async {
+		return []any{methodName, map[string]any{"accountId": accountID, "accepted": true}, clientID}
+	}
+
+	// Its response must be a consistent page for those arguments
+	if target.Paging && pluginResp.MethodResponse.Name == methodName {
+		if err := querypage.Check(pageReq, pluginResp.MethodResponse.Args); err != nil {
+			logger.ErrorContext(ctx, "Plugin returned an invalid query response",
+				slog.String("method", methodName),
+				slog.String("error", err.Error()),
+			)
+			return []any{"error", jmaperror.ServerFail("Plugin returned an invalid query response", err).ToMap(), clientID}
+		}
+	}
+
 	// Return plugin response as JMAP method response
 	return []any{
 		pluginResp.MethodResponse.Name,
@@ -327,7 +1113,7 @@ func processMethodCall(ctx context.Context, accountID string, call []any, index
 }
 
 // handleBlobAllocate processes a Blob/allocate method call
-func handleBlobAllocate(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string, isIAMAuth bool) []any {
+func handleBlobAllocate(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string, isIAMAuth bool, features account.Features) []any {
 	// Check if Blob/allocate is enabled
 	if deps.BlobAllocator == nil {
 		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
@@ -371,23 +1157,81 @@ func handleBlobAllocate(ctx context.Context, accountID string, args map[string]a
 		contentType, _ := reqMap["type"].(string)
 		size, _ := reqMap["size"].(float64) // JSON numbers come as float64
 		multipart, _ := reqMap["multipart"].(bool)
-
-		// Multipart is IAM-only
-		if multipart && !isIAMAuth {
+		name, _ := reqMap["name"].(string)
+		tags, ok := allocateTags(reqMap["tags"])
+		if !ok {
 			notCreated[creationID] = (&jmaperror.SetError{
-				ErrType:     "invalidArguments",
+				ErrType:     "invalidProperties",
+				Description: "tags must be an object of string values",
+				Properties:  []string{"tags"},
+			}).ToMap()
+			continue
+		}
+		indexed, ok := allocateIndexedMetadata(reqMap["indexedMetadata"])
+		if !ok {
+			notCreated[creationID] = (&jmaperror.SetError{
+				ErrType:     "invalidProperties",
+				Description: "indexedMetadata must be an object with string key and value",
+				Properties:  []string{"indexedMetadata"},
+			}).ToMap()
+			continue
+		}
+		checksum, ok := reqMap["checksumSha256"].(string)
+		if !ok && reqMap["checksumSha256"] != nil {
+			notCreated[creationID] = (&jmaperror.SetError{
+				ErrType:     "invalidProperties",
+				Description: "checksumSha256 must be a string",
+				Properties:  []string{"checksumSha256"},
+			}).ToMap()
+			continue
+		}
+
+		// Multipart is IAM-only
+		if multipart && !isIAMAuth {
+			notCreated[creationID] = (&jmaperror.SetError{
+				ErrType:     "invalidArguments",
 				Description: "multipart upload is only available via IAM authentication",
 			}).ToMap()
 			continue
 		}
 
+		if multipart && !features.MultipartAllowed() {
+			notCreated[creationID] = (&jmaperror.SetError{
+				ErrType:     "invalidArguments",
+				Description: "multipart upload is not available for this account",
+			}).ToMap()
+			continue
+		}
+
+		// A create naming the capability the blob is for is also held to
+		// that capability's maxSizeUpload
+		maxSize := features.MaxBlobSize
+		if capability, _ := reqMap["capability"].(string); capability != "" {
+			limit, ok := deps.Registry.MaxSizeUpload(capability)
+			if !ok {
+				notCreated[creationID] = (&jmaperror.SetError{
+					ErrType:     "invalidProperties",
+					Description: "capability is not supported",
+					Properties:  []string{"capability"},
+				}).ToMap()
+				continue
+			}
+			maxSize = features.BlobSizeLimit(limit)
+		}
+
 		req := bloballocate.AllocateRequest{
 			AccountID:   accountID,
 			Type:        contentType,
 			Size:        int64(size),
 			SizeUnknown: (isIAMAuth && int64(size) == 0) || multipart,
 			Multipart:   multipart,
+			Name:        name,
+			Tags:        tags,
 			IsIAMAuth:   isIAMAuth,
+			MaxSize:     maxSize,
+
+			IndexedMetadata: indexed,
+			ChecksumSHA256:  checksum,
 		}
 
 		resp, err := deps.BlobAllocator.Allocate(ctx, req)
@@ -412,6 +1256,21 @@ func handleBlobAllocate(ctx context.Context, accountID string, args map[string]a
 			"size":    resp.Size,
 			"expires": resp.URLExpires.UTC().Format("2006-01-02T15:04:05Z"),
 		}
+		if resp.Name != "" {
+			createdEntry["name"] = resp.Name
+		}
+		if len(resp.Tags) > 0 {
+			createdEntry["tags"] = resp.Tags
+		}
+		if resp.IndexedMetadata != nil {
+			createdEntry["indexedMetadata"] = map[string]any{
+				"key":   resp.IndexedMetadata.Key,
+				"value": resp.IndexedMetadata.Value,
+			}
+		}
+		if resp.ChecksumSHA256 != "" {
+			createdEntry["checksumSha256"] = resp.ChecksumSHA256
+		}
 		if len(resp.Parts) > 0 {
 			// Multipart response: include parts, no single URL
 			partsOut := make([]map[string]any, len(resp.Parts))
@@ -438,6 +1297,9 @@ func handleBlobAllocate(ctx context.Context, accountID string, args map[string]a
 		response["created"] = nil
 	}
 	if len(notCreated) > 0 {
+		for _, setErr := range notCreated {
+			errcode.Attach(setErr.(map[string]any))
+		}
 		response["notCreated"] = notCreated
 	} else {
 		response["notCreated"] = nil
@@ -446,6 +1308,46 @@ func handleBlobAllocate(ctx context.Context, accountID string, args map[string]a
 	return []any{"Blob/allocate", response, clientID}
 }
 
+// allocateTags reads the optional tags property of a Blob/allocate create
+// request, which must be an object of string values
+func allocateTags(value any) (map[string]string, bool) {
+	if value == nil {
+		return nil, true
+	}
+	obj, ok := value.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	tags := make(map[string]string, len(obj))
+	for key, v := range obj {
+		s, ok := v.(string)
+		if !ok {
+			return nil, false
+		}
+		tags[key] = s
+	}
+	return tags, true
+}
+
+// allocateIndexedMetadata reads the optional indexedMetadata property of a
+// Blob/allocate create request, which must be an object with a string key
+// and value
+func allocateIndexedMetadata(value any) (*blobmeta.IndexedMetadata, bool) {
+	if value == nil {
+		return nil, true
+	}
+	obj, ok := value.(map[string]any)
+	if !ok || len(obj) != 2 {
+		return nil, false
+	}
+	key, keyOK := obj["key"].(string)
+	val, valOK := obj["value"].(string)
+	if !keyOK || !valOK {
+		return nil, false
+	}
+	return &blobmeta.IndexedMetadata{Key: key, Value: val}, true
+}
+
 // handleBlobComplete processes a Blob/complete method call
 func handleBlobComplete(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string) []any {
 	// Check if Blob/complete is enabled
@@ -494,9 +1396,14 @@ func handleBlobComplete(ctx context.Context, accountID string, args map[string]a
 		if partNum <= 0 || etag == "" {
 			return []any{"error", jmaperror.InvalidArguments("each part must have a positive partNumber and non-empty etag").ToMap(), clientID}
 		}
+		checksum, ok := pMap["checksumSha256"].(string)
+		if !ok && pMap["checksumSha256"] != nil {
+			return []any{"error", jmaperror.InvalidArguments("each part's checksumSha256 must be a string").ToMap(), clientID}
+		}
 		parts = append(parts, bloballocate.CompletedPart{
-			PartNumber: int32(partNum),
-			ETag:       etag,
+			PartNumber:     int32(partNum),
+			ETag:           etag,
+			ChecksumSHA256: checksum,
 		})
 	}
 
@@ -526,6 +1433,374 @@ func handleBlobComplete(ctx context.Context, accountID string, args map[string]a
 	return []any{"Blob/complete", response, clientID}
 }
 
+// handleBlobAllocationStatus processes a Blob/allocationStatus method call,
+// reporting whether an allocation can still be uploaded to and, for a
+// multipart upload, which parts have arrived
+func handleBlobAllocationStatus(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string) []any {
+	// Check if Blob/allocationStatus is enabled
+	if deps.BlobStatus == nil {
+		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
+	}
+
+	// Check that the capability is in the using array
+	hasCapability := false
+	for _, cap := range usingCaps {
+		if cap == UploadPutCapability {
+			hasCapability = true
+			break
+		}
+	}
+	if !hasCapability {
+		return []any{"error", jmaperror.UnknownMethod("Blob/allocationStatus requires the " + UploadPutCapability + " capability").ToMap(), clientID}
+	}
+
+	// Validate accountId in args
+	argsAccountID, _ := args["accountId"].(string)
+	if argsAccountID != "" && argsAccountID != accountID {
+		return []any{"error", jmaperror.AccountNotFound("Account ID mismatch").ToMap(), clientID}
+	}
+
+	// Extract blobId
+	blobID, _ := args["id"].(string)
+	if blobID == "" {
+		return []any{"error", jmaperror.InvalidArguments("id is required").ToMap(), clientID}
+	}
+
+	resp, err := deps.BlobStatus.Status(ctx, blobstatus.StatusRequest{AccountID: accountID, BlobID: blobID})
+	if err != nil {
+		statusErr, ok := err.(*blobstatus.StatusError)
+		if ok {
+			return []any{"error", (&jmaperror.MethodError{
+				ErrType:     statusErr.Type,
+				Description: statusErr.Message,
+			}).ToMap(), clientID}
+		}
+		return []any{"error", jmaperror.ServerFail("Failed to get allocation status", err).ToMap(), clientID}
+	}
+
+	response := map[string]any{
+		"accountId": resp.AccountID,
+		"id":        resp.BlobID,
+		"status":    resp.Status,
+		"multipart": resp.Multipart,
+	}
+	if resp.Size != nil {
+		response["size"] = *resp.Size
+	}
+	if resp.URLExpires != nil {
+		response["urlExpires"] = resp.URLExpires.UTC().Format(time.RFC3339)
+	}
+	if resp.Multipart && resp.Status != blobstatus.StatusConfirmed {
+		uploaded := make([]map[string]any, len(resp.UploadedParts))
+		for i, p := range resp.UploadedParts {
+			uploaded[i] = map[string]any{
+				"partNumber": p.PartNumber,
+				"etag":       p.ETag,
+				"size":       p.Size,
+			}
+		}
+		response["uploadedParts"] = uploaded
+		response["remainingParts"] = append([]int32{}, resp.RemainingParts...)
+	}
+
+	return []any{"Blob/allocationStatus", response, clientID}
+}
+
+// handleBlobQueryByMetadata processes a Blob/queryByMetadata method call,
+// returning the IDs of the account's blobs allocated with an indexed
+// metadata key and value
+func handleBlobQueryByMetadata(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string) []any {
+	// Check if Blob/queryByMetadata is enabled
+	if deps.BlobIndex == nil {
+		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
+	}
+
+	// Check that the capability is in the using array
+	hasCapability := false
+	for _, cap := range usingCaps {
+		if cap == UploadPutCapability {
+			hasCapability = true
+			break
+		}
+	}
+	if !hasCapability {
+		return []any{"error", jmaperror.UnknownMethod("Blob/queryByMetadata requires the " + UploadPutCapability + " capability").ToMap(), clientID}
+	}
+
+	// Validate accountId in args
+	argsAccountID, _ := args["accountId"].(string)
+	if argsAccountID != "" && argsAccountID != accountID {
+		return []any{"error", jmaperror.AccountNotFound("Account ID mismatch").ToMap(), clientID}
+	}
+
+	key, _ := args["key"].(string)
+	value, _ := args["value"].(string)
+	after, _ := args["after"].(string)
+	limit, _ := args["limit"].(float64) // JSON numbers come as float64
+	if limit != float64(int(limit)) {
+		return []any{"error", jmaperror.InvalidArguments("limit must be an integer").ToMap(), clientID}
+	}
+
+	resp, err := deps.BlobIndex.Query(ctx, blobindex.QueryRequest{
+		AccountID: accountID,
+		Key:       key,
+		Value:     value,
+		After:     after,
+		Limit:     int(limit),
+	})
+	if err != nil {
+		queryErr, ok := err.(*blobindex.QueryError)
+		if ok {
+			return []any{"error", (&jmaperror.MethodError{
+				ErrType:     queryErr.Type,
+				Description: queryErr.Message,
+			}).ToMap(), clientID}
+		}
+		return []any{"error", jmaperror.ServerFail("Failed to query blobs by metadata", err).ToMap(), clientID}
+	}
+
+	return []any{"Blob/queryByMetadata", map[string]any{
+		"accountId": resp.AccountID,
+		"key":       resp.Key,
+		"value":     resp.Value,
+		"ids":       resp.IDs,
+		"hasMore":   resp.HasMore,
+	}, clientID}
+}
+
+// handleBlobReallocateParts processes a Blob/reallocateParts method call,
+// presigning fresh URLs for parts of a pending multipart upload whose URLs
+// have expired
+func handleBlobReallocateParts(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string) []any {
+	// Check if Blob/reallocateParts is enabled
+	if deps.BlobReallocator == nil {
+		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
+	}
+
+	// Check that the capability is in the using array
+	hasCapability := false
+	for _, cap := range usingCaps {
+		if cap == UploadPutCapability {
+			hasCapability = true
+			break
+		}
+	}
+	if !hasCapability {
+		return []any{"error", jmaperror.UnknownMethod("Blob/reallocateParts requires the " + UploadPutCapability + " capability").ToMap(), clientID}
+	}
+
+	// Validate accountId in args
+	argsAccountID, _ := args["accountId"].(string)
+	if argsAccountID != "" && argsAccountID != accountID {
+		return []any{"error", jmaperror.AccountNotFound("Account ID mismatch").ToMap(), clientID}
+	}
+
+	// Extract blobId
+	blobID, _ := args["id"].(string)
+	if blobID == "" {
+		return []any{"error", jmaperror.InvalidArguments("id is required").ToMap(), clientID}
+	}
+
+	// Extract partNumbers array; S3 allows part numbers up to 10000
+	partsRaw, ok := args["partNumbers"].([]any)
+	if !ok || len(partsRaw) == 0 {
+		return []any{"error", jmaperror.InvalidArguments("partNumbers array is required and must not be empty").ToMap(), clientID}
+	}
+	partNumbers := make([]int32, 0, len(partsRaw))
+	for _, pRaw := range partsRaw {
+		partNum, _ := pRaw.(float64)
+		if partNum < 1 || partNum > 10000 || partNum != float64(int32(partNum)) {
+			return []any{"error", jmaperror.InvalidArguments("each part number must be a positive integer").ToMap(), clientID}
+		}
+		partNumbers = append(partNumbers, int32(partNum))
+	}
+
+	resp, err := deps.BlobReallocator.Reallocate(ctx, blobreallocate.ReallocateRequest{
+		AccountID:   accountID,
+		BlobID:      blobID,
+		PartNumbers: partNumbers,
+	})
+	if err != nil {
+		reallocErr, ok := err.(*blobreallocate.ReallocateError)
+		if ok {
+			return []any{"error", (&jmaperror.MethodError{
+				ErrType:     reallocErr.Type,
+				Description: reallocErr.Message,
+			}).ToMap(), clientID}
+		}
+		return []any{"error", jmaperror.ServerFail("Failed to reallocate parts", err).ToMap(), clientID}
+	}
+
+	partsOut := make([]map[string]any, len(resp.Parts))
+	for i, p := range resp.Parts {
+		partsOut[i] = map[string]any{
+			"partNumber": p.PartNumber,
+			"url":        p.URL,
+		}
+	}
+	response := map[string]any{
+		"accountId": resp.AccountID,
+		"id":        resp.BlobID,
+		"expires":   resp.URLExpires.UTC().Format("2006-01-02T15:04:05Z"),
+		"parts":     partsOut,
+	}
+
+	return []any{"Blob/reallocateParts", response, clientID}
+}
+
+// handleAccountExport processes an Account/export method call.
+// Without an exportId it starts a new export job; with one it reports the
+// job's status, including the archive blobId once it has completed.
+func handleAccountExport(ctx context.Context, accountID string, args map[string]any, clientID string, usingCaps []string) []any {
+	// Check if Account/export is enabled
+	if deps.AccountExporter == nil {
+		return []any{"error", jmaperror.UnknownMethod("").ToMap(), clientID}
+	}
+
+	// Check that the capability is in the using array
+	hasCapability := false
+	for _, cap := range usingCaps {
+		if cap == AccountExportCapability {
+			hasCapability = true
+			break
+		}
+	}
+	if !hasCapability {
+		return []any{"error", jmaperror.UnknownMethod("Account/export requires the " + AccountExportCapability + " capability").ToMap(), clientID}
+	}
+
+	// Validate accountId in args
+	argsAccountID, _ := args["accountId"].(string)
+	if argsAccountID != "" && argsAccountID != accountID {
+		return []any{"error", jmaperror.AccountNotFound("Account ID mismatch").ToMap(), clientID}
+	}
+
+	var job *accountexport.Job
+	var err error
+	if rawExportID, present := args["exportId"]; present {
+		exportID, ok := rawExportID.(string)
+		if !ok || exportID == "" {
+			return []any{"error", jmaperror.InvalidArguments("exportId must be a non-empty string").ToMap(), clientID}
+		}
+		job, err = deps.AccountExporter.Get(ctx, accountID, exportID)
+	} else {
+		job, err = deps.AccountExporter.Start(ctx, accountID)
+		if err == nil {
+			logger.InfoContext(ctx, "Account export started",
+				slog.String("account_id", accountID),
+				slog.String("export_id", job.ExportID),
+			)
+		}
+	}
+	if err != nil {
+		exportErr, ok := err.(*accountexport.ExportError)
+		if ok {
+			return []any{"error", (&jmaperror.MethodError{
+				ErrType:     exportErr.Type,
+				Description: exportErr.Message,
+			}).ToMap(), clientID}
+		}
+		return []any{"error", jmaperror.ServerFail("Failed to process export", err).ToMap(), clientID}
+	}
+
+	response := map[string]any{
+		"accountId": accountID,
+		"exportId":  job.ExportID,
+		"status":    job.Status,
+		"createdAt": job.CreatedAt,
+	}
+	if job.BlobID != "" {
+		response["blobId"] = job.BlobID
+		response["size"] = job.Size
+	}
+	if job.CompletedAt != "" {
+		response["completedAt"] = job.CompletedAt
+	}
+	if job.Error != "" {
+		response["error"] = job.Error
+	}
+
+	return []any{"Account/export", response, clientID}
+}
+
+// pingInvokeMethod is the no-op plugin method Core/ping invokes when asked to
+const pingInvokeMethod = "Core/echo"
+
+// handleCorePing processes a Core/ping method call. It exercises the parts of
+// the request path every method depends on — a registry lookup, a DynamoDB
+// read and, when "invoke" is true, a Core/echo plugin invocation — and
+// reports how long each took, for canaries to alarm on.
+func handleCorePing(ctx context.Context, accountID string, args map[string]any, clientID string, requestID string, index int) []any {
+	// Validate accountId in args
+	argsAccountID, _ := args["accountId"].(string)
+	if argsAccountID != "" && argsAccountID != accountID {
+		return []any{"error", jmaperror.AccountNotFound("Account ID mismatch").ToMap(), clientID}
+	}
+
+	invoke := false
+	if rawInvoke, present := args["invoke"]; present {
+		var ok bool
+		if invoke, ok = rawInvoke.(bool); !ok {
+			return []any{"error", jmaperror.InvalidArguments("invoke must be a boolean").ToMap(), clientID}
+		}
+	}
+
+	start := time.Now()
+	timings := make(map[string]any)
+
+	stepStart := time.Now()
+	target := deps.Registry.GetMethodTarget(pingInvokeMethod)
+	timings["registryLookupMs"] = durationMs(time.Since(stepStart))
+
+	stepStart = time.Now()
+	if _, err := deps.Accounts.GetMeta(ctx, accountID); err != nil {
+		logger.ErrorContext(ctx, "Core/ping account read failed",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return []any{"error", jmaperror.ServerFail("Failed to read account", err).ToMap(), clientID}
+	}
+	timings["dynamodbReadMs"] = durationMs(time.Since(stepStart))
+
+	if invoke {
+		if target == nil {
+			return []any{"error", jmaperror.ServerFail(pingInvokeMethod+" is not registered", nil).ToMap(), clientID}
+		}
+		stepStart = time.Now()
+		_, err := deps.Invoker.Invoke(ctx, *target, plugin.PluginInvocationRequest{
+			PluginInvocationRequest: plugincontract.PluginInvocationRequest{
+				RequestID: requestID,
+				CallIndex: index,
+				AccountID: accountID,
+				Method:    pingInvokeMethod,
+				Args:      map[string]any{},
+				ClientID:  clientID,
+			},
+			CorrelationID: correlation.FromContext(ctx),
+		})
+		if err != nil {
+			logger.ErrorContext(ctx, "Core/ping plugin invocation failed",
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return []any{"error", jmaperror.ServerFail("Plugin invocation failed", err).ToMap(), clientID}
+		}
+		timings["pluginInvokeMs"] = durationMs(time.Since(stepStart))
+	}
+
+	response := map[string]any{
+		"accountId": accountID,
+		"timings":   timings,
+		"totalMs":   durationMs(time.Since(start)),
+	}
+	return []any{"Core/ping", response, clientID}
+}
+
+// durationMs converts a duration to fractional milliseconds
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
 // isIAMAuthenticatedRequest checks if the request is IAM-authenticated
 // by checking if UserArn is populated in the request context
 func isIAMAuthenticatedRequest(request events.APIGatewayProxyRequest) bool {
@@ -537,6 +1812,15 @@ func extractCallerPrincipal(request events.APIGatewayProxyRequest) string {
 	return request.RequestContext.Identity.UserArn
 }
 
+// instanceID names this Lambda instance in plugin latency records: its log
+// stream, so operators can find its logs, or a random ID outside Lambda
+func instanceID() string {
+	if stream := os.Getenv("AWS_LAMBDA_LOG_STREAM_NAME"); stream != "" {
+		return stream
+	}
+	return uuid.New().String()
+}
+
 // RealUUIDGenerator generates real UUIDs
 type RealUUIDGenerator struct{}
 
@@ -557,92 +1841,243 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Initialize DynamoDB client
-	tableName := os.Getenv("DYNAMODB_TABLE")
-	if tableName == "" {
-		logger.Error("FATAL: DYNAMODB_TABLE environment variable is required")
-		panic("DYNAMODB_TABLE environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTel metrics, exported through the ADOT collector
+	meterProvider, err := otelmetrics.Init(result.Ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize metrics",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
-	dbClient := db.NewClientFromConfig(result.Config, tableName)
 
-	// Load plugin registry
-	registry := plugin.NewRegistry()
-	if err := registry.LoadFromDynamoDB(result.Ctx, dbClient); err != nil {
+	// Load configuration from environment variables
+	cfg, err := config.LoadJMAPAPI(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	// Initialize DynamoDB client
+	dbClient := db.NewClientFromConfig(result.Config, tableName).WithConsistentRead(cfg.RegistryConsistentRead)
+
+	// Load plugin registry, from this environment's snapshot when
+	// there is one, refreshing it from DynamoDB in the background
+	registry, err := plugin.LoadWithSnapshot(result.Ctx, dbClient, plugin.SnapshotPath(tableName), func(err error) {
+		logger.Warn("Plugin registry snapshot failed",
+			slog.String("error", err.Error()),
+		)
+	})
+	if err != nil {
 		logger.Error("FATAL: Failed to load plugin registry",
 			slog.String("error", err.Error()),
 		)
 		panic(err)
 	}
+	registryLoad := registry.LastLoad()
+	logger.Info("Loaded plugin registry",
+		slog.String("source", registryLoad.Source),
+		slog.Int("items", registryLoad.Items),
+		slog.Int64("duration_ms", registryLoad.Duration.Milliseconds()),
+		slog.String("fingerprint", registry.Fingerprint()),
+	)
 
 	// Initialize Lambda invoker
 	lambdaClient := lambdasvc.NewFromConfig(result.Config)
 	invoker := plugin.NewLambdaInvoker(lambdaClient)
 
-	// Initialize Blob/allocate handler
-	var blobAllocator *bloballocate.Handler
-	blobBucket := os.Getenv("BLOB_BUCKET")
-	if blobBucket != "" {
-		// Get config from environment
-		maxSizeUploadPut, _ := strconv.ParseInt(os.Getenv("MAX_SIZE_UPLOAD_PUT"), 10, 64)
-		if maxSizeUploadPut == 0 {
-			maxSizeUploadPut = 250000000 // default 250 MB
-		}
-		maxPendingAllocs, _ := strconv.Atoi(os.Getenv("MAX_PENDING_ALLOCATIONS"))
-		if maxPendingAllocs == 0 {
-			maxPendingAllocs = 4
-		}
-		urlExpirySecs, _ := strconv.ParseInt(os.Getenv("ALLOCATION_URL_EXPIRY_SECONDS"), 10, 64)
-		if urlExpirySecs == 0 {
-			urlExpirySecs = 900 // default 15 minutes
+	// Optionally open the plugin Lambda connections before the first request
+	if cfg.PluginPrewarm {
+		prewarmCtx, cancel := context.WithTimeout(result.Ctx, pluginPrewarmTimeout)
+		if err := invoker.Prewarm(prewarmCtx, registry.InvokeTargets(), cfg.DispatcherParallelism); err != nil {
+			logger.Warn("Failed to prewarm plugin connections",
+				slog.String("error", err.Error()),
+			)
 		}
+		cancel()
+	}
 
-		// Initialize S3 presign client
-		s3Client := s3.NewFromConfig(result.Config)
-		presignClient := s3.NewPresignClient(s3Client)
+	// One DynamoDB client serves every store, sharing its connection pool
+	ddbClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
 
-		// Initialize DynamoDB client for blob allocations
-		ddbClient := dynamodb.NewFromConfig(result.Config)
+	// Initialize the blob methods; they share one blob storage, whose S3
+	// and presign clients are built once by blobstore.Open
+	var blobAllocator *bloballocate.Handler
+	var blobCompleter *blobcomplete.Handler
+	var blobStatus *blobstatus.Handler
+	var blobReallocator *blobreallocate.Handler
+	var blobIndex *blobindex.Handler
+	if cfg.BlobBucket != "" {
+		blobStorage, err := blobstore.Open(result.Config, cfg.Storage)
+		if err != nil {
+			logger.Error("FATAL: Failed to open blob storage",
+				slog.String("error", err.Error()),
+			)
+			panic(err)
+		}
 
-		s3Storage := bloballocate.NewS3Storage(presignClient, blobBucket, s3Client)
+		// Optional envelope encryption of blob record metadata
+		metadataEnvelope := blobcrypt.NewOptionalEnvelope(result.Config, cfg.Encryption.KMSKeyARN, cfg.Encryption.Attributes)
 
 		blobAllocator = &bloballocate.Handler{
-			Storage:          s3Storage,
-			MultipartStorage: s3Storage,
-			DB:               bloballocate.NewDynamoDBStore(ddbClient, tableName),
+			Storage:          blobStorage,
+			MultipartStorage: blobStorage,
+			DB:               bloballocate.NewDynamoDBStore(ddbClient, tableName).WithEncryption(metadataEnvelope).WithQuotaGrace(cfg.QuotaGrace),
 			UUIDGen:          &RealUUIDGenerator{},
-			MaxSizeUploadPut: maxSizeUploadPut,
-			MaxPendingAllocs: maxPendingAllocs,
-			URLExpirySecs:    urlExpirySecs,
-		}
-	}
-
-	// Configure dispatcher pool size
-	dispatcherPoolSize := DefaultDispatcherPoolSize
-	if poolSizeStr := os.Getenv("JMAP_DISPATCHER_PARALLELISM"); poolSizeStr != "" {
-		if parsed, err := strconv.Atoi(poolSizeStr); err == nil && parsed > 0 {
-			dispatcherPoolSize = parsed
+			MaxSizeUploadPut: cfg.MaxSizeUploadPut,
+			MaxPendingAllocs: cfg.MaxPendingAllocations,
+			URLExpirySecs:    int64(cfg.AllocationURLExpiry.Seconds()),
+			TagKeys:          cfg.TagKeys,
 		}
-	}
 
-	// Initialize Blob/complete handler (reuses same S3 and DynamoDB clients)
-	var blobCompleter *blobcomplete.Handler
-	if blobBucket != "" {
-		s3Client := s3.NewFromConfig(result.Config)
-		ddbClient := dynamodb.NewFromConfig(result.Config)
-		s3Storage := bloballocate.NewS3Storage(s3.NewPresignClient(s3Client), blobBucket, s3Client)
 		blobCompleter = &blobcomplete.Handler{
-			Storage: s3Storage,
+			Storage: blobStorage,
 			DB:      blobcomplete.NewDynamoDBStore(ddbClient, tableName),
 		}
+		if cfg.UploadProgressEvents {
+			blobCompleter.Outbox = outbox.NewWriter(ddbClient, tableName)
+		}
+
+		blobStatus = &blobstatus.Handler{
+			Storage: blobStorage,
+			DB:      blobstatus.NewDynamoDBStore(ddbClient, tableName),
+		}
+
+		blobReallocator = &blobreallocate.Handler{
+			Storage:       blobStorage,
+			DB:            blobreallocate.NewDynamoDBStore(ddbClient, tableName),
+			URLExpirySecs: int64(cfg.AllocationURLExpiry.Seconds()),
+		}
+
+		blobIndex = &blobindex.Handler{
+			DB: blobindex.NewDynamoDBStore(ddbClient, tableName),
+		}
+	}
+
+	// Initialize Account/export handler; the archive itself is built by the
+	// account-export worker, so only job records are touched here
+	accountExporter := &accountexport.Handler{
+		DB:      accountexport.NewDynamoDBStore(ddbClient, tableName),
+		UUIDGen: &RealUUIDGenerator{},
+	}
+
+	// Initialize rate limiter; a rate of zero disables limiting, except for
+	// tiers with their own limit
+	var rateLimiter RateLimiter
+	if cfg.RateLimit.Active() {
+		rateLimiter = ratelimit.NewLimiter(ddbClient, tableName, cfg.RateLimit.Limit).WithTierLimits(cfg.RateLimit.Tiers)
+	}
+	var concurrency ConcurrencyLimiter
+	if cfg.ConcurrencyLimit {
+		concurrency = inflight.NewLimiter(ddbClient, tableName)
+	}
+
+	// Load the key that signs plugin delegation tokens
+	delegationKey, err := delegation.LoadKey(result.Ctx, secretsmanager.NewFromConfig(result.Config), cfg.DelegationSecretARN)
+	if err != nil {
+		logger.Error("FATAL: Failed to load delegation key",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
+	accounts := account.NewDynamoDBStore(ddbClient, tableName)
+
 	deps = &Dependencies{
 		Registry:           registry,
 		Invoker:            invoker,
+		Accounts:           accounts,
+		Aliases:            accounts,
+		Activity:           accounts,
 		BlobAllocator:      blobAllocator,
 		BlobCompleter:      blobCompleter,
-		DispatcherPoolSize: dispatcherPoolSize,
+		BlobReallocator:    blobReallocator,
+		BlobStatus:         blobStatus,
+		BlobIndex:          blobIndex,
+		AccountExporter:    accountExporter,
+		RateLimiter:        rateLimiter,
+		Concurrency:        concurrency,
+		Bindings:           binding.NewDynamoDBStore(ddbClient, tableName),
+		Delegation:         delegation.NewSigner(delegationKey, delegation.DefaultTTL),
+		Features:           cfg.Features,
+		Usage:              usage.NewDynamoDBStore(ddbClient, tableName),
+		SamplePercent:      cfg.LogSamplePercent,
+		DispatcherPoolSize: cfg.DispatcherParallelism,
+		StrictValidation:   cfg.StrictValidation,
+		StateTokenMaxAge:   cfg.StateTokenMaxAge,
+		CORS:               cors.New(cfg.CORSOrigins, "POST"),
+		AccountIDClaim:     cfg.AccountIDClaim,
+	}
+
+	// Responses are kept for Idempotency-Key replay unless the TTL is zero
+	if cfg.IdempotencyTTL > 0 {
+		deps.Idempotency = idempotency.NewDynamoDBStore(ddbClient, tableName, cfg.IdempotencyTTL)
+	}
+
+	// Per-method metrics are written to the function log in EMF
+	var emf *metrics.EMF
+	if cfg.MetricNamespace != "" {
+		emf = metrics.NewEMF(os.Stdout, cfg.MetricNamespace)
+		deps.Metrics = emf
+		emf.RecordRegistryLoad(metrics.RegistryLoad{
+			Function: "jmap-api",
+			Source:   registryLoad.Source,
+			Items:    registryLoad.Items,
+			Duration: registryLoad.Duration,
+		})
+	}
+
+	// Plugin latency is tracked per invoke target and flushed periodically
+	// to DynamoDB, for the admin API, and to EMF
+	if cfg.PluginLatencyInterval > 0 {
+		tracker := pluginlatency.NewTracker(deps.Invoker, 0)
+		deps.Invoker = tracker
+		deps.PluginLatency = &pluginlatency.Flusher{
+			Tracker:  tracker,
+			Store:    pluginlatency.NewDynamoDBStore(ddbClient, tableName),
+			Instance: instanceID(),
+			Interval: cfg.PluginLatencyInterval,
+		}
+		if emf != nil {
+			deps.PluginLatency.Metrics = emf
+		}
+	}
+
+	// Serve plain HTTP for local development instead of running as a Lambda
+	if addr := os.Getenv(localdev.ListenEnv); addr != "" {
+		logger.Info("Serving locally", slog.String("addr", addr))
+		err := localdev.Serve(addr, corsHandler, "POST /jmap", "OPTIONS /jmap", "POST /jmap-iam/{accountId}")
+		logger.Error("FATAL: Local server failed",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	result.Start(handler)
+	result.Start(otelmetrics.WithFlush(meterProvider, corsHandler))
 }
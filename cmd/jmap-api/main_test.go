@@ -1,15 +1,39 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
 	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
 	"github.com/jarrod-lowe/jmap-service-core/internal/blobcomplete"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobindex"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobreallocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstatus"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobtag"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/cors"
+	"github.com/jarrod-lowe/jmap-service-core/internal/delegation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/idempotency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
 	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/pluginlatency"
+	"github.com/jarrod-lowe/jmap-service-core/internal/problem"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sessionstate"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/statetoken"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/trace/noop"
 )
@@ -32,6 +56,16 @@ func (m *mockInvoker) Invoke(ctx context.Context, target plugin.MethodTarget, re
 	}, nil
 }
 
+// mockAccountReader implements AccountReader for testing
+type mockAccountReader struct {
+	meta *account.Meta
+	err  error
+}
+
+func (m *mockAccountReader) GetMeta(ctx context.Context, accountID string) (*account.Meta, error) {
+	return m.meta, m.err
+}
+
 func setupTestDeps() {
 	tp := noop.NewTracerProvider()
 	otel.SetTracerProvider(tp)
@@ -43,7 +77,10 @@ func setupTestDeps() {
 	deps = &Dependencies{
 		Registry:           registry,
 		Invoker:            &mockInvoker{},
+		Accounts:           &mockAccountReader{},
 		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
 	}
 }
 
@@ -135,59 +172,109 @@ func TestHandler_MissingAuth_Returns401(t *testing.T) {
 	}
 }
 
-func TestExtractAccountID_FromJWTSub(t *testing.T) {
+func TestHandler_SuspendedAccount_Returns403(t *testing.T) {
+	setupTestDeps()
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-123", Suspended: true}}
+	ctx := context.Background()
+
 	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
 			Authorizer: map[string]any{
 				"claims": map[string]any{
-					"sub": "user-jwt-123",
+					"sub": "user-123",
 				},
 			},
 		},
 	}
 
-	accountID, err := extractAccountID(request)
+	response, err := handler(ctx, request)
 	if err != nil {
-		t.Fatalf("extractAccountID returned error: %v", err)
+		t.Fatalf("handler returned error: %v", err)
 	}
 
-	if accountID != "user-jwt-123" {
-		t.Errorf("expected 'user-jwt-123', got '%s'", accountID)
+	if response.StatusCode != 403 {
+		t.Errorf("expected status code 403, got %d", response.StatusCode)
 	}
-}
 
-func TestExtractAccountID_FromPathParam(t *testing.T) {
-	request := events.APIGatewayProxyRequest{
-		PathParameters: map[string]string{
-			"accountId": "user-iam-456",
-		},
-		RequestContext: events.APIGatewayProxyRequestContext{
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "should-not-use-this",
-				},
-			},
-		},
+	var body problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
 	}
-
-	accountID, err := extractAccountID(request)
-	if err != nil {
-		t.Fatalf("extractAccountID returned error: %v", err)
+	if body.Type != problem.TypeURI("forbidden") || body.Code != "CORE-3005" {
+		t.Errorf("expected forbidden with CORE-3005, got %+v", body)
 	}
+}
 
-	// Path param takes precedence
-	if accountID != "user-iam-456" {
-		t.Errorf("expected 'user-iam-456', got '%s'", accountID)
+// mockActivityRecorder implements ActivityRecorder for testing
+type mockActivityRecorder struct {
+	recorded []string
+	err      error
+}
+
+func (m *mockActivityRecorder) RecordActivity(ctx context.Context, accountID string, now time.Time) error {
+	m.recorded = append(m.recorded, accountID)
+	return m.err
+}
+
+func TestHandler_RecordsActivityWhenDue(t *testing.T) {
+	tests := []struct {
+		name string
+		meta *account.Meta
+		want int
+	}{
+		{"never recorded", &account.Meta{AccountID: "user-123"}, 1},
+		{"recently recorded", &account.Meta{AccountID: "user-123", LastActivityAt: time.Now().UTC().Format(time.RFC3339)}, 0},
+		{"unprovisioned", nil, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDeps()
+			deps.Accounts = &mockAccountReader{meta: tt.meta}
+			activity := &mockActivityRecorder{err: errors.New("dynamo down")}
+			deps.Activity = activity
+
+			request := events.APIGatewayProxyRequest{
+				Body: `{"using":[],"methodCalls":[]}`,
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID: "test-request-id",
+					Authorizer: map[string]any{
+						"claims": map[string]any{
+							"sub": "user-123",
+						},
+					},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != 200 {
+				t.Errorf("expected status code 200 despite the recorder failing, got %d", response.StatusCode)
+			}
+			if len(activity.recorded) != tt.want {
+				t.Errorf("expected %d activity records, got %v", tt.want, activity.recorded)
+			}
+		})
 	}
 }
 
-func TestHandler_UnknownMethod_ReturnsUnknownMethodError(t *testing.T) {
-	setupTestDeps()
-	ctx := context.Background()
+func TestHandler_WritesDisabled_RefusesWriteMethods(t *testing.T) {
+	var invoked []string
+	setupTestDepsWithMethods(&mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			invoked = append(invoked, request.Method)
+			return &plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID}}, nil
+		},
+	})
+	deps.Registry.AddMethod("Email/get", plugin.MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:email-get"})
+	deps.Registry.AddMethod("Email/set", plugin.MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:email-set"})
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-123", WritesDisabled: true}}
 
-	// Registry is empty, so any method should be unknown
 	request := events.APIGatewayProxyRequest{
-		Body: `{"using":[],"methodCalls":[["Unknown/method",{"accountId":"user-123"},"c0"]]}`,
+		Body: `{"using":[],"methodCalls":[["Email/get",{},"c0"],["Email/set",{},"c1"],["Blob/allocate",{},"c2"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
 			Authorizer: map[string]any{
@@ -198,42 +285,67 @@ func TestHandler_UnknownMethod_ReturnsUnknownMethodError(t *testing.T) {
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
 	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200 (JMAP errors are in body), got %d", response.StatusCode)
+		t.Fatalf("expected status code 200, got %d: %s", response.StatusCode, response.Body)
 	}
 
-	var jmapResp JMAPResponse
-	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
-		t.Fatalf("failed to unmarshal response: %v", err)
+	var body struct {
+		MethodResponses [][]any `json:"methodResponses"`
 	}
-
-	if len(jmapResp.MethodResponses) != 1 {
-		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
 	}
-
-	respName, ok := jmapResp.MethodResponses[0][0].(string)
-	if !ok || respName != "error" {
-		t.Errorf("expected error response, got '%v'", jmapResp.MethodResponses[0][0])
+	if len(body.MethodResponses) != 3 {
+		t.Fatalf("expected 3 method responses, got %v", body.MethodResponses)
 	}
-
-	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
-	if !ok {
-		t.Fatalf("expected args to be a map")
+	if body.MethodResponses[0][0] != "Email/get" {
+		t.Errorf("expected Email/get to succeed, got %v", body.MethodResponses[0])
+	}
+	for _, resp := range body.MethodResponses[1:] {
+		args, _ := resp[1].(map[string]any)
+		if resp[0] != "error" || args["type"] != "accountReadOnly" || args["code"] != "CORE-3007" {
+			t.Errorf("expected accountReadOnly error with CORE-3007, got %v", resp)
+		}
 	}
+	if len(invoked) != 1 || invoked[0] != "Email/get" {
+		t.Errorf("expected only Email/get to be invoked, got %v", invoked)
+	}
+}
 
-	errorType, ok := respArgs["type"].(string)
-	if !ok || errorType != "unknownMethod" {
-		t.Errorf("expected error type 'unknownMethod', got '%v'", respArgs["type"])
+func TestIsWriteCall(t *testing.T) {
+	tests := []struct {
+		method string
+		want   bool
+	}{
+		{"Blob/allocate", true},
+		{"Blob/complete", true},
+		{"Blob/reallocateParts", true},
+		{"Blob/upload", true},
+		{"Blob/copy", true},
+		{"Email/set", true},
+		{"Email/import", true},
+		{"Email/get", false},
+		{"Email/query", false},
+		{"Email/changes", false},
+		{"Blob/get", false},
+		{"Core/ping", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			if got := isWriteCall([]any{tt.method, map[string]any{}, "c0"}); got != tt.want {
+				t.Errorf("isWriteCall(%q) = %v, want %v", tt.method, got, tt.want)
+			}
+		})
 	}
 }
 
-func TestHandler_ResponseContentType(t *testing.T) {
+func TestHandler_AccountLookupFails_Returns500(t *testing.T) {
 	setupTestDeps()
+	deps.Accounts = &mockAccountReader{err: errors.New("dynamo down")}
 	ctx := context.Background()
 
 	request := events.APIGatewayProxyRequest{
@@ -248,88 +360,67 @@ func TestHandler_ResponseContentType(t *testing.T) {
 		},
 	}
 
-	response, _ := handler(ctx, request)
-
-	if response.Headers["Content-Type"] != "application/json" {
-		t.Errorf("expected Content-Type 'application/json', got '%s'", response.Headers["Content-Type"])
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
 	}
-}
-
-func TestProcessMethodCall_InvalidCallStructure_ReturnsError(t *testing.T) {
-	setupTestDeps()
-	ctx := context.Background()
-
-	// Call with wrong number of elements
-	call := []any{"method", "not-an-object"}
-	result := processMethodCall(ctx, "user-123", call, 0, "req-123", nil, nil, "", "", false)
 
-	if result[0] != "error" {
-		t.Errorf("expected error response, got '%v'", result[0])
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
 	}
 }
 
-func TestProcessMethodCall_NonStringMethodName_ReturnsError(t *testing.T) {
-	setupTestDeps()
-	ctx := context.Background()
-
-	call := []any{123, map[string]any{}, "c0"}
-	result := processMethodCall(ctx, "user-123", call, 0, "req-123", nil, nil, "", "", false)
-
-	if result[0] != "error" {
-		t.Errorf("expected error response, got '%v'", result[0])
-	}
-
-	args := result[1].(map[string]any)
-	if args["type"] != "invalidArguments" {
-		t.Errorf("expected invalidArguments error, got '%v'", args["type"])
-	}
+// mockRateLimiter implements RateLimiter for testing
+type mockRateLimiter struct {
+	decision ratelimit.Decision
+	err      error
+	tier     string
+	keys     []string
 }
 
-// setupTestDepsWithPrincipals creates test deps with a registry that has registered principals
-func setupTestDepsWithPrincipals(principals []string) {
-	tp := noop.NewTracerProvider()
-	otel.SetTracerProvider(tp)
-
-	registry := plugin.NewRegistryWithPrincipals(principals)
-
-	deps = &Dependencies{
-		Registry:           registry,
-		Invoker:            &mockInvoker{},
-		DispatcherPoolSize: DefaultDispatcherPoolSize,
-	}
+func (m *mockRateLimiter) AllowTier(ctx context.Context, tier string, keys ...string) (ratelimit.Decision, error) {
+	m.tier = tier
+	m.keys = keys
+	return m.decision, m.err
 }
 
-func TestHandler_IAMAuth_RegisteredPrincipal_Succeeds(t *testing.T) {
-	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+func TestHandler_RateLimited_Returns429WithRetryAfter(t *testing.T) {
+	setupTestDeps()
+	limiter := &mockRateLimiter{decision: ratelimit.Decision{Key: "account#user-123", RetryAfter: 1500 * time.Millisecond}}
+	deps.RateLimiter = limiter
 
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
 		Body: `{"using":[],"methodCalls":[]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 
-	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	if response.StatusCode != 429 {
+		t.Errorf("expected status code 429, got %d", response.StatusCode)
+	}
+	if response.Headers["Retry-After"] != "2" {
+		t.Errorf("expected Retry-After 2, got %q", response.Headers["Retry-After"])
+	}
+	if len(limiter.keys) != 1 || limiter.keys[0] != "account#user-123" {
+		t.Errorf("expected account key only for Cognito request, got %v", limiter.keys)
 	}
 }
 
-func TestHandler_IAMAuth_UnregisteredPrincipal_Returns403(t *testing.T) {
+func TestHandler_RateLimit_IAMAuth_ChecksAccountAndPrincipal(t *testing.T) {
 	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+	limiter := &mockRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+	deps.RateLimiter = limiter
 
 	request := events.APIGatewayProxyRequest{
 		Path: "/jmap-iam/user-123",
@@ -340,28 +431,32 @@ func TestHandler_IAMAuth_UnregisteredPrincipal_Returns403(t *testing.T) {
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
 			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/UnauthorizedRole",
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 
-	if response.StatusCode != 403 {
-		t.Errorf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	want := []string{"account#user-123", "principal#arn:aws:iam::123456789012:role/IngestRole"}
+	if len(limiter.keys) != 2 || limiter.keys[0] != want[0] || limiter.keys[1] != want[1] {
+		t.Errorf("expected keys %v, got %v", want, limiter.keys)
 	}
 }
 
-func TestHandler_CognitoAuth_BypassesPrincipalCheck(t *testing.T) {
-	// Registry has no principals registered, but Cognito requests should still work
-	setupTestDepsWithPrincipals([]string{})
-	ctx := context.Background()
+func TestHandler_RateLimit_UsesAccountTier(t *testing.T) {
+	setupTestDeps()
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{Tier: "pro"}}
+	limiter := &mockRateLimiter{decision: ratelimit.Decision{Allowed: true}}
+	deps.RateLimiter = limiter
 
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap", // Not /jmap-iam
 		Body: `{"using":[],"methodCalls":[]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
@@ -373,196 +468,2327 @@ func TestHandler_CognitoAuth_BypassesPrincipalCheck(t *testing.T) {
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 
-	// Should succeed even with empty principal list because this is Cognito auth
 	if response.StatusCode != 200 {
 		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
 	}
+	if limiter.tier != "pro" {
+		t.Errorf("expected the account's tier, got %q", limiter.tier)
+	}
 }
 
-func TestHandler_IAMAuth_AssumedRole_MatchesRegisteredRole(t *testing.T) {
-	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+func TestHandler_RateLimiterFails_Returns500(t *testing.T) {
+	setupTestDeps()
+	deps.RateLimiter = &mockRateLimiter{err: errors.New("dynamo down")}
 
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
 		Body: `{"using":[],"methodCalls":[]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				// Assumed role ARN should match the registered role
-				UserArn: "arn:aws:sts::123456789012:assumed-role/IngestRole/session-123",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 
-	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
 	}
 }
 
-// setupTestDepsWithMethods creates test deps with mock methods for result reference testing
-func setupTestDepsWithMethods(invoker *mockInvoker) {
-	tp := noop.NewTracerProvider()
-	otel.SetTracerProvider(tp)
-
-	registry := plugin.NewRegistry()
-	registry.AddMethod("Email/query", plugin.MethodTarget{
-		InvocationType: "lambda-invoke",
-		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-query",
-	})
-	registry.AddMethod("Email/get", plugin.MethodTarget{
-		InvocationType: "lambda-invoke",
-		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-get",
-	})
+// mockConcurrencyLimiter implements ConcurrencyLimiter for testing
+type mockConcurrencyLimiter struct {
+	refuse   bool
+	err      error
+	limit    int
+	acquired []string
+	released []string
+}
 
-	deps = &Dependencies{
-		Registry:           registry,
-		Invoker:            invoker,
-		DispatcherPoolSize: DefaultDispatcherPoolSize,
+func (m *mockConcurrencyLimiter) Acquire(ctx context.Context, accountID, requestID string, limit int) (bool, error) {
+	m.limit = limit
+	if m.err != nil || m.refuse {
+		return false, m.err
 	}
+	m.acquired = append(m.acquired, accountID+"/"+requestID)
+	return true, nil
 }
 
-func TestHandler_ResultReference_SimplePath_Resolves(t *testing.T) {
-	// Mock invoker that returns proper responses
-	var capturedGetArgs map[string]any
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			if request.Method == "Email/query" {
-				return &plugin.PluginInvocationResponse{
-					MethodResponse: plugin.MethodResponse{
-						Name: "Email/query",
-						Args: map[string]any{
-							"accountId": request.AccountID,
-							"ids":       []any{"email1", "email2", "email3"},
-						},
-						ClientID: request.ClientID,
-					},
-				}, nil
-			}
-			// Email/get - capture the resolved args
-			capturedGetArgs = request.Args
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name:     "Email/get",
-					Args:     map[string]any{"accountId": request.AccountID, "list": []any{}},
-					ClientID: request.ClientID,
-				},
-			}, nil
-		},
-	}
+func (m *mockConcurrencyLimiter) Release(ctx context.Context, accountID, requestID string) error {
+	m.released = append(m.released, accountID+"/"+requestID)
+	return nil
+}
 
-	setupTestDepsWithMethods(invoker)
-	ctx := context.Background()
+// setupTestDepsWithConcurrencyLimit declares maxConcurrentRequests of 4 in
+// the core capability and returns the limiter
+func setupTestDepsWithConcurrencyLimit() *mockConcurrencyLimiter {
+	setupTestDeps()
+	deps.Registry.AddCapabilityConfig("urn:ietf:params:jmap:core", map[string]any{"maxConcurrentRequests": float64(4)})
+	limiter := &mockConcurrencyLimiter{}
+	deps.Concurrency = limiter
+	return limiter
+}
 
-	// Request with result reference: Email/get references Email/query's ids
-	request := events.APIGatewayProxyRequest{
-		Body: `{
-			"using":[],
-			"methodCalls":[
-				["Email/query",{"accountId":"user-123"},"query0"],
-				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"query0","name":"Email/query","path":"/ids"}},"get0"]
-			]
-		}`,
-		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
-			},
-		},
-	}
+func TestHandler_ConcurrencyLimit_LeaseHeldForTheRequest(t *testing.T) {
+	limiter := setupTestDepsWithConcurrencyLimit()
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), usageTestRequest())
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
 	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+		t.Fatalf("expected status code 200, got %d: %s", response.StatusCode, response.Body)
 	}
+	if limiter.limit != 4 {
+		t.Errorf("expected the core capability's limit of 4, got %d", limiter.limit)
+	}
+	if len(limiter.acquired) != 1 || len(limiter.released) != 1 || limiter.acquired[0] != limiter.released[0] {
+		t.Errorf("expected one lease taken and released, got %v and %v", limiter.acquired, limiter.released)
+	}
+}
+
+func TestHandler_ConcurrencyLimit_Refused_Returns429(t *testing.T) {
+	limiter := setupTestDepsWithConcurrencyLimit()
+	limiter.refuse = true
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 429 || response.Headers["Retry-After"] != "1" {
+		t.Fatalf("expected status code 429 with Retry-After, got %d and %q", response.StatusCode, response.Headers["Retry-After"])
+	}
+	var body problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if body.Type != "urn:ietf:params:jmap:error:limit" || body.Limit != "maxConcurrentRequests" || body.MaxSize != 4 {
+		t.Errorf("unexpected problem %+v", body)
+	}
+	if len(limiter.released) != 0 {
+		t.Errorf("expected nothing released for a refused request, got %v", limiter.released)
+	}
+}
+
+func TestHandler_ConcurrencyLimit_Errors(t *testing.T) {
+	limiter := setupTestDepsWithConcurrencyLimit()
+	limiter.err = errors.New("dynamo down")
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 500 {
+		t.Errorf("expected status code 500, got %d", response.StatusCode)
+	}
+}
+
+func TestHandler_ConcurrencyLimit_NotDeclared(t *testing.T) {
+	setupTestDeps()
+	limiter := &mockConcurrencyLimiter{refuse: true}
+	deps.Concurrency = limiter
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 || limiter.limit != 0 {
+		t.Errorf("expected no limit without maxConcurrentRequests, got status %d and limit %d", response.StatusCode, limiter.limit)
+	}
+}
+
+// mockUsageRecorder implements UsageRecorder for testing
+type mockUsageRecorder struct {
+	accountID string
+	calls     int
+	err       error
+}
+
+func (m *mockUsageRecorder) RecordMethodCalls(ctx context.Context, accountID string, calls int) error {
+	m.accountID = accountID
+	m.calls = calls
+	return m.err
+}
+
+func usageTestRequest() events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Foo/get",{},"c0"],["Foo/set",{},"c1"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+}
+
+func TestHandler_RecordsMethodCallUsage(t *testing.T) {
+	setupTestDeps()
+	recorder := &mockUsageRecorder{}
+	deps.Usage = recorder
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if recorder.accountID != "user-123" || recorder.calls != 2 {
+		t.Errorf("expected 2 calls recorded for user-123, got %d for %q", recorder.calls, recorder.accountID)
+	}
+}
+
+func TestHandler_UsageRecordingFails_StillReturns200(t *testing.T) {
+	setupTestDeps()
+	deps.Usage = &mockUsageRecorder{err: errors.New("dynamo down")}
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+}
+
+// mockIdempotencyStore implements IdempotencyStore for testing
+type mockIdempotencyStore struct {
+	snapshots map[string]idempotency.Snapshot
+	claimErr  error
+	completed int
+	released  int
+}
+
+func (m *mockIdempotencyStore) Claim(ctx context.Context, accountID, key, requestHash string) (*idempotency.Snapshot, error) {
+	if m.claimErr != nil {
+		return nil, m.claimErr
+	}
+	if snapshot, ok := m.snapshots[accountID+"/"+key]; ok {
+		return &snapshot, nil
+	}
+	m.snapshots[accountID+"/"+key] = idempotency.Snapshot{RequestHash: requestHash}
+	return nil, nil
+}
+
+func (m *mockIdempotencyStore) Complete(ctx context.Context, accountID, key string, snapshot idempotency.Snapshot) error {
+	m.completed++
+	m.snapshots[accountID+"/"+key] = snapshot
+	return nil
+}
+
+func (m *mockIdempotencyStore) Release(ctx context.Context, accountID, key string) error {
+	m.released++
+	delete(m.snapshots, accountID+"/"+key)
+	return nil
+}
+
+func idempotentTestRequest(key string) events.APIGatewayProxyRequest {
+	request := usageTestRequest()
+	request.Headers = map[string]string{"idempotency-key": key}
+	return request
+}
+
+func TestHandler_IdempotencyKey_ReplaysResponse(t *testing.T) {
+	setupTestDeps()
+	recorder := &mockUsageRecorder{}
+	deps.Usage = recorder
+	idempotencyStore := &mockIdempotencyStore{snapshots: map[string]idempotency.Snapshot{}}
+	deps.Idempotency = idempotencyStore
+
+	first, err := handler(context.Background(), idempotentTestRequest("key-1"))
+	if err != nil || first.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d %v", first.StatusCode, err)
+	}
+	if idempotencyStore.completed != 1 {
+		t.Fatalf("expected the response to be stored, got %d", idempotencyStore.completed)
+	}
+
+	recorder.calls = 0
+	second, err := handler(context.Background(), idempotentTestRequest("key-1"))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if second.StatusCode != 200 || second.Body != first.Body {
+		t.Errorf("expected the first response replayed, got %d %s", second.StatusCode, second.Body)
+	}
+	if second.Headers[idempotency.ReplayedHeader] != "true" {
+		t.Errorf("expected the replayed header, got %v", second.Headers)
+	}
+	if recorder.calls != 0 {
+		t.Errorf("expected the method calls not to run again, got %d recorded", recorder.calls)
+	}
+}
+
+func TestHandler_IdempotencyKey_Rejections(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		stored     *idempotency.Snapshot
+		claimErr   error
+		wantStatus int
+		wantCode   string
+	}{
+		{"invalid key", strings.Repeat("k", idempotency.MaxKeyLength+1), nil, nil, 400, "CORE-2001"},
+		{"different request", "key-1", &idempotency.Snapshot{RequestHash: "other", StatusCode: 200, Body: "{}"}, nil, 422, "CORE-2009"},
+		{"still running", "key-1", &idempotency.Snapshot{RequestHash: idempotency.Hash(usageTestRequest().Body)}, nil, 409, "CORE-2008"},
+		{"store fails", "key-1", nil, errors.New("dynamo down"), 500, "CORE-5001"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDeps()
+			idempotencyStore := &mockIdempotencyStore{snapshots: map[string]idempotency.Snapshot{}, claimErr: tt.claimErr}
+			if tt.stored != nil {
+				idempotencyStore.snapshots["user-123/"+tt.key] = *tt.stored
+			}
+			deps.Idempotency = idempotencyStore
+
+			response, err := handler(context.Background(), idempotentTestRequest(tt.key))
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tt.wantStatus || !strings.Contains(response.Body, tt.wantCode) {
+				t.Errorf("expected %d with %s, got %d %s", tt.wantStatus, tt.wantCode, response.StatusCode, response.Body)
+			}
+			if idempotencyStore.completed != 0 {
+				t.Error("expected no response to be stored")
+			}
+		})
+	}
+}
+
+func TestHandler_IdempotencyKey_IgnoredWhenDisabled(t *testing.T) {
+	setupTestDeps()
+
+	response, err := handler(context.Background(), idempotentTestRequest(strings.Repeat("k", idempotency.MaxKeyLength+1)))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d", response.StatusCode)
+	}
+}
+
+// mockMethodMetrics implements MethodMetrics for testing
+type mockMethodMetrics struct {
+	mu    sync.Mutex
+	calls []metrics.MethodCall
+}
+
+func (m *mockMethodMetrics) RecordMethodCall(call metrics.MethodCall) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, call)
+}
+
+func TestHandler_RecordsMethodCallMetrics(t *testing.T) {
+	setupTestDeps()
+	recorder := &mockMethodMetrics{}
+	deps.Metrics = recorder
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d", response.StatusCode)
+	}
+	if len(recorder.calls) != 2 {
+		t.Fatalf("expected metrics for 2 calls, got %d", len(recorder.calls))
+	}
+	for _, call := range recorder.calls {
+		if call.Method != unknownMethod || call.Plugin != unknownMethod {
+			t.Errorf("expected unregistered method to be recorded as %q, got %+v", unknownMethod, call)
+		}
+		if call.ErrorType != "unknownMethod" {
+			t.Errorf("expected unknownMethod error type, got %q", call.ErrorType)
+		}
+	}
+}
+
+func TestHandler_MethodErrorsIncludeCode(t *testing.T) {
+	setupTestDeps()
+
+	response, err := handler(context.Background(), usageTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	var resp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	for _, methodResponse := range resp.MethodResponses {
+		args := methodResponse[1].(map[string]any)
+		if methodResponse[0] != "error" || args["code"] != "CORE-2003" {
+			t.Errorf("expected unknownMethod error with CORE-2003, got %v", methodResponse)
+		}
+	}
+}
+
+func TestHandler_InvalidJSON_ProblemIncludesCode(t *testing.T) {
+	setupTestDeps()
+	request := usageTestRequest()
+	request.Body = "{not json"
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if !strings.Contains(response.Body, `"code":"CORE-2005"`) {
+		t.Errorf("expected CORE-2005 in problem body, got %s", response.Body)
+	}
+}
+
+func TestMethodCallMetrics_CoreMethod(t *testing.T) {
+	setupTestDeps()
+
+	call := []any{"Blob/allocate", map[string]any{"accountId": "user-123"}, "c0"}
+	response := []any{"Blob/allocate", map[string]any{"created": map[string]any{}}, "c0"}
+	result := methodCallMetrics(call, response, 2*time.Millisecond)
+
+	if result.Method != "Blob/allocate" || result.Plugin != metrics.CorePlugin {
+		t.Errorf("expected core Blob/allocate, got %+v", result)
+	}
+	if result.ErrorType != "" {
+		t.Errorf("expected no error type, got %q", result.ErrorType)
+	}
+	if result.Latency != 2*time.Millisecond {
+		t.Errorf("expected latency 2ms, got %v", result.Latency)
+	}
+	if result.RequestBytes != len(`{"accountId":"user-123"}`) || result.ResponseBytes != len(`{"created":{}}`) {
+		t.Errorf("unexpected sizes %d, %d", result.RequestBytes, result.ResponseBytes)
+	}
+}
+
+func TestMethodCallMetrics_ErrorResponse(t *testing.T) {
+	setupTestDeps()
+
+	call := []any{"Account/export", map[string]any{}, "c0"}
+	response := []any{"error", map[string]any{"type": "forbidden"}, "c0"}
+	if result := methodCallMetrics(call, response, 0); result.ErrorType != "forbidden" {
+		t.Errorf("expected forbidden error type, got %q", result.ErrorType)
+	}
+}
+
+func TestMethodCallMetrics_InvalidCall(t *testing.T) {
+	setupTestDeps()
+
+	result := methodCallMetrics([]any{42}, []any{"error", map[string]any{}, ""}, 0)
+	if result.Method != unknownMethod || result.Plugin != unknownMethod {
+		t.Errorf("expected unknown method, got %+v", result)
+	}
+	if result.ErrorType != "unknown" {
+		t.Errorf("expected unknown error type when none is given, got %q", result.ErrorType)
+	}
+}
+
+// mockAliasResolver implements AliasResolver for testing
+type mockAliasResolver struct {
+	aliases map[string]string
+	err     error
+}
+
+func (m *mockAliasResolver) ResolveAlias(ctx context.Context, alias string) (string, error) {
+	if m.err != nil {
+		return "", m.err
+	}
+	accountID, ok := m.aliases[alias]
+	if !ok {
+		return "", account.ErrAliasNotFound
+	}
+	return accountID, nil
+}
+
+func TestHandler_IAMAuth_AliasPath_ResolvesAccount(t *testing.T) {
+	var capturedAccountID string
+	setupTestDepsWithMethods(&mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			capturedAccountID = request.AccountID
+			return &plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID}}, nil
+		},
+	})
+	deps.Registry = plugin.NewRegistryWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.Registry.AddMethod("Email/get", plugin.MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:email-get"})
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"alice@example.com": "user-123"}}
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/alice@example.com",
+		Body: `{"using":[],"methodCalls":[["Email/get",{"accountId":"alice@example.com"},"c0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "alice@example.com",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if strings.Contains(response.Body, `"error"`) {
+		t.Errorf("expected alias accountId argument to be accepted, got %s", response.Body)
+	}
+	if capturedAccountID != "user-123" {
+		t.Errorf("expected plugin to see account user-123, got %q", capturedAccountID)
+	}
+}
+
+func TestHandler_UnknownAliasPath_Returns404(t *testing.T) {
+	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.Aliases = &mockAliasResolver{}
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/nobody@example.com",
+		Body: `{"using":[],"methodCalls":[]}`,
+		PathParameters: map[string]string{
+			"accountId": "nobody@example.com",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 404 {
+		t.Errorf("expected status code 404, got %d", response.StatusCode)
+	}
+}
+
+func TestCanonicalizeArgsAccountID(t *testing.T) {
+	setupTestDeps()
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{
+		"alice@example.com": "user-123",
+		"bob@example.com":   "user-456",
+	}}
+	ctx := context.Background()
+
+	args, err := canonicalizeArgsAccountID(ctx, "user-123", map[string]any{"accountId": "alice@example.com", "ids": []any{"a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if args["accountId"] != "user-123" || args["ids"] == nil {
+		t.Errorf("expected alias replaced with account ID, got %v", args)
+	}
+
+	for _, other := range []string{"bob@example.com", "nobody@example.com", "user-456"} {
+		args, err := canonicalizeArgsAccountID(ctx, "user-123", map[string]any{"accountId": other})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if args["accountId"] != other {
+			t.Errorf("expected %s left unchanged, got %v", other, args["accountId"])
+		}
+	}
+
+	deps.Aliases = &mockAliasResolver{err: errors.New("dynamo down")}
+	if _, err := canonicalizeArgsAccountID(ctx, "user-123", map[string]any{"accountId": "alice@example.com"}); err == nil {
+		t.Error("expected lookup error to be returned")
+	}
+}
+
+func TestExtractAccountID_FromJWTSub(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-jwt-123",
+				},
+			},
+		},
+	}
+
+	accountID, err := extractAccountID(request, "sub")
+	if err != nil {
+		t.Fatalf("extractAccountID returned error: %v", err)
+	}
+
+	if accountID != "user-jwt-123" {
+		t.Errorf("expected 'user-jwt-123', got '%s'", accountID)
+	}
+}
+
+func TestExtractAccountID_FromPathParam(t *testing.T) {
+	request := events.APIGatewayProxyRequest{
+		PathParameters: map[string]string{
+			"accountId": "user-iam-456",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "should-not-use-this",
+				},
+			},
+		},
+	}
+
+	accountID, err := extractAccountID(request, "sub")
+	if err != nil {
+		t.Fatalf("extractAccountID returned error: %v", err)
+	}
+
+	// Path param takes precedence
+	if accountID != "user-iam-456" {
+		t.Errorf("expected 'user-iam-456', got '%s'", accountID)
+	}
+}
+
+func TestHandler_UnknownMethod_ReturnsUnknownMethodError(t *testing.T) {
+	setupTestDeps()
+	ctx := context.Background()
+
+	// Registry is empty, so any method should be unknown
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Unknown/method",{"accountId":"user-123"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200 (JMAP errors are in body), got %d", response.StatusCode)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if len(jmapResp.MethodResponses) != 1 {
+		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+	}
+
+	respName, ok := jmapResp.MethodResponses[0][0].(string)
+	if !ok || respName != "error" {
+		t.Errorf("expected error response, got '%v'", jmapResp.MethodResponses[0][0])
+	}
+
+	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
+	if !ok {
+		t.Fatalf("expected args to be a map")
+	}
+
+	errorType, ok := respArgs["type"].(string)
+	if !ok || errorType != "unknownMethod" {
+		t.Errorf("expected error type 'unknownMethod', got '%v'", respArgs["type"])
+	}
+}
+
+// setupTestDepsWithOwnedMethod registers Email/get as owned by the mail
+// capability, counting its invocations
+func setupTestDepsWithOwnedMethod(invoked *int) {
+	setupTestDeps()
+	deps.Registry.AddCapability("urn:ietf:params:jmap:mail")
+	deps.Registry.AddMethod("Email/get", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-get",
+		Capability:     "urn:ietf:params:jmap:mail",
+	})
+	deps.Invoker = &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			*invoked++
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID},
+			}, nil
+		},
+	}
+}
+
+func TestHandler_MethodCapability(t *testing.T) {
+	tests := []struct {
+		name     string
+		using    string
+		wantName string
+		invoked  int
+	}{
+		{"capability in using", `["urn:ietf:params:jmap:mail"]`, "Email/get", 1},
+		{"capability missing", `[]`, "error", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoked := 0
+			setupTestDepsWithOwnedMethod(&invoked)
+
+			request := strictTestRequest()
+			request.Body = `{"using":` + tt.using + `,"methodCalls":[["Email/get",{"accountId":"user-123"},"g0"]]}`
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+
+			var jmapResp JMAPResponse
+			if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(jmapResp.MethodResponses) != 1 || jmapResp.MethodResponses[0][0] != tt.wantName {
+				t.Fatalf("expected a %s response, got %s", tt.wantName, response.Body)
+			}
+			if tt.wantName == "error" {
+				if args, _ := jmapResp.MethodResponses[0][1].(map[string]any); args["type"] != "unknownMethod" {
+					t.Errorf("expected unknownMethod, got %v", args)
+				}
+			}
+			if invoked != tt.invoked {
+				t.Errorf("expected %d invocations, got %d", tt.invoked, invoked)
+			}
+		})
+	}
+}
+
+func TestHandler_MethodCapability_StrictValidation(t *testing.T) {
+	invoked := 0
+	setupTestDepsWithOwnedMethod(&invoked)
+	deps.StrictValidation = true
+
+	request := strictTestRequest()
+	request.Body = `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123"},"g0"]]}`
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 400 || !strings.Contains(response.Body, "unknownMethod") || invoked != 0 {
+		t.Errorf("expected a 400 unknownMethod problem without invoking, got %d %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_ArgsSchema_RejectsInvalidArguments(t *testing.T) {
+	invoked := 0
+	setupTestDepsWithOwnedMethod(&invoked)
+	deps.Registry.AddMethod("Email/get", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-get",
+		ArgsSchema: map[string]any{
+			"properties": map[string]any{
+				"ids": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			},
+		},
+	})
+
+	request := strictTestRequest()
+	request.Body = `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123","ids":["M1"]},"g0"],["Email/get",{"accountId":"user-123","ids":[1]},"g1"]]}`
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(jmapResp.MethodResponses) != 2 || jmapResp.MethodResponses[0][0] != "Email/get" || jmapResp.MethodResponses[1][0] != "error" {
+		t.Fatalf("expected the second call to fail, got %s", response.Body)
+	}
+	args, _ := jmapResp.MethodResponses[1][1].(map[string]any)
+	if args["type"] != "invalidArguments" || args["schemaPath"] != "/properties/ids/items/type" || args["description"] != "argument /ids/0 must be of type string" {
+		t.Errorf("unexpected error %v", args)
+	}
+	if invoked != 1 {
+		t.Errorf("expected only the valid call invoked, got %d invocations", invoked)
+	}
+}
+
+// setupTestDepsWithPagingQuery registers Email/query with the paging
+// contract, answered with respond's result for the request's arguments, and
+// returns the invocation count
+func setupTestDepsWithPagingQuery(respond func(args map[string]any) map[string]any) *int {
+	invoked := 0
+	setupTestDeps()
+	deps.Registry.AddMethod("Email/query", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-query",
+		Paging:         true,
+	})
+	deps.Invoker = &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			invoked++
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{Name: request.Method, Args: respond(request.Args), ClientID: request.ClientID},
+			}, nil
+		},
+	}
+	return &invoked
+}
+
+func TestHandler_QueryPaging(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     string
+		response map[string]any
+		wantType string
+		invoked  int
+	}{
+		{"conforming page", `{"accountId":"user-123","limit":2}`,
+			map[string]any{"queryState": "q1", "canCalculateChanges": false, "position": 0, "ids": []string{"M1", "M2"}}, "", 1},
+		{"invalid paging arguments", `{"accountId":"user-123","limit":-1}`, nil, "invalidArguments", 0},
+		{"page over the limit", `{"accountId":"user-123","limit":1}`,
+			map[string]any{"queryState": "q1", "canCalculateChanges": false, "position": 0, "ids": []string{"M1", "M2"}}, "serverFail", 1},
+		{"total missing", `{"accountId":"user-123","calculateTotal":true}`,
+			map[string]any{"queryState": "q1", "canCalculateChanges": false, "position": 0, "ids": []string{}}, "serverFail", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoked := setupTestDepsWithPagingQuery(func(args map[string]any) map[string]any { return tt.response })
+
+			request := strictTestRequest()
+			request.Body = `{"using":[],"methodCalls":[["Email/query",` + tt.args + `,"q0"]]}`
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+
+			var jmapResp JMAPResponse
+			if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(jmapResp.MethodResponses) != 1 {
+				t.Fatalf("expected one response, got %s", response.Body)
+			}
+			args, _ := jmapResp.MethodResponses[0][1].(map[string]any)
+			if tt.wantType == "" && jmapResp.MethodResponses[0][0] != "Email/query" {
+				t.Errorf("expected the plugin's page, got %s", response.Body)
+			}
+			if tt.wantType != "" && (jmapResp.MethodResponses[0][0] != "error" || args["type"] != tt.wantType) {
+				t.Errorf("expected a %s error, got %s", tt.wantType, response.Body)
+			}
+			if *invoked != tt.invoked {
+				t.Errorf("expected %d invocations, got %d", tt.invoked, *invoked)
+			}
+		})
+	}
+}
+
+func TestHandler_StateTokens(t *testing.T) {
+	now := time.Now()
+	current := statetoken.Encode(statetoken.Token{AccountID: "user-123", ModSeq: 7, IssuedAt: now})
+	edited := []byte(current)
+	edited[len(edited)/2] ^= 1
+	tests := []struct {
+		name     string
+		since    string
+		wantType string
+	}{
+		{"current token", `"` + current + `"`, ""},
+		{"edited token", `"` + string(edited) + `"`, "cannotCalculateChanges"},
+		{"another account's token", `"` + statetoken.Encode(statetoken.Token{AccountID: "user-456", IssuedAt: now}) + `"`, "cannotCalculateChanges"},
+		{"expired token", `"` + statetoken.Encode(statetoken.Token{AccountID: "user-123", IssuedAt: now.Add(-48 * time.Hour)}) + `"`, "cannotCalculateChanges"},
+		{"missing token", `null`, "invalidArguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			invoked := 0
+			setupTestDeps()
+			deps.StateTokenMaxAge = 24 * time.Hour
+			deps.Registry.AddMethod("Email/changes", plugin.MethodTarget{
+				InvocationType: "lambda-invoke",
+				InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-changes",
+				StateTokens:    true,
+			})
+			deps.Invoker = &mockInvoker{
+				invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+					invoked++
+					return &plugin.PluginInvocationResponse{
+						MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID},
+					}, nil
+				},
+			}
+
+			request := strictTestRequest()
+			request.Body = `{"using":[],"methodCalls":[["Email/changes",{"accountId":"user-123","sinceState":` + tt.since + `},"c0"]]}`
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+
+			var jmapResp JMAPResponse
+			if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if len(jmapResp.MethodResponses) != 1 {
+				t.Fatalf("expected one response, got %s", response.Body)
+			}
+			args, _ := jmapResp.MethodResponses[0][1].(map[string]any)
+			if tt.wantType == "" && (jmapResp.MethodResponses[0][0] != "Email/changes" || invoked != 1) {
+				t.Errorf("expected the plugin invoked, got %s", response.Body)
+			}
+			if tt.wantType != "" && (args["type"] != tt.wantType || invoked != 0) {
+				t.Errorf("expected a %s error without invoking, got %s", tt.wantType, response.Body)
+			}
+		})
+	}
+}
+
+func TestHandler_ResponseContentType(t *testing.T) {
+	setupTestDeps()
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, _ := handler(ctx, request)
+
+	if response.Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected Content-Type 'application/json', got '%s'", response.Headers["Content-Type"])
+	}
+}
+
+func TestProcessMethodCall_InvalidCallStructure_ReturnsError(t *testing.T) {
+	setupTestDeps()
+	ctx := context.Background()
+
+	// Call with wrong number of elements
+	call := []any{"method", "not-an-object"}
+	result := processMethodCall(ctx, "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
+
+	if result[0] != "error" {
+		t.Errorf("expected error response, got '%v'", result[0])
+	}
+}
+
+func TestProcessMethodCall_NonStringMethodName_ReturnsError(t *testing.T) {
+	setupTestDeps()
+	ctx := context.Background()
+
+	call := []any{123, map[string]any{}, "c0"}
+	result := processMethodCall(ctx, "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
+
+	if result[0] != "error" {
+		t.Errorf("expected error response, got '%v'", result[0])
+	}
+
+	args := result[1].(map[string]any)
+	if args["type"] != "invalidArguments" {
+		t.Errorf("expected invalidArguments error, got '%v'", args["type"])
+	}
+}
+
+// setupTestDepsWithPrincipals creates test deps with a registry that has registered principals
+func setupTestDepsWithPrincipals(principals []string) {
+	tp := noop.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+
+	registry := plugin.NewRegistryWithPrincipals(principals)
+
+	deps = &Dependencies{
+		Registry:           registry,
+		Invoker:            &mockInvoker{},
+		Accounts:           &mockAccountReader{},
+		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
+	}
+}
+
+func TestHandler_IAMAuth_RegisteredPrincipal_Succeeds(t *testing.T) {
+	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":[],"methodCalls":[]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_IAMAuth_UnregisteredPrincipal_Returns403(t *testing.T) {
+	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":[],"methodCalls":[]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/UnauthorizedRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 403 {
+		t.Errorf("expected status code 403, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_CognitoAuth_BypassesPrincipalCheck(t *testing.T) {
+	// Registry has no principals registered, but Cognito requests should still work
+	setupTestDepsWithPrincipals([]string{})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap", // Not /jmap-iam
+		Body: `{"using":[],"methodCalls":[]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	// Should succeed even with empty principal list because this is Cognito auth
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_IAMAuth_AssumedRole_MatchesRegisteredRole(t *testing.T) {
+	setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":[],"methodCalls":[]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				// Assumed role ARN should match the registered role
+				UserArn: "arn:aws:sts::123456789012:assumed-role/IngestRole/session-123",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+// setupTestDepsWithMethods creates test deps with mock methods for result reference testing
+func setupTestDepsWithMethods(invoker *mockInvoker) {
+	tp := noop.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+
+	registry := plugin.NewRegistry()
+	registry.AddMethod("Email/query", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-query",
+	})
+	registry.AddMethod("Email/get", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-get",
+	})
+
+	deps = &Dependencies{
+		Registry:           registry,
+		Invoker:            invoker,
+		Accounts:           &mockAccountReader{},
+		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
+	}
+}
+
+func TestHandler_ResultReference_SimplePath_Resolves(t *testing.T) {
+	// Mock invoker that returns proper responses
+	var capturedGetArgs map[string]any
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			if request.Method == "Email/query" {
+				return &plugin.PluginInvocationResponse{
+					MethodResponse: plugin.MethodResponse{
+						Name: "Email/query",
+						Args: map[string]any{
+							"accountId": request.AccountID,
+							"ids":       []any{"email1", "email2", "email3"},
+						},
+						ClientID: request.ClientID,
+					},
+				}, nil
+			}
+			// Email/get - capture the resolved args
+			capturedGetArgs = request.Args
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     "Email/get",
+					Args:     map[string]any{"accountId": request.AccountID, "list": []any{}},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+	ctx := context.Background()
+
+	// Request with result reference: Email/get references Email/query's ids
+	request := events.APIGatewayProxyRequest{
+		Body: `{
+			"using":[],
+			"methodCalls":[
+				["Email/query",{"accountId":"user-123"},"query0"],
+				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"query0","name":"Email/query","path":"/ids"}},"get0"]
+			]
+		}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	// Verify the Email/get was called with resolved ids
+	if capturedGetArgs == nil {
+		t.Fatal("Email/get was not called")
+	}
+
+	ids, ok := capturedGetArgs["ids"]
+	if !ok {
+		t.Fatal("expected 'ids' key in captured args")
+	}
+
+	idsSlice, ok := ids.([]any)
+	if !ok {
+		t.Fatalf("expected ids to be []any, got %T", ids)
+	}
+
+	if len(idsSlice) != 3 {
+		t.Errorf("expected 3 ids, got %d", len(idsSlice))
+	}
+}
+
+func TestHandler_ResultReference_WildcardPath_Resolves(t *testing.T) {
+	var capturedGetArgs map[string]any
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			if request.Method == "Email/query" {
+				return &plugin.PluginInvocationResponse{
+					MethodResponse: plugin.MethodResponse{
+						Name: "Email/query",
+						Args: map[string]any{
+							"accountId": request.AccountID,
+							"list": []any{
+								map[string]any{"id": "email1", "threadId": "thread1"},
+								map[string]any{"id": "email2", "threadId": "thread2"},
+							},
+						},
+						ClientID: request.ClientID,
+					},
+				}, nil
+			}
+			capturedGetArgs = request.Args
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     "Email/get",
+					Args:     map[string]any{"accountId": request.AccountID, "list": []any{}},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+	ctx := context.Background()
+
+	// Request with wildcard result reference
+	request := events.APIGatewayProxyRequest{
+		Body: `{
+			"using":[],
+			"methodCalls":[
+				["Email/query",{"accountId":"user-123"},"query0"],
+				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"query0","name":"Email/query","path":"/list/*/id"}},"get0"]
+			]
+		}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	if capturedGetArgs == nil {
+		t.Fatal("Email/get was not called")
+	}
+
+	ids, ok := capturedGetArgs["ids"]
+	if !ok {
+		t.Fatal("expected 'ids' key in captured args")
+	}
+
+	idsSlice, ok := ids.([]any)
+	if !ok {
+		t.Fatalf("expected ids to be []any, got %T", ids)
+	}
+
+	if len(idsSlice) != 2 {
+		t.Errorf("expected 2 ids, got %d", len(idsSlice))
+	}
+
+	if idsSlice[0] != "email1" || idsSlice[1] != "email2" {
+		t.Errorf("expected [email1, email2], got %v", idsSlice)
+	}
+}
+
+func TestHandler_ResultReference_InvalidReference_ReturnsError(t *testing.T) {
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     request.Method,
+					Args:     map[string]any{"accountId": request.AccountID},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+	ctx := context.Background()
+
+	// Request with invalid result reference (resultOf doesn't exist)
+	request := events.APIGatewayProxyRequest{
+		Body: `{
+			"using":[],
+			"methodCalls":[
+				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"nonexistent","name":"Email/query","path":"/ids"}},"get0"]
+			]
+		}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	// Should still return 200, but with error response
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if len(jmapResp.MethodResponses) != 1 {
+		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+	}
+
+	respName, ok := jmapResp.MethodResponses[0][0].(string)
+	if !ok || respName != "error" {
+		t.Errorf("expected error response, got '%v'", jmapResp.MethodResponses[0][0])
+	}
+
+	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
+	if !ok {
+		t.Fatalf("expected args to be a map")
+	}
+
+	errorType, ok := respArgs["type"].(string)
+	if !ok || errorType != "invalidResultReference" {
+		t.Errorf("expected error type 'invalidResultReference', got '%v'", respArgs["type"])
+	}
+}
+
+func TestHandler_ResultReference_ConflictingKeys_ReturnsError(t *testing.T) {
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name: "Email/query",
+					Args: map[string]any{
+						"accountId": request.AccountID,
+						"ids":       []any{"email1"},
+					},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+	ctx := context.Background()
+
+	// Request with both "ids" and "#ids" - should be an error
+	request := events.APIGatewayProxyRequest{
+		Body: `{
+			"using":[],
+			"methodCalls":[
+				["Email/query",{"accountId":"user-123"},"query0"],
+				["Email/get",{"accountId":"user-123","ids":["existing"],"#ids":{"resultOf":"query0","name":"Email/query","path":"/ids"}},"get0"]
+			]
+		}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	// First response should be Email/query success
+	if len(jmapResp.MethodResponses) != 2 {
+		t.Fatalf("expected 2 method responses, got %d", len(jmapResp.MethodResponses))
+	}
+
+	// Second response should be error for conflicting keys
+	respName, ok := jmapResp.MethodResponses[1][0].(string)
+	if !ok || respName != "error" {
+		t.Errorf("expected error response for second call, got '%v'", jmapResp.MethodResponses[1][0])
+	}
+
+	respArgs, ok := jmapResp.MethodResponses[1][1].(map[string]any)
+	if !ok {
+		t.Fatalf("expected args to be a map")
+	}
+
+	errorType, ok := respArgs["type"].(string)
+	if !ok || errorType != "invalidArguments" {
+		t.Errorf("expected error type 'invalidArguments', got '%v'", respArgs["type"])
+	}
+}
+
+// strictTestRequest is a request whose second call names another account
+func strictTestRequest() events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"q0"],["Email/get",{"accountId":"user-456"},"g0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "test-request-id",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
+	}
+}
+
+func TestHandler_StrictValidation_RejectsWholeRequest(t *testing.T) {
+	invoked := 0
+	setupTestDepsWithMethods(&mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			invoked++
+			return nil, errors.New("unexpected invocation")
+		},
+	})
+	deps.StrictValidation = true
+
+	response, err := handler(context.Background(), strictTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 400 {
+		t.Fatalf("expected status code 400, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if invoked != 0 {
+		t.Errorf("expected no plugin invocations, got %d", invoked)
+	}
+
+	var body map[string]any
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to unmarshal problem: %v", err)
+	}
+	if body["type"] != "urn:ietf:params:jmap:error:accountNotFound" || body["methodCallIndex"] != float64(1) {
+		t.Errorf("unexpected problem %s", response.Body)
+	}
+}
+
+func TestHandler_StrictValidation_AcceptsAliasAccountID(t *testing.T) {
+	setupTestDepsWithMethods(&mockInvoker{})
+	deps.StrictValidation = true
+	deps.Aliases = &mockAliasResolver{aliases: map[string]string{"me@example.com": "user-123"}}
+
+	request := strictTestRequest()
+	request.Body = `{"using":[],"methodCalls":[["Email/get",{"accountId":"me@example.com"},"g0"]]}`
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+}
+
+func TestHandler_StrictValidationOff_FailsOnlyTheBadCall(t *testing.T) {
+	invoked := 0
+	setupTestDepsWithMethods(&mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			invoked++
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID},
+			}, nil
+		},
+	})
+
+	response, err := handler(context.Background(), strictTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if invoked != 1 {
+		t.Errorf("expected the first call invoked, got %d invocations", invoked)
+	}
+}
+
+func TestHandler_PopulatesCDNURLAndAPIURL(t *testing.T) {
+	var capturedReq plugin.PluginInvocationRequest
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			capturedReq = request
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     request.Method,
+					Args:     map[string]any{"accountId": request.AccountID},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+
+	// Set env vars that handler() reads
+	t.Setenv("API_DOMAIN", "jmap.example.com")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Stage:     "v1",
+			APIID:     "abc123",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	if capturedReq.CDNURL != "https://jmap.example.com/v1" {
+		t.Errorf("expected CDNURL 'https://jmap.example.com/v1', got %q", capturedReq.CDNURL)
+	}
+
+	if capturedReq.APIURL != "https://abc123.execute-api.us-east-1.amazonaws.com/v1" {
+		t.Errorf("expected APIURL 'https://abc123.execute-api.us-east-1.amazonaws.com/v1', got %q", capturedReq.APIURL)
+	}
+}
+
+func TestHandler_CDNURLAndAPIURL_DefaultStage(t *testing.T) {
+	var capturedReq plugin.PluginInvocationRequest
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			capturedReq = request
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     request.Method,
+					Args:     map[string]any{"accountId": request.AccountID},
+					ClientID: request.ClientID,
+				},
+			}, nil
+		},
+	}
+
+	setupTestDepsWithMethods(invoker)
+
+	t.Setenv("API_DOMAIN", "jmap.example.com")
+	t.Setenv("AWS_REGION", "us-east-1")
+
+	ctx := context.Background()
+
+	// No Stage set — should default to "v1"
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			APIID:     "abc123",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	if capturedReq.CDNURL != "https://jmap.example.com/v1" {
+		t.Errorf("expected CDNURL with default stage 'https://jmap.example.com/v1', got %q", capturedReq.CDNURL)
+	}
+
+	if capturedReq.APIURL != "https://abc123.execute-api.us-east-1.amazonaws.com/v1" {
+		t.Errorf("expected APIURL with default stage 'https://abc123.execute-api.us-east-1.amazonaws.com/v1', got %q", capturedReq.APIURL)
+	}
+}
+
+// mockBlobAllocateStorage captures GeneratePresignedPutURL calls
+type mockBlobAllocateStorage struct {
+	lastSizeUnknown bool
+	lastChecksum    string
+}
+
+func (m *mockBlobAllocateStorage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error) {
+	m.lastSizeUnknown = sizeUnknown
+	m.lastChecksum = checksum
+	return "https://example.com/upload", time.Now().Add(15 * time.Minute), nil
+}
+
+// mockBlobAllocateDB captures AllocateBlob calls
+type mockBlobAllocateDB struct {
+	lastSizeUnknown bool
+	lastIsIAMAuth   bool
+	lastName        string
+	lastTags        map[string]string
+	lastIndexed     *blobmeta.IndexedMetadata
+	lastChecksum    string
+}
+
+func (m *mockBlobAllocateDB) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool, name string, tags map[string]string, indexed *blobmeta.IndexedMetadata, checksum string, maxSize int64) error {
+	m.lastSizeUnknown = sizeUnknown
+	m.lastIsIAMAuth = isIAMAuth
+	m.lastName = name
+	m.lastTags = tags
+	m.lastIndexed = indexed
+	m.lastChecksum = checksum
+	return nil
+}
+
+func setupTestDepsWithBlobAllocator(storage bloballocate.Storage, db bloballocate.DB, principals []string) {
+	tp := noop.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+
+	registry := plugin.NewRegistryWithPrincipals(principals)
+	registry.AddCapability("https://jmap.rrod.net/extensions/upload-put")
+
+	deps = &Dependencies{
+		Registry: registry,
+		Invoker:  &mockInvoker{},
+		Accounts: &mockAccountReader{},
+		BlobAllocator: &bloballocate.Handler{
+			Storage:          storage,
+			DB:               db,
+			UUIDGen:          &RealUUIDGenerator{},
+			MaxSizeUploadPut: 250000000,
+			MaxPendingAllocs: 4,
+			URLExpirySecs:    900,
+		},
+		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
+	}
+}
+
+func TestHandler_BlobAllocate_IAMAuth_SizeZero_SetsSizeUnknown(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	// IAM auth request with Blob/allocate, size=0
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	// Verify that SizeUnknown was set to true
+	if !mockDB.lastSizeUnknown {
+		t.Error("expected SizeUnknown=true to be passed to DB when IAM auth with size=0")
+	}
+	if !mockStorage.lastSizeUnknown {
+		t.Error("expected SizeUnknown=true to be passed to Storage when IAM auth with size=0")
+	}
+
+	// Verify the response includes created blob
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if len(jmapResp.MethodResponses) != 1 {
+		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+	}
+	if jmapResp.MethodResponses[0][0] != "Blob/allocate" {
+		t.Errorf("expected Blob/allocate response, got %v", jmapResp.MethodResponses[0][0])
+	}
+}
+
+func TestHandler_BlobAllocate_IAMAuth_SetsIsIAMAuth(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	if !mockDB.lastIsIAMAuth {
+		t.Error("expected IsIAMAuth=true to be passed to DB for IAM auth request")
+	}
+}
+
+func TestHandler_BlobAllocate_CognitoAuth_IsIAMAuthFalse(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"application/pdf","size":1024}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	if mockDB.lastIsIAMAuth {
+		t.Error("expected IsIAMAuth=false for Cognito auth request")
+	}
+}
+
+func TestHandler_BlobAllocate_Name(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"application/pdf","size":1024,"name":"report.pdf"}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if mockDB.lastName != "report.pdf" {
+		t.Errorf("expected name report.pdf passed to DB, got %q", mockDB.lastName)
+	}
+	if !strings.Contains(response.Body, `"name":"report.pdf"`) {
+		t.Errorf("expected name in created entry, got %s", response.Body)
+	}
+}
+
+func TestHandler_BlobAllocate_Tags(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	deps.BlobAllocator.TagKeys = blobtag.Keys{"Source", "Retention"}
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"application/pdf","size":1024,"tags":{"Source":"scanner"}},"c2":{"type":"application/pdf","size":1024,"tags":{"Owner":"someone"}},"c3":{"type":"application/pdf","size":1024,"tags":{"Source":7}}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if mockDB.lastTags["Source"] != "scanner" {
+		t.Errorf("expected Source tag passed to DB, got %v", mockDB.lastTags)
+	}
+
+	var resp struct {
+		MethodResponses [][]json.RawMessage `json:"methodResponses"`
+	}
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	var result struct {
+		Created    map[string]map[string]any `json:"created"`
+		NotCreated map[string]map[string]any `json:"notCreated"`
+	}
+	if err := json.Unmarshal(resp.MethodResponses[0][1], &result); err != nil {
+		t.Fatalf("failed to parse method response: %v", err)
+	}
+	if tags, _ := result.Created["c1"]["tags"].(map[string]any); tags["Source"] != "scanner" {
+		t.Errorf("expected tags in created entry, got %v", result.Created["c1"])
+	}
+	for _, id := range []string{"c2", "c3"} {
+		if result.NotCreated[id]["type"] != "invalidProperties" {
+			t.Errorf("%s: expected invalidProperties, got %v", id, result.NotCreated[id])
+		}
+	}
+}
+
+func TestHandler_BlobAllocate_IndexedMetadata(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"application/pdf","size":1024,"indexedMetadata":{"key":"correlationId","value":"msg-123"}},"c2":{"type":"application/pdf","size":1024,"indexedMetadata":{"key":"correlationId"}}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	if mockDB.lastIndexed == nil || mockDB.lastIndexed.Key != "correlationId" || mockDB.lastIndexed.Value != "msg-123" {
+		t.Errorf("expected indexed metadata passed to DB, got %v", mockDB.lastIndexed)
+	}
+
+	var resp struct {
+		MethodResponses [][]json.RawMessage `json:"methodResponses"`
+	}
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	var result struct {
+		Created    map[string]map[string]any `json:"created"`
+		NotCreated map[string]map[string]any `json:"notCreated"`
+	}
+	if err := json.Unmarshal(resp.MethodResponses[0][1], &result); err != nil {
+		t.Fatalf("failed to parse method response: %v", err)
+	}
+	if indexed, _ := result.Created["c1"]["indexedMetadata"].(map[string]any); indexed["value"] != "msg-123" {
+		t.Errorf("expected indexedMetadata in created entry, got %v", result.Created["c1"])
+	}
+	if result.NotCreated["c2"]["type"] != "invalidProperties" {
+		t.Errorf("expected invalidProperties, got %v", result.NotCreated["c2"])
+	}
+}
+
+func TestHandler_BlobAllocate_Checksum(t *testing.T) {
+	const checksum = "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.BlobAllocator.Storage = mockStorage
+	deps.BlobAllocator.DB = mockDB
+
+	method := firstMethodResponse(t, allocateRequestFor(`{"type":"text/plain","size":5,"checksumSha256":"`+checksum+`"}`))
+	created, _ := method[1].(map[string]any)["created"].(map[string]any)
+	entry, _ := created["c1"].(map[string]any)
+	if entry["checksumSha256"] != checksum {
+		t.Errorf("expected checksumSha256 in created entry, got %v", method[1])
+	}
+	if mockStorage.lastChecksum != checksum || mockDB.lastChecksum != checksum {
+		t.Errorf("expected the checksum passed to storage and DB, got %q and %q", mockStorage.lastChecksum, mockDB.lastChecksum)
+	}
+
+	method = firstMethodResponse(t, allocateRequestFor(`{"type":"text/plain","size":5,"checksumSha256":42}`))
+	notCreated, _ := method[1].(map[string]any)["notCreated"].(map[string]any)
+	if setErr, _ := notCreated["c1"].(map[string]any); setErr["type"] != "invalidProperties" {
+		t.Errorf("expected invalidProperties for a non-string checksum, got %v", method[1])
+	}
+}
+
+func TestHandler_BlobAllocate_CapabilityMaxSizeUpload(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	deps.Registry.AddCapabilityConfig("urn:example:calendar", map[string]any{"maxSizeUpload": float64(1000)})
+	deps.Registry.AddCapabilityConfig("urn:example:mail", map[string]any{})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"text/calendar","size":1024,"capability":"urn:example:calendar"},"c2":{"type":"text/calendar","size":1000,"capability":"urn:example:calendar"},"c3":{"type":"message/rfc822","size":1024,"capability":"urn:example:mail"},"c4":{"type":"message/rfc822","size":1024,"capability":"urn:example:unknown"}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var resp struct {
+		MethodResponses [][]json.RawMessage `json:"methodResponses"`
+	}
+	if err := json.Unmarshal([]byte(response.Body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	var result struct {
+		Created    map[string]any            `json:"created"`
+		NotCreated map[string]map[string]any `json:"notCreated"`
+	}
+	if err := json.Unmarshal(resp.MethodResponses[0][1], &result); err != nil {
+		t.Fatalf("failed to parse method response: %v", err)
+	}
+	if result.NotCreated["c1"]["type"] != "tooLarge" {
+		t.Errorf("c1: expected tooLarge over the capability limit, got %v", result.NotCreated["c1"])
+	}
+	for _, id := range []string{"c2", "c3"} {
+		if _, ok := result.Created[id]; !ok {
+			t.Errorf("%s: expected created, got %v", id, result.NotCreated[id])
+		}
+	}
+	if result.NotCreated["c4"]["type"] != "invalidProperties" {
+		t.Errorf("c4: expected invalidProperties for an unknown capability, got %v", result.NotCreated["c4"])
+	}
+}
+
+func TestHandler_BlobAllocate_IAMAuth_SizePositive_NoSizeUnknown(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	// IAM auth request with Blob/allocate, size>0
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":5000}}},"a0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	// SizeUnknown should be false when size is provided
+	if mockDB.lastSizeUnknown {
+		t.Error("expected SizeUnknown=false when IAM auth with size>0")
+	}
+}
+
+func TestHandler_BlobAllocate_CognitoAuth_SizeZero_Rejected(t *testing.T) {
+	mockStorage := &mockBlobAllocateStorage{}
+	mockDB := &mockBlobAllocateDB{}
+	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
+	ctx := context.Background()
 
-	// Verify the Email/get was called with resolved ids
-	if capturedGetArgs == nil {
-		t.Fatal("Email/get was not called")
+	// Cognito auth request with Blob/allocate, size=0 — should be rejected
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
 	}
 
-	ids, ok := capturedGetArgs["ids"]
-	if !ok {
-		t.Fatal("expected 'ids' key in captured args")
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
 	}
 
-	idsSlice, ok := ids.([]any)
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	// Should have notCreated with invalidArguments for size=0
+	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
 	if !ok {
-		t.Fatalf("expected ids to be []any, got %T", ids)
+		t.Fatal("expected response args to be a map")
+	}
+	notCreated, ok := respArgs["notCreated"].(map[string]any)
+	if !ok || notCreated == nil {
+		t.Fatal("expected notCreated to be set for Cognito + size=0")
+	}
+	c1Err, ok := notCreated["c1"].(map[string]any)
+	if !ok {
+		t.Fatal("expected c1 error in notCreated")
+	}
+	if c1Err["type"] != "invalidArguments" {
+		t.Errorf("expected invalidArguments error, got %v", c1Err["type"])
 	}
+}
 
-	if len(idsSlice) != 3 {
-		t.Errorf("expected 3 ids, got %d", len(idsSlice))
+// mockMultipartStorage implements bloballocate.MultipartStorage for testing
+type mockMultipartStorage struct {
+	createUploadID string
+}
+
+func (m *mockMultipartStorage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error) {
+	return m.createUploadID, nil
+}
+
+func (m *mockMultipartStorage) GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	parts := make([]bloballocate.PartURL, partCount)
+	for i := 0; i < partCount; i++ {
+		parts[i] = bloballocate.PartURL{PartNumber: int32(i + 1), URL: "https://example.com/part"}
 	}
+	return parts, time.Now().Add(15 * time.Minute), nil
 }
 
-func TestHandler_ResultReference_WildcardPath_Resolves(t *testing.T) {
-	var capturedGetArgs map[string]any
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			if request.Method == "Email/query" {
-				return &plugin.PluginInvocationResponse{
-					MethodResponse: plugin.MethodResponse{
-						Name: "Email/query",
-						Args: map[string]any{
-							"accountId": request.AccountID,
-							"list": []any{
-								map[string]any{"id": "email1", "threadId": "thread1"},
-								map[string]any{"id": "email2", "threadId": "thread2"},
-							},
-						},
-						ClientID: request.ClientID,
-					},
-				}, nil
-			}
-			capturedGetArgs = request.Args
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name:     "Email/get",
-					Args:     map[string]any{"accountId": request.AccountID, "list": []any{}},
-					ClientID: request.ClientID,
+// mockBlobCompleteStorage implements blobcomplete.Storage for testing
+type mockBlobCompleteStorage struct {
+	lastParts []bloballocate.CompletedPart
+}
+
+func (m *mockBlobCompleteStorage) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+	m.lastParts = parts
+	return nil
+}
+
+func (m *mockBlobCompleteStorage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	return nil, nil
+}
+
+// mockBlobCompleteDB implements blobcomplete.DB for testing
+type mockBlobCompleteDB struct {
+	record *blobcomplete.BlobRecord
+}
+
+func (m *mockBlobCompleteDB) GetBlobForComplete(ctx context.Context, accountID, blobID string) (*blobcomplete.BlobRecord, error) {
+	return m.record, nil
+}
+
+func setupTestDepsWithMultipart(principals []string) {
+	tp := noop.NewTracerProvider()
+	otel.SetTracerProvider(tp)
+
+	registry := plugin.NewRegistryWithPrincipals(principals)
+	registry.AddCapability("https://jmap.rrod.net/extensions/upload-put")
+
+	deps = &Dependencies{
+		Registry: registry,
+		Invoker:  &mockInvoker{},
+		Accounts: &mockAccountReader{},
+		BlobAllocator: &bloballocate.Handler{
+			Storage:            &mockBlobAllocateStorage{},
+			MultipartStorage:   &mockMultipartStorage{createUploadID: "upload-test"},
+			DB:                 &mockBlobAllocateDB{},
+			UUIDGen:            &RealUUIDGenerator{},
+			MaxSizeUploadPut:   250000000,
+			MaxPendingAllocs:   4,
+			URLExpirySecs:      900,
+			MultipartPartCount: 3,
+		},
+		BlobCompleter: &blobcomplete.Handler{
+			Storage: &mockBlobCompleteStorage{},
+			DB: &mockBlobCompleteDB{
+				record: &blobcomplete.BlobRecord{
+					Status:    "pending",
+					Multipart: true,
+					UploadID:  "upload-test",
 				},
-			}, nil
+			},
+		},
+		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
+	}
+}
+
+func TestHandler_BlobAllocate_Multipart_IAM_ReturnsPartsNotURL(t *testing.T) {
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	ctx := context.Background()
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","multipart":true}}},"a0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	if jmapResp.MethodResponses[0][0] != "Blob/allocate" {
+		t.Fatalf("expected Blob/allocate, got %v", jmapResp.MethodResponses[0][0])
+	}
+
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	created := respArgs["created"].(map[string]any)
+	c1 := created["c1"].(map[string]any)
+
+	// Should have parts, not url
+	parts, hasParts := c1["parts"]
+	_, hasURL := c1["url"]
+	if !hasParts {
+		t.Fatal("expected 'parts' in multipart response")
+	}
+	if hasURL {
+		t.Error("expected no 'url' in multipart response")
+	}
+
+	partsArr, ok := parts.([]any)
+	if !ok {
+		t.Fatalf("expected parts to be array, got %T", parts)
+	}
+	if len(partsArr) != 3 {
+		t.Errorf("expected 3 parts, got %d", len(partsArr))
+	}
+}
+
+func TestHandler_BlobAllocate_Multipart_Cognito_Rejected(t *testing.T) {
+	setupTestDepsWithMultipart(nil)
+	ctx := context.Background()
+
+	// Cognito auth request with multipart=true — should be rejected
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","multipart":true}}},"a0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Authorizer: map[string]any{
+				"claims": map[string]any{
+					"sub": "user-123",
+				},
+			},
+		},
+	}
+
+	response, err := handler(ctx, request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 200 {
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	notCreated, ok := respArgs["notCreated"].(map[string]any)
+	if !ok || notCreated == nil {
+		t.Fatal("expected notCreated for Cognito multipart request")
+	}
+	c1Err := notCreated["c1"].(map[string]any)
+	if c1Err["type"] != "invalidArguments" {
+		t.Errorf("expected invalidArguments, got %v", c1Err["type"])
+	}
+}
+
+// allocateRequestFor builds an IAM-authenticated Blob/allocate request with one creation
+func allocateRequestFor(create string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":` + create + `}},"a0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
 		},
 	}
+}
+
+func TestHandler_BlobAllocate_AccountTypeFeatures(t *testing.T) {
+	tests := map[string]struct {
+		create   string
+		wantType string
+	}{
+		"multipart disabled": {`{"type":"message/rfc822","multipart":true}`, "invalidArguments"},
+		"over max blob size": {`{"type":"message/rfc822","size":2000}`, "tooLarge"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+			deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-123", AccountType: "trial"}}
+			multipart := false
+			deps.Features = account.FeatureFlags{"trial": {Multipart: &multipart, MaxBlobSize: 1000}}
+
+			method := firstMethodResponse(t, allocateRequestFor(tc.create))
+
+			notCreated, ok := method[1].(map[string]any)["notCreated"].(map[string]any)
+			if !ok {
+				t.Fatalf("expected notCreated, got %v", method[1])
+			}
+			if errType := notCreated["c1"].(map[string]any)["type"]; errType != tc.wantType {
+				t.Errorf("expected %s, got %v", tc.wantType, errType)
+			}
+		})
+	}
+}
+
+func TestHandler_CapabilityOutsideAccountTypeSubset_Returns400(t *testing.T) {
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountID: "user-123", AccountType: "trial"}}
+	deps.Features = account.FeatureFlags{"trial": {Capabilities: []string{"urn:ietf:params:jmap:mail"}}}
+
+	response, err := handler(context.Background(), allocateRequestFor(`{"type":"message/rfc822","size":10}`))
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if response.StatusCode != 400 || !strings.Contains(response.Body, "unknownCapability") {
+		t.Errorf("expected 400 unknownCapability, got %d: %s", response.StatusCode, response.Body)
+	}
+}
 
-	setupTestDepsWithMethods(invoker)
+func TestHandler_BlobComplete_Success(t *testing.T) {
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
 	ctx := context.Background()
 
-	// Request with wildcard result reference
 	request := events.APIGatewayProxyRequest{
-		Body: `{
-			"using":[],
-			"methodCalls":[
-				["Email/query",{"accountId":"user-123"},"query0"],
-				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"query0","name":"Email/query","path":"/list/*/id"}},"get0"]
-			]
-		}`,
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/complete",{"accountId":"user-123","id":"blob-1","parts":[{"partNumber":1,"etag":"\"abc\""},{"partNumber":2,"etag":"\"def\""}]},"c0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
 			},
 		},
 	}
@@ -571,58 +2797,76 @@ func TestHandler_ResultReference_WildcardPath_Resolves(t *testing.T) {
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
 	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
-	if capturedGetArgs == nil {
-		t.Fatal("Email/get was not called")
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
 	}
 
-	ids, ok := capturedGetArgs["ids"]
-	if !ok {
-		t.Fatal("expected 'ids' key in captured args")
+	if len(jmapResp.MethodResponses) != 1 {
+		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
 	}
-
-	idsSlice, ok := ids.([]any)
-	if !ok {
-		t.Fatalf("expected ids to be []any, got %T", ids)
+	if jmapResp.MethodResponses[0][0] != "Blob/complete" {
+		t.Errorf("expected Blob/complete response, got %v", jmapResp.MethodResponses[0][0])
 	}
 
-	if len(idsSlice) != 2 {
-		t.Errorf("expected 2 ids, got %d", len(idsSlice))
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	if respArgs["accountId"] != "user-123" {
+		t.Errorf("expected accountId 'user-123', got %v", respArgs["accountId"])
 	}
-
-	if idsSlice[0] != "email1" || idsSlice[1] != "email2" {
-		t.Errorf("expected [email1, email2], got %v", idsSlice)
+	if respArgs["id"] != "blob-1" {
+		t.Errorf("expected id 'blob-1', got %v", respArgs["id"])
 	}
 }
 
-func TestHandler_ResultReference_InvalidReference_ReturnsError(t *testing.T) {
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name:     request.Method,
-					Args:     map[string]any{"accountId": request.AccountID},
-					ClientID: request.ClientID,
-				},
-			}, nil
+func TestHandler_BlobComplete_PartChecksums(t *testing.T) {
+	first, _ := blobchecksum.Sum(strings.NewReader("part one"))
+	second, _ := blobchecksum.Sum(strings.NewReader("part two"))
+	declared, _ := blobchecksum.Composite([]string{first, second})
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	storage := &mockBlobCompleteStorage{}
+	deps.BlobCompleter = &blobcomplete.Handler{
+		Storage: storage,
+		DB:      &mockBlobCompleteDB{record: &blobcomplete.BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-test", Checksum: declared}},
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Path: "/jmap-iam/user-123",
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/complete",{"accountId":"user-123","id":"blob-1","parts":[{"partNumber":1,"etag":"\"abc\"","checksumSha256":"` + first + `"},{"partNumber":2,"etag":"\"def\"","checksumSha256":"` + second + `"}]},"c0"]]}`,
+		PathParameters: map[string]string{
+			"accountId": "user-123",
+		},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID: "test-request-id",
+			Identity: events.APIGatewayRequestIdentity{
+				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			},
 		},
 	}
 
-	setupTestDepsWithMethods(invoker)
+	method := firstMethodResponse(t, request)
+	if method[0] != "Blob/complete" {
+		t.Fatalf("expected Blob/complete response, got %v", method)
+	}
+	if len(storage.lastParts) != 2 || storage.lastParts[1].ChecksumSHA256 != second {
+		t.Errorf("expected part checksums passed to storage, got %+v", storage.lastParts)
+	}
+}
+
+func TestHandler_BlobComplete_MissingCapability(t *testing.T) {
+	// Use setupTestDeps which has no upload-put capability
+	setupTestDeps()
+	deps.BlobCompleter = &blobcomplete.Handler{
+		Storage: &mockBlobCompleteStorage{},
+		DB:      &mockBlobCompleteDB{},
+	}
 	ctx := context.Background()
 
-	// Request with invalid result reference (resultOf doesn't exist)
 	request := events.APIGatewayProxyRequest{
-		Body: `{
-			"using":[],
-			"methodCalls":[
-				["Email/get",{"accountId":"user-123","#ids":{"resultOf":"nonexistent","name":"Email/query","path":"/ids"}},"get0"]
-			]
-		}`,
+		Body: `{"using":[],"methodCalls":[["Blob/complete",{"accountId":"user-123","id":"blob-1","parts":[{"partNumber":1,"etag":"e1"}]},"c0"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
 			Authorizer: map[string]any{
@@ -637,274 +2881,354 @@ func TestHandler_ResultReference_InvalidReference_ReturnsError(t *testing.T) {
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
-	// Should still return 200, but with error response
 	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
 	}
 
 	var jmapResp JMAPResponse
-	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
-		t.Fatalf("failed to unmarshal response: %v", err)
-	}
+	json.Unmarshal([]byte(response.Body), &jmapResp)
 
-	if len(jmapResp.MethodResponses) != 1 {
-		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+	if jmapResp.MethodResponses[0][0] != "error" {
+		t.Errorf("expected error response, got %v", jmapResp.MethodResponses[0][0])
 	}
-
-	respName, ok := jmapResp.MethodResponses[0][0].(string)
-	if !ok || respName != "error" {
-		t.Errorf("expected error response, got '%v'", jmapResp.MethodResponses[0][0])
+	errArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	if errArgs["type"] != "unknownMethod" {
+		t.Errorf("expected unknownMethod error, got %v", errArgs["type"])
 	}
+}
 
-	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
-	if !ok {
-		t.Fatalf("expected args to be a map")
-	}
+// mockAccountExportDB implements accountexport.DB for testing
+type mockAccountExportDB struct {
+	createdJob *accountexport.Job
+	jobs       map[string]*accountexport.Job
+}
 
-	errorType, ok := respArgs["type"].(string)
-	if !ok || errorType != "invalidResultReference" {
-		t.Errorf("expected error type 'invalidResultReference', got '%v'", respArgs["type"])
-	}
+// mockBlobStatusStorage implements blobstatus.Storage for testing
+type mockBlobStatusStorage struct {
+	parts []bloballocate.UploadedPart
 }
 
-func TestHandler_ResultReference_ConflictingKeys_ReturnsError(t *testing.T) {
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name: "Email/query",
-					Args: map[string]any{
-						"accountId": request.AccountID,
-						"ids":       []any{"email1"},
-					},
-					ClientID: request.ClientID,
-				},
-			}, nil
-		},
-	}
+func (m *mockBlobStatusStorage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	return m.parts, nil
+}
 
-	setupTestDepsWithMethods(invoker)
-	ctx := context.Background()
+// mockBlobStatusDB implements blobstatus.DB for testing
+type mockBlobStatusDB struct {
+	record *blobstatus.BlobRecord
+}
+
+func (m *mockBlobStatusDB) GetBlobForStatus(ctx context.Context, accountID, blobID string) (*blobstatus.BlobRecord, error) {
+	return m.record, nil
+}
+
+func TestHandler_BlobAllocationStatus(t *testing.T) {
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	deps.BlobStatus = &blobstatus.Handler{
+		Storage: &mockBlobStatusStorage{parts: []bloballocate.UploadedPart{{PartNumber: 2, ETag: `"def"`, Size: 5242880}}},
+		DB: &mockBlobStatusDB{record: &blobstatus.BlobRecord{
+			Status:       "pending",
+			SizeUnknown:  true,
+			Multipart:    true,
+			UploadID:     "upload-test",
+			URLExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second),
+		}},
+		PartCount: 3,
+	}
 
-	// Request with both "ids" and "#ids" - should be an error
 	request := events.APIGatewayProxyRequest{
-		Body: `{
-			"using":[],
-			"methodCalls":[
-				["Email/query",{"accountId":"user-123"},"query0"],
-				["Email/get",{"accountId":"user-123","ids":["existing"],"#ids":{"resultOf":"query0","name":"Email/query","path":"/ids"}},"get0"]
-			]
-		}`,
+		Path:           "/jmap-iam/user-123",
+		Body:           `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocationStatus",{"accountId":"user-123","id":"blob-1"},"c0"]]}`,
+		PathParameters: map[string]string{"accountId": "user-123"},
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
-			},
+			Identity:  events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:role/IngestRole"},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
-	if response.StatusCode != 200 {
-		t.Errorf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
-	}
-
 	var jmapResp JMAPResponse
 	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
 		t.Fatalf("failed to unmarshal response: %v", err)
 	}
-
-	// First response should be Email/query success
-	if len(jmapResp.MethodResponses) != 2 {
-		t.Fatalf("expected 2 method responses, got %d", len(jmapResp.MethodResponses))
+	if jmapResp.MethodResponses[0][0] != "Blob/allocationStatus" {
+		t.Fatalf("expected Blob/allocationStatus, got %v", jmapResp.MethodResponses[0])
 	}
 
-	// Second response should be error for conflicting keys
-	respName, ok := jmapResp.MethodResponses[1][0].(string)
-	if !ok || respName != "error" {
-		t.Errorf("expected error response for second call, got '%v'", jmapResp.MethodResponses[1][0])
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	if respArgs["id"] != "blob-1" || respArgs["status"] != "pending" || respArgs["multipart"] != true {
+		t.Errorf("unexpected response %v", respArgs)
 	}
-
-	respArgs, ok := jmapResp.MethodResponses[1][1].(map[string]any)
-	if !ok {
-		t.Fatalf("expected args to be a map")
+	if _, ok := respArgs["size"]; ok {
+		t.Error("expected no size for an upload of unknown size")
 	}
-
-	errorType, ok := respArgs["type"].(string)
-	if !ok || errorType != "invalidArguments" {
-		t.Errorf("expected error type 'invalidArguments', got '%v'", respArgs["type"])
+	if _, err := time.Parse(time.RFC3339, respArgs["urlExpires"].(string)); err != nil {
+		t.Errorf("expected an RFC 3339 urlExpires, got %v", respArgs["urlExpires"])
+	}
+	uploaded := respArgs["uploadedParts"].([]any)
+	if len(uploaded) != 1 || uploaded[0].(map[string]any)["etag"] != `"def"` {
+		t.Errorf("unexpected uploaded parts %v", uploaded)
+	}
+	remaining := respArgs["remainingParts"].([]any)
+	if len(remaining) != 2 || remaining[0] != float64(1) || remaining[1] != float64(3) {
+		t.Errorf("expected parts 1 and 3 remaining, got %v", remaining)
 	}
 }
 
-func TestHandler_PopulatesCDNURLAndAPIURL(t *testing.T) {
-	var capturedReq plugin.PluginInvocationRequest
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			capturedReq = request
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name:     request.Method,
-					Args:     map[string]any{"accountId": request.AccountID},
-					ClientID: request.ClientID,
-				},
-			}, nil
+func TestHandler_BlobAllocationStatus_NotFound(t *testing.T) {
+	setupTestDepsWithMultipart(nil)
+	deps.BlobStatus = &blobstatus.Handler{Storage: &mockBlobStatusStorage{}, DB: &mockBlobStatusDB{}}
+
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocationStatus",{"accountId":"user-123","id":"blob-1"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "test-request-id",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
 		},
 	}
 
-	setupTestDepsWithMethods(invoker)
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	var jmapResp JMAPResponse
+	json.Unmarshal([]byte(response.Body), &jmapResp)
+	if jmapResp.MethodResponses[0][0] != "error" {
+		t.Fatalf("expected an error, got %v", jmapResp.MethodResponses[0])
+	}
+	if errType := jmapResp.MethodResponses[0][1].(map[string]any)["type"]; errType != "blobNotFound" {
+		t.Errorf("expected blobNotFound, got %v", errType)
+	}
+}
 
-	// Set env vars that handler() reads
-	t.Setenv("API_DOMAIN", "jmap.example.com")
-	t.Setenv("AWS_REGION", "us-east-1")
+// mockBlobIndexDB implements blobindex.DB for testing
+type mockBlobIndexDB struct {
+	ids       []string
+	more      bool
+	lastKey   string
+	lastValue string
+	lastAfter string
+	lastLimit int
+}
 
-	ctx := context.Background()
+func (m *mockBlobIndexDB) QueryIndexedBlobs(ctx context.Context, accountID, key, value, after string, limit int) ([]string, bool, error) {
+	m.lastKey, m.lastValue, m.lastAfter, m.lastLimit = key, value, after, limit
+	return m.ids, m.more, nil
+}
+
+func TestHandler_BlobQueryByMetadata(t *testing.T) {
+	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	db := &mockBlobIndexDB{ids: []string{"blob-1", "blob-2"}, more: true}
+	deps.BlobIndex = &blobindex.Handler{DB: db}
 
 	request := events.APIGatewayProxyRequest{
-		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"]]}`,
+		Path:           "/jmap-iam/user-123",
+		Body:           `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/queryByMetadata",{"accountId":"user-123","key":"correlationId","value":"msg-123","after":"blob-0","limit":2},"c0"]]}`,
+		PathParameters: map[string]string{"accountId": "user-123"},
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Stage:     "v1",
-			APIID:     "abc123",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
-			},
+			Identity:  events.APIGatewayRequestIdentity{UserArn: "arn:aws:iam::123456789012:role/IngestRole"},
+		},
+	}
+
+	response, err := handler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if jmapResp.MethodResponses[0][0] != "Blob/queryByMetadata" {
+		t.Fatalf("expected Blob/queryByMetadata, got %v", jmapResp.MethodResponses[0])
+	}
+	if db.lastKey != "correlationId" || db.lastValue != "msg-123" || db.lastAfter != "blob-0" || db.lastLimit != 2 {
+		t.Errorf("unexpected query %+v", db)
+	}
+
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	ids := respArgs["ids"].([]any)
+	if len(ids) != 2 || ids[0] != "blob-1" || respArgs["hasMore"] != true || respArgs["value"] != "msg-123" {
+		t.Errorf("unexpected response %v", respArgs)
+	}
+}
+
+func TestHandler_BlobQueryByMetadata_InvalidArguments(t *testing.T) {
+	setupTestDepsWithMultipart(nil)
+	deps.BlobIndex = &blobindex.Handler{DB: &mockBlobIndexDB{}}
+
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/queryByMetadata",{"accountId":"user-123","key":"correlationId"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  "test-request-id",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	var jmapResp JMAPResponse
+	json.Unmarshal([]byte(response.Body), &jmapResp)
+	if jmapResp.MethodResponses[0][0] != "error" {
+		t.Fatalf("expected an error, got %v", jmapResp.MethodResponses[0])
 	}
-
-	if capturedReq.CDNURL != "https://jmap.example.com/v1" {
-		t.Errorf("expected CDNURL 'https://jmap.example.com/v1', got %q", capturedReq.CDNURL)
+	if errType := jmapResp.MethodResponses[0][1].(map[string]any)["type"]; errType != "invalidArguments" {
+		t.Errorf("expected invalidArguments, got %v", errType)
 	}
+}
 
-	if capturedReq.APIURL != "https://abc123.execute-api.us-east-1.amazonaws.com/v1" {
-		t.Errorf("expected APIURL 'https://abc123.execute-api.us-east-1.amazonaws.com/v1', got %q", capturedReq.APIURL)
-	}
+// mockBlobReallocateStorage implements blobreallocate.Storage for testing
+type mockBlobReallocateStorage struct {
+	partNumbers []int32
 }
 
-func TestHandler_CDNURLAndAPIURL_DefaultStage(t *testing.T) {
-	var capturedReq plugin.PluginInvocationRequest
-	invoker := &mockInvoker{
-		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
-			capturedReq = request
-			return &plugin.PluginInvocationResponse{
-				MethodResponse: plugin.MethodResponse{
-					Name:     request.Method,
-					Args:     map[string]any{"accountId": request.AccountID},
-					ClientID: request.ClientID,
-				},
-			}, nil
-		},
+func (m *mockBlobReallocateStorage) GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	m.partNumbers = partNumbers
+	parts := make([]bloballocate.PartURL, len(partNumbers))
+	for i, n := range partNumbers {
+		parts[i] = bloballocate.PartURL{PartNumber: n, URL: fmt.Sprintf("https://s3.example.com/part%d", n)}
 	}
+	return parts, time.Now().Add(time.Duration(urlExpirySecs) * time.Second), nil
+}
 
-	setupTestDepsWithMethods(invoker)
+// mockBlobReallocateDB implements blobreallocate.DB for testing
+type mockBlobReallocateDB struct {
+	record   *blobreallocate.BlobRecord
+	extended bool
+}
 
-	t.Setenv("API_DOMAIN", "jmap.example.com")
-	t.Setenv("AWS_REGION", "us-east-1")
+func (m *mockBlobReallocateDB) GetBlobForReallocate(ctx context.Context, accountID, blobID string) (*blobreallocate.BlobRecord, error) {
+	return m.record, nil
+}
 
-	ctx := context.Background()
+func (m *mockBlobReallocateDB) ExtendAllocation(ctx context.Context, accountID, blobID, uploadID string, urlExpiresAt time.Time) error {
+	m.extended = true
+	return nil
+}
+
+func TestHandler_BlobReallocateParts(t *testing.T) {
+	setupTestDepsWithMultipart(nil)
+	storage := &mockBlobReallocateStorage{}
+	db := &mockBlobReallocateDB{record: &blobreallocate.BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-test"}}
+	deps.BlobReallocator = &blobreallocate.Handler{Storage: storage, DB: db, URLExpirySecs: 900}
 
-	// No Stage set — should default to "v1"
 	request := events.APIGatewayProxyRequest{
-		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"]]}`,
+		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/reallocateParts",{"accountId":"user-123","id":"blob-1","partNumbers":[2,5]},"c0"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			APIID:     "abc123",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
-			},
+			RequestID:  "test-request-id",
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	var jmapResp JMAPResponse
+	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
+		t.Fatalf("failed to unmarshal response: %v", err)
+	}
+	if jmapResp.MethodResponses[0][0] != "Blob/reallocateParts" {
+		t.Fatalf("expected Blob/reallocateParts, got %v", jmapResp.MethodResponses[0])
 	}
 
-	if capturedReq.CDNURL != "https://jmap.example.com/v1" {
-		t.Errorf("expected CDNURL with default stage 'https://jmap.example.com/v1', got %q", capturedReq.CDNURL)
+	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
+	if respArgs["id"] != "blob-1" || respArgs["expires"] == nil {
+		t.Errorf("unexpected response %v", respArgs)
+	}
+	parts := respArgs["parts"].([]any)
+	if len(parts) != 2 || parts[1].(map[string]any)["partNumber"] != float64(5) || parts[1].(map[string]any)["url"] != "https://s3.example.com/part5" {
+		t.Errorf("unexpected parts %v", parts)
+	}
+	if len(storage.partNumbers) != 2 || storage.partNumbers[0] != 2 {
+		t.Errorf("expected parts 2 and 5 to be presigned, got %v", storage.partNumbers)
+	}
+	if !db.extended {
+		t.Error("expected the allocation to be extended")
 	}
+}
 
-	if capturedReq.APIURL != "https://abc123.execute-api.us-east-1.amazonaws.com/v1" {
-		t.Errorf("expected APIURL with default stage 'https://abc123.execute-api.us-east-1.amazonaws.com/v1', got %q", capturedReq.APIURL)
+func TestHandler_BlobReallocateParts_InvalidPartNumbers(t *testing.T) {
+	for _, partNumbers := range []string{`[]`, `[0]`, `[1.5]`, `["1"]`, `[10001]`} {
+		t.Run(partNumbers, func(t *testing.T) {
+			setupTestDepsWithMultipart(nil)
+			storage := &mockBlobReallocateStorage{}
+			deps.BlobReallocator = &blobreallocate.Handler{Storage: storage, DB: &mockBlobReallocateDB{}}
+
+			request := events.APIGatewayProxyRequest{
+				Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/reallocateParts",{"accountId":"user-123","id":"blob-1","partNumbers":` + partNumbers + `},"c0"]]}`,
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID:  "test-request-id",
+					Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+				},
+			}
+
+			response, _ := handler(context.Background(), request)
+			var jmapResp JMAPResponse
+			json.Unmarshal([]byte(response.Body), &jmapResp)
+			if jmapResp.MethodResponses[0][0] != "error" || jmapResp.MethodResponses[0][1].(map[string]any)["type"] != "invalidArguments" {
+				t.Errorf("expected invalidArguments, got %v", jmapResp.MethodResponses[0])
+			}
+			if storage.partNumbers != nil {
+				t.Error("expected nothing to be presigned")
+			}
+		})
 	}
 }
+func (m *mockAccountExportDB) CreateJob(ctx context.Context, job accountexport.Job) error {
+	m.createdJob = &job
+	return nil
+}
 
-// mockBlobAllocateStorage captures GeneratePresignedPutURL calls
-type mockBlobAllocateStorage struct {
-	lastSizeUnknown bool
+func (m *mockAccountExportDB) GetJob(ctx context.Context, accountID, exportID string) (*accountexport.Job, error) {
+	return m.jobs[exportID], nil
 }
 
-func (m *mockBlobAllocateStorage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool) (string, time.Time, error) {
-	m.lastSizeUnknown = sizeUnknown
-	return "https://example.com/upload", time.Now().Add(15 * time.Minute), nil
+func (m *mockAccountExportDB) StartJob(ctx context.Context, accountID, exportID string) error {
+	return nil
 }
 
-// mockBlobAllocateDB captures AllocateBlob calls
-type mockBlobAllocateDB struct {
-	lastSizeUnknown bool
-	lastIsIAMAuth   bool
+func (m *mockAccountExportDB) ListBlobs(ctx context.Context, accountID string) ([]accountexport.BlobEntry, error) {
+	return nil, nil
 }
 
-func (m *mockBlobAllocateDB) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool) error {
-	m.lastSizeUnknown = sizeUnknown
-	m.lastIsIAMAuth = isIAMAuth
+func (m *mockAccountExportDB) CompleteJob(ctx context.Context, job accountexport.Job, s3Key string) error {
 	return nil
 }
 
-func setupTestDepsWithBlobAllocator(storage bloballocate.Storage, db bloballocate.DB, principals []string) {
-	tp := noop.NewTracerProvider()
-	otel.SetTracerProvider(tp)
+func (m *mockAccountExportDB) FailJob(ctx context.Context, accountID, exportID, reason string) error {
+	return nil
+}
 
-	registry := plugin.NewRegistryWithPrincipals(principals)
-	registry.AddCapability("https://jmap.rrod.net/extensions/upload-put")
+func setupTestDepsWithAccountExporter(exportDB *mockAccountExportDB) {
+	otel.SetTracerProvider(noop.NewTracerProvider())
+
+	registry := plugin.NewRegistryWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+	registry.AddCapability("urn:ietf:params:jmap:core")
+	registry.AddCapability(AccountExportCapability)
 
 	deps = &Dependencies{
 		Registry: registry,
 		Invoker:  &mockInvoker{},
-		BlobAllocator: &bloballocate.Handler{
-			Storage:          storage,
-			DB:               db,
-			UUIDGen:          &RealUUIDGenerator{},
-			MaxSizeUploadPut: 250000000,
-			MaxPendingAllocs: 4,
-			URLExpirySecs:    900,
+		Accounts: &mockAccountReader{},
+		AccountExporter: &accountexport.Handler{
+			DB:      exportDB,
+			UUIDGen: &RealUUIDGenerator{},
 		},
 		DispatcherPoolSize: DefaultDispatcherPoolSize,
+		Bindings:           &mockPrincipalBindings{},
+		AccountIDClaim:     "sub",
 	}
 }
 
-func TestHandler_BlobAllocate_IAMAuth_SizeZero_SetsSizeUnknown(t *testing.T) {
-	mockStorage := &mockBlobAllocateStorage{}
-	mockDB := &mockBlobAllocateDB{}
-	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
-
-	// IAM auth request with Blob/allocate, size=0
-	request := events.APIGatewayProxyRequest{
+func accountExportRequest(body string) events.APIGatewayProxyRequest {
+	return events.APIGatewayProxyRequest{
 		Path: "/jmap-iam/user-123",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
+		Body: body,
 		PathParameters: map[string]string{
 			"accountId": "user-123",
 		},
@@ -915,25 +3239,18 @@ func TestHandler_BlobAllocate_IAMAuth_SizeZero_SetsSizeUnknown(t *testing.T) {
 			},
 		},
 	}
+}
 
-	response, err := handler(ctx, request)
+// firstMethodResponse runs the handler and returns the first method response
+func firstMethodResponse(t *testing.T, request events.APIGatewayProxyRequest) []any {
+	t.Helper()
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
 	if response.StatusCode != 200 {
 		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
 	}
-
-	// Verify that SizeUnknown was set to true
-	if !mockDB.lastSizeUnknown {
-		t.Error("expected SizeUnknown=true to be passed to DB when IAM auth with size=0")
-	}
-	if !mockStorage.lastSizeUnknown {
-		t.Error("expected SizeUnknown=true to be passed to Storage when IAM auth with size=0")
-	}
-
-	// Verify the response includes created blob
 	var jmapResp JMAPResponse
 	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
 		t.Fatalf("failed to unmarshal response: %v", err)
@@ -941,415 +3258,652 @@ func TestHandler_BlobAllocate_IAMAuth_SizeZero_SetsSizeUnknown(t *testing.T) {
 	if len(jmapResp.MethodResponses) != 1 {
 		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
 	}
-	if jmapResp.MethodResponses[0][0] != "Blob/allocate" {
-		t.Errorf("expected Blob/allocate response, got %v", jmapResp.MethodResponses[0][0])
+	return jmapResp.MethodResponses[0]
+}
+
+func TestHandler_AccountExport_StartsJob(t *testing.T) {
+	exportDB := &mockAccountExportDB{}
+	setupTestDepsWithAccountExporter(exportDB)
+
+	resp := firstMethodResponse(t, accountExportRequest(`{"using":["`+AccountExportCapability+`"],"methodCalls":[["Account/export",{"accountId":"user-123"},"c0"]]}`))
+
+	if resp[0] != "Account/export" {
+		t.Fatalf("expected Account/export response, got %v", resp)
+	}
+	args := resp[1].(map[string]any)
+	if args["status"] != "pending" || args["exportId"] == "" {
+		t.Errorf("unexpected response args: %v", args)
+	}
+	if exportDB.createdJob == nil || exportDB.createdJob.AccountID != "user-123" {
+		t.Errorf("expected job to be created for user-123, got %+v", exportDB.createdJob)
 	}
 }
 
-func TestHandler_BlobAllocate_IAMAuth_SetsIsIAMAuth(t *testing.T) {
-	mockStorage := &mockBlobAllocateStorage{}
-	mockDB := &mockBlobAllocateDB{}
-	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+func TestHandler_AccountExport_ReportsCompletedJob(t *testing.T) {
+	exportDB := &mockAccountExportDB{jobs: map[string]*accountexport.Job{
+		"exp-1": {AccountID: "user-123", ExportID: "exp-1", Status: "completed", BlobID: "blob-9", Size: 42},
+	}}
+	setupTestDepsWithAccountExporter(exportDB)
 
-	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
-		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
-			},
-		},
+	resp := firstMethodResponse(t, accountExportRequest(`{"using":["`+AccountExportCapability+`"],"methodCalls":[["Account/export",{"accountId":"user-123","exportId":"exp-1"},"c0"]]}`))
+
+	args := resp[1].(map[string]any)
+	if args["status"] != "completed" || args["blobId"] != "blob-9" {
+		t.Errorf("unexpected response args: %v", args)
+	}
+	if exportDB.createdJob != nil {
+		t.Error("expected no new job when polling")
 	}
+}
 
-	response, err := handler(ctx, request)
-	if err != nil {
-		t.Fatalf("handler returned error: %v", err)
+func TestHandler_AccountExport_UnknownExport_ReturnsError(t *testing.T) {
+	setupTestDepsWithAccountExporter(&mockAccountExportDB{})
+
+	resp := firstMethodResponse(t, accountExportRequest(`{"using":["`+AccountExportCapability+`"],"methodCalls":[["Account/export",{"exportId":"missing"},"c0"]]}`))
+
+	if resp[0] != "error" || resp[1].(map[string]any)["type"] != "notFound" {
+		t.Errorf("expected notFound error, got %v", resp)
 	}
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+}
+
+func TestHandler_AccountExport_RequiresCapability(t *testing.T) {
+	setupTestDepsWithAccountExporter(&mockAccountExportDB{})
+
+	resp := firstMethodResponse(t, accountExportRequest(`{"using":["urn:ietf:params:jmap:core"],"methodCalls":[["Account/export",{},"c0"]]}`))
+
+	if resp[0] != "error" || resp[1].(map[string]any)["type"] != "unknownMethod" {
+		t.Errorf("expected unknownMethod error, got %v", resp)
 	}
+}
 
-	if !mockDB.lastIsIAMAuth {
-		t.Error("expected IsIAMAuth=true to be passed to DB for IAM auth request")
+func TestHandler_AccountExport_AccountMismatch_ReturnsError(t *testing.T) {
+	exportDB := &mockAccountExportDB{}
+	setupTestDepsWithAccountExporter(exportDB)
+
+	resp := firstMethodResponse(t, accountExportRequest(`{"using":["`+AccountExportCapability+`"],"methodCalls":[["Account/export",{"accountId":"someone-else"},"c0"]]}`))
+
+	if resp[0] != "error" || resp[1].(map[string]any)["type"] != "accountNotFound" {
+		t.Errorf("expected accountNotFound error, got %v", resp)
+	}
+	if exportDB.createdJob != nil {
+		t.Error("expected no job to be created")
 	}
 }
 
-func TestHandler_BlobAllocate_CognitoAuth_IsIAMAuthFalse(t *testing.T) {
-	mockStorage := &mockBlobAllocateStorage{}
-	mockDB := &mockBlobAllocateDB{}
-	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
-	ctx := context.Background()
+// mockPrincipalBindings implements PrincipalBindings for testing. A nil
+// allowed map is a principal with no bindings, which may act on any account.
+type mockPrincipalBindings struct {
+	allowed map[string]bool
+	err     error
+}
 
-	request := events.APIGatewayProxyRequest{
-		Path: "/jmap",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"application/pdf","size":1024}}},"a0"]]}`,
-		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
+func (m *mockPrincipalBindings) IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	if m.allowed == nil {
+		return true, nil
+	}
+	return m.allowed[accountID], nil
+}
+
+func TestHandler_IAMAuth_PrincipalBindings(t *testing.T) {
+	tests := []struct {
+		name       string
+		bindings   *mockPrincipalBindings
+		wantStatus int
+	}{
+		{name: "bound account", bindings: &mockPrincipalBindings{allowed: map[string]bool{"user-123": true}}, wantStatus: 200},
+		{name: "account outside bindings", bindings: &mockPrincipalBindings{allowed: map[string]bool{"user-999": true}}, wantStatus: 403},
+		{name: "binding lookup fails", bindings: &mockPrincipalBindings{err: errors.New("throttled")}, wantStatus: 500},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+			deps.Bindings = tc.bindings
+
+			request := events.APIGatewayProxyRequest{
+				Path: "/jmap-iam/user-123",
+				Body: `{"using":[],"methodCalls":[]}`,
+				PathParameters: map[string]string{
+					"accountId": "user-123",
 				},
-			},
-		},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID: "test-request-id",
+					Identity: events.APIGatewayRequestIdentity{
+						UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+					},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.wantStatus {
+				t.Errorf("expected status code %d, got %d. Body: %s", tc.wantStatus, response.StatusCode, response.Body)
+			}
+		})
 	}
+}
 
-	response, err := handler(ctx, request)
+func TestProcessMethodCall_PassesDelegationToken(t *testing.T) {
+	signer := delegation.NewSigner([]byte("test-key"), delegation.DefaultTTL)
+	var captured plugin.PluginInvocationRequest
+	setupTestDepsWithMethods(&mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			captured = request
+			return &plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{Name: request.Method, Args: map[string]any{}, ClientID: request.ClientID}}, nil
+		},
+	})
+	deps.Registry.AddPlugin(plugin.PluginRecord{
+		PluginID:         "mail",
+		Methods:          map[string]plugin.MethodTarget{"Email/import": {InvocationType: "lambda-invoke", InvokeTarget: "arn:email-import"}},
+		ClientPrincipals: []string{"arn:aws:iam::123456789012:role/MailPlugin"},
+	})
+	deps.Delegation = signer
+
+	call := []any{"Email/import", map[string]any{"accountId": "user-123"}, "c0"}
+	processMethodCall(context.Background(), "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
+
+	claims, err := signer.Verify(captured.DelegationToken)
 	if err != nil {
-		t.Fatalf("handler returned error: %v", err)
+		t.Fatalf("expected a valid delegation token, got %v", err)
 	}
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	if claims.AccountID != "user-123" || claims.RequestID != "req-123" || claims.Method != "Email/import" ||
+		len(claims.Principals) != 1 || claims.Principals[0] != "arn:aws:iam::123456789012:role/MailPlugin" {
+		t.Errorf("unexpected claims: %+v", claims)
 	}
+}
 
-	if mockDB.lastIsIAMAuth {
-		t.Error("expected IsIAMAuth=false for Cognito auth request")
+func TestHandler_IAMAuth_DelegationToken(t *testing.T) {
+	signer := delegation.NewSigner([]byte("test-key"), delegation.DefaultTTL)
+	pluginRoles := []string{"arn:aws:iam::123456789012:role/MailPlugin"}
+	token, _ := signer.Mint("user-123", "req-origin", "Email/import", pluginRoles)
+	otherToken, _ := signer.Mint("user-999", "req-origin", "Email/import", pluginRoles)
+	otherPluginToken, _ := signer.Mint("user-123", "req-origin", "Calendar/set", []string{"arn:aws:iam::123456789012:role/CalendarPlugin"})
+
+	tests := []struct {
+		name       string
+		token      string
+		bindings   *mockPrincipalBindings
+		wantStatus int
+	}{
+		{name: "token for the path account", token: token, wantStatus: 200},
+		{name: "token for another account", token: otherToken, wantStatus: 403},
+		{name: "token for another plugin", token: otherPluginToken, wantStatus: 403},
+		{name: "plugin bound to other accounts", token: token, bindings: &mockPrincipalBindings{allowed: map[string]bool{"user-999": true}}, wantStatus: 403},
+		{name: "forged token", token: token + "x", wantStatus: 403},
+		{name: "no token", wantStatus: 403},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The plugin's role is not a registered principal, so only the
+			// token can authorize it
+			setupTestDepsWithPrincipals([]string{"arn:aws:iam::123456789012:role/IngestRole"})
+			deps.Delegation = signer
+			if tc.bindings != nil {
+				deps.Bindings = tc.bindings
+			}
+
+			request := events.APIGatewayProxyRequest{
+				Path:    "/jmap-iam/user-123",
+				Body:    `{"using":[],"methodCalls":[]}`,
+				Headers: map[string]string{"X-JMAP-Delegation-Token": tc.token},
+				PathParameters: map[string]string{
+					"accountId": "user-123",
+				},
+				RequestContext: events.APIGatewayProxyRequestContext{
+					RequestID: "test-request-id",
+					Identity: events.APIGatewayRequestIdentity{
+						UserArn: "arn:aws:sts::123456789012:assumed-role/MailPlugin/session-1",
+					},
+				},
+			}
+
+			response, err := handler(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler returned error: %v", err)
+			}
+			if response.StatusCode != tc.wantStatus {
+				t.Errorf("expected status code %d, got %d. Body: %s", tc.wantStatus, response.StatusCode, response.Body)
+			}
+		})
 	}
 }
 
-func TestHandler_BlobAllocate_IAMAuth_SizePositive_NoSizeUnknown(t *testing.T) {
-	mockStorage := &mockBlobAllocateStorage{}
-	mockDB := &mockBlobAllocateDB{}
-	setupTestDepsWithBlobAllocator(mockStorage, mockDB, []string{"arn:aws:iam::123456789012:role/IngestRole"})
+func TestCORSHandler_PreflightAndResponseHeaders(t *testing.T) {
+	setupTestDeps()
+	deps.CORS = cors.New([]string{"https://app.example.com"}, "POST")
 	ctx := context.Background()
 
-	// IAM auth request with Blob/allocate, size>0
+	preflight, err := corsHandler(ctx, events.APIGatewayProxyRequest{
+		HTTPMethod: "OPTIONS",
+		Headers:    map[string]string{"Origin": "https://app.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if preflight.StatusCode != 204 || preflight.Headers["Access-Control-Allow-Methods"] != "POST,OPTIONS" {
+		t.Errorf("unexpected preflight response: %d %v", preflight.StatusCode, preflight.Headers)
+	}
+
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":5000}}},"a0"]]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
+		Body:    `{"using":[],"methodCalls":[]}`,
+		Headers: map[string]string{"origin": "https://app.example.com"},
 		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
-			},
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
 		},
 	}
-
-	response, err := handler(ctx, request)
+	response, err := corsHandler(ctx, request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
+	if response.Headers["Access-Control-Allow-Origin"] != "https://app.example.com" || response.Headers["Vary"] != "Origin" {
+		t.Errorf("expected CORS headers on the response, got %v", response.Headers)
+	}
+}
+
+func TestCORSHandler_CorrelationID(t *testing.T) {
+	var pluginCorrelationID string
+	setupTestDepsWithMethods(&mockInvoker{invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+		pluginCorrelationID = request.CorrelationID
+		return &plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{Name: request.Method, ClientID: request.ClientID}}, nil
+	}})
+	deps.CORS = cors.New([]string{"*"}, "POST")
 
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
-	}
-
-	// SizeUnknown should be false when size is provided
-	if mockDB.lastSizeUnknown {
-		t.Error("expected SizeUnknown=false when IAM auth with size>0")
-	}
-}
-
-func TestHandler_BlobAllocate_CognitoAuth_SizeZero_Rejected(t *testing.T) {
-	mockStorage := &mockBlobAllocateStorage{}
-	mockDB := &mockBlobAllocateDB{}
-	setupTestDepsWithBlobAllocator(mockStorage, mockDB, nil)
-	ctx := context.Background()
-
-	// Cognito auth request with Blob/allocate, size=0 — should be rejected
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","size":0}}},"a0"]]}`,
+		Body:    `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123"},"c0"]]}`,
+		Headers: map[string]string{"x-correlation-id": "client-trace-1"},
 		RequestContext: events.APIGatewayProxyRequestContext{
-			RequestID: "test-request-id",
-			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
-			},
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
 		},
 	}
-
-	response, err := handler(ctx, request)
+	response, err := corsHandler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	if response.Headers[correlation.Header] != "client-trace-1" {
+		t.Errorf("expected correlation ID echoed, got %v", response.Headers)
+	}
+	if pluginCorrelationID != "client-trace-1" {
+		t.Errorf("expected correlation ID on plugin request, got %q", pluginCorrelationID)
 	}
 
-	var jmapResp JMAPResponse
-	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
-		t.Fatalf("failed to unmarshal response: %v", err)
+	request.Headers = nil
+	response, err = corsHandler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if generated := response.Headers[correlation.Header]; generated == "" || generated != pluginCorrelationID {
+		t.Errorf("expected generated correlation ID echoed and sent to the plugin, got %q and %q", generated, pluginCorrelationID)
 	}
+}
 
-	// Should have notCreated with invalidArguments for size=0
-	respArgs, ok := jmapResp.MethodResponses[0][1].(map[string]any)
-	if !ok {
-		t.Fatal("expected response args to be a map")
+func TestCORSHandler_ProblemCarriesCorrelationID(t *testing.T) {
+	setupTestDeps()
+	deps.CORS = cors.New([]string{"*"}, "POST")
+
+	request := usageTestRequest()
+	request.Body = "{not json"
+	request.Headers = map[string]string{"X-Correlation-Id": "client-trace-1"}
+	response, err := corsHandler(context.Background(), request)
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
 	}
-	notCreated, ok := respArgs["notCreated"].(map[string]any)
-	if !ok || notCreated == nil {
-		t.Fatal("expected notCreated to be set for Cognito + size=0")
+	if response.Headers["Content-Type"] != problem.ContentType {
+		t.Errorf("expected a problem content type, got %q", response.Headers["Content-Type"])
 	}
-	c1Err, ok := notCreated["c1"].(map[string]any)
-	if !ok {
-		t.Fatal("expected c1 error in notCreated")
+	var body problem.Problem
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
 	}
-	if c1Err["type"] != "invalidArguments" {
-		t.Errorf("expected invalidArguments error, got %v", c1Err["type"])
+	want := problem.Problem{
+		Type:          "urn:ietf:params:jmap:error:notJSON",
+		Title:         "Not JSON",
+		Status:        400,
+		Detail:        "Invalid JSON in request body",
+		Code:          "CORE-2005",
+		CorrelationID: "client-trace-1",
+	}
+	if body != want {
+		t.Errorf("got %+v, want %+v", body, want)
 	}
 }
 
-// mockMultipartStorage implements bloballocate.MultipartStorage for testing
-type mockMultipartStorage struct {
-	createUploadID string
-}
+func TestProcessMethodCall_CorePing_ReturnsTimings(t *testing.T) {
+	setupTestDeps()
+	invoked := false
+	deps.Invoker = &mockInvoker{invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+		invoked = true
+		return &plugin.PluginInvocationResponse{}, nil
+	}}
 
-func (m *mockMultipartStorage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string) (string, error) {
-	return m.createUploadID, nil
-}
+	call := []any{"Core/ping", map[string]any{"accountId": "user-123"}, "c0"}
+	result := processMethodCall(context.Background(), "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
 
-func (m *mockMultipartStorage) GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
-	parts := make([]bloballocate.PartURL, partCount)
-	for i := 0; i < partCount; i++ {
-		parts[i] = bloballocate.PartURL{PartNumber: int32(i + 1), URL: "https://example.com/part"}
+	if result[0] != "Core/ping" {
+		t.Fatalf("expected Core/ping response, got %v", result)
+	}
+	args := result[1].(map[string]any)
+	timings := args["timings"].(map[string]any)
+	for _, key := range []string{"registryLookupMs", "dynamodbReadMs"} {
+		if _, ok := timings[key]; !ok {
+			t.Errorf("expected %s timing, got %v", key, timings)
+		}
+	}
+	if _, ok := timings["pluginInvokeMs"]; ok || invoked {
+		t.Error("expected no plugin invocation without invoke")
+	}
+	if _, ok := args["totalMs"].(float64); !ok {
+		t.Errorf("expected totalMs, got %v", args["totalMs"])
 	}
-	return parts, time.Now().Add(15 * time.Minute), nil
 }
 
-// mockBlobCompleteStorage implements blobcomplete.Storage for testing
-type mockBlobCompleteStorage struct{}
+func TestProcessMethodCall_CorePing_InvokesEcho(t *testing.T) {
+	setupTestDeps()
+	deps.Registry.AddMethod("Core/echo", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:core-echo",
+	})
+	var invokedMethod string
+	deps.Invoker = &mockInvoker{invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+		invokedMethod = request.Method
+		return &plugin.PluginInvocationResponse{}, nil
+	}}
 
-func (m *mockBlobCompleteStorage) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
-	return nil
-}
+	call := []any{"Core/ping", map[string]any{"invoke": true}, "c0"}
+	result := processMethodCall(context.Background(), "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
 
-// mockBlobCompleteDB implements blobcomplete.DB for testing
-type mockBlobCompleteDB struct {
-	record *blobcomplete.BlobRecord
+	if result[0] != "Core/ping" {
+		t.Fatalf("expected Core/ping response, got %v", result)
+	}
+	if invokedMethod != "Core/echo" {
+		t.Errorf("expected Core/echo to be invoked, got %q", invokedMethod)
+	}
+	timings := result[1].(map[string]any)["timings"].(map[string]any)
+	if _, ok := timings["pluginInvokeMs"]; !ok {
+		t.Errorf("expected pluginInvokeMs timing, got %v", timings)
+	}
 }
 
-func (m *mockBlobCompleteDB) GetBlobForComplete(ctx context.Context, accountID, blobID string) (*blobcomplete.BlobRecord, error) {
-	return m.record, nil
+func TestProcessMethodCall_CorePing_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     map[string]any
+		setup    func()
+		wantType string
+	}{
+		{"invalid invoke", map[string]any{"invoke": "yes"}, func() {}, "invalidArguments"},
+		{"account mismatch", map[string]any{"accountId": "other"}, func() {}, "accountNotFound"},
+		{"echo not registered", map[string]any{"invoke": true}, func() {}, "serverFail"},
+		{"account read fails", map[string]any{}, func() {
+			deps.Accounts = &mockAccountReader{err: errors.New("throttled")}
+		}, "serverFail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDeps()
+			tt.setup()
+
+			call := []any{"Core/ping", tt.args, "c0"}
+			result := processMethodCall(context.Background(), "user-123", call, 0, "req-123", nil, nil, "", "", false, account.Features{})
+
+			if result[0] != "error" {
+				t.Fatalf("expected error response, got %v", result)
+			}
+			if errType := result[1].(map[string]any)["type"]; errType != tt.wantType {
+				t.Errorf("expected %s error, got %v", tt.wantType, errType)
+			}
+		})
+	}
 }
 
-func setupTestDepsWithMultipart(principals []string) {
-	tp := noop.NewTracerProvider()
-	otel.SetTracerProvider(tp)
+func TestHandler_SampledRequest_LogsRedactedCalls(t *testing.T) {
+	setupTestDeps()
+	var buf bytes.Buffer
+	origLogger := logger
+	logger = loglevel.NewWithOutput(&buf)
+	t.Cleanup(func() { logger = origLogger })
 
-	registry := plugin.NewRegistryWithPrincipals(principals)
-	registry.AddCapability("https://jmap.rrod.net/extensions/upload-put")
+	request := usageTestRequest()
+	request.Body = `{"using":[],"methodCalls":[["Email/query",{"filter":{"from":"alice@example.com"}},"c0"]]}`
 
-	deps = &Dependencies{
-		Registry: registry,
-		Invoker:  &mockInvoker{},
-		BlobAllocator: &bloballocate.Handler{
-			Storage:            &mockBlobAllocateStorage{},
-			MultipartStorage:   &mockMultipartStorage{createUploadID: "upload-test"},
-			DB:                 &mockBlobAllocateDB{},
-			UUIDGen:            &RealUUIDGenerator{},
-			MaxSizeUploadPut:   250000000,
-			MaxPendingAllocs:   4,
-			URLExpirySecs:      900,
-			MultipartPartCount: 3,
-		},
-		BlobCompleter: &blobcomplete.Handler{
-			Storage: &mockBlobCompleteStorage{},
-			DB: &mockBlobCompleteDB{
-				record: &blobcomplete.BlobRecord{
-					Status:    "pending",
-					Multipart: true,
-					UploadID:  "upload-test",
+	deps.SamplePercent = 0
+	if _, err := handler(context.Background(), request); err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	if strings.Contains(buf.String(), "Sampled method call") {
+		t.Fatal("expected no sampling at 0 percent")
+	}
+
+	deps.SamplePercent = 100
+	if _, err := handler(context.Background(), request); err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
+	logs := buf.String()
+	if !strings.Contains(logs, "Sampled method call") || !strings.Contains(logs, `"from":"[email]"`) {
+		t.Errorf("expected sampled, redacted call in logs, got %s", logs)
+	}
+	if strings.Contains(logs, "alice@example.com") {
+		t.Error("expected email address to be redacted")
+	}
+}
+
+// largeGetInvoker answers Email/get with a response of over 2KB and other
+// methods with a small one
+func largeGetInvoker() *mockInvoker {
+	return &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			args := map[string]any{"accountId": request.AccountID}
+			if request.Method == "Email/get" {
+				args["list"] = []any{strings.Repeat("x", 2048)}
+			}
+			return &plugin.PluginInvocationResponse{
+				MethodResponse: plugin.MethodResponse{
+					Name:     request.Method,
+					Args:     args,
+					ClientID: request.ClientID,
 				},
-			},
+			}, nil
 		},
-		DispatcherPoolSize: DefaultDispatcherPoolSize,
 	}
 }
 
-func TestHandler_BlobAllocate_Multipart_IAM_ReturnsPartsNotURL(t *testing.T) {
-	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+func TestHandler_ResponseTooLarge_ReplacesOverflowingCall(t *testing.T) {
+	setupTestDepsWithMethods(largeGetInvoker())
+	deps.MaxResponseSize = 1024
 
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","multipart":true}}},"a0"]]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
+		Body: `{"using":[],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"],["Email/get",{"accountId":"user-123"},"c1"],["Email/query",{"accountId":"user-123"},"c2"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			Authorizer: map[string]any{
+				"claims": map[string]any{"sub": "user-123"},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
 	if response.StatusCode != 200 {
 		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
 	}
-
+	if len(response.Body) > 1024 {
+		t.Errorf("expected the body to fit in 1024 bytes, got %d", len(response.Body))
+	}
 	var jmapResp JMAPResponse
 	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
-		t.Fatalf("failed to unmarshal response: %v", err)
+		t.Fatalf("failed to parse response: %v", err)
 	}
-
-	if jmapResp.MethodResponses[0][0] != "Blob/allocate" {
-		t.Fatalf("expected Blob/allocate, got %v", jmapResp.MethodResponses[0][0])
-	}
-
-	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
-	created := respArgs["created"].(map[string]any)
-	c1 := created["c1"].(map[string]any)
-
-	// Should have parts, not url
-	parts, hasParts := c1["parts"]
-	_, hasURL := c1["url"]
-	if !hasParts {
-		t.Fatal("expected 'parts' in multipart response")
+	if len(jmapResp.MethodResponses) != 3 {
+		t.Fatalf("expected 3 method responses, got %d", len(jmapResp.MethodResponses))
 	}
-	if hasURL {
-		t.Error("expected no 'url' in multipart response")
+	if jmapResp.MethodResponses[0][0] != "Email/query" || jmapResp.MethodResponses[2][0] != "Email/query" {
+		t.Errorf("expected the other calls to be answered, got %v", jmapResp.MethodResponses)
 	}
-
-	partsArr, ok := parts.([]any)
-	if !ok {
-		t.Fatalf("expected parts to be array, got %T", parts)
+	replaced := jmapResp.MethodResponses[1]
+	if replaced[0] != "error" || replaced[2] != "c1" {
+		t.Fatalf("expected an error for c1, got %v", replaced)
 	}
-	if len(partsArr) != 3 {
-		t.Errorf("expected 3 parts, got %d", len(partsArr))
+	errArgs := replaced[1].(map[string]any)
+	if errArgs["type"] != "requestTooLarge" || errArgs["code"] != "CORE-1006" || errArgs["maxSize"] != float64(1024) {
+		t.Errorf("unexpected error %v", errArgs)
 	}
 }
 
-func TestHandler_BlobAllocate_Multipart_Cognito_Rejected(t *testing.T) {
-	setupTestDepsWithMultipart(nil)
-	ctx := context.Background()
+func TestHandler_ResponseTooLarge_ReturnsProblemWhenErrorDoesNotFit(t *testing.T) {
+	setupTestDepsWithMethods(largeGetInvoker())
+	deps.MaxResponseSize = 64
 
-	// Cognito auth request with multipart=true — should be rejected
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/allocate",{"accountId":"user-123","create":{"c1":{"type":"message/rfc822","multipart":true}}},"a0"]]}`,
+		Body: `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123"},"c0"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
 			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
+				"claims": map[string]any{"sub": "user-123"},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	if response.StatusCode != 500 {
+		t.Fatalf("expected status code 500, got %d. Body: %s", response.StatusCode, response.Body)
+	}
+	var body map[string]any
+	if err := json.Unmarshal([]byte(response.Body), &body); err != nil {
+		t.Fatalf("failed to parse body: %v", err)
+	}
+	if body["code"] != "CORE-1006" || body["limit"] != "maxSizeResponse" || body["maxSize"] != float64(64) {
+		t.Errorf("unexpected problem %v", body)
 	}
+}
+
+// testSessionState is the session state of an unprovisioned account with
+// the test registry
+func testSessionState() string {
+	return sessionstate.Compute(deps.Registry.Fingerprint(), sessionstate.Account{})
+}
+
+func TestHandler_SessionState_MatchesSession(t *testing.T) {
+	setupTestDeps()
+	deps.Accounts = &mockAccountReader{meta: &account.Meta{AccountType: "basic", WritesDisabled: true}}
 
+	response, err := handler(context.Background(), strictTestRequest())
+	if err != nil {
+		t.Fatalf("handler returned error: %v", err)
+	}
 	var jmapResp JMAPResponse
 	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
 		t.Fatalf("failed to unmarshal response: %v", err)
 	}
-
-	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
-	notCreated, ok := respArgs["notCreated"].(map[string]any)
-	if !ok || notCreated == nil {
-		t.Fatal("expected notCreated for Cognito multipart request")
-	}
-	c1Err := notCreated["c1"].(map[string]any)
-	if c1Err["type"] != "invalidArguments" {
-		t.Errorf("expected invalidArguments, got %v", c1Err["type"])
+	want := sessionstate.Compute(deps.Registry.Fingerprint(), sessionstate.Account{AccountType: "basic", WritesDisabled: true})
+	if jmapResp.SessionState != want {
+		t.Errorf("expected sessionState %q, got %q", want, jmapResp.SessionState)
 	}
 }
 
-func TestHandler_BlobComplete_Success(t *testing.T) {
-	setupTestDepsWithMultipart([]string{"arn:aws:iam::123456789012:role/IngestRole"})
-	ctx := context.Background()
+func TestHandler_ResponseWithinLimit_Succeeds(t *testing.T) {
+	setupTestDepsWithMethods(&mockInvoker{})
+	deps.MaxResponseSize = 1024
 
 	request := events.APIGatewayProxyRequest{
-		Path: "/jmap-iam/user-123",
-		Body: `{"using":["https://jmap.rrod.net/extensions/upload-put"],"methodCalls":[["Blob/complete",{"accountId":"user-123","id":"blob-1","parts":[{"partNumber":1,"etag":"\"abc\""},{"partNumber":2,"etag":"\"def\""}]},"c0"]]}`,
-		PathParameters: map[string]string{
-			"accountId": "user-123",
-		},
+		Body: `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123"},"c0"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
-			Identity: events.APIGatewayRequestIdentity{
-				UserArn: "arn:aws:iam::123456789012:role/IngestRole",
+			Authorizer: map[string]any{
+				"claims": map[string]any{"sub": "user-123"},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
+	want := `{"methodResponses":[["Email/get",{"accountId":"user-123"},"c0"]],"sessionState":"` + testSessionState() + `"}`
+	if response.StatusCode != 200 || response.Body != want {
+		t.Errorf("expected 200 with %s, got %d: %s", want, response.StatusCode, response.Body)
 	}
+}
 
-	var jmapResp JMAPResponse
-	if err := json.Unmarshal([]byte(response.Body), &jmapResp); err != nil {
-		t.Fatalf("failed to unmarshal response: %v", err)
-	}
+// mockLatencyStore records the plugin latency statistics flushed to it
+type mockLatencyStore struct {
+	stats []pluginlatency.Stats
+}
 
-	if len(jmapResp.MethodResponses) != 1 {
-		t.Fatalf("expected 1 method response, got %d", len(jmapResp.MethodResponses))
+func (m *mockLatencyStore) Put(ctx context.Context, stats pluginlatency.Stats) error {
+	m.stats = append(m.stats, stats)
+	return nil
+}
+
+func TestCORSHandler_FlushesPluginLatency(t *testing.T) {
+	setupTestDepsWithMethods(&mockInvoker{})
+	deps.CORS = cors.New([]string{"*"}, "POST")
+	tracker := pluginlatency.NewTracker(deps.Invoker, 0)
+	deps.Invoker = tracker
+	store := &mockLatencyStore{}
+	deps.PluginLatency = &pluginlatency.Flusher{Tracker: tracker, Store: store, Instance: "instance-1"}
+
+	request := events.APIGatewayProxyRequest{
+		Body: `{"using":[],"methodCalls":[["Email/get",{"accountId":"user-123"},"c0"]]}`,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
 	}
-	if jmapResp.MethodResponses[0][0] != "Blob/complete" {
-		t.Errorf("expected Blob/complete response, got %v", jmapResp.MethodResponses[0][0])
+	if _, err := corsHandler(context.Background(), request); err != nil {
+		t.Fatalf("handler returned error: %v", err)
 	}
 
-	respArgs := jmapResp.MethodResponses[0][1].(map[string]any)
-	if respArgs["accountId"] != "user-123" {
-		t.Errorf("expected accountId 'user-123', got %v", respArgs["accountId"])
+	if len(store.stats) != 1 {
+		t.Fatalf("expected latency for one target, got %+v", store.stats)
 	}
-	if respArgs["id"] != "blob-1" {
-		t.Errorf("expected id 'blob-1', got %v", respArgs["id"])
+	if store.stats[0].Target != "arn:aws:lambda:us-east-1:123456789012:function:email-get" || store.stats[0].Calls != 1 || store.stats[0].Instance != "instance-1" {
+		t.Errorf("unexpected latency %+v", store.stats[0])
 	}
 }
 
-func TestHandler_BlobComplete_MissingCapability(t *testing.T) {
-	// Use setupTestDeps which has no upload-put capability
-	setupTestDeps()
-	deps.BlobCompleter = &blobcomplete.Handler{
-		Storage: &mockBlobCompleteStorage{},
-		DB:      &mockBlobCompleteDB{},
+func TestHandler_AsyncMethod_AnsweredWithoutPluginResponse(t *testing.T) {
+	var invokedTarget plugin.MethodTarget
+	invoker := &mockInvoker{
+		invokeFunc: func(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+			invokedTarget = target
+			return &plugin.PluginInvocationResponse{}, nil
+		},
 	}
-	ctx := context.Background()
+	setupTestDepsWithMethods(invoker)
+	deps.Registry.AddMethod("Email/markSeen", plugin.MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:us-east-1:123456789012:function:email-mark-seen",
+		Async:          true,
+	})
 
 	request := events.APIGatewayProxyRequest{
-		Body: `{"using":[],"methodCalls":[["Blob/complete",{"accountId":"user-123","id":"blob-1","parts":[{"partNumber":1,"etag":"e1"}]},"c0"]]}`,
+		Body: `{"using":[],"methodCalls":[["Email/markSeen",{"accountId":"user-123","ids":["e1"]},"c0"]]}`,
 		RequestContext: events.APIGatewayProxyRequestContext{
 			RequestID: "test-request-id",
 			Authorizer: map[string]any{
-				"claims": map[string]any{
-					"sub": "user-123",
-				},
+				"claims": map[string]any{"sub": "user-123"},
 			},
 		},
 	}
 
-	response, err := handler(ctx, request)
+	response, err := handler(context.Background(), request)
 	if err != nil {
 		t.Fatalf("handler returned error: %v", err)
 	}
-	if response.StatusCode != 200 {
-		t.Fatalf("expected status code 200, got %d. Body: %s", response.StatusCode, response.Body)
-	}
-
-	var jmapResp JMAPResponse
-	json.Unmarshal([]byte(response.Body), &jmapResp)
-
-	if jmapResp.MethodResponses[0][0] != "error" {
-		t.Errorf("expected error response, got %v", jmapResp.MethodResponses[0][0])
+	if !invokedTarget.Async {
+		t.Errorf("expected the async target to be invoked, got %+v", invokedTarget)
 	}
-	errArgs := jmapResp.MethodResponses[0][1].(map[string]any)
-	if errArgs["type"] != "unknownMethod" {
-		t.Errorf("expected unknownMethod error, got %v", errArgs["type"])
+	want := `{"methodResponses":[["Email/markSeen",{"accepted":true,"accountId":"user-123"},"c0"]],"sessionState":"` + testSessionState() + `"}`
+	if response.StatusCode != 200 || response.Body != want {
+		t.Errorf("expected 200 with %s, got %d: %s", want, response.StatusCode, response.Body)
 	}
 }
@@ -0,0 +1,574 @@
+// Command jmapctl exercises a deployed JMAP service from the command line, for
+// operators and plugin developers. It fetches the session, sends method
+// calls, uploads and downloads blobs, and backfills existing S3 objects as
+// blobs, authenticating either with a
+// Cognito token (-token) or with SigV4 using the default AWS credentials
+// (-iam), and pretty-prints the responses.
+//
+//	jmapctl -url https://jmap.example.com -token "$(make get-token)" session
+//	jmapctl -url https://jmap.example.com -iam -account user-123 call \
+//	    Email/query '{"filter":{}}' \
+//	    Email/get '{"#ids":"c0/ids","properties":["subject"]}'
+//
+// Method arguments are JSON. A property whose name starts with "#" and whose
+// value is a string "callId/path" is expanded into a result reference to that
+// earlier call, so "#ids":"c0/ids" becomes
+// {"resultOf":"c0","name":"Email/query","path":"/ids"}. Arguments without an
+// accountId get the -account value.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobbackfill"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/resultref"
+)
+
+// coreCapability is used by every request
+const coreCapability = "urn:ietf:params:jmap:core"
+
+// usage describes the commands
+const usage = `Usage: jmapctl [flags] <command> [arguments]
+
+Commands:
+  session                          Fetch the JMAP session (Cognito only)
+  call [-using urn,...] Method '{args}' [Method '{args}' ...]
+                                   Send method calls in one request
+  upload [-type type] [-parent tag] FILE
+                                   Upload a blob ("-" reads stdin)
+  download [-o FILE] BLOBID        Download a blob (default stdout)
+  backfill [-batch n] MANIFEST     Register existing S3 objects as blobs (-iam,
+                                   admin only). MANIFEST has a JSON object per
+                                   line: {"bucket":..,"key":..,"contentType":..}
+                                   ("-" reads stdin)
+
+Flags:
+`
+
+// HTTPDoer sends HTTP requests
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// RequestSigner signs requests to the IAM-authenticated API
+type RequestSigner interface {
+	Sign(ctx context.Context, req *http.Request, body []byte) error
+}
+
+// Config holds the global flags
+type Config struct {
+	APIURL        string
+	Token         string
+	IAM           bool
+	AccountID     string
+	CorrelationID string
+	Raw           bool
+}
+
+// Dependencies for commands (injectable for testing)
+type Dependencies struct {
+	HTTPClient HTTPDoer
+	Signer     RequestSigner
+	Config     Config
+	Stdin      io.Reader
+	Stdout     io.Writer
+}
+
+var deps *Dependencies
+
+// Invocation is one method call of a JMAP request
+type Invocation struct {
+	Name   string
+	Args   map[string]any
+	CallID string
+}
+
+// MarshalJSON encodes the invocation as the [name, args, callId] triple
+func (i Invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]any{i.Name, i.Args, i.CallID})
+}
+
+// Request is a JMAP request
+type Request struct {
+	Using       []string     `json:"using"`
+	MethodCalls []Invocation `json:"methodCalls"`
+}
+
+// sessionResponse is the part of the session jmapctl reads
+type sessionResponse struct {
+	PrimaryAccounts map[string]string `json:"primaryAccounts"`
+}
+
+// buildRequest builds a JMAP request from alternating method names and JSON
+// arguments, giving calls the IDs c0, c1, ... and expanding "#" properties
+// into result references
+func buildRequest(using []string, accountID string, args []string) (*Request, error) {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return nil, errors.New("expected one or more Method '{args}' pairs")
+	}
+
+	request := &Request{Using: using}
+	names := make(map[string]string)
+	for i := 0; i < len(args); i += 2 {
+		name, raw := args[i], args[i+1]
+		var methodArgs map[string]any
+		if err := json.Unmarshal([]byte(raw), &methodArgs); err != nil {
+			return nil, fmt.Errorf("invalid arguments for %s: %w", name, err)
+		}
+		if methodArgs == nil {
+			methodArgs = make(map[string]any)
+		}
+		if _, ok := methodArgs["accountId"]; !ok && accountID != "" {
+			methodArgs["accountId"] = accountID
+		}
+		for key, value := range methodArgs {
+			reference, ok := value.(string)
+			if !strings.HasPrefix(key, "#") || !ok {
+				continue
+			}
+			ref, err := parseReference(reference, names)
+			if err != nil {
+				return nil, fmt.Errorf("invalid reference %s in %s: %w", key, name, err)
+			}
+			methodArgs[key] = ref
+		}
+
+		callID := fmt.Sprintf("c%d", i/2)
+		names[callID] = name
+		request.MethodCalls = append(request.MethodCalls, Invocation{Name: name, Args: methodArgs, CallID: callID})
+	}
+	return request, nil
+}
+
+// parseReference parses "callId/path" into a result reference to an earlier
+// call in names
+func parseReference(reference string, names map[string]string) (resultref.ResultReference, error) {
+	callID, path, _ := strings.Cut(reference, "/")
+	name, ok := names[callID]
+	if !ok {
+		return resultref.ResultReference{}, fmt.Errorf("no earlier call %q", callID)
+	}
+	return resultref.ResultReference{ResultOf: callID, Name: name, Path: "/" + path}, nil
+}
+
+// endpoint returns the URL of a route, using the -iam variant of the path
+// when authenticating with SigV4
+func endpoint(route string, iamRoute string) string {
+	if deps.Config.IAM {
+		route = iamRoute
+	}
+	return strings.TrimSuffix(deps.Config.APIURL, "/") + route
+}
+
+// send sends an authenticated request and returns the response body. Non-2xx
+// responses are returned with an error that includes the body.
+func send(ctx context.Context, method, target, contentType string, body []byte, headers map[string]string) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if deps.Config.CorrelationID != "" {
+		req.Header.Set(correlation.Header, deps.Config.CorrelationID)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if deps.Config.IAM {
+		if err := deps.Signer.Sign(ctx, req, body); err != nil {
+			return nil, nil, fmt.Errorf("failed to sign request: %w", err)
+		}
+	} else {
+		req.Header.Set("Authorization", "Bearer "+deps.Config.Token)
+	}
+
+	resp, err := deps.HTTPClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp, respBody, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(respBody))
+	}
+	return resp, respBody, nil
+}
+
+// printJSON writes a JSON response, indented unless -raw is set
+func printJSON(body []byte) error {
+	if !deps.Config.Raw {
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, body, "", "  "); err == nil {
+			body = indented.Bytes()
+		}
+	}
+	_, err := fmt.Fprintf(deps.Stdout, "%s\n", bytes.TrimSpace(body))
+	return err
+}
+
+// fetchSession returns the session document
+func fetchSession(ctx context.Context) ([]byte, error) {
+	if deps.Config.IAM {
+		return nil, errors.New("the session endpoint only accepts Cognito tokens; use -token")
+	}
+	_, body, err := send(ctx, http.MethodGet, endpoint("/.well-known/jmap", ""), "", nil, nil)
+	return body, err
+}
+
+// accountID returns -account, or the session's primary account when using a
+// Cognito token
+func accountID(ctx context.Context) (string, error) {
+	if deps.Config.AccountID != "" || deps.Config.IAM {
+		if deps.Config.AccountID == "" {
+			return "", errors.New("-account is required with -iam")
+		}
+		return deps.Config.AccountID, nil
+	}
+	body, err := fetchSession(ctx)
+	if err != nil {
+		return "", err
+	}
+	var session sessionResponse
+	if err := json.Unmarshal(body, &session); err != nil {
+		return "", fmt.Errorf("invalid session: %w", err)
+	}
+	if session.PrimaryAccounts[coreCapability] == "" {
+		return "", errors.New("session has no primary account")
+	}
+	return session.PrimaryAccounts[coreCapability], nil
+}
+
+// runSession prints the session
+func runSession(ctx context.Context, args []string) error {
+	if len(args) != 0 {
+		return errors.New("session takes no arguments")
+	}
+	body, err := fetchSession(ctx)
+	if err != nil {
+		return err
+	}
+	return printJSON(body)
+}
+
+// runCall sends method calls and prints the response
+func runCall(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("call", flag.ContinueOnError)
+	using := flags.String("using", "", "comma-separated capabilities in addition to "+coreCapability)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	capabilities := []string{coreCapability}
+	for capability := range strings.SplitSeq(*using, ",") {
+		if capability = strings.TrimSpace(capability); capability != "" && capability != coreCapability {
+			capabilities = append(capabilities, capability)
+		}
+	}
+	if deps.Config.IAM && deps.Config.AccountID == "" {
+		return errors.New("-account is required with -iam")
+	}
+
+	request, err := buildRequest(capabilities, deps.Config.AccountID, flags.Args())
+	if err != nil {
+		return err
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	_, respBody, err := send(ctx, http.MethodPost, endpoint("/jmap", "/jmap-iam/"+url.PathEscape(deps.Config.AccountID)), "application/json", body, nil)
+	if err != nil {
+		return err
+	}
+	return printJSON(respBody)
+}
+
+// runUpload uploads a file and prints the upload response
+func runUpload(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ContinueOnError)
+	contentType := flags.String("type", "application/octet-stream", "blob media type")
+	parent := flags.String("parent", "", "X-Parent tag for the blob")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("upload takes one FILE")
+	}
+
+	var body []byte
+	var err error
+	if flags.Arg(0) == "-" {
+		body, err = io.ReadAll(deps.Stdin)
+	} else {
+		body, err = os.ReadFile(flags.Arg(0))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read blob: %w", err)
+	}
+
+	account, err := accountID(ctx)
+	if err != nil {
+		return err
+	}
+	var headers map[string]string
+	if *parent != "" {
+		headers = map[string]string{"X-Parent": *parent}
+	}
+	path := url.PathEscape(account)
+	_, respBody, err := send(ctx, http.MethodPost, endpoint("/upload/"+path, "/upload-iam/"+path), *contentType, body, headers)
+	if err != nil {
+		return err
+	}
+	return printJSON(respBody)
+}
+
+// runDownload downloads a blob to a file or stdout. The download route
+// redirects to a signed CloudFront URL, which the HTTP client follows without
+// the request's credentials.
+func runDownload(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("download", flag.ContinueOnError)
+	output := flags.String("o", "", "file to write the blob to (default stdout)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("download takes one BLOBID")
+	}
+
+	account, err := accountID(ctx)
+	if err != nil {
+		return err
+	}
+	path := url.PathEscape(account) + "/" + url.PathEscape(flags.Arg(0))
+	_, body, err := send(ctx, http.MethodGet, endpoint("/download/"+path, "/download-iam/"+path), "", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = deps.Stdout.Write(body)
+		return err
+	}
+	return os.WriteFile(*output, body, 0o600)
+}
+
+// maxBackfillBatch is the most objects account-admin backfills per request
+const maxBackfillBatch = 10
+
+// readManifest reads a backfill manifest of one JSON object per line,
+// skipping blank lines
+func readManifest(r io.Reader) ([]blobbackfill.Object, error) {
+	var objects []blobbackfill.Object
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var object blobbackfill.Object
+		if err := json.Unmarshal([]byte(text), &object); err != nil {
+			return nil, fmt.Errorf("invalid manifest line %d: %w", line, err)
+		}
+		if object.Bucket == "" || object.Key == "" {
+			return nil, fmt.Errorf("invalid manifest line %d: bucket and key are required", line)
+		}
+		objects = append(objects, object)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+	return objects, nil
+}
+
+// runBackfill registers the objects in a manifest as blobs of -account, a
+// batch per request, printing each batch's results. Objects a batch deferred
+// are sent again at the front of the next. Objects already registered are
+// reported as existing, so a manifest that stopped part way can be run again.
+func runBackfill(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	batch := flags.Int("batch", maxBackfillBatch, "objects per request")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("backfill takes one MANIFEST")
+	}
+	if *batch < 1 || *batch > maxBackfillBatch {
+		return fmt.Errorf("-batch must be between 1 and %d", maxBackfillBatch)
+	}
+	if !deps.Config.IAM || deps.Config.AccountID == "" {
+		return errors.New("backfill requires -iam and -account")
+	}
+
+	var manifest io.Reader = deps.Stdin
+	if flags.Arg(0) != "-" {
+		file, err := os.Open(flags.Arg(0))
+		if err != nil {
+			return fmt.Errorf("failed to read manifest: %w", err)
+		}
+		defer file.Close()
+		manifest = file
+	}
+	objects, err := readManifest(manifest)
+	if err != nil {
+		return err
+	}
+
+	target := endpoint("", "/admin-iam/accounts/"+url.PathEscape(deps.Config.AccountID)+"/backfill")
+	for request := 1; len(objects) > 0; request++ {
+		n := min(*batch, len(objects))
+		body, err := json.Marshal(map[string]any{"objects": objects[:n]})
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		_, respBody, err := send(ctx, http.MethodPost, target, "application/json", body, nil)
+		if err != nil {
+			return fmt.Errorf("batch %d: %w", request, err)
+		}
+		if err := printJSON(respBody); err != nil {
+			return err
+		}
+
+		var response struct {
+			Results []blobbackfill.Result `json:"results"`
+		}
+		if err := json.Unmarshal(respBody, &response); err != nil {
+			return fmt.Errorf("batch %d: failed to decode response: %w", request, err)
+		}
+		var deferred []blobbackfill.Object
+		for i, result := range response.Results {
+			if i < n && result.Error != nil && result.Error.Type == "deferred" {
+				deferred = append(deferred, objects[i])
+			}
+		}
+		objects = append(deferred, objects[n:]...)
+	}
+	return nil
+}
+
+// commands maps command names to their implementations
+var commands = map[string]func(ctx context.Context, args []string) error{
+	"session":  runSession,
+	"call":     runCall,
+	"upload":   runUpload,
+	"download": runDownload,
+	"backfill": runBackfill,
+}
+
+// run dispatches a command
+func run(ctx context.Context, args []string) error {
+	if len(args) == 0 {
+		return errors.New("no command given")
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if deps.Config.APIURL == "" {
+		return errors.New("-url or JMAP_URL is required")
+	}
+	if !deps.Config.IAM && deps.Config.Token == "" {
+		return errors.New("-token or JMAP_TOKEN is required unless -iam is set")
+	}
+	return command(ctx, args[1:])
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// SigV4Signer signs requests for execute-api with the caller's credentials
+type SigV4Signer struct {
+	signer      *v4.Signer
+	credentials aws.CredentialsProvider
+	region      string
+}
+
+// NewSigV4Signer creates a new SigV4Signer
+func NewSigV4Signer(cfg aws.Config) *SigV4Signer {
+	return &SigV4Signer{
+		signer:      v4.NewSigner(),
+		credentials: cfg.Credentials,
+		region:      cfg.Region,
+	}
+}
+
+// Sign signs the request in place
+func (s *SigV4Signer) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	return s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "execute-api", s.region, time.Now())
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("jmapctl", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), usage)
+		flags.PrintDefaults()
+	}
+	flags.StringVar(&cfg.APIURL, "url", os.Getenv("JMAP_URL"), "API base URL, such as https://jmap.example.com (env JMAP_URL)")
+	flags.StringVar(&cfg.Token, "token", os.Getenv("JMAP_TOKEN"), "Cognito ID token (env JMAP_TOKEN)")
+	flags.BoolVar(&cfg.IAM, "iam", false, "sign requests with SigV4 using the default AWS credentials")
+	flags.StringVar(&cfg.AccountID, "account", os.Getenv("JMAP_ACCOUNT_ID"), "account ID; required with -iam (env JMAP_ACCOUNT_ID)")
+	flags.StringVar(&cfg.CorrelationID, "correlation-id", "", "X-Correlation-Id to send")
+	flags.BoolVar(&cfg.Raw, "raw", false, "print JSON responses without indenting")
+	region := flags.String("region", "", "AWS region for -iam (default from the AWS config)")
+	_ = flags.Parse(os.Args[1:])
+
+	deps = &Dependencies{
+		HTTPClient: &http.Client{Timeout: 60 * time.Second},
+		Config:     cfg,
+		Stdin:      os.Stdin,
+		Stdout:     os.Stdout,
+	}
+	if cfg.IAM {
+		var options []func(*config.LoadOptions) error
+		if *region != "" {
+			options = append(options, config.WithRegion(*region))
+		}
+		awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "jmapctl: failed to load AWS config: %v\n", err)
+			os.Exit(1)
+		}
+		deps.Signer = NewSigV4Signer(awsConfig)
+	}
+
+	if err := run(ctx, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "jmapctl: %v\n", err)
+		if flags.NArg() == 0 {
+			flags.Usage()
+		}
+		os.Exit(1)
+	}
+}
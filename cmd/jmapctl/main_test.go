@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mockHTTPClient returns canned responses in order and records the requests
+type mockHTTPClient struct {
+	statusCode int
+	bodies     []string
+	err        error
+	requests   []*http.Request
+	sent       [][]byte
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.requests = append(m.requests, req)
+	var sent []byte
+	if req.Body != nil {
+		sent, _ = io.ReadAll(req.Body)
+	}
+	m.sent = append(m.sent, sent)
+	if m.err != nil {
+		return nil, m.err
+	}
+	body := m.bodies[0]
+	if len(m.bodies) > 1 {
+		m.bodies = m.bodies[1:]
+	}
+	statusCode := m.statusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	return &http.Response{
+		StatusCode: statusCode,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+type mockSigner struct {
+	signed bool
+	err    error
+}
+
+func (m *mockSigner) Sign(ctx context.Context, req *http.Request, body []byte) error {
+	m.signed = true
+	return m.err
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(client *mockHTTPClient, signer *mockSigner, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	if cfg.APIURL == "" {
+		cfg.APIURL = "https://jmap.example.com/"
+	}
+	deps = &Dependencies{
+		HTTPClient: client,
+		Signer:     signer,
+		Config:     cfg,
+		Stdin:      strings.NewReader("from stdin"),
+		Stdout:     &stdout,
+	}
+	return &stdout
+}
+
+func TestBuildRequest_ExpandsResultReferences(t *testing.T) {
+	request, err := buildRequest([]string{coreCapability}, "user-123", []string{
+		"Email/query", `{"filter":{}}`,
+		"Email/get", `{"#ids":"c0/ids","properties":["subject"],"accountId":"other"}`,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	encoded, _ := json.Marshal(request)
+	var decoded struct {
+		MethodCalls [][]json.RawMessage `json:"methodCalls"`
+	}
+	if err := json.Unmarshal(encoded, &decoded); err != nil || len(decoded.MethodCalls) != 2 {
+		t.Fatalf("expected two method calls, got %s", encoded)
+	}
+	if string(decoded.MethodCalls[1][2]) != `"c1"` {
+		t.Errorf("expected second call ID c1, got %s", decoded.MethodCalls[1][2])
+	}
+
+	first := request.MethodCalls[0].Args
+	if first["accountId"] != "user-123" {
+		t.Errorf("expected default accountId, got %v", first["accountId"])
+	}
+	second := request.MethodCalls[1].Args
+	if second["accountId"] != "other" {
+		t.Errorf("expected explicit accountId to be kept, got %v", second["accountId"])
+	}
+	ref, _ := json.Marshal(second["#ids"])
+	if string(ref) != `{"resultOf":"c0","name":"Email/query","path":"/ids"}` {
+		t.Errorf("unexpected result reference %s", ref)
+	}
+}
+
+func TestBuildRequest_Errors(t *testing.T) {
+	tests := map[string][]string{
+		"no calls":          nil,
+		"missing arguments": {"Core/echo"},
+		"invalid JSON":      {"Core/echo", "{"},
+		"unknown reference": {"Email/get", `{"#ids":"c3/ids"}`},
+	}
+	for name, args := range tests {
+		if _, err := buildRequest([]string{coreCapability}, "", args); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRun_Call_Cognito(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{`{"methodResponses":[["Core/echo",{"hello":true},"c0"]],"sessionState":"s"}`}}
+	stdout := setupTestDeps(client, nil, Config{Token: "jwt", CorrelationID: "trace-1"})
+
+	if err := run(context.Background(), []string{"call", "-using", "urn:example:test", "Core/echo", `{"hello":true}`}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := client.requests[0]
+	if req.URL.String() != "https://jmap.example.com/jmap" || req.Method != http.MethodPost {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL)
+	}
+	if req.Header.Get("Authorization") != "Bearer jwt" || req.Header.Get("X-Correlation-Id") != "trace-1" {
+		t.Errorf("unexpected headers %v", req.Header)
+	}
+	if !bytes.Contains(client.sent[0], []byte(`"using":["urn:ietf:params:jmap:core","urn:example:test"]`)) {
+		t.Errorf("unexpected request body %s", client.sent[0])
+	}
+	if !strings.Contains(stdout.String(), "\n  \"methodResponses\"") {
+		t.Errorf("expected indented output, got %s", stdout.String())
+	}
+}
+
+func TestRun_Call_IAM(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{`{"methodResponses":[]}`}}
+	signer := &mockSigner{}
+	stdout := setupTestDeps(client, signer, Config{IAM: true, AccountID: "user-123", Raw: true})
+
+	if err := run(context.Background(), []string{"call", "Core/echo", `{}`}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !signer.signed {
+		t.Error("expected request to be signed")
+	}
+	if got := client.requests[0].URL.Path; got != "/jmap-iam/user-123" {
+		t.Errorf("expected IAM route, got %s", got)
+	}
+	if client.requests[0].Header.Get("Authorization") != "" {
+		t.Error("expected no bearer token with IAM")
+	}
+	if stdout.String() != "{\"methodResponses\":[]}\n" {
+		t.Errorf("expected raw output, got %q", stdout.String())
+	}
+}
+
+func TestRun_Call_IAMRequiresAccount(t *testing.T) {
+	setupTestDeps(&mockHTTPClient{}, &mockSigner{}, Config{IAM: true})
+	if err := run(context.Background(), []string{"call", "Core/echo", `{}`}); err == nil {
+		t.Error("expected error without -account")
+	}
+}
+
+func TestRun_Session(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{`{"apiUrl":"https://jmap.example.com/jmap"}`}}
+	stdout := setupTestDeps(client, nil, Config{Token: "jwt"})
+
+	if err := run(context.Background(), []string{"session"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.requests[0].URL.Path != "/.well-known/jmap" {
+		t.Errorf("unexpected path %s", client.requests[0].URL.Path)
+	}
+	if !strings.Contains(stdout.String(), `"apiUrl": "https://jmap.example.com/jmap"`) {
+		t.Errorf("unexpected output %s", stdout.String())
+	}
+
+	setupTestDeps(client, &mockSigner{}, Config{IAM: true, AccountID: "user-123"})
+	if err := run(context.Background(), []string{"session"}); err == nil {
+		t.Error("expected error fetching session with IAM")
+	}
+}
+
+func TestRun_Upload_UsesPrimaryAccount(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{
+		`{"primaryAccounts":{"urn:ietf:params:jmap:core":"user-123"}}`,
+		`{"accountId":"user-123","blobId":"blob-1","type":"text/plain","size":10}`,
+	}}
+	stdout := setupTestDeps(client, nil, Config{Token: "jwt"})
+
+	if err := run(context.Background(), []string{"upload", "-type", "text/plain", "-parent", "email", "-"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected session and upload requests, got %d", len(client.requests))
+	}
+	upload := client.requests[1]
+	if upload.URL.Path != "/upload/user-123" || upload.Header.Get("Content-Type") != "text/plain" || upload.Header.Get("X-Parent") != "email" {
+		t.Errorf("unexpected upload request %s %v", upload.URL, upload.Header)
+	}
+	if string(client.sent[1]) != "from stdin" {
+		t.Errorf("expected stdin to be uploaded, got %q", client.sent[1])
+	}
+	if !strings.Contains(stdout.String(), `"blobId": "blob-1"`) {
+		t.Errorf("unexpected output %s", stdout.String())
+	}
+}
+
+func TestRun_Download_IAM(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{"blob bytes"}}
+	stdout := setupTestDeps(client, &mockSigner{}, Config{IAM: true, AccountID: "user-123"})
+
+	if err := run(context.Background(), []string{"download", "blob-1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.requests[0].URL.Path != "/download-iam/user-123/blob-1" {
+		t.Errorf("unexpected path %s", client.requests[0].URL.Path)
+	}
+	if stdout.String() != "blob bytes" {
+		t.Errorf("expected blob on stdout, got %q", stdout.String())
+	}
+}
+
+func TestRun_Backfill_Batches(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{`{"accountId":"user-123","results":[]}`}}
+	signer := &mockSigner{}
+	stdout := setupTestDeps(client, signer, Config{IAM: true, AccountID: "user-123"})
+	deps.Stdin = strings.NewReader(`{"bucket":"archive","key":"a"}
+
+{"bucket":"archive","key":"b","contentType":"text/plain"}
+{"bucket":"archive","key":"c"}
+`)
+
+	if err := run(context.Background(), []string{"backfill", "-batch", "2", "-"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 2 || !signer.signed {
+		t.Fatalf("expected two signed requests, got %d", len(client.requests))
+	}
+	if client.requests[0].URL.Path != "/admin-iam/accounts/user-123/backfill" || client.requests[0].Method != http.MethodPost {
+		t.Errorf("unexpected request %s %s", client.requests[0].Method, client.requests[0].URL.Path)
+	}
+
+	var first, second struct {
+		Objects []map[string]string `json:"objects"`
+	}
+	_ = json.Unmarshal(client.sent[0], &first)
+	_ = json.Unmarshal(client.sent[1], &second)
+	if len(first.Objects) != 2 || first.Objects[1]["contentType"] != "text/plain" || len(second.Objects) != 1 || second.Objects[0]["key"] != "c" {
+		t.Errorf("unexpected batches %s %s", client.sent[0], client.sent[1])
+	}
+	if strings.Count(stdout.String(), `"accountId"`) != 2 {
+		t.Errorf("expected each batch's results printed, got %s", stdout.String())
+	}
+}
+
+func TestRun_Backfill_ResendsDeferred(t *testing.T) {
+	client := &mockHTTPClient{bodies: []string{
+		`{"accountId":"user-123","results":[{"bucket":"archive","key":"a"},{"bucket":"archive","key":"b","error":{"type":"deferred"}}]}`,
+		`{"accountId":"user-123","results":[]}`,
+	}}
+	setupTestDeps(client, &mockSigner{}, Config{IAM: true, AccountID: "user-123"})
+	deps.Stdin = strings.NewReader(`{"bucket":"archive","key":"a"}
+{"bucket":"archive","key":"b","contentType":"text/plain"}
+{"bucket":"archive","key":"c"}
+`)
+
+	if err := run(context.Background(), []string{"backfill", "-batch", "2", "-"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.requests) != 2 {
+		t.Fatalf("expected two requests, got %d", len(client.requests))
+	}
+	var second struct {
+		Objects []map[string]string `json:"objects"`
+	}
+	_ = json.Unmarshal(client.sent[1], &second)
+	if len(second.Objects) != 2 || second.Objects[0]["key"] != "b" || second.Objects[0]["contentType"] != "text/plain" || second.Objects[1]["key"] != "c" {
+		t.Errorf("expected the deferred object sent first in the next batch, got %s", client.sent[1])
+	}
+}
+
+func TestRun_Backfill_Validation(t *testing.T) {
+	tests := map[string]struct {
+		cfg      Config
+		args     []string
+		manifest string
+	}{
+		"cognito":       {Config{Token: "jwt", AccountID: "user-123"}, []string{"backfill", "-"}, `{"bucket":"a","key":"b"}`},
+		"no account":    {Config{IAM: true}, []string{"backfill", "-"}, `{"bucket":"a","key":"b"}`},
+		"batch too big": {Config{IAM: true, AccountID: "user-123"}, []string{"backfill", "-batch", "11", "-"}, `{"bucket":"a","key":"b"}`},
+		"bad json":      {Config{IAM: true, AccountID: "user-123"}, []string{"backfill", "-"}, `{"bucket":`},
+		"missing key":   {Config{IAM: true, AccountID: "user-123"}, []string{"backfill", "-"}, `{"bucket":"a"}`},
+	}
+	for name, tt := range tests {
+		client := &mockHTTPClient{err: errors.New("unreachable")}
+		setupTestDeps(client, &mockSigner{}, tt.cfg)
+		deps.Stdin = strings.NewReader(tt.manifest)
+		if err := run(context.Background(), tt.args); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+		if len(client.requests) != 0 {
+			t.Errorf("%s: expected no requests, got %d", name, len(client.requests))
+		}
+	}
+}
+
+func TestRun_ErrorStatus(t *testing.T) {
+	client := &mockHTTPClient{statusCode: http.StatusForbidden, bodies: []string{`{"type":"forbidden"}`}}
+	setupTestDeps(client, nil, Config{Token: "jwt", AccountID: "user-123"})
+
+	err := run(context.Background(), []string{"download", "blob-1"})
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "forbidden") {
+		t.Errorf("expected status error with body, got %v", err)
+	}
+}
+
+func TestRun_Validation(t *testing.T) {
+	setupTestDeps(&mockHTTPClient{err: errors.New("unreachable")}, nil, Config{})
+
+	tests := map[string][]string{
+		"no command":      nil,
+		"unknown command": {"frobnicate"},
+		"missing token":   {"session"},
+	}
+	for name, args := range tests {
+		if err := run(context.Background(), args); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
@@ -11,11 +11,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
 	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
 	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
-	"github.com/jarrod-lowe/jmap-service-libs/logging"
 )
 
-var logger = logging.New()
+var logger = loglevel.New()
 
 // SSMReader reads parameters from SSM Parameter Store
 type SSMReader interface {
@@ -149,18 +152,40 @@ func main() {
 	}
 	defer result.Cleanup()
 
-	// Get required environment variables
-	ssmParameterName := os.Getenv("SSM_PARAMETER_NAME")
-	if ssmParameterName == "" {
-		logger.Error("FATAL: SSM_PARAMETER_NAME environment variable is required")
-		panic("SSM_PARAMETER_NAME environment variable is required")
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
 
-	metricNamespace := os.Getenv("METRIC_NAMESPACE")
-	if metricNamespace == "" {
-		logger.Error("FATAL: METRIC_NAMESPACE environment variable is required")
-		panic("METRIC_NAMESPACE environment variable is required")
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadKeyAgeCheck(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
 	}
+	ssmParameterName := cfg.SSMParameterName
+	metricNamespace := cfg.MetricNamespace
 
 	ssmClient := ssm.NewFromConfig(result.Config)
 	cwClient := cloudwatch.NewFromConfig(result.Config)
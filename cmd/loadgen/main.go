@@ -0,0 +1,415 @@
+// Command loadgen drives a weighted mix of JMAP requests against an
+// environment through a series of concurrency stages, and reports the
+// latency distribution of each scenario per stage. It is for validating
+// dispatcher pool sizing and plugin scaling before and after changes.
+//
+//	loadgen -url https://jmap.example.com -iam -account loadtest-1 \
+//	    -mix echo=70,blob=20,chain=10 -stages 5x30s,20x60s,50x60s
+//
+// Scenarios:
+//
+//   - echo: one Core/echo call
+//   - blob: upload a -blob-size blob, then download it
+//   - chain: -chain-depth Core/echo calls in one request, each taking its
+//     argument from the previous call by result reference
+//
+// Run it against a test environment and account; blob scenarios leave their
+// blobs behind and count against the account's quota.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	mathrand "math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/jmapclient"
+)
+
+// JMAPClient is the part of jmapclient.Client the scenarios use
+type JMAPClient interface {
+	Do(ctx context.Context, request *jmapclient.Request) (*jmapclient.Response, error)
+	Upload(ctx context.Context, in jmapclient.UploadInput) (*jmapclient.Blob, error)
+	Download(ctx context.Context, blobID string) ([]byte, error)
+}
+
+// Stage runs Concurrency workers for Duration
+type Stage struct {
+	Concurrency int
+	Duration    time.Duration
+}
+
+// Weight is a scenario's share of the mix
+type Weight struct {
+	Scenario string
+	Weight   int
+}
+
+// Config holds the flags
+type Config struct {
+	Mix        []Weight
+	Stages     []Stage
+	BlobSize   int
+	ChainDepth int
+	JSON       bool
+}
+
+// Dependencies for the load run (injectable for testing)
+type Dependencies struct {
+	Client JMAPClient
+	Config Config
+	Stdout io.Writer
+	Random func() float64 // in [0, 1), for picking scenarios
+}
+
+var deps *Dependencies
+
+// scenarios maps scenario names to a single iteration
+var scenarios = map[string]func(ctx context.Context) error{
+	"echo":  runEcho,
+	"blob":  runBlob,
+	"chain": runChain,
+}
+
+// runEcho sends one Core/echo call
+func runEcho(ctx context.Context) error {
+	request := jmapclient.NewRequest()
+	call := request.Invoke("Core/echo", map[string]any{"loadgen": true})
+	response, err := deps.Client.Do(ctx, request)
+	if err != nil {
+		return err
+	}
+	return response.Get(call, nil)
+}
+
+// runBlob uploads a blob and downloads it again
+func runBlob(ctx context.Context) error {
+	data := make([]byte, deps.Config.BlobSize)
+	_, _ = rand.Read(data)
+	blob, err := deps.Client.Upload(ctx, jmapclient.UploadInput{Type: "application/octet-stream", Data: data})
+	if err != nil {
+		return err
+	}
+	downloaded, err := deps.Client.Download(ctx, blob.BlobID)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(downloaded, data) {
+		return errors.New("downloaded blob differs from the upload")
+	}
+	return nil
+}
+
+// runChain sends a request whose calls each reference the previous one's
+// result
+func runChain(ctx context.Context) error {
+	request := jmapclient.NewRequest()
+	previous := request.Invoke("Core/echo", map[string]any{"ids": []string{"a", "b", "c"}})
+	for range deps.Config.ChainDepth - 1 {
+		previous = request.Invoke("Core/echo", map[string]any{"#ids": previous.Ref("/ids")})
+	}
+	response, err := deps.Client.Do(ctx, request)
+	if err != nil {
+		return err
+	}
+	var last struct {
+		IDs []string `json:"ids"`
+	}
+	if err := response.Get(previous, &last); err != nil {
+		return err
+	}
+	if len(last.IDs) != 3 {
+		return fmt.Errorf("result reference chain returned %d ids, want 3", len(last.IDs))
+	}
+	return nil
+}
+
+// pick chooses a scenario by weight
+func pick(mix []Weight) string {
+	total := 0
+	for _, weight := range mix {
+		total += weight.Weight
+	}
+	target := int(deps.Random() * float64(total))
+	for _, weight := range mix {
+		if target < weight.Weight {
+			return weight.Scenario
+		}
+		target -= weight.Weight
+	}
+	return mix[len(mix)-1].Scenario
+}
+
+// ScenarioStats summarises one scenario in one stage
+type ScenarioStats struct {
+	Scenario string  `json:"scenario"`
+	Count    int     `json:"count"`
+	Errors   int     `json:"errors"`
+	P50Ms    float64 `json:"p50Ms"`
+	P90Ms    float64 `json:"p90Ms"`
+	P99Ms    float64 `json:"p99Ms"`
+	MaxMs    float64 `json:"maxMs"`
+}
+
+// StageResult summarises one stage
+type StageResult struct {
+	Concurrency       int             `json:"concurrency"`
+	DurationSeconds   float64         `json:"durationSeconds"`
+	Requests          int             `json:"requests"`
+	RequestsPerSecond float64         `json:"requestsPerSecond"`
+	Scenarios         []ScenarioStats `json:"scenarios"`
+	FirstErrors       []string        `json:"firstErrors,omitempty"`
+}
+
+// maxErrorSamples is the number of distinct errors kept per stage
+const maxErrorSamples = 5
+
+// recorder collects the outcome of each iteration in a stage
+type recorder struct {
+	mu        sync.Mutex
+	latencies map[string][]time.Duration
+	errors    map[string]int
+	samples   []string
+}
+
+func newRecorder() *recorder {
+	return &recorder{latencies: make(map[string][]time.Duration), errors: make(map[string]int)}
+}
+
+func (r *recorder) record(scenario string, latency time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.latencies[scenario] = append(r.latencies[scenario], latency)
+	if err == nil {
+		return
+	}
+	r.errors[scenario]++
+	sample := scenario + ": " + err.Error()
+	if len(r.samples) < maxErrorSamples && !slices.Contains(r.samples, sample) {
+		r.samples = append(r.samples, sample)
+	}
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies in ms
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	rank = min(max(rank, 0), len(sorted)-1)
+	return float64(sorted[rank].Microseconds()) / 1000
+}
+
+// result summarises the recorded iterations
+func (r *recorder) result(stage Stage, elapsed time.Duration) StageResult {
+	result := StageResult{
+		Concurrency:     stage.Concurrency,
+		DurationSeconds: elapsed.Seconds(),
+		FirstErrors:     r.samples,
+	}
+	names := make([]string, 0, len(r.latencies))
+	for name := range r.latencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		latencies := r.latencies[name]
+		slices.Sort(latencies)
+		result.Requests += len(latencies)
+		result.Scenarios = append(result.Scenarios, ScenarioStats{
+			Scenario: name,
+			Count:    len(latencies),
+			Errors:   r.errors[name],
+			P50Ms:    percentile(latencies, 50),
+			P90Ms:    percentile(latencies, 90),
+			P99Ms:    percentile(latencies, 99),
+			MaxMs:    percentile(latencies, 100),
+		})
+	}
+	if elapsed > 0 {
+		result.RequestsPerSecond = float64(result.Requests) / elapsed.Seconds()
+	}
+	return result
+}
+
+// runStage runs the stage's workers until its duration is up
+func runStage(ctx context.Context, stage Stage) StageResult {
+	rec := newRecorder()
+	ctx, cancel := context.WithTimeout(ctx, stage.Duration)
+	defer cancel()
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for range stage.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				scenario := pick(deps.Config.Mix)
+				began := time.Now()
+				err := scenarios[scenario](ctx)
+				// An iteration cut off by the end of the stage is not a result
+				if ctx.Err() != nil {
+					return
+				}
+				rec.record(scenario, time.Since(began), err)
+			}
+		}()
+	}
+	wg.Wait()
+	return rec.result(stage, time.Since(start))
+}
+
+// run runs each stage in turn
+func run(ctx context.Context) []StageResult {
+	var results []StageResult
+	for i, stage := range deps.Config.Stages {
+		if !deps.Config.JSON {
+			fmt.Fprintf(deps.Stdout, "Stage %d: %d workers for %s\n", i+1, stage.Concurrency, stage.Duration)
+		}
+		result := runStage(ctx, stage)
+		results = append(results, result)
+		if !deps.Config.JSON {
+			writeStage(result)
+		}
+	}
+	return results
+}
+
+// writeStage writes one stage's results as a table
+func writeStage(result StageResult) {
+	fmt.Fprintf(deps.Stdout, "  %d requests, %.1f req/s\n", result.Requests, result.RequestsPerSecond)
+	table := tabwriter.NewWriter(deps.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "scenario\tcount\terrors\tp50 ms\tp90 ms\tp99 ms\tmax ms\t")
+	for _, s := range result.Scenarios {
+		fmt.Fprintf(table, "%s\t%d\t%d\t%.1f\t%.1f\t%.1f\t%.1f\t\n", s.Scenario, s.Count, s.Errors, s.P50Ms, s.P90Ms, s.P99Ms, s.MaxMs)
+	}
+	_ = table.Flush()
+	for _, sample := range result.FirstErrors {
+		fmt.Fprintf(deps.Stdout, "  error: %s\n", sample)
+	}
+	fmt.Fprintln(deps.Stdout)
+}
+
+// parseMix parses "echo=70,blob=20,chain=10"
+func parseMix(value string) ([]Weight, error) {
+	var mix []Weight
+	for entry := range strings.SplitSeq(value, ",") {
+		name, weight, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			weight = "1"
+		}
+		if _, known := scenarios[name]; !known {
+			return nil, fmt.Errorf("unknown scenario %q", name)
+		}
+		n, err := strconv.Atoi(weight)
+		if err != nil || n <= 0 {
+			return nil, fmt.Errorf("invalid weight %q for %s", weight, name)
+		}
+		mix = append(mix, Weight{Scenario: name, Weight: n})
+	}
+	return mix, nil
+}
+
+// parseStages parses "5x30s,20x1m"
+func parseStages(value string) ([]Stage, error) {
+	var stages []Stage
+	for entry := range strings.SplitSeq(value, ",") {
+		workers, duration, ok := strings.Cut(strings.TrimSpace(entry), "x")
+		concurrency, err := strconv.Atoi(workers)
+		if !ok || err != nil || concurrency <= 0 {
+			return nil, fmt.Errorf("invalid stage %q, want WORKERSxDURATION", entry)
+		}
+		d, err := time.ParseDuration(duration)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid duration in stage %q", entry)
+		}
+		stages = append(stages, Stage{Concurrency: concurrency, Duration: d})
+	}
+	return stages, nil
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "loadgen: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("loadgen", flag.ExitOnError)
+	apiURL := flags.String("url", os.Getenv("JMAP_URL"), "API base URL (env JMAP_URL)")
+	token := flags.String("token", os.Getenv("JMAP_TOKEN"), "Cognito ID token (env JMAP_TOKEN)")
+	iam := flags.Bool("iam", false, "sign requests with SigV4 using the default AWS credentials")
+	accountID := flags.String("account", os.Getenv("JMAP_ACCOUNT_ID"), "account ID; required with -iam (env JMAP_ACCOUNT_ID)")
+	region := flags.String("region", "", "AWS region for -iam (default from the AWS config)")
+	mix := flags.String("mix", "echo", "weighted scenarios, such as echo=70,blob=20,chain=10")
+	stages := flags.String("stages", "1x10s", "concurrency ramp as WORKERSxDURATION stages, such as 5x30s,20x1m")
+	flags.IntVar(&cfg.BlobSize, "blob-size", 64*1024, "size of blobs uploaded by the blob scenario, in bytes")
+	flags.IntVar(&cfg.ChainDepth, "chain-depth", 4, "calls per request in the chain scenario")
+	flags.BoolVar(&cfg.JSON, "json", false, "write the results as JSON")
+	_ = flags.Parse(os.Args[1:])
+
+	var err error
+	if cfg.Mix, err = parseMix(*mix); err != nil {
+		fail("%v", err)
+	}
+	if cfg.Stages, err = parseStages(*stages); err != nil {
+		fail("%v", err)
+	}
+	if *apiURL == "" {
+		fail("-url or JMAP_URL is required")
+	}
+
+	var auth jmapclient.Authenticator = jmapclient.BearerToken(*token)
+	if *iam {
+		var options []func(*config.LoadOptions) error
+		if *region != "" {
+			options = append(options, config.WithRegion(*region))
+		}
+		awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			fail("failed to load AWS config: %v", err)
+		}
+		auth = jmapclient.NewSigV4(awsConfig)
+	} else if *token == "" {
+		fail("-token or JMAP_TOKEN is required unless -iam is set")
+	}
+	// Keep a connection per worker so the client's pool does not skew latency
+	peak := 0
+	for _, stage := range cfg.Stages {
+		peak = max(peak, stage.Concurrency)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = peak
+	client := jmapclient.New(*apiURL, auth).
+		WithAccount(*accountID).
+		WithHTTPClient(&http.Client{Transport: transport, Timeout: 60 * time.Second})
+
+	deps = &Dependencies{Client: client, Config: cfg, Stdout: os.Stdout, Random: mathrand.Float64}
+	results := run(ctx)
+	if cfg.JSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			fail("%v", err)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/pkg/jmapclient"
+)
+
+// mockClient answers Core/echo by echoing arguments, resolving "#ids"
+// references to the earlier call's ids, and stores uploaded blobs
+type mockClient struct {
+	mu       sync.Mutex
+	blobs    map[string][]byte
+	requests []*jmapclient.Request
+	doErr    error
+	corrupt  bool
+}
+
+func newMockClient() *mockClient {
+	return &mockClient{blobs: make(map[string][]byte)}
+}
+
+func (m *mockClient) Do(ctx context.Context, request *jmapclient.Request) (*jmapclient.Response, error) {
+	m.mu.Lock()
+	m.requests = append(m.requests, request)
+	m.mu.Unlock()
+	if m.doErr != nil {
+		return nil, m.doErr
+	}
+	response := &jmapclient.Response{}
+	results := make(map[string]map[string]any)
+	for _, call := range request.Calls {
+		args := make(map[string]any)
+		for key, value := range call.Args.(map[string]any) {
+			if ref, ok := value.(jmapclient.ResultReference); ok {
+				args[strings.TrimPrefix(key, "#")] = results[ref.ResultOf]["ids"]
+				continue
+			}
+			args[key] = value
+		}
+		results[call.ID] = args
+		data, _ := json.Marshal(args)
+		response.MethodResponses = append(response.MethodResponses, jmapclient.Invocation{Name: call.Name, Args: data, CallID: call.ID})
+	}
+	return response, nil
+}
+
+func (m *mockClient) Upload(ctx context.Context, in jmapclient.UploadInput) (*jmapclient.Blob, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	blobID := "blob-" + string(rune('a'+len(m.blobs)%26))
+	m.blobs[blobID] = in.Data
+	return &jmapclient.Blob{BlobID: blobID, Size: int64(len(in.Data))}, nil
+}
+
+func (m *mockClient) Download(ctx context.Context, blobID string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.corrupt {
+		return []byte("corrupt"), nil
+	}
+	return m.blobs[blobID], nil
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(client *mockClient, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	if cfg.ChainDepth == 0 {
+		cfg.ChainDepth = 3
+	}
+	if cfg.BlobSize == 0 {
+		cfg.BlobSize = 128
+	}
+	deps = &Dependencies{Client: client, Config: cfg, Stdout: &stdout, Random: func() float64 { return 0 }}
+	return &stdout
+}
+
+func TestRunEcho(t *testing.T) {
+	client := newMockClient()
+	setupTestDeps(client, Config{})
+
+	if err := runEcho(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.requests[0].Calls[0].Name != "Core/echo" {
+		t.Errorf("unexpected request %+v", client.requests[0])
+	}
+}
+
+func TestRunChain(t *testing.T) {
+	client := newMockClient()
+	setupTestDeps(client, Config{ChainDepth: 4})
+
+	if err := runChain(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	calls := client.requests[0].Calls
+	if len(calls) != 4 {
+		t.Fatalf("expected 4 calls, got %d", len(calls))
+	}
+	ref, ok := calls[3].Args.(map[string]any)["#ids"].(jmapclient.ResultReference)
+	if !ok || ref.ResultOf != "c2" || ref.Path != "/ids" {
+		t.Errorf("expected reference to c2, got %+v", calls[3].Args)
+	}
+}
+
+func TestRunBlob(t *testing.T) {
+	client := newMockClient()
+	setupTestDeps(client, Config{BlobSize: 1024})
+
+	if err := runBlob(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.blobs["blob-a"]) != 1024 {
+		t.Errorf("expected a 1024 byte upload, got %d", len(client.blobs["blob-a"]))
+	}
+
+	client.corrupt = true
+	if err := runBlob(context.Background()); err == nil {
+		t.Error("expected error when the download differs")
+	}
+}
+
+func TestPick(t *testing.T) {
+	client := newMockClient()
+	setupTestDeps(client, Config{})
+	mix := []Weight{{"echo", 70}, {"blob", 20}, {"chain", 10}}
+
+	for _, tt := range []struct {
+		random float64
+		want   string
+	}{{0, "echo"}, {0.69, "echo"}, {0.7, "blob"}, {0.89, "blob"}, {0.9, "chain"}, {0.999, "chain"}} {
+		deps.Random = func() float64 { return tt.random }
+		if got := pick(mix); got != tt.want {
+			t.Errorf("pick at %v = %s, want %s", tt.random, got, tt.want)
+		}
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var latencies []time.Duration
+	for i := 1; i <= 100; i++ {
+		latencies = append(latencies, time.Duration(i)*time.Millisecond)
+	}
+	for _, tt := range []struct {
+		p    float64
+		want float64
+	}{{50, 50}, {90, 90}, {99, 99}, {100, 100}} {
+		if got := percentile(latencies, tt.p); got != tt.want {
+			t.Errorf("p%v = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+	if percentile(nil, 50) != 0 {
+		t.Error("expected 0 for no latencies")
+	}
+}
+
+func TestRun(t *testing.T) {
+	client := newMockClient()
+	stdout := setupTestDeps(client, Config{
+		Mix:    []Weight{{"echo", 1}},
+		Stages: []Stage{{Concurrency: 2, Duration: 30 * time.Millisecond}, {Concurrency: 4, Duration: 30 * time.Millisecond}},
+	})
+
+	results := run(context.Background())
+
+	if len(results) != 2 || results[1].Concurrency != 4 {
+		t.Fatalf("expected 2 stages, got %+v", results)
+	}
+	stats := results[0].Scenarios[0]
+	if stats.Scenario != "echo" || stats.Count == 0 || stats.Errors != 0 || results[0].Requests != stats.Count {
+		t.Errorf("unexpected stats %+v", results[0])
+	}
+	for _, want := range []string{"Stage 1: 2 workers for 30ms", "Stage 2: 4 workers", "scenario", "echo"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestRun_RecordsErrors(t *testing.T) {
+	client := newMockClient()
+	client.doErr = errors.New("jmapclient: unexpected status 429: Too Many Requests")
+	stdout := setupTestDeps(client, Config{
+		Mix:    []Weight{{"echo", 1}},
+		Stages: []Stage{{Concurrency: 1, Duration: 20 * time.Millisecond}},
+	})
+
+	results := run(context.Background())
+
+	stats := results[0].Scenarios[0]
+	if stats.Errors == 0 || stats.Errors != stats.Count {
+		t.Errorf("expected every request to fail, got %+v", stats)
+	}
+	if len(results[0].FirstErrors) != 1 || !strings.Contains(stdout.String(), "error: echo: jmapclient: unexpected status 429") {
+		t.Errorf("expected one error sample, got %v:\n%s", results[0].FirstErrors, stdout.String())
+	}
+}
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix("echo=70, blob=20,chain")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mix) != 3 || mix[0] != (Weight{"echo", 70}) || mix[2] != (Weight{"chain", 1}) {
+		t.Errorf("unexpected mix %+v", mix)
+	}
+	for _, bad := range []string{"email=1", "echo=0", "echo=x"} {
+		if _, err := parseMix(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestParseStages(t *testing.T) {
+	stages, err := parseStages("5x30s, 20x1m")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stages) != 2 || stages[1] != (Stage{Concurrency: 20, Duration: time.Minute}) {
+		t.Errorf("unexpected stages %+v", stages)
+	}
+	for _, bad := range []string{"5", "0x30s", "5xsoon", "5x-1s"} {
+		if _, err := parseStages(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
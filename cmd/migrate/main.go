@@ -0,0 +1,172 @@
+// Command migrate applies versioned migrations to the core table as record
+// shapes evolve, such as backfilling a new GSI key or renaming an attribute.
+// Applied versions and the progress of an interrupted migration are kept in
+// the CONFIG#/MIGRATIONS# item; see internal/migrate.
+//
+//	migrate -table jmap-test status
+//	migrate -table jmap-test -dry-run up
+//	migrate -table jmap-test up [-to VERSION]
+//
+// Only one migrate should run against a table at a time.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/migrate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// MigrationRunner reads migration state and applies migrations
+type MigrationRunner interface {
+	LoadState(ctx context.Context) (*migrate.State, error)
+	Run(ctx context.Context, state *migrate.State, migration migrate.Migration, dryRun bool, onPage func(migrate.Progress)) (migrate.Progress, error)
+}
+
+// Config holds the flags
+type Config struct {
+	DryRun bool
+	To     int
+}
+
+// Dependencies for commands (injectable for testing)
+type Dependencies struct {
+	Runner     MigrationRunner
+	Migrations []migrate.Migration
+	Config     Config
+	Stdout     io.Writer
+}
+
+var deps *Dependencies
+
+// runStatus prints the applied and pending migrations
+func runStatus(ctx context.Context) error {
+	state, err := deps.Runner.LoadState(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(deps.Stdout, "Schema version %d of %d\n", state.Version(), len(deps.Migrations))
+	for _, applied := range state.Applied {
+		fmt.Fprintf(deps.Stdout, "  applied  %3d  %s (%s, %d of %d items updated)\n", applied.Version, applied.Description, applied.AppliedAt, applied.Updated, applied.Scanned)
+	}
+	for _, migration := range migrate.Pending(state, deps.Migrations, 0) {
+		fmt.Fprintf(deps.Stdout, "  pending  %3d  %s\n", migration.Version, migration.Description)
+	}
+	if state.Current != nil {
+		fmt.Fprintf(deps.Stdout, "Migration %d was interrupted after %d items (%d updated) and resumes from its checkpoint\n", state.Current.Version, state.Current.Scanned, state.Current.Updated)
+	}
+	return nil
+}
+
+// runUp applies the pending migrations in order
+func runUp(ctx context.Context) error {
+	state, err := deps.Runner.LoadState(ctx)
+	if err != nil {
+		return err
+	}
+	if deps.Config.To > len(deps.Migrations) {
+		return fmt.Errorf("-to %d is past the latest migration, %d", deps.Config.To, len(deps.Migrations))
+	}
+	if deps.Config.To != 0 && deps.Config.To < state.Version() {
+		return fmt.Errorf("already at version %d; migrations cannot be reversed", state.Version())
+	}
+
+	pending := migrate.Pending(state, deps.Migrations, deps.Config.To)
+	if len(pending) == 0 {
+		fmt.Fprintf(deps.Stdout, "Already at version %d\n", state.Version())
+		return nil
+	}
+
+	verb := "Applied"
+	if deps.Config.DryRun {
+		verb = "Dry run of"
+	}
+	for _, migration := range pending {
+		fmt.Fprintf(deps.Stdout, "Migration %d: %s\n", migration.Version, migration.Description)
+		progress, err := deps.Runner.Run(ctx, state, migration, deps.Config.DryRun, func(progress migrate.Progress) {
+			fmt.Fprintf(deps.Stdout, "  %d items scanned, %d updated\n", progress.Scanned, progress.Updated)
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", migration.Version, err)
+		}
+		fmt.Fprintf(deps.Stdout, "%s migration %d: %d items scanned, %d updated\n", verb, migration.Version, progress.Scanned, progress.Updated)
+	}
+	return nil
+}
+
+// commands maps command names to their implementations
+var commands = map[string]func(ctx context.Context) error{
+	"status": runStatus,
+	"up":     runUp,
+}
+
+// run dispatches a command
+func run(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errors.New("expected one command: status or up")
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+	if err := migrate.Validate(deps.Migrations); err != nil {
+		return err
+	}
+	return command(ctx)
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: migrate [flags] status|up")
+		flags.PrintDefaults()
+	}
+	table := flags.String("table", os.Getenv("DYNAMODB_TABLE"), "core DynamoDB table (env DYNAMODB_TABLE)")
+	region := flags.String("region", "", "AWS region (default from the AWS config)")
+	pageSize := flags.Int("page-size", migrate.DefaultPageSize, "items scanned between checkpoints")
+	flags.BoolVar(&cfg.DryRun, "dry-run", false, "count the items each migration would update without writing")
+	flags.IntVar(&cfg.To, "to", 0, "stop after this version (default the latest)")
+	_ = flags.Parse(os.Args[1:])
+
+	if *table == "" {
+		fmt.Fprintln(os.Stderr, "migrate: -table or DYNAMODB_TABLE is required")
+		os.Exit(2)
+	}
+
+	var options []func(*config.LoadOptions) error
+	if *region != "" {
+		options = append(options, config.WithRegion(*region))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: failed to load AWS config: %v\n", err)
+		os.Exit(1)
+	}
+	// Migrate DynamoDB Local during local development
+	if err := localdev.Configure(&awsConfig); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+
+	deps = &Dependencies{
+		Runner:     migrate.NewRunner(store.NewRetryClient(dynamodb.NewFromConfig(awsConfig)), *table, int32(*pageSize)),
+		Migrations: migrations,
+		Config:     cfg,
+		Stdout:     os.Stdout,
+	}
+	if err := run(ctx, flags.Args()); err != nil {
+		fmt.Fprintf(os.Stderr, "migrate: %v\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/migrate"
+)
+
+// mockRunner records the migrations run and marks them applied
+type mockRunner struct {
+	state  *migrate.State
+	ran    []int
+	dryRun bool
+	err    error
+}
+
+func (m *mockRunner) LoadState(ctx context.Context) (*migrate.State, error) {
+	return m.state, nil
+}
+
+func (m *mockRunner) Run(ctx context.Context, state *migrate.State, migration migrate.Migration, dryRun bool, onPage func(migrate.Progress)) (migrate.Progress, error) {
+	if m.err != nil {
+		return migrate.Progress{}, m.err
+	}
+	m.ran = append(m.ran, migration.Version)
+	m.dryRun = dryRun
+	progress := migrate.Progress{Version: migration.Version, Scanned: 10, Updated: 3}
+	onPage(progress)
+	state.Applied = append(state.Applied, migrate.Applied{Version: migration.Version})
+	return progress, nil
+}
+
+var testMigrations = []migrate.Migration{
+	{Version: 1, Description: "Baseline"},
+	{Version: 2, Description: "Backfill gsi2 keys"},
+	{Version: 3, Description: "Rename contentType"},
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(runner *mockRunner, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	deps = &Dependencies{Runner: runner, Migrations: testMigrations, Config: cfg, Stdout: &stdout}
+	return &stdout
+}
+
+func TestMigrationsAreValid(t *testing.T) {
+	if err := migrate.Validate(migrations); err != nil {
+		t.Errorf("invalid migrations: %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	runner := &mockRunner{state: &migrate.State{
+		Applied: []migrate.Applied{{Version: 1, Description: "Baseline", AppliedAt: "2026-03-01T12:00:00Z", Scanned: 0}},
+		Current: &migrate.Progress{Version: 2, Scanned: 200, Updated: 50},
+	}}
+	stdout := setupTestDeps(runner, Config{})
+
+	if err := run(context.Background(), []string{"status"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"Schema version 1 of 3", "applied    1  Baseline", "pending    2  Backfill gsi2 keys", "pending    3", "Migration 2 was interrupted after 200 items"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in:\n%s", want, stdout.String())
+		}
+	}
+}
+
+func TestUp(t *testing.T) {
+	runner := &mockRunner{state: &migrate.State{Applied: []migrate.Applied{{Version: 1}}}}
+	stdout := setupTestDeps(runner, Config{})
+
+	if err := run(context.Background(), []string{"up"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.ran) != 2 || runner.ran[0] != 2 || runner.ran[1] != 3 || runner.dryRun {
+		t.Errorf("expected migrations 2 and 3 applied, got %v", runner.ran)
+	}
+	if !strings.Contains(stdout.String(), "Applied migration 3: 10 items scanned, 3 updated") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+}
+
+func TestUp_ToAndDryRun(t *testing.T) {
+	runner := &mockRunner{state: &migrate.State{}}
+	stdout := setupTestDeps(runner, Config{To: 2, DryRun: true})
+
+	if err := run(context.Background(), []string{"up"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.ran) != 2 || !runner.dryRun {
+		t.Errorf("expected dry run of migrations 1 and 2, got %v", runner.ran)
+	}
+	if !strings.Contains(stdout.String(), "Dry run of migration 2") {
+		t.Errorf("unexpected output:\n%s", stdout.String())
+	}
+}
+
+func TestUp_UpToDate(t *testing.T) {
+	runner := &mockRunner{state: &migrate.State{Applied: []migrate.Applied{{Version: 1}, {Version: 2}, {Version: 3}}}}
+	stdout := setupTestDeps(runner, Config{})
+
+	if err := run(context.Background(), []string{"up"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(runner.ran) != 0 || !strings.Contains(stdout.String(), "Already at version 3") {
+		t.Errorf("expected nothing to run, got %v:\n%s", runner.ran, stdout.String())
+	}
+}
+
+func TestUp_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		state  *migrate.State
+		cfg    Config
+		runErr error
+		want   string
+	}{
+		{"past latest", &migrate.State{}, Config{To: 4}, nil, "past the latest"},
+		{"reverse", &migrate.State{Applied: []migrate.Applied{{Version: 1}, {Version: 2}}}, Config{To: 1}, nil, "cannot be reversed"},
+		{"run fails", &migrate.State{}, Config{}, errors.New("throttled"), "migration 1: throttled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupTestDeps(&mockRunner{state: tt.state, err: tt.runErr}, tt.cfg)
+			err := run(context.Background(), []string{"up"})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestRun_UnknownCommand(t *testing.T) {
+	setupTestDeps(&mockRunner{state: &migrate.State{}}, Config{})
+	if err := run(context.Background(), []string{"down"}); err == nil {
+		t.Error("expected error for unknown command")
+	}
+}
@@ -0,0 +1,14 @@
+package main
+
+import "github.com/jarrod-lowe/jmap-service-core/internal/migrate"
+
+// migrations are applied in order. Append new ones with the next version;
+// never edit or remove one that has been applied to an environment. A
+// migration must leave records readable by both the code before and after
+// it, since Lambdas keep serving while it runs.
+var migrations = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "Baseline: the single-table layout before managed migrations",
+	},
+}
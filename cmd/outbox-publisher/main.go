@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// EventDeliverer delivers an event to every subscribed plugin, returning an
+// error if any delivery failed
+type EventDeliverer interface {
+	Deliver(ctx context.Context, payload publisher.EventPayload) error
+}
+
+// OutboxStore removes delivered outbox records
+type OutboxStore interface {
+	Delete(ctx context.Context, accountID, eventID string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Deliverer EventDeliverer
+	Outbox    OutboxStore
+}
+
+var deps *Dependencies
+
+// handler delivers outbox records from DynamoDB stream events. Records that
+// fail are reported back so the stream retries them.
+func handler(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	var response events.DynamoDBEventResponse
+	for _, record := range event.Records {
+		if !processRecord(ctx, record) {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+		}
+	}
+	return response, nil
+}
+
+// processRecord delivers a single outbox record, returning false if it should be retried
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord) bool {
+	// Only process INSERT events
+	if record.EventName != "INSERT" {
+		return true
+	}
+
+	entry, ok, err := outbox.FromImage(record.Change.NewImage)
+	if !ok {
+		return true
+	}
+	if err != nil {
+		// A malformed record will never deliver; retrying only delays the batch
+		logger.ErrorContext(ctx, "Invalid outbox record",
+			slog.String("error", err.Error()),
+		)
+		return true
+	}
+
+	// Log delivery under the request that caused the event
+	if entry.Payload.CorrelationID != "" {
+		ctx = correlation.WithID(ctx, entry.Payload.CorrelationID)
+	}
+
+	if err := deps.Deliverer.Deliver(ctx, entry.Payload); err != nil {
+		logger.ErrorContext(ctx, "Failed to deliver outbox event",
+			slog.String("account_id", entry.AccountID),
+			slog.String("event_id", entry.EventID),
+			slog.String("event_type", entry.Payload.EventType),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+
+	// The record expires by TTL if the delete fails, and the event has
+	// already been delivered, so this is not retried
+	if err := deps.Outbox.Delete(ctx, entry.AccountID, entry.EventID); err != nil {
+		logger.WarnContext(ctx, "Failed to delete delivered outbox record",
+			slog.String("account_id", entry.AccountID),
+			slog.String("event_id", entry.EventID),
+			slog.String("error", err.Error()),
+		)
+	}
+
+	logger.InfoContext(ctx, "Delivered outbox event",
+		slog.String("account_id", entry.AccountID),
+		slog.String("event_id", entry.EventID),
+		slog.String("event_type", entry.Payload.EventType),
+	)
+	return true
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadCore(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	// Load plugin registry for event targets
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+	eventPublisher := publisher.FromConfig(result.Config, registry).
+		WithEventLog(eventlog.NewDynamoDBStore(dynamoClient, tableName))
+
+	deps = &Dependencies{
+		Deliverer: eventPublisher,
+		Outbox:    outbox.NewDynamoDBStore(dynamoClient, tableName),
+	}
+
+	result.Start(handler)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockDeliverer struct {
+	delivered []publisher.EventPayload
+	err       error
+}
+
+func (m *mockDeliverer) Deliver(ctx context.Context, payload publisher.EventPayload) error {
+	m.delivered = append(m.delivered, payload)
+	return m.err
+}
+
+type mockOutboxStore struct {
+	deleted []string
+	err     error
+}
+
+func (m *mockOutboxStore) Delete(ctx context.Context, accountID, eventID string) error {
+	m.deleted = append(m.deleted, accountID+"/"+eventID)
+	return m.err
+}
+
+func outboxRecord(t *testing.T, sequence, eventID string) events.DynamoDBEventRecord {
+	t.Helper()
+	body, err := json.Marshal(publisher.EventPayload{
+		EventType: publisher.EventAccountCreated,
+		AccountID: "user-123",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return events.DynamoDBEventRecord{
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: sequence,
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"pk":      events.NewStringAttribute("ACCOUNT#user-123"),
+				"sk":      events.NewStringAttribute("OUTBOX#" + eventID),
+				"payload": events.NewStringAttribute(string(body)),
+			},
+		},
+	}
+}
+
+func TestHandler_DeliversAndDeletesRecord(t *testing.T) {
+	deliverer := &mockDeliverer{}
+	store := &mockOutboxStore{}
+	deps = &Dependencies{Deliverer: deliverer, Outbox: store}
+
+	response, err := handler(context.Background(), events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboxRecord(t, "1", "event-1")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.BatchItemFailures) != 0 {
+		t.Errorf("expected no failures, got %v", response.BatchItemFailures)
+	}
+	if len(deliverer.delivered) != 1 || deliverer.delivered[0].EventType != publisher.EventAccountCreated {
+		t.Errorf("expected account.created to be delivered, got %v", deliverer.delivered)
+	}
+	if len(store.deleted) != 1 || store.deleted[0] != "user-123/event-1" {
+		t.Errorf("expected outbox record to be deleted, got %v", store.deleted)
+	}
+}
+
+func TestHandler_DeliveryFails_ReportsOnlyFailedRecord(t *testing.T) {
+	deliverer := &mockDeliverer{err: errors.New("SQS error")}
+	store := &mockOutboxStore{}
+	deps = &Dependencies{Deliverer: deliverer, Outbox: store}
+
+	other := events.DynamoDBEventRecord{
+		EventName: "INSERT",
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: "1",
+			NewImage: map[string]events.DynamoDBAttributeValue{
+				"sk": events.NewStringAttribute("META#"),
+			},
+		},
+	}
+
+	response, err := handler(context.Background(), events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{other, outboxRecord(t, "2", "event-1")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.BatchItemFailures) != 1 || response.BatchItemFailures[0].ItemIdentifier != "2" {
+		t.Errorf("expected record 2 to be retried, got %v", response.BatchItemFailures)
+	}
+	if len(store.deleted) != 0 {
+		t.Error("expected undelivered record to be kept")
+	}
+}
+
+func TestHandler_DeleteFails_DoesNotRetry(t *testing.T) {
+	deps = &Dependencies{
+		Deliverer: &mockDeliverer{},
+		Outbox:    &mockOutboxStore{err: errors.New("DynamoDB error")},
+	}
+
+	response, err := handler(context.Background(), events.DynamoDBEvent{
+		Records: []events.DynamoDBEventRecord{outboxRecord(t, "1", "event-1")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(response.BatchItemFailures) != 0 {
+		t.Errorf("expected delivered record not to be retried, got %v", response.BatchItemFailures)
+	}
+}
+
+func TestHandler_IgnoresRemoveEvents(t *testing.T) {
+	deliverer := &mockDeliverer{}
+	deps = &Dependencies{Deliverer: deliverer, Outbox: &mockOutboxStore{}}
+
+	record := outboxRecord(t, "1", "event-1")
+	record.EventName = "REMOVE"
+
+	if _, err := handler(context.Background(), events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{record}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(deliverer.delivered) != 0 {
+		t.Error("expected REMOVE events to be ignored")
+	}
+}
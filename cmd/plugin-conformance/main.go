@@ -0,0 +1,469 @@
+// Command plugin-conformance checks that a plugin keeps the plugin contract
+// before it is registered. It invokes one of the plugin's methods, either as
+// a Lambda function (-function) or at an HTTP endpoint that accepts the
+// invocation request as a JSON POST (-url):
+//
+//	plugin-conformance -function arn:aws:lambda:...:function:mail-email-get \
+//	    -method Email/get -args '{"ids":[]}'
+//
+// The report covers:
+//
+//   - echo: the method responds under its own name, and Core/echo returns
+//     its arguments unchanged
+//   - error-mapping: an unknown method is answered with a JMAP method error,
+//     not a function error
+//   - client-id: the clientId is returned unchanged, including on errors
+//   - large-payload: a large request gets a well-formed response that fits in
+//     a Lambda response
+//   - timeout: every invocation finishes within core's plugin timeout
+//
+// It exits non-zero if any check fails.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-libs/plugincontract"
+)
+
+// unknownMethod is a method no plugin implements
+const unknownMethod = "Conformance/unknownMethod"
+
+// maxResponseBytes is the largest synchronous Lambda response
+const maxResponseBytes = 6 * 1024 * 1024
+
+// methodErrorTypes are the method-level error types of RFC 8620 section 3.6.2
+// and the standard methods of section 5
+var methodErrorTypes = map[string]bool{
+	"serverUnavailable":               true,
+	"serverFail":                      true,
+	"serverPartialFail":               true,
+	"unknownMethod":                   true,
+	"invalidArguments":                true,
+	"invalidResultReference":          true,
+	"forbidden":                       true,
+	"accountNotFound":                 true,
+	"accountNotSupportedByMethod":     true,
+	"accountReadOnly":                 true,
+	"requestTooLarge":                 true,
+	"cannotCalculateChanges":          true,
+	"stateMismatch":                   true,
+	"anchorNotFound":                  true,
+	"unsupportedSort":                 true,
+	"unsupportedFilter":               true,
+	"tooManyChanges":                  true,
+	"fromAccountNotFound":             true,
+	"fromAccountNotSupportedByMethod": true,
+}
+
+// clientIDs are sent to check the plugin returns them unchanged
+var clientIDs = []string{"c0", "conformance-7f3a", "#id with/odd chars ü"}
+
+// PluginTarget sends an invocation request payload to a plugin and returns
+// its response payload
+type PluginTarget interface {
+	Invoke(ctx context.Context, payload []byte) ([]byte, error)
+}
+
+// HTTPDoer sends HTTP requests
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Config holds the flags
+type Config struct {
+	Target      string // shown in the report
+	Method      string
+	Args        map[string]any
+	AccountID   string
+	PayloadSize int
+	Timeout     time.Duration
+	JSON        bool
+}
+
+// Dependencies for the checks (injectable for testing)
+type Dependencies struct {
+	Plugin PluginTarget
+	Config Config
+	Stdout io.Writer
+}
+
+var deps *Dependencies
+
+// CheckResult is the outcome of one check
+type CheckResult struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// Report is the compliance report
+type Report struct {
+	Target       string        `json:"target"`
+	Method       string        `json:"method"`
+	Passed       bool          `json:"passed"`
+	Checks       []CheckResult `json:"checks"`
+	MaxLatencyMs int64         `json:"maxLatencyMs"`
+}
+
+// invocation is the outcome of one call to the plugin
+type invocation struct {
+	response *plugin.PluginInvocationResponse
+	size     int
+	latency  time.Duration
+	err      error
+}
+
+// runner invokes the plugin and remembers every invocation for the timeout
+// check
+type runner struct {
+	invocations []invocation
+}
+
+// withAccount returns args with the configured accountId, unless args sets
+// its own
+func withAccount(args map[string]any) map[string]any {
+	callArgs := map[string]any{"accountId": deps.Config.AccountID}
+	for key, value := range args {
+		callArgs[key] = value
+	}
+	return callArgs
+}
+
+// invoke calls method with args, the configured account and clientID
+func (r *runner) invoke(ctx context.Context, method string, args map[string]any, clientID string) invocation {
+	request := plugin.PluginInvocationRequest{
+		PluginInvocationRequest: plugincontract.PluginInvocationRequest{
+			RequestID: fmt.Sprintf("conformance-%d", len(r.invocations)),
+			CallIndex: 0,
+			AccountID: deps.Config.AccountID,
+			Method:    method,
+			Args:      withAccount(args),
+			ClientID:  clientID,
+			CDNURL:    "https://cdn.conformance.invalid",
+			APIURL:    "https://api.conformance.invalid",
+		},
+		CorrelationID: "plugin-conformance",
+	}
+
+	result := r.send(ctx, request)
+	r.invocations = append(r.invocations, result)
+	return result
+}
+
+// send sends one request within the timeout
+func (r *runner) send(ctx context.Context, request plugin.PluginInvocationRequest) invocation {
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return invocation{err: fmt.Errorf("failed to marshal request: %w", err)}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, deps.Config.Timeout)
+	defer cancel()
+	start := time.Now()
+	output, err := deps.Plugin.Invoke(ctx, payload)
+	result := invocation{latency: time.Since(start), size: len(output)}
+	if err != nil {
+		result.err = err
+		return result
+	}
+
+	var response plugin.PluginInvocationResponse
+	if err := json.Unmarshal(output, &response); err != nil {
+		result.err = fmt.Errorf("invalid response: %w", err)
+		return result
+	}
+	if response.MethodResponse.Name == "" {
+		result.err = errors.New("response has no methodResponse name")
+		return result
+	}
+	result.response = &response
+	return result
+}
+
+// errorType returns the type of a method error response, or "" if the
+// response is not an error
+func errorType(response *plugin.PluginInvocationResponse) string {
+	if response.MethodResponse.Name != "error" {
+		return ""
+	}
+	errType, _ := response.MethodResponse.Args["type"].(string)
+	return errType
+}
+
+// normalise round-trips args through JSON so they compare as the plugin saw
+// them
+func normalise(args map[string]any) map[string]any {
+	data, _ := json.Marshal(args)
+	var out map[string]any
+	_ = json.Unmarshal(data, &out)
+	return out
+}
+
+// checkEcho calls the method with the sample arguments
+func (r *runner) checkEcho(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "echo"}
+	call := r.invoke(ctx, deps.Config.Method, deps.Config.Args, "c0")
+	switch {
+	case call.err != nil:
+		result.Detail = call.err.Error()
+	case call.response.MethodResponse.Name == "error":
+		result.Detail = fmt.Sprintf("%s returned a %q error for the sample arguments", deps.Config.Method, errorType(call.response))
+	case call.response.MethodResponse.Name != deps.Config.Method:
+		result.Detail = fmt.Sprintf("response is named %q, want %q", call.response.MethodResponse.Name, deps.Config.Method)
+	case deps.Config.Method == "Core/echo" && !reflect.DeepEqual(map[string]any(call.response.MethodResponse.Args), normalise(withAccount(deps.Config.Args))):
+		result.Detail = "Core/echo did not return its arguments unchanged"
+	default:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%s responded as %s", deps.Config.Method, call.response.MethodResponse.Name)
+	}
+	return result
+}
+
+// checkErrorMapping calls a method the plugin does not implement
+func (r *runner) checkErrorMapping(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "error-mapping"}
+	call := r.invoke(ctx, unknownMethod, nil, "c0")
+	switch {
+	case call.err != nil:
+		result.Detail = fmt.Sprintf("%s failed instead of returning a method error: %v", unknownMethod, call.err)
+	case call.response.MethodResponse.Name != "error":
+		result.Detail = fmt.Sprintf("%s returned %q, want an error response", unknownMethod, call.response.MethodResponse.Name)
+	case !methodErrorTypes[errorType(call.response)]:
+		result.Detail = fmt.Sprintf("error type %q is not a JMAP method error type", errorType(call.response))
+	default:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%s returned a %q error", unknownMethod, errorType(call.response))
+	}
+	return result
+}
+
+// checkClientID checks clientIds come back unchanged on success and error
+// responses
+func (r *runner) checkClientID(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "client-id"}
+	for _, method := range []string{deps.Config.Method, unknownMethod} {
+		for _, clientID := range clientIDs {
+			call := r.invoke(ctx, method, deps.Config.Args, clientID)
+			if call.err != nil {
+				result.Detail = fmt.Sprintf("%s with clientId %q: %v", method, clientID, call.err)
+				return result
+			}
+			if got := call.response.MethodResponse.ClientID; got != clientID {
+				result.Detail = fmt.Sprintf("%s returned clientId %q, want %q", method, got, clientID)
+				return result
+			}
+		}
+	}
+	result.Passed = true
+	result.Detail = fmt.Sprintf("%d clientIds returned unchanged", 2*len(clientIDs))
+	return result
+}
+
+// checkLargePayload sends the sample arguments padded to the payload size
+func (r *runner) checkLargePayload(ctx context.Context) CheckResult {
+	result := CheckResult{Name: "large-payload"}
+	args := map[string]any{"conformancePadding": strings.Repeat("x", deps.Config.PayloadSize)}
+	for key, value := range deps.Config.Args {
+		args[key] = value
+	}
+	call := r.invoke(ctx, deps.Config.Method, args, "c0")
+	switch {
+	case call.err != nil:
+		result.Detail = fmt.Sprintf("%d byte request failed: %v", deps.Config.PayloadSize, call.err)
+	case call.size > maxResponseBytes:
+		result.Detail = fmt.Sprintf("%d byte response exceeds the %d byte Lambda response limit", call.size, maxResponseBytes)
+	case call.response.MethodResponse.ClientID != "c0":
+		result.Detail = "response lost the clientId"
+	default:
+		result.Passed = true
+		result.Detail = fmt.Sprintf("%d byte request answered with %s (%d bytes)", deps.Config.PayloadSize, call.response.MethodResponse.Name, call.size)
+	}
+	return result
+}
+
+// checkTimeout checks every invocation so far finished within the timeout
+func (r *runner) checkTimeout() (CheckResult, time.Duration) {
+	result := CheckResult{Name: "timeout"}
+	var slowest time.Duration
+	for _, call := range r.invocations {
+		slowest = max(slowest, call.latency)
+		if errors.Is(call.err, context.DeadlineExceeded) || call.latency > deps.Config.Timeout {
+			result.Detail = fmt.Sprintf("an invocation took %s, over the %s plugin timeout", call.latency.Round(time.Millisecond), deps.Config.Timeout)
+			return result, slowest
+		}
+	}
+	result.Passed = true
+	result.Detail = fmt.Sprintf("slowest of %d invocations took %s (limit %s)", len(r.invocations), slowest.Round(time.Millisecond), deps.Config.Timeout)
+	return result, slowest
+}
+
+// run runs the checks in order and builds the report
+func run(ctx context.Context) Report {
+	r := &runner{}
+	report := Report{Target: deps.Config.Target, Method: deps.Config.Method, Passed: true}
+	report.Checks = append(report.Checks,
+		r.checkEcho(ctx),
+		r.checkErrorMapping(ctx),
+		r.checkClientID(ctx),
+		r.checkLargePayload(ctx),
+	)
+	timeout, slowest := r.checkTimeout()
+	report.Checks = append(report.Checks, timeout)
+	report.MaxLatencyMs = slowest.Milliseconds()
+
+	for _, check := range report.Checks {
+		report.Passed = report.Passed && check.Passed
+	}
+	return report
+}
+
+// writeReport writes the report as JSON or a table
+func writeReport(report Report) error {
+	if deps.Config.JSON {
+		encoder := json.NewEncoder(deps.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	fmt.Fprintf(deps.Stdout, "Plugin conformance: %s (%s)\n\n", report.Target, report.Method)
+	table := tabwriter.NewWriter(deps.Stdout, 0, 0, 2, ' ', 0)
+	passed := 0
+	for _, check := range report.Checks {
+		status := "FAIL"
+		if check.Passed {
+			status = "PASS"
+			passed++
+		}
+		fmt.Fprintf(table, "%s\t%s\t%s\n", status, check.Name, check.Detail)
+	}
+	if err := table.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(deps.Stdout, "\n%d/%d checks passed\n", passed, len(report.Checks))
+	return err
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// LambdaTarget invokes a plugin Lambda function as core does
+type LambdaTarget struct {
+	client   plugin.LambdaClient
+	function string
+}
+
+// Invoke invokes the function, treating a function error as a failure
+func (t *LambdaTarget) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	output, err := t.client.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(t.function),
+		Payload:      payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lambda invocation failed: %w", err)
+	}
+	if output.FunctionError != nil {
+		return output.Payload, fmt.Errorf("function error %s: %s", *output.FunctionError, bytes.TrimSpace(output.Payload))
+	}
+	return output.Payload, nil
+}
+
+// HTTPTarget POSTs invocation requests to a plugin running behind HTTP, such
+// as the Lambda runtime interface emulator
+type HTTPTarget struct {
+	client HTTPDoer
+	url    string
+}
+
+// Invoke POSTs the payload, treating a non-2xx status as a failure
+func (t *HTTPTarget) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return body, fmt.Errorf("unexpected status %d: %s", resp.StatusCode, bytes.TrimSpace(body))
+	}
+	return body, nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("plugin-conformance", flag.ExitOnError)
+	function := flags.String("function", "", "plugin Lambda function name or ARN")
+	endpoint := flags.String("url", "", "plugin HTTP endpoint, in place of -function")
+	flags.StringVar(&cfg.Method, "method", "Core/echo", "method to test")
+	args := flags.String("args", "{}", "sample method arguments as JSON")
+	flags.StringVar(&cfg.AccountID, "account", "conformance-account", "account ID to send")
+	flags.IntVar(&cfg.PayloadSize, "payload-size", 1024*1024, "padding added to the large-payload request, in bytes")
+	flags.DurationVar(&cfg.Timeout, "timeout", 25*time.Second, "plugin timeout each invocation must finish within")
+	flags.BoolVar(&cfg.JSON, "json", false, "write the report as JSON")
+	region := flags.String("region", "", "AWS region for -function (default from the AWS config)")
+	_ = flags.Parse(os.Args[1:])
+
+	if err := json.Unmarshal([]byte(*args), &cfg.Args); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin-conformance: invalid -args: %v\n", err)
+		os.Exit(2)
+	}
+
+	deps = &Dependencies{Config: cfg, Stdout: os.Stdout}
+	switch {
+	case *function != "" && *endpoint == "":
+		var options []func(*config.LoadOptions) error
+		if *region != "" {
+			options = append(options, config.WithRegion(*region))
+		}
+		awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "plugin-conformance: failed to load AWS config: %v\n", err)
+			os.Exit(2)
+		}
+		deps.Plugin = &LambdaTarget{client: lambda.NewFromConfig(awsConfig), function: *function}
+		deps.Config.Target = *function
+	case *endpoint != "" && *function == "":
+		deps.Plugin = &HTTPTarget{client: &http.Client{}, url: *endpoint}
+		deps.Config.Target = *endpoint
+	default:
+		fmt.Fprintln(os.Stderr, "plugin-conformance: exactly one of -function or -url is required")
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	report := run(ctx)
+	if err := writeReport(report); err != nil {
+		fmt.Fprintf(os.Stderr, "plugin-conformance: %v\n", err)
+		os.Exit(2)
+	}
+	if !report.Passed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// mockPlugin answers invocation requests with handle, defaulting to a
+// well-behaved Core/echo
+type mockPlugin struct {
+	handle   func(request plugin.PluginInvocationRequest) (any, error)
+	requests []plugin.PluginInvocationRequest
+}
+
+func (m *mockPlugin) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var request plugin.PluginInvocationRequest
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, err
+	}
+	m.requests = append(m.requests, request)
+	handle := m.handle
+	if handle == nil {
+		handle = echoPlugin
+	}
+	response, err := handle(request)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(response)
+}
+
+// echoPlugin behaves as Core/echo does
+func echoPlugin(request plugin.PluginInvocationRequest) (any, error) {
+	if request.Method != "Core/echo" {
+		return plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+			Name:     "error",
+			Args:     map[string]any{"type": "unknownMethod"},
+			ClientID: request.ClientID,
+		}}, nil
+	}
+	return plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+		Name:     request.Method,
+		Args:     request.Args,
+		ClientID: request.ClientID,
+	}}, nil
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(mock *mockPlugin, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	if cfg.Method == "" {
+		cfg.Method = "Core/echo"
+	}
+	if cfg.AccountID == "" {
+		cfg.AccountID = "conformance-account"
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Second
+	}
+	if cfg.PayloadSize == 0 {
+		cfg.PayloadSize = 1024
+	}
+	deps = &Dependencies{Plugin: mock, Config: cfg, Stdout: &stdout}
+	return &stdout
+}
+
+// checkByName returns the named check from a report
+func checkByName(t *testing.T, report Report, name string) CheckResult {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("report has no %s check", name)
+	return CheckResult{}
+}
+
+func TestRun_ConformingPlugin(t *testing.T) {
+	mock := &mockPlugin{}
+	setupTestDeps(mock, Config{Args: map[string]any{"hello": "world", "n": 1}})
+
+	report := run(context.Background())
+
+	if !report.Passed {
+		t.Fatalf("expected all checks to pass, got %+v", report.Checks)
+	}
+	if len(report.Checks) != 5 {
+		t.Errorf("expected 5 checks, got %d", len(report.Checks))
+	}
+	first := mock.requests[0]
+	if first.AccountID != "conformance-account" || first.Args["accountId"] != "conformance-account" || first.Args["hello"] != "world" {
+		t.Errorf("unexpected request %+v", first)
+	}
+}
+
+func TestRun_EchoAltersArgs(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		response, _ := echoPlugin(request)
+		if request.Method == "Core/echo" {
+			response.(plugin.PluginInvocationResponse).MethodResponse.Args["extra"] = true
+		}
+		return response, nil
+	}}
+	setupTestDeps(mock, Config{Args: map[string]any{"hello": "world"}})
+
+	report := run(context.Background())
+
+	if check := checkByName(t, report, "echo"); check.Passed {
+		t.Errorf("expected echo to fail, got %+v", check)
+	}
+	if report.Passed {
+		t.Error("expected report to fail")
+	}
+}
+
+func TestRun_WrongResponseName(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		return plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+			Name: "Email/got", ClientID: request.ClientID,
+		}}, nil
+	}}
+	setupTestDeps(mock, Config{Method: "Email/get"})
+
+	report := run(context.Background())
+
+	check := checkByName(t, report, "echo")
+	if check.Passed || !strings.Contains(check.Detail, `"Email/got"`) {
+		t.Errorf("expected echo to fail on the name, got %+v", check)
+	}
+}
+
+func TestRun_UnknownMethodFunctionError(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		if request.Method == unknownMethod {
+			return nil, errors.New("function error Unhandled: unknown method")
+		}
+		return echoPlugin(request)
+	}}
+	setupTestDeps(mock, Config{})
+
+	report := run(context.Background())
+
+	if check := checkByName(t, report, "error-mapping"); check.Passed {
+		t.Errorf("expected error-mapping to fail, got %+v", check)
+	}
+	if check := checkByName(t, report, "echo"); !check.Passed {
+		t.Errorf("expected echo to pass, got %+v", check)
+	}
+}
+
+func TestRun_NonJMAPErrorType(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		if request.Method == unknownMethod {
+			return plugin.PluginInvocationResponse{MethodResponse: plugin.MethodResponse{
+				Name: "error", Args: map[string]any{"type": "NotImplemented"}, ClientID: request.ClientID,
+			}}, nil
+		}
+		return echoPlugin(request)
+	}}
+	setupTestDeps(mock, Config{})
+
+	check := checkByName(t, run(context.Background()), "error-mapping")
+
+	if check.Passed || !strings.Contains(check.Detail, "NotImplemented") {
+		t.Errorf("expected error-mapping to fail on the type, got %+v", check)
+	}
+}
+
+func TestRun_ClientIDNotEchoedOnError(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		response, _ := echoPlugin(request)
+		if request.Method == unknownMethod {
+			resp := response.(plugin.PluginInvocationResponse)
+			resp.MethodResponse.ClientID = "c0"
+			return resp, nil
+		}
+		return response, nil
+	}}
+	setupTestDeps(mock, Config{})
+
+	check := checkByName(t, run(context.Background()), "client-id")
+
+	if check.Passed || !strings.Contains(check.Detail, unknownMethod) {
+		t.Errorf("expected client-id to fail for the error response, got %+v", check)
+	}
+}
+
+func TestRun_LargePayload(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		if _, ok := request.Args["conformancePadding"]; ok {
+			return nil, errors.New("function error Unhandled: out of memory")
+		}
+		return echoPlugin(request)
+	}}
+	setupTestDeps(mock, Config{PayloadSize: 4096})
+
+	report := run(context.Background())
+
+	check := checkByName(t, report, "large-payload")
+	if check.Passed || !strings.Contains(check.Detail, "4096 byte request failed") {
+		t.Errorf("expected large-payload to fail, got %+v", check)
+	}
+	padding, _ := mock.requests[len(mock.requests)-1].Args["conformancePadding"].(string)
+	if len(padding) != 4096 {
+		t.Errorf("expected 4096 bytes of padding, got %d", len(padding))
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	mock := &mockPlugin{handle: func(request plugin.PluginInvocationRequest) (any, error) {
+		if request.Method == unknownMethod {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return echoPlugin(request)
+	}}
+	setupTestDeps(mock, Config{Timeout: 10 * time.Millisecond})
+
+	report := run(context.Background())
+
+	if check := checkByName(t, report, "timeout"); check.Passed {
+		t.Errorf("expected timeout to fail, got %+v", check)
+	}
+	if report.MaxLatencyMs < 20 {
+		t.Errorf("expected max latency of at least 20ms, got %d", report.MaxLatencyMs)
+	}
+}
+
+func TestWriteReport(t *testing.T) {
+	report := Report{Target: "arn:plugin", Method: "Core/echo", Checks: []CheckResult{
+		{Name: "echo", Passed: true, Detail: "ok"},
+		{Name: "timeout", Detail: "too slow"},
+	}}
+
+	stdout := setupTestDeps(&mockPlugin{}, Config{})
+	if err := writeReport(report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, want := range []string{"arn:plugin (Core/echo)", "PASS  echo", "FAIL  timeout", "1/2 checks passed"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("expected %q in report:\n%s", want, stdout.String())
+		}
+	}
+
+	stdout = setupTestDeps(&mockPlugin{}, Config{JSON: true})
+	if err := writeReport(report); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded Report
+	if err := json.Unmarshal(stdout.Bytes(), &decoded); err != nil || len(decoded.Checks) != 2 {
+		t.Errorf("expected JSON report, got %s (%v)", stdout.String(), err)
+	}
+}
+
+// mockLambdaClient returns a canned invocation output
+type mockLambdaClient struct {
+	output *lambda.InvokeOutput
+	input  *lambda.InvokeInput
+}
+
+func (m *mockLambdaClient) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	m.input = params
+	return m.output, nil
+}
+
+func TestLambdaTarget_FunctionError(t *testing.T) {
+	client := &mockLambdaClient{output: &lambda.InvokeOutput{
+		FunctionError: aws.String("Unhandled"),
+		Payload:       []byte(`{"errorMessage":"boom"}`),
+	}}
+	target := &LambdaTarget{client: client, function: "arn:plugin"}
+
+	_, err := target.Invoke(context.Background(), []byte(`{}`))
+
+	if err == nil || !strings.Contains(err.Error(), "Unhandled") || !strings.Contains(err.Error(), "boom") {
+		t.Errorf("expected function error, got %v", err)
+	}
+	if aws.ToString(client.input.FunctionName) != "arn:plugin" {
+		t.Errorf("unexpected function %q", aws.ToString(client.input.FunctionName))
+	}
+}
+
+// mockHTTPClient returns a canned response and records the request
+type mockHTTPClient struct {
+	statusCode int
+	body       string
+	request    *http.Request
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.request = req
+	return &http.Response{StatusCode: m.statusCode, Body: io.NopCloser(strings.NewReader(m.body))}, nil
+}
+
+func TestHTTPTarget(t *testing.T) {
+	client := &mockHTTPClient{statusCode: http.StatusOK, body: `{"methodResponse":{}}`}
+	target := &HTTPTarget{client: client, url: "http://localhost:9000/2015-03-31/functions/function/invocations"}
+
+	body, err := target.Invoke(context.Background(), []byte(`{}`))
+	if err != nil || string(body) != `{"methodResponse":{}}` {
+		t.Fatalf("unexpected response %q, %v", body, err)
+	}
+	if client.request.Method != http.MethodPost || client.request.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected request %s %v", client.request.Method, client.request.Header)
+	}
+
+	client.statusCode = http.StatusBadGateway
+	if _, err := target.Invoke(context.Background(), []byte(`{}`)); err == nil || !strings.Contains(err.Error(), "502") {
+		t.Errorf("expected status error, got %v", err)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/deadletter"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+var logger = loglevel.New()
+
+// EventPublisher publishes events to subscribed plugins
+type EventPublisher interface {
+	Publish(ctx context.Context, payload publisher.EventPayload) error
+}
+
+// GraceClearer ends quota grace periods
+type GraceClearer interface {
+	ClearQuotaGrace(ctx context.Context, accountID string) error
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Publisher EventPublisher
+	Accounts  GraceClearer
+	// Thresholds are percentages of quota remaining, in descending order. A
+	// threshold of zero is reported as quota.exceeded.
+	Thresholds []int
+}
+
+var deps *Dependencies
+
+// handler publishes quota events for META# updates that take an account's
+// remaining quota across a threshold or into the quota grace band. Records
+// that fail are reported back so the stream retries them.
+func handler(ctx context.Context, event events.DynamoDBEvent) (events.DynamoDBEventResponse, error) {
+	var response events.DynamoDBEventResponse
+	for _, record := range event.Records {
+		if err := processRecord(ctx, record); err != nil {
+			response.BatchItemFailures = append(response.BatchItemFailures, events.DynamoDBBatchItemFailure{
+				ItemIdentifier: record.Change.SequenceNumber,
+			})
+		}
+	}
+	return response, nil
+}
+
+// processRecord publishes the quota events of a META# update, and ends the
+// account's quota grace period once it is back within quota
+func processRecord(ctx context.Context, record events.DynamoDBEventRecord) error {
+	// Only process MODIFY events
+	if record.EventName != "MODIFY" {
+		return nil
+	}
+
+	newImage := record.Change.NewImage
+	oldImage := record.Change.OldImage
+	if sk, _ := extractStringAttribute(newImage, dbclient.AttrSK); sk != dbclient.SKMeta {
+		return nil
+	}
+
+	pk, _ := extractStringAttribute(newImage, dbclient.AttrPK)
+	accountID := strings.TrimPrefix(pk, dbclient.PrefixAccount)
+
+	occurredAt := record.Change.ApproximateCreationDateTime.Time
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+
+	if err := publishThresholdEvent(ctx, accountID, occurredAt, oldImage, newImage); err != nil {
+		return err
+	}
+	return processQuotaGrace(ctx, accountID, occurredAt, oldImage, newImage)
+}
+
+// publishThresholdEvent publishes a quota event if the update crossed a
+// threshold
+func publishThresholdEvent(ctx context.Context, accountID string, occurredAt time.Time, oldImage, newImage map[string]events.DynamoDBAttributeValue) error {
+	threshold, ok := crossedThreshold(deps.Thresholds,
+		extractNumberAttribute(oldImage, "quotaBytes"), extractNumberAttribute(oldImage, "quotaRemaining"),
+		extractNumberAttribute(newImage, "quotaBytes"), extractNumberAttribute(newImage, "quotaRemaining"),
+	)
+	if !ok {
+		return nil
+	}
+
+	eventType := publisher.EventQuotaWarning
+	if threshold == 0 {
+		eventType = publisher.EventQuotaExceeded
+	}
+
+	payload := publisher.EventPayload{
+		EventType:  eventType,
+		OccurredAt: occurredAt.UTC().Format(time.RFC3339),
+		AccountID:  accountID,
+		Data: map[string]any{
+			"thresholdPercent": threshold,
+			"quotaBytes":       extractNumberAttribute(newImage, "quotaBytes"),
+			"quotaRemaining":   extractNumberAttribute(newImage, "quotaRemaining"),
+		},
+	}
+	if err := deps.Publisher.Publish(ctx, payload); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish quota event",
+			slog.String("account_id", accountID),
+			slog.String("event_type", eventType),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	logger.InfoContext(ctx, "Published quota event",
+		slog.String("account_id", accountID),
+		slog.String("event_type", eventType),
+		slog.Int("threshold_percent", threshold),
+	)
+	return nil
+}
+
+// processQuotaGrace publishes a quota.warning for each allocation Blob/allocate
+// let take the account further over quota during its grace period, and ends
+// the grace period once usage is back within quota
+func processQuotaGrace(ctx context.Context, accountID string, occurredAt time.Time, oldImage, newImage map[string]events.DynamoDBAttributeValue) error {
+	graceExpiresAt, ok := extractStringAttribute(newImage, "quotaGraceExpiresAt")
+	if !ok {
+		return nil
+	}
+
+	newRemaining := extractNumberAttribute(newImage, "quotaRemaining")
+	if newRemaining >= 0 {
+		if err := deps.Accounts.ClearQuotaGrace(ctx, accountID); err != nil {
+			logger.ErrorContext(ctx, "Failed to end quota grace period",
+				slog.String("account_id", accountID),
+				slog.String("error", err.Error()),
+			)
+			return err
+		}
+		logger.InfoContext(ctx, "Quota grace period ended",
+			slog.String("account_id", accountID),
+		)
+		return nil
+	}
+	if newRemaining >= extractNumberAttribute(oldImage, "quotaRemaining") {
+		return nil
+	}
+
+	payload := publisher.EventPayload{
+		EventType:  publisher.EventQuotaWarning,
+		OccurredAt: occurredAt.UTC().Format(time.RFC3339),
+		AccountID:  accountID,
+		Data: map[string]any{
+			"graceExpiresAt": graceExpiresAt,
+			"quotaBytes":     extractNumberAttribute(newImage, "quotaBytes"),
+			"quotaRemaining": newRemaining,
+		},
+	}
+	if err := deps.Publisher.Publish(ctx, payload); err != nil {
+		logger.ErrorContext(ctx, "Failed to publish quota grace warning",
+			slog.String("account_id", accountID),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	logger.InfoContext(ctx, "Published quota grace warning",
+		slog.String("account_id", accountID),
+		slog.String("grace_expires_at", graceExpiresAt),
+	)
+	return nil
+}
+
+// crossedThreshold returns the lowest threshold that the remaining share of
+// quota was above before the update and is at or below after it. Thresholds
+// re-arm when the remaining quota rises above them again.
+func crossedThreshold(thresholds []int, oldQuota, oldRemaining, newQuota, newRemaining int64) (int, bool) {
+	if newQuota <= 0 {
+		return 0, false
+	}
+
+	crossed, ok := 0, false
+	for _, threshold := range thresholds {
+		wasAbove := oldQuota <= 0 || oldRemaining*100 > int64(threshold)*oldQuota
+		isAtOrBelow := newRemaining*100 <= int64(threshold)*newQuota
+		if wasAbove && isAtOrBelow {
+			crossed, ok = threshold, true
+		}
+	}
+	return crossed, ok
+}
+
+// parseThresholds parses a comma-separated list of percentages of quota
+// remaining, e.g. "10,0", into descending order
+func parseThresholds(value string) ([]int, error) {
+	var thresholds []int
+	for _, part := range strings.Split(value, ",") {
+		percent, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || percent < 0 || percent >= 100 {
+			return nil, fmt.Errorf("invalid quota alert threshold %q", part)
+		}
+		thresholds = append(thresholds, percent)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+	return thresholds, nil
+}
+
+// extractStringAttribute extracts a string value from a DynamoDB stream attribute map
+func extractStringAttribute(image map[string]events.DynamoDBAttributeValue, key string) (string, bool) {
+	attr, ok := image[key]
+	if !ok || attr.DataType() != events.DataTypeString {
+		return "", false
+	}
+	return attr.String(), true
+}
+
+// extractNumberAttribute extracts a number value from a DynamoDB stream attribute map
+func extractNumberAttribute(image map[string]events.DynamoDBAttributeValue, key string) int64 {
+	attr, ok := image[key]
+	if !ok || attr.DataType() != events.DataTypeNumber {
+		return 0
+	}
+	val, _ := attr.Integer()
+	return val
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadQuotaAlerts(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	thresholds, err := parseThresholds(cfg.Thresholds)
+	if err != nil {
+		logger.Error("FATAL: QUOTA_ALERT_THRESHOLDS must be a comma-separated list of percentages",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load plugin registry for event targets
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+	eventPublisher := publisher.FromConfig(result.Config, registry).
+		WithDeadLetters(deadletter.NewDynamoDBStore(dynamoClient, tableName)).
+		WithEventLog(eventlog.NewDynamoDBStore(dynamoClient, tableName))
+
+	deps = &Dependencies{
+		Publisher:  eventPublisher,
+		Accounts:   account.NewDynamoDBStore(dynamoClient, tableName),
+		Thresholds: thresholds,
+	}
+
+	result.Start(handler)
+}
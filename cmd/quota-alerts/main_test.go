@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockPublisher struct {
+	published []publisher.EventPayload
+	err       error
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, payload publisher.EventPayload) error {
+	m.published = append(m.published, payload)
+	return m.err
+}
+
+type mockGraceClearer struct {
+	cleared []string
+	err     error
+}
+
+func (m *mockGraceClearer) ClearQuotaGrace(ctx context.Context, accountID string) error {
+	m.cleared = append(m.cleared, accountID)
+	return m.err
+}
+
+func metaImage(quotaBytes, quotaRemaining int64) map[string]events.DynamoDBAttributeValue {
+	return map[string]events.DynamoDBAttributeValue{
+		"pk":             events.NewStringAttribute("ACCOUNT#user-123"),
+		"sk":             events.NewStringAttribute("META#"),
+		"quotaBytes":     events.NewNumberAttribute(strconv.FormatInt(quotaBytes, 10)),
+		"quotaRemaining": events.NewNumberAttribute(strconv.FormatInt(quotaRemaining, 10)),
+	}
+}
+
+func metaUpdate(oldRemaining, newRemaining int64) events.DynamoDBEvent {
+	return events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{{
+		EventName: "MODIFY",
+		Change: events.DynamoDBStreamRecord{
+			SequenceNumber: "1",
+			OldImage:       metaImage(1000, oldRemaining),
+			NewImage:       metaImage(1000, newRemaining),
+		},
+	}}}
+}
+
+func TestHandler_PublishesQuotaEvents(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldRemaining int64
+		newRemaining int64
+		eventType    string
+		threshold    int
+	}{
+		{name: "warning", oldRemaining: 150, newRemaining: 100, eventType: publisher.EventQuotaWarning, threshold: 10},
+		{name: "exceeded", oldRemaining: 50, newRemaining: 0, eventType: publisher.EventQuotaExceeded, threshold: 0},
+		{name: "both crossed reports the lowest", oldRemaining: 500, newRemaining: -10, eventType: publisher.EventQuotaExceeded, threshold: 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pub := &mockPublisher{}
+			deps = &Dependencies{Publisher: pub, Thresholds: []int{10, 0}}
+
+			resp, _ := handler(context.Background(), metaUpdate(tc.oldRemaining, tc.newRemaining))
+			if len(resp.BatchItemFailures) != 0 {
+				t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
+			}
+			if len(pub.published) != 1 {
+				t.Fatalf("expected one event, got %d", len(pub.published))
+			}
+			event := pub.published[0]
+			if event.EventType != tc.eventType || event.AccountID != "user-123" || event.Data["thresholdPercent"] != tc.threshold {
+				t.Errorf("unexpected event: %+v", event)
+			}
+		})
+	}
+}
+
+func TestHandler_NoEventWithoutCrossing(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldRemaining int64
+		newRemaining int64
+	}{
+		{name: "above thresholds", oldRemaining: 500, newRemaining: 400},
+		{name: "already below", oldRemaining: 90, newRemaining: 80},
+		{name: "quota freed", oldRemaining: 0, newRemaining: 200},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pub := &mockPublisher{}
+			deps = &Dependencies{Publisher: pub, Thresholds: []int{10, 0}}
+
+			_, _ = handler(context.Background(), metaUpdate(tc.oldRemaining, tc.newRemaining))
+			if len(pub.published) != 0 {
+				t.Errorf("expected no events, got %+v", pub.published)
+			}
+		})
+	}
+}
+
+func TestHandler_IgnoresOtherRecords(t *testing.T) {
+	pub := &mockPublisher{}
+	deps = &Dependencies{Publisher: pub, Thresholds: []int{10, 0}}
+
+	event := metaUpdate(150, 0)
+	event.Records[0].Change.NewImage["sk"] = events.NewStringAttribute("BLOB#abc")
+	_, _ = handler(context.Background(), event)
+
+	insert := metaUpdate(150, 0)
+	insert.Records[0].EventName = "INSERT"
+	_, _ = handler(context.Background(), insert)
+
+	if len(pub.published) != 0 {
+		t.Errorf("expected no events, got %+v", pub.published)
+	}
+}
+
+func TestHandler_PublishFails_ReportsBatchItemFailure(t *testing.T) {
+	deps = &Dependencies{Publisher: &mockPublisher{err: errors.New("publish error")}, Thresholds: []int{0}}
+
+	resp, _ := handler(context.Background(), metaUpdate(50, 0))
+	if len(resp.BatchItemFailures) != 1 || resp.BatchItemFailures[0].ItemIdentifier != "1" {
+		t.Errorf("expected the record to be retried, got %+v", resp.BatchItemFailures)
+	}
+}
+
+// graceUpdate is a META# update of an account in its quota grace period
+func graceUpdate(oldRemaining, newRemaining int64) events.DynamoDBEvent {
+	event := metaUpdate(oldRemaining, newRemaining)
+	event.Records[0].Change.NewImage["quotaGraceExpiresAt"] = events.NewStringAttribute("2025-01-08T00:00:00Z")
+	return event
+}
+
+func TestHandler_GraceAllocation_PublishesWarning(t *testing.T) {
+	pub := &mockPublisher{}
+	accounts := &mockGraceClearer{}
+	deps = &Dependencies{Publisher: pub, Accounts: accounts}
+
+	resp, _ := handler(context.Background(), graceUpdate(-10, -60))
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
+	}
+	if len(pub.published) != 1 {
+		t.Fatalf("expected one event, got %d", len(pub.published))
+	}
+	event := pub.published[0]
+	if event.EventType != publisher.EventQuotaWarning || event.Data["graceExpiresAt"] != "2025-01-08T00:00:00Z" || event.Data["quotaRemaining"] != int64(-60) {
+		t.Errorf("unexpected event: %+v", event)
+	}
+	if len(accounts.cleared) != 0 {
+		t.Errorf("expected grace to be kept, got %v", accounts.cleared)
+	}
+}
+
+func TestHandler_GraceRelease_NoWarning(t *testing.T) {
+	pub := &mockPublisher{}
+	deps = &Dependencies{Publisher: pub, Accounts: &mockGraceClearer{}}
+
+	_, _ = handler(context.Background(), graceUpdate(-60, -10))
+
+	if len(pub.published) != 0 {
+		t.Errorf("expected no events, got %+v", pub.published)
+	}
+}
+
+func TestHandler_BackWithinQuota_ClearsGrace(t *testing.T) {
+	accounts := &mockGraceClearer{}
+	deps = &Dependencies{Publisher: &mockPublisher{}, Accounts: accounts}
+
+	resp, _ := handler(context.Background(), graceUpdate(-10, 20))
+	if len(resp.BatchItemFailures) != 0 {
+		t.Fatalf("unexpected failures: %+v", resp.BatchItemFailures)
+	}
+	if len(accounts.cleared) != 1 || accounts.cleared[0] != "user-123" {
+		t.Errorf("expected grace to be cleared, got %v", accounts.cleared)
+	}
+
+	deps.Accounts = &mockGraceClearer{err: errors.New("dynamo down")}
+	resp, _ = handler(context.Background(), graceUpdate(-10, 20))
+	if len(resp.BatchItemFailures) != 1 {
+		t.Errorf("expected the record to be retried, got %+v", resp.BatchItemFailures)
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := parseThresholds("0, 10,5")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(thresholds) != 3 || thresholds[0] != 10 || thresholds[1] != 5 || thresholds[2] != 0 {
+		t.Errorf("expected descending thresholds, got %v", thresholds)
+	}
+
+	for _, value := range []string{"", "abc", "-1", "100", "10,"} {
+		if _, err := parseThresholds(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
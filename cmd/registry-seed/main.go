@@ -0,0 +1,434 @@
+// Command registry-seed loads a declarative manifest of plugins into the
+// plugin registry. It is idempotent: each plugin record is written only when
+// it differs from the manifest, keeping its original registeredAt, so it can
+// be re-run on every deploy or environment bring-up.
+//
+//	registry-seed -table jmap-test plugins.yaml
+//
+// The manifest is YAML or JSON, and ${VAR} references in it are replaced from
+// the environment, so one manifest can serve every environment:
+//
+//	plugins:
+//	  - pluginId: mail
+//	    version: 1.4.0
+//	    capabilities:
+//	      urn:ietf:params:jmap:mail: {maxMailboxesPerEmail: 10}
+//	    methods:
+//	      Email/get: {invokeTarget: "${MAIL_EMAIL_GET_ARN}", capability: "urn:ietf:params:jmap:mail"}
+//	    events:
+//	      account.created: {targetType: sqs, targetArn: "${MAIL_EVENTS_QUEUE_ARN}"}
+//	    clientPrincipals: ["${MAIL_ROLE_ARN}"]
+//
+// With -prune, plugin records not in the manifest are deleted.
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/argschema"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/querypage"
+	"github.com/jarrod-lowe/jmap-service-core/pkg/statetoken"
+	"gopkg.in/yaml.v3"
+)
+
+// lambdaInvoke is the only method invocation type core supports
+const lambdaInvoke = "lambda-invoke"
+
+// eventTargetTypes are the event target types the publisher delivers to
+var eventTargetTypes = []string{"sqs", "sns", "eventbridge", "webhook", "lambda"}
+
+// Manifest is the declarative registry contents
+type Manifest struct {
+	Plugins []PluginManifest `yaml:"plugins"`
+}
+
+// PluginManifest declares one plugin
+type PluginManifest struct {
+	PluginID           string                    `yaml:"pluginId"`
+	Version            string                    `yaml:"version"`
+	Capabilities       map[string]map[string]any `yaml:"capabilities"`
+	Methods            map[string]MethodManifest `yaml:"methods"`
+	Events             map[string]EventManifest  `yaml:"events"`
+	EventSchemaVersion int                       `yaml:"eventSchemaVersion"`
+	ClientPrincipals   []string                  `yaml:"clientPrincipals"`
+	CallbackSecretArn  string                    `yaml:"callbackSecretArn"`
+	ClientProfiles     map[string][]string       `yaml:"clientProfiles"`
+}
+
+// MethodManifest declares a method's handler
+type MethodManifest struct {
+	InvocationType string         `yaml:"invocationType"` // defaults to lambda-invoke
+	InvokeTarget   string         `yaml:"invokeTarget"`
+	Async          bool           `yaml:"async"`
+	Capability     string         `yaml:"capability"`  // capability a request must list in using to call the method
+	ArgsSchema     map[string]any `yaml:"argsSchema"`  // JSON Schema the method's arguments are validated against
+	Paging         bool           `yaml:"paging"`      // a /query method following the paging contract of pkg/querypage
+	StateTokens    bool           `yaml:"stateTokens"` // a /changes or /queryChanges method taking pkg/statetoken state tokens
+}
+
+// EventManifest declares where an event is delivered
+type EventManifest struct {
+	TargetType string `yaml:"targetType"`
+	TargetArn  string `yaml:"targetArn"`
+	DetailType string `yaml:"detailType"`
+	SecretArn  string `yaml:"secretArn"`
+}
+
+// PluginStore reads and writes plugin records
+type PluginStore interface {
+	ListPlugins(ctx context.Context) ([]plugin.PluginRecord, error)
+	PutPlugin(ctx context.Context, record plugin.PluginRecord) error
+	DeletePlugin(ctx context.Context, pluginID string) error
+}
+
+// Config holds the flags
+type Config struct {
+	DryRun bool
+	Prune  bool
+}
+
+// Dependencies for seeding (injectable for testing)
+type Dependencies struct {
+	Store  PluginStore
+	Config Config
+	Stdout io.Writer
+	Now    func() time.Time
+}
+
+var deps *Dependencies
+
+// parseManifest expands ${VAR} references from the environment and decodes
+// the manifest, rejecting unknown fields
+func parseManifest(data []byte) (*Manifest, error) {
+	var missing []string
+	expanded := os.Expand(string(data), func(name string) string {
+		value, ok := os.LookupEnv(name)
+		if !ok && !slices.Contains(missing, name) {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("manifest references unset environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(expanded))
+	decoder.KnownFields(true)
+	var manifest Manifest
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if err := validate(&manifest); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+// validate rejects manifests the registry would load wrongly, such as a
+// method registered by two plugins, where the last one loaded wins
+func validate(manifest *Manifest) error {
+	plugins := make(map[string]bool)
+	methods := make(map[string]string)
+	for _, p := range manifest.Plugins {
+		if p.PluginID == "" {
+			return errors.New("plugin without a pluginId")
+		}
+		if plugins[p.PluginID] {
+			return fmt.Errorf("plugin %s is declared twice", p.PluginID)
+		}
+		plugins[p.PluginID] = true
+
+		for name, method := range p.Methods {
+			if owner, ok := methods[name]; ok {
+				return fmt.Errorf("method %s is registered by both %s and %s", name, owner, p.PluginID)
+			}
+			methods[name] = p.PluginID
+			if method.InvocationType != "" && method.InvocationType != lambdaInvoke {
+				return fmt.Errorf("plugin %s method %s: unsupported invocationType %q", p.PluginID, name, method.InvocationType)
+			}
+			if method.InvokeTarget == "" {
+				return fmt.Errorf("plugin %s method %s has no invokeTarget", p.PluginID, name)
+			}
+			if method.ArgsSchema != nil {
+				if _, err := argschema.Compile(method.ArgsSchema); err != nil {
+					return fmt.Errorf("plugin %s method %s: %w", p.PluginID, name, err)
+				}
+			}
+			if method.Paging && !querypage.IsQuery(name) {
+				return fmt.Errorf("plugin %s method %s: paging is only for /query methods", p.PluginID, name)
+			}
+			if method.StateTokens && statetoken.SinceArgument(name) == "" {
+				return fmt.Errorf("plugin %s method %s: stateTokens is only for /changes and /queryChanges methods", p.PluginID, name)
+			}
+		}
+		for name, event := range p.Events {
+			if !slices.Contains(eventTargetTypes, event.TargetType) {
+				return fmt.Errorf("plugin %s event %s: targetType must be one of %s", p.PluginID, name, strings.Join(eventTargetTypes, ", "))
+			}
+			if event.TargetArn == "" {
+				return fmt.Errorf("plugin %s event %s has no targetArn", p.PluginID, name)
+			}
+		}
+		for name, capabilities := range p.ClientProfiles {
+			if name == "" {
+				return fmt.Errorf("plugin %s has a client profile without a name", p.PluginID)
+			}
+			if len(capabilities) == 0 {
+				return fmt.Errorf("plugin %s client profile %s lists no capabilities", p.PluginID, name)
+			}
+		}
+	}
+	return nil
+}
+
+// toRecord builds the plugin record for a manifest entry
+func toRecord(p PluginManifest, registeredAt string) plugin.PluginRecord {
+	record := plugin.PluginRecord{
+		PK:                 plugin.PluginPrefix,
+		SK:                 plugin.PluginPrefix + p.PluginID,
+		PluginID:           p.PluginID,
+		Capabilities:       p.Capabilities,
+		Methods:            make(map[string]plugin.MethodTarget, len(p.Methods)),
+		EventSchemaVersion: p.EventSchemaVersion,
+		ClientPrincipals:   p.ClientPrincipals,
+		CallbackSecretArn:  p.CallbackSecretArn,
+		ClientProfiles:     p.ClientProfiles,
+		RegisteredAt:       registeredAt,
+		Version:            p.Version,
+	}
+	if record.Capabilities == nil {
+		record.Capabilities = make(map[string]map[string]any)
+	}
+	for name, method := range p.Methods {
+		invocationType := method.InvocationType
+		if invocationType == "" {
+			invocationType = lambdaInvoke
+		}
+		record.Methods[name] = plugin.MethodTarget{InvocationType: invocationType, InvokeTarget: method.InvokeTarget, Async: method.Async, Capability: method.Capability, ArgsSchema: method.ArgsSchema, Paging: method.Paging, StateTokens: method.StateTokens}
+	}
+	if len(p.Events) > 0 {
+		record.Events = make(map[string]plugin.EventTarget, len(p.Events))
+		for name, event := range p.Events {
+			record.Events[name] = plugin.EventTarget(event)
+		}
+	}
+	return record
+}
+
+// sameRecord reports whether two records would be stored identically
+func sameRecord(a, b plugin.PluginRecord) bool {
+	itemA, errA := attributevalue.MarshalMap(a)
+	itemB, errB := attributevalue.MarshalMap(b)
+	return errA == nil && errB == nil && reflect.DeepEqual(itemA, itemB)
+}
+
+// seed writes the manifest's plugins that differ from the stored records,
+// and with -prune deletes the stored plugins the manifest does not declare
+func seed(ctx context.Context, manifest *Manifest) error {
+	existing, err := deps.Store.ListPlugins(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list plugins: %w", err)
+	}
+	stored := make(map[string]plugin.PluginRecord, len(existing))
+	for _, record := range existing {
+		stored[record.PluginID] = record
+	}
+
+	prefix := ""
+	if deps.Config.DryRun {
+		prefix = "would have "
+	}
+	declared := make(map[string]bool)
+	for _, p := range manifest.Plugins {
+		declared[p.PluginID] = true
+		current, found := stored[p.PluginID]
+		registeredAt := deps.Now().UTC().Format(time.RFC3339)
+		if found {
+			registeredAt = current.RegisteredAt
+		}
+		record := toRecord(p, registeredAt)
+
+		action := "created"
+		if found {
+			if sameRecord(current, record) {
+				fmt.Fprintf(deps.Stdout, "unchanged %s\n", p.PluginID)
+				continue
+			}
+			action = "updated"
+		}
+		if !deps.Config.DryRun {
+			if err := deps.Store.PutPlugin(ctx, record); err != nil {
+				return fmt.Errorf("failed to write plugin %s: %w", p.PluginID, err)
+			}
+		}
+		fmt.Fprintf(deps.Stdout, "%s%s %s\n", prefix, action, p.PluginID)
+	}
+
+	if !deps.Config.Prune {
+		return nil
+	}
+	var stale []string
+	for pluginID := range stored {
+		if !declared[pluginID] {
+			stale = append(stale, pluginID)
+		}
+	}
+	sort.Strings(stale)
+	for _, pluginID := range stale {
+		if !deps.Config.DryRun {
+			if err := deps.Store.DeletePlugin(ctx, pluginID); err != nil {
+				return fmt.Errorf("failed to delete plugin %s: %w", pluginID, err)
+			}
+		}
+		fmt.Fprintf(deps.Stdout, "%sdeleted %s\n", prefix, pluginID)
+	}
+	return nil
+}
+
+// =============================================================================
+// Real implementations
+// =============================================================================
+
+// DynamoDBClient defines the DynamoDB operations the store uses
+type DynamoDBClient interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBStore stores plugin records in the core table
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// ListPlugins returns every plugin record
+func (s *DynamoDBStore) ListPlugins(ctx context.Context) ([]plugin.PluginRecord, error) {
+	var records []plugin.PluginRecord
+	var startKey map[string]types.AttributeValue
+	for {
+		output, err := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.tableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: plugin.PluginPrefix},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+		page := make([]plugin.PluginRecord, 0, len(output.Items))
+		if err := attributevalue.UnmarshalListOfMaps(output.Items, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal plugin records: %w", err)
+		}
+		records = append(records, page...)
+		if len(output.LastEvaluatedKey) == 0 {
+			return records, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+// PutPlugin writes a plugin record, replacing any existing one
+func (s *DynamoDBStore) PutPlugin(ctx context.Context, record plugin.PluginRecord) error {
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin record: %w", err)
+	}
+	_, err = s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item:      item,
+	})
+	return err
+}
+
+// DeletePlugin deletes a plugin record
+func (s *DynamoDBStore) DeletePlugin(ctx context.Context, pluginID string) error {
+	_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(s.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: plugin.PluginPrefix},
+			"sk": &types.AttributeValueMemberS{Value: plugin.PluginPrefix + pluginID},
+		},
+	})
+	return err
+}
+
+// fail prints an error and exits
+func fail(format string, args ...any) {
+	fmt.Fprintf(os.Stderr, "registry-seed: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+func main() {
+	ctx := context.Background()
+
+	cfg := Config{}
+	flags := flag.NewFlagSet("registry-seed", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: registry-seed [flags] MANIFEST")
+		flags.PrintDefaults()
+	}
+	table := flags.String("table", os.Getenv("DYNAMODB_TABLE"), "core DynamoDB table (env DYNAMODB_TABLE)")
+	region := flags.String("region", "", "AWS region (default from the AWS config)")
+	flags.BoolVar(&cfg.DryRun, "dry-run", false, "report the changes without writing them")
+	flags.BoolVar(&cfg.Prune, "prune", false, "delete plugins that are not in the manifest")
+	_ = flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 || *table == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		fail("failed to read manifest: %v", err)
+	}
+	manifest, err := parseManifest(bytes.TrimSpace(data))
+	if err != nil {
+		fail("%v", err)
+	}
+
+	var options []func(*config.LoadOptions) error
+	if *region != "" {
+		options = append(options, config.WithRegion(*region))
+	}
+	awsConfig, err := config.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		fail("failed to load AWS config: %v", err)
+	}
+	// Seed DynamoDB Local during local bring-up
+	if err := localdev.Configure(&awsConfig); err != nil {
+		fail("%v", err)
+	}
+
+	deps = &Dependencies{
+		Store:  &DynamoDBStore{client: store.NewRetryClient(dynamodb.NewFromConfig(awsConfig)), tableName: *table},
+		Config: cfg,
+		Stdout: os.Stdout,
+		Now:    time.Now,
+	}
+	if err := seed(ctx, manifest); err != nil {
+		fail("%v", err)
+	}
+}
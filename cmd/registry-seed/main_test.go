@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// mockStore holds plugin records in memory, round-tripping them through
+// DynamoDB attribute values as the table would
+type mockStore struct {
+	items   map[string]map[string]types.AttributeValue
+	puts    []string
+	deletes []string
+	err     error
+}
+
+func newMockStore(records ...plugin.PluginRecord) *mockStore {
+	store := &mockStore{items: make(map[string]map[string]types.AttributeValue)}
+	for _, record := range records {
+		store.items[record.PluginID], _ = attributevalue.MarshalMap(record)
+	}
+	return store
+}
+
+func (m *mockStore) ListPlugins(ctx context.Context) ([]plugin.PluginRecord, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	var records []plugin.PluginRecord
+	for _, item := range m.items {
+		var record plugin.PluginRecord
+		if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (m *mockStore) PutPlugin(ctx context.Context, record plugin.PluginRecord) error {
+	m.puts = append(m.puts, record.PluginID)
+	m.items[record.PluginID], _ = attributevalue.MarshalMap(record)
+	return nil
+}
+
+func (m *mockStore) DeletePlugin(ctx context.Context, pluginID string) error {
+	m.deletes = append(m.deletes, pluginID)
+	delete(m.items, pluginID)
+	return nil
+}
+
+// record returns a stored plugin record
+func (m *mockStore) record(t *testing.T, pluginID string) plugin.PluginRecord {
+	t.Helper()
+	var record plugin.PluginRecord
+	if err := attributevalue.UnmarshalMap(m.items[pluginID], &record); err != nil {
+		t.Fatalf("failed to unmarshal %s: %v", pluginID, err)
+	}
+	return record
+}
+
+// setupTestDeps sets deps for one test and returns its output buffer
+func setupTestDeps(store *mockStore, cfg Config) *bytes.Buffer {
+	var stdout bytes.Buffer
+	deps = &Dependencies{
+		Store:  store,
+		Config: cfg,
+		Stdout: &stdout,
+		Now:    func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) },
+	}
+	return &stdout
+}
+
+const testManifest = `
+plugins:
+  - pluginId: mail
+    version: 1.4.0
+    capabilities:
+      urn:ietf:params:jmap:mail:
+        maxMailboxesPerEmail: 10
+        emailQuerySortOptions: [receivedAt]
+    methods:
+      Email/get: {invokeTarget: "${TEST_MAIL_ARN}", capability: "urn:ietf:params:jmap:mail"}
+    events:
+      account.created: {targetType: sqs, targetArn: "arn:aws:sqs:ap-southeast-2:123456789012:mail-events"}
+    clientPrincipals: ["arn:aws:iam::123456789012:role/mail"]
+    clientProfiles:
+      minimal: [urn:ietf:params:jmap:mail]
+`
+
+func mustParse(t *testing.T, data string) *Manifest {
+	t.Helper()
+	t.Setenv("TEST_MAIL_ARN", "arn:aws:lambda:ap-southeast-2:123456789012:function:mail")
+	manifest, err := parseManifest([]byte(data))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return manifest
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest := mustParse(t, testManifest)
+
+	record := toRecord(manifest.Plugins[0], "2026-03-01T12:00:00Z")
+	if record.PK != "PLUGIN#" || record.SK != "PLUGIN#mail" {
+		t.Errorf("unexpected keys %s %s", record.PK, record.SK)
+	}
+	method := record.Methods["Email/get"]
+	if method.InvocationType != "lambda-invoke" || method.InvokeTarget != "arn:aws:lambda:ap-southeast-2:123456789012:function:mail" || method.Capability != "urn:ietf:params:jmap:mail" {
+		t.Errorf("unexpected method %+v", method)
+	}
+	if record.Events["account.created"].TargetType != "sqs" {
+		t.Errorf("unexpected events %+v", record.Events)
+	}
+	if record.Capabilities["urn:ietf:params:jmap:mail"]["maxMailboxesPerEmail"] != 10 {
+		t.Errorf("unexpected capabilities %+v", record.Capabilities)
+	}
+	if profile := record.ClientProfiles["minimal"]; len(profile) != 1 || profile[0] != "urn:ietf:params:jmap:mail" {
+		t.Errorf("unexpected client profiles %+v", record.ClientProfiles)
+	}
+}
+
+func TestParseManifest_JSON(t *testing.T) {
+	manifest := mustParse(t, `{"plugins":[{"pluginId":"core","methods":{"Core/echo":{"invokeTarget":"arn:echo"}}}]}`)
+	if manifest.Plugins[0].Methods["Core/echo"].InvokeTarget != "arn:echo" {
+		t.Errorf("unexpected manifest %+v", manifest)
+	}
+}
+
+func TestParseManifest_AsyncMethod(t *testing.T) {
+	manifest := mustParse(t, `{"plugins":[{"pluginId":"mail","methods":{"Email/markSeen":{"invokeTarget":"arn:seen","async":true},"Email/get":{"invokeTarget":"arn:get"}}}]}`)
+
+	record := toRecord(manifest.Plugins[0], "2026-03-01T12:00:00Z")
+	if !record.Methods["Email/markSeen"].Async || record.Methods["Email/get"].Async {
+		t.Errorf("expected only Email/markSeen to be async, got %+v", record.Methods)
+	}
+}
+
+func TestParseManifest_ArgsSchema(t *testing.T) {
+	manifest := mustParse(t, `
+plugins:
+  - pluginId: mail
+    methods:
+      Email/get:
+        invokeTarget: arn:get
+        argsSchema:
+          type: object
+          required: [accountId]
+          properties:
+            ids: {type: array, maxItems: 500}
+`)
+
+	record := toRecord(manifest.Plugins[0], "2026-03-01T12:00:00Z")
+	schema := record.Methods["Email/get"].ArgsSchema
+	if schema["type"] != "object" || schema["properties"] == nil {
+		t.Errorf("unexpected argsSchema %+v", schema)
+	}
+
+	store := newMockStore()
+	setupTestDeps(store, Config{})
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.puts) != 1 {
+		t.Errorf("expected the schema to round-trip unchanged, got %d puts", len(store.puts))
+	}
+}
+
+func TestParseManifest_Paging(t *testing.T) {
+	manifest := mustParse(t, `
+plugins:
+  - pluginId: mail
+    methods:
+      Email/query: {invokeTarget: arn:query, paging: true}
+      Email/changes: {invokeTarget: arn:changes, stateTokens: true}
+`)
+
+	record := toRecord(manifest.Plugins[0], "2026-03-01T12:00:00Z")
+	if !record.Methods["Email/query"].Paging {
+		t.Error("expected paging on the Email/query target")
+	}
+	if !record.Methods["Email/changes"].StateTokens {
+		t.Error("expected stateTokens on the Email/changes target")
+	}
+}
+
+func TestParseManifest_Invalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+		want     string
+	}{
+		{"unset variable", `plugins: [{pluginId: mail, methods: {Email/get: {invokeTarget: "${TEST_UNSET_ARN}"}}}]`, "TEST_UNSET_ARN"},
+		{"unknown field", `plugins: [{pluginId: mail, method: {}}]`, "method"},
+		{"missing pluginId", `plugins: [{version: 1.0.0}]`, "pluginId"},
+		{"duplicate plugin", `plugins: [{pluginId: mail}, {pluginId: mail}]`, "declared twice"},
+		{"duplicate method", `plugins: [{pluginId: a, methods: {X/get: {invokeTarget: arn:a}}}, {pluginId: b, methods: {X/get: {invokeTarget: arn:b}}}]`, "both a and b"},
+		{"no invokeTarget", `plugins: [{pluginId: mail, methods: {Email/get: {}}}]`, "no invokeTarget"},
+		{"bad invocationType", `plugins: [{pluginId: mail, methods: {Email/get: {invocationType: http, invokeTarget: x}}}]`, "invocationType"},
+		{"bad event target", `plugins: [{pluginId: mail, events: {account.created: {targetType: kafka, targetArn: x}}}]`, "targetType"},
+		{"empty client profile", `plugins: [{pluginId: mail, clientProfiles: {minimal: []}}]`, "lists no capabilities"},
+		{"bad argsSchema", `plugins: [{pluginId: mail, methods: {Email/get: {invokeTarget: x, argsSchema: {oneOf: []}}}}]`, "unsupported keyword"},
+		{"paging on a non-query method", `plugins: [{pluginId: mail, methods: {Email/get: {invokeTarget: x, paging: true}}}]`, "only for /query methods"},
+		{"stateTokens on a non-changes method", `plugins: [{pluginId: mail, methods: {Email/get: {invokeTarget: x, stateTokens: true}}}]`, "only for /changes and /queryChanges methods"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseManifest([]byte(tt.manifest))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestSeed_CreatesThenUnchanged(t *testing.T) {
+	store := newMockStore()
+	stdout := setupTestDeps(store, Config{})
+	manifest := mustParse(t, testManifest)
+
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "created mail\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+	if got := store.record(t, "mail").RegisteredAt; got != "2026-03-01T12:00:00Z" {
+		t.Errorf("unexpected registeredAt %s", got)
+	}
+
+	// A second run, a day later, finds nothing to do
+	stdout = setupTestDeps(store, Config{})
+	deps.Now = func() time.Time { return time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC) }
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "unchanged mail\n" || len(store.puts) != 1 {
+		t.Errorf("expected no writes, got %q and puts %v", stdout.String(), store.puts)
+	}
+}
+
+func TestSeed_UpdateKeepsRegisteredAt(t *testing.T) {
+	store := newMockStore(plugin.PluginRecord{
+		PK: "PLUGIN#", SK: "PLUGIN#mail", PluginID: "mail", Version: "1.3.0",
+		RegisteredAt: "2025-01-17T00:00:00Z",
+	})
+	stdout := setupTestDeps(store, Config{})
+
+	if err := seed(context.Background(), mustParse(t, testManifest)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "updated mail\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+	record := store.record(t, "mail")
+	if record.Version != "1.4.0" || record.RegisteredAt != "2025-01-17T00:00:00Z" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestSeed_Prune(t *testing.T) {
+	store := newMockStore(
+		plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#old", PluginID: "old"},
+		plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#legacy", PluginID: "legacy"},
+	)
+	manifest := mustParse(t, testManifest)
+
+	// Without -prune, other plugins are left alone
+	setupTestDeps(store, Config{})
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.deletes) != 0 {
+		t.Errorf("expected no deletes, got %v", store.deletes)
+	}
+
+	stdout := setupTestDeps(store, Config{Prune: true})
+	if err := seed(context.Background(), manifest); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "unchanged mail\ndeleted legacy\ndeleted old\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+}
+
+func TestSeed_DryRun(t *testing.T) {
+	store := newMockStore(plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#old", PluginID: "old"})
+	stdout := setupTestDeps(store, Config{DryRun: true, Prune: true})
+
+	if err := seed(context.Background(), mustParse(t, testManifest)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stdout.String() != "would have created mail\nwould have deleted old\n" {
+		t.Errorf("unexpected output %q", stdout.String())
+	}
+	if len(store.puts) != 0 || len(store.deletes) != 0 {
+		t.Errorf("expected no writes, got puts %v deletes %v", store.puts, store.deletes)
+	}
+}
+
+func TestSeed_ListError(t *testing.T) {
+	store := newMockStore()
+	store.err = errors.New("throttled")
+	setupTestDeps(store, Config{})
+
+	if err := seed(context.Background(), mustParse(t, testManifest)); err == nil || !strings.Contains(err.Error(), "throttled") {
+		t.Errorf("expected list error, got %v", err)
+	}
+}
+
+// mockDynamoDB returns canned query pages and records writes
+type mockDynamoDB struct {
+	pages  []*dynamodb.QueryOutput
+	put    *dynamodb.PutItemInput
+	delete *dynamodb.DeleteItemInput
+}
+
+func (m *mockDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	page := m.pages[0]
+	m.pages = m.pages[1:]
+	return page, nil
+}
+
+func (m *mockDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.put = params
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDB) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.delete = params
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBStore(t *testing.T) {
+	core, _ := attributevalue.MarshalMap(plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#core", PluginID: "core"})
+	mail, _ := attributevalue.MarshalMap(plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#mail", PluginID: "mail"})
+	client := &mockDynamoDB{pages: []*dynamodb.QueryOutput{
+		{Items: []map[string]types.AttributeValue{core}, LastEvaluatedKey: core},
+		{Items: []map[string]types.AttributeValue{mail}},
+	}}
+	store := &DynamoDBStore{client: client, tableName: "jmap-test"}
+
+	records, err := store.ListPlugins(context.Background())
+	if err != nil || len(records) != 2 || records[1].PluginID != "mail" {
+		t.Fatalf("expected both pages, got %+v, %v", records, err)
+	}
+
+	if err := store.PutPlugin(context.Background(), plugin.PluginRecord{PK: "PLUGIN#", SK: "PLUGIN#mail", PluginID: "mail"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *client.put.TableName != "jmap-test" || client.put.Item["sk"].(*types.AttributeValueMemberS).Value != "PLUGIN#mail" {
+		t.Errorf("unexpected put %+v", client.put)
+	}
+
+	if err := store.DeletePlugin(context.Background(), "mail"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.delete.Key["sk"].(*types.AttributeValueMemberS).Value != "PLUGIN#mail" {
+		t.Errorf("unexpected delete key %+v", client.delete.Key)
+	}
+}
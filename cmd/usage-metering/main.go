@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/config"
+	"github.com/jarrod-lowe/jmap-service-core/internal/db"
+	"github.com/jarrod-lowe/jmap-service-core/internal/deadletter"
+	"github.com/jarrod-lowe/jmap-service-core/internal/eventlog"
+	"github.com/jarrod-lowe/jmap-service-core/internal/localdev"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-core/internal/tracebackend"
+	"github.com/jarrod-lowe/jmap-service-core/internal/usage"
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+var logger = loglevel.New()
+
+// Meter runs one metering pass over all accounts
+type Meter interface {
+	Run(ctx context.Context) (usage.Summary, error)
+}
+
+// Dependencies for handler (injectable for testing)
+type Dependencies struct {
+	Meter Meter
+}
+
+var deps *Dependencies
+
+// handler is the Lambda entry point, invoked on a schedule
+func handler(ctx context.Context) error {
+	summary, err := deps.Meter.Run(ctx)
+	if err != nil {
+		logger.ErrorContext(ctx, "Usage metering failed",
+			slog.Int("accounts", summary.Accounts),
+			slog.Int("failed", summary.Failed),
+			slog.String("error", err.Error()),
+		)
+		return err
+	}
+
+	logger.InfoContext(ctx, "Usage metering completed",
+		slog.Int("accounts", summary.Accounts),
+	)
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	result, err := awsinit.Init(ctx)
+	if err != nil {
+		logger.Error("FATAL: Failed to initialize AWS",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	defer result.Cleanup()
+
+	// Optional local endpoints for offline development
+	if err := localdev.Configure(&result.Config); err != nil {
+		logger.Error("FATAL: Invalid local endpoint configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional log level refresh and per-request debug principals
+	if err := loglevel.Configure(ctx, result.Config); err != nil {
+		logger.Error("FATAL: Invalid logging configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Optional OTLP tracing backend in place of X-Ray
+	if err := tracebackend.Configure(ctx, result); err != nil {
+		logger.Error("FATAL: Invalid tracing configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	// Load configuration from environment variables
+	cfg, err := config.LoadUsageMetering(os.Getenv)
+	if err != nil {
+		logger.Error("FATAL: Invalid configuration",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+	tableName := cfg.Table
+
+	// Optional quota thresholds; an empty value disables usage.threshold events
+	thresholds := cfg.Thresholds
+
+	dynamoClient := store.NewRetryClient(dynamodb.NewFromConfig(result.Config))
+
+	// Load plugin registry for event publishing
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(result.Ctx, db.NewClientFromConfig(result.Config, tableName)); err != nil {
+		logger.Error("FATAL: Failed to load plugin registry",
+			slog.String("error", err.Error()),
+		)
+		panic(err)
+	}
+
+	eventPublisher := publisher.FromConfig(result.Config, registry).
+		WithDeadLetters(deadletter.NewDynamoDBStore(dynamoClient, tableName)).
+		WithEventLog(eventlog.NewDynamoDBStore(dynamoClient, tableName))
+
+	deps = &Dependencies{
+		Meter: &usage.Meter{
+			Accounts:   account.NewDynamoDBStore(dynamoClient, tableName),
+			Usage:      usage.NewDynamoDBStore(dynamoClient, tableName),
+			Publisher:  eventPublisher,
+			Thresholds: thresholds,
+		},
+	}
+
+	result.Start(handler)
+}
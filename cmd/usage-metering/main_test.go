@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/usage"
+)
+
+type mockMeter struct {
+	summary usage.Summary
+	err     error
+	calls   int
+}
+
+func (m *mockMeter) Run(ctx context.Context) (usage.Summary, error) {
+	m.calls++
+	return m.summary, m.err
+}
+
+func TestHandler_RunsMeter(t *testing.T) {
+	meter := &mockMeter{summary: usage.Summary{Accounts: 3}}
+	deps = &Dependencies{Meter: meter}
+
+	if err := handler(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meter.calls != 1 {
+		t.Errorf("expected one metering run, got %d", meter.calls)
+	}
+}
+
+func TestHandler_PartialFailure_ReturnsError(t *testing.T) {
+	meter := &mockMeter{
+		summary: usage.Summary{Accounts: 3, Failed: 1},
+		err:     errors.New("failed to meter 1 of 3 accounts"),
+	}
+	deps = &Dependencies{Meter: meter}
+
+	if err := handler(context.Background()); err == nil {
+		t.Fatal("expected error so the failed run is visible in Lambda metrics")
+	}
+}
@@ -0,0 +1,42 @@
+// Package accesspoint maps accounts to the S3 Access Points scoped to their
+// blob prefix, so writes and presigned URLs for an account can only reach
+// that account's objects.
+package accesspoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Map maps an account ID to the ARN of its access point
+type Map map[string]string
+
+// Parse parses a JSON object of account ID to access point ARN, e.g.
+// {"shared-inbox": "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/jmap-shared-inbox"}.
+// An empty string yields no access points.
+func Parse(value string) (Map, error) {
+	points := Map{}
+	if value == "" {
+		return points, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &points); err != nil {
+		return nil, fmt.Errorf("invalid access points: %w", err)
+	}
+	for accountID, arn := range points {
+		if !strings.HasPrefix(arn, "arn:") || !strings.Contains(arn, ":accesspoint/") {
+			return nil, fmt.Errorf("invalid access points: account %q must map to an access point ARN, got %q", accountID, arn)
+		}
+	}
+	return points, nil
+}
+
+// Bucket returns what to pass as the S3 Bucket of a request for one of
+// accountID's objects: its access point ARN, or bucket if it has none
+func (m Map) Bucket(accountID, bucket string) string {
+	if arn, ok := m[accountID]; ok {
+		return arn
+	}
+	return bucket
+}
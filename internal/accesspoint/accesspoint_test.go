@@ -0,0 +1,44 @@
+package accesspoint
+
+import "testing"
+
+const testARN = "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/jmap-shared-inbox"
+
+func TestParse(t *testing.T) {
+	points, err := Parse(`{"shared-inbox": "` + testARN + `"}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if points["shared-inbox"] != testARN {
+		t.Errorf("unexpected access points %v", points)
+	}
+
+	if points, err := Parse(""); err != nil || len(points) != 0 {
+		t.Errorf("expected no access points, got %v, %v", points, err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`{"shared-inbox": "jmap-blobs"}`,
+		`{"shared-inbox": "arn:aws:s3:::jmap-blobs"}`,
+	} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestBucket(t *testing.T) {
+	points := Map{"shared-inbox": testARN}
+	if got := points.Bucket("shared-inbox", "jmap-blobs"); got != testARN {
+		t.Errorf("expected the access point, got %q", got)
+	}
+	if got := points.Bucket("user-1", "jmap-blobs"); got != "jmap-blobs" {
+		t.Errorf("expected the bucket, got %q", got)
+	}
+	if got := Map(nil).Bucket("shared-inbox", "jmap-blobs"); got != "jmap-blobs" {
+		t.Errorf("expected the bucket without access points, got %q", got)
+	}
+}
@@ -0,0 +1,543 @@
+package account
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// ErrAccountNotFound is returned when the account META# record does not exist
+var ErrAccountNotFound = errors.New("account not found")
+
+// ErrAccountExists is returned by CreateMeta when the account already exists
+var ErrAccountExists = errors.New("account already exists")
+
+// ErrInvalidCursor is returned when a pagination cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrConcurrentUpdate is returned when a quota change keeps losing races with
+// other writers to the META# record
+var ErrConcurrentUpdate = errors.New("concurrent account update")
+
+// maxQuotaUpdateAttempts bounds the optimistic retry loop in SetQuota
+const maxQuotaUpdateAttempts = 3
+
+// MaxIDLength is the longest account ID accepted when provisioning
+const MaxIDLength = 128
+
+// Meta represents the account META# record
+type Meta struct {
+	AccountID               string `dynamodbav:"-"` // Derived from PK, not stored
+	AccountType             string `dynamodbav:"accountType,omitempty"`
+	Owner                   string `dynamodbav:"owner,omitempty"`
+	Tier                    string `dynamodbav:"tier,omitempty"`
+	QuotaBytes              int64  `dynamodbav:"quotaBytes"`
+	QuotaRemaining          int64  `dynamodbav:"quotaRemaining"`
+	QuotaGraceExpiresAt     string `dynamodbav:"quotaGraceExpiresAt,omitempty"`
+	PendingAllocationsCount int    `dynamodbav:"pendingAllocationsCount"`
+	MaxPendingAllocations   int    `dynamodbav:"maxPendingAllocations,omitempty"`
+	Suspended               bool   `dynamodbav:"suspended,omitempty"`
+	SuspendedAt             string `dynamodbav:"suspendedAt,omitempty"`
+	SuspendedReason         string `dynamodbav:"suspendedReason,omitempty"`
+	WritesDisabled          bool   `dynamodbav:"writesDisabled,omitempty"`
+	WritesDisabledAt        string `dynamodbav:"writesDisabledAt,omitempty"`
+	WritesDisabledReason    string `dynamodbav:"writesDisabledReason,omitempty"`
+	CreatedAt               string `dynamodbav:"createdAt,omitempty"`
+	UpdatedAt               string `dynamodbav:"updatedAt,omitempty"`
+	LastDiscoveryAccess     string `dynamodbav:"lastDiscoveryAccess,omitempty"`
+	LastActivityAt          string `dynamodbav:"lastActivityAt,omitempty"`
+	InactiveAt              string `dynamodbav:"inactiveAt,omitempty"`
+	DeletionScheduledAt     string `dynamodbav:"deletionScheduledAt,omitempty"`
+
+	// CapabilityOverrides replace settings in the session's
+	// accountCapabilities for this account, keyed by capability URI
+	CapabilityOverrides map[string]map[string]any `dynamodbav:"capabilityOverrides,omitempty"`
+}
+
+// BlobUsage summarises the blob records stored under an account
+type BlobUsage struct {
+	Count          int64 // All blob records, including pending and deleted
+	ConfirmedCount int64
+	PendingCount   int64
+	DeletedCount   int64
+	ConfirmedBytes int64
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by account
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoDBStore reads and updates account META# records
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// metaKey builds the primary key of an account META# record
+func metaKey(accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+	}
+}
+
+// GetMeta retrieves the META# record for an account.
+// Returns nil if the account has not been provisioned.
+func (d *DynamoDBStore) GetMeta(ctx context.Context, accountID string) (*Meta, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       metaKey(accountID),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var meta Meta
+	if err := attributevalue.UnmarshalMap(result.Item, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account meta: %w", err)
+	}
+	meta.AccountID = accountID
+
+	return &meta, nil
+}
+
+// IsValidID reports whether an account ID is safe to use in keys, S3 object
+// paths and tags: 1 to MaxIDLength characters of letters, digits, '.', '_'
+// and '-', not starting with '.'. Cognito subs always pass.
+func IsValidID(accountID string) bool {
+	if accountID == "" || len(accountID) > MaxIDLength || accountID[0] == '.' {
+		return false
+	}
+	for _, c := range accountID {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '.', c == '_', c == '-':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// CreateMeta creates a new account META# record with quotaRemaining equal
+// to quotaBytes. Returns ErrAccountExists if the account already exists.
+func (d *DynamoDBStore) CreateMeta(ctx context.Context, meta Meta) (*Meta, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+	meta.QuotaRemaining = meta.QuotaBytes
+	meta.CreatedAt = now
+	meta.UpdatedAt = now
+
+	av, err := attributevalue.MarshalMap(meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal account meta: %w", err)
+	}
+	for k, v := range metaKey(meta.AccountID) {
+		av[k] = v
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return nil, ErrAccountExists
+		}
+		return nil, err
+	}
+
+	return &meta, nil
+}
+
+// SetSuspended sets or clears the suspended flag on an account.
+// The reason is recorded alongside the flag when suspending and removed when
+// the suspension is lifted. Returns ErrAccountNotFound if the account does not exist.
+func (d *DynamoDBStore) SetSuspended(ctx context.Context, accountID string, suspended bool, reason string) (*Meta, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var updateExpr string
+	exprValues := map[string]types.AttributeValue{
+		":now":       &types.AttributeValueMemberS{Value: now},
+		":suspended": &types.AttributeValueMemberBOOL{Value: suspended},
+	}
+
+	if suspended {
+		updateExpr = "SET suspended = :suspended, suspendedAt = :now, suspendedReason = :reason, updatedAt = :now"
+		exprValues[":reason"] = &types.AttributeValueMemberS{Value: reason}
+	} else {
+		updateExpr = "SET suspended = :suspended, updatedAt = :now REMOVE suspendedAt, suspendedReason"
+	}
+
+	output, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.tableName),
+		Key:                       metaKey(accountID),
+		UpdateExpression:          aws.String(updateExpr),
+		ConditionExpression:       aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: exprValues,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	var meta Meta
+	if err := attributevalue.UnmarshalMap(output.Attributes, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account meta: %w", err)
+	}
+	meta.AccountID = accountID
+
+	return &meta, nil
+}
+
+// SetWritesDisabled sets or clears the writesDisabled flag on an account,
+// which blocks new writes while leaving reads working. The reason is recorded
+// alongside the flag when disabling and removed when writes are re-enabled.
+// Returns ErrAccountNotFound if the account does not exist.
+func (d *DynamoDBStore) SetWritesDisabled(ctx context.Context, accountID string, disabled bool, reason string) (*Meta, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	var updateExpr string
+	exprValues := map[string]types.AttributeValue{
+		":now":      &types.AttributeValueMemberS{Value: now},
+		":disabled": &types.AttributeValueMemberBOOL{Value: disabled},
+	}
+
+	if disabled {
+		updateExpr = "SET writesDisabled = :disabled, writesDisabledAt = :now, writesDisabledReason = :reason, updatedAt = :now"
+		exprValues[":reason"] = &types.AttributeValueMemberS{Value: reason}
+	} else {
+		updateExpr = "SET writesDisabled = :disabled, updatedAt = :now REMOVE writesDisabledAt, writesDisabledReason"
+	}
+
+	output, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.tableName),
+		Key:                       metaKey(accountID),
+		UpdateExpression:          aws.String(updateExpr),
+		ConditionExpression:       aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: exprValues,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	var meta Meta
+	if err := attributevalue.UnmarshalMap(output.Attributes, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account meta: %w", err)
+	}
+	meta.AccountID = accountID
+
+	return &meta, nil
+}
+
+// SetCapabilityOverrides replaces an account's capability overrides; empty
+// overrides remove them. Returns ErrAccountNotFound if the account does not
+// exist.
+func (d *DynamoDBStore) SetCapabilityOverrides(ctx context.Context, accountID string, overrides map[string]map[string]any) (*Meta, error) {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	updateExpr := "SET updatedAt = :now REMOVE capabilityOverrides"
+	exprValues := map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberS{Value: now},
+	}
+	if len(overrides) > 0 {
+		av, err := attributevalue.Marshal(overrides)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal capability overrides: %w", err)
+		}
+		updateExpr = "SET capabilityOverrides = :overrides, updatedAt = :now"
+		exprValues[":overrides"] = av
+	}
+
+	output, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.tableName),
+		Key:                       metaKey(accountID),
+		UpdateExpression:          aws.String(updateExpr),
+		ConditionExpression:       aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: exprValues,
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	var meta Meta
+	if err := attributevalue.UnmarshalMap(output.Attributes, &meta); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal account meta: %w", err)
+	}
+	meta.AccountID = accountID
+
+	return &meta, nil
+}
+
+// ClearQuotaGrace ends an account's quota grace period once it is back
+// within quota, so a later overrun gets a full grace period again. It does
+// nothing if the account is over quota or has no grace period.
+func (d *DynamoDBStore) ClearQuotaGrace(ctx context.Context, accountID string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.tableName),
+		Key:                 metaKey(accountID),
+		UpdateExpression:    aws.String("REMOVE quotaGraceExpiresAt"),
+		ConditionExpression: aws.String("attribute_exists(quotaGraceExpiresAt) AND quotaRemaining >= :zero"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":zero": &types.AttributeValueMemberN{Value: "0"},
+		},
+	})
+	if err != nil && !dbclient.IsConditionalCheckFailed(err) {
+		return fmt.Errorf("failed to clear quota grace: %w", err)
+	}
+	return nil
+}
+
+// QuotaChange describes the result of a quota update
+type QuotaChange struct {
+	Meta               *Meta
+	PreviousQuotaBytes int64
+}
+
+// SetQuota changes an account's quotaBytes and adjusts quotaRemaining by the
+// same delta, so bytes already in use stay accounted for. quotaRemaining may
+// go negative when the quota is reduced below current usage; allocations are
+// then rejected until usage falls. A tier change also applies the tier's
+// maxPendingAllocations, removing the account's override when it is zero. An
+// empty tier leaves the stored tier and pending allocation limit as is.
+// Returns ErrAccountNotFound if the account does not exist.
+func (d *DynamoDBStore) SetQuota(ctx context.Context, accountID string, quotaBytes int64, tier string, maxPendingAllocations int) (*QuotaChange, error) {
+	for attempt := 0; attempt < maxQuotaUpdateAttempts; attempt++ {
+		current, err := d.GetMeta(ctx, accountID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrAccountNotFound
+		}
+
+		updateExpr := "SET quotaBytes = :new, updatedAt = :now"
+		exprValues := map[string]types.AttributeValue{
+			":new":   &types.AttributeValueMemberN{Value: strconv.FormatInt(quotaBytes, 10)},
+			":old":   &types.AttributeValueMemberN{Value: strconv.FormatInt(current.QuotaBytes, 10)},
+			":delta": &types.AttributeValueMemberN{Value: strconv.FormatInt(quotaBytes-current.QuotaBytes, 10)},
+			":now":   &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		}
+		if tier != "" {
+			updateExpr += ", tier = :tier"
+			exprValues[":tier"] = &types.AttributeValueMemberS{Value: tier}
+			if maxPendingAllocations > 0 {
+				updateExpr += ", maxPendingAllocations = :maxPending"
+				exprValues[":maxPending"] = &types.AttributeValueMemberN{Value: strconv.Itoa(maxPendingAllocations)}
+			}
+		}
+		updateExpr += " ADD quotaRemaining :delta"
+		if tier != "" && maxPendingAllocations == 0 {
+			updateExpr += " REMOVE maxPendingAllocations"
+		}
+
+		// The condition on the old quotaBytes guards against a concurrent quota
+		// change; quotaRemaining itself is adjusted atomically with ADD so
+		// concurrent allocations are unaffected.
+		output, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:                 aws.String(d.tableName),
+			Key:                       metaKey(accountID),
+			UpdateExpression:          aws.String(updateExpr),
+			ConditionExpression:       aws.String("attribute_exists(pk) AND quotaBytes = :old"),
+			ExpressionAttributeValues: exprValues,
+			ReturnValues:              types.ReturnValueAllNew,
+		})
+		if err != nil {
+			if dbclient.IsConditionalCheckFailed(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		var meta Meta
+		if err := attributevalue.UnmarshalMap(output.Attributes, &meta); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal account meta: %w", err)
+		}
+		meta.AccountID = accountID
+
+		return &QuotaChange{Meta: &meta, PreviousQuotaBytes: current.QuotaBytes}, nil
+	}
+
+	return nil, ErrConcurrentUpdate
+}
+
+// ListMeta returns a page of account META# records.
+// Pass the returned cursor back in to fetch the next page; an empty cursor
+// means there are no more pages. A page may contain fewer than limit records
+// because the scan limit applies before the META# filter.
+func (d *DynamoDBStore) ListMeta(ctx context.Context, limit int32, cursor string) ([]Meta, string, error) {
+	startKey, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	output, err := d.client.Scan(ctx, &dynamodb.ScanInput{
+		TableName:        aws.String(d.tableName),
+		FilterExpression: aws.String("sk = :meta AND begins_with(pk, :account)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":meta":    &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+			":account": &types.AttributeValueMemberS{Value: dbclient.PrefixAccount},
+		},
+		Limit:             aws.Int32(limit),
+		ExclusiveStartKey: startKey,
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	metas := make([]Meta, 0, len(output.Items))
+	for _, item := range output.Items {
+		var meta Meta
+		if err := attributevalue.UnmarshalMap(item, &meta); err != nil {
+			return nil, "", fmt.Errorf("failed to unmarshal account meta: %w", err)
+		}
+		if pk, ok := item["pk"].(*types.AttributeValueMemberS); ok {
+			meta.AccountID = strings.TrimPrefix(pk.Value, dbclient.PrefixAccount)
+		}
+		metas = append(metas, meta)
+	}
+
+	nextCursor, err := encodeCursor(output.LastEvaluatedKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return metas, nextCursor, nil
+}
+
+// GetBlobUsage aggregates the blob records stored under an account
+func (d *DynamoDBStore) GetBlobUsage(ctx context.Context, accountID string) (*BlobUsage, error) {
+	usage := &BlobUsage{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :blob)"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+				"#size":   "size",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":   &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+				":blob": &types.AttributeValueMemberS{Value: "BLOB#"},
+			},
+			ProjectionExpression: aws.String("#status, #size, deletedAt"),
+			ExclusiveStartKey:    startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			var blob struct {
+				Status    string `dynamodbav:"status"`
+				Size      int64  `dynamodbav:"size"`
+				DeletedAt string `dynamodbav:"deletedAt"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &blob); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal blob record: %w", err)
+			}
+
+			usage.Count++
+			switch {
+			case blob.DeletedAt != "":
+				usage.DeletedCount++
+			case blob.Status == "pending":
+				usage.PendingCount++
+			default:
+				// Records from the traditional upload path have no status
+				usage.ConfirmedCount++
+				usage.ConfirmedBytes += blob.Size
+			}
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return usage, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+// encodeCursor converts a DynamoDB LastEvaluatedKey into an opaque cursor
+func encodeCursor(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+
+	var plain map[string]string
+	if err := attributevalue.UnmarshalMap(key, &plain); err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	data, err := json.Marshal(plain)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor converts an opaque cursor back into a DynamoDB ExclusiveStartKey
+func decodeCursor(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var plain map[string]string
+	if err := json.Unmarshal(data, &plain); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	key, err := attributevalue.MarshalMap(plain)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return key, nil
+}
@@ -0,0 +1,616 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDynamoDBClient implements DynamoDBClient for testing
+type mockDynamoDBClient struct {
+	getItemFunc     func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	putItemFunc     func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	updateItemFunc  func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	lastUpdateInput *dynamodb.UpdateItemInput
+	queryFunc       func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	scanFunc        func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	transactFunc    func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func (m *mockDynamoDBClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.transactFunc != nil {
+		return m.transactFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if m.scanFunc != nil {
+		return m.scanFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getItemFunc != nil {
+		return m.getItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if m.putItemFunc != nil {
+		return m.putItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.lastUpdateInput = params
+	if m.updateItemFunc != nil {
+		return m.updateItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.UpdateItemOutput{Attributes: map[string]types.AttributeValue{}}, nil
+}
+
+func TestGetMeta_ReturnsRecord(t *testing.T) {
+	var capturedKey map[string]types.AttributeValue
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			capturedKey = params.Key
+			return &dynamodb.GetItemOutput{
+				Item: map[string]types.AttributeValue{
+					"pk":             &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+					"sk":             &types.AttributeValueMemberS{Value: "META#"},
+					"quotaBytes":     &types.AttributeValueMemberN{Value: "1000"},
+					"quotaRemaining": &types.AttributeValueMemberN{Value: "400"},
+					"suspended":      &types.AttributeValueMemberBOOL{Value: true},
+				},
+			}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	meta, err := store.GetMeta(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta == nil {
+		t.Fatal("expected meta, got nil")
+	}
+	if meta.AccountID != "user-1" {
+		t.Errorf("expected AccountID user-1, got %s", meta.AccountID)
+	}
+	if meta.QuotaBytes != 1000 || meta.QuotaRemaining != 400 {
+		t.Errorf("unexpected quota values: %d/%d", meta.QuotaRemaining, meta.QuotaBytes)
+	}
+	if !meta.Suspended {
+		t.Error("expected Suspended to be true")
+	}
+	if pk := capturedKey["pk"].(*types.AttributeValueMemberS).Value; pk != "ACCOUNT#user-1" {
+		t.Errorf("expected pk ACCOUNT#user-1, got %s", pk)
+	}
+	if sk := capturedKey["sk"].(*types.AttributeValueMemberS).Value; sk != "META#" {
+		t.Errorf("expected sk META#, got %s", sk)
+	}
+}
+
+func TestGetMeta_NotFound_ReturnsNil(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "test-table")
+
+	meta, err := store.GetMeta(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta != nil {
+		t.Errorf("expected nil meta, got %+v", meta)
+	}
+}
+
+func TestGetMeta_Error_Propagates(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return nil, errors.New("dynamo down")
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.GetMeta(context.Background(), "user-1"); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestSetSuspended_Suspend_SetsReason(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetSuspended(context.Background(), "user-1", true, "abuse"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if input == nil {
+		t.Fatal("expected UpdateItem to be called")
+	}
+	if !strings.Contains(*input.UpdateExpression, "suspendedReason = :reason") {
+		t.Errorf("expected reason to be set, got %s", *input.UpdateExpression)
+	}
+	if *input.ConditionExpression != "attribute_exists(pk)" {
+		t.Errorf("expected attribute_exists(pk) condition, got %s", *input.ConditionExpression)
+	}
+	if v := input.ExpressionAttributeValues[":suspended"].(*types.AttributeValueMemberBOOL).Value; !v {
+		t.Error("expected :suspended to be true")
+	}
+}
+
+func TestSetSuspended_Unsuspend_RemovesReason(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetSuspended(context.Background(), "user-1", false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr := *client.lastUpdateInput.UpdateExpression
+	if !strings.Contains(expr, "REMOVE suspendedAt, suspendedReason") {
+		t.Errorf("expected suspension details to be removed, got %s", expr)
+	}
+}
+
+func TestSetSuspended_MissingAccount_ReturnsErrAccountNotFound(t *testing.T) {
+	client := &mockDynamoDBClient{
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	_, err := store.SetSuspended(context.Background(), "missing", true, "")
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestSetWritesDisabled_Disable_SetsReason(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetWritesDisabled(context.Background(), "user-1", true, "migration"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if !strings.Contains(*input.UpdateExpression, "writesDisabledReason = :reason") {
+		t.Errorf("expected reason to be set, got %s", *input.UpdateExpression)
+	}
+	if *input.ConditionExpression != "attribute_exists(pk)" {
+		t.Errorf("expected attribute_exists(pk) condition, got %s", *input.ConditionExpression)
+	}
+	if v := input.ExpressionAttributeValues[":disabled"].(*types.AttributeValueMemberBOOL).Value; !v {
+		t.Error("expected :disabled to be true")
+	}
+}
+
+func TestSetWritesDisabled_Enable_RemovesReason(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetWritesDisabled(context.Background(), "user-1", false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr := *client.lastUpdateInput.UpdateExpression
+	if !strings.Contains(expr, "REMOVE writesDisabledAt, writesDisabledReason") {
+		t.Errorf("expected kill switch details to be removed, got %s", expr)
+	}
+}
+
+func TestSetWritesDisabled_MissingAccount_ReturnsErrAccountNotFound(t *testing.T) {
+	client := &mockDynamoDBClient{
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	_, err := store.SetWritesDisabled(context.Background(), "missing", true, "")
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestSetCapabilityOverrides_SetsOverrides(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	overrides := map[string]map[string]any{
+		"https://jmap.rrod.net/extensions/upload-put": {"maxSizeUploadPut": 1000},
+	}
+	if _, err := store.SetCapabilityOverrides(context.Background(), "user-1", overrides); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if *input.UpdateExpression != "SET capabilityOverrides = :overrides, updatedAt = :now" {
+		t.Errorf("unexpected update expression: %s", *input.UpdateExpression)
+	}
+	if *input.ConditionExpression != "attribute_exists(pk)" {
+		t.Errorf("expected attribute_exists(pk) condition, got %s", *input.ConditionExpression)
+	}
+	var stored map[string]map[string]any
+	if err := attributevalue.Unmarshal(input.ExpressionAttributeValues[":overrides"], &stored); err != nil {
+		t.Fatalf("failed to unmarshal overrides: %v", err)
+	}
+	if stored["https://jmap.rrod.net/extensions/upload-put"]["maxSizeUploadPut"] != float64(1000) {
+		t.Errorf("unexpected stored overrides: %v", stored)
+	}
+}
+
+func TestSetCapabilityOverrides_Empty_RemovesOverrides(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetCapabilityOverrides(context.Background(), "user-1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expr := *client.lastUpdateInput.UpdateExpression
+	if !strings.Contains(expr, "REMOVE capabilityOverrides") {
+		t.Errorf("expected overrides to be removed, got %s", expr)
+	}
+}
+
+func TestSetCapabilityOverrides_MissingAccount_ReturnsErrAccountNotFound(t *testing.T) {
+	client := &mockDynamoDBClient{
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	_, err := store.SetCapabilityOverrides(context.Background(), "missing", nil)
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestClearQuotaGrace_RemovesWhenWithinQuota(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if err := store.ClearQuotaGrace(context.Background(), "user-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if *input.UpdateExpression != "REMOVE quotaGraceExpiresAt" {
+		t.Errorf("unexpected update expression: %s", *input.UpdateExpression)
+	}
+	if !strings.Contains(*input.ConditionExpression, "quotaRemaining >= :zero") {
+		t.Errorf("expected condition on quota remaining, got %s", *input.ConditionExpression)
+	}
+}
+
+func TestClearQuotaGrace_ConditionFailed_ReturnsNil(t *testing.T) {
+	client := &mockDynamoDBClient{
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if err := store.ClearQuotaGrace(context.Background(), "user-1"); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
+
+func TestListMeta_ReturnsAccountsAndCursor(t *testing.T) {
+	var capturedInput *dynamodb.ScanInput
+	client := &mockDynamoDBClient{
+		scanFunc: func(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+			capturedInput = params
+			return &dynamodb.ScanOutput{
+				Items: []map[string]types.AttributeValue{
+					{
+						"pk":         &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+						"sk":         &types.AttributeValueMemberS{Value: "META#"},
+						"quotaBytes": &types.AttributeValueMemberN{Value: "1000"},
+					},
+				},
+				LastEvaluatedKey: map[string]types.AttributeValue{
+					"pk": &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+					"sk": &types.AttributeValueMemberS{Value: "META#"},
+				},
+			}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	metas, cursor, err := store.ListMeta(context.Background(), 25, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(metas) != 1 || metas[0].AccountID != "user-1" || metas[0].QuotaBytes != 1000 {
+		t.Fatalf("unexpected metas: %+v", metas)
+	}
+	if *capturedInput.Limit != 25 {
+		t.Errorf("expected limit 25, got %d", *capturedInput.Limit)
+	}
+	if capturedInput.ExclusiveStartKey != nil {
+		t.Error("expected no ExclusiveStartKey for first page")
+	}
+	if cursor == "" {
+		t.Fatal("expected a cursor for the next page")
+	}
+
+	// The cursor must round-trip into the next scan's ExclusiveStartKey
+	if _, _, err := store.ListMeta(context.Background(), 25, cursor); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	pk := capturedInput.ExclusiveStartKey["pk"].(*types.AttributeValueMemberS).Value
+	if pk != "ACCOUNT#user-1" {
+		t.Errorf("expected ExclusiveStartKey pk ACCOUNT#user-1, got %s", pk)
+	}
+}
+
+func TestListMeta_InvalidCursor_ReturnsErrInvalidCursor(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "test-table")
+
+	_, _, err := store.ListMeta(context.Background(), 25, "!!not-base64!!")
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("expected ErrInvalidCursor, got %v", err)
+	}
+}
+
+func TestGetBlobUsage_AggregatesAcrossPages(t *testing.T) {
+	calls := 0
+	client := &mockDynamoDBClient{
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			calls++
+			if calls == 1 {
+				return &dynamodb.QueryOutput{
+					Items: []map[string]types.AttributeValue{
+						{"size": &types.AttributeValueMemberN{Value: "100"}},
+						{"size": &types.AttributeValueMemberN{Value: "200"}, "status": &types.AttributeValueMemberS{Value: "confirmed"}},
+					},
+					LastEvaluatedKey: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+						"sk": &types.AttributeValueMemberS{Value: "BLOB#b2"},
+					},
+				}, nil
+			}
+			return &dynamodb.QueryOutput{
+				Items: []map[string]types.AttributeValue{
+					{"size": &types.AttributeValueMemberN{Value: "50"}, "status": &types.AttributeValueMemberS{Value: "pending"}},
+					{"size": &types.AttributeValueMemberN{Value: "75"}, "deletedAt": &types.AttributeValueMemberS{Value: "2025-01-01T00:00:00Z"}},
+				},
+			}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	usage, err := store.GetBlobUsage(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 query pages, got %d", calls)
+	}
+	want := BlobUsage{Count: 4, ConfirmedCount: 2, PendingCount: 1, DeletedCount: 1, ConfirmedBytes: 300}
+	if *usage != want {
+		t.Errorf("expected %+v, got %+v", want, *usage)
+	}
+}
+
+func metaItem(quotaBytes, quotaRemaining string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk":             &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+		"sk":             &types.AttributeValueMemberS{Value: "META#"},
+		"quotaBytes":     &types.AttributeValueMemberN{Value: quotaBytes},
+		"quotaRemaining": &types.AttributeValueMemberN{Value: quotaRemaining},
+	}
+}
+
+func TestSetQuota_AdjustsRemainingByDelta(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: metaItem("1000", "400")}, nil
+		},
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return &dynamodb.UpdateItemOutput{Attributes: metaItem("3000", "2400")}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	change, err := store.SetQuota(context.Background(), "user-1", 3000, "pro", 20)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if change.PreviousQuotaBytes != 1000 {
+		t.Errorf("expected previous quota 1000, got %d", change.PreviousQuotaBytes)
+	}
+	if change.Meta.QuotaRemaining != 2400 {
+		t.Errorf("expected quotaRemaining 2400, got %d", change.Meta.QuotaRemaining)
+	}
+
+	input := client.lastUpdateInput
+	if !strings.Contains(*input.UpdateExpression, "ADD quotaRemaining :delta") {
+		t.Errorf("expected atomic ADD of delta, got %s", *input.UpdateExpression)
+	}
+	if !strings.Contains(*input.UpdateExpression, "tier = :tier") {
+		t.Errorf("expected tier to be set, got %s", *input.UpdateExpression)
+	}
+	if !strings.Contains(*input.UpdateExpression, "maxPendingAllocations = :maxPending") ||
+		input.ExpressionAttributeValues[":maxPending"].(*types.AttributeValueMemberN).Value != "20" {
+		t.Errorf("expected the tier's maxPendingAllocations to be set, got %s", *input.UpdateExpression)
+	}
+	if v := input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value; v != "2000" {
+		t.Errorf("expected delta 2000, got %s", v)
+	}
+	if v := input.ExpressionAttributeValues[":old"].(*types.AttributeValueMemberN).Value; v != "1000" {
+		t.Errorf("expected :old 1000, got %s", v)
+	}
+}
+
+func TestSetQuota_TierWithoutPendingLimit_RemovesOverride(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: metaItem("1000", "400")}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetQuota(context.Background(), "user-1", 1000, "standard", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(*client.lastUpdateInput.UpdateExpression, " REMOVE maxPendingAllocations") {
+		t.Errorf("expected maxPendingAllocations removed, got %s", *client.lastUpdateInput.UpdateExpression)
+	}
+}
+
+func TestSetQuota_Decrease_UsesNegativeDelta(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: metaItem("1000", "400")}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetQuota(context.Background(), "user-1", 500, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if v := input.ExpressionAttributeValues[":delta"].(*types.AttributeValueMemberN).Value; v != "-500" {
+		t.Errorf("expected delta -500, got %s", v)
+	}
+	if strings.Contains(*input.UpdateExpression, "tier") || strings.Contains(*input.UpdateExpression, "maxPendingAllocations") {
+		t.Errorf("expected tier and pending limit to be left alone, got %s", *input.UpdateExpression)
+	}
+}
+
+func TestSetQuota_MissingAccount_ReturnsErrAccountNotFound(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "test-table")
+
+	_, err := store.SetQuota(context.Background(), "missing", 500, "", 0)
+	if !errors.Is(err, ErrAccountNotFound) {
+		t.Fatalf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestSetQuota_RetriesOnConflict(t *testing.T) {
+	gets := 0
+	updates := 0
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			gets++
+			return &dynamodb.GetItemOutput{Item: metaItem("1000", "400")}, nil
+		},
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			updates++
+			if updates == 1 {
+				return nil, &types.ConditionalCheckFailedException{}
+			}
+			return &dynamodb.UpdateItemOutput{Attributes: metaItem("2000", "1400")}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if _, err := store.SetQuota(context.Background(), "user-1", 2000, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gets != 2 || updates != 2 {
+		t.Errorf("expected 2 reads and 2 updates, got %d/%d", gets, updates)
+	}
+}
+
+func TestSetQuota_PersistentConflict_ReturnsErrConcurrentUpdate(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: metaItem("1000", "400")}, nil
+		},
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	_, err := store.SetQuota(context.Background(), "user-1", 2000, "", 0)
+	if !errors.Is(err, ErrConcurrentUpdate) {
+		t.Fatalf("expected ErrConcurrentUpdate, got %v", err)
+	}
+}
+
+func TestIsValidID(t *testing.T) {
+	valid := []string{"user-1", "0f8fad5b-d9cb-469f-a165-70867728950e", "shared.support_inbox"}
+	for _, id := range valid {
+		if !IsValidID(id) {
+			t.Errorf("expected %q to be valid", id)
+		}
+	}
+
+	invalid := []string{"", ".hidden", "a/b", "a&b", "user 1", "user#1", strings.Repeat("a", MaxIDLength+1)}
+	for _, id := range invalid {
+		if IsValidID(id) {
+			t.Errorf("expected %q to be invalid", id)
+		}
+	}
+}
+
+func TestCreateMeta_WritesRecordWithFullQuota(t *testing.T) {
+	var captured *dynamodb.PutItemInput
+	client := &mockDynamoDBClient{
+		putItemFunc: func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			captured = params
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	meta, err := store.CreateMeta(context.Background(), Meta{AccountID: "shared-1", AccountType: "service", QuotaBytes: 5000})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if meta.QuotaRemaining != 5000 || meta.CreatedAt == "" {
+		t.Errorf("unexpected meta: %+v", meta)
+	}
+	if pk := captured.Item["pk"].(*types.AttributeValueMemberS).Value; pk != "ACCOUNT#shared-1" {
+		t.Errorf("unexpected pk: %s", pk)
+	}
+	if sk := captured.Item["sk"].(*types.AttributeValueMemberS).Value; sk != "META#" {
+		t.Errorf("unexpected sk: %s", sk)
+	}
+	if v := captured.Item["quotaRemaining"].(*types.AttributeValueMemberN).Value; v != "5000" {
+		t.Errorf("unexpected quotaRemaining: %s", v)
+	}
+	if *captured.ConditionExpression != "attribute_not_exists(pk)" {
+		t.Errorf("unexpected condition: %s", *captured.ConditionExpression)
+	}
+}
+
+func TestCreateMeta_Exists_ReturnsErrAccountExists(t *testing.T) {
+	client := &mockDynamoDBClient{
+		putItemFunc: func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	_, err := store.CreateMeta(context.Background(), Meta{AccountID: "shared-1", QuotaBytes: 5000})
+	if !errors.Is(err, ErrAccountExists) {
+		t.Errorf("expected ErrAccountExists, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package account
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// ActivityInterval is how old an account's lastActivityAt may be before a
+// request records activity again, so a busy account costs one META# write
+// an hour rather than one per request
+const ActivityInterval = time.Hour
+
+// Actions the account-reaper takes on an inactive account, besides flagging
+// it and publishing account.inactive
+const (
+	InactiveFlag     = "flag"
+	InactiveSuspend  = "suspend"
+	InactiveDeletion = "schedule-deletion"
+)
+
+// InactiveSuspendedReason is the suspendedReason of accounts the
+// account-reaper suspends
+const InactiveSuspendedReason = "inactive"
+
+// LastActive returns when the account was last seen: the latest of its
+// lastActivityAt, lastDiscoveryAccess and createdAt. It is the zero time if
+// none of them is set.
+func (m *Meta) LastActive() time.Time {
+	var last time.Time
+	for _, value := range []string{m.LastActivityAt, m.LastDiscoveryAccess, m.CreatedAt} {
+		if t, err := time.Parse(time.RFC3339, value); err == nil && t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// ActivityDue reports whether a request for the account should record
+// activity: none is recorded within ActivityInterval, or the account is
+// flagged inactive. It is false for a nil meta, as an unprovisioned account
+// has no record to update.
+func ActivityDue(meta *Meta, now time.Time) bool {
+	if meta == nil {
+		return false
+	}
+	if meta.InactiveAt != "" {
+		return true
+	}
+	last, err := time.Parse(time.RFC3339, meta.LastActivityAt)
+	return err != nil || now.Sub(last) >= ActivityInterval
+}
+
+// RecordActivity sets an account's lastActivityAt to now and clears any
+// inactive flag and scheduled deletion; a suspension by the account-reaper
+// is left for an operator to lift. The update is conditional on activity
+// being due, so concurrent requests write it once, and it does nothing for
+// an account without a META# record.
+func (d *DynamoDBStore) RecordActivity(ctx context.Context, accountID string, now time.Time) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.tableName),
+		Key:                 metaKey(accountID),
+		UpdateExpression:    aws.String("SET lastActivityAt = :now REMOVE inactiveAt, deletionScheduledAt"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND (attribute_not_exists(lastActivityAt) OR lastActivityAt < :due OR attribute_exists(inactiveAt))"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":now": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+			":due": &types.AttributeValueMemberS{Value: now.Add(-ActivityInterval).UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil && !dbclient.IsConditionalCheckFailed(err) {
+		return fmt.Errorf("failed to record account activity: %w", err)
+	}
+	return nil
+}
+
+// MarkInactive flags an account inactive and takes the action, writing event
+// to the outbox in the same transaction. deletionAt is recorded as the
+// account's deletionScheduledAt for InactiveDeletion. The update is
+// conditional on the account not being flagged already and not having been
+// active since cutoff, so an account that becomes active while the
+// account-reaper runs is left alone; marked is false in either case.
+func (d *DynamoDBStore) MarkInactive(ctx context.Context, accountID, action string, cutoff, deletionAt time.Time, event publisher.EventPayload) (marked bool, err error) {
+	now := time.Now()
+	exprValues := map[string]types.AttributeValue{
+		":now":    &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+		":cutoff": &types.AttributeValueMemberS{Value: cutoff.UTC().Format(time.RFC3339)},
+	}
+
+	updateExpr := "SET inactiveAt = :now, updatedAt = :now"
+	switch action {
+	case InactiveFlag:
+	case InactiveSuspend:
+		updateExpr += ", suspended = :suspended, suspendedAt = :now, suspendedReason = :reason"
+		exprValues[":suspended"] = &types.AttributeValueMemberBOOL{Value: true}
+		exprValues[":reason"] = &types.AttributeValueMemberS{Value: InactiveSuspendedReason}
+	case InactiveDeletion:
+		updateExpr += ", deletionScheduledAt = :deletionAt"
+		exprValues[":deletionAt"] = &types.AttributeValueMemberS{Value: deletionAt.UTC().Format(time.RFC3339)}
+	default:
+		return false, fmt.Errorf("unknown inactive account action %q", action)
+	}
+
+	outboxItem, err := outbox.Put(d.tableName, uuid.New().String(), event, now)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:        aws.String(d.tableName),
+					Key:              metaKey(accountID),
+					UpdateExpression: aws.String(updateExpr),
+					ConditionExpression: aws.String("attribute_exists(pk) AND attribute_not_exists(inactiveAt)" +
+						" AND (attribute_not_exists(lastActivityAt) OR lastActivityAt < :cutoff)" +
+						" AND (attribute_not_exists(lastDiscoveryAccess) OR lastDiscoveryAccess < :cutoff)" +
+						" AND (attribute_not_exists(createdAt) OR createdAt < :cutoff)"),
+					ExpressionAttributeValues: exprValues,
+				},
+			},
+			outboxItem,
+		},
+	})
+	if err != nil {
+		if dbclient.GetConditionalCheckFailureIndex(err) == 0 {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to mark account inactive: %w", err)
+	}
+	return true, nil
+}
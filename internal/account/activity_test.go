@@ -0,0 +1,150 @@
+package account
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+var activityNow = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestLastActive_TakesLatest(t *testing.T) {
+	meta := &Meta{
+		CreatedAt:           "2026-01-01T00:00:00Z",
+		LastDiscoveryAccess: "2026-03-01T00:00:00Z",
+		LastActivityAt:      "2026-02-01T00:00:00Z",
+	}
+	if got := meta.LastActive(); !got.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected lastDiscoveryAccess, got %v", got)
+	}
+	if got := (&Meta{}).LastActive(); !got.IsZero() {
+		t.Errorf("expected the zero time, got %v", got)
+	}
+}
+
+func TestActivityDue(t *testing.T) {
+	recent := activityNow.Add(-time.Minute).Format(time.RFC3339)
+	stale := activityNow.Add(-2 * time.Hour).Format(time.RFC3339)
+	tests := []struct {
+		name string
+		meta *Meta
+		want bool
+	}{
+		{"unprovisioned", nil, false},
+		{"never recorded", &Meta{}, true},
+		{"recent", &Meta{LastActivityAt: recent}, false},
+		{"stale", &Meta{LastActivityAt: stale}, true},
+		{"recent but inactive", &Meta{LastActivityAt: recent, InactiveAt: recent}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ActivityDue(tt.meta, activityNow); got != tt.want {
+				t.Errorf("ActivityDue() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordActivity_SetsTimestampAndClearsInactive(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if err := store.RecordActivity(context.Background(), "user-1", activityNow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := client.lastUpdateInput
+	if *input.UpdateExpression != "SET lastActivityAt = :now REMOVE inactiveAt, deletionScheduledAt" {
+		t.Errorf("unexpected update expression: %s", *input.UpdateExpression)
+	}
+	if !strings.Contains(*input.ConditionExpression, "lastActivityAt < :due") {
+		t.Errorf("expected condition on stale activity, got %s", *input.ConditionExpression)
+	}
+	if due := input.ExpressionAttributeValues[":due"].(*types.AttributeValueMemberS).Value; due != "2026-06-01T11:00:00Z" {
+		t.Errorf("unexpected due time %s", due)
+	}
+}
+
+func TestRecordActivity_ConditionFailed_ReturnsNil(t *testing.T) {
+	client := &mockDynamoDBClient{
+		updateItemFunc: func(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	if err := store.RecordActivity(context.Background(), "user-1", activityNow); err != nil {
+		t.Fatalf("expected nil, got %v", err)
+	}
+}
+
+func TestMarkInactive_Actions(t *testing.T) {
+	cutoff := activityNow.Add(-90 * 24 * time.Hour)
+	deletionAt := activityNow.Add(30 * 24 * time.Hour)
+	tests := []struct {
+		action string
+		want   string
+	}{
+		{InactiveFlag, "SET inactiveAt = :now, updatedAt = :now"},
+		{InactiveSuspend, "SET inactiveAt = :now, updatedAt = :now, suspended = :suspended, suspendedAt = :now, suspendedReason = :reason"},
+		{InactiveDeletion, "SET inactiveAt = :now, updatedAt = :now, deletionScheduledAt = :deletionAt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			var input *dynamodb.TransactWriteItemsInput
+			client := &mockDynamoDBClient{
+				transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+					input = params
+					return &dynamodb.TransactWriteItemsOutput{}, nil
+				},
+			}
+			store := NewDynamoDBStore(client, "test-table")
+			event := publisher.EventPayload{EventType: publisher.EventAccountInactive, AccountID: "user-1"}
+
+			marked, err := store.MarkInactive(context.Background(), "user-1", tt.action, cutoff, deletionAt, event)
+			if err != nil || !marked {
+				t.Fatalf("expected the account marked, got %v, %v", marked, err)
+			}
+			if len(input.TransactItems) != 2 || input.TransactItems[1].Put == nil {
+				t.Fatalf("expected the META# update and an outbox put, got %+v", input.TransactItems)
+			}
+			update := input.TransactItems[0].Update
+			if *update.UpdateExpression != tt.want {
+				t.Errorf("unexpected update expression: %s", *update.UpdateExpression)
+			}
+			if !strings.Contains(*update.ConditionExpression, "attribute_not_exists(inactiveAt)") {
+				t.Errorf("expected condition on inactiveAt, got %s", *update.ConditionExpression)
+			}
+			if got := update.ExpressionAttributeValues[":cutoff"].(*types.AttributeValueMemberS).Value; got != "2026-03-03T12:00:00Z" {
+				t.Errorf("unexpected cutoff %s", got)
+			}
+		})
+	}
+}
+
+func TestMarkInactive_ActiveSinceCutoff_ReturnsFalse(t *testing.T) {
+	client := &mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, transactionCanceled(2, 0)
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	marked, err := store.MarkInactive(context.Background(), "user-1", InactiveFlag, activityNow, time.Time{}, publisher.EventPayload{AccountID: "user-1"})
+	if err != nil || marked {
+		t.Errorf("expected not marked without error, got %v, %v", marked, err)
+	}
+}
+
+func TestMarkInactive_UnknownAction(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "test-table")
+
+	if _, err := store.MarkInactive(context.Background(), "user-1", "delete", activityNow, time.Time{}, publisher.EventPayload{}); err == nil {
+		t.Error("expected an error for an unknown action")
+	}
+}
@@ -0,0 +1,237 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Key prefixes for alias records. Each alias is stored twice: a lookup
+// record at ALIAS#{alias} that resolves it, and an ALIAS#{alias} record
+// under the account for listing.
+const (
+	PrefixAlias = "ALIAS#"
+	SKAlias     = "ALIAS#"
+)
+
+// MaxAliasLength is the longest alias accepted (the maximum email address length)
+const MaxAliasLength = 254
+
+// ErrAliasNotFound is returned when an alias does not resolve to an account
+var ErrAliasNotFound = errors.New("alias not found")
+
+// ErrAliasExists is returned by PutAlias when the alias belongs to an account
+var ErrAliasExists = errors.New("alias already exists")
+
+// Alias is a human-friendly name that resolves to an account ID
+type Alias struct {
+	Alias     string `dynamodbav:"alias" json:"alias"`
+	AccountID string `dynamodbav:"accountId" json:"accountId"`
+	CreatedAt string `dynamodbav:"createdAt" json:"createdAt"`
+}
+
+// IsAlias reports whether an identifier is an alias rather than an account
+// ID. Aliases must contain '@', which account IDs never do, so the two
+// namespaces cannot collide.
+func IsAlias(id string) bool {
+	return strings.Contains(id, "@")
+}
+
+// NormalizeAlias lowercases an alias so lookups are case-insensitive
+func NormalizeAlias(alias string) string {
+	return strings.ToLower(alias)
+}
+
+// IsValidAlias reports whether an alias can be stored: an '@' somewhere after
+// the first character, at most MaxAliasLength bytes, and no whitespace,
+// control characters or '/' since aliases appear in URL paths.
+func IsValidAlias(alias string) bool {
+	if len(alias) > MaxAliasLength || strings.IndexByte(alias, '@') < 1 {
+		return false
+	}
+	for _, c := range alias {
+		if c <= ' ' || c == 0x7f || c == '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// aliasKey builds the primary key of an alias lookup record
+func aliasKey(alias string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: PrefixAlias + alias},
+		"sk": &types.AttributeValueMemberS{Value: SKAlias},
+	}
+}
+
+// accountAliasKey builds the primary key of the alias record under an account
+func accountAliasKey(accountID, alias string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKAlias + alias},
+	}
+}
+
+// ResolveAlias returns the account ID an alias belongs to.
+// Returns ErrAliasNotFound if the alias is not registered.
+func (d *DynamoDBStore) ResolveAlias(ctx context.Context, alias string) (string, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       aliasKey(NormalizeAlias(alias)),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if result.Item == nil {
+		return "", ErrAliasNotFound
+	}
+
+	accountID, ok := result.Item["accountId"].(*types.AttributeValueMemberS)
+	if !ok || accountID.Value == "" {
+		return "", fmt.Errorf("alias record missing accountId")
+	}
+
+	return accountID.Value, nil
+}
+
+// PutAlias registers an alias for an account. Returns ErrAccountNotFound if
+// the account does not exist and ErrAliasExists if the alias is already taken.
+func (d *DynamoDBStore) PutAlias(ctx context.Context, accountID, alias string) (*Alias, error) {
+	record := Alias{
+		Alias:     NormalizeAlias(alias),
+		AccountID: accountID,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	av, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal alias: %w", err)
+	}
+	lookupItem := make(map[string]types.AttributeValue, len(av)+2)
+	accountItem := make(map[string]types.AttributeValue, len(av)+2)
+	for k, v := range av {
+		lookupItem[k] = v
+		accountItem[k] = v
+	}
+	for k, v := range aliasKey(record.Alias) {
+		lookupItem[k] = v
+	}
+	for k, v := range accountAliasKey(accountID, record.Alias) {
+		accountItem[k] = v
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName:           aws.String(d.tableName),
+					Key:                 metaKey(accountID),
+					ConditionExpression: aws.String("attribute_exists(pk)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(d.tableName),
+					Item:                lookupItem,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(d.tableName),
+					Item:      accountItem,
+				},
+			},
+		},
+	})
+	if err != nil {
+		switch dbclient.GetConditionalCheckFailureIndex(err) {
+		case 0:
+			return nil, ErrAccountNotFound
+		case 1:
+			return nil, ErrAliasExists
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// DeleteAlias removes an alias from an account.
+// Returns ErrAliasNotFound if the alias does not belong to the account.
+func (d *DynamoDBStore) DeleteAlias(ctx context.Context, accountID, alias string) error {
+	alias = NormalizeAlias(alias)
+
+	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName:           aws.String(d.tableName),
+					Key:                 aliasKey(alias),
+					ConditionExpression: aws.String("accountId = :accountId"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":accountId": &types.AttributeValueMemberS{Value: accountID},
+					},
+				},
+			},
+			{
+				Delete: &types.Delete{
+					TableName: aws.String(d.tableName),
+					Key:       accountAliasKey(accountID, alias),
+				},
+			},
+		},
+	})
+	if err != nil {
+		if dbclient.HasConditionalCheckFailure(err) {
+			return ErrAliasNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// ListAliases returns the aliases registered for an account, ordered by alias
+func (d *DynamoDBStore) ListAliases(ctx context.Context, accountID string) ([]Alias, error) {
+	aliases := []Alias{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :alias)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":    &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+				":alias": &types.AttributeValueMemberS{Value: SKAlias},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			var alias Alias
+			if err := attributevalue.UnmarshalMap(item, &alias); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal alias: %w", err)
+			}
+			aliases = append(aliases, alias)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return aliases, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,178 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// transactionCanceled builds a TransactionCanceledException with a
+// ConditionalCheckFailed reason at the given index
+func transactionCanceled(items, failedIndex int) error {
+	reasons := make([]types.CancellationReason, items)
+	for i := range reasons {
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+	}
+	reasons[failedIndex].Code = aws.String("ConditionalCheckFailed")
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+func TestIsValidAlias(t *testing.T) {
+	valid := []string{"alice@example.com", "A.B+tag@example.org", "x@y"}
+	for _, alias := range valid {
+		if !IsValidAlias(alias) {
+			t.Errorf("expected %q to be valid", alias)
+		}
+	}
+
+	invalid := []string{"", "user-1", "@example.com", "a b@example.com", "a/b@example.com", "a@b\n"}
+	for _, alias := range invalid {
+		if IsValidAlias(alias) {
+			t.Errorf("expected %q to be invalid", alias)
+		}
+	}
+}
+
+func TestIsAlias_DisjointFromAccountIDs(t *testing.T) {
+	if IsAlias("user-1") || !IsAlias("alice@example.com") {
+		t.Error("expected only identifiers containing @ to be aliases")
+	}
+	if IsValidID("alice@example.com") {
+		t.Error("expected aliases to never be valid account IDs")
+	}
+}
+
+func TestResolveAlias_ReturnsAccountID(t *testing.T) {
+	var capturedKey map[string]types.AttributeValue
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			capturedKey = params.Key
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"accountId": &types.AttributeValueMemberS{Value: "user-1"},
+			}}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	accountID, err := store.ResolveAlias(context.Background(), "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if accountID != "user-1" {
+		t.Errorf("expected user-1, got %s", accountID)
+	}
+	if pk := capturedKey["pk"].(*types.AttributeValueMemberS).Value; pk != "ALIAS#alice@example.com" {
+		t.Errorf("expected normalized lookup key, got %s", pk)
+	}
+}
+
+func TestResolveAlias_Missing_ReturnsNotFound(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "table")
+
+	if _, err := store.ResolveAlias(context.Background(), "alice@example.com"); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("expected ErrAliasNotFound, got %v", err)
+	}
+}
+
+func TestPutAlias_WritesLookupAndAccountRecords(t *testing.T) {
+	var captured *dynamodb.TransactWriteItemsInput
+	client := &mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	alias, err := store.PutAlias(context.Background(), "user-1", "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if alias.Alias != "alice@example.com" || alias.AccountID != "user-1" || alias.CreatedAt == "" {
+		t.Errorf("unexpected alias: %+v", alias)
+	}
+
+	items := captured.TransactItems
+	if len(items) != 3 {
+		t.Fatalf("expected 3 transaction items, got %d", len(items))
+	}
+	if pk := items[0].ConditionCheck.Key["pk"].(*types.AttributeValueMemberS).Value; pk != "ACCOUNT#user-1" {
+		t.Errorf("expected account existence check, got %s", pk)
+	}
+	if pk := items[1].Put.Item["pk"].(*types.AttributeValueMemberS).Value; pk != "ALIAS#alice@example.com" {
+		t.Errorf("unexpected lookup pk %s", pk)
+	}
+	if sk := items[2].Put.Item["sk"].(*types.AttributeValueMemberS).Value; sk != "ALIAS#alice@example.com" {
+		t.Errorf("unexpected account alias sk %s", sk)
+	}
+}
+
+func TestPutAlias_MapsConditionFailures(t *testing.T) {
+	tests := []struct {
+		index int
+		want  error
+	}{
+		{0, ErrAccountNotFound},
+		{1, ErrAliasExists},
+	}
+	for _, tc := range tests {
+		client := &mockDynamoDBClient{
+			transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+				return nil, transactionCanceled(3, tc.index)
+			},
+		}
+		store := NewDynamoDBStore(client, "table")
+
+		if _, err := store.PutAlias(context.Background(), "user-1", "alice@example.com"); !errors.Is(err, tc.want) {
+			t.Errorf("index %d: expected %v, got %v", tc.index, tc.want, err)
+		}
+	}
+}
+
+func TestDeleteAlias_WrongAccount_ReturnsNotFound(t *testing.T) {
+	var captured *dynamodb.TransactWriteItemsInput
+	client := &mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return nil, transactionCanceled(2, 0)
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	if err := store.DeleteAlias(context.Background(), "user-2", "alice@example.com"); !errors.Is(err, ErrAliasNotFound) {
+		t.Errorf("expected ErrAliasNotFound, got %v", err)
+	}
+	if id := captured.TransactItems[0].Delete.ExpressionAttributeValues[":accountId"].(*types.AttributeValueMemberS).Value; id != "user-2" {
+		t.Errorf("expected delete conditioned on owning account, got %s", id)
+	}
+}
+
+func TestListAliases_PagesThroughResults(t *testing.T) {
+	calls := 0
+	client := &mockDynamoDBClient{
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			calls++
+			output := &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{{
+				"alias":     &types.AttributeValueMemberS{Value: "a" + string(rune('0'+calls)) + "@example.com"},
+				"accountId": &types.AttributeValueMemberS{Value: "user-1"},
+			}}}
+			if calls == 1 {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "x"}}
+			}
+			return output, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	aliases, err := store.ListAliases(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(aliases) != 2 || aliases[0].Alias != "a1@example.com" || aliases[1].Alias != "a2@example.com" {
+		t.Errorf("unexpected aliases: %+v", aliases)
+	}
+}
@@ -0,0 +1,85 @@
+package account
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// DefaultAccountType is the accountType of accounts created on first login.
+// Accounts that predate accountType are treated as this type.
+const DefaultAccountType = "default"
+
+// CoreCapability is always offered, whatever an accountType's capability subset
+const CoreCapability = "urn:ietf:params:jmap:core"
+
+// Features are the capabilities and limits that apply to accounts of one
+// accountType. The zero value imposes no restrictions.
+type Features struct {
+	// Multipart allows Blob/allocate multipart uploads; nil allows them
+	Multipart *bool `json:"multipart,omitempty"`
+	// MaxBlobSize caps the size of a single blob in bytes; zero keeps the
+	// deployment limits
+	MaxBlobSize int64 `json:"maxBlobSize,omitempty"`
+	// Capabilities lists the capabilities offered to the account; empty
+	// offers every registered capability
+	Capabilities []string `json:"capabilities,omitempty"`
+}
+
+// MultipartAllowed reports whether multipart uploads are available
+func (f Features) MultipartAllowed() bool {
+	return f.Multipart == nil || *f.Multipart
+}
+
+// AllowsCapability reports whether a capability is offered to the account
+func (f Features) AllowsCapability(capability string) bool {
+	if len(f.Capabilities) == 0 || capability == CoreCapability {
+		return true
+	}
+	for _, c := range f.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// BlobSizeLimit returns the smaller of limit and MaxBlobSize, when set
+func (f Features) BlobSizeLimit(limit int64) int64 {
+	if f.MaxBlobSize > 0 && (limit <= 0 || f.MaxBlobSize < limit) {
+		return f.MaxBlobSize
+	}
+	return limit
+}
+
+// FeatureFlags maps an accountType to its features
+type FeatureFlags map[string]Features
+
+// ParseFeatureFlags parses a JSON object of accountType to features, e.g.
+// {"service": {"multipart": true}, "trial": {"multipart": false, "maxBlobSize": 10485760,
+// "capabilities": ["urn:ietf:params:jmap:mail"]}}. An empty string yields no flags.
+func ParseFeatureFlags(value string) (FeatureFlags, error) {
+	flags := FeatureFlags{}
+	if value == "" {
+		return flags, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &flags); err != nil {
+		return nil, fmt.Errorf("invalid account type features: %w", err)
+	}
+	for accountType, features := range flags {
+		if features.MaxBlobSize < 0 {
+			return nil, fmt.Errorf("invalid account type features: %q must not have a negative maxBlobSize", accountType)
+		}
+	}
+
+	return flags, nil
+}
+
+// For returns the features of an accountType. Types without an entry have
+// no restrictions.
+func (f FeatureFlags) For(accountType string) Features {
+	if accountType == "" {
+		accountType = DefaultAccountType
+	}
+	return f[accountType]
+}
@@ -0,0 +1,81 @@
+package account
+
+import "testing"
+
+func TestParseFeatureFlags_Empty(t *testing.T) {
+	flags, err := ParseFeatureFlags("")
+	if err != nil || len(flags) != 0 {
+		t.Errorf("expected no flags, got %v %v", flags, err)
+	}
+}
+
+func TestParseFeatureFlags_Valid(t *testing.T) {
+	flags, err := ParseFeatureFlags(`{"trial": {"multipart": false, "maxBlobSize": 1000, "capabilities": ["urn:x"]}, "service": {"multipart": null}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trial := flags.For("trial")
+	if trial.MultipartAllowed() || trial.MaxBlobSize != 1000 || len(trial.Capabilities) != 1 {
+		t.Errorf("unexpected trial features: %+v", trial)
+	}
+	if !flags.For("service").MultipartAllowed() {
+		t.Error("expected a null multipart flag to allow multipart")
+	}
+}
+
+func TestParseFeatureFlags_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":      `trial`,
+		"negative size": `{"trial": {"maxBlobSize": -1}}`,
+		"wrong type":    `{"trial": {"multipart": "no"}}`,
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseFeatureFlags(value); err == nil {
+				t.Errorf("expected error for %s", value)
+			}
+		})
+	}
+}
+
+func TestFeatureFlagsFor_UnsetTypeUsesDefault(t *testing.T) {
+	flags := FeatureFlags{DefaultAccountType: {MaxBlobSize: 500}}
+
+	if flags.For("").MaxBlobSize != 500 {
+		t.Error("expected accounts without accountType to use the default type")
+	}
+	if flags.For("service").MaxBlobSize != 0 {
+		t.Error("expected unconfigured types to have no restrictions")
+	}
+}
+
+func TestFeaturesAllowsCapability(t *testing.T) {
+	unrestricted := Features{}
+	if !unrestricted.AllowsCapability("urn:anything") {
+		t.Error("expected no subset to allow every capability")
+	}
+
+	subset := Features{Capabilities: []string{"urn:mail"}}
+	if !subset.AllowsCapability("urn:mail") || subset.AllowsCapability("urn:calendars") {
+		t.Error("expected subset to allow only listed capabilities")
+	}
+	if !subset.AllowsCapability(CoreCapability) {
+		t.Error("expected core capability to always be allowed")
+	}
+}
+
+func TestFeaturesBlobSizeLimit(t *testing.T) {
+	if got := (Features{}).BlobSizeLimit(1000); got != 1000 {
+		t.Errorf("expected deployment limit, got %d", got)
+	}
+	if got := (Features{MaxBlobSize: 500}).BlobSizeLimit(1000); got != 500 {
+		t.Errorf("expected smaller account type limit, got %d", got)
+	}
+	if got := (Features{MaxBlobSize: 5000}).BlobSizeLimit(1000); got != 1000 {
+		t.Errorf("expected account type limit not to raise deployment limit, got %d", got)
+	}
+	if got := (Features{MaxBlobSize: 500}).BlobSizeLimit(0); got != 500 {
+		t.Errorf("expected account type limit when there is no deployment limit, got %d", got)
+	}
+}
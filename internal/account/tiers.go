@@ -0,0 +1,123 @@
+package account
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Key of the optional config record holding tier presets. Its "tiers"
+// attribute is a JSON string in the same format as QUOTA_TIERS.
+const (
+	PKConfig     = "CONFIG#"
+	SKQuotaTiers = "QUOTA_TIERS#"
+)
+
+// Tier is a preset of the quota and limits applied to an account
+type Tier struct {
+	QuotaBytes int64 `json:"quotaBytes"`
+	// MaxPendingAllocations overrides the deployment-wide pending allocation
+	// limit for the account; zero keeps the deployment default
+	MaxPendingAllocations int `json:"maxPendingAllocations,omitempty"`
+}
+
+// UnmarshalJSON accepts either a preset object or a bare number, which is
+// shorthand for a preset with only a quota
+func (t *Tier) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] != '{' && !bytes.Equal(data, []byte("null")) {
+		return json.Unmarshal(data, &t.QuotaBytes)
+	}
+	type plain Tier
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// Tiers maps a quota tier name to its preset.
+// Tier names double as Cognito group names: a user in the "pro" group is
+// provisioned with the "pro" tier's preset on first login.
+type Tiers map[string]Tier
+
+// ParseTiers parses a JSON object of tier name to preset, e.g.
+// {"standard": 1073741824, "pro": {"quotaBytes": 10737418240, "maxPendingAllocations": 20}}.
+// A bare number is a quota in bytes. An empty string yields no tiers.
+func ParseTiers(value string) (Tiers, error) {
+	tiers := Tiers{}
+	if value == "" {
+		return tiers, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &tiers); err != nil {
+		return nil, fmt.Errorf("invalid quota tiers: %w", err)
+	}
+	for name, tier := range tiers {
+		if tier.QuotaBytes <= 0 {
+			return nil, fmt.Errorf("invalid quota tiers: tier %q must have a positive quota", name)
+		}
+		if tier.MaxPendingAllocations < 0 {
+			return nil, fmt.Errorf("invalid quota tiers: tier %q must not have a negative maxPendingAllocations", name)
+		}
+	}
+
+	return tiers, nil
+}
+
+// Merge returns the tiers with overrides applied; a tier in overrides
+// replaces the tier of the same name
+func (t Tiers) Merge(overrides Tiers) Tiers {
+	merged := make(Tiers, len(t)+len(overrides))
+	for name, tier := range t {
+		merged[name] = tier
+	}
+	for name, tier := range overrides {
+		merged[name] = tier
+	}
+	return merged
+}
+
+// ForGroups selects the tier for a user from their group memberships.
+// When the user is in several tier groups the largest quota wins.
+// Returns false if none of the groups is a tier.
+func (t Tiers) ForGroups(groups []string) (string, Tier, bool) {
+	var name string
+	var selected Tier
+	for _, group := range groups {
+		tier, ok := t[group]
+		if !ok {
+			continue
+		}
+		if tier.QuotaBytes > selected.QuotaBytes || (tier.QuotaBytes == selected.QuotaBytes && group < name) {
+			name, selected = group, tier
+		}
+	}
+	return name, selected, name != ""
+}
+
+// LoadTiers reads tier presets from the CONFIG# record.
+// Returns no tiers if the record does not exist.
+func (d *DynamoDBStore) LoadTiers(ctx context.Context) (Tiers, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: PKConfig},
+			"sk": &types.AttributeValueMemberS{Value: SKQuotaTiers},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return Tiers{}, nil
+	}
+
+	value, ok := result.Item["tiers"].(*types.AttributeValueMemberS)
+	if !ok {
+		return nil, fmt.Errorf("quota tiers config record missing tiers")
+	}
+
+	return ParseTiers(value.Value)
+}
@@ -0,0 +1,151 @@
+package account
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+func TestParseTiers_Empty(t *testing.T) {
+	tiers, err := ParseTiers("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(tiers) != 0 {
+		t.Errorf("expected no tiers, got %v", tiers)
+	}
+}
+
+func TestParseTiers_Valid(t *testing.T) {
+	tiers, err := ParseTiers(`{"standard": 1000, "pro": 5000}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tiers["standard"].QuotaBytes != 1000 || tiers["pro"].QuotaBytes != 5000 {
+		t.Errorf("unexpected tiers: %v", tiers)
+	}
+}
+
+func TestParseTiers_PresetWithLimits(t *testing.T) {
+	tiers, err := ParseTiers(`{"standard": 1000, "pro": {"quotaBytes": 5000, "maxPendingAllocations": 20}}`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tiers["standard"] != (Tier{QuotaBytes: 1000}) {
+		t.Errorf("unexpected standard tier: %+v", tiers["standard"])
+	}
+	if tiers["pro"] != (Tier{QuotaBytes: 5000, MaxPendingAllocations: 20}) {
+		t.Errorf("unexpected pro tier: %+v", tiers["pro"])
+	}
+}
+
+func TestParseTiers_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"not json":   `pro=5000`,
+		"zero quota": `{"pro": 0}`,
+		"negative":   `{"pro": -1}`,
+		"wrong type": `{"pro": "big"}`,
+		"no quota":   `{"pro": {"maxPendingAllocations": 5}}`,
+		"neg limit":  `{"pro": {"quotaBytes": 5000, "maxPendingAllocations": -1}}`,
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseTiers(value); err == nil {
+				t.Errorf("expected error for %s", value)
+			}
+		})
+	}
+}
+
+func TestTiersForGroups_LargestQuotaWins(t *testing.T) {
+	tiers := Tiers{"standard": {QuotaBytes: 1000}, "pro": {QuotaBytes: 5000, MaxPendingAllocations: 20}}
+
+	name, tier, ok := tiers.ForGroups([]string{"admins", "standard", "pro"})
+	if !ok {
+		t.Fatal("expected a tier to match")
+	}
+	if name != "pro" || tier.QuotaBytes != 5000 || tier.MaxPendingAllocations != 20 {
+		t.Errorf("expected pro/5000/20, got %s/%+v", name, tier)
+	}
+}
+
+func TestTiersForGroups_NoMatch(t *testing.T) {
+	tiers := Tiers{"pro": {QuotaBytes: 5000}}
+
+	if _, _, ok := tiers.ForGroups([]string{"admins"}); ok {
+		t.Error("expected no tier to match")
+	}
+	if _, _, ok := tiers.ForGroups(nil); ok {
+		t.Error("expected no tier to match for no groups")
+	}
+}
+
+func TestTiersMerge_OverridesByName(t *testing.T) {
+	base := Tiers{"standard": {QuotaBytes: 1000}, "pro": {QuotaBytes: 5000}}
+	merged := base.Merge(Tiers{"pro": {QuotaBytes: 8000}, "team": {QuotaBytes: 9000}})
+
+	if len(merged) != 3 || merged["standard"].QuotaBytes != 1000 || merged["pro"].QuotaBytes != 8000 || merged["team"].QuotaBytes != 9000 {
+		t.Errorf("unexpected merged tiers: %v", merged)
+	}
+	if base["pro"].QuotaBytes != 5000 {
+		t.Error("expected base tiers to be unchanged")
+	}
+}
+
+func TestLoadTiers_ParsesConfigRecord(t *testing.T) {
+	var capturedKey map[string]types.AttributeValue
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			capturedKey = params.Key
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"tiers": &types.AttributeValueMemberS{Value: `{"pro": {"quotaBytes": 5000, "maxPendingAllocations": 20}}`},
+			}}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	tiers, err := store.LoadTiers(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tiers["pro"].MaxPendingAllocations != 20 {
+		t.Errorf("unexpected tiers: %v", tiers)
+	}
+	if pk := capturedKey["pk"].(*types.AttributeValueMemberS).Value; pk != "CONFIG#" {
+		t.Errorf("expected CONFIG# record, got %s", pk)
+	}
+}
+
+func TestLoadTiers_MissingRecord_ReturnsNoTiers(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "table")
+
+	tiers, err := store.LoadTiers(context.Background())
+	if err != nil || len(tiers) != 0 {
+		t.Errorf("expected no tiers, got %v %v", tiers, err)
+	}
+}
+
+func TestLoadTiers_InvalidRecord_ReturnsError(t *testing.T) {
+	client := &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: map[string]types.AttributeValue{
+				"tiers": &types.AttributeValueMemberS{Value: `{"pro": 0}`},
+			}}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+
+	if _, err := store.LoadTiers(context.Background()); err == nil {
+		t.Fatal("expected error for invalid tiers")
+	}
+
+	store = NewDynamoDBStore(&mockDynamoDBClient{getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+		return nil, errors.New("dynamo down")
+	}}, "table")
+	if _, err := store.LoadTiers(context.Background()); err == nil {
+		t.Fatal("expected error when the record cannot be read")
+	}
+}
@@ -0,0 +1,129 @@
+package accountexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+// TargetTypeLambda is the event target type for synchronous plugin callbacks
+const TargetTypeLambda = "lambda"
+
+// EventTargetGetter provides event targets from the plugin registry
+type EventTargetGetter interface {
+	GetEventTargets(eventType string) []plugin.AggregatedEventTarget
+}
+
+// contributionResponse is the response a plugin returns to an account.export callback
+type contributionResponse struct {
+	Files []struct {
+		Name    string `json:"name"`
+		BlobID  string `json:"blobId,omitempty"`
+		Content string `json:"content,omitempty"`
+	} `json:"files"`
+}
+
+// LambdaContributor collects export contributions by synchronously invoking
+// each plugin subscribed to the account.export event with a "lambda" target
+type LambdaContributor struct {
+	client   plugin.LambdaClient
+	registry EventTargetGetter
+}
+
+// NewLambdaContributor creates a new LambdaContributor
+func NewLambdaContributor(client plugin.LambdaClient, registry EventTargetGetter) *LambdaContributor {
+	return &LambdaContributor{
+		client:   client,
+		registry: registry,
+	}
+}
+
+// Contributions invokes every subscribed plugin and gathers their files.
+// A failing plugin does not stop the others; its error is returned alongside
+// the contributions that did succeed.
+func (c *LambdaContributor) Contributions(ctx context.Context, accountID, exportID string) ([]Contribution, error) {
+	payload, err := json.Marshal(publisher.EventPayload{
+		EventType:     publisher.EventAccountExport,
+		OccurredAt:    time.Now().UTC().Format(time.RFC3339),
+		CorrelationID: correlation.FromContext(ctx),
+		AccountID:     accountID,
+		Data: map[string]any{
+			"exportId": exportID,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal export event: %w", err)
+	}
+
+	var contributions []Contribution
+	var errs []error
+	for _, target := range c.registry.GetEventTargets(publisher.EventAccountExport) {
+		if target.TargetType != TargetTypeLambda {
+			logger.WarnContext(ctx, "Export callbacks must use lambda targets, skipping",
+				slog.String("target_type", target.TargetType),
+				slog.String("plugin_id", target.PluginID),
+			)
+			continue
+		}
+
+		files, err := c.invoke(ctx, target, payload)
+		if err != nil {
+			logger.ErrorContext(ctx, "Plugin export callback failed",
+				slog.String("account_id", accountID),
+				slog.String("plugin_id", target.PluginID),
+				slog.String("error", err.Error()),
+			)
+			errs = append(errs, fmt.Errorf("plugin %s: %w", target.PluginID, err))
+			continue
+		}
+		contributions = append(contributions, files...)
+	}
+
+	return contributions, errors.Join(errs...)
+}
+
+// invoke calls one plugin and validates its response
+func (c *LambdaContributor) invoke(ctx context.Context, target plugin.AggregatedEventTarget, payload []byte) ([]Contribution, error) {
+	output, err := c.client.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(target.TargetArn),
+		Payload:      payload,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lambda invocation failed: %w", err)
+	}
+	if output.FunctionError != nil {
+		return nil, fmt.Errorf("function error: %s", aws.ToString(output.FunctionError))
+	}
+
+	var resp contributionResponse
+	if err := json.Unmarshal(output.Payload, &resp); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	contributions := make([]Contribution, 0, len(resp.Files))
+	for _, f := range resp.Files {
+		if f.Name == "" || strings.Contains(f.Name, "..") || strings.HasPrefix(f.Name, "/") {
+			return nil, fmt.Errorf("invalid file name %q", f.Name)
+		}
+		if (f.BlobID == "") == (f.Content == "") {
+			return nil, fmt.Errorf("file %q must have exactly one of blobId or content", f.Name)
+		}
+		contributions = append(contributions, Contribution{
+			PluginID: target.PluginID,
+			Name:     f.Name,
+			BlobID:   f.BlobID,
+			Content:  f.Content,
+		})
+	}
+	return contributions, nil
+}
@@ -0,0 +1,119 @@
+package accountexport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockLambdaClient struct {
+	responses map[string]string
+	errs      map[string]error
+	invoked   []string
+	payload   []byte
+}
+
+func (m *mockLambdaClient) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	arn := aws.ToString(params.FunctionName)
+	m.invoked = append(m.invoked, arn)
+	m.payload = params.Payload
+	if err := m.errs[arn]; err != nil {
+		return nil, err
+	}
+	return &lambda.InvokeOutput{Payload: []byte(m.responses[arn])}, nil
+}
+
+type mockEventTargets struct {
+	targets []plugin.AggregatedEventTarget
+}
+
+func (m *mockEventTargets) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
+	return m.targets
+}
+
+func TestContributions_CollectsFromLambdaTargets(t *testing.T) {
+	client := &mockLambdaClient{
+		responses: map[string]string{
+			"arn:email": `{"files":[{"name":"mailboxes.json","content":"{}"},{"name":"raw/1.eml","blobId":"b1"}]}`,
+		},
+	}
+	registry := &mockEventTargets{targets: []plugin.AggregatedEventTarget{
+		{PluginID: "email", TargetType: "lambda", TargetArn: "arn:email"},
+		{PluginID: "audit", TargetType: "sqs", TargetArn: "arn:queue"},
+	}}
+	c := NewLambdaContributor(client, registry)
+
+	contributions, err := c.Contributions(context.Background(), "user-1", "exp-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(client.invoked) != 1 {
+		t.Fatalf("expected only the lambda target to be invoked, got %v", client.invoked)
+	}
+	if len(contributions) != 2 || contributions[0].PluginID != "email" || contributions[1].BlobID != "b1" {
+		t.Errorf("unexpected contributions: %+v", contributions)
+	}
+
+	var payload publisher.EventPayload
+	if err := json.Unmarshal(client.payload, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.EventType != "account.export" || payload.AccountID != "user-1" || payload.Data["exportId"] != "exp-1" {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestContributions_PluginFailure_ContinuesWithOthers(t *testing.T) {
+	client := &mockLambdaClient{
+		responses: map[string]string{
+			"arn:email": `{"files":[{"name":"a.json","content":"{}"}]}`,
+		},
+		errs: map[string]error{"arn:calendar": errors.New("timeout")},
+	}
+	registry := &mockEventTargets{targets: []plugin.AggregatedEventTarget{
+		{PluginID: "calendar", TargetType: "lambda", TargetArn: "arn:calendar"},
+		{PluginID: "email", TargetType: "lambda", TargetArn: "arn:email"},
+	}}
+	c := NewLambdaContributor(client, registry)
+
+	contributions, err := c.Contributions(context.Background(), "user-1", "exp-1")
+	if err == nil {
+		t.Fatal("expected error for failing plugin")
+	}
+	if len(contributions) != 1 || contributions[0].PluginID != "email" {
+		t.Errorf("expected email contribution to survive, got %+v", contributions)
+	}
+}
+
+func TestContributions_InvalidFiles_Rejected(t *testing.T) {
+	tests := map[string]string{
+		"path traversal":  `{"files":[{"name":"../x","content":"a"}]}`,
+		"absolute path":   `{"files":[{"name":"/x","content":"a"}]}`,
+		"both sources":    `{"files":[{"name":"x","content":"a","blobId":"b"}]}`,
+		"neither source":  `{"files":[{"name":"x"}]}`,
+		"invalid payload": `not json`,
+	}
+	for name, response := range tests {
+		t.Run(name, func(t *testing.T) {
+			client := &mockLambdaClient{responses: map[string]string{"arn:p": response}}
+			registry := &mockEventTargets{targets: []plugin.AggregatedEventTarget{
+				{PluginID: "p", TargetType: "lambda", TargetArn: "arn:p"},
+			}}
+
+			contributions, err := NewLambdaContributor(client, registry).Contributions(context.Background(), "user-1", "exp-1")
+			if err == nil {
+				t.Error("expected error")
+			}
+			if len(contributions) != 0 {
+				t.Errorf("expected no contributions, got %+v", contributions)
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package accountexport
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// SKPrefixExport is the sort key prefix for export job records
+const SKPrefixExport = "EXPORT#"
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by accountexport
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoDBStore implements DB using AWS DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	envelope  *blobcrypt.Envelope
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// WithEncryption opens sealed blob records as they are listed
+func (d *DynamoDBStore) WithEncryption(envelope *blobcrypt.Envelope) *DynamoDBStore {
+	d.envelope = envelope
+	return d
+}
+
+// jobKey builds the primary key of an export job record
+func jobKey(accountID, exportID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKPrefixExport + exportID},
+	}
+}
+
+// jobRecord is the DynamoDB representation of an export job
+type jobRecord struct {
+	AccountID   string `dynamodbav:"accountId"`
+	ExportID    string `dynamodbav:"exportId"`
+	Status      string `dynamodbav:"status"`
+	BlobID      string `dynamodbav:"blobId,omitempty"`
+	Size        int64  `dynamodbav:"size,omitempty"`
+	Error       string `dynamodbav:"error,omitempty"`
+	CreatedAt   string `dynamodbav:"createdAt"`
+	CompletedAt string `dynamodbav:"completedAt,omitempty"`
+}
+
+// CreateJob writes a new export job record.
+// The INSERT on the table stream starts the account-export worker.
+func (d *DynamoDBStore) CreateJob(ctx context.Context, job Job) error {
+	av, err := attributevalue.MarshalMap(jobRecord{
+		AccountID: job.AccountID,
+		ExportID:  job.ExportID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal export job: %w", err)
+	}
+	for k, v := range jobKey(job.AccountID, job.ExportID) {
+		av[k] = v
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	return err
+}
+
+// GetJob retrieves an export job. Returns nil if it does not exist.
+func (d *DynamoDBStore) GetJob(ctx context.Context, accountID, exportID string) (*Job, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       jobKey(accountID, exportID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record jobRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal export job: %w", err)
+	}
+
+	return &Job{
+		AccountID:   record.AccountID,
+		ExportID:    record.ExportID,
+		Status:      record.Status,
+		BlobID:      record.BlobID,
+		Size:        record.Size,
+		Error:       record.Error,
+		CreatedAt:   record.CreatedAt,
+		CompletedAt: record.CompletedAt,
+	}, nil
+}
+
+// StartJob moves a job from pending to running.
+// Returns ErrJobNotPending if the job is missing or already started.
+func (d *DynamoDBStore) StartJob(ctx context.Context, accountID, exportID string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.tableName),
+		Key:                 jobKey(accountID, exportID),
+		UpdateExpression:    aws.String("SET #status = :running"),
+		ConditionExpression: aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":running": &types.AttributeValueMemberS{Value: StatusRunning},
+			":pending": &types.AttributeValueMemberS{Value: StatusPending},
+		},
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrJobNotPending
+		}
+		return err
+	}
+	return nil
+}
+
+// ListBlobs returns the confirmed, non-deleted blobs of an account.
+// Previous export archives are skipped so exports do not nest.
+func (d *DynamoDBStore) ListBlobs(ctx context.Context, accountID string) ([]BlobEntry, error) {
+	var blobs []BlobEntry
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :blob)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":   &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+				":blob": &types.AttributeValueMemberS{Value: "BLOB#"},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			if d.envelope != nil {
+				if err := d.envelope.Open(ctx, item); err != nil {
+					return nil, fmt.Errorf("failed to open blob record: %w", err)
+				}
+			}
+
+			var blob struct {
+				BlobID      string `dynamodbav:"blobId"`
+				ContentType string `dynamodbav:"contentType"`
+				Size        int64  `dynamodbav:"size"`
+				S3Key       string `dynamodbav:"s3Key"`
+				Status      string `dynamodbav:"status"`
+				CreatedAt   string `dynamodbav:"createdAt"`
+				DeletedAt   string `dynamodbav:"deletedAt"`
+				ExportID    string `dynamodbav:"exportId"`
+			}
+			if err := attributevalue.UnmarshalMap(item, &blob); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal blob record: %w", err)
+			}
+
+			// Records from the traditional upload path have no status
+			if blob.DeletedAt != "" || blob.Status == "pending" || blob.ExportID != "" {
+				continue
+			}
+			if blob.BlobID == "" {
+				if sk, ok := item["sk"].(*types.AttributeValueMemberS); ok {
+					blob.BlobID = strings.TrimPrefix(sk.Value, "BLOB#")
+				}
+			}
+
+			blobs = append(blobs, BlobEntry{
+				BlobID:      blob.BlobID,
+				ContentType: blob.ContentType,
+				Size:        blob.Size,
+				S3Key:       blob.S3Key,
+				CreatedAt:   blob.CreatedAt,
+			})
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return blobs, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+// CompleteJob records the archive as a confirmed blob, charges its size to
+// the account quota, and marks the job completed, in a single transaction.
+// The quota is charged unconditionally so an export always completes; blob
+// cleanup restores it when the archive is deleted.
+func (d *DynamoDBStore) CompleteJob(ctx context.Context, job Job, s3Key string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	blobItem, err := attributevalue.MarshalMap(map[string]any{
+		"pk":          dbclient.AccountPK(job.AccountID),
+		"sk":          "BLOB#" + job.BlobID,
+		"blobId":      job.BlobID,
+		"accountId":   job.AccountID,
+		"size":        job.Size,
+		"contentType": ArchiveContentType,
+		"s3Key":       s3Key,
+		"status":      "confirmed",
+		"exportId":    job.ExportID,
+		"createdAt":   now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal blob record: %w", err)
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName: aws.String(d.tableName),
+					Item:      blobItem,
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName: aws.String(d.tableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(job.AccountID)},
+						"sk": &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+					},
+					UpdateExpression: aws.String("ADD quotaRemaining :negSize"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":negSize": &types.AttributeValueMemberN{Value: strconv.FormatInt(-job.Size, 10)},
+					},
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:        aws.String(d.tableName),
+					Key:              jobKey(job.AccountID, job.ExportID),
+					UpdateExpression: aws.String("SET #status = :completed, blobId = :blobId, #size = :size, completedAt = :now"),
+					ExpressionAttributeNames: map[string]string{
+						"#status": "status",
+						"#size":   "size",
+					},
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":completed": &types.AttributeValueMemberS{Value: StatusCompleted},
+						":blobId":    &types.AttributeValueMemberS{Value: job.BlobID},
+						":size":      &types.AttributeValueMemberN{Value: strconv.FormatInt(job.Size, 10)},
+						":now":       &types.AttributeValueMemberS{Value: now},
+					},
+				},
+			},
+		},
+	})
+	return err
+}
+
+// FailJob marks a job as failed with a reason
+func (d *DynamoDBStore) FailJob(ctx context.Context, accountID, exportID, reason string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              jobKey(accountID, exportID),
+		UpdateExpression: aws.String("SET #status = :failed, #error = :reason, completedAt = :now"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+			"#error":  "error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed": &types.AttributeValueMemberS{Value: StatusFailed},
+			":reason": &types.AttributeValueMemberS{Value: reason},
+			":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	return err
+}
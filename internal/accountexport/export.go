@@ -0,0 +1,322 @@
+package accountexport
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+)
+
+var logger = loglevel.New()
+
+// Export job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// ArchiveContentType is the content type of the export archive blob
+const ArchiveContentType = "application/zip"
+
+// ManifestName is the path of the manifest within an export archive
+const ManifestName = "manifest.json"
+
+// ErrJobNotPending is returned by DB.StartJob when the job has already been
+// picked up, so duplicate stream deliveries do not run an export twice
+var ErrJobNotPending = errors.New("export job is not pending")
+
+// Job is an account export job
+type Job struct {
+	AccountID   string `json:"accountId"`
+	ExportID    string `json:"exportId"`
+	Status      string `json:"status"`
+	BlobID      string `json:"blobId,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Error       string `json:"error,omitempty"`
+	CreatedAt   string `json:"createdAt"`
+	CompletedAt string `json:"completedAt,omitempty"`
+}
+
+// BlobEntry is a confirmed blob to be included in an export
+type BlobEntry struct {
+	BlobID      string `json:"blobId"`
+	ContentType string `json:"type"`
+	Size        int64  `json:"size"`
+	S3Key       string `json:"-"`
+	CreatedAt   string `json:"createdAt,omitempty"`
+}
+
+// Contribution is a file a plugin adds to an export. Exactly one of BlobID
+// (a blob already stored in the account) or Content must be set.
+type Contribution struct {
+	PluginID string
+	Name     string
+	BlobID   string
+	Content  string
+}
+
+// ExportError represents a JMAP error from Account/export
+type ExportError struct {
+	Type    string
+	Message string
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// DB handles DynamoDB operations for export jobs
+type DB interface {
+	CreateJob(ctx context.Context, job Job) error
+	GetJob(ctx context.Context, accountID, exportID string) (*Job, error)
+	StartJob(ctx context.Context, accountID, exportID string) error
+	ListBlobs(ctx context.Context, accountID string) ([]BlobEntry, error)
+	CompleteJob(ctx context.Context, job Job, s3Key string) error
+	FailJob(ctx context.Context, accountID, exportID, reason string) error
+}
+
+// Storage handles S3 operations for export archives
+type Storage interface {
+	OpenBlob(ctx context.Context, s3Key string) (io.ReadCloser, error)
+	// WriteArchive streams whatever write produces to a new S3 object and
+	// returns the number of bytes stored
+	WriteArchive(ctx context.Context, accountID, s3Key, contentType string, write func(w io.Writer) error) (int64, error)
+}
+
+// Contributor collects plugin-contributed files for an export
+type Contributor interface {
+	Contributions(ctx context.Context, accountID, exportID string) ([]Contribution, error)
+}
+
+// UUIDGenerator generates unique IDs
+type UUIDGenerator interface {
+	Generate() string
+}
+
+// Handler handles Account/export method calls and runs export jobs
+type Handler struct {
+	DB          DB
+	Storage     Storage
+	Contributor Contributor
+	UUIDGen     UUIDGenerator
+}
+
+// Manifest describes the contents of an export archive
+type Manifest struct {
+	AccountID  string          `json:"accountId"`
+	ExportID   string          `json:"exportId"`
+	ExportedAt string          `json:"exportedAt"`
+	Blobs      []ManifestBlob  `json:"blobs"`
+	Plugins    []ManifestEntry `json:"plugins"`
+	Errors     []string        `json:"errors,omitempty"`
+}
+
+// ManifestBlob is a blob stored under blobs/ in an export archive
+type ManifestBlob struct {
+	BlobEntry
+	Path string `json:"path"`
+}
+
+// ManifestEntry is a plugin-contributed file stored under plugins/ in an
+// export archive. BlobID is set when the file was copied from a blob.
+type ManifestEntry struct {
+	PluginID string `json:"pluginId"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	BlobID   string `json:"blobId,omitempty"`
+}
+
+// Start creates a pending export job. The job is picked up asynchronously by
+// the account-export worker.
+func (h *Handler) Start(ctx context.Context, accountID string) (*Job, error) {
+	job := Job{
+		AccountID: accountID,
+		ExportID:  h.UUIDGen.Generate(),
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if err := h.DB.CreateJob(ctx, job); err != nil {
+		return nil, &ExportError{Type: "serverFail", Message: fmt.Sprintf("failed to create export job: %v", err)}
+	}
+
+	return &job, nil
+}
+
+// Get returns the current state of an export job
+func (h *Handler) Get(ctx context.Context, accountID, exportID string) (*Job, error) {
+	job, err := h.DB.GetJob(ctx, accountID, exportID)
+	if err != nil {
+		return nil, &ExportError{Type: "serverFail", Message: fmt.Sprintf("failed to get export job: %v", err)}
+	}
+	if job == nil {
+		return nil, &ExportError{Type: "notFound", Message: "export not found"}
+	}
+	return job, nil
+}
+
+// Run builds the export archive for a pending job and records it as a blob.
+// Build failures are recorded on the job rather than returned, so the worker
+// does not retry an export that has already been attempted.
+func (h *Handler) Run(ctx context.Context, accountID, exportID string) error {
+	if err := h.DB.StartJob(ctx, accountID, exportID); err != nil {
+		if errors.Is(err, ErrJobNotPending) {
+			logger.InfoContext(ctx, "Export job already started, skipping",
+				slog.String("account_id", accountID),
+				slog.String("export_id", exportID),
+			)
+			return nil
+		}
+		return fmt.Errorf("failed to start export job: %w", err)
+	}
+
+	job, err := h.build(ctx, accountID, exportID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Export failed",
+			slog.String("account_id", accountID),
+			slog.String("export_id", exportID),
+			slog.String("error", err.Error()),
+		)
+		if failErr := h.DB.FailJob(ctx, accountID, exportID, err.Error()); failErr != nil {
+			return fmt.Errorf("failed to record export failure: %w", failErr)
+		}
+		return nil
+	}
+
+	logger.InfoContext(ctx, "Export completed",
+		slog.String("account_id", accountID),
+		slog.String("export_id", exportID),
+		slog.String("blob_id", job.BlobID),
+		slog.Int64("size", job.Size),
+	)
+	return nil
+}
+
+// build writes the archive and completes the job
+func (h *Handler) build(ctx context.Context, accountID, exportID string) (*Job, error) {
+	blobs, err := h.DB.ListBlobs(ctx, accountID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+
+	// Plugin contributions are best effort: a failing plugin is noted in the
+	// manifest rather than failing the whole export
+	var contributionErrors []string
+	contributions, err := h.Contributor.Contributions(ctx, accountID, exportID)
+	if err != nil {
+		contributionErrors = append(contributionErrors, err.Error())
+	}
+
+	blobID := h.UUIDGen.Generate()
+	s3Key := fmt.Sprintf("%s/%s", accountID, blobID)
+
+	size, err := h.Storage.WriteArchive(ctx, accountID, s3Key, ArchiveContentType, func(w io.Writer) error {
+		return h.writeArchive(ctx, w, accountID, exportID, blobs, contributions, contributionErrors)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	job := Job{
+		AccountID:   accountID,
+		ExportID:    exportID,
+		Status:      StatusCompleted,
+		BlobID:      blobID,
+		Size:        size,
+		CompletedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := h.DB.CompleteJob(ctx, job, s3Key); err != nil {
+		return nil, fmt.Errorf("failed to complete export job: %w", err)
+	}
+
+	return &job, nil
+}
+
+// writeArchive writes the zip archive: every blob under blobs/, plugin
+// contributions under plugins/<pluginId>/, and a manifest.json describing both
+func (h *Handler) writeArchive(ctx context.Context, w io.Writer, accountID, exportID string, blobs []BlobEntry, contributions []Contribution, errs []string) error {
+	zw := zip.NewWriter(w)
+
+	m := Manifest{
+		AccountID:  accountID,
+		ExportID:   exportID,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Blobs:      make([]ManifestBlob, 0, len(blobs)),
+		Plugins:    make([]ManifestEntry, 0, len(contributions)),
+		Errors:     errs,
+	}
+
+	blobsByID := make(map[string]BlobEntry, len(blobs))
+	for _, blob := range blobs {
+		blobsByID[blob.BlobID] = blob
+
+		path := "blobs/" + blob.BlobID
+		if err := h.copyBlob(ctx, zw, path, blob.S3Key); err != nil {
+			return err
+		}
+		m.Blobs = append(m.Blobs, ManifestBlob{BlobEntry: blob, Path: path})
+	}
+
+	for _, c := range contributions {
+		path := fmt.Sprintf("plugins/%s/%s", c.PluginID, c.Name)
+		entry := ManifestEntry{PluginID: c.PluginID, Name: c.Name, Path: path, BlobID: c.BlobID}
+
+		if c.BlobID != "" {
+			blob, ok := blobsByID[c.BlobID]
+			if !ok {
+				m.Errors = append(m.Errors, fmt.Sprintf("plugin %s: blob %s not found in account", c.PluginID, c.BlobID))
+				continue
+			}
+			if err := h.copyBlob(ctx, zw, path, blob.S3Key); err != nil {
+				return err
+			}
+		} else {
+			fw, err := zw.Create(path)
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(fw, c.Content); err != nil {
+				return err
+			}
+		}
+		m.Plugins = append(m.Plugins, entry)
+	}
+
+	fw, err := zw.Create(ManifestName)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fw)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(m); err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+// copyBlob streams a stored blob into the archive at path
+func (h *Handler) copyBlob(ctx context.Context, zw *zip.Writer, path, s3Key string) error {
+	body, err := h.Storage.OpenBlob(ctx, s3Key)
+	if err != nil {
+		return fmt.Errorf("failed to read blob %s: %w", s3Key, err)
+	}
+	defer body.Close()
+
+	fw, err := zw.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, body); err != nil {
+		return fmt.Errorf("failed to copy blob %s: %w", s3Key, err)
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package accountexport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+type mockDB struct {
+	createdJob   *Job
+	createErr    error
+	jobs         map[string]*Job
+	startErr     error
+	blobs        []BlobEntry
+	listErr      error
+	completedJob *Job
+	completedKey string
+	completeErr  error
+	failedReason string
+	failCalled   bool
+}
+
+func (m *mockDB) CreateJob(ctx context.Context, job Job) error {
+	m.createdJob = &job
+	return m.createErr
+}
+
+func (m *mockDB) GetJob(ctx context.Context, accountID, exportID string) (*Job, error) {
+	return m.jobs[exportID], nil
+}
+
+func (m *mockDB) StartJob(ctx context.Context, accountID, exportID string) error {
+	return m.startErr
+}
+
+func (m *mockDB) ListBlobs(ctx context.Context, accountID string) ([]BlobEntry, error) {
+	return m.blobs, m.listErr
+}
+
+func (m *mockDB) CompleteJob(ctx context.Context, job Job, s3Key string) error {
+	m.completedJob = &job
+	m.completedKey = s3Key
+	return m.completeErr
+}
+
+func (m *mockDB) FailJob(ctx context.Context, accountID, exportID, reason string) error {
+	m.failCalled = true
+	m.failedReason = reason
+	return nil
+}
+
+type mockStorage struct {
+	objects  map[string]string
+	archive  bytes.Buffer
+	writeErr error
+}
+
+func (m *mockStorage) OpenBlob(ctx context.Context, s3Key string) (io.ReadCloser, error) {
+	content, ok := m.objects[s3Key]
+	if !ok {
+		return nil, errors.New("no such key")
+	}
+	return io.NopCloser(strings.NewReader(content)), nil
+}
+
+func (m *mockStorage) WriteArchive(ctx context.Context, accountID, s3Key, contentType string, write func(w io.Writer) error) (int64, error) {
+	if m.writeErr != nil {
+		return 0, m.writeErr
+	}
+	if err := write(&m.archive); err != nil {
+		return 0, err
+	}
+	return int64(m.archive.Len()), nil
+}
+
+type mockContributor struct {
+	contributions []Contribution
+	err           error
+}
+
+func (m *mockContributor) Contributions(ctx context.Context, accountID, exportID string) ([]Contribution, error) {
+	return m.contributions, m.err
+}
+
+type mockUUIDGen struct {
+	ids []string
+}
+
+func (m *mockUUIDGen) Generate() string {
+	id := m.ids[0]
+	m.ids = m.ids[1:]
+	return id
+}
+
+// readArchive returns the files in a zip archive keyed by name
+func readArchive(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("failed to open archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestStart_CreatesPendingJob(t *testing.T) {
+	db := &mockDB{}
+	h := &Handler{DB: db, UUIDGen: &mockUUIDGen{ids: []string{"exp-1"}}}
+
+	job, err := h.Start(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.ExportID != "exp-1" || job.Status != StatusPending {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	if db.createdJob == nil || db.createdJob.AccountID != "user-1" {
+		t.Errorf("expected job to be stored, got %+v", db.createdJob)
+	}
+}
+
+func TestGet_NotFound_ReturnsNotFoundError(t *testing.T) {
+	h := &Handler{DB: &mockDB{}}
+
+	_, err := h.Get(context.Background(), "user-1", "missing")
+	var exportErr *ExportError
+	if !errors.As(err, &exportErr) || exportErr.Type != "notFound" {
+		t.Fatalf("expected notFound error, got %v", err)
+	}
+}
+
+func TestRun_WritesArchiveAndCompletesJob(t *testing.T) {
+	db := &mockDB{
+		blobs: []BlobEntry{
+			{BlobID: "b1", ContentType: "message/rfc822", Size: 5, S3Key: "user-1/b1"},
+			{BlobID: "b2", ContentType: "text/plain", Size: 3, S3Key: "user-1/b2"},
+		},
+	}
+	storage := &mockStorage{objects: map[string]string{"user-1/b1": "hello", "user-1/b2": "abc"}}
+	contributor := &mockContributor{
+		contributions: []Contribution{
+			{PluginID: "email", Name: "mailboxes.json", Content: `{"inbox":{}}`},
+			{PluginID: "email", Name: "raw/b1.eml", BlobID: "b1"},
+		},
+	}
+	h := &Handler{DB: db, Storage: storage, Contributor: contributor, UUIDGen: &mockUUIDGen{ids: []string{"archive-1"}}}
+
+	if err := h.Run(context.Background(), "user-1", "exp-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if db.failCalled {
+		t.Fatalf("expected job not to fail, got %s", db.failedReason)
+	}
+	if db.completedJob == nil || db.completedJob.BlobID != "archive-1" || db.completedKey != "user-1/archive-1" {
+		t.Fatalf("unexpected completion: %+v %s", db.completedJob, db.completedKey)
+	}
+	if db.completedJob.Size != int64(storage.archive.Len()) {
+		t.Errorf("expected size %d, got %d", storage.archive.Len(), db.completedJob.Size)
+	}
+
+	files := readArchive(t, storage.archive.Bytes())
+	if files["blobs/b1"] != "hello" || files["blobs/b2"] != "abc" {
+		t.Errorf("unexpected blob contents: %v", files)
+	}
+	if files["plugins/email/mailboxes.json"] != `{"inbox":{}}` {
+		t.Errorf("unexpected inline contribution: %q", files["plugins/email/mailboxes.json"])
+	}
+	if files["plugins/email/raw/b1.eml"] != "hello" {
+		t.Errorf("unexpected blob contribution: %q", files["plugins/email/raw/b1.eml"])
+	}
+
+	var m Manifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if m.AccountID != "user-1" || m.ExportID != "exp-1" || len(m.Blobs) != 2 || len(m.Plugins) != 2 {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+	if len(m.Errors) != 0 {
+		t.Errorf("expected no errors, got %v", m.Errors)
+	}
+}
+
+func TestRun_ContributionErrors_RecordedInManifest(t *testing.T) {
+	db := &mockDB{}
+	storage := &mockStorage{}
+	contributor := &mockContributor{
+		contributions: []Contribution{{PluginID: "email", Name: "x.eml", BlobID: "not-in-account"}},
+		err:           errors.New("plugin calendar: timeout"),
+	}
+	h := &Handler{DB: db, Storage: storage, Contributor: contributor, UUIDGen: &mockUUIDGen{ids: []string{"archive-1"}}}
+
+	if err := h.Run(context.Background(), "user-1", "exp-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.completedJob == nil {
+		t.Fatal("expected export to complete despite plugin errors")
+	}
+
+	files := readArchive(t, storage.archive.Bytes())
+	if _, ok := files["plugins/email/x.eml"]; ok {
+		t.Error("expected contribution with unknown blob to be skipped")
+	}
+	var m Manifest
+	if err := json.Unmarshal([]byte(files["manifest.json"]), &m); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+	if len(m.Errors) != 2 {
+		t.Errorf("expected 2 manifest errors, got %v", m.Errors)
+	}
+}
+
+func TestRun_AlreadyStarted_Skips(t *testing.T) {
+	db := &mockDB{startErr: ErrJobNotPending}
+	h := &Handler{DB: db, Storage: &mockStorage{}, Contributor: &mockContributor{}, UUIDGen: &mockUUIDGen{}}
+
+	if err := h.Run(context.Background(), "user-1", "exp-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.completedJob != nil || db.failCalled {
+		t.Error("expected job to be left alone")
+	}
+}
+
+func TestRun_StorageFailure_MarksJobFailed(t *testing.T) {
+	db := &mockDB{}
+	storage := &mockStorage{writeErr: errors.New("s3 down")}
+	h := &Handler{DB: db, Storage: storage, Contributor: &mockContributor{}, UUIDGen: &mockUUIDGen{ids: []string{"archive-1"}}}
+
+	if err := h.Run(context.Background(), "user-1", "exp-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !db.failCalled || !strings.Contains(db.failedReason, "s3 down") {
+		t.Errorf("expected job to be marked failed, got %q", db.failedReason)
+	}
+	if db.completedJob != nil {
+		t.Error("expected job not to complete")
+	}
+}
+
+func TestRun_StartError_Propagates(t *testing.T) {
+	db := &mockDB{startErr: errors.New("dynamo down")}
+	h := &Handler{DB: db}
+
+	if err := h.Run(context.Background(), "user-1", "exp-1"); err == nil {
+		t.Fatal("expected error so the stream record is retried")
+	}
+}
@@ -0,0 +1,164 @@
+package accountexport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// DefaultPartSize is the multipart part size used when writing archives.
+// S3 requires every part except the last to be at least 5 MiB.
+const DefaultPartSize = 8 * 1024 * 1024
+
+// S3Client defines the interface for S3 operations needed by accountexport
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// S3Storage implements Storage using AWS S3
+type S3Storage struct {
+	client     S3Client
+	bucketName string
+	partSize   int
+}
+
+// NewS3Storage creates a new S3Storage
+func NewS3Storage(client S3Client, bucketName string) *S3Storage {
+	return &S3Storage{
+		client:     client,
+		bucketName: bucketName,
+		partSize:   DefaultPartSize,
+	}
+}
+
+// OpenBlob opens a stored blob for reading
+func (s *S3Storage) OpenBlob(ctx context.Context, s3Key string) (io.ReadCloser, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(s3Key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// WriteArchive streams an archive to S3 as a multipart upload, so archives
+// larger than Lambda memory can be written. The object is tagged confirmed
+// up front so the pending-blob lifecycle rule never expires it.
+func (s *S3Storage) WriteArchive(ctx context.Context, accountID, s3Key, contentType string, write func(w io.Writer) error) (int64, error) {
+	created, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucketName),
+		Key:         aws.String(s3Key),
+		ContentType: aws.String(contentType),
+		Tagging:     aws.String(fmt.Sprintf("Account=%s&Status=confirmed", accountID)),
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	w := &multipartWriter{
+		ctx:      ctx,
+		client:   s.client,
+		bucket:   s.bucketName,
+		key:      s3Key,
+		uploadID: aws.ToString(created.UploadId),
+		partSize: s.partSize,
+	}
+
+	if err := write(w); err != nil {
+		w.abort()
+		return 0, err
+	}
+	if err := w.flush(); err != nil {
+		w.abort()
+		return 0, err
+	}
+
+	_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucketName),
+		Key:      aws.String(s3Key),
+		UploadId: aws.String(w.uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{
+			Parts: w.parts,
+		},
+	})
+	if err != nil {
+		w.abort()
+		return 0, fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return w.size, nil
+}
+
+// multipartWriter buffers writes into parts and uploads each full part
+type multipartWriter struct {
+	ctx      context.Context
+	client   S3Client
+	bucket   string
+	key      string
+	uploadID string
+	partSize int
+	buf      bytes.Buffer
+	parts    []s3types.CompletedPart
+	size     int64
+}
+
+// Write implements io.Writer
+func (w *multipartWriter) Write(p []byte) (int, error) {
+	n, _ := w.buf.Write(p)
+	w.size += int64(n)
+	for w.buf.Len() >= w.partSize {
+		if err := w.uploadPart(w.buf.Next(w.partSize)); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// flush uploads any buffered data as the final part. An empty archive still
+// needs one part for S3 to complete the upload.
+func (w *multipartWriter) flush() error {
+	if w.buf.Len() == 0 && len(w.parts) > 0 {
+		return nil
+	}
+	return w.uploadPart(w.buf.Next(w.buf.Len()))
+}
+
+func (w *multipartWriter) uploadPart(data []byte) error {
+	partNumber := int32(len(w.parts) + 1)
+	output, err := w.client.UploadPart(w.ctx, &s3.UploadPartInput{
+		Bucket:     aws.String(w.bucket),
+		Key:        aws.String(w.key),
+		UploadId:   aws.String(w.uploadID),
+		PartNumber: aws.Int32(partNumber),
+		Body:       bytes.NewReader(data),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	w.parts = append(w.parts, s3types.CompletedPart{
+		ETag:       output.ETag,
+		PartNumber: aws.Int32(partNumber),
+	})
+	return nil
+}
+
+// abort discards the multipart upload; errors are ignored as S3 also expires
+// incomplete uploads via the bucket lifecycle
+func (w *multipartWriter) abort() {
+	_, _ = w.client.AbortMultipartUpload(w.ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(w.bucket),
+		Key:      aws.String(w.key),
+		UploadId: aws.String(w.uploadID),
+	})
+}
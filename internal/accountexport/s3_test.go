@@ -0,0 +1,112 @@
+package accountexport
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type mockS3Client struct {
+	uploadedParts [][]byte
+	createInput   *s3.CreateMultipartUploadInput
+	completed     *s3.CompleteMultipartUploadInput
+	aborted       bool
+	uploadPartErr error
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader([]byte("data")))}, nil
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.createInput = params
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (m *mockS3Client) UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	if m.uploadPartErr != nil {
+		return nil, m.uploadPartErr
+	}
+	data, _ := io.ReadAll(params.Body)
+	m.uploadedParts = append(m.uploadedParts, data)
+	return &s3.UploadPartOutput{ETag: aws.String(fmt.Sprintf("etag-%d", *params.PartNumber))}, nil
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.completed = params
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestWriteArchive_SplitsIntoParts(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "bucket")
+	storage.partSize = 4
+
+	size, err := storage.WriteArchive(context.Background(), "user-1", "user-1/archive", ArchiveContentType, func(w io.Writer) error {
+		_, err := w.Write([]byte("abcdefghij"))
+		return err
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size != 10 {
+		t.Errorf("expected size 10, got %d", size)
+	}
+	if len(client.uploadedParts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(client.uploadedParts))
+	}
+	if string(client.uploadedParts[0]) != "abcd" || string(client.uploadedParts[2]) != "ij" {
+		t.Errorf("unexpected parts: %q", client.uploadedParts)
+	}
+	if len(client.completed.MultipartUpload.Parts) != 3 {
+		t.Errorf("expected 3 completed parts, got %d", len(client.completed.MultipartUpload.Parts))
+	}
+	if *client.createInput.Tagging != "Account=user-1&Status=confirmed" {
+		t.Errorf("unexpected tagging: %s", *client.createInput.Tagging)
+	}
+}
+
+func TestWriteArchive_EmptyArchive_UploadsOnePart(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "bucket")
+
+	if _, err := storage.WriteArchive(context.Background(), "user-1", "user-1/archive", ArchiveContentType, func(w io.Writer) error {
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(client.uploadedParts) != 1 {
+		t.Errorf("expected 1 part, got %d", len(client.uploadedParts))
+	}
+}
+
+func TestWriteArchive_WriteError_AbortsUpload(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "bucket")
+
+	_, err := storage.WriteArchive(context.Background(), "user-1", "user-1/archive", ArchiveContentType, func(w io.Writer) error {
+		return errors.New("blob missing")
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if !client.aborted {
+		t.Error("expected multipart upload to be aborted")
+	}
+	if client.completed != nil {
+		t.Error("expected upload not to be completed")
+	}
+}
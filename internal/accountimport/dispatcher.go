@@ -0,0 +1,73 @@
+package accountimport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+// LambdaDispatcher hands plugin files to plugins by synchronously invoking
+// their "lambda" target for the account.import event
+type LambdaDispatcher struct {
+	client   plugin.LambdaClient
+	registry accountexport.EventTargetGetter
+}
+
+// NewLambdaDispatcher creates a new LambdaDispatcher
+func NewLambdaDispatcher(client plugin.LambdaClient, registry accountexport.EventTargetGetter) *LambdaDispatcher {
+	return &LambdaDispatcher{
+		client:   client,
+		registry: registry,
+	}
+}
+
+// ImportPlugin invokes the plugin's account.import target with its files.
+// Plugins may be invoked more than once for the same import if it is resumed,
+// so they must treat repeated calls as idempotent.
+func (d *LambdaDispatcher) ImportPlugin(ctx context.Context, accountID, importID, pluginID string, files []File) error {
+	var targetArn string
+	for _, target := range d.registry.GetEventTargets(publisher.EventAccountImport) {
+		if target.PluginID == pluginID && target.TargetType == accountexport.TargetTypeLambda {
+			targetArn = target.TargetArn
+			break
+		}
+	}
+	if targetArn == "" {
+		return errors.New("plugin has no account.import lambda target")
+	}
+
+	payload, err := json.Marshal(publisher.EventPayload{
+		EventType:     publisher.EventAccountImport,
+		OccurredAt:    time.Now().UTC().Format(time.RFC3339),
+		CorrelationID: correlation.FromContext(ctx),
+		AccountID:     accountID,
+		Data: map[string]any{
+			"importId": importID,
+			"files":    files,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal import event: %w", err)
+	}
+
+	output, err := d.client.Invoke(ctx, &lambda.InvokeInput{
+		FunctionName: aws.String(targetArn),
+		Payload:      payload,
+	})
+	if err != nil {
+		return fmt.Errorf("lambda invocation failed: %w", err)
+	}
+	if output.FunctionError != nil {
+		return fmt.Errorf("function error: %s", aws.ToString(output.FunctionError))
+	}
+	return nil
+}
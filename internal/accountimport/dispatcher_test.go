@@ -0,0 +1,92 @@
+package accountimport
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+type mockLambdaClient struct {
+	invoked       []string
+	payload       []byte
+	functionError string
+}
+
+func (m *mockLambdaClient) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	m.invoked = append(m.invoked, aws.ToString(params.FunctionName))
+	m.payload = params.Payload
+	output := &lambda.InvokeOutput{}
+	if m.functionError != "" {
+		output.FunctionError = aws.String(m.functionError)
+	}
+	return output, nil
+}
+
+type mockEventTargets struct {
+	targets []plugin.AggregatedEventTarget
+}
+
+func (m *mockEventTargets) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
+	return m.targets
+}
+
+func TestImportPlugin_InvokesPluginTarget(t *testing.T) {
+	client := &mockLambdaClient{}
+	registry := &mockEventTargets{targets: []plugin.AggregatedEventTarget{
+		{PluginID: "calendar", TargetType: "lambda", TargetArn: "arn:calendar"},
+		{PluginID: "email", TargetType: "sqs", TargetArn: "arn:queue"},
+		{PluginID: "email", TargetType: "lambda", TargetArn: "arn:email"},
+	}}
+	d := NewLambdaDispatcher(client, registry)
+
+	err := d.ImportPlugin(context.Background(), "user-1", "archive-1", "email", []File{{Name: "a.json", Content: "{}"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(client.invoked) != 1 || client.invoked[0] != "arn:email" {
+		t.Fatalf("expected only the email lambda target, got %v", client.invoked)
+	}
+
+	var payload struct {
+		EventType string `json:"eventType"`
+		AccountID string `json:"accountId"`
+		Data      struct {
+			ImportID string `json:"importId"`
+			Files    []File `json:"files"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(client.payload, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	if payload.EventType != "account.import" || payload.AccountID != "user-1" || payload.Data.ImportID != "archive-1" || len(payload.Data.Files) != 1 {
+		t.Errorf("unexpected payload: %+v", payload)
+	}
+}
+
+func TestImportPlugin_NoTarget_ReturnsError(t *testing.T) {
+	client := &mockLambdaClient{}
+	d := NewLambdaDispatcher(client, &mockEventTargets{})
+
+	if err := d.ImportPlugin(context.Background(), "user-1", "archive-1", "email", nil); err == nil {
+		t.Fatal("expected error for plugin without import target")
+	}
+	if len(client.invoked) != 0 {
+		t.Errorf("expected no invocation, got %v", client.invoked)
+	}
+}
+
+func TestImportPlugin_FunctionError_ReturnsError(t *testing.T) {
+	client := &mockLambdaClient{functionError: "Unhandled"}
+	registry := &mockEventTargets{targets: []plugin.AggregatedEventTarget{
+		{PluginID: "email", TargetType: "lambda", TargetArn: "arn:email"},
+	}}
+
+	if err := NewLambdaDispatcher(client, registry).ImportPlugin(context.Background(), "user-1", "archive-1", "email", nil); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -0,0 +1,423 @@
+package accountimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// SKPrefixImport is the sort key prefix for import job records
+const SKPrefixImport = "IMPORT#"
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by accountimport
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoDBStore implements DB using AWS DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	envelope  *blobcrypt.Envelope
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// WithEncryption seals the envelope's attributes of restored blob records
+func (d *DynamoDBStore) WithEncryption(envelope *blobcrypt.Envelope) *DynamoDBStore {
+	d.envelope = envelope
+	return d
+}
+
+// jobKey builds the primary key of an import job record
+func jobKey(accountID, importID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKPrefixImport + importID},
+	}
+}
+
+// blobKey builds the primary key of a blob record
+func blobKey(accountID, blobID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: "BLOB#" + blobID},
+	}
+}
+
+// jobRecord is the DynamoDB representation of an import job
+type jobRecord struct {
+	AccountID       string   `dynamodbav:"accountId"`
+	ImportID        string   `dynamodbav:"importId"`
+	Status          string   `dynamodbav:"status"`
+	BlobsTotal      int      `dynamodbav:"blobsTotal"`
+	BlobsImported   int      `dynamodbav:"blobsImported"`
+	PluginsTotal    int      `dynamodbav:"pluginsTotal"`
+	PluginsImported int      `dynamodbav:"pluginsImported"`
+	Errors          []string `dynamodbav:"errors,omitempty"`
+	Error           string   `dynamodbav:"error,omitempty"`
+	CreatedAt       string   `dynamodbav:"createdAt"`
+	UpdatedAt       string   `dynamodbav:"updatedAt,omitempty"`
+	CompletedAt     string   `dynamodbav:"completedAt,omitempty"`
+	LeaseExpiresAt  string   `dynamodbav:"leaseExpiresAt,omitempty"`
+}
+
+// CreateJob writes a new import job record. The record on the table stream
+// starts the account-import worker. Returns ErrJobExists if it already exists.
+func (d *DynamoDBStore) CreateJob(ctx context.Context, job Job) error {
+	av, err := attributevalue.MarshalMap(jobRecord{
+		AccountID: job.AccountID,
+		ImportID:  job.ImportID,
+		Status:    job.Status,
+		CreatedAt: job.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal import job: %w", err)
+	}
+	for k, v := range jobKey(job.AccountID, job.ImportID) {
+		av[k] = v
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:           aws.String(d.tableName),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrJobExists
+		}
+		return err
+	}
+	return nil
+}
+
+// GetJob retrieves an import job. Returns nil if it does not exist.
+func (d *DynamoDBStore) GetJob(ctx context.Context, accountID, importID string) (*Job, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.tableName),
+		Key:            jobKey(accountID, importID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var record jobRecord
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal import job: %w", err)
+	}
+
+	return &Job{
+		AccountID:       record.AccountID,
+		ImportID:        record.ImportID,
+		Status:          record.Status,
+		BlobsTotal:      record.BlobsTotal,
+		BlobsImported:   record.BlobsImported,
+		PluginsTotal:    record.PluginsTotal,
+		PluginsImported: record.PluginsImported,
+		Errors:          record.Errors,
+		Error:           record.Error,
+		CreatedAt:       record.CreatedAt,
+		UpdatedAt:       record.UpdatedAt,
+		CompletedAt:     record.CompletedAt,
+		LeaseExpiresAt:  record.LeaseExpiresAt,
+	}, nil
+}
+
+// SetStatus moves a job between statuses with a conditional update.
+// Moving back to pending clears any previous failure and lease.
+func (d *DynamoDBStore) SetStatus(ctx context.Context, accountID, importID, from, to string) error {
+	update := "SET #status = :to, updatedAt = :now"
+	names := map[string]string{"#status": "status"}
+	if to == StatusPending {
+		update += " REMOVE #error, completedAt, leaseExpiresAt"
+		names["#error"] = "error"
+	}
+
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(d.tableName),
+		Key:                      jobKey(accountID, importID),
+		UpdateExpression:         aws.String(update),
+		ConditionExpression:      aws.String("#status = :from"),
+		ExpressionAttributeNames: names,
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":from": &types.AttributeValueMemberS{Value: from},
+			":to":   &types.AttributeValueMemberS{Value: to},
+			":now":  &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrStatusConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// Acquire moves a pending job, or a running job whose lease has lapsed, to
+// running with a new lease. Running jobs without a lease are treated as
+// lapsed.
+func (d *DynamoDBStore) Acquire(ctx context.Context, accountID, importID string, leaseExpiresAt time.Time) error {
+	now := time.Now().UTC()
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              jobKey(accountID, importID),
+		UpdateExpression: aws.String("SET #status = :running, leaseExpiresAt = :lease, updatedAt = :now"),
+		ConditionExpression: aws.String("#status = :pending OR (#status = :running AND " +
+			"(attribute_not_exists(leaseExpiresAt) OR leaseExpiresAt < :now))"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: StatusPending},
+			":running": &types.AttributeValueMemberS{Value: StatusRunning},
+			":lease":   &types.AttributeValueMemberS{Value: leaseExpiresAt.UTC().Format(time.RFC3339)},
+			":now":     &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrStatusConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// RequeueLapsed moves a running job whose lease has lapsed back to pending,
+// so the stream starts a new worker
+func (d *DynamoDBStore) RequeueLapsed(ctx context.Context, accountID, importID string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              jobKey(accountID, importID),
+		UpdateExpression: aws.String("SET #status = :pending, updatedAt = :now REMOVE leaseExpiresAt"),
+		ConditionExpression: aws.String("#status = :running AND " +
+			"(attribute_not_exists(leaseExpiresAt) OR leaseExpiresAt < :now)"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: StatusPending},
+			":running": &types.AttributeValueMemberS{Value: StatusRunning},
+			":now":     &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrStatusConflict
+		}
+		return err
+	}
+	return nil
+}
+
+// GetArchive returns a confirmed, non-deleted blob. Returns nil if the blob
+// does not exist or is not usable as an archive.
+func (d *DynamoDBStore) GetArchive(ctx context.Context, accountID, blobID string) (*Archive, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       blobKey(accountID, blobID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var blob struct {
+		Size      int64  `dynamodbav:"size"`
+		S3Key     string `dynamodbav:"s3Key"`
+		Status    string `dynamodbav:"status"`
+		DeletedAt string `dynamodbav:"deletedAt"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &blob); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal blob record: %w", err)
+	}
+
+	// Records from the traditional upload path have no status
+	if blob.DeletedAt != "" || blob.Status == "pending" {
+		return nil, nil
+	}
+
+	return &Archive{S3Key: blob.S3Key, Size: blob.Size}, nil
+}
+
+// BlobExists reports whether the account has a record for the blob
+func (d *DynamoDBStore) BlobExists(ctx context.Context, accountID, blobID string) (bool, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(d.tableName),
+		Key:                  blobKey(accountID, blobID),
+		ProjectionExpression: aws.String("pk"),
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// RestoreBlob records a confirmed blob and charges its size to the account
+// quota in a single transaction. As with export archives the quota is
+// charged unconditionally; blob cleanup restores it on deletion.
+func (d *DynamoDBStore) RestoreBlob(ctx context.Context, accountID, importID string, blob accountexport.BlobEntry) error {
+	createdAt := blob.CreatedAt
+	if createdAt == "" {
+		createdAt = time.Now().UTC().Format(time.RFC3339)
+	}
+
+	blobItem, err := attributevalue.MarshalMap(map[string]any{
+		"pk":          dbclient.AccountPK(accountID),
+		"sk":          "BLOB#" + blob.BlobID,
+		"blobId":      blob.BlobID,
+		"accountId":   accountID,
+		"size":        blob.Size,
+		"contentType": blob.ContentType,
+		"s3Key":       blob.S3Key,
+		"status":      "confirmed",
+		"importId":    importID,
+		"createdAt":   createdAt,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal blob record: %w", err)
+	}
+	if d.envelope != nil {
+		if err := d.envelope.Seal(ctx, blobItem); err != nil {
+			return fmt.Errorf("failed to seal blob record: %w", err)
+		}
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Put: &types.Put{
+					TableName:           aws.String(d.tableName),
+					Item:                blobItem,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName: aws.String(d.tableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+						"sk": &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+					},
+					UpdateExpression: aws.String("ADD quotaRemaining :negSize"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":negSize": &types.AttributeValueMemberN{Value: strconv.FormatInt(-blob.Size, 10)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		if isBlobConflict(err) {
+			return ErrBlobExists
+		}
+		return err
+	}
+	return nil
+}
+
+// isBlobConflict reports whether a RestoreBlob transaction was cancelled by
+// the blob record's condition
+func isBlobConflict(err error) bool {
+	var canceled *types.TransactionCanceledException
+	if !errors.As(err, &canceled) {
+		return false
+	}
+	return len(canceled.CancellationReasons) > 0 &&
+		aws.ToString(canceled.CancellationReasons[0].Code) == "ConditionalCheckFailed"
+}
+
+// UpdateProgress saves a running job's counters and plugin errors
+func (d *DynamoDBStore) UpdateProgress(ctx context.Context, job Job) error {
+	values := map[string]types.AttributeValue{
+		":blobsTotal":      &types.AttributeValueMemberN{Value: strconv.Itoa(job.BlobsTotal)},
+		":blobsImported":   &types.AttributeValueMemberN{Value: strconv.Itoa(job.BlobsImported)},
+		":pluginsTotal":    &types.AttributeValueMemberN{Value: strconv.Itoa(job.PluginsTotal)},
+		":pluginsImported": &types.AttributeValueMemberN{Value: strconv.Itoa(job.PluginsImported)},
+		":now":             &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+	}
+	update := "SET blobsTotal = :blobsTotal, blobsImported = :blobsImported, pluginsTotal = :pluginsTotal, pluginsImported = :pluginsImported, updatedAt = :now"
+
+	if len(job.Errors) > 0 {
+		errs, err := attributevalue.Marshal(job.Errors)
+		if err != nil {
+			return fmt.Errorf("failed to marshal import errors: %w", err)
+		}
+		values[":errors"] = errs
+		update += ", #errors = :errors"
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(d.tableName),
+		Key:                       jobKey(job.AccountID, job.ImportID),
+		UpdateExpression:          aws.String(update),
+		ExpressionAttributeValues: values,
+	}
+	if len(job.Errors) > 0 {
+		input.ExpressionAttributeNames = map[string]string{"#errors": "errors"}
+	}
+
+	_, err := d.client.UpdateItem(ctx, input)
+	return err
+}
+
+// CompleteJob marks a job completed
+func (d *DynamoDBStore) CompleteJob(ctx context.Context, job Job) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              jobKey(job.AccountID, job.ImportID),
+		UpdateExpression: aws.String("SET #status = :completed, completedAt = :completedAt, updatedAt = :completedAt REMOVE leaseExpiresAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":completed":   &types.AttributeValueMemberS{Value: StatusCompleted},
+			":completedAt": &types.AttributeValueMemberS{Value: job.CompletedAt},
+		},
+	})
+	return err
+}
+
+// FailJob marks a job as failed with a reason. Progress is kept so the
+// import can be resumed.
+func (d *DynamoDBStore) FailJob(ctx context.Context, accountID, importID, reason string) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              jobKey(accountID, importID),
+		UpdateExpression: aws.String("SET #status = :failed, #error = :reason, completedAt = :now, updatedAt = :now REMOVE leaseExpiresAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+			"#error":  "error",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":failed": &types.AttributeValueMemberS{Value: StatusFailed},
+			":reason": &types.AttributeValueMemberS{Value: reason},
+			":now":    &types.AttributeValueMemberS{Value: now},
+		},
+	})
+	return err
+}
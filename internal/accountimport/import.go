@@ -0,0 +1,494 @@
+package accountimport
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+)
+
+var logger = loglevel.New()
+
+// Import job statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+)
+
+// YieldMargin is how much Lambda time Run leaves unused. When less remains,
+// the job is put back to pending so a fresh invocation resumes it.
+const YieldMargin = time.Minute
+
+// A running job holds a lease until its invocation's deadline plus
+// LeaseGrace, or for MaxLease when the context has no deadline. A job whose
+// worker timed out or crashed is left running; once its lease lapses another
+// invocation may take it over.
+const (
+	LeaseGrace = 5 * time.Second
+	MaxLease   = 15 * time.Minute
+)
+
+var (
+	// ErrStatusConflict is returned when a job is not in the status a
+	// transition expects, so duplicate stream deliveries are ignored
+	ErrStatusConflict = errors.New("import job is not in the expected status")
+	// ErrJobExists is returned by DB.CreateJob when the job already exists
+	ErrJobExists = errors.New("import job already exists")
+	// ErrBlobExists is returned by DB.RestoreBlob when the blob has already
+	// been restored into the account
+	ErrBlobExists = errors.New("blob already exists")
+)
+
+// Job is an account import job. The import ID is the archive's blob ID, so
+// starting an import of the same archive again finds the existing job.
+type Job struct {
+	AccountID       string   `json:"accountId"`
+	ImportID        string   `json:"importId"`
+	Status          string   `json:"status"`
+	BlobsTotal      int      `json:"blobsTotal"`
+	BlobsImported   int      `json:"blobsImported"`
+	PluginsTotal    int      `json:"pluginsTotal"`
+	PluginsImported int      `json:"pluginsImported"`
+	Errors          []string `json:"errors,omitempty"`
+	Error           string   `json:"error,omitempty"`
+	CreatedAt       string   `json:"createdAt"`
+	UpdatedAt       string   `json:"updatedAt,omitempty"`
+	CompletedAt     string   `json:"completedAt,omitempty"`
+	// LeaseExpiresAt is when a running job's worker is presumed gone
+	LeaseExpiresAt string `json:"leaseExpiresAt,omitempty"`
+}
+
+// leaseLapsed reports whether a running job's lease has expired. A running
+// job without a lease predates leases and is treated as lapsed.
+func (j *Job) leaseLapsed(now time.Time) bool {
+	if j.Status != StatusRunning {
+		return false
+	}
+	expiresAt, err := time.Parse(time.RFC3339, j.LeaseExpiresAt)
+	return err != nil || now.After(expiresAt)
+}
+
+// Archive is the stored export archive an import reads from
+type Archive struct {
+	S3Key string
+	Size  int64
+}
+
+// File is a plugin file handed back to its plugin on import. Exactly one of
+// BlobID (a blob restored into the account) or Content is set.
+type File struct {
+	Name    string `json:"name"`
+	BlobID  string `json:"blobId,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// ImportError represents an error starting or reading an import
+type ImportError struct {
+	Type    string
+	Message string
+}
+
+func (e *ImportError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// DB handles DynamoDB operations for import jobs
+type DB interface {
+	CreateJob(ctx context.Context, job Job) error
+	GetJob(ctx context.Context, accountID, importID string) (*Job, error)
+	// SetStatus moves a job from one status to another.
+	// Returns ErrStatusConflict if the job is not in status from.
+	SetStatus(ctx context.Context, accountID, importID, from, to string) error
+	// Acquire moves a pending job, or a running job whose lease has lapsed,
+	// to running with a lease until leaseExpiresAt.
+	// Returns ErrStatusConflict for any other job.
+	Acquire(ctx context.Context, accountID, importID string, leaseExpiresAt time.Time) error
+	// RequeueLapsed moves a running job whose lease has lapsed back to
+	// pending. Returns ErrStatusConflict for any other job.
+	RequeueLapsed(ctx context.Context, accountID, importID string) error
+	// GetArchive returns a confirmed blob of the account, or nil if none exists
+	GetArchive(ctx context.Context, accountID, blobID string) (*Archive, error)
+	BlobExists(ctx context.Context, accountID, blobID string) (bool, error)
+	// RestoreBlob records a confirmed blob and charges it to the account quota.
+	// Returns ErrBlobExists if the blob record is already present.
+	RestoreBlob(ctx context.Context, accountID, importID string, blob accountexport.BlobEntry) error
+	UpdateProgress(ctx context.Context, job Job) error
+	CompleteJob(ctx context.Context, job Job) error
+	FailJob(ctx context.Context, accountID, importID, reason string) error
+}
+
+// Storage handles S3 operations for imports
+type Storage interface {
+	OpenArchive(ctx context.Context, archive Archive) (io.ReaderAt, error)
+	PutBlob(ctx context.Context, accountID, s3Key, contentType string, size int64, body io.Reader) error
+}
+
+// Dispatcher hands plugin files from an archive to the plugin that wrote them
+type Dispatcher interface {
+	ImportPlugin(ctx context.Context, accountID, importID, pluginID string, files []File) error
+}
+
+// Handler starts import jobs and runs them
+type Handler struct {
+	DB         DB
+	Storage    Storage
+	Dispatcher Dispatcher
+}
+
+// Start creates a pending import job for an archive blob in the account.
+// Starting an import that already exists returns it unchanged, except that a
+// failed import, or a running one whose worker's lease has lapsed, is put
+// back to pending so it resumes where it stopped.
+func (h *Handler) Start(ctx context.Context, accountID, archiveBlobID string) (*Job, error) {
+	job, err := h.DB.GetJob(ctx, accountID, archiveBlobID)
+	if err != nil {
+		return nil, &ImportError{Type: "serverFail", Message: fmt.Sprintf("failed to get import job: %v", err)}
+	}
+	if job != nil {
+		return h.resume(ctx, job)
+	}
+
+	archive, err := h.DB.GetArchive(ctx, accountID, archiveBlobID)
+	if err != nil {
+		return nil, &ImportError{Type: "serverFail", Message: fmt.Sprintf("failed to get archive: %v", err)}
+	}
+	if archive == nil {
+		return nil, &ImportError{Type: "notFound", Message: "archive blob not found"}
+	}
+
+	job = &Job{
+		AccountID: accountID,
+		ImportID:  archiveBlobID,
+		Status:    StatusPending,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := h.DB.CreateJob(ctx, *job); err != nil {
+		if errors.Is(err, ErrJobExists) {
+			return h.Get(ctx, accountID, archiveBlobID)
+		}
+		return nil, &ImportError{Type: "serverFail", Message: fmt.Sprintf("failed to create import job: %v", err)}
+	}
+
+	return job, nil
+}
+
+// resume puts a failed or abandoned job back to pending; other jobs are
+// returned as they are
+func (h *Handler) resume(ctx context.Context, job *Job) (*Job, error) {
+	var err error
+	switch {
+	case job.Status == StatusFailed:
+		err = h.DB.SetStatus(ctx, job.AccountID, job.ImportID, StatusFailed, StatusPending)
+	case job.leaseLapsed(time.Now()):
+		err = h.DB.RequeueLapsed(ctx, job.AccountID, job.ImportID)
+	default:
+		return job, nil
+	}
+	if err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			return h.Get(ctx, job.AccountID, job.ImportID)
+		}
+		return nil, &ImportError{Type: "serverFail", Message: fmt.Sprintf("failed to resume import job: %v", err)}
+	}
+
+	logger.InfoContext(ctx, "Resuming import",
+		slog.String("account_id", job.AccountID),
+		slog.String("import_id", job.ImportID),
+		slog.String("previous_status", job.Status),
+		slog.Int("blobs_imported", job.BlobsImported),
+		slog.Int("plugins_imported", job.PluginsImported),
+	)
+
+	job.Status = StatusPending
+	job.Error = ""
+	job.LeaseExpiresAt = ""
+	return job, nil
+}
+
+// Get returns the current state of an import job
+func (h *Handler) Get(ctx context.Context, accountID, importID string) (*Job, error) {
+	job, err := h.DB.GetJob(ctx, accountID, importID)
+	if err != nil {
+		return nil, &ImportError{Type: "serverFail", Message: fmt.Sprintf("failed to get import job: %v", err)}
+	}
+	if job == nil {
+		return nil, &ImportError{Type: "notFound", Message: "import not found"}
+	}
+	return job, nil
+}
+
+// Run restores a pending import job, or takes over a running one whose lease
+// has lapsed, continuing from its recorded progress. Import failures are
+// recorded on the job rather than returned; starting the import again
+// resumes it.
+func (h *Handler) Run(ctx context.Context, accountID, importID string) error {
+	if err := h.DB.Acquire(ctx, accountID, importID, leaseExpiry(ctx)); err != nil {
+		if errors.Is(err, ErrStatusConflict) {
+			logger.InfoContext(ctx, "Import job not pending or still leased, skipping",
+				slog.String("account_id", accountID),
+				slog.String("import_id", importID),
+			)
+			return nil
+		}
+		return fmt.Errorf("failed to start import job: %w", err)
+	}
+
+	job, err := h.DB.GetJob(ctx, accountID, importID)
+	if err != nil {
+		return fmt.Errorf("failed to get import job: %w", err)
+	}
+	if job == nil {
+		return fmt.Errorf("import job %s disappeared", importID)
+	}
+
+	done, err := h.restore(ctx, job)
+	if err != nil {
+		logger.ErrorContext(ctx, "Import failed",
+			slog.String("account_id", accountID),
+			slog.String("import_id", importID),
+			slog.Int("blobs_imported", job.BlobsImported),
+			slog.String("error", err.Error()),
+		)
+		if failErr := h.DB.FailJob(ctx, accountID, importID, err.Error()); failErr != nil {
+			return fmt.Errorf("failed to record import failure: %w", failErr)
+		}
+		return nil
+	}
+
+	if !done {
+		// Out of time: back to pending, and the stream starts a new invocation
+		logger.InfoContext(ctx, "Import yielding before timeout",
+			slog.String("account_id", accountID),
+			slog.String("import_id", importID),
+			slog.Int("blobs_imported", job.BlobsImported),
+			slog.Int("plugins_imported", job.PluginsImported),
+		)
+		if err := h.DB.SetStatus(ctx, accountID, importID, StatusRunning, StatusPending); err != nil {
+			return fmt.Errorf("failed to requeue import job: %w", err)
+		}
+		return nil
+	}
+
+	job.Status = StatusCompleted
+	job.CompletedAt = time.Now().UTC().Format(time.RFC3339)
+	if err := h.DB.CompleteJob(ctx, *job); err != nil {
+		return fmt.Errorf("failed to complete import job: %w", err)
+	}
+
+	logger.InfoContext(ctx, "Import completed",
+		slog.String("account_id", accountID),
+		slog.String("import_id", importID),
+		slog.Int("blobs_imported", job.BlobsImported),
+		slog.Int("plugins_imported", job.PluginsImported),
+		slog.Int("error_count", len(job.Errors)),
+	)
+	return nil
+}
+
+// restore works through the archive from the job's recorded progress,
+// saving progress after each step. It returns false if it stopped early to
+// avoid the Lambda timeout.
+func (h *Handler) restore(ctx context.Context, job *Job) (bool, error) {
+	archive, err := h.DB.GetArchive(ctx, job.AccountID, job.ImportID)
+	if err != nil {
+		return false, fmt.Errorf("failed to get archive: %w", err)
+	}
+	if archive == nil {
+		return false, fmt.Errorf("archive blob %s not found", job.ImportID)
+	}
+
+	readerAt, err := h.Storage.OpenArchive(ctx, *archive)
+	if err != nil {
+		return false, fmt.Errorf("failed to open archive: %w", err)
+	}
+	zr, err := zip.NewReader(readerAt, archive.Size)
+	if err != nil {
+		return false, fmt.Errorf("failed to read archive: %w", err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	m, err := readManifest(files)
+	if err != nil {
+		return false, err
+	}
+	plugins := groupPlugins(m.Plugins)
+
+	job.BlobsTotal = len(m.Blobs)
+	job.PluginsTotal = len(plugins)
+
+	for job.BlobsImported < len(m.Blobs) {
+		if outOfTime(ctx) {
+			return false, nil
+		}
+		if err := h.restoreBlob(ctx, job, files, m.Blobs[job.BlobsImported]); err != nil {
+			return false, err
+		}
+		job.BlobsImported++
+		if err := h.DB.UpdateProgress(ctx, *job); err != nil {
+			return false, fmt.Errorf("failed to save progress: %w", err)
+		}
+	}
+
+	// Plugin imports are best effort: a failing plugin is noted on the job
+	// rather than failing the whole import
+	for job.PluginsImported < len(plugins) {
+		if outOfTime(ctx) {
+			return false, nil
+		}
+		p := plugins[job.PluginsImported]
+		if err := h.importPlugin(ctx, job, files, p); err != nil {
+			logger.ErrorContext(ctx, "Plugin import failed",
+				slog.String("account_id", job.AccountID),
+				slog.String("import_id", job.ImportID),
+				slog.String("plugin_id", p.pluginID),
+				slog.String("error", err.Error()),
+			)
+			job.Errors = append(job.Errors, fmt.Sprintf("plugin %s: %v", p.pluginID, err))
+		}
+		job.PluginsImported++
+		if err := h.DB.UpdateProgress(ctx, *job); err != nil {
+			return false, fmt.Errorf("failed to save progress: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// restoreBlob copies one blob out of the archive into the account, keeping
+// its blob ID so plugin data referring to it stays valid. Blobs already in
+// the account are skipped, which makes re-running a step safe.
+func (h *Handler) restoreBlob(ctx context.Context, job *Job, files map[string]*zip.File, blob accountexport.ManifestBlob) error {
+	exists, err := h.DB.BlobExists(ctx, job.AccountID, blob.BlobID)
+	if err != nil {
+		return fmt.Errorf("failed to check blob %s: %w", blob.BlobID, err)
+	}
+	if exists {
+		return nil
+	}
+
+	f, ok := files[blob.Path]
+	if !ok {
+		return fmt.Errorf("archive is missing %s", blob.Path)
+	}
+	body, err := f.Open()
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", blob.Path, err)
+	}
+	defer body.Close()
+
+	entry := blob.BlobEntry
+	entry.Size = int64(f.UncompressedSize64)
+	entry.S3Key = fmt.Sprintf("%s/%s", job.AccountID, blob.BlobID)
+
+	if err := h.Storage.PutBlob(ctx, job.AccountID, entry.S3Key, entry.ContentType, entry.Size, body); err != nil {
+		return fmt.Errorf("failed to store blob %s: %w", blob.BlobID, err)
+	}
+	if err := h.DB.RestoreBlob(ctx, job.AccountID, job.ImportID, entry); err != nil && !errors.Is(err, ErrBlobExists) {
+		return fmt.Errorf("failed to record blob %s: %w", blob.BlobID, err)
+	}
+	return nil
+}
+
+// importPlugin hands a plugin the files it contributed to the export.
+// Files copied from blobs are passed by blob ID, since those blobs have been
+// restored; other files are passed inline.
+func (h *Handler) importPlugin(ctx context.Context, job *Job, files map[string]*zip.File, p pluginFiles) error {
+	importFiles := make([]File, 0, len(p.entries))
+	for _, entry := range p.entries {
+		if entry.BlobID != "" {
+			importFiles = append(importFiles, File{Name: entry.Name, BlobID: entry.BlobID})
+			continue
+		}
+
+		content, err := readFile(files, entry.Path)
+		if err != nil {
+			return err
+		}
+		importFiles = append(importFiles, File{Name: entry.Name, Content: string(content)})
+	}
+
+	return h.Dispatcher.ImportPlugin(ctx, job.AccountID, job.ImportID, p.pluginID, importFiles)
+}
+
+// pluginFiles is the set of archive files contributed by one plugin
+type pluginFiles struct {
+	pluginID string
+	entries  []accountexport.ManifestEntry
+}
+
+// groupPlugins groups manifest entries by plugin, in order of first
+// appearance so progress indexes are stable across invocations
+func groupPlugins(entries []accountexport.ManifestEntry) []pluginFiles {
+	var plugins []pluginFiles
+	index := make(map[string]int)
+	for _, entry := range entries {
+		i, ok := index[entry.PluginID]
+		if !ok {
+			i = len(plugins)
+			index[entry.PluginID] = i
+			plugins = append(plugins, pluginFiles{pluginID: entry.PluginID})
+		}
+		plugins[i].entries = append(plugins[i].entries, entry)
+	}
+	return plugins
+}
+
+// readManifest parses the archive manifest
+func readManifest(files map[string]*zip.File) (*accountexport.Manifest, error) {
+	content, err := readFile(files, accountexport.ManifestName)
+	if err != nil {
+		return nil, err
+	}
+	var m accountexport.Manifest
+	if err := json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// readFile reads a whole file from the archive
+func readFile(files map[string]*zip.File, path string) ([]byte, error) {
+	f, ok := files[path]
+	if !ok {
+		return nil, fmt.Errorf("archive is missing %s", path)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer rc.Close()
+
+	content, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return content, nil
+}
+
+// leaseExpiry returns when the lease of a job run under ctx expires: shortly
+// after the invocation's deadline, when it can no longer be running
+func leaseExpiry(ctx context.Context) time.Time {
+	if deadline, ok := ctx.Deadline(); ok {
+		return deadline.Add(LeaseGrace)
+	}
+	return time.Now().Add(MaxLease)
+}
+
+// outOfTime reports whether the invocation is within YieldMargin of its deadline
+func outOfTime(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < YieldMargin
+}
@@ -0,0 +1,528 @@
+package accountimport
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/accountexport"
+)
+
+type mockDB struct {
+	jobs          map[string]*Job
+	createErr     error
+	statusErr     error
+	transitions   []string
+	archive       *Archive
+	existing      map[string]bool
+	restored      []accountexport.BlobEntry
+	restoreErr    error
+	progressSaves int
+	completed     *Job
+	failedReason  string
+}
+
+func (m *mockDB) CreateJob(ctx context.Context, job Job) error {
+	if m.createErr != nil {
+		return m.createErr
+	}
+	if m.jobs == nil {
+		m.jobs = make(map[string]*Job)
+	}
+	m.jobs[job.ImportID] = &job
+	return nil
+}
+
+func (m *mockDB) GetJob(ctx context.Context, accountID, importID string) (*Job, error) {
+	job, ok := m.jobs[importID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *job
+	return &copied, nil
+}
+
+func (m *mockDB) SetStatus(ctx context.Context, accountID, importID, from, to string) error {
+	if m.statusErr != nil {
+		return m.statusErr
+	}
+	job, ok := m.jobs[importID]
+	if !ok || job.Status != from {
+		return ErrStatusConflict
+	}
+	job.Status = to
+	m.transitions = append(m.transitions, from+"->"+to)
+	return nil
+}
+
+func (m *mockDB) Acquire(ctx context.Context, accountID, importID string, leaseExpiresAt time.Time) error {
+	if m.statusErr != nil {
+		return m.statusErr
+	}
+	job, ok := m.jobs[importID]
+	if !ok || (job.Status != StatusPending && !job.leaseLapsed(time.Now())) {
+		return ErrStatusConflict
+	}
+	m.transitions = append(m.transitions, job.Status+"->"+StatusRunning)
+	job.Status = StatusRunning
+	job.LeaseExpiresAt = leaseExpiresAt.UTC().Format(time.RFC3339)
+	return nil
+}
+
+func (m *mockDB) RequeueLapsed(ctx context.Context, accountID, importID string) error {
+	job, ok := m.jobs[importID]
+	if !ok || !job.leaseLapsed(time.Now()) {
+		return ErrStatusConflict
+	}
+	job.Status = StatusPending
+	job.LeaseExpiresAt = ""
+	m.transitions = append(m.transitions, "running->pending")
+	return nil
+}
+
+func (m *mockDB) GetArchive(ctx context.Context, accountID, blobID string) (*Archive, error) {
+	return m.archive, nil
+}
+
+func (m *mockDB) BlobExists(ctx context.Context, accountID, blobID string) (bool, error) {
+	return m.existing[blobID], nil
+}
+
+func (m *mockDB) RestoreBlob(ctx context.Context, accountID, importID string, blob accountexport.BlobEntry) error {
+	if m.restoreErr != nil {
+		return m.restoreErr
+	}
+	m.restored = append(m.restored, blob)
+	return nil
+}
+
+func (m *mockDB) UpdateProgress(ctx context.Context, job Job) error {
+	m.progressSaves++
+	stored := m.jobs[job.ImportID]
+	stored.BlobsTotal, stored.BlobsImported = job.BlobsTotal, job.BlobsImported
+	stored.PluginsTotal, stored.PluginsImported = job.PluginsTotal, job.PluginsImported
+	stored.Errors = job.Errors
+	return nil
+}
+
+func (m *mockDB) CompleteJob(ctx context.Context, job Job) error {
+	m.completed = &job
+	m.jobs[job.ImportID].Status = StatusCompleted
+	return nil
+}
+
+func (m *mockDB) FailJob(ctx context.Context, accountID, importID, reason string) error {
+	m.failedReason = reason
+	m.jobs[importID].Status = StatusFailed
+	return nil
+}
+
+type mockStorage struct {
+	archive []byte
+	puts    map[string]string
+	putErr  error
+}
+
+func (m *mockStorage) OpenArchive(ctx context.Context, archive Archive) (io.ReaderAt, error) {
+	return bytes.NewReader(m.archive), nil
+}
+
+func (m *mockStorage) PutBlob(ctx context.Context, accountID, s3Key, contentType string, size int64, body io.Reader) error {
+	if m.putErr != nil {
+		return m.putErr
+	}
+	content, _ := io.ReadAll(body)
+	if m.puts == nil {
+		m.puts = make(map[string]string)
+	}
+	m.puts[s3Key] = string(content)
+	return nil
+}
+
+type dispatchCall struct {
+	pluginID string
+	files    []File
+}
+
+type mockDispatcher struct {
+	calls []dispatchCall
+	errs  map[string]error
+}
+
+func (m *mockDispatcher) ImportPlugin(ctx context.Context, accountID, importID, pluginID string, files []File) error {
+	m.calls = append(m.calls, dispatchCall{pluginID: pluginID, files: files})
+	return m.errs[pluginID]
+}
+
+// buildArchive writes a zip in the export archive layout
+func buildArchive(t *testing.T) []byte {
+	t.Helper()
+	m := accountexport.Manifest{
+		AccountID: "source",
+		ExportID:  "exp-1",
+		Blobs: []accountexport.ManifestBlob{
+			{BlobEntry: accountexport.BlobEntry{BlobID: "b1", ContentType: "message/rfc822", Size: 5}, Path: "blobs/b1"},
+			{BlobEntry: accountexport.BlobEntry{BlobID: "b2", ContentType: "text/plain", Size: 3}, Path: "blobs/b2"},
+		},
+		Plugins: []accountexport.ManifestEntry{
+			{PluginID: "email", Name: "mailboxes.json", Path: "plugins/email/mailboxes.json"},
+			{PluginID: "calendar", Name: "cal.ics", Path: "plugins/calendar/cal.ics"},
+			{PluginID: "email", Name: "raw/b1.eml", Path: "plugins/email/raw/b1.eml", BlobID: "b1"},
+		},
+	}
+	manifest, _ := json.Marshal(m)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"blobs/b1":                     "hello",
+		"blobs/b2":                     "abc",
+		"plugins/email/mailboxes.json": `{"inbox":{}}`,
+		"plugins/email/raw/b1.eml":     "hello",
+		"plugins/calendar/cal.ics":     "BEGIN:VCALENDAR",
+		accountexport.ManifestName:     string(manifest),
+	} {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", name, err)
+		}
+		if _, err := io.WriteString(fw, content); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// setupRun returns a handler with a pending job for a valid archive
+func setupRun(t *testing.T) (*Handler, *mockDB, *mockStorage, *mockDispatcher) {
+	t.Helper()
+	archive := buildArchive(t)
+	db := &mockDB{
+		jobs:    map[string]*Job{"archive-1": {AccountID: "user-1", ImportID: "archive-1", Status: StatusPending}},
+		archive: &Archive{S3Key: "user-1/archive-1", Size: int64(len(archive))},
+	}
+	storage := &mockStorage{archive: archive}
+	dispatcher := &mockDispatcher{}
+	return &Handler{DB: db, Storage: storage, Dispatcher: dispatcher}, db, storage, dispatcher
+}
+
+func TestStart_CreatesPendingJob(t *testing.T) {
+	db := &mockDB{archive: &Archive{S3Key: "user-1/archive-1", Size: 10}}
+	h := &Handler{DB: db}
+
+	job, err := h.Start(context.Background(), "user-1", "archive-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.ImportID != "archive-1" || job.Status != StatusPending {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	if db.jobs["archive-1"] == nil {
+		t.Error("expected job to be stored")
+	}
+}
+
+func TestStart_ArchiveNotFound(t *testing.T) {
+	h := &Handler{DB: &mockDB{}}
+
+	_, err := h.Start(context.Background(), "user-1", "missing")
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || importErr.Type != "notFound" {
+		t.Fatalf("expected notFound error, got %v", err)
+	}
+}
+
+func TestStart_ExistingJob_ReturnedUnchanged(t *testing.T) {
+	lease := time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+	db := &mockDB{jobs: map[string]*Job{
+		"archive-1": {AccountID: "user-1", ImportID: "archive-1", Status: StatusRunning, BlobsImported: 3, LeaseExpiresAt: lease},
+	}}
+	h := &Handler{DB: db}
+
+	job, err := h.Start(context.Background(), "user-1", "archive-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Status != StatusRunning || job.BlobsImported != 3 {
+		t.Errorf("expected existing job, got %+v", job)
+	}
+	if len(db.transitions) != 0 {
+		t.Errorf("expected no status change, got %v", db.transitions)
+	}
+}
+
+func TestStart_FailedJob_Resumes(t *testing.T) {
+	db := &mockDB{jobs: map[string]*Job{
+		"archive-1": {AccountID: "user-1", ImportID: "archive-1", Status: StatusFailed, Error: "s3 down", BlobsImported: 1},
+	}}
+	h := &Handler{DB: db}
+
+	job, err := h.Start(context.Background(), "user-1", "archive-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if job.Status != StatusPending || job.Error != "" || job.BlobsImported != 1 {
+		t.Errorf("expected resumed job with progress kept, got %+v", job)
+	}
+	if len(db.transitions) != 1 || db.transitions[0] != "failed->pending" {
+		t.Errorf("unexpected transitions: %v", db.transitions)
+	}
+}
+
+func TestStart_LapsedLease_Resumes(t *testing.T) {
+	lapsed := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	for name, lease := range map[string]string{"lapsed": lapsed, "no lease": ""} {
+		db := &mockDB{jobs: map[string]*Job{
+			"archive-1": {AccountID: "user-1", ImportID: "archive-1", Status: StatusRunning, BlobsImported: 2, LeaseExpiresAt: lease},
+		}}
+		h := &Handler{DB: db}
+
+		job, err := h.Start(context.Background(), "user-1", "archive-1")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+		if job.Status != StatusPending || job.BlobsImported != 2 || job.LeaseExpiresAt != "" {
+			t.Errorf("%s: expected abandoned job back to pending with progress kept, got %+v", name, job)
+		}
+		if len(db.transitions) != 1 || db.transitions[0] != "running->pending" {
+			t.Errorf("%s: unexpected transitions: %v", name, db.transitions)
+		}
+	}
+}
+
+func TestGet_NotFound_ReturnsNotFoundError(t *testing.T) {
+	h := &Handler{DB: &mockDB{}}
+
+	_, err := h.Get(context.Background(), "user-1", "missing")
+	var importErr *ImportError
+	if !errors.As(err, &importErr) || importErr.Type != "notFound" {
+		t.Fatalf("expected notFound error, got %v", err)
+	}
+}
+
+func TestRun_RestoresBlobsAndDispatchesPlugins(t *testing.T) {
+	h, db, storage, dispatcher := setupRun(t)
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if db.completed == nil {
+		t.Fatalf("expected job to complete, failed with %q", db.failedReason)
+	}
+	if storage.puts["user-1/b1"] != "hello" || storage.puts["user-1/b2"] != "abc" {
+		t.Errorf("unexpected stored blobs: %v", storage.puts)
+	}
+	if len(db.restored) != 2 || db.restored[0].BlobID != "b1" || db.restored[0].Size != 5 || db.restored[0].S3Key != "user-1/b1" {
+		t.Errorf("unexpected restored records: %+v", db.restored)
+	}
+	if db.completed.BlobsImported != 2 || db.completed.PluginsImported != 2 || db.completed.PluginsTotal != 2 {
+		t.Errorf("unexpected progress: %+v", db.completed)
+	}
+
+	if len(dispatcher.calls) != 2 || dispatcher.calls[0].pluginID != "email" || dispatcher.calls[1].pluginID != "calendar" {
+		t.Fatalf("unexpected dispatches: %+v", dispatcher.calls)
+	}
+	emailFiles := dispatcher.calls[0].files
+	if len(emailFiles) != 2 || emailFiles[0].Content != `{"inbox":{}}` || emailFiles[1].BlobID != "b1" || emailFiles[1].Content != "" {
+		t.Errorf("unexpected email files: %+v", emailFiles)
+	}
+}
+
+func TestRun_ResumesFromProgress(t *testing.T) {
+	h, db, storage, dispatcher := setupRun(t)
+	db.jobs["archive-1"].BlobsImported = 1
+	db.jobs["archive-1"].PluginsImported = 0
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := storage.puts["user-1/b1"]; ok {
+		t.Error("expected already imported blob to be skipped")
+	}
+	if len(db.restored) != 1 || db.restored[0].BlobID != "b2" {
+		t.Errorf("unexpected restored records: %+v", db.restored)
+	}
+	if len(dispatcher.calls) != 2 {
+		t.Errorf("expected plugins to be dispatched, got %+v", dispatcher.calls)
+	}
+}
+
+func TestRun_ExistingBlob_Skipped(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	db.existing = map[string]bool{"b1": true}
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := storage.puts["user-1/b1"]; ok {
+		t.Error("expected existing blob not to be overwritten")
+	}
+	if db.completed == nil || db.completed.BlobsImported != 2 {
+		t.Errorf("expected existing blob to count as imported, got %+v", db.completed)
+	}
+}
+
+func TestRun_BlobRecordRace_TreatedAsImported(t *testing.T) {
+	h, db, _, _ := setupRun(t)
+	db.restoreErr = ErrBlobExists
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.completed == nil {
+		t.Fatalf("expected job to complete, failed with %q", db.failedReason)
+	}
+}
+
+func TestRun_PluginFailure_RecordedAndContinues(t *testing.T) {
+	h, db, _, dispatcher := setupRun(t)
+	dispatcher.errs = map[string]error{"email": errors.New("timeout")}
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if db.completed == nil {
+		t.Fatal("expected import to complete despite plugin failure")
+	}
+	if len(db.completed.Errors) != 1 || !strings.Contains(db.completed.Errors[0], "email") {
+		t.Errorf("expected plugin error to be recorded, got %v", db.completed.Errors)
+	}
+	if len(dispatcher.calls) != 2 {
+		t.Errorf("expected remaining plugins to be dispatched, got %d calls", len(dispatcher.calls))
+	}
+}
+
+func TestRun_StorageFailure_MarksJobFailedWithProgress(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	storage.putErr = errors.New("s3 down")
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(db.failedReason, "s3 down") {
+		t.Errorf("expected job to be marked failed, got %q", db.failedReason)
+	}
+	if db.completed != nil {
+		t.Error("expected job not to complete")
+	}
+}
+
+func TestRun_InvalidArchive_MarksJobFailed(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	storage.archive = []byte("not a zip")
+	db.archive.Size = int64(len(storage.archive))
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.failedReason == "" {
+		t.Error("expected job to be marked failed")
+	}
+}
+
+func TestRun_NearDeadline_YieldsBackToPending(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	ctx, cancel := context.WithTimeout(context.Background(), YieldMargin/2)
+	defer cancel()
+
+	if err := h.Run(ctx, "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if db.completed != nil || db.failedReason != "" {
+		t.Error("expected job to be neither completed nor failed")
+	}
+	if len(storage.puts) != 0 {
+		t.Errorf("expected no work after yielding, got %v", storage.puts)
+	}
+	if db.jobs["archive-1"].Status != StatusPending {
+		t.Errorf("expected job back to pending, got %s", db.jobs["archive-1"].Status)
+	}
+}
+
+func TestRun_NotPending_Skips(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	db.jobs["archive-1"].Status = StatusCompleted
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(storage.puts) != 0 || db.completed != nil {
+		t.Error("expected job to be left alone")
+	}
+}
+
+func TestRun_SetsLeaseToDeadline(t *testing.T) {
+	h, db, _, _ := setupRun(t)
+	deadline := time.Now().Add(10 * time.Minute)
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	if err := h.Run(ctx, "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := deadline.Add(LeaseGrace).UTC().Format(time.RFC3339)
+	if db.completed == nil || db.completed.LeaseExpiresAt != want {
+		t.Errorf("expected lease %s, got %+v", want, db.completed)
+	}
+}
+
+func TestRun_TakesOverLapsedLease(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	db.jobs["archive-1"].Status = StatusRunning
+	db.jobs["archive-1"].LeaseExpiresAt = time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.completed == nil || len(storage.puts) != 2 {
+		t.Errorf("expected the abandoned job to be taken over and completed, got %v", db.transitions)
+	}
+}
+
+func TestRun_LiveLease_Skips(t *testing.T) {
+	h, db, storage, _ := setupRun(t)
+	db.jobs["archive-1"].Status = StatusRunning
+	db.jobs["archive-1"].LeaseExpiresAt = time.Now().Add(time.Minute).UTC().Format(time.RFC3339)
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(storage.puts) != 0 || db.completed != nil {
+		t.Error("expected a job another worker holds to be left alone")
+	}
+}
+
+func TestRun_StartError_Propagates(t *testing.T) {
+	db := &mockDB{statusErr: errors.New("dynamo down")}
+	h := &Handler{DB: db}
+
+	if err := h.Run(context.Background(), "user-1", "archive-1"); err == nil {
+		t.Fatal("expected error so the stream record is retried")
+	}
+}
+
+func TestOutOfTime(t *testing.T) {
+	if outOfTime(context.Background()) {
+		t.Error("expected no deadline to mean time remaining")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*YieldMargin+time.Second)
+	defer cancel()
+	if outOfTime(ctx) {
+		t.Error("expected time remaining before the margin")
+	}
+}
@@ -0,0 +1,128 @@
+package accountimport
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// DefaultReadAhead is how much of the archive each ranged GET fetches.
+// Zip readers issue many small reads, so fetching ahead keeps the number of
+// S3 requests proportional to the archive size rather than its file count.
+const DefaultReadAhead = 8 * 1024 * 1024
+
+// S3Client defines the interface for S3 operations needed by accountimport
+type S3Client interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+}
+
+// S3Storage implements Storage using AWS S3
+type S3Storage struct {
+	client     S3Client
+	bucketName string
+	readAhead  int64
+}
+
+// NewS3Storage creates a new S3Storage
+func NewS3Storage(client S3Client, bucketName string) *S3Storage {
+	return &S3Storage{
+		client:     client,
+		bucketName: bucketName,
+		readAhead:  DefaultReadAhead,
+	}
+}
+
+// OpenArchive returns random access to an archive using ranged GETs
+func (s *S3Storage) OpenArchive(ctx context.Context, archive Archive) (io.ReaderAt, error) {
+	return &rangeReader{
+		ctx:       ctx,
+		client:    s.client,
+		bucket:    s.bucketName,
+		key:       archive.S3Key,
+		size:      archive.Size,
+		readAhead: s.readAhead,
+	}, nil
+}
+
+// PutBlob stores a restored blob. The object is tagged confirmed so the
+// pending-blob lifecycle rule never expires it.
+func (s *S3Storage) PutBlob(ctx context.Context, accountID, s3Key, contentType string, size int64, body io.Reader) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucketName),
+		Key:           aws.String(s3Key),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+		ContentType:   aws.String(contentType),
+		Tagging:       aws.String(fmt.Sprintf("Account=%s&Status=confirmed", accountID)),
+	})
+	return err
+}
+
+// rangeReader implements io.ReaderAt over an S3 object, caching the most
+// recently fetched range
+type rangeReader struct {
+	ctx       context.Context
+	client    S3Client
+	bucket    string
+	key       string
+	size      int64
+	readAhead int64
+	bufOff    int64
+	buf       []byte
+}
+
+// ReadAt implements io.ReaderAt
+func (r *rangeReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		if off < r.bufOff || off >= r.bufOff+int64(len(r.buf)) {
+			if err := r.fetch(off, int64(len(p)-n)); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(p[n:], r.buf[off-r.bufOff:])
+		n += copied
+		off += int64(copied)
+	}
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// fetch loads at least want bytes starting at off into the buffer
+func (r *rangeReader) fetch(off, want int64) error {
+	length := max(want, r.readAhead)
+	end := min(off+length, r.size) - 1
+
+	output, err := r.client.GetObject(r.ctx, &s3.GetObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(r.key),
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", off, end)),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read archive range: %w", err)
+	}
+	defer output.Body.Close()
+
+	buf, err := io.ReadAll(output.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read archive range: %w", err)
+	}
+	if len(buf) == 0 {
+		return io.ErrUnexpectedEOF
+	}
+
+	r.bufOff = off
+	r.buf = buf
+	return nil
+}
@@ -0,0 +1,82 @@
+package accountimport
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+type mockS3Client struct {
+	object []byte
+	ranges []string
+	put    *s3.PutObjectInput
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	rng := aws.ToString(params.Range)
+	m.ranges = append(m.ranges, rng)
+	var start, end int
+	if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(m.object[start : end+1]))}, nil
+}
+
+func (m *mockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.put = params
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestOpenArchive_ReadsAheadAndCaches(t *testing.T) {
+	client := &mockS3Client{object: []byte("abcdefghijklmnop")}
+	storage := NewS3Storage(client, "bucket")
+	storage.readAhead = 8
+
+	r, err := storage.OpenArchive(context.Background(), Archive{S3Key: "k", Size: 16})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	buf := make([]byte, 2)
+	if _, err := r.ReadAt(buf, 1); err != nil || string(buf) != "bc" {
+		t.Fatalf("unexpected read: %q %v", buf, err)
+	}
+	if _, err := r.ReadAt(buf, 4); err != nil || string(buf) != "ef" {
+		t.Fatalf("unexpected read: %q %v", buf, err)
+	}
+	if len(client.ranges) != 1 || client.ranges[0] != "bytes=1-8" {
+		t.Errorf("expected one read-ahead request, got %v", client.ranges)
+	}
+
+	// Spans the cached range and the end of the object
+	big := make([]byte, 10)
+	n, err := r.ReadAt(big, 7)
+	if err != io.EOF || n != 9 || string(big[:n]) != "hijklmnop" {
+		t.Errorf("unexpected read: %q %d %v", big[:n], n, err)
+	}
+
+	if _, err := r.ReadAt(buf, 16); err != io.EOF {
+		t.Errorf("expected EOF past end, got %v", err)
+	}
+}
+
+func TestPutBlob_TagsConfirmed(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "bucket")
+
+	if err := storage.PutBlob(context.Background(), "user-1", "user-1/b1", "text/plain", 3, bytes.NewReader([]byte("abc"))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if aws.ToString(client.put.Tagging) != "Account=user-1&Status=confirmed" {
+		t.Errorf("unexpected tagging: %s", aws.ToString(client.put.Tagging))
+	}
+	if aws.ToInt64(client.put.ContentLength) != 3 || aws.ToString(client.put.Key) != "user-1/b1" {
+		t.Errorf("unexpected put: %+v", client.put)
+	}
+}
@@ -0,0 +1,316 @@
+// Package apikey mints and validates API keys, which let third-party
+// integrations call the key-authenticated routes for one account without a
+// Cognito login or an IAM role. Only a hash of each key is stored; the key
+// itself is returned once, when it is created.
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Key prefixes for API key records. Each key is stored twice: a lookup
+// record at APIKEY#{keyId} that holds the key hash, and an APIKEY#{keyId}
+// record under the account for listing.
+const (
+	PrefixAPIKey = "APIKEY#"
+	SKAPIKey     = "APIKEY#"
+)
+
+// Scopes an API key may be granted
+const (
+	ScopeRead   = "read"   // download blobs
+	ScopeUpload = "upload" // upload blobs
+)
+
+// tokenPrefix starts every API key, so leaked keys are easy to recognise
+const tokenPrefix = "jmk"
+
+var (
+	// ErrInvalidKey is returned when a key is malformed, unknown or revoked
+	ErrInvalidKey = errors.New("invalid API key")
+	// ErrKeyNotFound is returned when a key does not belong to the account
+	ErrKeyNotFound = errors.New("API key not found")
+	// ErrAccountNotFound is returned when creating a key for a missing account
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// Key is an API key's metadata. The key itself is never stored.
+type Key struct {
+	KeyID     string   `dynamodbav:"keyId" json:"keyId"`
+	AccountID string   `dynamodbav:"accountId" json:"accountId"`
+	Name      string   `dynamodbav:"name,omitempty" json:"name,omitempty"`
+	Scopes    []string `dynamodbav:"scopes" json:"scopes"`
+	CreatedAt string   `dynamodbav:"createdAt" json:"createdAt"`
+	RevokedAt string   `dynamodbav:"revokedAt,omitempty" json:"revokedAt,omitempty"`
+}
+
+// HasScope reports whether the key was granted a scope
+func (k *Key) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+// IsValidScope reports whether scope is one an API key may be granted
+func IsValidScope(scope string) bool {
+	return scope == ScopeRead || scope == ScopeUpload
+}
+
+// ParseToken splits a key of the form jmk.{keyId}.{secret}
+func ParseToken(token string) (keyID, secret string, err error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenPrefix || parts[1] == "" || parts[2] == "" {
+		return "", "", ErrInvalidKey
+	}
+	return parts[1], parts[2], nil
+}
+
+// hashSecret returns the hex SHA-256 of a key's secret. The secret is 256
+// random bits, so a fast hash is enough.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed for API keys
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoDBStore stores API keys in DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// lookupKey builds the primary key of an API key lookup record
+func lookupKey(keyID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: PrefixAPIKey + keyID},
+		"sk": &types.AttributeValueMemberS{Value: SKAPIKey},
+	}
+}
+
+// accountKey builds the primary key of the API key record under an account
+func accountKey(accountID, keyID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKAPIKey + keyID},
+	}
+}
+
+// Create mints a key for an account and returns its metadata and the key,
+// which cannot be retrieved again. Returns ErrAccountNotFound if the account
+// does not exist.
+func (d *DynamoDBStore) Create(ctx context.Context, accountID, name string, scopes []string) (*Key, string, error) {
+	idBytes := make([]byte, 8)
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key ID: %w", err)
+	}
+	if _, err := rand.Read(secretBytes); err != nil {
+		return nil, "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	secret := base64.RawURLEncoding.EncodeToString(secretBytes)
+
+	key := Key{
+		KeyID:     hex.EncodeToString(idBytes),
+		AccountID: accountID,
+		Name:      name,
+		Scopes:    scopes,
+		CreatedAt: d.now().UTC().Format(time.RFC3339),
+	}
+
+	av, err := attributevalue.MarshalMap(key)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal API key: %w", err)
+	}
+	lookupItem := make(map[string]types.AttributeValue, len(av)+3)
+	accountItem := make(map[string]types.AttributeValue, len(av)+2)
+	for k, v := range av {
+		lookupItem[k] = v
+		accountItem[k] = v
+	}
+	for k, v := range lookupKey(key.KeyID) {
+		lookupItem[k] = v
+	}
+	lookupItem["keyHash"] = &types.AttributeValueMemberS{Value: hashSecret(secret)}
+	for k, v := range accountKey(accountID, key.KeyID) {
+		accountItem[k] = v
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName: aws.String(d.tableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+						"sk": &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+					},
+					ConditionExpression: aws.String("attribute_exists(pk)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName:           aws.String(d.tableName),
+					Item:                lookupItem,
+					ConditionExpression: aws.String("attribute_not_exists(pk)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(d.tableName),
+					Item:      accountItem,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if dbclient.GetConditionalCheckFailureIndex(err) == 0 {
+			return nil, "", ErrAccountNotFound
+		}
+		return nil, "", err
+	}
+
+	return &key, tokenPrefix + "." + key.KeyID + "." + secret, nil
+}
+
+// Authenticate returns the metadata of a presented key.
+// Returns ErrInvalidKey if the key is malformed, unknown or revoked.
+func (d *DynamoDBStore) Authenticate(ctx context.Context, token string) (*Key, error) {
+	keyID, secret, err := ParseToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(d.tableName),
+		Key:            lookupKey(keyID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, ErrInvalidKey
+	}
+
+	var record struct {
+		Key
+		KeyHash string `dynamodbav:"keyHash"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &record); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(record.KeyHash), []byte(hashSecret(secret))) != 1 {
+		return nil, ErrInvalidKey
+	}
+	if record.RevokedAt != "" {
+		return nil, ErrInvalidKey
+	}
+
+	return &record.Key, nil
+}
+
+// Revoke marks a key revoked so it can no longer authenticate. Revoked keys
+// are still listed. Returns ErrKeyNotFound if the key does not belong to the
+// account.
+func (d *DynamoDBStore) Revoke(ctx context.Context, accountID, keyID string) error {
+	revokedAt := &types.AttributeValueMemberS{Value: d.now().UTC().Format(time.RFC3339)}
+
+	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				Update: &types.Update{
+					TableName:           aws.String(d.tableName),
+					Key:                 lookupKey(keyID),
+					UpdateExpression:    aws.String("SET revokedAt = if_not_exists(revokedAt, :revokedAt)"),
+					ConditionExpression: aws.String("accountId = :accountId"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":accountId": &types.AttributeValueMemberS{Value: accountID},
+						":revokedAt": revokedAt,
+					},
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:        aws.String(d.tableName),
+					Key:              accountKey(accountID, keyID),
+					UpdateExpression: aws.String("SET revokedAt = if_not_exists(revokedAt, :revokedAt)"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":revokedAt": revokedAt,
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		if dbclient.HasConditionalCheckFailure(err) {
+			return ErrKeyNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// List returns the keys created for an account, including revoked keys
+func (d *DynamoDBStore) List(ctx context.Context, accountID string) ([]Key, error) {
+	keys := []Key{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			KeyConditionExpression: aws.String("pk = :pk AND begins_with(sk, :apikey)"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":     &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+				":apikey": &types.AttributeValueMemberS{Value: SKAPIKey},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			var key Key
+			if err := attributevalue.UnmarshalMap(item, &key); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal API key: %w", err)
+			}
+			keys = append(keys, key)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return keys, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
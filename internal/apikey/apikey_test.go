@@ -0,0 +1,237 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBClient struct {
+	getItemFunc  func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	queryFunc    func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	transactFunc func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getItemFunc != nil {
+		return m.getItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.transactFunc != nil {
+		return m.transactFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// transactionCanceled builds a TransactionCanceledException with a
+// ConditionalCheckFailed reason at the given index
+func transactionCanceled(items, failedIndex int) error {
+	reasons := make([]types.CancellationReason, items)
+	for i := range reasons {
+		reasons[i] = types.CancellationReason{Code: aws.String("None")}
+	}
+	reasons[failedIndex].Code = aws.String("ConditionalCheckFailed")
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+// createKey mints a key against a mock and returns the stored lookup record
+func createKey(t *testing.T) (string, map[string]types.AttributeValue) {
+	t.Helper()
+	var captured *dynamodb.TransactWriteItemsInput
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}, "table")
+
+	_, token, err := store.Create(context.Background(), "user-1", "crm", []string{ScopeRead})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return token, captured.TransactItems[1].Put.Item
+}
+
+func TestCreate_WritesHashedLookupAndAccountRecords(t *testing.T) {
+	var captured *dynamodb.TransactWriteItemsInput
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}, "table")
+
+	key, token, err := store.Create(context.Background(), "user-1", "crm", []string{ScopeRead, ScopeUpload})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, "jmk."+key.KeyID+".") {
+		t.Errorf("unexpected token format %q", token)
+	}
+	if key.AccountID != "user-1" || key.Name != "crm" || key.CreatedAt == "" || !key.HasScope(ScopeUpload) {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	items := captured.TransactItems
+	if len(items) != 3 {
+		t.Fatalf("expected 3 transaction items, got %d", len(items))
+	}
+	if sk := items[0].ConditionCheck.Key["sk"].(*types.AttributeValueMemberS).Value; sk != "META#" {
+		t.Errorf("expected account existence check, got %s", sk)
+	}
+	lookup := items[1].Put.Item
+	if pk := lookup["pk"].(*types.AttributeValueMemberS).Value; pk != "APIKEY#"+key.KeyID {
+		t.Errorf("unexpected lookup pk %s", pk)
+	}
+	hash := lookup["keyHash"].(*types.AttributeValueMemberS).Value
+	if hash == "" || strings.Contains(token, hash) {
+		t.Errorf("expected a hash of the key to be stored, got %q", hash)
+	}
+	if _, ok := items[2].Put.Item["keyHash"]; ok {
+		t.Error("expected no key hash on the account record")
+	}
+	if sk := items[2].Put.Item["sk"].(*types.AttributeValueMemberS).Value; sk != "APIKEY#"+key.KeyID {
+		t.Errorf("unexpected account record sk %s", sk)
+	}
+}
+
+func TestCreate_MissingAccount(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, transactionCanceled(3, 0)
+		},
+	}, "table")
+
+	if _, _, err := store.Create(context.Background(), "missing", "", []string{ScopeRead}); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	token, record := createKey(t)
+	keyID, _, _ := ParseToken(token)
+
+	revoked := make(map[string]types.AttributeValue, len(record)+1)
+	for k, v := range record {
+		revoked[k] = v
+	}
+	revoked["revokedAt"] = &types.AttributeValueMemberS{Value: "2026-01-01T00:00:00Z"}
+
+	tests := []struct {
+		name    string
+		token   string
+		item    map[string]types.AttributeValue
+		wantErr bool
+	}{
+		{name: "valid key", token: token, item: record},
+		{name: "wrong secret", token: "jmk." + keyID + ".guess", item: record, wantErr: true},
+		{name: "revoked key", token: token, item: revoked, wantErr: true},
+		{name: "unknown key", token: token, wantErr: true},
+		{name: "malformed key", token: "Bearer " + token, item: record, wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewDynamoDBStore(&mockDynamoDBClient{
+				getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+					return &dynamodb.GetItemOutput{Item: tc.item}, nil
+				},
+			}, "table")
+
+			key, err := store.Authenticate(context.Background(), tc.token)
+			if tc.wantErr {
+				if !errors.Is(err, ErrInvalidKey) {
+					t.Errorf("expected ErrInvalidKey, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if key.KeyID != keyID || key.AccountID != "user-1" || !key.HasScope(ScopeRead) || key.HasScope(ScopeUpload) {
+				t.Errorf("unexpected key: %+v", key)
+			}
+		})
+	}
+}
+
+func TestRevoke_ChecksAccountOwnsKey(t *testing.T) {
+	var captured *dynamodb.TransactWriteItemsInput
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}, "table")
+
+	if err := store.Revoke(context.Background(), "user-1", "abc"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	update := captured.TransactItems[0].Update
+	if got := update.ExpressionAttributeValues[":accountId"].(*types.AttributeValueMemberS).Value; got != "user-1" {
+		t.Errorf("expected the lookup update to be conditional on the account, got %s", got)
+	}
+
+	store = NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, transactionCanceled(2, 0)
+		},
+	}, "table")
+	if err := store.Revoke(context.Background(), "user-2", "abc"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestList_ReturnsAccountKeys(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if pk := params.ExpressionAttributeValues[":pk"].(*types.AttributeValueMemberS).Value; pk != "ACCOUNT#user-1" {
+				t.Errorf("unexpected pk %s", pk)
+			}
+			return &dynamodb.QueryOutput{Items: []map[string]types.AttributeValue{
+				{
+					"keyId":     &types.AttributeValueMemberS{Value: "abc"},
+					"accountId": &types.AttributeValueMemberS{Value: "user-1"},
+					"scopes":    &types.AttributeValueMemberL{Value: []types.AttributeValue{&types.AttributeValueMemberS{Value: "upload"}}},
+					"createdAt": &types.AttributeValueMemberS{Value: "2026-01-01T00:00:00Z"},
+				},
+			}}, nil
+		},
+	}, "table")
+
+	keys, err := store.List(context.Background(), "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0].KeyID != "abc" || !keys[0].HasScope(ScopeUpload) {
+		t.Errorf("unexpected keys: %+v", keys)
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	keyID, secret, err := ParseToken("jmk.abc.s3cret")
+	if err != nil || keyID != "abc" || secret != "s3cret" {
+		t.Errorf("unexpected parse: %q %q %v", keyID, secret, err)
+	}
+
+	for _, token := range []string{"", "abc.s3cret", "xyz.abc.s3cret", "jmk..s3cret", "jmk.abc.", "jmk.abc.s3.cret"} {
+		if _, _, err := ParseToken(token); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("expected %q to be invalid", token)
+		}
+	}
+}
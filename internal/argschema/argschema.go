@@ -0,0 +1,372 @@
+// Package argschema validates method arguments against the JSON Schema a
+// plugin registers for a method, so plugins need not repeat the same checks
+// and clients get consistent errors.
+//
+// Only the subset of JSON Schema that describes JMAP arguments is supported:
+// type, properties, required, additionalProperties, items, enum, const,
+// minimum, maximum, minLength, maxLength, minItems, maxItems and pattern.
+// Annotations such as title and description are ignored. Any other keyword,
+// such as $ref or oneOf, is rejected when the schema is compiled rather than
+// silently not enforced.
+package argschema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// annotations are keywords that describe a schema without constraining it
+var annotations = map[string]bool{
+	"$schema":     true,
+	"$id":         true,
+	"$comment":    true,
+	"title":       true,
+	"description": true,
+	"default":     true,
+	"examples":    true,
+	"deprecated":  true,
+}
+
+// types are the JSON Schema type names
+var types = []string{"object", "array", "string", "number", "integer", "boolean", "null"}
+
+// Schema is a compiled argument schema
+type Schema struct {
+	root *node
+}
+
+// node is one compiled schema object; path is its JSON Pointer within the
+// registered schema
+type node struct {
+	path                 string
+	types                []string
+	properties           map[string]*node
+	required             []string
+	additionalProperties *node
+	noAdditional         bool
+	items                *node
+	enum                 []any
+	constValue           any
+	hasConst             bool
+	minimum, maximum     *float64
+	minLength, maxLength *int
+	minItems, maxItems   *int
+	pattern              *regexp.Regexp
+}
+
+// Error describes the first argument that failed the schema. SchemaPath is
+// the JSON Pointer of the failing keyword within the schema, and Path the
+// JSON Pointer of the failing value within the arguments.
+type Error struct {
+	SchemaPath string
+	Path       string
+	Message    string
+}
+
+func (e *Error) Error() string {
+	path := e.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("argument %s %s", path, e.Message)
+}
+
+// Compile checks a schema and prepares it for validation
+func Compile(schema map[string]any) (*Schema, error) {
+	root, err := compile(schema, "")
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{root: root}, nil
+}
+
+// Validate checks args against the schema and returns the first failure,
+// or nil if they conform. Properties are checked in name order, so the
+// failure reported is stable.
+func (s *Schema) Validate(args map[string]any) *Error {
+	return s.root.validate(args, "")
+}
+
+func compile(schema map[string]any, path string) (*node, error) {
+	n := &node{path: path}
+	fail := func(keyword, format string, a ...any) error {
+		return fmt.Errorf("schema %s/%s: %s", path, escape(keyword), fmt.Sprintf(format, a...))
+	}
+
+	for keyword, value := range schema {
+		var err error
+		switch keyword {
+		case "type":
+			n.types, err = compileTypes(value)
+		case "properties":
+			props, ok := value.(map[string]any)
+			if !ok {
+				return nil, fail(keyword, "must be an object")
+			}
+			n.properties = make(map[string]*node, len(props))
+			for name, prop := range props {
+				propSchema, ok := prop.(map[string]any)
+				if !ok {
+					return nil, fail(keyword, "property %s must be a schema object", name)
+				}
+				if n.properties[name], err = compile(propSchema, path+"/properties/"+escape(name)); err != nil {
+					return nil, err
+				}
+			}
+		case "required":
+			n.required, err = stringList(value)
+		case "additionalProperties":
+			switch v := value.(type) {
+			case bool:
+				n.noAdditional = !v
+			case map[string]any:
+				n.additionalProperties, err = compile(v, path+"/additionalProperties")
+				if err != nil {
+					return nil, err
+				}
+			default:
+				return nil, fail(keyword, "must be a boolean or a schema object")
+			}
+		case "items":
+			itemSchema, ok := value.(map[string]any)
+			if !ok {
+				return nil, fail(keyword, "must be a schema object")
+			}
+			if n.items, err = compile(itemSchema, path+"/items"); err != nil {
+				return nil, err
+			}
+		case "enum":
+			list, ok := value.([]any)
+			if !ok || len(list) == 0 {
+				return nil, fail(keyword, "must be a non-empty array")
+			}
+			n.enum = list
+		case "const":
+			n.constValue, n.hasConst = value, true
+		case "minimum", "maximum":
+			f, ok := number(value)
+			if !ok {
+				return nil, fail(keyword, "must be a number")
+			}
+			if keyword == "minimum" {
+				n.minimum = &f
+			} else {
+				n.maximum = &f
+			}
+		case "minLength", "maxLength", "minItems", "maxItems":
+			f, ok := number(value)
+			if !ok || f < 0 || f != math.Trunc(f) {
+				return nil, fail(keyword, "must be a non-negative integer")
+			}
+			limit := int(f)
+			switch keyword {
+			case "minLength":
+				n.minLength = &limit
+			case "maxLength":
+				n.maxLength = &limit
+			case "minItems":
+				n.minItems = &limit
+			case "maxItems":
+				n.maxItems = &limit
+			}
+		case "pattern":
+			expr, ok := value.(string)
+			if !ok {
+				return nil, fail(keyword, "must be a string")
+			}
+			if n.pattern, err = regexp.Compile(expr); err != nil {
+				return nil, fail(keyword, "%v", err)
+			}
+		default:
+			if !annotations[keyword] {
+				return nil, fail(keyword, "unsupported keyword")
+			}
+		}
+		if err != nil {
+			return nil, fail(keyword, "%v", err)
+		}
+	}
+	return n, nil
+}
+
+// compileTypes reads a type keyword, a type name or a list of them
+func compileTypes(value any) ([]string, error) {
+	names, err := stringList(value)
+	if name, ok := value.(string); ok {
+		names, err = []string{name}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if !slices.Contains(types, name) {
+			return nil, fmt.Errorf("unknown type %q", name)
+		}
+	}
+	return names, nil
+}
+
+// stringList reads a keyword whose value is an array of strings
+func stringList(value any) ([]string, error) {
+	list, ok := value.([]any)
+	if !ok {
+		return nil, fmt.Errorf("must be an array of strings")
+	}
+	names := make([]string, 0, len(list))
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("must be an array of strings")
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (n *node) validate(value any, path string) *Error {
+	fail := func(keyword, format string, a ...any) *Error {
+		return &Error{SchemaPath: n.path + "/" + keyword, Path: path, Message: fmt.Sprintf(format, a...)}
+	}
+
+	if len(n.types) > 0 && !slices.ContainsFunc(n.types, func(t string) bool { return hasType(value, t) }) {
+		return fail("type", "must be of type %s", strings.Join(n.types, " or "))
+	}
+	if n.hasConst && !equal(value, n.constValue) {
+		return fail("const", "must be %s", encode(n.constValue))
+	}
+	if n.enum != nil && !slices.ContainsFunc(n.enum, func(v any) bool { return equal(value, v) }) {
+		return fail("enum", "must be one of %s", encode(n.enum))
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		for _, name := range n.required {
+			if _, ok := v[name]; !ok {
+				return fail("required", "is missing required property %s", name)
+			}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			childPath := path + "/" + escape(name)
+			if prop, ok := n.properties[name]; ok {
+				if err := prop.validate(v[name], childPath); err != nil {
+					return err
+				}
+			} else if n.additionalProperties != nil {
+				if err := n.additionalProperties.validate(v[name], childPath); err != nil {
+					return err
+				}
+			} else if n.noAdditional {
+				return fail("additionalProperties", "has unknown property %s", name)
+			}
+		}
+	case []any:
+		if n.minItems != nil && len(v) < *n.minItems {
+			return fail("minItems", "must have at least %d items", *n.minItems)
+		}
+		if n.maxItems != nil && len(v) > *n.maxItems {
+			return fail("maxItems", "must have at most %d items", *n.maxItems)
+		}
+		if n.items != nil {
+			for i, item := range v {
+				if err := n.items.validate(item, fmt.Sprintf("%s/%d", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(v)
+		if n.minLength != nil && length < *n.minLength {
+			return fail("minLength", "must be at least %d characters", *n.minLength)
+		}
+		if n.maxLength != nil && length > *n.maxLength {
+			return fail("maxLength", "must be at most %d characters", *n.maxLength)
+		}
+		if n.pattern != nil && !n.pattern.MatchString(v) {
+			return fail("pattern", "must match %s", n.pattern)
+		}
+	default:
+		if f, ok := number(v); ok {
+			if n.minimum != nil && f < *n.minimum {
+				return fail("minimum", "must be at least %v", *n.minimum)
+			}
+			if n.maximum != nil && f > *n.maximum {
+				return fail("maximum", "must be at most %v", *n.maximum)
+			}
+		}
+	}
+	return nil
+}
+
+// hasType reports whether a decoded JSON value is of a JSON Schema type
+func hasType(value any, name string) bool {
+	switch name {
+	case "object":
+		_, ok := value.(map[string]any)
+		return ok
+	case "array":
+		_, ok := value.([]any)
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	case "number":
+		_, ok := number(value)
+		return ok
+	case "integer":
+		f, ok := number(value)
+		return ok && f == math.Trunc(f)
+	}
+	return false
+}
+
+// number converts the numeric types JSON, YAML and DynamoDB decoding
+// produce to float64
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// equal compares two values as JSON, so 1 and 1.0 are equal whichever
+// decoder produced them
+func equal(a, b any) bool {
+	return encode(a) == encode(b)
+}
+
+func encode(value any) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+// escape escapes a name for use as a JSON Pointer token (RFC 6901)
+func escape(name string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
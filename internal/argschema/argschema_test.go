@@ -0,0 +1,139 @@
+package argschema
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// testSchema is an Email/get style argument schema
+const testSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"type": "object",
+	"required": ["accountId"],
+	"additionalProperties": false,
+	"properties": {
+		"accountId": {"type": "string", "minLength": 1},
+		"ids": {"type": ["array", "null"], "maxItems": 3, "items": {"type": "string", "pattern": "^M"}},
+		"properties": {"type": "array", "items": {"enum": ["id", "subject"]}},
+		"limit": {"type": "integer", "minimum": 1, "maximum": 50},
+		"version": {"const": 2}
+	}
+}`
+
+func mustCompile(t *testing.T, schema string) *Schema {
+	t.Helper()
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(schema), &raw); err != nil {
+		t.Fatalf("invalid test schema: %v", err)
+	}
+	compiled, err := Compile(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return compiled
+}
+
+func decode(t *testing.T, args string) map[string]any {
+	t.Helper()
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(args), &decoded); err != nil {
+		t.Fatalf("invalid test args: %v", err)
+	}
+	return decoded
+}
+
+func TestValidate_Valid(t *testing.T) {
+	schema := mustCompile(t, testSchema)
+
+	for _, args := range []string{
+		`{"accountId":"a1"}`,
+		`{"accountId":"a1","ids":null,"limit":50,"version":2.0}`,
+		`{"accountId":"a1","ids":["M1","M2"],"properties":["id","subject"]}`,
+	} {
+		if err := schema.Validate(decode(t, args)); err != nil {
+			t.Errorf("Validate(%s) = %v", args, err)
+		}
+	}
+}
+
+func TestValidate_Failures(t *testing.T) {
+	schema := mustCompile(t, testSchema)
+
+	tests := []struct {
+		args       string
+		schemaPath string
+		path       string
+	}{
+		{`{}`, "/required", ""},
+		{`{"accountId":""}`, "/properties/accountId/minLength", "/accountId"},
+		{`{"accountId":"a1","extra":1}`, "/additionalProperties", ""},
+		{`{"accountId":"a1","ids":"M1"}`, "/properties/ids/type", "/ids"},
+		{`{"accountId":"a1","ids":["M1","M2","M3","M4"]}`, "/properties/ids/maxItems", "/ids"},
+		{`{"accountId":"a1","ids":["M1","X2"]}`, "/properties/ids/items/pattern", "/ids/1"},
+		{`{"accountId":"a1","properties":["id","body"]}`, "/properties/properties/items/enum", "/properties/1"},
+		{`{"accountId":"a1","limit":1.5}`, "/properties/limit/type", "/limit"},
+		{`{"accountId":"a1","limit":0}`, "/properties/limit/minimum", "/limit"},
+		{`{"accountId":"a1","version":1}`, "/properties/version/const", "/version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.args, func(t *testing.T) {
+			err := schema.Validate(decode(t, tt.args))
+			if err == nil {
+				t.Fatal("expected a failure")
+			}
+			if err.SchemaPath != tt.schemaPath || err.Path != tt.path {
+				t.Errorf("got schema path %q and path %q, want %q and %q", err.SchemaPath, err.Path, tt.schemaPath, tt.path)
+			}
+		})
+	}
+}
+
+func TestValidate_AdditionalPropertiesSchema(t *testing.T) {
+	schema := mustCompile(t, `{"additionalProperties": {"type": "boolean"}}`)
+
+	err := schema.Validate(map[string]any{"a/b": true, "c": "yes"})
+	if err == nil || err.SchemaPath != "/additionalProperties/type" || err.Path != "/c" {
+		t.Errorf("unexpected failure %+v", err)
+	}
+	if !strings.Contains(err.Error(), "argument /c must be of type boolean") {
+		t.Errorf("unexpected message %q", err.Error())
+	}
+}
+
+func TestCompile_YAMLNumbers(t *testing.T) {
+	// YAML decodes integers as int rather than float64
+	schema, err := Compile(map[string]any{"properties": map[string]any{
+		"limit": map[string]any{"maximum": 10, "enum": []any{1, 10}},
+	}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := schema.Validate(map[string]any{"limit": float64(10)}); err != nil {
+		t.Errorf("unexpected failure %v", err)
+	}
+}
+
+func TestCompile_Invalid(t *testing.T) {
+	tests := []struct {
+		schema string
+		want   string
+	}{
+		{`{"$ref": "#/defs/id"}`, "schema /$ref: unsupported keyword"},
+		{`{"type": "decimal"}`, "unknown type"},
+		{`{"required": "accountId"}`, "schema /required"},
+		{`{"properties": {"ids": {"oneOf": []}}}`, "schema /properties/ids/oneOf"},
+		{`{"pattern": "("}`, "schema /pattern"},
+		{`{"maxLength": -1}`, "non-negative integer"},
+		{`{"enum": []}`, "non-empty array"},
+	}
+	for _, tt := range tests {
+		var raw map[string]any
+		if err := json.Unmarshal([]byte(tt.schema), &raw); err != nil {
+			t.Fatalf("invalid test schema: %v", err)
+		}
+		if _, err := Compile(raw); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Compile(%s) = %v, want an error containing %q", tt.schema, err, tt.want)
+		}
+	}
+}
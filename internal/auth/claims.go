@@ -0,0 +1,108 @@
+// Package auth reads the caller's identity from the API Gateway authorizer
+// context, for the authorizers a deployment may use in front of the user
+// endpoints: a Cognito user pool, a JWT authorizer for another OIDC provider
+// such as Auth0 or Entra ID, or a Lambda authorizer.
+package auth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultAccountIDClaim is the claim holding a Cognito user's ID. The user
+// endpoints read the account ID from the claim named by ACCOUNT_ID_CLAIM,
+// which every deployment must set.
+const DefaultAccountIDClaim = "sub"
+
+// AccountIDFromAuthorizer returns the named claim from an authorizer context.
+// Claims are read from, in order:
+//   - authorizer.claims, set by Cognito user pool authorizers and by HTTP API
+//     JWT authorizers with payload format 1.0
+//   - authorizer.jwt.claims, the HTTP API JWT authorizer layout in payload
+//     format 2.0
+//   - authorizer itself, where a Lambda authorizer puts its context fields
+//
+// API Gateway sets the authorizer context, so clients cannot spoof it.
+func AccountIDFromAuthorizer(authorizer map[string]any, claim string) (string, error) {
+	if authorizer == nil {
+		return "", fmt.Errorf("no authorizer context")
+	}
+
+	value, ok := claimsFromAuthorizer(authorizer)[claim].(string)
+	if !ok || value == "" {
+		return "", fmt.Errorf("%s claim not found or empty", claim)
+	}
+	return value, nil
+}
+
+// GroupsClaim is the claim listing a Cognito user's groups
+const GroupsClaim = "cognito:groups"
+
+// GroupsFromAuthorizer returns the caller's Cognito groups, read from the
+// same places as AccountIDFromAuthorizer. REST API authorizers pass the
+// claim as a comma-separated string, HTTP API authorizers as "[a b]", and
+// some as a list; all are accepted.
+func GroupsFromAuthorizer(authorizer map[string]any) []string {
+	if authorizer == nil {
+		return nil
+	}
+
+	var groups []string
+	switch value := claimsFromAuthorizer(authorizer)[GroupsClaim].(type) {
+	case string:
+		value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+		groups = strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == ' ' })
+	case []any:
+		for _, group := range value {
+			if name, ok := group.(string); ok && name != "" {
+				groups = append(groups, name)
+			}
+		}
+	}
+	return groups
+}
+
+// HasGroup reports whether the caller is in the named Cognito group
+func HasGroup(authorizer map[string]any, group string) bool {
+	if group == "" {
+		return false
+	}
+	for _, member := range GroupsFromAuthorizer(authorizer) {
+		if member == group {
+			return true
+		}
+	}
+	return false
+}
+
+// claimsFromAuthorizer returns the map holding the caller's claims
+func claimsFromAuthorizer(authorizer map[string]any) map[string]any {
+	if claims, ok := authorizer["claims"].(map[string]any); ok {
+		return claims
+	}
+	if jwt, isJWT := authorizer["jwt"].(map[string]any); isJWT {
+		if claims, ok := jwt["claims"].(map[string]any); ok {
+			return claims
+		}
+	}
+	// Lambda authorizer context fields are top-level values
+	return authorizer
+}
+
+// Context fields set by the API key authorizer on key-authenticated routes
+const (
+	APIKeyIDField        = "apiKeyId"
+	APIKeyAccountIDField = "accountId"
+	APIKeyScopesField    = "scopes"
+)
+
+// APIKeyFromAuthorizer returns the account and key ID set by the API key
+// authorizer. ok is false if the request was not authenticated with a key.
+func APIKeyFromAuthorizer(authorizer map[string]any) (accountID, keyID string, ok bool) {
+	keyID, _ = authorizer[APIKeyIDField].(string)
+	accountID, _ = authorizer[APIKeyAccountIDField].(string)
+	if keyID == "" || accountID == "" {
+		return "", "", false
+	}
+	return accountID, keyID, true
+}
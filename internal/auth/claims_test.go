@@ -0,0 +1,142 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAccountIDFromAuthorizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]any
+		claim      string
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "cognito claims",
+			authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+			claim:      "sub",
+			want:       "user-123",
+		},
+		{
+			name:       "http api jwt claims",
+			authorizer: map[string]any{"jwt": map[string]any{"claims": map[string]any{"oid": "entra-object-id"}}},
+			claim:      "oid",
+			want:       "entra-object-id",
+		},
+		{
+			name:       "lambda authorizer context",
+			authorizer: map[string]any{"principalId": "auth0|abc", "accountId": "user-456"},
+			claim:      "accountId",
+			want:       "user-456",
+		},
+		{
+			name:       "custom claim name",
+			authorizer: map[string]any{"claims": map[string]any{"sub": "auth0|abc", "https://example.com/account": "user-789"}},
+			claim:      "https://example.com/account",
+			want:       "user-789",
+		},
+		{
+			name:       "claims present but claim missing does not fall back",
+			authorizer: map[string]any{"claims": map[string]any{"email": "a@example.com"}, "sub": "spoofed"},
+			claim:      "sub",
+			wantErr:    true,
+		},
+		{
+			name:       "empty claim",
+			authorizer: map[string]any{"claims": map[string]any{"sub": ""}},
+			claim:      "sub",
+			wantErr:    true,
+		},
+		{
+			name:    "no authorizer",
+			claim:   "sub",
+			wantErr: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := AccountIDFromAuthorizer(tc.authorizer, tc.claim)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAPIKeyFromAuthorizer(t *testing.T) {
+	accountID, keyID, ok := APIKeyFromAuthorizer(map[string]any{"apiKeyId": "abc", "accountId": "user-1", "scopes": "read"})
+	if !ok || accountID != "user-1" || keyID != "abc" {
+		t.Errorf("unexpected result %q %q %v", accountID, keyID, ok)
+	}
+
+	if _, _, ok := APIKeyFromAuthorizer(map[string]any{"claims": map[string]any{"sub": "user-1"}}); ok {
+		t.Error("expected Cognito claims not to be treated as an API key")
+	}
+	if _, _, ok := APIKeyFromAuthorizer(nil); ok {
+		t.Error("expected no API key without an authorizer context")
+	}
+}
+
+func TestGroupsFromAuthorizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]any
+		want       []string
+	}{
+		{
+			name:       "REST API comma-separated",
+			authorizer: map[string]any{"claims": map[string]any{"cognito:groups": "admins,users"}},
+			want:       []string{"admins", "users"},
+		},
+		{
+			name:       "HTTP API bracketed",
+			authorizer: map[string]any{"jwt": map[string]any{"claims": map[string]any{"cognito:groups": "[admins users]"}}},
+			want:       []string{"admins", "users"},
+		},
+		{
+			name:       "list",
+			authorizer: map[string]any{"claims": map[string]any{"cognito:groups": []any{"admins"}}},
+			want:       []string{"admins"},
+		},
+		{
+			name:       "no groups",
+			authorizer: map[string]any{"claims": map[string]any{"sub": "user-1"}},
+		},
+		{
+			name: "no authorizer",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := GroupsFromAuthorizer(tc.authorizer); !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestHasGroup(t *testing.T) {
+	authorizer := map[string]any{"claims": map[string]any{"cognito:groups": "admins-readonly,users"}}
+	if HasGroup(authorizer, "admins") {
+		t.Error("expected group names to match exactly")
+	}
+	if !HasGroup(authorizer, "users") {
+		t.Error("expected users group to match")
+	}
+	if HasGroup(authorizer, "") {
+		t.Error("expected an empty group never to match")
+	}
+}
@@ -0,0 +1,201 @@
+// Package binding restricts IAM principals to the accounts they serve. A
+// principal with no bindings may act on any account, as registry trust
+// alone allows; once a principal has a binding it may only act on its bound
+// accounts.
+package binding
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// PrefixPrincipal is the partition key prefix for a principal's bindings.
+// Each binding is PRINCIPAL#{roleArn} / ACCOUNT#{accountId}.
+const PrefixPrincipal = "PRINCIPAL#"
+
+var (
+	// ErrBindingNotFound is returned when deleting a binding that does not exist
+	ErrBindingNotFound = errors.New("binding not found")
+	// ErrAccountNotFound is returned when binding a principal to a missing account
+	ErrAccountNotFound = errors.New("account not found")
+)
+
+// Binding allows a principal to act on an account
+type Binding struct {
+	PrincipalARN string `dynamodbav:"principalArn" json:"principalArn"`
+	AccountID    string `dynamodbav:"accountId" json:"accountId"`
+	CreatedAt    string `dynamodbav:"createdAt" json:"createdAt"`
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed for bindings
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// DynamoDBStore stores principal bindings in DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// principalPK returns the partition key for a principal's bindings. Assumed
+// role sessions are bound through their role.
+func principalPK(principalARN string) string {
+	return PrefixPrincipal + plugin.NormalizeARN(principalARN)
+}
+
+// bindingKey builds the primary key of a binding record
+func bindingKey(principalARN, accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: principalPK(principalARN)},
+		"sk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+	}
+}
+
+// IsAllowed reports whether a principal may act on an account: either it is
+// bound to the account, or it has no bindings at all
+func (d *DynamoDBStore) IsAllowed(ctx context.Context, principalARN, accountID string) (bool, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       bindingKey(principalARN, accountID),
+	})
+	if err != nil {
+		return false, err
+	}
+	if result.Item != nil {
+		return true, nil
+	}
+
+	// Not bound to this account; allowed only if not bound to any
+	output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+		TableName:              aws.String(d.tableName),
+		KeyConditionExpression: aws.String("pk = :pk"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pk": &types.AttributeValueMemberS{Value: principalPK(principalARN)},
+		},
+		Limit: aws.Int32(1),
+	})
+	if err != nil {
+		return false, err
+	}
+	return len(output.Items) == 0, nil
+}
+
+// Put binds a principal to an account. Returns ErrAccountNotFound if the
+// account does not exist.
+func (d *DynamoDBStore) Put(ctx context.Context, principalARN, accountID string) (*Binding, error) {
+	record := Binding{
+		PrincipalARN: plugin.NormalizeARN(principalARN),
+		AccountID:    accountID,
+		CreatedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal binding: %w", err)
+	}
+	for k, v := range bindingKey(principalARN, accountID) {
+		item[k] = v
+	}
+
+	_, err = d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []types.TransactWriteItem{
+			{
+				ConditionCheck: &types.ConditionCheck{
+					TableName: aws.String(d.tableName),
+					Key: map[string]types.AttributeValue{
+						"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+						"sk": &types.AttributeValueMemberS{Value: dbclient.SKMeta},
+					},
+					ConditionExpression: aws.String("attribute_exists(pk)"),
+				},
+			},
+			{
+				Put: &types.Put{
+					TableName: aws.String(d.tableName),
+					Item:      item,
+				},
+			},
+		},
+	})
+	if err != nil {
+		if dbclient.GetConditionalCheckFailureIndex(err) == 0 {
+			return nil, ErrAccountNotFound
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// Delete removes a principal's binding to an account. Removing a principal's
+// last binding lifts its restriction. Returns ErrBindingNotFound if the
+// binding does not exist.
+func (d *DynamoDBStore) Delete(ctx context.Context, principalARN, accountID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:           aws.String(d.tableName),
+		Key:                 bindingKey(principalARN, accountID),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrBindingNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// List returns the accounts a principal is bound to, ordered by account ID
+func (d *DynamoDBStore) List(ctx context.Context, principalARN string) ([]string, error) {
+	accountIDs := []string{}
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			KeyConditionExpression: aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk": &types.AttributeValueMemberS{Value: principalPK(principalARN)},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, item := range output.Items {
+			sk, ok := item["sk"].(*types.AttributeValueMemberS)
+			if !ok {
+				return nil, fmt.Errorf("binding record missing sk")
+			}
+			accountIDs = append(accountIDs, strings.TrimPrefix(sk.Value, dbclient.PrefixAccount))
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return accountIDs, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
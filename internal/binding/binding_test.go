@@ -0,0 +1,176 @@
+package binding
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBClient struct {
+	getItemFunc  func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	queryFunc    func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	deleteFunc   func(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	transactFunc func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getItemFunc != nil {
+		return m.getItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	if m.deleteFunc != nil {
+		return m.deleteFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if m.transactFunc != nil {
+		return m.transactFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+const (
+	testRoleARN    = "arn:aws:iam::123456789012:role/Ingest"
+	testSessionARN = "arn:aws:sts::123456789012:assumed-role/Ingest/session-1"
+)
+
+// bindingsClient serves a fixed set of account bindings for testRoleARN
+func bindingsClient(t *testing.T, accountIDs ...string) *mockDynamoDBClient {
+	return &mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			if pk := params.Key["pk"].(*types.AttributeValueMemberS).Value; pk != "PRINCIPAL#"+testRoleARN {
+				t.Errorf("expected bindings keyed by role ARN, got %s", pk)
+			}
+			sk := params.Key["sk"].(*types.AttributeValueMemberS).Value
+			for _, id := range accountIDs {
+				if sk == "ACCOUNT#"+id {
+					return &dynamodb.GetItemOutput{Item: params.Key}, nil
+				}
+			}
+			return &dynamodb.GetItemOutput{}, nil
+		},
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			var items []map[string]types.AttributeValue
+			for _, id := range accountIDs {
+				items = append(items, map[string]types.AttributeValue{
+					"sk": &types.AttributeValueMemberS{Value: "ACCOUNT#" + id},
+				})
+			}
+			return &dynamodb.QueryOutput{Items: items}, nil
+		},
+	}
+}
+
+func TestIsAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		bindings []string
+		account  string
+		want     bool
+	}{
+		{name: "unbound principal may act on any account", account: "user-1", want: true},
+		{name: "bound account", bindings: []string{"user-1", "user-2"}, account: "user-2", want: true},
+		{name: "account outside bindings", bindings: []string{"user-1"}, account: "user-2", want: false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			store := NewDynamoDBStore(bindingsClient(t, tc.bindings...), "table")
+
+			got, err := store.IsAllowed(context.Background(), testSessionARN, tc.account)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestIsAllowed_Error(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		getItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return nil, errors.New("throttled")
+		},
+	}, "table")
+
+	if _, err := store.IsAllowed(context.Background(), testRoleARN, "user-1"); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestPut_ChecksAccountExists(t *testing.T) {
+	var captured *dynamodb.TransactWriteItemsInput
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			captured = params
+			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+	}, "table")
+
+	binding, err := store.Put(context.Background(), testSessionARN, "user-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if binding.PrincipalARN != testRoleARN || binding.AccountID != "user-1" {
+		t.Errorf("unexpected binding: %+v", binding)
+	}
+	if sk := captured.TransactItems[0].ConditionCheck.Key["sk"].(*types.AttributeValueMemberS).Value; sk != "META#" {
+		t.Errorf("expected account existence check, got %s", sk)
+	}
+	item := captured.TransactItems[1].Put.Item
+	if pk := item["pk"].(*types.AttributeValueMemberS).Value; pk != "PRINCIPAL#"+testRoleARN {
+		t.Errorf("unexpected pk %s", pk)
+	}
+
+	reasons := []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("None")}}
+	store = NewDynamoDBStore(&mockDynamoDBClient{
+		transactFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{CancellationReasons: reasons}
+		},
+	}, "table")
+	if _, err := store.Put(context.Background(), testRoleARN, "missing"); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestDelete_Missing(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{
+		deleteFunc: func(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}, "table")
+
+	if err := store.Delete(context.Background(), testRoleARN, "user-1"); !errors.Is(err, ErrBindingNotFound) {
+		t.Errorf("expected ErrBindingNotFound, got %v", err)
+	}
+}
+
+func TestList_ReturnsAccountIDs(t *testing.T) {
+	store := NewDynamoDBStore(bindingsClient(t, "user-1", "user-2"), "table")
+
+	accountIDs, err := store.List(context.Background(), testRoleARN)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(accountIDs) != 2 || accountIDs[0] != "user-1" || accountIDs[1] != "user-2" {
+		t.Errorf("unexpected accounts: %v", accountIDs)
+	}
+}
@@ -5,27 +5,71 @@ import (
 	"fmt"
 	"strings"
 	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobindex"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobname"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobtag"
 )
 
 // AllocateRequest is the Blob/allocate method request
 type AllocateRequest struct {
-	AccountID   string `json:"accountId"`
-	Type        string `json:"type"`        // MIME type
-	Size        int64  `json:"size"`        // Size in bytes
-	SizeUnknown bool   `json:"sizeUnknown"` // True when size is not declared (IAM path)
-	Multipart   bool   `json:"multipart"`   // True for multipart upload (IAM-only)
-	IsIAMAuth   bool   `json:"-"`           // True when request is IAM-authenticated
+	AccountID   string            `json:"accountId"`
+	Type        string            `json:"type"`        // MIME type
+	Size        int64             `json:"size"`        // Size in bytes
+	SizeUnknown bool              `json:"sizeUnknown"` // True when size is not declared (IAM path)
+	Multipart   bool              `json:"multipart"`   // True for multipart upload (IAM-only)
+	Name        string            `json:"name"`        // Optional original filename
+	Tags        map[string]string `json:"tags"`        // Optional approved extra S3 tags
+	IsIAMAuth   bool              `json:"-"`           // True when request is IAM-authenticated
+	MaxSize     int64             `json:"-"`           // Account- or capability-specific size cap; zero uses MaxSizeUploadPut, or no cap for multipart
+	// IndexedMetadata is an optional key and value to look the blob up by
+	IndexedMetadata *blobmeta.IndexedMetadata `json:"indexedMetadata,omitempty"`
+	// ChecksumSHA256 is the optional base64 SHA-256 of the content, or for a
+	// multipart upload the composite checksum of its parts
+	ChecksumSHA256 string `json:"checksumSha256,omitempty"`
 }
 
 // AllocateResponse is the Blob/allocate method response
 type AllocateResponse struct {
-	AccountID  string    `json:"accountId"`
-	BlobID     string    `json:"blobId"`
-	Type       string    `json:"type"`
-	Size       int64     `json:"size"`
-	URL        string    `json:"url"`
-	URLExpires time.Time `json:"urlExpires"`
-	Parts      []PartURL `json:"parts,omitempty"` // Non-nil for multipart uploads
+	AccountID  string            `json:"accountId"`
+	BlobID     string            `json:"blobId"`
+	Type       string            `json:"type"`
+	Size       int64             `json:"size"`
+	Name       string            `json:"name,omitempty"`
+	Tags       map[string]string `json:"tags,omitempty"`
+	URL        string            `json:"url"`
+	URLExpires time.Time         `json:"urlExpires"`
+	Parts      []PartURL         `json:"parts,omitempty"` // Non-nil for multipart uploads
+	// IndexedMetadata echoes the request's indexed metadata
+	IndexedMetadata *blobmeta.IndexedMetadata `json:"indexedMetadata,omitempty"`
+	// ChecksumSHA256 echoes the request's checksum, which the upload must
+	// send as x-amz-checksum-sha256 (on each part, its own checksum)
+	ChecksumSHA256 string `json:"checksumSha256,omitempty"`
+}
+
+// PartURL represents a presigned URL for a single upload part
+type PartURL struct {
+	PartNumber int32  `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+// CompletedPart represents a part that has been uploaded by the client
+type CompletedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	// ChecksumSHA256 is the part's base64 SHA-256, required when the
+	// allocation declared a checksum
+	ChecksumSHA256 string `json:"checksumSha256,omitempty"`
+}
+
+// UploadedPart represents a part of a multipart upload the storage backend
+// has received
+type UploadedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+	Size       int64  `json:"size"`
 }
 
 // AllocationError represents a JMAP error from Blob/allocate
@@ -39,20 +83,22 @@ func (e *AllocationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Type, e.Message)
 }
 
-// Storage handles S3 operations for blob allocation
+// Storage presigns blob uploads. A non-empty checksum is signed into the
+// URL, so the storage rejects content that does not match it.
 type Storage interface {
-	GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool) (string, time.Time, error)
+	GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error)
 }
 
-// MultipartStorage handles S3 multipart upload operations
+// MultipartStorage handles multipart upload operations. An upload created
+// with checksums needs each part's checksum to complete.
 type MultipartStorage interface {
-	CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string) (string, error)
+	CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error)
 	GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]PartURL, time.Time, error)
 }
 
 // DB handles DynamoDB operations for blob allocation
 type DB interface {
-	AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool) error
+	AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool, name string, tags map[string]string, indexed *blobmeta.IndexedMetadata, checksum string, maxSize int64) error
 }
 
 // UUIDGenerator generates unique IDs
@@ -73,6 +119,8 @@ type Handler struct {
 	MaxPendingAllocs    int
 	URLExpirySecs       int64
 	MultipartPartCount  int
+	// TagKeys are the extra S3 tag keys clients may set; none when empty
+	TagKeys blobtag.Keys
 }
 
 // Allocate processes a Blob/allocate request
@@ -82,15 +130,24 @@ func (h *Handler) Allocate(ctx context.Context, req AllocateRequest) (*AllocateR
 		return nil, &AllocationError{Type: "invalidArguments", Message: "multipart requires unknown size"}
 	}
 
-	// Validate size (skip when size is unknown, e.g. IAM path)
+	// A single PUT is also held to MaxSizeUploadPut; multipart uploads are
+	// only held to the account or capability limit, if any
+	maxSize := req.MaxSize
+	if !req.Multipart && (maxSize <= 0 || h.MaxSizeUploadPut < maxSize) {
+		maxSize = h.MaxSizeUploadPut
+	}
+	req.MaxSize = maxSize
+
+	// Validate size. When it is unknown, e.g. on the IAM path, the limit is
+	// recorded on the allocation and enforced when the upload completes.
 	if !req.SizeUnknown {
 		if req.Size <= 0 {
 			return nil, &AllocationError{Type: "invalidArguments", Message: "size must be greater than 0"}
 		}
-		if req.Size > h.MaxSizeUploadPut {
+		if req.Size > maxSize {
 			return nil, &AllocationError{
 				Type:    "tooLarge",
-				Message: fmt.Sprintf("size %d exceeds maximum %d bytes", req.Size, h.MaxSizeUploadPut),
+				Message: fmt.Sprintf("size %d exceeds maximum %d bytes", req.Size, maxSize),
 			}
 		}
 	}
@@ -100,6 +157,44 @@ func (h *Handler) Allocate(ctx context.Context, req AllocateRequest) (*AllocateR
 		return nil, &AllocationError{Type: "invalidProperties", Message: "type must be a valid media type", Properties: []string{"type"}}
 	}
 
+	// Validate the filename, dropping any directory part
+	name, err := blobname.Clean(req.Name)
+	if err != nil {
+		return nil, &AllocationError{Type: "invalidProperties", Message: "name must be at most 255 bytes of text without control characters", Properties: []string{"name"}}
+	}
+	req.Name = name
+
+	// Validate any extra tags against the approved keys
+	tags, err := h.TagKeys.Validate(req.Tags)
+	if err != nil {
+		return nil, &AllocationError{Type: "invalidProperties", Message: err.Error(), Properties: []string{"tags"}}
+	}
+	req.Tags = tags
+
+	// Validate the indexed metadata, which becomes the blob's gsi2 keys
+	if req.IndexedMetadata != nil {
+		if err := blobindex.Validate(*req.IndexedMetadata); err != nil {
+			return nil, &AllocationError{Type: "invalidProperties", Message: "indexedMetadata " + err.Error(), Properties: []string{"indexedMetadata"}}
+		}
+	}
+
+	// Validate the checksum, which for a multipart upload is the composite
+	// of its parts' checksums
+	if req.ChecksumSHA256 != "" {
+		valid := blobchecksum.Valid(req.ChecksumSHA256)
+		if req.Multipart {
+			_, err := blobchecksum.ParseComposite(req.ChecksumSHA256)
+			valid = err == nil
+		}
+		if !valid {
+			message := "checksumSha256 must be a base64 SHA-256 digest"
+			if req.Multipart {
+				message = "checksumSha256 must be the composite checksum of the parts, a base64 SHA-256 digest followed by -{partCount}"
+			}
+			return nil, &AllocationError{Type: "invalidProperties", Message: message, Properties: []string{"checksumSha256"}}
+		}
+	}
+
 	// Generate blobId
 	blobID := h.UUIDGen.Generate()
 	s3Key := fmt.Sprintf("%s/%s", req.AccountID, blobID)
@@ -113,12 +208,16 @@ func (h *Handler) Allocate(ctx context.Context, req AllocateRequest) (*AllocateR
 
 // allocateSinglePut handles the standard single-PUT upload flow
 func (h *Handler) allocateSinglePut(ctx context.Context, req AllocateRequest, blobID, s3Key string) (*AllocateResponse, error) {
-	url, urlExpires, err := h.Storage.GeneratePresignedPutURL(ctx, req.AccountID, blobID, req.Size, req.Type, h.URLExpirySecs, req.SizeUnknown)
+	url, urlExpires, err := h.Storage.GeneratePresignedPutURL(ctx, req.AccountID, blobID, req.Size, req.Type, h.URLExpirySecs, req.SizeUnknown, req.ChecksumSHA256)
 	if err != nil {
 		return nil, &AllocationError{Type: "serverFail", Message: "failed to generate upload URL"}
 	}
 
-	if err := h.DB.AllocateBlob(ctx, req.AccountID, blobID, req.Size, req.Type, urlExpires, h.MaxPendingAllocs, s3Key, req.SizeUnknown, "", req.IsIAMAuth); err != nil {
+	var maxSize int64
+	if req.SizeUnknown {
+		maxSize = req.MaxSize
+	}
+	if err := h.DB.AllocateBlob(ctx, req.AccountID, blobID, req.Size, req.Type, urlExpires, h.MaxPendingAllocs, s3Key, req.SizeUnknown, "", req.IsIAMAuth, req.Name, req.Tags, req.IndexedMetadata, req.ChecksumSHA256, maxSize); err != nil {
 		if allocErr, ok := err.(*AllocationError); ok {
 			return nil, allocErr
 		}
@@ -130,15 +229,20 @@ func (h *Handler) allocateSinglePut(ctx context.Context, req AllocateRequest, bl
 		BlobID:     blobID,
 		Type:       req.Type,
 		Size:       req.Size,
+		Name:       req.Name,
+		Tags:       req.Tags,
 		URL:        url,
 		URLExpires: urlExpires,
+
+		IndexedMetadata: req.IndexedMetadata,
+		ChecksumSHA256:  req.ChecksumSHA256,
 	}, nil
 }
 
 // allocateMultipart handles the multipart upload flow
 func (h *Handler) allocateMultipart(ctx context.Context, req AllocateRequest, blobID, s3Key string) (*AllocateResponse, error) {
 	// Create multipart upload in S3
-	uploadID, err := h.MultipartStorage.CreateMultipartUpload(ctx, req.AccountID, blobID, req.Type)
+	uploadID, err := h.MultipartStorage.CreateMultipartUpload(ctx, req.AccountID, blobID, req.Type, req.ChecksumSHA256 != "")
 	if err != nil {
 		return nil, &AllocationError{Type: "serverFail", Message: "failed to create multipart upload"}
 	}
@@ -155,7 +259,7 @@ func (h *Handler) allocateMultipart(ctx context.Context, req AllocateRequest, bl
 	}
 
 	// Store allocation with upload ID
-	if err := h.DB.AllocateBlob(ctx, req.AccountID, blobID, 0, req.Type, urlExpires, h.MaxPendingAllocs, s3Key, true, uploadID, req.IsIAMAuth); err != nil {
+	if err := h.DB.AllocateBlob(ctx, req.AccountID, blobID, 0, req.Type, urlExpires, h.MaxPendingAllocs, s3Key, true, uploadID, req.IsIAMAuth, req.Name, req.Tags, req.IndexedMetadata, req.ChecksumSHA256, req.MaxSize); err != nil {
 		if allocErr, ok := err.(*AllocationError); ok {
 			return nil, allocErr
 		}
@@ -167,8 +271,13 @@ func (h *Handler) allocateMultipart(ctx context.Context, req AllocateRequest, bl
 		BlobID:     blobID,
 		Type:       req.Type,
 		Size:       0,
+		Name:       req.Name,
+		Tags:       req.Tags,
 		URLExpires: urlExpires,
 		Parts:      parts,
+
+		IndexedMetadata: req.IndexedMetadata,
+		ChecksumSHA256:  req.ChecksumSHA256,
 	}, nil
 }
 
@@ -3,8 +3,13 @@ package bloballocate
 import (
 	"context"
 	"errors"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobtag"
 )
 
 // MockStorage implements Storage for testing
@@ -21,9 +26,10 @@ type GenerateURLInput struct {
 	Size        int64
 	ContentType string
 	SizeUnknown bool
+	Checksum    string
 }
 
-func (m *MockStorage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool) (string, time.Time, error) {
+func (m *MockStorage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error) {
 	m.GeneratePresignedURLCalled = true
 	m.GeneratePresignedURLInput = GenerateURLInput{
 		AccountID:   accountID,
@@ -31,6 +37,7 @@ func (m *MockStorage) GeneratePresignedPutURL(ctx context.Context, accountID, bl
 		Size:        size,
 		ContentType: contentType,
 		SizeUnknown: sizeUnknown,
+		Checksum:    checksum,
 	}
 	if m.GeneratePresignedURLErr != nil {
 		return "", time.Time{}, m.GeneratePresignedURLErr
@@ -55,9 +62,14 @@ type AllocateInput struct {
 	SizeUnknown  bool
 	UploadID     string
 	IsIAMAuth    bool
+	Name         string
+	Tags         map[string]string
+	Indexed      *blobmeta.IndexedMetadata
+	Checksum     string
+	MaxSize      int64
 }
 
-func (m *MockDB) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool) error {
+func (m *MockDB) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool, name string, tags map[string]string, indexed *blobmeta.IndexedMetadata, checksum string, maxSize int64) error {
 	m.AllocateCalled = true
 	m.AllocateInput = AllocateInput{
 		AccountID:    accountID,
@@ -68,6 +80,11 @@ func (m *MockDB) AllocateBlob(ctx context.Context, accountID, blobID string, siz
 		SizeUnknown:  sizeUnknown,
 		UploadID:     uploadID,
 		IsIAMAuth:    isIAMAuth,
+		Name:         name,
+		Tags:         tags,
+		Indexed:      indexed,
+		Checksum:     checksum,
+		MaxSize:      maxSize,
 	}
 	if m.AllocateErrType != "" {
 		return &AllocationError{Type: m.AllocateErrType, Message: "test error"}
@@ -168,6 +185,30 @@ func TestAllocate_TooLarge(t *testing.T) {
 	}
 }
 
+func TestAllocate_TooLargeForAccount(t *testing.T) {
+	handler := &Handler{
+		MaxSizeUploadPut: 1000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+
+	req := AllocateRequest{
+		AccountID: "account-123",
+		Type:      "application/pdf",
+		Size:      600,
+		MaxSize:   500, // account type limit below MaxSizeUploadPut
+	}
+
+	_, err := handler.Allocate(context.Background(), req)
+	allocErr, ok := err.(*AllocationError)
+	if !ok {
+		t.Fatalf("expected AllocationError, got %T", err)
+	}
+	if allocErr.Type != "tooLarge" || !strings.Contains(allocErr.Message, "maximum 500") {
+		t.Errorf("expected tooLarge against the account limit, got %s: %s", allocErr.Type, allocErr.Message)
+	}
+}
+
 func TestAllocate_InvalidType(t *testing.T) {
 	handler := &Handler{
 		MaxSizeUploadPut: 250000000,
@@ -471,11 +512,49 @@ func TestAllocate_SizeUnknown_PassesFlagToDB(t *testing.T) {
 	if !mockDB.AllocateInput.SizeUnknown {
 		t.Error("expected SizeUnknown=true to be passed to DB.AllocateBlob")
 	}
+	if mockDB.AllocateInput.MaxSize != 250000000 {
+		t.Errorf("expected MaxSizeUploadPut recorded as the limit, got %d", mockDB.AllocateInput.MaxSize)
+	}
 	if !mockStorage.GeneratePresignedURLInput.SizeUnknown {
 		t.Error("expected SizeUnknown=true to be passed to Storage.GeneratePresignedPutURL")
 	}
 }
 
+func TestAllocate_MaxSizeRecordedForUnknownSize(t *testing.T) {
+	tests := []struct {
+		name     string
+		req      AllocateRequest
+		expected int64
+	}{
+		{"known size", AllocateRequest{Size: 10}, 0},
+		{"account limit", AllocateRequest{SizeUnknown: true, MaxSize: 500}, 500},
+		{"multipart without limit", AllocateRequest{SizeUnknown: true, Multipart: true}, 0},
+		{"multipart account limit", AllocateRequest{SizeUnknown: true, Multipart: true, MaxSize: 5000}, 5000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := &MockDB{}
+			handler := &Handler{
+				Storage:          &MockStorage{},
+				MultipartStorage: &MockMultipartStorage{CreateMultipartUploadID: "upload-1"},
+				DB:               mockDB,
+				UUIDGen:          &MockUUIDGen{GenerateResult: "blob-1"},
+				MaxSizeUploadPut: 1000,
+				MaxPendingAllocs: 4,
+				URLExpirySecs:    900,
+			}
+			tt.req.AccountID, tt.req.Type = "account-1", "text/plain"
+
+			if _, err := handler.Allocate(context.Background(), tt.req); err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if mockDB.AllocateInput.MaxSize != tt.expected {
+				t.Errorf("expected max size %d, got %d", tt.expected, mockDB.AllocateInput.MaxSize)
+			}
+		})
+	}
+}
+
 func TestAllocate_SizeUnknown_CognitoStillRequiresSize(t *testing.T) {
 	handler := &Handler{
 		MaxSizeUploadPut: 250000000,
@@ -510,13 +589,15 @@ type MockMultipartStorage struct {
 	CreateMultipartUploadCalled bool
 	CreateMultipartUploadID     string
 	CreateMultipartUploadErr    error
+	CreateMultipartChecksums    bool
 	GeneratePartURLsCalled      bool
 	GeneratePartURLsResult      []PartURL
 	GeneratePartURLsErr         error
 }
 
-func (m *MockMultipartStorage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string) (string, error) {
+func (m *MockMultipartStorage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error) {
 	m.CreateMultipartUploadCalled = true
+	m.CreateMultipartChecksums = checksums
 	if m.CreateMultipartUploadErr != nil {
 		return "", m.CreateMultipartUploadErr
 	}
@@ -869,3 +950,273 @@ func TestValidateMediaType(t *testing.T) {
 		})
 	}
 }
+
+func TestAllocate_Name_Cleaned(t *testing.T) {
+	db := &MockDB{}
+	handler := &Handler{
+		Storage:          &MockStorage{GeneratePresignedURLResult: "https://s3.example.com/upload"},
+		DB:               db,
+		UUIDGen:          &MockUUIDGen{GenerateResult: "blob-uuid-123"},
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+
+	resp, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID: "account-123",
+		Type:      "application/pdf",
+		Size:      1024,
+		Name:      "docs/report.pdf",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.AllocateInput.Name != "report.pdf" || resp.Name != "report.pdf" {
+		t.Errorf("expected name report.pdf stored and returned, got %q and %q", db.AllocateInput.Name, resp.Name)
+	}
+}
+
+func TestAllocate_InvalidName(t *testing.T) {
+	db := &MockDB{}
+	handler := &Handler{
+		DB:               db,
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+
+	_, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID: "account-123",
+		Type:      "application/pdf",
+		Size:      1024,
+		Name:      "bad\x00name",
+	})
+	allocErr, ok := err.(*AllocationError)
+	if !ok || allocErr.Type != "invalidProperties" || len(allocErr.Properties) != 1 || allocErr.Properties[0] != "name" {
+		t.Fatalf("expected invalidProperties [name], got %v", err)
+	}
+	if db.AllocateCalled {
+		t.Error("expected no allocation")
+	}
+}
+
+func TestAllocate_Tags(t *testing.T) {
+	db := &MockDB{}
+	handler := &Handler{
+		Storage:          &MockStorage{GeneratePresignedURLResult: "https://s3.example.com/upload"},
+		DB:               db,
+		UUIDGen:          &MockUUIDGen{GenerateResult: "blob-uuid-123"},
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+		TagKeys:          blobtag.Keys{"Source", "Retention"},
+	}
+
+	resp, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID: "account-123",
+		Type:      "application/pdf",
+		Size:      1024,
+		Tags:      map[string]string{"source": "scanner", "Retention": "7y"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{"Source": "scanner", "Retention": "7y"}
+	if !reflect.DeepEqual(db.AllocateInput.Tags, want) || !reflect.DeepEqual(resp.Tags, want) {
+		t.Errorf("expected tags %v stored and returned, got %v and %v", want, db.AllocateInput.Tags, resp.Tags)
+	}
+}
+
+func TestAllocate_InvalidTags(t *testing.T) {
+	tests := []struct {
+		name string
+		tags map[string]string
+	}{
+		{"unapproved key", map[string]string{"Owner": "someone"}},
+		{"reserved key", map[string]string{"Status": "confirmed"}},
+		{"invalid value", map[string]string{"Source": "<script>"}},
+		{"empty value", map[string]string{"Source": ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDB{}
+			handler := &Handler{
+				DB:               db,
+				MaxSizeUploadPut: 250000000,
+				MaxPendingAllocs: 4,
+				URLExpirySecs:    900,
+				TagKeys:          blobtag.Keys{"Source"},
+			}
+			_, err := handler.Allocate(context.Background(), AllocateRequest{
+				AccountID: "account-123",
+				Type:      "application/pdf",
+				Size:      1024,
+				Tags:      tt.tags,
+			})
+			allocErr, ok := err.(*AllocationError)
+			if !ok || allocErr.Type != "invalidProperties" || len(allocErr.Properties) != 1 || allocErr.Properties[0] != "tags" {
+				t.Fatalf("expected invalidProperties [tags], got %v", err)
+			}
+			if db.AllocateCalled {
+				t.Error("expected no allocation")
+			}
+		})
+	}
+}
+
+func TestAllocate_IndexedMetadata(t *testing.T) {
+	db := &MockDB{}
+	handler := &Handler{
+		Storage:          &MockStorage{GeneratePresignedURLResult: "https://s3.example.com/upload"},
+		DB:               db,
+		UUIDGen:          &MockUUIDGen{GenerateResult: "blob-uuid-123"},
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+
+	indexed := &blobmeta.IndexedMetadata{Key: "correlationId", Value: "msg-123"}
+	resp, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID:       "account-123",
+		Type:            "application/pdf",
+		Size:            1024,
+		IndexedMetadata: indexed,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(db.AllocateInput.Indexed, indexed) || !reflect.DeepEqual(resp.IndexedMetadata, indexed) {
+		t.Errorf("expected indexed metadata %v stored and returned, got %v and %v", indexed, db.AllocateInput.Indexed, resp.IndexedMetadata)
+	}
+}
+
+func TestAllocate_InvalidIndexedMetadata(t *testing.T) {
+	db := &MockDB{}
+	handler := &Handler{
+		DB:               db,
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+	_, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID:       "account-123",
+		Type:            "application/pdf",
+		Size:            1024,
+		IndexedMetadata: &blobmeta.IndexedMetadata{Key: "a#b", Value: "x"},
+	})
+	allocErr, ok := err.(*AllocationError)
+	if !ok || allocErr.Type != "invalidProperties" || len(allocErr.Properties) != 1 || allocErr.Properties[0] != "indexedMetadata" {
+		t.Fatalf("expected invalidProperties [indexedMetadata], got %v", err)
+	}
+	if db.AllocateCalled {
+		t.Error("expected no allocation")
+	}
+}
+
+// testChecksum is the base64 SHA-256 of "hello"
+const testChecksum = "LPJNul+wow4m6DsqxbninhsWHlwfp0JecwQzYpOLmCQ="
+
+func TestAllocate_Checksum_SinglePut(t *testing.T) {
+	storage := &MockStorage{GeneratePresignedURLResult: "https://s3.example.com/upload"}
+	db := &MockDB{}
+	handler := &Handler{
+		Storage:          storage,
+		DB:               db,
+		UUIDGen:          &MockUUIDGen{GenerateResult: "blob-uuid-123"},
+		MaxSizeUploadPut: 250000000,
+		MaxPendingAllocs: 4,
+		URLExpirySecs:    900,
+	}
+
+	resp, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID:      "account-123",
+		Type:           "text/plain",
+		Size:           5,
+		ChecksumSHA256: testChecksum,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if storage.GeneratePresignedURLInput.Checksum != testChecksum {
+		t.Errorf("expected the checksum to be signed into the URL, got %q", storage.GeneratePresignedURLInput.Checksum)
+	}
+	if db.AllocateInput.Checksum != testChecksum || resp.ChecksumSHA256 != testChecksum {
+		t.Errorf("expected the checksum stored and returned, got %q and %q", db.AllocateInput.Checksum, resp.ChecksumSHA256)
+	}
+}
+
+func TestAllocate_Checksum_Multipart(t *testing.T) {
+	multipart := &MockMultipartStorage{CreateMultipartUploadID: "upload-abc"}
+	db := &MockDB{}
+	handler := &Handler{
+		Storage:            &MockStorage{},
+		MultipartStorage:   multipart,
+		DB:                 db,
+		UUIDGen:            &MockUUIDGen{GenerateResult: "blob-mp-1"},
+		MaxSizeUploadPut:   250000000,
+		MaxPendingAllocs:   4,
+		URLExpirySecs:      900,
+		MultipartPartCount: 2,
+	}
+
+	resp, err := handler.Allocate(context.Background(), AllocateRequest{
+		AccountID:      "account-1",
+		Type:           "message/rfc822",
+		SizeUnknown:    true,
+		Multipart:      true,
+		ChecksumSHA256: testChecksum + "-2",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !multipart.CreateMultipartChecksums {
+		t.Error("expected the multipart upload to be created with checksums")
+	}
+	if db.AllocateInput.Checksum != testChecksum+"-2" || resp.ChecksumSHA256 != testChecksum+"-2" {
+		t.Errorf("expected the checksum stored and returned, got %q and %q", db.AllocateInput.Checksum, resp.ChecksumSHA256)
+	}
+}
+
+func TestAllocate_InvalidChecksum(t *testing.T) {
+	tests := []struct {
+		name      string
+		multipart bool
+		checksum  string
+	}{
+		{"not base64", false, "not a checksum"},
+		{"wrong length", false, "aGVsbG8="},
+		{"composite for a single PUT", false, testChecksum + "-2"},
+		{"whole-object checksum for multipart", true, testChecksum},
+		{"zero parts", true, testChecksum + "-0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := &MockDB{}
+			handler := &Handler{
+				Storage:            &MockStorage{},
+				MultipartStorage:   &MockMultipartStorage{},
+				DB:                 db,
+				UUIDGen:            &MockUUIDGen{GenerateResult: "blob-1"},
+				MaxSizeUploadPut:   250000000,
+				MaxPendingAllocs:   4,
+				URLExpirySecs:      900,
+				MultipartPartCount: 2,
+			}
+			_, err := handler.Allocate(context.Background(), AllocateRequest{
+				AccountID:      "account-123",
+				Type:           "text/plain",
+				Size:           5,
+				SizeUnknown:    tt.multipart,
+				Multipart:      tt.multipart,
+				ChecksumSHA256: tt.checksum,
+			})
+			allocErr, ok := err.(*AllocationError)
+			if !ok || allocErr.Type != "invalidProperties" || len(allocErr.Properties) != 1 || allocErr.Properties[0] != "checksumSha256" {
+				t.Fatalf("expected invalidProperties [checksumSha256], got %v", err)
+			}
+			if db.AllocateCalled {
+				t.Error("expected no allocation")
+			}
+		})
+	}
+}
@@ -10,6 +10,9 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
 )
 
 // DynamoDBClient defines the interface for DynamoDB operations
@@ -22,6 +25,32 @@ type DynamoDBClient interface {
 type DynamoDBStore struct {
 	client    DynamoDBClient
 	tableName string
+	envelope  *blobcrypt.Envelope
+	grace     QuotaGrace
+}
+
+// QuotaGrace lets allocations take an account over its quota by up to
+// Percent of the quota. The first allocation over quota starts the grace
+// period, recorded on META# as quotaGraceExpiresAt; once it lapses,
+// allocations over quota are rejected until usage is back under the quota.
+type QuotaGrace struct {
+	Percent int
+	Period  time.Duration
+}
+
+// Bytes returns how far over quotaBytes allocations may go
+func (g QuotaGrace) Bytes(quotaBytes int64) int64 {
+	return quotaBytes * int64(g.Percent) / 100
+}
+
+// graceAllocation is returned by diagnoseMetaConditionFailure when an
+// allocation over quota is within the grace band
+type graceAllocation struct {
+	quotaBytes int64
+}
+
+func (g *graceAllocation) Error() string {
+	return "allocation is within the quota grace band"
 }
 
 // NewDynamoDBStore creates a new DynamoDBStore
@@ -32,27 +61,46 @@ func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
 	}
 }
 
+// WithEncryption seals the envelope's attributes of allocated blob records
+func (d *DynamoDBStore) WithEncryption(envelope *blobcrypt.Envelope) *DynamoDBStore {
+	d.envelope = envelope
+	return d
+}
+
+// WithQuotaGrace allows allocations over quota within grace
+func (d *DynamoDBStore) WithQuotaGrace(grace QuotaGrace) *DynamoDBStore {
+	d.grace = grace
+	return d
+}
+
 // AllocateBlob creates a pending allocation record with a transactional write
 // that also updates the account META# record (pendingAllocationsCount, quotaRemaining).
 // When uploadID is non-empty, stores it on the blob record for multipart upload tracking.
-func (d *DynamoDBStore) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool) error {
-	now := time.Now().UTC().Format(time.RFC3339)
+// A non-empty name is stored as the blob's original filename, and any tags
+// for blob-confirm to apply to the object. Indexed metadata is stored with
+// the gsi2 keys Blob/queryByMetadata finds the blob by. A declared checksum
+// is stored for blob-confirm to verify the uploaded object against, and a
+// non-zero maxSize for blob-confirm and Blob/complete to hold an upload of
+// unknown size to.
+func (d *DynamoDBStore) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool, name string, tags map[string]string, indexed *blobmeta.IndexedMetadata, checksum string, maxSize int64) error {
+	allocatedAt := time.Now().UTC()
+	now := allocatedAt.Format(time.RFC3339)
 	urlExpiresAtStr := urlExpiresAt.UTC().Format(time.RFC3339)
 
 	// Build GSI sort key: EXPIRES#{urlExpiresAt}#{accountId}#{blobId}
-	gsi1sk := fmt.Sprintf("EXPIRES#%s#%s#%s", urlExpiresAtStr, accountID, blobID)
+	gsi1sk := fmt.Sprintf("%s%s#%s#%s", store.ExpiresPrefix, urlExpiresAtStr, accountID, blobID)
 
 	// Build blob record
 	// Note: blobId and accountId are stored as explicit attributes (in addition to pk/sk)
 	// because blob-download expects them when unmarshaling BlobRecord
 	blobItem := map[string]any{
-		"pk":           fmt.Sprintf("ACCOUNT#%s", accountID),
-		"sk":           fmt.Sprintf("BLOB#%s", blobID),
+		"pk":           store.AccountPK(accountID),
+		"sk":           store.BlobSK(blobID),
 		"blobId":       blobID,
 		"accountId":    accountID,
-		"gsi1pk":       "PENDING",
+		"gsi1pk":       store.PendingGSI1PK,
 		"gsi1sk":       gsi1sk,
-		"status":       "pending",
+		"status":       store.StatusPending,
 		"urlExpiresAt": urlExpiresAtStr,
 		"size":         size,
 		"contentType":  contentType,
@@ -69,32 +117,114 @@ func (d *DynamoDBStore) AllocateBlob(ctx context.Context, accountID, blobID stri
 		blobItem["uploadId"] = uploadID
 		blobItem["multipart"] = true
 	}
+	if name != "" {
+		blobItem["name"] = name
+	}
+	if len(tags) > 0 {
+		blobItem["tags"] = tags
+	}
+	if checksum != "" {
+		blobItem["declaredChecksumSha256"] = checksum
+	}
+	if maxSize > 0 {
+		blobItem["maxSize"] = maxSize
+	}
+	if indexed != nil {
+		blobItem["indexedMetadata"] = indexed
+		blobItem["gsi2pk"] = store.IndexedGSI2PK(accountID, indexed.Key, indexed.Value)
+		blobItem["gsi2sk"] = store.BlobSK(blobID)
+	}
 
 	blobAV, err := attributevalue.MarshalMap(blobItem)
 	if err != nil {
 		return fmt.Errorf("failed to marshal blob record: %w", err)
 	}
+	if d.envelope != nil {
+		if err := d.envelope.Seal(ctx, blobAV); err != nil {
+			return fmt.Errorf("failed to seal blob record: %w", err)
+		}
+	}
+
+	metaUpdate := d.metaUpdate(accountID, maxPending, size, sizeUnknown, isIAMAuth, allocatedAt, nil)
+
+	// Transaction: Update META# and Put blob record. Conflicts are retried
+	// by the client (store.RetryClient).
+	err = d.executeAllocationTransaction(ctx, store.RequestToken(store.OpAllocate, accountID, blobID), metaUpdate, blobAV)
+	if err == nil {
+		return nil
+	}
 
-	// Build META# key
-	metaKey := map[string]types.AttributeValue{
-		"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-		"sk": &types.AttributeValueMemberS{Value: "META#"},
+	err = d.allocationFailure(ctx, err, accountID, maxPending, size, sizeUnknown, isIAMAuth)
+	var grace *graceAllocation
+	if !errors.As(err, &grace) {
+		return err
 	}
 
+	// Over quota but within the grace band: try again allowing for it, under
+	// a separate token since the transaction differs
+	metaUpdate = d.metaUpdate(accountID, maxPending, size, sizeUnknown, isIAMAuth, allocatedAt, grace)
+	err = d.executeAllocationTransaction(ctx, store.RequestToken(store.OpAllocateGrace, accountID, blobID), metaUpdate, blobAV)
+	if err == nil {
+		return nil
+	}
+	err = d.allocationFailure(ctx, err, accountID, maxPending, size, sizeUnknown, isIAMAuth)
+	if errors.As(err, &grace) {
+		// The account's quota changed under us
+		return &AllocationError{
+			Type:    "serverFail",
+			Message: "Allocation failed due to concurrent modification",
+		}
+	}
+	return err
+}
+
+// allocationFailure converts a failed allocation transaction into the error
+// to report, diagnosing why the META# condition failed
+func (d *DynamoDBStore) allocationFailure(ctx context.Context, err error, accountID string, maxPending int, size int64, sizeUnknown bool, isIAMAuth bool) error {
+	// Check for transaction cancellation reasons
+	var txCanceled *types.TransactionCanceledException
+	if errors.As(err, &txCanceled) {
+		// Analyze cancellation reasons
+		for i, reason := range txCanceled.CancellationReasons {
+			if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
+				if i == 0 {
+					// META# update condition failed
+					// Could be: account not provisioned, suspended, writes disabled,
+					// too many pending, or over quota
+					// We need to distinguish these cases
+					return d.diagnoseMetaConditionFailure(ctx, accountID, maxPending, size, sizeUnknown, isIAMAuth)
+				}
+				// Blob record already exists (unlikely with UUID)
+				return fmt.Errorf("blob record already exists")
+			}
+		}
+	}
+	return fmt.Errorf("transaction failed: %w", err)
+}
+
+// metaUpdate builds the META# update of an allocation. With grace, the
+// quota may be overdrawn by up to the grace band, provided the quota is
+// unchanged since it was read and the grace period, which the update starts
+// if needed, has not lapsed.
+func (d *DynamoDBStore) metaUpdate(accountID string, maxPending int, size int64, sizeUnknown bool, isIAMAuth bool, now time.Time, grace *graceAllocation) *types.Update {
 	// Build META# update expression and condition.
 	// IAM auth: skip pending allocations count (no increment, no limit check).
 	// Non-IAM: include pending count increment and limit check.
+	// Suspended accounts and those with writes disabled are rejected for
+	// both IAM and non-IAM.
 	var updateExpr, conditionExpr string
 	exprValues := map[string]types.AttributeValue{
-		":now": &types.AttributeValueMemberS{Value: now},
+		":now":   &types.AttributeValueMemberS{Value: now.Format(time.RFC3339)},
+		":false": &types.AttributeValueMemberBOOL{Value: false},
 	}
 
 	if isIAMAuth {
 		updateExpr = "SET updatedAt = :now"
-		conditionExpr = "attribute_exists(pk)"
+		conditionExpr = "attribute_exists(pk) AND (attribute_not_exists(suspended) OR suspended = :false) AND (attribute_not_exists(writesDisabled) OR writesDisabled = :false)"
 	} else {
 		updateExpr = "ADD pendingAllocationsCount :one SET updatedAt = :now"
-		conditionExpr = "attribute_exists(pk) AND pendingAllocationsCount < :max"
+		// An account's own maxPendingAllocations (set from its tier) replaces maxPending
+		conditionExpr = "attribute_exists(pk) AND (attribute_not_exists(suspended) OR suspended = :false) AND (attribute_not_exists(writesDisabled) OR writesDisabled = :false) AND (pendingAllocationsCount < maxPendingAllocations OR (attribute_not_exists(maxPendingAllocations) AND pendingAllocationsCount < :max))"
 		exprValues[":one"] = &types.AttributeValueMemberN{Value: "1"}
 		exprValues[":max"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", maxPending)}
 	}
@@ -106,53 +236,38 @@ func (d *DynamoDBStore) AllocateBlob(ctx context.Context, accountID, blobID stri
 		} else {
 			updateExpr = "ADD pendingAllocationsCount :one, quotaRemaining :negSize SET updatedAt = :now"
 		}
-		conditionExpr += " AND quotaRemaining >= :size"
 		exprValues[":negSize"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("-%d", size)}
-		exprValues[":size"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", size)}
+		if grace == nil {
+			conditionExpr += " AND quotaRemaining >= :size"
+			exprValues[":size"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", size)}
+		} else {
+			updateExpr += ", quotaGraceExpiresAt = if_not_exists(quotaGraceExpiresAt, :graceExpires)"
+			conditionExpr += " AND quotaBytes = :quotaBytes AND quotaRemaining >= :floor AND (attribute_not_exists(quotaGraceExpiresAt) OR quotaGraceExpiresAt > :now)"
+			exprValues[":graceExpires"] = &types.AttributeValueMemberS{Value: now.Add(d.grace.Period).Format(time.RFC3339)}
+			exprValues[":quotaBytes"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", grace.quotaBytes)}
+			exprValues[":floor"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", size-d.grace.Bytes(grace.quotaBytes))}
+		}
 	}
 
-	metaUpdate := &types.Update{
+	return &types.Update{
 		TableName:                 aws.String(d.tableName),
-		Key:                       metaKey,
+		Key:                       store.MetaKey(accountID),
 		UpdateExpression:          aws.String(updateExpr),
 		ConditionExpression:       aws.String(conditionExpr),
 		ExpressionAttributeValues: exprValues,
 	}
-
-	// Transaction: Update META# and Put blob record with retry logic
-	err = d.executeAllocationWithRetry(ctx, metaUpdate, blobAV)
-
-	if err != nil {
-		// Check for transaction cancellation reasons
-		var txCanceled *types.TransactionCanceledException
-		if errors.As(err, &txCanceled) {
-			// Analyze cancellation reasons
-			for i, reason := range txCanceled.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
-					if i == 0 {
-						// META# update condition failed
-						// Could be: account not provisioned, too many pending, or over quota
-						// We need to distinguish these cases
-						return d.diagnoseMetaConditionFailure(ctx, accountID, maxPending, size, sizeUnknown, isIAMAuth)
-					}
-					// Blob record already exists (unlikely with UUID)
-					return fmt.Errorf("blob record already exists")
-				}
-			}
-		}
-		return fmt.Errorf("transaction failed: %w", err)
-	}
-
-	return nil
 }
 
-// executeAllocationTransaction executes the DynamoDB transaction for blob allocation
+// executeAllocationTransaction executes the DynamoDB transaction for blob allocation.
+// token makes a retry of an applied transaction succeed rather than fail its conditions.
 func (d *DynamoDBStore) executeAllocationTransaction(
 	ctx context.Context,
+	token *string,
 	metaUpdate *types.Update,
 	blobItem map[string]types.AttributeValue,
 ) error {
 	_, err := d.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: token,
 		TransactItems: []types.TransactWriteItem{
 			{Update: metaUpdate},
 			{Put: &types.Put{
@@ -165,57 +280,13 @@ func (d *DynamoDBStore) executeAllocationTransaction(
 	return err
 }
 
-// executeAllocationWithRetry wraps transaction execution with retry logic for TransactionConflict
-func (d *DynamoDBStore) executeAllocationWithRetry(
-	ctx context.Context,
-	metaUpdate *types.Update,
-	blobItem map[string]types.AttributeValue,
-) error {
-	const maxRetries = 3
-	var err error
-
-	for attempt := 0; attempt <= maxRetries; attempt++ {
-		err = d.executeAllocationTransaction(ctx, metaUpdate, blobItem)
-
-		if err == nil {
-			return nil // Success
-		}
-
-		// Check if this is a TransactionConflict that we should retry
-		shouldRetry := false
-		var txCanceled *types.TransactionCanceledException
-		if errors.As(err, &txCanceled) {
-			for _, reason := range txCanceled.CancellationReasons {
-				if reason.Code != nil && *reason.Code == "TransactionConflict" {
-					shouldRetry = true
-					break
-				}
-			}
-		}
-
-		// If we found a TransactionConflict and haven't exhausted retries, retry
-		if shouldRetry && attempt < maxRetries {
-			time.Sleep(50 * time.Millisecond * (1 << attempt)) // 50ms, 100ms, 200ms
-			continue
-		}
-
-		// ConditionalCheckFailed, exhausted retries, or other error - stop retrying
-		break
-	}
-
-	return err
-}
-
 // diagnoseMetaConditionFailure determines why the META# condition failed
 func (d *DynamoDBStore) diagnoseMetaConditionFailure(ctx context.Context, accountID string, maxPending int, size int64, sizeUnknown bool, isIAMAuth bool) error {
 	// Query the META# record to determine which condition failed
 	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: "META#"},
-		},
-		ProjectionExpression: aws.String("pendingAllocationsCount, quotaRemaining"),
+		TableName:            aws.String(d.tableName),
+		Key:                  store.MetaKey(accountID),
+		ProjectionExpression: aws.String("pendingAllocationsCount, maxPendingAllocations, quotaRemaining, quotaBytes, quotaGraceExpiresAt, suspended, writesDisabled"),
 	})
 	if err != nil {
 		// Can't diagnose, return generic error
@@ -233,6 +304,24 @@ func (d *DynamoDBStore) diagnoseMetaConditionFailure(ctx context.Context, accoun
 		}
 	}
 
+	// Suspension takes precedence over quota and pending limits
+	if v, ok := result.Item["suspended"]; ok {
+		if b, ok := v.(*types.AttributeValueMemberBOOL); ok && b.Value {
+			return &AllocationError{
+				Type:    "forbidden",
+				Message: "Account is suspended",
+			}
+		}
+	}
+	if v, ok := result.Item["writesDisabled"]; ok {
+		if b, ok := v.(*types.AttributeValueMemberBOOL); ok && b.Value {
+			return &AllocationError{
+				Type:    "accountReadOnly",
+				Message: "Account is read-only",
+			}
+		}
+	}
+
 	// Parse values from the record
 	var pendingCount int
 	var quotaRemaining int64
@@ -243,6 +332,12 @@ func (d *DynamoDBStore) diagnoseMetaConditionFailure(ctx context.Context, accoun
 		}
 	}
 
+	if v, ok := result.Item["maxPendingAllocations"]; ok {
+		if n, ok := v.(*types.AttributeValueMemberN); ok {
+			fmt.Sscanf(n.Value, "%d", &maxPending)
+		}
+	}
+
 	if v, ok := result.Item["quotaRemaining"]; ok {
 		if n, ok := v.(*types.AttributeValueMemberN); ok {
 			fmt.Sscanf(n.Value, "%d", &quotaRemaining)
@@ -258,6 +353,25 @@ func (d *DynamoDBStore) diagnoseMetaConditionFailure(ctx context.Context, accoun
 	}
 
 	if !sizeUnknown && quotaRemaining < size {
+		if d.grace.Percent > 0 {
+			var quotaBytes int64
+			if n, ok := result.Item["quotaBytes"].(*types.AttributeValueMemberN); ok {
+				fmt.Sscanf(n.Value, "%d", &quotaBytes)
+			}
+			if quotaRemaining+d.grace.Bytes(quotaBytes) >= size {
+				graceExpiresAt := ""
+				if v, ok := result.Item["quotaGraceExpiresAt"].(*types.AttributeValueMemberS); ok {
+					graceExpiresAt = v.Value
+				}
+				if graceExpiresAt == "" || graceExpiresAt > time.Now().UTC().Format(time.RFC3339) {
+					return &graceAllocation{quotaBytes: quotaBytes}
+				}
+				return &AllocationError{
+					Type:    "overQuota",
+					Message: fmt.Sprintf("Insufficient quota remaining (%d bytes needed, %d available) and the quota grace period ended at %s", size, quotaRemaining, graceExpiresAt),
+				}
+			}
+		}
 		return &AllocationError{
 			Type:    "overQuota",
 			Message: fmt.Sprintf("Insufficient quota remaining (%d bytes needed, %d available)", size, quotaRemaining),
@@ -9,6 +9,8 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
 )
 
 // CapturingDynamoDBClient captures TransactWriteItems calls for inspection
@@ -38,7 +40,7 @@ func TestAllocateBlob_NonMultipart_NoUploadIdStored(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -62,7 +64,7 @@ func TestAllocateBlob_Multipart_StoresUploadId(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "message/rfc822",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "upload-xyz-123", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "upload-xyz-123", false, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -100,12 +102,46 @@ func TestAllocateBlob_Multipart_StoresUploadId(t *testing.T) {
 	}
 }
 
+func TestAllocateBlob_StoresDeclaredChecksum(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 5, "text/plain",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "c3VtMQ==", 0)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	checksumAttr, ok := putItem["declaredChecksumSha256"].(*types.AttributeValueMemberS)
+	if !ok || checksumAttr.Value != "c3VtMQ==" {
+		t.Errorf("expected declaredChecksumSha256 to be stored, got %v", putItem["declaredChecksumSha256"])
+	}
+	if _, ok := putItem["checksumSha256"]; ok {
+		t.Error("expected no verified checksum before the upload is confirmed")
+	}
+}
+
+func TestAllocateBlob_StoresMaxSize(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "text/plain",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true, "", nil, nil, "", 5000)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	if maxSize, ok := putItem["maxSize"].(*types.AttributeValueMemberN); !ok || maxSize.Value != "5000" {
+		t.Errorf("expected maxSize to be stored, got %v", putItem["maxSize"])
+	}
+}
+
 func TestAllocateBlob_EmptyUploadId_NotStored(t *testing.T) {
 	client := &CapturingDynamoDBClient{}
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -117,6 +153,88 @@ func TestAllocateBlob_EmptyUploadId_NotStored(t *testing.T) {
 	}
 }
 
+func TestAllocateBlob_Name_Stored(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "report.pdf", nil, nil, "", 0)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	nameAttr, ok := putItem["name"].(*types.AttributeValueMemberS)
+	if !ok || nameAttr.Value != "report.pdf" {
+		t.Errorf("expected name report.pdf, got %v", putItem["name"])
+	}
+}
+
+func TestAllocateBlob_Tags_Stored(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", map[string]string{"Source": "scanner"}, nil, "", 0)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	tagsAttr, ok := putItem["tags"].(*types.AttributeValueMemberM)
+	if !ok {
+		t.Fatalf("expected tags map, got %v", putItem["tags"])
+	}
+	if source, ok := tagsAttr.Value["Source"].(*types.AttributeValueMemberS); !ok || source.Value != "scanner" {
+		t.Errorf("expected Source tag scanner, got %v", tagsAttr.Value)
+	}
+}
+
+func TestAllocateBlob_IndexedMetadata_StoredWithGSI2Keys(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil,
+		&blobmeta.IndexedMetadata{Key: "correlationId", Value: "msg-123"}, "", 0)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	if pk, ok := putItem["gsi2pk"].(*types.AttributeValueMemberS); !ok || pk.Value != "INDEXED#account-1#correlationId#msg-123" {
+		t.Errorf("unexpected gsi2pk %v", putItem["gsi2pk"])
+	}
+	if sk, ok := putItem["gsi2sk"].(*types.AttributeValueMemberS); !ok || sk.Value != "BLOB#blob-1" {
+		t.Errorf("unexpected gsi2sk %v", putItem["gsi2sk"])
+	}
+	if _, ok := putItem["indexedMetadata"].(*types.AttributeValueMemberM); !ok {
+		t.Errorf("expected indexedMetadata map, got %v", putItem["indexedMetadata"])
+	}
+}
+
+func TestAllocateBlob_NoIndexedMetadata_NoGSI2Keys(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	for _, attr := range []string{"gsi2pk", "gsi2sk", "indexedMetadata"} {
+		if _, ok := putItem[attr]; ok {
+			t.Errorf("expected no %s attribute", attr)
+		}
+	}
+}
+
 func TestAllocateBlob_TransactionError_Propagated(t *testing.T) {
 	client := &CapturingDynamoDBClient{
 		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
@@ -126,7 +244,7 @@ func TestAllocateBlob_TransactionError_Propagated(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err == nil {
 		t.Fatal("expected error, got nil")
@@ -138,7 +256,7 @@ func TestAllocateBlob_IAMAuth_StoresIAMAuthFlag(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "message/rfc822",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -163,7 +281,7 @@ func TestAllocateBlob_NonIAMAuth_NoIAMAuthFlag(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -180,7 +298,7 @@ func TestAllocateBlob_IAMAuth_SkipsPendingCountInUpdate(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "message/rfc822",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -200,7 +318,7 @@ func TestAllocateBlob_IAMAuth_SkipsPendingCondition(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "message/rfc822",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -224,7 +342,7 @@ func TestAllocateBlob_NonIAMAuth_IncludesPendingCount(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err != nil {
 		t.Fatalf("expected no error, got %v", err)
@@ -264,7 +382,7 @@ func TestAllocateBlob_IAMAuth_DiagnoseSkipsTooManyPending(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 0, "message/rfc822",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", true, "", true, "", nil, nil, "", 0)
 
 	if err == nil {
 		t.Fatal("expected error from condition failure")
@@ -281,55 +399,242 @@ func TestAllocateBlob_IAMAuth_DiagnoseSkipsTooManyPending(t *testing.T) {
 	}
 }
 
-func stringPtr(s string) *string {
-	return &s
+func TestAllocateBlob_SuspendedAccount_ReturnsForbidden(t *testing.T) {
+	client := &CapturingDynamoDBClient{
+		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: stringPtr("ConditionalCheckFailed")},
+					{Code: stringPtr("None")},
+				},
+			}
+		},
+		GetItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{
+				Item: map[string]types.AttributeValue{
+					"pendingAllocationsCount": &types.AttributeValueMemberN{Value: "0"},
+					"quotaRemaining":          &types.AttributeValueMemberN{Value: "1000000"},
+					"suspended":               &types.AttributeValueMemberBOOL{Value: true},
+				},
+			}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+
+	allocErr, ok := err.(*AllocationError)
+	if !ok {
+		t.Fatalf("expected AllocationError, got %T: %v", err, err)
+	}
+	if allocErr.Type != "forbidden" {
+		t.Errorf("expected forbidden error type, got %s", allocErr.Type)
+	}
+
+	conditionExpr := *client.LastTransactInput.TransactItems[0].Update.ConditionExpression
+	if !strings.Contains(conditionExpr, "suspended") {
+		t.Errorf("expected condition to check suspended flag, got: %s", conditionExpr)
+	}
 }
 
-func ctx() context.Context {
-	return context.Background()
+func TestAllocateBlob_WritesDisabled_ReturnsAccountReadOnly(t *testing.T) {
+	client := &CapturingDynamoDBClient{
+		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+			return nil, &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: stringPtr("ConditionalCheckFailed")},
+					{Code: stringPtr("None")},
+				},
+			}
+		},
+		GetItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{
+				Item: map[string]types.AttributeValue{
+					"pendingAllocationsCount": &types.AttributeValueMemberN{Value: "0"},
+					"quotaRemaining":          &types.AttributeValueMemberN{Value: "1000000"},
+					"writesDisabled":          &types.AttributeValueMemberBOOL{Value: true},
+				},
+			}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", true, "", nil, nil, "", 0)
+
+	allocErr, ok := err.(*AllocationError)
+	if !ok {
+		t.Fatalf("expected AllocationError, got %T: %v", err, err)
+	}
+	if allocErr.Type != "accountReadOnly" {
+		t.Errorf("expected accountReadOnly error type, got %s", allocErr.Type)
+	}
+
+	conditionExpr := *client.LastTransactInput.TransactItems[0].Update.ConditionExpression
+	if !strings.Contains(conditionExpr, "writesDisabled") {
+		t.Errorf("expected condition to check writesDisabled flag, got: %s", conditionExpr)
+	}
 }
 
-// TestAllocateBlob_TransactionConflict_SucceedsOnRetry verifies that a TransactionConflict
-// error is retried and succeeds on the second attempt.
-func TestAllocateBlob_TransactionConflict_SucceedsOnRetry(t *testing.T) {
-	callCount := 0
+// overQuotaClient fails the first allocation transaction on the META#
+// condition and reports meta when it is diagnosed
+func overQuotaClient(meta map[string]types.AttributeValue) (*CapturingDynamoDBClient, *[]*dynamodb.TransactWriteItemsInput) {
+	var transactions []*dynamodb.TransactWriteItemsInput
 	client := &CapturingDynamoDBClient{
 		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-			callCount++
-			if callCount == 1 {
-				// First call fails with TransactionConflict on META# update (item 0)
+			transactions = append(transactions, params)
+			if len(transactions) == 1 {
 				return nil, &types.TransactionCanceledException{
 					CancellationReasons: []types.CancellationReason{
-						{Code: stringPtr("TransactionConflict")}, // META# update
-						{Code: stringPtr("None")},                 // BLOB# create (would have succeeded)
+						{Code: stringPtr("ConditionalCheckFailed")},
+						{Code: stringPtr("None")},
 					},
 				}
 			}
-			// Second call succeeds
 			return &dynamodb.TransactWriteItemsOutput{}, nil
 		},
+		GetItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{Item: meta}, nil
+		},
+	}
+	return client, &transactions
+}
+
+func TestAllocateBlob_WithinGraceBand_Succeeds(t *testing.T) {
+	client, transactions := overQuotaClient(map[string]types.AttributeValue{
+		"pendingAllocationsCount": &types.AttributeValueMemberN{Value: "0"},
+		"quotaBytes":              &types.AttributeValueMemberN{Value: "10000"},
+		"quotaRemaining":          &types.AttributeValueMemberN{Value: "100"},
+	})
+	store := NewDynamoDBStore(client, "test-table").WithQuotaGrace(QuotaGrace{Percent: 10, Period: 24 * time.Hour})
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1000, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+	if err != nil {
+		t.Fatalf("expected allocation within grace to succeed, got %v", err)
+	}
+
+	if len(*transactions) != 2 {
+		t.Fatalf("expected a second transaction allowing for grace, got %d", len(*transactions))
+	}
+	first, second := (*transactions)[0], (*transactions)[1]
+	if *first.ClientRequestToken == *second.ClientRequestToken {
+		t.Error("expected the grace transaction to use its own token")
+	}
+	update := second.TransactItems[0].Update
+	if !strings.Contains(*update.ConditionExpression, "quotaRemaining >= :floor") || !strings.Contains(*update.ConditionExpression, "quotaGraceExpiresAt > :now") {
+		t.Errorf("expected grace condition, got %s", *update.ConditionExpression)
+	}
+	if !strings.Contains(*update.UpdateExpression, "quotaGraceExpiresAt = if_not_exists(quotaGraceExpiresAt, :graceExpires)") {
+		t.Errorf("expected grace period to be started, got %s", *update.UpdateExpression)
+	}
+	// 1000 needed, 1000 of grace on a 10000 byte quota
+	if floor := update.ExpressionAttributeValues[":floor"].(*types.AttributeValueMemberN).Value; floor != "0" {
+		t.Errorf("expected floor 0, got %s", floor)
+	}
+	if quota := update.ExpressionAttributeValues[":quotaBytes"].(*types.AttributeValueMemberN).Value; quota != "10000" {
+		t.Errorf("expected quotaBytes 10000, got %s", quota)
+	}
+	expires, err := time.Parse(time.RFC3339, update.ExpressionAttributeValues[":graceExpires"].(*types.AttributeValueMemberS).Value)
+	if err != nil || time.Until(expires) < 23*time.Hour {
+		t.Errorf("expected grace to expire in a day, got %v (%v)", expires, err)
+	}
+}
+
+func TestAllocateBlob_OverQuota_RejectedWithoutGrace(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace QuotaGrace
+		meta  map[string]types.AttributeValue
+	}{
+		{
+			name:  "grace disabled",
+			grace: QuotaGrace{},
+			meta: map[string]types.AttributeValue{
+				"quotaBytes":     &types.AttributeValueMemberN{Value: "10000"},
+				"quotaRemaining": &types.AttributeValueMemberN{Value: "100"},
+			},
+		},
+		{
+			name:  "beyond grace band",
+			grace: QuotaGrace{Percent: 5, Period: time.Hour},
+			meta: map[string]types.AttributeValue{
+				"quotaBytes":     &types.AttributeValueMemberN{Value: "10000"},
+				"quotaRemaining": &types.AttributeValueMemberN{Value: "100"},
+			},
+		},
+		{
+			name:  "grace period lapsed",
+			grace: QuotaGrace{Percent: 10, Period: time.Hour},
+			meta: map[string]types.AttributeValue{
+				"quotaBytes":          &types.AttributeValueMemberN{Value: "10000"},
+				"quotaRemaining":      &types.AttributeValueMemberN{Value: "100"},
+				"quotaGraceExpiresAt": &types.AttributeValueMemberS{Value: time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, transactions := overQuotaClient(tt.meta)
+			store := NewDynamoDBStore(client, "test-table").WithQuotaGrace(tt.grace)
+
+			err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1000, "application/pdf",
+				time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", true, "", nil, nil, "", 0)
+
+			allocErr, ok := err.(*AllocationError)
+			if !ok || allocErr.Type != "overQuota" {
+				t.Fatalf("expected overQuota, got %v", err)
+			}
+			if len(*transactions) != 1 {
+				t.Errorf("expected no grace transaction, got %d transactions", len(*transactions))
+			}
+		})
 	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func ctx() context.Context {
+	return context.Background()
+}
+
+// TestAllocateBlob_SetsClientRequestToken verifies the transaction carries a token derived
+// from the blob, so a retried allocation is not applied twice.
+func TestAllocateBlob_SetsClientRequestToken(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
 
+	token := client.LastTransactInput.ClientRequestToken
+	if token == nil || len(*token) != 36 {
+		t.Fatalf("expected a 36 character token, got %v", token)
+	}
+
+	err = store.AllocateBlob(ctx(), "account-1", "blob-2", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-2", false, "", false, "", nil, nil, "", 0)
 	if err != nil {
-		t.Fatalf("expected success after retry, got error: %v", err)
+		t.Fatalf("unexpected error: %v", err)
 	}
-	if callCount != 2 {
-		t.Errorf("expected exactly 2 calls (1 failure + 1 retry), got %d", callCount)
+	if *client.LastTransactInput.ClientRequestToken == *token {
+		t.Error("expected a different token for a different blob")
 	}
 }
 
-// TestAllocateBlob_TransactionConflict_ExhaustsRetries verifies that after max retries
-// with TransactionConflict, the error is returned to the caller.
-func TestAllocateBlob_TransactionConflict_ExhaustsRetries(t *testing.T) {
+// TestAllocateBlob_TransactionConflict_ReturnsError verifies that a TransactionConflict
+// is returned to the caller without retrying; the client (store.RetryClient) retries conflicts.
+func TestAllocateBlob_TransactionConflict_ReturnsError(t *testing.T) {
 	callCount := 0
 	client := &CapturingDynamoDBClient{
 		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
 			callCount++
-			// Always fail with TransactionConflict
 			return nil, &types.TransactionCanceledException{
 				CancellationReasons: []types.CancellationReason{
 					{Code: stringPtr("TransactionConflict")},
@@ -341,16 +646,14 @@ func TestAllocateBlob_TransactionConflict_ExhaustsRetries(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err == nil {
-		t.Fatal("expected error after exhausting retries, got nil")
+		t.Fatal("expected error, got nil")
 	}
-	// Expect 4 total calls: 1 initial + 3 retries
-	if callCount != 4 {
-		t.Errorf("expected 4 calls (1 initial + 3 retries), got %d", callCount)
+	if callCount != 1 {
+		t.Errorf("expected 1 call, got %d", callCount)
 	}
-	// Error message should indicate transaction failed
 	if !strings.Contains(err.Error(), "transaction failed") {
 		t.Errorf("expected 'transaction failed' in error message, got: %v", err)
 	}
@@ -382,7 +685,7 @@ func TestAllocateBlob_ConditionalCheckFailed_NoRetry(t *testing.T) {
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 
 	if err == nil {
 		t.Fatal("expected error from ConditionalCheckFailed, got nil")
@@ -401,52 +704,98 @@ func TestAllocateBlob_ConditionalCheckFailed_NoRetry(t *testing.T) {
 	}
 }
 
-// TestAllocateBlob_TransactionConflict_MultipleRetries verifies exponential backoff timing
-// by checking that retries happen with increasing delays.
-func TestAllocateBlob_TransactionConflict_MultipleRetries(t *testing.T) {
-	callCount := 0
-	var callTimes []time.Time
+func TestAllocateBlob_NonIAMAuth_HonoursAccountPendingLimit(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	store := NewDynamoDBStore(client, "test-table")
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	conditionExpr := *client.LastTransactInput.TransactItems[0].Update.ConditionExpression
+	if !strings.Contains(conditionExpr, "pendingAllocationsCount < maxPendingAllocations") {
+		t.Errorf("expected condition to use the account's own limit, got: %s", conditionExpr)
+	}
+	if !strings.Contains(conditionExpr, "attribute_not_exists(maxPendingAllocations) AND pendingAllocationsCount < :max") {
+		t.Errorf("expected condition to fall back to the default limit, got: %s", conditionExpr)
+	}
+}
+
+func TestAllocateBlob_DiagnoseUsesAccountPendingLimit(t *testing.T) {
 	client := &CapturingDynamoDBClient{
 		TransactWriteItemsFunc: func(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
-			callCount++
-			callTimes = append(callTimes, time.Now())
-
-			if callCount <= 2 {
-				// Fail first 2 attempts with TransactionConflict
-				return nil, &types.TransactionCanceledException{
-					CancellationReasons: []types.CancellationReason{
-						{Code: stringPtr("TransactionConflict")},
-						{Code: stringPtr("None")},
-					},
-				}
+			return nil, &types.TransactionCanceledException{
+				CancellationReasons: []types.CancellationReason{
+					{Code: stringPtr("ConditionalCheckFailed")},
+					{Code: stringPtr("None")},
+				},
 			}
-			// Third attempt succeeds
-			return &dynamodb.TransactWriteItemsOutput{}, nil
+		},
+		GetItemFunc: func(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+			return &dynamodb.GetItemOutput{
+				Item: map[string]types.AttributeValue{
+					"pendingAllocationsCount": &types.AttributeValueMemberN{Value: "2"},
+					"maxPendingAllocations":   &types.AttributeValueMemberN{Value: "2"},
+					"quotaRemaining":          &types.AttributeValueMemberN{Value: "1000000"},
+				},
+			}, nil
 		},
 	}
 	store := NewDynamoDBStore(client, "test-table")
 
 	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
-		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false)
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
+
+	allocErr, ok := err.(*AllocationError)
+	if !ok {
+		t.Fatalf("expected AllocationError, got %T: %v", err, err)
+	}
+	if allocErr.Type != "tooManyPending" || !strings.Contains(allocErr.Message, "(2/2)") {
+		t.Errorf("expected tooManyPending against the account limit, got %s: %s", allocErr.Type, allocErr.Message)
+	}
+}
 
+// stubKMSClient hands out a fixed data key
+type stubKMSClient struct{}
+
+func (stubKMSClient) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]string) ([]byte, []byte, error) {
+	return make([]byte, 32), []byte("wrapped"), nil
+}
+
+func (stubKMSClient) Decrypt(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]string) ([]byte, error) {
+	return make([]byte, 32), nil
+}
+
+func TestAllocateBlob_WithEncryption_SealsContentType(t *testing.T) {
+	client := &CapturingDynamoDBClient{}
+	envelope := blobcrypt.NewEnvelope(stubKMSClient{}, "alias/blob-metadata", blobcrypt.DefaultAttributes)
+	store := NewDynamoDBStore(client, "test-table").WithEncryption(envelope)
+
+	err := store.AllocateBlob(ctx(), "account-1", "blob-1", 1024, "application/pdf",
+		time.Now().Add(15*time.Minute), 4, "account-1/blob-1", false, "", false, "", nil, nil, "", 0)
 	if err != nil {
-		t.Fatalf("expected success after retries, got error: %v", err)
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	putItem := client.LastTransactInput.TransactItems[1].Put.Item
+	if _, ok := putItem["contentType"]; ok {
+		t.Error("expected contentType to be sealed")
 	}
-	if callCount != 3 {
-		t.Errorf("expected 3 calls (1 initial + 2 retries), got %d", callCount)
+	if _, ok := putItem[blobcrypt.AttrSealed]; !ok {
+		t.Errorf("expected %s attribute, got %v", blobcrypt.AttrSealed, putItem)
 	}
 
-	// Verify exponential backoff: delays should be ~50ms, ~100ms
-	if len(callTimes) >= 2 {
-		delay1 := callTimes[1].Sub(callTimes[0])
-		if delay1 < 40*time.Millisecond || delay1 > 70*time.Millisecond {
-			t.Errorf("expected first retry delay ~50ms, got %v", delay1)
-		}
+	// Other attributes stay readable for the cleanup GSI and quota handling
+	if _, ok := putItem["gsi1sk"]; !ok {
+		t.Error("expected gsi1sk to stay in plaintext")
 	}
-	if len(callTimes) >= 3 {
-		delay2 := callTimes[2].Sub(callTimes[1])
-		if delay2 < 80*time.Millisecond || delay2 > 130*time.Millisecond {
-			t.Errorf("expected second retry delay ~100ms, got %v", delay2)
-		}
+	if err := envelope.Open(ctx(), putItem); err != nil {
+		t.Fatalf("failed to open sealed record: %v", err)
+	}
+	if ct := putItem["contentType"].(*types.AttributeValueMemberS).Value; ct != "application/pdf" {
+		t.Errorf("expected contentType to round trip, got %s", ct)
 	}
 }
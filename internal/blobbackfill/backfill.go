@@ -0,0 +1,288 @@
+// Package blobbackfill registers objects already in S3 as blobs of an
+// account, for operators migrating content from another system. Each object
+// is copied within S3 into the blob bucket, so no data passes through the
+// caller, and goes through the same reserve, store and confirm steps as a
+// direct upload: its size is charged to the account's quota, and its object
+// tagged confirmed.
+//
+// A blob's ID is derived from the account and the source bucket and key, so
+// importing the same manifest again skips the objects already registered
+// and finishes any a previous run left pending.
+package blobbackfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+var logger = loglevel.New()
+
+// MaxBatchBytes is the most bytes a single Import copies, so a batch
+// finishes within API Gateway's timeout. Larger objects are rejected; an
+// object that would take a batch over it is deferred to a later one.
+const MaxBatchBytes = 512 * 1024 * 1024
+
+// reservationTTL is how long an object's quota reservation is held before
+// blob-alloc-cleanup may reclaim it, long enough for the largest copy
+const reservationTTL = 15 * time.Minute
+
+// defaultContentType is the type of objects with none of their own whose
+// content is not recognised
+const defaultContentType = "application/octet-stream"
+
+// namespace derives blob IDs from source objects (see BlobID)
+var namespace = uuid.MustParse("6f1d4c36-2b7e-4d55-9a59-3c8f0e2b1a47")
+
+// ErrSourceNotFound is returned by Storage for a source object that does not
+// exist
+var ErrSourceNotFound = errors.New("source object not found")
+
+// Object is a manifest entry naming an existing object to register.
+// ContentType overrides the object's own type.
+type Object struct {
+	Bucket      string `json:"bucket"`
+	Key         string `json:"key"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Result reports how an object was registered. Existing is set for an
+// object registered by an earlier import; Error is set instead of the blob
+// for one that could not be.
+type Result struct {
+	Bucket      string       `json:"bucket"`
+	Key         string       `json:"key"`
+	BlobID      string       `json:"blobId,omitempty"`
+	Size        int64        `json:"size,omitempty"`
+	ContentType string       `json:"type,omitempty"`
+	Existing    bool         `json:"existing,omitempty"`
+	Error       *ResultError `json:"error,omitempty"`
+}
+
+// ResultError describes why an object was not registered
+type ResultError struct {
+	Type        string `json:"type"`
+	Description string `json:"description"`
+}
+
+// SourceInfo is a source object's size and type
+type SourceInfo struct {
+	Size        int64
+	ContentType string
+}
+
+// DB handles blob records and the account quota
+type DB interface {
+	GetBlobInfo(ctx context.Context, accountID, blobID string) (*blobmeta.Info, error)
+	GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error)
+	ReserveBlob(ctx context.Context, record blobmeta.Record, expiresAt time.Time) error
+	ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error
+	CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error
+}
+
+// Storage reads source objects and copies them into the blob bucket
+type Storage interface {
+	// Head returns a source object's size and type, or ErrSourceNotFound
+	Head(ctx context.Context, bucket, key string) (*SourceInfo, error)
+	// ReadHead returns up to the first n bytes of a source object
+	ReadHead(ctx context.Context, bucket, key string, n int64) ([]byte, error)
+	// Copy copies a source object to the blob's key, tagged pending
+	Copy(ctx context.Context, bucket, key, accountID, blobID, contentType string) error
+	// ConfirmTag tags a copied blob confirmed
+	ConfirmTag(ctx context.Context, accountID, blobID string) error
+}
+
+// Handler imports manifests of existing objects
+type Handler struct {
+	DB      DB
+	Storage Storage
+}
+
+// BlobID returns the blob ID an object is registered under in an account
+func BlobID(accountID, bucket, key string) string {
+	return uuid.NewSHA1(namespace, []byte(accountID+"\x00"+bucket+"\x00"+key)).String()
+}
+
+// Import registers each object as a blob of the account, in order, and
+// returns a result for each. An object that fails does not stop the others.
+// Once MaxBatchBytes have been copied, objects that need copying are
+// reported as deferred; the first object copied is never deferred.
+// Returns store.ErrAccountNotProvisioned, and no results, if the account does
+// not exist.
+func (h *Handler) Import(ctx context.Context, accountID string, objects []Object) ([]Result, error) {
+	results := make([]Result, 0, len(objects))
+	var copied int64
+	for _, object := range objects {
+		result, copiedSize, err := h.importObject(ctx, accountID, object, MaxBatchBytes-copied)
+		copied += copiedSize
+		if errors.Is(err, store.ErrAccountNotProvisioned) {
+			return nil, err
+		}
+		if err != nil {
+			result.Error = &ResultError{Type: "serverFail", Description: err.Error()}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// importObject registers a single object, copying it only if it fits in
+// remaining bytes, and returns the bytes copied. A ResultError in the result
+// is an object that cannot be registered now; an error is a failure that may
+// succeed if the object is imported again.
+func (h *Handler) importObject(ctx context.Context, accountID string, object Object, remaining int64) (Result, int64, error) {
+	result := Result{Bucket: object.Bucket, Key: object.Key}
+	if object.Bucket == "" || object.Key == "" {
+		result.Error = &ResultError{Type: "invalidArguments", Description: "bucket and key are required"}
+		return result, 0, nil
+	}
+	blobID := BlobID(accountID, object.Bucket, object.Key)
+	result.BlobID = blobID
+
+	info, err := h.DB.GetBlobInfo(ctx, accountID, blobID)
+	if err != nil {
+		return result, 0, fmt.Errorf("failed to read blob record: %w", err)
+	}
+	if info != nil {
+		return h.resume(ctx, accountID, object, result, info, remaining)
+	}
+
+	source, err := h.Storage.Head(ctx, object.Bucket, object.Key)
+	if errors.Is(err, ErrSourceNotFound) {
+		result.Error = &ResultError{Type: "notFound", Description: "Source object not found"}
+		return result, 0, nil
+	}
+	if err != nil {
+		return result, 0, fmt.Errorf("failed to read source object: %w", err)
+	}
+	if source.Size > MaxBatchBytes {
+		result.Error = &ResultError{Type: "tooLarge", Description: fmt.Sprintf("Objects over %d bytes cannot be backfilled", int64(MaxBatchBytes))}
+		return result, 0, nil
+	}
+	if source.Size > remaining {
+		result.Error = deferred()
+		return result, 0, nil
+	}
+	contentType, err := h.contentType(ctx, object, source)
+	if err != nil {
+		return result, 0, err
+	}
+	result.Size = source.Size
+	result.ContentType = contentType
+
+	record := blobmeta.Record{
+		BlobID:      blobID,
+		AccountID:   accountID,
+		Size:        source.Size,
+		ContentType: contentType,
+		S3Key:       blobstore.Key(accountID, blobID),
+		CreatedAt:   time.Now().UTC().Format(time.RFC3339),
+	}
+	if err := h.DB.ReserveBlob(ctx, record, time.Now().Add(reservationTTL)); err != nil {
+		if errors.Is(err, store.ErrOverQuota) {
+			result.Error = &ResultError{Type: "overQuota", Description: "Account quota exceeded"}
+			return result, 0, nil
+		}
+		return result, 0, err
+	}
+
+	if err := h.Storage.Copy(ctx, object.Bucket, object.Key, accountID, blobID, contentType); err != nil {
+		if err := h.DB.CleanupAllocation(ctx, accountID, blobID, source.Size, true); err != nil {
+			// blob-alloc-cleanup releases it once the reservation expires
+			logger.ErrorContext(ctx, "Failed to release quota reservation",
+				slog.String("account_id", accountID),
+				slog.String("blob_id", blobID),
+				slog.String("error", err.Error()),
+			)
+		}
+		if errors.Is(err, ErrSourceNotFound) {
+			result.Error = &ResultError{Type: "notFound", Description: "Source object not found"}
+			return result, 0, nil
+		}
+		return result, 0, fmt.Errorf("failed to copy object: %w", err)
+	}
+	return result, source.Size, h.confirm(ctx, accountID, blobID, source.Size)
+}
+
+// resume handles an object whose blob record already exists: a confirmed
+// blob is reported as existing, and a pending one, left by an import that
+// stopped part way, is copied again and confirmed
+func (h *Handler) resume(ctx context.Context, accountID string, object Object, result Result, info *blobmeta.Info, remaining int64) (Result, int64, error) {
+	record, err := h.DB.GetBlob(ctx, accountID, result.BlobID)
+	if err != nil {
+		return result, 0, fmt.Errorf("failed to read blob record: %w", err)
+	}
+	if record == nil {
+		return result, 0, fmt.Errorf("blob record removed during import")
+	}
+	result.Size = record.Size
+	result.ContentType = record.ContentType
+	if record.DeletedAt != "" {
+		result.Error = &ResultError{Type: "alreadyExists", Description: "The blob for this object was deleted"}
+		return result, 0, nil
+	}
+	if info.Status != store.StatusPending {
+		result.Existing = true
+		return result, 0, nil
+	}
+	if record.Size > remaining && remaining < MaxBatchBytes {
+		result.Error = deferred()
+		return result, 0, nil
+	}
+
+	if err := h.Storage.Copy(ctx, object.Bucket, object.Key, accountID, result.BlobID, record.ContentType); err != nil {
+		if errors.Is(err, ErrSourceNotFound) {
+			result.Error = &ResultError{Type: "notFound", Description: "Source object not found"}
+			return result, 0, nil
+		}
+		return result, 0, fmt.Errorf("failed to copy object: %w", err)
+	}
+	return result, record.Size, h.confirm(ctx, accountID, result.BlobID, record.Size)
+}
+
+// deferred is the error of an object left for a later batch because this
+// one has copied MaxBatchBytes
+func deferred() *ResultError {
+	return &ResultError{Type: "deferred", Description: "Batch byte limit reached; send the object in a later request"}
+}
+
+// confirm tags a copied blob confirmed, then confirms its record, in the
+// order blob-upload uses so the object is protected before the record says
+// it exists
+func (h *Handler) confirm(ctx context.Context, accountID, blobID string, size int64) error {
+	if err := h.Storage.ConfirmTag(ctx, accountID, blobID); err != nil {
+		return fmt.Errorf("failed to tag object: %w", err)
+	}
+	if err := h.DB.ConfirmBlob(ctx, accountID, blobID, size, false, true); err != nil {
+		return fmt.Errorf("failed to confirm blob: %w", err)
+	}
+	return nil
+}
+
+// contentType returns the type to register an object with: the manifest's,
+// else the object's own, else one sniffed from its content
+func (h *Handler) contentType(ctx context.Context, object Object, source *SourceInfo) (string, error) {
+	if object.ContentType != "" {
+		return object.ContentType, nil
+	}
+	if source.ContentType != "" && source.ContentType != defaultContentType {
+		return source.ContentType, nil
+	}
+	if source.Size == 0 {
+		return defaultContentType, nil
+	}
+	head, err := h.Storage.ReadHead(ctx, object.Bucket, object.Key, sniff.HeadSize)
+	if err != nil {
+		return "", fmt.Errorf("failed to read source object: %w", err)
+	}
+	return sniff.Check("", head).Detected, nil
+}
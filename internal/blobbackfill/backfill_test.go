@@ -0,0 +1,308 @@
+package blobbackfill
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/fakes"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// The fake table satisfies DB
+var _ DB = (*fakes.Table)(nil)
+
+// mockStorage implements Storage for testing, holding source objects by
+// bucket and key and recording the blobs copied and tagged
+type mockStorage struct {
+	sources  map[string]*SourceInfo
+	body     []byte
+	copied   map[string]string
+	tagged   []string
+	headErr  error
+	copyErr  error
+	tagErr   error
+	headRead bool
+}
+
+func newMockStorage() *mockStorage {
+	return &mockStorage{sources: make(map[string]*SourceInfo), copied: make(map[string]string)}
+}
+
+func (m *mockStorage) Head(ctx context.Context, bucket, key string) (*SourceInfo, error) {
+	if m.headErr != nil {
+		return nil, m.headErr
+	}
+	source, ok := m.sources[bucket+"/"+key]
+	if !ok {
+		return nil, ErrSourceNotFound
+	}
+	return source, nil
+}
+
+func (m *mockStorage) ReadHead(ctx context.Context, bucket, key string, n int64) ([]byte, error) {
+	m.headRead = true
+	return m.body, nil
+}
+
+func (m *mockStorage) Copy(ctx context.Context, bucket, key, accountID, blobID, contentType string) error {
+	if m.copyErr != nil {
+		return m.copyErr
+	}
+	m.copied[accountID+"/"+blobID] = contentType
+	return nil
+}
+
+func (m *mockStorage) ConfirmTag(ctx context.Context, accountID, blobID string) error {
+	if m.tagErr != nil {
+		return m.tagErr
+	}
+	m.tagged = append(m.tagged, accountID+"/"+blobID)
+	return nil
+}
+
+func newHandler(quota int64) (*Handler, *fakes.Table, *mockStorage) {
+	table := fakes.NewTable()
+	table.PutAccount(account.Meta{AccountID: "user-1", QuotaRemaining: quota})
+	storage := newMockStorage()
+	return &Handler{DB: table, Storage: storage}, table, storage
+}
+
+func TestBlobID_Deterministic(t *testing.T) {
+	id := BlobID("user-1", "archive", "mail/1.eml")
+	if id != BlobID("user-1", "archive", "mail/1.eml") {
+		t.Error("expected the same object to get the same blob ID")
+	}
+	if id == BlobID("user-2", "archive", "mail/1.eml") || id == BlobID("user-1", "archive", "mail/2.eml") {
+		t.Error("expected different accounts and objects to get different blob IDs")
+	}
+}
+
+func TestImport_RegistersObject(t *testing.T) {
+	h, table, storage := newHandler(1000)
+	storage.sources["archive/mail/1.eml"] = &SourceInfo{Size: 100, ContentType: "message/rfc822"}
+
+	results, err := h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "mail/1.eml"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || results[0].Error != nil {
+		t.Fatalf("expected one registered object, got %+v", results)
+	}
+	result := results[0]
+	if result.BlobID != BlobID("user-1", "archive", "mail/1.eml") || result.Size != 100 || result.ContentType != "message/rfc822" {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	blob, _ := table.Blob("user-1", result.BlobID)
+	if blob.Status != store.StatusConfirmed || !blob.IAMAuth {
+		t.Errorf("expected a confirmed record, got %+v", blob)
+	}
+	if meta, _ := table.Account("user-1"); meta.QuotaRemaining != 900 {
+		t.Errorf("expected the size charged to quota, got %d remaining", meta.QuotaRemaining)
+	}
+	if storage.copied["user-1/"+result.BlobID] != "message/rfc822" || len(storage.tagged) != 1 {
+		t.Errorf("expected the object copied and tagged confirmed, got %v %v", storage.copied, storage.tagged)
+	}
+}
+
+func TestImport_SecondRunReportsExisting(t *testing.T) {
+	h, table, storage := newHandler(1000)
+	storage.sources["archive/a"] = &SourceInfo{Size: 100, ContentType: "text/plain"}
+	objects := []Object{{Bucket: "archive", Key: "a"}}
+
+	if _, err := h.Import(context.Background(), "user-1", objects); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	results, err := h.Import(context.Background(), "user-1", objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !results[0].Existing || results[0].Size != 100 || results[0].ContentType != "text/plain" {
+		t.Errorf("expected the blob reported as existing, got %+v", results[0])
+	}
+	if meta, _ := table.Account("user-1"); meta.QuotaRemaining != 900 {
+		t.Errorf("expected quota charged once, got %d remaining", meta.QuotaRemaining)
+	}
+	if len(storage.tagged) != 1 {
+		t.Errorf("expected the object copied once, got %v", storage.tagged)
+	}
+}
+
+func TestImport_ResumesPendingBlob(t *testing.T) {
+	h, table, storage := newHandler(1000)
+	blobID := BlobID("user-1", "archive", "a")
+	table.PutBlob(fakes.Blob{
+		Record: blobmeta.Record{AccountID: "user-1", BlobID: blobID, Size: 100, ContentType: "text/plain"},
+		Status: fakes.StatusPending,
+	})
+
+	results, err := h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Error != nil || results[0].Existing {
+		t.Fatalf("expected the pending blob to be finished, got %+v", results[0])
+	}
+	if blob, _ := table.Blob("user-1", blobID); blob.Status != store.StatusConfirmed {
+		t.Errorf("expected the record confirmed, got %q", blob.Status)
+	}
+	if storage.copied["user-1/"+blobID] != "text/plain" {
+		t.Errorf("expected the object copied with the reserved type, got %v", storage.copied)
+	}
+}
+
+func TestImport_DeletedBlob(t *testing.T) {
+	h, table, _ := newHandler(1000)
+	blobID := BlobID("user-1", "archive", "a")
+	table.PutBlob(fakes.Blob{
+		Record: blobmeta.Record{AccountID: "user-1", BlobID: blobID, Size: 100, DeletedAt: "2024-01-01T00:00:00Z"},
+		Status: store.StatusConfirmed,
+	})
+
+	results, _ := h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "a"}})
+	if results[0].Error == nil || results[0].Error.Type != "alreadyExists" {
+		t.Errorf("expected alreadyExists, got %+v", results[0])
+	}
+}
+
+func TestImport_ContentType(t *testing.T) {
+	tests := []struct {
+		name     string
+		object   Object
+		source   SourceInfo
+		expected string
+		sniffed  bool
+	}{
+		{"manifest", Object{ContentType: "text/calendar"}, SourceInfo{Size: 10, ContentType: "text/plain"}, "text/calendar", false},
+		{"object", Object{}, SourceInfo{Size: 10, ContentType: "text/plain"}, "text/plain", false},
+		{"sniffed", Object{}, SourceInfo{Size: 10, ContentType: "application/octet-stream"}, "application/pdf", true},
+		{"empty", Object{}, SourceInfo{}, "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, _, storage := newHandler(1000)
+			storage.sources["archive/a"] = &tt.source
+			storage.body = []byte("%PDF-1.7\n")
+			tt.object.Bucket, tt.object.Key = "archive", "a"
+
+			results, _ := h.Import(context.Background(), "user-1", []Object{tt.object})
+			if results[0].ContentType != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, results[0].ContentType)
+			}
+			if storage.headRead != tt.sniffed {
+				t.Errorf("expected content read %v, got %v", tt.sniffed, storage.headRead)
+			}
+		})
+	}
+}
+
+func TestImport_RejectedObjects(t *testing.T) {
+	h, _, storage := newHandler(100)
+	storage.sources["archive/big"] = &SourceInfo{Size: MaxBatchBytes + 1, ContentType: "text/plain"}
+	storage.sources["archive/over"] = &SourceInfo{Size: 101, ContentType: "text/plain"}
+
+	results, err := h.Import(context.Background(), "user-1", []Object{
+		{Bucket: "archive"},
+		{Bucket: "archive", Key: "missing"},
+		{Bucket: "archive", Key: "big"},
+		{Bucket: "archive", Key: "over"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for i, expected := range []string{"invalidArguments", "notFound", "tooLarge", "overQuota"} {
+		if results[i].Error == nil || results[i].Error.Type != expected {
+			t.Errorf("object %d: expected %s, got %+v", i, expected, results[i])
+		}
+	}
+	if len(storage.copied) != 0 {
+		t.Errorf("expected nothing copied, got %v", storage.copied)
+	}
+}
+
+func TestImport_DefersObjectsOverBatchBytes(t *testing.T) {
+	h, _, storage := newHandler(2 * MaxBatchBytes)
+	storage.sources["archive/a"] = &SourceInfo{Size: MaxBatchBytes - 100, ContentType: "text/plain"}
+	storage.sources["archive/b"] = &SourceInfo{Size: 200, ContentType: "text/plain"}
+	storage.sources["archive/c"] = &SourceInfo{Size: 100, ContentType: "text/plain"}
+
+	objects := []Object{{Bucket: "archive", Key: "a"}, {Bucket: "archive", Key: "b"}, {Bucket: "archive", Key: "c"}}
+	results, err := h.Import(context.Background(), "user-1", objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Error != nil || results[2].Error != nil {
+		t.Errorf("expected the objects within the limit registered, got %+v", results)
+	}
+	if results[1].Error == nil || results[1].Error.Type != "deferred" {
+		t.Errorf("expected the object over the limit deferred, got %+v", results[1])
+	}
+	if len(storage.copied) != 2 {
+		t.Errorf("expected two objects copied, got %v", storage.copied)
+	}
+
+	// Sent again, the deferred object is copied
+	results, err = h.Import(context.Background(), "user-1", objects)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[1].Error != nil || results[1].Existing {
+		t.Errorf("expected the deferred object registered, got %+v", results[1])
+	}
+}
+
+func TestImport_CopyFailureReleasesReservation(t *testing.T) {
+	h, table, storage := newHandler(1000)
+	storage.sources["archive/a"] = &SourceInfo{Size: 100, ContentType: "text/plain"}
+	storage.copyErr = errors.New("slow down")
+
+	results, err := h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if results[0].Error == nil || results[0].Error.Type != "serverFail" {
+		t.Errorf("expected serverFail, got %+v", results[0])
+	}
+	if _, ok := table.Blob("user-1", results[0].BlobID); ok {
+		t.Error("expected the reservation removed")
+	}
+	if meta, _ := table.Account("user-1"); meta.QuotaRemaining != 1000 {
+		t.Errorf("expected quota restored, got %d remaining", meta.QuotaRemaining)
+	}
+}
+
+func TestImport_TagFailureLeavesBlobPending(t *testing.T) {
+	h, table, storage := newHandler(1000)
+	storage.sources["archive/a"] = &SourceInfo{Size: 100, ContentType: "text/plain"}
+	storage.tagErr = errors.New("slow down")
+
+	results, _ := h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "a"}})
+	if results[0].Error == nil || results[0].Error.Type != "serverFail" {
+		t.Fatalf("expected serverFail, got %+v", results[0])
+	}
+	if blob, _ := table.Blob("user-1", results[0].BlobID); blob.Status != store.StatusPending {
+		t.Errorf("expected the record left pending for a re-run, got %q", blob.Status)
+	}
+
+	storage.tagErr = nil
+	results, _ = h.Import(context.Background(), "user-1", []Object{{Bucket: "archive", Key: "a"}})
+	if results[0].Error != nil {
+		t.Fatalf("expected the re-run to finish the blob, got %+v", results[0])
+	}
+	if blob, _ := table.Blob("user-1", results[0].BlobID); blob.Status != store.StatusConfirmed {
+		t.Errorf("expected the record confirmed, got %q", blob.Status)
+	}
+}
+
+func TestImport_AccountNotProvisioned(t *testing.T) {
+	h, _, storage := newHandler(1000)
+	storage.sources["archive/a"] = &SourceInfo{Size: 100, ContentType: "text/plain"}
+
+	_, err := h.Import(context.Background(), "user-2", []Object{{Bucket: "archive", Key: "a"}})
+	if !errors.Is(err, store.ErrAccountNotProvisioned) {
+		t.Errorf("expected ErrAccountNotProvisioned, got %v", err)
+	}
+}
@@ -0,0 +1,109 @@
+package blobbackfill
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+)
+
+// S3Client defines the interface for S3 operations needed by blobbackfill
+type S3Client interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+}
+
+// S3Storage implements Storage using AWS S3
+type S3Storage struct {
+	client     S3Client
+	bucketName string
+}
+
+// NewS3Storage creates a new S3Storage copying into the blob bucket
+func NewS3Storage(client S3Client, bucketName string) *S3Storage {
+	return &S3Storage{client: client, bucketName: bucketName}
+}
+
+// Head returns a source object's size and type
+func (s *S3Storage) Head(ctx context.Context, bucket, key string) (*SourceInfo, error) {
+	output, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	return &SourceInfo{
+		Size:        aws.ToInt64(output.ContentLength),
+		ContentType: aws.ToString(output.ContentType),
+	}, nil
+}
+
+// ReadHead returns up to the first n bytes of a source object
+func (s *S3Storage) ReadHead(ctx context.Context, bucket, key string, n int64) ([]byte, error) {
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, sourceError(err)
+	}
+	defer output.Body.Close()
+	return io.ReadAll(io.LimitReader(output.Body, n))
+}
+
+// Copy copies a source object to the blob's key with the given type, tagged
+// pending so the pending-blob lifecycle rule removes it if the blob is never
+// confirmed
+func (s *S3Storage) Copy(ctx context.Context, bucket, key, accountID, blobID, contentType string) error {
+	_, err := s.client.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(s.bucketName),
+		Key:               aws.String(blobstore.Key(accountID, blobID)),
+		CopySource:        aws.String(bucket + "/" + (&url.URL{Path: key}).EscapedPath()),
+		ContentType:       aws.String(contentType),
+		MetadataDirective: s3types.MetadataDirectiveReplace,
+		TaggingDirective:  s3types.TaggingDirectiveReplace,
+		Tagging:           aws.String(fmt.Sprintf("Account=%s&Status=%s", url.QueryEscape(accountID), blobstore.StatusPending)),
+	})
+	if err != nil {
+		return sourceError(err)
+	}
+	return nil
+}
+
+// ConfirmTag replaces a copied blob's tags with confirmed ones
+func (s *S3Storage) ConfirmTag(ctx context.Context, accountID, blobID string) error {
+	_, err := s.client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket: aws.String(s.bucketName),
+		Key:    aws.String(blobstore.Key(accountID, blobID)),
+		Tagging: &s3types.Tagging{TagSet: []s3types.Tag{
+			{Key: aws.String("Account"), Value: aws.String(accountID)},
+			{Key: aws.String("Status"), Value: aws.String(blobstore.StatusConfirmed)},
+		}},
+	})
+	return err
+}
+
+// sourceError maps S3's not-found errors for a source object to
+// ErrSourceNotFound. HeadObject reports a missing object as NotFound, and
+// GetObject and CopyObject as NoSuchKey.
+func sourceError(err error) error {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "NotFound", "NoSuchKey":
+			return ErrSourceNotFound
+		}
+	}
+	return err
+}
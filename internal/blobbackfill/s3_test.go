@@ -0,0 +1,124 @@
+package blobbackfill
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+type mockS3Client struct {
+	headErr      error
+	getInput     *s3.GetObjectInput
+	copyInput    *s3.CopyObjectInput
+	copyErr      error
+	taggingInput *s3.PutObjectTaggingInput
+}
+
+func (m *mockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.headErr != nil {
+		return nil, m.headErr
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(42), ContentType: aws.String("text/plain")}, nil
+}
+
+func (m *mockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.getInput = params
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("hello"))}, nil
+}
+
+func (m *mockS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	m.copyInput = params
+	if m.copyErr != nil {
+		return nil, m.copyErr
+	}
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *mockS3Client) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	m.taggingInput = params
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func TestS3Storage_Head(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "blobs")
+
+	info, err := storage.Head(context.Background(), "archive", "a")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Size != 42 || info.ContentType != "text/plain" {
+		t.Errorf("unexpected info %+v", info)
+	}
+
+	client.headErr = &smithy.GenericAPIError{Code: "NotFound"}
+	if _, err := storage.Head(context.Background(), "archive", "a"); !errors.Is(err, ErrSourceNotFound) {
+		t.Errorf("expected ErrSourceNotFound, got %v", err)
+	}
+}
+
+func TestS3Storage_ReadHead(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "blobs")
+
+	head, err := storage.ReadHead(context.Background(), "archive", "a", 512)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(head) != "hello" {
+		t.Errorf("unexpected content %q", head)
+	}
+	if aws.ToString(client.getInput.Range) != "bytes=0-511" {
+		t.Errorf("expected a ranged read, got %q", aws.ToString(client.getInput.Range))
+	}
+}
+
+func TestS3Storage_Copy(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "blobs")
+
+	if err := storage.Copy(context.Background(), "archive", "mail/a b.eml", "user-1", "blob-1", "message/rfc822"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := client.copyInput
+	if aws.ToString(input.Bucket) != "blobs" || aws.ToString(input.Key) != "user-1/blob-1" {
+		t.Errorf("expected copy to blobs/user-1/blob-1, got %s/%s", aws.ToString(input.Bucket), aws.ToString(input.Key))
+	}
+	if aws.ToString(input.CopySource) != "archive/mail/a%20b.eml" {
+		t.Errorf("expected an escaped copy source, got %q", aws.ToString(input.CopySource))
+	}
+	if aws.ToString(input.ContentType) != "message/rfc822" || input.MetadataDirective != s3types.MetadataDirectiveReplace {
+		t.Errorf("expected the content type replaced, got %q", aws.ToString(input.ContentType))
+	}
+	if aws.ToString(input.Tagging) != "Account=user-1&Status=pending" || input.TaggingDirective != s3types.TaggingDirectiveReplace {
+		t.Errorf("expected the copy tagged pending, got %q", aws.ToString(input.Tagging))
+	}
+
+	client.copyErr = &smithy.GenericAPIError{Code: "NoSuchKey"}
+	if err := storage.Copy(context.Background(), "archive", "a", "user-1", "blob-1", "text/plain"); !errors.Is(err, ErrSourceNotFound) {
+		t.Errorf("expected ErrSourceNotFound, got %v", err)
+	}
+}
+
+func TestS3Storage_ConfirmTag(t *testing.T) {
+	client := &mockS3Client{}
+	storage := NewS3Storage(client, "blobs")
+
+	if err := storage.ConfirmTag(context.Background(), "user-1", "blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tags := map[string]string{}
+	for _, tag := range client.taggingInput.Tagging.TagSet {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	if aws.ToString(client.taggingInput.Key) != "user-1/blob-1" || tags["Account"] != "user-1" || tags["Status"] != "confirmed" {
+		t.Errorf("unexpected tagging %s %v", aws.ToString(client.taggingInput.Key), tags)
+	}
+}
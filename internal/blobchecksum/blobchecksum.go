@@ -0,0 +1,61 @@
+// Package blobchecksum handles the SHA-256 checksums clients declare for
+// blob uploads, in the base64 form S3 takes in x-amz-checksum-sha256. A
+// multipart upload's checksum is S3's composite: the base64 SHA-256 of its
+// parts' digests, followed by "-" and the number of parts.
+package blobchecksum
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalid is returned for a checksum that is not a base64 SHA-256 digest,
+// or for a multipart upload, a composite one
+var ErrInvalid = errors.New("invalid SHA-256 checksum")
+
+// Valid reports whether checksum is the base64 SHA-256 of a whole object
+func Valid(checksum string) bool {
+	digest, err := base64.StdEncoding.DecodeString(checksum)
+	return err == nil && len(digest) == sha256.Size
+}
+
+// ParseComposite returns the number of parts a composite checksum covers
+func ParseComposite(checksum string) (int, error) {
+	digest, count, ok := strings.Cut(checksum, "-")
+	if !ok || !Valid(digest) {
+		return 0, ErrInvalid
+	}
+	parts, err := strconv.Atoi(count)
+	if err != nil || parts < 1 || strconv.Itoa(parts) != count {
+		return 0, ErrInvalid
+	}
+	return parts, nil
+}
+
+// Composite returns the composite checksum of a multipart upload from its
+// parts' checksums, in part order
+func Composite(parts []string) (string, error) {
+	h := sha256.New()
+	for i, part := range parts {
+		digest, err := base64.StdEncoding.DecodeString(part)
+		if err != nil || len(digest) != sha256.Size {
+			return "", fmt.Errorf("part %d: %w", i+1, ErrInvalid)
+		}
+		h.Write(digest)
+	}
+	return fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(parts)), nil
+}
+
+// Sum returns the checksum of r's content
+func Sum(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
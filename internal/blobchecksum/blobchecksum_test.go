@@ -0,0 +1,66 @@
+package blobchecksum
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func sum(s string) string {
+	digest := sha256.Sum256([]byte(s))
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+func TestValid(t *testing.T) {
+	if !Valid(sum("hello")) {
+		t.Error("expected a SHA-256 digest to be valid")
+	}
+	for _, checksum := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("short")), sum("hello") + "-2"} {
+		if Valid(checksum) {
+			t.Errorf("expected %q to be invalid", checksum)
+		}
+	}
+}
+
+func TestParseComposite(t *testing.T) {
+	parts, err := ParseComposite(sum("x") + "-3")
+	if err != nil || parts != 3 {
+		t.Errorf("expected 3 parts, got %d, %v", parts, err)
+	}
+	for _, checksum := range []string{sum("x"), sum("x") + "-0", sum("x") + "-03", sum("x") + "-two", "abc-1"} {
+		if _, err := ParseComposite(checksum); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %q to be invalid, got %v", checksum, err)
+		}
+	}
+}
+
+func TestComposite(t *testing.T) {
+	// The digest of the parts' binary digests, as S3 computes it
+	first := sha256.Sum256([]byte("part one"))
+	second := sha256.Sum256([]byte("part two"))
+	want := sha256.Sum256(append(first[:], second[:]...))
+
+	got, err := Composite([]string{sum("part one"), sum("part two")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != base64.StdEncoding.EncodeToString(want[:])+"-2" {
+		t.Errorf("unexpected composite %s", got)
+	}
+	if _, err := ParseComposite(got); err != nil {
+		t.Errorf("expected the composite to parse, got %v", err)
+	}
+
+	if _, err := Composite([]string{sum("a"), "bad"}); !errors.Is(err, ErrInvalid) || !strings.Contains(err.Error(), "part 2") {
+		t.Errorf("expected part 2 to be invalid, got %v", err)
+	}
+}
+
+func TestSum(t *testing.T) {
+	got, err := Sum(strings.NewReader("hello"))
+	if err != nil || got != sum("hello") {
+		t.Errorf("unexpected sum %s, %v", got, err)
+	}
+}
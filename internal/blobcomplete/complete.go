@@ -3,10 +3,20 @@ package blobcomplete
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"time"
 
 	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
 )
 
+var logger = loglevel.New()
+
 // CompleteRequest is the Blob/complete method request
 type CompleteRequest struct {
 	AccountID string                       `json:"accountId"`
@@ -35,11 +45,16 @@ type BlobRecord struct {
 	Status    string
 	Multipart bool
 	UploadID  string
+	// Checksum is the composite SHA-256 checksum declared at allocation, if any
+	Checksum string
+	// MaxSize is the limit on the assembled blob's size; zero for none
+	MaxSize int64
 }
 
 // Storage handles S3 operations for completing multipart uploads
 type Storage interface {
 	CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error
+	ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error)
 }
 
 // DB handles DynamoDB operations for Blob/complete
@@ -47,10 +62,19 @@ type DB interface {
 	GetBlobForComplete(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
 }
 
+// Outbox records events for the outbox publisher to deliver
+type Outbox interface {
+	Write(ctx context.Context, records []outbox.Record) error
+}
+
 // Handler handles Blob/complete method calls
 type Handler struct {
 	Storage Storage
 	DB      DB
+	// Outbox, when set, receives a blob.upload.part event for each part
+	// assembled. S3 sends no notification as each part is uploaded, so this
+	// is where progress is first known.
+	Outbox Outbox
 }
 
 // Complete processes a Blob/complete request
@@ -70,7 +94,7 @@ func (h *Handler) Complete(ctx context.Context, req CompleteRequest) (*CompleteR
 	}
 
 	// Verify blob is pending
-	if record.Status != "pending" {
+	if record.Status != store.StatusPending {
 		return nil, &CompleteError{Type: "invalidArguments", Message: fmt.Sprintf("blob is not pending (status: %s)", record.Status)}
 	}
 
@@ -84,14 +108,109 @@ func (h *Handler) Complete(ctx context.Context, req CompleteRequest) (*CompleteR
 		return nil, &CompleteError{Type: "serverFail", Message: "blob record missing uploadId"}
 	}
 
+	// A declared checksum must be the composite of the parts' checksums.
+	// S3 checks each part against its own.
+	if record.Checksum != "" {
+		if err := checkParts(record.Checksum, req.Parts); err != nil {
+			return nil, err
+		}
+	}
+
+	// An upload over its size limit is not assembled; its parts are left for
+	// the bucket's lifecycle rule to abort, and its allocation to expire
+	if record.MaxSize > 0 {
+		if err := h.checkSize(ctx, req, record); err != nil {
+			return nil, err
+		}
+	}
+
 	// Complete the multipart upload in S3
 	// This creates the final S3 object, which triggers the S3 ObjectCreated event → blob-confirm
 	if err := h.Storage.CompleteMultipartUpload(ctx, req.AccountID, req.BlobID, record.UploadID, req.Parts); err != nil {
 		return nil, &CompleteError{Type: "serverFail", Message: fmt.Sprintf("failed to complete multipart upload: %v", err)}
 	}
 
+	// The upload is complete whether or not its events are recorded, so a
+	// failure here is logged rather than returned
+	if h.Outbox != nil {
+		if err := h.Outbox.Write(ctx, partEvents(ctx, req)); err != nil {
+			logger.ErrorContext(ctx, "Failed to record upload progress events",
+				slog.String("account_id", req.AccountID),
+				slog.String("blob_id", req.BlobID),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+
 	return &CompleteResponse{
 		AccountID: req.AccountID,
 		BlobID:    req.BlobID,
 	}, nil
 }
+
+// checkSize totals the sizes of the parts being completed and rejects the
+// upload if they exceed the blob's limit
+func (h *Handler) checkSize(ctx context.Context, req CompleteRequest, record *BlobRecord) error {
+	uploaded, err := h.Storage.ListParts(ctx, req.AccountID, req.BlobID, record.UploadID)
+	if err != nil {
+		return &CompleteError{Type: "serverFail", Message: fmt.Sprintf("failed to list parts: %v", err)}
+	}
+	sizes := make(map[int32]int64, len(uploaded))
+	for _, part := range uploaded {
+		sizes[part.PartNumber] = part.Size
+	}
+	var total int64
+	for _, part := range req.Parts {
+		total += sizes[part.PartNumber]
+	}
+	if total > record.MaxSize {
+		return &CompleteError{Type: "tooLarge", Message: fmt.Sprintf("size %d exceeds maximum %d bytes", total, record.MaxSize)}
+	}
+	return nil
+}
+
+// checkParts verifies the parts' checksums against the declared composite
+func checkParts(declared string, parts []bloballocate.CompletedPart) error {
+	checksums := make([]string, len(parts))
+	for i, part := range parts {
+		if part.ChecksumSHA256 == "" {
+			return &CompleteError{Type: "invalidArguments", Message: fmt.Sprintf("part %d is missing checksumSha256", part.PartNumber)}
+		}
+		checksums[i] = part.ChecksumSHA256
+	}
+	composite, err := blobchecksum.Composite(checksums)
+	if err != nil {
+		return &CompleteError{Type: "invalidArguments", Message: fmt.Sprintf("invalid checksumSha256: %v", err)}
+	}
+	if composite != declared {
+		return &CompleteError{Type: "invalidArguments", Message: "part checksums do not match the declared checksumSha256"}
+	}
+	return nil
+}
+
+// partEvents returns a blob.upload.part event for each completed part. Event
+// IDs are derived from the blob and part, so a repeated Blob/complete does
+// not record them twice.
+func partEvents(ctx context.Context, req CompleteRequest) []outbox.Record {
+	occurredAt := time.Now().UTC().Format(time.RFC3339)
+	records := make([]outbox.Record, len(req.Parts))
+	for i, part := range req.Parts {
+		records[i] = outbox.Record{
+			AccountID: req.AccountID,
+			EventID:   fmt.Sprintf("%s-part-%d", req.BlobID, part.PartNumber),
+			Payload: publisher.EventPayload{
+				EventType:  publisher.EventBlobUploadPart,
+				OccurredAt: occurredAt,
+				AccountID:  req.AccountID,
+				Data: map[string]any{
+					"blobId":     req.BlobID,
+					"partNumber": part.PartNumber,
+					"etag":       part.ETag,
+					"partCount":  len(req.Parts),
+				},
+				CorrelationID: correlation.FromContext(ctx),
+			},
+		}
+	}
+	return records
+}
@@ -3,23 +3,34 @@ package blobcomplete
 import (
 	"context"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
 )
 
 // mockStorage implements Storage for testing
 type mockStorage struct {
 	completeFunc func(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error
+	parts        []bloballocate.UploadedPart
+	completed    bool
 }
 
 func (m *mockStorage) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+	m.completed = true
 	if m.completeFunc != nil {
 		return m.completeFunc(ctx, accountID, blobID, uploadID, parts)
 	}
 	return nil
 }
 
+func (m *mockStorage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	return m.parts, nil
+}
+
 // mockDB implements DB for testing
 type mockDB struct {
 	getBlobFunc func(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
@@ -290,3 +301,182 @@ func TestComplete_DBGetError(t *testing.T) {
 		t.Errorf("expected type 'serverFail', got %q", compErr.Type)
 	}
 }
+
+// mockOutbox implements Outbox for testing
+type mockOutbox struct {
+	records []outbox.Record
+	err     error
+}
+
+func (m *mockOutbox) Write(ctx context.Context, records []outbox.Record) error {
+	m.records = append(m.records, records...)
+	return m.err
+}
+
+func pendingMultipartDB() *mockDB {
+	return &mockDB{
+		getBlobFunc: func(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+			return &BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-abc"}, nil
+		},
+	}
+}
+
+func TestComplete_RecordsPartEvents(t *testing.T) {
+	events := &mockOutbox{}
+	h := &Handler{Storage: &mockStorage{}, DB: pendingMultipartDB(), Outbox: events}
+
+	_, err := h.Complete(context.Background(), CompleteRequest{
+		AccountID: "account-1",
+		BlobID:    "blob-1",
+		Parts: []bloballocate.CompletedPart{
+			{PartNumber: 1, ETag: "\"etag1\""},
+			{PartNumber: 2, ETag: "\"etag2\""},
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(events.records) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(events.records))
+	}
+	record := events.records[1]
+	if record.EventID != "blob-1-part-2" || record.Payload.EventType != publisher.EventBlobUploadPart || record.Payload.AccountID != "account-1" {
+		t.Errorf("unexpected event %+v", record)
+	}
+	data := record.Payload.Data
+	if data["blobId"] != "blob-1" || data["partNumber"] != int32(2) || data["etag"] != "\"etag2\"" || data["partCount"] != 2 {
+		t.Errorf("unexpected event data %v", data)
+	}
+}
+
+func TestComplete_EventFailureStillCompletes(t *testing.T) {
+	events := &mockOutbox{err: fmt.Errorf("throttled")}
+	h := &Handler{Storage: &mockStorage{}, DB: pendingMultipartDB(), Outbox: events}
+
+	_, err := h.Complete(context.Background(), CompleteRequest{
+		AccountID: "account-1",
+		BlobID:    "blob-1",
+		Parts:     []bloballocate.CompletedPart{{PartNumber: 1, ETag: "\"etag1\""}},
+	})
+	if err != nil {
+		t.Errorf("expected the completed upload to succeed, got %v", err)
+	}
+}
+
+func TestComplete_NoEventsOnFailure(t *testing.T) {
+	events := &mockOutbox{}
+	storage := &mockStorage{
+		completeFunc: func(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+			return fmt.Errorf("InvalidPart")
+		},
+	}
+	h := &Handler{Storage: storage, DB: pendingMultipartDB(), Outbox: events}
+
+	if _, err := h.Complete(context.Background(), CompleteRequest{
+		AccountID: "account-1",
+		BlobID:    "blob-1",
+		Parts:     []bloballocate.CompletedPart{{PartNumber: 1, ETag: "\"etag1\""}},
+	}); err == nil {
+		t.Fatal("expected error")
+	}
+	if len(events.records) != 0 {
+		t.Errorf("expected no events for a failed completion, got %d", len(events.records))
+	}
+}
+
+func TestComplete_ChecksumMatchesParts(t *testing.T) {
+	first, _ := blobchecksum.Sum(strings.NewReader("part one"))
+	second, _ := blobchecksum.Sum(strings.NewReader("part two"))
+	declared, _ := blobchecksum.Composite([]string{first, second})
+	parts := []bloballocate.CompletedPart{
+		{PartNumber: 1, ETag: "\"etag1\"", ChecksumSHA256: first},
+		{PartNumber: 2, ETag: "\"etag2\"", ChecksumSHA256: second},
+	}
+	swapped := []bloballocate.CompletedPart{
+		{PartNumber: 1, ETag: "\"etag1\"", ChecksumSHA256: second},
+		{PartNumber: 2, ETag: "\"etag2\"", ChecksumSHA256: first},
+	}
+	missing := []bloballocate.CompletedPart{
+		{PartNumber: 1, ETag: "\"etag1\"", ChecksumSHA256: first},
+		{PartNumber: 2, ETag: "\"etag2\""},
+	}
+
+	tests := []struct {
+		name    string
+		parts   []bloballocate.CompletedPart
+		wantErr bool
+	}{
+		{"matching parts", parts, false},
+		{"parts in the wrong order", swapped, true},
+		{"a part without a checksum", missing, true},
+		{"too few parts", parts[:1], true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			completed := false
+			storage := &mockStorage{
+				completeFunc: func(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+					completed = true
+					return nil
+				},
+			}
+			db := &mockDB{
+				getBlobFunc: func(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+					return &BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-abc", Checksum: declared}, nil
+				},
+			}
+			h := &Handler{Storage: storage, DB: db}
+
+			_, err := h.Complete(context.Background(), CompleteRequest{AccountID: "account-1", BlobID: "blob-1", Parts: tt.parts})
+			if !tt.wantErr {
+				if err != nil || !completed {
+					t.Fatalf("expected the upload to complete, got %v", err)
+				}
+				return
+			}
+			completeErr, ok := err.(*CompleteError)
+			if !ok || completeErr.Type != "invalidArguments" {
+				t.Fatalf("expected invalidArguments, got %v", err)
+			}
+			if completed {
+				t.Error("expected the upload not to be completed")
+			}
+		})
+	}
+}
+
+func TestComplete_OverMaxSize_ReturnsTooLarge(t *testing.T) {
+	db := &mockDB{
+		getBlobFunc: func(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+			return &BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-abc", MaxSize: 100}, nil
+		},
+	}
+	storage := &mockStorage{parts: []bloballocate.UploadedPart{
+		{PartNumber: 1, Size: 60},
+		{PartNumber: 2, Size: 60},
+		{PartNumber: 3, Size: 60},
+	}}
+	h := &Handler{Storage: storage, DB: db}
+
+	req := CompleteRequest{AccountID: "account-1", BlobID: "blob-1", Parts: []bloballocate.CompletedPart{
+		{PartNumber: 1, ETag: "\"etag1\""},
+		{PartNumber: 2, ETag: "\"etag2\""},
+	}}
+	_, err := h.Complete(context.Background(), req)
+	compErr, ok := err.(*CompleteError)
+	if !ok || compErr.Type != "tooLarge" {
+		t.Fatalf("expected tooLarge, got %v", err)
+	}
+	if storage.completed {
+		t.Error("expected the upload not to be completed")
+	}
+
+	// Only the parts being completed count towards the size
+	req.Parts = req.Parts[:1]
+	if _, err := h.Complete(context.Background(), req); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !storage.completed {
+		t.Error("expected the upload to be completed")
+	}
+}
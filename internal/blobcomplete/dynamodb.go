@@ -3,10 +3,12 @@ package blobcomplete
 import (
 	"context"
 	"fmt"
+	"strconv"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
 )
 
 // DynamoDBClient defines the interface for DynamoDB operations needed by blobcomplete
@@ -32,12 +34,9 @@ func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
 // Returns nil if the blob record is not found.
 func (d *DynamoDBStore) GetBlobForComplete(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
 	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
-		TableName: aws.String(d.tableName),
-		Key: map[string]types.AttributeValue{
-			"pk": &types.AttributeValueMemberS{Value: fmt.Sprintf("ACCOUNT#%s", accountID)},
-			"sk": &types.AttributeValueMemberS{Value: fmt.Sprintf("BLOB#%s", blobID)},
-		},
-		ProjectionExpression: aws.String("#status, multipart, uploadId"),
+		TableName:            aws.String(d.tableName),
+		Key:                  store.BlobKey(accountID, blobID),
+		ProjectionExpression: aws.String("#status, multipart, uploadId, declaredChecksumSha256, maxSize"),
 		ExpressionAttributeNames: map[string]string{
 			"#status": "status",
 		},
@@ -61,6 +60,16 @@ func (d *DynamoDBStore) GetBlobForComplete(ctx context.Context, accountID, blobI
 	if uidAttr, ok := result.Item["uploadId"].(*types.AttributeValueMemberS); ok {
 		record.UploadID = uidAttr.Value
 	}
+	if checksumAttr, ok := result.Item["declaredChecksumSha256"].(*types.AttributeValueMemberS); ok {
+		record.Checksum = checksumAttr.Value
+	}
+	if maxSizeAttr, ok := result.Item["maxSize"].(*types.AttributeValueMemberN); ok {
+		maxSize, err := strconv.ParseInt(maxSizeAttr.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob maxSize: %w", err)
+		}
+		record.MaxSize = maxSize
+	}
 
 	return record, nil
 }
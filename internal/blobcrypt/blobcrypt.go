@@ -0,0 +1,197 @@
+// Package blobcrypt encrypts selected attributes of blob records with KMS
+// envelope encryption.
+//
+// Each sealed record gets its own AES-256 data key from KMS. The selected
+// attributes are removed from the item, encrypted together with AES-GCM and
+// stored as "sealed", with the KMS-wrapped data key in "sealedKey". The
+// record's pk and sk are bound to both the ciphertext and the data key, so a
+// sealed value cannot be copied onto another record. Records written before
+// encryption was enabled have no "sealed" attribute and are read unchanged.
+package blobcrypt
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+)
+
+// Attribute names used on sealed records
+const (
+	AttrSealed    = "sealed"
+	AttrSealedKey = "sealedKey"
+)
+
+// DefaultAttributes are the blob record attributes sealed when none are configured
+var DefaultAttributes = []string{"contentType", "parent", "name"}
+
+// KMSClient generates and unwraps data keys
+type KMSClient interface {
+	// GenerateDataKey returns a new AES-256 key in plaintext and wrapped under keyID
+	GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]string) (plaintext, ciphertext []byte, err error)
+	// Decrypt unwraps a data key returned by GenerateDataKey
+	Decrypt(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]string) ([]byte, error)
+}
+
+// Envelope seals and opens blob record attributes
+type Envelope struct {
+	client     KMSClient
+	keyID      string
+	attributes []string
+}
+
+// NewEnvelope creates an Envelope that seals the given attributes with data
+// keys from keyID
+func NewEnvelope(client KMSClient, keyID string, attributes []string) *Envelope {
+	return &Envelope{
+		client:     client,
+		keyID:      keyID,
+		attributes: attributes,
+	}
+}
+
+// NewOptionalEnvelope creates an Envelope using the KMS SDK client, or returns nil
+// when keyID is empty so blob records are stored in plaintext. attributes is
+// a comma-separated list as accepted by ParseAttributes.
+func NewOptionalEnvelope(config aws.Config, keyID, attributes string) *Envelope {
+	if keyID == "" {
+		return nil
+	}
+	return NewEnvelope(NewSDKKMSClient(kms.NewFromConfig(config)), keyID, ParseAttributes(attributes))
+}
+
+// ParseAttributes splits a comma-separated attribute list, ignoring blanks.
+// An empty list gives DefaultAttributes.
+func ParseAttributes(value string) []string {
+	var attributes []string
+	for _, attribute := range strings.Split(value, ",") {
+		if attribute = strings.TrimSpace(attribute); attribute != "" {
+			attributes = append(attributes, attribute)
+		}
+	}
+	if len(attributes) == 0 {
+		return DefaultAttributes
+	}
+	return attributes
+}
+
+// Seal moves the envelope's attributes out of item into the sealed
+// attributes. Only string attributes are sealed; an item with none of them
+// is left unchanged.
+func (e *Envelope) Seal(ctx context.Context, item map[string]types.AttributeValue) error {
+	values := make(map[string]string)
+	for _, name := range e.attributes {
+		if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+			values[name] = value.Value
+		}
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	encryptionContext, err := recordContext(item)
+	if err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(values)
+	if err != nil {
+		return fmt.Errorf("failed to marshal sealed attributes: %w", err)
+	}
+
+	dataKey, wrappedKey, err := e.client.GenerateDataKey(ctx, e.keyID, encryptionContext)
+	if err != nil {
+		return fmt.Errorf("failed to generate data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, additionalData(encryptionContext))
+
+	for name := range values {
+		delete(item, name)
+	}
+	item[AttrSealed] = &types.AttributeValueMemberB{Value: sealed}
+	item[AttrSealedKey] = &types.AttributeValueMemberB{Value: wrappedKey}
+	return nil
+}
+
+// Open restores sealed attributes into item and removes the sealed
+// attributes. Items that are not sealed are left unchanged.
+func (e *Envelope) Open(ctx context.Context, item map[string]types.AttributeValue) error {
+	sealed, ok := item[AttrSealed].(*types.AttributeValueMemberB)
+	if !ok {
+		return nil
+	}
+	wrappedKey, ok := item[AttrSealedKey].(*types.AttributeValueMemberB)
+	if !ok {
+		return fmt.Errorf("sealed record has no %s", AttrSealedKey)
+	}
+
+	encryptionContext, err := recordContext(item)
+	if err != nil {
+		return err
+	}
+	dataKey, err := e.client.Decrypt(ctx, e.keyID, wrappedKey.Value, encryptionContext)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt data key: %w", err)
+	}
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+	if len(sealed.Value) < gcm.NonceSize() {
+		return fmt.Errorf("sealed attributes are truncated")
+	}
+	nonce, ciphertext := sealed.Value[:gcm.NonceSize()], sealed.Value[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData(encryptionContext))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt sealed attributes: %w", err)
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal(plaintext, &values); err != nil {
+		return fmt.Errorf("failed to unmarshal sealed attributes: %w", err)
+	}
+	for name, value := range values {
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	delete(item, AttrSealed)
+	delete(item, AttrSealedKey)
+	return nil
+}
+
+// recordContext returns the KMS encryption context binding a record's keys
+func recordContext(item map[string]types.AttributeValue) (map[string]string, error) {
+	pk, pkOK := item["pk"].(*types.AttributeValueMemberS)
+	sk, skOK := item["sk"].(*types.AttributeValueMemberS)
+	if !pkOK || !skOK {
+		return nil, fmt.Errorf("record has no pk and sk to bind sealed attributes to")
+	}
+	return map[string]string{"pk": pk.Value, "sk": sk.Value}, nil
+}
+
+// additionalData is the AES-GCM additional data for an encryption context
+func additionalData(encryptionContext map[string]string) []byte {
+	return []byte(encryptionContext["pk"] + "\x00" + encryptionContext["sk"])
+}
+
+// newGCM creates an AES-GCM cipher from a data key
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,121 @@
+package blobcrypt
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockKMSClient "wraps" data keys by prefixing them, and records the
+// encryption context it was given
+type mockKMSClient struct {
+	key     []byte
+	context map[string]string
+}
+
+func (m *mockKMSClient) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]string) ([]byte, []byte, error) {
+	m.context = encryptionContext
+	return m.key, append([]byte("wrapped:"), m.key...), nil
+}
+
+func (m *mockKMSClient) Decrypt(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]string) ([]byte, error) {
+	m.context = encryptionContext
+	return bytes.TrimPrefix(ciphertext, []byte("wrapped:")), nil
+}
+
+func testEnvelope() (*Envelope, *mockKMSClient) {
+	client := &mockKMSClient{key: bytes.Repeat([]byte{7}, 32)}
+	return NewEnvelope(client, "arn:aws:kms:ap-southeast-2:123456789012:key/abc", DefaultAttributes), client
+}
+
+func blobItem() map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk":          &types.AttributeValueMemberS{Value: "ACCOUNT#user-123"},
+		"sk":          &types.AttributeValueMemberS{Value: "BLOB#blob-456"},
+		"size":        &types.AttributeValueMemberN{Value: "42"},
+		"contentType": &types.AttributeValueMemberS{Value: "message/rfc822"},
+		"parent":      &types.AttributeValueMemberS{Value: "email-789"},
+	}
+}
+
+func TestEnvelope_SealAndOpen(t *testing.T) {
+	envelope, client := testEnvelope()
+	item := blobItem()
+
+	if err := envelope.Seal(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := item["contentType"]; ok {
+		t.Error("expected contentType to be removed")
+	}
+	if _, ok := item["parent"]; ok {
+		t.Error("expected parent to be removed")
+	}
+	if _, ok := item[AttrSealed].(*types.AttributeValueMemberB); !ok {
+		t.Fatalf("expected %s attribute, got %v", AttrSealed, item)
+	}
+	if bytes.Contains(item[AttrSealed].(*types.AttributeValueMemberB).Value, []byte("message/rfc822")) {
+		t.Error("expected sealed attributes to be encrypted")
+	}
+	wantContext := map[string]string{"pk": "ACCOUNT#user-123", "sk": "BLOB#blob-456"}
+	if !reflect.DeepEqual(client.context, wantContext) {
+		t.Errorf("expected encryption context %v, got %v", wantContext, client.context)
+	}
+
+	if err := envelope.Open(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(item, blobItem()) {
+		t.Errorf("expected the original item back, got %v", item)
+	}
+}
+
+func TestEnvelope_Open_RejectsMovedRecord(t *testing.T) {
+	envelope, _ := testEnvelope()
+	item := blobItem()
+	if err := envelope.Seal(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item["sk"] = &types.AttributeValueMemberS{Value: "BLOB#other"}
+	if err := envelope.Open(context.Background(), item); err == nil {
+		t.Error("expected sealed attributes copied to another record to fail to open")
+	}
+}
+
+func TestEnvelope_PassesThroughUnsealed(t *testing.T) {
+	envelope, client := testEnvelope()
+
+	// Records from before encryption was enabled read unchanged
+	item := blobItem()
+	if err := envelope.Open(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(item, blobItem()) {
+		t.Errorf("expected unsealed item to be unchanged, got %v", item)
+	}
+
+	// Records with nothing to seal don't need a data key
+	item = map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "ACCOUNT#user-123"},
+		"sk": &types.AttributeValueMemberS{Value: "BLOB#blob-456"},
+	}
+	if err := envelope.Seal(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := item[AttrSealed]; ok || client.context != nil {
+		t.Errorf("expected nothing to be sealed, got %v", item)
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	if got := ParseAttributes(" contentType, ,size"); !reflect.DeepEqual(got, []string{"contentType", "size"}) {
+		t.Errorf("unexpected attributes %v", got)
+	}
+	if got := ParseAttributes(""); !reflect.DeepEqual(got, DefaultAttributes) {
+		t.Errorf("expected default attributes, got %v", got)
+	}
+}
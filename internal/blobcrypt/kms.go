@@ -0,0 +1,72 @@
+package blobcrypt
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// KMSAPI is the KMS SDK operations used by SDKKMSClient
+type KMSAPI interface {
+	GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error)
+	Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error)
+}
+
+// SDKKMSClient generates and unwraps data keys with the KMS SDK client
+type SDKKMSClient struct {
+	client KMSAPI
+}
+
+// NewSDKKMSClient creates a new SDKKMSClient
+func NewSDKKMSClient(client KMSAPI) *SDKKMSClient {
+	return &SDKKMSClient{client: client}
+}
+
+// GenerateDataKey returns a new AES-256 data key, in plaintext and wrapped under keyID
+func (c *SDKKMSClient) GenerateDataKey(ctx context.Context, keyID string, encryptionContext map[string]string) ([]byte, []byte, error) {
+	output, err := c.client.GenerateDataKey(ctx, &kms.GenerateDataKeyInput{
+		KeyId:             aws.String(keyID),
+		KeySpec:           kmstypes.DataKeySpecAes256,
+		EncryptionContext: encryptionContext,
+	}, keyRegion(keyID)...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GenerateDataKey request failed: %w", err)
+	}
+	return output.Plaintext, output.CiphertextBlob, nil
+}
+
+// Decrypt unwraps a data key. The key must have been wrapped under keyID.
+func (c *SDKKMSClient) Decrypt(ctx context.Context, keyID string, ciphertext []byte, encryptionContext map[string]string) ([]byte, error) {
+	output, err := c.client.Decrypt(ctx, &kms.DecryptInput{
+		KeyId:             aws.String(keyID),
+		CiphertextBlob:    ciphertext,
+		EncryptionContext: encryptionContext,
+	}, keyRegion(keyID)...)
+	if err != nil {
+		return nil, fmt.Errorf("Decrypt request failed: %w", err)
+	}
+	return output.Plaintext, nil
+}
+
+// keyRegion sends a request to the key's region, or the client's region if
+// keyID is not an ARN
+func keyRegion(keyID string) []func(*kms.Options) {
+	region := arnRegion(keyID)
+	if region == "" {
+		return nil
+	}
+	return []func(*kms.Options){func(o *kms.Options) { o.Region = region }}
+}
+
+// arnRegion returns the region of an ARN, or "" if value is not an ARN
+func arnRegion(value string) string {
+	parts := strings.Split(value, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
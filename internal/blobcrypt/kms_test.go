@@ -0,0 +1,96 @@
+package blobcrypt
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/kms"
+	kmstypes "github.com/aws/aws-sdk-go-v2/service/kms/types"
+)
+
+// mockKMSAPI records each call and the region it was sent to
+type mockKMSAPI struct {
+	generateInput *kms.GenerateDataKeyInput
+	decryptInput  *kms.DecryptInput
+	region        string
+	err           error
+}
+
+// requestRegion applies optFns to the client's default options
+func requestRegion(optFns []func(*kms.Options)) string {
+	options := kms.Options{Region: "us-east-1"}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	return options.Region
+}
+
+func (m *mockKMSAPI) GenerateDataKey(ctx context.Context, params *kms.GenerateDataKeyInput, optFns ...func(*kms.Options)) (*kms.GenerateDataKeyOutput, error) {
+	m.generateInput = params
+	m.region = requestRegion(optFns)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &kms.GenerateDataKeyOutput{Plaintext: []byte("plain"), CiphertextBlob: []byte("wrapped")}, nil
+}
+
+func (m *mockKMSAPI) Decrypt(ctx context.Context, params *kms.DecryptInput, optFns ...func(*kms.Options)) (*kms.DecryptOutput, error) {
+	m.decryptInput = params
+	m.region = requestRegion(optFns)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &kms.DecryptOutput{Plaintext: []byte("plain")}, nil
+}
+
+func TestSDKKMSClient_GenerateDataKey(t *testing.T) {
+	api := &mockKMSAPI{}
+	client := NewSDKKMSClient(api)
+
+	plaintext, ciphertext, err := client.GenerateDataKey(context.Background(), "arn:aws:kms:ap-southeast-2:123456789012:key/abc", map[string]string{"pk": "ACCOUNT#user-123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(plaintext) != "plain" || string(ciphertext) != "wrapped" {
+		t.Errorf("unexpected keys %q, %q", plaintext, ciphertext)
+	}
+
+	if api.region != "ap-southeast-2" {
+		t.Errorf("expected the key's region, got %s", api.region)
+	}
+	input := api.generateInput
+	if aws.ToString(input.KeyId) != "arn:aws:kms:ap-southeast-2:123456789012:key/abc" || input.KeySpec != kmstypes.DataKeySpecAes256 || input.EncryptionContext["pk"] != "ACCOUNT#user-123" {
+		t.Errorf("unexpected input %+v", input)
+	}
+}
+
+func TestSDKKMSClient_Decrypt(t *testing.T) {
+	api := &mockKMSAPI{}
+	client := NewSDKKMSClient(api)
+
+	plaintext, err := client.Decrypt(context.Background(), "alias/blob-metadata", []byte("wrapped"), nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(plaintext) != "plain" {
+		t.Errorf("unexpected plaintext %q", plaintext)
+	}
+	if api.region != "us-east-1" {
+		t.Errorf("expected the client's region for a key alias, got %s", api.region)
+	}
+	if string(api.decryptInput.CiphertextBlob) != "wrapped" || aws.ToString(api.decryptInput.KeyId) != "alias/blob-metadata" {
+		t.Errorf("unexpected input %+v", api.decryptInput)
+	}
+}
+
+func TestSDKKMSClient_RequestError(t *testing.T) {
+	client := NewSDKKMSClient(&mockKMSAPI{err: errors.New("AccessDeniedException")})
+
+	_, err := client.Decrypt(context.Background(), "alias/blob-metadata", []byte("wrapped"), nil)
+	if err == nil || !strings.Contains(err.Error(), "AccessDeniedException") {
+		t.Errorf("expected the request error, got %v", err)
+	}
+}
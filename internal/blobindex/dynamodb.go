@@ -0,0 +1,84 @@
+package blobindex
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by blobindex
+type DynamoDBClient interface {
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBStore implements DB using AWS DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore for blobindex
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// QueryIndexedBlobs reads the account's blobs indexed under key and value
+// from gsi2. Pending and deleted blobs are filtered out; as DynamoDB applies
+// the filter after reading a page, it keeps reading until it has one more
+// blob than limit, or the index runs out.
+func (d *DynamoDBStore) QueryIndexedBlobs(ctx context.Context, accountID, key, value, after string, limit int) ([]string, bool, error) {
+	gsi2pk := store.IndexedGSI2PK(accountID, key, value)
+
+	// The gsi2 sort key is the blob's sort key, so the start key of the page
+	// after a blob can be built from its ID
+	var startKey map[string]types.AttributeValue
+	if after != "" {
+		startKey = store.BlobKey(accountID, after)
+		startKey["gsi2pk"] = &types.AttributeValueMemberS{Value: gsi2pk}
+		startKey["gsi2sk"] = &types.AttributeValueMemberS{Value: store.BlobSK(after)}
+	}
+
+	var ids []string
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(d.tableName),
+			IndexName:              aws.String(store.GSI2Name),
+			KeyConditionExpression: aws.String("gsi2pk = :pk"),
+			FilterExpression:       aws.String("attribute_not_exists(deletedAt) AND (attribute_not_exists(#status) OR #status = :confirmed)"),
+			ProjectionExpression:   aws.String("blobId"),
+			ExpressionAttributeNames: map[string]string{
+				"#status": "status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":        &types.AttributeValueMemberS{Value: gsi2pk},
+				":confirmed": &types.AttributeValueMemberS{Value: store.StatusConfirmed},
+			},
+			Limit:             aws.Int32(int32(limit + 1 - len(ids))),
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to query indexed blobs: %w", err)
+		}
+
+		for _, item := range output.Items {
+			if idAttr, ok := item["blobId"].(*types.AttributeValueMemberS); ok {
+				ids = append(ids, idAttr.Value)
+			}
+		}
+
+		if len(ids) > limit {
+			return ids[:limit], true, nil
+		}
+		if len(output.LastEvaluatedKey) == 0 {
+			return ids, false, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
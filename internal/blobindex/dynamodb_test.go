@@ -0,0 +1,99 @@
+package blobindex
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockClient returns a queued page for each Query call
+type mockClient struct {
+	pages  []*dynamodb.QueryOutput
+	inputs []*dynamodb.QueryInput
+}
+
+func (m *mockClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.inputs = append(m.inputs, params)
+	page := m.pages[0]
+	m.pages = m.pages[1:]
+	return page, nil
+}
+
+// page builds a query output of blobIds, continuing if more is set
+func page(more bool, blobIDs ...string) *dynamodb.QueryOutput {
+	output := &dynamodb.QueryOutput{}
+	for _, id := range blobIDs {
+		output.Items = append(output.Items, map[string]types.AttributeValue{
+			"blobId": &types.AttributeValueMemberS{Value: id},
+		})
+	}
+	if more {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "next"},
+		}
+	}
+	return output
+}
+
+func attrString(item map[string]types.AttributeValue, name string) string {
+	if v, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return v.Value
+	}
+	return ""
+}
+
+func TestQueryIndexedBlobs_QueriesGSI2(t *testing.T) {
+	client := &mockClient{pages: []*dynamodb.QueryOutput{page(false, "blob-1", "blob-2")}}
+	store := NewDynamoDBStore(client, "table")
+
+	ids, more, err := store.QueryIndexedBlobs(context.Background(), "account-1", "correlationId", "msg-123", "", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"blob-1", "blob-2"}) || more {
+		t.Errorf("unexpected result %v, %v", ids, more)
+	}
+	input := client.inputs[0]
+	if *input.IndexName != "gsi2" || *input.Limit != 11 || input.ExclusiveStartKey != nil {
+		t.Errorf("unexpected query %+v", input)
+	}
+	if got := attrString(input.ExpressionAttributeValues, ":pk"); got != "INDEXED#account-1#correlationId#msg-123" {
+		t.Errorf("unexpected gsi2pk %q", got)
+	}
+}
+
+func TestQueryIndexedBlobs_StartsAfterBlob(t *testing.T) {
+	client := &mockClient{pages: []*dynamodb.QueryOutput{page(false)}}
+	store := NewDynamoDBStore(client, "table")
+
+	if _, _, err := store.QueryIndexedBlobs(context.Background(), "account-1", "k", "v", "blob-9", 10); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	start := client.inputs[0].ExclusiveStartKey
+	if attrString(start, "pk") != "ACCOUNT#account-1" || attrString(start, "sk") != "BLOB#blob-9" ||
+		attrString(start, "gsi2pk") != "INDEXED#account-1#k#v" || attrString(start, "gsi2sk") != "BLOB#blob-9" {
+		t.Errorf("unexpected start key %v", start)
+	}
+}
+
+func TestQueryIndexedBlobs_ReadsPastFilteredPages(t *testing.T) {
+	client := &mockClient{pages: []*dynamodb.QueryOutput{
+		page(true, "blob-1"),
+		page(true, "blob-2", "blob-3"),
+	}}
+	store := NewDynamoDBStore(client, "table")
+
+	ids, more, err := store.QueryIndexedBlobs(context.Background(), "account-1", "k", "v", "", 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"blob-1", "blob-2"}) || !more {
+		t.Errorf("unexpected result %v, %v", ids, more)
+	}
+	if len(client.inputs) != 2 || *client.inputs[1].Limit != 2 || client.inputs[1].ExclusiveStartKey == nil {
+		t.Errorf("expected a second page continuing the first, got %d queries", len(client.inputs))
+	}
+}
@@ -0,0 +1,120 @@
+// Package blobindex finds an account's blobs by the indexed metadata they
+// were allocated with. A Blob/allocate create request can carry one
+// metadata key and value, such as a plugin's correlation id; it is promoted
+// to the blob record's gsi2 keys, so Blob/queryByMetadata reads the matching
+// blob IDs from the index instead of scanning the account's records.
+package blobindex
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"unicode"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// Query limits. A query without a limit returns up to DefaultLimit IDs.
+const (
+	DefaultLimit = 100
+	MaxLimit     = 1000
+)
+
+// MaxValueBytes is the longest indexed value, which keeps the gsi2
+// partition key well inside DynamoDB's 2048 byte limit
+const MaxValueBytes = 512
+
+// keyPattern is the form of an indexed metadata key. Keys cannot hold "#",
+// which separates the parts of the gsi2 partition key.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Validate checks an indexed metadata key and value
+func Validate(meta blobmeta.IndexedMetadata) error {
+	if !keyPattern.MatchString(meta.Key) {
+		return errors.New("key must be 1 to 64 letters, digits, '.', '_' or '-'")
+	}
+	if meta.Value == "" || len(meta.Value) > MaxValueBytes {
+		return fmt.Errorf("value must be 1 to %d bytes", MaxValueBytes)
+	}
+	for _, r := range meta.Value {
+		if r == unicode.ReplacementChar || unicode.IsControl(r) {
+			return errors.New("value must be text without control characters")
+		}
+	}
+	return nil
+}
+
+// QueryRequest is the Blob/queryByMetadata method request. After is the
+// last blob ID of the previous page, if any.
+type QueryRequest struct {
+	AccountID string `json:"accountId"`
+	Key       string `json:"key"`
+	Value     string `json:"value"`
+	After     string `json:"after,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+}
+
+// QueryResponse is the Blob/queryByMetadata method response. IDs are in
+// blob ID order; HasMore is set when another page follows the last of them.
+type QueryResponse struct {
+	AccountID string   `json:"accountId"`
+	Key       string   `json:"key"`
+	Value     string   `json:"value"`
+	IDs       []string `json:"ids"`
+	HasMore   bool     `json:"hasMore"`
+}
+
+// QueryError represents a JMAP error from Blob/queryByMetadata
+type QueryError struct {
+	Type    string
+	Message string
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// DB handles DynamoDB operations for Blob/queryByMetadata
+type DB interface {
+	// QueryIndexedBlobs returns the IDs of up to limit live blobs of the
+	// account indexed under key and value, after the given blob ID, and
+	// whether there are more
+	QueryIndexedBlobs(ctx context.Context, accountID, key, value, after string, limit int) ([]string, bool, error)
+}
+
+// Handler handles Blob/queryByMetadata method calls
+type Handler struct {
+	DB DB
+}
+
+// Query processes a Blob/queryByMetadata request
+func (h *Handler) Query(ctx context.Context, req QueryRequest) (*QueryResponse, error) {
+	if err := Validate(blobmeta.IndexedMetadata{Key: req.Key, Value: req.Value}); err != nil {
+		return nil, &QueryError{Type: "invalidArguments", Message: err.Error()}
+	}
+	limit := req.Limit
+	switch {
+	case limit < 0:
+		return nil, &QueryError{Type: "invalidArguments", Message: "limit must not be negative"}
+	case limit == 0:
+		limit = DefaultLimit
+	case limit > MaxLimit:
+		limit = MaxLimit
+	}
+
+	ids, more, err := h.DB.QueryIndexedBlobs(ctx, req.AccountID, req.Key, req.Value, req.After, limit)
+	if err != nil {
+		return nil, &QueryError{Type: "serverFail", Message: fmt.Sprintf("failed to query indexed blobs: %v", err)}
+	}
+	if ids == nil {
+		ids = []string{}
+	}
+	return &QueryResponse{
+		AccountID: req.AccountID,
+		Key:       req.Key,
+		Value:     req.Value,
+		IDs:       ids,
+		HasMore:   more,
+	}, nil
+}
@@ -0,0 +1,117 @@
+package blobindex
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// mockDB implements DB for testing
+type mockDB struct {
+	ids       []string
+	more      bool
+	err       error
+	lastAfter string
+	lastLimit int
+}
+
+func (m *mockDB) QueryIndexedBlobs(ctx context.Context, accountID, key, value, after string, limit int) ([]string, bool, error) {
+	m.lastAfter = after
+	m.lastLimit = limit
+	return m.ids, m.more, m.err
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		meta  blobmeta.IndexedMetadata
+		valid bool
+	}{
+		{"simple", blobmeta.IndexedMetadata{Key: "correlationId", Value: "msg-123"}, true},
+		{"value with hash", blobmeta.IndexedMetadata{Key: "ref", Value: "a#b"}, true},
+		{"empty key", blobmeta.IndexedMetadata{Key: "", Value: "x"}, false},
+		{"key with hash", blobmeta.IndexedMetadata{Key: "a#b", Value: "x"}, false},
+		{"long key", blobmeta.IndexedMetadata{Key: strings.Repeat("k", 65), Value: "x"}, false},
+		{"empty value", blobmeta.IndexedMetadata{Key: "k", Value: ""}, false},
+		{"long value", blobmeta.IndexedMetadata{Key: "k", Value: strings.Repeat("v", MaxValueBytes+1)}, false},
+		{"control character", blobmeta.IndexedMetadata{Key: "k", Value: "a\nb"}, false},
+		{"invalid utf-8", blobmeta.IndexedMetadata{Key: "k", Value: "a\xffb"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Validate(tt.meta); (err == nil) != tt.valid {
+				t.Errorf("Validate(%+v) = %v, want valid %v", tt.meta, err, tt.valid)
+			}
+		})
+	}
+}
+
+func TestQuery_ReturnsIDs(t *testing.T) {
+	db := &mockDB{ids: []string{"blob-1", "blob-2"}, more: true}
+	h := &Handler{DB: db}
+
+	resp, err := h.Query(context.Background(), QueryRequest{AccountID: "account-1", Key: "correlationId", Value: "msg-123", After: "blob-0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(resp.IDs, []string{"blob-1", "blob-2"}) || !resp.HasMore {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if db.lastAfter != "blob-0" || db.lastLimit != DefaultLimit {
+		t.Errorf("expected after blob-0 with the default limit, got %q, %d", db.lastAfter, db.lastLimit)
+	}
+}
+
+func TestQuery_NoMatchesReturnsEmptyIDs(t *testing.T) {
+	h := &Handler{DB: &mockDB{}}
+
+	resp, err := h.Query(context.Background(), QueryRequest{AccountID: "account-1", Key: "k", Value: "v"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.IDs == nil || len(resp.IDs) != 0 || resp.HasMore {
+		t.Errorf("expected an empty ids list, got %+v", resp)
+	}
+}
+
+func TestQuery_CapsLimit(t *testing.T) {
+	db := &mockDB{}
+	h := &Handler{DB: db}
+
+	if _, err := h.Query(context.Background(), QueryRequest{AccountID: "account-1", Key: "k", Value: "v", Limit: MaxLimit + 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.lastLimit != MaxLimit {
+		t.Errorf("expected limit capped at %d, got %d", MaxLimit, db.lastLimit)
+	}
+}
+
+func TestQuery_InvalidArguments(t *testing.T) {
+	h := &Handler{DB: &mockDB{}}
+
+	for _, req := range []QueryRequest{
+		{AccountID: "account-1", Key: "", Value: "v"},
+		{AccountID: "account-1", Key: "k", Value: ""},
+		{AccountID: "account-1", Key: "k", Value: "v", Limit: -1},
+	} {
+		_, err := h.Query(context.Background(), req)
+		var queryErr *QueryError
+		if !errors.As(err, &queryErr) || queryErr.Type != "invalidArguments" {
+			t.Errorf("Query(%+v): expected invalidArguments, got %v", req, err)
+		}
+	}
+}
+
+func TestQuery_DBError(t *testing.T) {
+	h := &Handler{DB: &mockDB{err: errors.New("boom")}}
+
+	_, err := h.Query(context.Background(), QueryRequest{AccountID: "account-1", Key: "k", Value: "v"})
+	var queryErr *QueryError
+	if !errors.As(err, &queryErr) || queryErr.Type != "serverFail" {
+		t.Errorf("expected serverFail, got %v", err)
+	}
+}
@@ -0,0 +1,72 @@
+// Package blobmeta holds the blob metadata types the blob Lambdas exchange
+// with their storage, so that shared implementations such as internal/fakes
+// can satisfy each Lambda's storage interfaces.
+package blobmeta
+
+// Record is a blob record in DynamoDB
+type Record struct {
+	BlobID      string `dynamodbav:"blobId"`
+	AccountID   string `dynamodbav:"accountId"`
+	Size        int64  `dynamodbav:"size"`
+	ContentType string `dynamodbav:"contentType"`
+	S3Key       string `dynamodbav:"s3Key"`
+	CreatedAt   string `dynamodbav:"createdAt"`
+	DeletedAt   string `dynamodbav:"deletedAt,omitempty"`
+	Parent      string `dynamodbav:"parent,omitempty"`     // Optional parent tag from X-Parent header
+	ScanStatus  string `dynamodbav:"scanStatus,omitempty"` // Content scan verdict, if the blob was scanned
+	Name        string `dynamodbav:"name,omitempty"`       // Optional original filename
+	// Tags are the approved extra S3 tags the client set, such as Source
+	Tags map[string]string `dynamodbav:"tags,omitempty"`
+	// Set when blob-confirm sniffs the content: the type the client declared,
+	// the type detected, and whether they grossly disagree
+	DeclaredType string `dynamodbav:"declaredType,omitempty"`
+	DetectedType string `dynamodbav:"detectedType,omitempty"`
+	TypeMismatch bool   `dynamodbav:"typeMismatch,omitempty"`
+	// ChecksumSHA256 is the checksum the client declared, set once
+	// blob-confirm has verified the content against it
+	ChecksumSHA256 string `dynamodbav:"checksumSha256,omitempty"`
+	// IndexedMetadata is the key and value the blob can be looked up by
+	IndexedMetadata *IndexedMetadata `dynamodbav:"indexedMetadata,omitempty"`
+}
+
+// IndexedMetadata is a single metadata key and value promoted to the gsi2
+// index keys of a blob record, so the account's blobs can be found by it
+type IndexedMetadata struct {
+	Key   string `dynamodbav:"key" json:"key"`
+	Value string `dynamodbav:"value" json:"value"`
+}
+
+// UploadRequest is an S3 upload request
+type UploadRequest struct {
+	Key         string
+	Body        []byte
+	ContentType string
+	AccountID   string
+	ParentTag   string // Optional X-Parent header value
+	// Tags are the approved extra tags from X-Tag-{Key} headers
+	Tags map[string]string
+}
+
+// Info holds status and metadata about a blob record, as needed to confirm it
+type Info struct {
+	Status      string
+	SizeUnknown bool
+	IAMAuth     bool
+	// ContentType is the declared type, empty if it is encrypted
+	ContentType string
+	// Tags are the approved extra S3 tags set when the blob was allocated
+	Tags map[string]string
+	// Checksum is the SHA-256 checksum declared at allocation, if any
+	Checksum string
+	// MaxSize is the size limit for an upload of unknown size; zero for none
+	MaxSize int64
+}
+
+// PendingAllocation is an expired pending allocation record
+type PendingAllocation struct {
+	AccountID string
+	BlobID    string
+	S3Key     string
+	Size      int64
+	IAMAuth   bool
+}
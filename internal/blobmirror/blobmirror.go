@@ -0,0 +1,203 @@
+// Package blobmirror copies confirmed blobs and their records to a replica
+// bucket and table in another region, for disaster recovery. blob-mirror
+// mirrors a blob when its object is tagged confirmed and removes it from the
+// replica when the object is deleted. A record changed after confirmation,
+// such as by a scan verdict, is mirrored again by retagging its object.
+package blobmirror
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// ErrSourceMissing is returned when the object to copy is no longer in the
+// source bucket, because the blob was deleted after its event was sent
+var ErrSourceMissing = errors.New("source object not found")
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by
+// blobmirror
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// S3Client defines the interface for S3 operations needed by blobmirror
+type S3Client interface {
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// Item is a blob record as stored, copied attribute for attribute so
+// encrypted metadata stays sealed
+type Item = map[string]types.AttributeValue
+
+// Source reads blob records from the primary table
+type Source struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewSource creates a new Source
+func NewSource(client DynamoDBClient, tableName string) *Source {
+	return &Source{client: client, tableName: tableName}
+}
+
+// GetBlobItem returns a blob's record, or nil if it does not exist
+func (s *Source) GetBlobItem(ctx context.Context, accountID, blobID string) (Item, error) {
+	output, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(s.tableName),
+		Key:            store.BlobKey(accountID, blobID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob record: %w", err)
+	}
+	return output.Item, nil
+}
+
+// Confirmed reports whether a record is for a blob that is confirmed and not
+// deleted. Records from before blobs had a status are confirmed.
+func Confirmed(item Item) bool {
+	if _, deleted := item["deletedAt"]; deleted {
+		return false
+	}
+	status, _ := item["status"].(*types.AttributeValueMemberS)
+	return status == nil || status.Value != store.StatusPending
+}
+
+// Replica writes blobs to the replica bucket and table
+type Replica struct {
+	s3           S3Client
+	db           DynamoDBClient
+	sourceBucket string
+	bucket       string
+	tableName    string
+}
+
+// NewReplica creates a new Replica copying objects from sourceBucket. The
+// clients must be for the replica's region.
+func NewReplica(s3Client S3Client, db DynamoDBClient, sourceBucket, bucket, tableName string) *Replica {
+	return &Replica{
+		s3:           s3Client,
+		db:           db,
+		sourceBucket: sourceBucket,
+		bucket:       bucket,
+		tableName:    tableName,
+	}
+}
+
+// CopyObject copies an object and its tags from the source bucket. Objects
+// are copied in a single request, which S3 limits to 5 GiB.
+func (r *Replica) CopyObject(ctx context.Context, key string) error {
+	_, err := r.s3.CopyObject(ctx, &s3.CopyObjectInput{
+		Bucket:            aws.String(r.bucket),
+		Key:               aws.String(key),
+		CopySource:        aws.String(r.sourceBucket + "/" + escapeKey(key)),
+		TaggingDirective:  s3types.TaggingDirectiveCopy,
+		MetadataDirective: s3types.MetadataDirectiveCopy,
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			return ErrSourceMissing
+		}
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	return nil
+}
+
+// PutBlobItem writes a blob's record, replacing any earlier copy
+func (r *Replica) PutBlobItem(ctx context.Context, item Item) error {
+	_, err := r.db.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write replica blob record: %w", err)
+	}
+	return nil
+}
+
+// DeleteObject deletes an object, which may already be gone
+func (r *Replica) DeleteObject(ctx context.Context, key string) error {
+	_, err := r.s3.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete replica object: %w", err)
+	}
+	return nil
+}
+
+// DeleteBlobItem deletes a blob's record, which may already be gone
+func (r *Replica) DeleteBlobItem(ctx context.Context, accountID, blobID string) error {
+	_, err := r.db.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(r.tableName),
+		Key:       store.BlobKey(accountID, blobID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete replica blob record: %w", err)
+	}
+	return nil
+}
+
+// TaggingClient defines the S3 tagging operations needed by Retagger
+type TaggingClient interface {
+	GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+}
+
+// Retagger has blob-mirror copy a blob's record again after it changes
+type Retagger struct {
+	s3     TaggingClient
+	bucket string
+}
+
+// NewRetagger creates a new Retagger for the source bucket
+func NewRetagger(client TaggingClient, bucket string) *Retagger {
+	return &Retagger{s3: client, bucket: bucket}
+}
+
+// Retag writes an object's tags back unchanged. S3 sends an
+// ObjectTagging:Put event for it, on which blob-mirror copies the blob's
+// current record to the replica. A missing object, whose blob is being
+// deleted, is skipped.
+func (r *Retagger) Retag(ctx context.Context, key string) error {
+	output, err := r.s3.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+		Bucket: aws.String(r.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var apiErr smithy.APIError
+		if errors.As(err, &apiErr) && apiErr.ErrorCode() == "NoSuchKey" {
+			return nil
+		}
+		return fmt.Errorf("failed to read object tags: %w", err)
+	}
+	_, err = r.s3.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(r.bucket),
+		Key:     aws.String(key),
+		Tagging: &s3types.Tagging{TagSet: output.TagSet},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to rewrite object tags: %w", err)
+	}
+	return nil
+}
+
+// escapeKey URL-encodes each segment of an object key for CopySource
+func escapeKey(key string) string {
+	return (&url.URL{Path: key}).EscapedPath()
+}
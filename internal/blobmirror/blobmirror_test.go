@@ -0,0 +1,231 @@
+package blobmirror
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+type mockDynamoDBClient struct {
+	items     map[string]Item
+	getInput  *dynamodb.GetItemInput
+	putInput  *dynamodb.PutItemInput
+	delInput  *dynamodb.DeleteItemInput
+	getErr    error
+	putErr    error
+	deleteErr error
+}
+
+func itemKey(key map[string]types.AttributeValue) string {
+	return key["pk"].(*types.AttributeValueMemberS).Value + "|" + key["sk"].(*types.AttributeValueMemberS).Value
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.getInput = params
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return &dynamodb.GetItemOutput{Item: m.items[itemKey(params.Key)]}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.putInput = params
+	if m.putErr != nil {
+		return nil, m.putErr
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.delInput = params
+	if m.deleteErr != nil {
+		return nil, m.deleteErr
+	}
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+type mockS3Client struct {
+	copyInput   *s3.CopyObjectInput
+	deleteInput *s3.DeleteObjectInput
+	copyErr     error
+}
+
+func (m *mockS3Client) CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	m.copyInput = params
+	if m.copyErr != nil {
+		return nil, m.copyErr
+	}
+	return &s3.CopyObjectOutput{}, nil
+}
+
+func (m *mockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.deleteInput = params
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestGetBlobItem(t *testing.T) {
+	item := Item{"status": &types.AttributeValueMemberS{Value: store.StatusConfirmed}}
+	client := &mockDynamoDBClient{items: map[string]Item{
+		itemKey(store.BlobKey("user-1", "blob-1")): item,
+	}}
+	source := NewSource(client, "primary")
+
+	got, err := source.GetBlobItem(context.Background(), "user-1", "blob-1")
+	if err != nil || got["status"] == nil {
+		t.Fatalf("expected the record, got %v, %v", got, err)
+	}
+	if *client.getInput.TableName != "primary" || !*client.getInput.ConsistentRead {
+		t.Errorf("expected a consistent read of the primary table, got %+v", client.getInput)
+	}
+
+	if got, err := source.GetBlobItem(context.Background(), "user-1", "missing"); err != nil || got != nil {
+		t.Errorf("expected no record, got %v, %v", got, err)
+	}
+
+	client.getErr = errors.New("throttled")
+	if _, err := source.GetBlobItem(context.Background(), "user-1", "blob-1"); err == nil {
+		t.Error("expected an error when the read fails")
+	}
+}
+
+func TestConfirmed(t *testing.T) {
+	status := func(value string) types.AttributeValue { return &types.AttributeValueMemberS{Value: value} }
+	tests := []struct {
+		name string
+		item Item
+		want bool
+	}{
+		{"confirmed", Item{"status": status(store.StatusConfirmed)}, true},
+		{"pending", Item{"status": status(store.StatusPending)}, false},
+		{"no status", Item{}, true},
+		{"deleted", Item{"status": status(store.StatusConfirmed), "deletedAt": status("2024-01-01T00:00:00Z")}, false},
+	}
+	for _, tt := range tests {
+		if got := Confirmed(tt.item); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+		}
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	client := &mockS3Client{}
+	replica := NewReplica(client, &mockDynamoDBClient{}, "blobs", "blobs-dr", "table-dr")
+
+	if err := replica.CopyObject(context.Background(), "user 1/blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := client.copyInput
+	if *input.Bucket != "blobs-dr" || *input.Key != "user 1/blob-1" {
+		t.Errorf("unexpected destination %s/%s", *input.Bucket, *input.Key)
+	}
+	if *input.CopySource != "blobs/user%201/blob-1" {
+		t.Errorf("unexpected copy source %s", *input.CopySource)
+	}
+	if input.TaggingDirective != s3types.TaggingDirectiveCopy {
+		t.Errorf("expected the tags to be copied, got %q", input.TaggingDirective)
+	}
+
+	client.copyErr = &smithy.GenericAPIError{Code: "NoSuchKey"}
+	if err := replica.CopyObject(context.Background(), "user-1/blob-1"); !errors.Is(err, ErrSourceMissing) {
+		t.Errorf("expected ErrSourceMissing, got %v", err)
+	}
+	client.copyErr = &smithy.GenericAPIError{Code: "SlowDown"}
+	if err := replica.CopyObject(context.Background(), "user-1/blob-1"); err == nil || errors.Is(err, ErrSourceMissing) {
+		t.Errorf("expected a copy error, got %v", err)
+	}
+}
+
+func TestReplicaRecords(t *testing.T) {
+	db := &mockDynamoDBClient{}
+	s3Client := &mockS3Client{}
+	replica := NewReplica(s3Client, db, "blobs", "blobs-dr", "table-dr")
+
+	item := Item{"pk": &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"}}
+	if err := replica.PutBlobItem(context.Background(), item); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *db.putInput.TableName != "table-dr" || db.putInput.Item["pk"] == nil {
+		t.Errorf("expected the record in the replica table, got %+v", db.putInput)
+	}
+
+	if err := replica.DeleteBlobItem(context.Background(), "user-1", "blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *db.delInput.TableName != "table-dr" || itemKey(db.delInput.Key) != itemKey(store.BlobKey("user-1", "blob-1")) {
+		t.Errorf("unexpected delete %+v", db.delInput)
+	}
+
+	if err := replica.DeleteObject(context.Background(), "user-1/blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if *s3Client.deleteInput.Bucket != "blobs-dr" {
+		t.Errorf("expected the replica object to be deleted, got %s", *s3Client.deleteInput.Bucket)
+	}
+
+	db.putErr = errors.New("throttled")
+	db.deleteErr = errors.New("throttled")
+	if err := replica.PutBlobItem(context.Background(), item); err == nil {
+		t.Error("expected an error when the put fails")
+	}
+	if err := replica.DeleteBlobItem(context.Background(), "user-1", "blob-1"); err == nil {
+		t.Error("expected an error when the delete fails")
+	}
+}
+
+type mockTaggingClient struct {
+	tags     []s3types.Tag
+	putInput *s3.PutObjectTaggingInput
+	getErr   error
+}
+
+func (m *mockTaggingClient) GetObjectTagging(ctx context.Context, params *s3.GetObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.GetObjectTaggingOutput, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: m.tags}, nil
+}
+
+func (m *mockTaggingClient) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	m.putInput = params
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func TestRetag(t *testing.T) {
+	client := &mockTaggingClient{tags: []s3types.Tag{
+		{Key: aws.String("Account"), Value: aws.String("user-1")},
+		{Key: aws.String("Status"), Value: aws.String("confirmed")},
+	}}
+	if err := NewRetagger(client, "blobs").Retag(context.Background(), "user-1/blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := client.putInput
+	if input == nil || aws.ToString(input.Bucket) != "blobs" || aws.ToString(input.Key) != "user-1/blob-1" {
+		t.Fatalf("expected the object's tags to be written, got %+v", input)
+	}
+	if len(input.Tagging.TagSet) != 2 || aws.ToString(input.Tagging.TagSet[1].Value) != "confirmed" {
+		t.Errorf("expected the tags written back unchanged, got %+v", input.Tagging.TagSet)
+	}
+}
+
+func TestRetag_MissingObject(t *testing.T) {
+	client := &mockTaggingClient{getErr: &smithy.GenericAPIError{Code: "NoSuchKey"}}
+	if err := NewRetagger(client, "blobs").Retag(context.Background(), "user-1/blob-1"); err != nil {
+		t.Fatalf("expected a missing object to be skipped, got %v", err)
+	}
+	if client.putInput != nil {
+		t.Error("expected no tags written")
+	}
+
+	client = &mockTaggingClient{getErr: errors.New("slow down")}
+	if err := NewRetagger(client, "blobs").Retag(context.Background(), "user-1/blob-1"); err == nil {
+		t.Error("expected other errors to be returned")
+	}
+}
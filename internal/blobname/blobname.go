@@ -0,0 +1,86 @@
+// Package blobname validates the original filenames clients give blobs on
+// upload and formats them for the Content-Disposition of downloads.
+package blobname
+
+import (
+	"errors"
+	"mime"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxLength is the longest name accepted, in bytes
+const MaxLength = 255
+
+// ErrInvalid is returned for a name that is too long, not UTF-8, or holds
+// control characters
+var ErrInvalid = errors.New("invalid blob name")
+
+// Clean returns name without any directory part a client included, and
+// checks what remains. An empty name is returned as is.
+func Clean(name string) (string, error) {
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil
+	}
+	if len(name) > MaxLength || !utf8.ValidString(name) {
+		return "", ErrInvalid
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return "", ErrInvalid
+		}
+	}
+	if name == "." || name == ".." {
+		return "", ErrInvalid
+	}
+	return name, nil
+}
+
+// FromHeaders returns the cleaned filename of an upload, from the filename
+// parameter of Content-Disposition or else from X-Filename, which may be
+// percent-encoded to carry non-ASCII names. It returns "" if neither is set.
+func FromHeaders(headers map[string]string) (string, error) {
+	if value := header(headers, "Content-Disposition"); value != "" {
+		_, params, err := mime.ParseMediaType(value)
+		if err != nil {
+			return "", ErrInvalid
+		}
+		// mime decodes an RFC 2231 filename* into filename
+		if name := params["filename"]; name != "" {
+			return Clean(name)
+		}
+	}
+	if value := header(headers, "X-Filename"); value != "" {
+		name, err := url.PathUnescape(value)
+		if err != nil {
+			return "", ErrInvalid
+		}
+		return Clean(name)
+	}
+	return "", nil
+}
+
+// ContentDisposition returns the Content-Disposition of a download of a blob
+// named name, with the given disposition type, "attachment" or "inline"
+func ContentDisposition(disposition, name string) string {
+	if value := mime.FormatMediaType(disposition, map[string]string{"filename": name}); value != "" {
+		return value
+	}
+	return disposition
+}
+
+// header returns a header's value, matching its name case-insensitively
+func header(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,76 @@
+package blobname
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"report.pdf", "report.pdf", false},
+		{`C:\Users\me\report.pdf`, "report.pdf", false},
+		{"../../etc/passwd", "passwd", false},
+		{"  spaced.txt ", "spaced.txt", false},
+		{"résumé.docx", "résumé.docx", false},
+		{"", "", false},
+		{"dir/", "", false},
+		{"bad\nname", "", true},
+		{"..", "", true},
+		{strings.Repeat("a", MaxLength+1), "", true},
+		{"\xff.txt", "", true},
+	}
+	for _, tt := range tests {
+		got, err := Clean(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("Clean(%q) = %q, %v; want %q, error %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		want    string
+	}{
+		{"content disposition", map[string]string{"Content-Disposition": `attachment; filename="report.pdf"`}, "report.pdf"},
+		{"encoded filename", map[string]string{"content-disposition": `attachment; filename*=UTF-8''r%C3%A9sum%C3%A9.docx`}, "résumé.docx"},
+		{"x-filename", map[string]string{"X-Filename": "notes%20v2.txt"}, "notes v2.txt"},
+		{"disposition first", map[string]string{"Content-Disposition": `inline; filename=a.txt`, "X-Filename": "b.txt"}, "a.txt"},
+		{"neither", map[string]string{"Content-Type": "text/plain"}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FromHeaders(tt.headers)
+			if err != nil || got != tt.want {
+				t.Errorf("got %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFromHeaders_Invalid(t *testing.T) {
+	for _, headers := range []map[string]string{
+		{"Content-Disposition": `attachment; filename="unterminated`},
+		{"X-Filename": "bad%zz"},
+		{"X-Filename": "line%0Abreak"},
+	} {
+		if _, err := FromHeaders(headers); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%v: expected ErrInvalid, got %v", headers, err)
+		}
+	}
+}
+
+func TestContentDisposition(t *testing.T) {
+	if got := ContentDisposition("attachment", "report.pdf"); got != "attachment; filename=report.pdf" {
+		t.Errorf("unexpected %q", got)
+	}
+	if got := ContentDisposition("inline", "résumé.docx"); got != "inline; filename*=utf-8''r%C3%A9sum%C3%A9.docx" {
+		t.Errorf("unexpected %q", got)
+	}
+}
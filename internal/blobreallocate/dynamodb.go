@@ -0,0 +1,99 @@
+package blobreallocate
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by blobreallocate
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// DynamoDBStore implements DB using AWS DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore for blobreallocate
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// GetBlobForReallocate returns the blob record fields needed for Blob/reallocateParts.
+// Returns nil if the blob record is not found.
+func (d *DynamoDBStore) GetBlobForReallocate(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(d.tableName),
+		Key:                  store.BlobKey(accountID, blobID),
+		ProjectionExpression: aws.String("#status, multipart, uploadId, urlExpiresAt, deletedAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	record := &BlobRecord{}
+
+	if statusAttr, ok := result.Item["status"].(*types.AttributeValueMemberS); ok {
+		record.Status = statusAttr.Value
+	}
+	if mpAttr, ok := result.Item["multipart"].(*types.AttributeValueMemberBOOL); ok {
+		record.Multipart = mpAttr.Value
+	}
+	if uidAttr, ok := result.Item["uploadId"].(*types.AttributeValueMemberS); ok {
+		record.UploadID = uidAttr.Value
+	}
+	if expAttr, ok := result.Item["urlExpiresAt"].(*types.AttributeValueMemberS); ok {
+		record.URLExpiresAt, _ = time.Parse(time.RFC3339, expAttr.Value)
+	}
+	_, record.Deleted = result.Item["deletedAt"]
+
+	return record, nil
+}
+
+// ExtendAllocation moves a pending allocation's urlExpiresAt, and its gsi1
+// sort key, to urlExpiresAt
+func (d *DynamoDBStore) ExtendAllocation(ctx context.Context, accountID, blobID, uploadID string, urlExpiresAt time.Time) error {
+	expires := urlExpiresAt.UTC().Format(time.RFC3339)
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(d.tableName),
+		Key:                 store.BlobKey(accountID, blobID),
+		UpdateExpression:    aws.String("SET urlExpiresAt = :expires, gsi1sk = :gsi1sk"),
+		ConditionExpression: aws.String("#status = :pending AND uploadId = :uploadId AND attribute_not_exists(deletedAt)"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expires":  &types.AttributeValueMemberS{Value: expires},
+			":gsi1sk":   &types.AttributeValueMemberS{Value: fmt.Sprintf("%s%s#%s#%s", store.ExpiresPrefix, expires, accountID, blobID)},
+			":pending":  &types.AttributeValueMemberS{Value: store.StatusPending},
+			":uploadId": &types.AttributeValueMemberS{Value: uploadID},
+		},
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return store.ErrNotPending
+		}
+		return err
+	}
+	return nil
+}
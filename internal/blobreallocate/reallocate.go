@@ -0,0 +1,142 @@
+package blobreallocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// ReallocateRequest is the Blob/reallocateParts method request
+type ReallocateRequest struct {
+	AccountID   string  `json:"accountId"`
+	BlobID      string  `json:"id"`
+	PartNumbers []int32 `json:"partNumbers"`
+}
+
+// ReallocateResponse is the Blob/reallocateParts method response
+type ReallocateResponse struct {
+	AccountID  string                 `json:"accountId"`
+	BlobID     string                 `json:"id"`
+	URLExpires time.Time              `json:"expires"`
+	Parts      []bloballocate.PartURL `json:"parts"`
+}
+
+// ReallocateError represents a JMAP error from Blob/reallocateParts
+type ReallocateError struct {
+	Type    string
+	Message string
+}
+
+func (e *ReallocateError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// BlobRecord holds the DynamoDB record fields needed by Blob/reallocateParts
+type BlobRecord struct {
+	Status       string
+	Multipart    bool
+	UploadID     string
+	URLExpiresAt time.Time
+	Deleted      bool
+}
+
+// Storage presigns part URLs for an existing multipart upload
+type Storage interface {
+	GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error)
+}
+
+// DB handles DynamoDB operations for Blob/reallocateParts
+type DB interface {
+	GetBlobForReallocate(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
+	// ExtendAllocation moves a pending allocation's expiry to urlExpiresAt,
+	// so blob-alloc-cleanup leaves it alone while the new URLs are valid.
+	// Returns store.ErrNotPending if it is no longer pending under uploadID.
+	ExtendAllocation(ctx context.Context, accountID, blobID, uploadID string, urlExpiresAt time.Time) error
+}
+
+// Handler handles Blob/reallocateParts method calls
+type Handler struct {
+	Storage       Storage
+	DB            DB
+	URLExpirySecs int64
+	// PartCount is how many part URLs Blob/allocate hands out for a
+	// multipart upload; zero means bloballocate.DefaultMultipartPartCount.
+	// Only those part numbers can be presigned again.
+	PartCount int
+}
+
+// Reallocate processes a Blob/reallocateParts request
+func (h *Handler) Reallocate(ctx context.Context, req ReallocateRequest) (*ReallocateResponse, error) {
+	if err := h.validatePartNumbers(req.PartNumbers); err != nil {
+		return nil, err
+	}
+
+	record, err := h.DB.GetBlobForReallocate(ctx, req.AccountID, req.BlobID)
+	if err != nil {
+		return nil, &ReallocateError{Type: "serverFail", Message: fmt.Sprintf("failed to get blob record: %v", err)}
+	}
+	if record == nil || record.Deleted {
+		return nil, &ReallocateError{Type: "blobNotFound", Message: "blob not found"}
+	}
+
+	// Verify blob is a pending multipart upload
+	if record.Status != store.StatusPending {
+		return nil, &ReallocateError{Type: "invalidArguments", Message: fmt.Sprintf("blob is not pending (status: %s)", record.Status)}
+	}
+	if !record.Multipart {
+		return nil, &ReallocateError{Type: "invalidArguments", Message: "blob is not a multipart upload"}
+	}
+	if record.UploadID == "" {
+		return nil, &ReallocateError{Type: "serverFail", Message: "blob record missing uploadId"}
+	}
+
+	parts, urlExpires, err := h.Storage.GeneratePresignedPartURLsFor(ctx, req.AccountID, req.BlobID, record.UploadID, req.PartNumbers, h.URLExpirySecs)
+	if err != nil {
+		return nil, &ReallocateError{Type: "serverFail", Message: "failed to generate part upload URLs"}
+	}
+
+	// Never bring the expiry forward: URLs handed out earlier may still be
+	// in use
+	if urlExpires.After(record.URLExpiresAt) {
+		if err := h.DB.ExtendAllocation(ctx, req.AccountID, req.BlobID, record.UploadID, urlExpires); err != nil {
+			if errors.Is(err, store.ErrNotPending) {
+				return nil, &ReallocateError{Type: "blobNotFound", Message: "allocation is no longer pending"}
+			}
+			return nil, &ReallocateError{Type: "serverFail", Message: fmt.Sprintf("failed to extend allocation: %v", err)}
+		}
+	}
+
+	return &ReallocateResponse{
+		AccountID:  req.AccountID,
+		BlobID:     req.BlobID,
+		URLExpires: urlExpires,
+		Parts:      parts,
+	}, nil
+}
+
+// validatePartNumbers checks the requested parts are unique and were part
+// of the allocation
+func (h *Handler) validatePartNumbers(partNumbers []int32) error {
+	if len(partNumbers) == 0 {
+		return &ReallocateError{Type: "invalidArguments", Message: "partNumbers must not be empty"}
+	}
+	partCount := h.PartCount
+	if partCount == 0 {
+		partCount = bloballocate.DefaultMultipartPartCount
+	}
+	seen := make(map[int32]bool, len(partNumbers))
+	for _, n := range partNumbers {
+		if n < 1 || int(n) > partCount {
+			return &ReallocateError{Type: "invalidArguments", Message: fmt.Sprintf("part number %d is outside 1-%d", n, partCount)}
+		}
+		if seen[n] {
+			return &ReallocateError{Type: "invalidArguments", Message: fmt.Sprintf("part number %d is repeated", n)}
+		}
+		seen[n] = true
+	}
+	return nil
+}
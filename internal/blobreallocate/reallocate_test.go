@@ -0,0 +1,154 @@
+package blobreallocate
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// mockStorage implements Storage for testing
+type mockStorage struct {
+	expires      time.Time
+	err          error
+	lastUploadID string
+	lastParts    []int32
+}
+
+func (m *mockStorage) GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	m.lastUploadID = uploadID
+	m.lastParts = partNumbers
+	if m.err != nil {
+		return nil, time.Time{}, m.err
+	}
+	parts := make([]bloballocate.PartURL, len(partNumbers))
+	for i, n := range partNumbers {
+		parts[i] = bloballocate.PartURL{PartNumber: n, URL: fmt.Sprintf("https://example.com/part-%d", n)}
+	}
+	return parts, m.expires, nil
+}
+
+// mockDB implements DB for testing
+type mockDB struct {
+	record    *BlobRecord
+	getErr    error
+	extendErr error
+	extended  *time.Time
+}
+
+func (m *mockDB) GetBlobForReallocate(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+	return m.record, m.getErr
+}
+
+func (m *mockDB) ExtendAllocation(ctx context.Context, accountID, blobID, uploadID string, urlExpiresAt time.Time) error {
+	if m.extendErr != nil {
+		return m.extendErr
+	}
+	m.extended = &urlExpiresAt
+	return nil
+}
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func pendingMultipart() *BlobRecord {
+	return &BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-1", URLExpiresAt: testNow.Add(-time.Minute)}
+}
+
+func TestReallocate_Success(t *testing.T) {
+	storage := &mockStorage{expires: testNow.Add(15 * time.Minute)}
+	db := &mockDB{record: pendingMultipart()}
+	h := &Handler{Storage: storage, DB: db, URLExpirySecs: 900, PartCount: 10}
+
+	resp, err := h.Reallocate(context.Background(), ReallocateRequest{AccountID: "account-1", BlobID: "blob-1", PartNumbers: []int32{3, 7}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if storage.lastUploadID != "upload-1" || !reflect.DeepEqual(storage.lastParts, []int32{3, 7}) {
+		t.Errorf("expected parts 3 and 7 of upload-1, got %v of %q", storage.lastParts, storage.lastUploadID)
+	}
+	if len(resp.Parts) != 2 || resp.Parts[1].PartNumber != 7 || !resp.URLExpires.Equal(storage.expires) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if db.extended == nil || !db.extended.Equal(storage.expires) {
+		t.Errorf("expected the allocation to be extended to %v, got %v", storage.expires, db.extended)
+	}
+}
+
+func TestReallocate_KeepsLaterExpiry(t *testing.T) {
+	record := pendingMultipart()
+	record.URLExpiresAt = testNow.Add(time.Hour)
+	storage := &mockStorage{expires: testNow.Add(15 * time.Minute)}
+	db := &mockDB{record: record}
+	h := &Handler{Storage: storage, DB: db, URLExpirySecs: 900}
+
+	if _, err := h.Reallocate(context.Background(), ReallocateRequest{AccountID: "account-1", BlobID: "blob-1", PartNumbers: []int32{1}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if db.extended != nil {
+		t.Errorf("expected the later expiry to be kept, got %v", *db.extended)
+	}
+}
+
+func TestReallocate_Errors(t *testing.T) {
+	confirmed := pendingMultipart()
+	confirmed.Status = "confirmed"
+	single := pendingMultipart()
+	single.Multipart = false
+	deleted := pendingMultipart()
+	deleted.Deleted = true
+	noUpload := pendingMultipart()
+	noUpload.UploadID = ""
+
+	tests := []struct {
+		name        string
+		partNumbers []int32
+		record      *BlobRecord
+		getErr      error
+		presignErr  error
+		extendErr   error
+		wantType    string
+	}{
+		{"no parts", nil, pendingMultipart(), nil, nil, nil, "invalidArguments"},
+		{"part zero", []int32{0}, pendingMultipart(), nil, nil, nil, "invalidArguments"},
+		{"part beyond allocation", []int32{11}, pendingMultipart(), nil, nil, nil, "invalidArguments"},
+		{"repeated part", []int32{2, 2}, pendingMultipart(), nil, nil, nil, "invalidArguments"},
+		{"missing", []int32{1}, nil, nil, nil, nil, "blobNotFound"},
+		{"deleted", []int32{1}, deleted, nil, nil, nil, "blobNotFound"},
+		{"confirmed", []int32{1}, confirmed, nil, nil, nil, "invalidArguments"},
+		{"single put", []int32{1}, single, nil, nil, nil, "invalidArguments"},
+		{"missing uploadId", []int32{1}, noUpload, nil, nil, nil, "serverFail"},
+		{"db error", []int32{1}, nil, fmt.Errorf("throttled"), nil, nil, "serverFail"},
+		{"presign error", []int32{1}, pendingMultipart(), nil, fmt.Errorf("presign failed"), nil, "serverFail"},
+		{"cleaned up meanwhile", []int32{1}, pendingMultipart(), nil, nil, store.ErrNotPending, "blobNotFound"},
+		{"extend error", []int32{1}, pendingMultipart(), nil, nil, fmt.Errorf("throttled"), "serverFail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{
+				Storage:   &mockStorage{expires: testNow, err: tt.presignErr},
+				DB:        &mockDB{record: tt.record, getErr: tt.getErr, extendErr: tt.extendErr},
+				PartCount: 10,
+			}
+			_, err := h.Reallocate(context.Background(), ReallocateRequest{AccountID: "account-1", BlobID: "blob-1", PartNumbers: tt.partNumbers})
+			reallocErr, ok := err.(*ReallocateError)
+			if !ok || reallocErr.Type != tt.wantType {
+				t.Errorf("expected %s, got %v", tt.wantType, err)
+			}
+		})
+	}
+}
+
+func TestReallocate_DefaultPartCount(t *testing.T) {
+	h := &Handler{Storage: &mockStorage{expires: testNow}, DB: &mockDB{record: pendingMultipart()}}
+	if _, err := h.Reallocate(context.Background(), ReallocateRequest{PartNumbers: []int32{bloballocate.DefaultMultipartPartCount}}); err != nil {
+		t.Errorf("expected the last default part to be allowed, got %v", err)
+	}
+	_, err := h.Reallocate(context.Background(), ReallocateRequest{PartNumbers: []int32{bloballocate.DefaultMultipartPartCount + 1}})
+	if reallocErr, ok := err.(*ReallocateError); !ok || reallocErr.Type != "invalidArguments" {
+		t.Errorf("expected invalidArguments, got %v", err)
+	}
+}
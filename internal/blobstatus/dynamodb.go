@@ -0,0 +1,76 @@
+package blobstatus
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by blobstatus
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+// DynamoDBStore implements DB using AWS DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore for blobstatus
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// GetBlobForStatus returns the blob record fields needed for Blob/allocationStatus.
+// Returns nil if the blob record is not found.
+func (d *DynamoDBStore) GetBlobForStatus(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(d.tableName),
+		Key:                  store.BlobKey(accountID, blobID),
+		ProjectionExpression: aws.String("#status, #size, sizeUnknown, multipart, uploadId, urlExpiresAt, deletedAt"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+			"#size":   "size",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	record := &BlobRecord{}
+
+	if statusAttr, ok := result.Item["status"].(*types.AttributeValueMemberS); ok {
+		record.Status = statusAttr.Value
+	}
+	if sizeAttr, ok := result.Item["size"].(*types.AttributeValueMemberN); ok {
+		record.Size, _ = strconv.ParseInt(sizeAttr.Value, 10, 64)
+	}
+	if suAttr, ok := result.Item["sizeUnknown"].(*types.AttributeValueMemberBOOL); ok {
+		record.SizeUnknown = suAttr.Value
+	}
+	if mpAttr, ok := result.Item["multipart"].(*types.AttributeValueMemberBOOL); ok {
+		record.Multipart = mpAttr.Value
+	}
+	if uidAttr, ok := result.Item["uploadId"].(*types.AttributeValueMemberS); ok {
+		record.UploadID = uidAttr.Value
+	}
+	if expAttr, ok := result.Item["urlExpiresAt"].(*types.AttributeValueMemberS); ok {
+		record.URLExpiresAt, _ = time.Parse(time.RFC3339, expAttr.Value)
+	}
+	_, record.Deleted = result.Item["deletedAt"]
+
+	return record, nil
+}
@@ -0,0 +1,161 @@
+package blobstatus
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// Statuses reported by Blob/allocationStatus. An allocation is expired once
+// its upload URLs have expired, until blob-alloc-cleanup removes it.
+const (
+	StatusPending   = store.StatusPending
+	StatusExpired   = "expired"
+	StatusConfirmed = store.StatusConfirmed
+)
+
+// StatusRequest is the Blob/allocationStatus method request
+type StatusRequest struct {
+	AccountID string `json:"accountId"`
+	BlobID    string `json:"id"`
+}
+
+// StatusResponse is the Blob/allocationStatus method response. Size is
+// omitted while the size of an upload is unknown. UploadedParts and
+// RemainingParts are only set for unconfirmed multipart uploads, and are
+// omitted when empty.
+type StatusResponse struct {
+	AccountID      string                      `json:"accountId"`
+	BlobID         string                      `json:"id"`
+	Status         string                      `json:"status"`
+	Size           *int64                      `json:"size,omitempty"`
+	URLExpires     *time.Time                  `json:"urlExpires,omitempty"`
+	Multipart      bool                        `json:"multipart"`
+	UploadedParts  []bloballocate.UploadedPart `json:"uploadedParts,omitempty"`
+	RemainingParts []int32                     `json:"remainingParts,omitempty"`
+}
+
+// StatusError represents a JMAP error from Blob/allocationStatus
+type StatusError struct {
+	Type    string
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Type, e.Message)
+}
+
+// BlobRecord holds the DynamoDB record fields needed by Blob/allocationStatus
+type BlobRecord struct {
+	Status       string
+	Size         int64
+	SizeUnknown  bool
+	Multipart    bool
+	UploadID     string
+	URLExpiresAt time.Time
+	Deleted      bool
+}
+
+// Storage lists the parts received for a multipart upload
+type Storage interface {
+	ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error)
+}
+
+// DB handles DynamoDB operations for Blob/allocationStatus
+type DB interface {
+	GetBlobForStatus(ctx context.Context, accountID, blobID string) (*BlobRecord, error)
+}
+
+// Handler handles Blob/allocationStatus method calls
+type Handler struct {
+	Storage Storage
+	DB      DB
+	// PartCount is how many part URLs Blob/allocate hands out for a
+	// multipart upload; zero means bloballocate.DefaultMultipartPartCount
+	PartCount int
+	now       func() time.Time
+}
+
+// Status processes a Blob/allocationStatus request
+func (h *Handler) Status(ctx context.Context, req StatusRequest) (*StatusResponse, error) {
+	record, err := h.DB.GetBlobForStatus(ctx, req.AccountID, req.BlobID)
+	if err != nil {
+		return nil, &StatusError{Type: "serverFail", Message: fmt.Sprintf("failed to get blob record: %v", err)}
+	}
+	if record == nil || record.Deleted {
+		return nil, &StatusError{Type: "blobNotFound", Message: "blob not found"}
+	}
+
+	resp := &StatusResponse{
+		AccountID: req.AccountID,
+		BlobID:    req.BlobID,
+		Status:    record.Status,
+		Multipart: record.Multipart,
+	}
+	if !record.SizeUnknown {
+		size := record.Size
+		resp.Size = &size
+	}
+
+	switch record.Status {
+	case store.StatusConfirmed:
+		return resp, nil
+	case store.StatusPending:
+	default:
+		// Blobs uploaded directly have no allocation to report
+		return nil, &StatusError{Type: "blobNotFound", Message: "blob has no allocation"}
+	}
+
+	now := time.Now
+	if h.now != nil {
+		now = h.now
+	}
+	if !record.URLExpiresAt.IsZero() {
+		expires := record.URLExpiresAt
+		resp.URLExpires = &expires
+		if now().After(expires) {
+			resp.Status = StatusExpired
+		}
+	}
+
+	if !record.Multipart {
+		return resp, nil
+	}
+	if record.UploadID == "" {
+		return nil, &StatusError{Type: "serverFail", Message: "blob record missing uploadId"}
+	}
+	parts, err := h.Storage.ListParts(ctx, req.AccountID, req.BlobID, record.UploadID)
+	if err != nil {
+		return nil, &StatusError{Type: "serverFail", Message: fmt.Sprintf("failed to list uploaded parts: %v", err)}
+	}
+	resp.UploadedParts = parts
+	resp.RemainingParts = remainingParts(h.partCount(), parts)
+	return resp, nil
+}
+
+// partCount returns how many part URLs an allocation was given
+func (h *Handler) partCount() int {
+	if h.PartCount > 0 {
+		return h.PartCount
+	}
+	return bloballocate.DefaultMultipartPartCount
+}
+
+// remainingParts returns the part numbers from 1 to partCount not yet
+// uploaded
+func remainingParts(partCount int, uploaded []bloballocate.UploadedPart) []int32 {
+	done := make(map[int32]bool, len(uploaded))
+	for _, p := range uploaded {
+		done[p.PartNumber] = true
+	}
+	remaining := make([]int32, 0, max(partCount-len(done), 0))
+	for i := int32(1); i <= int32(partCount); i++ {
+		if !done[i] {
+			remaining = append(remaining, i)
+		}
+	}
+	return remaining
+}
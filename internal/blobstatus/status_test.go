@@ -0,0 +1,148 @@
+package blobstatus
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+)
+
+// mockStorage implements Storage for testing
+type mockStorage struct {
+	parts        []bloballocate.UploadedPart
+	err          error
+	lastUploadID string
+}
+
+func (m *mockStorage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	m.lastUploadID = uploadID
+	return m.parts, m.err
+}
+
+// mockDB implements DB for testing
+type mockDB struct {
+	record *BlobRecord
+	err    error
+}
+
+func (m *mockDB) GetBlobForStatus(ctx context.Context, accountID, blobID string) (*BlobRecord, error) {
+	return m.record, m.err
+}
+
+var testNow = time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestHandler(record *BlobRecord, storage *mockStorage) *Handler {
+	return &Handler{
+		Storage:   storage,
+		DB:        &mockDB{record: record},
+		PartCount: 4,
+		now:       func() time.Time { return testNow },
+	}
+}
+
+func TestStatus_PendingSinglePut(t *testing.T) {
+	expires := testNow.Add(10 * time.Minute)
+	h := newTestHandler(&BlobRecord{Status: "pending", Size: 1024, URLExpiresAt: expires}, &mockStorage{})
+
+	resp, err := h.Status(context.Background(), StatusRequest{AccountID: "account-1", BlobID: "blob-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Status != StatusPending || resp.Size == nil || *resp.Size != 1024 || !resp.URLExpires.Equal(expires) {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if resp.Multipart || resp.UploadedParts != nil || resp.RemainingParts != nil {
+		t.Errorf("expected no parts for a single PUT, got %+v", resp)
+	}
+}
+
+func TestStatus_Expired(t *testing.T) {
+	h := newTestHandler(&BlobRecord{Status: "pending", Size: 1024, URLExpiresAt: testNow.Add(-time.Second)}, &mockStorage{})
+
+	resp, err := h.Status(context.Background(), StatusRequest{AccountID: "account-1", BlobID: "blob-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Status != StatusExpired {
+		t.Errorf("expected expired, got %q", resp.Status)
+	}
+}
+
+func TestStatus_Multipart(t *testing.T) {
+	storage := &mockStorage{parts: []bloballocate.UploadedPart{
+		{PartNumber: 1, ETag: `"a"`, Size: 5242880},
+		{PartNumber: 3, ETag: `"c"`, Size: 5242880},
+	}}
+	h := newTestHandler(&BlobRecord{Status: "pending", SizeUnknown: true, Multipart: true, UploadID: "upload-1", URLExpiresAt: testNow.Add(time.Minute)}, storage)
+
+	resp, err := h.Status(context.Background(), StatusRequest{AccountID: "account-1", BlobID: "blob-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if storage.lastUploadID != "upload-1" {
+		t.Errorf("expected parts of upload-1, got %q", storage.lastUploadID)
+	}
+	if resp.Size != nil {
+		t.Errorf("expected no size for an unknown size, got %d", *resp.Size)
+	}
+	if len(resp.UploadedParts) != 2 {
+		t.Errorf("expected 2 uploaded parts, got %+v", resp.UploadedParts)
+	}
+	if !reflect.DeepEqual(resp.RemainingParts, []int32{2, 4}) {
+		t.Errorf("expected parts 2 and 4 remaining, got %v", resp.RemainingParts)
+	}
+}
+
+func TestStatus_Confirmed(t *testing.T) {
+	storage := &mockStorage{}
+	h := newTestHandler(&BlobRecord{Status: "confirmed", Size: 2048, Multipart: true, UploadID: "upload-1"}, storage)
+
+	resp, err := h.Status(context.Background(), StatusRequest{AccountID: "account-1", BlobID: "blob-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Status != StatusConfirmed || *resp.Size != 2048 || resp.URLExpires != nil {
+		t.Errorf("unexpected response %+v", resp)
+	}
+	if storage.lastUploadID != "" {
+		t.Error("expected no parts to be listed for a confirmed blob")
+	}
+}
+
+func TestStatus_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		record   *BlobRecord
+		dbErr    error
+		partsErr error
+		wantType string
+	}{
+		{"missing", nil, nil, nil, "blobNotFound"},
+		{"deleted", &BlobRecord{Status: "confirmed", Deleted: true}, nil, nil, "blobNotFound"},
+		{"direct upload", &BlobRecord{Size: 10}, nil, nil, "blobNotFound"},
+		{"db error", nil, fmt.Errorf("throttled"), nil, "serverFail"},
+		{"missing uploadId", &BlobRecord{Status: "pending", Multipart: true}, nil, nil, "serverFail"},
+		{"list error", &BlobRecord{Status: "pending", Multipart: true, UploadID: "upload-1"}, nil, fmt.Errorf("NoSuchUpload"), "serverFail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := &Handler{Storage: &mockStorage{err: tt.partsErr}, DB: &mockDB{record: tt.record, err: tt.dbErr}}
+			_, err := h.Status(context.Background(), StatusRequest{AccountID: "account-1", BlobID: "blob-1"})
+			statusErr, ok := err.(*StatusError)
+			if !ok || statusErr.Type != tt.wantType {
+				t.Errorf("expected %s, got %v", tt.wantType, err)
+			}
+		})
+	}
+}
+
+func TestRemainingParts_DefaultPartCount(t *testing.T) {
+	h := &Handler{}
+	remaining := remainingParts(h.partCount(), []bloballocate.UploadedPart{{PartNumber: 1}})
+	if len(remaining) != bloballocate.DefaultMultipartPartCount-1 || remaining[0] != 2 {
+		t.Errorf("unexpected remaining parts %v", remaining)
+	}
+}
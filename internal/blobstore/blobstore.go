@@ -0,0 +1,137 @@
+// Package blobstore stores blob content. BlobStore is what the blob binaries
+// need from a backend; S3 is the default, and a local directory can stand in
+// for it during offline development. Each binary picks its backend in main()
+// from config, with Open.
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accesspoint"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// Backend names accepted in Config
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+)
+
+// Tag values of an object's Status tag
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+)
+
+// tagOrder is the order core's own object tags are written in; any
+// approved extra tags follow, sorted by key
+var tagOrder = []string{"Account", "Status", "Parent"}
+
+// ErrUnsupported is returned for an operation the backend cannot perform,
+// such as presigning on the filesystem backend
+var ErrUnsupported = errors.New("operation not supported by blob storage backend")
+
+// BlobStore stores blob content, keyed "{accountId}/{blobId}"
+type BlobStore interface {
+	// Upload stores a blob tagged as pending
+	Upload(ctx context.Context, req blobmeta.UploadRequest) error
+	// ConfirmUpload replaces an uploaded blob's tags with confirmed ones
+	ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string, extra map[string]string) error
+	// ConfirmTag replaces an object's tags with confirmed ones
+	ConfirmTag(ctx context.Context, key string, extra map[string]string) error
+	// ReadHead returns up to the first n bytes of an object
+	ReadHead(ctx context.Context, key string, n int64) ([]byte, error)
+	// Checksum returns an object's base64 SHA-256 checksum (see
+	// internal/blobchecksum), or "" if the backend holds none for it
+	Checksum(ctx context.Context, key string) (string, error)
+	// DeleteObject deletes an object; deleting a missing object succeeds
+	DeleteObject(ctx context.Context, key string) error
+
+	GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error)
+	CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error)
+	GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error)
+	GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error)
+	CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error
+	ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error)
+}
+
+// Config selects and configures a backend
+type Config struct {
+	// Backend is BackendS3 or BackendFilesystem
+	Backend string
+	// Bucket and AccessPoints configure the S3 backend
+	Bucket       string
+	AccessPoints accesspoint.Map
+	// Root is the directory the filesystem backend stores objects under
+	Root string
+}
+
+// Open returns the backend cfg selects
+func Open(awsCfg aws.Config, cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendS3, "":
+		client := s3.NewFromConfig(awsCfg)
+		return NewS3Storage(s3.NewPresignClient(client), cfg.Bucket, client).WithAccessPoints(cfg.AccessPoints), nil
+	case BackendFilesystem:
+		return NewFilesystemStorage(cfg.Root)
+	default:
+		return nil, fmt.Errorf("unknown blob storage backend %q", cfg.Backend)
+	}
+}
+
+// Key returns the object key of a blob
+func Key(accountID, blobID string) string {
+	return fmt.Sprintf("%s/%s", accountID, blobID)
+}
+
+// ConfirmedTags returns the tags of a confirmed blob. parentTag and extra,
+// the approved tags a client set (see internal/blobtag), are optional.
+func ConfirmedTags(accountID, parentTag string, extra map[string]string) map[string]string {
+	return tags(accountID, StatusConfirmed, parentTag, extra)
+}
+
+// PendingTags returns the tags of a blob uploaded but not yet confirmed.
+// parentTag and extra are optional.
+func PendingTags(accountID, parentTag string, extra map[string]string) map[string]string {
+	return tags(accountID, StatusPending, parentTag, extra)
+}
+
+// tags returns an object's tags. Core's own tags win over extra ones.
+func tags(accountID, status, parentTag string, extra map[string]string) map[string]string {
+	t := make(map[string]string, len(extra)+3)
+	for name, value := range extra {
+		t[name] = value
+	}
+	t["Account"] = accountID
+	t["Status"] = status
+	delete(t, "Parent")
+	if parentTag != "" {
+		t["Parent"] = parentTag
+	}
+	return t
+}
+
+// tagNames returns the names of tags in the order they are written
+func tagNames(tags map[string]string) []string {
+	names := make([]string, 0, len(tags))
+	var extra []string
+	for _, name := range tagOrder {
+		if _, ok := tags[name]; ok {
+			names = append(names, name)
+		}
+	}
+	for name := range tags {
+		if !slices.Contains(tagOrder, name) {
+			extra = append(extra, name)
+		}
+	}
+	slices.Sort(extra)
+	return append(names, extra...)
+}
@@ -0,0 +1,193 @@
+package blobstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// metaSuffix names the file beside each object holding its content type
+// and tags
+const metaSuffix = ".meta.json"
+
+// objectMeta is what the filesystem backend keeps beside an object
+type objectMeta struct {
+	ContentType string            `json:"contentType"`
+	Tags        map[string]string `json:"tags"`
+}
+
+// FilesystemStorage implements BlobStore on a local directory, for offline
+// development. It cannot presign URLs, so Blob/allocate and Blob/complete
+// return ErrUnsupported; uploads through blob-upload work.
+type FilesystemStorage struct {
+	root string
+}
+
+// NewFilesystemStorage creates a new FilesystemStorage under root, creating
+// the directory if needed
+func NewFilesystemStorage(root string) (*FilesystemStorage, error) {
+	if root == "" {
+		return nil, fmt.Errorf("filesystem blob storage needs a root directory")
+	}
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create blob storage root: %w", err)
+	}
+	return &FilesystemStorage{root: root}, nil
+}
+
+// path returns the file an object is stored in, rejecting keys that would
+// escape the root
+func (f *FilesystemStorage) path(key string) (string, error) {
+	accountID, blobID, ok := strings.Cut(key, "/")
+	if !ok || accountID == "" || blobID == "" || strings.Contains(blobID, "/") || accountID == ".." || blobID == ".." || accountID == "." || blobID == "." {
+		return "", fmt.Errorf("invalid key %q: expected {accountId}/{blobId}", key)
+	}
+	return filepath.Join(f.root, accountID, blobID), nil
+}
+
+// Upload stores a blob tagged as pending
+func (f *FilesystemStorage) Upload(ctx context.Context, req blobmeta.UploadRequest) error {
+	path, err := f.path(req.Key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create account directory: %w", err)
+	}
+	if err := os.WriteFile(path, req.Body, 0o644); err != nil {
+		return fmt.Errorf("failed to write object: %w", err)
+	}
+	return writeMeta(path, objectMeta{ContentType: req.ContentType, Tags: PendingTags(req.AccountID, req.ParentTag, req.Tags)})
+}
+
+// ConfirmUpload replaces an uploaded blob's tags with confirmed ones
+func (f *FilesystemStorage) ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string, extra map[string]string) error {
+	return f.setTags(Key(accountID, blobID), ConfirmedTags(accountID, parentTag, extra))
+}
+
+// ConfirmTag replaces an object's tags with confirmed ones
+func (f *FilesystemStorage) ConfirmTag(ctx context.Context, key string, extra map[string]string) error {
+	accountID, _, _ := strings.Cut(key, "/")
+	return f.setTags(key, ConfirmedTags(accountID, "", extra))
+}
+
+// setTags replaces an existing object's tags
+func (f *FilesystemStorage) setTags(key string, tags map[string]string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	meta, err := readMeta(path)
+	if err != nil {
+		return err
+	}
+	meta.Tags = tags
+	return writeMeta(path, meta)
+}
+
+// ReadHead returns up to the first n bytes of an object
+func (f *FilesystemStorage) ReadHead(ctx context.Context, key string, n int64) ([]byte, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(io.LimitReader(file, n))
+}
+
+// Checksum returns the SHA-256 checksum of an object's content
+func (f *FilesystemStorage) Checksum(ctx context.Context, key string) (string, error) {
+	path, err := f.path(key)
+	if err != nil {
+		return "", err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return blobchecksum.Sum(file)
+}
+
+// DeleteObject deletes an object. Deleting a missing object succeeds, as in S3.
+func (f *FilesystemStorage) DeleteObject(ctx context.Context, key string) error {
+	path, err := f.path(key)
+	if err != nil {
+		return err
+	}
+	for _, p := range []string{path, path + metaSuffix} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to delete object: %w", err)
+		}
+	}
+	return nil
+}
+
+// GeneratePresignedPutURL is not supported
+func (f *FilesystemStorage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error) {
+	return "", time.Time{}, ErrUnsupported
+}
+
+// CreateMultipartUpload is not supported
+func (f *FilesystemStorage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error) {
+	return "", ErrUnsupported
+}
+
+// GeneratePresignedPartURLs is not supported
+func (f *FilesystemStorage) GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	return nil, time.Time{}, ErrUnsupported
+}
+
+// GeneratePresignedPartURLsFor is not supported
+func (f *FilesystemStorage) GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	return nil, time.Time{}, ErrUnsupported
+}
+
+// CompleteMultipartUpload is not supported
+func (f *FilesystemStorage) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+	return ErrUnsupported
+}
+
+// ListParts is not supported
+func (f *FilesystemStorage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	return nil, ErrUnsupported
+}
+
+// readMeta reads the metadata beside the object at path
+func readMeta(path string) (objectMeta, error) {
+	var meta objectMeta
+	data, err := os.ReadFile(path + metaSuffix)
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("invalid object metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// writeMeta writes the metadata beside the object at path
+func writeMeta(path string, meta objectMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+metaSuffix, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write object metadata: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+func TestFilesystemStorage_Lifecycle(t *testing.T) {
+	storage, err := NewFilesystemStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	ctx := context.Background()
+
+	err = storage.Upload(ctx, blobmeta.UploadRequest{Key: "account-1/blob-1", Body: []byte("hello world"), ContentType: "text/plain", AccountID: "account-1", ParentTag: "email-1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	path, _ := storage.path("account-1/blob-1")
+	meta, err := readMeta(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.ContentType != "text/plain" || meta.Tags["Status"] != StatusPending || meta.Tags["Parent"] != "email-1" {
+		t.Errorf("unexpected metadata %+v", meta)
+	}
+
+	if err := storage.ConfirmUpload(ctx, "account-1", "blob-1", "email-1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta, _ := readMeta(path); meta.Tags["Status"] != StatusConfirmed || meta.ContentType != "text/plain" {
+		t.Errorf("expected a confirmed blob, got %+v", meta)
+	}
+
+	head, err := storage.ReadHead(ctx, "account-1/blob-1", 5)
+	if err != nil || string(head) != "hello" {
+		t.Errorf("expected hello, got %q %v", head, err)
+	}
+
+	if err := storage.DeleteObject(ctx, "account-1/blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := storage.ReadHead(ctx, "account-1/blob-1", 5); err == nil {
+		t.Error("expected the object to be gone")
+	}
+	if err := storage.DeleteObject(ctx, "account-1/blob-1"); err != nil {
+		t.Errorf("expected deleting a missing object to succeed, got %v", err)
+	}
+	if err := storage.ConfirmTag(ctx, "account-1/blob-1", nil); err == nil {
+		t.Error("expected tagging a missing object to fail")
+	}
+}
+
+func TestFilesystemStorage_RejectsEscapingKeys(t *testing.T) {
+	storage, _ := NewFilesystemStorage(t.TempDir())
+	for _, key := range []string{"../blob-1", "account-1/..", "account-1/a/b", "blob-1", "/blob-1"} {
+		if err := storage.DeleteObject(context.Background(), key); err == nil {
+			t.Errorf("%q: expected an error", key)
+		}
+	}
+}
+
+func TestFilesystemStorage_PresignUnsupported(t *testing.T) {
+	storage, _ := NewFilesystemStorage(t.TempDir())
+	if _, _, err := storage.GeneratePresignedPutURL(context.Background(), "account-1", "blob-1", 10, "text/plain", 900, false, ""); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+	if _, err := storage.CreateMultipartUpload(context.Background(), "account-1", "blob-1", "text/plain", false); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	store, err := Open(aws.Config{}, Config{Backend: BackendS3, Bucket: "test-bucket"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.(*S3Storage); !ok {
+		t.Errorf("expected S3Storage, got %T", store)
+	}
+
+	store, err = Open(aws.Config{}, Config{Backend: BackendFilesystem, Root: t.TempDir()})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, ok := store.(*FilesystemStorage); !ok {
+		t.Errorf("expected FilesystemStorage, got %T", store)
+	}
+
+	if _, err := Open(aws.Config{}, Config{Backend: "gcs"}); err == nil {
+		t.Error("expected an error for an unknown backend")
+	}
+	if _, err := Open(aws.Config{}, Config{Backend: BackendFilesystem}); err == nil {
+		t.Error("expected an error without a root")
+	}
+}
@@ -0,0 +1,321 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accesspoint"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/otelmetrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// presignDuration records how long presigning takes by S3 operation
+var presignDuration = otelmetrics.Histogram("jmap.s3.presign.duration", "S3 URL presigning latency", "ms")
+
+// recordPresign records one presign call's latency
+func recordPresign(ctx context.Context, operation string, start time.Time) {
+	presignDuration.Record(ctx, otelmetrics.Milliseconds(time.Since(start)), metric.WithAttributes(
+		attribute.String("operation", operation),
+	))
+}
+
+// S3PresignClient defines the interface for S3 presign operations
+type S3PresignClient interface {
+	PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignUploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+}
+
+// S3Client defines the interface for S3 object and multipart operations
+// (non-presigned)
+type S3Client interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error)
+}
+
+// S3Storage implements BlobStore using AWS S3
+type S3Storage struct {
+	presignClient S3PresignClient
+	s3Client      S3Client
+	bucketName    string
+	accessPoints  accesspoint.Map
+}
+
+// NewS3Storage creates a new S3Storage
+func NewS3Storage(presignClient S3PresignClient, bucketName string, s3Client S3Client) *S3Storage {
+	return &S3Storage{
+		presignClient: presignClient,
+		s3Client:      s3Client,
+		bucketName:    bucketName,
+	}
+}
+
+// WithAccessPoints sends requests for accounts with an access point through
+// it, so their presigned URLs cannot reach other accounts' objects
+func (s *S3Storage) WithAccessPoints(points accesspoint.Map) *S3Storage {
+	s.accessPoints = points
+	return s
+}
+
+// bucket returns the bucket or access point for accountID's objects
+func (s *S3Storage) bucket(accountID string) string {
+	return s.accessPoints.Bucket(accountID, s.bucketName)
+}
+
+// keyBucket returns the bucket or access point for the object at key
+func (s *S3Storage) keyBucket(key string) string {
+	accountID, _, _ := strings.Cut(key, "/")
+	return s.bucket(accountID)
+}
+
+// Upload uploads a blob with pending status tag
+func (s *S3Storage) Upload(ctx context.Context, req blobmeta.UploadRequest) error {
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket(req.AccountID)),
+		Key:         aws.String(req.Key),
+		Body:        bytes.NewReader(req.Body),
+		ContentType: aws.String(req.ContentType),
+		Tagging:     aws.String(tagging(PendingTags(req.AccountID, req.ParentTag, req.Tags))),
+	})
+	return err
+}
+
+// ConfirmUpload updates an uploaded blob's tags to confirmed
+func (s *S3Storage) ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string, extra map[string]string) error {
+	return s.putTags(ctx, Key(accountID, blobID), ConfirmedTags(accountID, parentTag, extra))
+}
+
+// ConfirmTag updates an object's tags to confirmed
+func (s *S3Storage) ConfirmTag(ctx context.Context, key string, extra map[string]string) error {
+	accountID, _, _ := strings.Cut(key, "/")
+	return s.putTags(ctx, key, ConfirmedTags(accountID, "", extra))
+}
+
+// tagging encodes tags as the query string PutObject takes
+func tagging(tags map[string]string) string {
+	names := tagNames(tags)
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, url.QueryEscape(name)+"="+url.QueryEscape(tags[name]))
+	}
+	return strings.Join(pairs, "&")
+}
+
+// putTags replaces an object's tags
+func (s *S3Storage) putTags(ctx context.Context, key string, tags map[string]string) error {
+	names := tagNames(tags)
+	tagSet := make([]s3types.Tag, 0, len(names))
+	for _, name := range names {
+		tagSet = append(tagSet, s3types.Tag{Key: aws.String(name), Value: aws.String(tags[name])})
+	}
+	_, err := s.s3Client.PutObjectTagging(ctx, &s3.PutObjectTaggingInput{
+		Bucket:  aws.String(s.keyBucket(key)),
+		Key:     aws.String(key),
+		Tagging: &s3types.Tagging{TagSet: tagSet},
+	})
+	return err
+}
+
+// ReadHead returns up to the first n bytes of an object
+func (s *S3Storage) ReadHead(ctx context.Context, key string, n int64) ([]byte, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.keyBucket(key)),
+		Key:    aws.String(key),
+		Range:  aws.String(fmt.Sprintf("bytes=0-%d", n-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer result.Body.Close()
+	return io.ReadAll(io.LimitReader(result.Body, n))
+}
+
+// Checksum returns the SHA-256 checksum S3 holds for an object, composite
+// for a multipart upload, or "" if it was uploaded without one
+func (s *S3Storage) Checksum(ctx context.Context, key string) (string, error) {
+	result, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket:       aws.String(s.keyBucket(key)),
+		Key:          aws.String(key),
+		ChecksumMode: s3types.ChecksumModeEnabled,
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.ChecksumSHA256), nil
+}
+
+// DeleteObject deletes an object
+func (s *S3Storage) DeleteObject(ctx context.Context, key string) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.keyBucket(key)),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// GeneratePresignedPutURL generates a pre-signed URL for PUT upload with
+// constraints. A checksum is signed as x-amz-checksum-sha256, which the
+// client must send and S3 checks the content against.
+func (s *S3Storage) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error) {
+	// Note: We don't include Tagging here because it would require the client
+	// to send the x-amz-tagging header with the exact same value.
+	// Instead, blob-confirm Lambda applies the Status=confirmed tag after upload.
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket(accountID)),
+		Key:         aws.String(Key(accountID, blobID)),
+		ContentType: aws.String(contentType),
+	}
+	if !sizeUnknown {
+		input.ContentLength = aws.Int64(size)
+	}
+	if checksum != "" {
+		input.ChecksumSHA256 = aws.String(checksum)
+	}
+
+	start := time.Now()
+	presignReq, err := s.presignClient.PresignPutObject(ctx, input, func(opts *s3.PresignOptions) {
+		opts.Expires = time.Duration(urlExpirySecs) * time.Second
+	})
+	recordPresign(ctx, "PutObject", start)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to presign PUT request: %w", err)
+	}
+
+	urlExpires := time.Now().Add(time.Duration(urlExpirySecs) * time.Second)
+	return presignReq.URL, urlExpires, nil
+}
+
+// CreateMultipartUpload initiates a multipart upload in S3 and returns the
+// upload ID. With checksums, S3 keeps each part's SHA-256 and the completed
+// object's composite checksum.
+func (s *S3Storage) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(s.bucket(accountID)),
+		Key:         aws.String(Key(accountID, blobID)),
+		ContentType: aws.String(contentType),
+	}
+	if checksums {
+		input.ChecksumAlgorithm = s3types.ChecksumAlgorithmSha256
+	}
+	output, err := s.s3Client.CreateMultipartUpload(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+
+	return aws.ToString(output.UploadId), nil
+}
+
+// GeneratePresignedPartURLs generates presigned URLs for uploading individual parts
+func (s *S3Storage) GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	partNumbers := make([]int32, partCount)
+	for i := range partNumbers {
+		partNumbers[i] = int32(i + 1)
+	}
+	return s.GeneratePresignedPartURLsFor(ctx, accountID, blobID, uploadID, partNumbers, urlExpirySecs)
+}
+
+// GeneratePresignedPartURLsFor generates presigned URLs for uploading the
+// given parts of an existing multipart upload
+func (s *S3Storage) GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	key := Key(accountID, blobID)
+	parts := make([]bloballocate.PartURL, 0, len(partNumbers))
+
+	for _, partNum := range partNumbers {
+		start := time.Now()
+		presignReq, err := s.presignClient.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket(accountID)),
+			Key:        aws.String(key),
+			UploadId:   aws.String(uploadID),
+			PartNumber: aws.Int32(partNum),
+		}, func(opts *s3.PresignOptions) {
+			opts.Expires = time.Duration(urlExpirySecs) * time.Second
+		})
+		recordPresign(ctx, "UploadPart", start)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("failed to presign upload part %d: %w", partNum, err)
+		}
+
+		parts = append(parts, bloballocate.PartURL{
+			PartNumber: partNum,
+			URL:        presignReq.URL,
+		})
+	}
+
+	urlExpires := time.Now().Add(time.Duration(urlExpirySecs) * time.Second)
+	return parts, urlExpires, nil
+}
+
+// CompleteMultipartUpload finalizes a multipart upload in S3. Part
+// checksums are passed on for S3 to check against the parts it received.
+func (s *S3Storage) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+	s3Parts := make([]s3types.CompletedPart, len(parts))
+	for i, p := range parts {
+		s3Parts[i] = s3types.CompletedPart{
+			PartNumber: aws.Int32(p.PartNumber),
+			ETag:       aws.String(p.ETag),
+		}
+		if p.ChecksumSHA256 != "" {
+			s3Parts[i].ChecksumSHA256 = aws.String(p.ChecksumSHA256)
+		}
+	}
+
+	_, err := s.s3Client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(s.bucket(accountID)),
+		Key:      aws.String(Key(accountID, blobID)),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &s3types.CompletedMultipartUpload{
+			Parts: s3Parts,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete multipart upload: %w", err)
+	}
+
+	return nil
+}
+
+// ListParts returns the parts S3 has received for a multipart upload, in
+// part number order
+func (s *S3Storage) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	var parts []bloballocate.UploadedPart
+	input := &s3.ListPartsInput{
+		Bucket:   aws.String(s.bucket(accountID)),
+		Key:      aws.String(Key(accountID, blobID)),
+		UploadId: aws.String(uploadID),
+	}
+	for {
+		output, err := s.s3Client.ListParts(ctx, input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list parts: %w", err)
+		}
+		for _, p := range output.Parts {
+			parts = append(parts, bloballocate.UploadedPart{
+				PartNumber: aws.ToInt32(p.PartNumber),
+				ETag:       aws.ToString(p.ETag),
+				Size:       aws.ToInt64(p.Size),
+			})
+		}
+		if !aws.ToBool(output.IsTruncated) {
+			return parts, nil
+		}
+		input.PartNumberMarker = output.NextPartNumberMarker
+	}
+}
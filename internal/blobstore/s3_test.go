@@ -0,0 +1,501 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/accesspoint"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// MockS3PresignClient implements S3PresignClient for testing
+type MockS3PresignClient struct {
+	PresignPutObjectFunc   func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignUploadPartFunc  func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error)
+	PresignUploadPartCalls []s3.UploadPartInput
+}
+
+func (m *MockS3PresignClient) PresignPutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if m.PresignPutObjectFunc != nil {
+		return m.PresignPutObjectFunc(ctx, params, optFns...)
+	}
+	return &v4.PresignedHTTPRequest{URL: "https://example.com/presigned"}, nil
+}
+
+func (m *MockS3PresignClient) PresignUploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+	if m.PresignUploadPartCalls == nil {
+		m.PresignUploadPartCalls = []s3.UploadPartInput{}
+	}
+	m.PresignUploadPartCalls = append(m.PresignUploadPartCalls, *params)
+	if m.PresignUploadPartFunc != nil {
+		return m.PresignUploadPartFunc(ctx, params, optFns...)
+	}
+	return &v4.PresignedHTTPRequest{URL: fmt.Sprintf("https://example.com/part/%d", aws.ToInt32(params.PartNumber))}, nil
+}
+
+// MockS3Client implements S3Client for testing
+type MockS3Client struct {
+	CreateMultipartUploadFunc   func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	CompleteMultipartUploadFunc func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUploadFunc    func(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+	PutObjectCalls              []*s3.PutObjectInput
+	PutObjectTaggingCalls       []*s3.PutObjectTaggingInput
+	GetObjectCalls              []*s3.GetObjectInput
+	DeleteObjectCalls           []*s3.DeleteObjectInput
+	HeadObjectCalls             []*s3.HeadObjectInput
+	Body                        string
+	ChecksumSHA256              string
+	ListPartsPages              []*s3.ListPartsOutput
+	ListPartsCalls              []s3.ListPartsInput
+}
+
+func (m *MockS3Client) ListParts(ctx context.Context, params *s3.ListPartsInput, optFns ...func(*s3.Options)) (*s3.ListPartsOutput, error) {
+	m.ListPartsCalls = append(m.ListPartsCalls, *params)
+	if len(m.ListPartsPages) == 0 {
+		return nil, fmt.Errorf("NoSuchUpload")
+	}
+	page := m.ListPartsPages[0]
+	m.ListPartsPages = m.ListPartsPages[1:]
+	return page, nil
+}
+
+func (m *MockS3Client) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.PutObjectCalls = append(m.PutObjectCalls, params)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (m *MockS3Client) PutObjectTagging(ctx context.Context, params *s3.PutObjectTaggingInput, optFns ...func(*s3.Options)) (*s3.PutObjectTaggingOutput, error) {
+	m.PutObjectTaggingCalls = append(m.PutObjectTaggingCalls, params)
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (m *MockS3Client) GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	m.GetObjectCalls = append(m.GetObjectCalls, params)
+	return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(m.Body))}, nil
+}
+
+func (m *MockS3Client) HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	m.HeadObjectCalls = append(m.HeadObjectCalls, params)
+	output := &s3.HeadObjectOutput{}
+	if m.ChecksumSHA256 != "" {
+		output.ChecksumSHA256 = aws.String(m.ChecksumSHA256)
+	}
+	return output, nil
+}
+
+func (m *MockS3Client) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	m.DeleteObjectCalls = append(m.DeleteObjectCalls, params)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (m *MockS3Client) CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	if m.CreateMultipartUploadFunc != nil {
+		return m.CreateMultipartUploadFunc(ctx, params, optFns...)
+	}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("test-upload-id")}, nil
+}
+
+func (m *MockS3Client) CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	if m.CompleteMultipartUploadFunc != nil {
+		return m.CompleteMultipartUploadFunc(ctx, params, optFns...)
+	}
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+func (m *MockS3Client) AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	if m.AbortMultipartUploadFunc != nil {
+		return m.AbortMultipartUploadFunc(ctx, params, optFns...)
+	}
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+func TestCreateMultipartUpload_Success(t *testing.T) {
+	var capturedInput *s3.CreateMultipartUploadInput
+	mockS3 := &MockS3Client{
+		CreateMultipartUploadFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			capturedInput = params
+			return &s3.CreateMultipartUploadOutput{
+				UploadId: aws.String("upload-abc-123"),
+			}, nil
+		},
+	}
+	mockPresign := &MockS3PresignClient{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	uploadID, err := storage.CreateMultipartUpload(context.Background(), "account-1", "blob-1", "message/rfc822", false)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if uploadID != "upload-abc-123" {
+		t.Errorf("expected uploadID 'upload-abc-123', got %q", uploadID)
+	}
+	if capturedInput == nil {
+		t.Fatal("expected CreateMultipartUpload to be called")
+	}
+	if aws.ToString(capturedInput.Bucket) != "test-bucket" {
+		t.Errorf("expected bucket 'test-bucket', got %q", aws.ToString(capturedInput.Bucket))
+	}
+	if aws.ToString(capturedInput.Key) != "account-1/blob-1" {
+		t.Errorf("expected key 'account-1/blob-1', got %q", aws.ToString(capturedInput.Key))
+	}
+	if aws.ToString(capturedInput.ContentType) != "message/rfc822" {
+		t.Errorf("expected content type 'message/rfc822', got %q", aws.ToString(capturedInput.ContentType))
+	}
+	if capturedInput.ChecksumAlgorithm != "" {
+		t.Errorf("expected no checksum algorithm, got %q", capturedInput.ChecksumAlgorithm)
+	}
+
+	if _, err := storage.CreateMultipartUpload(context.Background(), "account-1", "blob-1", "message/rfc822", true); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if capturedInput.ChecksumAlgorithm != s3types.ChecksumAlgorithmSha256 {
+		t.Errorf("expected SHA256 checksums, got %q", capturedInput.ChecksumAlgorithm)
+	}
+}
+
+func TestCreateMultipartUpload_Error(t *testing.T) {
+	mockS3 := &MockS3Client{
+		CreateMultipartUploadFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			return nil, fmt.Errorf("access denied")
+		},
+	}
+	mockPresign := &MockS3PresignClient{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	_, err := storage.CreateMultipartUpload(context.Background(), "account-1", "blob-1", "message/rfc822", false)
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestGeneratePresignedPartURLs_Success(t *testing.T) {
+	mockPresign := &MockS3PresignClient{}
+	mockS3 := &MockS3Client{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	parts, expires, err := storage.GeneratePresignedPartURLs(context.Background(), "account-1", "blob-1", "upload-123", 3, 900)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("expected 3 parts, got %d", len(parts))
+	}
+	if expires.IsZero() {
+		t.Fatal("expected non-zero expires time")
+	}
+
+	// Verify part numbers are 1-indexed
+	for i, part := range parts {
+		expectedPartNum := int32(i + 1)
+		if part.PartNumber != expectedPartNum {
+			t.Errorf("part %d: expected PartNumber %d, got %d", i, expectedPartNum, part.PartNumber)
+		}
+		if part.URL == "" {
+			t.Errorf("part %d: expected non-empty URL", i)
+		}
+	}
+
+	// Verify presign calls had correct inputs
+	if len(mockPresign.PresignUploadPartCalls) != 3 {
+		t.Fatalf("expected 3 presign calls, got %d", len(mockPresign.PresignUploadPartCalls))
+	}
+	for i, call := range mockPresign.PresignUploadPartCalls {
+		if aws.ToString(call.Bucket) != "test-bucket" {
+			t.Errorf("call %d: expected bucket 'test-bucket', got %q", i, aws.ToString(call.Bucket))
+		}
+		if aws.ToString(call.Key) != "account-1/blob-1" {
+			t.Errorf("call %d: expected key 'account-1/blob-1', got %q", i, aws.ToString(call.Key))
+		}
+		if aws.ToString(call.UploadId) != "upload-123" {
+			t.Errorf("call %d: expected uploadId 'upload-123', got %q", i, aws.ToString(call.UploadId))
+		}
+		if aws.ToInt32(call.PartNumber) != int32(i+1) {
+			t.Errorf("call %d: expected partNumber %d, got %d", i, i+1, aws.ToInt32(call.PartNumber))
+		}
+	}
+}
+
+func TestGeneratePresignedPartURLs_PresignError(t *testing.T) {
+	mockPresign := &MockS3PresignClient{
+		PresignUploadPartFunc: func(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+			return nil, fmt.Errorf("presign failed")
+		},
+	}
+	mockS3 := &MockS3Client{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	_, _, err := storage.GeneratePresignedPartURLs(context.Background(), "account-1", "blob-1", "upload-123", 3, 900)
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestGeneratePresignedPartURLsFor_SelectedParts(t *testing.T) {
+	mockPresign := &MockS3PresignClient{}
+	storage := NewS3Storage(mockPresign, "test-bucket", &MockS3Client{})
+
+	parts, _, err := storage.GeneratePresignedPartURLsFor(context.Background(), "account-1", "blob-1", "upload-123", []int32{2, 7}, 900)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(parts) != 2 || parts[0].PartNumber != 2 || parts[1].PartNumber != 7 {
+		t.Fatalf("unexpected parts %+v", parts)
+	}
+	if len(mockPresign.PresignUploadPartCalls) != 2 || aws.ToInt32(mockPresign.PresignUploadPartCalls[1].PartNumber) != 7 {
+		t.Errorf("expected parts 2 and 7 to be presigned, got %d calls", len(mockPresign.PresignUploadPartCalls))
+	}
+	if aws.ToString(mockPresign.PresignUploadPartCalls[0].UploadId) != "upload-123" {
+		t.Errorf("expected uploadId 'upload-123', got %q", aws.ToString(mockPresign.PresignUploadPartCalls[0].UploadId))
+	}
+}
+
+func TestCompleteMultipartUpload_Success(t *testing.T) {
+	var capturedInput *s3.CompleteMultipartUploadInput
+	mockS3 := &MockS3Client{
+		CompleteMultipartUploadFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+			capturedInput = params
+			return &s3.CompleteMultipartUploadOutput{}, nil
+		},
+	}
+	mockPresign := &MockS3PresignClient{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	completedParts := []bloballocate.CompletedPart{
+		{PartNumber: 1, ETag: "\"etag1\"", ChecksumSHA256: "c3VtMQ=="},
+		{PartNumber: 2, ETag: "\"etag2\""},
+	}
+	err := storage.CompleteMultipartUpload(context.Background(), "account-1", "blob-1", "upload-123", completedParts)
+
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if capturedInput == nil {
+		t.Fatal("expected CompleteMultipartUpload to be called")
+	}
+	if aws.ToString(capturedInput.Bucket) != "test-bucket" {
+		t.Errorf("expected bucket 'test-bucket', got %q", aws.ToString(capturedInput.Bucket))
+	}
+	if aws.ToString(capturedInput.Key) != "account-1/blob-1" {
+		t.Errorf("expected key 'account-1/blob-1', got %q", aws.ToString(capturedInput.Key))
+	}
+	if aws.ToString(capturedInput.UploadId) != "upload-123" {
+		t.Errorf("expected uploadId 'upload-123', got %q", aws.ToString(capturedInput.UploadId))
+	}
+	if len(capturedInput.MultipartUpload.Parts) != 2 {
+		t.Fatalf("expected 2 parts, got %d", len(capturedInput.MultipartUpload.Parts))
+	}
+	if aws.ToInt32(capturedInput.MultipartUpload.Parts[0].PartNumber) != 1 {
+		t.Errorf("expected first part number 1, got %d", aws.ToInt32(capturedInput.MultipartUpload.Parts[0].PartNumber))
+	}
+	if aws.ToString(capturedInput.MultipartUpload.Parts[0].ETag) != "\"etag1\"" {
+		t.Errorf("expected first part ETag '\"etag1\"', got %q", aws.ToString(capturedInput.MultipartUpload.Parts[0].ETag))
+	}
+	if aws.ToString(capturedInput.MultipartUpload.Parts[0].ChecksumSHA256) != "c3VtMQ==" {
+		t.Errorf("expected first part checksum, got %q", aws.ToString(capturedInput.MultipartUpload.Parts[0].ChecksumSHA256))
+	}
+	if capturedInput.MultipartUpload.Parts[1].ChecksumSHA256 != nil {
+		t.Errorf("expected no second part checksum, got %q", aws.ToString(capturedInput.MultipartUpload.Parts[1].ChecksumSHA256))
+	}
+}
+
+func TestCompleteMultipartUpload_Error(t *testing.T) {
+	mockS3 := &MockS3Client{
+		CompleteMultipartUploadFunc: func(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+			return nil, fmt.Errorf("complete failed")
+		},
+	}
+	mockPresign := &MockS3PresignClient{}
+
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3)
+	err := storage.CompleteMultipartUpload(context.Background(), "account-1", "blob-1", "upload-123", []bloballocate.CompletedPart{{PartNumber: 1, ETag: "etag1"}})
+
+	if err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestS3Storage_WithAccessPoints(t *testing.T) {
+	const arn = "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/jmap-shared-inbox"
+	var putBuckets, partBuckets, createBuckets []string
+	mockPresign := &MockS3PresignClient{
+		PresignPutObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+			putBuckets = append(putBuckets, aws.ToString(params.Bucket))
+			return &v4.PresignedHTTPRequest{URL: "https://example.com/presigned"}, nil
+		},
+	}
+	mockS3 := &MockS3Client{
+		CreateMultipartUploadFunc: func(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+			createBuckets = append(createBuckets, aws.ToString(params.Bucket))
+			return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+		},
+	}
+	storage := NewS3Storage(mockPresign, "test-bucket", mockS3).WithAccessPoints(accesspoint.Map{"shared-inbox": arn})
+	ctx := context.Background()
+
+	for _, accountID := range []string{"shared-inbox", "user-1"} {
+		if _, _, err := storage.GeneratePresignedPutURL(ctx, accountID, "blob-1", 10, "text/plain", 900, false, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, err := storage.CreateMultipartUpload(ctx, accountID, "blob-1", "text/plain", false); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if _, _, err := storage.GeneratePresignedPartURLs(ctx, accountID, "blob-1", "upload-1", 1, 900); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	for _, call := range mockPresign.PresignUploadPartCalls {
+		partBuckets = append(partBuckets, aws.ToString(call.Bucket))
+	}
+
+	want := []string{arn, "test-bucket"}
+	for name, got := range map[string][]string{"put": putBuckets, "create": createBuckets, "part": partBuckets} {
+		if len(got) != 2 || got[0] != want[0] || got[1] != want[1] {
+			t.Errorf("%s: expected %v, got %v", name, want, got)
+		}
+	}
+}
+
+func TestS3Storage_UploadAndConfirm(t *testing.T) {
+	mockS3 := &MockS3Client{}
+	storage := NewS3Storage(&MockS3PresignClient{}, "test-bucket", mockS3)
+	ctx := context.Background()
+
+	err := storage.Upload(ctx, blobmeta.UploadRequest{Key: "account-1/blob-1", Body: []byte("hello"), ContentType: "text/plain", AccountID: "account-1", ParentTag: "email-1", Tags: map[string]string{"Source": "mail import", "Retention": "7y"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	put := mockS3.PutObjectCalls[0]
+	if aws.ToString(put.Tagging) != "Account=account-1&Status=pending&Parent=email-1&Retention=7y&Source=mail+import" {
+		t.Errorf("unexpected tagging %q", aws.ToString(put.Tagging))
+	}
+	if aws.ToString(put.Bucket) != "test-bucket" || aws.ToString(put.Key) != "account-1/blob-1" {
+		t.Errorf("unexpected object %s/%s", aws.ToString(put.Bucket), aws.ToString(put.Key))
+	}
+
+	if err := storage.ConfirmUpload(ctx, "account-1", "blob-1", "email-1", map[string]string{"Source": "mail import"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := storage.ConfirmTag(ctx, "account-2/blob-2", map[string]string{"Retention": "7y", "Status": "spoofed"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []string{"Account=account-1,Status=confirmed,Parent=email-1,Source=mail import", "Account=account-2,Status=confirmed,Retention=7y"}
+	for i, call := range mockS3.PutObjectTaggingCalls {
+		var pairs []string
+		for _, tag := range call.Tagging.TagSet {
+			pairs = append(pairs, aws.ToString(tag.Key)+"="+aws.ToString(tag.Value))
+		}
+		if got := strings.Join(pairs, ","); got != want[i] {
+			t.Errorf("call %d: expected tags %s, got %s", i, want[i], got)
+		}
+	}
+}
+
+func TestS3Storage_ReadHeadAndDelete(t *testing.T) {
+	mockS3 := &MockS3Client{Body: "%PDF-1.7 and the rest"}
+	storage := NewS3Storage(&MockS3PresignClient{}, "test-bucket", mockS3)
+	ctx := context.Background()
+
+	head, err := storage.ReadHead(ctx, "account-1/blob-1", 8)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(head) != "%PDF-1.7" {
+		t.Errorf("unexpected head %q", head)
+	}
+	if aws.ToString(mockS3.GetObjectCalls[0].Range) != "bytes=0-7" {
+		t.Errorf("unexpected range %q", aws.ToString(mockS3.GetObjectCalls[0].Range))
+	}
+
+	if err := storage.DeleteObject(ctx, "account-1/blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if del := mockS3.DeleteObjectCalls[0]; aws.ToString(del.Bucket) != "test-bucket" || aws.ToString(del.Key) != "account-1/blob-1" {
+		t.Errorf("unexpected delete %s/%s", aws.ToString(del.Bucket), aws.ToString(del.Key))
+	}
+}
+
+func TestS3Storage_PresignedPutChecksum(t *testing.T) {
+	var captured *s3.PutObjectInput
+	presign := &MockS3PresignClient{
+		PresignPutObjectFunc: func(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.PresignOptions)) (*v4.PresignedHTTPRequest, error) {
+			captured = params
+			return &v4.PresignedHTTPRequest{URL: "https://example.com/presigned"}, nil
+		},
+	}
+	storage := NewS3Storage(presign, "test-bucket", &MockS3Client{})
+
+	if _, _, err := storage.GeneratePresignedPutURL(context.Background(), "account-1", "blob-1", 10, "text/plain", 900, false, ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if captured.ChecksumSHA256 != nil {
+		t.Errorf("expected no checksum, got %q", aws.ToString(captured.ChecksumSHA256))
+	}
+	if _, _, err := storage.GeneratePresignedPutURL(context.Background(), "account-1", "blob-1", 10, "text/plain", 900, false, "c3VtMQ=="); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if aws.ToString(captured.ChecksumSHA256) != "c3VtMQ==" {
+		t.Errorf("expected the checksum to be signed, got %q", aws.ToString(captured.ChecksumSHA256))
+	}
+}
+
+func TestS3Storage_Checksum(t *testing.T) {
+	mockS3 := &MockS3Client{ChecksumSHA256: "c3VtMQ==-2"}
+	storage := NewS3Storage(&MockS3PresignClient{}, "test-bucket", mockS3)
+
+	checksum, err := storage.Checksum(context.Background(), "account-1/blob-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if checksum != "c3VtMQ==-2" {
+		t.Errorf("unexpected checksum %q", checksum)
+	}
+	head := mockS3.HeadObjectCalls[0]
+	if aws.ToString(head.Key) != "account-1/blob-1" || head.ChecksumMode != s3types.ChecksumModeEnabled {
+		t.Errorf("unexpected head %s, checksum mode %q", aws.ToString(head.Key), head.ChecksumMode)
+	}
+}
+
+func TestS3Storage_ListParts(t *testing.T) {
+	mockS3 := &MockS3Client{ListPartsPages: []*s3.ListPartsOutput{
+		{
+			Parts:                []s3types.Part{{PartNumber: aws.Int32(1), ETag: aws.String(`"etag1"`), Size: aws.Int64(5242880)}},
+			IsTruncated:          aws.Bool(true),
+			NextPartNumberMarker: aws.String("1"),
+		},
+		{
+			Parts: []s3types.Part{{PartNumber: aws.Int32(3), ETag: aws.String(`"etag3"`), Size: aws.Int64(100)}},
+		},
+	}}
+	storage := NewS3Storage(&MockS3PresignClient{}, "test-bucket", mockS3)
+
+	parts, err := storage.ListParts(context.Background(), "account-1", "blob-1", "upload-123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := []bloballocate.UploadedPart{{PartNumber: 1, ETag: `"etag1"`, Size: 5242880}, {PartNumber: 3, ETag: `"etag3"`, Size: 100}}
+	if len(parts) != len(want) || parts[0] != want[0] || parts[1] != want[1] {
+		t.Errorf("expected %v, got %v", want, parts)
+	}
+	if len(mockS3.ListPartsCalls) != 2 || aws.ToString(mockS3.ListPartsCalls[1].PartNumberMarker) != "1" {
+		t.Errorf("expected the second page to start after part 1, got %+v", mockS3.ListPartsCalls)
+	}
+	if aws.ToString(mockS3.ListPartsCalls[0].UploadId) != "upload-123" || aws.ToString(mockS3.ListPartsCalls[0].Key) != "account-1/blob-1" {
+		t.Errorf("unexpected request %+v", mockS3.ListPartsCalls[0])
+	}
+
+	if _, err := storage.ListParts(context.Background(), "account-1", "blob-1", "upload-123"); err == nil {
+		t.Error("expected an error for an unknown upload")
+	}
+}
@@ -0,0 +1,134 @@
+// Package blobtag validates the extra S3 tags clients may set on blobs, such
+// as Source or Retention, so bucket lifecycle rules can be keyed on them.
+// Only keys the deployment approves are accepted; the Account, Status and
+// Parent tags are always set by core itself.
+package blobtag
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MaxKeys is how many keys may be approved. S3 allows 10 tags on an object,
+// and core uses the other three.
+const MaxKeys = 7
+
+// MaxValueLength is the longest tag value S3 accepts
+const MaxValueLength = 256
+
+// maxKeyLength is the longest tag key S3 accepts
+const maxKeyLength = 128
+
+// HeaderPrefix starts the name of each tag header on a direct upload, as in
+// X-Tag-Source
+const HeaderPrefix = "X-Tag-"
+
+// reserved are the tag keys core sets itself
+var reserved = []string{"Account", "Status", "Parent"}
+
+// ErrInvalid is returned for tags with an unapproved key or invalid value
+var ErrInvalid = errors.New("invalid blob tags")
+
+// Keys is the set of approved tag keys, in their canonical case
+type Keys []string
+
+// ParseKeys checks a list of tag keys can be approved
+func ParseKeys(names []string) (Keys, error) {
+	if len(names) > MaxKeys {
+		return nil, fmt.Errorf("at most %d tag keys can be approved, got %d", MaxKeys, len(names))
+	}
+	keys := make(Keys, 0, len(names))
+	for _, name := range names {
+		if name == "" || len(name) > maxKeyLength || !validChars(name) {
+			return nil, fmt.Errorf("invalid tag key %q", name)
+		}
+		if _, ok := Keys(reserved).canonical(name); ok {
+			return nil, fmt.Errorf("tag key %q is reserved", name)
+		}
+		if _, ok := keys.canonical(name); ok {
+			return nil, fmt.Errorf("tag key %q is repeated", name)
+		}
+		keys = append(keys, name)
+	}
+	return keys, nil
+}
+
+// canonical returns the approved key matching name, ignoring case
+func (k Keys) canonical(name string) (string, bool) {
+	for _, key := range k {
+		if strings.EqualFold(key, name) {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// Validate checks each tag has an approved key and a valid value, and
+// returns them under the keys' canonical case. It returns nil for no tags.
+func (k Keys) Validate(tags map[string]string) (map[string]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	valid := make(map[string]string, len(tags))
+	for name, value := range tags {
+		key, ok := k.canonical(name)
+		if !ok {
+			return nil, fmt.Errorf("%w: tag key %q is not approved", ErrInvalid, name)
+		}
+		if _, dup := valid[key]; dup {
+			return nil, fmt.Errorf("%w: tag key %q is repeated", ErrInvalid, key)
+		}
+		if !ValidValue(value) {
+			return nil, fmt.Errorf("%w: tag %q value contains invalid characters or exceeds %d characters", ErrInvalid, key, MaxValueLength)
+		}
+		valid[key] = value
+	}
+	return valid, nil
+}
+
+// FromHeaders returns the tags set by X-Tag-{Key} headers, validated. Header
+// names are matched ignoring case.
+func (k Keys) FromHeaders(headers map[string]string) (map[string]string, error) {
+	tags := map[string]string{}
+	for name, value := range headers {
+		if len(name) > len(HeaderPrefix) && strings.EqualFold(name[:len(HeaderPrefix)], HeaderPrefix) {
+			tags[name[len(HeaderPrefix):]] = value
+		}
+	}
+	return k.Validate(tags)
+}
+
+// ValidValue reports whether value is a non-empty S3 tag value: letters,
+// numbers, whitespace and + - = . _ : / @
+func ValidValue(value string) bool {
+	return value != "" && len(value) <= MaxValueLength && validChars(value)
+}
+
+// validChars reports whether s holds only characters allowed in AWS tags
+func validChars(s string) bool {
+	for _, r := range s {
+		if !isAllowedTagChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isAllowedTagChar checks if a rune is allowed in AWS tag keys and values
+func isAllowedTagChar(r rune) bool {
+	if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') {
+		return true
+	}
+	if r >= '0' && r <= '9' {
+		return true
+	}
+	if r == ' ' || r == '\t' || r == '\n' || r == '\r' {
+		return true
+	}
+	switch r {
+	case '+', '-', '=', '.', '_', ':', '/', '@':
+		return true
+	}
+	return false
+}
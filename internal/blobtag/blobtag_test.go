@@ -0,0 +1,81 @@
+package blobtag
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys([]string{"Source", "Retention"})
+	if err != nil || !reflect.DeepEqual(keys, Keys{"Source", "Retention"}) {
+		t.Fatalf("unexpected keys %v, %v", keys, err)
+	}
+
+	for _, names := range [][]string{
+		{"Status"},
+		{"parent"},
+		{"Source", "source"},
+		{""},
+		{"Bad&Key"},
+		{"A", "B", "C", "D", "E", "F", "G", "H"},
+	} {
+		if _, err := ParseKeys(names); err == nil {
+			t.Errorf("expected %v to be rejected", names)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	keys := Keys{"Source", "Retention"}
+
+	tags, err := keys.Validate(map[string]string{"source": "import", "Retention": "short-term"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, map[string]string{"Source": "import", "Retention": "short-term"}) {
+		t.Errorf("expected canonical keys, got %v", tags)
+	}
+
+	if tags, err := keys.Validate(nil); tags != nil || err != nil {
+		t.Errorf("expected nil for no tags, got %v, %v", tags, err)
+	}
+
+	for _, bad := range []map[string]string{
+		{"Project": "x"},
+		{"Status": "confirmed"},
+		{"Source": ""},
+		{"Source": "a&b"},
+		{"Source": strings.Repeat("a", MaxValueLength+1)},
+		{"Source": "a", "source": "b"},
+	} {
+		if _, err := keys.Validate(bad); !errors.Is(err, ErrInvalid) {
+			t.Errorf("expected %v to be invalid, got %v", bad, err)
+		}
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	keys := Keys{"Source", "Retention"}
+
+	tags, err := keys.FromHeaders(map[string]string{
+		"x-tag-source":    "import",
+		"X-Tag-Retention": "7y",
+		"X-Parent":        "mailbox-1",
+		"Content-Type":    "text/plain",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !reflect.DeepEqual(tags, map[string]string{"Source": "import", "Retention": "7y"}) {
+		t.Errorf("unexpected tags %v", tags)
+	}
+
+	if _, err := keys.FromHeaders(map[string]string{"X-Tag-Owner": "me"}); !errors.Is(err, ErrInvalid) {
+		t.Errorf("expected an unapproved header to be invalid, got %v", err)
+	}
+	if tags, err := keys.FromHeaders(map[string]string{"X-Filename": "a.txt"}); tags != nil || err != nil {
+		t.Errorf("expected no tags, got %v, %v", tags, err)
+	}
+}
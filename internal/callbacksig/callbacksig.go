@@ -0,0 +1,252 @@
+// Package callbacksig verifies signed requests that plugins send back to
+// core, and rejects replays of them.
+//
+// Plugins with a callback secret sign each request the way core signs
+// webhooks: the hex HMAC-SHA256 of "{timestamp}.{nonce}.{body}", sent with
+// the timestamp and nonce headers. Other plugins rely on the SigV4 signature
+// API Gateway has already checked; its signature serves as the nonce. Either
+// way the timestamp must be within MaxSkew and the nonce unused.
+package callbacksig
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Headers on an HMAC-signed callback. The signature is prefixed "sha256=".
+const (
+	SignatureHeader = "X-JMAP-Signature"
+	TimestampHeader = "X-JMAP-Timestamp"
+	NonceHeader     = "X-JMAP-Nonce"
+)
+
+// MaxSkew is how far a request's timestamp may be from now. Nonces are kept
+// for twice this long, covering every request that could still be accepted.
+const MaxSkew = 5 * time.Minute
+
+// PrefixNonce is the partition key prefix for used nonces
+const PrefixNonce = "NONCE#"
+
+// sigV4DateFormat is the layout of the X-Amz-Date header
+const sigV4DateFormat = "20060102T150405Z"
+
+// secretCacheTTL is how long a callback secret is reused before it is read
+// again, so a rotated secret is picked up without a deploy
+const secretCacheTTL = 5 * time.Minute
+
+var (
+	// ErrInvalidSignature is returned for unsigned, badly signed or stale requests
+	ErrInvalidSignature = errors.New("invalid callback signature")
+	// ErrReplayed is returned when a request's nonce has already been used
+	ErrReplayed = errors.New("callback replayed")
+)
+
+// NonceStore records used nonces
+type NonceStore interface {
+	// Claim records a nonce until expiresAt. Returns ErrReplayed if it is
+	// already recorded.
+	Claim(ctx context.Context, nonce string, expiresAt time.Time) error
+}
+
+// SecretsClient reads callback secrets from Secrets Manager
+type SecretsClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// cachedSecret is a callback secret and when it was read
+type cachedSecret struct {
+	value    string
+	loadedAt time.Time
+}
+
+// Verifier checks callback signatures and nonces
+type Verifier struct {
+	nonces  NonceStore
+	secrets SecretsClient
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+// NewVerifier creates a Verifier
+func NewVerifier(nonces NonceStore, secrets SecretsClient) *Verifier {
+	return &Verifier{
+		nonces:  nonces,
+		secrets: secrets,
+		now:     time.Now,
+		cache:   make(map[string]cachedSecret),
+	}
+}
+
+// Verify checks a callback request. With a secretArn the request must be
+// HMAC-signed with that secret; without one it must carry a SigV4
+// Authorization header. Errors other than ErrInvalidSignature and ErrReplayed
+// are failures to check.
+func (v *Verifier) Verify(ctx context.Context, headers map[string]string, body, secretArn string) error {
+	if secretArn != "" {
+		return v.verifyHMAC(ctx, headers, body, secretArn)
+	}
+	return v.verifySigV4(ctx, headers)
+}
+
+// verifyHMAC checks an HMAC-signed request and claims its nonce
+func (v *Verifier) verifyHMAC(ctx context.Context, headers map[string]string, body, secretArn string) error {
+	signature, ok := strings.CutPrefix(header(headers, SignatureHeader), "sha256=")
+	timestamp := header(headers, TimestampHeader)
+	nonce := header(headers, NonceHeader)
+	if !ok || timestamp == "" || nonce == "" {
+		return fmt.Errorf("%w: missing signature, timestamp or nonce", ErrInvalidSignature)
+	}
+
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: malformed timestamp", ErrInvalidSignature)
+	}
+	if err := v.checkSkew(time.Unix(seconds, 0)); err != nil {
+		return err
+	}
+
+	secret, err := v.secret(ctx, secretArn)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, nonce, body))) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+
+	return v.nonces.Claim(ctx, "hmac:"+nonce, v.now().Add(2*MaxSkew))
+}
+
+// verifySigV4 claims the signature of a request API Gateway has already
+// authenticated with SigV4. SigV4 bounds the timestamp but not reuse.
+func (v *Verifier) verifySigV4(ctx context.Context, headers map[string]string) error {
+	authorization := header(headers, "Authorization")
+	if !strings.HasPrefix(authorization, "AWS4-HMAC-SHA256 ") {
+		return fmt.Errorf("%w: missing SigV4 authorization", ErrInvalidSignature)
+	}
+	_, signature, ok := strings.Cut(authorization, "Signature=")
+	if !ok || signature == "" {
+		return fmt.Errorf("%w: missing SigV4 signature", ErrInvalidSignature)
+	}
+
+	date, err := time.Parse(sigV4DateFormat, header(headers, "X-Amz-Date"))
+	if err != nil {
+		return fmt.Errorf("%w: malformed X-Amz-Date", ErrInvalidSignature)
+	}
+	if err := v.checkSkew(date); err != nil {
+		return err
+	}
+
+	return v.nonces.Claim(ctx, "sigv4:"+signature, v.now().Add(2*MaxSkew))
+}
+
+// checkSkew rejects timestamps more than MaxSkew from now
+func (v *Verifier) checkSkew(timestamp time.Time) error {
+	skew := v.now().Sub(timestamp)
+	if skew > MaxSkew || skew < -MaxSkew {
+		return fmt.Errorf("%w: timestamp outside %s", ErrInvalidSignature, MaxSkew)
+	}
+	return nil
+}
+
+// secret returns a callback secret, reading it at most once per cache TTL
+func (v *Verifier) secret(ctx context.Context, secretArn string) (string, error) {
+	v.mu.Lock()
+	cached, ok := v.cache[secretArn]
+	v.mu.Unlock()
+	if ok && v.now().Sub(cached.loadedAt) < secretCacheTTL {
+		return cached.value, nil
+	}
+
+	result, err := v.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretArn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get callback secret: %w", err)
+	}
+	if result.SecretString == nil || *result.SecretString == "" {
+		return "", fmt.Errorf("callback secret %s is empty", secretArn)
+	}
+
+	v.mu.Lock()
+	v.cache[secretArn] = cachedSecret{value: *result.SecretString, loadedAt: v.now()}
+	v.mu.Unlock()
+	return *result.SecretString, nil
+}
+
+// Sign returns the hex HMAC-SHA256 signature of a callback. Plugins send it
+// as "sha256={signature}".
+func Sign(secret, timestamp, nonce, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write([]byte(nonce))
+	mac.Write([]byte("."))
+	mac.Write([]byte(body))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// header returns a header value, which API Gateway may pass in any case
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
+// DynamoDBClient defines the DynamoDB operation needed for nonces
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBNonceStore records nonces in DynamoDB as NONCE#{nonce} / NONCE#,
+// removed by the table's ttl once they can no longer be replayed
+type DynamoDBNonceStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBNonceStore creates a new DynamoDBNonceStore
+func NewDynamoDBNonceStore(client DynamoDBClient, tableName string) *DynamoDBNonceStore {
+	return &DynamoDBNonceStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Claim records a nonce, failing with ErrReplayed if it is already recorded
+func (s *DynamoDBNonceStore) Claim(ctx context.Context, nonce string, expiresAt time.Time) error {
+	_, err := s.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(s.tableName),
+		Item: map[string]types.AttributeValue{
+			"pk":  &types.AttributeValueMemberS{Value: PrefixNonce + nonce},
+			"sk":  &types.AttributeValueMemberS{Value: PrefixNonce},
+			"ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(pk)"),
+	})
+	if err != nil {
+		if dbclient.IsConditionalCheckFailed(err) {
+			return ErrReplayed
+		}
+		return fmt.Errorf("failed to record nonce: %w", err)
+	}
+	return nil
+}
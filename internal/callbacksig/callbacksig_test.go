@@ -0,0 +1,165 @@
+package callbacksig
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// memoryNonces is an in-memory NonceStore
+type memoryNonces map[string]time.Time
+
+func (m memoryNonces) Claim(ctx context.Context, nonce string, expiresAt time.Time) error {
+	if _, ok := m[nonce]; ok {
+		return ErrReplayed
+	}
+	m[nonce] = expiresAt
+	return nil
+}
+
+type mockSecretsClient struct {
+	calls int
+}
+
+func (m *mockSecretsClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.calls++
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String("s3cret")}, nil
+}
+
+var testNow = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func testVerifier() (*Verifier, memoryNonces, *mockSecretsClient) {
+	nonces := memoryNonces{}
+	secrets := &mockSecretsClient{}
+	v := NewVerifier(nonces, secrets)
+	v.now = func() time.Time { return testNow }
+	return v, nonces, secrets
+}
+
+func signedHeaders(at time.Time, nonce, body string) map[string]string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	return map[string]string{
+		"x-jmap-signature": "sha256=" + Sign("s3cret", timestamp, nonce, body),
+		"x-jmap-timestamp": timestamp,
+		"x-jmap-nonce":     nonce,
+	}
+}
+
+func TestVerify_HMAC(t *testing.T) {
+	body := `{"eventTypes":["account.created"]}`
+	tests := []struct {
+		name    string
+		headers map[string]string
+		body    string
+		wantErr error
+	}{
+		{name: "valid", headers: signedHeaders(testNow, "n-1", body), body: body},
+		{name: "tampered body", headers: signedHeaders(testNow, "n-1", body), body: `{}`, wantErr: ErrInvalidSignature},
+		{name: "stale timestamp", headers: signedHeaders(testNow.Add(-MaxSkew-time.Second), "n-1", body), body: body, wantErr: ErrInvalidSignature},
+		{name: "future timestamp", headers: signedHeaders(testNow.Add(MaxSkew+time.Second), "n-1", body), body: body, wantErr: ErrInvalidSignature},
+		{name: "unsigned", headers: map[string]string{}, body: body, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, _, _ := testVerifier()
+			err := v.Verify(context.Background(), tc.headers, tc.body, "arn:secret")
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestVerify_HMAC_RejectsReplay(t *testing.T) {
+	v, nonces, secrets := testVerifier()
+	headers := signedHeaders(testNow, "n-1", "{}")
+
+	if err := v.Verify(context.Background(), headers, "{}", "arn:secret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := v.Verify(context.Background(), headers, "{}", "arn:secret"); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected ErrReplayed, got %v", err)
+	}
+	if expiresAt := nonces["hmac:n-1"]; !expiresAt.Equal(testNow.Add(2 * MaxSkew)) {
+		t.Errorf("unexpected nonce expiry %v", expiresAt)
+	}
+	if secrets.calls != 1 {
+		t.Errorf("expected the secret to be cached, read %d times", secrets.calls)
+	}
+}
+
+func TestVerify_SigV4(t *testing.T) {
+	authorization := "AWS4-HMAC-SHA256 Credential=AKIA/20250101/ap-southeast-2/execute-api/aws4_request, SignedHeaders=host;x-amz-date, Signature=abc123"
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+	}{
+		{name: "valid", headers: map[string]string{"Authorization": authorization, "X-Amz-Date": "20250101T120000Z"}},
+		{name: "stale", headers: map[string]string{"Authorization": authorization, "X-Amz-Date": "20250101T110000Z"}, wantErr: ErrInvalidSignature},
+		{name: "not SigV4", headers: map[string]string{"Authorization": "Bearer token", "X-Amz-Date": "20250101T120000Z"}, wantErr: ErrInvalidSignature},
+		{name: "no authorization", headers: map[string]string{}, wantErr: ErrInvalidSignature},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, _, _ := testVerifier()
+			err := v.Verify(context.Background(), tc.headers, "", "")
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("expected %v, got %v", tc.wantErr, err)
+			}
+		})
+	}
+
+	v, _, _ := testVerifier()
+	headers := map[string]string{"authorization": authorization, "x-amz-date": "20250101T120000Z"}
+	_ = v.Verify(context.Background(), headers, "", "")
+	if err := v.Verify(context.Background(), headers, "", ""); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected a reused SigV4 signature to be rejected, got %v", err)
+	}
+}
+
+type mockDynamoDBClient struct {
+	putFunc func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return m.putFunc(ctx, params, optFns...)
+}
+
+func TestDynamoDBNonceStore_Claim(t *testing.T) {
+	var captured *dynamodb.PutItemInput
+	store := NewDynamoDBNonceStore(&mockDynamoDBClient{
+		putFunc: func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			captured = params
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}, "table")
+
+	if err := store.Claim(context.Background(), "hmac:n-1", testNow); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if pk := captured.Item["pk"].(*types.AttributeValueMemberS).Value; pk != "NONCE#hmac:n-1" {
+		t.Errorf("unexpected pk %s", pk)
+	}
+	if ttl := captured.Item["ttl"].(*types.AttributeValueMemberN).Value; ttl != strconv.FormatInt(testNow.Unix(), 10) {
+		t.Errorf("unexpected ttl %s", ttl)
+	}
+
+	store = NewDynamoDBNonceStore(&mockDynamoDBClient{
+		putFunc: func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			return nil, &types.ConditionalCheckFailedException{}
+		},
+	}, "table")
+	if err := store.Claim(context.Background(), "hmac:n-1", testNow); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected ErrReplayed, got %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+// Package config loads Lambda configuration from environment variables into
+// typed, validated structs, one per binary. Every setting is read in this
+// package, with its default and allowed range, so a new limit or feature
+// flag is added in one place and invalid values fail at cold start rather
+// than falling back silently.
+//
+// A Load function reports every problem at once:
+//
+//	cfg, err := config.LoadBlobUpload(os.Getenv)
+//	if err != nil {
+//		logger.Error("FATAL: Invalid configuration", slog.String("error", err.Error()))
+//		panic(err)
+//	}
+//
+// Settings owned by other packages, such as LOCAL_ENDPOINTS, LOG_LEVEL and
+// TRACE_BACKEND, are still read there.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Env reads environment variables, collecting a problem for each missing or
+// invalid value instead of stopping at the first
+type Env struct {
+	getenv   func(string) string
+	problems []error
+}
+
+// NewEnv returns an Env reading values with getenv, normally os.Getenv
+func NewEnv(getenv func(string) string) *Env {
+	return &Env{getenv: getenv}
+}
+
+// Err returns every problem found so far, or nil if there were none
+func (e *Env) Err() error {
+	return errors.Join(e.problems...)
+}
+
+// Check records err, if not nil, as a problem with name
+func (e *Env) Check(name string, err error) {
+	if err != nil {
+		e.problems = append(e.problems, fmt.Errorf("%s: %w", name, err))
+	}
+}
+
+// Required returns the value of name, recording a problem if it is unset
+func (e *Env) Required(name string) string {
+	value := e.getenv(name)
+	if value == "" {
+		e.problems = append(e.problems, fmt.Errorf("%s is required", name))
+	}
+	return value
+}
+
+// String returns the value of name, or fallback if it is unset
+func (e *Env) String(name, fallback string) string {
+	if value := e.getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// List splits the comma-separated value of name, ignoring blanks. It
+// returns nil if the value is unset or empty.
+func (e *Env) List(name string) []string {
+	var list []string
+	for _, entry := range strings.Split(e.getenv(name), ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+// Int returns the integer value of name, or fallback if it is unset. A
+// value outside min to max is a problem.
+func (e *Env) Int(name string, fallback, min, max int) int {
+	return int(e.Int64(name, int64(fallback), int64(min), int64(max)))
+}
+
+// Int64 returns the integer value of name, or fallback if it is unset. A
+// value outside min to max is a problem.
+func (e *Env) Int64(name string, fallback, min, max int64) int64 {
+	value := e.getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || parsed < min || parsed > max {
+		e.problems = append(e.problems, fmt.Errorf("%s must be an integer from %d to %d, got %q", name, min, max, value))
+		return fallback
+	}
+	return parsed
+}
+
+// Float returns the numeric value of name, or fallback if it is unset. A
+// value outside min to max is a problem.
+func (e *Env) Float(name string, fallback, min, max float64) float64 {
+	value := e.getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || !(parsed >= min && parsed <= max) {
+		e.problems = append(e.problems, fmt.Errorf("%s must be a number from %g to %g, got %q", name, min, max, value))
+		return fallback
+	}
+	return parsed
+}
+
+// Seconds returns the value of name, a whole number of seconds, as a
+// duration, or fallback if it is unset. A value outside min to max is a
+// problem.
+func (e *Env) Seconds(name string, fallback, min, max time.Duration) time.Duration {
+	seconds := e.Int64(name, int64(fallback/time.Second), int64(min/time.Second), int64(max/time.Second))
+	return time.Duration(seconds) * time.Second
+}
+
+// Bool returns the value of name, or fallback if it is unset. Values are
+// parsed with strconv.ParseBool.
+func (e *Env) Bool(name string, fallback bool) bool {
+	value := e.getenv(name)
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		e.problems = append(e.problems, fmt.Errorf("%s must be true or false, got %q", name, value))
+		return fallback
+	}
+	return parsed
+}
@@ -0,0 +1,111 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testEnv returns a getenv reading from values
+func testEnv(values map[string]string) func(string) string {
+	return func(name string) string { return values[name] }
+}
+
+func TestEnv_Defaults(t *testing.T) {
+	env := NewEnv(testEnv(nil))
+
+	if got := env.String("NAME", "fallback"); got != "fallback" {
+		t.Errorf("String = %q", got)
+	}
+	if got := env.Int("COUNT", 4, 1, 10); got != 4 {
+		t.Errorf("Int = %d", got)
+	}
+	if got := env.Float("PERCENT", 0.5, 0, 100); got != 0.5 {
+		t.Errorf("Float = %v", got)
+	}
+	if got := env.Seconds("EXPIRY", 5*time.Minute, time.Second, time.Hour); got != 5*time.Minute {
+		t.Errorf("Seconds = %v", got)
+	}
+	if got := env.Bool("ENABLED", true); !got {
+		t.Error("Bool = false")
+	}
+	if got := env.List("ORIGINS"); got != nil {
+		t.Errorf("List = %v", got)
+	}
+	if err := env.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEnv_Values(t *testing.T) {
+	env := NewEnv(testEnv(map[string]string{
+		"NAME":    "value",
+		"COUNT":   " 7 ",
+		"PERCENT": "12.5",
+		"EXPIRY":  "60",
+		"ENABLED": "false",
+		"ORIGINS": " https://a.example , ,https://b.example",
+	}))
+
+	if got := env.Required("NAME"); got != "value" {
+		t.Errorf("Required = %q", got)
+	}
+	if got := env.Int("COUNT", 4, 1, 10); got != 7 {
+		t.Errorf("Int = %d", got)
+	}
+	if got := env.Float("PERCENT", 0, 0, 100); got != 12.5 {
+		t.Errorf("Float = %v", got)
+	}
+	if got := env.Seconds("EXPIRY", 0, time.Second, time.Hour); got != time.Minute {
+		t.Errorf("Seconds = %v", got)
+	}
+	if got := env.Bool("ENABLED", true); got {
+		t.Error("Bool = true")
+	}
+	if got := env.List("ORIGINS"); len(got) != 2 || got[0] != "https://a.example" || got[1] != "https://b.example" {
+		t.Errorf("List = %v", got)
+	}
+	if err := env.Err(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEnv_CollectsEveryProblem(t *testing.T) {
+	env := NewEnv(testEnv(map[string]string{
+		"COUNT":   "11",
+		"PREFIX":  "abc",
+		"PERCENT": "NaN",
+		"ENABLED": "maybe",
+	}))
+
+	env.Required("TABLE")
+	if got := env.Int("COUNT", 4, 1, 10); got != 4 {
+		t.Errorf("expected the fallback for an out of range value, got %d", got)
+	}
+	env.Int("PREFIX", 0, 0, 32)
+	env.Float("PERCENT", 0, 0, 100)
+	env.Bool("ENABLED", false)
+	env.Check("TIERS", errors.New("invalid tier limits"))
+	env.Check("FEATURES", nil)
+
+	err := env.Err()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{
+		"TABLE is required",
+		`COUNT must be an integer from 1 to 10, got "11"`,
+		`PREFIX must be an integer from 0 to 32, got "abc"`,
+		`PERCENT must be a number from 0 to 100, got "NaN"`,
+		`ENABLED must be true or false, got "maybe"`,
+		"TIERS: invalid tier limits",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "FEATURES") {
+		t.Errorf("unexpected problem for a nil error:\n%v", err)
+	}
+}
@@ -0,0 +1,658 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/accesspoint"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobtag"
+	"github.com/jarrod-lowe/jmap-service-core/internal/downloadregion"
+	"github.com/jarrod-lowe/jmap-service-core/internal/ratelimit"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+	"github.com/jarrod-lowe/jmap-service-core/internal/usage"
+)
+
+// RateLimit is the per-account request rate limit
+type RateLimit struct {
+	// Limit applies to accounts without a tier limit; Enabled is false when
+	// RATE_LIMIT_PER_SECOND is zero
+	Limit   ratelimit.Limit
+	Enabled bool
+	// Tiers overrides Limit for accounts in a quota tier
+	Tiers ratelimit.TierLimits
+}
+
+// Active reports whether any account is limited, so a limiter is needed
+func (r RateLimit) Active() bool {
+	return r.Enabled || len(r.Tiers) > 0
+}
+
+// loadRateLimit reads RATE_LIMIT_PER_SECOND, RATE_LIMIT_BURST and
+// RATE_LIMIT_TIERS
+func loadRateLimit(env *Env) RateLimit {
+	var r RateLimit
+	var err error
+	r.Limit, r.Enabled, err = ratelimit.ParseLimit(env.getenv("RATE_LIMIT_PER_SECOND"), env.getenv("RATE_LIMIT_BURST"))
+	env.Check("RATE_LIMIT_PER_SECOND and RATE_LIMIT_BURST", err)
+	r.Tiers, err = ratelimit.ParseTierLimits(env.getenv("RATE_LIMIT_TIERS"))
+	env.Check("RATE_LIMIT_TIERS", err)
+	return r
+}
+
+// Encryption is the optional envelope encryption of blob record metadata,
+// passed to blobcrypt.NewOptionalEnvelope. It is off when KMSKeyARN is
+// empty.
+type Encryption struct {
+	KMSKeyARN  string
+	Attributes string
+}
+
+// loadEncryption reads BLOB_METADATA_KMS_KEY_ARN and BLOB_ENCRYPTED_ATTRIBUTES
+func loadEncryption(env *Env) Encryption {
+	return Encryption{
+		KMSKeyARN:  env.String("BLOB_METADATA_KMS_KEY_ARN", ""),
+		Attributes: env.String("BLOB_ENCRYPTED_ATTRIBUTES", ""),
+	}
+}
+
+// loadAccessPoints reads BLOB_ACCESS_POINTS, a JSON object of account ID to
+// the ARN of the S3 Access Point scoped to its blobs
+func loadAccessPoints(env *Env) accesspoint.Map {
+	points, err := accesspoint.Parse(env.getenv("BLOB_ACCESS_POINTS"))
+	env.Check("BLOB_ACCESS_POINTS", err)
+	return points
+}
+
+// loadTagKeys reads BLOB_TAG_KEYS, the comma-separated extra S3 tag keys
+// clients may set on their blobs
+func loadTagKeys(env *Env) blobtag.Keys {
+	keys, err := blobtag.ParseKeys(env.List("BLOB_TAG_KEYS"))
+	env.Check("BLOB_TAG_KEYS", err)
+	return keys
+}
+
+// loadStorage reads BLOB_STORAGE_BACKEND, "s3" or "filesystem", and
+// BLOB_STORAGE_ROOT, the directory the filesystem backend needs. The S3
+// backend uses bucket and points.
+func loadStorage(env *Env, bucket string, points accesspoint.Map) blobstore.Config {
+	cfg := blobstore.Config{
+		Backend:      env.String("BLOB_STORAGE_BACKEND", blobstore.BackendS3),
+		Bucket:       bucket,
+		AccessPoints: points,
+	}
+	switch cfg.Backend {
+	case blobstore.BackendS3:
+	case blobstore.BackendFilesystem:
+		cfg.Root = env.Required("BLOB_STORAGE_ROOT")
+	default:
+		env.Check("BLOB_STORAGE_BACKEND", fmt.Errorf("must be s3 or filesystem, got %q", cfg.Backend))
+	}
+	return cfg
+}
+
+// loadFeatures reads ACCOUNT_TYPE_FEATURES, a JSON object of account type to
+// features. Types without an entry are unrestricted.
+func loadFeatures(env *Env) account.FeatureFlags {
+	features, err := account.ParseFeatureFlags(env.getenv("ACCOUNT_TYPE_FEATURES"))
+	env.Check("ACCOUNT_TYPE_FEATURES", err)
+	return features
+}
+
+// loadQuota reads the required DEFAULT_QUOTA_BYTES and the optional
+// QUOTA_TIERS, a JSON object of tier name to quota bytes
+func loadQuota(env *Env) (int64, account.Tiers) {
+	var defaultQuota int64
+	if env.Required("DEFAULT_QUOTA_BYTES") != "" {
+		defaultQuota = env.Int64("DEFAULT_QUOTA_BYTES", 0, 0, math.MaxInt64)
+	}
+	tiers, err := account.ParseTiers(env.getenv("QUOTA_TIERS"))
+	env.Check("QUOTA_TIERS", err)
+	return defaultQuota, tiers
+}
+
+// Core configures binaries that need only the core table: apikey-authorizer,
+// event-redrive, event-replay and outbox-publisher
+type Core struct {
+	Table string
+}
+
+// LoadCore loads Core
+func LoadCore(getenv func(string) string) (Core, error) {
+	env := NewEnv(getenv)
+	cfg := Core{Table: env.Required("DYNAMODB_TABLE")}
+	return cfg, env.Err()
+}
+
+// JMAPAPI configures jmap-api
+type JMAPAPI struct {
+	Table          string
+	AccountIDClaim string
+	// BlobBucket enables Blob/allocate and Blob/complete when set
+	BlobBucket            string
+	MaxSizeUploadPut      int64
+	MaxPendingAllocations int
+	AllocationURLExpiry   time.Duration
+	DispatcherParallelism int
+	RateLimit             RateLimit
+	Features              account.FeatureFlags
+	DelegationSecretARN   string
+	// LogSamplePercent of method calls are logged in full, redacted
+	LogSamplePercent float64
+	Encryption       Encryption
+	CORSOrigins      []string
+	// MetricNamespace enables per-method EMF metrics when set
+	MetricNamespace string
+	// AccessPoints scope allocation URLs to an account's access point
+	AccessPoints accesspoint.Map
+	// IdempotencyTTL is how long responses are kept for replay to requests
+	// repeating an Idempotency-Key; zero ignores the header
+	IdempotencyTTL time.Duration
+	// Storage is where allocated blobs are stored
+	Storage blobstore.Config
+	// UploadProgressEvents publishes a blob.upload.part event for each
+	// part of a completed multipart upload
+	UploadProgressEvents bool
+	// TagKeys are the extra S3 tag keys Blob/allocate accepts
+	TagKeys blobtag.Keys
+	// PluginPrewarm opens connections to the plugin Lambdas at cold start
+	PluginPrewarm bool
+	// PluginLatencyInterval is how often per-plugin latency statistics are
+	// flushed; zero disables tracking them
+	PluginLatencyInterval time.Duration
+	// QuotaGrace lets Blob/allocate go over quota; a zero Percent disables it
+	QuotaGrace bloballocate.QuotaGrace
+	// StrictValidation checks every method call before running any, and
+	// rejects the whole request if one fails
+	StrictValidation bool
+	// RegistryConsistentRead loads the plugin registry with strongly
+	// consistent reads
+	RegistryConsistentRead bool
+	// StateTokenMaxAge is how old a state token may be when passed back to
+	// a plugin's /changes method; zero lets tokens last forever
+	StateTokenMaxAge time.Duration
+	// ConcurrencyLimit enforces the core capability's maxConcurrentRequests
+	// per account
+	ConcurrencyLimit bool
+}
+
+// LoadJMAPAPI loads JMAPAPI
+func LoadJMAPAPI(getenv func(string) string) (JMAPAPI, error) {
+	env := NewEnv(getenv)
+	cfg := JMAPAPI{
+		Table:                 env.Required("DYNAMODB_TABLE"),
+		AccountIDClaim:        env.Required("ACCOUNT_ID_CLAIM"),
+		BlobBucket:            env.String("BLOB_BUCKET", ""),
+		MaxSizeUploadPut:      env.Int64("MAX_SIZE_UPLOAD_PUT", 250000000, 1, math.MaxInt64),
+		MaxPendingAllocations: env.Int("MAX_PENDING_ALLOCATIONS", 4, 1, 1000),
+		AllocationURLExpiry:   env.Seconds("ALLOCATION_URL_EXPIRY_SECONDS", 15*time.Minute, time.Second, 7*24*time.Hour),
+		DispatcherParallelism: env.Int("JMAP_DISPATCHER_PARALLELISM", 4, 1, 1000),
+		RateLimit:             loadRateLimit(env),
+		Features:              loadFeatures(env),
+		DelegationSecretARN:   env.Required("DELEGATION_SECRET_ARN"),
+		LogSamplePercent:      env.Float("LOG_SAMPLE_PERCENT", 0, 0, 100),
+		Encryption:            loadEncryption(env),
+		CORSOrigins:           env.List("CORS_ALLOWED_ORIGINS"),
+		MetricNamespace:       env.String("METRIC_NAMESPACE", ""),
+		AccessPoints:          loadAccessPoints(env),
+		IdempotencyTTL:        env.Seconds("IDEMPOTENCY_TTL_SECONDS", 24*time.Hour, 0, 7*24*time.Hour),
+		UploadProgressEvents:  env.Bool("UPLOAD_PROGRESS_EVENTS", false),
+		TagKeys:               loadTagKeys(env),
+		PluginPrewarm:         env.Bool("PLUGIN_PREWARM", false),
+		PluginLatencyInterval: env.Seconds("PLUGIN_LATENCY_FLUSH_SECONDS", time.Minute, 0, time.Hour),
+		QuotaGrace: bloballocate.QuotaGrace{
+			Percent: env.Int("QUOTA_GRACE_PERCENT", 0, 0, 100),
+			Period:  env.Seconds("QUOTA_GRACE_PERIOD_SECONDS", 7*24*time.Hour, time.Hour, 90*24*time.Hour),
+		},
+		StrictValidation:       env.Bool("JMAP_STRICT_VALIDATION", false),
+		RegistryConsistentRead: env.Bool("REGISTRY_CONSISTENT_READ", false),
+		StateTokenMaxAge:       env.Seconds("STATE_TOKEN_MAX_AGE_SECONDS", 0, 0, 365*24*time.Hour),
+		ConcurrencyLimit:       env.Bool("CONCURRENCY_LIMIT", false),
+	}
+	cfg.Storage = loadStorage(env, cfg.BlobBucket, cfg.AccessPoints)
+	return cfg, env.Err()
+}
+
+// Session configures get-jmap-session
+type Session struct {
+	Table          string
+	AccountIDClaim string
+	APIDomain      string
+	Features       account.FeatureFlags
+	CORSOrigins    []string
+	// MaxWait is the longest a long-polling session request is held; zero
+	// disables long polling
+	MaxWait time.Duration
+}
+
+// LoadSession loads Session
+func LoadSession(getenv func(string) string) (Session, error) {
+	env := NewEnv(getenv)
+	cfg := Session{
+		Table:          env.Required("DYNAMODB_TABLE"),
+		AccountIDClaim: env.Required("ACCOUNT_ID_CLAIM"),
+		APIDomain:      env.String("API_DOMAIN", "localhost"),
+		Features:       loadFeatures(env),
+		CORSOrigins:    env.List("CORS_ALLOWED_ORIGINS"),
+		MaxWait:        env.Seconds("SESSION_MAX_WAIT_SECONDS", 20*time.Second, 0, 25*time.Second),
+	}
+	return cfg, env.Err()
+}
+
+// BlobUpload configures blob-upload
+type BlobUpload struct {
+	Table               string
+	AccountIDClaim      string
+	Bucket              string
+	MaxSizeUpload       int64
+	RateLimit           RateLimit
+	Features            account.FeatureFlags
+	DelegationSecretARN string
+	Encryption          Encryption
+	CORSOrigins         []string
+	// ScanBlobs requests a content scan of each blob as it is confirmed
+	ScanBlobs bool
+	// AccessPoints scope uploads to an account's access point
+	AccessPoints accesspoint.Map
+	// Storage is where uploaded blobs are stored
+	Storage blobstore.Config
+	// TagKeys are the extra S3 tag keys uploads may set with headers
+	TagKeys blobtag.Keys
+}
+
+// LoadBlobUpload loads BlobUpload
+func LoadBlobUpload(getenv func(string) string) (BlobUpload, error) {
+	env := NewEnv(getenv)
+	cfg := BlobUpload{
+		Table:               env.Required("DYNAMODB_TABLE"),
+		AccountIDClaim:      env.Required("ACCOUNT_ID_CLAIM"),
+		Bucket:              env.Required("BLOB_BUCKET"),
+		MaxSizeUpload:       env.Int64("MAX_SIZE_UPLOAD", 10000000, 1, math.MaxInt64),
+		RateLimit:           loadRateLimit(env),
+		Features:            loadFeatures(env),
+		DelegationSecretARN: env.Required("DELEGATION_SECRET_ARN"),
+		Encryption:          loadEncryption(env),
+		CORSOrigins:         env.List("CORS_ALLOWED_ORIGINS"),
+		ScanBlobs:           env.Bool("BLOB_SCANNING_ENABLED", false),
+		AccessPoints:        loadAccessPoints(env),
+		TagKeys:             loadTagKeys(env),
+	}
+	cfg.Storage = loadStorage(env, cfg.Bucket, cfg.AccessPoints)
+	return cfg, env.Err()
+}
+
+// BlobDownload configures blob-download
+type BlobDownload struct {
+	Table               string
+	AccountIDClaim      string
+	CloudFrontDomain    string
+	CloudFrontKeyPairID string
+	PrivateKeySecretARN string
+	SignedURLExpiry     time.Duration
+	// SourceIPv4Prefix and SourceIPv6Prefix bind signed URLs to the
+	// requester's address range; 0 disables binding
+	SourceIPv4Prefix    int
+	SourceIPv6Prefix    int
+	RateLimit           RateLimit
+	DelegationSecretARN string
+	Encryption          Encryption
+	CORSOrigins         []string
+	// BlobCacheSize and BlobCacheTTL bound the in-memory cache of blob
+	// records; a size of 0, the default, disables it
+	BlobCacheSize int
+	BlobCacheTTL  time.Duration
+	// Regions picks a replica region's domain for callers near it; empty
+	// serves every download from CloudFrontDomain
+	Regions downloadregion.Regions
+	// Failover serves every download from the blob-mirror replica: blob
+	// records are read from its table and URLs signed for its domain
+	Failover       bool
+	FailoverDomain string
+	FailoverRegion string
+	FailoverTable  string
+}
+
+// LoadBlobDownload loads BlobDownload
+func LoadBlobDownload(getenv func(string) string) (BlobDownload, error) {
+	env := NewEnv(getenv)
+	cfg := BlobDownload{
+		Table:               env.Required("DYNAMODB_TABLE"),
+		AccountIDClaim:      env.Required("ACCOUNT_ID_CLAIM"),
+		CloudFrontDomain:    env.Required("CLOUDFRONT_DOMAIN"),
+		CloudFrontKeyPairID: env.Required("CLOUDFRONT_KEY_PAIR_ID"),
+		PrivateKeySecretARN: env.Required("PRIVATE_KEY_SECRET_ARN"),
+		SignedURLExpiry:     env.Seconds("SIGNED_URL_EXPIRY_SECONDS", 5*time.Minute, time.Second, 7*24*time.Hour),
+		SourceIPv4Prefix:    env.Int("SIGNED_URL_IPV4_PREFIX", 0, 0, 32),
+		SourceIPv6Prefix:    env.Int("SIGNED_URL_IPV6_PREFIX", 0, 0, 128),
+		RateLimit:           loadRateLimit(env),
+		DelegationSecretARN: env.Required("DELEGATION_SECRET_ARN"),
+		Encryption:          loadEncryption(env),
+		CORSOrigins:         env.List("CORS_ALLOWED_ORIGINS"),
+		BlobCacheSize:       env.Int("BLOB_CACHE_SIZE", 0, 0, 100000),
+		BlobCacheTTL:        env.Seconds("BLOB_CACHE_TTL_SECONDS", 30*time.Second, time.Second, time.Hour),
+	}
+	var err error
+	cfg.Regions, err = downloadregion.Parse(env.getenv("BLOB_DOWNLOAD_REGIONS"))
+	env.Check("BLOB_DOWNLOAD_REGIONS", err)
+	cfg.Failover = env.Bool("BLOB_DOWNLOAD_FAILOVER", false)
+	if cfg.Failover {
+		cfg.FailoverDomain = env.Required("BLOB_MIRROR_DOMAIN")
+		cfg.FailoverRegion = env.Required("BLOB_MIRROR_REGION")
+		cfg.FailoverTable = env.Required("BLOB_MIRROR_TABLE")
+	}
+	return cfg, env.Err()
+}
+
+// BlobDelete configures blob-delete
+type BlobDelete struct {
+	Table               string
+	AccountIDClaim      string
+	DelegationSecretARN string
+	Encryption          Encryption
+	// MirrorBucket, set while blob-mirror runs, is the blob bucket whose
+	// objects are retagged after a scan verdict so the verdict is mirrored
+	MirrorBucket string
+}
+
+// LoadBlobDelete loads BlobDelete
+func LoadBlobDelete(getenv func(string) string) (BlobDelete, error) {
+	env := NewEnv(getenv)
+	cfg := BlobDelete{
+		Table:               env.Required("DYNAMODB_TABLE"),
+		AccountIDClaim:      env.Required("ACCOUNT_ID_CLAIM"),
+		DelegationSecretARN: env.Required("DELEGATION_SECRET_ARN"),
+		Encryption:          loadEncryption(env),
+		MirrorBucket:        env.String("BLOB_MIRROR_SOURCE_BUCKET", ""),
+	}
+	return cfg, env.Err()
+}
+
+// BlobStore configures binaries that need the core table and blob bucket:
+// blob-confirm, account-export and account-import
+type BlobStore struct {
+	Table      string
+	Bucket     string
+	Encryption Encryption
+	// ScanBlobs requests a content scan of each blob blob-confirm confirms
+	ScanBlobs bool
+	// ContentSniffing is whether blob-confirm checks each blob's declared
+	// type against its content: "off", "flag" or "correct"
+	ContentSniffing string
+	// Storage is where blob-confirm finds blobs
+	Storage blobstore.Config
+}
+
+// LoadBlobStore loads BlobStore
+func LoadBlobStore(getenv func(string) string) (BlobStore, error) {
+	env := NewEnv(getenv)
+	cfg := BlobStore{
+		Table:           env.Required("DYNAMODB_TABLE"),
+		Bucket:          env.Required("BLOB_BUCKET"),
+		Encryption:      loadEncryption(env),
+		ScanBlobs:       env.Bool("BLOB_SCANNING_ENABLED", false),
+		ContentSniffing: env.String("BLOB_CONTENT_SNIFFING", sniff.ModeOff),
+	}
+	switch cfg.ContentSniffing {
+	case sniff.ModeOff, sniff.ModeFlag, sniff.ModeCorrect:
+	default:
+		env.Check("BLOB_CONTENT_SNIFFING", fmt.Errorf("must be off, flag or correct, got %q", cfg.ContentSniffing))
+	}
+	cfg.Storage = loadStorage(env, cfg.Bucket, nil)
+	return cfg, env.Err()
+}
+
+// BlobMirror configures blob-mirror
+type BlobMirror struct {
+	Table  string
+	Bucket string
+	// Region, ReplicaBucket and ReplicaTable are where confirmed blobs and
+	// their records are copied
+	Region        string
+	ReplicaBucket string
+	ReplicaTable  string
+}
+
+// LoadBlobMirror loads BlobMirror
+func LoadBlobMirror(getenv func(string) string) (BlobMirror, error) {
+	env := NewEnv(getenv)
+	cfg := BlobMirror{
+		Table:         env.Required("DYNAMODB_TABLE"),
+		Bucket:        env.Required("BLOB_BUCKET"),
+		Region:        env.Required("BLOB_MIRROR_REGION"),
+		ReplicaBucket: env.Required("BLOB_MIRROR_BUCKET"),
+		ReplicaTable:  env.Required("BLOB_MIRROR_TABLE"),
+	}
+	return cfg, env.Err()
+}
+
+// BlobCleanup configures blob-cleanup and blob-alloc-cleanup
+type BlobCleanup struct {
+	Table  string
+	Bucket string
+	// BufferHours is how long past expiry an allocation is kept before
+	// blob-alloc-cleanup removes it
+	BufferHours int
+	// MetricNamespace enables per-run EMF metrics when set
+	MetricNamespace string
+	// Storage is where blob-alloc-cleanup deletes abandoned blobs from
+	Storage blobstore.Config
+}
+
+// LoadBlobCleanup loads BlobCleanup
+func LoadBlobCleanup(getenv func(string) string) (BlobCleanup, error) {
+	env := NewEnv(getenv)
+	cfg := BlobCleanup{
+		Table:           env.Required("DYNAMODB_TABLE"),
+		Bucket:          env.Required("BLOB_BUCKET"),
+		BufferHours:     env.Int("CLEANUP_BUFFER_HOURS", 72, 1, 24*365),
+		MetricNamespace: env.String("METRIC_NAMESPACE", ""),
+	}
+	cfg.Storage = loadStorage(env, cfg.Bucket, nil)
+	return cfg, env.Err()
+}
+
+// AccountAdmin configures account-admin
+type AccountAdmin struct {
+	Table        string
+	DefaultQuota int64
+	QuotaTiers   account.Tiers
+	// AdminPrincipals may call the IAM /admin routes; an empty list denies
+	// everyone
+	AdminPrincipals []string
+	// AdminGroup may call the Cognito /admin routes; empty denies everyone
+	AdminGroup string
+	// Bucket is the blob bucket objects are backfilled into; empty disables
+	// the backfill route
+	Bucket     string
+	Encryption Encryption
+	// ScanBlobs requests a content scan of each blob backfilled
+	ScanBlobs bool
+}
+
+// LoadAccountAdmin loads AccountAdmin
+func LoadAccountAdmin(getenv func(string) string) (AccountAdmin, error) {
+	env := NewEnv(getenv)
+	cfg := AccountAdmin{
+		Table:           env.Required("DYNAMODB_TABLE"),
+		AdminPrincipals: env.List("ADMIN_PRINCIPALS"),
+		AdminGroup:      env.String("ADMIN_COGNITO_GROUP", ""),
+		Bucket:          env.String("BLOB_BUCKET", ""),
+		Encryption:      loadEncryption(env),
+		ScanBlobs:       env.Bool("BLOB_SCANNING_ENABLED", false),
+	}
+	cfg.DefaultQuota, cfg.QuotaTiers = loadQuota(env)
+	return cfg, env.Err()
+}
+
+// AccountInit configures account-init
+type AccountInit struct {
+	Table        string
+	DefaultQuota int64
+	QuotaTiers   account.Tiers
+}
+
+// LoadAccountInit loads AccountInit
+func LoadAccountInit(getenv func(string) string) (AccountInit, error) {
+	env := NewEnv(getenv)
+	cfg := AccountInit{Table: env.Required("DYNAMODB_TABLE")}
+	cfg.DefaultQuota, cfg.QuotaTiers = loadQuota(env)
+	return cfg, env.Err()
+}
+
+// Health configures health
+type Health struct {
+	Table               string
+	Bucket              string
+	DelegationSecretARN string
+}
+
+// LoadHealth loads Health
+func LoadHealth(getenv func(string) string) (Health, error) {
+	env := NewEnv(getenv)
+	cfg := Health{
+		Table:               env.Required("DYNAMODB_TABLE"),
+		Bucket:              env.Required("BLOB_BUCKET"),
+		DelegationSecretARN: env.Required("DELEGATION_SECRET_ARN"),
+	}
+	return cfg, env.Err()
+}
+
+// Canary configures canary
+type Canary struct {
+	APIURL          string
+	AccountID       string
+	MetricNamespace string
+}
+
+// LoadCanary loads Canary
+func LoadCanary(getenv func(string) string) (Canary, error) {
+	env := NewEnv(getenv)
+	cfg := Canary{
+		APIURL:          env.Required("API_URL"),
+		AccountID:       env.Required("CANARY_ACCOUNT_ID"),
+		MetricNamespace: env.Required("METRIC_NAMESPACE"),
+	}
+	return cfg, env.Err()
+}
+
+// KeyAgeCheck configures key-age-check
+type KeyAgeCheck struct {
+	SSMParameterName string
+	MetricNamespace  string
+}
+
+// LoadKeyAgeCheck loads KeyAgeCheck
+func LoadKeyAgeCheck(getenv func(string) string) (KeyAgeCheck, error) {
+	env := NewEnv(getenv)
+	cfg := KeyAgeCheck{
+		SSMParameterName: env.Required("SSM_PARAMETER_NAME"),
+		MetricNamespace:  env.Required("METRIC_NAMESPACE"),
+	}
+	return cfg, env.Err()
+}
+
+// QuotaAlerts configures quota-alerts
+type QuotaAlerts struct {
+	Table string
+	// Thresholds is the comma-separated QUOTA_ALERT_THRESHOLDS list, parsed
+	// by quota-alerts. It is required, since without thresholds the Lambda
+	// would consume the stream and publish nothing.
+	Thresholds string
+}
+
+// LoadQuotaAlerts loads QuotaAlerts
+func LoadQuotaAlerts(getenv func(string) string) (QuotaAlerts, error) {
+	env := NewEnv(getenv)
+	cfg := QuotaAlerts{
+		Table:      env.Required("DYNAMODB_TABLE"),
+		Thresholds: env.Required("QUOTA_ALERT_THRESHOLDS"),
+	}
+	return cfg, env.Err()
+}
+
+// UsageMetering configures usage-metering
+type UsageMetering struct {
+	Table string
+	// Thresholds are quota percentages that raise usage.threshold events;
+	// none disables them
+	Thresholds []int
+}
+
+// LoadUsageMetering loads UsageMetering
+func LoadUsageMetering(getenv func(string) string) (UsageMetering, error) {
+	env := NewEnv(getenv)
+	cfg := UsageMetering{Table: env.Required("DYNAMODB_TABLE")}
+	var err error
+	cfg.Thresholds, err = usage.ParseThresholds(env.getenv("USAGE_THRESHOLDS"))
+	env.Check("USAGE_THRESHOLDS", err)
+	return cfg, env.Err()
+}
+
+// DLQRedrive configures dlq-redrive
+type DLQRedrive struct {
+	// ConfirmQueueURL and CleanupQueueURL are the blob-confirm and
+	// blob-cleanup dead letter queues
+	ConfirmQueueURL string
+	CleanupQueueURL string
+	// ParkedQueueURL is where messages that cannot be redriven are kept
+	ParkedQueueURL  string
+	ConfirmFunction string
+	CleanupFunction string
+	Bucket          string
+	// StreamARN is the table stream blob-cleanup reads
+	StreamARN string
+	// MaxAttempts is how many runs try a message before it is parked
+	MaxAttempts int
+	// MetricNamespace enables per-run EMF metrics when set
+	MetricNamespace string
+}
+
+// LoadDLQRedrive loads DLQRedrive
+func LoadDLQRedrive(getenv func(string) string) (DLQRedrive, error) {
+	env := NewEnv(getenv)
+	cfg := DLQRedrive{
+		ConfirmQueueURL: env.Required("BLOB_CONFIRM_DLQ_URL"),
+		CleanupQueueURL: env.Required("BLOB_CLEANUP_DLQ_URL"),
+		ParkedQueueURL:  env.Required("DLQ_PARKED_QUEUE_URL"),
+		ConfirmFunction: env.Required("BLOB_CONFIRM_FUNCTION"),
+		CleanupFunction: env.Required("BLOB_CLEANUP_FUNCTION"),
+		Bucket:          env.Required("BLOB_BUCKET"),
+		StreamARN:       env.Required("DYNAMODB_STREAM_ARN"),
+		MaxAttempts:     env.Int("DLQ_REDRIVE_MAX_ATTEMPTS", 5, 1, 100),
+		MetricNamespace: env.String("METRIC_NAMESPACE", ""),
+	}
+	return cfg, env.Err()
+}
+
+// AccountReaper configures account-reaper
+type AccountReaper struct {
+	Table string
+	// InactiveAfter is how long an account goes unused before it is flagged
+	InactiveAfter time.Duration
+	// Action is one of the account.Inactive* actions
+	Action string
+	// DeletionDelay is how far ahead deletion is scheduled for the
+	// schedule-deletion action
+	DeletionDelay time.Duration
+}
+
+// LoadAccountReaper loads AccountReaper
+func LoadAccountReaper(getenv func(string) string) (AccountReaper, error) {
+	env := NewEnv(getenv)
+	day := 24 * time.Hour
+	cfg := AccountReaper{
+		Table:         env.Required("DYNAMODB_TABLE"),
+		InactiveAfter: env.Seconds("INACTIVE_ACCOUNT_AFTER_SECONDS", 365*day, day, 10*365*day),
+		Action:        env.String("INACTIVE_ACCOUNT_ACTION", account.InactiveFlag),
+		DeletionDelay: env.Seconds("INACTIVE_ACCOUNT_DELETION_DELAY_SECONDS", 30*day, 0, 365*day),
+	}
+	switch cfg.Action {
+	case account.InactiveFlag, account.InactiveSuspend, account.InactiveDeletion:
+	default:
+		env.Check("INACTIVE_ACCOUNT_ACTION", fmt.Errorf("must be flag, suspend or schedule-deletion, got %q", cfg.Action))
+	}
+	return cfg, env.Err()
+}
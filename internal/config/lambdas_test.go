@@ -0,0 +1,474 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadJMAPAPI_Defaults(t *testing.T) {
+	cfg, err := LoadJMAPAPI(testEnv(map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"ACCOUNT_ID_CLAIM":      "sub",
+		"DELEGATION_SECRET_ARN": "arn:secret",
+		"RATE_LIMIT_PER_SECOND": "0",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxSizeUploadPut != 250000000 || cfg.MaxPendingAllocations != 4 || cfg.AllocationURLExpiry != 15*time.Minute || cfg.DispatcherParallelism != 4 || cfg.IdempotencyTTL != 24*time.Hour || cfg.PluginLatencyInterval != time.Minute {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+	if cfg.RateLimit.Active() || cfg.BlobBucket != "" || cfg.LogSamplePercent != 0 || cfg.UploadProgressEvents || len(cfg.TagKeys) != 0 || cfg.PluginPrewarm || cfg.QuotaGrace.Percent != 0 || cfg.StrictValidation || cfg.RegistryConsistentRead || cfg.StateTokenMaxAge != 0 || cfg.ConcurrencyLimit {
+		t.Errorf("expected optional settings off, got %+v", cfg)
+	}
+}
+
+func TestLoadJMAPAPI_QuotaGrace(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":             "jmap-test",
+		"ACCOUNT_ID_CLAIM":           "sub",
+		"DELEGATION_SECRET_ARN":      "arn:secret",
+		"RATE_LIMIT_PER_SECOND":      "0",
+		"QUOTA_GRACE_PERCENT":        "5",
+		"QUOTA_GRACE_PERIOD_SECONDS": "86400",
+	}
+	cfg, err := LoadJMAPAPI(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.QuotaGrace.Percent != 5 || cfg.QuotaGrace.Period != 24*time.Hour {
+		t.Errorf("unexpected quota grace %+v", cfg.QuotaGrace)
+	}
+
+	values["QUOTA_GRACE_PERIOD_SECONDS"] = "60"
+	if _, err := LoadJMAPAPI(testEnv(values)); err == nil || !strings.Contains(err.Error(), "QUOTA_GRACE_PERIOD_SECONDS") {
+		t.Errorf("expected a QUOTA_GRACE_PERIOD_SECONDS error, got %v", err)
+	}
+}
+
+func TestLoadJMAPAPI_ReportsEveryProblem(t *testing.T) {
+	_, err := LoadJMAPAPI(testEnv(map[string]string{
+		"RATE_LIMIT_PER_SECOND": "10",
+		"RATE_LIMIT_BURST":      "0",
+		"LOG_SAMPLE_PERCENT":    "101",
+		"ACCOUNT_TYPE_FEATURES": "{",
+	}))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"DYNAMODB_TABLE is required", "ACCOUNT_ID_CLAIM is required", "DELEGATION_SECRET_ARN is required", "RATE_LIMIT_BURST", "LOG_SAMPLE_PERCENT", "ACCOUNT_TYPE_FEATURES"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadSession_MaxWait(t *testing.T) {
+	values := map[string]string{"DYNAMODB_TABLE": "jmap-test", "ACCOUNT_ID_CLAIM": "sub"}
+	cfg, err := LoadSession(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.MaxWait != 20*time.Second {
+		t.Errorf("unexpected default maximum wait %v", cfg.MaxWait)
+	}
+
+	values["SESSION_MAX_WAIT_SECONDS"] = "0"
+	if cfg, err := LoadSession(testEnv(values)); err != nil || cfg.MaxWait != 0 {
+		t.Errorf("expected long polling disabled, got %v, %v", cfg.MaxWait, err)
+	}
+	values["SESSION_MAX_WAIT_SECONDS"] = "30"
+	if _, err := LoadSession(testEnv(values)); err == nil {
+		t.Error("expected a wait past API Gateway's timeout to be rejected")
+	}
+}
+
+func TestLoadBlobUpload_AccessPoints(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"ACCOUNT_ID_CLAIM":      "sub",
+		"BLOB_BUCKET":           "blobs",
+		"DELEGATION_SECRET_ARN": "arn:secret",
+		"RATE_LIMIT_PER_SECOND": "0",
+		"BLOB_ACCESS_POINTS":    `{"shared-inbox": "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/jmap-shared"}`,
+	}
+	cfg, err := LoadBlobUpload(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AccessPoints.Bucket("shared-inbox", "blobs") != "arn:aws:s3:ap-southeast-2:123456789012:accesspoint/jmap-shared" {
+		t.Errorf("unexpected access points %v", cfg.AccessPoints)
+	}
+
+	values["BLOB_ACCESS_POINTS"] = `{"shared-inbox": "blobs"}`
+	if _, err := LoadBlobUpload(testEnv(values)); err == nil || !strings.Contains(err.Error(), "BLOB_ACCESS_POINTS") {
+		t.Errorf("expected a BLOB_ACCESS_POINTS error, got %v", err)
+	}
+}
+
+func TestLoadBlobUpload_TagKeys(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"ACCOUNT_ID_CLAIM":      "sub",
+		"BLOB_BUCKET":           "blobs",
+		"DELEGATION_SECRET_ARN": "arn:secret",
+		"RATE_LIMIT_PER_SECOND": "0",
+		"BLOB_TAG_KEYS":         "Source, Retention",
+	}
+	cfg, err := LoadBlobUpload(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(cfg.TagKeys) != 2 || cfg.TagKeys[0] != "Source" || cfg.TagKeys[1] != "Retention" {
+		t.Errorf("unexpected tag keys %v", cfg.TagKeys)
+	}
+
+	values["BLOB_TAG_KEYS"] = "Source,Status"
+	if _, err := LoadBlobUpload(testEnv(values)); err == nil || !strings.Contains(err.Error(), "BLOB_TAG_KEYS") {
+		t.Errorf("expected a BLOB_TAG_KEYS error, got %v", err)
+	}
+}
+
+func TestLoadBlobUpload_RateLimit(t *testing.T) {
+	cfg, err := LoadBlobUpload(testEnv(map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"ACCOUNT_ID_CLAIM":      "sub",
+		"BLOB_BUCKET":           "blobs",
+		"DELEGATION_SECRET_ARN": "arn:secret",
+		"RATE_LIMIT_PER_SECOND": "0",
+		"RATE_LIMIT_TIERS":      `{"pro": {"rate": 50, "burst": 100}}`,
+		"CORS_ALLOWED_ORIGINS":  "https://app.example.com",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.RateLimit.Enabled || !cfg.RateLimit.Active() || cfg.RateLimit.Tiers["pro"].Burst != 100 {
+		t.Errorf("expected only the tier limit, got %+v", cfg.RateLimit)
+	}
+	if len(cfg.CORSOrigins) != 1 {
+		t.Errorf("unexpected origins %v", cfg.CORSOrigins)
+	}
+	if cfg.MaxSizeUpload != 10000000 {
+		t.Errorf("expected the default maxSizeUpload, got %d", cfg.MaxSizeUpload)
+	}
+	if cfg.ScanBlobs {
+		t.Error("expected scanning off by default")
+	}
+}
+
+func TestLoadBlobStore_ScanBlobs(t *testing.T) {
+	cfg, err := LoadBlobStore(testEnv(map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"BLOB_BUCKET":           "blobs",
+		"BLOB_SCANNING_ENABLED": "true",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.ScanBlobs {
+		t.Error("expected scanning enabled")
+	}
+}
+
+func TestLoadBlobStore_ContentSniffing(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE": "jmap-test",
+		"BLOB_BUCKET":    "blobs",
+	}
+	cfg, err := LoadBlobStore(testEnv(values))
+	if err != nil || cfg.ContentSniffing != "off" {
+		t.Fatalf("expected sniffing off by default, got %q, %v", cfg.ContentSniffing, err)
+	}
+
+	values["BLOB_CONTENT_SNIFFING"] = "correct"
+	if cfg, err := LoadBlobStore(testEnv(values)); err != nil || cfg.ContentSniffing != "correct" {
+		t.Errorf("expected correct, got %q, %v", cfg.ContentSniffing, err)
+	}
+
+	values["BLOB_CONTENT_SNIFFING"] = "fix"
+	if _, err := LoadBlobStore(testEnv(values)); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
+func TestLoadBlobStore_StorageBackend(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE": "jmap-test",
+		"BLOB_BUCKET":    "blobs",
+	}
+	cfg, err := LoadBlobStore(testEnv(values))
+	if err != nil || cfg.Storage.Backend != "s3" || cfg.Storage.Bucket != "blobs" {
+		t.Fatalf("expected the S3 backend by default, got %+v, %v", cfg.Storage, err)
+	}
+
+	values["BLOB_STORAGE_BACKEND"] = "filesystem"
+	if _, err := LoadBlobStore(testEnv(values)); err == nil {
+		t.Error("expected the filesystem backend to need a root")
+	}
+
+	values["BLOB_STORAGE_ROOT"] = "/tmp/blobs"
+	if cfg, err := LoadBlobStore(testEnv(values)); err != nil || cfg.Storage.Root != "/tmp/blobs" {
+		t.Errorf("expected the root, got %+v, %v", cfg.Storage, err)
+	}
+
+	values["BLOB_STORAGE_BACKEND"] = "gcs"
+	if _, err := LoadBlobStore(testEnv(values)); err == nil {
+		t.Error("expected an unknown backend to be rejected")
+	}
+}
+
+func TestLoadBlobDownload_SourceIPPrefixes(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":         "jmap-test",
+		"ACCOUNT_ID_CLAIM":       "sub",
+		"CLOUDFRONT_DOMAIN":      "cdn.example.com",
+		"CLOUDFRONT_KEY_PAIR_ID": "KEYPAIRID123",
+		"PRIVATE_KEY_SECRET_ARN": "arn:key",
+		"DELEGATION_SECRET_ARN":  "arn:secret",
+		"RATE_LIMIT_PER_SECOND":  "0",
+		"SIGNED_URL_IPV4_PREFIX": "24",
+	}
+	cfg, err := LoadBlobDownload(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.SourceIPv4Prefix != 24 || cfg.SourceIPv6Prefix != 0 || cfg.SignedURLExpiry != 5*time.Minute {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+	if cfg.BlobCacheSize != 0 || cfg.BlobCacheTTL != 30*time.Second {
+		t.Errorf("unexpected cache config %+v", cfg)
+	}
+
+	values["SIGNED_URL_IPV4_PREFIX"] = "33"
+	if _, err := LoadBlobDownload(testEnv(values)); err == nil {
+		t.Error("expected an IPv4 prefix over 32 to be rejected")
+	}
+	values["SIGNED_URL_IPV4_PREFIX"] = ""
+	values["SIGNED_URL_IPV6_PREFIX"] = "abc"
+	if _, err := LoadBlobDownload(testEnv(values)); err == nil {
+		t.Error("expected a non-numeric IPv6 prefix to be rejected")
+	}
+}
+
+func TestLoadBlobDownload_BlobCache(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":         "jmap-test",
+		"ACCOUNT_ID_CLAIM":       "sub",
+		"CLOUDFRONT_DOMAIN":      "cdn.example.com",
+		"CLOUDFRONT_KEY_PAIR_ID": "KEYPAIRID123",
+		"PRIVATE_KEY_SECRET_ARN": "arn:key",
+		"DELEGATION_SECRET_ARN":  "arn:secret",
+		"RATE_LIMIT_PER_SECOND":  "0",
+		"BLOB_CACHE_SIZE":        "500",
+		"BLOB_CACHE_TTL_SECONDS": "5",
+	}
+	cfg, err := LoadBlobDownload(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BlobCacheSize != 500 || cfg.BlobCacheTTL != 5*time.Second {
+		t.Errorf("unexpected cache config %+v", cfg)
+	}
+
+	values["BLOB_CACHE_TTL_SECONDS"] = "0"
+	if _, err := LoadBlobDownload(testEnv(values)); err == nil {
+		t.Error("expected a zero cache TTL to be rejected")
+	}
+}
+
+func TestLoadBlobDownload_Failover(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":         "jmap-test",
+		"ACCOUNT_ID_CLAIM":       "sub",
+		"CLOUDFRONT_DOMAIN":      "cdn.example.com",
+		"CLOUDFRONT_KEY_PAIR_ID": "KEYPAIRID123",
+		"PRIVATE_KEY_SECRET_ARN": "arn:key",
+		"DELEGATION_SECRET_ARN":  "arn:secret",
+		"RATE_LIMIT_PER_SECOND":  "0",
+	}
+	cfg, err := LoadBlobDownload(testEnv(values))
+	if err != nil || cfg.Failover {
+		t.Fatalf("expected failover off by default, got %v, %v", cfg.Failover, err)
+	}
+
+	values["BLOB_DOWNLOAD_FAILOVER"] = "true"
+	if _, err := LoadBlobDownload(testEnv(values)); err == nil || !strings.Contains(err.Error(), "BLOB_MIRROR_DOMAIN is required") {
+		t.Errorf("expected failover to need the replica, got %v", err)
+	}
+
+	values["BLOB_MIRROR_DOMAIN"] = "dr.cdn.example.com"
+	values["BLOB_MIRROR_REGION"] = "us-west-2"
+	values["BLOB_MIRROR_TABLE"] = "jmap-test-dr"
+	cfg, err = LoadBlobDownload(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.Failover || cfg.FailoverDomain != "dr.cdn.example.com" || cfg.FailoverRegion != "us-west-2" || cfg.FailoverTable != "jmap-test-dr" {
+		t.Errorf("unexpected failover config %+v", cfg)
+	}
+}
+
+func TestLoadBlobMirror(t *testing.T) {
+	values := map[string]string{
+		"DYNAMODB_TABLE":     "jmap-test",
+		"BLOB_BUCKET":        "blobs",
+		"BLOB_MIRROR_REGION": "us-west-2",
+		"BLOB_MIRROR_BUCKET": "blobs-dr",
+	}
+	if _, err := LoadBlobMirror(testEnv(values)); err == nil || !strings.Contains(err.Error(), "BLOB_MIRROR_TABLE is required") {
+		t.Errorf("expected the replica table to be required, got %v", err)
+	}
+
+	values["BLOB_MIRROR_TABLE"] = "jmap-test-dr"
+	cfg, err := LoadBlobMirror(testEnv(values))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Region != "us-west-2" || cfg.ReplicaBucket != "blobs-dr" || cfg.ReplicaTable != "jmap-test-dr" || cfg.Bucket != "blobs" {
+		t.Errorf("unexpected config %+v", cfg)
+	}
+}
+
+func TestLoadBlobDelete(t *testing.T) {
+	vars := map[string]string{
+		"DYNAMODB_TABLE":        "jmap-test",
+		"ACCOUNT_ID_CLAIM":      "sub",
+		"DELEGATION_SECRET_ARN": "arn:secret",
+	}
+	cfg, err := LoadBlobDelete(testEnv(vars))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Table != "jmap-test" || cfg.MirrorBucket != "" {
+		t.Errorf("expected verdicts not retagged by default, got %+v", cfg)
+	}
+
+	vars["BLOB_MIRROR_SOURCE_BUCKET"] = "blobs"
+	cfg, _ = LoadBlobDelete(testEnv(vars))
+	if cfg.MirrorBucket != "blobs" {
+		t.Errorf("expected the mirror source bucket, got %+v", cfg)
+	}
+}
+
+func TestLoadAccountAdmin(t *testing.T) {
+	cfg, err := LoadAccountAdmin(testEnv(map[string]string{
+		"DYNAMODB_TABLE":      "jmap-test",
+		"DEFAULT_QUOTA_BYTES": "1000",
+		"QUOTA_TIERS":         `{"pro": 5000}`,
+		"ADMIN_PRINCIPALS":    " arn:a , ,arn:b",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.DefaultQuota != 1000 || len(cfg.QuotaTiers) != 1 {
+		t.Errorf("unexpected quota %+v", cfg)
+	}
+	if len(cfg.AdminPrincipals) != 2 || cfg.AdminPrincipals[0] != "arn:a" || cfg.AdminPrincipals[1] != "arn:b" {
+		t.Errorf("unexpected principals %v", cfg.AdminPrincipals)
+	}
+	if cfg.Bucket != "" || cfg.ScanBlobs {
+		t.Errorf("expected backfill disabled by default, got %+v", cfg)
+	}
+}
+
+func TestLoadAccountAdmin_Backfill(t *testing.T) {
+	cfg, err := LoadAccountAdmin(testEnv(map[string]string{
+		"DYNAMODB_TABLE":            "jmap-test",
+		"DEFAULT_QUOTA_BYTES":       "1000",
+		"BLOB_BUCKET":               "blobs",
+		"BLOB_METADATA_KMS_KEY_ARN": "arn:key",
+		"BLOB_SCANNING_ENABLED":     "true",
+	}))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Bucket != "blobs" || cfg.Encryption.KMSKeyARN != "arn:key" || !cfg.ScanBlobs {
+		t.Errorf("unexpected backfill config %+v", cfg)
+	}
+}
+
+func TestLoadAccountInit_DefaultQuota(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  string
+	}{
+		{"", "DEFAULT_QUOTA_BYTES is required"},
+		{"lots", "DEFAULT_QUOTA_BYTES must be an integer"},
+	} {
+		_, err := LoadAccountInit(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test", "DEFAULT_QUOTA_BYTES": tt.value}))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("DEFAULT_QUOTA_BYTES=%q: expected %q, got %v", tt.value, tt.want, err)
+		}
+	}
+}
+
+func TestLoadBlobCleanup(t *testing.T) {
+	cfg, err := LoadBlobCleanup(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test", "BLOB_BUCKET": "blobs"}))
+	if err != nil || cfg.BufferHours != 72 {
+		t.Errorf("expected a 72 hour buffer, got %d, %v", cfg.BufferHours, err)
+	}
+}
+
+func TestLoadQuotaAlerts_RequiresThresholds(t *testing.T) {
+	cfg, err := LoadQuotaAlerts(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test", "QUOTA_ALERT_THRESHOLDS": "10,0"}))
+	if err != nil || cfg.Thresholds != "10,0" {
+		t.Errorf("unexpected thresholds %q, %v", cfg.Thresholds, err)
+	}
+	if _, err := LoadQuotaAlerts(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test"})); err == nil {
+		t.Error("expected missing thresholds to be rejected")
+	}
+}
+
+func TestLoadUsageMetering(t *testing.T) {
+	cfg, err := LoadUsageMetering(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test", "USAGE_THRESHOLDS": "100,80"}))
+	if err != nil || len(cfg.Thresholds) != 2 || cfg.Thresholds[0] != 80 {
+		t.Errorf("unexpected thresholds %v, %v", cfg.Thresholds, err)
+	}
+	if _, err := LoadUsageMetering(testEnv(map[string]string{"DYNAMODB_TABLE": "jmap-test", "USAGE_THRESHOLDS": "x"})); err == nil {
+		t.Error("expected an invalid threshold to be rejected")
+	}
+}
+
+func TestLoadDLQRedrive(t *testing.T) {
+	env := map[string]string{
+		"BLOB_CONFIRM_DLQ_URL":  "https://sqs.example/confirm-dlq",
+		"BLOB_CLEANUP_DLQ_URL":  "https://sqs.example/cleanup-dlq",
+		"DLQ_PARKED_QUEUE_URL":  "https://sqs.example/parked",
+		"BLOB_CONFIRM_FUNCTION": "blob-confirm",
+		"BLOB_CLEANUP_FUNCTION": "blob-cleanup",
+		"BLOB_BUCKET":           "blobs",
+		"DYNAMODB_STREAM_ARN":   "arn:aws:dynamodb:us-east-1:123456789012:table/jmap/stream/1",
+	}
+	cfg, err := LoadDLQRedrive(testEnv(env))
+	if err != nil || cfg.MaxAttempts != 5 {
+		t.Errorf("expected 5 attempts, got %d, %v", cfg.MaxAttempts, err)
+	}
+
+	env["DLQ_REDRIVE_MAX_ATTEMPTS"] = "0"
+	if _, err := LoadDLQRedrive(testEnv(env)); err == nil {
+		t.Error("expected zero attempts to be rejected")
+	}
+}
+
+func TestLoadAccountReaper(t *testing.T) {
+	env := map[string]string{"DYNAMODB_TABLE": "jmap"}
+	cfg, err := LoadAccountReaper(testEnv(env))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.Action != "flag" || cfg.InactiveAfter != 365*24*time.Hour || cfg.DeletionDelay != 30*24*time.Hour {
+		t.Errorf("unexpected defaults %+v", cfg)
+	}
+
+	env["INACTIVE_ACCOUNT_ACTION"] = "delete"
+	if _, err := LoadAccountReaper(testEnv(env)); err == nil {
+		t.Error("expected an unknown action to be rejected")
+	}
+
+	env["INACTIVE_ACCOUNT_ACTION"] = "suspend"
+	env["INACTIVE_ACCOUNT_AFTER_SECONDS"] = "60"
+	if _, err := LoadAccountReaper(testEnv(env)); err == nil {
+		t.Error("expected a threshold under a day to be rejected")
+	}
+}
@@ -0,0 +1,70 @@
+// Package correlation carries a correlation ID through a request so it can be
+// followed end to end: from the X-Correlation-Id header, or generated when
+// the caller sends none, into spans, logs, plugin invocations and published
+// events, and back to the caller in the response.
+package correlation
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Header carries the correlation ID on requests and responses
+const Header = "X-Correlation-Id"
+
+// SpanAttribute is the span attribute holding the correlation ID
+const SpanAttribute = "correlation.id"
+
+// validID limits caller-supplied IDs to short tokens that are safe to log
+// and echo
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:\-]{1,128}$`)
+
+type contextKey struct{}
+
+// WithID returns a context carrying a correlation ID
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the correlation ID in ctx, or "" if there is none
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+// FromHeaders returns the caller's correlation ID, or a new one when the
+// header is missing or not a valid ID
+func FromHeaders(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, Header) && validID.MatchString(value) {
+			return value
+		}
+	}
+	return uuid.NewString()
+}
+
+// RequestContext returns a context carrying the request's correlation ID,
+// which is also recorded on the invocation's span, and the ID
+func RequestContext(ctx context.Context, request events.APIGatewayProxyRequest) (context.Context, string) {
+	id := FromHeaders(request.Headers)
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String(SpanAttribute, id))
+	return WithID(ctx, id), id
+}
+
+// SetHeader adds the correlation ID to a response's headers and returns them
+func SetHeader(headers map[string]string, id string) map[string]string {
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[Header] = id
+	return headers
+}
@@ -0,0 +1,57 @@
+package correlation
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+func TestFromHeaders_AcceptsCallerID(t *testing.T) {
+	if id := FromHeaders(map[string]string{"x-correlation-id": "client-42.retry:1"}); id != "client-42.retry:1" {
+		t.Errorf("expected caller's ID, got %q", id)
+	}
+}
+
+func TestFromHeaders_GeneratesID(t *testing.T) {
+	for name, headers := range map[string]map[string]string{
+		"missing":  nil,
+		"empty":    {Header: ""},
+		"invalid":  {Header: "bad id\nwith newline"},
+		"too long": {Header: strings.Repeat("a", 129)},
+	} {
+		id := FromHeaders(headers)
+		if _, err := uuid.Parse(id); err != nil {
+			t.Errorf("%s: expected generated UUID, got %q", name, id)
+		}
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	request := events.APIGatewayProxyRequest{Headers: map[string]string{Header: "abc-123"}}
+
+	ctx, id := RequestContext(context.Background(), request)
+	if id != "abc-123" || FromContext(ctx) != "abc-123" {
+		t.Errorf("expected abc-123 in context, got %q and %q", id, FromContext(ctx))
+	}
+}
+
+func TestFromContext_None(t *testing.T) {
+	if id := FromContext(context.Background()); id != "" {
+		t.Errorf("expected no ID, got %q", id)
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	headers := SetHeader(nil, "abc-123")
+	if headers[Header] != "abc-123" {
+		t.Errorf("expected header to be set, got %v", headers)
+	}
+
+	headers = SetHeader(map[string]string{"Content-Type": "application/json"}, "abc-123")
+	if len(headers) != 2 || headers[Header] != "abc-123" {
+		t.Errorf("expected header added to existing headers, got %v", headers)
+	}
+}
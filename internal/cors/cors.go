@@ -0,0 +1,114 @@
+// Package cors adds CORS headers to handler responses and answers preflight
+// requests, so browser clients can call the API from the origins configured
+// in CORS_ALLOWED_ORIGINS.
+package cors
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AllowedHeaders are the request headers browser clients may send
+const AllowedHeaders = "Authorization,Content-Type,X-Debug-Log,X-Correlation-Id,X-Blob-Region,Idempotency-Key,X-JMAP-Client-Profile"
+
+// ExposedHeaders are the response headers browser clients may read
+const ExposedHeaders = "X-Correlation-Id,Idempotent-Replayed"
+
+// MaxAge is how long, in seconds, browsers may cache a preflight response
+const MaxAge = 600
+
+// Policy decides which origins may call a handler and with which methods
+type Policy struct {
+	origins  map[string]bool
+	allowAll bool
+	methods  string
+}
+
+// New creates a Policy for the given origins and methods. An origin of "*"
+// allows every origin. OPTIONS is always allowed.
+func New(origins []string, methods ...string) *Policy {
+	p := &Policy{
+		origins: make(map[string]bool),
+		methods: strings.Join(append(methods, "OPTIONS"), ","),
+	}
+	for _, origin := range origins {
+		if origin == "*" {
+			p.allowAll = true
+		}
+		p.origins[origin] = true
+	}
+	return p
+}
+
+// ParseOrigins splits a comma-separated origin list, ignoring blanks
+func ParseOrigins(value string) []string {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// IsPreflight reports whether a request is a CORS preflight
+func IsPreflight(httpMethod string) bool {
+	return httpMethod == "OPTIONS"
+}
+
+// Apply adds CORS headers for the request's origin to a response's headers
+// and returns them. Responses for a disallowed or missing origin get no
+// Access-Control headers, which makes the browser block them.
+func (p *Policy) Apply(requestHeaders, responseHeaders map[string]string) map[string]string {
+	if responseHeaders == nil {
+		responseHeaders = make(map[string]string)
+	}
+	if p.allowAll {
+		responseHeaders["Access-Control-Allow-Origin"] = "*"
+		responseHeaders["Access-Control-Expose-Headers"] = ExposedHeaders
+		return responseHeaders
+	}
+
+	// The response differs by origin, so caches must key on it
+	addVary(responseHeaders, "Origin")
+	origin := header(requestHeaders, "Origin")
+	if origin != "" && p.origins[origin] {
+		responseHeaders["Access-Control-Allow-Origin"] = origin
+		responseHeaders["Access-Control-Expose-Headers"] = ExposedHeaders
+	}
+	return responseHeaders
+}
+
+// Preflight returns the headers for a preflight response
+func (p *Policy) Preflight(requestHeaders map[string]string) map[string]string {
+	headers := p.Apply(requestHeaders, nil)
+	if _, ok := headers["Access-Control-Allow-Origin"]; !ok {
+		return headers
+	}
+	headers["Access-Control-Allow-Methods"] = p.methods
+	headers["Access-Control-Allow-Headers"] = AllowedHeaders
+	headers["Access-Control-Max-Age"] = strconv.Itoa(MaxAge)
+	return headers
+}
+
+// addVary adds a value to the Vary header, keeping any already there
+func addVary(headers map[string]string, value string) {
+	for key, existing := range headers {
+		if strings.EqualFold(key, "Vary") {
+			delete(headers, key)
+			headers["Vary"] = existing + ", " + value
+			return
+		}
+	}
+	headers["Vary"] = value
+}
+
+// header returns a header value, which API Gateway may pass in any case
+func header(headers map[string]string, name string) string {
+	for key, value := range headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,88 @@
+package cors
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		origins  []string
+		request  map[string]string
+		response map[string]string
+		want     map[string]string
+	}{
+		{
+			name:    "wildcard",
+			origins: []string{"*"},
+			request: map[string]string{"origin": "https://app.example.com"},
+			want: map[string]string{
+				"Access-Control-Allow-Origin":   "*",
+				"Access-Control-Expose-Headers": ExposedHeaders,
+			},
+		},
+		{
+			name:     "allowed origin",
+			origins:  []string{"https://app.example.com"},
+			request:  map[string]string{"Origin": "https://app.example.com"},
+			response: map[string]string{"Content-Type": "application/json"},
+			want: map[string]string{
+				"Content-Type":                  "application/json",
+				"Access-Control-Allow-Origin":   "https://app.example.com",
+				"Access-Control-Expose-Headers": ExposedHeaders,
+				"Vary":                          "Origin",
+			},
+		},
+		{
+			name:    "disallowed origin",
+			origins: []string{"https://app.example.com"},
+			request: map[string]string{"Origin": "https://evil.example.com"},
+			want:    map[string]string{"Vary": "Origin"},
+		},
+		{
+			name:     "existing vary",
+			origins:  []string{"https://app.example.com"},
+			request:  map[string]string{},
+			response: map[string]string{"vary": "Accept-Encoding"},
+			want:     map[string]string{"Vary": "Accept-Encoding, Origin"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := New(tc.origins, "POST").Apply(tc.request, tc.response)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("expected %v, got %v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestPreflight(t *testing.T) {
+	p := New([]string{"https://app.example.com"}, "GET")
+
+	headers := p.Preflight(map[string]string{"Origin": "https://app.example.com"})
+	if headers["Access-Control-Allow-Methods"] != "GET,OPTIONS" {
+		t.Errorf("unexpected methods %q", headers["Access-Control-Allow-Methods"])
+	}
+	if headers["Access-Control-Allow-Headers"] != AllowedHeaders || headers["Access-Control-Max-Age"] != "600" {
+		t.Errorf("unexpected preflight headers %v", headers)
+	}
+
+	headers = p.Preflight(map[string]string{"Origin": "https://evil.example.com"})
+	if _, ok := headers["Access-Control-Allow-Methods"]; ok {
+		t.Errorf("expected no preflight headers for a disallowed origin, got %v", headers)
+	}
+}
+
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://a.example.com, ,https://b.example.com")
+	want := []string{"https://a.example.com", "https://b.example.com"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+	if got := ParseOrigins(""); got != nil {
+		t.Errorf("expected no origins, got %v", got)
+	}
+}
@@ -10,33 +10,48 @@ import (
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
 	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
 )
 
 // Client wraps DynamoDB operations with OTel tracing
 type Client struct {
-	ddb       dbclient.DynamoDBClient
-	tableName string
+	ddb            dbclient.DynamoDBClient
+	tableName      string
+	consistentRead bool
 }
 
-// NewClientFromConfig creates a new DynamoDB client from an existing AWS config.
-// The config should already have OTel middleware appended.
+// NewClientFromConfig creates a new DynamoDB client from an existing AWS config,
+// retrying throttled requests. The config should already have OTel middleware appended.
 func NewClientFromConfig(cfg aws.Config, tableName string) *Client {
-	ddb := dbclient.NewClient(cfg)
+	ddb := store.NewRetryClient(dynamodb.NewFromConfig(cfg))
 	return &Client{
 		ddb:       ddb,
 		tableName: tableName,
 	}
 }
 
+// WithConsistentRead makes the client's queries strongly consistent when
+// consistent is true, at twice the read cost
+func (c *Client) WithConsistentRead(consistent bool) *Client {
+	c.consistentRead = consistent
+	return c
+}
+
 // Account represents an account record in DynamoDB
 type Account struct {
 	PK                  string `dynamodbav:"pk"`
 	SK                  string `dynamodbav:"sk"`
 	UserID              string `dynamodbav:"-"` // Derived from PK, not stored
 	Owner               string `dynamodbav:"owner"`
+	AccountType         string `dynamodbav:"accountType,omitempty"`
 	CreatedAt           string `dynamodbav:"createdAt"`
 	LastDiscoveryAccess string `dynamodbav:"lastDiscoveryAccess"`
+	WritesDisabled      bool   `dynamodbav:"writesDisabled,omitempty"`
+
+	// CapabilityOverrides are the account's session capability settings,
+	// as on account.Meta
+	CapabilityOverrides map[string]map[string]any `dynamodbav:"capabilityOverrides,omitempty"`
 }
 
 // EnsureAccount creates or updates an account record.
@@ -100,9 +115,23 @@ func (c *Client) EnsureAccount(ctx context.Context, userID string) (*Account, er
 // QueryByPK queries all items with the given partition key.
 // Returns the raw DynamoDB attribute maps for flexibility.
 func (c *Client) QueryByPK(ctx context.Context, pk string) ([]map[string]types.AttributeValue, error) {
-	keyCondition := expression.Key("pk").Equal(expression.Value(pk))
+	return c.QueryAttributes(ctx, pk, nil)
+}
 
-	expr, err := expression.NewBuilder().WithKeyCondition(keyCondition).Build()
+// QueryAttributes queries all items with the given partition key, reading
+// only the named attributes, or every attribute if none are named. It reads
+// every page of the partition.
+func (c *Client) QueryAttributes(ctx context.Context, pk string, attributes []string) ([]map[string]types.AttributeValue, error) {
+	builder := expression.NewBuilder().WithKeyCondition(expression.Key("pk").Equal(expression.Value(pk)))
+	if len(attributes) > 0 {
+		projection := expression.NamesList(expression.Name(attributes[0]))
+		for _, name := range attributes[1:] {
+			projection = projection.AddNames(expression.Name(name))
+		}
+		builder = builder.WithProjection(projection)
+	}
+
+	expr, err := builder.Build()
 	if err != nil {
 		return nil, fmt.Errorf("failed to build query expression: %w", err)
 	}
@@ -110,14 +139,22 @@ func (c *Client) QueryByPK(ctx context.Context, pk string) ([]map[string]types.A
 	input := &dynamodb.QueryInput{
 		TableName:                 aws.String(c.tableName),
 		KeyConditionExpression:    expr.KeyCondition(),
+		ProjectionExpression:      expr.Projection(),
 		ExpressionAttributeNames:  expr.Names(),
 		ExpressionAttributeValues: expr.Values(),
+		ConsistentRead:            aws.Bool(c.consistentRead),
 	}
 
-	output, err := c.ddb.Query(ctx, input)
-	if err != nil {
-		return nil, err
+	var items []map[string]types.AttributeValue
+	for {
+		output, err := c.ddb.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, output.Items...)
+		if len(output.LastEvaluatedKey) == 0 {
+			return items, nil
+		}
+		input.ExclusiveStartKey = output.LastEvaluatedKey
 	}
-
-	return output.Items, nil
 }
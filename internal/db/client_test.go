@@ -68,3 +68,54 @@ func TestQueryByPK_CallsDynamoDBWithCorrectPK(t *testing.T) {
 		t.Error("Expected Query to be called on DynamoDB client")
 	}
 }
+
+func TestQueryByPK_ReadsEveryPage(t *testing.T) {
+	pages := []*dynamodb.QueryOutput{
+		{
+			Items:            []map[string]types.AttributeValue{{"pluginId": &types.AttributeValueMemberS{Value: "mail"}}},
+			LastEvaluatedKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: "PLUGIN#"}},
+		},
+		{
+			Items: []map[string]types.AttributeValue{{"pluginId": &types.AttributeValueMemberS{Value: "contacts"}}},
+		},
+	}
+	var startKeys []map[string]types.AttributeValue
+	mock := &mockDynamoDBClient{
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			startKeys = append(startKeys, params.ExclusiveStartKey)
+			page := pages[0]
+			pages = pages[1:]
+			return page, nil
+		},
+	}
+	client := &Client{ddb: mock, tableName: "test-table"}
+
+	items, err := client.QueryByPK(context.Background(), "PLUGIN#")
+	if err != nil {
+		t.Fatalf("QueryByPK returned error: %v", err)
+	}
+	if len(items) != 2 || len(startKeys) != 2 || startKeys[0] != nil || startKeys[1] == nil {
+		t.Errorf("expected both pages read in turn, got %d items from %d queries", len(items), len(startKeys))
+	}
+}
+
+func TestQueryAttributes_ProjectsAndReadsConsistently(t *testing.T) {
+	mock := &mockDynamoDBClient{}
+	client := (&Client{ddb: mock, tableName: "test-table"}).WithConsistentRead(true)
+
+	if _, err := client.QueryAttributes(context.Background(), "PLUGIN#", []string{"pluginId", "version"}); err != nil {
+		t.Fatalf("QueryAttributes returned error: %v", err)
+	}
+
+	input := mock.queryInput
+	if input.ProjectionExpression == nil || !*input.ConsistentRead {
+		t.Fatalf("expected a consistent, projected query, got %+v", input)
+	}
+	projected := map[string]bool{}
+	for _, name := range input.ExpressionAttributeNames {
+		projected[name] = true
+	}
+	if !projected["pluginId"] || !projected["version"] {
+		t.Errorf("expected pluginId and version projected, got %v", input.ExpressionAttributeNames)
+	}
+}
@@ -0,0 +1,200 @@
+// Package deadletter stores plugin events that the publisher could not send
+// after retrying, so that the event-redrive Lambda can send them again later
+// instead of the events being lost.
+package deadletter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+// PK is the partition key holding all dead letters. Dead letters are rare,
+// and a single partition lets the redrive Lambda read them oldest first.
+const PK = "DEADLETTER#"
+
+// Record is a dead-lettered event in DynamoDB
+type Record struct {
+	PK            string `dynamodbav:"pk"`
+	SK            string `dynamodbav:"sk"` // {failedAt}#{id}
+	AccountID     string `dynamodbav:"accountId"`
+	EventType     string `dynamodbav:"eventType"`
+	Payload       string `dynamodbav:"payload"`
+	PluginID      string `dynamodbav:"pluginId"`
+	TargetType    string `dynamodbav:"targetType"`
+	TargetArn     string `dynamodbav:"targetArn"`
+	DetailType    string `dynamodbav:"detailType,omitempty"`
+	SecretArn     string `dynamodbav:"secretArn,omitempty"`
+	SchemaVersion int    `dynamodbav:"schemaVersion,omitempty"`
+	Attempts      int    `dynamodbav:"attempts"`
+	LastError     string `dynamodbav:"lastError"`
+	FailedAt      string `dynamodbav:"failedAt"`
+	Redrives      int    `dynamodbav:"redrives"`
+	LastRedriveAt string `dynamodbav:"lastRedriveAt,omitempty"`
+}
+
+// Target returns the target the event could not be sent to
+func (r Record) Target() plugin.AggregatedEventTarget {
+	return plugin.AggregatedEventTarget{
+		PluginID:      r.PluginID,
+		TargetType:    r.TargetType,
+		TargetArn:     r.TargetArn,
+		DetailType:    r.DetailType,
+		SecretArn:     r.SecretArn,
+		SchemaVersion: r.SchemaVersion,
+	}
+}
+
+// Event returns the event that could not be sent
+func (r Record) Event() (publisher.EventPayload, error) {
+	var payload publisher.EventPayload
+	if err := json.Unmarshal([]byte(r.Payload), &payload); err != nil {
+		return publisher.EventPayload{}, fmt.Errorf("failed to unmarshal dead letter %s: %w", r.SK, err)
+	}
+	return payload, nil
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed for dead letters
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBStore stores dead letters in DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// Put stores an event that could not be sent to a target
+func (d *DynamoDBStore) Put(ctx context.Context, letter publisher.DeadLetter) error {
+	// Stamp the version so the payload can be upgraded by a later redrive
+	payload := letter.Payload
+	if payload.SchemaVersion == 0 {
+		payload.SchemaVersion = publisher.CurrentSchemaVersion
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter payload: %w", err)
+	}
+
+	failedAt := d.now().UTC().Format(time.RFC3339Nano)
+	record := Record{
+		PK:            PK,
+		SK:            failedAt + "#" + uuid.NewString(),
+		AccountID:     payload.AccountID,
+		EventType:     payload.EventType,
+		Payload:       string(body),
+		PluginID:      letter.Target.PluginID,
+		TargetType:    letter.Target.TargetType,
+		TargetArn:     letter.Target.TargetArn,
+		DetailType:    letter.Target.DetailType,
+		SecretArn:     letter.Target.SecretArn,
+		SchemaVersion: letter.Target.SchemaVersion,
+		Attempts:      letter.Attempts,
+		LastError:     letter.Error,
+		FailedAt:      failedAt,
+	}
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dead letter: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to put dead letter: %w", err)
+	}
+	return nil
+}
+
+// List returns up to limit dead letters, oldest first
+func (d *DynamoDBStore) List(ctx context.Context, limit int) ([]Record, error) {
+	var records []Record
+	var startKey map[string]types.AttributeValue
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                 aws.String(d.tableName),
+			KeyConditionExpression:    aws.String("pk = :pk"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{":pk": &types.AttributeValueMemberS{Value: PK}},
+			Limit:                     aws.Int32(int32(limit - len(records))),
+			ExclusiveStartKey:         startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to query dead letters: %w", err)
+		}
+
+		for _, item := range output.Items {
+			var record Record
+			if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal dead letter: %w", err)
+			}
+			records = append(records, record)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 || len(records) >= limit {
+			return records, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
+
+// Delete removes a dead letter once it has been redriven
+func (d *DynamoDBStore) Delete(ctx context.Context, sk string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: PK},
+			"sk": &types.AttributeValueMemberS{Value: sk},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete dead letter: %w", err)
+	}
+	return nil
+}
+
+// RecordRedriveFailure keeps a dead letter whose redrive failed, recording the error
+func (d *DynamoDBStore) RecordRedriveFailure(ctx context.Context, sk, lastError string) error {
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: PK},
+			"sk": &types.AttributeValueMemberS{Value: sk},
+		},
+		UpdateExpression:    aws.String("SET lastError = :error, lastRedriveAt = :now ADD redrives :one"),
+		ConditionExpression: aws.String("attribute_exists(pk)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":error": &types.AttributeValueMemberS{Value: lastError},
+			":now":   &types.AttributeValueMemberS{Value: d.now().UTC().Format(time.RFC3339)},
+			":one":   &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record dead letter redrive failure: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package deadletter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockDynamoDBClient struct {
+	putInputs    []*dynamodb.PutItemInput
+	queryInputs  []*dynamodb.QueryInput
+	queryOutputs []*dynamodb.QueryOutput
+	updateInput  *dynamodb.UpdateItemInput
+	deleteInput  *dynamodb.DeleteItemInput
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.putInputs = append(m.putInputs, params)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.queryInputs = append(m.queryInputs, params)
+	output := m.queryOutputs[0]
+	m.queryOutputs = m.queryOutputs[1:]
+	return output, nil
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updateInput = params
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deleteInput = params
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBStore_Put_RoundTripsTargetAndEvent(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "table")
+	store.now = func() time.Time { return time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC) }
+
+	target := plugin.AggregatedEventTarget{
+		PluginID:      "billing",
+		TargetType:    "eventbridge",
+		TargetArn:     "arn:aws:events:ap-southeast-2:123456789012:event-bus/billing",
+		DetailType:    "Account Created",
+		SchemaVersion: 1,
+	}
+	err := store.Put(context.Background(), publisher.DeadLetter{
+		Target:   target,
+		Payload:  publisher.EventPayload{EventType: "account.created", AccountID: "user-123"},
+		Error:    "throttled",
+		Attempts: 3,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var record Record
+	if err := attributevalue.UnmarshalMap(client.putInputs[0].Item, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.PK != PK || !strings.HasPrefix(record.SK, "2026-03-04T05:06:07Z#") {
+		t.Errorf("unexpected key %s / %s", record.PK, record.SK)
+	}
+	if record.Target() != target {
+		t.Errorf("expected target to round trip, got %+v", record.Target())
+	}
+	if record.AccountID != "user-123" || record.Attempts != 3 || record.LastError != "throttled" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+
+	event, err := record.Event()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if event.EventType != "account.created" || event.SchemaVersion != publisher.CurrentSchemaVersion {
+		t.Errorf("unexpected event: %+v", event)
+	}
+}
+
+func TestDynamoDBStore_List_PaginatesUpToLimit(t *testing.T) {
+	item := func(sk string) map[string]types.AttributeValue {
+		av, _ := attributevalue.MarshalMap(Record{PK: PK, SK: sk})
+		return av
+	}
+	client := &mockDynamoDBClient{queryOutputs: []*dynamodb.QueryOutput{
+		{
+			Items:            []map[string]types.AttributeValue{item("a")},
+			LastEvaluatedKey: map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: PK}},
+		},
+		{Items: []map[string]types.AttributeValue{item("b")}},
+	}}
+	store := NewDynamoDBStore(client, "table")
+
+	records, err := store.List(context.Background(), 5)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records[0].SK != "a" || records[1].SK != "b" {
+		t.Errorf("unexpected records: %+v", records)
+	}
+	if *client.queryInputs[1].Limit != 4 {
+		t.Errorf("expected second page limited to the remainder, got %d", *client.queryInputs[1].Limit)
+	}
+}
+
+func TestDynamoDBStore_RecordRedriveFailure(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "table")
+
+	if err := store.RecordRedriveFailure(context.Background(), "sk-1", "still failing"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.updateInput.Key["sk"].(*types.AttributeValueMemberS).Value != "sk-1" {
+		t.Error("expected update of the dead letter")
+	}
+	if client.updateInput.ExpressionAttributeValues[":error"].(*types.AttributeValueMemberS).Value != "still failing" {
+		t.Error("expected the redrive error to be recorded")
+	}
+}
+
+func TestDynamoDBStore_Delete(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "table")
+
+	if err := store.Delete(context.Background(), "sk-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.deleteInput.Key["pk"].(*types.AttributeValueMemberS).Value != PK {
+		t.Error("expected delete from the dead letter partition")
+	}
+}
@@ -0,0 +1,218 @@
+// Package delegation mints and verifies the short-lived tokens core passes to
+// plugins so they can call back into the IAM endpoints on behalf of a single
+// account and request. A token is only honoured for the principals of the
+// plugin it was minted for, and does not lift principal bindings.
+package delegation
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+var logger = loglevel.New()
+
+// HeaderName is the request header that carries a delegation token
+const HeaderName = "X-JMAP-Delegation-Token"
+
+// DefaultTTL is how long a delegation token is valid. It only needs to
+// outlive a single plugin invocation.
+const DefaultTTL = 5 * time.Minute
+
+// tokenPrefix marks a delegation token
+const tokenPrefix = "jmd."
+
+var (
+	// ErrInvalidToken is returned for malformed tokens or bad signatures
+	ErrInvalidToken = errors.New("invalid delegation token")
+	// ErrExpiredToken is returned for tokens past their expiry
+	ErrExpiredToken = errors.New("delegation token expired")
+	// ErrWrongAccount is returned for tokens presented for another account
+	ErrWrongAccount = errors.New("delegation token is for another account")
+	// ErrWrongPrincipal is returned for tokens presented by a principal
+	// other than the plugin they were minted for
+	ErrWrongPrincipal = errors.New("delegation token is for another principal")
+)
+
+// Claims is what a delegation token grants: access to one account, for the
+// principals of the plugin serving one method call of one JMAP request, until
+// it expires
+type Claims struct {
+	AccountID  string   `json:"accountId"`
+	RequestID  string   `json:"requestId"`
+	Method     string   `json:"method"`
+	Principals []string `json:"principals"`
+	ExpiresAt  int64    `json:"exp"`
+}
+
+// Signer mints and verifies delegation tokens with an HMAC-SHA256 key
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner creates a Signer for the given key
+func NewSigner(key []byte, ttl time.Duration) *Signer {
+	return &Signer{
+		key: key,
+		ttl: ttl,
+		now: time.Now,
+	}
+}
+
+// Mint returns a token granting principals, the client principals of the
+// plugin serving method, access to accountID for its call within requestID
+func (s *Signer) Mint(accountID, requestID, method string, principals []string) (string, error) {
+	payload, err := json.Marshal(Claims{
+		AccountID:  accountID,
+		RequestID:  requestID,
+		Method:     method,
+		Principals: principals,
+		ExpiresAt:  s.now().Add(s.ttl).Unix(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal delegation claims: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return tokenPrefix + encoded + "." + s.sign(encoded), nil
+}
+
+// Verify checks a token's signature, scope and expiry and returns its claims
+func (s *Signer) Verify(token string) (*Claims, error) {
+	rest, ok := strings.CutPrefix(token, tokenPrefix)
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	encoded, signature, ok := strings.Cut(rest, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(s.sign(encoded))) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims Claims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.AccountID == "" || claims.RequestID == "" || claims.Method == "" || len(claims.Principals) == 0 {
+		return nil, ErrInvalidToken
+	}
+	if s.now().Unix() >= claims.ExpiresAt {
+		return nil, ErrExpiredToken
+	}
+
+	return &claims, nil
+}
+
+// sign returns the encoded HMAC of an encoded payload
+func (s *Signer) sign(encoded string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verifier verifies delegation tokens
+type Verifier interface {
+	Verify(token string) (*Claims, error)
+}
+
+// Authorize checks the delegation token in a request's headers and returns
+// its claims if it grants callerARN access to accountID. It returns nil
+// claims and no error when there is no token or no verifier; callers fall
+// back to registry trust then, and when the token is rejected.
+func Authorize(verifier Verifier, headers map[string]string, accountID, callerARN string) (*Claims, error) {
+	token := TokenFromHeaders(headers)
+	if verifier == nil || token == "" {
+		return nil, nil
+	}
+
+	claims, err := verifier.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+	if claims.AccountID != accountID {
+		return nil, ErrWrongAccount
+	}
+	if !plugin.IsAllowedARN(claims.Principals, callerARN) {
+		return nil, ErrWrongPrincipal
+	}
+	return claims, nil
+}
+
+// IsDelegated reports whether an IAM-authenticated request carries a
+// delegation token granting its caller access to accountID. Rejected tokens
+// are logged, and the caller falls back to registry trust.
+func IsDelegated(ctx context.Context, verifier Verifier, request events.APIGatewayProxyRequest, accountID string) bool {
+	claims, err := Authorize(verifier, request.Headers, accountID, request.RequestContext.Identity.UserArn)
+	if err != nil {
+		logger.WarnContext(ctx, "Rejected delegation token",
+			slog.String("request_id", request.RequestContext.RequestID),
+			slog.String("account_id", accountID),
+			slog.String("caller_principal", request.RequestContext.Identity.UserArn),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	if claims == nil {
+		return false
+	}
+
+	logger.InfoContext(ctx, "Delegated plugin call",
+		slog.String("request_id", request.RequestContext.RequestID),
+		slog.String("account_id", accountID),
+		slog.String("delegating_request_id", claims.RequestID),
+		slog.String("delegating_method", claims.Method),
+	)
+	return true
+}
+
+// TokenFromHeaders returns the delegation token from request headers, which
+// API Gateway may pass in any case
+func TokenFromHeaders(headers map[string]string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, HeaderName) {
+			return value
+		}
+	}
+	return ""
+}
+
+// SecretsClient defines the Secrets Manager operation needed to load the key
+type SecretsClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// LoadKey reads the signing key from Secrets Manager
+func LoadKey(ctx context.Context, client SecretsClient, secretARN string) ([]byte, error) {
+	result, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretARN),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegation key: %w", err)
+	}
+	if result.SecretString == nil || *result.SecretString == "" {
+		return nil, fmt.Errorf("delegation key secret is empty")
+	}
+	return []byte(*result.SecretString), nil
+}
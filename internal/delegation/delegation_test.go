@@ -0,0 +1,205 @@
+package delegation
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// testPrincipals are the client principals of the plugin tokens are minted for
+var testPrincipals = []string{"arn:aws:iam::123456789012:role/MailPlugin"}
+
+func testSigner(now time.Time) *Signer {
+	s := NewSigner([]byte("test-key"), DefaultTTL)
+	s.now = func() time.Time { return now }
+	return s
+}
+
+func TestMintVerify_RoundTrip(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := testSigner(now)
+
+	token, err := s.Mint("user-1", "req-1", "Email/import", testPrincipals)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, "jmd.") {
+		t.Errorf("expected jmd. prefix, got %s", token)
+	}
+
+	claims, err := s.Verify(token)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if claims.AccountID != "user-1" || claims.RequestID != "req-1" || claims.Method != "Email/import" || len(claims.Principals) != 1 {
+		t.Errorf("unexpected claims: %+v", claims)
+	}
+	if claims.ExpiresAt != now.Add(DefaultTTL).Unix() {
+		t.Errorf("unexpected expiry %d", claims.ExpiresAt)
+	}
+}
+
+func TestVerify_Expired(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	token, _ := testSigner(now).Mint("user-1", "req-1", "Email/import", testPrincipals)
+
+	if _, err := testSigner(now.Add(DefaultTTL)).Verify(token); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("expected ErrExpiredToken, got %v", err)
+	}
+}
+
+func TestVerify_Invalid(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	token, _ := testSigner(now).Mint("user-1", "req-1", "Email/import", testPrincipals)
+
+	other := NewSigner([]byte("other-key"), DefaultTTL)
+	other.now = func() time.Time { return now }
+
+	payload, signature, _ := strings.Cut(strings.TrimPrefix(token, "jmd."), ".")
+	forged, _ := testSigner(now).Mint("user-2", "req-1", "Email/import", testPrincipals)
+	forgedPayload, _, _ := strings.Cut(strings.TrimPrefix(forged, "jmd."), ".")
+
+	tests := map[string]struct {
+		signer *Signer
+		token  string
+	}{
+		"wrong key":         {signer: other, token: token},
+		"swapped payload":   {signer: testSigner(now), token: "jmd." + forgedPayload + "." + signature},
+		"missing prefix":    {signer: testSigner(now), token: payload + "." + signature},
+		"missing signature": {signer: testSigner(now), token: "jmd." + payload},
+		"empty":             {signer: testSigner(now), token: ""},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := tc.signer.Verify(tc.token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_Unscoped(t *testing.T) {
+	s := testSigner(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		name                         string
+		accountID, requestID, method string
+		principals                   []string
+	}{
+		{name: "no account", requestID: "req-1", method: "Email/import", principals: testPrincipals},
+		{name: "no request", accountID: "user-1", method: "Email/import", principals: testPrincipals},
+		{name: "no method", accountID: "user-1", requestID: "req-1", principals: testPrincipals},
+		{name: "no principals", accountID: "user-1", requestID: "req-1", method: "Email/import"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			token, _ := s.Mint(tc.accountID, tc.requestID, tc.method, tc.principals)
+			if _, err := s.Verify(token); !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	s := testSigner(now)
+	token, _ := s.Mint("user-1", "req-1", "Email/import", testPrincipals)
+	pluginSession := "arn:aws:sts::123456789012:assumed-role/MailPlugin/session-1"
+
+	tests := []struct {
+		name      string
+		headers   map[string]string
+		accountID string
+		caller    string
+		wantErr   error
+		wantNil   bool
+	}{
+		{name: "plugin session for the token's account", headers: map[string]string{HeaderName: token}, accountID: "user-1", caller: pluginSession},
+		{name: "another account", headers: map[string]string{HeaderName: token}, accountID: "user-2", caller: pluginSession, wantErr: ErrWrongAccount},
+		{name: "another plugin's role", headers: map[string]string{HeaderName: token}, accountID: "user-1", caller: "arn:aws:sts::123456789012:assumed-role/Other/session-1", wantErr: ErrWrongPrincipal},
+		{name: "forged token", headers: map[string]string{HeaderName: token + "x"}, accountID: "user-1", caller: pluginSession, wantErr: ErrInvalidToken},
+		{name: "no token", accountID: "user-1", caller: pluginSession, wantNil: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			claims, err := Authorize(s, tc.headers, tc.accountID, tc.caller)
+			if !errors.Is(err, tc.wantErr) {
+				t.Fatalf("expected %v, got %v", tc.wantErr, err)
+			}
+			if (claims == nil) != (tc.wantErr != nil || tc.wantNil) {
+				t.Errorf("unexpected claims %+v", claims)
+			}
+		})
+	}
+
+	if claims, err := Authorize(nil, map[string]string{HeaderName: token}, "user-1", pluginSession); claims != nil || err != nil {
+		t.Errorf("expected no delegation without a verifier, got %+v %v", claims, err)
+	}
+}
+
+func TestIsDelegated(t *testing.T) {
+	s := testSigner(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC))
+	token, _ := s.Mint("user-1", "req-1", "Email/import", testPrincipals)
+	request := events.APIGatewayProxyRequest{
+		Headers: map[string]string{"x-jmap-delegation-token": token},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Identity: events.APIGatewayRequestIdentity{UserArn: "arn:aws:sts::123456789012:assumed-role/MailPlugin/session-1"},
+		},
+	}
+
+	if !IsDelegated(context.Background(), s, request, "user-1") {
+		t.Error("expected the plugin's session to be delegated")
+	}
+	if IsDelegated(context.Background(), s, request, "user-2") {
+		t.Error("expected no delegation for another account")
+	}
+	request.RequestContext.Identity.UserArn = "arn:aws:iam::123456789012:role/Other"
+	if IsDelegated(context.Background(), s, request, "user-1") {
+		t.Error("expected no delegation for another principal")
+	}
+}
+
+func TestTokenFromHeaders_CaseInsensitive(t *testing.T) {
+	if got := TokenFromHeaders(map[string]string{"x-jmap-delegation-token": "jmd.a.b"}); got != "jmd.a.b" {
+		t.Errorf("expected token, got %q", got)
+	}
+	if got := TokenFromHeaders(map[string]string{"Authorization": "x"}); got != "" {
+		t.Errorf("expected no token, got %q", got)
+	}
+}
+
+type mockSecretsClient struct {
+	value *string
+	err   error
+}
+
+func (m *mockSecretsClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: m.value}, nil
+}
+
+func TestLoadKey(t *testing.T) {
+	key, err := LoadKey(context.Background(), &mockSecretsClient{value: aws.String("s3cret")}, "arn:secret")
+	if err != nil || string(key) != "s3cret" {
+		t.Errorf("unexpected result: %q %v", key, err)
+	}
+
+	if _, err := LoadKey(context.Background(), &mockSecretsClient{value: aws.String("")}, "arn:secret"); err == nil {
+		t.Error("expected error for empty secret")
+	}
+	if _, err := LoadKey(context.Background(), &mockSecretsClient{err: errors.New("denied")}, "arn:secret"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -3,11 +3,20 @@ package dispatcher
 import (
 	"context"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/jarrod-lowe/jmap-service-core/internal/otelmetrics"
 	"github.com/jarrod-lowe/jmap-service-core/internal/resultref"
 	"github.com/jarrod-lowe/jmap-service-libs/plugincontract"
 )
 
+// Pool saturation shows as calls waiting for a worker while all are busy
+var (
+	queueWait   = otelmetrics.Histogram("jmap.dispatcher.queue_wait", "Time method calls wait for a free worker", "ms")
+	utilization = otelmetrics.Histogram("jmap.dispatcher.utilization", "Fraction of workers busy when a call starts", "1")
+)
+
 // CallProcessor processes a single JMAP method call
 type CallProcessor interface {
 	Process(ctx context.Context, idx int, call []any, depResponses []resultref.MethodResponse) []any
@@ -25,6 +34,7 @@ type workItem struct {
 	idx          int
 	call         []any
 	depResponses []resultref.MethodResponse
+	enqueuedAt   time.Time
 }
 
 // completion signals that a work item finished processing
@@ -74,6 +84,7 @@ func Execute(ctx context.Context, cfg Config) [][]any {
 // startWorkers spawns a fixed pool of workers that pull from the work queue
 func startWorkers(ctx context.Context, poolSize int, workQueue <-chan workItem,
 	completions chan<- completion, processor CallProcessor, wg *sync.WaitGroup) {
+	var busy atomic.Int64
 	for w := 0; w < poolSize; w++ {
 		wg.Add(1)
 		go func() {
@@ -86,7 +97,10 @@ func startWorkers(ctx context.Context, poolSize int, workQueue <-chan workItem,
 					if !ok {
 						return // Queue closed, shut down
 					}
+					queueWait.Record(ctx, otelmetrics.Milliseconds(time.Since(item.enqueuedAt)))
+					utilization.Record(ctx, float64(busy.Add(1))/float64(poolSize))
 					resp := processor.Process(ctx, item.idx, item.call, item.depResponses)
+					busy.Add(-1)
 					isErr := isErrorResponse(resp)
 					completions <- completion{item.idx, resp, isErr}
 				}
@@ -113,6 +127,7 @@ func coordinate(ctx context.Context, calls [][]any, deps, dependents map[int][]i
 				idx:          i,
 				call:         call,
 				depResponses: nil,
+				enqueuedAt:   time.Now(),
 			}
 		}
 	}
@@ -165,6 +180,7 @@ func coordinate(ctx context.Context, calls [][]any, deps, dependents map[int][]i
 										idx:          transitiveDepIdx,
 										call:         calls[transitiveDepIdx],
 										depResponses: gatherDepResponses(transitiveDepIdx, deps, responses),
+										enqueuedAt:   time.Now(),
 									}
 								}
 							}
@@ -176,6 +192,7 @@ func coordinate(ctx context.Context, calls [][]any, deps, dependents map[int][]i
 						idx:          depIdx,
 						call:         calls[depIdx],
 						depResponses: gatherDepResponses(depIdx, deps, responses),
+						enqueuedAt:   time.Now(),
 					}
 				}
 			}
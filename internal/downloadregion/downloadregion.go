@@ -0,0 +1,85 @@
+// Package downloadregion picks the CloudFront domain a blob download is
+// served from, for deployments that replicate the blob bucket to other
+// regions behind their own distributions.
+package downloadregion
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Request headers naming the region a client wants blobs served from, and
+// the country CloudFront saw the viewer in
+const (
+	HintHeader    = "X-Blob-Region"
+	CountryHeader = "CloudFront-Viewer-Country"
+)
+
+// Regions maps each replica region to the domain serving its blobs, and
+// viewer countries to the region nearest them
+type Regions struct {
+	// Domains maps a region name, such as "eu-west-1", to a CloudFront
+	// domain whose /blobs/* behavior serves that region's replica
+	Domains map[string]string `json:"domains"`
+	// Countries maps an ISO 3166-1 alpha-2 country code to a region name
+	Countries map[string]string `json:"countries"`
+}
+
+// Parse parses a JSON object of domains and countries, e.g.
+// {"domains": {"eu-west-1": "eu.cdn.example.com"}, "countries": {"DE": "eu-west-1"}}.
+// Every country must map to a region with a domain. An empty string yields
+// no regions, so every download uses the primary domain.
+func Parse(value string) (Regions, error) {
+	var regions Regions
+	if value == "" {
+		return regions, nil
+	}
+
+	if err := json.Unmarshal([]byte(value), &regions); err != nil {
+		return Regions{}, fmt.Errorf("invalid download regions: %w", err)
+	}
+	for region, domain := range regions.Domains {
+		if domain == "" || strings.ContainsAny(domain, "/:") {
+			return Regions{}, fmt.Errorf("invalid download regions: region %q must have a bare domain name", region)
+		}
+	}
+	countries := make(map[string]string, len(regions.Countries))
+	for country, region := range regions.Countries {
+		if _, ok := regions.Domains[region]; !ok {
+			return Regions{}, fmt.Errorf("invalid download regions: country %q maps to unknown region %q", country, region)
+		}
+		countries[strings.ToUpper(country)] = region
+	}
+	regions.Countries = countries
+	return regions, nil
+}
+
+// Domain returns the domain to serve a download from, and its region: the
+// hinted region if it has a domain, else the region of the viewer's country,
+// else primary with an empty region
+func (r Regions) Domain(hint, country, primary string) (domain, region string) {
+	if domain, ok := r.Domains[hint]; ok {
+		return domain, hint
+	}
+	if region, ok := r.Countries[strings.ToUpper(country)]; ok {
+		return r.Domains[region], region
+	}
+	return primary, ""
+}
+
+// FromHeaders returns the domain and region to serve a download from, using
+// the request's region hint and viewer country headers
+func (r Regions) FromHeaders(headers map[string]string, primary string) (domain, region string) {
+	return r.Domain(header(headers, HintHeader), header(headers, CountryHeader), primary)
+}
+
+// header returns a header's value, matching its name case-insensitively
+func header(headers map[string]string, name string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package downloadregion
+
+import "testing"
+
+const testRegions = `{"domains": {"eu-west-1": "eu.cdn.example.com", "ap-southeast-2": "au.cdn.example.com"}, "countries": {"de": "eu-west-1", "AU": "ap-southeast-2", "NZ": "ap-southeast-2"}}`
+
+func TestParse(t *testing.T) {
+	regions, err := Parse(testRegions)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if regions.Domains["eu-west-1"] != "eu.cdn.example.com" || regions.Countries["DE"] != "eu-west-1" {
+		t.Errorf("unexpected regions %+v", regions)
+	}
+
+	if regions, err := Parse(""); err != nil || len(regions.Domains) != 0 {
+		t.Errorf("expected no regions, got %+v, %v", regions, err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, value := range []string{
+		`not json`,
+		`{"domains": {"eu-west-1": ""}}`,
+		`{"domains": {"eu-west-1": "https://eu.cdn.example.com"}}`,
+		`{"domains": {"eu-west-1": "eu.cdn.example.com"}, "countries": {"US": "us-east-1"}}`,
+	} {
+		if _, err := Parse(value); err == nil {
+			t.Errorf("%s: expected an error", value)
+		}
+	}
+}
+
+func TestDomain(t *testing.T) {
+	regions, _ := Parse(testRegions)
+	tests := []struct {
+		name       string
+		hint       string
+		country    string
+		wantDomain string
+		wantRegion string
+	}{
+		{"hint", "eu-west-1", "AU", "eu.cdn.example.com", "eu-west-1"},
+		{"country", "", "nz", "au.cdn.example.com", "ap-southeast-2"},
+		{"unknown hint uses country", "us-east-1", "DE", "eu.cdn.example.com", "eu-west-1"},
+		{"primary", "", "US", "cdn.example.com", ""},
+		{"nothing known", "", "", "cdn.example.com", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			domain, region := regions.Domain(tt.hint, tt.country, "cdn.example.com")
+			if domain != tt.wantDomain || region != tt.wantRegion {
+				t.Errorf("got %q, %q; want %q, %q", domain, region, tt.wantDomain, tt.wantRegion)
+			}
+		})
+	}
+
+	if domain, _ := (Regions{}).Domain("eu-west-1", "DE", "cdn.example.com"); domain != "cdn.example.com" {
+		t.Errorf("expected the primary without regions, got %q", domain)
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	regions, _ := Parse(testRegions)
+	domain, region := regions.FromHeaders(map[string]string{"cloudfront-viewer-country": "DE"}, "cdn.example.com")
+	if domain != "eu.cdn.example.com" || region != "eu-west-1" {
+		t.Errorf("got %q, %q", domain, region)
+	}
+	domain, _ = regions.FromHeaders(map[string]string{"X-Blob-Region": "ap-southeast-2", "CloudFront-Viewer-Country": "DE"}, "cdn.example.com")
+	if domain != "au.cdn.example.com" {
+		t.Errorf("expected the hint to win, got %q", domain)
+	}
+}
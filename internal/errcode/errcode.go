@@ -0,0 +1,120 @@
+// Package errcode defines stable error codes for the errors core returns.
+//
+// JMAP error types are coarse and descriptions are free text that may change,
+// so every method error, SetError and HTTP error body from core also carries
+// a "code" such as CORE-1001. Codes are never reused or renumbered, so
+// clients and support can match on them. The thousands digit groups them:
+//
+//	1xxx  quotas and limits
+//	2xxx  invalid requests
+//	3xxx  authentication and authorization
+//	4xxx  missing resources
+//	5xxx  server failures
+package errcode
+
+import "strings"
+
+// Code is a stable error code
+type Code string
+
+// Field is the member of an error object holding its code
+const Field = "code"
+
+// Quotas and limits
+const (
+	OverQuota        Code = "CORE-1001"
+	TooLarge         Code = "CORE-1002"
+	TooManyPending   Code = "CORE-1003"
+	RateLimited      Code = "CORE-1004"
+	RequestLimit     Code = "CORE-1005"
+	ResponseTooLarge Code = "CORE-1006"
+)
+
+// Invalid requests
+const (
+	InvalidArguments       Code = "CORE-2001"
+	InvalidProperties      Code = "CORE-2002"
+	UnknownMethod          Code = "CORE-2003"
+	InvalidResultReference Code = "CORE-2004"
+	NotJSON                Code = "CORE-2005"
+	NotRequest             Code = "CORE-2006"
+	UnknownCapability      Code = "CORE-2007"
+	Conflict               Code = "CORE-2008"
+	IdempotencyKeyReused   Code = "CORE-2009"
+)
+
+// Authentication and authorization
+const (
+	Unauthorized          Code = "CORE-3001"
+	Forbidden             Code = "CORE-3002"
+	AccountNotFound       Code = "CORE-3003"
+	AccountNotProvisioned Code = "CORE-3004"
+	AccountSuspended      Code = "CORE-3005"
+	BlobInfected          Code = "CORE-3006"
+	AccountReadOnly       Code = "CORE-3007"
+	BlobScanPending       Code = "CORE-3008"
+)
+
+// Missing resources
+const (
+	NotFound     Code = "CORE-4001"
+	BlobNotFound Code = "CORE-4002"
+)
+
+// Server failures
+const (
+	ServerFail        Code = "CORE-5001"
+	ServerUnavailable Code = "CORE-5002"
+)
+
+// problemTypePrefix prefixes the types of RFC 7807 request-level errors
+const problemTypePrefix = "urn:ietf:params:jmap:error:"
+
+// byType is the default code for each error type
+var byType = map[string]Code{
+	"overQuota":              OverQuota,
+	"tooLarge":               TooLarge,
+	"tooManyPending":         TooManyPending,
+	"rateLimited":            RateLimited,
+	"limit":                  RequestLimit,
+	"invalidArguments":       InvalidArguments,
+	"invalidProperties":      InvalidProperties,
+	"unknownMethod":          UnknownMethod,
+	"invalidResultReference": InvalidResultReference,
+	"notJSON":                NotJSON,
+	"notRequest":             NotRequest,
+	"unknownCapability":      UnknownCapability,
+	"conflict":               Conflict,
+	"unauthorized":           Unauthorized,
+	"forbidden":              Forbidden,
+	"accountNotFound":        AccountNotFound,
+	"accountNotProvisioned":  AccountNotProvisioned,
+	"accountReadOnly":        AccountReadOnly,
+	"notFound":               NotFound,
+	"blobNotFound":           BlobNotFound,
+	"serverFail":             ServerFail,
+	"serverUnavailable":      ServerUnavailable,
+}
+
+// ForType returns the code for a JMAP error type or request-level problem
+// type URN, or "" for a type without one
+func ForType(errType string) Code {
+	return byType[strings.TrimPrefix(errType, problemTypePrefix)]
+}
+
+// Attach sets the code of an error object from its "type" member, unless it
+// already has one, and returns it. Errors relayed from plugins keep their own
+// codes.
+func Attach(errObject map[string]any) map[string]any {
+	if errObject == nil {
+		return nil
+	}
+	if _, ok := errObject[Field]; ok {
+		return errObject
+	}
+	errType, _ := errObject["type"].(string)
+	if code := ForType(errType); code != "" {
+		errObject[Field] = string(code)
+	}
+	return errObject
+}
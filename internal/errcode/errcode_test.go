@@ -0,0 +1,74 @@
+package errcode
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestForType(t *testing.T) {
+	tests := []struct {
+		errType string
+		want    Code
+	}{
+		{"overQuota", OverQuota},
+		{"invalidArguments", InvalidArguments},
+		{"urn:ietf:params:jmap:error:notJSON", NotJSON},
+		{"urn:ietf:params:jmap:error:unknownCapability", UnknownCapability},
+		{"accountReadOnly", AccountReadOnly},
+		{"serverFail", ServerFail},
+		{"somethingNew", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := ForType(tt.errType); got != tt.want {
+			t.Errorf("ForType(%q) = %q, want %q", tt.errType, got, tt.want)
+		}
+	}
+}
+
+func TestCodes_AreUniqueAndWellFormed(t *testing.T) {
+	format := regexp.MustCompile(`^CORE-[1-5][0-9]{3}$`)
+	seen := make(map[Code]string)
+	for errType, code := range byType {
+		if !format.MatchString(string(code)) {
+			t.Errorf("code %q for %s is not CORE-nnnn", code, errType)
+		}
+		if other, ok := seen[code]; ok {
+			t.Errorf("code %q is used by both %s and %s", code, other, errType)
+		}
+		seen[code] = errType
+	}
+	if _, ok := seen[AccountSuspended]; ok {
+		t.Errorf("AccountSuspended must not be the default code of a type")
+	}
+	if _, ok := seen[BlobInfected]; ok {
+		t.Errorf("BlobInfected must not be the default code of a type")
+	}
+	if _, ok := seen[IdempotencyKeyReused]; ok {
+		t.Errorf("IdempotencyKeyReused must not be the default code of a type")
+	}
+}
+
+func TestAttach(t *testing.T) {
+	errObject := Attach(map[string]any{"type": "overQuota", "description": "quota exceeded"})
+	if errObject[Field] != "CORE-1001" {
+		t.Errorf("expected CORE-1001, got %v", errObject[Field])
+	}
+}
+
+func TestAttach_KeepsExistingCode(t *testing.T) {
+	errObject := Attach(map[string]any{"type": "serverFail", "code": "MAIL-2001"})
+	if errObject[Field] != "MAIL-2001" {
+		t.Errorf("expected plugin code to be kept, got %v", errObject[Field])
+	}
+}
+
+func TestAttach_UnknownType(t *testing.T) {
+	errObject := Attach(map[string]any{"type": "somethingNew"})
+	if _, ok := errObject[Field]; ok {
+		t.Errorf("expected no code for an unknown type, got %v", errObject[Field])
+	}
+	if Attach(nil) != nil {
+		t.Error("expected nil for a nil error object")
+	}
+}
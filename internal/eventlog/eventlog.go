@@ -0,0 +1,264 @@
+// Package eventlog keeps a copy of every published plugin event for a limited
+// time, so that a plugin that was down or newly registered can have missed
+// events replayed to it.
+package eventlog
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+// PKPrefix is the partition key prefix of event log records. Events are
+// partitioned by UTC day of occurrence: EVENTLOG#{yyyy-mm-dd}.
+const PKPrefix = "EVENTLOG#"
+
+// Retention is how long events are kept for replay
+const Retention = 14 * 24 * time.Hour
+
+// dayFormat is the format of the day in the partition key
+const dayFormat = "2006-01-02"
+
+// ErrInvalidCursor is returned when a replay cursor cannot be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Record is a logged event in DynamoDB
+type Record struct {
+	PK         string `dynamodbav:"pk"`
+	SK         string `dynamodbav:"sk"` // {occurredAt}#{hash}
+	EventType  string `dynamodbav:"eventType"`
+	AccountID  string `dynamodbav:"accountId"`
+	OccurredAt string `dynamodbav:"occurredAt"`
+	Payload    string `dynamodbav:"payload"`
+	TTL        int64  `dynamodbav:"ttl"`
+}
+
+// Filter selects events to replay. From and To are required; EventTypes and
+// AccountID narrow the events within that range if set.
+type Filter struct {
+	EventTypes []string
+	AccountID  string
+	From       time.Time
+	To         time.Time
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by the event log
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBStore stores the event log in DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// Append logs a published event. The key is derived from the event, so
+// appending a redelivered event overwrites the first copy.
+func (d *DynamoDBStore) Append(ctx context.Context, payload publisher.EventPayload) error {
+	if payload.SchemaVersion == 0 {
+		payload.SchemaVersion = publisher.CurrentSchemaVersion
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	occurredAt, err := time.Parse(time.RFC3339, payload.OccurredAt)
+	if err != nil {
+		occurredAt = d.now()
+	}
+	occurredAt = occurredAt.UTC()
+
+	hash := sha256.Sum256(body)
+	record := Record{
+		PK:         PKPrefix + occurredAt.Format(dayFormat),
+		SK:         occurredAt.Format(time.RFC3339) + "#" + hex.EncodeToString(hash[:8]),
+		EventType:  payload.EventType,
+		AccountID:  payload.AccountID,
+		OccurredAt: occurredAt.Format(time.RFC3339),
+		Payload:    string(body),
+		TTL:        occurredAt.Add(Retention).Unix(),
+	}
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event log record: %w", err)
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to append to event log: %w", err)
+	}
+	return nil
+}
+
+// cursor is the position to resume a replay from
+type cursor struct {
+	Day string `json:"day"`
+	SK  string `json:"sk,omitempty"`
+}
+
+// Query returns up to limit logged events matching filter, oldest first, and
+// a cursor for the next page, which is empty when there are no more events
+func (d *DynamoDBStore) Query(ctx context.Context, filter Filter, cursorStr string, limit int) ([]publisher.EventPayload, string, error) {
+	from := filter.From.UTC()
+	to := filter.To.UTC()
+
+	day := from.Truncate(24 * time.Hour)
+	var startSK string
+	if cursorStr != "" {
+		c, err := decodeCursor(cursorStr)
+		if err != nil {
+			return nil, "", err
+		}
+		day, err = time.Parse(dayFormat, c.Day)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		startSK = c.SK
+	}
+
+	var events []publisher.EventPayload
+	for ; !day.After(to); day = day.Add(24 * time.Hour) {
+		pk := PKPrefix + day.Format(dayFormat)
+		var startKey map[string]types.AttributeValue
+		if startSK != "" {
+			startKey = map[string]types.AttributeValue{
+				"pk": &types.AttributeValueMemberS{Value: pk},
+				"sk": &types.AttributeValueMemberS{Value: startSK},
+			}
+			startSK = ""
+		}
+
+		for {
+			input := queryInput(d.tableName, pk, filter, from, to)
+			input.Limit = aws.Int32(int32(limit - len(events)))
+			input.ExclusiveStartKey = startKey
+
+			output, err := d.client.Query(ctx, input)
+			if err != nil {
+				return nil, "", fmt.Errorf("failed to query event log: %w", err)
+			}
+
+			for _, item := range output.Items {
+				var record Record
+				if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+					return nil, "", fmt.Errorf("failed to unmarshal event log record: %w", err)
+				}
+				var payload publisher.EventPayload
+				if err := json.Unmarshal([]byte(record.Payload), &payload); err != nil {
+					return nil, "", fmt.Errorf("failed to unmarshal logged event %s: %w", record.SK, err)
+				}
+				events = append(events, payload)
+			}
+
+			if len(output.LastEvaluatedKey) == 0 {
+				break
+			}
+			if len(events) >= limit {
+				var lastSK string
+				if sk, ok := output.LastEvaluatedKey["sk"].(*types.AttributeValueMemberS); ok {
+					lastSK = sk.Value
+				}
+				next, err := encodeCursor(cursor{Day: day.Format(dayFormat), SK: lastSK})
+				return events, next, err
+			}
+			startKey = output.LastEvaluatedKey
+		}
+
+		if len(events) >= limit {
+			nextDay := day.Add(24 * time.Hour)
+			if nextDay.After(to) {
+				return events, "", nil
+			}
+			next, err := encodeCursor(cursor{Day: nextDay.Format(dayFormat)})
+			return events, next, err
+		}
+	}
+
+	return events, "", nil
+}
+
+// queryInput builds the query for one day's partition
+func queryInput(tableName, pk string, filter Filter, from, to time.Time) *dynamodb.QueryInput {
+	values := map[string]types.AttributeValue{
+		":pk":   &types.AttributeValueMemberS{Value: pk},
+		":from": &types.AttributeValueMemberS{Value: from.Format(time.RFC3339)},
+		// Sort keys continue with "#", which sorts before "~"
+		":to": &types.AttributeValueMemberS{Value: to.Format(time.RFC3339) + "~"},
+	}
+
+	var conditions []string
+	if len(filter.EventTypes) > 0 {
+		names := make([]string, len(filter.EventTypes))
+		for i, eventType := range filter.EventTypes {
+			name := ":type" + strconv.Itoa(i)
+			names[i] = name
+			values[name] = &types.AttributeValueMemberS{Value: eventType}
+		}
+		conditions = append(conditions, "eventType IN ("+strings.Join(names, ", ")+")")
+	}
+	if filter.AccountID != "" {
+		values[":accountId"] = &types.AttributeValueMemberS{Value: filter.AccountID}
+		conditions = append(conditions, "accountId = :accountId")
+	}
+
+	input := &dynamodb.QueryInput{
+		TableName:                 aws.String(tableName),
+		KeyConditionExpression:    aws.String("pk = :pk AND sk BETWEEN :from AND :to"),
+		ExpressionAttributeValues: values,
+	}
+	if len(conditions) > 0 {
+		input.FilterExpression = aws.String(strings.Join(conditions, " AND "))
+	}
+	return input
+}
+
+// encodeCursor converts a replay position into an opaque cursor
+func encodeCursor(c cursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode cursor: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor converts an opaque cursor back into a replay position
+func decodeCursor(value string) (cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return cursor{}, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Day == "" {
+		return cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
@@ -0,0 +1,138 @@
+package eventlog
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockDynamoDBClient struct {
+	putInputs    []*dynamodb.PutItemInput
+	queryInputs  []*dynamodb.QueryInput
+	queryOutputs map[string][]*dynamodb.QueryOutput // by pk
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.putInputs = append(m.putInputs, params)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.queryInputs = append(m.queryInputs, params)
+	pk := params.ExpressionAttributeValues[":pk"].(*types.AttributeValueMemberS).Value
+	outputs := m.queryOutputs[pk]
+	if len(outputs) == 0 {
+		return &dynamodb.QueryOutput{}, nil
+	}
+	m.queryOutputs[pk] = outputs[1:]
+	return outputs[0], nil
+}
+
+func logItem(t *testing.T, occurredAt, eventType string) map[string]types.AttributeValue {
+	t.Helper()
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "table")
+	if err := store.Append(context.Background(), publisher.EventPayload{EventType: eventType, OccurredAt: occurredAt, AccountID: "user-123"}); err != nil {
+		t.Fatal(err)
+	}
+	return client.putInputs[0].Item
+}
+
+func TestDynamoDBStore_Append_PartitionsByDay(t *testing.T) {
+	item := logItem(t, "2026-03-04T05:06:07Z", "account.created")
+
+	var record Record
+	if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+		t.Fatal(err)
+	}
+	if record.PK != "EVENTLOG#2026-03-04" {
+		t.Errorf("expected day partition, got %s", record.PK)
+	}
+	if record.SK[:21] != "2026-03-04T05:06:07Z#" {
+		t.Errorf("expected sort key to start with occurredAt, got %s", record.SK)
+	}
+	if record.TTL != time.Date(2026, 3, 18, 5, 6, 7, 0, time.UTC).Unix() {
+		t.Errorf("expected ttl at the end of retention, got %d", record.TTL)
+	}
+
+	// A redelivered event gets the same key
+	again := logItem(t, "2026-03-04T05:06:07Z", "account.created")
+	if again["sk"].(*types.AttributeValueMemberS).Value != record.SK {
+		t.Error("expected identical events to share a key")
+	}
+}
+
+func TestDynamoDBStore_Query_SpansDaysWithFilter(t *testing.T) {
+	client := &mockDynamoDBClient{queryOutputs: map[string][]*dynamodb.QueryOutput{
+		"EVENTLOG#2026-03-04": {{Items: []map[string]types.AttributeValue{logItem(t, "2026-03-04T23:00:00Z", "account.created")}}},
+		"EVENTLOG#2026-03-05": {{Items: []map[string]types.AttributeValue{logItem(t, "2026-03-05T01:00:00Z", "quota.updated")}}},
+	}}
+	store := NewDynamoDBStore(client, "table")
+
+	events, cursor, err := store.Query(context.Background(), Filter{
+		EventTypes: []string{"account.created", "quota.updated"},
+		AccountID:  "user-123",
+		From:       time.Date(2026, 3, 4, 12, 0, 0, 0, time.UTC),
+		To:         time.Date(2026, 3, 5, 12, 0, 0, 0, time.UTC),
+	}, "", 100)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cursor != "" {
+		t.Errorf("expected no cursor, got %q", cursor)
+	}
+	if len(events) != 2 || events[0].EventType != "account.created" || events[1].EventType != "quota.updated" {
+		t.Errorf("expected events from both days in order, got %+v", events)
+	}
+
+	input := client.queryInputs[0]
+	if *input.FilterExpression != "eventType IN (:type0, :type1) AND accountId = :accountId" {
+		t.Errorf("unexpected filter: %s", *input.FilterExpression)
+	}
+	if input.ExpressionAttributeValues[":from"].(*types.AttributeValueMemberS).Value != "2026-03-04T12:00:00Z" {
+		t.Error("expected sort key range to start at from")
+	}
+}
+
+func TestDynamoDBStore_Query_CursorResumesWithinDay(t *testing.T) {
+	lastKey := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: "EVENTLOG#2026-03-04"},
+		"sk": &types.AttributeValueMemberS{Value: "2026-03-04T01:00:00Z#abc"},
+	}
+	client := &mockDynamoDBClient{queryOutputs: map[string][]*dynamodb.QueryOutput{
+		"EVENTLOG#2026-03-04": {
+			{Items: []map[string]types.AttributeValue{logItem(t, "2026-03-04T01:00:00Z", "account.created")}, LastEvaluatedKey: lastKey},
+			{Items: []map[string]types.AttributeValue{logItem(t, "2026-03-04T02:00:00Z", "account.created")}},
+		},
+	}}
+	store := NewDynamoDBStore(client, "table")
+	filter := Filter{From: time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC), To: time.Date(2026, 3, 4, 23, 0, 0, 0, time.UTC)}
+
+	events, cursor, err := store.Query(context.Background(), filter, "", 1)
+	if err != nil || len(events) != 1 || cursor == "" {
+		t.Fatalf("expected one event and a cursor, got %d events, cursor %q, err %v", len(events), cursor, err)
+	}
+
+	events, cursor, err = store.Query(context.Background(), filter, cursor, 1)
+	if err != nil || len(events) != 1 || cursor != "" {
+		t.Fatalf("expected the last event and no cursor, got %d events, cursor %q, err %v", len(events), cursor, err)
+	}
+	if client.queryInputs[1].ExclusiveStartKey["sk"].(*types.AttributeValueMemberS).Value != "2026-03-04T01:00:00Z#abc" {
+		t.Error("expected the second page to resume after the first")
+	}
+}
+
+func TestDynamoDBStore_Query_InvalidCursor(t *testing.T) {
+	store := NewDynamoDBStore(&mockDynamoDBClient{}, "table")
+
+	_, _, err := store.Query(context.Background(), Filter{To: time.Now()}, "not-a-cursor", 10)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("expected ErrInvalidCursor, got %v", err)
+	}
+}
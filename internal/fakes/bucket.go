@@ -0,0 +1,337 @@
+package fakes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// Object is an object in a Bucket
+type Object struct {
+	Body        []byte
+	ContentType string
+	Tags        map[string]string
+	// Checksum is the composite checksum of a multipart upload created with
+	// checksums; other objects' checksums are computed from Body
+	Checksum string
+}
+
+// multipartUpload is an upload started with CreateMultipartUpload
+type multipartUpload struct {
+	key         string
+	contentType string
+	checksums   bool
+	parts       map[int32][]byte
+}
+
+// Bucket is an in-memory stand-in for the blob bucket. Objects are keyed
+// "{accountId}/{blobId}" as in S3. Presigned URLs point at a fake host and
+// cannot be fetched; tests upload to them with PutObject. It is safe for
+// concurrent use.
+type Bucket struct {
+	mu       sync.Mutex
+	objects  map[string]Object
+	uploads  map[string]multipartUpload
+	failures map[string]error
+}
+
+// NewBucket creates an empty bucket
+func NewBucket() *Bucket {
+	return &Bucket{
+		objects:  make(map[string]Object),
+		uploads:  make(map[string]multipartUpload),
+		failures: make(map[string]error),
+	}
+}
+
+// FailOn makes every later call to the named method, such as "Upload",
+// return err. A nil err clears the failure.
+func (b *Bucket) FailOn(method string, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.failures, method)
+		return
+	}
+	b.failures[method] = err
+}
+
+// PutObject stores an object, as a client uploading to a presigned URL would
+func (b *Bucket) PutObject(key string, body []byte, contentType string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.objects[key] = Object{Body: body, ContentType: contentType, Tags: map[string]string{}}
+}
+
+// Object returns an object
+func (b *Bucket) Object(key string) (Object, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	object, ok := b.objects[key]
+	return object, ok
+}
+
+// Upload stores an uploaded blob tagged as pending
+func (b *Bucket) Upload(ctx context.Context, req blobmeta.UploadRequest) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["Upload"]; err != nil {
+		return err
+	}
+	b.objects[req.Key] = Object{Body: req.Body, ContentType: req.ContentType, Tags: objectTags(req.AccountID, StatusPending, req.ParentTag, req.Tags)}
+	return nil
+}
+
+// objectTags returns an object's tags: the approved extra tags, then core's
+// own, which win
+func objectTags(accountID, status, parentTag string, extra map[string]string) map[string]string {
+	tags := make(map[string]string, len(extra)+3)
+	for name, value := range extra {
+		tags[name] = value
+	}
+	tags["Account"] = accountID
+	tags["Status"] = status
+	delete(tags, "Parent")
+	if parentTag != "" {
+		tags["Parent"] = parentTag
+	}
+	return tags
+}
+
+// ConfirmUpload replaces an uploaded blob's tags with confirmed ones
+func (b *Bucket) ConfirmUpload(ctx context.Context, accountID, blobID, parentTag string, extra map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["ConfirmUpload"]; err != nil {
+		return err
+	}
+	return b.setTags(fmt.Sprintf("%s/%s", accountID, blobID), objectTags(accountID, StatusConfirmed, parentTag, extra))
+}
+
+// ConfirmTag replaces an object's tags with confirmed ones
+func (b *Bucket) ConfirmTag(ctx context.Context, key string, extra map[string]string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["ConfirmTag"]; err != nil {
+		return err
+	}
+	accountID, _, _ := strings.Cut(key, "/")
+	return b.setTags(key, objectTags(accountID, StatusConfirmed, "", extra))
+}
+
+// setTags replaces an existing object's tags. Callers hold mu.
+func (b *Bucket) setTags(key string, tags map[string]string) error {
+	object, ok := b.objects[key]
+	if !ok {
+		return fmt.Errorf("NoSuchKey: %s", key)
+	}
+	object.Tags = tags
+	b.objects[key] = object
+	return nil
+}
+
+// DeleteObject deletes an object. Deleting a missing object succeeds, as in S3.
+func (b *Bucket) DeleteObject(ctx context.Context, key string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["DeleteObject"]; err != nil {
+		return err
+	}
+	delete(b.objects, key)
+	return nil
+}
+
+// Checksum returns an object's SHA-256 checksum
+func (b *Bucket) Checksum(ctx context.Context, key string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["Checksum"]; err != nil {
+		return "", err
+	}
+	object, ok := b.objects[key]
+	if !ok {
+		return "", fmt.Errorf("NoSuchKey: %s", key)
+	}
+	if object.Checksum != "" {
+		return object.Checksum, nil
+	}
+	return blobchecksum.Sum(bytes.NewReader(object.Body))
+}
+
+// ReadHead returns up to the first n bytes of an object
+func (b *Bucket) ReadHead(ctx context.Context, key string, n int64) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["ReadHead"]; err != nil {
+		return nil, err
+	}
+	object, ok := b.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("NoSuchKey: %s", key)
+	}
+	body := object.Body
+	if int64(len(body)) > n {
+		body = body[:n]
+	}
+	return append([]byte(nil), body...), nil
+}
+
+// GeneratePresignedPutURL returns a fake URL for the blob's key, carrying
+// any checksum as a signed URL would
+func (b *Bucket) GeneratePresignedPutURL(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpirySecs int64, sizeUnknown bool, checksum string) (string, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["GeneratePresignedPutURL"]; err != nil {
+		return "", time.Time{}, err
+	}
+	var query url.Values
+	if checksum != "" {
+		query = url.Values{"x-amz-checksum-sha256": {checksum}}
+	}
+	return presignedURL(fmt.Sprintf("%s/%s", accountID, blobID), query), expiry(urlExpirySecs), nil
+}
+
+// CreateMultipartUpload starts a multipart upload for the blob's key
+func (b *Bucket) CreateMultipartUpload(ctx context.Context, accountID, blobID, contentType string, checksums bool) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["CreateMultipartUpload"]; err != nil {
+		return "", err
+	}
+	uploadID := uuid.NewString()
+	b.uploads[uploadID] = multipartUpload{key: fmt.Sprintf("%s/%s", accountID, blobID), contentType: contentType, checksums: checksums, parts: map[int32][]byte{}}
+	return uploadID, nil
+}
+
+// GeneratePresignedPartURLs returns fake URLs for partCount parts of a
+// multipart upload
+func (b *Bucket) GeneratePresignedPartURLs(ctx context.Context, accountID, blobID, uploadID string, partCount int, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	partNumbers := make([]int32, partCount)
+	for i := range partNumbers {
+		partNumbers[i] = int32(i + 1)
+	}
+	return b.presignParts("GeneratePresignedPartURLs", accountID, blobID, uploadID, partNumbers, urlExpirySecs)
+}
+
+// GeneratePresignedPartURLsFor returns fake URLs for the given parts of a
+// multipart upload
+func (b *Bucket) GeneratePresignedPartURLsFor(ctx context.Context, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	return b.presignParts("GeneratePresignedPartURLsFor", accountID, blobID, uploadID, partNumbers, urlExpirySecs)
+}
+
+// presignParts returns fake part URLs, failing as FailOn(method) requested
+func (b *Bucket) presignParts(method, accountID, blobID, uploadID string, partNumbers []int32, urlExpirySecs int64) ([]bloballocate.PartURL, time.Time, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures[method]; err != nil {
+		return nil, time.Time{}, err
+	}
+	key := fmt.Sprintf("%s/%s", accountID, blobID)
+	parts := make([]bloballocate.PartURL, len(partNumbers))
+	for i, partNumber := range partNumbers {
+		parts[i] = bloballocate.PartURL{
+			PartNumber: partNumber,
+			URL: presignedURL(key, url.Values{
+				"partNumber": {fmt.Sprint(partNumber)},
+				"uploadId":   {uploadID},
+			}),
+		}
+	}
+	return parts, expiry(urlExpirySecs), nil
+}
+
+// CompleteMultipartUpload completes a multipart upload, storing an empty
+// object at its key. For an upload created with checksums, each part's
+// checksum is required and checked against any content stored with PutPart,
+// and the object takes the parts' composite checksum.
+func (b *Bucket) CompleteMultipartUpload(ctx context.Context, accountID, blobID, uploadID string, parts []bloballocate.CompletedPart) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["CompleteMultipartUpload"]; err != nil {
+		return err
+	}
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != fmt.Sprintf("%s/%s", accountID, blobID) {
+		return fmt.Errorf("NoSuchUpload: %s", uploadID)
+	}
+	if len(parts) == 0 {
+		return fmt.Errorf("MalformedXML: no parts")
+	}
+	object := Object{ContentType: upload.contentType, Tags: map[string]string{}}
+	if upload.checksums {
+		checksums := make([]string, len(parts))
+		for i, part := range parts {
+			if part.ChecksumSHA256 == "" {
+				return fmt.Errorf("InvalidRequest: missing checksum for part %d", part.PartNumber)
+			}
+			if body, ok := upload.parts[part.PartNumber]; ok {
+				if sum, _ := blobchecksum.Sum(bytes.NewReader(body)); sum != part.ChecksumSHA256 {
+					return fmt.Errorf("BadDigest: part %d", part.PartNumber)
+				}
+			}
+			checksums[i] = part.ChecksumSHA256
+		}
+		composite, err := blobchecksum.Composite(checksums)
+		if err != nil {
+			return fmt.Errorf("InvalidRequest: %w", err)
+		}
+		object.Checksum = composite
+	}
+	delete(b.uploads, uploadID)
+	b.objects[upload.key] = object
+	return nil
+}
+
+// PutPart stores a part of a multipart upload, as a client uploading to a
+// presigned part URL would. The part's ETag is "etag-{partNumber}".
+func (b *Bucket) PutPart(uploadID string, partNumber int32, body []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	upload, ok := b.uploads[uploadID]
+	if !ok {
+		return fmt.Errorf("NoSuchUpload: %s", uploadID)
+	}
+	upload.parts[partNumber] = body
+	return nil
+}
+
+// ListParts returns the parts stored for a multipart upload, in part number
+// order
+func (b *Bucket) ListParts(ctx context.Context, accountID, blobID, uploadID string) ([]bloballocate.UploadedPart, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := b.failures["ListParts"]; err != nil {
+		return nil, err
+	}
+	upload, ok := b.uploads[uploadID]
+	if !ok || upload.key != fmt.Sprintf("%s/%s", accountID, blobID) {
+		return nil, fmt.Errorf("NoSuchUpload: %s", uploadID)
+	}
+	parts := make([]bloballocate.UploadedPart, 0, len(upload.parts))
+	for partNumber, body := range upload.parts {
+		parts = append(parts, bloballocate.UploadedPart{PartNumber: partNumber, ETag: fmt.Sprintf("etag-%d", partNumber), Size: int64(len(body))})
+	}
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+	return parts, nil
+}
+
+// presignedURL returns a URL on the fake bucket's host
+func presignedURL(key string, query url.Values) string {
+	u := url.URL{Scheme: "https", Host: "fake-bucket.s3.localhost", Path: "/" + key, RawQuery: query.Encode()}
+	return u.String()
+}
+
+// expiry returns when a URL signed now for expirySecs expires
+func expiry(expirySecs int64) time.Time {
+	return time.Now().Add(time.Duration(expirySecs) * time.Second)
+}
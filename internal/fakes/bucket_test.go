@@ -0,0 +1,185 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobchecksum"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcomplete"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobreallocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstatus"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstore"
+)
+
+var (
+	_ bloballocate.Storage          = (*Bucket)(nil)
+	_ bloballocate.MultipartStorage = (*Bucket)(nil)
+	_ blobcomplete.Storage          = (*Bucket)(nil)
+	_ blobreallocate.Storage        = (*Bucket)(nil)
+	_ blobstatus.Storage            = (*Bucket)(nil)
+	_ blobstore.BlobStore           = (*Bucket)(nil)
+)
+
+func TestUpload_ThenConfirm(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewBucket()
+
+	if err := bucket.Upload(ctx, blobmeta.UploadRequest{Key: "user-1/blob-1", Body: []byte("hi"), ContentType: "text/plain", AccountID: "user-1", ParentTag: "email"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	object, _ := bucket.Object("user-1/blob-1")
+	if object.Tags["Status"] != StatusPending || object.Tags["Parent"] != "email" || string(object.Body) != "hi" {
+		t.Errorf("unexpected object after upload: %+v", object)
+	}
+
+	if err := bucket.ConfirmUpload(ctx, "user-1", "blob-1", "email", map[string]string{"Source": "import"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	object, _ = bucket.Object("user-1/blob-1")
+	if object.Tags["Status"] != StatusConfirmed || object.Tags["Account"] != "user-1" || object.Tags["Source"] != "import" {
+		t.Errorf("unexpected tags after confirm: %v", object.Tags)
+	}
+}
+
+func TestConfirmTag_MissingObject(t *testing.T) {
+	if err := NewBucket().ConfirmTag(context.Background(), "user-1/blob-1", nil); err == nil {
+		t.Error("expected error for missing object")
+	}
+}
+
+func TestConfirmTag_DeleteObject(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewBucket()
+	bucket.PutObject("user-1/blob-1", []byte("hi"), "text/plain")
+
+	if err := bucket.ConfirmTag(ctx, "user-1/blob-1", nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if object, _ := bucket.Object("user-1/blob-1"); object.Tags["Status"] != StatusConfirmed || object.Tags["Account"] != "user-1" {
+		t.Errorf("unexpected tags: %v", object.Tags)
+	}
+
+	for range 2 {
+		if err := bucket.DeleteObject(ctx, "user-1/blob-1"); err != nil {
+			t.Fatalf("expected delete to be idempotent, got %v", err)
+		}
+	}
+	if _, ok := bucket.Object("user-1/blob-1"); ok {
+		t.Error("expected object to be deleted")
+	}
+}
+
+func TestPresignedPutURL(t *testing.T) {
+	url, expires, err := NewBucket().GeneratePresignedPutURL(context.Background(), "user-1", "blob-1", 10, "text/plain", 900, false, "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasSuffix(url, "/user-1/blob-1") || expires.IsZero() {
+		t.Errorf("unexpected URL %q expiring %v", url, expires)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewBucket()
+
+	uploadID, err := bucket.CreateMultipartUpload(ctx, "user-1", "blob-1", "message/rfc822", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	parts, _, err := bucket.GeneratePresignedPartURLs(ctx, "user-1", "blob-1", uploadID, 3, 900)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(parts) != 3 || parts[2].PartNumber != 3 || !strings.Contains(parts[2].URL, "uploadId="+uploadID) {
+		t.Errorf("unexpected parts %+v", parts)
+	}
+
+	if err := bucket.PutPart(uploadID, 2, []byte("second")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := bucket.PutPart(uploadID, 1, []byte("first!!")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	uploaded, err := bucket.ListParts(ctx, "user-1", "blob-1", uploadID)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(uploaded) != 2 || uploaded[0].PartNumber != 1 || uploaded[0].Size != 7 || uploaded[1].ETag != "etag-2" {
+		t.Errorf("unexpected uploaded parts %+v", uploaded)
+	}
+
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-2", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a"}}); err == nil {
+		t.Error("expected error completing upload for another blob")
+	}
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-1", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a"}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if object, ok := bucket.Object("user-1/blob-1"); !ok || object.ContentType != "message/rfc822" {
+		t.Errorf("expected completed object, got %+v, %v", object, ok)
+	}
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-1", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a"}}); err == nil {
+		t.Error("expected error completing upload twice")
+	}
+}
+
+func TestMultipartUpload_Checksums(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewBucket()
+	first, _ := blobchecksum.Sum(strings.NewReader("first"))
+	second, _ := blobchecksum.Sum(strings.NewReader("second"))
+
+	uploadID, err := bucket.CreateMultipartUpload(ctx, "user-1", "blob-1", "message/rfc822", true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = bucket.PutPart(uploadID, 1, []byte("first"))
+	_ = bucket.PutPart(uploadID, 2, []byte("second"))
+
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-1", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a", ChecksumSHA256: first}, {PartNumber: 2, ETag: "b"}}); err == nil {
+		t.Error("expected error completing without a part's checksum")
+	}
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-1", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a", ChecksumSHA256: second}, {PartNumber: 2, ETag: "b", ChecksumSHA256: second}}); err == nil || !strings.Contains(err.Error(), "BadDigest") {
+		t.Errorf("expected BadDigest for a part that does not match, got %v", err)
+	}
+	if err := bucket.CompleteMultipartUpload(ctx, "user-1", "blob-1", uploadID, []bloballocate.CompletedPart{{PartNumber: 1, ETag: "a", ChecksumSHA256: first}, {PartNumber: 2, ETag: "b", ChecksumSHA256: second}}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := blobchecksum.Composite([]string{first, second})
+	if checksum, err := bucket.Checksum(ctx, "user-1/blob-1"); err != nil || checksum != want {
+		t.Errorf("expected composite checksum %s, got %s, %v", want, checksum, err)
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	ctx := context.Background()
+	bucket := NewBucket()
+	bucket.PutObject("user-1/blob-1", []byte("hello"), "text/plain")
+
+	want, _ := blobchecksum.Sum(strings.NewReader("hello"))
+	if checksum, err := bucket.Checksum(ctx, "user-1/blob-1"); err != nil || checksum != want {
+		t.Errorf("expected %s, got %s, %v", want, checksum, err)
+	}
+	if _, err := bucket.Checksum(ctx, "user-1/missing"); err == nil {
+		t.Error("expected error for a missing object")
+	}
+
+	url, _, _ := bucket.GeneratePresignedPutURL(ctx, "user-1", "blob-2", 5, "text/plain", 900, false, want)
+	if !strings.Contains(url, "x-amz-checksum-sha256=") {
+		t.Errorf("expected the checksum in the URL, got %q", url)
+	}
+}
+
+func TestBucketFailOn(t *testing.T) {
+	bucket := NewBucket()
+	boom := errors.New("s3 down")
+	bucket.FailOn("DeleteObject", boom)
+
+	if err := bucket.DeleteObject(context.Background(), "user-1/blob-1"); !errors.Is(err, boom) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+}
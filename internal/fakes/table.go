@@ -0,0 +1,669 @@
+// Package fakes provides in-memory implementations of the core's storage
+// interfaces for handler and plugin integration tests. Table stands in for
+// the DynamoDB table, keeping account quota and pending allocation counts
+// consistent across blob operations as the real transactions do, and Bucket
+// stands in for the blob bucket.
+//
+// Each Lambda declares its own storage interfaces; the fakes satisfy them
+// without per-package mocks:
+//
+//	deps := &Dependencies{DB: fakes.NewTable(), Storage: fakes.NewBucket()}
+package fakes
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcomplete"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobreallocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstatus"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+// Blob statuses, as stored in the status attribute
+const (
+	StatusPending   = store.StatusPending
+	StatusConfirmed = store.StatusConfirmed
+)
+
+// ErrNotPending is returned when a conditional write expects a pending blob.
+// It is the store's error, so callers can test for either with errors.Is.
+var ErrNotPending = store.ErrNotPending
+
+// ErrAlreadyDeleted is returned when a blob to mark deleted is already
+// marked or gone
+var ErrAlreadyDeleted = store.ErrAlreadyDeleted
+
+// ErrBlobNotFound is returned when a scan verdict is recorded for a blob
+// with no record, or one marked deleted
+var ErrBlobNotFound = store.ErrBlobNotFound
+
+// ErrOverQuota and ErrAccountNotProvisioned are returned when a direct
+// upload cannot be reserved
+var (
+	ErrOverQuota             = store.ErrOverQuota
+	ErrAccountNotProvisioned = store.ErrAccountNotProvisioned
+)
+
+// Blob is a blob record with the allocation attributes kept alongside it
+type Blob struct {
+	blobmeta.Record
+	Status       string // StatusPending, StatusConfirmed, or empty for direct uploads
+	SizeUnknown  bool
+	IAMAuth      bool
+	Multipart    bool
+	UploadID     string
+	URLExpiresAt time.Time
+	ConfirmedAt  string
+	// DeclaredChecksum is the SHA-256 checksum declared at allocation
+	DeclaredChecksum string
+	// MaxSize is the size limit for an upload of unknown size
+	MaxSize int64
+}
+
+type blobKey struct {
+	accountID string
+	blobID    string
+}
+
+// Table is an in-memory stand-in for the core's DynamoDB table. It holds
+// account META# records, blob records, plugin records and the events written
+// to the outbox. It is safe for concurrent use.
+type Table struct {
+	mu       sync.Mutex
+	accounts map[string]account.Meta
+	blobs    map[blobKey]Blob
+	plugins  []plugin.PluginRecord
+	events   []publisher.EventPayload
+	failures map[string]error
+	scan     bool
+}
+
+// NewTable creates an empty table
+func NewTable() *Table {
+	return &Table{
+		accounts: make(map[string]account.Meta),
+		blobs:    make(map[blobKey]Blob),
+		failures: make(map[string]error),
+	}
+}
+
+// WithScanRequests marks blobs pending a scan as they are confirmed and
+// writes a blob.scan.requested event for each, as the store does with scan
+// requests enabled
+func (t *Table) WithScanRequests() *Table {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.scan = true
+	return t
+}
+
+// FailOn makes every later call to the named method, such as "GetBlob",
+// return err. A nil err clears the failure.
+func (t *Table) FailOn(method string, err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err == nil {
+		delete(t.failures, method)
+		return
+	}
+	t.failures[method] = err
+}
+
+// failure returns the injected error for method. Callers hold mu.
+func (t *Table) failure(method string) error {
+	return t.failures[method]
+}
+
+// PutAccount stores an account's META# record, replacing any existing one
+func (t *Table) PutAccount(meta account.Meta) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.accounts[meta.AccountID] = meta
+}
+
+// Account returns an account's META# record
+func (t *Table) Account(accountID string) (account.Meta, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	meta, ok := t.accounts[accountID]
+	return meta, ok
+}
+
+// PutBlob stores a blob record, replacing any existing one
+func (t *Table) PutBlob(blob Blob) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.blobs[blobKey{blob.AccountID, blob.BlobID}] = blob
+}
+
+// Blob returns a blob record
+func (t *Table) Blob(accountID, blobID string) (Blob, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	return blob, ok
+}
+
+// Events returns the events written to the outbox, oldest first
+func (t *Table) Events() []publisher.EventPayload {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]publisher.EventPayload(nil), t.events...)
+}
+
+// GetMeta returns an account's META# record, or nil if the account has none
+func (t *Table) GetMeta(ctx context.Context, accountID string) (*account.Meta, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetMeta"); err != nil {
+		return nil, err
+	}
+	meta, ok := t.accounts[accountID]
+	if !ok {
+		return nil, nil
+	}
+	return &meta, nil
+}
+
+// CreateAccountMeta creates an account's META# record from preset and writes
+// event to the outbox. An existing record is left unchanged, without writing
+// the event.
+func (t *Table) CreateAccountMeta(ctx context.Context, accountID, tier string, preset account.Tier, event publisher.EventPayload) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("CreateAccountMeta"); err != nil {
+		return err
+	}
+	if _, ok := t.accounts[accountID]; ok {
+		return nil
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	t.accounts[accountID] = account.Meta{
+		AccountID:             accountID,
+		AccountType:           account.DefaultAccountType,
+		Tier:                  tier,
+		QuotaBytes:            preset.QuotaBytes,
+		QuotaRemaining:        preset.QuotaBytes,
+		MaxPendingAllocations: preset.MaxPendingAllocations,
+		CreatedAt:             now,
+		UpdatedAt:             now,
+	}
+	t.events = append(t.events, event)
+	return nil
+}
+
+// ReserveBlob stores a pending record for a direct upload and deducts its
+// size from the account's quota. Like the real store it marks the record
+// iamAuth, and returns ErrAccountNotProvisioned or ErrOverQuota.
+func (t *Table) ReserveBlob(ctx context.Context, record blobmeta.Record, expiresAt time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("ReserveBlob"); err != nil {
+		return err
+	}
+	meta, ok := t.accounts[record.AccountID]
+	if !ok {
+		return ErrAccountNotProvisioned
+	}
+	if meta.QuotaRemaining < record.Size {
+		return ErrOverQuota
+	}
+	key := blobKey{record.AccountID, record.BlobID}
+	if _, exists := t.blobs[key]; exists {
+		return fmt.Errorf("blob record already exists")
+	}
+
+	meta.QuotaRemaining -= record.Size
+	meta.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	t.accounts[record.AccountID] = meta
+	t.blobs[key] = Blob{Record: record, Status: StatusPending, IAMAuth: true, URLExpiresAt: expiresAt}
+	return nil
+}
+
+// GetBlob returns a blob record, or nil if there is none
+func (t *Table) GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlob"); err != nil {
+		return nil, err
+	}
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	if !ok {
+		return nil, nil
+	}
+	return &blob.Record, nil
+}
+
+// GetBlobs returns the records of an account's blobs by blob ID, leaving out
+// blobs with no record
+func (t *Table) GetBlobs(ctx context.Context, accountID string, blobIDs []string) (map[string]*blobmeta.Record, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlobs"); err != nil {
+		return nil, err
+	}
+	records := make(map[string]*blobmeta.Record, len(blobIDs))
+	for _, blobID := range blobIDs {
+		if blob, ok := t.blobs[blobKey{accountID, blobID}]; ok {
+			records[blobID] = &blob.Record
+		}
+	}
+	return records, nil
+}
+
+// MarkBlobDeleted sets a blob record's deletedAt, returning ErrAlreadyDeleted
+// if there is no record or it is already marked
+func (t *Table) MarkBlobDeleted(ctx context.Context, accountID, blobID string, deletedAt string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("MarkBlobDeleted"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.DeletedAt != "" {
+		return ErrAlreadyDeleted
+	}
+	blob.DeletedAt = deletedAt
+	t.blobs[key] = blob
+	return nil
+}
+
+// AllocateBlob creates a pending blob record, counting it against the
+// account's pending allocations (unless isIAMAuth) and deducting size from
+// its quota (unless sizeUnknown). It returns the same AllocationErrors as
+// bloballocate.DynamoDBStore.
+func (t *Table) AllocateBlob(ctx context.Context, accountID, blobID string, size int64, contentType string, urlExpiresAt time.Time, maxPending int, s3Key string, sizeUnknown bool, uploadID string, isIAMAuth bool, name string, tags map[string]string, indexed *blobmeta.IndexedMetadata, checksum string, maxSize int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("AllocateBlob"); err != nil {
+		return err
+	}
+
+	meta, ok := t.accounts[accountID]
+	if !ok {
+		return &bloballocate.AllocationError{Type: "accountNotProvisioned", Message: "Account is not provisioned"}
+	}
+	if meta.Suspended {
+		return &bloballocate.AllocationError{Type: "forbidden", Message: "Account is suspended"}
+	}
+	if meta.WritesDisabled {
+		return &bloballocate.AllocationError{Type: "accountReadOnly", Message: "Account is read-only"}
+	}
+	if meta.MaxPendingAllocations > 0 {
+		maxPending = meta.MaxPendingAllocations
+	}
+	if !isIAMAuth && meta.PendingAllocationsCount >= maxPending {
+		return &bloballocate.AllocationError{
+			Type:    "tooManyPending",
+			Message: fmt.Sprintf("Too many pending allocations (%d/%d)", meta.PendingAllocationsCount, maxPending),
+		}
+	}
+	if !sizeUnknown && meta.QuotaRemaining < size {
+		return &bloballocate.AllocationError{
+			Type:    "overQuota",
+			Message: fmt.Sprintf("Insufficient quota remaining (%d bytes needed, %d available)", size, meta.QuotaRemaining),
+		}
+	}
+	key := blobKey{accountID, blobID}
+	if _, exists := t.blobs[key]; exists {
+		return fmt.Errorf("blob record already exists")
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	if !isIAMAuth {
+		meta.PendingAllocationsCount++
+	}
+	if !sizeUnknown {
+		meta.QuotaRemaining -= size
+	}
+	meta.UpdatedAt = now
+	t.accounts[accountID] = meta
+
+	t.blobs[key] = Blob{
+		Record: blobmeta.Record{
+			BlobID:      blobID,
+			AccountID:   accountID,
+			Size:        size,
+			ContentType: contentType,
+			S3Key:       s3Key,
+			CreatedAt:   now,
+			Name:        name,
+			Tags:        tags,
+
+			IndexedMetadata: indexed,
+		},
+		Status:           StatusPending,
+		SizeUnknown:      sizeUnknown,
+		IAMAuth:          isIAMAuth,
+		Multipart:        uploadID != "",
+		UploadID:         uploadID,
+		URLExpiresAt:     urlExpiresAt,
+		DeclaredChecksum: checksum,
+		MaxSize:          maxSize,
+	}
+	return nil
+}
+
+// GetBlobForComplete returns the attributes Blob/complete needs, or nil if
+// there is no blob record
+func (t *Table) GetBlobForComplete(ctx context.Context, accountID, blobID string) (*blobcomplete.BlobRecord, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlobForComplete"); err != nil {
+		return nil, err
+	}
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	if !ok {
+		return nil, nil
+	}
+	return &blobcomplete.BlobRecord{Status: blob.Status, Multipart: blob.Multipart, UploadID: blob.UploadID, Checksum: blob.DeclaredChecksum, MaxSize: blob.MaxSize}, nil
+}
+
+// GetBlobForStatus returns the attributes Blob/allocationStatus needs, or
+// nil if there is no blob record
+func (t *Table) GetBlobForStatus(ctx context.Context, accountID, blobID string) (*blobstatus.BlobRecord, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlobForStatus"); err != nil {
+		return nil, err
+	}
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	if !ok {
+		return nil, nil
+	}
+	return &blobstatus.BlobRecord{
+		Status:       blob.Status,
+		Size:         blob.Size,
+		SizeUnknown:  blob.SizeUnknown,
+		Multipart:    blob.Multipart,
+		UploadID:     blob.UploadID,
+		URLExpiresAt: blob.URLExpiresAt,
+		Deleted:      blob.DeletedAt != "",
+	}, nil
+}
+
+// GetBlobForReallocate returns the attributes Blob/reallocateParts needs,
+// or nil if there is no blob record
+func (t *Table) GetBlobForReallocate(ctx context.Context, accountID, blobID string) (*blobreallocate.BlobRecord, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlobForReallocate"); err != nil {
+		return nil, err
+	}
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	if !ok {
+		return nil, nil
+	}
+	return &blobreallocate.BlobRecord{
+		Status:       blob.Status,
+		Multipart:    blob.Multipart,
+		UploadID:     blob.UploadID,
+		URLExpiresAt: blob.URLExpiresAt,
+		Deleted:      blob.DeletedAt != "",
+	}, nil
+}
+
+// ExtendAllocation moves a pending allocation's expiry, returning
+// ErrNotPending if it is no longer pending under uploadID
+func (t *Table) ExtendAllocation(ctx context.Context, accountID, blobID, uploadID string, urlExpiresAt time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("ExtendAllocation"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.Status != StatusPending || blob.UploadID != uploadID || blob.DeletedAt != "" {
+		return ErrNotPending
+	}
+	blob.URLExpiresAt = urlExpiresAt
+	t.blobs[key] = blob
+	return nil
+}
+
+// GetBlobInfo returns the attributes blob-confirm needs, or nil if there is
+// no blob record
+func (t *Table) GetBlobInfo(ctx context.Context, accountID, blobID string) (*blobmeta.Info, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetBlobInfo"); err != nil {
+		return nil, err
+	}
+	blob, ok := t.blobs[blobKey{accountID, blobID}]
+	if !ok {
+		return nil, nil
+	}
+	return &blobmeta.Info{Status: blob.Status, SizeUnknown: blob.SizeUnknown, IAMAuth: blob.IAMAuth, ContentType: blob.ContentType, Tags: blob.Tags, Checksum: blob.DeclaredChecksum, MaxSize: blob.MaxSize}, nil
+}
+
+// ConfirmBlob confirms a pending blob, releasing its pending allocation
+// (unless iamAuth) and, when sizeUnknown, recording actualSize and deducting
+// it from quota. Confirming a blob that is not pending does nothing, as the
+// real store treats it as already confirmed.
+func (t *Table) ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("ConfirmBlob"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.Status != StatusPending {
+		return nil
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	blob.Status = StatusConfirmed
+	blob.ConfirmedAt = now
+	if sizeUnknown {
+		blob.Size = actualSize
+		blob.SizeUnknown = false
+	}
+	t.blobs[key] = blob
+
+	meta := t.accounts[accountID]
+	meta.AccountID = accountID
+	if !iamAuth {
+		meta.PendingAllocationsCount--
+	}
+	if sizeUnknown {
+		meta.QuotaRemaining -= actualSize
+	}
+	meta.UpdatedAt = now
+	t.accounts[accountID] = meta
+
+	if t.scan {
+		blob.ScanStatus = store.ScanPending
+		t.blobs[key] = blob
+		t.events = append(t.events, publisher.EventPayload{
+			EventType:  publisher.EventBlobScanRequested,
+			OccurredAt: now,
+			AccountID:  accountID,
+			Data:       map[string]any{"blobId": blobID, "size": actualSize},
+		})
+	}
+	return nil
+}
+
+// SetScanStatus records a scan verdict on a live blob, returning
+// ErrBlobNotFound if there is none
+func (t *Table) SetScanStatus(ctx context.Context, accountID, blobID, status string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("SetScanStatus"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.DeletedAt != "" {
+		return ErrBlobNotFound
+	}
+	blob.ScanStatus = status
+	t.blobs[key] = blob
+	return nil
+}
+
+// RecordSniffedType records a pending blob's declared and detected types,
+// flagging a mismatch and, when correct, replacing its content type. A blob
+// that is not pending is left alone.
+func (t *Table) RecordSniffedType(ctx context.Context, accountID, blobID string, result sniff.Result, correct bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("RecordSniffedType"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.Status != StatusPending {
+		return nil
+	}
+	blob.DeclaredType = result.Declared
+	blob.DetectedType = result.Detected
+	if result.Mismatch {
+		blob.TypeMismatch = true
+		if correct {
+			blob.ContentType = result.Detected
+		}
+	}
+	t.blobs[key] = blob
+	return nil
+}
+
+// RecordChecksum records the verified checksum of a pending blob. A blob
+// that is not pending is left alone.
+func (t *Table) RecordChecksum(ctx context.Context, accountID, blobID, checksum string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("RecordChecksum"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	blob, ok := t.blobs[key]
+	if !ok || blob.Status != StatusPending {
+		return nil
+	}
+	blob.ChecksumSHA256 = checksum
+	t.blobs[key] = blob
+	return nil
+}
+
+// GetExpiredPendingAllocations returns the pending blobs whose upload URLs
+// expired before cutoff, oldest first
+func (t *Table) GetExpiredPendingAllocations(ctx context.Context, cutoff time.Time) ([]blobmeta.PendingAllocation, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("GetExpiredPendingAllocations"); err != nil {
+		return nil, err
+	}
+
+	var expired []Blob
+	for _, blob := range t.blobs {
+		if blob.Status == StatusPending && blob.URLExpiresAt.Before(cutoff) {
+			expired = append(expired, blob)
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		return expired[i].URLExpiresAt.Before(expired[j].URLExpiresAt)
+	})
+
+	allocations := make([]blobmeta.PendingAllocation, 0, len(expired))
+	for _, blob := range expired {
+		allocations = append(allocations, blobmeta.PendingAllocation{
+			AccountID: blob.AccountID,
+			BlobID:    blob.BlobID,
+			S3Key:     blob.S3Key,
+			Size:      blob.Size,
+			IAMAuth:   blob.IAMAuth,
+		})
+	}
+	return allocations, nil
+}
+
+// CleanupAllocation deletes a pending blob record, restoring size to the
+// account's quota and releasing its pending allocation (unless iamAuth). It
+// returns ErrNotPending if the blob is no longer pending.
+func (t *Table) CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("CleanupAllocation"); err != nil {
+		return err
+	}
+	key := blobKey{accountID, blobID}
+	if blob, ok := t.blobs[key]; !ok || blob.Status != StatusPending {
+		return ErrNotPending
+	}
+	delete(t.blobs, key)
+
+	meta := t.accounts[accountID]
+	meta.AccountID = accountID
+	if !iamAuth {
+		meta.PendingAllocationsCount--
+	}
+	meta.QuotaRemaining += size
+	meta.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+	t.accounts[accountID] = meta
+	return nil
+}
+
+// PutPlugin stores a plugin record, replacing any with the same plugin ID
+func (t *Table) PutPlugin(record plugin.PluginRecord) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if record.PK == "" {
+		record.PK = plugin.PluginPrefix
+	}
+	if record.SK == "" {
+		record.SK = plugin.PluginPrefix + record.PluginID
+	}
+	for i, existing := range t.plugins {
+		if existing.PluginID == record.PluginID {
+			t.plugins[i] = record
+			return
+		}
+	}
+	t.plugins = append(t.plugins, record)
+}
+
+// QueryByPK returns the plugin records when pk is plugin.PluginPrefix, and
+// no items otherwise
+func (t *Table) QueryByPK(ctx context.Context, pk string) ([]map[string]types.AttributeValue, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.failure("QueryByPK"); err != nil {
+		return nil, err
+	}
+	if pk != plugin.PluginPrefix {
+		return nil, nil
+	}
+	items := make([]map[string]types.AttributeValue, 0, len(t.plugins))
+	for _, record := range t.plugins {
+		item, err := attributevalue.MarshalMap(record)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// Registry loads a plugin registry from the table's plugin records
+func (t *Table) Registry(ctx context.Context) (*plugin.Registry, error) {
+	registry := plugin.NewRegistry()
+	if err := registry.LoadFromDynamoDB(ctx, t); err != nil {
+		return nil, err
+	}
+	return registry, nil
+}
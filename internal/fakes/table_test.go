@@ -0,0 +1,387 @@
+package fakes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/bloballocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcomplete"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobreallocate"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobstatus"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/store"
+)
+
+var (
+	_ bloballocate.DB      = (*Table)(nil)
+	_ blobcomplete.DB      = (*Table)(nil)
+	_ blobreallocate.DB    = (*Table)(nil)
+	_ blobstatus.DB        = (*Table)(nil)
+	_ plugin.PluginQuerier = (*Table)(nil)
+)
+
+// newAccountTable returns a table with one account with quota and a pending
+// allocation limit
+func newAccountTable(quota int64, maxPending int) *Table {
+	table := NewTable()
+	table.PutAccount(account.Meta{AccountID: "user-1", QuotaBytes: quota, QuotaRemaining: quota, MaxPendingAllocations: maxPending})
+	return table
+}
+
+// allocationErrorType returns the JMAP error type of an AllocationError
+func allocationErrorType(err error) string {
+	var allocErr *bloballocate.AllocationError
+	if errors.As(err, &allocErr) {
+		return allocErr.Type
+	}
+	return ""
+}
+
+func TestCreateAccountMeta_CreatesOnceAndWritesEvent(t *testing.T) {
+	ctx := context.Background()
+	table := NewTable()
+	preset := account.Tier{QuotaBytes: 1000, MaxPendingAllocations: 5}
+
+	if err := table.CreateAccountMeta(ctx, "user-1", "free", preset, publisher.EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := table.CreateAccountMeta(ctx, "user-1", "pro", account.Tier{QuotaBytes: 5000}, publisher.EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("unexpected error on repeat: %v", err)
+	}
+
+	meta, err := table.GetMeta(ctx, "user-1")
+	if err != nil || meta == nil {
+		t.Fatalf("expected account, got %v, %v", meta, err)
+	}
+	if meta.Tier != "free" || meta.QuotaRemaining != 1000 || meta.MaxPendingAllocations != 5 {
+		t.Errorf("expected first preset to be kept, got %+v", meta)
+	}
+	if events := table.Events(); len(events) != 1 {
+		t.Errorf("expected one event, got %d", len(events))
+	}
+}
+
+func TestGetMeta_NotFound(t *testing.T) {
+	meta, err := NewTable().GetMeta(context.Background(), "user-1")
+	if meta != nil || err != nil {
+		t.Errorf("expected nil, nil; got %v, %v", meta, err)
+	}
+}
+
+func TestAllocateConfirm_TracksQuotaAndPending(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+
+	if err := table.AllocateBlob(ctx, "user-1", "blob-1", 300, "text/plain", time.Now().Add(time.Hour), 2, "user-1/blob-1", false, "", false, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	meta, _ := table.Account("user-1")
+	if meta.QuotaRemaining != 700 || meta.PendingAllocationsCount != 1 {
+		t.Errorf("expected quota 700 and 1 pending after allocate, got %+v", meta)
+	}
+
+	info, err := table.GetBlobInfo(ctx, "user-1", "blob-1")
+	if err != nil || info == nil || info.Status != StatusPending {
+		t.Fatalf("expected pending blob info, got %+v, %v", info, err)
+	}
+
+	if err := table.ConfirmBlob(ctx, "user-1", "blob-1", 300, false, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := table.ConfirmBlob(ctx, "user-1", "blob-1", 300, false, false); err != nil {
+		t.Fatalf("expected repeat confirm to succeed, got %v", err)
+	}
+	meta, _ = table.Account("user-1")
+	if meta.QuotaRemaining != 700 || meta.PendingAllocationsCount != 0 {
+		t.Errorf("expected quota 700 and none pending after confirm, got %+v", meta)
+	}
+	blob, _ := table.Blob("user-1", "blob-1")
+	if blob.Status != StatusConfirmed {
+		t.Errorf("expected confirmed blob, got %q", blob.Status)
+	}
+}
+
+func TestConfirmBlob_SizeUnknownDeductsActualSize(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+
+	if err := table.AllocateBlob(ctx, "user-1", "blob-1", 0, "text/plain", time.Now().Add(time.Hour), 2, "user-1/blob-1", true, "upload-1", true, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := table.ConfirmBlob(ctx, "user-1", "blob-1", 400, true, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	meta, _ := table.Account("user-1")
+	if meta.QuotaRemaining != 600 || meta.PendingAllocationsCount != 0 {
+		t.Errorf("expected quota 600 and none pending, got %+v", meta)
+	}
+	record, _ := table.GetBlob(ctx, "user-1", "blob-1")
+	if record.Size != 400 {
+		t.Errorf("expected actual size recorded, got %d", record.Size)
+	}
+}
+
+func TestConfirmBlob_WithScanRequests(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0).WithScanRequests()
+
+	if err := table.AllocateBlob(ctx, "user-1", "blob-1", 100, "text/plain", time.Now().Add(time.Hour), 2, "user-1/blob-1", false, "", true, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := table.ConfirmBlob(ctx, "user-1", "blob-1", 100, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record, _ := table.GetBlob(ctx, "user-1", "blob-1"); record.ScanStatus != store.ScanPending {
+		t.Errorf("expected scan pending, got %q", record.ScanStatus)
+	}
+	events := table.Events()
+	if len(events) != 1 || events[0].EventType != publisher.EventBlobScanRequested || events[0].Data["blobId"] != "blob-1" {
+		t.Errorf("unexpected events %+v", events)
+	}
+
+	if err := table.SetScanStatus(ctx, "user-1", "blob-1", store.ScanInfected); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record, _ := table.GetBlob(ctx, "user-1", "blob-1"); record.ScanStatus != store.ScanInfected {
+		t.Errorf("expected infected, got %q", record.ScanStatus)
+	}
+	if err := table.SetScanStatus(ctx, "user-1", "blob-2", store.ScanClean); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func TestAllocateBlob_Errors(t *testing.T) {
+	ctx := context.Background()
+	expires := time.Now().Add(time.Hour)
+
+	if err := NewTable().AllocateBlob(ctx, "user-1", "blob-1", 10, "text/plain", expires, 2, "k", false, "", false, "", nil, nil, "", 0); allocationErrorType(err) != "accountNotProvisioned" {
+		t.Errorf("expected accountNotProvisioned, got %v", err)
+	}
+
+	suspended := NewTable()
+	suspended.PutAccount(account.Meta{AccountID: "user-1", QuotaRemaining: 1000, Suspended: true})
+	if err := suspended.AllocateBlob(ctx, "user-1", "blob-1", 10, "text/plain", expires, 2, "k", false, "", true, "", nil, nil, "", 0); allocationErrorType(err) != "forbidden" {
+		t.Errorf("expected forbidden, got %v", err)
+	}
+
+	readOnly := NewTable()
+	readOnly.PutAccount(account.Meta{AccountID: "user-1", QuotaRemaining: 1000, WritesDisabled: true})
+	if err := readOnly.AllocateBlob(ctx, "user-1", "blob-1", 10, "text/plain", expires, 2, "k", false, "", true, "", nil, nil, "", 0); allocationErrorType(err) != "accountReadOnly" {
+		t.Errorf("expected accountReadOnly, got %v", err)
+	}
+
+	if err := newAccountTable(100, 0).AllocateBlob(ctx, "user-1", "blob-1", 101, "text/plain", expires, 2, "k", false, "", false, "", nil, nil, "", 0); allocationErrorType(err) != "overQuota" {
+		t.Errorf("expected overQuota, got %v", err)
+	}
+
+	table := newAccountTable(1000, 1)
+	if err := table.AllocateBlob(ctx, "user-1", "blob-1", 10, "text/plain", expires, 5, "k1", false, "", false, "", nil, nil, "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := table.AllocateBlob(ctx, "user-1", "blob-2", 10, "text/plain", expires, 5, "k2", false, "", false, "", nil, nil, "", 0); allocationErrorType(err) != "tooManyPending" {
+		t.Errorf("expected account limit to override maxPending, got %v", err)
+	}
+	if err := table.AllocateBlob(ctx, "user-1", "blob-3", 10, "text/plain", expires, 5, "k3", false, "", true, "", nil, nil, "", 0); err != nil {
+		t.Errorf("expected IAM allocation to skip pending limit, got %v", err)
+	}
+}
+
+func TestExpiredAllocations_Cleanup(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+	now := time.Now()
+
+	_ = table.AllocateBlob(ctx, "user-1", "old", 100, "text/plain", now.Add(-2*time.Hour), 5, "user-1/old", false, "", false, "", nil, nil, "", 0)
+	_ = table.AllocateBlob(ctx, "user-1", "older", 50, "text/plain", now.Add(-3*time.Hour), 5, "user-1/older", false, "", true, "", nil, nil, "", 0)
+	_ = table.AllocateBlob(ctx, "user-1", "fresh", 10, "text/plain", now.Add(time.Hour), 5, "user-1/fresh", false, "", false, "", nil, nil, "", 0)
+
+	expired, err := table.GetExpiredPendingAllocations(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(expired) != 2 || expired[0].BlobID != "older" || expired[1].BlobID != "old" {
+		t.Fatalf("expected older then old, got %+v", expired)
+	}
+	if !expired[0].IAMAuth || expired[1].S3Key != "user-1/old" {
+		t.Errorf("expected allocation attributes to be returned, got %+v", expired)
+	}
+
+	for _, alloc := range expired {
+		if err := table.CleanupAllocation(ctx, alloc.AccountID, alloc.BlobID, alloc.Size, alloc.IAMAuth); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	meta, _ := table.Account("user-1")
+	if meta.QuotaRemaining != 990 || meta.PendingAllocationsCount != 1 {
+		t.Errorf("expected quota 990 and 1 pending after cleanup, got %+v", meta)
+	}
+	if err := table.CleanupAllocation(ctx, "user-1", "old", 100, false); !errors.Is(err, ErrNotPending) {
+		t.Errorf("expected ErrNotPending for removed blob, got %v", err)
+	}
+}
+
+func TestReserveBlob_TracksQuota(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(100, 0)
+	record := blobmeta.Record{BlobID: "blob-1", AccountID: "user-1", Size: 60, S3Key: "user-1/blob-1"}
+
+	if err := table.ReserveBlob(ctx, record, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record.BlobID = "blob-2"
+	if err := table.ReserveBlob(ctx, record, time.Now().Add(time.Minute)); !errors.Is(err, ErrOverQuota) {
+		t.Errorf("expected ErrOverQuota, got %v", err)
+	}
+	record.AccountID = "user-2"
+	if err := table.ReserveBlob(ctx, record, time.Now().Add(time.Minute)); !errors.Is(err, ErrAccountNotProvisioned) {
+		t.Errorf("expected ErrAccountNotProvisioned, got %v", err)
+	}
+
+	if err := table.ConfirmBlob(ctx, "user-1", "blob-1", 60, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	blob, _ := table.Blob("user-1", "blob-1")
+	meta, _ := table.Account("user-1")
+	if blob.Status != StatusConfirmed || meta.QuotaRemaining != 40 || meta.PendingAllocationsCount != 0 {
+		t.Errorf("expected a confirmed blob and 40 bytes left, got %+v and %+v", blob, meta)
+	}
+}
+
+func TestGetMarkDeleted(t *testing.T) {
+	ctx := context.Background()
+	table := NewTable()
+
+	table.PutBlob(Blob{Record: blobmeta.Record{BlobID: "blob-1", AccountID: "user-1", Size: 5, ContentType: "text/plain", S3Key: "user-1/blob-1", Parent: "email"}})
+	if err := table.MarkBlobDeleted(ctx, "user-1", "blob-1", "2026-01-01T00:00:00Z"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := table.GetBlob(ctx, "user-1", "blob-1")
+	if err != nil || got == nil {
+		t.Fatalf("expected blob, got %v, %v", got, err)
+	}
+	if got.Parent != "email" || got.DeletedAt != "2026-01-01T00:00:00Z" {
+		t.Errorf("unexpected record %+v", got)
+	}
+	if missing, err := table.GetBlob(ctx, "user-1", "blob-2"); missing != nil || err != nil {
+		t.Errorf("expected nil, nil for missing blob; got %v, %v", missing, err)
+	}
+	if blobs, err := table.GetBlobs(ctx, "user-1", []string{"blob-1", "blob-2"}); err != nil || len(blobs) != 1 || blobs["blob-1"] == nil {
+		t.Errorf("expected only blob-1, got %v, %v", blobs, err)
+	}
+
+	if err := table.MarkBlobDeleted(ctx, "user-1", "blob-1", "2026-01-02T00:00:00Z"); !errors.Is(err, ErrAlreadyDeleted) {
+		t.Errorf("expected ErrAlreadyDeleted for marked blob, got %v", err)
+	}
+	if err := table.MarkBlobDeleted(ctx, "user-1", "blob-2", "2026-01-02T00:00:00Z"); !errors.Is(err, ErrAlreadyDeleted) {
+		t.Errorf("expected ErrAlreadyDeleted for missing blob, got %v", err)
+	}
+}
+
+func TestGetBlobForComplete(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+	_ = table.AllocateBlob(ctx, "user-1", "blob-1", 0, "text/plain", time.Now().Add(time.Hour), 5, "user-1/blob-1", true, "upload-1", false, "", nil, nil, "", 0)
+
+	record, err := table.GetBlobForComplete(ctx, "user-1", "blob-1")
+	if err != nil || record == nil {
+		t.Fatalf("expected record, got %v, %v", record, err)
+	}
+	if record.Status != StatusPending || !record.Multipart || record.UploadID != "upload-1" {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestChecksum_DeclaredThenRecorded(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+	_ = table.AllocateBlob(ctx, "user-1", "blob-1", 5, "text/plain", time.Now().Add(time.Hour), 5, "user-1/blob-1", false, "", false, "", nil, nil, "c3VtMQ==", 0)
+
+	info, err := table.GetBlobInfo(ctx, "user-1", "blob-1")
+	if err != nil || info.Checksum != "c3VtMQ==" {
+		t.Fatalf("expected the declared checksum, got %+v, %v", info, err)
+	}
+	if err := table.RecordChecksum(ctx, "user-1", "blob-1", "c3VtMQ=="); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob, _ := table.Blob("user-1", "blob-1"); blob.ChecksumSHA256 != "c3VtMQ==" {
+		t.Errorf("expected the checksum to be recorded, got %+v", blob)
+	}
+
+	// A confirmed blob is left alone
+	_ = table.ConfirmBlob(ctx, "user-1", "blob-1", 5, false, false)
+	if err := table.RecordChecksum(ctx, "user-1", "blob-1", "other"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob, _ := table.Blob("user-1", "blob-1"); blob.ChecksumSHA256 != "c3VtMQ==" {
+		t.Errorf("expected a confirmed blob's checksum to be kept, got %q", blob.ChecksumSHA256)
+	}
+}
+
+func TestExtendAllocation(t *testing.T) {
+	ctx := context.Background()
+	table := newAccountTable(1000, 0)
+	now := time.Now()
+	_ = table.AllocateBlob(ctx, "user-1", "blob-1", 0, "text/plain", now.Add(-2*time.Hour), 5, "user-1/blob-1", true, "upload-1", false, "", nil, nil, "", 0)
+
+	if err := table.ExtendAllocation(ctx, "user-1", "blob-1", "upload-2", now.Add(time.Hour)); !errors.Is(err, ErrNotPending) {
+		t.Errorf("expected ErrNotPending for another upload, got %v", err)
+	}
+	if err := table.ExtendAllocation(ctx, "user-1", "blob-1", "upload-1", now.Add(time.Hour)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	record, _ := table.GetBlobForReallocate(ctx, "user-1", "blob-1")
+	if !record.URLExpiresAt.Equal(now.Add(time.Hour)) {
+		t.Errorf("expected expiry to be extended, got %v", record.URLExpiresAt)
+	}
+	if expired, _ := table.GetExpiredPendingAllocations(ctx, now); len(expired) != 0 {
+		t.Errorf("expected an extended allocation not to be expired, got %+v", expired)
+	}
+}
+
+func TestFailOn(t *testing.T) {
+	ctx := context.Background()
+	table := NewTable()
+	boom := errors.New("dynamo down")
+
+	table.FailOn("GetBlob", boom)
+	if _, err := table.GetBlob(ctx, "user-1", "blob-1"); !errors.Is(err, boom) {
+		t.Errorf("expected injected error, got %v", err)
+	}
+	if _, err := table.GetMeta(ctx, "user-1"); err != nil {
+		t.Errorf("expected other methods to succeed, got %v", err)
+	}
+
+	table.FailOn("GetBlob", nil)
+	if _, err := table.GetBlob(ctx, "user-1", "blob-1"); err != nil {
+		t.Errorf("expected failure to be cleared, got %v", err)
+	}
+}
+
+func TestRegistry_LoadsPlugins(t *testing.T) {
+	table := NewTable()
+	table.PutPlugin(plugin.PluginRecord{
+		PluginID:     "mail",
+		Capabilities: map[string]map[string]any{"urn:ietf:params:jmap:mail": {}},
+		Methods: map[string]plugin.MethodTarget{
+			"Email/get": {InvocationType: "lambda", InvokeTarget: "arn:aws:lambda:ap-southeast-2:123456789012:function:mail"},
+		},
+	})
+
+	registry, err := table.Registry(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !registry.HasCapability("urn:ietf:params:jmap:mail") || registry.GetMethodTarget("Email/get") == nil {
+		t.Errorf("expected plugin to be registered")
+	}
+	if items, _ := table.QueryByPK(context.Background(), "ACCOUNT#user-1"); len(items) != 0 {
+		t.Errorf("expected no items for other partitions, got %d", len(items))
+	}
+}
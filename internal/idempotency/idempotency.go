@@ -0,0 +1,206 @@
+// Package idempotency stores snapshots of JMAP API responses under a
+// client-chosen Idempotency-Key, so a retried request replays the original
+// response instead of running its method calls a second time.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Header is the request header carrying the key, and ReplayedHeader marks a
+// response replayed from a snapshot
+const (
+	Header         = "Idempotency-Key"
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// SKPrefix prefixes the sort key of a snapshot under ACCOUNT#{accountId}
+const SKPrefix = "IDEMPOTENCY#"
+
+// MaxKeyLength is the longest key accepted
+const MaxKeyLength = 255
+
+// pendingExpiry bounds how long a claim blocks retries if the request
+// holding it dies before completing or releasing it; it outlasts the
+// longest a Lambda invocation can run
+const pendingExpiry = 15 * time.Minute
+
+// maxClaimAttempts bounds retries when a conflicting snapshot disappears
+// between the conditional write and the read that follows it
+const maxClaimAttempts = 2
+
+// ErrInvalidKey is returned by CheckKey for a key that is too long or holds
+// characters other than printable ASCII
+var ErrInvalidKey = errors.New("invalid idempotency key")
+
+// Snapshot is what is stored for a key: the hash of the request that claimed
+// it and, once that request has completed, its response
+type Snapshot struct {
+	RequestHash string `dynamodbav:"requestHash"`
+	StatusCode  int    `dynamodbav:"statusCode,omitempty"`
+	ContentType string `dynamodbav:"contentType,omitempty"`
+	Body        string `dynamodbav:"body,omitempty"`
+}
+
+// Pending reports whether the request that claimed the key is still running
+func (s Snapshot) Pending() bool {
+	return s.StatusCode == 0
+}
+
+// FromHeaders returns the request's Idempotency-Key, matching the header
+// name case-insensitively, or "" if it has none
+func FromHeaders(headers map[string]string) string {
+	for k, v := range headers {
+		if strings.EqualFold(k, Header) {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// CheckKey returns ErrInvalidKey unless key is 1 to MaxKeyLength printable
+// ASCII characters
+func CheckKey(key string) error {
+	if key == "" || len(key) > MaxKeyLength {
+		return ErrInvalidKey
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return ErrInvalidKey
+		}
+	}
+	return nil
+}
+
+// Hash returns a digest of a request body, so a key reused for a different
+// request can be told apart from a retry
+func Hash(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by idempotency
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBStore stores response snapshots, each expiring ttl after its
+// request completes
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string, ttl time.Duration) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// snapshotKey builds the primary key of an account's snapshot for a key
+func snapshotKey(accountID, key string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKPrefix + key},
+	}
+}
+
+// Claim reserves key for a request with the given hash. It returns nil if
+// the caller now holds the key and must Complete or Release it, or the
+// snapshot already stored for the key otherwise. A snapshot past its expiry
+// but not yet removed by DynamoDB TTL is treated as absent.
+func (d *DynamoDBStore) Claim(ctx context.Context, accountID, key, requestHash string) (*Snapshot, error) {
+	for attempt := 0; attempt < maxClaimAttempts; attempt++ {
+		now := d.now()
+		item := snapshotKey(accountID, key)
+		item["requestHash"] = &types.AttributeValueMemberS{Value: requestHash}
+		item["ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(pendingExpiry).Unix(), 10)}
+
+		_, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+			TableName:                aws.String(d.tableName),
+			Item:                     item,
+			ConditionExpression:      aws.String("attribute_not_exists(pk) OR #ttl < :now"),
+			ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			},
+		})
+		if err == nil {
+			return nil, nil
+		}
+		if !dbclient.IsConditionalCheckFailed(err) {
+			return nil, fmt.Errorf("failed to claim idempotency key: %w", err)
+		}
+
+		output, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(d.tableName),
+			Key:            snapshotKey(accountID, key),
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to read idempotency snapshot: %w", err)
+		}
+		if output.Item == nil {
+			continue
+		}
+		var snapshot Snapshot
+		if err := attributevalue.UnmarshalMap(output.Item, &snapshot); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal idempotency snapshot: %w", err)
+		}
+		return &snapshot, nil
+	}
+	return nil, fmt.Errorf("failed to claim idempotency key: snapshot changed during claim")
+}
+
+// Complete stores the response for a key the caller has claimed
+func (d *DynamoDBStore) Complete(ctx context.Context, accountID, key string, snapshot Snapshot) error {
+	item, err := attributevalue.MarshalMap(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to marshal idempotency snapshot: %w", err)
+	}
+	for k, v := range snapshotKey(accountID, key) {
+		item[k] = v
+	}
+	item["ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(d.now().Add(d.ttl).Unix(), 10)}
+
+	if _, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to store idempotency snapshot: %w", err)
+	}
+	return nil
+}
+
+// Release gives up a claimed key without storing a response, so a retry
+// runs the request again
+func (d *DynamoDBStore) Release(ctx context.Context, accountID, key string) error {
+	if _, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       snapshotKey(accountID, key),
+	}); err != nil {
+		return fmt.Errorf("failed to release idempotency key: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBClient struct {
+	item       map[string]types.AttributeValue
+	putErr     error
+	lastPut    *dynamodb.PutItemInput
+	lastDelete *dynamodb.DeleteItemInput
+	gets       int
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.gets++
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.lastPut = params
+	if m.putErr != nil {
+		return nil, m.putErr
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.lastDelete = params
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func newTestStore(client *mockDynamoDBClient) *DynamoDBStore {
+	store := NewDynamoDBStore(client, "table", 24*time.Hour)
+	store.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return store
+}
+
+func TestFromHeaders(t *testing.T) {
+	if got := FromHeaders(map[string]string{"idempotency-key": " abc "}); got != "abc" {
+		t.Errorf("expected abc, got %q", got)
+	}
+	if got := FromHeaders(map[string]string{"Content-Type": "application/json"}); got != "" {
+		t.Errorf("expected no key, got %q", got)
+	}
+}
+
+func TestCheckKey(t *testing.T) {
+	for _, key := range []string{"abc", "9f2c1e4a-6b0d-4c1e-9a55-2f0b8d7e1c33", strings.Repeat("k", MaxKeyLength)} {
+		if err := CheckKey(key); err != nil {
+			t.Errorf("%q: unexpected error %v", key, err)
+		}
+	}
+	for _, key := range []string{"", strings.Repeat("k", MaxKeyLength+1), "line\nbreak", "ключ"} {
+		if err := CheckKey(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%q: expected ErrInvalidKey, got %v", key, err)
+		}
+	}
+}
+
+func TestClaim_NewKey(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := newTestStore(client)
+
+	snapshot, err := store.Claim(context.Background(), "user-1", "key-1", "hash")
+	if err != nil || snapshot != nil {
+		t.Fatalf("expected the key to be claimed, got %+v %v", snapshot, err)
+	}
+	put := client.lastPut
+	if sk := put.Item["sk"].(*types.AttributeValueMemberS).Value; sk != "IDEMPOTENCY#key-1" {
+		t.Errorf("unexpected sort key %s", sk)
+	}
+	if ttl := put.Item["ttl"].(*types.AttributeValueMemberN).Value; ttl != "1700000900" {
+		t.Errorf("expected the pending expiry, got %s", ttl)
+	}
+	if _, ok := put.Item["statusCode"]; ok {
+		t.Error("expected a claim without a response")
+	}
+	if *put.ConditionExpression != "attribute_not_exists(pk) OR #ttl < :now" {
+		t.Errorf("unexpected condition %s", *put.ConditionExpression)
+	}
+}
+
+func TestClaim_ExistingSnapshot(t *testing.T) {
+	client := &mockDynamoDBClient{
+		putErr: &types.ConditionalCheckFailedException{},
+		item: map[string]types.AttributeValue{
+			"requestHash": &types.AttributeValueMemberS{Value: "hash"},
+			"statusCode":  &types.AttributeValueMemberN{Value: "200"},
+			"contentType": &types.AttributeValueMemberS{Value: "application/json"},
+			"body":        &types.AttributeValueMemberS{Value: `{"methodResponses":[]}`},
+		},
+	}
+	store := newTestStore(client)
+
+	snapshot, err := store.Claim(context.Background(), "user-1", "key-1", "hash")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if snapshot == nil || snapshot.Pending() || snapshot.StatusCode != 200 || snapshot.Body != `{"methodResponses":[]}` {
+		t.Errorf("unexpected snapshot %+v", snapshot)
+	}
+}
+
+func TestClaim_PendingSnapshot(t *testing.T) {
+	client := &mockDynamoDBClient{
+		putErr: &types.ConditionalCheckFailedException{},
+		item: map[string]types.AttributeValue{
+			"requestHash": &types.AttributeValueMemberS{Value: "hash"},
+		},
+	}
+	snapshot, err := newTestStore(client).Claim(context.Background(), "user-1", "key-1", "hash")
+	if err != nil || snapshot == nil || !snapshot.Pending() {
+		t.Errorf("expected a pending snapshot, got %+v %v", snapshot, err)
+	}
+}
+
+func TestClaim_SnapshotVanishes(t *testing.T) {
+	client := &mockDynamoDBClient{putErr: &types.ConditionalCheckFailedException{}}
+	if _, err := newTestStore(client).Claim(context.Background(), "user-1", "key-1", "hash"); err == nil {
+		t.Fatal("expected an error")
+	}
+	if client.gets != maxClaimAttempts {
+		t.Errorf("expected %d reads, got %d", maxClaimAttempts, client.gets)
+	}
+}
+
+func TestComplete(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := newTestStore(client)
+
+	err := store.Complete(context.Background(), "user-1", "key-1", Snapshot{RequestHash: "hash", StatusCode: 200, ContentType: "application/json", Body: "{}"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	put := client.lastPut
+	if put.ConditionExpression != nil {
+		t.Error("expected an unconditional write")
+	}
+	if code := put.Item["statusCode"].(*types.AttributeValueMemberN).Value; code != "200" {
+		t.Errorf("expected status 200, got %s", code)
+	}
+	if ttl := put.Item["ttl"].(*types.AttributeValueMemberN).Value; ttl != "1700086400" {
+		t.Errorf("expected the snapshot expiry, got %s", ttl)
+	}
+}
+
+func TestRelease(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	if err := newTestStore(client).Release(context.Background(), "user-1", "key-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sk := client.lastDelete.Key["sk"].(*types.AttributeValueMemberS).Value; sk != "IDEMPOTENCY#key-1" {
+		t.Errorf("unexpected sort key %s", sk)
+	}
+}
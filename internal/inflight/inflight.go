@@ -0,0 +1,203 @@
+// Package inflight limits how many requests an account has in flight at
+// once. Each request holds a lease in its account's record until it is done;
+// a request finding the account's leases all taken is refused. Leases expire,
+// so a request whose Lambda crashes or times out without releasing its lease
+// only holds it until the invocation could no longer be running.
+package inflight
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Key prefixes and record layout for lease records
+const (
+	PKPrefix = "INFLIGHT#"
+	SKLeases = "LEASES#"
+)
+
+// maxUpdateAttempts bounds the optimistic retry loop when concurrent
+// requests race on the same record. Requests from one account racing is the
+// case being limited, so this allows more attempts than rate limiting.
+const maxUpdateAttempts = 5
+
+// idleExpiry is how long after its last lease expires a record is kept; a
+// missing record holds no leases
+const idleExpiry = time.Hour
+
+// DefaultLease is how long a lease is held when the context has no
+// deadline to bound it
+const DefaultLease = 30 * time.Second
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by
+// inflight
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// Limiter holds per-account request leases in DynamoDB, so every Lambda
+// instance counts the same requests
+type Limiter struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewLimiter creates a new Limiter
+func NewLimiter(client DynamoDBClient, tableName string) *Limiter {
+	return &Limiter{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// key returns the key of an account's lease record
+func key(accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: PKPrefix + accountID},
+		"sk": &types.AttributeValueMemberS{Value: SKLeases},
+	}
+}
+
+// Acquire takes a lease for requestID if the account holds fewer than limit
+// unexpired leases, and reports whether it did. The lease lasts until the
+// context's deadline, which on Lambda is the end of the invocation, or
+// DefaultLease. A record that keeps changing under it is treated as full.
+func (l *Limiter) Acquire(ctx context.Context, accountID, requestID string, limit int) (bool, error) {
+	recordKey := key(accountID)
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		output, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(l.tableName),
+			Key:            recordKey,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return false, fmt.Errorf("failed to read request leases: %w", err)
+		}
+		now := l.now()
+		leases, version, err := parseRecord(output.Item)
+		if err != nil {
+			return false, err
+		}
+
+		// Expired leases belong to requests that can no longer be running
+		live := make(map[string]types.AttributeValue, len(leases)+1)
+		latest := now
+		for id, expiresAt := range leases {
+			if expiresAt.After(now) {
+				live[id] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.UnixMilli(), 10)}
+				latest = maxTime(latest, expiresAt)
+			}
+		}
+		if len(live) >= limit {
+			return false, nil
+		}
+		expiresAt := now.Add(DefaultLease)
+		if deadline, ok := ctx.Deadline(); ok {
+			expiresAt = deadline
+		}
+		live[requestID] = &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.UnixMilli(), 10)}
+		latest = maxTime(latest, expiresAt)
+
+		input := &dynamodb.PutItemInput{
+			TableName: aws.String(l.tableName),
+			Item: map[string]types.AttributeValue{
+				"pk":      recordKey["pk"],
+				"sk":      recordKey["sk"],
+				"leases":  &types.AttributeValueMemberM{Value: live},
+				"version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+				"ttl":     &types.AttributeValueMemberN{Value: strconv.FormatInt(latest.Add(idleExpiry).Unix(), 10)},
+			},
+		}
+		if output.Item == nil {
+			input.ConditionExpression = aws.String("attribute_not_exists(pk)")
+		} else {
+			input.ConditionExpression = aws.String("version = :previous")
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":previous": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			}
+		}
+		if _, err := l.client.PutItem(ctx, input); err != nil {
+			if dbclient.IsConditionalCheckFailed(err) {
+				continue
+			}
+			return false, fmt.Errorf("failed to write request leases: %w", err)
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// Release gives up the lease of requestID. Releasing a lease that has
+// expired and been dropped is not an error. The record's version is bumped
+// so a concurrent Acquire cannot write the lease back.
+func (l *Limiter) Release(ctx context.Context, accountID, requestID string) error {
+	_, err := l.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(l.tableName),
+		Key:                 key(accountID),
+		UpdateExpression:    aws.String("REMOVE leases.#request SET version = version + :one"),
+		ConditionExpression: aws.String("attribute_exists(leases.#request)"),
+		ExpressionAttributeNames: map[string]string{
+			"#request": requestID,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+	})
+	if err != nil && !dbclient.IsConditionalCheckFailed(err) {
+		return fmt.Errorf("failed to release request lease: %w", err)
+	}
+	return nil
+}
+
+// parseRecord reads the leases and version of a lease record, which may be
+// missing
+func parseRecord(item map[string]types.AttributeValue) (map[string]time.Time, int64, error) {
+	if item == nil {
+		return nil, 0, nil
+	}
+	versionAttr, ok := item["version"].(*types.AttributeValueMemberN)
+	if !ok {
+		return nil, 0, fmt.Errorf("request lease record missing version")
+	}
+	version, err := strconv.ParseInt(versionAttr.Value, 10, 64)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid request lease version: %w", err)
+	}
+
+	leases := make(map[string]time.Time)
+	leasesAttr, _ := item["leases"].(*types.AttributeValueMemberM)
+	if leasesAttr == nil {
+		return leases, version, nil
+	}
+	for id, value := range leasesAttr.Value {
+		expiresAttr, ok := value.(*types.AttributeValueMemberN)
+		if !ok {
+			return nil, 0, fmt.Errorf("invalid request lease %s", id)
+		}
+		expiresAt, err := strconv.ParseInt(expiresAttr.Value, 10, 64)
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid request lease %s: %w", id, err)
+		}
+		leases[id] = time.UnixMilli(expiresAt)
+	}
+	return leases, version, nil
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,206 @@
+package inflight
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDynamoDBClient stores lease records in memory and enforces the
+// version condition and lease removal like DynamoDB would
+type mockDynamoDBClient struct {
+	items       map[string]map[string]types.AttributeValue
+	conflicts   int
+	getErr      error
+	updateErr   error
+	putAttempts int
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	pk := params.Key["pk"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[pk]}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.putAttempts++
+	if m.conflicts > 0 {
+		m.conflicts--
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	if m.items == nil {
+		m.items = make(map[string]map[string]types.AttributeValue)
+	}
+	pk := params.Item["pk"].(*types.AttributeValueMemberS).Value
+	if previous, ok := params.ExpressionAttributeValues[":previous"]; ok {
+		if m.items[pk]["version"].(*types.AttributeValueMemberN).Value != previous.(*types.AttributeValueMemberN).Value {
+			return nil, &types.ConditionalCheckFailedException{}
+		}
+	} else if m.items[pk] != nil {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	m.items[pk] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if m.updateErr != nil {
+		return nil, m.updateErr
+	}
+	pk := params.Key["pk"].(*types.AttributeValueMemberS).Value
+	item := m.items[pk]
+	requestID := params.ExpressionAttributeNames["#request"]
+	if item == nil {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	leases := item["leases"].(*types.AttributeValueMemberM).Value
+	if _, ok := leases[requestID]; !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	delete(leases, requestID)
+	version, _ := strconv.ParseInt(item["version"].(*types.AttributeValueMemberN).Value, 10, 64)
+	item["version"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)}
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func newTestLimiter(client *mockDynamoDBClient, now *time.Time) *Limiter {
+	l := NewLimiter(client, "table")
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+// leaseCount returns how many leases an account's record holds
+func leaseCount(client *mockDynamoDBClient, accountID string) int {
+	item := client.items[PKPrefix+accountID]
+	if item == nil {
+		return 0
+	}
+	return len(item["leases"].(*types.AttributeValueMemberM).Value)
+}
+
+func TestAcquire_UpToTheLimitThenRefuses(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	for i := range 2 {
+		ok, err := l.Acquire(context.Background(), "user-1", "req-"+strconv.Itoa(i), 2)
+		if err != nil || !ok {
+			t.Fatalf("request %d: expected a lease, got %v %v", i, ok, err)
+		}
+	}
+	ok, err := l.Acquire(context.Background(), "user-1", "req-2", 2)
+	if err != nil || ok {
+		t.Fatalf("expected the third request to be refused, got %v %v", ok, err)
+	}
+
+	// Other accounts have their own leases
+	if ok, _ := l.Acquire(context.Background(), "user-2", "req-3", 2); !ok {
+		t.Error("expected another account to get a lease")
+	}
+}
+
+func TestRelease_FreesALease(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	if ok, _ := l.Acquire(context.Background(), "user-1", "req-1", 1); !ok {
+		t.Fatal("expected a lease")
+	}
+	if err := l.Release(context.Background(), "user-1", "req-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if leaseCount(client, "user-1") != 0 {
+		t.Error("expected the lease to be removed")
+	}
+	if ok, _ := l.Acquire(context.Background(), "user-1", "req-2", 1); !ok {
+		t.Error("expected a lease after the release")
+	}
+
+	// Releasing a lease that is already gone is not an error
+	if err := l.Release(context.Background(), "user-1", "req-1"); err != nil {
+		t.Errorf("unexpected error releasing a released lease: %v", err)
+	}
+	client.updateErr = errors.New("throttled")
+	if err := l.Release(context.Background(), "user-1", "req-2"); err == nil {
+		t.Error("expected an error when the update fails")
+	}
+}
+
+func TestAcquire_ExpiredLeasesAreDropped(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	if ok, _ := l.Acquire(context.Background(), "user-1", "crashed", 1); !ok {
+		t.Fatal("expected a lease")
+	}
+	if ok, _ := l.Acquire(context.Background(), "user-1", "req-2", 1); ok {
+		t.Fatal("expected a refusal while the lease is held")
+	}
+
+	now = now.Add(DefaultLease + time.Second)
+	if ok, _ := l.Acquire(context.Background(), "user-1", "req-2", 1); !ok {
+		t.Fatal("expected a lease once the crashed request's lease expired")
+	}
+	if leaseCount(client, "user-1") != 1 {
+		t.Errorf("expected the expired lease to be dropped, got %d leases", leaseCount(client, "user-1"))
+	}
+}
+
+func TestAcquire_LeaseLastsUntilTheDeadline(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	ctx, cancel := context.WithDeadline(context.Background(), now.Add(5*time.Second))
+	defer cancel()
+	if ok, _ := l.Acquire(ctx, "user-1", "req-1", 1); !ok {
+		t.Fatal("expected a lease")
+	}
+	lease := client.items[PKPrefix+"user-1"]["leases"].(*types.AttributeValueMemberM).Value["req-1"]
+	if got := lease.(*types.AttributeValueMemberN).Value; got != strconv.FormatInt(now.Add(5*time.Second).UnixMilli(), 10) {
+		t.Errorf("expected the lease to end at the deadline, got %s", got)
+	}
+	ttl := client.items[PKPrefix+"user-1"]["ttl"].(*types.AttributeValueMemberN).Value
+	if ttl != strconv.FormatInt(now.Add(5*time.Second+idleExpiry).Unix(), 10) {
+		t.Errorf("unexpected ttl %s", ttl)
+	}
+}
+
+func TestAcquire_RetriesOnConflict(t *testing.T) {
+	client := &mockDynamoDBClient{conflicts: 1}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	ok, err := l.Acquire(context.Background(), "user-1", "req-1", 1)
+	if err != nil || !ok {
+		t.Fatalf("expected a lease after a retry, got %v %v", ok, err)
+	}
+	if client.putAttempts != 2 {
+		t.Errorf("expected 2 put attempts, got %d", client.putAttempts)
+	}
+
+	client.conflicts = maxUpdateAttempts
+	if ok, err := l.Acquire(context.Background(), "user-1", "req-2", 5); err != nil || ok {
+		t.Errorf("expected a refusal under sustained contention, got %v %v", ok, err)
+	}
+}
+
+func TestAcquire_ReadError(t *testing.T) {
+	client := &mockDynamoDBClient{getErr: errors.New("throttled")}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, &now)
+
+	if _, err := l.Acquire(context.Background(), "user-1", "req-1", 1); err == nil {
+		t.Error("expected an error when the read fails")
+	}
+}
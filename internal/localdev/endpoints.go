@@ -0,0 +1,91 @@
+// Package localdev runs the core offline: it points AWS clients at local
+// stand-ins such as DynamoDB Local, MinIO or LocalStack, and serves Lambda
+// HTTP handlers from a plain HTTP server in place of API Gateway.
+package localdev
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// EndpointsEnv lists the local endpoints. It is either a single URL used for
+// every service, as with LocalStack, or comma-separated service=URL pairs,
+// such as "dynamodb=http://localhost:8000,s3=http://localhost:9000".
+const EndpointsEnv = "LOCAL_ENDPOINTS"
+
+// allServices is the key of the endpoint used for every service
+const allServices = ""
+
+// ParseEndpoints parses an EndpointsEnv value into URLs keyed by service, as
+// lower case SDK service IDs without spaces (dynamodb, s3, secretsmanager)
+func ParseEndpoints(value string) (map[string]string, error) {
+	endpoints := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		service, endpoint := allServices, entry
+		if name, rest, ok := strings.Cut(entry, "="); ok {
+			service, endpoint = serviceKey(name), strings.TrimSpace(rest)
+		}
+		parsed, err := url.Parse(endpoint)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("invalid endpoint %q in %s", entry, EndpointsEnv)
+		}
+		endpoints[service] = endpoint
+	}
+	return endpoints, nil
+}
+
+// Configure points clients created from cfg afterwards at the endpoints in
+// LOCAL_ENDPOINTS, and makes S3 clients use path-style addressing, which
+// local stand-ins need. It does nothing when LOCAL_ENDPOINTS is unset. Call
+// it straight after awsinit.Init, before any client is created.
+func Configure(cfg *aws.Config) error {
+	value := os.Getenv(EndpointsEnv)
+	if value == "" {
+		return nil
+	}
+	endpoints, err := ParseEndpoints(value)
+	if err != nil {
+		return err
+	}
+
+	if endpoint, ok := endpoints[allServices]; ok {
+		cfg.BaseEndpoint = aws.String(endpoint)
+	}
+	cfg.ServiceOptions = append(cfg.ServiceOptions, func(serviceID string, options any) {
+		if endpoint, ok := endpoints[serviceKey(serviceID)]; ok {
+			setBaseEndpoint(options, endpoint)
+		}
+		if s3Options, ok := options.(*s3.Options); ok {
+			s3Options.UsePathStyle = true
+		}
+	})
+	return nil
+}
+
+// serviceKey normalises a service name or SDK service ID ("Secrets Manager")
+// to an endpoint key ("secretsmanager")
+func serviceKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(name), " ", ""))
+}
+
+// setBaseEndpoint sets the BaseEndpoint every SDK service's Options has
+func setBaseEndpoint(options any, endpoint string) {
+	value := reflect.ValueOf(options)
+	if value.Kind() != reflect.Pointer || value.Elem().Kind() != reflect.Struct {
+		return
+	}
+	field := value.Elem().FieldByName("BaseEndpoint")
+	if field.IsValid() && field.CanSet() && field.Type() == reflect.TypeOf((*string)(nil)) {
+		field.Set(reflect.ValueOf(aws.String(endpoint)))
+	}
+}
@@ -0,0 +1,83 @@
+package localdev
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	got, err := ParseEndpoints(" dynamodb=http://localhost:8000, S3=http://localhost:9000,Secrets Manager=http://localhost:4566 ")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"dynamodb":       "http://localhost:8000",
+		"s3":             "http://localhost:9000",
+		"secretsmanager": "http://localhost:4566",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestParseEndpoints_Invalid(t *testing.T) {
+	for _, value := range []string{"localhost:4566", "dynamodb=", "s3=not a url"} {
+		if _, err := ParseEndpoints(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestConfigure_Unset(t *testing.T) {
+	t.Setenv(EndpointsEnv, "")
+	cfg := aws.Config{}
+	if err := Configure(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.BaseEndpoint != nil || len(cfg.ServiceOptions) != 0 {
+		t.Error("expected config to be unchanged")
+	}
+}
+
+func TestConfigure_PerService(t *testing.T) {
+	t.Setenv(EndpointsEnv, "dynamodb=http://localhost:8000,s3=http://localhost:9000")
+	cfg := aws.Config{Region: "ap-southeast-2"}
+	if err := Configure(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	dynamoOptions := dynamodb.NewFromConfig(cfg).Options()
+	if aws.ToString(dynamoOptions.BaseEndpoint) != "http://localhost:8000" {
+		t.Errorf("expected DynamoDB Local endpoint, got %q", aws.ToString(dynamoOptions.BaseEndpoint))
+	}
+	s3Options := s3.NewFromConfig(cfg).Options()
+	if aws.ToString(s3Options.BaseEndpoint) != "http://localhost:9000" || !s3Options.UsePathStyle {
+		t.Errorf("expected path-style MinIO endpoint, got %q (path style %v)", aws.ToString(s3Options.BaseEndpoint), s3Options.UsePathStyle)
+	}
+}
+
+func TestConfigure_AllServices(t *testing.T) {
+	t.Setenv(EndpointsEnv, "http://localhost:4566")
+	cfg := aws.Config{Region: "ap-southeast-2"}
+	if err := Configure(&cfg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if aws.ToString(cfg.BaseEndpoint) != "http://localhost:4566" {
+		t.Errorf("expected LocalStack endpoint for every service, got %q", aws.ToString(cfg.BaseEndpoint))
+	}
+	if !s3.NewFromConfig(cfg).Options().UsePathStyle {
+		t.Error("expected S3 to use path-style addressing")
+	}
+}
+
+func TestConfigure_Invalid(t *testing.T) {
+	t.Setenv(EndpointsEnv, "dynamodb=localhost")
+	if err := Configure(&aws.Config{}); err == nil {
+		t.Error("expected error for invalid endpoint")
+	}
+}
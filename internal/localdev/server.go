@@ -0,0 +1,171 @@
+package localdev
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/google/uuid"
+)
+
+// ListenEnv is the address an HTTP Lambda serves on instead of running as a
+// Lambda, such as ":8080"
+const ListenEnv = "LOCAL_HTTP_ADDR"
+
+// AccountHeader sets the Cognito sub the request is authenticated as, in
+// place of the authorizer. Requests without it use DefaultAccountID.
+const AccountHeader = "X-Local-Account-Id"
+
+// DefaultAccountID is the account requests are authenticated as by default
+const DefaultAccountID = "local-user"
+
+// PrincipalHeader sets the IAM caller ARN of requests to SigV4 routes, such
+// as /jmap-iam, which API Gateway would take from the signature
+const PrincipalHeader = "X-Local-Principal-Arn"
+
+// binaryMediaTypes are base64-encoded, as API Gateway is configured to
+var binaryMediaTypes = map[string]bool{
+	"application/octet-stream": true,
+	"message/rfc822":           true,
+}
+
+// pathParameter matches the wildcards of a route pattern
+var pathParameter = regexp.MustCompile(`\{([A-Za-z0-9_]+)\}`)
+
+// LambdaHandler is an API Gateway proxy handler. Each command has its own
+// response type with the API Gateway proxy response's JSON fields.
+type LambdaHandler[Resp any] func(ctx context.Context, request events.APIGatewayProxyRequest) (Resp, error)
+
+// Serve serves handler on addr for each route pattern, such as
+// "POST /jmap-iam/{accountId}", until the server fails
+func Serve[Resp any](addr string, handler LambdaHandler[Resp], patterns ...string) error {
+	mux := http.NewServeMux()
+	for _, pattern := range patterns {
+		mux.Handle(pattern, Handler(pattern, handler))
+	}
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// Handler adapts handler to net/http for one route pattern. Each request is
+// converted to the event API Gateway would send, authenticated as the
+// account in AccountHeader.
+func Handler[Resp any](pattern string, handler LambdaHandler[Resp]) http.Handler {
+	var names []string
+	for _, match := range pathParameter.FindAllStringSubmatch(pattern, -1) {
+		names = append(names, match[1])
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request, err := toEvent(r, names)
+		if err != nil {
+			http.Error(w, "failed to read request", http.StatusBadRequest)
+			return
+		}
+
+		resp, err := handler(r.Context(), request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		writeResponse(w, resp)
+	})
+}
+
+// toEvent converts an HTTP request to an API Gateway proxy request
+func toEvent(r *http.Request, names []string) (events.APIGatewayProxyRequest, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return events.APIGatewayProxyRequest{}, err
+	}
+
+	// API Gateway's resource is the route's path, without its method
+	resource := r.Pattern
+	if _, path, ok := strings.Cut(resource, " "); ok {
+		resource = path
+	}
+
+	request := events.APIGatewayProxyRequest{
+		Resource:              resource,
+		Path:                  r.URL.Path,
+		HTTPMethod:            r.Method,
+		Headers:               make(map[string]string),
+		MultiValueHeaders:     r.Header,
+		QueryStringParameters: make(map[string]string),
+		PathParameters:        make(map[string]string),
+		Body:                  string(body),
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  uuid.NewString(),
+			HTTPMethod: r.Method,
+			Path:       r.URL.Path,
+		},
+	}
+	for name, values := range r.Header {
+		request.Headers[name] = values[0]
+	}
+	for name, values := range r.URL.Query() {
+		request.QueryStringParameters[name] = values[0]
+	}
+	for _, name := range names {
+		request.PathParameters[name] = r.PathValue(name)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if binaryMediaTypes[mediaType] {
+		request.Body = base64.StdEncoding.EncodeToString(body)
+		request.IsBase64Encoded = true
+	}
+
+	accountID := r.Header.Get(AccountHeader)
+	if accountID == "" {
+		accountID = DefaultAccountID
+	}
+	request.RequestContext.Authorizer = map[string]any{
+		"claims": map[string]any{"sub": accountID},
+	}
+	request.RequestContext.Identity.UserArn = r.Header.Get(PrincipalHeader)
+	return request, nil
+}
+
+// writeResponse writes a handler's response, which is converted to an API
+// Gateway proxy response through JSON as the Lambda runtime does
+func writeResponse(w http.ResponseWriter, resp any) {
+	var proxy events.APIGatewayProxyResponse
+	encoded, err := json.Marshal(resp)
+	if err == nil {
+		err = json.Unmarshal(encoded, &proxy)
+	}
+	if err != nil {
+		http.Error(w, "invalid handler response", http.StatusBadGateway)
+		return
+	}
+
+	body := []byte(proxy.Body)
+	if proxy.IsBase64Encoded {
+		if body, err = base64.StdEncoding.DecodeString(proxy.Body); err != nil {
+			http.Error(w, "invalid base64 response body", http.StatusBadGateway)
+			return
+		}
+	}
+	for name, value := range proxy.Headers {
+		w.Header().Set(name, value)
+	}
+	for name, values := range proxy.MultiValueHeaders {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.WriteHeader(proxy.StatusCode)
+	_, _ = w.Write(body)
+}
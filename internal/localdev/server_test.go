@@ -0,0 +1,90 @@
+package localdev
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// testResponse has the JSON fields of the commands' Response types
+type testResponse struct {
+	StatusCode      int               `json:"statusCode"`
+	Headers         map[string]string `json:"headers"`
+	Body            string            `json:"body"`
+	IsBase64Encoded bool              `json:"isBase64Encoded,omitempty"`
+}
+
+func TestHandler_ConvertsRequestAndResponse(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	handler := func(ctx context.Context, request events.APIGatewayProxyRequest) (testResponse, error) {
+		got = request
+		return testResponse{StatusCode: 201, Headers: map[string]string{"Content-Type": "application/json"}, Body: `{"ok":true}`}, nil
+	}
+	mux := http.NewServeMux()
+	mux.Handle("POST /download/{accountId}/{blobId}", Handler("POST /download/{accountId}/{blobId}", handler))
+
+	request := httptest.NewRequest("POST", "/download/user-123/blob-1?name=a.txt", strings.NewReader(`{"using":[]}`))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(AccountHeader, "user-123")
+	recorder := httptest.NewRecorder()
+	mux.ServeHTTP(recorder, request)
+
+	if recorder.Code != 201 || recorder.Body.String() != `{"ok":true}` || recorder.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response: %d %v %s", recorder.Code, recorder.Header(), recorder.Body.String())
+	}
+	if got.HTTPMethod != "POST" || got.Resource != "/download/{accountId}/{blobId}" || got.Body != `{"using":[]}` || got.IsBase64Encoded {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if got.PathParameters["accountId"] != "user-123" || got.PathParameters["blobId"] != "blob-1" {
+		t.Errorf("expected path parameters, got %v", got.PathParameters)
+	}
+	if got.QueryStringParameters["name"] != "a.txt" || got.Headers["Content-Type"] != "application/json" {
+		t.Errorf("expected query string and headers, got %v %v", got.QueryStringParameters, got.Headers)
+	}
+	claims := got.RequestContext.Authorizer["claims"].(map[string]any)
+	if claims["sub"] != "user-123" || got.RequestContext.RequestID == "" {
+		t.Errorf("expected authenticated request with an ID, got %+v", got.RequestContext)
+	}
+}
+
+func TestHandler_BinaryBodies(t *testing.T) {
+	var got events.APIGatewayProxyRequest
+	handler := func(ctx context.Context, request events.APIGatewayProxyRequest) (testResponse, error) {
+		got = request
+		return testResponse{StatusCode: 200, Body: base64.StdEncoding.EncodeToString([]byte{0xff, 0x00}), IsBase64Encoded: true}, nil
+	}
+
+	request := httptest.NewRequest("POST", "/upload/user-123", strings.NewReader("\xff\x00"))
+	request.Header.Set("Content-Type", "application/octet-stream")
+	recorder := httptest.NewRecorder()
+	Handler("POST /upload/{accountId}", handler).ServeHTTP(recorder, request)
+
+	if !got.IsBase64Encoded || got.Body != base64.StdEncoding.EncodeToString([]byte{0xff, 0x00}) {
+		t.Errorf("expected base64-encoded request body, got %+v", got)
+	}
+	if claims := got.RequestContext.Authorizer["claims"].(map[string]any); claims["sub"] != DefaultAccountID {
+		t.Errorf("expected default account, got %v", claims["sub"])
+	}
+	if recorder.Body.String() != "\xff\x00" {
+		t.Errorf("expected decoded response body, got %q", recorder.Body.String())
+	}
+}
+
+func TestHandler_Error(t *testing.T) {
+	handler := func(ctx context.Context, request events.APIGatewayProxyRequest) (testResponse, error) {
+		return testResponse{}, errors.New("boom")
+	}
+
+	recorder := httptest.NewRecorder()
+	Handler("GET /health/ready", handler).ServeHTTP(recorder, httptest.NewRequest("GET", "/health/ready", nil))
+
+	if recorder.Code != http.StatusBadGateway {
+		t.Errorf("expected 502 for a handler error, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,161 @@
+// Package loglevel provides the service's loggers with a log level that can
+// change while a Lambda is running.
+//
+// The level starts from LOG_LEVEL (DEBUG, INFO, WARN or ERROR, default INFO).
+// Configure optionally re-reads it from an SSM parameter on an interval, and
+// allows listed principals to turn on debug logging for a single request
+// with the X-Debug-Log header.
+package loglevel
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/auth"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// DebugHeader requests debug logging for one request. Any value other than
+// empty, "0" or "false" turns it on.
+const DebugHeader = "X-Debug-Log"
+
+// Level is the level shared by all loggers created by New
+var Level = levelFromEnv()
+
+// debugPrincipals are the callers allowed to use DebugHeader
+var (
+	debugPrincipalsMu sync.RWMutex
+	debugPrincipals   []string
+)
+
+type debugKey struct{}
+
+// New creates a structured JSON logger writing to stdout at Level
+func New() *slog.Logger {
+	return NewWithOutput(os.Stdout)
+}
+
+// NewWithOutput creates a structured JSON logger writing to w at Level
+func NewWithOutput(w io.Writer) *slog.Logger {
+	return slog.New(&handler{
+		next: slog.NewJSONHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}),
+	})
+}
+
+// ParseLevel parses a level name. ok is false for an unknown name.
+func ParseLevel(value string) (level slog.Level, ok bool) {
+	switch strings.ToUpper(strings.TrimSpace(value)) {
+	case "DEBUG":
+		return slog.LevelDebug, true
+	case "INFO":
+		return slog.LevelInfo, true
+	case "WARN", "WARNING":
+		return slog.LevelWarn, true
+	case "ERROR":
+		return slog.LevelError, true
+	default:
+		return slog.LevelInfo, false
+	}
+}
+
+// levelFromEnv creates the shared level from LOG_LEVEL
+func levelFromEnv() *slog.LevelVar {
+	level := new(slog.LevelVar)
+	if parsed, ok := ParseLevel(os.Getenv("LOG_LEVEL")); ok {
+		level.Set(parsed)
+	}
+	return level
+}
+
+// WithDebug returns a context whose log records are written at debug level,
+// whatever Level is
+func WithDebug(ctx context.Context) context.Context {
+	return context.WithValue(ctx, debugKey{}, true)
+}
+
+// DebugEnabled reports whether ctx was created by WithDebug
+func DebugEnabled(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	enabled, _ := ctx.Value(debugKey{}).(bool)
+	return enabled
+}
+
+// SetDebugPrincipals sets the callers allowed to use DebugHeader: Cognito
+// subs, or IAM role or user ARNs
+func SetDebugPrincipals(principals []string) {
+	debugPrincipalsMu.Lock()
+	defer debugPrincipalsMu.Unlock()
+	debugPrincipals = principals
+}
+
+// RequestContext returns a context with debug logging when the request asks
+// for it with DebugHeader and its caller is an allowed debug principal.
+// Otherwise ctx is returned unchanged.
+func RequestContext(ctx context.Context, request events.APIGatewayProxyRequest) context.Context {
+	if !debugRequested(request.Headers) {
+		return ctx
+	}
+
+	debugPrincipalsMu.RLock()
+	allowed := debugPrincipals
+	debugPrincipalsMu.RUnlock()
+	if len(allowed) == 0 {
+		return ctx
+	}
+
+	if plugin.IsAllowedARN(allowed, request.RequestContext.Identity.UserArn) {
+		return WithDebug(ctx)
+	}
+	if sub, err := auth.AccountIDFromAuthorizer(request.RequestContext.Authorizer, "sub"); err == nil {
+		for _, principal := range allowed {
+			if principal == sub {
+				return WithDebug(ctx)
+			}
+		}
+	}
+	return ctx
+}
+
+// debugRequested reports whether the headers carry a true DebugHeader
+func debugRequested(headers map[string]string) bool {
+	for name, value := range headers {
+		if strings.EqualFold(name, DebugHeader) {
+			value = strings.ToLower(strings.TrimSpace(value))
+			return value != "" && value != "0" && value != "false"
+		}
+	}
+	return false
+}
+
+// handler filters records by Level, or lets everything through for
+// contexts created by WithDebug, and adds the context's correlation ID
+type handler struct {
+	next slog.Handler
+}
+
+func (h *handler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= Level.Level() || DebugEnabled(ctx)
+}
+
+func (h *handler) Handle(ctx context.Context, record slog.Record) error {
+	if id := correlation.FromContext(ctx); id != "" {
+		record.AddAttrs(slog.String("correlation_id", id))
+	}
+	return h.next.Handle(ctx, record)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &handler{next: h.next.WithAttrs(attrs)}
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{next: h.next.WithGroup(name)}
+}
@@ -0,0 +1,158 @@
+package loglevel
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+)
+
+// setLevel sets Level for one test
+func setLevel(t *testing.T, level slog.Level) {
+	t.Helper()
+	previous := Level.Level()
+	Level.Set(level)
+	t.Cleanup(func() { Level.Set(previous) })
+}
+
+// setDebugPrincipals sets the debug principals for one test
+func setDebugPrincipals(t *testing.T, principals []string) {
+	t.Helper()
+	SetDebugPrincipals(principals)
+	t.Cleanup(func() { SetDebugPrincipals(nil) })
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		value string
+		level slog.Level
+		ok    bool
+	}{
+		{"DEBUG", slog.LevelDebug, true},
+		{"debug", slog.LevelDebug, true},
+		{" info ", slog.LevelInfo, true},
+		{"WARNING", slog.LevelWarn, true},
+		{"ERROR", slog.LevelError, true},
+		{"", slog.LevelInfo, false},
+		{"verbose", slog.LevelInfo, false},
+	}
+	for _, tt := range tests {
+		level, ok := ParseLevel(tt.value)
+		if level != tt.level || ok != tt.ok {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v, %v", tt.value, level, ok, tt.level, tt.ok)
+		}
+	}
+}
+
+func TestLogger_FollowsLevel(t *testing.T) {
+	setLevel(t, slog.LevelInfo)
+	var buf bytes.Buffer
+	logger := NewWithOutput(&buf)
+
+	logger.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("expected debug record to be dropped at INFO, got %s", buf.String())
+	}
+
+	Level.Set(slog.LevelDebug)
+	logger.Debug("shown")
+	if !bytes.Contains(buf.Bytes(), []byte("shown")) {
+		t.Errorf("expected debug record after level change, got %s", buf.String())
+	}
+}
+
+func TestLogger_DebugContext(t *testing.T) {
+	setLevel(t, slog.LevelWarn)
+	var buf bytes.Buffer
+	logger := NewWithOutput(&buf).With(slog.String("component", "test"))
+
+	logger.InfoContext(context.Background(), "hidden")
+	logger.DebugContext(WithDebug(context.Background()), "shown")
+
+	if bytes.Contains(buf.Bytes(), []byte("hidden")) {
+		t.Error("expected info record to be dropped at WARN")
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("shown")) || !bytes.Contains(buf.Bytes(), []byte(`"component":"test"`)) {
+		t.Errorf("expected debug record with attributes, got %s", buf.String())
+	}
+}
+
+func TestLogger_CorrelationID(t *testing.T) {
+	setLevel(t, slog.LevelInfo)
+	var buf bytes.Buffer
+	logger := NewWithOutput(&buf)
+
+	logger.InfoContext(correlation.WithID(context.Background(), "abc-123"), "correlated")
+	logger.InfoContext(context.Background(), "uncorrelated")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("expected two records, got %s", buf.String())
+	}
+	if !bytes.Contains(lines[0], []byte(`"correlation_id":"abc-123"`)) {
+		t.Errorf("expected correlation ID on record, got %s", lines[0])
+	}
+	if bytes.Contains(lines[1], []byte("correlation_id")) {
+		t.Errorf("expected no correlation ID without one in context, got %s", lines[1])
+	}
+}
+
+func TestRequestContext(t *testing.T) {
+	setDebugPrincipals(t, []string{"user-123", "arn:aws:iam::123456789012:role/Operator"})
+
+	cognito := func(sub string, headers map[string]string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			Headers: headers,
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Authorizer: map[string]any{"claims": map[string]any{"sub": sub}},
+			},
+		}
+	}
+	iam := func(arn string, headers map[string]string) events.APIGatewayProxyRequest {
+		return events.APIGatewayProxyRequest{
+			Headers: headers,
+			RequestContext: events.APIGatewayProxyRequestContext{
+				Identity: events.APIGatewayRequestIdentity{UserArn: arn},
+			},
+		}
+	}
+	debug := map[string]string{"x-debug-log": "1"}
+
+	tests := []struct {
+		name    string
+		request events.APIGatewayProxyRequest
+		want    bool
+	}{
+		{"allowed sub", cognito("user-123", debug), true},
+		{"allowed assumed role", iam("arn:aws:sts::123456789012:assumed-role/Operator/session", debug), true},
+		{"other sub", cognito("user-456", debug), false},
+		{"other role", iam("arn:aws:sts::123456789012:assumed-role/Other/session", debug), false},
+		{"no header", cognito("user-123", nil), false},
+		{"header false", cognito("user-123", map[string]string{"X-Debug-Log": "false"}), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := RequestContext(context.Background(), tt.request)
+			if got := DebugEnabled(ctx); got != tt.want {
+				t.Errorf("DebugEnabled = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequestContext_NoPrincipals(t *testing.T) {
+	setDebugPrincipals(t, nil)
+
+	request := events.APIGatewayProxyRequest{
+		Headers: map[string]string{DebugHeader: "true"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
+	}
+	if DebugEnabled(RequestContext(context.Background(), request)) {
+		t.Error("expected no debug logging when no principals are allowed")
+	}
+}
@@ -0,0 +1,121 @@
+package loglevel
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// DefaultRefreshInterval is how often the level parameter is re-read when
+// LOG_LEVEL_REFRESH_SECONDS is not set
+const DefaultRefreshInterval = time.Minute
+
+// ParameterReader reads a parameter from SSM Parameter Store
+type ParameterReader interface {
+	GetParameter(ctx context.Context, name string) (string, error)
+}
+
+// SSMParameterReader implements ParameterReader using AWS SSM
+type SSMParameterReader struct {
+	client *ssm.Client
+}
+
+// NewSSMParameterReader creates a new SSMParameterReader
+func NewSSMParameterReader(client *ssm.Client) *SSMParameterReader {
+	return &SSMParameterReader{client: client}
+}
+
+// GetParameter retrieves a parameter from SSM
+func (r *SSMParameterReader) GetParameter(ctx context.Context, name string) (string, error) {
+	result, err := r.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name: aws.String(name),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.ToString(result.Parameter.Value), nil
+}
+
+// Configure applies the logging environment: LOG_DEBUG_PRINCIPALS, a
+// comma-separated list of callers allowed to use DebugHeader, and
+// LOG_LEVEL_PARAMETER, an SSM parameter holding a level name that is re-read
+// every LOG_LEVEL_REFRESH_SECONDS. Both are optional.
+func Configure(ctx context.Context, config aws.Config) error {
+	var principals []string
+	for _, principal := range strings.Split(os.Getenv("LOG_DEBUG_PRINCIPALS"), ",") {
+		if principal = strings.TrimSpace(principal); principal != "" {
+			principals = append(principals, principal)
+		}
+	}
+	SetDebugPrincipals(principals)
+
+	parameterName := os.Getenv("LOG_LEVEL_PARAMETER")
+	if parameterName == "" {
+		return nil
+	}
+	interval := DefaultRefreshInterval
+	if value := os.Getenv("LOG_LEVEL_REFRESH_SECONDS"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 1 {
+			return fmt.Errorf("invalid LOG_LEVEL_REFRESH_SECONDS %q", value)
+		}
+		interval = time.Duration(seconds) * time.Second
+	}
+
+	Watch(ctx, NewSSMParameterReader(ssm.NewFromConfig(config)), parameterName, interval, New())
+	return nil
+}
+
+// Watch sets Level from the named parameter, then re-reads it every interval
+// until ctx is done. A Lambda's goroutines are paused between invocations, so
+// a change is picked up by the first invocation after the interval. Failed
+// reads and unknown level names leave Level unchanged.
+func Watch(ctx context.Context, reader ParameterReader, name string, interval time.Duration, logger *slog.Logger) {
+	refresh(ctx, reader, name, logger)
+
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				refresh(ctx, reader, name, logger)
+			}
+		}
+	}()
+}
+
+// refresh reads the level parameter once
+func refresh(ctx context.Context, reader ParameterReader, name string, logger *slog.Logger) {
+	value, err := reader.GetParameter(ctx, name)
+	if err != nil {
+		logger.WarnContext(ctx, "Failed to read log level parameter",
+			slog.String("parameter", name),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	level, ok := ParseLevel(value)
+	if !ok {
+		logger.WarnContext(ctx, "Unknown log level in parameter",
+			slog.String("parameter", name),
+			slog.String("value", value),
+		)
+		return
+	}
+	if level != Level.Level() {
+		Level.Set(level)
+		logger.WarnContext(ctx, "Log level changed",
+			slog.String("level", level.String()),
+		)
+	}
+}
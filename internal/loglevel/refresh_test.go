@@ -0,0 +1,108 @@
+package loglevel
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// mockParameterReader returns the values in turn, repeating the last
+type mockParameterReader struct {
+	mu     sync.Mutex
+	values []string
+	err    error
+	reads  int
+}
+
+func (m *mockParameterReader) GetParameter(ctx context.Context, name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reads++
+	if m.err != nil {
+		return "", m.err
+	}
+	value := m.values[0]
+	if len(m.values) > 1 {
+		m.values = m.values[1:]
+	}
+	return value, nil
+}
+
+var discardLogger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+
+func TestWatch_SetsLevelImmediately(t *testing.T) {
+	setLevel(t, slog.LevelInfo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	Watch(ctx, &mockParameterReader{values: []string{"DEBUG"}}, "/jmap/log-level", time.Hour, discardLogger)
+
+	if Level.Level() != slog.LevelDebug {
+		t.Errorf("expected DEBUG after first read, got %v", Level.Level())
+	}
+}
+
+func TestWatch_RereadsOnInterval(t *testing.T) {
+	setLevel(t, slog.LevelInfo)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	Watch(ctx, &mockParameterReader{values: []string{"INFO", "ERROR"}}, "/jmap/log-level", time.Millisecond, discardLogger)
+
+	deadline := time.Now().Add(time.Second)
+	for Level.Level() != slog.LevelError {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected ERROR after refresh, got %v", Level.Level())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestWatch_KeepsLevelOnFailure(t *testing.T) {
+	setLevel(t, slog.LevelWarn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	Watch(ctx, &mockParameterReader{err: errors.New("throttled")}, "/jmap/log-level", time.Hour, discardLogger)
+	Watch(ctx, &mockParameterReader{values: []string{"LOUD"}}, "/jmap/log-level", time.Hour, discardLogger)
+
+	if Level.Level() != slog.LevelWarn {
+		t.Errorf("expected level to stay WARN, got %v", Level.Level())
+	}
+}
+
+func TestConfigure_InvalidRefreshSeconds(t *testing.T) {
+	t.Setenv("LOG_LEVEL_PARAMETER", "/jmap/log-level")
+	t.Setenv("LOG_LEVEL_REFRESH_SECONDS", "soon")
+	t.Cleanup(func() { SetDebugPrincipals(nil) })
+
+	if err := Configure(context.Background(), aws.Config{}); err == nil {
+		t.Error("expected error for invalid refresh interval")
+	}
+}
+
+func TestConfigure_DebugPrincipals(t *testing.T) {
+	t.Setenv("LOG_LEVEL_PARAMETER", "")
+	t.Setenv("LOG_DEBUG_PRINCIPALS", " user-123 , ,arn:aws:iam::123456789012:role/Operator")
+	t.Cleanup(func() { SetDebugPrincipals(nil) })
+
+	if err := Configure(context.Background(), aws.Config{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	request := events.APIGatewayProxyRequest{
+		Headers: map[string]string{DebugHeader: "1"},
+		RequestContext: events.APIGatewayProxyRequestContext{
+			Authorizer: map[string]any{"claims": map[string]any{"sub": "user-123"}},
+		},
+	}
+	if !DebugEnabled(RequestContext(context.Background(), request)) {
+		t.Error("expected listed principal to get debug logging")
+	}
+}
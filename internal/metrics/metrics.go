@@ -0,0 +1,261 @@
+// Package metrics writes CloudWatch metrics in the embedded metric format
+// (EMF). EMF records are JSON log lines that CloudWatch Logs turns into
+// metrics, so Lambdas publish metrics without calling PutMetricData.
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Dimension names on method call metrics
+const (
+	DimensionMethod    = "Method"
+	DimensionPlugin    = "Plugin"
+	DimensionErrorType = "ErrorType"
+	DimensionFunction  = "Function"
+	DimensionTarget    = "Target"
+	DimensionQueue     = "Queue"
+	DimensionSource    = "Source"
+)
+
+// CorePlugin is the Plugin dimension of methods core handles itself
+const CorePlugin = "core"
+
+// MethodCall is the outcome of one JMAP method call
+type MethodCall struct {
+	Method        string
+	Plugin        string
+	ErrorType     string // empty for a successful call
+	Latency       time.Duration
+	RequestBytes  int
+	ResponseBytes int
+}
+
+// CleanupRun is the outcome of one invocation of a cleanup Lambda
+type CleanupRun struct {
+	Function           string
+	Scanned            int
+	Cleaned            int
+	Errored            int
+	QuotaRestoredBytes int64
+}
+
+// PluginLatency is one instance's plugin latency statistics for an invoke
+// target since it last published them
+type PluginLatency struct {
+	Target string
+	Calls  int
+	Errors int
+	P50    float64 // milliseconds
+	P90    float64
+	P99    float64
+}
+
+// DLQRedrive is the outcome of one dlq-redrive run over a dead letter queue
+type DLQRedrive struct {
+	Queue    string
+	Received int
+	Redriven int
+	Retained int // failed again and left for the next run
+	Parked   int
+}
+
+// RegistryLoad is how long an instance took to load the plugin registry, and
+// how many plugin records it holds
+type RegistryLoad struct {
+	Function string
+	Source   string // where it was loaded from: dynamodb or snapshot
+	Items    int
+	Duration time.Duration
+}
+
+// metricDefinition names a metric and its unit in an EMF directive
+type metricDefinition struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+// directive tells CloudWatch which fields of a record are metrics, and with
+// which dimensions
+type directive struct {
+	Namespace  string             `json:"Namespace"`
+	Dimensions [][]string         `json:"Dimensions"`
+	Metrics    []metricDefinition `json:"Metrics"`
+}
+
+// methodCallMetrics are published per method and plugin
+var methodCallMetrics = []metricDefinition{
+	{Name: "Invocations", Unit: "Count"},
+	{Name: "Errors", Unit: "Count"},
+	{Name: "Latency", Unit: "Milliseconds"},
+	{Name: "RequestSize", Unit: "Bytes"},
+	{Name: "ResponseSize", Unit: "Bytes"},
+}
+
+// cleanupRunMetrics are published per cleanup function
+var cleanupRunMetrics = []metricDefinition{
+	{Name: "ItemsScanned", Unit: "Count"},
+	{Name: "ItemsCleaned", Unit: "Count"},
+	{Name: "ItemsErrored", Unit: "Count"},
+	{Name: "QuotaRestoredBytes", Unit: "Bytes"},
+}
+
+// pluginLatencyMetrics are published per invoke target
+var pluginLatencyMetrics = []metricDefinition{
+	{Name: "PluginCalls", Unit: "Count"},
+	{Name: "PluginErrors", Unit: "Count"},
+	{Name: "PluginLatencyP50", Unit: "Milliseconds"},
+	{Name: "PluginLatencyP90", Unit: "Milliseconds"},
+	{Name: "PluginLatencyP99", Unit: "Milliseconds"},
+}
+
+// dlqRedriveMetrics are published per dead letter queue
+var dlqRedriveMetrics = []metricDefinition{
+	{Name: "DLQMessagesReceived", Unit: "Count"},
+	{Name: "DLQMessagesRedriven", Unit: "Count"},
+	{Name: "DLQMessagesRetained", Unit: "Count"},
+	{Name: "DLQMessagesParked", Unit: "Count"},
+}
+
+// registryLoadMetrics are published per function and load source
+var registryLoadMetrics = []metricDefinition{
+	{Name: "RegistryItems", Unit: "Count"},
+	{Name: "RegistryLoadTime", Unit: "Milliseconds"},
+}
+
+// EMF writes EMF records, one per line
+type EMF struct {
+	w         io.Writer
+	namespace string
+	now       func() time.Time
+
+	mu sync.Mutex
+}
+
+// NewEMF creates an EMF writing records for namespace to w. In Lambda, w is
+// os.Stdout.
+func NewEMF(w io.Writer, namespace string) *EMF {
+	return &EMF{
+		w:         w,
+		namespace: namespace,
+		now:       time.Now,
+	}
+}
+
+// RecordMethodCall writes the metrics for a method call. Every call counts
+// towards Invocations, Latency and the sizes by method and plugin; failed
+// calls also count towards Errors by method, plugin and error type.
+func (e *EMF) RecordMethodCall(call MethodCall) {
+	errors := 0
+	directives := []directive{{
+		Namespace:  e.namespace,
+		Dimensions: [][]string{{DimensionMethod, DimensionPlugin}},
+		Metrics:    methodCallMetrics,
+	}}
+	record := map[string]any{
+		DimensionMethod: call.Method,
+		DimensionPlugin: call.Plugin,
+		"Invocations":   1,
+		"Latency":       float64(call.Latency.Microseconds()) / 1000,
+		"RequestSize":   call.RequestBytes,
+		"ResponseSize":  call.ResponseBytes,
+	}
+	if call.ErrorType != "" {
+		errors = 1
+		record[DimensionErrorType] = call.ErrorType
+		directives = append(directives, directive{
+			Namespace:  e.namespace,
+			Dimensions: [][]string{{DimensionMethod, DimensionPlugin, DimensionErrorType}},
+			Metrics:    []metricDefinition{{Name: "Errors", Unit: "Count"}},
+		})
+	}
+	record["Errors"] = errors
+	e.write(record, directives)
+}
+
+// RecordCleanupRun writes the metrics for a cleanup run by function, so
+// alarms can catch cleanup falling behind or failing
+func (e *EMF) RecordCleanupRun(run CleanupRun) {
+	e.write(map[string]any{
+		DimensionFunction:    run.Function,
+		"ItemsScanned":       run.Scanned,
+		"ItemsCleaned":       run.Cleaned,
+		"ItemsErrored":       run.Errored,
+		"QuotaRestoredBytes": run.QuotaRestoredBytes,
+	}, []directive{{
+		Namespace:  e.namespace,
+		Dimensions: [][]string{{DimensionFunction}},
+		Metrics:    cleanupRunMetrics,
+	}})
+}
+
+// RecordPluginLatency writes an instance's latency statistics for a plugin
+// invoke target, so slow plugins can be graphed and alarmed on
+func (e *EMF) RecordPluginLatency(latency PluginLatency) {
+	e.write(map[string]any{
+		DimensionTarget:    latency.Target,
+		"PluginCalls":      latency.Calls,
+		"PluginErrors":     latency.Errors,
+		"PluginLatencyP50": latency.P50,
+		"PluginLatencyP90": latency.P90,
+		"PluginLatencyP99": latency.P99,
+	}, []directive{{
+		Namespace:  e.namespace,
+		Dimensions: [][]string{{DimensionTarget}},
+		Metrics:    pluginLatencyMetrics,
+	}})
+}
+
+// RecordDLQRedrive writes the metrics for a redrive run by queue, so parked
+// messages, which need an operator, can be alarmed on
+func (e *EMF) RecordDLQRedrive(run DLQRedrive) {
+	e.write(map[string]any{
+		DimensionQueue:        run.Queue,
+		"DLQMessagesReceived": run.Received,
+		"DLQMessagesRedriven": run.Redriven,
+		"DLQMessagesRetained": run.Retained,
+		"DLQMessagesParked":   run.Parked,
+	}, []directive{{
+		Namespace:  e.namespace,
+		Dimensions: [][]string{{DimensionQueue}},
+		Metrics:    dlqRedriveMetrics,
+	}})
+}
+
+// RecordRegistryLoad writes the metrics for a plugin registry load by
+// function and source, so registry growth and its cost to cold starts are
+// visible
+func (e *EMF) RecordRegistryLoad(load RegistryLoad) {
+	e.write(map[string]any{
+		DimensionFunction:  load.Function,
+		DimensionSource:    load.Source,
+		"RegistryItems":    load.Items,
+		"RegistryLoadTime": float64(load.Duration.Microseconds()) / 1000,
+	}, []directive{{
+		Namespace:  e.namespace,
+		Dimensions: [][]string{{DimensionFunction, DimensionSource}},
+		Metrics:    registryLoadMetrics,
+	}})
+}
+
+// write adds the EMF metadata to a record and writes it as one line
+func (e *EMF) write(record map[string]any, directives []directive) {
+	record["_aws"] = map[string]any{
+		"Timestamp":         e.now().UnixMilli(),
+		"CloudWatchMetrics": directives,
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+
+	// Keep concurrent method calls' records on separate lines
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, _ = e.w.Write(line)
+}
@@ -0,0 +1,179 @@
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("invalid EMF line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestRecordMethodCall_Success(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+	emf.now = func() time.Time { return time.UnixMilli(1700000000000) }
+
+	emf.RecordMethodCall(MethodCall{
+		Method:        "Email/get",
+		Plugin:        "mail-core",
+		Latency:       1500 * time.Microsecond,
+		RequestBytes:  40,
+		ResponseBytes: 900,
+	})
+
+	records := decodeRecords(t, &buf)
+	if len(records) != 1 {
+		t.Fatalf("expected one record, got %d", len(records))
+	}
+	record := records[0]
+	if record["Method"] != "Email/get" || record["Plugin"] != "mail-core" {
+		t.Errorf("unexpected dimensions %v", record)
+	}
+	if record["Invocations"] != 1.0 || record["Errors"] != 0.0 || record["Latency"] != 1.5 {
+		t.Errorf("unexpected metric values %v", record)
+	}
+	if record["RequestSize"] != 40.0 || record["ResponseSize"] != 900.0 {
+		t.Errorf("unexpected sizes %v", record)
+	}
+	if _, ok := record["ErrorType"]; ok {
+		t.Error("expected no ErrorType for a successful call")
+	}
+
+	meta := record["_aws"].(map[string]any)
+	if meta["Timestamp"] != 1700000000000.0 {
+		t.Errorf("unexpected timestamp %v", meta["Timestamp"])
+	}
+	directives := meta["CloudWatchMetrics"].([]any)
+	if len(directives) != 1 {
+		t.Fatalf("expected one directive, got %v", directives)
+	}
+	first := directives[0].(map[string]any)
+	if first["Namespace"] != "JMAPService/test" {
+		t.Errorf("unexpected namespace %v", first["Namespace"])
+	}
+	if !reflect.DeepEqual(first["Dimensions"], []any{[]any{"Method", "Plugin"}}) {
+		t.Errorf("unexpected dimensions %v", first["Dimensions"])
+	}
+}
+
+func TestRecordMethodCall_ErrorAddsErrorTypeDirective(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordMethodCall(MethodCall{Method: "Email/get", Plugin: "mail-core", ErrorType: "serverFail"})
+
+	record := decodeRecords(t, &buf)[0]
+	if record["Errors"] != 1.0 || record["ErrorType"] != "serverFail" {
+		t.Errorf("unexpected error metrics %v", record)
+	}
+	directives := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	if len(directives) != 2 {
+		t.Fatalf("expected two directives, got %v", directives)
+	}
+	byType := directives[1].(map[string]any)
+	if !reflect.DeepEqual(byType["Dimensions"], []any{[]any{"Method", "Plugin", "ErrorType"}}) {
+		t.Errorf("unexpected dimensions %v", byType["Dimensions"])
+	}
+}
+
+func TestRecordMethodCall_OneRecordPerLine(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordMethodCall(MethodCall{Method: "Email/get", Plugin: "mail-core"})
+	emf.RecordMethodCall(MethodCall{Method: "Mailbox/get", Plugin: "mail-core"})
+
+	if records := decodeRecords(t, &buf); len(records) != 2 {
+		t.Errorf("expected two records, got %d", len(records))
+	}
+}
+
+func TestRecordCleanupRun(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordCleanupRun(CleanupRun{Function: "blob-cleanup", Scanned: 5, Cleaned: 3, Errored: 1, QuotaRestoredBytes: 4096})
+
+	record := decodeRecords(t, &buf)[0]
+	if record["Function"] != "blob-cleanup" {
+		t.Errorf("unexpected dimension %v", record)
+	}
+	if record["ItemsScanned"] != 5.0 || record["ItemsCleaned"] != 3.0 || record["ItemsErrored"] != 1.0 || record["QuotaRestoredBytes"] != 4096.0 {
+		t.Errorf("unexpected metric values %v", record)
+	}
+	directives := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	if !reflect.DeepEqual(directives[0].(map[string]any)["Dimensions"], []any{[]any{"Function"}}) {
+		t.Errorf("unexpected dimensions %v", directives)
+	}
+}
+
+func TestRecordPluginLatency(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordPluginLatency(PluginLatency{Target: "arn:aws:lambda:us-east-1:123456789012:function:mail", Calls: 10, Errors: 1, P50: 12.5, P90: 40, P99: 250})
+
+	record := decodeRecords(t, &buf)[0]
+	if record["Target"] != "arn:aws:lambda:us-east-1:123456789012:function:mail" {
+		t.Errorf("unexpected dimension %v", record)
+	}
+	if record["PluginCalls"] != 10.0 || record["PluginErrors"] != 1.0 || record["PluginLatencyP50"] != 12.5 || record["PluginLatencyP99"] != 250.0 {
+		t.Errorf("unexpected metric values %v", record)
+	}
+	directives := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	if !reflect.DeepEqual(directives[0].(map[string]any)["Dimensions"], []any{[]any{"Target"}}) {
+		t.Errorf("unexpected dimensions %v", directives)
+	}
+}
+
+func TestRecordDLQRedrive(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordDLQRedrive(DLQRedrive{Queue: "blob-confirm", Received: 4, Redriven: 2, Retained: 1, Parked: 1})
+
+	record := decodeRecords(t, &buf)[0]
+	if record["Queue"] != "blob-confirm" {
+		t.Errorf("unexpected dimension %v", record)
+	}
+	if record["DLQMessagesReceived"] != 4.0 || record["DLQMessagesRedriven"] != 2.0 || record["DLQMessagesRetained"] != 1.0 || record["DLQMessagesParked"] != 1.0 {
+		t.Errorf("unexpected metric values %v", record)
+	}
+	directives := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	if !reflect.DeepEqual(directives[0].(map[string]any)["Dimensions"], []any{[]any{"Queue"}}) {
+		t.Errorf("unexpected dimensions %v", directives)
+	}
+}
+
+func TestRecordRegistryLoad(t *testing.T) {
+	var buf bytes.Buffer
+	emf := NewEMF(&buf, "JMAPService/test")
+
+	emf.RecordRegistryLoad(RegistryLoad{Function: "jmap-api", Source: "dynamodb", Items: 7, Duration: 42500 * time.Microsecond})
+
+	record := decodeRecords(t, &buf)[0]
+	if record["Function"] != "jmap-api" || record["Source"] != "dynamodb" {
+		t.Errorf("unexpected dimensions %v", record)
+	}
+	if record["RegistryItems"] != 7.0 || record["RegistryLoadTime"] != 42.5 {
+		t.Errorf("unexpected metric values %v", record)
+	}
+	directives := record["_aws"].(map[string]any)["CloudWatchMetrics"].([]any)
+	if !reflect.DeepEqual(directives[0].(map[string]any)["Dimensions"], []any{[]any{"Function", "Source"}}) {
+		t.Errorf("unexpected dimensions %v", directives)
+	}
+}
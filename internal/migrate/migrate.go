@@ -0,0 +1,314 @@
+// Package migrate applies versioned changes to existing records in the core
+// table. A migration scans the table, optionally filtered, and updates each
+// item that needs it. Progress is checkpointed after every page in a state
+// item, so an interrupted migration resumes where it stopped, and applied
+// versions are recorded there too.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// Key of the state item recording applied migrations
+const (
+	PKConfig     = "CONFIG#"
+	SKMigrations = "MIGRATIONS#"
+)
+
+// DefaultPageSize is the number of items scanned per checkpoint
+const DefaultPageSize = 100
+
+// Migration is one versioned change to existing records. Migrate must be
+// idempotent: items can be visited again when a migration resumes from its
+// last checkpoint.
+type Migration struct {
+	Version     int
+	Description string
+
+	// Filter is a Scan filter expression selecting the items to visit, with
+	// its FilterNames and FilterValues. An empty Filter visits every item.
+	Filter       string
+	FilterNames  map[string]string
+	FilterValues map[string]types.AttributeValue
+
+	// Migrate returns the update an item needs, or nil if it needs none. A
+	// nil Migrate only records the version.
+	Migrate func(item map[string]types.AttributeValue) (*Update, error)
+}
+
+// Update is an UpdateItem expression for one item. Condition, if set, is
+// checked as well as the item still existing; an item failing it is skipped.
+type Update struct {
+	Expression string
+	Condition  string
+	Names      map[string]string
+	Values     map[string]types.AttributeValue
+}
+
+// Applied records a completed migration
+type Applied struct {
+	Version     int    `dynamodbav:"version"`
+	Description string `dynamodbav:"description"`
+	AppliedAt   string `dynamodbav:"appliedAt"`
+	Scanned     int64  `dynamodbav:"scanned"`
+	Updated     int64  `dynamodbav:"updated"`
+}
+
+// Progress is a migration's position in the table. Checkpoint is the key of
+// the last item scanned; nil before the first page.
+type Progress struct {
+	Version    int               `dynamodbav:"version"`
+	Checkpoint map[string]string `dynamodbav:"checkpoint,omitempty"`
+	Scanned    int64             `dynamodbav:"scanned"`
+	Updated    int64             `dynamodbav:"updated"`
+	StartedAt  string            `dynamodbav:"startedAt"`
+}
+
+// State is the state item
+type State struct {
+	PK      string    `dynamodbav:"pk"`
+	SK      string    `dynamodbav:"sk"`
+	Applied []Applied `dynamodbav:"applied"`
+	Current *Progress `dynamodbav:"current,omitempty"`
+}
+
+// Version returns the highest applied version, or 0
+func (s State) Version() int {
+	version := 0
+	for _, applied := range s.Applied {
+		version = max(version, applied.Version)
+	}
+	return version
+}
+
+// Validate checks migrations are numbered 1, 2, 3... in order
+func Validate(migrations []Migration) error {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return fmt.Errorf("migration %d has version %d, want %d", i, migration.Version, i+1)
+		}
+		if migration.Description == "" {
+			return fmt.Errorf("migration %d has no description", migration.Version)
+		}
+	}
+	return nil
+}
+
+// Pending returns the migrations after the state's version, up to and
+// including version to; to of 0 means all of them
+func Pending(state *State, migrations []Migration, to int) []Migration {
+	var pending []Migration
+	for _, migration := range migrations {
+		if migration.Version > state.Version() && (to == 0 || migration.Version <= to) {
+			pending = append(pending, migration)
+		}
+	}
+	return pending
+}
+
+// DynamoDBClient defines the DynamoDB operations migrations use
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// Runner applies migrations to a table
+type Runner struct {
+	client    DynamoDBClient
+	tableName string
+	pageSize  int32
+	now       func() time.Time
+}
+
+// NewRunner creates a runner scanning pageSize items per checkpoint
+func NewRunner(client DynamoDBClient, tableName string, pageSize int32) *Runner {
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	return &Runner{client: client, tableName: tableName, pageSize: pageSize, now: time.Now}
+}
+
+// LoadState reads the state item, returning an empty state if there is none
+func (r *Runner) LoadState(ctx context.Context) (*State, error) {
+	output, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(r.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: PKConfig},
+			"sk": &types.AttributeValueMemberS{Value: SKMigrations},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migration state: %w", err)
+	}
+	state := &State{PK: PKConfig, SK: SKMigrations}
+	if output.Item == nil {
+		return state, nil
+	}
+	if err := attributevalue.UnmarshalMap(output.Item, state); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal migration state: %w", err)
+	}
+	return state, nil
+}
+
+// saveState writes the state item
+func (r *Runner) saveState(ctx context.Context, state *State) error {
+	item, err := attributevalue.MarshalMap(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal migration state: %w", err)
+	}
+	if _, err := r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(r.tableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to save migration state: %w", err)
+	}
+	return nil
+}
+
+// Run applies one migration, resuming from the state's checkpoint if it was
+// interrupted, and records it as applied. With dryRun it counts the items
+// that would be updated without writing anything, recording the migration
+// in state in memory only, so the next one can be dry-run after it. onPage,
+// if set, is called with the progress after each page.
+func (r *Runner) Run(ctx context.Context, state *State, migration Migration, dryRun bool, onPage func(Progress)) (Progress, error) {
+	if migration.Version != state.Version()+1 {
+		return Progress{}, fmt.Errorf("migration %d cannot follow version %d", migration.Version, state.Version())
+	}
+
+	progress := Progress{Version: migration.Version, StartedAt: r.now().UTC().Format(time.RFC3339)}
+	if state.Current != nil && state.Current.Version == migration.Version && !dryRun {
+		progress = *state.Current
+	}
+
+	for migration.Migrate != nil {
+		input := &dynamodb.ScanInput{
+			TableName:         aws.String(r.tableName),
+			Limit:             aws.Int32(r.pageSize),
+			ExclusiveStartKey: toKey(progress.Checkpoint),
+		}
+		if migration.Filter != "" {
+			input.FilterExpression = aws.String(migration.Filter)
+			input.ExpressionAttributeNames = migration.FilterNames
+			input.ExpressionAttributeValues = migration.FilterValues
+		}
+		output, err := r.client.Scan(ctx, input)
+		if err != nil {
+			return progress, fmt.Errorf("failed to scan: %w", err)
+		}
+
+		for _, item := range output.Items {
+			progress.Scanned++
+			update, err := migration.Migrate(item)
+			if err != nil {
+				return progress, fmt.Errorf("migration %d failed on %s/%s: %w", migration.Version, stringAttr(item, "pk"), stringAttr(item, "sk"), err)
+			}
+			if update == nil {
+				continue
+			}
+			if dryRun {
+				progress.Updated++
+				continue
+			}
+			applied, err := r.apply(ctx, item, update)
+			if err != nil {
+				return progress, fmt.Errorf("failed to update %s/%s: %w", stringAttr(item, "pk"), stringAttr(item, "sk"), err)
+			}
+			if applied {
+				progress.Updated++
+			}
+		}
+
+		progress.Checkpoint = fromKey(output.LastEvaluatedKey)
+		if !dryRun {
+			state.Current = &progress
+			if err := r.saveState(ctx, state); err != nil {
+				return progress, err
+			}
+		}
+		if onPage != nil {
+			onPage(progress)
+		}
+		if progress.Checkpoint == nil {
+			break
+		}
+	}
+
+	state.Applied = append(state.Applied, Applied{
+		Version:     migration.Version,
+		Description: migration.Description,
+		AppliedAt:   r.now().UTC().Format(time.RFC3339),
+		Scanned:     progress.Scanned,
+		Updated:     progress.Updated,
+	})
+	if dryRun {
+		return progress, nil
+	}
+	state.Current = nil
+	return progress, r.saveState(ctx, state)
+}
+
+// apply updates one item, returning false if it was deleted or failed the
+// update's condition
+func (r *Runner) apply(ctx context.Context, item map[string]types.AttributeValue, update *Update) (bool, error) {
+	condition := "attribute_exists(pk)"
+	if update.Condition != "" {
+		condition += " AND (" + update.Condition + ")"
+	}
+	_, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(r.tableName),
+		Key:                       map[string]types.AttributeValue{"pk": item["pk"], "sk": item["sk"]},
+		UpdateExpression:          aws.String(update.Expression),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  update.Names,
+		ExpressionAttributeValues: update.Values,
+	})
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// fromKey flattens a table key, whose attributes are all strings, for the
+// checkpoint
+func fromKey(key map[string]types.AttributeValue) map[string]string {
+	if len(key) == 0 {
+		return nil
+	}
+	flat := make(map[string]string, len(key))
+	for name := range key {
+		flat[name] = stringAttr(key, name)
+	}
+	return flat
+}
+
+// toKey restores a checkpointed key
+func toKey(flat map[string]string) map[string]types.AttributeValue {
+	if len(flat) == 0 {
+		return nil
+	}
+	key := make(map[string]types.AttributeValue, len(flat))
+	for name, value := range flat {
+		key[name] = &types.AttributeValueMemberS{Value: value}
+	}
+	return key
+}
+
+// stringAttr returns a string attribute of an item, or ""
+func stringAttr(item map[string]types.AttributeValue, name string) string {
+	if value, ok := item[name].(*types.AttributeValueMemberS); ok {
+		return value.Value
+	}
+	return ""
+}
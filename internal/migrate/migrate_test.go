@@ -0,0 +1,270 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDynamoDB scans a fixed list of items in pages and records writes
+type mockDynamoDB struct {
+	items      []map[string]types.AttributeValue
+	state      map[string]types.AttributeValue
+	scans      []*dynamodb.ScanInput
+	updates    []*dynamodb.UpdateItemInput
+	stateSaves int
+	failScanAt int // fail the scan with this 1-based index; 0 never fails
+	conflict   string
+}
+
+func (m *mockDynamoDB) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: m.state}, nil
+}
+
+func (m *mockDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.state = params.Item
+	m.stateSaves++
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDB) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	if stringAttr(params.Key, "sk") == m.conflict {
+		return nil, &types.ConditionalCheckFailedException{Message: aws.String("conditional check failed")}
+	}
+	m.updates = append(m.updates, params)
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func (m *mockDynamoDB) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	m.scans = append(m.scans, params)
+	if len(m.scans) == m.failScanAt {
+		return nil, errors.New("throttled")
+	}
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		for i, item := range m.items {
+			if stringAttr(item, "sk") == stringAttr(params.ExclusiveStartKey, "sk") {
+				start = i + 1
+			}
+		}
+	}
+	end := min(start+int(*params.Limit), len(m.items))
+	output := &dynamodb.ScanOutput{Items: m.items[start:end]}
+	if end < len(m.items) {
+		output.LastEvaluatedKey = map[string]types.AttributeValue{"pk": m.items[end-1]["pk"], "sk": m.items[end-1]["sk"]}
+	}
+	return output, nil
+}
+
+// savedState decodes the saved state item
+func (m *mockDynamoDB) savedState(t *testing.T) State {
+	t.Helper()
+	var state State
+	if err := attributevalue.UnmarshalMap(m.state, &state); err != nil {
+		t.Fatalf("failed to unmarshal state: %v", err)
+	}
+	return state
+}
+
+// testItems returns blob-like items, some missing a "status" attribute
+func testItems() []map[string]types.AttributeValue {
+	var items []map[string]types.AttributeValue
+	for _, sk := range []string{"BLOB#a", "BLOB#b", "BLOB#c", "BLOB#d", "BLOB#e"} {
+		item := map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: "ACCOUNT#user-1"},
+			"sk": &types.AttributeValueMemberS{Value: sk},
+		}
+		if sk == "BLOB#b" {
+			item["status"] = &types.AttributeValueMemberS{Value: "pending"}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// addStatus sets status on items without one
+var addStatus = Migration{
+	Version:      1,
+	Description:  "Add status to blobs",
+	Filter:       "begins_with(sk, :blob)",
+	FilterValues: map[string]types.AttributeValue{":blob": &types.AttributeValueMemberS{Value: "BLOB#"}},
+	Migrate: func(item map[string]types.AttributeValue) (*Update, error) {
+		if _, ok := item["status"]; ok {
+			return nil, nil
+		}
+		return &Update{
+			Expression: "SET #status = :confirmed",
+			Condition:  "attribute_not_exists(#status)",
+			Names:      map[string]string{"#status": "status"},
+			Values:     map[string]types.AttributeValue{":confirmed": &types.AttributeValueMemberS{Value: "confirmed"}},
+		}, nil
+	},
+}
+
+func newTestRunner(client *mockDynamoDB) *Runner {
+	runner := NewRunner(client, "jmap-test", 2)
+	runner.now = func() time.Time { return time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC) }
+	return runner
+}
+
+func TestRun(t *testing.T) {
+	client := &mockDynamoDB{items: testItems()}
+	runner := newTestRunner(client)
+	state, err := runner.LoadState(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var pages int
+	progress, err := runner.Run(context.Background(), state, addStatus, false, func(Progress) { pages++ })
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if progress.Scanned != 5 || progress.Updated != 4 || pages != 3 {
+		t.Errorf("expected 5 scanned, 4 updated over 3 pages, got %+v over %d", progress, pages)
+	}
+	if *client.scans[0].FilterExpression != "begins_with(sk, :blob)" || *client.scans[0].Limit != 2 {
+		t.Errorf("unexpected scan %+v", client.scans[0])
+	}
+	update := client.updates[0]
+	if *update.ConditionExpression != "attribute_exists(pk) AND (attribute_not_exists(#status))" || stringAttr(update.Key, "sk") != "BLOB#a" {
+		t.Errorf("unexpected update %+v", update)
+	}
+
+	saved := client.savedState(t)
+	if saved.PK != PKConfig || saved.SK != SKMigrations || saved.Current != nil || saved.Version() != 1 {
+		t.Errorf("unexpected state %+v", saved)
+	}
+	if applied := saved.Applied[0]; applied.Description != "Add status to blobs" || applied.Updated != 4 || applied.AppliedAt != "2026-03-01T12:00:00Z" {
+		t.Errorf("unexpected applied record %+v", applied)
+	}
+}
+
+func TestRun_ResumesFromCheckpoint(t *testing.T) {
+	client := &mockDynamoDB{items: testItems(), failScanAt: 2}
+	runner := newTestRunner(client)
+	state, _ := runner.LoadState(context.Background())
+
+	if _, err := runner.Run(context.Background(), state, addStatus, false, nil); err == nil || !strings.Contains(err.Error(), "throttled") {
+		t.Fatalf("expected scan failure, got %v", err)
+	}
+	saved := client.savedState(t)
+	if saved.Current == nil || saved.Current.Checkpoint["sk"] != "BLOB#b" || saved.Current.Updated != 1 || saved.Version() != 0 {
+		t.Fatalf("expected checkpoint after the first page, got %+v", saved)
+	}
+
+	client.failScanAt = 0
+	state, _ = runner.LoadState(context.Background())
+	progress, err := runner.Run(context.Background(), state, addStatus, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stringAttr(client.scans[2].ExclusiveStartKey, "sk") != "BLOB#b" {
+		t.Errorf("expected resume after BLOB#b, got %v", client.scans[2].ExclusiveStartKey)
+	}
+	if progress.Scanned != 5 || progress.Updated != 4 || len(client.updates) != 4 {
+		t.Errorf("expected each item visited once, got %+v and %d updates", progress, len(client.updates))
+	}
+}
+
+func TestRun_DryRun(t *testing.T) {
+	client := &mockDynamoDB{items: testItems()}
+	runner := newTestRunner(client)
+	state, _ := runner.LoadState(context.Background())
+
+	progress, err := runner.Run(context.Background(), state, addStatus, true, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if progress.Updated != 4 || len(client.updates) != 0 || client.stateSaves != 0 {
+		t.Errorf("expected 4 counted and no writes, got %+v, %d updates, %d saves", progress, len(client.updates), client.stateSaves)
+	}
+
+	// The next migration can be dry-run after it
+	next := Migration{Version: 2, Description: "Record only"}
+	if _, err := runner.Run(context.Background(), state, next, true, nil); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestRun_SkipsConditionFailures(t *testing.T) {
+	client := &mockDynamoDB{items: testItems(), conflict: "BLOB#c"}
+	runner := newTestRunner(client)
+	state, _ := runner.LoadState(context.Background())
+
+	progress, err := runner.Run(context.Background(), state, addStatus, false, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if progress.Updated != 3 {
+		t.Errorf("expected 3 updated, got %d", progress.Updated)
+	}
+}
+
+func TestRun_MigrateError(t *testing.T) {
+	client := &mockDynamoDB{items: testItems()}
+	runner := newTestRunner(client)
+	state, _ := runner.LoadState(context.Background())
+	failing := Migration{Version: 1, Description: "Fail", Migrate: func(item map[string]types.AttributeValue) (*Update, error) {
+		return nil, errors.New("unexpected shape")
+	}}
+
+	_, err := runner.Run(context.Background(), state, failing, false, nil)
+	if err == nil || !strings.Contains(err.Error(), "ACCOUNT#user-1/BLOB#a") {
+		t.Errorf("expected error naming the item, got %v", err)
+	}
+}
+
+func TestRun_RecordOnly(t *testing.T) {
+	client := &mockDynamoDB{items: testItems()}
+	runner := newTestRunner(client)
+	state, _ := runner.LoadState(context.Background())
+
+	if _, err := runner.Run(context.Background(), state, Migration{Version: 1, Description: "Baseline"}, false, nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.scans) != 0 || client.savedState(t).Version() != 1 {
+		t.Errorf("expected version recorded without scanning, got %d scans", len(client.scans))
+	}
+}
+
+func TestRun_OutOfOrder(t *testing.T) {
+	runner := newTestRunner(&mockDynamoDB{})
+	state := &State{Applied: []Applied{{Version: 1}}}
+
+	if _, err := runner.Run(context.Background(), state, Migration{Version: 3, Description: "Skip"}, false, nil); err == nil {
+		t.Error("expected error for a skipped version")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate([]Migration{{Version: 1, Description: "a"}, {Version: 2, Description: "b"}}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := Validate([]Migration{{Version: 1, Description: "a"}, {Version: 3, Description: "b"}}); err == nil {
+		t.Error("expected error for a gap")
+	}
+	if err := Validate([]Migration{{Version: 1}}); err == nil {
+		t.Error("expected error for a missing description")
+	}
+}
+
+func TestPending(t *testing.T) {
+	migrations := []Migration{{Version: 1}, {Version: 2}, {Version: 3}, {Version: 4}}
+	state := &State{Applied: []Applied{{Version: 1}}}
+
+	if got := Pending(state, migrations, 0); len(got) != 3 || got[0].Version != 2 {
+		t.Errorf("expected 2-4 pending, got %+v", got)
+	}
+	if got := Pending(state, migrations, 3); len(got) != 2 || got[1].Version != 3 {
+		t.Errorf("expected 2-3 pending, got %+v", got)
+	}
+}
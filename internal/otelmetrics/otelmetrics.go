@@ -0,0 +1,89 @@
+// Package otelmetrics sets up OpenTelemetry metrics alongside the tracing
+// awsinit starts, so handlers can record counters and histograms that the
+// ADOT collector exports, without calling CloudWatch themselves.
+//
+// Instruments are created from Meter at package level, like tracers are;
+// until Init installs a provider they record nothing.
+package otelmetrics
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/noop"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+)
+
+// ScopeName is the instrumentation scope of core's instruments
+const ScopeName = "github.com/jarrod-lowe/jmap-service-core"
+
+// ExporterEnv selects the metrics exporter, as in the OTel SDK
+// specification. Only "otlp" enables metrics.
+const ExporterEnv = "OTEL_METRICS_EXPORTER"
+
+// Meter returns the meter core's instruments are created from
+func Meter() metric.Meter {
+	return otel.Meter(ScopeName)
+}
+
+// Histogram creates a histogram from Meter, or a no-op one if the name is
+// invalid, so package-level instruments are never nil
+func Histogram(name, description, unit string) metric.Float64Histogram {
+	histogram, err := Meter().Float64Histogram(name,
+		metric.WithDescription(description),
+		metric.WithUnit(unit),
+	)
+	if err != nil {
+		return noop.Float64Histogram{}
+	}
+	return histogram
+}
+
+// Milliseconds converts a duration to fractional milliseconds for
+// histograms
+func Milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// Init installs a global MeterProvider exporting over OTLP gRPC when
+// OTEL_METRICS_EXPORTER is "otlp", and returns it for WithFlush. The endpoint
+// comes from the standard OTEL_EXPORTER_OTLP_* variables, as for traces.
+// Otherwise it returns nil and instruments stay no-ops.
+func Init(ctx context.Context) (Flusher, error) {
+	if os.Getenv(ExporterEnv) != "otlp" {
+		return nil, nil
+	}
+	exporter, err := otlpmetricgrpc.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Lambda is frozen between invocations, so WithFlush exports after each
+	// one; the periodic reader only covers long invocations
+	provider := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+	)
+	otel.SetMeterProvider(provider)
+	return provider, nil
+}
+
+// Flusher exports buffered metrics
+type Flusher interface {
+	ForceFlush(ctx context.Context) error
+}
+
+// WithFlush wraps a handler to flush metrics after each invocation, before
+// Lambda freezes the function. A nil flusher returns the handler unchanged.
+// Flush failures are dropped so they never fail a request.
+func WithFlush[Req, Resp any](flusher Flusher, handler func(context.Context, Req) (Resp, error)) func(context.Context, Req) (Resp, error) {
+	if flusher == nil {
+		return handler
+	}
+	return func(ctx context.Context, request Req) (Resp, error) {
+		defer func() { _ = flusher.ForceFlush(ctx) }()
+		return handler(ctx, request)
+	}
+}
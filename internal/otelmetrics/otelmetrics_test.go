@@ -0,0 +1,80 @@
+package otelmetrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+func TestInit_DisabledByDefault(t *testing.T) {
+	t.Setenv(ExporterEnv, "")
+
+	flusher, err := Init(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flusher != nil {
+		t.Error("expected no provider when metrics are disabled")
+	}
+}
+
+// TestHistogram_CreatedBeforeProvider checks that package-level instruments,
+// created before Init runs, record once a provider is installed
+func TestHistogram_CreatedBeforeProvider(t *testing.T) {
+	histogram := Histogram("test.latency", "Test latency", "ms")
+
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	histogram.Record(context.Background(), Milliseconds(1500*time.Microsecond))
+
+	var data metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &data); err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	if len(data.ScopeMetrics) != 1 || data.ScopeMetrics[0].Scope.Name != ScopeName {
+		t.Fatalf("expected metrics in scope %s, got %+v", ScopeName, data.ScopeMetrics)
+	}
+	points := data.ScopeMetrics[0].Metrics[0].Data.(metricdata.Histogram[float64]).DataPoints
+	if len(points) != 1 || points[0].Sum != 1.5 {
+		t.Errorf("expected one 1.5ms point, got %+v", points)
+	}
+}
+
+type mockFlusher struct {
+	flushes int
+}
+
+func (m *mockFlusher) ForceFlush(ctx context.Context) error {
+	m.flushes++
+	return errors.New("collector unavailable")
+}
+
+func TestWithFlush(t *testing.T) {
+	flusher := &mockFlusher{}
+	handler := WithFlush(flusher, func(ctx context.Context, request string) (string, error) {
+		return "hello " + request, nil
+	})
+
+	response, err := handler(context.Background(), "world")
+	if err != nil || response != "hello world" {
+		t.Errorf("expected handler result, got %q, %v", response, err)
+	}
+	if flusher.flushes != 1 {
+		t.Errorf("expected one flush, got %d", flusher.flushes)
+	}
+}
+
+func TestWithFlush_NilFlusher(t *testing.T) {
+	handler := WithFlush(nil, func(ctx context.Context, request string) (string, error) {
+		return request, nil
+	})
+	if response, _ := handler(context.Background(), "ok"); response != "ok" {
+		t.Errorf("expected handler result, got %q", response)
+	}
+}
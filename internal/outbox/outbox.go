@@ -0,0 +1,176 @@
+// Package outbox stores events in DynamoDB in the same transaction as the
+// change they describe. The outbox-publisher Lambda delivers them from the
+// table's stream, so an event is published at least once if and only if the
+// change was committed.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// SKPrefix is the sort key prefix of outbox records under ACCOUNT#{accountId}
+const SKPrefix = "OUTBOX#"
+
+// recordExpiry removes records whose delete after delivery failed
+const recordExpiry = 7 * 24 * time.Hour
+
+// Record is an event waiting in the outbox
+type Record struct {
+	AccountID string
+	EventID   string
+	Payload   publisher.EventPayload
+}
+
+// Put returns a transaction item that writes payload to the outbox under
+// eventID, which must be unique within the account
+func Put(tableName, eventID string, payload publisher.EventPayload, now time.Time) (types.TransactWriteItem, error) {
+	// Record the schema version so a later publisher can upgrade the payload
+	if payload.SchemaVersion == 0 {
+		payload.SchemaVersion = publisher.CurrentSchemaVersion
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return types.TransactWriteItem{}, fmt.Errorf("failed to marshal outbox event: %w", err)
+	}
+
+	return types.TransactWriteItem{
+		Put: &types.Put{
+			TableName: aws.String(tableName),
+			Item: map[string]types.AttributeValue{
+				"pk":        &types.AttributeValueMemberS{Value: dbclient.AccountPK(payload.AccountID)},
+				"sk":        &types.AttributeValueMemberS{Value: SKPrefix + eventID},
+				"accountId": &types.AttributeValueMemberS{Value: payload.AccountID},
+				"eventId":   &types.AttributeValueMemberS{Value: eventID},
+				"eventType": &types.AttributeValueMemberS{Value: payload.EventType},
+				"payload":   &types.AttributeValueMemberS{Value: string(body)},
+				"createdAt": &types.AttributeValueMemberS{Value: now.UTC().Format(time.RFC3339)},
+				"ttl":       &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(recordExpiry).Unix(), 10)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(pk)"),
+		},
+	}, nil
+}
+
+// FromImage reads an outbox record from a DynamoDB stream image. ok is false
+// if the image is not an outbox record.
+func FromImage(image map[string]events.DynamoDBAttributeValue) (record Record, ok bool, err error) {
+	sk, found := image["sk"]
+	if !found || sk.DataType() != events.DataTypeString || !strings.HasPrefix(sk.String(), SKPrefix) {
+		return Record{}, false, nil
+	}
+	record.EventID = strings.TrimPrefix(sk.String(), SKPrefix)
+
+	body, found := image["payload"]
+	if !found || body.DataType() != events.DataTypeString {
+		return Record{}, true, fmt.Errorf("outbox record %s has no payload", record.EventID)
+	}
+	if err := json.Unmarshal([]byte(body.String()), &record.Payload); err != nil {
+		return Record{}, true, fmt.Errorf("failed to unmarshal outbox record %s: %w", record.EventID, err)
+	}
+	record.AccountID = record.Payload.AccountID
+	return record, true, nil
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by the outbox
+type DynamoDBClient interface {
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBStore removes delivered outbox records
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Delete removes a delivered outbox record
+func (d *DynamoDBStore) Delete(ctx context.Context, accountID, eventID string) error {
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.tableName),
+		Key: map[string]types.AttributeValue{
+			"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+			"sk": &types.AttributeValueMemberS{Value: SKPrefix + eventID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete outbox record: %w", err)
+	}
+	return nil
+}
+
+// maxTransactItems is the most items DynamoDB accepts in one transaction
+const maxTransactItems = 100
+
+// WriterClient defines the DynamoDB operations needed to write outbox records
+type WriterClient interface {
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// Writer adds events to the outbox on their own, for changes with no
+// DynamoDB write to share a transaction with
+type Writer struct {
+	client    WriterClient
+	tableName string
+}
+
+// NewWriter creates a new Writer
+func NewWriter(client WriterClient, tableName string) *Writer {
+	return &Writer{
+		client:    client,
+		tableName: tableName,
+	}
+}
+
+// Write stores records in transactions of up to 100. Event IDs should be
+// derived from the change, so that writing the same records again after a
+// failure does not duplicate events: a batch whose records are already in
+// the outbox is skipped.
+func (w *Writer) Write(ctx context.Context, records []Record) error {
+	now := time.Now()
+	for start := 0; start < len(records); start += maxTransactItems {
+		batch := records[start:min(start+maxTransactItems, len(records))]
+		items := make([]types.TransactWriteItem, len(batch))
+		for i, record := range batch {
+			item, err := Put(w.tableName, record.EventID, record.Payload, now)
+			if err != nil {
+				return err
+			}
+			items[i] = item
+		}
+		_, err := w.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if err != nil && !alreadyWritten(err) {
+			return fmt.Errorf("failed to write outbox records: %w", err)
+		}
+	}
+	return nil
+}
+
+// alreadyWritten reports whether a transaction failed because its records
+// are already in the outbox
+func alreadyWritten(err error) bool {
+	for _, reason := range dbclient.GetTransactionCancellationReasons(err) {
+		if reason.Code == "ConditionalCheckFailed" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+func TestPut_RoundTripsThroughStreamImage(t *testing.T) {
+	payload := publisher.EventPayload{
+		EventType:  publisher.EventAccountCreated,
+		OccurredAt: "2026-03-04T00:00:00Z",
+		AccountID:  "user-123",
+		Data:       map[string]any{"tier": "pro"},
+	}
+
+	item, err := Put("table", "event-1", payload, time.Date(2026, 3, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item.Put == nil || *item.Put.ConditionExpression != "attribute_not_exists(pk)" {
+		t.Fatal("expected a conditional put")
+	}
+
+	// Convert the written item to the shape the stream delivers
+	image := map[string]events.DynamoDBAttributeValue{}
+	for name, value := range item.Put.Item {
+		switch v := value.(type) {
+		case *types.AttributeValueMemberS:
+			image[name] = events.NewStringAttribute(v.Value)
+		case *types.AttributeValueMemberN:
+			image[name] = events.NewNumberAttribute(v.Value)
+		}
+	}
+	if image["pk"].String() != "ACCOUNT#user-123" || image["sk"].String() != "OUTBOX#event-1" {
+		t.Errorf("unexpected key %s / %s", image["pk"].String(), image["sk"].String())
+	}
+
+	record, ok, err := FromImage(image)
+	if err != nil || !ok {
+		t.Fatalf("expected outbox record, got ok=%v err=%v", ok, err)
+	}
+	if record.EventID != "event-1" || record.AccountID != "user-123" {
+		t.Errorf("unexpected record: %+v", record)
+	}
+	if record.Payload.EventType != publisher.EventAccountCreated || record.Payload.Data["tier"] != "pro" {
+		t.Errorf("unexpected payload: %+v", record.Payload)
+	}
+	if record.Payload.SchemaVersion != publisher.CurrentSchemaVersion {
+		t.Errorf("expected payload to record schema version %d, got %d", publisher.CurrentSchemaVersion, record.Payload.SchemaVersion)
+	}
+}
+
+func TestFromImage_IgnoresOtherRecords(t *testing.T) {
+	_, ok, err := FromImage(map[string]events.DynamoDBAttributeValue{
+		"sk": events.NewStringAttribute("META#"),
+	})
+	if ok || err != nil {
+		t.Errorf("expected non-outbox record to be ignored, got ok=%v err=%v", ok, err)
+	}
+}
+
+func TestFromImage_MissingPayload_ReturnsError(t *testing.T) {
+	_, ok, err := FromImage(map[string]events.DynamoDBAttributeValue{
+		"sk": events.NewStringAttribute("OUTBOX#event-1"),
+	})
+	if !ok || err == nil {
+		t.Errorf("expected error for outbox record without payload, got ok=%v err=%v", ok, err)
+	}
+}
+
+type mockDynamoDBClient struct {
+	lastDelete *dynamodb.DeleteItemInput
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.lastDelete = params
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDelete_RemovesRecord(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := NewDynamoDBStore(client, "table")
+
+	if err := store.Delete(context.Background(), "user-123", "event-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if sk := client.lastDelete.Key["sk"].(*types.AttributeValueMemberS).Value; sk != "OUTBOX#event-1" {
+		t.Errorf("expected OUTBOX#event-1, got %s", sk)
+	}
+}
+
+type mockWriterClient struct {
+	batches [][]types.TransactWriteItem
+	errs    []error
+}
+
+func (m *mockWriterClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.batches = append(m.batches, params.TransactItems)
+	if len(m.errs) > 0 {
+		err := m.errs[0]
+		m.errs = m.errs[1:]
+		return nil, err
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func testRecords(n int) []Record {
+	records := make([]Record, n)
+	for i := range records {
+		records[i] = Record{
+			AccountID: "user-123",
+			EventID:   fmt.Sprintf("event-%d", i),
+			Payload:   publisher.EventPayload{EventType: publisher.EventAccountCreated, AccountID: "user-123"},
+		}
+	}
+	return records
+}
+
+func TestWriter_WritesInTransactionsOf100(t *testing.T) {
+	client := &mockWriterClient{}
+	if err := NewWriter(client, "table").Write(context.Background(), testRecords(150)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.batches) != 2 || len(client.batches[0]) != 100 || len(client.batches[1]) != 50 {
+		t.Fatalf("expected transactions of 100 and 50, got %d", len(client.batches))
+	}
+	if sk := client.batches[1][0].Put.Item["sk"].(*types.AttributeValueMemberS).Value; sk != "OUTBOX#event-100" {
+		t.Errorf("expected OUTBOX#event-100, got %s", sk)
+	}
+}
+
+func TestWriter_SkipsRecordsAlreadyWritten(t *testing.T) {
+	canceled := &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}}}
+	client := &mockWriterClient{errs: []error{canceled}}
+	if err := NewWriter(client, "table").Write(context.Background(), testRecords(101)); err != nil {
+		t.Fatalf("expected records already written to be skipped, got %v", err)
+	}
+	if len(client.batches) != 2 {
+		t.Errorf("expected the second transaction to be written, got %d", len(client.batches))
+	}
+}
+
+func TestWriter_ReturnsOtherErrors(t *testing.T) {
+	client := &mockWriterClient{errs: []error{fmt.Errorf("throttled")}}
+	if err := NewWriter(client, "table").Write(context.Background(), testRecords(1)); err == nil {
+		t.Fatal("expected error")
+	}
+}
@@ -12,7 +12,7 @@ func IsAllowedARN(registeredARNs []string, callerARN string) bool {
 	}
 
 	// Normalize caller ARN (convert assumed-role to role ARN if needed)
-	normalizedCaller := normalizeARN(callerARN)
+	normalizedCaller := NormalizeARN(callerARN)
 
 	for _, registered := range registeredARNs {
 		if registered == normalizedCaller {
@@ -23,11 +23,11 @@ func IsAllowedARN(registeredARNs []string, callerARN string) bool {
 	return false
 }
 
-// normalizeARN converts an assumed-role ARN to its source role ARN.
+// NormalizeARN converts an assumed-role ARN to its source role ARN.
 // Input:  arn:aws:sts::123456789012:assumed-role/RoleName/SessionName
 // Output: arn:aws:iam::123456789012:role/RoleName
 // If the ARN is already a role ARN or any other format, it's returned unchanged.
-func normalizeARN(arn string) string {
+func NormalizeARN(arn string) string {
 	// Check if this is an assumed-role ARN
 	// Format: arn:aws:sts::<account>:assumed-role/<role>/<session>
 	if !strings.Contains(arn, ":assumed-role/") {
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// Inspection is what a loaded registry contains and where it came from, for
+// operators working out why a method or capability is or is not served
+type Inspection struct {
+	SnapshotVersion int    `json:"snapshotVersion"`
+	Source          string `json:"source,omitempty"`
+	// LoadedAt is zero for a registry that was built rather than loaded
+	LoadedAt         time.Time                      `json:"loadedAt"`
+	SnapshotSavedAt  *time.Time                     `json:"snapshotSavedAt,omitempty"`
+	Items            int                            `json:"items"`
+	Fingerprint      string                         `json:"fingerprint"`
+	LastRegisteredAt string                         `json:"lastRegisteredAt,omitempty"`
+	Plugins          []PluginSummary                `json:"plugins"`
+	Capabilities     map[string]map[string]any      `json:"capabilities"`
+	Methods          map[string]MethodInspection    `json:"methods"`
+	Events           map[string][]EventSubscription `json:"events"`
+	Principals       []string                       `json:"principals"`
+	ClientProfiles   map[string][]string            `json:"clientProfiles"`
+}
+
+// PluginSummary identifies a loaded plugin record
+type PluginSummary struct {
+	PluginID     string `json:"pluginId"`
+	Version      string `json:"version,omitempty"`
+	RegisteredAt string `json:"registeredAt,omitempty"`
+}
+
+// MethodInspection is the target a method is routed to and the plugin that
+// won it, which is the last plugin loaded that declares the method
+type MethodInspection struct {
+	PluginID       string `json:"pluginId,omitempty"`
+	InvocationType string `json:"invocationType"`
+	InvokeTarget   string `json:"invokeTarget"`
+	Async          bool   `json:"async,omitempty"`
+	Capability     string `json:"capability,omitempty"`
+	ArgsSchema     bool   `json:"argsSchema,omitempty"` // whether arguments are validated, not the schema itself
+	Paging         bool   `json:"paging,omitempty"`
+	StateTokens    bool   `json:"stateTokens,omitempty"`
+}
+
+// EventSubscription is a plugin's subscription to an event type
+type EventSubscription struct {
+	PluginID      string `json:"pluginId"`
+	TargetType    string `json:"targetType"`
+	TargetArn     string `json:"targetArn"`
+	DetailType    string `json:"detailType,omitempty"`
+	SchemaVersion int    `json:"schemaVersion,omitempty"`
+}
+
+// Inspect returns what the registry contains, with its last load. Plugins
+// and event subscriptions are in load order; principals and client profile
+// capabilities are sorted.
+func (r *Registry) Inspect() Inspection {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	inspection := Inspection{
+		SnapshotVersion: SnapshotVersion,
+		Source:          r.lastLoad.Source,
+		LoadedAt:        r.lastLoad.LoadedAt,
+		Items:           r.lastLoad.Items,
+		Fingerprint:     r.fingerprint,
+		Plugins:         make([]PluginSummary, 0, len(r.plugins)),
+		Capabilities:    make(map[string]map[string]any, len(r.capabilitySet)),
+		Methods:         make(map[string]MethodInspection, len(r.methodMap)),
+		Events:          make(map[string][]EventSubscription),
+		Principals:      slices.Sorted(maps.Keys(r.allowedPrincipals)),
+		ClientProfiles:  make(map[string][]string, len(r.clientProfiles)),
+	}
+	if !r.lastLoad.SavedAt.IsZero() {
+		savedAt := r.lastLoad.SavedAt
+		inspection.SnapshotSavedAt = &savedAt
+	}
+	if inspection.Principals == nil {
+		inspection.Principals = []string{}
+	}
+
+	for _, record := range r.plugins {
+		inspection.Plugins = append(inspection.Plugins, PluginSummary{
+			PluginID:     record.PluginID,
+			Version:      record.Version,
+			RegisteredAt: record.RegisteredAt,
+		})
+		if record.RegisteredAt > inspection.LastRegisteredAt {
+			inspection.LastRegisteredAt = record.RegisteredAt
+		}
+		// Later plugins win a method, as they do when the registry loads
+		for method := range record.Methods {
+			if target, ok := r.methodMap[method]; ok {
+				inspection.Methods[method] = inspectMethod(record.PluginID, target)
+			}
+		}
+		for eventType, target := range record.Events {
+			inspection.Events[eventType] = append(inspection.Events[eventType], EventSubscription{
+				PluginID:      record.PluginID,
+				TargetType:    target.TargetType,
+				TargetArn:     target.TargetArn,
+				DetailType:    target.DetailType,
+				SchemaVersion: record.EventSchemaVersion,
+			})
+		}
+	}
+	// Methods added directly have no plugin
+	for method, target := range r.methodMap {
+		if _, ok := inspection.Methods[method]; !ok {
+			inspection.Methods[method] = inspectMethod("", target)
+		}
+	}
+
+	for capability := range r.capabilitySet {
+		config := maps.Clone(r.capabilityConfig[capability])
+		if config == nil {
+			config = map[string]any{}
+		}
+		inspection.Capabilities[capability] = config
+	}
+	for name, capabilities := range r.clientProfiles {
+		inspection.ClientProfiles[name] = slices.Sorted(slices.Values(capabilities))
+	}
+	return inspection
+}
+
+// inspectMethod describes a method target served by pluginID
+func inspectMethod(pluginID string, target MethodTarget) MethodInspection {
+	return MethodInspection{
+		PluginID:       pluginID,
+		InvocationType: target.InvocationType,
+		InvokeTarget:   target.InvokeTarget,
+		Async:          target.Async,
+		Capability:     target.Capability,
+		ArgsSchema:     target.ArgsSchema != nil,
+		Paging:         target.Paging,
+		StateTokens:    target.StateTokens,
+	}
+}
@@ -0,0 +1,96 @@
+package plugin
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+)
+
+func TestInspect_LoadedRegistry(t *testing.T) {
+	events, _ := attributevalue.MarshalMap(PluginRecord{
+		PK:                 PluginPrefix,
+		SK:                 PluginPrefix + "events",
+		PluginID:           "events",
+		Methods:            map[string]MethodTarget{"Email/get": {InvocationType: "lambda-invoke", InvokeTarget: "arn:events-get", Paging: true}},
+		Events:             map[string]EventTarget{"account.created": {TargetType: "sqs", TargetArn: "arn:queue"}},
+		EventSchemaVersion: 2,
+		ClientPrincipals:   []string{"arn:role/b", "arn:role/a"},
+		ClientProfiles:     map[string][]string{"mobile": {"urn:z", "urn:a"}},
+		RegisteredAt:       "2025-02-01T00:00:00Z",
+		Version:            "2.0.0",
+	})
+	registry := NewRegistry()
+	querier := &mockQuerier{items: append(mailItems(), events)}
+	if err := registry.LoadFromDynamoDB(context.Background(), querier); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	inspection := registry.Inspect()
+	if inspection.SnapshotVersion != SnapshotVersion || inspection.Source != LoadSourceDynamoDB || inspection.Items != 2 {
+		t.Errorf("unexpected load %+v", inspection)
+	}
+	if inspection.LoadedAt.IsZero() || inspection.SnapshotSavedAt != nil {
+		t.Errorf("expected a load time and no snapshot time, got %v and %v", inspection.LoadedAt, inspection.SnapshotSavedAt)
+	}
+	if inspection.Fingerprint != registry.Fingerprint() || inspection.LastRegisteredAt != "2025-02-01T00:00:00Z" {
+		t.Errorf("unexpected fingerprint %q or lastRegisteredAt %q", inspection.Fingerprint, inspection.LastRegisteredAt)
+	}
+	if len(inspection.Plugins) != 2 || inspection.Plugins[1] != (PluginSummary{PluginID: "events", Version: "2.0.0", RegisteredAt: "2025-02-01T00:00:00Z"}) {
+		t.Errorf("unexpected plugins %+v", inspection.Plugins)
+	}
+
+	// The plugin loaded last wins Email/get
+	want := MethodInspection{PluginID: "events", InvocationType: "lambda-invoke", InvokeTarget: "arn:events-get", Paging: true}
+	if got := inspection.Methods["Email/get"]; got != want {
+		t.Errorf("Email/get = %+v, want %+v", got, want)
+	}
+	if got := inspection.Capabilities["urn:ietf:params:jmap:mail"]["maxMailboxDepth"]; got != float64(10) {
+		t.Errorf("unexpected capabilities %v", inspection.Capabilities)
+	}
+	wantEvents := []EventSubscription{{PluginID: "events", TargetType: "sqs", TargetArn: "arn:queue", SchemaVersion: 2}}
+	if !reflect.DeepEqual(inspection.Events["account.created"], wantEvents) {
+		t.Errorf("unexpected events %+v", inspection.Events)
+	}
+	if !reflect.DeepEqual(inspection.Principals, []string{"arn:role/a", "arn:role/b"}) {
+		t.Errorf("unexpected principals %v", inspection.Principals)
+	}
+	if !reflect.DeepEqual(inspection.ClientProfiles["mobile"], []string{"urn:a", "urn:z"}) {
+		t.Errorf("unexpected client profiles %v", inspection.ClientProfiles)
+	}
+}
+
+func TestInspect_SnapshotAndBuiltRegistries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	saveStaleSnapshot(t, path)
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	inspection := loaded.Inspect()
+	if inspection.Source != LoadSourceSnapshot || inspection.SnapshotSavedAt == nil || inspection.LoadedAt.IsZero() {
+		t.Errorf("unexpected snapshot load %+v", inspection)
+	}
+	if inspection.Methods["Email/old"].PluginID != "old" {
+		t.Errorf("unexpected methods %+v", inspection.Methods)
+	}
+
+	built := NewRegistry()
+	built.AddMethod("Core/echo", MethodTarget{InvokeTarget: "arn:echo", ArgsSchema: map[string]any{"type": "object"}})
+	built.AddCapability("urn:ietf:params:jmap:core")
+	inspection = built.Inspect()
+	if !inspection.LoadedAt.IsZero() || inspection.Source != "" {
+		t.Errorf("expected no load, got %+v", inspection)
+	}
+	if got := inspection.Methods["Core/echo"]; got.PluginID != "" || !got.ArgsSchema {
+		t.Errorf("unexpected Core/echo %+v", got)
+	}
+	if config := inspection.Capabilities["urn:ietf:params:jmap:core"]; config == nil || len(config) != 0 {
+		t.Errorf("expected an empty config, got %v", config)
+	}
+	if inspection.Principals == nil || len(inspection.Plugins) != 0 {
+		t.Errorf("expected empty lists, got %+v", inspection)
+	}
+}
@@ -3,12 +3,22 @@ package plugin
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/otelmetrics"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 )
 
+// invokeDuration records plugin invocation latency by method and outcome
+var invokeDuration = otelmetrics.Histogram("jmap.plugin.invoke.duration", "Plugin Lambda invocation latency", "ms")
+
 // Invoker defines the interface for invoking plugin methods
 type Invoker interface {
 	Invoke(ctx context.Context, target MethodTarget, request PluginInvocationRequest) (*PluginInvocationResponse, error)
@@ -29,7 +39,10 @@ func NewLambdaInvoker(client LambdaClient) *LambdaInvoker {
 	return &LambdaInvoker{client: client}
 }
 
-// Invoke invokes a plugin Lambda with the given request
+// Invoke invokes a plugin Lambda with the given request. An async target is
+// invoked with InvocationType Event, which queues the request and returns
+// without the plugin's response, so an empty response is returned for the
+// caller to answer in its place.
 func (i *LambdaInvoker) Invoke(ctx context.Context, target MethodTarget, request PluginInvocationRequest) (*PluginInvocationResponse, error) {
 	// Marshal request to JSON
 	payload, err := json.Marshal(request)
@@ -42,11 +55,26 @@ func (i *LambdaInvoker) Invoke(ctx context.Context, target MethodTarget, request
 		FunctionName: aws.String(target.InvokeTarget),
 		Payload:      payload,
 	}
+	if target.Async {
+		input.InvocationType = lambdatypes.InvocationTypeEvent
+	}
 
+	start := time.Now()
 	output, err := i.client.Invoke(ctx, input)
+	outcome := "ok"
+	if err != nil || output.FunctionError != nil {
+		outcome = "error"
+	}
+	invokeDuration.Record(ctx, otelmetrics.Milliseconds(time.Since(start)), metric.WithAttributes(
+		attribute.String("method", request.Method),
+		attribute.String("outcome", outcome),
+	))
 	if err != nil {
 		return nil, fmt.Errorf("lambda invocation failed: %w", err)
 	}
+	if target.Async {
+		return &PluginInvocationResponse{}, nil
+	}
 
 	// Unmarshal response
 	var response PluginInvocationResponse
@@ -56,3 +84,38 @@ func (i *LambdaInvoker) Invoke(ctx context.Context, target MethodTarget, request
 
 	return &response, nil
 }
+
+// Prewarm opens connections to Lambda before the first request needs them,
+// with a DryRun invocation of each target. DryRun checks the caller may
+// invoke the function without running it, so plugins see no traffic. Up to
+// connections calls run at once, leaving that many connections idle in the
+// client's pool. Errors are returned together; a failed call only means that
+// connection is opened on first use instead.
+func (i *LambdaInvoker) Prewarm(ctx context.Context, targets []string, connections int) error {
+	connections = max(connections, 1)
+	slots := make(chan struct{}, connections)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, target := range targets {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			_, err := i.client.Invoke(ctx, &lambda.InvokeInput{
+				FunctionName:   aws.String(target),
+				InvocationType: lambdatypes.InvocationTypeDryRun,
+			})
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("%s: %w", target, err))
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/jarrod-lowe/jmap-service-libs/plugincontract"
 )
 
 // mockLambdaClient implements LambdaClient for testing
@@ -49,14 +53,14 @@ func TestLambdaInvoker_InvokesLambdaWithCorrectPayload(t *testing.T) {
 
 	invoker := NewLambdaInvoker(mock)
 
-	request := PluginInvocationRequest{
+	request := PluginInvocationRequest{PluginInvocationRequest: plugincontract.PluginInvocationRequest{
 		RequestID: "req-123",
 		CallIndex: 0,
 		AccountID: "user-123",
 		Method:    "Email/get",
 		Args:      map[string]any{"ids": []string{"email-1"}},
 		ClientID:  "c0",
-	}
+	}}
 
 	target := MethodTarget{
 		InvocationType: "lambda-invoke",
@@ -128,6 +132,32 @@ func TestLambdaInvoker_UsesCorrectFunctionARN(t *testing.T) {
 	}
 }
 
+func TestLambdaInvoker_AsyncUsesEventInvocation(t *testing.T) {
+	mock := &mockLambdaClient{
+		invokeFunc: func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+			return &lambda.InvokeOutput{StatusCode: 202}, nil
+		},
+	}
+
+	invoker := NewLambdaInvoker(mock)
+	target := MethodTarget{
+		InvocationType: "lambda-invoke",
+		InvokeTarget:   "arn:aws:lambda:ap-southeast-2:123:function:mark-seen",
+		Async:          true,
+	}
+
+	resp, err := invoker.Invoke(context.Background(), target, PluginInvocationRequest{})
+	if err != nil {
+		t.Fatalf("Invoke returned error: %v", err)
+	}
+	if mock.invokeInput.InvocationType != lambdatypes.InvocationTypeEvent {
+		t.Errorf("expected an Event invocation, got %q", mock.invokeInput.InvocationType)
+	}
+	if resp == nil || resp.MethodResponse.Name != "" {
+		t.Errorf("expected an empty response, got %+v", resp)
+	}
+}
+
 func TestLambdaInvoker_ReturnsPluginResponse(t *testing.T) {
 	mock := &mockLambdaClient{
 		invokeFunc: func(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
@@ -145,7 +175,7 @@ func TestLambdaInvoker_ReturnsPluginResponse(t *testing.T) {
 
 	invoker := NewLambdaInvoker(mock)
 
-	resp, err := invoker.Invoke(context.Background(), MethodTarget{InvokeTarget: "arn:test"}, PluginInvocationRequest{ClientID: "c0"})
+	resp, err := invoker.Invoke(context.Background(), MethodTarget{InvokeTarget: "arn:test"}, PluginInvocationRequest{PluginInvocationRequest: plugincontract.PluginInvocationRequest{ClientID: "c0"}})
 	if err != nil {
 		t.Fatalf("Invoke returned error: %v", err)
 	}
@@ -199,7 +229,7 @@ func TestLambdaInvoker_ReturnsErrorResponse(t *testing.T) {
 
 	invoker := NewLambdaInvoker(mock)
 
-	resp, err := invoker.Invoke(context.Background(), MethodTarget{InvokeTarget: "arn:test"}, PluginInvocationRequest{ClientID: "c0"})
+	resp, err := invoker.Invoke(context.Background(), MethodTarget{InvokeTarget: "arn:test"}, PluginInvocationRequest{PluginInvocationRequest: plugincontract.PluginInvocationRequest{ClientID: "c0"}})
 	if err != nil {
 		t.Fatalf("Invoke returned error: %v", err)
 	}
@@ -218,3 +248,38 @@ func TestLambdaInvoker_ReturnsErrorResponse(t *testing.T) {
 	}
 }
 
+
+// concurrentLambdaClient records DryRun invocations from several goroutines
+type concurrentLambdaClient struct {
+	mu      sync.Mutex
+	targets []string
+	inputs  []*lambda.InvokeInput
+}
+
+func (c *concurrentLambdaClient) Invoke(ctx context.Context, params *lambda.InvokeInput, optFns ...func(*lambda.Options)) (*lambda.InvokeOutput, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.targets = append(c.targets, *params.FunctionName)
+	c.inputs = append(c.inputs, params)
+	if *params.FunctionName == "arn:denied" {
+		return nil, errors.New("AccessDeniedException")
+	}
+	return &lambda.InvokeOutput{StatusCode: 204}, nil
+}
+
+func TestLambdaInvoker_Prewarm(t *testing.T) {
+	client := &concurrentLambdaClient{}
+
+	err := NewLambdaInvoker(client).Prewarm(context.Background(), []string{"arn:mail", "arn:denied", "arn:calendar"}, 2)
+	if err == nil || !strings.Contains(err.Error(), "arn:denied") {
+		t.Errorf("expected the failed target reported, got %v", err)
+	}
+	if len(client.targets) != 3 {
+		t.Errorf("expected every target prewarmed, got %v", client.targets)
+	}
+	for _, input := range client.inputs {
+		if input.InvocationType != lambdatypes.InvocationTypeDryRun || input.Payload != nil {
+			t.Errorf("expected a DryRun invocation without payload, got %+v", input)
+		}
+	}
+}
@@ -2,11 +2,20 @@ package plugin
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/argschema"
 )
 
 // PluginPrefix is the partition key prefix for plugin records
@@ -17,23 +26,69 @@ type PluginQuerier interface {
 	QueryByPK(ctx context.Context, pk string) ([]map[string]types.AttributeValue, error)
 }
 
-// Registry holds loaded plugin configuration
+// AttributeQuerier is a PluginQuerier that can read only some attributes.
+// The registry reads only the attributes of PluginRecord when its querier
+// is one.
+type AttributeQuerier interface {
+	QueryAttributes(ctx context.Context, pk string, attributes []string) ([]map[string]types.AttributeValue, error)
+}
+
+// recordAttributes are the attributes PluginRecord reads, from its
+// dynamodbav tags
+var recordAttributes = func() []string {
+	recordType := reflect.TypeFor[PluginRecord]()
+	attributes := make([]string, 0, recordType.NumField())
+	for i := range recordType.NumField() {
+		name, _, _ := strings.Cut(recordType.Field(i).Tag.Get("dynamodbav"), ",")
+		if name != "" && name != "-" {
+			attributes = append(attributes, name)
+		}
+	}
+	return attributes
+}()
+
+// Sources a registry is loaded from
+const (
+	LoadSourceDynamoDB = "dynamodb"
+	LoadSourceSnapshot = "snapshot"
+)
+
+// LoadStats describes the registry's last load, so its growth and load time
+// can be published as metrics
+type LoadStats struct {
+	Source   string
+	Items    int // plugin records loaded
+	Duration time.Duration
+	LoadedAt time.Time
+	// SavedAt is when the snapshot was written, for snapshot loads
+	SavedAt time.Time
+}
+
+// Registry holds loaded plugin configuration. It is safe for concurrent
+// use, so a loaded registry can be refreshed while requests read it.
 type Registry struct {
+	mu                sync.RWMutex
 	methodMap         map[string]MethodTarget
+	methodSchemas     map[string]*argschema.Schema // compiled from each method's ArgsSchema
 	capabilitySet     map[string]bool
 	capabilityConfig  map[string]map[string]any
 	plugins           []PluginRecord
-	allowedPrincipals map[string]bool // aggregated from all plugins' ClientPrincipals
+	allowedPrincipals map[string]bool     // aggregated from all plugins' ClientPrincipals
+	clientProfiles    map[string][]string // aggregated from all plugins' ClientProfiles
+	fingerprint       string              // hash of the loaded plugin records
+	lastLoad          LoadStats
 }
 
 // NewRegistry creates an empty registry
 func NewRegistry() *Registry {
 	return &Registry{
 		methodMap:         make(map[string]MethodTarget),
+		methodSchemas:     make(map[string]*argschema.Schema),
 		capabilitySet:     make(map[string]bool),
 		capabilityConfig:  make(map[string]map[string]any),
 		plugins:           []PluginRecord{},
 		allowedPrincipals: make(map[string]bool),
+		clientProfiles:    make(map[string][]string),
 	}
 }
 
@@ -49,21 +104,113 @@ func NewRegistryWithPrincipals(principals []string) *Registry {
 
 // LoadFromDynamoDB loads all plugins from DynamoDB
 func (r *Registry) LoadFromDynamoDB(ctx context.Context, querier PluginQuerier) error {
-	items, err := querier.QueryByPK(ctx, PluginPrefix)
+	start := time.Now()
+	records, err := queryRecords(ctx, querier)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load(records); err != nil {
+		return err
+	}
+	r.lastLoad = LoadStats{Source: LoadSourceDynamoDB, Items: len(records), Duration: time.Since(start), LoadedAt: time.Now().UTC()}
+	return nil
+}
+
+// Refresh reloads the registry from DynamoDB, replacing its contents in one
+// step once the load succeeds. On failure the registry is left as it was.
+func (r *Registry) Refresh(ctx context.Context, querier PluginQuerier) error {
+	start := time.Now()
+	records, err := queryRecords(ctx, querier)
+	if err != nil {
+		return err
+	}
+
+	fresh := NewRegistry()
+	if err := fresh.load(records); err != nil {
+		return err
+	}
+	fresh.lastLoad = LoadStats{Source: LoadSourceDynamoDB, Items: len(records), Duration: time.Since(start), LoadedAt: time.Now().UTC()}
+	r.replace(fresh)
+	return nil
+}
+
+// replace swaps the registry's contents for fresh's
+func (r *Registry) replace(fresh *Registry) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.methodMap = fresh.methodMap
+	r.methodSchemas = fresh.methodSchemas
+	r.capabilitySet = fresh.capabilitySet
+	r.capabilityConfig = fresh.capabilityConfig
+	r.plugins = fresh.plugins
+	r.allowedPrincipals = fresh.allowedPrincipals
+	r.clientProfiles = fresh.clientProfiles
+	r.fingerprint = fresh.fingerprint
+	r.lastLoad = fresh.lastLoad
+}
+
+// LastLoad describes the registry's last load
+func (r *Registry) LastLoad() LoadStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.lastLoad
+}
+
+// Fingerprint returns a hash of the loaded plugin records, which changes
+// whenever a load or refresh finds different records
+func (r *Registry) Fingerprint() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fingerprint
+}
+
+// Records returns the loaded plugin records
+func (r *Registry) Records() []PluginRecord {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.plugins)
+}
+
+// queryRecords reads every plugin record from DynamoDB, from the single
+// PLUGIN# partition
+func queryRecords(ctx context.Context, querier PluginQuerier) ([]PluginRecord, error) {
+	var items []map[string]types.AttributeValue
+	var err error
+	if attributeQuerier, ok := querier.(AttributeQuerier); ok {
+		items, err = attributeQuerier.QueryAttributes(ctx, PluginPrefix, recordAttributes)
+	} else {
+		items, err = querier.QueryByPK(ctx, PluginPrefix)
+	}
 	if err != nil {
-		return fmt.Errorf("failed to query plugins: %w", err)
+		return nil, fmt.Errorf("failed to query plugins: %w", err)
 	}
 
+	records := make([]PluginRecord, 0, len(items))
 	for _, item := range items {
 		var record PluginRecord
 		if err := attributevalue.UnmarshalMap(item, &record); err != nil {
-			return fmt.Errorf("failed to unmarshal plugin record: %w", err)
+			return nil, fmt.Errorf("failed to unmarshal plugin record: %w", err)
 		}
+		records = append(records, record)
+	}
+	return records, nil
+}
 
+// load indexes plugin records into the registry. The caller holds the
+// write lock, or has the only reference to the registry.
+func (r *Registry) load(records []PluginRecord) error {
+	for _, record := range records {
 		r.plugins = append(r.plugins, record)
 
-		// Index methods
-		maps.Copy(r.methodMap, record.Methods)
+		// Index methods, compiling their argument schemas
+		for method, target := range record.Methods {
+			if err := r.indexMethod(method, target); err != nil {
+				return fmt.Errorf("plugin %s: %w", record.PluginID, err)
+			}
+		}
 
 		// Index capabilities with merging
 		for capability, config := range record.Capabilities {
@@ -81,13 +228,54 @@ func (r *Registry) LoadFromDynamoDB(ctx context.Context, querier PluginQuerier)
 		for _, principal := range record.ClientPrincipals {
 			r.allowedPrincipals[principal] = true
 		}
+
+		// Aggregate client profiles: plugins declaring the same profile
+		// each add their capabilities to it
+		for name, capabilities := range record.ClientProfiles {
+			for _, capability := range capabilities {
+				if !slices.Contains(r.clientProfiles[name], capability) {
+					r.clientProfiles[name] = append(r.clientProfiles[name], capability)
+				}
+			}
+		}
+	}
+
+	data, err := json.Marshal(r.plugins)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint plugin records: %w", err)
 	}
+	sum := sha256.Sum256(data)
+	r.fingerprint = hex.EncodeToString(sum[:])
+	return nil
+}
 
+// indexMethod adds a method target, replacing any earlier one along with
+// its schema
+func (r *Registry) indexMethod(method string, target MethodTarget) error {
+	delete(r.methodSchemas, method)
+	if target.ArgsSchema != nil {
+		schema, err := argschema.Compile(target.ArgsSchema)
+		if err != nil {
+			return fmt.Errorf("method %s has an invalid argsSchema: %w", method, err)
+		}
+		r.methodSchemas[method] = schema
+	}
+	r.methodMap[method] = target
 	return nil
 }
 
+// ArgsSchema returns the compiled argument schema of a method, or nil if it
+// has none
+func (r *Registry) ArgsSchema(method string) *argschema.Schema {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.methodSchemas[method]
+}
+
 // GetMethodTarget returns the target for a method, or nil if not found
 func (r *Registry) GetMethodTarget(method string) *MethodTarget {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	target, ok := r.methodMap[method]
 	if !ok {
 		return nil
@@ -95,8 +283,28 @@ func (r *Registry) GetMethodTarget(method string) *MethodTarget {
 	return &target
 }
 
+// InvokeTargets returns the distinct Lambda targets of the registered
+// methods, in a stable order
+func (r *Registry) InvokeTargets() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	seen := make(map[string]bool)
+	var targets []string
+	for _, target := range r.methodMap {
+		if target.InvokeTarget == "" || seen[target.InvokeTarget] {
+			continue
+		}
+		seen[target.InvokeTarget] = true
+		targets = append(targets, target.InvokeTarget)
+	}
+	slices.Sort(targets)
+	return targets
+}
+
 // GetCapabilities returns all available capability URNs
 func (r *Registry) GetCapabilities() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	caps := make([]string, 0, len(r.capabilitySet))
 	for cap := range r.capabilitySet {
 		caps = append(caps, cap)
@@ -106,6 +314,8 @@ func (r *Registry) GetCapabilities() []string {
 
 // GetCapabilityConfig returns the merged configuration for a capability
 func (r *Registry) GetCapabilityConfig(capability string) map[string]any {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	config, ok := r.capabilityConfig[capability]
 	if !ok {
 		return nil
@@ -113,8 +323,65 @@ func (r *Registry) GetCapabilityConfig(capability string) map[string]any {
 	return config
 }
 
+// MaxSizeUploadKey is the capability config property declaring the largest
+// blob a capability's clients may upload
+const MaxSizeUploadKey = "maxSizeUpload"
+
+// MaxSizeUpload returns the maxSizeUpload a capability's config declares, or
+// 0 if it declares none. ok is false if the capability is not registered.
+func (r *Registry) MaxSizeUpload(capability string) (size int64, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.capabilitySet[capability] {
+		return 0, false
+	}
+	return configInt(r.capabilityConfig[capability], MaxSizeUploadKey), true
+}
+
+// coreCapability is the JMAP core capability, whose config holds the
+// request limits of RFC 8620 section 2
+const coreCapability = "urn:ietf:params:jmap:core"
+
+// MaxConcurrentRequestsKey is the core capability property limiting how
+// many requests a client may have in flight at once
+const MaxConcurrentRequestsKey = "maxConcurrentRequests"
+
+// MaxConcurrentRequests returns the maxConcurrentRequests the core
+// capability declares, or 0 if it declares none
+func (r *Registry) MaxConcurrentRequests() int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return configInt(r.capabilityConfig[coreCapability], MaxConcurrentRequestsKey)
+}
+
+// configInt returns a non-negative integer capability config property, as
+// loaded from DynamoDB or set in tests, or 0 if it is missing
+func configInt(config map[string]any, key string) int64 {
+	var value int64
+	switch v := config[key].(type) {
+	case float64:
+		value = int64(v)
+	case int64:
+		value = v
+	case int:
+		value = int64(v)
+	}
+	return max(value, 0)
+}
+
+// ClientProfile returns the capabilities a session client profile lists. ok
+// is false if no plugin declares the profile.
+func (r *Registry) ClientProfile(name string) (capabilities []string, ok bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	capabilities, ok = r.clientProfiles[name]
+	return capabilities, ok
+}
+
 // HasCapability checks if a capability is available
 func (r *Registry) HasCapability(capability string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	return r.capabilitySet[capability]
 }
 
@@ -122,6 +389,8 @@ func (r *Registry) HasCapability(capability string) bool {
 // Returns true if the caller is registered by any plugin.
 // Handles assumed-role ARN translation automatically.
 func (r *Registry) IsAllowedPrincipal(callerARN string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	// Convert map keys to slice for IsAllowedARN
 	registeredARNs := make([]string, 0, len(r.allowedPrincipals))
 	for arn := range r.allowedPrincipals {
@@ -130,27 +399,157 @@ func (r *Registry) IsAllowedPrincipal(callerARN string) bool {
 	return IsAllowedARN(registeredARNs, callerARN)
 }
 
-// AddMethod adds a method target to the registry.
+// PluginIDsForPrincipal returns the plugins that register the caller as a
+// client principal. Handles assumed-role ARN translation automatically.
+func (r *Registry) PluginIDsForPrincipal(callerARN string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var pluginIDs []string
+	for _, plugin := range r.plugins {
+		if IsAllowedARN(plugin.ClientPrincipals, callerARN) {
+			pluginIDs = append(pluginIDs, plugin.PluginID)
+		}
+	}
+	return pluginIDs
+}
+
+// CallbackSecretArn returns the secret a plugin signs its callbacks with, or
+// "" if it only signs them with SigV4
+func (r *Registry) CallbackSecretArn(pluginID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, plugin := range r.plugins {
+		if plugin.PluginID == pluginID {
+			return plugin.CallbackSecretArn
+		}
+	}
+	return ""
+}
+
+// MethodPlugin returns the ID of the plugin serving a method, or "" if no
+// plugin does. As with method targets, the last plugin loaded wins.
+func (r *Registry) MethodPlugin(method string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.plugins) - 1; i >= 0; i-- {
+		if _, ok := r.plugins[i].Methods[method]; ok {
+			return r.plugins[i].PluginID
+		}
+	}
+	return ""
+}
+
+// MethodPrincipals returns the client principals of the plugin serving a
+// method, which may present the delegation tokens minted for its calls. As
+// with method targets, the last plugin loaded wins.
+func (r *Registry) MethodPrincipals(method string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.plugins) - 1; i >= 0; i-- {
+		if _, ok := r.plugins[i].Methods[method]; ok {
+			return slices.Clone(r.plugins[i].ClientPrincipals)
+		}
+	}
+	return nil
+}
+
+// EventPrincipals returns the client principals of every plugin subscribed
+// to an event type, such as the scanners subscribed to blob.scan.requested
+func (r *Registry) EventPrincipals(eventType string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var principals []string
+	for _, plugin := range r.plugins {
+		if _, ok := plugin.Events[eventType]; ok {
+			principals = append(principals, plugin.ClientPrincipals...)
+		}
+	}
+	return principals
+}
+
+// PluginCount returns the number of plugins loaded
+func (r *Registry) PluginCount() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.plugins)
+}
+
+// LastRegisteredAt returns the latest registeredAt of the loaded plugins, or
+// "" if none are loaded. Timestamps are RFC 3339 in UTC, so they compare as
+// strings.
+func (r *Registry) LastRegisteredAt() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	latest := ""
+	for _, plugin := range r.plugins {
+		if plugin.RegisteredAt > latest {
+			latest = plugin.RegisteredAt
+		}
+	}
+	return latest
+}
+
+// AddMethod adds a method target to the registry. It panics if the
+// target's ArgsSchema is invalid.
 // This is primarily for testing.
 func (r *Registry) AddMethod(method string, target MethodTarget) {
-	r.methodMap[method] = target
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.indexMethod(method, target); err != nil {
+		panic(err)
+	}
+}
+
+// AddPlugin loads a plugin record into the registry alongside those already
+// loaded. It panics if the record is invalid.
+// This is primarily for testing.
+func (r *Registry) AddPlugin(record PluginRecord) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.load([]PluginRecord{record}); err != nil {
+		panic(err)
+	}
 }
 
 // AddCapability registers a capability URN.
 // This is primarily for testing.
 func (r *Registry) AddCapability(capability string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	r.capabilitySet[capability] = true
 }
 
+// AddCapabilityConfig registers a capability URN with its config.
+// This is primarily for testing.
+func (r *Registry) AddCapabilityConfig(capability string, config map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.capabilitySet[capability] = true
+	r.capabilityConfig[capability] = maps.Clone(config)
+}
+
+// AddClientProfile adds capabilities to a session client profile.
+// This is primarily for testing.
+func (r *Registry) AddClientProfile(name string, capabilities ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clientProfiles[name] = append(r.clientProfiles[name], capabilities...)
+}
+
 // AggregatedEventTarget represents a plugin's subscription to an event
 type AggregatedEventTarget struct {
-	PluginID   string
-	TargetType string
-	TargetArn  string
+	PluginID      string
+	TargetType    string
+	TargetArn     string
+	DetailType    string
+	SecretArn     string
+	SchemaVersion int
 }
 
 // GetEventTargets returns all plugin targets subscribed to an event type
 func (r *Registry) GetEventTargets(eventType string) []AggregatedEventTarget {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 	var targets []AggregatedEventTarget
 
 	for _, plugin := range r.plugins {
@@ -159,9 +558,12 @@ func (r *Registry) GetEventTargets(eventType string) []AggregatedEventTarget {
 		}
 		if target, ok := plugin.Events[eventType]; ok {
 			targets = append(targets, AggregatedEventTarget{
-				PluginID:   plugin.PluginID,
-				TargetType: target.TargetType,
-				TargetArn:  target.TargetArn,
+				PluginID:      plugin.PluginID,
+				TargetType:    target.TargetType,
+				TargetArn:     target.TargetArn,
+				DetailType:    target.DetailType,
+				SecretArn:     target.SecretArn,
+				SchemaVersion: plugin.EventSchemaVersion,
 			})
 		}
 	}
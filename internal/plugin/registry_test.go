@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"context"
+	"slices"
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -311,6 +312,53 @@ func TestRegistry_IsAllowedPrincipal_RegisteredPrincipalIsAllowed(t *testing.T)
 	}
 }
 
+func TestRegistry_PluginIDsForPrincipal(t *testing.T) {
+	mock := &mockQuerier{
+		items: []map[string]types.AttributeValue{
+			createTestPluginItemWithPrincipals("ingest-plugin", []string{
+				"arn:aws:iam::123456789012:role/IngestRole",
+			}),
+			createTestPluginItemWithPrincipals("other-plugin", []string{
+				"arn:aws:iam::123456789012:role/OtherRole",
+			}),
+		},
+	}
+
+	registry := NewRegistry()
+	_ = registry.LoadFromDynamoDB(context.Background(), mock)
+
+	pluginIDs := registry.PluginIDsForPrincipal("arn:aws:sts::123456789012:assumed-role/IngestRole/session")
+	if len(pluginIDs) != 1 || pluginIDs[0] != "ingest-plugin" {
+		t.Errorf("expected [ingest-plugin], got %v", pluginIDs)
+	}
+	if pluginIDs := registry.PluginIDsForPrincipal("arn:aws:iam::123456789012:role/Unknown"); len(pluginIDs) != 0 {
+		t.Errorf("expected no plugins, got %v", pluginIDs)
+	}
+}
+
+func TestRegistry_CallbackSecretArn(t *testing.T) {
+	record := PluginRecord{
+		PK:                PluginPrefix,
+		SK:                PluginPrefix + "ingest-plugin",
+		PluginID:          "ingest-plugin",
+		CallbackSecretArn: "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:jmap-plugin-callback-ingest",
+	}
+	item, _ := attributevalue.MarshalMap(record)
+
+	registry := NewRegistry()
+	_ = registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: []map[string]types.AttributeValue{
+		item,
+		createTestPluginItemWithPrincipals("other-plugin", nil),
+	}})
+
+	if got := registry.CallbackSecretArn("ingest-plugin"); got != record.CallbackSecretArn {
+		t.Errorf("expected callback secret, got %q", got)
+	}
+	if got := registry.CallbackSecretArn("other-plugin"); got != "" {
+		t.Errorf("expected no callback secret, got %q", got)
+	}
+}
+
 func TestRegistry_IsAllowedPrincipal_UnregisteredPrincipalIsDenied(t *testing.T) {
 	mock := &mockQuerier{
 		items: []map[string]types.AttributeValue{
@@ -444,6 +492,42 @@ func TestRegistry_GetEventTargets_ReturnsTargetsForEventType(t *testing.T) {
 	}
 }
 
+func TestRegistry_GetEventTargets_IncludesPluginSchemaVersion(t *testing.T) {
+	item := createTestPluginItemWithEvents("mail-core", map[string]EventTarget{
+		"account.created": {
+			TargetType: "sqs",
+			TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:jmap-service-email-events",
+		},
+	})
+	item["eventSchemaVersion"] = &types.AttributeValueMemberN{Value: "2"}
+
+	registry := NewRegistry()
+	_ = registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: []map[string]types.AttributeValue{item}})
+
+	targets := registry.GetEventTargets("account.created")
+	if len(targets) != 1 || targets[0].SchemaVersion != 2 {
+		t.Errorf("expected target with schema version 2, got %+v", targets)
+	}
+}
+
+func TestRegistry_GetEventTargets_IncludesWebhookSecret(t *testing.T) {
+	item := createTestPluginItemWithEvents("crm", map[string]EventTarget{
+		"account.created": {
+			TargetType: "webhook",
+			TargetArn:  "https://crm.example.com/jmap-events",
+			SecretArn:  "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:jmap-webhook-crm",
+		},
+	})
+
+	registry := NewRegistry()
+	_ = registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: []map[string]types.AttributeValue{item}})
+
+	targets := registry.GetEventTargets("account.created")
+	if len(targets) != 1 || targets[0].SecretArn != "arn:aws:secretsmanager:ap-southeast-2:123456789012:secret:jmap-webhook-crm" {
+		t.Errorf("expected target with webhook secret, got %+v", targets)
+	}
+}
+
 func TestRegistry_GetEventTargets_ReturnsEmptyForUnknownEvent(t *testing.T) {
 	mock := &mockQuerier{
 		items: []map[string]types.AttributeValue{
@@ -520,3 +604,242 @@ func TestRegistry_GetEventTargets_PluginWithNoEvents(t *testing.T) {
 		t.Errorf("expected 0 targets for plugin with no events, got %d", len(targets))
 	}
 }
+
+func TestRegistry_MethodPlugin(t *testing.T) {
+	mail, _ := attributevalue.MarshalMap(PluginRecord{
+		PK:       PluginPrefix,
+		SK:       PluginPrefix + "mail-core",
+		PluginID: "mail-core",
+		Methods:  map[string]MethodTarget{"Email/get": {InvocationType: "lambda-invoke", InvokeTarget: "arn:mail"}},
+	})
+	override, _ := attributevalue.MarshalMap(PluginRecord{
+		PK:               PluginPrefix,
+		SK:               PluginPrefix + "mail-override",
+		PluginID:         "mail-override",
+		Methods:          map[string]MethodTarget{"Email/get": {InvocationType: "lambda-invoke", InvokeTarget: "arn:override"}},
+		ClientPrincipals: []string{"arn:aws:iam::123456789012:role/Override"},
+	})
+
+	registry := NewRegistry()
+	_ = registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: []map[string]types.AttributeValue{mail, override}})
+
+	if got := registry.MethodPlugin("Email/get"); got != "mail-override" {
+		t.Errorf("expected the plugin whose target is used, got %q", got)
+	}
+	if got := registry.MethodPlugin("Mailbox/get"); got != "" {
+		t.Errorf("expected no plugin for an unknown method, got %q", got)
+	}
+	if got := registry.MethodPrincipals("Email/get"); len(got) != 1 || got[0] != "arn:aws:iam::123456789012:role/Override" {
+		t.Errorf("expected the serving plugin's principals, got %v", got)
+	}
+	if got := registry.MethodPrincipals("Mailbox/get"); got != nil {
+		t.Errorf("expected no principals for an unknown method, got %v", got)
+	}
+}
+
+func TestRegistry_EventPrincipals(t *testing.T) {
+	registry := NewRegistry()
+	registry.AddPlugin(PluginRecord{
+		PluginID:         "scanner",
+		Events:           map[string]EventTarget{"blob.scan.requested": {TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:scans"}},
+		ClientPrincipals: []string{"arn:aws:iam::123456789012:role/Scanner"},
+	})
+	registry.AddPlugin(PluginRecord{
+		PluginID:         "mail-core",
+		ClientPrincipals: []string{"arn:aws:iam::123456789012:role/Mail"},
+	})
+
+	if got := registry.EventPrincipals("blob.scan.requested"); len(got) != 1 || got[0] != "arn:aws:iam::123456789012:role/Scanner" {
+		t.Errorf("expected the subscribed plugin's principals, got %v", got)
+	}
+	if got := registry.EventPrincipals("account.created"); got != nil {
+		t.Errorf("expected no principals for an event without subscribers, got %v", got)
+	}
+}
+
+func TestRegistry_PluginCountAndLastRegisteredAt(t *testing.T) {
+	older, _ := attributevalue.MarshalMap(PluginRecord{
+		PK:           PluginPrefix,
+		SK:           PluginPrefix + "core",
+		PluginID:     "core",
+		RegisteredAt: "2026-01-02T03:04:05Z",
+	})
+	newer, _ := attributevalue.MarshalMap(PluginRecord{
+		PK:           PluginPrefix,
+		SK:           PluginPrefix + "mail-core",
+		PluginID:     "mail-core",
+		RegisteredAt: "2026-02-01T00:00:00Z",
+	})
+
+	registry := NewRegistry()
+	if registry.PluginCount() != 0 || registry.LastRegisteredAt() != "" {
+		t.Fatal("expected an empty registry to have no plugins")
+	}
+	_ = registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: []map[string]types.AttributeValue{newer, older}})
+
+	if got := registry.PluginCount(); got != 2 {
+		t.Errorf("expected 2 plugins, got %d", got)
+	}
+	if got := registry.LastRegisteredAt(); got != "2026-02-01T00:00:00Z" {
+		t.Errorf("expected the newest registration, got %q", got)
+	}
+}
+
+func TestRegistry_MaxSizeUpload(t *testing.T) {
+	mock := &mockQuerier{
+		items: []map[string]types.AttributeValue{
+			createTestPluginItem("calendar", map[string]map[string]any{
+				"urn:ietf:params:jmap:calendars": {"maxSizeUpload": float64(5000000)},
+				"urn:ietf:params:jmap:contacts":  {},
+			}, map[string]MethodTarget{}),
+		},
+	}
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), mock); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if size, ok := registry.MaxSizeUpload("urn:ietf:params:jmap:calendars"); !ok || size != 5000000 {
+		t.Errorf("expected 5000000, got %d, %v", size, ok)
+	}
+	if size, ok := registry.MaxSizeUpload("urn:ietf:params:jmap:contacts"); !ok || size != 0 {
+		t.Errorf("expected no limit, got %d, %v", size, ok)
+	}
+	if _, ok := registry.MaxSizeUpload("urn:example:unknown"); ok {
+		t.Error("expected an unregistered capability to be reported")
+	}
+}
+
+func TestRegistry_MaxConcurrentRequests(t *testing.T) {
+	registry := NewRegistry()
+	if got := registry.MaxConcurrentRequests(); got != 0 {
+		t.Errorf("expected no limit without the core capability, got %d", got)
+	}
+	registry.AddCapabilityConfig("urn:ietf:params:jmap:core", map[string]any{"maxConcurrentRequests": float64(4)})
+	if got := registry.MaxConcurrentRequests(); got != 4 {
+		t.Errorf("expected 4, got %d", got)
+	}
+}
+
+func TestRegistry_InvokeTargets(t *testing.T) {
+	registry := NewRegistry()
+	registry.AddMethod("Email/get", MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:mail"})
+	registry.AddMethod("Email/set", MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:mail"})
+	registry.AddMethod("CalendarEvent/get", MethodTarget{InvocationType: "lambda-invoke", InvokeTarget: "arn:calendar"})
+
+	if got := registry.InvokeTargets(); len(got) != 2 || got[0] != "arn:calendar" || got[1] != "arn:mail" {
+		t.Errorf("expected each target once, got %v", got)
+	}
+}
+
+func TestRegistry_ClientProfile_AggregatesFromPlugins(t *testing.T) {
+	items := make([]map[string]types.AttributeValue, 0, 2)
+	for _, record := range []PluginRecord{
+		{
+			PK: PluginPrefix, SK: PluginPrefix + "core", PluginID: "core",
+			ClientProfiles: map[string][]string{"minimal": {"urn:ietf:params:jmap:core"}},
+		},
+		{
+			PK: PluginPrefix, SK: PluginPrefix + "mail", PluginID: "mail",
+			ClientProfiles: map[string][]string{
+				"minimal": {"urn:ietf:params:jmap:mail", "urn:ietf:params:jmap:core"},
+				"mail":    {"urn:ietf:params:jmap:mail"},
+			},
+		},
+	} {
+		item, _ := attributevalue.MarshalMap(record)
+		items = append(items, item)
+	}
+
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: items}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	capabilities, ok := registry.ClientProfile("minimal")
+	if !ok || len(capabilities) != 2 || capabilities[0] != "urn:ietf:params:jmap:core" || capabilities[1] != "urn:ietf:params:jmap:mail" {
+		t.Errorf("expected core and mail in the minimal profile, got %v, %v", capabilities, ok)
+	}
+	if _, ok := registry.ClientProfile("mail"); !ok {
+		t.Error("expected the mail profile")
+	}
+	if _, ok := registry.ClientProfile("unknown"); ok {
+		t.Error("expected no unknown profile")
+	}
+}
+
+func TestRegistry_ArgsSchema(t *testing.T) {
+	schema := map[string]any{"type": "object", "required": []any{"accountId"}}
+	mock := &mockQuerier{
+		items: []map[string]types.AttributeValue{
+			createTestPluginItem("mail", nil, map[string]MethodTarget{
+				"Email/get":   {InvokeTarget: "arn:get", ArgsSchema: schema},
+				"Email/query": {InvokeTarget: "arn:query", ArgsSchema: schema},
+			}),
+			createTestPluginItem("override", nil, map[string]MethodTarget{
+				"Email/query": {InvokeTarget: "arn:override"},
+			}),
+		},
+	}
+
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), mock); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	compiled := registry.ArgsSchema("Email/get")
+	if compiled == nil {
+		t.Fatal("expected a schema for Email/get")
+	}
+	if err := compiled.Validate(map[string]any{}); err == nil || err.SchemaPath != "/required" {
+		t.Errorf("expected a required failure, got %v", err)
+	}
+	if registry.ArgsSchema("Email/query") != nil {
+		t.Error("expected the overriding registration to drop the schema")
+	}
+}
+
+func TestRegistry_ArgsSchema_InvalidFailsLoad(t *testing.T) {
+	mock := &mockQuerier{
+		items: []map[string]types.AttributeValue{
+			createTestPluginItem("mail", nil, map[string]MethodTarget{
+				"Email/get": {InvokeTarget: "arn:get", ArgsSchema: map[string]any{"$ref": "#/defs/get"}},
+			}),
+		},
+	}
+
+	if err := NewRegistry().LoadFromDynamoDB(context.Background(), mock); err == nil {
+		t.Error("expected an error for an invalid argsSchema")
+	}
+}
+
+// mockAttributeQuerier implements AttributeQuerier for testing
+type mockAttributeQuerier struct {
+	mockQuerier
+	attributes []string
+}
+
+func (m *mockAttributeQuerier) QueryAttributes(ctx context.Context, pk string, attributes []string) ([]map[string]types.AttributeValue, error) {
+	m.attributes = attributes
+	return m.QueryByPK(ctx, pk)
+}
+
+func TestRegistry_LoadFromDynamoDB_ProjectsRecordAttributes(t *testing.T) {
+	querier := &mockAttributeQuerier{mockQuerier: mockQuerier{items: []map[string]types.AttributeValue{
+		createTestPluginItem("mail", nil, map[string]MethodTarget{"Email/get": {InvokeTarget: "arn:get"}}),
+	}}}
+
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), querier); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, name := range []string{"pluginId", "methods", "capabilities", "clientProfiles", "version"} {
+		if !slices.Contains(querier.attributes, name) {
+			t.Errorf("expected %s projected, got %v", name, querier.attributes)
+		}
+	}
+	if stats := registry.LastLoad(); stats.Source != LoadSourceDynamoDB || stats.Items != 1 || stats.Duration <= 0 {
+		t.Errorf("unexpected load stats %+v", stats)
+	}
+}
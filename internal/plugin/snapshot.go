@@ -0,0 +1,126 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SnapshotVersion is the format version of registry snapshots. A snapshot
+// written in another format is ignored and the registry loaded from
+// DynamoDB instead.
+const SnapshotVersion = 1
+
+// SnapshotPath returns where a Lambda keeps its snapshot of the registry in
+// table. On Lambda this is in /tmp, which lasts as long as the execution
+// environment, including runtime restarts after a crash or timeout, which
+// run initialization again. The table name keeps local servers using
+// different tables from sharing a snapshot.
+func SnapshotPath(table string) string {
+	return filepath.Join(os.TempDir(), "plugin-registry-"+table+".json")
+}
+
+// snapshot is the file format of a registry snapshot
+type snapshot struct {
+	Version int            `json:"version"`
+	SavedAt time.Time      `json:"savedAt"`
+	Plugins []PluginRecord `json:"plugins"`
+}
+
+// SaveSnapshot writes the registry's plugin records to path. The file is
+// written alongside and renamed into place, so a reader never sees a partial
+// snapshot.
+func (r *Registry) SaveSnapshot(path string) error {
+	data, err := json.Marshal(snapshot{Version: SnapshotVersion, SavedAt: time.Now().UTC(), Plugins: r.Records()})
+	if err != nil {
+		return fmt.Errorf("failed to encode registry snapshot: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write registry snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write registry snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write registry snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write registry snapshot: %w", err)
+	}
+	return nil
+}
+
+// LoadSnapshot loads a registry from a snapshot written by SaveSnapshot. The
+// error wraps fs.ErrNotExist if there is no snapshot.
+func LoadSnapshot(path string) (*Registry, error) {
+	start := time.Now()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registry snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, fmt.Errorf("failed to decode registry snapshot: %w", err)
+	}
+	if snap.Version != SnapshotVersion {
+		return nil, fmt.Errorf("registry snapshot has version %d, want %d", snap.Version, SnapshotVersion)
+	}
+
+	r := NewRegistry()
+	if err := r.load(snap.Plugins); err != nil {
+		return nil, fmt.Errorf("failed to load registry snapshot: %w", err)
+	}
+	r.lastLoad = LoadStats{
+		Source:   LoadSourceSnapshot,
+		Items:    len(snap.Plugins),
+		Duration: time.Since(start),
+		LoadedAt: time.Now().UTC(),
+		SavedAt:  snap.SavedAt,
+	}
+	return r, nil
+}
+
+// LoadWithSnapshot loads the registry from the snapshot at path if there is
+// one, and refreshes it from DynamoDB in the background, saving a new
+// snapshot once that succeeds. Without a usable snapshot it loads from
+// DynamoDB and saves one before returning. report is called with each
+// error that does not fail the load: an unreadable snapshot, a failed save,
+// or a failed background refresh, which leaves the snapshot's contents in
+// place.
+func LoadWithSnapshot(ctx context.Context, querier PluginQuerier, path string, report func(error)) (*Registry, error) {
+	r, err := LoadSnapshot(path)
+	if err == nil {
+		go func() {
+			if err := r.Refresh(ctx, querier); err != nil {
+				report(err)
+				return
+			}
+			if err := r.SaveSnapshot(path); err != nil {
+				report(err)
+			}
+		}()
+		return r, nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		report(err)
+	}
+
+	r = NewRegistry()
+	if err := r.LoadFromDynamoDB(ctx, querier); err != nil {
+		return nil, err
+	}
+	if err := r.SaveSnapshot(path); err != nil {
+		report(err)
+	}
+	return r, nil
+}
@@ -0,0 +1,206 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// gatedQuerier answers QueryByPK only once release is closed
+type gatedQuerier struct {
+	mockQuerier
+	release chan struct{}
+}
+
+func (g *gatedQuerier) QueryByPK(ctx context.Context, pk string) ([]map[string]types.AttributeValue, error) {
+	<-g.release
+	return g.mockQuerier.QueryByPK(ctx, pk)
+}
+
+// errorLog collects the errors LoadWithSnapshot reports
+type errorLog struct {
+	mu     sync.Mutex
+	errors []error
+}
+
+func (l *errorLog) report(err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, err)
+}
+
+func (l *errorLog) count() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.errors)
+}
+
+func mailItems() []map[string]types.AttributeValue {
+	return []map[string]types.AttributeValue{
+		createTestPluginItem("mail", map[string]map[string]any{
+			"urn:ietf:params:jmap:mail": {"maxMailboxDepth": 10},
+		}, map[string]MethodTarget{
+			"Email/get": {InvocationType: "lambda-invoke", InvokeTarget: "arn:get", ArgsSchema: map[string]any{"type": "object"}},
+		}),
+	}
+}
+
+// saveStaleSnapshot saves a snapshot holding only Email/old
+func saveStaleSnapshot(t *testing.T, path string) {
+	t.Helper()
+	stale := NewRegistry()
+	items := []map[string]types.AttributeValue{
+		createTestPluginItem("old", nil, map[string]MethodTarget{"Email/old": {InvokeTarget: "arn:old"}}),
+	}
+	if err := stale.LoadFromDynamoDB(context.Background(), &mockQuerier{items: items}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := stale.SaveSnapshot(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSnapshot_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: mailItems()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := registry.SaveSnapshot(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if loaded.GetMethodTarget("Email/get") == nil || loaded.ArgsSchema("Email/get") == nil {
+		t.Error("expected Email/get and its schema from the snapshot")
+	}
+	if config := loaded.GetCapabilityConfig("urn:ietf:params:jmap:mail"); config["maxMailboxDepth"] != float64(10) {
+		t.Errorf("unexpected capability config %v", config)
+	}
+}
+
+func TestLoadSnapshot_OtherVersionIgnored(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := os.WriteFile(path, []byte(`{"version":99,"plugins":[]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSnapshot(path); err == nil {
+		t.Error("expected an error for another snapshot version")
+	}
+}
+
+func TestLoadWithSnapshot_NoSnapshotLoadsAndSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	var log errorLog
+
+	registry, err := LoadWithSnapshot(context.Background(), &mockQuerier{items: mailItems()}, path, log.report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.GetMethodTarget("Email/get") == nil {
+		t.Error("expected Email/get from DynamoDB")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("expected a snapshot saved, got %v", err)
+	}
+	if log.count() != 0 {
+		t.Errorf("expected no reported errors, got %v", log.errors)
+	}
+}
+
+func TestLoadWithSnapshot_UsesSnapshotThenRefreshes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	saveStaleSnapshot(t, path)
+
+	querier := &gatedQuerier{mockQuerier: mockQuerier{items: mailItems()}, release: make(chan struct{})}
+	var log errorLog
+	registry, err := LoadWithSnapshot(context.Background(), querier, path, log.report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.GetMethodTarget("Email/old") == nil {
+		t.Fatal("expected the snapshot's contents before the refresh")
+	}
+
+	close(querier.release)
+	deadline := time.Now().Add(time.Second)
+	for registry.GetMethodTarget("Email/get") == nil && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if registry.GetMethodTarget("Email/get") == nil || registry.GetMethodTarget("Email/old") != nil {
+		t.Error("expected the refresh to replace the snapshot's contents")
+	}
+}
+
+func TestLoadWithSnapshot_RefreshFailureKeepsSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	saveStaleSnapshot(t, path)
+
+	var log errorLog
+	registry, err := LoadWithSnapshot(context.Background(), &mockQuerier{err: errors.New("throttled")}, path, log.report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for log.count() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if log.count() != 1 || registry.GetMethodTarget("Email/old") == nil {
+		t.Errorf("expected the failure reported and the snapshot kept, got %v", log.errors)
+	}
+}
+
+func TestLoadWithSnapshot_CorruptSnapshotFallsBack(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var log errorLog
+	registry, err := LoadWithSnapshot(context.Background(), &mockQuerier{items: mailItems()}, path, log.report)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.GetMethodTarget("Email/get") == nil || log.count() != 1 {
+		t.Errorf("expected a DynamoDB load and the bad snapshot reported, got %v", log.errors)
+	}
+}
+
+func TestFingerprint_SurvivesSnapshotAndTracksChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "registry.json")
+	registry := NewRegistry()
+	if err := registry.LoadFromDynamoDB(context.Background(), &mockQuerier{items: mailItems()}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := registry.SaveSnapshot(path); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	loaded, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if registry.Fingerprint() == "" || loaded.Fingerprint() != registry.Fingerprint() {
+		t.Errorf("expected the snapshot to keep fingerprint %q, got %q", registry.Fingerprint(), loaded.Fingerprint())
+	}
+
+	saveStaleSnapshot(t, path)
+	stale, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stale.Fingerprint() == registry.Fingerprint() {
+		t.Error("expected different records to change the fingerprint")
+	}
+}
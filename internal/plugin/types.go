@@ -2,32 +2,55 @@ package plugin
 
 import "github.com/jarrod-lowe/jmap-service-libs/plugincontract"
 
+// PluginInvocationRequest is the request core sends to a plugin: the plugin
+// contract request plus fields the contract does not carry yet. The extra
+// fields are omitted when empty, so plugins decoding into the contract type
+// are unaffected.
+type PluginInvocationRequest struct {
+	plugincontract.PluginInvocationRequest
+	// DelegationToken lets the plugin call core's IAM endpoints for this
+	// account only, until it expires. See internal/delegation.
+	DelegationToken string `json:"delegationToken,omitempty"`
+	// CorrelationID identifies the client request across plugins and
+	// asynchronous pipelines. See internal/correlation.
+	CorrelationID string `json:"correlationId,omitempty"`
+}
+
 // Type aliases for exported plugin contract types
-type PluginInvocationRequest = plugincontract.PluginInvocationRequest
 type PluginInvocationResponse = plugincontract.PluginInvocationResponse
 type MethodResponse = plugincontract.MethodResponse
 
 // PluginRecord represents a plugin registration in DynamoDB (internal only)
 type PluginRecord struct {
-	PK               string                    `dynamodbav:"pk"`
-	SK               string                    `dynamodbav:"sk"`
-	PluginID         string                    `dynamodbav:"pluginId"`
-	Capabilities     map[string]map[string]any `dynamodbav:"capabilities"`
-	Methods          map[string]MethodTarget   `dynamodbav:"methods"`
-	Events           map[string]EventTarget    `dynamodbav:"events,omitempty"`
-	ClientPrincipals []string                  `dynamodbav:"clientPrincipals,omitempty"`
-	RegisteredAt     string                    `dynamodbav:"registeredAt"`
-	Version          string                    `dynamodbav:"version"`
+	PK                 string                    `dynamodbav:"pk"`
+	SK                 string                    `dynamodbav:"sk"`
+	PluginID           string                    `dynamodbav:"pluginId"`
+	Capabilities       map[string]map[string]any `dynamodbav:"capabilities"`
+	Methods            map[string]MethodTarget   `dynamodbav:"methods"`
+	Events             map[string]EventTarget    `dynamodbav:"events,omitempty"`
+	EventSchemaVersion int                       `dynamodbav:"eventSchemaVersion,omitempty"` // event payload schema version the plugin supports; defaults to 1
+	ClientPrincipals   []string                  `dynamodbav:"clientPrincipals,omitempty"`
+	CallbackSecretArn  string                    `dynamodbav:"callbackSecretArn,omitempty"` // secret the plugin HMAC-signs callbacks with; SigV4 only when unset
+	ClientProfiles     map[string][]string       `dynamodbav:"clientProfiles,omitempty"`    // session client profile name to the capabilities it lists
+	RegisteredAt       string                    `dynamodbav:"registeredAt"`
+	Version            string                    `dynamodbav:"version"`
 }
 
 // MethodTarget defines how to invoke a method handler (internal only)
 type MethodTarget struct {
-	InvocationType string `dynamodbav:"invocationType"`
-	InvokeTarget   string `dynamodbav:"invokeTarget"`
+	InvocationType string         `dynamodbav:"invocationType"`
+	InvokeTarget   string         `dynamodbav:"invokeTarget"`
+	Async          bool           `dynamodbav:"async,omitempty"`       // fire-and-forget: invoked with InvocationType Event, answered without waiting for the plugin
+	Capability     string         `dynamodbav:"capability,omitempty"`  // capability that owns the method, which a request must list in using to call it
+	ArgsSchema     map[string]any `dynamodbav:"argsSchema,omitempty"`  // JSON Schema core validates the method's arguments against before invoking it; see internal/argschema
+	Paging         bool           `dynamodbav:"paging,omitempty"`      // a /query method that follows the paging contract, whose paging arguments and response core checks; see pkg/querypage
+	StateTokens    bool           `dynamodbav:"stateTokens,omitempty"` // a /changes or /queryChanges method taking state tokens core verifies before invoking it; see pkg/statetoken
 }
 
 // EventTarget defines where to deliver a system event (internal only)
 type EventTarget struct {
-	TargetType string `dynamodbav:"targetType"` // "sqs"
-	TargetArn  string `dynamodbav:"targetArn"`  // SQS queue ARN
+	TargetType string `dynamodbav:"targetType"`           // "sqs", "sns", "eventbridge", "webhook", or "lambda" for synchronous callbacks such as account.export
+	TargetArn  string `dynamodbav:"targetArn"`            // SQS queue, SNS topic, EventBridge bus, or Lambda function ARN; HTTPS URL for webhooks
+	DetailType string `dynamodbav:"detailType,omitempty"` // EventBridge detail-type; defaults to the event type
+	SecretArn  string `dynamodbav:"secretArn,omitempty"`  // Secrets Manager secret holding the webhook signing key
 }
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/jarrod-lowe/jmap-service-libs/plugincontract"
 )
 
 func TestPluginRecord_DynamoDBMarshal_PreservesKeys(t *testing.T) {
@@ -122,7 +123,7 @@ func TestMethodTarget_DynamoDBRoundTrip(t *testing.T) {
 }
 
 func TestPluginInvocationRequest_JSONMarshal(t *testing.T) {
-	req := PluginInvocationRequest{
+	req := PluginInvocationRequest{PluginInvocationRequest: plugincontract.PluginInvocationRequest{
 		RequestID: "req-123",
 		CallIndex: 0,
 		AccountID: "user-456",
@@ -132,7 +133,7 @@ func TestPluginInvocationRequest_JSONMarshal(t *testing.T) {
 			"ids":       []string{"email-1", "email-2"},
 		},
 		ClientID: "c0",
-	}
+	}}
 
 	data, err := json.Marshal(req)
 	if err != nil {
@@ -164,6 +165,31 @@ func TestPluginInvocationRequest_JSONMarshal(t *testing.T) {
 	if _, ok := parsed["clientId"]; !ok {
 		t.Error("expected 'clientId' in JSON output")
 	}
+
+	if _, ok := parsed["delegationToken"]; ok {
+		t.Error("expected no 'delegationToken' in JSON output when unset")
+	}
+}
+
+func TestPluginInvocationRequest_JSONMarshal_DelegationToken(t *testing.T) {
+	req := PluginInvocationRequest{
+		PluginInvocationRequest: plugincontract.PluginInvocationRequest{AccountID: "user-456", Method: "Email/import"},
+		DelegationToken:         "jmd.payload.signature",
+	}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	// Contract fields stay at the top level alongside the token
+	var parsed map[string]any
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatalf("failed to unmarshal JSON: %v", err)
+	}
+	if parsed["delegationToken"] != "jmd.payload.signature" || parsed["accountId"] != "user-456" {
+		t.Errorf("unexpected JSON: %s", data)
+	}
 }
 
 func TestPluginInvocationResponse_JSONUnmarshal(t *testing.T) {
@@ -0,0 +1,78 @@
+package pluginlatency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+)
+
+// Store keeps flushed statistics for the admin API
+type Store interface {
+	Put(ctx context.Context, stats Stats) error
+}
+
+// MetricsRecorder publishes flushed statistics as metrics
+type MetricsRecorder interface {
+	RecordPluginLatency(latency metrics.PluginLatency)
+}
+
+// Flusher flushes a Tracker at most once per Interval. Lambda freezes an
+// instance between invocations, so there is no background timer; the
+// handler calls FlushIfDue at the end of each request instead.
+type Flusher struct {
+	Tracker  *Tracker
+	Store    Store           // nil skips storing
+	Metrics  MetricsRecorder // nil skips metrics
+	Instance string
+	Interval time.Duration
+
+	mu   sync.Mutex
+	last time.Time
+	now  func() time.Time
+}
+
+// FlushIfDue flushes the tracker if Interval has passed since the last
+// flush, or since the first call. Metrics are always recorded; storage
+// failures are returned together.
+func (f *Flusher) FlushIfDue(ctx context.Context) error {
+	now := time.Now
+	if f.now != nil {
+		now = f.now
+	}
+
+	f.mu.Lock()
+	current := now()
+	if f.last.IsZero() {
+		f.last = current
+	}
+	if current.Sub(f.last) < f.Interval {
+		f.mu.Unlock()
+		return nil
+	}
+	f.last = current
+	f.mu.Unlock()
+
+	var errs []error
+	for _, s := range f.Tracker.Flush(f.Instance) {
+		if f.Metrics != nil {
+			f.Metrics.RecordPluginLatency(metrics.PluginLatency{
+				Target: s.Target,
+				Calls:  s.Calls,
+				Errors: s.Errors,
+				P50:    s.P50Ms,
+				P90:    s.P90Ms,
+				P99:    s.P99Ms,
+			})
+		}
+		if f.Store != nil {
+			if err := f.Store.Put(ctx, s); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.Target, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,183 @@
+// Package pluginlatency tracks how long plugin invocations take, per invoke
+// target, so operators can find slow plugins without tracing every request.
+//
+// Tracker wraps a plugin.Invoker and keeps the latencies of each target's
+// most recent calls. jmap-api flushes them periodically: each flush writes
+// EMF metrics and stores the instance's statistics in DynamoDB, where the
+// account-admin Lambda reads them back for operators.
+package pluginlatency
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// DefaultWindow is how many recent calls per target percentiles are taken
+// over
+const DefaultWindow = 512
+
+// Stats are one instance's latency statistics for an invoke target.
+// Percentiles are over the target's most recent calls; Calls and Errors
+// count the calls since the previous flush.
+type Stats struct {
+	Target    string  `dynamodbav:"target" json:"target"`
+	Instance  string  `dynamodbav:"instance" json:"instance"`
+	Calls     int     `dynamodbav:"calls" json:"calls"`
+	Errors    int     `dynamodbav:"errors" json:"errors"`
+	Samples   int     `dynamodbav:"samples" json:"samples"`
+	P50Ms     float64 `dynamodbav:"p50Ms" json:"p50Ms"`
+	P90Ms     float64 `dynamodbav:"p90Ms" json:"p90Ms"`
+	P99Ms     float64 `dynamodbav:"p99Ms" json:"p99Ms"`
+	MaxMs     float64 `dynamodbav:"maxMs" json:"maxMs"`
+	UpdatedAt string  `dynamodbav:"updatedAt" json:"updatedAt"`
+}
+
+// targetLatency holds a target's recent latencies in a ring
+type targetLatency struct {
+	samples []time.Duration
+	next    int
+	calls   int
+	errors  int
+}
+
+// Tracker is a plugin.Invoker recording the latency of each call it passes
+// on, by invoke target
+type Tracker struct {
+	next   plugin.Invoker
+	window int
+	now    func() time.Time
+
+	mu      sync.Mutex
+	targets map[string]*targetLatency
+}
+
+// NewTracker wraps next, keeping the latencies of the last window calls per
+// target; zero means DefaultWindow
+func NewTracker(next plugin.Invoker, window int) *Tracker {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &Tracker{
+		next:    next,
+		window:  window,
+		now:     time.Now,
+		targets: make(map[string]*targetLatency),
+	}
+}
+
+// Invoke invokes the plugin and records how long it took
+func (t *Tracker) Invoke(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+	start := t.now()
+	resp, err := t.next.Invoke(ctx, target, request)
+	t.record(target.InvokeTarget, t.now().Sub(start), err != nil)
+	return resp, err
+}
+
+// record adds a call's latency to its target's ring
+func (t *Tracker) record(target string, latency time.Duration, failed bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	tl, ok := t.targets[target]
+	if !ok {
+		tl = &targetLatency{samples: make([]time.Duration, 0, t.window)}
+		t.targets[target] = tl
+	}
+	if len(tl.samples) < t.window {
+		tl.samples = append(tl.samples, latency)
+	} else {
+		tl.samples[tl.next] = latency
+	}
+	tl.next = (tl.next + 1) % t.window
+	tl.calls++
+	if failed {
+		tl.errors++
+	}
+}
+
+// Flush returns the statistics of every target called since the previous
+// flush, ordered by target, and resets their call counts. Recent latencies
+// are kept, so percentiles roll rather than restart.
+func (t *Tracker) Flush(instance string) []Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	updatedAt := t.now().UTC().Format(time.RFC3339)
+	var stats []Stats
+	for target, tl := range t.targets {
+		if tl.calls == 0 {
+			continue
+		}
+		sorted := slices.Clone(tl.samples)
+		slices.Sort(sorted)
+		stats = append(stats, Stats{
+			Target:    target,
+			Instance:  instance,
+			Calls:     tl.calls,
+			Errors:    tl.errors,
+			Samples:   len(sorted),
+			P50Ms:     milliseconds(percentile(sorted, 50)),
+			P90Ms:     milliseconds(percentile(sorted, 90)),
+			P99Ms:     milliseconds(percentile(sorted, 99)),
+			MaxMs:     milliseconds(sorted[len(sorted)-1]),
+			UpdatedAt: updatedAt,
+		})
+		tl.calls = 0
+		tl.errors = 0
+	}
+	slices.SortFunc(stats, func(a, b Stats) int { return strings.Compare(a.Target, b.Target) })
+	return stats
+}
+
+// percentile returns the nearest-rank pth percentile of sorted, which must
+// not be empty
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// TargetSummary combines every instance's statistics for a target. Calls
+// and Errors are summed; percentiles cannot be merged, so each is the
+// highest any instance reported, an upper bound.
+type TargetSummary struct {
+	Target    string  `json:"target"`
+	Calls     int     `json:"calls"`
+	Errors    int     `json:"errors"`
+	P50Ms     float64 `json:"p50Ms"`
+	P90Ms     float64 `json:"p90Ms"`
+	P99Ms     float64 `json:"p99Ms"`
+	MaxMs     float64 `json:"maxMs"`
+	Instances []Stats `json:"instances"`
+}
+
+// Summarize combines statistics by target, ordered by target
+func Summarize(stats []Stats) []TargetSummary {
+	summaries := []TargetSummary{}
+	byTarget := make(map[string]int)
+	for _, s := range stats {
+		i, ok := byTarget[s.Target]
+		if !ok {
+			i = len(summaries)
+			byTarget[s.Target] = i
+			summaries = append(summaries, TargetSummary{Target: s.Target})
+		}
+		summary := &summaries[i]
+		summary.Calls += s.Calls
+		summary.Errors += s.Errors
+		summary.P50Ms = max(summary.P50Ms, s.P50Ms)
+		summary.P90Ms = max(summary.P90Ms, s.P90Ms)
+		summary.P99Ms = max(summary.P99Ms, s.P99Ms)
+		summary.MaxMs = max(summary.MaxMs, s.MaxMs)
+		summary.Instances = append(summary.Instances, s)
+	}
+	slices.SortFunc(summaries, func(a, b TargetSummary) int { return strings.Compare(a.Target, b.Target) })
+	return summaries
+}
@@ -0,0 +1,198 @@
+package pluginlatency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/metrics"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// stubInvoker fails calls to failTarget and succeeds otherwise
+type stubInvoker struct {
+	failTarget string
+}
+
+func (s *stubInvoker) Invoke(ctx context.Context, target plugin.MethodTarget, request plugin.PluginInvocationRequest) (*plugin.PluginInvocationResponse, error) {
+	if target.InvokeTarget == s.failTarget {
+		return nil, errors.New("invoke failed")
+	}
+	return &plugin.PluginInvocationResponse{}, nil
+}
+
+// newTracker returns a tracker whose clock makes successive calls take the
+// given latencies, then none
+func newTracker(next plugin.Invoker, window int, latencies ...time.Duration) *Tracker {
+	tracker := NewTracker(next, window)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	reads := 0
+	tracker.now = func() time.Time {
+		if reads%2 == 1 && len(latencies) > 0 {
+			now = now.Add(latencies[0])
+			latencies = latencies[1:]
+		}
+		reads++
+		return now
+	}
+	return tracker
+}
+
+func invoke(t *testing.T, tracker *Tracker, target string) {
+	t.Helper()
+	_, _ = tracker.Invoke(context.Background(), plugin.MethodTarget{InvokeTarget: target}, plugin.PluginInvocationRequest{})
+}
+
+func TestTracker_Percentiles(t *testing.T) {
+	latencies := make([]time.Duration, 100)
+	for i := range latencies {
+		latencies[i] = time.Duration(i+1) * time.Millisecond
+	}
+	tracker := newTracker(&stubInvoker{}, 0, latencies...)
+	for range latencies {
+		invoke(t, tracker, "fn-a")
+	}
+
+	stats := tracker.Flush("instance-1")
+	if len(stats) != 1 {
+		t.Fatalf("expected stats for one target, got %+v", stats)
+	}
+	s := stats[0]
+	if s.Target != "fn-a" || s.Instance != "instance-1" || s.Calls != 100 || s.Errors != 0 || s.Samples != 100 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if s.P50Ms != 50 || s.P90Ms != 90 || s.P99Ms != 99 || s.MaxMs != 100 {
+		t.Errorf("unexpected percentiles %+v", s)
+	}
+}
+
+func TestTracker_CountsErrorsAndResetsOnFlush(t *testing.T) {
+	tracker := newTracker(&stubInvoker{failTarget: "fn-b"}, 0)
+	invoke(t, tracker, "fn-a")
+	invoke(t, tracker, "fn-b")
+	invoke(t, tracker, "fn-b")
+
+	stats := tracker.Flush("i")
+	if len(stats) != 2 || stats[0].Target != "fn-a" || stats[1].Target != "fn-b" {
+		t.Fatalf("expected stats ordered by target, got %+v", stats)
+	}
+	if stats[1].Calls != 2 || stats[1].Errors != 2 {
+		t.Errorf("expected 2 failed calls to fn-b, got %+v", stats[1])
+	}
+
+	if stats := tracker.Flush("i"); len(stats) != 0 {
+		t.Errorf("expected no stats without new calls, got %+v", stats)
+	}
+	invoke(t, tracker, "fn-a")
+	stats = tracker.Flush("i")
+	if len(stats) != 1 || stats[0].Calls != 1 || stats[0].Samples != 2 {
+		t.Errorf("expected one new call over two samples, got %+v", stats)
+	}
+}
+
+func TestTracker_WindowKeepsRecentCalls(t *testing.T) {
+	tracker := newTracker(&stubInvoker{}, 2, 100*time.Millisecond, time.Millisecond, 2*time.Millisecond)
+	for range 3 {
+		invoke(t, tracker, "fn-a")
+	}
+
+	s := tracker.Flush("i")[0]
+	if s.Samples != 2 || s.MaxMs != 2 || s.Calls != 3 {
+		t.Errorf("expected the slow first call to have rolled out, got %+v", s)
+	}
+}
+
+// recordingStore records the stats it is given
+type recordingStore struct {
+	stats []Stats
+	err   error
+}
+
+func (r *recordingStore) Put(ctx context.Context, stats Stats) error {
+	r.stats = append(r.stats, stats)
+	return r.err
+}
+
+// recordingMetrics records the latencies it is given
+type recordingMetrics struct {
+	targets []string
+}
+
+func (r *recordingMetrics) RecordPluginLatency(latency metrics.PluginLatency) {
+	r.targets = append(r.targets, latency.Target)
+}
+
+func TestFlusher_FlushesOncePerInterval(t *testing.T) {
+	tracker := newTracker(&stubInvoker{}, 0)
+	store := &recordingStore{}
+	recorder := &recordingMetrics{}
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	flusher := &Flusher{
+		Tracker:  tracker,
+		Store:    store,
+		Metrics:  recorder,
+		Instance: "instance-1",
+		Interval: time.Minute,
+		now:      func() time.Time { return now },
+	}
+
+	invoke(t, tracker, "fn-a")
+	if err := flusher.FlushIfDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.stats) != 0 {
+		t.Fatalf("expected no flush before the interval, got %+v", store.stats)
+	}
+
+	now = now.Add(time.Minute)
+	if err := flusher.FlushIfDue(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(store.stats) != 1 || store.stats[0].Instance != "instance-1" || len(recorder.targets) != 1 {
+		t.Errorf("expected one flush, got stats %+v and metrics %v", store.stats, recorder.targets)
+	}
+
+	now = now.Add(time.Second)
+	invoke(t, tracker, "fn-a")
+	_ = flusher.FlushIfDue(context.Background())
+	if len(store.stats) != 1 {
+		t.Errorf("expected no second flush within the interval, got %+v", store.stats)
+	}
+}
+
+func TestFlusher_ReturnsStoreErrors(t *testing.T) {
+	tracker := newTracker(&stubInvoker{}, 0)
+	recorder := &recordingMetrics{}
+	flusher := &Flusher{
+		Tracker: tracker,
+		Store:   &recordingStore{err: errors.New("throttled")},
+		Metrics: recorder,
+	}
+
+	invoke(t, tracker, "fn-a")
+	if err := flusher.FlushIfDue(context.Background()); err == nil {
+		t.Fatal("expected the store error")
+	}
+	if len(recorder.targets) != 1 {
+		t.Errorf("expected metrics to be recorded despite the store error, got %v", recorder.targets)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summaries := Summarize([]Stats{
+		{Target: "fn-b", Instance: "i-1", Calls: 5, Errors: 1, P50Ms: 10, P90Ms: 20, P99Ms: 30, MaxMs: 40},
+		{Target: "fn-a", Instance: "i-1", Calls: 1, P99Ms: 5},
+		{Target: "fn-b", Instance: "i-2", Calls: 2, Errors: 1, P50Ms: 15, P90Ms: 18, P99Ms: 50, MaxMs: 50},
+	})
+	if len(summaries) != 2 || summaries[0].Target != "fn-a" || summaries[1].Target != "fn-b" {
+		t.Fatalf("expected summaries ordered by target, got %+v", summaries)
+	}
+	b := summaries[1]
+	if b.Calls != 7 || b.Errors != 2 || b.P50Ms != 15 || b.P90Ms != 20 || b.P99Ms != 50 || b.MaxMs != 50 || len(b.Instances) != 2 {
+		t.Errorf("unexpected summary %+v", b)
+	}
+	if summaries := Summarize(nil); summaries == nil || len(summaries) != 0 {
+		t.Errorf("expected an empty list, got %#v", summaries)
+	}
+}
@@ -0,0 +1,102 @@
+package pluginlatency
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// PK is the partition key of the latency records. Each is
+// PLUGINLATENCY# / {target}#{instance}, so every instance's view of a
+// target is kept.
+const PK = "PLUGINLATENCY#"
+
+// RecordTTL is how long a record outlives its last flush, so records of
+// instances Lambda has retired expire
+const RecordTTL = 15 * time.Minute
+
+// DynamoDBClient defines the interface for DynamoDB operations needed for latency records
+type DynamoDBClient interface {
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+// DynamoDBStore stores latency statistics in DynamoDB
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// Put stores an instance's statistics for a target, replacing its previous
+// ones
+func (d *DynamoDBStore) Put(ctx context.Context, stats Stats) error {
+	item, err := attributevalue.MarshalMap(stats)
+	if err != nil {
+		return fmt.Errorf("failed to marshal plugin latency: %w", err)
+	}
+	item["pk"] = &types.AttributeValueMemberS{Value: PK}
+	item["sk"] = &types.AttributeValueMemberS{Value: stats.Target + "#" + stats.Instance}
+	item["ttl"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(d.now().Add(RecordTTL).Unix(), 10)}
+
+	if _, err := d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	}); err != nil {
+		return fmt.Errorf("failed to store plugin latency: %w", err)
+	}
+	return nil
+}
+
+// List returns every instance's statistics, ordered by target. Records past
+// their TTL but not yet removed by DynamoDB are left out.
+func (d *DynamoDBStore) List(ctx context.Context) ([]Stats, error) {
+	stats := []Stats{}
+	now := strconv.FormatInt(d.now().Unix(), 10)
+	var startKey map[string]types.AttributeValue
+
+	for {
+		output, err := d.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:                aws.String(d.tableName),
+			KeyConditionExpression:   aws.String("pk = :pk"),
+			FilterExpression:         aws.String("#ttl > :now"),
+			ExpressionAttributeNames: map[string]string{"#ttl": "ttl"},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":  &types.AttributeValueMemberS{Value: PK},
+				":now": &types.AttributeValueMemberN{Value: now},
+			},
+			ExclusiveStartKey: startKey,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list plugin latency: %w", err)
+		}
+
+		for _, item := range output.Items {
+			var s Stats
+			if err := attributevalue.UnmarshalMap(item, &s); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal plugin latency: %w", err)
+			}
+			stats = append(stats, s)
+		}
+
+		if len(output.LastEvaluatedKey) == 0 {
+			return stats, nil
+		}
+		startKey = output.LastEvaluatedKey
+	}
+}
@@ -0,0 +1,87 @@
+package pluginlatency
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBClient struct {
+	putItemFunc func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	queryFunc   func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	if m.putItemFunc != nil {
+		return m.putItemFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	if m.queryFunc != nil {
+		return m.queryFunc(ctx, params, optFns...)
+	}
+	return &dynamodb.QueryOutput{}, nil
+}
+
+var testNow = time.Unix(1772366400, 0)
+
+func TestDynamoDBStore_Put(t *testing.T) {
+	var item map[string]types.AttributeValue
+	client := &mockDynamoDBClient{
+		putItemFunc: func(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+			item = params.Item
+			return &dynamodb.PutItemOutput{}, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+	store.now = func() time.Time { return testNow }
+
+	if err := store.Put(context.Background(), Stats{Target: "fn-a", Instance: "instance-1", Calls: 3, P99Ms: 12.5}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if item["pk"].(*types.AttributeValueMemberS).Value != "PLUGINLATENCY#" || item["sk"].(*types.AttributeValueMemberS).Value != "fn-a#instance-1" {
+		t.Errorf("unexpected key %v %v", item["pk"], item["sk"])
+	}
+	if item["ttl"].(*types.AttributeValueMemberN).Value != "1772367300" {
+		t.Errorf("expected ttl 15 minutes ahead, got %v", item["ttl"])
+	}
+	if item["p99Ms"].(*types.AttributeValueMemberN).Value != "12.5" {
+		t.Errorf("unexpected p99Ms %v", item["p99Ms"])
+	}
+}
+
+func TestDynamoDBStore_ListPages(t *testing.T) {
+	pages := [][]map[string]types.AttributeValue{
+		{{"target": &types.AttributeValueMemberS{Value: "fn-a"}, "instance": &types.AttributeValueMemberS{Value: "i-1"}, "calls": &types.AttributeValueMemberN{Value: "4"}}},
+		{{"target": &types.AttributeValueMemberS{Value: "fn-b"}, "instance": &types.AttributeValueMemberS{Value: "i-1"}}},
+	}
+	calls := 0
+	client := &mockDynamoDBClient{
+		queryFunc: func(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+			if params.ExpressionAttributeValues[":now"].(*types.AttributeValueMemberN).Value != "1772366400" {
+				t.Errorf("expected expired records to be filtered, got %v", params.ExpressionAttributeValues)
+			}
+			output := &dynamodb.QueryOutput{Items: pages[calls]}
+			calls++
+			if calls < len(pages) {
+				output.LastEvaluatedKey = map[string]types.AttributeValue{"pk": &types.AttributeValueMemberS{Value: PK}}
+			}
+			return output, nil
+		},
+	}
+	store := NewDynamoDBStore(client, "table")
+	store.now = func() time.Time { return testNow }
+
+	stats, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(stats) != 2 || stats[0].Target != "fn-a" || stats[0].Calls != 4 || stats[1].Target != "fn-b" {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
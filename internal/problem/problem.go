@@ -0,0 +1,153 @@
+// Package problem builds the RFC 7807 bodies of the HTTP-level errors core
+// returns, so every handler answers with the same shape:
+//
+//	{"type": "urn:ietf:params:jmap:error:notFound", "title": "Not Found",
+//	 "status": 404, "detail": "Blob not found", "code": "CORE-4001",
+//	 "correlationId": "..."}
+//
+// Error types registered with IANA for JMAP use the urn:ietf:params:jmap:error:
+// namespace; core's own types, such as rateLimited, use TypePrefixCore.
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+)
+
+// ContentType is the media type of problem bodies
+const ContentType = "application/problem+json"
+
+// Type URI prefixes for JMAP-registered error types and core's own
+const (
+	TypePrefixJMAP = "urn:ietf:params:jmap:error:"
+	TypePrefixCore = "urn:jmap-service-core:error:"
+)
+
+// jmapTypes are the error types in the IANA JMAP Error Codes registry
+var jmapTypes = map[string]bool{
+	"accountNotFound":        true,
+	"accountReadOnly":        true,
+	"blobNotFound":           true,
+	"forbidden":              true,
+	"invalidArguments":       true,
+	"invalidProperties":      true,
+	"invalidResultReference": true,
+	"limit":                  true,
+	"notFound":               true,
+	"notJSON":                true,
+	"notRequest":             true,
+	"overQuota":              true,
+	"serverFail":             true,
+	"serverUnavailable":      true,
+	"tooLarge":               true,
+	"unknownCapability":      true,
+	"unknownMethod":          true,
+}
+
+// titles are the short, fixed summaries of each error type
+var titles = map[string]string{
+	"accountNotFound":        "Account Not Found",
+	"accountNotProvisioned":  "Account Not Provisioned",
+	"accountReadOnly":        "Account Read Only",
+	"blobNotFound":           "Blob Not Found",
+	"conflict":               "Conflict",
+	"forbidden":              "Forbidden",
+	"invalidArguments":       "Invalid Arguments",
+	"invalidProperties":      "Invalid Properties",
+	"invalidResultReference": "Invalid Result Reference",
+	"limit":                  "Limit Exceeded",
+	"notFound":               "Not Found",
+	"notJSON":                "Not JSON",
+	"notRequest":             "Not Request",
+	"overQuota":              "Over Quota",
+	"rateLimited":            "Rate Limited",
+	"serverFail":             "Server Failure",
+	"serverUnavailable":      "Server Unavailable",
+	"tooLarge":               "Too Large",
+	"tooManyPending":         "Too Many Pending",
+	"unauthorized":           "Unauthorized",
+	"unknownCapability":      "Unknown Capability",
+	"unknownMethod":          "Unknown Method",
+}
+
+// Problem is an RFC 7807 problem details object. Limit and MaxSize are
+// extension members naming and giving a size limit that was exceeded, and
+// MethodCallIndex locates the method call a whole request was rejected for.
+type Problem struct {
+	Type          string `json:"type"`
+	Title         string `json:"title"`
+	Status        int    `json:"status"`
+	Detail        string `json:"detail,omitempty"`
+	Code          string `json:"code,omitempty"`
+	CorrelationID string `json:"correlationId,omitempty"`
+	Limit         string `json:"limit,omitempty"`
+	MaxSize       int64  `json:"maxSize,omitempty"`
+	// MethodCallIndex is a pointer, as the first call's index is zero
+	MethodCallIndex *int `json:"methodCallIndex,omitempty"`
+}
+
+// TypeURI returns the type URI of an error type such as "notFound"
+func TypeURI(errType string) string {
+	if jmapTypes[errType] {
+		return TypePrefixJMAP + errType
+	}
+	return TypePrefixCore + errType
+}
+
+// TypeName returns the error type of a type URI, the inverse of TypeURI
+func TypeName(uri string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(uri, TypePrefixJMAP), TypePrefixCore)
+}
+
+// New builds a problem of an error type, with the type's code
+func New(status int, errType, detail string) *Problem {
+	title, ok := titles[errType]
+	if !ok {
+		title = http.StatusText(status)
+	}
+	return &Problem{
+		Type:   TypeURI(errType),
+		Title:  title,
+		Status: status,
+		Detail: detail,
+		Code:   string(errcode.ForType(errType)),
+	}
+}
+
+// WithCode replaces the problem's code and returns it
+func (p *Problem) WithCode(code errcode.Code) *Problem {
+	p.Code = string(code)
+	return p
+}
+
+// WithLimit names the size limit exceeded and its value, and returns the
+// problem
+func (p *Problem) WithLimit(limit string, maxSize int64) *Problem {
+	p.Limit = limit
+	p.MaxSize = maxSize
+	return p
+}
+
+// WithMethodCall names the index of the method call the problem is about,
+// and returns the problem
+func (p *Problem) WithMethodCall(index int) *Problem {
+	p.MethodCallIndex = &index
+	return p
+}
+
+// Body returns the problem as JSON, carrying the correlation ID in ctx
+func (p *Problem) Body(ctx context.Context) string {
+	p.CorrelationID = correlation.FromContext(ctx)
+	body, _ := json.Marshal(p)
+	return string(body)
+}
+
+// Headers returns the headers of a problem response
+func Headers() map[string]string {
+	return map[string]string{"Content-Type": ContentType}
+}
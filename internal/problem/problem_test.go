@@ -0,0 +1,94 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/errcode"
+)
+
+func TestTypeURI(t *testing.T) {
+	tests := []struct {
+		errType string
+		want    string
+	}{
+		{"notJSON", "urn:ietf:params:jmap:error:notJSON"},
+		{"notFound", "urn:ietf:params:jmap:error:notFound"},
+		{"rateLimited", "urn:jmap-service-core:error:rateLimited"},
+		{"unauthorized", "urn:jmap-service-core:error:unauthorized"},
+	}
+	for _, tt := range tests {
+		if got := TypeURI(tt.errType); got != tt.want {
+			t.Errorf("TypeURI(%q) = %q, want %q", tt.errType, got, tt.want)
+		}
+		if got := TypeName(tt.want); got != tt.errType {
+			t.Errorf("TypeName(%q) = %q, want %q", tt.want, got, tt.errType)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	p := New(404, "notFound", "Blob not found")
+	if p.Type != "urn:ietf:params:jmap:error:notFound" || p.Title != "Not Found" || p.Status != 404 || p.Code != "CORE-4001" {
+		t.Errorf("unexpected problem %+v", p)
+	}
+
+	p = New(418, "somethingNew", "")
+	if p.Title != "I'm a teapot" || p.Code != "" {
+		t.Errorf("expected the status text and no code, got %+v", p)
+	}
+
+	p = New(403, "forbidden", "Account is suspended").WithCode(errcode.AccountSuspended)
+	if p.Code != "CORE-3005" {
+		t.Errorf("expected CORE-3005, got %q", p.Code)
+	}
+}
+
+func TestBody(t *testing.T) {
+	ctx := correlation.WithID(context.Background(), "corr-1")
+	body := New(413, "tooLarge", "Blob exceeds maximum size of 4 bytes").WithLimit("maxSizeUpload", 4).Body(ctx)
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	want := map[string]any{
+		"type":          "urn:ietf:params:jmap:error:tooLarge",
+		"title":         "Too Large",
+		"status":        float64(413),
+		"detail":        "Blob exceeds maximum size of 4 bytes",
+		"code":          "CORE-1002",
+		"correlationId": "corr-1",
+		"limit":         "maxSizeUpload",
+		"maxSize":       float64(4),
+	}
+	for k, v := range want {
+		if fields[k] != v {
+			t.Errorf("%s: got %v, want %v", k, fields[k], v)
+		}
+	}
+	if len(fields) != len(want) {
+		t.Errorf("unexpected members in %s", body)
+	}
+}
+
+func TestBody_WithMethodCall(t *testing.T) {
+	body := New(400, "unknownMethod", "unknown method Foo/bar").WithMethodCall(0).Body(context.Background())
+
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if index, ok := fields["methodCallIndex"]; !ok || index != float64(0) {
+		t.Errorf("expected methodCallIndex 0, got %s", body)
+	}
+}
+
+func TestBody_WithoutCorrelationID(t *testing.T) {
+	body := New(500, "serverFail", "").Body(context.Background())
+	if body != `{"type":"urn:ietf:params:jmap:error:serverFail","title":"Server Failure","status":500,"code":"CORE-5001"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+}
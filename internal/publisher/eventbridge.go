@@ -0,0 +1,91 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// EventBridgeSource is the source of every event put on an EventBridge bus
+const EventBridgeSource = "jmap-service"
+
+// EventBridgeEntry is a single event for PutEvents
+type EventBridgeEntry struct {
+	EventBusName string
+	Source       string
+	DetailType   string
+	Detail       string
+}
+
+// EventBridgeClient puts events on EventBridge buses
+type EventBridgeClient interface {
+	PutEvents(ctx context.Context, entries []EventBridgeEntry) error
+}
+
+// EventBridgeAPI is the EventBridge SDK operation used by SDKEventBridgeClient
+type EventBridgeAPI interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// SDKEventBridgeClient puts events with the EventBridge SDK client
+type SDKEventBridgeClient struct {
+	client EventBridgeAPI
+}
+
+// NewSDKEventBridgeClient creates a new SDKEventBridgeClient
+func NewSDKEventBridgeClient(client EventBridgeAPI) *SDKEventBridgeClient {
+	return &SDKEventBridgeClient{client: client}
+}
+
+// PutEvents puts entries on their buses. Each entry is sent to the region of
+// its bus ARN, or the client's region if it is not an ARN, so entries for
+// buses in several regions are sent in one call per region.
+func (c *SDKEventBridgeClient) PutEvents(ctx context.Context, entries []EventBridgeEntry) error {
+	var regions []string
+	byRegion := make(map[string][]ebtypes.PutEventsRequestEntry)
+	for _, entry := range entries {
+		region := arnRegion(entry.EventBusName)
+		if _, ok := byRegion[region]; !ok {
+			regions = append(regions, region)
+		}
+		byRegion[region] = append(byRegion[region], ebtypes.PutEventsRequestEntry{
+			EventBusName: aws.String(entry.EventBusName),
+			Source:       aws.String(entry.Source),
+			DetailType:   aws.String(entry.DetailType),
+			Detail:       aws.String(entry.Detail),
+		})
+	}
+
+	for _, region := range regions {
+		var optFns []func(*eventbridge.Options)
+		if region != "" {
+			optFns = append(optFns, func(o *eventbridge.Options) { o.Region = region })
+		}
+		output, err := c.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: byRegion[region]}, optFns...)
+		if err != nil {
+			return fmt.Errorf("PutEvents request failed: %w", err)
+		}
+		if output.FailedEntryCount > 0 {
+			for _, entry := range output.Entries {
+				if entry.ErrorCode != nil {
+					return fmt.Errorf("PutEvents failed for %d entries: %s: %s", output.FailedEntryCount, aws.ToString(entry.ErrorCode), aws.ToString(entry.ErrorMessage))
+				}
+			}
+			return fmt.Errorf("PutEvents failed for %d entries", output.FailedEntryCount)
+		}
+	}
+	return nil
+}
+
+// arnRegion returns the region of an ARN, or "" if value is not an ARN
+func arnRegion(value string) string {
+	parts := strings.Split(value, ":")
+	if len(parts) < 6 || parts[0] != "arn" {
+		return ""
+	}
+	return parts[3]
+}
@@ -0,0 +1,90 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+// mockEventBridgeAPI records each PutEvents call and the region it was sent to
+type mockEventBridgeAPI struct {
+	inputs  []*eventbridge.PutEventsInput
+	regions []string
+	output  *eventbridge.PutEventsOutput
+	err     error
+}
+
+func (m *mockEventBridgeAPI) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput, optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	options := eventbridge.Options{Region: "us-east-1"}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	m.inputs = append(m.inputs, params)
+	m.regions = append(m.regions, options.Region)
+	if m.err != nil {
+		return nil, m.err
+	}
+	if m.output != nil {
+		return m.output, nil
+	}
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+func TestSDKEventBridgeClient_PutEvents_SendsToBusRegion(t *testing.T) {
+	api := &mockEventBridgeAPI{}
+	client := NewSDKEventBridgeClient(api)
+
+	err := client.PutEvents(context.Background(), []EventBridgeEntry{
+		{
+			EventBusName: "arn:aws:events:ap-southeast-2:123456789012:event-bus/billing",
+			Source:       EventBridgeSource,
+			DetailType:   "account.created",
+			Detail:       `{"accountId":"user-123"}`,
+		},
+		{EventBusName: "default", Source: EventBridgeSource, DetailType: "quota.updated", Detail: `{}`},
+		{EventBusName: "arn:aws:events:ap-southeast-2:123456789012:event-bus/audit", Source: EventBridgeSource, DetailType: "account.created", Detail: `{}`},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(api.inputs) != 2 {
+		t.Fatalf("expected one call per region, got %d", len(api.inputs))
+	}
+	if api.regions[0] != "ap-southeast-2" || len(api.inputs[0].Entries) != 2 {
+		t.Errorf("expected both ARN entries sent to the bus region, got %s with %d entries", api.regions[0], len(api.inputs[0].Entries))
+	}
+	if api.regions[1] != "us-east-1" || aws.ToString(api.inputs[1].Entries[0].EventBusName) != "default" {
+		t.Errorf("expected the client region for bus names, got %s", api.regions[1])
+	}
+	entry := api.inputs[0].Entries[0]
+	if aws.ToString(entry.DetailType) != "account.created" || aws.ToString(entry.Source) != EventBridgeSource || aws.ToString(entry.Detail) != `{"accountId":"user-123"}` {
+		t.Errorf("unexpected entry %+v", entry)
+	}
+}
+
+func TestSDKEventBridgeClient_PutEvents_FailedEntries(t *testing.T) {
+	api := &mockEventBridgeAPI{output: &eventbridge.PutEventsOutput{
+		FailedEntryCount: 1,
+		Entries:          []ebtypes.PutEventsResultEntry{{ErrorCode: aws.String("InternalFailure"), ErrorMessage: aws.String("boom")}},
+	}}
+	client := NewSDKEventBridgeClient(api)
+
+	err := client.PutEvents(context.Background(), []EventBridgeEntry{{EventBusName: "default"}})
+	if err == nil || !strings.Contains(err.Error(), "InternalFailure") {
+		t.Errorf("expected failed entry error, got %v", err)
+	}
+}
+
+func TestSDKEventBridgeClient_PutEvents_RequestError(t *testing.T) {
+	client := NewSDKEventBridgeClient(&mockEventBridgeAPI{err: errors.New("access denied")})
+
+	if err := client.PutEvents(context.Background(), []EventBridgeEntry{{EventBusName: "default"}}); err == nil {
+		t.Error("expected error for a failed request")
+	}
+}
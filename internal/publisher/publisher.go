@@ -0,0 +1,590 @@
+package publisher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+var logger = loglevel.New()
+
+// Event types published to subscribed plugins
+const (
+	EventAccountCreated    = "account.created"
+	EventQuotaUpdated      = "quota.updated"
+	EventAccountExport     = "account.export"
+	EventAccountImport     = "account.import"
+	EventUsageReport       = "usage.report"
+	EventUsageThreshold    = "usage.threshold"
+	EventQuotaWarning      = "quota.warning"
+	EventQuotaExceeded     = "quota.exceeded"
+	EventBlobScanRequested = "blob.scan.requested"
+	EventBlobUploadPart    = "blob.upload.part"
+	EventAccountInactive   = "account.inactive"
+)
+
+// Event target types delivered by the publisher
+const (
+	TargetTypeSQS         = "sqs"
+	TargetTypeEventBridge = "eventbridge"
+	TargetTypeSNS         = "sns"
+	TargetTypeWebhook     = "webhook"
+)
+
+// EventPayload represents a system event notification sent to plugin event targets
+type EventPayload struct {
+	SchemaVersion int            `json:"schemaVersion,omitempty"` // set to CurrentSchemaVersion when sent
+	EventType     string         `json:"eventType"`
+	OccurredAt    string         `json:"occurredAt"`
+	AccountID     string         `json:"accountId"`
+	Data          map[string]any `json:"data,omitempty"`
+	CorrelationID string         `json:"correlationId,omitempty"` // request that caused the event; set from the context when sent
+}
+
+// SQSClient is the interface for SQS operations
+type SQSClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(ctx context.Context, params *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error)
+}
+
+// SNSClient is the interface for SNS operations
+type SNSClient interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error)
+}
+
+// EventTargetGetter provides event targets from the plugin registry
+type EventTargetGetter interface {
+	GetEventTargets(eventType string) []plugin.AggregatedEventTarget
+}
+
+// Default retry policy for a failed send to a target
+const (
+	defaultMaxAttempts = 3
+	defaultBackoff     = 100 * time.Millisecond
+)
+
+// defaultConcurrency bounds how many queues, buses and topics an event is
+// sent to at once
+const defaultConcurrency = 8
+
+// maxBatchEntries is the most messages SQS accepts in one SendMessageBatch
+const maxBatchEntries = 10
+
+// errTargetNotEnabled is returned for targets whose client is not configured.
+// Retrying cannot succeed, so these are not retried.
+var errTargetNotEnabled = errors.New("target type is not enabled")
+
+// errInvalidTarget is returned for targets that are misconfigured in the
+// registry. Retrying cannot succeed, so these are not retried.
+var errInvalidTarget = errors.New("invalid target")
+
+// DeadLetter is an event that could not be sent to a target after retries
+type DeadLetter struct {
+	Target   plugin.AggregatedEventTarget
+	Payload  EventPayload
+	Error    string
+	Attempts int
+}
+
+// DeadLetterStore keeps events that exhausted their retries until they are
+// redriven
+type DeadLetterStore interface {
+	Put(ctx context.Context, letter DeadLetter) error
+}
+
+// EventLog keeps published events so they can be replayed to plugins
+type EventLog interface {
+	Append(ctx context.Context, payload EventPayload) error
+}
+
+// SQSEventPublisher publishes events to SQS queues, and to EventBridge buses,
+// SNS topics and webhooks when their clients are configured
+type SQSEventPublisher struct {
+	sqsClient   SQSClient
+	eventBridge EventBridgeClient
+	snsClient   SNSClient
+	webhooks    WebhookClient
+	registry    EventTargetGetter
+	deadLetters DeadLetterStore
+	eventLog    EventLog
+	maxAttempts int
+	backoff     time.Duration
+	concurrency int
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+// NewSQSEventPublisher creates a new SQSEventPublisher
+func NewSQSEventPublisher(sqsClient SQSClient, registry EventTargetGetter) *SQSEventPublisher {
+	return &SQSEventPublisher{
+		sqsClient:   sqsClient,
+		registry:    registry,
+		maxAttempts: defaultMaxAttempts,
+		backoff:     defaultBackoff,
+		concurrency: defaultConcurrency,
+		sleep:       sleepContext,
+	}
+}
+
+// FromConfig creates an SQSEventPublisher that delivers to every target
+// type, with SDK clients built from cfg. Dead letters and the event log are
+// left to the caller, since not every Lambda should record them.
+func FromConfig(cfg aws.Config, registry EventTargetGetter) *SQSEventPublisher {
+	return NewSQSEventPublisher(sqs.NewFromConfig(cfg), registry).
+		WithEventBridge(NewSDKEventBridgeClient(eventbridge.NewFromConfig(cfg))).
+		WithSNS(sns.NewFromConfig(cfg)).
+		WithWebhooks(NewHTTPWebhookClient(secretsmanager.NewFromConfig(cfg)))
+}
+
+// WithEventBridge enables delivery to eventbridge targets
+func (p *SQSEventPublisher) WithEventBridge(client EventBridgeClient) *SQSEventPublisher {
+	p.eventBridge = client
+	return p
+}
+
+// WithSNS enables delivery to sns targets
+func (p *SQSEventPublisher) WithSNS(client SNSClient) *SQSEventPublisher {
+	p.snsClient = client
+	return p
+}
+
+// WithWebhooks enables delivery to webhook targets
+func (p *SQSEventPublisher) WithWebhooks(client WebhookClient) *SQSEventPublisher {
+	p.webhooks = client
+	return p
+}
+
+// WithRetry sets how many times a send to each target is attempted, and the
+// backoff before the first retry, which doubles for each later retry
+func (p *SQSEventPublisher) WithRetry(maxAttempts int, backoff time.Duration) *SQSEventPublisher {
+	p.maxAttempts = maxAttempts
+	p.backoff = backoff
+	return p
+}
+
+// WithConcurrency sets how many destinations an event is sent to at once
+func (p *SQSEventPublisher) WithConcurrency(concurrency int) *SQSEventPublisher {
+	p.concurrency = concurrency
+	return p
+}
+
+// WithDeadLetters stores events that Publish could not send after retries
+func (p *SQSEventPublisher) WithDeadLetters(store DeadLetterStore) *SQSEventPublisher {
+	p.deadLetters = store
+	return p
+}
+
+// WithEventLog records every published event for replay
+func (p *SQSEventPublisher) WithEventLog(log EventLog) *SQSEventPublisher {
+	p.eventLog = log
+	return p
+}
+
+// Publish sends the event to all registered targets. A send that fails after
+// retries is written to the dead-letter store, if configured, and does not
+// fail the caller.
+func (p *SQSEventPublisher) Publish(ctx context.Context, payload EventPayload) error {
+	_, err := p.send(ctx, payload, true)
+	return err
+}
+
+// Deliver sends the event to all registered targets and returns an error
+// if any send failed after retries, so the caller can retry. A retry sends to
+// every target again, so targets must tolerate duplicates.
+func (p *SQSEventPublisher) Deliver(ctx context.Context, payload EventPayload) error {
+	failed, err := p.send(ctx, payload, false)
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to deliver %s event to %d targets", payload.EventType, failed)
+	}
+	return nil
+}
+
+// SendTo sends the event to a single target with retries, such as when
+// redriving a dead letter
+func (p *SQSEventPublisher) SendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload EventPayload) error {
+	encoder, err := newPayloadEncoder(payload)
+	if err != nil {
+		return err
+	}
+	body, err := encoder.encode(target.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	_, err = p.sendWithRetry(ctx, target, payload, body)
+	return err
+}
+
+// send sends the event to each registered target, returning the number of
+// targets that could not be sent to. Failed sends are dead-lettered if
+// deadLetter is set.
+func (p *SQSEventPublisher) send(ctx context.Context, payload EventPayload, deadLetter bool) (int, error) {
+	if payload.CorrelationID == "" {
+		payload.CorrelationID = correlation.FromContext(ctx)
+	}
+
+	// Log the event even without targets, so plugins that subscribe later can replay it
+	if p.eventLog != nil {
+		if err := p.eventLog.Append(ctx, payload); err != nil {
+			logger.WarnContext(ctx, "Failed to log event for replay",
+				slog.String("account_id", payload.AccountID),
+				slog.String("event_type", payload.EventType),
+				slog.String("error", err.Error()))
+		}
+	}
+
+	targets := p.registry.GetEventTargets(payload.EventType)
+	if len(targets) == 0 {
+		logger.InfoContext(ctx, "No event targets registered",
+			slog.String("event_type", payload.EventType))
+		return 0, nil
+	}
+
+	encoder, err := newPayloadEncoder(payload)
+	if err != nil {
+		return 0, err
+	}
+
+	var sendable []plugin.AggregatedEventTarget
+	var bodies [][]byte
+	for _, target := range targets {
+		if !knownTargetType(target.TargetType) {
+			logger.WarnContext(ctx, "Unknown target type, skipping",
+				slog.String("target_type", target.TargetType),
+				slog.String("plugin_id", target.PluginID))
+			continue
+		}
+
+		body, err := encoder.encode(target.SchemaVersion)
+		if err != nil {
+			return 0, err
+		}
+		sendable = append(sendable, target)
+		bodies = append(bodies, body)
+	}
+
+	results := p.sendAll(ctx, sendable, payload, bodies)
+
+	failed := 0
+	for i, target := range sendable {
+		if err := results[i].err; err != nil {
+			failed++
+			logger.ErrorContext(ctx, "Failed to publish event",
+				slog.String("plugin_id", target.PluginID),
+				slog.String("target_type", target.TargetType),
+				slog.String("target_arn", target.TargetArn),
+				slog.Int("attempts", results[i].attempts),
+				slog.String("error", err.Error()))
+			if deadLetter {
+				p.deadLetter(ctx, DeadLetter{Target: target, Payload: payload, Error: err.Error(), Attempts: results[i].attempts})
+			}
+			// Continue to other targets
+		} else {
+			logger.InfoContext(ctx, "Published event",
+				slog.String("event_type", payload.EventType),
+				slog.String("plugin_id", target.PluginID))
+		}
+	}
+	return failed, nil
+}
+
+// sendResult is the outcome of sending to one target
+type sendResult struct {
+	attempts int
+	err      error
+}
+
+// sendAll sends to every target, returning a result for each. SQS targets
+// that share a queue are sent in batches; each queue, bus and topic is sent
+// to in parallel, up to the publisher's concurrency.
+func (p *SQSEventPublisher) sendAll(ctx context.Context, targets []plugin.AggregatedEventTarget, payload EventPayload, bodies [][]byte) []sendResult {
+	// Group target indexes by queue, keeping the order queues first appear in
+	var groups [][]int
+	queueGroup := make(map[string]int)
+	for i, target := range targets {
+		if target.TargetType == TargetTypeSQS {
+			if g, ok := queueGroup[target.TargetArn]; ok {
+				groups[g] = append(groups[g], i)
+				continue
+			}
+			queueGroup[target.TargetArn] = len(groups)
+		}
+		groups = append(groups, []int{i})
+	}
+
+	results := make([]sendResult, len(targets))
+	sem := make(chan struct{}, max(p.concurrency, 1))
+	var wg sync.WaitGroup
+	for _, group := range groups {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(group []int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			// Each goroutine writes only its own targets' results
+			if len(group) == 1 {
+				attempts, err := p.sendWithRetry(ctx, targets[group[0]], payload, bodies[group[0]])
+				results[group[0]] = sendResult{attempts: attempts, err: err}
+				return
+			}
+			for start := 0; start < len(group); start += maxBatchEntries {
+				batch := group[start:min(start+maxBatchEntries, len(group))]
+				p.sendBatchWithRetry(ctx, targets[batch[0]].TargetArn, batch, payload, bodies, results)
+			}
+		}(group)
+	}
+	wg.Wait()
+	return results
+}
+
+// sendBatchWithRetry sends the bodies of the indexed targets, which share a
+// queue, with SendMessageBatch. Entries that fail are sent again together in
+// a smaller batch, after a doubling backoff, until they succeed or the
+// attempts are exhausted.
+func (p *SQSEventPublisher) sendBatchWithRetry(ctx context.Context, targetArn string, indexes []int, payload EventPayload, bodies [][]byte, results []sendResult) {
+	backoff := p.backoff
+	pending := indexes
+	for attempt := 1; ; attempt++ {
+		failures := p.sendBatch(ctx, targetArn, pending, payload, bodies)
+
+		var retry []int
+		for _, i := range pending {
+			results[i] = sendResult{attempts: attempt, err: failures[i]}
+			if failures[i] != nil {
+				retry = append(retry, i)
+			}
+		}
+		if len(retry) == 0 || attempt >= p.maxAttempts {
+			return
+		}
+		if sleepErr := p.sleep(ctx, backoff); sleepErr != nil {
+			return
+		}
+		backoff *= 2
+		pending = retry
+	}
+}
+
+// sendBatch makes a single SendMessageBatch call, returning the error for
+// each indexed target that was not sent
+func (p *SQSEventPublisher) sendBatch(ctx context.Context, targetArn string, indexes []int, payload EventPayload, bodies [][]byte) map[int]error {
+	fifo := isFIFO(targetArn)
+	entries := make([]sqstypes.SendMessageBatchRequestEntry, len(indexes))
+	for n, i := range indexes {
+		entries[n] = sqstypes.SendMessageBatchRequestEntry{
+			Id:          aws.String(strconv.Itoa(i)),
+			MessageBody: aws.String(string(bodies[i])),
+		}
+		if fifo {
+			entries[n].MessageGroupId = aws.String(payload.AccountID)
+			entries[n].MessageDeduplicationId = aws.String(deduplicationID(bodies[i]))
+		}
+	}
+
+	failures := make(map[int]error)
+	output, err := p.sqsClient.SendMessageBatch(ctx, &sqs.SendMessageBatchInput{
+		QueueUrl: aws.String(arnToQueueURL(targetArn)),
+		Entries:  entries,
+	})
+	if err != nil {
+		for _, i := range indexes {
+			failures[i] = err
+		}
+		return failures
+	}
+	for _, entry := range output.Failed {
+		i, convErr := strconv.Atoi(aws.ToString(entry.Id))
+		if convErr != nil {
+			continue
+		}
+		failures[i] = fmt.Errorf("%s: %s", aws.ToString(entry.Code), aws.ToString(entry.Message))
+	}
+	return failures
+}
+
+// sendWithRetry sends to a target until it succeeds or the attempts are
+// exhausted, returning the number of attempts made
+func (p *SQSEventPublisher) sendWithRetry(ctx context.Context, target plugin.AggregatedEventTarget, payload EventPayload, body []byte) (int, error) {
+	backoff := p.backoff
+	attempts := 0
+	for {
+		attempts++
+		err := p.sendTo(ctx, target, payload, body)
+		if err == nil || attempts >= p.maxAttempts || errors.Is(err, errTargetNotEnabled) || errors.Is(err, errInvalidTarget) {
+			return attempts, err
+		}
+		if sleepErr := p.sleep(ctx, backoff); sleepErr != nil {
+			return attempts, err
+		}
+		backoff *= 2
+	}
+}
+
+// sendTo makes a single send to a target
+func (p *SQSEventPublisher) sendTo(ctx context.Context, target plugin.AggregatedEventTarget, payload EventPayload, body []byte) error {
+	switch target.TargetType {
+	case TargetTypeSQS:
+		return p.sendSQS(ctx, target, payload, body)
+	case TargetTypeEventBridge:
+		return p.sendEventBridge(ctx, target, payload.EventType, body)
+	case TargetTypeSNS:
+		return p.sendSNS(ctx, target, payload, body)
+	case TargetTypeWebhook:
+		return p.sendWebhook(ctx, target, payload.EventType, body)
+	default:
+		return fmt.Errorf("unknown target type %q", target.TargetType)
+	}
+}
+
+// deadLetter stores an event that could not be sent. If it cannot be stored
+// the event is lost, so this is logged as an error.
+func (p *SQSEventPublisher) deadLetter(ctx context.Context, letter DeadLetter) {
+	if p.deadLetters == nil {
+		return
+	}
+	if err := p.deadLetters.Put(ctx, letter); err != nil {
+		logger.ErrorContext(ctx, "Failed to dead-letter event",
+			slog.String("account_id", letter.Payload.AccountID),
+			slog.String("event_type", letter.Payload.EventType),
+			slog.String("plugin_id", letter.Target.PluginID),
+			slog.String("error", err.Error()))
+	}
+}
+
+// knownTargetType reports whether the publisher can send to a target type
+func knownTargetType(targetType string) bool {
+	switch targetType {
+	case TargetTypeSQS, TargetTypeEventBridge, TargetTypeSNS, TargetTypeWebhook:
+		return true
+	}
+	return false
+}
+
+// sleepContext waits for d, returning early if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// sendSQS sends the event body to an SQS queue target
+func (p *SQSEventPublisher) sendSQS(ctx context.Context, target plugin.AggregatedEventTarget, payload EventPayload, body []byte) error {
+	input := &sqs.SendMessageInput{
+		QueueUrl:    aws.String(arnToQueueURL(target.TargetArn)),
+		MessageBody: aws.String(string(body)),
+	}
+	if isFIFO(target.TargetArn) {
+		input.MessageGroupId = aws.String(payload.AccountID)
+		input.MessageDeduplicationId = aws.String(deduplicationID(body))
+	}
+	_, err := p.sqsClient.SendMessage(ctx, input)
+	return err
+}
+
+// sendEventBridge puts the event on an EventBridge bus target. The detail
+// type is the event type unless the target maps it to another name.
+func (p *SQSEventPublisher) sendEventBridge(ctx context.Context, target plugin.AggregatedEventTarget, eventType string, body []byte) error {
+	if p.eventBridge == nil {
+		return fmt.Errorf("eventbridge: %w", errTargetNotEnabled)
+	}
+
+	detailType := eventType
+	if target.DetailType != "" {
+		detailType = target.DetailType
+	}
+	return p.eventBridge.PutEvents(ctx, []EventBridgeEntry{{
+		EventBusName: target.TargetArn,
+		Source:       EventBridgeSource,
+		DetailType:   detailType,
+		Detail:       string(body),
+	}})
+}
+
+// sendSNS publishes the event body to an SNS topic target. The event type and
+// account ID are set as message attributes so subscriptions can filter on them.
+func (p *SQSEventPublisher) sendSNS(ctx context.Context, target plugin.AggregatedEventTarget, payload EventPayload, body []byte) error {
+	if p.snsClient == nil {
+		return fmt.Errorf("sns: %w", errTargetNotEnabled)
+	}
+
+	input := &sns.PublishInput{
+		TopicArn: aws.String(target.TargetArn),
+		Message:  aws.String(string(body)),
+		MessageAttributes: map[string]snstypes.MessageAttributeValue{
+			"eventType": {DataType: aws.String("String"), StringValue: aws.String(payload.EventType)},
+			"accountId": {DataType: aws.String("String"), StringValue: aws.String(payload.AccountID)},
+		},
+	}
+	if isFIFO(target.TargetArn) {
+		input.MessageGroupId = aws.String(payload.AccountID)
+		input.MessageDeduplicationId = aws.String(deduplicationID(body))
+	}
+	_, err := p.snsClient.Publish(ctx, input)
+	return err
+}
+
+// sendWebhook posts the event body to a webhook target's HTTPS URL, signed
+// with the target's secret
+func (p *SQSEventPublisher) sendWebhook(ctx context.Context, target plugin.AggregatedEventTarget, eventType string, body []byte) error {
+	if p.webhooks == nil {
+		return fmt.Errorf("webhook: %w", errTargetNotEnabled)
+	}
+	if !validWebhookEndpoint(target.TargetArn) {
+		return fmt.Errorf("webhook URL must be https: %w", errInvalidTarget)
+	}
+	if target.SecretArn == "" {
+		return fmt.Errorf("webhook has no secretArn: %w", errInvalidTarget)
+	}
+	return p.webhooks.Post(ctx, target.TargetArn, target.SecretArn, eventType, body)
+}
+
+// isFIFO reports whether a queue or topic ARN names a FIFO resource
+func isFIFO(arn string) bool {
+	return strings.HasSuffix(arn, ".fifo")
+}
+
+// deduplicationID derives a FIFO deduplication ID from the event body, so a
+// retried send of the same event is dropped while distinct events, which
+// differ at least in occurredAt, are not
+func deduplicationID(body []byte) string {
+	hash := sha256.Sum256(body)
+	return hex.EncodeToString(hash[:])
+}
+
+// arnToQueueURL converts an SQS ARN to a queue URL
+// arn:aws:sqs:region:account:queue-name -> https://sqs.region.amazonaws.com/account/queue-name
+func arnToQueueURL(arn string) string {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 {
+		return ""
+	}
+	region := parts[3]
+	account := parts[4]
+	queueName := parts[5]
+	return fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", region, account, queueName)
+}
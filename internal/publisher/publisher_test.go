@@ -0,0 +1,823 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+func TestArnToQueueURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		arn      string
+		expected string
+	}{
+		{
+			name:     "valid SQS ARN",
+			arn:      "arn:aws:sqs:ap-southeast-2:123456789012:my-queue",
+			expected: "https://sqs.ap-southeast-2.amazonaws.com/123456789012/my-queue",
+		},
+		{
+			name:     "us-east-1 region",
+			arn:      "arn:aws:sqs:us-east-1:999888777666:another-queue",
+			expected: "https://sqs.us-east-1.amazonaws.com/999888777666/another-queue",
+		},
+		{
+			name:     "invalid ARN - too few parts",
+			arn:      "arn:aws:sqs:region",
+			expected: "",
+		},
+		{
+			name:     "empty ARN",
+			arn:      "",
+			expected: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			result := arnToQueueURL(tc.arn)
+			if result != tc.expected {
+				t.Errorf("arnToQueueURL(%q) = %q, want %q", tc.arn, result, tc.expected)
+			}
+		})
+	}
+}
+
+// MockSQSClient implements SQSClient for testing
+type MockSQSClient struct {
+	mu                 sync.Mutex
+	SendMessageCalled  bool
+	SendMessageInputs  []MockSendMessageInput
+	SendMessageErr     error
+	SendMessageResults []*sqs.SendMessageOutput
+	callIndex          int
+	BatchInputs        []*sqs.SendMessageBatchInput
+	// BatchFailures lists entry IDs to fail, one list per batch call
+	BatchFailures [][]string
+}
+
+type MockSendMessageInput struct {
+	QueueURL               string
+	MessageBody            string
+	MessageGroupID         string
+	MessageDeduplicationID string
+}
+
+func (m *MockSQSClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.SendMessageCalled = true
+	m.SendMessageInputs = append(m.SendMessageInputs, MockSendMessageInput{
+		QueueURL:               *input.QueueUrl,
+		MessageBody:            *input.MessageBody,
+		MessageGroupID:         aws.ToString(input.MessageGroupId),
+		MessageDeduplicationID: aws.ToString(input.MessageDeduplicationId),
+	})
+	if m.SendMessageErr != nil {
+		return nil, m.SendMessageErr
+	}
+	if m.callIndex < len(m.SendMessageResults) {
+		result := m.SendMessageResults[m.callIndex]
+		m.callIndex++
+		return result, nil
+	}
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (m *MockSQSClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	call := len(m.BatchInputs)
+	m.BatchInputs = append(m.BatchInputs, input)
+	if m.SendMessageErr != nil {
+		return nil, m.SendMessageErr
+	}
+	output := &sqs.SendMessageBatchOutput{}
+	if call < len(m.BatchFailures) {
+		for _, id := range m.BatchFailures[call] {
+			output.Failed = append(output.Failed, sqstypes.BatchResultErrorEntry{
+				Id:      aws.String(id),
+				Code:    aws.String("InternalError"),
+				Message: aws.String("try again"),
+			})
+		}
+	}
+	return output, nil
+}
+
+// MockEventTargetGetter implements EventTargetGetter for testing
+type MockEventTargetGetter struct {
+	Targets []plugin.AggregatedEventTarget
+}
+
+func (m *MockEventTargetGetter) GetEventTargets(eventType string) []plugin.AggregatedEventTarget {
+	return m.Targets
+}
+
+func TestSQSEventPublisher_Publish_SendsToAllTargets(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "plugin-a",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-a",
+			},
+			{
+				PluginID:   "plugin-b",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
+			},
+		},
+	}
+
+	publisher := &SQSEventPublisher{
+		sqsClient: mockSQS,
+		registry:  mockRegistry,
+	}
+
+	payload := EventPayload{
+		EventType:  "account.created",
+		OccurredAt: "2026-02-01T00:00:00Z",
+		AccountID:  "user-123",
+		Data: map[string]any{
+			"quotaBytes": int64(1073741824),
+		},
+	}
+
+	err := publisher.Publish(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if !mockSQS.SendMessageCalled {
+		t.Fatal("expected SQS.SendMessage to be called")
+	}
+
+	if len(mockSQS.SendMessageInputs) != 2 {
+		t.Fatalf("expected 2 SendMessage calls, got %d", len(mockSQS.SendMessageInputs))
+	}
+
+	// Verify first message
+	if mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-a" {
+		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[0].QueueURL)
+	}
+
+	// Verify second message
+	if mockSQS.SendMessageInputs[1].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-b" {
+		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[1].QueueURL)
+	}
+}
+
+func TestSQSEventPublisher_Publish_NoTargets(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{},
+	}
+
+	publisher := &SQSEventPublisher{
+		sqsClient: mockSQS,
+		registry:  mockRegistry,
+	}
+
+	payload := EventPayload{
+		EventType: "account.created",
+		AccountID: "user-123",
+	}
+
+	err := publisher.Publish(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Should not call SQS when no targets
+	if mockSQS.SendMessageCalled {
+		t.Error("expected SQS.SendMessage NOT to be called when no targets")
+	}
+}
+
+func TestSQSEventPublisher_Publish_SkipsNonSQSTargets(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "plugin-a",
+				TargetType: "lambda", // Not SQS
+				TargetArn:  "arn:aws:lambda:ap-southeast-2:123456789012:function:my-func",
+			},
+			{
+				PluginID:   "plugin-b",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
+			},
+		},
+	}
+
+	publisher := &SQSEventPublisher{
+		sqsClient: mockSQS,
+		registry:  mockRegistry,
+	}
+
+	payload := EventPayload{
+		EventType: "account.created",
+		AccountID: "user-123",
+	}
+
+	err := publisher.Publish(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	// Should only call SQS once (for the SQS target)
+	if len(mockSQS.SendMessageInputs) != 1 {
+		t.Errorf("expected 1 SendMessage call, got %d", len(mockSQS.SendMessageInputs))
+	}
+
+	if mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-b" {
+		t.Errorf("unexpected queue URL: %s", mockSQS.SendMessageInputs[0].QueueURL)
+	}
+}
+
+func TestSQSEventPublisher_Publish_ContinuesOnSQSError(t *testing.T) {
+	mockSQS := &MockSQSClient{
+		SendMessageErr: errors.New("SQS error"),
+	}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "plugin-a",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-a",
+			},
+			{
+				PluginID:   "plugin-b",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
+			},
+		},
+	}
+
+	publisher := &SQSEventPublisher{
+		sqsClient: mockSQS,
+		registry:  mockRegistry,
+	}
+
+	payload := EventPayload{
+		EventType: "account.created",
+		AccountID: "user-123",
+	}
+
+	// Should not return error even if SQS fails
+	err := publisher.Publish(context.Background(), payload)
+	if err != nil {
+		t.Fatalf("expected no error even on SQS failures, got %v", err)
+	}
+
+	// Should still attempt both targets
+	if len(mockSQS.SendMessageInputs) != 2 {
+		t.Errorf("expected 2 SendMessage attempts, got %d", len(mockSQS.SendMessageInputs))
+	}
+}
+
+func TestSQSEventPublisher_Deliver_ReturnsErrorOnSQSError(t *testing.T) {
+	mockSQS := &MockSQSClient{
+		SendMessageErr: errors.New("SQS error"),
+	}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "plugin-a",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-a",
+			},
+			{
+				PluginID:   "plugin-b",
+				TargetType: "sqs",
+				TargetArn:  "arn:aws:sqs:ap-southeast-2:123456789012:queue-b",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(mockSQS, mockRegistry).WithRetry(3, 0)
+
+	err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"})
+	if err == nil {
+		t.Fatal("expected error so the caller can retry")
+	}
+
+	// Should retry each target
+	if len(mockSQS.SendMessageInputs) != 6 {
+		t.Errorf("expected 6 SendMessage attempts, got %d", len(mockSQS.SendMessageInputs))
+	}
+}
+
+func TestSQSEventPublisher_Deliver_NoTargets(t *testing.T) {
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, &MockEventTargetGetter{})
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Errorf("expected no error without targets, got %v", err)
+	}
+}
+
+// MockEventBridgeClient implements EventBridgeClient for testing
+type MockEventBridgeClient struct {
+	mu      sync.Mutex
+	Entries []EventBridgeEntry
+	Err     error
+}
+
+func (m *MockEventBridgeClient) PutEvents(ctx context.Context, entries []EventBridgeEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Entries = append(m.Entries, entries...)
+	return m.Err
+}
+
+func TestSQSEventPublisher_Publish_EventBridgeTargets(t *testing.T) {
+	mockEventBridge := &MockEventBridgeClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "billing",
+				TargetType: "eventbridge",
+				TargetArn:  "arn:aws:events:ap-southeast-2:123456789012:event-bus/billing",
+			},
+			{
+				PluginID:   "crm",
+				TargetType: "eventbridge",
+				TargetArn:  "arn:aws:events:ap-southeast-2:123456789012:event-bus/crm",
+				DetailType: "Account Created",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry).WithEventBridge(mockEventBridge).WithConcurrency(1)
+
+	err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mockEventBridge.Entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(mockEventBridge.Entries))
+	}
+	first := mockEventBridge.Entries[0]
+	if first.EventBusName != "arn:aws:events:ap-southeast-2:123456789012:event-bus/billing" || first.Source != EventBridgeSource {
+		t.Errorf("unexpected entry: %+v", first)
+	}
+	if first.DetailType != "account.created" {
+		t.Errorf("expected detail type to default to the event type, got %q", first.DetailType)
+	}
+	if !strings.Contains(first.Detail, `"accountId":"user-123"`) {
+		t.Errorf("expected detail to be the event payload, got %s", first.Detail)
+	}
+	if mockEventBridge.Entries[1].DetailType != "Account Created" {
+		t.Errorf("expected mapped detail type, got %q", mockEventBridge.Entries[1].DetailType)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_EventBridgeNotEnabled(t *testing.T) {
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "billing",
+				TargetType: "eventbridge",
+				TargetArn:  "arn:aws:events:ap-southeast-2:123456789012:event-bus/billing",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+		t.Error("expected error when eventbridge targets are not enabled")
+	}
+}
+
+// MockSNSClient implements SNSClient for testing
+type MockSNSClient struct {
+	mu     sync.Mutex
+	Inputs []*sns.PublishInput
+	Err    error
+}
+
+func (m *MockSNSClient) Publish(ctx context.Context, input *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Inputs = append(m.Inputs, input)
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSQSEventPublisher_Publish_SNSTargets(t *testing.T) {
+	mockSNS := &MockSNSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "notify",
+				TargetType: "sns",
+				TargetArn:  "arn:aws:sns:ap-southeast-2:123456789012:account-events",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry).WithSNS(mockSNS)
+
+	err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mockSNS.Inputs) != 1 {
+		t.Fatalf("expected 1 publish, got %d", len(mockSNS.Inputs))
+	}
+	input := mockSNS.Inputs[0]
+	if *input.TopicArn != "arn:aws:sns:ap-southeast-2:123456789012:account-events" {
+		t.Errorf("unexpected topic ARN %q", *input.TopicArn)
+	}
+	if !strings.Contains(*input.Message, `"accountId":"user-123"`) {
+		t.Errorf("expected message to be the event payload, got %s", *input.Message)
+	}
+	if attr, ok := input.MessageAttributes["eventType"]; !ok || *attr.StringValue != "account.created" {
+		t.Errorf("expected eventType message attribute, got %+v", input.MessageAttributes)
+	}
+	if attr, ok := input.MessageAttributes["accountId"]; !ok || *attr.StringValue != "user-123" {
+		t.Errorf("expected accountId message attribute, got %+v", input.MessageAttributes)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_SNSError(t *testing.T) {
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "notify",
+				TargetType: "sns",
+				TargetArn:  "arn:aws:sns:ap-southeast-2:123456789012:account-events",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry).WithSNS(&MockSNSClient{Err: errors.New("SNS error")}).WithRetry(1, 0)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+		t.Error("expected error when SNS publish fails")
+	}
+}
+
+func TestSQSEventPublisher_Deliver_SNSNotEnabled(t *testing.T) {
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{
+				PluginID:   "notify",
+				TargetType: "sns",
+				TargetArn:  "arn:aws:sns:ap-southeast-2:123456789012:account-events",
+			},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+		t.Error("expected error when sns targets are not enabled")
+	}
+}
+
+func TestSQSEventPublisher_Publish_FIFOQueueOrdersByAccount(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{PluginID: "mail", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:events.fifo"},
+			{PluginID: "other", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:events"},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(mockSQS, mockRegistry).WithConcurrency(1)
+
+	first := EventPayload{EventType: "quota.updated", OccurredAt: "2026-01-01T00:00:00Z", AccountID: "user-123"}
+	second := EventPayload{EventType: "quota.updated", OccurredAt: "2026-01-01T00:00:01Z", AccountID: "user-123"}
+	for _, payload := range []EventPayload{first, first, second} {
+		if err := publisher.Deliver(context.Background(), payload); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	fifo := mockSQS.SendMessageInputs[0]
+	if fifo.MessageGroupID != "user-123" {
+		t.Errorf("expected account ID as message group, got %q", fifo.MessageGroupID)
+	}
+	if fifo.MessageDeduplicationID == "" {
+		t.Error("expected deduplication ID for FIFO queue")
+	}
+	standard := mockSQS.SendMessageInputs[1]
+	if standard.MessageGroupID != "" || standard.MessageDeduplicationID != "" {
+		t.Errorf("expected no FIFO attributes for standard queue, got %+v", standard)
+	}
+	if mockSQS.SendMessageInputs[2].MessageDeduplicationID != fifo.MessageDeduplicationID {
+		t.Error("expected the same event to have the same deduplication ID")
+	}
+	if mockSQS.SendMessageInputs[4].MessageDeduplicationID == fifo.MessageDeduplicationID {
+		t.Error("expected distinct events to have distinct deduplication IDs")
+	}
+}
+
+func TestSQSEventPublisher_Publish_FIFOTopic(t *testing.T) {
+	mockSNS := &MockSNSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{PluginID: "notify", TargetType: "sns", TargetArn: "arn:aws:sns:ap-southeast-2:123456789012:account-events.fifo"},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, mockRegistry).WithSNS(mockSNS)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	input := mockSNS.Inputs[0]
+	if aws.ToString(input.MessageGroupId) != "user-123" || aws.ToString(input.MessageDeduplicationId) == "" {
+		t.Errorf("expected FIFO attributes for FIFO topic, got group %q dedup %q", aws.ToString(input.MessageGroupId), aws.ToString(input.MessageDeduplicationId))
+	}
+}
+
+// flakySQSClient fails a number of sends before succeeding
+type flakySQSClient struct {
+	failures int
+	calls    int
+}
+
+func (m *flakySQSClient) SendMessage(ctx context.Context, input *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error) {
+	m.calls++
+	if m.calls <= m.failures {
+		return nil, errors.New("SQS throttled")
+	}
+	return &sqs.SendMessageOutput{}, nil
+}
+
+func (m *flakySQSClient) SendMessageBatch(ctx context.Context, input *sqs.SendMessageBatchInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageBatchOutput, error) {
+	return nil, errors.New("unexpected batch send")
+}
+
+// MockDeadLetterStore implements DeadLetterStore for testing
+type MockDeadLetterStore struct {
+	Letters []DeadLetter
+	Err     error
+}
+
+func (m *MockDeadLetterStore) Put(ctx context.Context, letter DeadLetter) error {
+	m.Letters = append(m.Letters, letter)
+	return m.Err
+}
+
+func singleSQSTarget() *MockEventTargetGetter {
+	return &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{PluginID: "plugin-a", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:queue-a"},
+		},
+	}
+}
+
+func TestSQSEventPublisher_Deliver_RetriesWithBackoff(t *testing.T) {
+	client := &flakySQSClient{failures: 2}
+	publisher := NewSQSEventPublisher(client, singleSQSTarget()).WithRetry(3, 100*time.Millisecond)
+	var waits []time.Duration
+	publisher.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("expected send to succeed on retry, got %v", err)
+	}
+	if client.calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", client.calls)
+	}
+	if len(waits) != 2 || waits[0] != 100*time.Millisecond || waits[1] != 200*time.Millisecond {
+		t.Errorf("expected exponential backoff, got %v", waits)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_StopsRetryingWhenContextDone(t *testing.T) {
+	client := &flakySQSClient{failures: 3}
+	publisher := NewSQSEventPublisher(client, singleSQSTarget()).WithRetry(3, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := publisher.Deliver(ctx, EventPayload{EventType: "account.created"}); err == nil {
+		t.Fatal("expected error")
+	}
+	if client.calls != 1 {
+		t.Errorf("expected no retries after the context is done, got %d attempts", client.calls)
+	}
+}
+
+func TestSQSEventPublisher_Publish_DeadLettersAfterRetries(t *testing.T) {
+	deadLetters := &MockDeadLetterStore{}
+	publisher := NewSQSEventPublisher(&MockSQSClient{SendMessageErr: errors.New("SQS error")}, singleSQSTarget()).
+		WithRetry(2, 0).
+		WithDeadLetters(deadLetters)
+
+	payload := EventPayload{EventType: "account.created", AccountID: "user-123"}
+	if err := publisher.Publish(context.Background(), payload); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if len(deadLetters.Letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %d", len(deadLetters.Letters))
+	}
+	letter := deadLetters.Letters[0]
+	if letter.Target.PluginID != "plugin-a" || letter.Payload.AccountID != "user-123" {
+		t.Errorf("unexpected dead letter: %+v", letter)
+	}
+	if letter.Attempts != 2 || letter.Error != "SQS error" {
+		t.Errorf("expected attempts and error to be recorded, got %+v", letter)
+	}
+}
+
+func TestSQSEventPublisher_Publish_DeadLetterFailureDoesNotFail(t *testing.T) {
+	publisher := NewSQSEventPublisher(&MockSQSClient{SendMessageErr: errors.New("SQS error")}, singleSQSTarget()).
+		WithRetry(1, 0).
+		WithDeadLetters(&MockDeadLetterStore{Err: errors.New("DynamoDB error")})
+
+	if err := publisher.Publish(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_DoesNotDeadLetter(t *testing.T) {
+	deadLetters := &MockDeadLetterStore{}
+	publisher := NewSQSEventPublisher(&MockSQSClient{SendMessageErr: errors.New("SQS error")}, singleSQSTarget()).
+		WithRetry(1, 0).
+		WithDeadLetters(deadLetters)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+		t.Fatal("expected error so the caller can retry")
+	}
+	if len(deadLetters.Letters) != 0 {
+		t.Error("expected the caller's retry to be relied on instead of dead-lettering")
+	}
+}
+
+func TestSQSEventPublisher_SendTo_SendsToSingleTarget(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	publisher := NewSQSEventPublisher(mockSQS, &MockEventTargetGetter{})
+
+	target := plugin.AggregatedEventTarget{PluginID: "plugin-a", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:queue-a"}
+	if err := publisher.SendTo(context.Background(), target, EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(mockSQS.SendMessageInputs) != 1 || mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/queue-a" {
+		t.Errorf("unexpected sends: %+v", mockSQS.SendMessageInputs)
+	}
+}
+
+// MockEventLog implements EventLog for testing
+type MockEventLog struct {
+	Events []EventPayload
+	Err    error
+}
+
+func (m *MockEventLog) Append(ctx context.Context, payload EventPayload) error {
+	m.Events = append(m.Events, payload)
+	return m.Err
+}
+
+func TestSQSEventPublisher_Publish_LogsEventWithoutTargets(t *testing.T) {
+	eventLog := &MockEventLog{}
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, &MockEventTargetGetter{}).WithEventLog(eventLog)
+
+	if err := publisher.Publish(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(eventLog.Events) != 1 || eventLog.Events[0].AccountID != "user-123" {
+		t.Errorf("expected event to be logged for replay, got %+v", eventLog.Events)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_EventLogFailureDoesNotFail(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	publisher := NewSQSEventPublisher(mockSQS, singleSQSTarget()).WithEventLog(&MockEventLog{Err: errors.New("DynamoDB error")})
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("expected delivery to succeed, got %v", err)
+	}
+	if len(mockSQS.SendMessageInputs) != 1 {
+		t.Error("expected the event to be sent")
+	}
+}
+
+func sharedQueueTargets(n int, arn string) *MockEventTargetGetter {
+	registry := &MockEventTargetGetter{}
+	for i := range n {
+		registry.Targets = append(registry.Targets, plugin.AggregatedEventTarget{
+			PluginID:   "plugin-" + strconv.Itoa(i),
+			TargetType: "sqs",
+			TargetArn:  arn,
+		})
+	}
+	return registry
+}
+
+func TestSQSEventPublisher_Deliver_BatchesTargetsSharingAQueue(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	registry := sharedQueueTargets(12, "arn:aws:sqs:ap-southeast-2:123456789012:shared.fifo")
+	registry.Targets = append(registry.Targets, plugin.AggregatedEventTarget{
+		PluginID: "solo", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:solo",
+	})
+	publisher := NewSQSEventPublisher(mockSQS, registry)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mockSQS.BatchInputs) != 2 {
+		t.Fatalf("expected 12 targets to be sent in 2 batches, got %d", len(mockSQS.BatchInputs))
+	}
+	entries := len(mockSQS.BatchInputs[0].Entries) + len(mockSQS.BatchInputs[1].Entries)
+	if entries != 12 {
+		t.Errorf("expected 12 batch entries, got %d", entries)
+	}
+	entry := mockSQS.BatchInputs[0].Entries[0]
+	if aws.ToString(entry.MessageGroupId) != "user-123" || aws.ToString(entry.MessageDeduplicationId) == "" {
+		t.Errorf("expected FIFO attributes on batch entries, got %+v", entry)
+	}
+	if len(mockSQS.SendMessageInputs) != 1 || mockSQS.SendMessageInputs[0].QueueURL != "https://sqs.ap-southeast-2.amazonaws.com/123456789012/solo" {
+		t.Errorf("expected a single send to the unshared queue, got %+v", mockSQS.SendMessageInputs)
+	}
+}
+
+func TestSQSEventPublisher_Publish_RetriesAndDeadLettersFailedBatchEntries(t *testing.T) {
+	mockSQS := &MockSQSClient{BatchFailures: [][]string{{"0", "2"}, {"2"}}}
+	deadLetters := &MockDeadLetterStore{}
+	publisher := NewSQSEventPublisher(mockSQS, sharedQueueTargets(3, "arn:aws:sqs:ap-southeast-2:123456789012:shared")).
+		WithRetry(2, 0).
+		WithDeadLetters(deadLetters)
+
+	if err := publisher.Publish(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(mockSQS.BatchInputs) != 2 {
+		t.Fatalf("expected a retry batch, got %d batches", len(mockSQS.BatchInputs))
+	}
+	if len(mockSQS.BatchInputs[1].Entries) != 2 {
+		t.Errorf("expected only the failed entries to be retried, got %d", len(mockSQS.BatchInputs[1].Entries))
+	}
+	if len(deadLetters.Letters) != 1 || deadLetters.Letters[0].Target.PluginID != "plugin-2" || deadLetters.Letters[0].Attempts != 2 {
+		t.Errorf("expected only the entry that kept failing to be dead-lettered, got %+v", deadLetters.Letters)
+	}
+}
+
+// blockingSNSClient records how many publishes are in flight at once
+type blockingSNSClient struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (m *blockingSNSClient) Publish(ctx context.Context, input *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	m.mu.Lock()
+	m.inFlight++
+	m.maxInFlight = max(m.maxInFlight, m.inFlight)
+	m.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	m.mu.Lock()
+	m.inFlight--
+	m.mu.Unlock()
+	return &sns.PublishOutput{}, nil
+}
+
+func TestSQSEventPublisher_Deliver_BoundsConcurrency(t *testing.T) {
+	registry := &MockEventTargetGetter{}
+	for i := range 6 {
+		registry.Targets = append(registry.Targets, plugin.AggregatedEventTarget{
+			PluginID:   "plugin-" + strconv.Itoa(i),
+			TargetType: "sns",
+			TargetArn:  "arn:aws:sns:ap-southeast-2:123456789012:topic-" + strconv.Itoa(i),
+		})
+	}
+	client := &blockingSNSClient{}
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, registry).WithSNS(client).WithConcurrency(2)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.maxInFlight != 2 {
+		t.Errorf("expected 2 sends in flight at most, got %d", client.maxInFlight)
+	}
+}
@@ -0,0 +1,122 @@
+package publisher
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// Event payload schema versions. Version 1 is the original payload, which
+// has no schemaVersion field. Version 2 adds schemaVersion, and version 3
+// adds correlationId.
+const (
+	MinSchemaVersion     = 1
+	CurrentSchemaVersion = 3
+)
+
+// schemaShim converts a decoded payload between adjacent schema versions
+type schemaShim func(payload map[string]any)
+
+// upgrades convert a payload from version N to N+1, keyed by N. They apply to
+// payloads written by older code, such as outbox records.
+var upgrades = map[int]schemaShim{
+	1: func(payload map[string]any) { payload["schemaVersion"] = 2 },
+	2: func(payload map[string]any) { payload["schemaVersion"] = 3 },
+}
+
+// downgrades convert a payload from version N to N-1, keyed by N. They apply
+// to subscribers that declare an older eventSchemaVersion.
+var downgrades = map[int]schemaShim{
+	2: func(payload map[string]any) { delete(payload, "schemaVersion") },
+	3: func(payload map[string]any) {
+		delete(payload, "correlationId")
+		payload["schemaVersion"] = 2
+	},
+}
+
+// payloadEncoder encodes an event payload at each subscriber's schema
+// version, caching the encoding of each version
+type payloadEncoder struct {
+	current []byte
+	bodies  map[int][]byte
+}
+
+// newPayloadEncoder upgrades the payload to the current schema version. A
+// payload with no version is treated as current.
+func newPayloadEncoder(payload EventPayload) (*payloadEncoder, error) {
+	version := payload.SchemaVersion
+	if version == 0 {
+		version = CurrentSchemaVersion
+		payload.SchemaVersion = version
+	}
+	if version < MinSchemaVersion || version > CurrentSchemaVersion {
+		return nil, fmt.Errorf("unsupported event schema version %d", version)
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+
+	if version < CurrentSchemaVersion {
+		body, err = convertPayload(body, version, CurrentSchemaVersion)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &payloadEncoder{
+		current: body,
+		bodies:  map[int][]byte{CurrentSchemaVersion: body},
+	}, nil
+}
+
+// encode returns the payload at a subscriber's declared schema version.
+// Subscribers that declare no version receive version 1, and a version newer
+// than the publisher's receives the current version.
+func (e *payloadEncoder) encode(version int) ([]byte, error) {
+	switch {
+	case version < MinSchemaVersion:
+		version = MinSchemaVersion
+	case version > CurrentSchemaVersion:
+		version = CurrentSchemaVersion
+	}
+
+	if body, ok := e.bodies[version]; ok {
+		return body, nil
+	}
+	body, err := convertPayload(e.current, CurrentSchemaVersion, version)
+	if err != nil {
+		return nil, err
+	}
+	e.bodies[version] = body
+	return body, nil
+}
+
+// convertPayload applies the shims between two schema versions, one version
+// at a time
+func convertPayload(body []byte, from, to int) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var payload map[string]any
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("failed to decode event payload: %w", err)
+	}
+
+	for version := from; version < to; version++ {
+		if shim, ok := upgrades[version]; ok {
+			shim(payload)
+		}
+	}
+	for version := from; version > to; version-- {
+		if shim, ok := downgrades[version]; ok {
+			shim(payload)
+		}
+	}
+
+	converted, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal event payload: %w", err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,134 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+func TestPayloadEncoder_StampsCurrentVersion(t *testing.T) {
+	encoder, err := newPayloadEncoder(EventPayload{EventType: "account.created", AccountID: "user-123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, err := encoder.encode(CurrentSchemaVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var decoded EventPayload
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("expected schema version %d, got %d", CurrentSchemaVersion, decoded.SchemaVersion)
+	}
+}
+
+func TestPayloadEncoder_UndeclaredVersionGetsVersion1(t *testing.T) {
+	encoder, err := newPayloadEncoder(EventPayload{
+		EventType: "quota.updated",
+		AccountID: "user-123",
+		Data:      map[string]any{"bytes": int64(9007199254740993)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, err := encoder.encode(0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(string(body), "schemaVersion") {
+		t.Errorf("expected version 1 payload without schemaVersion, got %s", body)
+	}
+	if !strings.Contains(string(body), `"bytes":9007199254740993`) {
+		t.Errorf("expected data to survive conversion unchanged, got %s", body)
+	}
+}
+
+func TestPayloadEncoder_NewerVersionGetsCurrent(t *testing.T) {
+	encoder, err := newPayloadEncoder(EventPayload{EventType: "account.created"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, err := encoder.encode(CurrentSchemaVersion + 1)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(body), `"schemaVersion":3`) {
+		t.Errorf("expected current version payload, got %s", body)
+	}
+}
+
+func TestPayloadEncoder_UpgradesOlderPayload(t *testing.T) {
+	encoder, err := newPayloadEncoder(EventPayload{SchemaVersion: 1, EventType: "account.created"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	body, err := encoder.encode(CurrentSchemaVersion)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.Contains(string(body), `"schemaVersion":3`) {
+		t.Errorf("expected payload upgraded to version 3, got %s", body)
+	}
+}
+
+func TestPayloadEncoder_UnsupportedVersion(t *testing.T) {
+	if _, err := newPayloadEncoder(EventPayload{SchemaVersion: CurrentSchemaVersion + 1}); err == nil {
+		t.Error("expected error for payload newer than the publisher")
+	}
+}
+
+func TestSQSEventPublisher_Deliver_SendsEachSubscriberItsVersion(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{PluginID: "legacy", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:legacy"},
+			{PluginID: "current", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:current", SchemaVersion: 2},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(mockSQS, mockRegistry).WithConcurrency(1)
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if strings.Contains(mockSQS.SendMessageInputs[0].MessageBody, "schemaVersion") {
+		t.Errorf("expected version 1 body for legacy plugin, got %s", mockSQS.SendMessageInputs[0].MessageBody)
+	}
+	if !strings.Contains(mockSQS.SendMessageInputs[1].MessageBody, `"schemaVersion":2`) {
+		t.Errorf("expected version 2 body for current plugin, got %s", mockSQS.SendMessageInputs[1].MessageBody)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_CorrelationIDFromContext(t *testing.T) {
+	mockSQS := &MockSQSClient{}
+	mockRegistry := &MockEventTargetGetter{
+		Targets: []plugin.AggregatedEventTarget{
+			{PluginID: "v2", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:v2", SchemaVersion: 2},
+			{PluginID: "current", TargetType: "sqs", TargetArn: "arn:aws:sqs:ap-southeast-2:123456789012:current", SchemaVersion: CurrentSchemaVersion},
+		},
+	}
+
+	publisher := NewSQSEventPublisher(mockSQS, mockRegistry).WithConcurrency(1)
+	ctx := correlation.WithID(context.Background(), "abc-123")
+	if err := publisher.Deliver(ctx, EventPayload{EventType: "account.created", AccountID: "user-123"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	v2 := mockSQS.SendMessageInputs[0].MessageBody
+	if strings.Contains(v2, "correlationId") || !strings.Contains(v2, `"schemaVersion":2`) {
+		t.Errorf("expected version 2 body without correlationId, got %s", v2)
+	}
+	if current := mockSQS.SendMessageInputs[1].MessageBody; !strings.Contains(current, `"correlationId":"abc-123"`) {
+		t.Errorf("expected correlationId in current body, got %s", current)
+	}
+}
@@ -0,0 +1,145 @@
+package publisher
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+)
+
+// Headers set on every webhook request. The signature is the hex HMAC-SHA256
+// of "{timestamp}.{body}" keyed with the target's secret, prefixed "sha256=".
+const (
+	WebhookSignatureHeader = "X-JMAP-Signature"
+	WebhookTimestampHeader = "X-JMAP-Timestamp"
+	WebhookEventTypeHeader = "X-JMAP-Event-Type"
+)
+
+// webhookTimeout bounds a single webhook request, so a slow endpoint cannot
+// hold up the other targets
+const webhookTimeout = 10 * time.Second
+
+// secretCacheTTL is how long a signing secret is reused before it is read
+// again, so a rotated secret is picked up without a deploy
+const secretCacheTTL = 5 * time.Minute
+
+// WebhookClient posts signed events to HTTPS endpoints
+type WebhookClient interface {
+	Post(ctx context.Context, endpoint, secretArn, eventType string, body []byte) error
+}
+
+// SecretsClient reads webhook signing secrets from Secrets Manager
+type SecretsClient interface {
+	GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+// cachedSecret is a signing secret and when it was read
+type cachedSecret struct {
+	value    string
+	loadedAt time.Time
+}
+
+// HTTPWebhookClient posts events over HTTPS, signing each request with the
+// target's secret
+type HTTPWebhookClient struct {
+	httpClient aws.HTTPClient
+	secrets    SecretsClient
+	now        func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedSecret
+}
+
+// NewHTTPWebhookClient creates a new HTTPWebhookClient
+func NewHTTPWebhookClient(secrets SecretsClient) *HTTPWebhookClient {
+	return &HTTPWebhookClient{
+		httpClient: &http.Client{Timeout: webhookTimeout},
+		secrets:    secrets,
+		now:        time.Now,
+		cache:      make(map[string]cachedSecret),
+	}
+}
+
+// Post sends body to endpoint. Any response other than 2xx is an error.
+func (c *HTTPWebhookClient) Post(ctx context.Context, endpoint, secretArn, eventType string, body []byte) error {
+	secret, err := c.secret(ctx, secretArn)
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(c.now().Unix(), 10)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookTimestampHeader, timestamp)
+	req.Header.Set(WebhookEventTypeHeader, eventType)
+	req.Header.Set(WebhookSignatureHeader, "sha256="+SignWebhook(secret, timestamp, body))
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return nil
+}
+
+// secret returns the signing secret, reading it from Secrets Manager if it is
+// not cached
+func (c *HTTPWebhookClient) secret(ctx context.Context, secretArn string) (string, error) {
+	c.mu.Lock()
+	cached, ok := c.cache[secretArn]
+	c.mu.Unlock()
+	if ok && c.now().Sub(cached.loadedAt) < secretCacheTTL {
+		return cached.value, nil
+	}
+
+	result, err := c.secrets.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(secretArn),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read webhook secret: %w", err)
+	}
+	if result.SecretString == nil || *result.SecretString == "" {
+		return "", fmt.Errorf("webhook secret %s is empty", secretArn)
+	}
+
+	c.mu.Lock()
+	c.cache[secretArn] = cachedSecret{value: *result.SecretString, loadedAt: c.now()}
+	c.mu.Unlock()
+	return *result.SecretString, nil
+}
+
+// SignWebhook returns the hex HMAC-SHA256 signature of a webhook request.
+// Receivers recompute it to verify the request, and should reject timestamps
+// more than a few minutes old to prevent replays.
+func SignWebhook(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// validWebhookEndpoint reports whether endpoint is an absolute HTTPS URL
+func validWebhookEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
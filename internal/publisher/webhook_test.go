@@ -0,0 +1,204 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/jarrod-lowe/jmap-service-core/internal/plugin"
+)
+
+// mockHTTPClient captures the request and returns a canned response
+type mockHTTPClient struct {
+	request *http.Request
+	body    string
+	status  int
+	reply   string
+}
+
+func (m *mockHTTPClient) Do(req *http.Request) (*http.Response, error) {
+	m.request = req
+	body, _ := io.ReadAll(req.Body)
+	m.body = string(body)
+	return &http.Response{
+		StatusCode: m.status,
+		Body:       io.NopCloser(strings.NewReader(m.reply)),
+	}, nil
+}
+
+// mockSecretsClient returns a fixed secret and counts reads
+type mockSecretsClient struct {
+	value string
+	err   error
+	reads int
+}
+
+func (m *mockSecretsClient) GetSecretValue(ctx context.Context, params *secretsmanager.GetSecretValueInput, optFns ...func(*secretsmanager.Options)) (*secretsmanager.GetSecretValueOutput, error) {
+	m.reads++
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(m.value)}, nil
+}
+
+func testWebhookClient(httpClient *mockHTTPClient, secrets *mockSecretsClient, now time.Time) *HTTPWebhookClient {
+	client := NewHTTPWebhookClient(secrets)
+	client.httpClient = httpClient
+	client.now = func() time.Time { return now }
+	return client
+}
+
+func TestHTTPWebhookClient_Post_SignsRequest(t *testing.T) {
+	httpClient := &mockHTTPClient{status: 204}
+	now := time.Unix(1767225600, 0)
+	client := testWebhookClient(httpClient, &mockSecretsClient{value: "s3cret"}, now)
+
+	body := []byte(`{"eventType":"account.created"}`)
+	if err := client.Post(context.Background(), "https://hooks.example.com/jmap", "arn:secret", "account.created", body); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	req := httpClient.request
+	if req.Method != "POST" || req.URL.String() != "https://hooks.example.com/jmap" {
+		t.Errorf("unexpected request %s %s", req.Method, req.URL)
+	}
+	if httpClient.body != string(body) {
+		t.Errorf("expected payload as body, got %s", httpClient.body)
+	}
+	if req.Header.Get(WebhookTimestampHeader) != "1767225600" {
+		t.Errorf("unexpected timestamp %q", req.Header.Get(WebhookTimestampHeader))
+	}
+	if req.Header.Get(WebhookEventTypeHeader) != "account.created" {
+		t.Errorf("unexpected event type %q", req.Header.Get(WebhookEventTypeHeader))
+	}
+	want := "sha256=" + SignWebhook("s3cret", "1767225600", body)
+	if req.Header.Get(WebhookSignatureHeader) != want {
+		t.Errorf("expected signature %s, got %s", want, req.Header.Get(WebhookSignatureHeader))
+	}
+}
+
+func TestSignWebhook_KnownValue(t *testing.T) {
+	// echo -n '1700000000.{}' | openssl dgst -sha256 -hmac key
+	got := SignWebhook("key", "1700000000", []byte("{}"))
+	if got != "9d713ed406bb7076d4123f0dc2c39d2df5c654ed4b0cd56b52c8b4c940bd63ae" {
+		t.Errorf("unexpected signature %s", got)
+	}
+}
+
+func TestHTTPWebhookClient_Post_ErrorStatus(t *testing.T) {
+	client := testWebhookClient(&mockHTTPClient{status: 500, reply: "down"}, &mockSecretsClient{value: "s3cret"}, time.Now())
+
+	err := client.Post(context.Background(), "https://hooks.example.com/jmap", "arn:secret", "account.created", []byte(`{}`))
+	if err == nil {
+		t.Error("expected error for non-2xx response")
+	}
+}
+
+func TestHTTPWebhookClient_Post_CachesSecret(t *testing.T) {
+	secrets := &mockSecretsClient{value: "s3cret"}
+	now := time.Now()
+	client := testWebhookClient(&mockHTTPClient{status: 200}, secrets, now)
+
+	for range 3 {
+		if err := client.Post(context.Background(), "https://hooks.example.com/jmap", "arn:secret", "account.created", []byte(`{}`)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	if secrets.reads != 1 {
+		t.Errorf("expected the secret to be read once, got %d", secrets.reads)
+	}
+
+	client.now = func() time.Time { return now.Add(secretCacheTTL) }
+	_ = client.Post(context.Background(), "https://hooks.example.com/jmap", "arn:secret", "account.created", []byte(`{}`))
+	if secrets.reads != 2 {
+		t.Errorf("expected the secret to be read again after the cache expires, got %d", secrets.reads)
+	}
+}
+
+func TestHTTPWebhookClient_Post_SecretError(t *testing.T) {
+	httpClient := &mockHTTPClient{status: 200}
+	client := testWebhookClient(httpClient, &mockSecretsClient{err: errors.New("access denied")}, time.Now())
+
+	if err := client.Post(context.Background(), "https://hooks.example.com/jmap", "arn:secret", "account.created", []byte(`{}`)); err == nil {
+		t.Error("expected error when the secret cannot be read")
+	}
+	if httpClient.request != nil {
+		t.Error("expected no unsigned request to be sent")
+	}
+}
+
+// MockWebhookClient implements WebhookClient for testing
+type MockWebhookClient struct {
+	Endpoints []string
+	Err       error
+}
+
+func (m *MockWebhookClient) Post(ctx context.Context, endpoint, secretArn, eventType string, body []byte) error {
+	m.Endpoints = append(m.Endpoints, endpoint)
+	return m.Err
+}
+
+func webhookTarget(url, secretArn string) *MockEventTargetGetter {
+	return &MockEventTargetGetter{Targets: []plugin.AggregatedEventTarget{
+		{PluginID: "crm", TargetType: "webhook", TargetArn: url, SecretArn: secretArn},
+	}}
+}
+
+func TestSQSEventPublisher_Deliver_WebhookTargets(t *testing.T) {
+	webhooks := &MockWebhookClient{}
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, webhookTarget("https://crm.example.com/events", "arn:secret")).WithWebhooks(webhooks)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(webhooks.Endpoints) != 1 || webhooks.Endpoints[0] != "https://crm.example.com/events" {
+		t.Errorf("expected a post to the webhook URL, got %v", webhooks.Endpoints)
+	}
+}
+
+func TestSQSEventPublisher_Deliver_WebhookRetries(t *testing.T) {
+	webhooks := &MockWebhookClient{Err: errors.New("webhook returned 503")}
+	publisher := NewSQSEventPublisher(&MockSQSClient{}, webhookTarget("https://crm.example.com/events", "arn:secret")).
+		WithWebhooks(webhooks).
+		WithRetry(3, 0)
+
+	if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+		t.Fatal("expected error when the webhook fails")
+	}
+	if len(webhooks.Endpoints) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(webhooks.Endpoints))
+	}
+}
+
+func TestSQSEventPublisher_Deliver_InvalidWebhookNotRetried(t *testing.T) {
+	tests := []struct {
+		name      string
+		url       string
+		secretArn string
+	}{
+		{name: "plain http", url: "http://crm.example.com/events", secretArn: "arn:secret"},
+		{name: "no secret", url: "https://crm.example.com/events"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			webhooks := &MockWebhookClient{}
+			publisher := NewSQSEventPublisher(&MockSQSClient{}, webhookTarget(tc.url, tc.secretArn)).
+				WithWebhooks(webhooks).
+				WithRetry(3, 0)
+
+			if err := publisher.Deliver(context.Background(), EventPayload{EventType: "account.created"}); err == nil {
+				t.Error("expected error for an invalid webhook target")
+			}
+			if len(webhooks.Endpoints) != 0 {
+				t.Errorf("expected no posts, got %v", webhooks.Endpoints)
+			}
+		})
+	}
+}
@@ -0,0 +1,299 @@
+// Package ratelimit enforces request rates with token buckets stored in
+// DynamoDB, one bucket per account and per IAM principal, so the limit holds
+// across every Lambda instance.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Key prefixes and record layout for token bucket records
+const (
+	PKPrefix = "RATELIMIT#"
+	SKBucket = "BUCKET#"
+)
+
+// maxUpdateAttempts bounds the optimistic retry loop when concurrent
+// requests race on the same bucket
+const maxUpdateAttempts = 3
+
+// idleExpiry is how long after a bucket refills completely its record is
+// kept; a missing record is equivalent to a full bucket
+const idleExpiry = time.Hour
+
+// Limit configures a token bucket: Burst tokens, refilled at Rate per second
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int64   `json:"burst"`
+}
+
+// ParseLimit parses the rate and burst environment values. A rate of zero
+// disables rate limiting and is reported with enabled false.
+func ParseLimit(rate, burst string) (limit Limit, enabled bool, err error) {
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil || r < 0 || math.IsInf(r, 0) || math.IsNaN(r) {
+		return Limit{}, false, fmt.Errorf("invalid rate %q", rate)
+	}
+	if r == 0 {
+		return Limit{}, false, nil
+	}
+	b, err := strconv.ParseInt(burst, 10, 64)
+	if err != nil || b < 1 {
+		return Limit{}, false, fmt.Errorf("invalid burst %q", burst)
+	}
+	return Limit{Rate: r, Burst: b}, true, nil
+}
+
+// TierLimits maps a quota tier name to the limit for its accounts' buckets
+type TierLimits map[string]Limit
+
+// ParseTierLimits parses a JSON object of tier name to limit, e.g.
+// {"pro": {"rate": 50, "burst": 100}}. A rate of zero leaves the tier's
+// accounts unlimited. An empty value means no tier limits.
+func ParseTierLimits(value string) (TierLimits, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var limits TierLimits
+	if err := json.Unmarshal([]byte(value), &limits); err != nil {
+		return nil, fmt.Errorf("invalid tier limits: %w", err)
+	}
+	for tier, limit := range limits {
+		if limit.Rate < 0 || (limit.Rate > 0 && limit.Burst < 1) {
+			return nil, fmt.Errorf("invalid limit for tier %q", tier)
+		}
+	}
+	return limits, nil
+}
+
+// Decision is the outcome of a rate limit check
+type Decision struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when not allowed
+	RetryAfter time.Duration
+	// Key is the bucket that denied the request
+	Key string
+}
+
+// RetryAfterSeconds formats RetryAfter for a Retry-After header, rounding up
+// to at least one second
+func (d Decision) RetryAfterSeconds() string {
+	seconds := int64(math.Ceil(d.RetryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	return strconv.FormatInt(seconds, 10)
+}
+
+// accountKeyPrefix marks account bucket keys, which tier limits apply to
+const accountKeyPrefix = "account#"
+
+// AccountKey is the bucket key for an account
+func AccountKey(accountID string) string {
+	return accountKeyPrefix + accountID
+}
+
+// PrincipalKey is the bucket key for an IAM principal
+func PrincipalKey(principalARN string) string {
+	return "principal#" + principalARN
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by ratelimit
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+}
+
+// Limiter enforces token buckets stored in DynamoDB, so every Lambda
+// instance shares the same state
+type Limiter struct {
+	client    DynamoDBClient
+	tableName string
+	limit     Limit
+	tiers     TierLimits
+	now       func() time.Time
+}
+
+// NewLimiter creates a new Limiter
+func NewLimiter(client DynamoDBClient, tableName string, limit Limit) *Limiter {
+	return &Limiter{
+		client:    client,
+		tableName: tableName,
+		limit:     limit,
+		now:       time.Now,
+	}
+}
+
+// WithTierLimits sets per-tier limits for account buckets. Accounts in other
+// tiers, and principal buckets, use the default limit.
+func (l *Limiter) WithTierLimits(tiers TierLimits) *Limiter {
+	l.tiers = tiers
+	return l
+}
+
+// Allow takes one token from each key's bucket in order, stopping at the
+// first bucket that is empty. Tokens already taken from earlier buckets are
+// returned, so a request one bucket refuses costs the others nothing.
+func (l *Limiter) Allow(ctx context.Context, keys ...string) (Decision, error) {
+	return l.AllowTier(ctx, "", keys...)
+}
+
+// AllowTier is Allow for an account in the given quota tier, whose limit
+// applies to account keys. Buckets whose limit has a zero rate are skipped.
+func (l *Limiter) AllowTier(ctx context.Context, tier string, keys ...string) (Decision, error) {
+	var taken []string
+	var takenLimits []Limit
+	for _, key := range keys {
+		limit := l.limit
+		if tierLimit, ok := l.tiers[tier]; ok && strings.HasPrefix(key, accountKeyPrefix) {
+			limit = tierLimit
+		}
+		if limit.Rate == 0 {
+			continue
+		}
+		decision, err := l.take(ctx, key, limit)
+		if err != nil {
+			return Decision{}, err
+		}
+		if !decision.Allowed {
+			for i, takenKey := range taken {
+				// A refund that fails leaves its bucket a token short
+				// until it refills, so the denial still stands
+				_, _ = l.update(ctx, takenKey, takenLimits[i], -1)
+			}
+			return decision, nil
+		}
+		taken = append(taken, key)
+		takenLimits = append(takenLimits, limit)
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// take removes one token from a bucket
+func (l *Limiter) take(ctx context.Context, key string, limit Limit) (Decision, error) {
+	return l.update(ctx, key, limit, 1)
+}
+
+// update refills a bucket for the time since it was last written and removes
+// cost tokens, or returns them to the bucket if cost is negative. Each write
+// increments the bucket's version and is conditional on the version read, so
+// two requests in the same millisecond cannot both spend the same token; a
+// bucket that keeps losing races is treated as exhausted.
+func (l *Limiter) update(ctx context.Context, key string, limit Limit, cost float64) (Decision, error) {
+	bucketKey := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: PKPrefix + key},
+		"sk": &types.AttributeValueMemberS{Value: SKBucket},
+	}
+
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		output, err := l.client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName:      aws.String(l.tableName),
+			Key:            bucketKey,
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			return Decision{}, fmt.Errorf("failed to read rate limit bucket: %w", err)
+		}
+
+		now := l.now()
+		tokens := float64(limit.Burst)
+		var version int64
+		if output.Item != nil {
+			storedTokens, storedAt, storedVersion, err := parseBucket(output.Item)
+			if err != nil {
+				return Decision{}, err
+			}
+			elapsed := now.Sub(time.UnixMilli(storedAt)).Seconds()
+			tokens = math.Min(float64(limit.Burst), storedTokens+math.Max(elapsed, 0)*limit.Rate)
+			version = storedVersion
+		}
+
+		if cost > 0 && tokens < cost {
+			return Decision{
+				Key:        key,
+				RetryAfter: time.Duration((cost - tokens) / limit.Rate * float64(time.Second)),
+			}, nil
+		}
+		tokens = math.Min(float64(limit.Burst), tokens-cost)
+
+		refillSeconds := (float64(limit.Burst) - tokens) / limit.Rate
+		expiresAt := now.Add(time.Duration(refillSeconds*float64(time.Second)) + idleExpiry)
+
+		input := &dynamodb.PutItemInput{
+			TableName: aws.String(l.tableName),
+			Item: map[string]types.AttributeValue{
+				"pk":        bucketKey["pk"],
+				"sk":        bucketKey["sk"],
+				"tokens":    &types.AttributeValueMemberN{Value: strconv.FormatFloat(tokens, 'f', -1, 64)},
+				"updatedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+				"ttl":       &types.AttributeValueMemberN{Value: strconv.FormatInt(expiresAt.Unix(), 10)},
+				"version":   &types.AttributeValueMemberN{Value: strconv.FormatInt(version+1, 10)},
+			},
+		}
+		switch {
+		case output.Item == nil:
+			input.ConditionExpression = aws.String("attribute_not_exists(pk)")
+		case version == 0:
+			// Buckets written before versioning have no version attribute
+			input.ConditionExpression = aws.String("attribute_not_exists(version)")
+		default:
+			input.ConditionExpression = aws.String("version = :version")
+			input.ExpressionAttributeValues = map[string]types.AttributeValue{
+				":version": &types.AttributeValueMemberN{Value: strconv.FormatInt(version, 10)},
+			}
+		}
+
+		if _, err := l.client.PutItem(ctx, input); err != nil {
+			if dbclient.IsConditionalCheckFailed(err) {
+				continue
+			}
+			return Decision{}, fmt.Errorf("failed to update rate limit bucket: %w", err)
+		}
+		return Decision{Allowed: true}, nil
+	}
+
+	return Decision{
+		Key:        key,
+		RetryAfter: time.Duration(float64(time.Second) / limit.Rate),
+	}, nil
+}
+
+// parseBucket reads the tokens, updatedAt and version attributes of a bucket
+// record. A record without a version is version zero.
+func parseBucket(item map[string]types.AttributeValue) (float64, int64, int64, error) {
+	tokensAttr, ok := item["tokens"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("rate limit bucket missing tokens")
+	}
+	updatedAttr, ok := item["updatedAt"].(*types.AttributeValueMemberN)
+	if !ok {
+		return 0, 0, 0, fmt.Errorf("rate limit bucket missing updatedAt")
+	}
+	tokens, err := strconv.ParseFloat(tokensAttr.Value, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid rate limit tokens: %w", err)
+	}
+	updatedAt, err := strconv.ParseInt(updatedAttr.Value, 10, 64)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid rate limit updatedAt: %w", err)
+	}
+	var version int64
+	if versionAttr, ok := item["version"].(*types.AttributeValueMemberN); ok {
+		version, err = strconv.ParseInt(versionAttr.Value, 10, 64)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("invalid rate limit version: %w", err)
+		}
+	}
+	return tokens, updatedAt, version, nil
+}
@@ -0,0 +1,317 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDynamoDBClient stores bucket records in memory and enforces the
+// version condition like DynamoDB would
+type mockDynamoDBClient struct {
+	items       map[string]map[string]types.AttributeValue
+	conflicts   int
+	getErr      error
+	putAttempts int
+	// beforePut runs ahead of each put, to simulate a concurrent writer
+	beforePut func()
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	pk := params.Key["pk"].(*types.AttributeValueMemberS).Value
+	return &dynamodb.GetItemOutput{Item: m.items[pk]}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.putAttempts++
+	if m.beforePut != nil {
+		m.beforePut()
+	}
+	if m.conflicts > 0 {
+		m.conflicts--
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	if m.items == nil {
+		m.items = make(map[string]map[string]types.AttributeValue)
+	}
+	pk := params.Item["pk"].(*types.AttributeValueMemberS).Value
+	existing := m.items[pk]
+	_, hasVersion := existing["version"]
+	var ok bool
+	switch aws.ToString(params.ConditionExpression) {
+	case "attribute_not_exists(pk)":
+		ok = existing == nil
+	case "attribute_not_exists(version)":
+		ok = existing != nil && !hasVersion
+	case "version = :version":
+		ok = hasVersion && existing["version"].(*types.AttributeValueMemberN).Value ==
+			params.ExpressionAttributeValues[":version"].(*types.AttributeValueMemberN).Value
+	}
+	if !ok {
+		return nil, &types.ConditionalCheckFailedException{}
+	}
+	m.items[pk] = params.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func newTestLimiter(client *mockDynamoDBClient, limit Limit, now *time.Time) *Limiter {
+	l := NewLimiter(client, "table", limit)
+	l.now = func() time.Time { return *now }
+	return l
+}
+
+func TestAllow_ConsumesBurstThenDenies(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 3}, &now)
+
+	for i := 0; i < 3; i++ {
+		d, err := l.Allow(context.Background(), AccountKey("user-1"))
+		if err != nil || !d.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v %v", i, d, err)
+		}
+	}
+
+	d, err := l.Allow(context.Background(), AccountKey("user-1"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed || d.Key != "account#user-1" {
+		t.Fatalf("expected denial for account bucket, got %+v", d)
+	}
+	if d.RetryAfterSeconds() != "1" {
+		t.Errorf("expected Retry-After 1, got %s", d.RetryAfterSeconds())
+	}
+}
+
+func TestAllow_RefillsOverTime(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 2, Burst: 1}, &now)
+
+	if d, _ := l.Allow(context.Background(), "k"); !d.Allowed {
+		t.Fatal("expected first request allowed")
+	}
+	if d, _ := l.Allow(context.Background(), "k"); d.Allowed {
+		t.Fatal("expected second request denied")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	if d, _ := l.Allow(context.Background(), "k"); !d.Allowed {
+		t.Fatal("expected request allowed after refill")
+	}
+}
+
+func TestAllow_StopsAtFirstDeniedKey(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 1}, &now)
+
+	if d, _ := l.Allow(context.Background(), PrincipalKey("arn:p")); !d.Allowed {
+		t.Fatal("expected principal request allowed")
+	}
+
+	d, err := l.Allow(context.Background(), AccountKey("user-1"), PrincipalKey("arn:p"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed || d.Key != "principal#arn:p" {
+		t.Errorf("expected principal bucket to deny, got %+v", d)
+	}
+}
+
+func TestAllow_DeniedRequestRefundsEarlierBuckets(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 2}, &now)
+
+	// Exhaust the principal's bucket
+	for i := 0; i < 2; i++ {
+		_, _ = l.Allow(context.Background(), PrincipalKey("arn:p"))
+	}
+	for i := 0; i < 5; i++ {
+		if d, _ := l.Allow(context.Background(), AccountKey("user-1"), PrincipalKey("arn:p")); d.Allowed {
+			t.Fatalf("request %d: expected principal bucket to deny", i)
+		}
+	}
+
+	// The refused requests left the account's bucket full
+	for i := 0; i < 2; i++ {
+		if d, _ := l.Allow(context.Background(), AccountKey("user-1"), PrincipalKey("arn:q")); !d.Allowed {
+			t.Errorf("request %d: expected another principal allowed, got %+v", i, d)
+		}
+	}
+}
+
+func TestAllow_RetriesOnConflict(t *testing.T) {
+	client := &mockDynamoDBClient{conflicts: 1}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 5}, &now)
+
+	d, err := l.Allow(context.Background(), "k")
+	if err != nil || !d.Allowed {
+		t.Fatalf("expected allowed after retry, got %+v %v", d, err)
+	}
+	if client.putAttempts != 2 {
+		t.Errorf("expected 2 put attempts, got %d", client.putAttempts)
+	}
+}
+
+func TestAllow_PersistentConflict_Denies(t *testing.T) {
+	client := &mockDynamoDBClient{conflicts: maxUpdateAttempts}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 5}, &now)
+
+	d, err := l.Allow(context.Background(), "k")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d.Allowed {
+		t.Error("expected denial under sustained contention")
+	}
+}
+
+func TestAllow_ConcurrentWriteInSameMillisecond_Retries(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 2}, &now)
+	other := newTestLimiter(client, Limit{Rate: 1, Burst: 2}, &now)
+
+	if d, _ := l.Allow(context.Background(), "k"); !d.Allowed {
+		t.Fatal("expected first request allowed")
+	}
+
+	// Another instance spends the last token between this read and write,
+	// at the same millisecond
+	client.beforePut = func() {
+		client.beforePut = nil
+		if d, _ := other.Allow(context.Background(), "k"); !d.Allowed {
+			t.Fatal("expected concurrent request allowed")
+		}
+	}
+	if d, _ := l.Allow(context.Background(), "k"); d.Allowed {
+		t.Error("expected the racing request denied once the bucket is re-read")
+	}
+	if v := client.items["RATELIMIT#k"]["version"].(*types.AttributeValueMemberN).Value; v != "2" {
+		t.Errorf("expected version 2, got %s", v)
+	}
+}
+
+func TestAllow_UnversionedBucket(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	client := &mockDynamoDBClient{items: map[string]map[string]types.AttributeValue{
+		"RATELIMIT#k": {
+			"tokens":    &types.AttributeValueMemberN{Value: "1"},
+			"updatedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+		},
+	}}
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 5}, &now)
+
+	if d, err := l.Allow(context.Background(), "k"); err != nil || !d.Allowed {
+		t.Fatalf("expected allowed, got %+v %v", d, err)
+	}
+	if v := client.items["RATELIMIT#k"]["version"].(*types.AttributeValueMemberN).Value; v != "1" {
+		t.Errorf("expected version 1, got %s", v)
+	}
+}
+
+func TestAllow_WritesTTL(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 10}, &now)
+
+	if _, err := l.Allow(context.Background(), "k"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	item := client.items["RATELIMIT#k"]
+	ttl, _ := strconv.ParseInt(item["ttl"].(*types.AttributeValueMemberN).Value, 10, 64)
+	if want := now.Add(time.Second + idleExpiry).Unix(); ttl != want {
+		t.Errorf("expected ttl %d, got %d", want, ttl)
+	}
+}
+
+func TestAllow_ReadError_ReturnsError(t *testing.T) {
+	client := &mockDynamoDBClient{getErr: errors.New("dynamo down")}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 1}, &now)
+
+	if _, err := l.Allow(context.Background(), "k"); err == nil {
+		t.Fatal("expected error")
+	}
+}
+
+func TestParseLimit(t *testing.T) {
+	limit, enabled, err := ParseLimit("2.5", "10")
+	if err != nil || !enabled || limit.Rate != 2.5 || limit.Burst != 10 {
+		t.Errorf("unexpected result: %+v %v %v", limit, enabled, err)
+	}
+
+	if _, enabled, err := ParseLimit("0", ""); err != nil || enabled {
+		t.Errorf("expected zero rate to disable limiting, got %v %v", enabled, err)
+	}
+
+	for _, tc := range [][2]string{{"", "10"}, {"-1", "10"}, {"abc", "10"}, {"1", "0"}, {"1", ""}} {
+		if _, _, err := ParseLimit(tc[0], tc[1]); err == nil {
+			t.Errorf("expected error for rate %q burst %q", tc[0], tc[1])
+		}
+	}
+}
+
+func TestAllowTier_AppliesTierLimitToAccountKeys(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	now := time.Unix(1700000000, 0)
+	l := newTestLimiter(client, Limit{Rate: 1, Burst: 1}, &now).
+		WithTierLimits(TierLimits{"pro": {Rate: 1, Burst: 3}, "unlimited": {}})
+
+	for i := 0; i < 3; i++ {
+		if d, err := l.AllowTier(context.Background(), "pro", AccountKey("user-1")); err != nil || !d.Allowed {
+			t.Fatalf("request %d: expected allowed by tier burst, got %+v %v", i, d, err)
+		}
+	}
+	if d, _ := l.AllowTier(context.Background(), "pro", AccountKey("user-1")); d.Allowed {
+		t.Error("expected tier burst to be exhausted")
+	}
+
+	// Principal buckets keep the default limit
+	_, _ = l.AllowTier(context.Background(), "pro", PrincipalKey("arn:p"))
+	if d, _ := l.AllowTier(context.Background(), "pro", PrincipalKey("arn:p")); d.Allowed {
+		t.Error("expected principal bucket to use the default burst")
+	}
+
+	puts := client.putAttempts
+	for i := 0; i < 5; i++ {
+		if d, _ := l.AllowTier(context.Background(), "unlimited", AccountKey("user-2")); !d.Allowed {
+			t.Fatal("expected zero-rate tier to be unlimited")
+		}
+	}
+	if client.putAttempts != puts {
+		t.Errorf("expected unlimited tier to skip its bucket, got %d writes", client.putAttempts-puts)
+	}
+}
+
+func TestParseTierLimits(t *testing.T) {
+	limits, err := ParseTierLimits(`{"pro":{"rate":50,"burst":100},"internal":{"rate":0}}`)
+	if err != nil || limits["pro"] != (Limit{Rate: 50, Burst: 100}) || limits["internal"] != (Limit{}) {
+		t.Errorf("unexpected result: %+v %v", limits, err)
+	}
+
+	if limits, err := ParseTierLimits(""); err != nil || limits != nil {
+		t.Errorf("expected no tier limits, got %+v %v", limits, err)
+	}
+
+	for _, value := range []string{`{`, `{"pro":{"rate":-1,"burst":1}}`, `{"pro":{"rate":1}}`} {
+		if _, err := ParseTierLimits(value); err == nil {
+			t.Errorf("expected error for %s", value)
+		}
+	}
+}
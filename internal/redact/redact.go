@@ -0,0 +1,59 @@
+// Package redact removes personal data from JMAP method arguments and
+// responses so they can be logged: email addresses in any string, and blob
+// and message content wherever it appears.
+package redact
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Placeholders substituted for redacted values
+const (
+	EmailPlaceholder   = "[email]"
+	ContentPlaceholder = "[redacted]"
+)
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(\.[A-Za-z0-9\-]+)+`)
+
+// contentKeys are members holding blob data or message content
+var contentKeys = map[string]bool{
+	"data":         true,
+	"dataAsText":   true,
+	"dataAsBase64": true,
+	"bodyValues":   true,
+	"preview":      true,
+}
+
+// isContentKey reports whether a member holds content, including the
+// "data:asText" style members of Blob/upload
+func isContentKey(key string) bool {
+	return contentKeys[key] || strings.HasPrefix(key, "data:")
+}
+
+// Value returns a copy of a decoded JSON value with content members replaced
+// and email addresses masked. The input is not modified.
+func Value(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, member := range v {
+			if isContentKey(key) {
+				out[key] = ContentPlaceholder
+				continue
+			}
+			out[key] = Value(member)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = Value(item)
+		}
+		return out
+	case string:
+		return emailPattern.ReplaceAllString(v, EmailPlaceholder)
+	default:
+		return v
+	}
+}
@@ -0,0 +1,60 @@
+package redact
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValue(t *testing.T) {
+	input := map[string]any{
+		"accountId": "user-123",
+		"filter":    map[string]any{"from": "Alice <alice@example.com>", "to": "bob.smith+jmap@mail.example.co.uk"},
+		"create": map[string]any{
+			"b1": map[string]any{
+				"data": []any{
+					map[string]any{"data:asText": "hello"},
+				},
+				"type": "text/plain",
+			},
+		},
+		"list": []any{
+			map[string]any{"id": "M1", "preview": "Meeting at noon", "bodyValues": map[string]any{"1": "secret"}},
+		},
+		"limit": 10.0,
+		"flag":  true,
+	}
+
+	want := map[string]any{
+		"accountId": "user-123",
+		"filter":    map[string]any{"from": "Alice <[email]>", "to": "[email]"},
+		"create": map[string]any{
+			"b1": map[string]any{
+				"data": "[redacted]",
+				"type": "text/plain",
+			},
+		},
+		"list": []any{
+			map[string]any{"id": "M1", "preview": "[redacted]", "bodyValues": "[redacted]"},
+		},
+		"limit": 10.0,
+		"flag":  true,
+	}
+
+	if got := Value(input); !reflect.DeepEqual(got, want) {
+		t.Errorf("Value() = %v, want %v", got, want)
+	}
+}
+
+func TestValue_DoesNotModifyInput(t *testing.T) {
+	input := map[string]any{"to": "alice@example.com", "dataAsBase64": "aGVsbG8="}
+	Value(input)
+	if input["to"] != "alice@example.com" || input["dataAsBase64"] != "aGVsbG8=" {
+		t.Errorf("input was modified: %v", input)
+	}
+}
+
+func TestValue_Nil(t *testing.T) {
+	if Value(nil) != nil {
+		t.Error("expected nil")
+	}
+}
@@ -0,0 +1,90 @@
+// Package requestcheck validates every method call of a JMAP request before
+// any of them runs. jmap-api otherwise finds a broken call only when it
+// reaches it, after the calls before it have already invoked plugins; in
+// strict mode it uses Check to reject such a request outright.
+package requestcheck
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Rules gives Check what it needs to know about the request and the
+// methods core serves
+type Rules struct {
+	// Using is the request's using list
+	Using []string
+	// KnownMethod reports whether a method is served by core or a plugin
+	KnownMethod func(name string) bool
+	// RequiredCapability returns the capability a method needs in using, or
+	// "" if it needs none
+	RequiredCapability func(name string) string
+	// AccountMatches reports whether an accountId argument names the
+	// request's account
+	AccountMatches func(accountID string) bool
+}
+
+// Failure describes the first method call that failed a check. Type is the
+// JMAP error type the call would have failed with.
+type Failure struct {
+	Index  int
+	Type   string
+	Detail string
+}
+
+func (f *Failure) Error() string {
+	return fmt.Sprintf("methodCalls[%d]: %s", f.Index, f.Detail)
+}
+
+// Check checks each method call's structure, method, capability, accountId
+// and result references, in order, and returns the first failure, or nil if
+// every call passes. Result references must name an earlier call's client
+// ID; whether the referenced result has the path is only known once it runs.
+func Check(calls [][]any, rules Rules) *Failure {
+	seen := make(map[string]bool, len(calls))
+	for i, call := range calls {
+		fail := func(errType, format string, a ...any) *Failure {
+			return &Failure{Index: i, Type: errType, Detail: fmt.Sprintf(format, a...)}
+		}
+
+		if len(call) != 3 {
+			return fail("notRequest", "method call must have exactly 3 elements: [name, args, clientId]")
+		}
+		name, _ := call[0].(string)
+		if name == "" {
+			return fail("notRequest", "method name must be a non-empty string")
+		}
+		args, ok := call[1].(map[string]any)
+		if !ok {
+			return fail("notRequest", "arguments of %s must be an object", name)
+		}
+		clientID, ok := call[2].(string)
+		if !ok {
+			return fail("notRequest", "client ID of %s must be a string", name)
+		}
+
+		if !rules.KnownMethod(name) {
+			return fail("unknownMethod", "unknown method %s", name)
+		}
+		if capability := rules.RequiredCapability(name); capability != "" && !slices.Contains(rules.Using, capability) {
+			return fail("unknownMethod", "%s requires the %s capability", name, capability)
+		}
+		if accountID, ok := args["accountId"].(string); ok && !rules.AccountMatches(accountID) {
+			return fail("accountNotFound", "%s names another account", name)
+		}
+
+		for key, value := range args {
+			if !strings.HasPrefix(key, "#") {
+				continue
+			}
+			ref, _ := value.(map[string]any)
+			resultOf, _ := ref["resultOf"].(string)
+			if !seen[resultOf] {
+				return fail("invalidResultReference", "%s argument %s does not reference an earlier method call", name, key)
+			}
+		}
+		seen[clientID] = true
+	}
+	return nil
+}
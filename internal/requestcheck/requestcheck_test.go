@@ -0,0 +1,68 @@
+package requestcheck
+
+import (
+	"testing"
+)
+
+var testRules = Rules{
+	Using: []string{"urn:ietf:params:jmap:core", "urn:ietf:params:jmap:mail"},
+	KnownMethod: func(name string) bool {
+		return name == "Email/get" || name == "Email/query" || name == "Blob/allocate"
+	},
+	RequiredCapability: func(name string) string {
+		if name == "Blob/allocate" {
+			return "https://jmap.rrod.net/extensions/upload-put"
+		}
+		return ""
+	},
+	AccountMatches: func(accountID string) bool {
+		return accountID == "user-1" || accountID == "alice@example.com"
+	},
+}
+
+func TestCheck_ValidRequest(t *testing.T) {
+	calls := [][]any{
+		{"Email/query", map[string]any{"accountId": "user-1"}, "c0"},
+		{"Email/get", map[string]any{
+			"accountId": "alice@example.com",
+			"#ids":      map[string]any{"resultOf": "c0", "name": "Email/query", "path": "/ids"},
+		}, "c1"},
+	}
+	if failure := Check(calls, testRules); failure != nil {
+		t.Errorf("expected no failure, got %v", failure)
+	}
+}
+
+func TestCheck_Failures(t *testing.T) {
+	valid := []any{"Email/get", map[string]any{}, "c0"}
+	tests := []struct {
+		name  string
+		calls [][]any
+		index int
+		want  string
+	}{
+		{"too few elements", [][]any{valid, {"Email/get", map[string]any{}}}, 1, "notRequest"},
+		{"name not a string", [][]any{{42, map[string]any{}, "c0"}}, 0, "notRequest"},
+		{"args not an object", [][]any{{"Email/get", []any{}, "c0"}}, 0, "notRequest"},
+		{"client ID not a string", [][]any{{"Email/get", map[string]any{}, 1}}, 0, "notRequest"},
+		{"unknown method", [][]any{valid, {"Foo/bar", map[string]any{}, "c1"}}, 1, "unknownMethod"},
+		{"capability not used", [][]any{{"Blob/allocate", map[string]any{}, "c0"}}, 0, "unknownMethod"},
+		{"other account", [][]any{{"Email/get", map[string]any{"accountId": "user-2"}, "c0"}}, 0, "accountNotFound"},
+		{"forward reference", [][]any{
+			{"Email/get", map[string]any{"#ids": map[string]any{"resultOf": "c1", "name": "Email/query", "path": "/ids"}}, "c0"},
+			{"Email/query", map[string]any{}, "c1"},
+		}, 0, "invalidResultReference"},
+		{"malformed reference", [][]any{valid, {"Email/get", map[string]any{"#ids": "c0"}, "c1"}}, 1, "invalidResultReference"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			failure := Check(tt.calls, testRules)
+			if failure == nil {
+				t.Fatal("expected a failure")
+			}
+			if failure.Index != tt.index || failure.Type != tt.want {
+				t.Errorf("expected %s at %d, got %s at %d: %v", tt.want, tt.index, failure.Type, failure.Index, failure)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package respbody encodes JMAP API response bodies. Method responses are
+// encoded one at a time into a pooled buffer rather than marshalled as one
+// value, so a large response is not held twice, and the body size is
+// tracked as it grows so a response that would not fit through Lambda and
+// API Gateway can be refused before it is built.
+package respbody
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sync"
+)
+
+// MaxSize is the largest body jmap-api returns. Lambda limits a synchronous
+// response to 6 MB (API Gateway allows 10 MB), and the body is escaped again
+// inside the proxy response, so this leaves room for that.
+const MaxSize = 5 * 1024 * 1024
+
+// ErrTooLarge is returned when a body would exceed its size limit
+var ErrTooLarge = errors.New("response body exceeds size limit")
+
+// maxPooledSize is the largest buffer returned to the pool; bigger ones are
+// left to the garbage collector so one huge response does not pin memory
+const maxPooledSize = 1024 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Writer builds a JMAP response body:
+//
+//	{"methodResponses":[...],"createdIds":{...},"sessionState":"..."}
+//
+// Call Add for each method response, then Finish. Release returns the
+// buffer to the pool once the body is no longer needed.
+type Writer struct {
+	buf   *bytes.Buffer
+	enc   *json.Encoder
+	limit int
+	count int
+}
+
+// NewWriter returns a Writer whose body may not exceed limit bytes; zero
+// means MaxSize
+func NewWriter(limit int) *Writer {
+	if limit <= 0 {
+		limit = MaxSize
+	}
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	buf.WriteString(`{"methodResponses":[`)
+	return &Writer{buf: buf, enc: json.NewEncoder(buf), limit: limit}
+}
+
+// Len returns the size of the body so far
+func (w *Writer) Len() int {
+	return w.buf.Len()
+}
+
+// Add appends a method response. If it would take the body over the limit
+// it is not added and ErrTooLarge is returned, leaving the body as it was.
+func (w *Writer) Add(response any) error {
+	mark := w.buf.Len()
+	if w.count > 0 {
+		w.buf.WriteByte(',')
+	}
+	if err := w.encode(response); err != nil {
+		w.buf.Truncate(mark)
+		return err
+	}
+	if w.buf.Len() > w.limit {
+		w.buf.Truncate(mark)
+		return ErrTooLarge
+	}
+	w.count++
+	return nil
+}
+
+// Finish closes the body with createdIds, omitted when empty, and
+// sessionState, and returns it
+func (w *Writer) Finish(createdIDs map[string]string, sessionState string) (string, error) {
+	w.buf.WriteByte(']')
+	if len(createdIDs) > 0 {
+		w.buf.WriteString(`,"createdIds":`)
+		if err := w.encode(createdIDs); err != nil {
+			return "", err
+		}
+	}
+	w.buf.WriteString(`,"sessionState":`)
+	if err := w.encode(sessionState); err != nil {
+		return "", err
+	}
+	w.buf.WriteByte('}')
+	if w.buf.Len() > w.limit {
+		return "", ErrTooLarge
+	}
+	return w.buf.String(), nil
+}
+
+// Release returns the buffer to the pool. The Writer must not be used
+// afterwards; strings returned by Finish remain valid.
+func (w *Writer) Release() {
+	if w.buf.Cap() <= maxPooledSize {
+		bufferPool.Put(w.buf)
+	}
+	w.buf = nil
+	w.enc = nil
+}
+
+// encode writes v without the newline json.Encoder ends it with
+func (w *Writer) encode(v any) error {
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+	w.buf.Truncate(w.buf.Len() - 1)
+	return nil
+}
@@ -0,0 +1,136 @@
+package respbody
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// response mirrors the body jmap-api returns, marshalled in one go
+type response struct {
+	MethodResponses [][]any           `json:"methodResponses"`
+	CreatedIDs      map[string]string `json:"createdIds,omitempty"`
+	SessionState    string            `json:"sessionState"`
+}
+
+func TestWriter_MatchesMarshal(t *testing.T) {
+	tests := []struct {
+		name string
+		resp response
+	}{
+		{"empty", response{MethodResponses: [][]any{}, SessionState: "0"}},
+		{"one", response{
+			MethodResponses: [][]any{{"Core/echo", map[string]any{"hello": "<world>"}, "c0"}},
+			SessionState:    "0",
+		}},
+		{"several with createdIds", response{
+			MethodResponses: [][]any{
+				{"Blob/allocate", map[string]any{"created": map[string]any{"k1": map[string]any{"id": "blob-1"}}}, "c0"},
+				{"error", map[string]any{"type": "unknownMethod"}, "c1"},
+			},
+			CreatedIDs:   map[string]string{"k1": "blob-1"},
+			SessionState: "abc",
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := NewWriter(0)
+			defer w.Release()
+			for _, r := range tt.resp.MethodResponses {
+				if err := w.Add(r); err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+			}
+			body, err := w.Finish(tt.resp.CreatedIDs, tt.resp.SessionState)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			want, _ := json.Marshal(tt.resp)
+			if body != string(want) {
+				t.Errorf("body mismatch\n got: %s\nwant: %s", body, want)
+			}
+		})
+	}
+}
+
+func TestWriter_AddOverLimit(t *testing.T) {
+	w := NewWriter(100)
+	defer w.Release()
+
+	if err := w.Add([]any{"Core/echo", map[string]any{}, "c0"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	before := w.Len()
+	err := w.Add([]any{"Core/echo", map[string]any{"data": strings.Repeat("x", 200)}, "c1"})
+	if !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+	if w.Len() != before {
+		t.Errorf("expected the body to be left at %d bytes, got %d", before, w.Len())
+	}
+
+	body, err := w.Finish(nil, "0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got response
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body is not valid JSON: %v: %s", err, body)
+	}
+	if len(got.MethodResponses) != 1 || got.MethodResponses[0][2] != "c0" {
+		t.Errorf("expected only c0 in the body, got %v", got.MethodResponses)
+	}
+}
+
+func TestWriter_FinishOverLimit(t *testing.T) {
+	w := NewWriter(40)
+	defer w.Release()
+
+	if _, err := w.Finish(map[string]string{"k1": strings.Repeat("x", 40)}, "0"); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge, got %v", err)
+	}
+}
+
+func TestWriter_UnencodableResponse(t *testing.T) {
+	w := NewWriter(0)
+	defer w.Release()
+
+	if err := w.Add([]any{"Core/echo", map[string]any{"bad": make(chan int)}, "c0"}); err == nil {
+		t.Fatal("expected an encoding error")
+	}
+	if err := w.Add([]any{"Core/echo", map[string]any{}, "c1"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := w.Finish(nil, "0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	var got response
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatalf("body is not valid JSON: %v: %s", err, body)
+	}
+	if !reflect.DeepEqual(got.MethodResponses, [][]any{{"Core/echo", map[string]any{}, "c1"}}) {
+		t.Errorf("unexpected method responses %v", got.MethodResponses)
+	}
+}
+
+func TestWriter_ReusesPooledBuffer(t *testing.T) {
+	first := NewWriter(0)
+	if err := first.Add([]any{"Core/echo", map[string]any{}, "c0"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, _ := first.Finish(nil, "0")
+	first.Release()
+
+	second := NewWriter(0)
+	defer second.Release()
+	got, _ := second.Finish(nil, "1")
+	if got != `{"methodResponses":[],"sessionState":"1"}` {
+		t.Errorf("expected a fresh body, got %s", got)
+	}
+	if !strings.Contains(body, `"c0"`) {
+		t.Errorf("expected the first body to survive release, got %s", body)
+	}
+}
@@ -0,0 +1,55 @@
+// Package sessionstate computes the state string of the JMAP Session object
+// (RFC 8620 section 2), which changes whenever the session a client would
+// be given changes. get-jmap-session puts it in the session and long-polls
+// on it, and jmap-api returns it as the sessionState of every response, so
+// both compute it from the same inputs: the plugin registry and the account
+// settings that shape the session.
+package sessionstate
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+)
+
+// stateSize is the number of hash bytes kept in a state string
+const stateSize = 9
+
+// Account is the account settings the session depends on
+type Account struct {
+	AccountType         string                    `json:"accountType,omitempty"`
+	WritesDisabled      bool                      `json:"writesDisabled,omitempty"`
+	CapabilityOverrides map[string]map[string]any `json:"capabilityOverrides,omitempty"`
+}
+
+// FromMeta returns the session settings of an account's META# record, or
+// the zero Account if it has not been provisioned
+func FromMeta(meta *account.Meta) Account {
+	if meta == nil {
+		return Account{}
+	}
+	return Account{
+		AccountType:         meta.AccountType,
+		WritesDisabled:      meta.WritesDisabled,
+		CapabilityOverrides: meta.CapabilityOverrides,
+	}
+}
+
+// Compute returns the session state for an account given the registry's
+// fingerprint. It is short, URL-safe, and the same for equal inputs.
+func Compute(registryFingerprint string, acct Account) string {
+	// Maps encode with sorted keys, so equal settings encode the same
+	data, err := json.Marshal(struct {
+		Registry string  `json:"registry"`
+		Account  Account `json:"account"`
+	}{registryFingerprint, acct})
+	if err != nil {
+		// Overrides come from JSON or DynamoDB, so always encode; fall
+		// back to the registry alone rather than fail the request
+		data = []byte(registryFingerprint)
+	}
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:stateSize])
+}
@@ -0,0 +1,49 @@
+package sessionstate
+
+import (
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+)
+
+func TestCompute_StableForEqualInputs(t *testing.T) {
+	a := Account{AccountType: "basic", CapabilityOverrides: map[string]map[string]any{
+		"urn:a": {"x": 1.0, "y": 2.0},
+		"urn:b": {"z": true},
+	}}
+	b := Account{AccountType: "basic", CapabilityOverrides: map[string]map[string]any{
+		"urn:b": {"z": true},
+		"urn:a": {"y": 2.0, "x": 1.0},
+	}}
+
+	if Compute("r1", a) != Compute("r1", b) {
+		t.Error("expected equal settings to give the same state")
+	}
+	if got := Compute("r1", a); len(got) != 12 {
+		t.Errorf("expected a 12 character state, got %q", got)
+	}
+}
+
+func TestCompute_ChangesWithInputs(t *testing.T) {
+	base := Compute("r1", Account{})
+	for name, state := range map[string]string{
+		"registry":        Compute("r2", Account{}),
+		"account type":    Compute("r1", Account{AccountType: "premium"}),
+		"writes disabled": Compute("r1", Account{WritesDisabled: true}),
+		"overrides":       Compute("r1", Account{CapabilityOverrides: map[string]map[string]any{"urn:a": {"x": 1.0}}}),
+	} {
+		if state == base {
+			t.Errorf("expected a change of %s to change the state", name)
+		}
+	}
+}
+
+func TestFromMeta(t *testing.T) {
+	if FromMeta(nil).AccountType != "" {
+		t.Error("expected the zero Account for an unprovisioned account")
+	}
+	meta := &account.Meta{AccountType: "basic", WritesDisabled: true, Tier: "gold"}
+	if got := FromMeta(meta); got.AccountType != "basic" || !got.WritesDisabled {
+		t.Errorf("unexpected settings %+v", got)
+	}
+}
@@ -0,0 +1,73 @@
+// Package sniff detects the media type of blob content from its first bytes
+// and compares it with the type the uploading client declared.
+package sniff
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Modes of content sniffing in blob-confirm
+const (
+	// ModeOff skips sniffing
+	ModeOff = "off"
+	// ModeFlag records the detected type and flags gross mismatches
+	ModeFlag = "flag"
+	// ModeCorrect also replaces a grossly mismatched declared type
+	ModeCorrect = "correct"
+)
+
+// HeadSize is how many bytes of content are read to detect its type
+const HeadSize = 512
+
+// Result compares a blob's declared and detected media types
+type Result struct {
+	Declared string
+	Detected string
+	// Mismatch is set when the content is clearly not of the declared type
+	Mismatch bool
+}
+
+// Check detects the media type of head, the first bytes of a blob declared
+// as declared
+func Check(declared string, head []byte) Result {
+	detected := http.DetectContentType(head)
+	return Result{
+		Declared: declared,
+		Detected: detected,
+		Mismatch: Mismatch(declared, detected),
+	}
+}
+
+// Mismatch reports whether content detected as detected is grossly at odds
+// with the declared type: its top-level type differs, as an image declared
+// as text does, or no real type was declared. Detection only recognises a
+// few formats, so plain text and unrecognised content never count as a
+// mismatch, and neither does a different subtype, such as an office document
+// detected as a zip file.
+func Mismatch(declared, detected string) bool {
+	detectedType := essence(detected)
+	if detectedType == "text/plain" || detectedType == "application/octet-stream" {
+		return false
+	}
+	declaredType := essence(declared)
+	if declaredType == "" || declaredType == "application/octet-stream" {
+		return true
+	}
+	return topLevel(declaredType) != topLevel(detectedType)
+}
+
+// essence returns a media type without its parameters, in lower case
+func essence(mediaType string) string {
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		return parsed
+	}
+	return strings.ToLower(strings.TrimSpace(mediaType))
+}
+
+// topLevel returns the part of a media type before the slash
+func topLevel(mediaType string) string {
+	top, _, _ := strings.Cut(mediaType, "/")
+	return top
+}
@@ -0,0 +1,55 @@
+package sniff
+
+import "testing"
+
+var (
+	pngHead = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+	pdfHead = []byte("%PDF-1.7\n")
+)
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name         string
+		declared     string
+		head         []byte
+		wantDetected string
+		wantMismatch bool
+	}{
+		{"matching image", "image/png", pngHead, "image/png", false},
+		{"image declared as text", "text/plain", pngHead, "image/png", true},
+		{"pdf declared as octet-stream", "application/octet-stream", pdfHead, "application/pdf", true},
+		{"pdf declared as image", "image/jpeg", pdfHead, "application/pdf", true},
+		{"email is plain text", "message/rfc822", []byte("From: a@example.com\r\nSubject: hi\r\n\r\nbody"), "text/plain; charset=utf-8", false},
+		{"unrecognised binary", "audio/ogg", []byte{0x00, 0x01, 0x02, 0x03}, "application/octet-stream", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Check(tt.declared, tt.head)
+			if got.Declared != tt.declared || got.Detected != tt.wantDetected || got.Mismatch != tt.wantMismatch {
+				t.Errorf("got %+v, want detected %q mismatch %v", got, tt.wantDetected, tt.wantMismatch)
+			}
+		})
+	}
+}
+
+func TestMismatch(t *testing.T) {
+	tests := []struct {
+		declared string
+		detected string
+		want     bool
+	}{
+		{"image/jpeg", "image/png", false},
+		{"application/vnd.openxmlformats-officedocument.wordprocessingml.document", "application/zip", false},
+		{"Image/PNG; name=x", "image/png", false},
+		{"text/plain", "text/html; charset=utf-8", false},
+		{"image/png", "text/html; charset=utf-8", true},
+		{"application/octet-stream", "image/gif", true},
+		{"application/json", "application/pdf", false},
+		{"", "image/gif", true},
+	}
+	for _, tt := range tests {
+		if got := Mismatch(tt.declared, tt.detected); got != tt.want {
+			t.Errorf("Mismatch(%q, %q) = %v, want %v", tt.declared, tt.detected, got, tt.want)
+		}
+	}
+}
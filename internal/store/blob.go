@@ -0,0 +1,649 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobcrypt"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/correlation"
+	"github.com/jarrod-lowe/jmap-service-core/internal/outbox"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+)
+
+// Limits of a batched blob lookup. BatchGetItem reads at most 100 keys per
+// request, and returns keys it could not read in time as unprocessed.
+const (
+	maxBatchGetKeys     = 100
+	maxBatchGetAttempts = 5
+	batchGetBaseDelay   = 50 * time.Millisecond
+	batchGetMaxDelay    = time.Second
+)
+
+// BlobStore reads and writes blob records in the core table
+type BlobStore struct {
+	client    DynamoDBClient
+	tableName string
+	envelope  *blobcrypt.Envelope
+	scan      bool
+	sleep     func(ctx context.Context, d time.Duration) error
+}
+
+// NewBlobStore creates a new BlobStore
+func NewBlobStore(client DynamoDBClient, tableName string) *BlobStore {
+	return &BlobStore{
+		client:    client,
+		tableName: tableName,
+		sleep:     sleepContext,
+	}
+}
+
+// WithEncryption seals the envelope's attributes of blob records as they are
+// written, and opens them as they are read
+func (s *BlobStore) WithEncryption(envelope *blobcrypt.Envelope) *BlobStore {
+	s.envelope = envelope
+	return s
+}
+
+// WithScanRequests marks blobs pending a content scan as they are
+// confirmed, and writes a blob.scan.requested event to the outbox in the
+// same transaction
+func (s *BlobStore) WithScanRequests() *BlobStore {
+	s.scan = true
+	return s
+}
+
+// ReserveBlob writes a pending record for a blob about to be uploaded
+// directly and deducts its size from the account's quota, in one
+// transaction conditional on the account having the quota remaining. The
+// upload is then confirmed with ConfirmBlob, or released with
+// CleanupAllocation if it fails. Until then the record is indexed as pending
+// until expiresAt, so blob-alloc-cleanup restores the quota of an upload that
+// never finished.
+//
+// Direct uploads do not count towards the account's pending allocations, so
+// the record is marked iamAuth, as IAM allocations are, and ConfirmBlob and
+// CleanupAllocation must be called with iamAuth set. Returns
+// ErrAccountNotProvisioned if the account has no META# record, and
+// ErrOverQuota if its quota is too low.
+func (s *BlobStore) ReserveBlob(ctx context.Context, record blobmeta.Record, expiresAt time.Time) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+	expires := expiresAt.UTC().Format(time.RFC3339)
+	item := map[string]any{
+		"pk":           AccountPK(record.AccountID),
+		"sk":           BlobSK(record.BlobID),
+		"blobId":       record.BlobID,
+		"accountId":    record.AccountID,
+		"size":         record.Size,
+		"contentType":  record.ContentType,
+		"s3Key":        record.S3Key,
+		"createdAt":    record.CreatedAt,
+		"status":       StatusPending,
+		"iamAuth":      true,
+		"urlExpiresAt": expires,
+		"gsi1pk":       PendingGSI1PK,
+		"gsi1sk":       fmt.Sprintf("%s%s#%s#%s", ExpiresPrefix, expires, record.AccountID, record.BlobID),
+	}
+	if record.Parent != "" {
+		item["parent"] = record.Parent
+	}
+	if record.Name != "" {
+		item["name"] = record.Name
+	}
+	if len(record.Tags) > 0 {
+		item["tags"] = record.Tags
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+	if s.envelope != nil {
+		if err := s.envelope.Seal(ctx, av); err != nil {
+			return err
+		}
+	}
+
+	size := strconv.FormatInt(record.Size, 10)
+	_, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: RequestToken(OpReserve, record.AccountID, record.BlobID),
+		TransactItems: []types.TransactWriteItem{
+			{Update: &types.Update{
+				TableName:           aws.String(s.tableName),
+				Key:                 MetaKey(record.AccountID),
+				UpdateExpression:    aws.String("ADD quotaRemaining :negSize SET updatedAt = :now"),
+				ConditionExpression: aws.String("attribute_exists(pk) AND quotaRemaining >= :size"),
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":negSize": &types.AttributeValueMemberN{Value: "-" + size},
+					":size":    &types.AttributeValueMemberN{Value: size},
+					":now":     &types.AttributeValueMemberS{Value: now},
+				},
+			}},
+			{Put: &types.Put{
+				TableName:           aws.String(s.tableName),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(pk)"),
+			}},
+		},
+	})
+	if isReplay(err) {
+		return nil
+	}
+	if isConditionFailure(err) {
+		return s.reserveFailure(ctx, record.AccountID, record.Size)
+	}
+	return err
+}
+
+// reserveFailure works out why a reservation's condition failed
+func (s *BlobStore) reserveFailure(ctx context.Context, accountID string, size int64) error {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(s.tableName),
+		Key:                  MetaKey(accountID),
+		ProjectionExpression: aws.String("quotaRemaining"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read account after reservation failed: %w", err)
+	}
+	if result.Item == nil {
+		return ErrAccountNotProvisioned
+	}
+	var meta struct {
+		QuotaRemaining int64 `dynamodbav:"quotaRemaining"`
+	}
+	if err := attributevalue.UnmarshalMap(result.Item, &meta); err != nil {
+		return err
+	}
+	if meta.QuotaRemaining < size {
+		return ErrOverQuota
+	}
+	return fmt.Errorf("reservation failed due to concurrent modification")
+}
+
+// GetBlob returns a blob record, or nil if there is none
+func (s *BlobStore) GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.tableName),
+		Key:       BlobKey(accountID, blobID),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+	return s.blobRecord(ctx, result.Item)
+}
+
+// GetBlobs returns the records of an account's blobs by blob ID, reading up
+// to 100 at a time. Blobs with no record are left out of the map. Keys
+// DynamoDB leaves unprocessed are retried with backoff, and an error is
+// returned if any remain.
+func (s *BlobStore) GetBlobs(ctx context.Context, accountID string, blobIDs []string) (map[string]*blobmeta.Record, error) {
+	records := make(map[string]*blobmeta.Record, len(blobIDs))
+	seen := make(map[string]bool, len(blobIDs))
+	var keys []map[string]types.AttributeValue
+	for _, blobID := range blobIDs {
+		if seen[blobID] {
+			continue
+		}
+		seen[blobID] = true
+		keys = append(keys, BlobKey(accountID, blobID))
+	}
+
+	for start := 0; start < len(keys); start += maxBatchGetKeys {
+		end := min(start+maxBatchGetKeys, len(keys))
+		items, err := s.batchGet(ctx, keys[start:end])
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range items {
+			record, err := s.blobRecord(ctx, item)
+			if err != nil {
+				return nil, err
+			}
+			records[record.BlobID] = record
+		}
+	}
+	return records, nil
+}
+
+// batchGet reads one batch of keys, retrying unprocessed keys
+func (s *BlobStore) batchGet(ctx context.Context, keys []map[string]types.AttributeValue) ([]map[string]types.AttributeValue, error) {
+	var items []map[string]types.AttributeValue
+	request := map[string]types.KeysAndAttributes{
+		s.tableName: {Keys: keys},
+	}
+	for attempt := 1; ; attempt++ {
+		result, err := s.client.BatchGetItem(ctx, &dynamodb.BatchGetItemInput{RequestItems: request})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, result.Responses[s.tableName]...)
+
+		unprocessed := result.UnprocessedKeys[s.tableName]
+		if len(unprocessed.Keys) == 0 {
+			return items, nil
+		}
+		if attempt >= maxBatchGetAttempts {
+			return nil, fmt.Errorf("%d blob records unprocessed after %d attempts", len(unprocessed.Keys), attempt)
+		}
+		if err := s.sleep(ctx, backoff(batchGetBaseDelay, batchGetMaxDelay, attempt)); err != nil {
+			return nil, err
+		}
+		request = map[string]types.KeysAndAttributes{s.tableName: unprocessed}
+	}
+}
+
+// blobRecord opens and reads a blob record item
+func (s *BlobStore) blobRecord(ctx context.Context, item map[string]types.AttributeValue) (*blobmeta.Record, error) {
+	if s.envelope != nil {
+		if err := s.envelope.Open(ctx, item); err != nil {
+			return nil, err
+		}
+	}
+
+	var record blobmeta.Record
+	if err := attributevalue.UnmarshalMap(item, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// MarkBlobDeleted sets deletedAt on a blob record. blob-cleanup removes the
+// object and record, and restores quota, from the stream event this causes.
+// The record must exist and not already be marked, so a delete racing
+// cleanup cannot recreate a bare record or cause a second cleanup; either
+// returns ErrAlreadyDeleted. Its gsi2 keys are removed with it, so a deleted
+// blob drops out of Blob/queryByMetadata straight away.
+func (s *BlobStore) MarkBlobDeleted(ctx context.Context, accountID, blobID string, deletedAt string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 BlobKey(accountID, blobID),
+		UpdateExpression:    aws.String("SET #deletedAt = :deletedAt REMOVE gsi2pk, gsi2sk"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND attribute_not_exists(#deletedAt)"),
+		ExpressionAttributeNames: map[string]string{
+			"#deletedAt": "deletedAt",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":deletedAt": &types.AttributeValueMemberS{Value: deletedAt},
+		},
+	})
+	if isConditionFailure(err) {
+		return ErrAlreadyDeleted
+	}
+	return err
+}
+
+// DeleteBlobRecord deletes a blob record marked deleted by its keys and, when
+// accountID and size are known, restores the size to the account's quota in
+// the same transaction. The delete is conditional on the record still being
+// there and marked, so a redelivered stream event cannot restore quota twice;
+// a record already removed returns ErrAlreadyDeleted.
+func (s *BlobStore) DeleteBlobRecord(ctx context.Context, pk, sk string, accountID string, size int64) error {
+	key := map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: pk},
+		"sk": &types.AttributeValueMemberS{Value: sk},
+	}
+	condition := aws.String("attribute_exists(deletedAt)")
+	if accountID == "" || size == 0 {
+		_, err := s.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+			TableName:           aws.String(s.tableName),
+			Key:                 key,
+			ConditionExpression: condition,
+		})
+		if isConditionFailure(err) {
+			return ErrAlreadyDeleted
+		}
+		return err
+	}
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: RequestToken(OpDelete, pk, sk),
+		TransactItems: []types.TransactWriteItem{
+			{
+				Delete: &types.Delete{
+					TableName:           aws.String(s.tableName),
+					Key:                 key,
+					ConditionExpression: condition,
+				},
+			},
+			{
+				Update: &types.Update{
+					TableName:        aws.String(s.tableName),
+					Key:              MetaKey(accountID),
+					UpdateExpression: aws.String("ADD quotaRemaining :size"),
+					ExpressionAttributeValues: map[string]types.AttributeValue{
+						":size": &types.AttributeValueMemberN{Value: strconv.FormatInt(size, 10)},
+					},
+				},
+			},
+		},
+	})
+	if isConditionFailure(err) || isReplay(err) {
+		return ErrAlreadyDeleted
+	}
+	return err
+}
+
+// GetBlobInfo returns the allocation status of a blob record, or nil if
+// there is none
+func (s *BlobStore) GetBlobInfo(ctx context.Context, accountID, blobID string) (*blobmeta.Info, error) {
+	result, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:            aws.String(s.tableName),
+		Key:                  BlobKey(accountID, blobID),
+		ProjectionExpression: aws.String("#status, sizeUnknown, iamAuth, contentType, tags, declaredChecksumSha256, maxSize"),
+		ExpressionAttributeNames: map[string]string{
+			"#status": "status",
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	info := &blobmeta.Info{}
+	if statusAttr, ok := result.Item["status"].(*types.AttributeValueMemberS); ok {
+		info.Status = statusAttr.Value
+	}
+	if suAttr, ok := result.Item["sizeUnknown"].(*types.AttributeValueMemberBOOL); ok {
+		info.SizeUnknown = suAttr.Value
+	}
+	if iaAttr, ok := result.Item["iamAuth"].(*types.AttributeValueMemberBOOL); ok {
+		info.IAMAuth = iaAttr.Value
+	}
+	if ctAttr, ok := result.Item["contentType"].(*types.AttributeValueMemberS); ok {
+		info.ContentType = ctAttr.Value
+	}
+	if checksumAttr, ok := result.Item["declaredChecksumSha256"].(*types.AttributeValueMemberS); ok {
+		info.Checksum = checksumAttr.Value
+	}
+	if maxSizeAttr, ok := result.Item["maxSize"].(*types.AttributeValueMemberN); ok {
+		maxSize, err := strconv.ParseInt(maxSizeAttr.Value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid blob maxSize: %w", err)
+		}
+		info.MaxSize = maxSize
+	}
+	if tagsAttr, ok := result.Item["tags"]; ok {
+		if err := attributevalue.Unmarshal(tagsAttr, &info.Tags); err != nil {
+			return nil, fmt.Errorf("invalid blob tags: %w", err)
+		}
+	}
+	return info, nil
+}
+
+// ConfirmBlob marks a pending blob confirmed and takes it out of the pending
+// index. Unless iamAuth, it decrements the account's pending count; when
+// sizeUnknown, it also records actualSize and deducts it from quota. With
+// scan requests, the blob is marked pending a scan and the request is written
+// to the outbox. A blob that is no longer pending has already been confirmed,
+// so that is not an error.
+func (s *BlobStore) ConfirmBlob(ctx context.Context, accountID, blobID string, actualSize int64, sizeUnknown bool, iamAuth bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	blobUpdateExpr := "SET #status = :confirmed, confirmedAt = :now REMOVE gsi1pk, gsi1sk"
+	blobExprNames := map[string]string{"#status": "status"}
+	blobExprValues := map[string]types.AttributeValue{
+		":confirmed": &types.AttributeValueMemberS{Value: StatusConfirmed},
+		":pending":   &types.AttributeValueMemberS{Value: StatusPending},
+		":now":       &types.AttributeValueMemberS{Value: now},
+	}
+	if sizeUnknown {
+		blobUpdateExpr = "SET #status = :confirmed, confirmedAt = :now, #size = :actualSize REMOVE gsi1pk, gsi1sk, sizeUnknown"
+		blobExprNames["#size"] = "size"
+		blobExprValues[":actualSize"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(actualSize, 10)}
+	}
+
+	metaUpdateExpr := "ADD pendingAllocationsCount :negOne SET updatedAt = :now"
+	metaValues := map[string]types.AttributeValue{
+		":now": &types.AttributeValueMemberS{Value: now},
+	}
+	switch {
+	case iamAuth && sizeUnknown:
+		metaUpdateExpr = "ADD quotaRemaining :negSize SET updatedAt = :now"
+	case iamAuth:
+		metaUpdateExpr = "SET updatedAt = :now"
+	case sizeUnknown:
+		metaUpdateExpr = "ADD pendingAllocationsCount :negOne, quotaRemaining :negSize SET updatedAt = :now"
+	}
+	if !iamAuth {
+		metaValues[":negOne"] = &types.AttributeValueMemberN{Value: "-1"}
+	}
+	if sizeUnknown {
+		metaValues[":negSize"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(-actualSize, 10)}
+	}
+
+	if s.scan {
+		blobUpdateExpr = strings.Replace(blobUpdateExpr, "confirmedAt = :now", "confirmedAt = :now, scanStatus = :scanPending", 1)
+		blobExprValues[":scanPending"] = &types.AttributeValueMemberS{Value: ScanPending}
+	}
+
+	items := []types.TransactWriteItem{
+		{Update: &types.Update{
+			TableName:                 aws.String(s.tableName),
+			Key:                       BlobKey(accountID, blobID),
+			UpdateExpression:          aws.String(blobUpdateExpr),
+			ConditionExpression:       aws.String("#status = :pending"),
+			ExpressionAttributeNames:  blobExprNames,
+			ExpressionAttributeValues: blobExprValues,
+		}},
+		{Update: &types.Update{
+			TableName:                 aws.String(s.tableName),
+			Key:                       MetaKey(accountID),
+			UpdateExpression:          aws.String(metaUpdateExpr),
+			ExpressionAttributeValues: metaValues,
+		}},
+	}
+	if s.scan {
+		event := publisher.EventPayload{
+			EventType:  publisher.EventBlobScanRequested,
+			OccurredAt: now,
+			AccountID:  accountID,
+			Data: map[string]any{
+				"blobId": blobID,
+				"size":   actualSize,
+			},
+			CorrelationID: correlation.FromContext(ctx),
+		}
+		outboxItem, err := outbox.Put(s.tableName, uuid.New().String(), event, time.Now())
+		if err != nil {
+			return err
+		}
+		items = append(items, outboxItem)
+	}
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: RequestToken(OpConfirm, accountID, blobID),
+		TransactItems:      items,
+	})
+	if err != nil && !isConditionFailure(err) && !isReplay(err) {
+		return err
+	}
+	return nil
+}
+
+// RecordSniffedType records the type sniffed from a pending blob's content
+// next to the type its client declared. A mismatch is flagged and, when
+// correct, the detected type replaces the declared one. A blob that is no
+// longer pending has already been confirmed, so it is left alone.
+func (s *BlobStore) RecordSniffedType(ctx context.Context, accountID, blobID string, result sniff.Result, correct bool) error {
+	updateExpr := "SET declaredType = :declared, detectedType = :detected"
+	values := map[string]types.AttributeValue{
+		":declared": &types.AttributeValueMemberS{Value: result.Declared},
+		":detected": &types.AttributeValueMemberS{Value: result.Detected},
+		":pending":  &types.AttributeValueMemberS{Value: StatusPending},
+	}
+	if result.Mismatch {
+		updateExpr += ", typeMismatch = :mismatch"
+		values[":mismatch"] = &types.AttributeValueMemberBOOL{Value: true}
+		if correct {
+			updateExpr += ", contentType = :detected"
+		}
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(s.tableName),
+		Key:                       BlobKey(accountID, blobID),
+		UpdateExpression:          aws.String(updateExpr),
+		ConditionExpression:       aws.String("#status = :pending"),
+		ExpressionAttributeNames:  map[string]string{"#status": "status"},
+		ExpressionAttributeValues: values,
+	})
+	if err != nil && !isConditionFailure(err) {
+		return err
+	}
+	return nil
+}
+
+// RecordChecksum records that a pending blob's content matched the checksum
+// its client declared. A blob that is no longer pending has already been
+// confirmed, so it is left alone.
+func (s *BlobStore) RecordChecksum(ctx context.Context, accountID, blobID, checksum string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                aws.String(s.tableName),
+		Key:                      BlobKey(accountID, blobID),
+		UpdateExpression:         aws.String("SET checksumSha256 = :checksum"),
+		ConditionExpression:      aws.String("#status = :pending"),
+		ExpressionAttributeNames: map[string]string{"#status": "status"},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":checksum": &types.AttributeValueMemberS{Value: checksum},
+			":pending":  &types.AttributeValueMemberS{Value: StatusPending},
+		},
+	})
+	if err != nil && !isConditionFailure(err) {
+		return err
+	}
+	return nil
+}
+
+// SetScanStatus records a scanner's verdict on a blob. Returns
+// ErrBlobNotFound if the blob has no record or is marked deleted.
+func (s *BlobStore) SetScanStatus(ctx context.Context, accountID, blobID, status string) error {
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.tableName),
+		Key:                 BlobKey(accountID, blobID),
+		UpdateExpression:    aws.String("SET scanStatus = :status, scannedAt = :now"),
+		ConditionExpression: aws.String("attribute_exists(pk) AND attribute_not_exists(deletedAt)"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":status": &types.AttributeValueMemberS{Value: status},
+			":now":    &types.AttributeValueMemberS{Value: time.Now().UTC().Format(time.RFC3339)},
+		},
+	})
+	if isConditionFailure(err) {
+		return ErrBlobNotFound
+	}
+	return err
+}
+
+// GetExpiredPendingAllocations returns the pending allocations whose upload
+// URLs expired before cutoff
+func (s *BlobStore) GetExpiredPendingAllocations(ctx context.Context, cutoff time.Time) ([]blobmeta.PendingAllocation, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String(s.tableName),
+		IndexName:              aws.String(GSI1Name),
+		KeyConditionExpression: aws.String("gsi1pk = :pending AND gsi1sk < :cutoff"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":pending": &types.AttributeValueMemberS{Value: PendingGSI1PK},
+			":cutoff":  &types.AttributeValueMemberS{Value: fmt.Sprintf("%s%s#", ExpiresPrefix, cutoff.UTC().Format(time.RFC3339))},
+		},
+	}
+
+	allocations := []blobmeta.PendingAllocation{}
+	for {
+		result, err := s.client.Query(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range result.Items {
+			if alloc, ok := pendingAllocation(item); ok {
+				allocations = append(allocations, alloc)
+			}
+		}
+		if len(result.LastEvaluatedKey) == 0 {
+			return allocations, nil
+		}
+		input.ExclusiveStartKey = result.LastEvaluatedKey
+	}
+}
+
+// pendingAllocation reads a pending allocation from a gsi1 item
+func pendingAllocation(item map[string]types.AttributeValue) (blobmeta.PendingAllocation, bool) {
+	var alloc blobmeta.PendingAllocation
+	pk, _ := item["pk"].(*types.AttributeValueMemberS)
+	sk, _ := item["sk"].(*types.AttributeValueMemberS)
+	if pk == nil || sk == nil {
+		return alloc, false
+	}
+	var ok bool
+	if alloc.AccountID, alloc.BlobID, ok = ParseBlobKey(pk.Value, sk.Value); !ok {
+		return alloc, false
+	}
+	if s3KeyAttr, ok := item["s3Key"].(*types.AttributeValueMemberS); ok {
+		alloc.S3Key = s3KeyAttr.Value
+	}
+	if sizeAttr, ok := item["size"].(*types.AttributeValueMemberN); ok {
+		alloc.Size, _ = strconv.ParseInt(sizeAttr.Value, 10, 64)
+	}
+	if iaAttr, ok := item["iamAuth"].(*types.AttributeValueMemberBOOL); ok {
+		alloc.IAMAuth = iaAttr.Value
+	}
+	return alloc, true
+}
+
+// CleanupAllocation deletes a pending blob record and restores its size to
+// the account's quota, and unless iamAuth decrements the pending count, in
+// one transaction. Returns ErrNotPending if the blob was confirmed or
+// removed meanwhile.
+func (s *BlobStore) CleanupAllocation(ctx context.Context, accountID, blobID string, size int64, iamAuth bool) error {
+	now := time.Now().UTC().Format(time.RFC3339)
+
+	updateExpr := "ADD pendingAllocationsCount :negOne, quotaRemaining :size SET updatedAt = :now"
+	exprValues := map[string]types.AttributeValue{
+		":size": &types.AttributeValueMemberN{Value: strconv.FormatInt(size, 10)},
+		":now":  &types.AttributeValueMemberS{Value: now},
+	}
+	if iamAuth {
+		updateExpr = "ADD quotaRemaining :size SET updatedAt = :now"
+	} else {
+		exprValues[":negOne"] = &types.AttributeValueMemberN{Value: "-1"}
+	}
+
+	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+		ClientRequestToken: RequestToken(OpCleanupAllocation, accountID, blobID),
+		TransactItems: []types.TransactWriteItem{
+			{Delete: &types.Delete{
+				TableName:           aws.String(s.tableName),
+				Key:                 BlobKey(accountID, blobID),
+				ConditionExpression: aws.String("#status = :pending"),
+				ExpressionAttributeNames: map[string]string{
+					"#status": "status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":pending": &types.AttributeValueMemberS{Value: StatusPending},
+				},
+			}},
+			{Update: &types.Update{
+				TableName:                 aws.String(s.tableName),
+				Key:                       MetaKey(accountID),
+				UpdateExpression:          aws.String(updateExpr),
+				ExpressionAttributeValues: exprValues,
+			}},
+		},
+	})
+	if isConditionFailure(err) || isReplay(err) {
+		return ErrNotPending
+	}
+	return err
+}
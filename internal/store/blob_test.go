@@ -0,0 +1,619 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+	"github.com/jarrod-lowe/jmap-service-core/internal/sniff"
+)
+
+func TestReserveBlob(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	err := s.ReserveBlob(context.Background(), blobmeta.Record{
+		BlobID:      "blob-1",
+		AccountID:   "acc-1",
+		Size:        42,
+		ContentType: "text/plain",
+		S3Key:       "acc-1/blob-1",
+		CreatedAt:   "2026-01-01T00:00:00Z",
+		Tags:        map[string]string{"Retention": "7y"},
+	}, time.Date(2026, 1, 1, 0, 15, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	tx := client.transaction
+	if tx == nil || len(tx.TransactItems) != 2 {
+		t.Fatalf("expected a two-item transaction, got %+v", tx)
+	}
+	if *tx.ClientRequestToken != *RequestToken(OpReserve, "acc-1", "blob-1") {
+		t.Error("expected the reservation's request token")
+	}
+
+	meta := tx.TransactItems[0].Update
+	if keyValue(meta.Key, "sk") != MetaSK || !strings.Contains(*meta.ConditionExpression, "quotaRemaining >= :size") {
+		t.Errorf("unexpected META# update %+v", meta)
+	}
+	if n := meta.ExpressionAttributeValues[":negSize"].(*types.AttributeValueMemberN); n.Value != "-42" {
+		t.Errorf("expected 42 bytes deducted, got %s", n.Value)
+	}
+
+	item := tx.TransactItems[1].Put.Item
+	if keyValue(item, "pk") != "ACCOUNT#acc-1" || keyValue(item, "sk") != "BLOB#blob-1" {
+		t.Errorf("unexpected keys %v", item)
+	}
+	if keyValue(item, "status") != StatusPending || keyValue(item, "gsi1pk") != PendingGSI1PK {
+		t.Errorf("expected a pending, indexed record, got %v", item)
+	}
+	if keyValue(item, "gsi1sk") != "EXPIRES#2026-01-01T00:15:00Z#acc-1#blob-1" {
+		t.Errorf("unexpected gsi1sk %q", keyValue(item, "gsi1sk"))
+	}
+	if iam, ok := item["iamAuth"].(*types.AttributeValueMemberBOOL); !ok || !iam.Value {
+		t.Error("expected the reservation not to count as a pending allocation")
+	}
+	if _, ok := item["parent"]; ok {
+		t.Error("expected no parent attribute")
+	}
+	if tags, ok := item["tags"].(*types.AttributeValueMemberM); !ok || keyValue(tags.Value, "Retention") != "7y" {
+		t.Errorf("expected the Retention tag stored, got %v", item["tags"])
+	}
+}
+
+func TestReserveBlob_ConditionFailed(t *testing.T) {
+	failed := &types.TransactionCanceledException{CancellationReasons: []types.CancellationReason{
+		{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("None")},
+	}}
+	record := blobmeta.Record{BlobID: "blob-1", AccountID: "acc-1", Size: 42}
+
+	tests := []struct {
+		name string
+		meta map[string]types.AttributeValue
+		want error
+	}{
+		{"no account", nil, ErrAccountNotProvisioned},
+		{"over quota", map[string]types.AttributeValue{
+			"quotaRemaining": &types.AttributeValueMemberN{Value: "41"},
+		}, ErrOverQuota},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewBlobStore(&mockDynamoDBClient{item: tt.meta, txErr: failed}, "jmap-test")
+			if err := s.ReserveBlob(context.Background(), record, time.Now()); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	// A replay of an applied reservation succeeds
+	s := NewBlobStore(&mockDynamoDBClient{txErr: &types.IdempotentParameterMismatchException{}}, "jmap-test")
+	if err := s.ReserveBlob(context.Background(), record, time.Now()); err != nil {
+		t.Errorf("expected a replay to succeed, got %v", err)
+	}
+}
+
+func TestGetBlob(t *testing.T) {
+	client := &mockDynamoDBClient{item: map[string]types.AttributeValue{
+		"blobId":    &types.AttributeValueMemberS{Value: "blob-1"},
+		"accountId": &types.AttributeValueMemberS{Value: "acc-1"},
+		"size":      &types.AttributeValueMemberN{Value: "42"},
+		"deletedAt": &types.AttributeValueMemberS{Value: "2026-01-02T00:00:00Z"},
+	}}
+	s := NewBlobStore(client, "jmap-test")
+
+	record, err := s.GetBlob(context.Background(), "acc-1", "blob-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if record == nil || record.Size != 42 || record.DeletedAt == "" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if keyValue(client.gets[0].Key, "sk") != "BLOB#blob-1" {
+		t.Errorf("unexpected key %v", client.gets[0].Key)
+	}
+}
+
+func TestGetBlob_NotFound(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{}, "jmap-test")
+
+	record, err := s.GetBlob(context.Background(), "acc-1", "blob-1")
+	if err != nil || record != nil {
+		t.Errorf("expected nil, nil, got %+v, %v", record, err)
+	}
+}
+
+// blobItem returns the record item of a blob
+func blobItem(accountID, blobID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk":        &types.AttributeValueMemberS{Value: AccountPK(accountID)},
+		"sk":        &types.AttributeValueMemberS{Value: BlobSK(blobID)},
+		"blobId":    &types.AttributeValueMemberS{Value: blobID},
+		"accountId": &types.AttributeValueMemberS{Value: accountID},
+		"size":      &types.AttributeValueMemberN{Value: "42"},
+	}
+}
+
+// batchOutput returns a BatchGetItem result of items, leaving unprocessed
+// the blobs of unprocessed
+func batchOutput(items []map[string]types.AttributeValue, unprocessed ...string) *dynamodb.BatchGetItemOutput {
+	out := &dynamodb.BatchGetItemOutput{
+		Responses: map[string][]map[string]types.AttributeValue{"jmap-test": items},
+	}
+	if len(unprocessed) > 0 {
+		var keys []map[string]types.AttributeValue
+		for _, blobID := range unprocessed {
+			keys = append(keys, BlobKey("acc-1", blobID))
+		}
+		out.UnprocessedKeys = map[string]types.KeysAndAttributes{"jmap-test": {Keys: keys}}
+	}
+	return out
+}
+
+// newTestBlobStore returns a BlobStore over client that does not wait
+// between retries
+func newTestBlobStore(client DynamoDBClient) *BlobStore {
+	s := NewBlobStore(client, "jmap-test")
+	s.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+	return s
+}
+
+func TestGetBlobs(t *testing.T) {
+	client := &mockDynamoDBClient{batches: []*dynamodb.BatchGetItemOutput{
+		batchOutput([]map[string]types.AttributeValue{blobItem("acc-1", "blob-1")}, "blob-2"),
+		batchOutput([]map[string]types.AttributeValue{blobItem("acc-1", "blob-2")}),
+	}}
+	s := newTestBlobStore(client)
+
+	records, err := s.GetBlobs(context.Background(), "acc-1", []string{"blob-1", "blob-2", "blob-1", "blob-3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(records) != 2 || records["blob-1"].Size != 42 || records["blob-2"] == nil {
+		t.Errorf("unexpected records %+v", records)
+	}
+	if len(client.batchGets) != 2 {
+		t.Fatalf("expected a retry of the unprocessed key, got %d requests", len(client.batchGets))
+	}
+	if keys := client.batchGets[0].RequestItems["jmap-test"].Keys; len(keys) != 3 {
+		t.Errorf("expected 3 distinct keys, got %d", len(keys))
+	}
+	if keys := client.batchGets[1].RequestItems["jmap-test"].Keys; len(keys) != 1 || keyValue(keys[0], "sk") != "BLOB#blob-2" {
+		t.Errorf("unexpected retried keys %v", keys)
+	}
+}
+
+func TestGetBlobs_Batches(t *testing.T) {
+	client := &mockDynamoDBClient{batches: []*dynamodb.BatchGetItemOutput{batchOutput(nil), batchOutput(nil), batchOutput(nil)}}
+	s := newTestBlobStore(client)
+
+	blobIDs := make([]string, 250)
+	for i := range blobIDs {
+		blobIDs[i] = fmt.Sprintf("blob-%d", i)
+	}
+	records, err := s.GetBlobs(context.Background(), "acc-1", blobIDs)
+	if err != nil || len(records) != 0 {
+		t.Fatalf("expected no records, got %v, %v", records, err)
+	}
+	var sizes []int
+	for _, input := range client.batchGets {
+		sizes = append(sizes, len(input.RequestItems["jmap-test"].Keys))
+	}
+	if len(sizes) != 3 || sizes[0] != 100 || sizes[1] != 100 || sizes[2] != 50 {
+		t.Errorf("unexpected batch sizes %v", sizes)
+	}
+}
+
+func TestGetBlobs_StillUnprocessed(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	for range maxBatchGetAttempts {
+		client.batches = append(client.batches, batchOutput(nil, "blob-1"))
+	}
+	s := newTestBlobStore(client)
+
+	if _, err := s.GetBlobs(context.Background(), "acc-1", []string{"blob-1"}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if len(client.batchGets) != maxBatchGetAttempts {
+		t.Errorf("expected %d requests, got %d", maxBatchGetAttempts, len(client.batchGets))
+	}
+}
+
+func TestGetBlobs_None(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	records, err := NewBlobStore(client, "jmap-test").GetBlobs(context.Background(), "acc-1", nil)
+	if err != nil || len(records) != 0 || len(client.batchGets) != 0 {
+		t.Errorf("expected no requests, got %v, %v, %d", records, err, len(client.batchGets))
+	}
+}
+
+func TestMarkBlobDeleted(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.MarkBlobDeleted(context.Background(), "acc-1", "blob-1", "2026-01-02T00:00:00Z"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	update := client.updates[0]
+	if keyValue(update.Key, "pk") != "ACCOUNT#acc-1" || keyValue(update.ExpressionAttributeValues, ":deletedAt") != "2026-01-02T00:00:00Z" {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if got := aws.ToString(update.ConditionExpression); got != "attribute_exists(pk) AND attribute_not_exists(#deletedAt)" {
+		t.Errorf("unexpected condition %q", got)
+	}
+}
+
+func TestMarkBlobDeleted_AlreadyDeleted(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: &types.ConditionalCheckFailedException{}}, "jmap-test")
+
+	err := s.MarkBlobDeleted(context.Background(), "acc-1", "blob-1", "2026-01-02T00:00:00Z")
+	if !errors.Is(err, ErrAlreadyDeleted) {
+		t.Errorf("expected ErrAlreadyDeleted, got %v", err)
+	}
+}
+
+func TestDeleteBlobRecord_WithoutQuota(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.DeleteBlobRecord(context.Background(), "ACCOUNT#acc-1", "BLOB#blob-1", "", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.deletes) != 1 || client.transaction != nil {
+		t.Fatalf("expected a plain delete, got %d deletes and transaction %v", len(client.deletes), client.transaction)
+	}
+	if got := aws.ToString(client.deletes[0].ConditionExpression); got != "attribute_exists(deletedAt)" {
+		t.Errorf("unexpected condition %q", got)
+	}
+}
+
+func TestDeleteBlobRecord_RestoresQuota(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.DeleteBlobRecord(context.Background(), "ACCOUNT#acc-1", "BLOB#blob-1", "acc-1", 42); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(client.deletes) != 0 || client.transaction == nil {
+		t.Fatal("expected a transaction")
+	}
+	if del := client.transaction.TransactItems[0].Delete; aws.ToString(del.ConditionExpression) != "attribute_exists(deletedAt)" {
+		t.Errorf("unexpected delete %+v", del)
+	}
+	if got, want := aws.ToString(client.transaction.ClientRequestToken), aws.ToString(RequestToken(OpDelete, "ACCOUNT#acc-1", "BLOB#blob-1")); got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+	update := client.transaction.TransactItems[1].Update
+	if keyValue(update.Key, "sk") != "META#" || aws.ToString(update.UpdateExpression) != "ADD quotaRemaining :size" {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if size := update.ExpressionAttributeValues[":size"].(*types.AttributeValueMemberN); size.Value != "42" {
+		t.Errorf("unexpected size %s", size.Value)
+	}
+}
+
+func TestDeleteBlobRecord_AlreadyRemoved(t *testing.T) {
+	tests := []struct {
+		name      string
+		accountID string
+		size      int64
+		err       error
+	}{
+		{"plain delete", "", 0, &types.ConditionalCheckFailedException{}},
+		{"with quota", "acc-1", 42, &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("None")}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDynamoDBClient{err: tt.err}
+			s := NewBlobStore(client, "jmap-test")
+
+			err := s.DeleteBlobRecord(context.Background(), "ACCOUNT#acc-1", "BLOB#blob-1", tt.accountID, tt.size)
+			if !errors.Is(err, ErrAlreadyDeleted) {
+				t.Errorf("expected ErrAlreadyDeleted, got %v", err)
+			}
+		})
+	}
+}
+
+func TestGetBlobInfo(t *testing.T) {
+	client := &mockDynamoDBClient{item: map[string]types.AttributeValue{
+		"status":      &types.AttributeValueMemberS{Value: StatusPending},
+		"sizeUnknown": &types.AttributeValueMemberBOOL{Value: true},
+		"contentType": &types.AttributeValueMemberS{Value: "image/png"},
+		"tags": &types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+			"Source": &types.AttributeValueMemberS{Value: "scanner"},
+		}},
+		"declaredChecksumSha256": &types.AttributeValueMemberS{Value: "c3VtMQ=="},
+	}}
+	s := NewBlobStore(client, "jmap-test")
+
+	info, err := s.GetBlobInfo(context.Background(), "acc-1", "blob-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.Status != StatusPending || !info.SizeUnknown || info.IAMAuth || info.ContentType != "image/png" || info.Tags["Source"] != "scanner" || info.Checksum != "c3VtMQ==" {
+		t.Errorf("unexpected info %+v", info)
+	}
+}
+
+func TestConfirmBlob_Expressions(t *testing.T) {
+	tests := []struct {
+		name        string
+		sizeUnknown bool
+		iamAuth     bool
+		blobExpr    string
+		metaExpr    string
+	}{
+		{"presigned", false, false,
+			"SET #status = :confirmed, confirmedAt = :now REMOVE gsi1pk, gsi1sk",
+			"ADD pendingAllocationsCount :negOne SET updatedAt = :now"},
+		{"presigned size unknown", true, false,
+			"SET #status = :confirmed, confirmedAt = :now, #size = :actualSize REMOVE gsi1pk, gsi1sk, sizeUnknown",
+			"ADD pendingAllocationsCount :negOne, quotaRemaining :negSize SET updatedAt = :now"},
+		{"iam", false, true,
+			"SET #status = :confirmed, confirmedAt = :now REMOVE gsi1pk, gsi1sk",
+			"SET updatedAt = :now"},
+		{"iam size unknown", true, true,
+			"SET #status = :confirmed, confirmedAt = :now, #size = :actualSize REMOVE gsi1pk, gsi1sk, sizeUnknown",
+			"ADD quotaRemaining :negSize SET updatedAt = :now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDynamoDBClient{}
+			s := NewBlobStore(client, "jmap-test")
+
+			if err := s.ConfirmBlob(context.Background(), "acc-1", "blob-1", 42, tt.sizeUnknown, tt.iamAuth); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			blob := client.transaction.TransactItems[0].Update
+			meta := client.transaction.TransactItems[1].Update
+			if got := aws.ToString(blob.UpdateExpression); got != tt.blobExpr {
+				t.Errorf("blob expression = %q", got)
+			}
+			if got := aws.ToString(meta.UpdateExpression); got != tt.metaExpr {
+				t.Errorf("meta expression = %q", got)
+			}
+			for _, name := range []string{":negOne", ":negSize"} {
+				if _, ok := meta.ExpressionAttributeValues[name]; ok != strings.Contains(tt.metaExpr, name) {
+					t.Errorf("value %s present = %v", name, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestConfirmBlob_AlreadyConfirmed(t *testing.T) {
+	client := &mockDynamoDBClient{err: &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}, {Code: aws.String("None")}},
+	}}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.ConfirmBlob(context.Background(), "acc-1", "blob-1", 42, false, false); err != nil {
+		t.Errorf("expected a repeated confirm to succeed, got %v", err)
+	}
+}
+
+func TestConfirmBlob_Replayed(t *testing.T) {
+	client := &mockDynamoDBClient{err: &types.IdempotentParameterMismatchException{}}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.ConfirmBlob(context.Background(), "acc-1", "blob-1", 42, false, false); err != nil {
+		t.Errorf("expected a replayed confirm to succeed, got %v", err)
+	}
+	if got, want := aws.ToString(client.transaction.ClientRequestToken), aws.ToString(RequestToken(OpConfirm, "acc-1", "blob-1")); got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestConfirmBlob_Error(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: errors.New("throttled")}, "jmap-test")
+
+	if err := s.ConfirmBlob(context.Background(), "acc-1", "blob-1", 42, false, false); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestConfirmBlob_WithScanRequests(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test").WithScanRequests()
+
+	if err := s.ConfirmBlob(context.Background(), "acc-1", "blob-1", 42, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	items := client.transaction.TransactItems
+	if len(items) != 3 {
+		t.Fatalf("expected blob, meta and outbox items, got %d", len(items))
+	}
+	blob := items[0].Update
+	if got := aws.ToString(blob.UpdateExpression); !strings.Contains(got, "scanStatus = :scanPending") {
+		t.Errorf("blob expression = %q", got)
+	}
+	if keyValue(blob.ExpressionAttributeValues, ":scanPending") != ScanPending {
+		t.Errorf("unexpected scan status %+v", blob.ExpressionAttributeValues)
+	}
+	event := items[2].Put.Item
+	if keyValue(event, "eventType") != "blob.scan.requested" || !strings.HasPrefix(keyValue(event, "sk"), "OUTBOX#") {
+		t.Errorf("unexpected outbox item %+v", event)
+	}
+	if payload := keyValue(event, "payload"); !strings.Contains(payload, `"blobId":"blob-1"`) {
+		t.Errorf("unexpected payload %s", payload)
+	}
+}
+
+func TestSetScanStatus(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.SetScanStatus(context.Background(), "acc-1", "blob-1", ScanInfected); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	update := client.updates[0]
+	if keyValue(update.Key, "sk") != "BLOB#blob-1" || keyValue(update.ExpressionAttributeValues, ":status") != ScanInfected {
+		t.Errorf("unexpected update %+v", update)
+	}
+}
+
+func TestSetScanStatus_NotFound(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: &types.ConditionalCheckFailedException{}}, "jmap-test")
+
+	err := s.SetScanStatus(context.Background(), "acc-1", "blob-1", ScanClean)
+	if !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound, got %v", err)
+	}
+}
+
+func TestRecordSniffedType(t *testing.T) {
+	tests := []struct {
+		name     string
+		result   sniff.Result
+		correct  bool
+		wantExpr string
+	}{
+		{"match", sniff.Result{Declared: "image/png", Detected: "image/png"}, true,
+			"SET declaredType = :declared, detectedType = :detected"},
+		{"flagged", sniff.Result{Declared: "text/plain", Detected: "image/png", Mismatch: true}, false,
+			"SET declaredType = :declared, detectedType = :detected, typeMismatch = :mismatch"},
+		{"corrected", sniff.Result{Declared: "text/plain", Detected: "image/png", Mismatch: true}, true,
+			"SET declaredType = :declared, detectedType = :detected, typeMismatch = :mismatch, contentType = :detected"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &mockDynamoDBClient{}
+			s := NewBlobStore(client, "jmap-test")
+
+			if err := s.RecordSniffedType(context.Background(), "acc-1", "blob-1", tt.result, tt.correct); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			update := client.updates[0]
+			if aws.ToString(update.UpdateExpression) != tt.wantExpr {
+				t.Errorf("got %q, want %q", aws.ToString(update.UpdateExpression), tt.wantExpr)
+			}
+			if keyValue(update.ExpressionAttributeValues, ":detected") != "image/png" || aws.ToString(update.ConditionExpression) != "#status = :pending" {
+				t.Errorf("unexpected update %+v", update)
+			}
+		})
+	}
+}
+
+func TestRecordSniffedType_NoLongerPending(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: &types.ConditionalCheckFailedException{}}, "jmap-test")
+
+	if err := s.RecordSniffedType(context.Background(), "acc-1", "blob-1", sniff.Result{}, false); err != nil {
+		t.Errorf("expected a confirmed blob to be skipped, got %v", err)
+	}
+}
+
+func TestRecordChecksum(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.RecordChecksum(context.Background(), "acc-1", "blob-1", "c3VtMQ=="); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	update := client.updates[0]
+	if aws.ToString(update.UpdateExpression) != "SET checksumSha256 = :checksum" || aws.ToString(update.ConditionExpression) != "#status = :pending" {
+		t.Errorf("unexpected update %+v", update)
+	}
+	if keyValue(update.ExpressionAttributeValues, ":checksum") != "c3VtMQ==" {
+		t.Errorf("unexpected checksum %v", update.ExpressionAttributeValues[":checksum"])
+	}
+
+	skipped := NewBlobStore(&mockDynamoDBClient{err: &types.ConditionalCheckFailedException{}}, "jmap-test")
+	if err := skipped.RecordChecksum(context.Background(), "acc-1", "blob-1", "c3VtMQ=="); err != nil {
+		t.Errorf("expected a confirmed blob to be skipped, got %v", err)
+	}
+}
+
+// pendingItem returns a gsi1 item of a pending allocation
+func pendingItem(pk, sk string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk":      &types.AttributeValueMemberS{Value: pk},
+		"sk":      &types.AttributeValueMemberS{Value: sk},
+		"s3Key":   &types.AttributeValueMemberS{Value: "key"},
+		"size":    &types.AttributeValueMemberN{Value: "42"},
+		"iamAuth": &types.AttributeValueMemberBOOL{Value: true},
+	}
+}
+
+func TestGetExpiredPendingAllocations_Paginates(t *testing.T) {
+	client := &mockDynamoDBClient{pages: []*dynamodb.QueryOutput{
+		{
+			Items:            []map[string]types.AttributeValue{pendingItem("ACCOUNT#acc-1", "BLOB#blob-1")},
+			LastEvaluatedKey: BlobKey("acc-1", "blob-1"),
+		},
+		{
+			Items: []map[string]types.AttributeValue{
+				pendingItem("ACCOUNT#acc-2", "META#"),
+				pendingItem("ACCOUNT#acc-2", "BLOB#blob-2"),
+			},
+		},
+	}}
+	s := NewBlobStore(client, "jmap-test")
+	cutoff := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	allocations, err := s.GetExpiredPendingAllocations(context.Background(), cutoff)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(allocations) != 2 || allocations[1].AccountID != "acc-2" || allocations[1].BlobID != "blob-2" {
+		t.Fatalf("unexpected allocations %+v", allocations)
+	}
+	if a := allocations[0]; a.S3Key != "key" || a.Size != 42 || !a.IAMAuth {
+		t.Errorf("unexpected allocation %+v", a)
+	}
+	if len(client.queries) != 2 || client.queries[1].ExclusiveStartKey == nil {
+		t.Fatalf("expected the second query to continue from the first, got %d queries", len(client.queries))
+	}
+	first := client.queries[0]
+	if aws.ToString(first.IndexName) != "gsi1" || keyValue(first.ExpressionAttributeValues, ":cutoff") != "EXPIRES#2026-01-01T12:00:00Z#" {
+		t.Errorf("unexpected query %+v", first)
+	}
+}
+
+func TestCleanupAllocation(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	s := NewBlobStore(client, "jmap-test")
+
+	if err := s.CleanupAllocation(context.Background(), "acc-1", "blob-1", 42, false); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	del := client.transaction.TransactItems[0].Delete
+	meta := client.transaction.TransactItems[1].Update
+	if keyValue(del.Key, "sk") != "BLOB#blob-1" || aws.ToString(del.ConditionExpression) != "#status = :pending" {
+		t.Errorf("unexpected delete %+v", del)
+	}
+	if aws.ToString(meta.UpdateExpression) != "ADD pendingAllocationsCount :negOne, quotaRemaining :size SET updatedAt = :now" {
+		t.Errorf("unexpected meta update %q", aws.ToString(meta.UpdateExpression))
+	}
+	if got, want := aws.ToString(client.transaction.ClientRequestToken), aws.ToString(RequestToken(OpCleanupAllocation, "acc-1", "blob-1")); got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestCleanupAllocation_Replayed(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: &types.IdempotentParameterMismatchException{}}, "jmap-test")
+
+	if err := s.CleanupAllocation(context.Background(), "acc-1", "blob-1", 42, false); !errors.Is(err, ErrNotPending) {
+		t.Errorf("expected ErrNotPending, got %v", err)
+	}
+}
+
+func TestCleanupAllocation_NotPending(t *testing.T) {
+	s := NewBlobStore(&mockDynamoDBClient{err: &types.TransactionCanceledException{
+		CancellationReasons: []types.CancellationReason{{Code: aws.String("ConditionalCheckFailed")}},
+	}}, "jmap-test")
+
+	err := s.CleanupAllocation(context.Background(), "acc-1", "blob-1", 42, true)
+	if !errors.Is(err, ErrNotPending) {
+		t.Errorf("expected ErrNotPending, got %v", err)
+	}
+}
@@ -0,0 +1,114 @@
+package store
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// BlobReader reads blob records
+type BlobReader interface {
+	GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error)
+}
+
+// BlobCache keeps recently read blob records in memory, in front of a
+// BlobReader, so a warm Lambda serving the same blobs repeatedly does not
+// read them from DynamoDB each time. It holds at most size records, evicting
+// the least recently used.
+//
+// A live record is reused for ttl, so a blob deleted elsewhere may still be
+// served from a warm Lambda for that long. A record marked deleted is kept
+// until evicted, as deletion is final. Blobs with no record, and records
+// still awaiting a scan verdict, are not cached, so a blob is found as soon
+// as its upload completes and an infected verdict takes effect at once.
+type BlobCache struct {
+	reader BlobReader
+	size   int
+	ttl    time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	entries map[blobKey]*list.Element
+	order   *list.List // most recently used first
+}
+
+// blobKey identifies a cached record
+type blobKey struct {
+	accountID string
+	blobID    string
+}
+
+// cachedBlob is a cached record and when it was read
+type cachedBlob struct {
+	key      blobKey
+	record   blobmeta.Record
+	loadedAt time.Time
+}
+
+// NewBlobCache creates a BlobCache of up to size records over reader
+func NewBlobCache(reader BlobReader, size int, ttl time.Duration) *BlobCache {
+	return &BlobCache{
+		reader:  reader,
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[blobKey]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// GetBlob returns a blob record from the cache, or from the reader if it is
+// not cached or has expired
+func (c *BlobCache) GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error) {
+	key := blobKey{accountID, blobID}
+	if record, ok := c.get(key); ok {
+		return record, nil
+	}
+
+	record, err := c.reader.GetBlob(ctx, accountID, blobID)
+	if err != nil || record == nil || record.ScanStatus == ScanPending {
+		return record, err
+	}
+	c.put(key, *record)
+	return record, nil
+}
+
+// get returns a copy of a cached record, dropping it if it has expired
+func (c *BlobCache) get(key blobKey) (*blobmeta.Record, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedBlob)
+	if entry.record.DeletedAt == "" && c.now().Sub(entry.loadedAt) >= c.ttl {
+		c.remove(elem)
+		return nil, false
+	}
+	c.order.MoveToFront(elem)
+	record := entry.record
+	return &record, true
+}
+
+// put caches a record, evicting the least recently used beyond size
+func (c *BlobCache) put(key blobKey, record blobmeta.Record) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.remove(elem)
+	}
+	c.entries[key] = c.order.PushFront(&cachedBlob{key: key, record: record, loadedAt: c.now()})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// remove drops a cache entry; the caller holds mu
+func (c *BlobCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.entries, elem.Value.(*cachedBlob).key)
+}
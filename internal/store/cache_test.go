@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/blobmeta"
+)
+
+// countingReader returns records from a map, counting reads
+type countingReader struct {
+	records map[string]*blobmeta.Record
+	err     error
+	reads   int
+}
+
+func (r *countingReader) GetBlob(ctx context.Context, accountID, blobID string) (*blobmeta.Record, error) {
+	r.reads++
+	if r.err != nil {
+		return nil, r.err
+	}
+	record, ok := r.records[accountID+"/"+blobID]
+	if !ok {
+		return nil, nil
+	}
+	copied := *record
+	return &copied, nil
+}
+
+func newTestBlobCache(reader BlobReader, size int, now *time.Time) *BlobCache {
+	c := NewBlobCache(reader, size, 30*time.Second)
+	c.now = func() time.Time { return *now }
+	return c
+}
+
+func TestBlobCache_ReusesUntilExpiry(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{
+		"acc-1/blob-1": {AccountID: "acc-1", BlobID: "blob-1", Size: 42},
+	}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 10, &now)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		record, err := c.GetBlob(ctx, "acc-1", "blob-1")
+		if err != nil || record == nil || record.Size != 42 {
+			t.Fatalf("read %d: unexpected %+v, %v", i, record, err)
+		}
+	}
+	if reader.reads != 1 {
+		t.Errorf("expected 1 read, got %d", reader.reads)
+	}
+
+	now = now.Add(30 * time.Second)
+	if _, err := c.GetBlob(ctx, "acc-1", "blob-1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reader.reads != 2 {
+		t.Errorf("expected an expired record to be read again, got %d reads", reader.reads)
+	}
+}
+
+func TestBlobCache_KeepsDeletedRecords(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{
+		"acc-1/blob-1": {AccountID: "acc-1", BlobID: "blob-1", DeletedAt: "2026-01-01T00:00:00Z"},
+	}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 10, &now)
+
+	c.GetBlob(context.Background(), "acc-1", "blob-1")
+	now = now.Add(time.Hour)
+	record, _ := c.GetBlob(context.Background(), "acc-1", "blob-1")
+	if record == nil || record.DeletedAt == "" || reader.reads != 1 {
+		t.Errorf("expected the deleted record from the cache, got %+v after %d reads", record, reader.reads)
+	}
+}
+
+func TestBlobCache_DoesNotCacheMissesOrErrors(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 10, &now)
+	ctx := context.Background()
+
+	c.GetBlob(ctx, "acc-1", "blob-1")
+	reader.records["acc-1/blob-1"] = &blobmeta.Record{AccountID: "acc-1", BlobID: "blob-1"}
+	if record, _ := c.GetBlob(ctx, "acc-1", "blob-1"); record == nil {
+		t.Error("expected a blob created after a miss to be found")
+	}
+
+	reader.err = errors.New("throttled")
+	if _, err := c.GetBlob(ctx, "acc-1", "blob-2"); err == nil {
+		t.Error("expected the reader's error")
+	}
+}
+
+func TestBlobCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{
+		"acc-1/a": {BlobID: "a"},
+		"acc-1/b": {BlobID: "b"},
+		"acc-1/c": {BlobID: "c"},
+	}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 2, &now)
+	ctx := context.Background()
+
+	c.GetBlob(ctx, "acc-1", "a")
+	c.GetBlob(ctx, "acc-1", "b")
+	c.GetBlob(ctx, "acc-1", "a") // a is now most recently used
+	c.GetBlob(ctx, "acc-1", "c") // evicts b
+	reads := reader.reads
+
+	c.GetBlob(ctx, "acc-1", "a")
+	c.GetBlob(ctx, "acc-1", "c")
+	if reader.reads != reads {
+		t.Errorf("expected a and c to be cached")
+	}
+	c.GetBlob(ctx, "acc-1", "b")
+	if reader.reads != reads+1 {
+		t.Errorf("expected b to have been evicted")
+	}
+}
+
+func TestBlobCache_DoesNotCacheScanPending(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{"acc-1/blob-1": {BlobID: "blob-1", ScanStatus: ScanPending}}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 10, &now)
+	ctx := context.Background()
+
+	c.GetBlob(ctx, "acc-1", "blob-1")
+	reader.records["acc-1/blob-1"] = &blobmeta.Record{BlobID: "blob-1", ScanStatus: ScanInfected}
+	record, _ := c.GetBlob(ctx, "acc-1", "blob-1")
+	if reader.reads != 2 || record.ScanStatus != ScanInfected {
+		t.Errorf("expected the verdict to be read at once, got %q after %d reads", record.ScanStatus, reader.reads)
+	}
+}
+
+func TestBlobCache_ReturnsCopies(t *testing.T) {
+	reader := &countingReader{records: map[string]*blobmeta.Record{"acc-1/blob-1": {BlobID: "blob-1", Size: 42}}}
+	now := time.Unix(1700000000, 0)
+	c := newTestBlobCache(reader, 10, &now)
+	ctx := context.Background()
+
+	first, _ := c.GetBlob(ctx, "acc-1", "blob-1")
+	first.Size = 0
+	if second, _ := c.GetBlob(ctx, "acc-1", "blob-1"); second.Size != 42 {
+		t.Errorf("expected the cached record to be unchanged, got %+v", second)
+	}
+}
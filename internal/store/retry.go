@@ -0,0 +1,208 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// Default retry policy of a RetryClient
+const (
+	defaultMaxAttempts = 4
+	defaultBaseDelay   = 50 * time.Millisecond
+	defaultMaxDelay    = time.Second
+)
+
+// API is the DynamoDB API a RetryClient wraps. *dynamodb.Client satisfies it.
+type API interface {
+	DynamoDBClient
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+}
+
+// RetryClient retries DynamoDB requests that were throttled or lost a
+// conflict with a transaction, with exponential backoff and full jitter, so
+// that brief contention does not reach callers as a failure. Transactions are
+// retried only when every cancellation reason is transient; a failed
+// condition is returned at once.
+//
+// The SDK's own retryer already retries throttled requests a few times in
+// quick succession; this adds a longer, bounded backoff on top, and covers
+// transaction conflicts, which the SDK does not retry.
+type RetryClient struct {
+	client      API
+	maxAttempts int
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	sleep       func(ctx context.Context, d time.Duration) error
+}
+
+// NewRetryClient wraps client with the default retry policy
+func NewRetryClient(client API) *RetryClient {
+	return &RetryClient{
+		client:      client,
+		maxAttempts: defaultMaxAttempts,
+		baseDelay:   defaultBaseDelay,
+		maxDelay:    defaultMaxDelay,
+		sleep:       sleepContext,
+	}
+}
+
+// WithRetry sets how many times a request is attempted, and the backoff
+// ceiling before the first retry, which doubles for each later retry up to
+// maxDelay
+func (c *RetryClient) WithRetry(maxAttempts int, baseDelay, maxDelay time.Duration) *RetryClient {
+	c.maxAttempts = maxAttempts
+	c.baseDelay = baseDelay
+	c.maxDelay = maxDelay
+	return c
+}
+
+// GetItem calls GetItem, retrying transient failures
+func (c *RetryClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.GetItemOutput, error) {
+		return c.client.GetItem(ctx, params, optFns...)
+	})
+}
+
+// BatchGetItem calls BatchGetItem, retrying transient failures. Keys returned
+// unprocessed are left to the caller.
+func (c *RetryClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.BatchGetItemOutput, error) {
+		return c.client.BatchGetItem(ctx, params, optFns...)
+	})
+}
+
+// PutItem calls PutItem, retrying transient failures
+func (c *RetryClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.PutItemOutput, error) {
+		return c.client.PutItem(ctx, params, optFns...)
+	})
+}
+
+// UpdateItem calls UpdateItem, retrying transient failures
+func (c *RetryClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.UpdateItemOutput, error) {
+		return c.client.UpdateItem(ctx, params, optFns...)
+	})
+}
+
+// DeleteItem calls DeleteItem, retrying transient failures
+func (c *RetryClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.DeleteItemOutput, error) {
+		return c.client.DeleteItem(ctx, params, optFns...)
+	})
+}
+
+// Query calls Query, retrying transient failures
+func (c *RetryClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.QueryOutput, error) {
+		return c.client.Query(ctx, params, optFns...)
+	})
+}
+
+// Scan calls Scan, retrying transient failures
+func (c *RetryClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return withRetry(ctx, c, isTransient, func() (*dynamodb.ScanOutput, error) {
+		return c.client.Scan(ctx, params, optFns...)
+	})
+}
+
+// TransactWriteItems calls TransactWriteItems, retrying transient failures
+// and transactions cancelled only by conflicts or throttling
+func (c *RetryClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	return withRetry(ctx, c, isTransientTransaction, func() (*dynamodb.TransactWriteItemsOutput, error) {
+		return c.client.TransactWriteItems(ctx, params, optFns...)
+	})
+}
+
+// withRetry makes call until it succeeds, fails with an error retryable does
+// not accept, or the attempts are exhausted, returning the last result
+func withRetry[T any](ctx context.Context, c *RetryClient, retryable func(error) bool, call func() (T, error)) (T, error) {
+	for attempt := 1; ; attempt++ {
+		out, err := call()
+		if err == nil || attempt >= c.maxAttempts || !retryable(err) {
+			return out, err
+		}
+		if sleepErr := c.sleep(ctx, backoff(c.baseDelay, c.maxDelay, attempt)); sleepErr != nil {
+			return out, err
+		}
+	}
+}
+
+// backoff returns a random delay before the retry following attempt, up to
+// baseDelay doubled for each earlier retry and capped at maxDelay
+func backoff(baseDelay, maxDelay time.Duration, attempt int) time.Duration {
+	ceiling := maxDelay
+	if shift := attempt - 1; shift < 30 {
+		if d := baseDelay << shift; d < ceiling {
+			ceiling = d
+		}
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling + 1)
+}
+
+// transientCodes are the error codes of requests that were not applied and
+// may succeed if sent again
+var transientCodes = map[string]bool{
+	"ProvisionedThroughputExceededException": true,
+	"ThrottlingException":                    true,
+	"RequestLimitExceeded":                   true,
+	"TransactionConflictException":           true,
+	"InternalServerError":                    true,
+}
+
+// isTransient reports whether err is throttling, a conflict with a
+// transaction, or an internal error
+func isTransient(err error) bool {
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && transientCodes[apiErr.ErrorCode()]
+}
+
+// transientReasons are the cancellation reasons of a transaction that may
+// succeed if sent again
+var transientReasons = map[string]bool{
+	"None":                          true,
+	"TransactionConflict":           true,
+	"ProvisionedThroughputExceeded": true,
+	"ThrottlingError":               true,
+}
+
+// isTransientTransaction reports whether err is transient, or a transaction
+// cancelled for transient reasons only
+func isTransientTransaction(err error) bool {
+	var txCanceled *types.TransactionCanceledException
+	if !errors.As(err, &txCanceled) {
+		return isTransient(err)
+	}
+	transient := false
+	for _, reason := range txCanceled.CancellationReasons {
+		if reason.Code == nil {
+			continue
+		}
+		if !transientReasons[*reason.Code] {
+			return false
+		}
+		transient = transient || *reason.Code != "None"
+	}
+	return transient
+}
+
+// sleepContext waits for d, returning early if ctx is done
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
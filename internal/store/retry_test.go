@@ -0,0 +1,178 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/smithy-go"
+)
+
+// flakyClient fails its first calls with errs, then succeeds
+type flakyClient struct {
+	mockDynamoDBClient
+	errs  []error
+	calls int
+}
+
+func (f *flakyClient) next() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{}, nil
+}
+
+func (f *flakyClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &dynamodb.ScanOutput{}, nil
+}
+
+func (f *flakyClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+// newTestRetryClient returns a RetryClient over client that records its
+// backoff delays instead of sleeping
+func newTestRetryClient(client API, delays *[]time.Duration) *RetryClient {
+	c := NewRetryClient(client)
+	c.sleep = func(ctx context.Context, d time.Duration) error {
+		*delays = append(*delays, d)
+		return nil
+	}
+	return c
+}
+
+func throttled() error {
+	return &types.ProvisionedThroughputExceededException{Message: aws.String("slow down")}
+}
+
+func cancelled(codes ...string) error {
+	reasons := make([]types.CancellationReason, len(codes))
+	for i, code := range codes {
+		reasons[i] = types.CancellationReason{Code: aws.String(code)}
+	}
+	return &types.TransactionCanceledException{CancellationReasons: reasons}
+}
+
+func TestRetryClient_RetriesThrottling(t *testing.T) {
+	client := &flakyClient{errs: []error{throttled(), &smithy.GenericAPIError{Code: "ThrottlingException"}}}
+	var delays []time.Duration
+	c := newTestRetryClient(client, &delays)
+
+	if _, err := c.GetItem(context.Background(), &dynamodb.GetItemInput{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.calls != 3 || len(delays) != 2 {
+		t.Fatalf("expected 3 calls and 2 waits, got %d and %v", client.calls, delays)
+	}
+	for i, d := range delays {
+		if ceiling := defaultBaseDelay << i; d < 0 || d > ceiling {
+			t.Errorf("delay %d = %v, want at most %v", i, d, ceiling)
+		}
+	}
+}
+
+func TestRetryClient_GivesUp(t *testing.T) {
+	client := &flakyClient{errs: []error{throttled(), throttled(), throttled(), throttled(), throttled()}}
+	var delays []time.Duration
+	c := newTestRetryClient(client, &delays)
+
+	_, err := c.Scan(context.Background(), &dynamodb.ScanInput{})
+	var exceeded *types.ProvisionedThroughputExceededException
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("expected the last error, got %v", err)
+	}
+	if client.calls != defaultMaxAttempts {
+		t.Errorf("expected %d calls, got %d", defaultMaxAttempts, client.calls)
+	}
+}
+
+func TestRetryClient_DoesNotRetryOtherErrors(t *testing.T) {
+	for _, err := range []error{
+		errors.New("network down"),
+		&types.ConditionalCheckFailedException{},
+		&types.ResourceNotFoundException{},
+	} {
+		client := &flakyClient{errs: []error{err}}
+		var delays []time.Duration
+		c := newTestRetryClient(client, &delays)
+
+		if _, got := c.GetItem(context.Background(), &dynamodb.GetItemInput{}); got != err {
+			t.Errorf("expected %v, got %v", err, got)
+		}
+		if client.calls != 1 {
+			t.Errorf("%v: expected 1 call, got %d", err, client.calls)
+		}
+	}
+}
+
+func TestRetryClient_Transactions(t *testing.T) {
+	tests := []struct {
+		name  string
+		err   error
+		retry bool
+	}{
+		{"conflict", cancelled("None", "TransactionConflict"), true},
+		{"throttled reason", cancelled("ThrottlingError"), true},
+		{"throttled request", throttled(), true},
+		{"condition failed", cancelled("ConditionalCheckFailed", "TransactionConflict"), false},
+		{"validation", cancelled("ValidationError"), false},
+		{"no reasons", cancelled(), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &flakyClient{errs: []error{tt.err}}
+			var delays []time.Duration
+			c := newTestRetryClient(client, &delays)
+
+			_, err := c.TransactWriteItems(context.Background(), &dynamodb.TransactWriteItemsInput{})
+			if tt.retry && (err != nil || client.calls != 2) {
+				t.Errorf("expected a successful retry, got %v after %d calls", err, client.calls)
+			}
+			if !tt.retry && (err == nil || client.calls != 1) {
+				t.Errorf("expected no retry, got %v after %d calls", err, client.calls)
+			}
+		})
+	}
+}
+
+func TestRetryClient_StopsWhenContextDone(t *testing.T) {
+	client := &flakyClient{errs: []error{throttled(), throttled()}}
+	c := NewRetryClient(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := c.GetItem(ctx, &dynamodb.GetItemInput{}); err == nil {
+		t.Fatal("expected an error")
+	}
+	if client.calls != 1 {
+		t.Errorf("expected 1 call, got %d", client.calls)
+	}
+}
+
+func TestRetryClient_BackoffCapped(t *testing.T) {
+	for attempt := 1; attempt <= 64; attempt++ {
+		if d := backoff(100*time.Millisecond, 300*time.Millisecond, attempt); d < 0 || d > 300*time.Millisecond {
+			t.Errorf("backoff(%d) = %v", attempt, d)
+		}
+	}
+}
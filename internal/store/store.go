@@ -0,0 +1,177 @@
+// Package store reads and writes the blob records of the core table: BLOB#
+// records, the allocation attributes kept on them while they are pending,
+// and the account META# counters that change alongside them. The blob
+// Lambdas share it so that key formats, attribute names and error handling
+// stay the same across them; each Lambda still declares the narrow
+// interface it needs, which a BlobStore satisfies.
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/google/uuid"
+)
+
+// Key prefixes and fixed keys of the core table
+const (
+	AccountPrefix = "ACCOUNT#"
+	BlobPrefix    = "BLOB#"
+	MetaSK        = "META#"
+)
+
+// Blob statuses, as stored in the status attribute of allocated blobs.
+// Blobs uploaded directly have no status.
+const (
+	StatusPending   = "pending"
+	StatusConfirmed = "confirmed"
+)
+
+// Scan statuses, as stored in the scanStatus attribute of blobs confirmed
+// while scanning is enabled. Blobs confirmed without scanning have none.
+const (
+	ScanPending  = "pending"
+	ScanClean    = "clean"
+	ScanInfected = "infected"
+)
+
+// Pending allocations are indexed on gsi1 under PendingGSI1PK, sorted by
+// EXPIRES#{urlExpiresAt}#{accountId}#{blobId}
+const (
+	GSI1Name      = "gsi1"
+	PendingGSI1PK = "PENDING"
+	ExpiresPrefix = "EXPIRES#"
+)
+
+// Blobs allocated with indexed metadata are indexed on gsi2 under
+// INDEXED#{accountId}#{key}#{value}, sorted by the blob's sort key
+const (
+	GSI2Name      = "gsi2"
+	IndexedPrefix = "INDEXED#"
+)
+
+// Operations a transaction's ClientRequestToken is derived from
+const (
+	OpAllocate          = "allocate"
+	OpAllocateGrace     = "allocate-grace"
+	OpReserve           = "reserve"
+	OpConfirm           = "confirm"
+	OpCleanupAllocation = "cleanup-allocation"
+	OpDelete            = "delete"
+)
+
+// tokenNamespace is the UUID namespace of ClientRequestTokens
+var tokenNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/jarrod-lowe/jmap-service-core/client-request-token"))
+
+// ErrNotPending is returned when a write that expects a pending blob finds
+// the blob confirmed or gone
+var ErrNotPending = errors.New("blob is not pending")
+
+// ErrAlreadyDeleted is returned when a write that expects a live blob finds
+// it already marked deleted, or a delete finds it already removed
+var ErrAlreadyDeleted = errors.New("blob is already deleted")
+
+// ErrBlobNotFound is returned when a write that expects a live blob finds
+// no record, or one marked deleted
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrOverQuota is returned when an account has too little quota remaining
+// for a blob
+var ErrOverQuota = errors.New("insufficient quota remaining")
+
+// ErrAccountNotProvisioned is returned when an account has no META# record
+var ErrAccountNotProvisioned = errors.New("account is not provisioned")
+
+// DynamoDBClient defines the DynamoDB operations a BlobStore uses
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error)
+	TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error)
+}
+
+// AccountPK returns the partition key of an account's records
+func AccountPK(accountID string) string {
+	return AccountPrefix + accountID
+}
+
+// BlobSK returns the sort key of a blob record
+func BlobSK(blobID string) string {
+	return BlobPrefix + blobID
+}
+
+// BlobKey returns the primary key of a blob record
+func BlobKey(accountID, blobID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: BlobSK(blobID)},
+	}
+}
+
+// MetaKey returns the primary key of an account META# record
+func MetaKey(accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: MetaSK},
+	}
+}
+
+// IndexedGSI2PK returns the gsi2 partition key of an account's blobs
+// allocated with an indexed metadata key and value. Keys cannot hold "#",
+// so the value is everything after the third one.
+func IndexedGSI2PK(accountID, key, value string) string {
+	return IndexedPrefix + accountID + "#" + key + "#" + value
+}
+
+// ParseBlobKey returns the account and blob IDs of a blob record's pk and
+// sk, and false if they are not a blob record's keys
+func ParseBlobKey(pk, sk string) (accountID, blobID string, ok bool) {
+	accountID, okPK := strings.CutPrefix(pk, AccountPrefix)
+	blobID, okSK := strings.CutPrefix(sk, BlobPrefix)
+	if !okPK || !okSK || accountID == "" || blobID == "" {
+		return "", "", false
+	}
+	return accountID, blobID, true
+}
+
+// RequestToken returns the ClientRequestToken of a transaction. It is the
+// same for every attempt at operation on the record identified by ids, so a
+// retry of a transaction DynamoDB already applied, within its ten minute
+// idempotency window, succeeds without applying it again.
+func RequestToken(operation string, ids ...string) *string {
+	name := operation + "#" + strings.Join(ids, "#")
+	return aws.String(uuid.NewSHA1(tokenNamespace, []byte(name)).String())
+}
+
+// isReplay reports whether err is a transaction DynamoDB already applied
+// under the same ClientRequestToken with other parameters, as when a retried
+// Lambda invocation recomputes a timestamp
+func isReplay(err error) bool {
+	var mismatch *types.IdempotentParameterMismatchException
+	return errors.As(err, &mismatch)
+}
+
+// isConditionFailure reports whether err is a failed condition, on its own
+// or as a cancellation reason of a transaction
+func isConditionFailure(err error) bool {
+	var conditionFailed *types.ConditionalCheckFailedException
+	if errors.As(err, &conditionFailed) {
+		return true
+	}
+	var txCanceled *types.TransactionCanceledException
+	if errors.As(err, &txCanceled) {
+		for _, reason := range txCanceled.CancellationReasons {
+			if reason.Code != nil && *reason.Code == "ConditionalCheckFailed" {
+				return true
+			}
+		}
+	}
+	return false
+}
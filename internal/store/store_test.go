@@ -0,0 +1,164 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// mockDynamoDBClient records the requests it is sent and answers them from
+// preset results
+type mockDynamoDBClient struct {
+	item        map[string]types.AttributeValue
+	pages       []*dynamodb.QueryOutput
+	batches     []*dynamodb.BatchGetItemOutput
+	err         error
+	txErr       error
+	gets        []*dynamodb.GetItemInput
+	batchGets   []*dynamodb.BatchGetItemInput
+	puts        []*dynamodb.PutItemInput
+	updates     []*dynamodb.UpdateItemInput
+	deletes     []*dynamodb.DeleteItemInput
+	queries     []dynamodb.QueryInput
+	transaction *dynamodb.TransactWriteItemsInput
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.gets = append(m.gets, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockDynamoDBClient) BatchGetItem(ctx context.Context, params *dynamodb.BatchGetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.BatchGetItemOutput, error) {
+	m.batchGets = append(m.batchGets, params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	batch := m.batches[0]
+	m.batches = m.batches[1:]
+	return batch, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.puts = append(m.puts, params)
+	return &dynamodb.PutItemOutput{}, m.err
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.updates = append(m.updates, params)
+	return &dynamodb.UpdateItemOutput{}, m.err
+}
+
+func (m *mockDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	m.deletes = append(m.deletes, params)
+	return &dynamodb.DeleteItemOutput{}, m.err
+}
+
+func (m *mockDynamoDBClient) Query(ctx context.Context, params *dynamodb.QueryInput, optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	m.queries = append(m.queries, *params)
+	if m.err != nil {
+		return nil, m.err
+	}
+	page := m.pages[0]
+	m.pages = m.pages[1:]
+	return page, nil
+}
+
+func (m *mockDynamoDBClient) TransactWriteItems(ctx context.Context, params *dynamodb.TransactWriteItemsInput, optFns ...func(*dynamodb.Options)) (*dynamodb.TransactWriteItemsOutput, error) {
+	m.transaction = params
+	if m.txErr != nil {
+		return nil, m.txErr
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, m.err
+}
+
+// keyValue returns the string value of a key attribute
+func keyValue(key map[string]types.AttributeValue, name string) string {
+	if s, ok := key[name].(*types.AttributeValueMemberS); ok {
+		return s.Value
+	}
+	return ""
+}
+
+func TestKeys(t *testing.T) {
+	blob := BlobKey("acc-1", "blob-1")
+	if keyValue(blob, "pk") != "ACCOUNT#acc-1" || keyValue(blob, "sk") != "BLOB#blob-1" {
+		t.Errorf("unexpected blob key %v", blob)
+	}
+	meta := MetaKey("acc-1")
+	if keyValue(meta, "pk") != "ACCOUNT#acc-1" || keyValue(meta, "sk") != "META#" {
+		t.Errorf("unexpected meta key %v", meta)
+	}
+	if got := IndexedGSI2PK("acc-1", "correlationId", "a#b"); got != "INDEXED#acc-1#correlationId#a#b" {
+		t.Errorf("unexpected indexed gsi2pk %q", got)
+	}
+}
+
+func TestParseBlobKey(t *testing.T) {
+	tests := []struct {
+		pk, sk    string
+		accountID string
+		blobID    string
+		ok        bool
+	}{
+		{"ACCOUNT#acc-1", "BLOB#blob-1", "acc-1", "blob-1", true},
+		{"ACCOUNT#acc-1", "META#", "", "", false},
+		{"USER#acc-1", "BLOB#blob-1", "", "", false},
+		{"ACCOUNT#", "BLOB#blob-1", "", "", false},
+		{"ACCOUNT#acc-1", "BLOB#", "", "", false},
+	}
+	for _, tt := range tests {
+		accountID, blobID, ok := ParseBlobKey(tt.pk, tt.sk)
+		if accountID != tt.accountID || blobID != tt.blobID || ok != tt.ok {
+			t.Errorf("ParseBlobKey(%q, %q) = %q, %q, %v", tt.pk, tt.sk, accountID, blobID, ok)
+		}
+	}
+}
+
+func TestIsConditionFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"other", errors.New("throttled"), false},
+		{"conditional check", &types.ConditionalCheckFailedException{}, true},
+		{"cancelled by condition", &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{{Code: aws.String("None")}, {Code: aws.String("ConditionalCheckFailed")}},
+		}, true},
+		{"cancelled by conflict", &types.TransactionCanceledException{
+			CancellationReasons: []types.CancellationReason{{Code: aws.String("TransactionConflict")}},
+		}, false},
+	}
+	for _, tt := range tests {
+		if got := isConditionFailure(tt.err); got != tt.want {
+			t.Errorf("%s: isConditionFailure = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequestToken(t *testing.T) {
+	token := aws.ToString(RequestToken(OpConfirm, "acc-1", "blob-1"))
+	if len(token) != 36 {
+		t.Errorf("expected a 36 character token, got %q", token)
+	}
+	if again := aws.ToString(RequestToken(OpConfirm, "acc-1", "blob-1")); again != token {
+		t.Errorf("expected the same token, got %q and %q", token, again)
+	}
+	for _, other := range []*string{
+		RequestToken(OpCleanupAllocation, "acc-1", "blob-1"),
+		RequestToken(OpConfirm, "acc-1", "blob-2"),
+		RequestToken(OpConfirm, "acc-2", "blob-1"),
+	} {
+		if aws.ToString(other) == token {
+			t.Errorf("expected a different token than %q", token)
+		}
+	}
+}
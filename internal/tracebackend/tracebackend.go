@@ -0,0 +1,77 @@
+// Package tracebackend selects where traces are sent. awsinit always starts
+// the X-Ray tracer provider, which exports through the ADOT collector; with
+// TRACING_BACKEND=otlp, Configure replaces it with one exporting straight to
+// a generic OTLP endpoint, such as Jaeger, Tempo or Honeycomb.
+package tracebackend
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	lambdadetector "go.opentelemetry.io/contrib/detectors/aws/lambda"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+)
+
+// BackendEnv selects the tracing backend
+const BackendEnv = "TRACING_BACKEND"
+
+// Supported backends
+const (
+	BackendXRay = "xray"
+	BackendOTLP = "otlp"
+)
+
+// Configure switches result to the backend named by TRACING_BACKEND. An
+// unset or "xray" backend leaves the X-Ray provider in place. For "otlp", the
+// endpoint and headers come from the standard OTEL_EXPORTER_OTLP_TRACES_*
+// variables, which take precedence over the collector endpoint the functions
+// are configured with. Call it after awsinit.Init and before result.Start.
+func Configure(ctx context.Context, result *awsinit.Result) error {
+	switch backend := os.Getenv(BackendEnv); backend {
+	case "", BackendXRay:
+		return nil
+	case BackendOTLP:
+		provider, err := newOTLPProvider(ctx)
+		if err != nil {
+			return err
+		}
+		// The X-Ray provider only holds the cold start span, which is
+		// dropped rather than sent to a collector that may not exist
+		previous := result.TracerProvider
+		result.TracerProvider = provider
+		otel.SetTracerProvider(provider)
+		if previous != nil {
+			_ = previous.Shutdown(ctx)
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s must be %q or %q, got %q", BackendEnv, BackendXRay, BackendOTLP, backend)
+	}
+}
+
+// newOTLPProvider builds a provider exporting over OTLP gRPC. Spans keep W3C
+// trace IDs, since the backend is not X-Ray.
+func newOTLPProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracegrpc.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithDetectors(lambdadetector.NewResourceDetector()),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to detect trace resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	), nil
+}
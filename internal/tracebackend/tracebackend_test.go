@@ -0,0 +1,55 @@
+package tracebackend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jarrod-lowe/jmap-service-libs/awsinit"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestConfigure_XRayByDefault(t *testing.T) {
+	for _, backend := range []string{"", BackendXRay} {
+		t.Setenv(BackendEnv, backend)
+		original := sdktrace.NewTracerProvider()
+		result := &awsinit.Result{TracerProvider: original}
+
+		if err := Configure(context.Background(), result); err != nil {
+			t.Fatalf("backend %q: unexpected error: %v", backend, err)
+		}
+		if result.TracerProvider != original {
+			t.Errorf("backend %q: expected X-Ray provider to be kept", backend)
+		}
+	}
+}
+
+func TestConfigure_OTLP(t *testing.T) {
+	t.Setenv(BackendEnv, BackendOTLP)
+	t.Setenv("AWS_LAMBDA_FUNCTION_NAME", "jmap-api")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://localhost:4317")
+	original := sdktrace.NewTracerProvider()
+	result := &awsinit.Result{TracerProvider: original}
+	t.Cleanup(func() { otel.SetTracerProvider(original) })
+
+	if err := Configure(context.Background(), result); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer func() { _ = result.TracerProvider.Shutdown(context.Background()) }()
+
+	if result.TracerProvider == original {
+		t.Fatal("expected provider to be replaced")
+	}
+	if otel.GetTracerProvider() != result.TracerProvider {
+		t.Error("expected replacement to be the global provider")
+	}
+}
+
+func TestConfigure_UnknownBackend(t *testing.T) {
+	t.Setenv(BackendEnv, "zipkin")
+	result := &awsinit.Result{TracerProvider: sdktrace.NewTracerProvider()}
+
+	if err := Configure(context.Background(), result); err == nil {
+		t.Error("expected error for unknown backend")
+	}
+}
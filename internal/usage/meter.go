@@ -0,0 +1,221 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/loglevel"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+var logger = loglevel.New()
+
+// listPageSize is the number of META# records requested per scan page
+const listPageSize = 100
+
+// AccountLister pages through account META# records
+type AccountLister interface {
+	ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error)
+}
+
+// CounterStore reads usage counters and metering state
+type CounterStore interface {
+	GetCounters(ctx context.Context, accountID, period string) (Counters, error)
+	GetMeteringState(ctx context.Context, accountID string) (MeteringState, error)
+	PutMeteringState(ctx context.Context, accountID string, state MeteringState) error
+}
+
+// EventPublisher publishes events to subscribed plugins
+type EventPublisher interface {
+	Publish(ctx context.Context, payload publisher.EventPayload) error
+}
+
+// Meter aggregates each account's usage into usage.report events, and
+// usage.threshold events when stored bytes cross a share of the quota
+type Meter struct {
+	Accounts  AccountLister
+	Usage     CounterStore
+	Publisher EventPublisher
+	// Thresholds are percentages of quota, in ascending order
+	Thresholds []int
+	Now        func() time.Time
+}
+
+// Summary counts the outcome of a metering run
+type Summary struct {
+	Accounts int
+	Failed   int
+}
+
+// ParseThresholds parses a comma-separated list of quota percentages, e.g.
+// "80,100", into ascending order. An empty string yields no thresholds.
+func ParseThresholds(value string) ([]int, error) {
+	var thresholds []int
+	if value == "" {
+		return thresholds, nil
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		percent, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || percent <= 0 {
+			return nil, fmt.Errorf("invalid usage threshold %q", part)
+		}
+		thresholds = append(thresholds, percent)
+	}
+	sort.Ints(thresholds)
+	return thresholds, nil
+}
+
+// Run meters every account. A failure for one account is logged and the run
+// continues; an error is returned at the end if any account failed.
+func (m *Meter) Run(ctx context.Context) (Summary, error) {
+	var summary Summary
+	cursor := ""
+
+	for {
+		metas, next, err := m.Accounts.ListMeta(ctx, listPageSize, cursor)
+		if err != nil {
+			return summary, fmt.Errorf("failed to list accounts: %w", err)
+		}
+
+		for _, meta := range metas {
+			summary.Accounts++
+			if err := m.meterAccount(ctx, meta); err != nil {
+				summary.Failed++
+				logger.ErrorContext(ctx, "Failed to meter account",
+					slog.String("account_id", meta.AccountID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	if summary.Failed > 0 {
+		return summary, fmt.Errorf("failed to meter %d of %d accounts", summary.Failed, summary.Accounts)
+	}
+	return summary, nil
+}
+
+// meterAccount reports the current period to date, finalises the previous
+// period once, and reports newly crossed quota thresholds
+func (m *Meter) meterAccount(ctx context.Context, meta account.Meta) error {
+	now := m.now()
+	period := Period(now)
+	previous := Period(now.Add(-24 * time.Hour))
+
+	state, err := m.Usage.GetMeteringState(ctx, meta.AccountID)
+	if err != nil {
+		return fmt.Errorf("failed to read metering state: %w", err)
+	}
+	updated := state
+
+	if state.LastFinalPeriod < previous {
+		counters, err := m.Usage.GetCounters(ctx, meta.AccountID, previous)
+		if err != nil {
+			return fmt.Errorf("failed to read usage: %w", err)
+		}
+		if err := m.publish(ctx, now, meta.AccountID, reportData(meta, previous, counters, true)); err != nil {
+			return err
+		}
+		updated.LastFinalPeriod = previous
+	}
+
+	counters, err := m.Usage.GetCounters(ctx, meta.AccountID, period)
+	if err != nil {
+		return fmt.Errorf("failed to read usage: %w", err)
+	}
+	if err := m.publish(ctx, now, meta.AccountID, reportData(meta, period, counters, false)); err != nil {
+		return err
+	}
+
+	// Thresholds are re-armed when usage falls back below them
+	crossed := m.crossedThreshold(meta)
+	if crossed > state.LastThreshold {
+		payload := publisher.EventPayload{
+			EventType:  publisher.EventUsageThreshold,
+			OccurredAt: now.UTC().Format(time.RFC3339),
+			AccountID:  meta.AccountID,
+			Data: map[string]any{
+				"thresholdPercent": crossed,
+				"storedBytes":      storedBytes(meta),
+				"quotaBytes":       meta.QuotaBytes,
+			},
+		}
+		if err := m.Publisher.Publish(ctx, payload); err != nil {
+			return fmt.Errorf("failed to publish usage.threshold: %w", err)
+		}
+	}
+	updated.LastThreshold = crossed
+
+	if updated != state {
+		if err := m.Usage.PutMeteringState(ctx, meta.AccountID, updated); err != nil {
+			return fmt.Errorf("failed to save metering state: %w", err)
+		}
+	}
+	return nil
+}
+
+// publish sends a usage.report event
+func (m *Meter) publish(ctx context.Context, now time.Time, accountID string, data map[string]any) error {
+	err := m.Publisher.Publish(ctx, publisher.EventPayload{
+		EventType:  publisher.EventUsageReport,
+		OccurredAt: now.UTC().Format(time.RFC3339),
+		AccountID:  accountID,
+		Data:       data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish usage.report: %w", err)
+	}
+	return nil
+}
+
+// crossedThreshold returns the highest threshold at or below the account's
+// stored share of its quota, or zero if none is reached
+func (m *Meter) crossedThreshold(meta account.Meta) int {
+	if meta.QuotaBytes <= 0 {
+		return 0
+	}
+	percent := storedBytes(meta) * 100 / meta.QuotaBytes
+	crossed := 0
+	for _, threshold := range m.Thresholds {
+		if percent >= int64(threshold) {
+			crossed = threshold
+		}
+	}
+	return crossed
+}
+
+func (m *Meter) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// storedBytes is the account's usage including reserved allocations
+func storedBytes(meta account.Meta) int64 {
+	return meta.QuotaBytes - meta.QuotaRemaining
+}
+
+// reportData builds the data of a usage.report event
+func reportData(meta account.Meta, period string, counters Counters, final bool) map[string]any {
+	return map[string]any{
+		"period":        period,
+		"final":         final,
+		"storedBytes":   storedBytes(meta),
+		"quotaBytes":    meta.QuotaBytes,
+		"downloadBytes": counters.DownloadBytes,
+		"methodCalls":   counters.MethodCalls,
+	}
+}
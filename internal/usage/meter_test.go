@@ -0,0 +1,192 @@
+package usage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jarrod-lowe/jmap-service-core/internal/account"
+	"github.com/jarrod-lowe/jmap-service-core/internal/publisher"
+)
+
+type mockAccountLister struct {
+	pages [][]account.Meta
+}
+
+func (m *mockAccountLister) ListMeta(ctx context.Context, limit int32, cursor string) ([]account.Meta, string, error) {
+	page := 0
+	if cursor != "" {
+		page = 1
+	}
+	next := ""
+	if page+1 < len(m.pages) {
+		next = "page-2"
+	}
+	return m.pages[page], next, nil
+}
+
+type mockCounterStore struct {
+	counters map[string]Counters
+	states   map[string]MeteringState
+	getErr   map[string]error
+	puts     int
+}
+
+func (m *mockCounterStore) GetCounters(ctx context.Context, accountID, period string) (Counters, error) {
+	return m.counters[accountID+"/"+period], m.getErr[accountID]
+}
+
+func (m *mockCounterStore) GetMeteringState(ctx context.Context, accountID string) (MeteringState, error) {
+	return m.states[accountID], nil
+}
+
+func (m *mockCounterStore) PutMeteringState(ctx context.Context, accountID string, state MeteringState) error {
+	m.puts++
+	m.states[accountID] = state
+	return nil
+}
+
+type mockPublisher struct {
+	payloads []publisher.EventPayload
+}
+
+func (m *mockPublisher) Publish(ctx context.Context, payload publisher.EventPayload) error {
+	m.payloads = append(m.payloads, payload)
+	return nil
+}
+
+func (m *mockPublisher) ofType(eventType string) []publisher.EventPayload {
+	var matched []publisher.EventPayload
+	for _, p := range m.payloads {
+		if p.EventType == eventType {
+			matched = append(matched, p)
+		}
+	}
+	return matched
+}
+
+func newTestMeter(lister *mockAccountLister, store *mockCounterStore, pub *mockPublisher) *Meter {
+	return &Meter{
+		Accounts:   lister,
+		Usage:      store,
+		Publisher:  pub,
+		Thresholds: []int{80, 100},
+		Now:        func() time.Time { return time.Date(2026, 3, 5, 1, 0, 0, 0, time.UTC) },
+	}
+}
+
+func TestRun_ReportsPeriodToDateAndFinalisesPreviousPeriodOnce(t *testing.T) {
+	lister := &mockAccountLister{pages: [][]account.Meta{{{AccountID: "user-1", QuotaBytes: 1000, QuotaRemaining: 900}}}}
+	store := &mockCounterStore{
+		counters: map[string]Counters{
+			"user-1/2026-03-04": {MethodCalls: 40, DownloadBytes: 5000},
+			"user-1/2026-03-05": {MethodCalls: 2},
+		},
+		states: map[string]MeteringState{},
+	}
+	pub := &mockPublisher{}
+	meter := newTestMeter(lister, store, pub)
+
+	if _, err := meter.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reports := pub.ofType(publisher.EventUsageReport)
+	if len(reports) != 2 {
+		t.Fatalf("expected final and period-to-date reports, got %d", len(reports))
+	}
+	final := reports[0].Data
+	if final["period"] != "2026-03-04" || final["final"] != true || final["methodCalls"] != int64(40) || final["downloadBytes"] != int64(5000) {
+		t.Errorf("unexpected final report: %v", final)
+	}
+	current := reports[1].Data
+	if current["period"] != "2026-03-05" || current["final"] != false || current["storedBytes"] != int64(100) {
+		t.Errorf("unexpected period-to-date report: %v", current)
+	}
+
+	// A second run the same day does not finalise the previous period again
+	pub.payloads = nil
+	if _, err := meter.Run(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if reports := pub.ofType(publisher.EventUsageReport); len(reports) != 1 || reports[0].Data["final"] != false {
+		t.Errorf("expected only a period-to-date report, got %v", reports)
+	}
+}
+
+func TestRun_ThresholdReportedOnceAndRearmed(t *testing.T) {
+	meta := account.Meta{AccountID: "user-1", QuotaBytes: 1000, QuotaRemaining: 150}
+	lister := &mockAccountLister{pages: [][]account.Meta{{meta}}}
+	store := &mockCounterStore{states: map[string]MeteringState{"user-1": {LastFinalPeriod: "2026-03-04"}}}
+	pub := &mockPublisher{}
+	meter := newTestMeter(lister, store, pub)
+
+	meter.Run(context.Background())
+	thresholds := pub.ofType(publisher.EventUsageThreshold)
+	if len(thresholds) != 1 || thresholds[0].Data["thresholdPercent"] != 80 {
+		t.Fatalf("expected one 80%% threshold event, got %v", thresholds)
+	}
+
+	pub.payloads = nil
+	meter.Run(context.Background())
+	if len(pub.ofType(publisher.EventUsageThreshold)) != 0 {
+		t.Error("expected threshold not to be reported again")
+	}
+
+	// Usage drops below the threshold, then crosses it again
+	lister.pages[0][0].QuotaRemaining = 900
+	meter.Run(context.Background())
+	lister.pages[0][0].QuotaRemaining = 150
+	pub.payloads = nil
+	meter.Run(context.Background())
+	if len(pub.ofType(publisher.EventUsageThreshold)) != 1 {
+		t.Error("expected threshold to be reported after re-crossing")
+	}
+}
+
+func TestRun_PartialFailure_ContinuesAndReturnsError(t *testing.T) {
+	lister := &mockAccountLister{pages: [][]account.Meta{
+		{{AccountID: "user-1", QuotaBytes: 1000, QuotaRemaining: 1000}},
+		{{AccountID: "user-2", QuotaBytes: 1000, QuotaRemaining: 1000}},
+	}}
+	store := &mockCounterStore{
+		states: map[string]MeteringState{},
+		getErr: map[string]error{"user-1": errors.New("dynamo down")},
+	}
+	pub := &mockPublisher{}
+	meter := newTestMeter(lister, store, pub)
+
+	summary, err := meter.Run(context.Background())
+	if err == nil {
+		t.Fatal("expected error when an account fails")
+	}
+	if summary.Accounts != 2 || summary.Failed != 1 {
+		t.Errorf("unexpected summary: %+v", summary)
+	}
+	for _, p := range pub.payloads {
+		if p.AccountID == "user-1" {
+			t.Errorf("expected no events for failed account, got %v", p)
+		}
+	}
+	if len(pub.ofType(publisher.EventUsageReport)) != 2 {
+		t.Error("expected the second account to still be reported")
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	thresholds, err := ParseThresholds("100, 80")
+	if err != nil || len(thresholds) != 2 || thresholds[0] != 80 || thresholds[1] != 100 {
+		t.Errorf("unexpected thresholds: %v %v", thresholds, err)
+	}
+
+	if thresholds, err := ParseThresholds(""); err != nil || len(thresholds) != 0 {
+		t.Errorf("expected no thresholds, got %v %v", thresholds, err)
+	}
+
+	for _, value := range []string{"abc", "0", "80,,100"} {
+		if _, err := ParseThresholds(value); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
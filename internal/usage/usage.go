@@ -0,0 +1,181 @@
+package usage
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/jarrod-lowe/jmap-service-libs/dbclient"
+)
+
+// Sort keys under ACCOUNT#{accountId}: daily counters live at
+// USAGE#{yyyy-mm-dd} and the metering job's state at METERING#
+const (
+	SKUsagePrefix = "USAGE#"
+	SKMetering    = "METERING#"
+)
+
+// Counter attribute names on daily usage records
+const (
+	CounterMethodCalls   = "methodCalls"
+	CounterDownloadBytes = "downloadBytes"
+)
+
+// recordExpiry keeps daily usage records long enough for a billing system
+// to reconcile a full month
+const recordExpiry = 40 * 24 * time.Hour
+
+// Counters are the usage totals for one account and period
+type Counters struct {
+	MethodCalls   int64 `dynamodbav:"methodCalls" json:"methodCalls"`
+	DownloadBytes int64 `dynamodbav:"downloadBytes" json:"downloadBytes"`
+}
+
+// MeteringState is what the metering job remembers about an account between runs
+type MeteringState struct {
+	// LastThreshold is the highest quota threshold (percent) already reported
+	LastThreshold int `dynamodbav:"lastThreshold"`
+	// LastFinalPeriod is the latest period reported as final
+	LastFinalPeriod string `dynamodbav:"lastFinalPeriod,omitempty"`
+}
+
+// Period returns the usage period containing t: the UTC day
+func Period(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// DynamoDBClient defines the interface for DynamoDB operations needed by usage
+type DynamoDBClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+}
+
+// DynamoDBStore records and reads usage counters
+type DynamoDBStore struct {
+	client    DynamoDBClient
+	tableName string
+	now       func() time.Time
+}
+
+// NewDynamoDBStore creates a new DynamoDBStore
+func NewDynamoDBStore(client DynamoDBClient, tableName string) *DynamoDBStore {
+	return &DynamoDBStore{
+		client:    client,
+		tableName: tableName,
+		now:       time.Now,
+	}
+}
+
+// usageKey builds the primary key of an account's usage record for a period
+func usageKey(accountID, period string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKUsagePrefix + period},
+	}
+}
+
+// meteringKey builds the primary key of an account's metering state record
+func meteringKey(accountID string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"pk": &types.AttributeValueMemberS{Value: dbclient.AccountPK(accountID)},
+		"sk": &types.AttributeValueMemberS{Value: SKMetering},
+	}
+}
+
+// RecordMethodCalls adds method calls to the account's counters for the current period
+func (d *DynamoDBStore) RecordMethodCalls(ctx context.Context, accountID string, calls int) error {
+	return d.add(ctx, accountID, CounterMethodCalls, int64(calls))
+}
+
+// RecordDownload adds downloaded bytes to the account's counters for the current period
+func (d *DynamoDBStore) RecordDownload(ctx context.Context, accountID string, bytes int64) error {
+	return d.add(ctx, accountID, CounterDownloadBytes, bytes)
+}
+
+// add atomically increments one counter, creating the period's record if needed
+func (d *DynamoDBStore) add(ctx context.Context, accountID, counter string, n int64) error {
+	if n <= 0 {
+		return nil
+	}
+
+	now := d.now()
+	_, err := d.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(d.tableName),
+		Key:              usageKey(accountID, Period(now)),
+		UpdateExpression: aws.String("ADD #counter :n SET #ttl = if_not_exists(#ttl, :ttl)"),
+		ExpressionAttributeNames: map[string]string{
+			"#counter": counter,
+			"#ttl":     "ttl",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":n":   &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)},
+			":ttl": &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Add(recordExpiry).Unix(), 10)},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", counter, err)
+	}
+	return nil
+}
+
+// GetCounters returns an account's counters for a period; a period with no
+// recorded usage has zero counters
+func (d *DynamoDBStore) GetCounters(ctx context.Context, accountID, period string) (Counters, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       usageKey(accountID, period),
+	})
+	if err != nil {
+		return Counters{}, err
+	}
+
+	var counters Counters
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &counters); err != nil {
+			return Counters{}, fmt.Errorf("failed to unmarshal usage: %w", err)
+		}
+	}
+	return counters, nil
+}
+
+// GetMeteringState returns the metering job's state for an account
+func (d *DynamoDBStore) GetMeteringState(ctx context.Context, accountID string) (MeteringState, error) {
+	result, err := d.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(d.tableName),
+		Key:       meteringKey(accountID),
+	})
+	if err != nil {
+		return MeteringState{}, err
+	}
+
+	var state MeteringState
+	if result.Item != nil {
+		if err := attributevalue.UnmarshalMap(result.Item, &state); err != nil {
+			return MeteringState{}, fmt.Errorf("failed to unmarshal metering state: %w", err)
+		}
+	}
+	return state, nil
+}
+
+// PutMeteringState saves the metering job's state for an account
+func (d *DynamoDBStore) PutMeteringState(ctx context.Context, accountID string, state MeteringState) error {
+	item, err := attributevalue.MarshalMap(state)
+	if err != nil {
+		return fmt.Errorf("failed to marshal metering state: %w", err)
+	}
+	for k, v := range meteringKey(accountID) {
+		item[k] = v
+	}
+
+	_, err = d.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.tableName),
+		Item:      item,
+	})
+	return err
+}
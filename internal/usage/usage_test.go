@@ -0,0 +1,113 @@
+package usage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+type mockDynamoDBClient struct {
+	item        map[string]types.AttributeValue
+	lastGet     *dynamodb.GetItemInput
+	lastPut     *dynamodb.PutItemInput
+	lastUpdate  *dynamodb.UpdateItemInput
+	updateCalls int
+}
+
+func (m *mockDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	m.lastGet = params
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	m.lastPut = params
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (m *mockDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	m.lastUpdate = params
+	m.updateCalls++
+	return &dynamodb.UpdateItemOutput{}, nil
+}
+
+func newTestStore(client *mockDynamoDBClient) *DynamoDBStore {
+	store := NewDynamoDBStore(client, "table")
+	store.now = func() time.Time { return time.Date(2026, 3, 4, 23, 30, 0, 0, time.UTC) }
+	return store
+}
+
+func TestRecordDownload_AddsToDailyCounter(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := newTestStore(client)
+
+	if err := store.RecordDownload(context.Background(), "user-1", 2048); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	update := client.lastUpdate
+	if sk := update.Key["sk"].(*types.AttributeValueMemberS).Value; sk != "USAGE#2026-03-04" {
+		t.Errorf("expected daily usage record, got %s", sk)
+	}
+	if update.ExpressionAttributeNames["#counter"] != CounterDownloadBytes {
+		t.Errorf("expected downloadBytes counter, got %s", update.ExpressionAttributeNames["#counter"])
+	}
+	if n := update.ExpressionAttributeValues[":n"].(*types.AttributeValueMemberN).Value; n != "2048" {
+		t.Errorf("expected increment 2048, got %s", n)
+	}
+}
+
+func TestRecordMethodCalls_ZeroIsNoop(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := newTestStore(client)
+
+	if err := store.RecordMethodCalls(context.Background(), "user-1", 0); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if client.updateCalls != 0 {
+		t.Error("expected no write for zero calls")
+	}
+}
+
+func TestGetCounters_MissingRecordIsZero(t *testing.T) {
+	store := newTestStore(&mockDynamoDBClient{})
+
+	counters, err := store.GetCounters(context.Background(), "user-1", "2026-03-04")
+	if err != nil || counters != (Counters{}) {
+		t.Errorf("expected zero counters, got %+v %v", counters, err)
+	}
+}
+
+func TestGetCounters_ReadsRecord(t *testing.T) {
+	client := &mockDynamoDBClient{item: map[string]types.AttributeValue{
+		"methodCalls":   &types.AttributeValueMemberN{Value: "12"},
+		"downloadBytes": &types.AttributeValueMemberN{Value: "4096"},
+	}}
+	store := newTestStore(client)
+
+	counters, err := store.GetCounters(context.Background(), "user-1", "2026-03-04")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if counters.MethodCalls != 12 || counters.DownloadBytes != 4096 {
+		t.Errorf("unexpected counters: %+v", counters)
+	}
+}
+
+func TestPutMeteringState_WritesStateRecord(t *testing.T) {
+	client := &mockDynamoDBClient{}
+	store := newTestStore(client)
+
+	if err := store.PutMeteringState(context.Background(), "user-1", MeteringState{LastThreshold: 80}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	item := client.lastPut.Item
+	if sk := item["sk"].(*types.AttributeValueMemberS).Value; sk != SKMetering {
+		t.Errorf("expected METERING# record, got %s", sk)
+	}
+	if n := item["lastThreshold"].(*types.AttributeValueMemberN).Value; n != "80" {
+		t.Errorf("expected lastThreshold 80, got %s", n)
+	}
+}
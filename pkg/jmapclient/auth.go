@@ -0,0 +1,52 @@
+package jmapclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// Authenticator adds credentials to a request before it is sent
+type Authenticator interface {
+	Authenticate(ctx context.Context, req *http.Request, body []byte) error
+}
+
+// BearerToken authenticates with a Cognito ID token
+type BearerToken string
+
+// Authenticate sets the Authorization header
+func (t BearerToken) Authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	req.Header.Set("Authorization", "Bearer "+string(t))
+	return nil
+}
+
+// SigV4 signs requests for execute-api, sending them to the IAM routes
+type SigV4 struct {
+	signer      *v4.Signer
+	credentials aws.CredentialsProvider
+	region      string
+}
+
+// NewSigV4 signs with cfg's credentials in cfg's region
+func NewSigV4(cfg aws.Config) *SigV4 {
+	return &SigV4{
+		signer:      v4.NewSigner(),
+		credentials: cfg.Credentials,
+		region:      cfg.Region,
+	}
+}
+
+// Authenticate signs the request in place
+func (s *SigV4) Authenticate(ctx context.Context, req *http.Request, body []byte) error {
+	creds, err := s.credentials.Retrieve(ctx)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256(body)
+	return s.signer.SignHTTP(ctx, creds, req, hex.EncodeToString(hash[:]), "execute-api", s.region, time.Now())
+}
@@ -0,0 +1,223 @@
+package jmapclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Blob is an uploaded blob
+type Blob struct {
+	AccountID string `json:"accountId"`
+	BlobID    string `json:"blobId"`
+	Type      string `json:"type"`
+	Size      int64  `json:"size"`
+}
+
+// UploadInput is a blob to upload
+type UploadInput struct {
+	Type   string // media type; defaults to application/octet-stream
+	Data   []byte
+	Parent string // optional X-Parent tag, for direct uploads only
+}
+
+// SetError is a per-object error in a /set-style response such as
+// Blob/allocate's notCreated (RFC 8620 section 5.3)
+type SetError struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description,omitempty"`
+	Properties  []string `json:"properties,omitempty"`
+}
+
+func (e *SetError) Error() string {
+	return fmt.Sprintf("jmapclient: %s: %s", e.Type, e.Description)
+}
+
+// PartURL is a presigned URL for one part of a multipart upload
+type PartURL struct {
+	PartNumber int32  `json:"partNumber"`
+	URL        string `json:"url"`
+}
+
+// Allocation is a blob allocated by Blob/allocate, to be uploaded with a
+// presigned PUT to URL or, for multipart uploads, to each of Parts
+type Allocation struct {
+	ID      string    `json:"id"`
+	Type    string    `json:"type"`
+	Size    int64     `json:"size"`
+	Expires string    `json:"expires"`
+	URL     string    `json:"url,omitempty"`
+	Parts   []PartURL `json:"parts,omitempty"`
+}
+
+// CompletedPart is an uploaded part of a multipart upload
+type CompletedPart struct {
+	PartNumber int32  `json:"partNumber"`
+	ETag       string `json:"etag"`
+}
+
+// contentType returns the input's media type
+func (in UploadInput) contentType() string {
+	if in.Type == "" {
+		return "application/octet-stream"
+	}
+	return in.Type
+}
+
+// Upload uploads a blob in the request body, as RFC 8620 section 6.1
+// describes. The upload size is limited by API Gateway; use PutBlob for
+// larger blobs.
+func (c *Client) Upload(ctx context.Context, in UploadInput) (*Blob, error) {
+	accountID, err := c.AccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var headers map[string]string
+	if in.Parent != "" {
+		headers = map[string]string{"X-Parent": in.Parent}
+	}
+	account := url.PathEscape(accountID)
+	body, _, err := c.send(ctx, http.MethodPost, c.route("/upload/"+account, "/upload-iam/"+account), in.contentType(), in.Data, headers)
+	if err != nil {
+		return nil, err
+	}
+	var blob Blob
+	if err := json.Unmarshal(body, &blob); err != nil {
+		return nil, fmt.Errorf("jmapclient: invalid upload response: %w", err)
+	}
+	return &blob, nil
+}
+
+// Allocate allocates a blob with Blob/allocate. A zero size is only allowed
+// with SigV4, where it leaves the size to be set when the upload completes.
+// Multipart uploads are also SigV4 only.
+func (c *Client) Allocate(ctx context.Context, contentType string, size int64, multipart bool) (*Allocation, error) {
+	accountID, err := c.AccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	create := map[string]any{"type": contentType}
+	if size > 0 {
+		create["size"] = size
+	}
+	if multipart {
+		create["multipart"] = true
+	}
+
+	request := NewRequest(UploadPutCapability)
+	call := request.Invoke("Blob/allocate", map[string]any{
+		"accountId": accountID,
+		"create":    map[string]any{"blob": create},
+	})
+	response, err := c.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Created    map[string]Allocation `json:"created"`
+		NotCreated map[string]SetError   `json:"notCreated"`
+	}
+	if err := response.Get(call, &result); err != nil {
+		return nil, err
+	}
+	if setErr, ok := result.NotCreated["blob"]; ok {
+		return nil, &setErr
+	}
+	allocation, ok := result.Created["blob"]
+	if !ok {
+		return nil, errors.New("jmapclient: Blob/allocate returned no blob")
+	}
+	return &allocation, nil
+}
+
+// PutBlob uploads a blob by allocating it and PUTting it to the presigned
+// URL. The blob is confirmed asynchronously once the object lands, so it may
+// briefly be unavailable to other methods.
+func (c *Client) PutBlob(ctx context.Context, in UploadInput) (*Blob, error) {
+	allocation, err := c.Allocate(ctx, in.contentType(), int64(len(in.Data)), false)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.put(ctx, allocation.URL, in.contentType(), in.Data); err != nil {
+		return nil, err
+	}
+	accountID, _ := c.AccountID(ctx)
+	return &Blob{AccountID: accountID, BlobID: allocation.ID, Type: in.contentType(), Size: int64(len(in.Data))}, nil
+}
+
+// MultipartUpload uploads a blob in parts with a multipart allocation, then
+// completes it with Blob/complete. S3 requires every part but the last to be
+// at least 5 MiB. It is SigV4 only.
+func (c *Client) MultipartUpload(ctx context.Context, contentType string, parts [][]byte) (*Blob, error) {
+	if len(parts) == 0 {
+		return nil, errors.New("jmapclient: no parts to upload")
+	}
+	allocation, err := c.Allocate(ctx, contentType, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	if len(parts) > len(allocation.Parts) {
+		return nil, fmt.Errorf("jmapclient: %d parts exceeds the %d allocated", len(parts), len(allocation.Parts))
+	}
+
+	completed := make([]CompletedPart, len(parts))
+	var size int64
+	for i, data := range parts {
+		etag, err := c.put(ctx, allocation.Parts[i].URL, "", data)
+		if err != nil {
+			return nil, fmt.Errorf("jmapclient: part %d: %w", allocation.Parts[i].PartNumber, err)
+		}
+		completed[i] = CompletedPart{PartNumber: allocation.Parts[i].PartNumber, ETag: etag}
+		size += int64(len(data))
+	}
+
+	accountID, _ := c.AccountID(ctx)
+	request := NewRequest(UploadPutCapability)
+	call := request.Invoke("Blob/complete", map[string]any{
+		"accountId": accountID,
+		"id":        allocation.ID,
+		"parts":     completed,
+	})
+	response, err := c.Do(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+	if err := response.Get(call, nil); err != nil {
+		return nil, err
+	}
+	return &Blob{AccountID: accountID, BlobID: allocation.ID, Type: contentType, Size: size}, nil
+}
+
+// put PUTs data to a presigned URL, which carries its own credentials, and
+// returns the object's ETag
+func (c *Client) put(ctx context.Context, target, contentType string, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("jmapclient: failed to build upload: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	_, headers, err := c.roundTrip(req)
+	if err != nil {
+		return "", err
+	}
+	return headers.Get("ETag"), nil
+}
+
+// Download downloads a blob. The download route redirects to a signed
+// CloudFront URL, which *http.Client follows without the request's
+// credentials.
+func (c *Client) Download(ctx context.Context, blobID string) ([]byte, error) {
+	accountID, err := c.AccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	path := url.PathEscape(accountID) + "/" + url.PathEscape(blobID)
+	body, _, err := c.send(ctx, http.MethodGet, c.route("/download/"+path, "/download-iam/"+path), "", nil, nil)
+	return body, err
+}
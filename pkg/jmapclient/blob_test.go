@@ -0,0 +1,141 @@
+package jmapclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestUpload(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL, BearerToken("jwt"))
+
+	blob, err := client.Upload(context.Background(), UploadInput{Type: "text/plain", Data: []byte("hello"), Parent: "email"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob.AccountID != "user-123" || blob.BlobID != "blob-1" || blob.Type != "text/plain" || blob.Size != 5 {
+		t.Errorf("unexpected blob %+v", blob)
+	}
+	request := api.last()
+	if request.Path != "/upload/user-123" || request.Header.Get("X-Parent") != "email" {
+		t.Errorf("unexpected request %s %v", request.Path, request.Header)
+	}
+}
+
+func TestUpload_SigV4(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL, testSigV4()).WithAccount("user-123")
+
+	blob, err := client.Upload(context.Background(), UploadInput{Data: []byte("hello")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob.Type != "application/octet-stream" || api.last().Path != "/upload-iam/user-123" {
+		t.Errorf("unexpected upload %+v to %s", blob, api.last().Path)
+	}
+}
+
+func TestPutBlob(t *testing.T) {
+	api := newFakeAPI(t)
+	api.jmap = func(request map[string]any) any {
+		return map[string]any{
+			"methodResponses": []any{[]any{"Blob/allocate", map[string]any{
+				"accountId": "user-123",
+				"created": map[string]any{"blob": map[string]any{
+					"id": "blob-2", "type": "text/plain", "size": 5, "url": api.URL + "/bucket/user-123/blob-2",
+				}},
+			}, "c0"}},
+		}
+	}
+	client := New(api.URL, BearerToken("jwt")).WithAccount("user-123")
+
+	blob, err := client.PutBlob(context.Background(), UploadInput{Type: "text/plain", Data: []byte("hello")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob.BlobID != "blob-2" || blob.Size != 5 {
+		t.Errorf("unexpected blob %+v", blob)
+	}
+
+	paths := api.paths()
+	if len(paths) != 2 || paths[0] != "POST /jmap" || paths[1] != "PUT /bucket/user-123/blob-2" {
+		t.Fatalf("unexpected requests %v", paths)
+	}
+	put := api.last()
+	if put.Body != "hello" || put.Header.Get("Content-Type") != "text/plain" || put.Header.Get("Authorization") != "" {
+		t.Errorf("unexpected PUT %v %q", put.Header, put.Body)
+	}
+}
+
+func TestAllocate_NotCreated(t *testing.T) {
+	api := newFakeAPI(t)
+	api.jmap = func(request map[string]any) any {
+		return map[string]any{
+			"methodResponses": []any{[]any{"Blob/allocate", map[string]any{
+				"accountId":  "user-123",
+				"notCreated": map[string]any{"blob": map[string]any{"type": "overQuota", "description": "Insufficient quota"}},
+			}, "c0"}},
+		}
+	}
+	client := New(api.URL, BearerToken("jwt")).WithAccount("user-123")
+
+	_, err := client.Allocate(context.Background(), "text/plain", 10, false)
+	var setErr *SetError
+	if !errors.As(err, &setErr) || setErr.Type != "overQuota" {
+		t.Errorf("expected overQuota SetError, got %v", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	api := newFakeAPI(t)
+	var completeArgs map[string]any
+	api.jmap = func(request map[string]any) any {
+		call := request["methodCalls"].([]any)[0].([]any)
+		if call[0] == "Blob/complete" {
+			completeArgs = call[1].(map[string]any)
+			return map[string]any{"methodResponses": []any{[]any{"Blob/complete", map[string]any{"accountId": "user-123", "blobId": "blob-3"}, "c0"}}}
+		}
+		parts := make([]any, 3)
+		for i := range parts {
+			parts[i] = map[string]any{"partNumber": i + 1, "url": fmt.Sprintf("%s/bucket/user-123/blob-3?partNumber=%d", api.URL, i+1)}
+		}
+		return map[string]any{"methodResponses": []any{[]any{"Blob/allocate", map[string]any{
+			"created": map[string]any{"blob": map[string]any{"id": "blob-3", "type": "message/rfc822", "parts": parts}},
+		}, "c0"}}}
+	}
+	client := New(api.URL, testSigV4()).WithAccount("user-123")
+
+	blob, err := client.MultipartUpload(context.Background(), "message/rfc822", [][]byte{[]byte("part one"), []byte("two")})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if blob.BlobID != "blob-3" || blob.Size != 11 {
+		t.Errorf("unexpected blob %+v", blob)
+	}
+	if len(api.paths()) != 4 {
+		t.Errorf("expected allocate, two PUTs and complete, got %v", api.paths())
+	}
+	parts := completeArgs["parts"].([]any)
+	if completeArgs["id"] != "blob-3" || len(parts) != 2 || parts[1].(map[string]any)["etag"] != `"etag-2"` {
+		t.Errorf("unexpected Blob/complete arguments %v", completeArgs)
+	}
+
+	if _, err := client.MultipartUpload(context.Background(), "message/rfc822", make([][]byte, 4)); err == nil {
+		t.Error("expected error for more parts than allocated")
+	}
+}
+
+func TestDownload_FollowsRedirect(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL, BearerToken("jwt")).WithAccount("user-123")
+
+	data, err := client.Download(context.Background(), "blob-1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "contents of blob-1" {
+		t.Errorf("unexpected contents %q", data)
+	}
+}
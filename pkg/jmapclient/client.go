@@ -0,0 +1,224 @@
+// Package jmapclient is a Go client for the JMAP service core's endpoints:
+// the session, method calls with result references, blob upload (directly
+// or through Blob/allocate and a presigned PUT) and download. It
+// authenticates either with a Cognito token or by signing requests with
+// SigV4 for the IAM routes.
+//
+//	client := jmapclient.New("https://jmap.example.com", jmapclient.NewSigV4(cfg)).WithAccount("user-123")
+//
+//	req := jmapclient.NewRequest("urn:ietf:params:jmap:mail")
+//	query := req.Invoke("Email/query", map[string]any{"limit": 5})
+//	get := req.Invoke("Email/get", map[string]any{"#ids": query.Ref("/ids")})
+//	resp, err := client.Do(ctx, req)
+//	...
+//	var emails struct{ List []Email }
+//	err = resp.Get(get, &emails)
+package jmapclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Capabilities used by the client
+const (
+	CoreCapability      = "urn:ietf:params:jmap:core"
+	UploadPutCapability = "https://jmap.rrod.net/extensions/upload-put"
+)
+
+// CorrelationHeader carries the ID the service logs and traces a request by
+const CorrelationHeader = "X-Correlation-Id"
+
+// ErrSessionRequiresToken is returned when fetching the session with SigV4,
+// as the session endpoint only accepts Cognito tokens
+var ErrSessionRequiresToken = errors.New("jmapclient: the session endpoint requires a Cognito token")
+
+// ErrAccountRequired is returned when an IAM request has no account
+var ErrAccountRequired = errors.New("jmapclient: an account ID is required with SigV4")
+
+// Doer sends HTTP requests. *http.Client implements it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// StatusError is returned for non-2xx HTTP responses
+type StatusError struct {
+	StatusCode int
+	Body       []byte
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("jmapclient: unexpected status %d: %s", e.StatusCode, bytes.TrimSpace(e.Body))
+}
+
+// Client calls the core's HTTP API. Its methods are safe for concurrent use;
+// configure it with the With methods before first use.
+type Client struct {
+	baseURL       string
+	auth          Authenticator
+	httpClient    Doer
+	accountID     string
+	correlationID string
+
+	mu             sync.Mutex
+	primaryAccount string
+}
+
+// New creates a client for the API at baseURL, such as
+// "https://jmap.example.com", authenticating with auth
+func New(baseURL string, auth Authenticator) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		auth:       auth,
+		httpClient: &http.Client{Timeout: 60 * time.Second},
+	}
+}
+
+// WithAccount sets the account requests are made for. It is required with
+// SigV4; with a Cognito token it defaults to the session's primary account.
+func (c *Client) WithAccount(accountID string) *Client {
+	c.accountID = accountID
+	return c
+}
+
+// WithHTTPClient sets the HTTP client requests are sent with
+func (c *Client) WithHTTPClient(httpClient Doer) *Client {
+	c.httpClient = httpClient
+	return c
+}
+
+// WithCorrelationID sends id as the X-Correlation-Id of every request
+func (c *Client) WithCorrelationID(id string) *Client {
+	c.correlationID = id
+	return c
+}
+
+// iam reports whether requests go to the SigV4 routes
+func (c *Client) iam() bool {
+	_, ok := c.auth.(*SigV4)
+	return ok
+}
+
+// route returns the URL of a route, using the IAM variant with SigV4
+func (c *Client) route(cognito, iam string) string {
+	if c.iam() {
+		return c.baseURL + iam
+	}
+	return c.baseURL + cognito
+}
+
+// Session fetches the session document
+func (c *Client) Session(ctx context.Context) (*Session, error) {
+	if c.iam() {
+		return nil, ErrSessionRequiresToken
+	}
+	body, _, err := c.send(ctx, http.MethodGet, c.baseURL+"/.well-known/jmap", "", nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var session Session
+	if err := json.Unmarshal(body, &session); err != nil {
+		return nil, fmt.Errorf("jmapclient: invalid session: %w", err)
+	}
+	return &session, nil
+}
+
+// AccountID returns the account requests are made for: the configured one,
+// or the session's primary account, which is fetched once
+func (c *Client) AccountID(ctx context.Context) (string, error) {
+	if c.accountID != "" {
+		return c.accountID, nil
+	}
+	if c.iam() {
+		return "", ErrAccountRequired
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.primaryAccount != "" {
+		return c.primaryAccount, nil
+	}
+	session, err := c.Session(ctx)
+	if err != nil {
+		return "", err
+	}
+	accountID := session.PrimaryAccounts[CoreCapability]
+	if accountID == "" {
+		return "", errors.New("jmapclient: session has no primary account")
+	}
+	c.primaryAccount = accountID
+	return accountID, nil
+}
+
+// Do sends a JMAP request. Method errors are returned by Response.Get rather
+// than here.
+func (c *Client) Do(ctx context.Context, request *Request) (*Response, error) {
+	target := c.baseURL + "/jmap"
+	if c.iam() {
+		if c.accountID == "" {
+			return nil, ErrAccountRequired
+		}
+		target = c.baseURL + "/jmap-iam/" + url.PathEscape(c.accountID)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("jmapclient: failed to encode request: %w", err)
+	}
+	respBody, _, err := c.send(ctx, http.MethodPost, target, "application/json", body, nil)
+	if err != nil {
+		return nil, err
+	}
+	var response Response
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("jmapclient: invalid response: %w", err)
+	}
+	return &response, nil
+}
+
+// send sends an authenticated request, returning the body and headers of a
+// 2xx response and a *StatusError otherwise
+func (c *Client) send(ctx context.Context, method, target, contentType string, body []byte, headers map[string]string) ([]byte, http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, fmt.Errorf("jmapclient: failed to build request: %w", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.correlationID != "" {
+		req.Header.Set(CorrelationHeader, c.correlationID)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	if err := c.auth.Authenticate(ctx, req, body); err != nil {
+		return nil, nil, fmt.Errorf("jmapclient: failed to authenticate request: %w", err)
+	}
+	return c.roundTrip(req)
+}
+
+// roundTrip sends a prepared request
+func (c *Client) roundTrip(req *http.Request) ([]byte, http.Header, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("jmapclient: request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("jmapclient: failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, resp.Header, &StatusError{StatusCode: resp.StatusCode, Body: respBody}
+	}
+	return respBody, resp.Header, nil
+}
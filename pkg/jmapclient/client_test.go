@@ -0,0 +1,221 @@
+package jmapclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// fakeAPI stands in for the API and the blob bucket, recording requests
+type fakeAPI struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []recordedRequest
+	jmap     func(request map[string]any) any // returns the JMAP response
+}
+
+type recordedRequest struct {
+	Method string
+	Path   string
+	Header http.Header
+	Body   string
+}
+
+func newFakeAPI(t *testing.T) *fakeAPI {
+	t.Helper()
+	api := &fakeAPI{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/jmap", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"apiUrl":          api.URL + "/jmap",
+			"primaryAccounts": map[string]string{CoreCapability: "user-123"},
+			"accounts":        map[string]any{"user-123": map[string]any{"name": "user@example.com", "isPersonal": true}},
+			"state":           "s1",
+		})
+	})
+	jmap := func(w http.ResponseWriter, r *http.Request) {
+		var request map[string]any
+		_ = json.Unmarshal([]byte(api.last().Body), &request)
+		writeJSON(w, api.jmap(request))
+	}
+	mux.HandleFunc("POST /jmap", jmap)
+	mux.HandleFunc("POST /jmap-iam/{accountId}", jmap)
+	upload := func(w http.ResponseWriter, r *http.Request) {
+		body := api.last().Body
+		writeJSON(w, Blob{AccountID: r.PathValue("accountId"), BlobID: "blob-1", Type: r.Header.Get("Content-Type"), Size: int64(len(body))})
+	}
+	mux.HandleFunc("POST /upload/{accountId}", upload)
+	mux.HandleFunc("POST /upload-iam/{accountId}", upload)
+	mux.HandleFunc("GET /download/{accountId}/{blobId}", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/cdn/"+r.PathValue("blobId"), http.StatusFound)
+	})
+	mux.HandleFunc("GET /cdn/{blobId}", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("contents of " + r.PathValue("blobId")))
+	})
+	mux.HandleFunc("PUT /bucket/{key...}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"etag-`+r.URL.Query().Get("partNumber")+`"`)
+	})
+
+	api.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		api.mu.Lock()
+		api.requests = append(api.requests, recordedRequest{Method: r.Method, Path: r.URL.Path, Header: r.Header.Clone(), Body: string(body)})
+		api.mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(api.Close)
+	return api
+}
+
+// last returns the most recent request
+func (a *fakeAPI) last() recordedRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.requests[len(a.requests)-1]
+}
+
+// paths returns the method and path of each request
+func (a *fakeAPI) paths() []string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	paths := make([]string, len(a.requests))
+	for i, request := range a.requests {
+		paths[i] = request.Method + " " + request.Path
+	}
+	return paths
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// testSigV4 signs with static credentials
+func testSigV4() *SigV4 {
+	return NewSigV4(aws.Config{
+		Region: "ap-southeast-2",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+	})
+}
+
+func TestSession(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL+"/", BearerToken("jwt")).WithCorrelationID("trace-1")
+
+	session, err := client.Session(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if session.PrimaryAccounts[CoreCapability] != "user-123" || !session.Accounts["user-123"].IsPersonal {
+		t.Errorf("unexpected session %+v", session)
+	}
+	request := api.last()
+	if request.Header.Get("Authorization") != "Bearer jwt" || request.Header.Get(CorrelationHeader) != "trace-1" {
+		t.Errorf("unexpected headers %v", request.Header)
+	}
+}
+
+func TestSession_SigV4(t *testing.T) {
+	client := New("https://jmap.example.com", testSigV4())
+	if _, err := client.Session(context.Background()); !errors.Is(err, ErrSessionRequiresToken) {
+		t.Errorf("expected ErrSessionRequiresToken, got %v", err)
+	}
+}
+
+func TestAccountID_FetchesPrimaryAccountOnce(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL, BearerToken("jwt"))
+
+	for range 2 {
+		accountID, err := client.AccountID(context.Background())
+		if err != nil || accountID != "user-123" {
+			t.Fatalf("expected user-123, got %q, %v", accountID, err)
+		}
+	}
+	if len(api.paths()) != 1 {
+		t.Errorf("expected one session fetch, got %v", api.paths())
+	}
+}
+
+func TestDo_BackReferences(t *testing.T) {
+	api := newFakeAPI(t)
+	api.jmap = func(request map[string]any) any {
+		return map[string]any{
+			"methodResponses": []any{
+				[]any{"Email/query", map[string]any{"ids": []string{"e1"}}, "c0"},
+				[]any{"error", map[string]any{"type": "invalidArguments", "description": "bad properties"}, "c1"},
+			},
+			"sessionState": "s1",
+		}
+	}
+	client := New(api.URL, BearerToken("jwt"))
+
+	request := NewRequest("urn:ietf:params:jmap:mail", CoreCapability)
+	query := request.Invoke("Email/query", map[string]any{"accountId": "user-123"})
+	get := request.Invoke("Email/get", map[string]any{"#ids": query.Ref("/ids")})
+	response, err := client.Do(context.Background(), request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := `{"using":["urn:ietf:params:jmap:core","urn:ietf:params:jmap:mail"],"methodCalls":[["Email/query",{"accountId":"user-123"},"c0"],["Email/get",{"#ids":{"resultOf":"c0","name":"Email/query","path":"/ids"}},"c1"]]}`
+	if got := api.last().Body; got != want {
+		t.Errorf("unexpected request\n got %s\nwant %s", got, want)
+	}
+
+	var result struct{ IDs []string }
+	if err := response.Get(query, &result); err != nil || len(result.IDs) != 1 {
+		t.Errorf("expected query result, got %+v, %v", result, err)
+	}
+	var methodErr *MethodError
+	if err := response.Get(get, nil); !errors.As(err, &methodErr) || methodErr.Type != "invalidArguments" {
+		t.Errorf("expected method error, got %v", err)
+	}
+	if err := response.Get(&Call{ID: "c9"}, nil); err == nil {
+		t.Error("expected error for call without a response")
+	}
+}
+
+func TestDo_SigV4(t *testing.T) {
+	api := newFakeAPI(t)
+	api.jmap = func(request map[string]any) any {
+		return map[string]any{"methodResponses": []any{}, "sessionState": "s1"}
+	}
+
+	if _, err := New(api.URL, testSigV4()).Do(context.Background(), NewRequest()); !errors.Is(err, ErrAccountRequired) {
+		t.Errorf("expected ErrAccountRequired, got %v", err)
+	}
+
+	client := New(api.URL, testSigV4()).WithAccount("user-123")
+	if _, err := client.Do(context.Background(), NewRequest()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	request := api.last()
+	if request.Path != "/jmap-iam/user-123" {
+		t.Errorf("expected IAM route, got %s", request.Path)
+	}
+	if !strings.HasPrefix(request.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+		t.Errorf("expected SigV4 signature, got %q", request.Header.Get("Authorization"))
+	}
+}
+
+func TestDo_StatusError(t *testing.T) {
+	api := newFakeAPI(t)
+	client := New(api.URL+"/missing", BearerToken("jwt")).WithAccount("user-123")
+
+	_, err := client.Do(context.Background(), NewRequest())
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected 404 StatusError, got %v", err)
+	}
+}
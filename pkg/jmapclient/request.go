@@ -0,0 +1,162 @@
+package jmapclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// Session is the JMAP session document (RFC 8620 section 2)
+type Session struct {
+	Capabilities    map[string]json.RawMessage `json:"capabilities"`
+	Accounts        map[string]Account         `json:"accounts"`
+	PrimaryAccounts map[string]string          `json:"primaryAccounts"`
+	Username        string                     `json:"username"`
+	APIURL          string                     `json:"apiUrl"`
+	DownloadURL     string                     `json:"downloadUrl"`
+	UploadURL       string                     `json:"uploadUrl"`
+	EventSourceURL  string                     `json:"eventSourceUrl,omitempty"`
+	State           string                     `json:"state"`
+}
+
+// Account is an account in the session
+type Account struct {
+	Name                string                     `json:"name"`
+	IsPersonal          bool                       `json:"isPersonal"`
+	IsReadOnly          bool                       `json:"isReadOnly"`
+	AccountCapabilities map[string]json.RawMessage `json:"accountCapabilities"`
+}
+
+// ResultReference refers to part of an earlier call's result (RFC 8620
+// section 3.7). It is sent as the value of an argument named "#" + name.
+type ResultReference struct {
+	ResultOf string `json:"resultOf"`
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+}
+
+// Call is a method call in a Request
+type Call struct {
+	ID   string
+	Name string
+	Args any
+}
+
+// Ref returns a reference to path in this call's result, such as "/ids"
+func (c *Call) Ref(path string) ResultReference {
+	return ResultReference{ResultOf: c.ID, Name: c.Name, Path: path}
+}
+
+// Request is a JMAP request under construction
+type Request struct {
+	Using []string
+	Calls []*Call
+}
+
+// NewRequest creates a request using the core capability and using
+func NewRequest(using ...string) *Request {
+	request := &Request{Using: []string{CoreCapability}}
+	for _, capability := range using {
+		if !slices.Contains(request.Using, capability) {
+			request.Using = append(request.Using, capability)
+		}
+	}
+	return request
+}
+
+// Invoke adds a method call with args, which are encoded as JSON, and
+// returns it. Calls are given the IDs c0, c1, and so on.
+func (r *Request) Invoke(name string, args any) *Call {
+	call := &Call{ID: fmt.Sprintf("c%d", len(r.Calls)), Name: name, Args: args}
+	r.Calls = append(r.Calls, call)
+	return call
+}
+
+// MarshalJSON encodes the request as sent to the API
+func (r *Request) MarshalJSON() ([]byte, error) {
+	calls := make([][3]any, len(r.Calls))
+	for i, call := range r.Calls {
+		args := call.Args
+		if args == nil {
+			args = map[string]any{}
+		}
+		calls[i] = [3]any{call.Name, args, call.ID}
+	}
+	return json.Marshal(struct {
+		Using       []string `json:"using"`
+		MethodCalls [][3]any `json:"methodCalls"`
+	}{r.Using, calls})
+}
+
+// Invocation is a method response
+type Invocation struct {
+	Name   string
+	Args   json.RawMessage
+	CallID string
+}
+
+// UnmarshalJSON decodes the [name, args, callId] triple
+func (i *Invocation) UnmarshalJSON(data []byte) error {
+	var triple []json.RawMessage
+	if err := json.Unmarshal(data, &triple); err != nil {
+		return err
+	}
+	if len(triple) != 3 {
+		return fmt.Errorf("invocation has %d elements, want 3", len(triple))
+	}
+	if err := json.Unmarshal(triple[0], &i.Name); err != nil {
+		return err
+	}
+	i.Args = triple[1]
+	return json.Unmarshal(triple[2], &i.CallID)
+}
+
+// MarshalJSON encodes the [name, args, callId] triple
+func (i Invocation) MarshalJSON() ([]byte, error) {
+	return json.Marshal([3]any{i.Name, i.Args, i.CallID})
+}
+
+// Response is a JMAP response
+type Response struct {
+	MethodResponses []Invocation      `json:"methodResponses"`
+	CreatedIDs      map[string]string `json:"createdIds,omitempty"`
+	SessionState    string            `json:"sessionState"`
+}
+
+// MethodError is a method-level error response (RFC 8620 section 3.6.2)
+type MethodError struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+func (e *MethodError) Error() string {
+	if e.Description == "" {
+		return "jmapclient: method error " + e.Type
+	}
+	return fmt.Sprintf("jmapclient: method error %s: %s", e.Type, e.Description)
+}
+
+// Get decodes the first response to call into v, which may be nil. It
+// returns a *MethodError if the call failed.
+func (r *Response) Get(call *Call, v any) error {
+	for _, invocation := range r.MethodResponses {
+		if invocation.CallID != call.ID {
+			continue
+		}
+		if invocation.Name == "error" {
+			methodErr := &MethodError{}
+			if err := json.Unmarshal(invocation.Args, methodErr); err != nil {
+				return fmt.Errorf("jmapclient: invalid error response: %w", err)
+			}
+			return methodErr
+		}
+		if v == nil {
+			return nil
+		}
+		if err := json.Unmarshal(invocation.Args, v); err != nil {
+			return fmt.Errorf("jmapclient: invalid %s response: %w", invocation.Name, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("jmapclient: no response to call %s", call.ID)
+}
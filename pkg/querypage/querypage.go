@@ -0,0 +1,252 @@
+// Package querypage is the paging part of the plugin contract for /query
+// methods (RFC 8620 section 5.5). Plugins read the paging arguments of a
+// call with ParseRequest and either page an ordered result list with Page or
+// build a Response themselves, and write it into their method response with
+// Apply, so every plugin's /query pages the same way. jmap-api checks the
+// same arguments before invoking a plugin and its response with Check.
+//
+//	req, err := querypage.ParseRequest(args)
+//	if err != nil {
+//		return invalidArguments(err)
+//	}
+//	page, err := querypage.Page(req, ids, 256)
+//	if errors.Is(err, querypage.ErrAnchorNotFound) {
+//		return anchorNotFound()
+//	}
+//	page.QueryState = state
+//	page.Apply(responseArgs)
+package querypage
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+// QuerySuffix ends the name of every /query method
+const QuerySuffix = "/query"
+
+// ErrAnchorNotFound is returned by Page when the anchor is not in the
+// results; plugins answer it with an anchorNotFound method error
+var ErrAnchorNotFound = errors.New("anchor not found in the results")
+
+// IsQuery reports whether method is a /query method, such as Email/query
+func IsQuery(method string) bool {
+	return strings.HasSuffix(method, QuerySuffix) && len(method) > len(QuerySuffix)
+}
+
+// Request is the paging arguments of a /query call
+type Request struct {
+	// Position is the index of the first result to return; a negative
+	// Position counts back from the end of the results. It is ignored when
+	// Anchor is set.
+	Position int
+	// Anchor is the ID of a result to page from, or empty
+	Anchor string
+	// AnchorOffset is added to the index of Anchor
+	AnchorOffset int
+	// Limit is the most IDs to return, or nil for no limit
+	Limit *int
+	// CalculateTotal asks for the total number of results
+	CalculateTotal bool
+}
+
+// Response is the paging part of a /query response
+type Response struct {
+	QueryState          string
+	CanCalculateChanges bool
+	// Position is the index of the first ID returned
+	Position int
+	IDs      []string
+	// Total is the number of results, set when the request asked for it
+	Total *int
+	// Limit is set when the plugin returned fewer IDs than were asked for
+	// because of its own maximum
+	Limit *int
+}
+
+// ParseRequest reads the paging arguments of a /query call. The error
+// describes the first invalid argument, for an invalidArguments method
+// error.
+func ParseRequest(args map[string]any) (Request, error) {
+	var req Request
+	var err error
+	if req.Position, err = intArg(args, "position", math.MinInt); err != nil {
+		return Request{}, err
+	}
+	if value, ok := args["anchor"]; ok && value != nil {
+		anchor, ok := value.(string)
+		if !ok || anchor == "" {
+			return Request{}, fmt.Errorf("anchor must be a non-empty string or null")
+		}
+		req.Anchor = anchor
+	}
+	if req.AnchorOffset, err = intArg(args, "anchorOffset", math.MinInt); err != nil {
+		return Request{}, err
+	}
+	if value, ok := args["limit"]; ok && value != nil {
+		limit, err := intArg(args, "limit", 0)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Limit = &limit
+	}
+	if value, ok := args["calculateTotal"]; ok && value != nil {
+		if req.CalculateTotal, ok = value.(bool); !ok {
+			return Request{}, fmt.Errorf("calculateTotal must be a boolean")
+		}
+	}
+	return req, nil
+}
+
+// Page returns the page req asks for of the ordered results ids, returning
+// at most maxLimit IDs when maxLimit is positive. The caller sets
+// QueryState and CanCalculateChanges.
+func Page(req Request, ids []string, maxLimit int) (Response, error) {
+	start := req.Position
+	if req.Anchor != "" {
+		index := slices.Index(ids, req.Anchor)
+		if index < 0 {
+			return Response{}, ErrAnchorNotFound
+		}
+		start = max(index+req.AnchorOffset, 0)
+	} else if start < 0 {
+		start = max(len(ids)+start, 0)
+	}
+	start = min(start, len(ids))
+
+	var resp Response
+	limit := len(ids) - start
+	if req.Limit != nil {
+		limit = min(limit, *req.Limit)
+	}
+	if maxLimit > 0 && limit > maxLimit {
+		limit = maxLimit
+		resp.Limit = &maxLimit
+	}
+	resp.Position = start
+	resp.IDs = slices.Clone(ids[start : start+limit])
+	if req.CalculateTotal {
+		total := len(ids)
+		resp.Total = &total
+	}
+	return resp, nil
+}
+
+// Apply writes the response's paging fields into the arguments of a /query
+// method response
+func (r Response) Apply(args map[string]any) {
+	args["queryState"] = r.QueryState
+	args["canCalculateChanges"] = r.CanCalculateChanges
+	args["position"] = r.Position
+	ids := r.IDs
+	if ids == nil {
+		ids = []string{}
+	}
+	args["ids"] = ids
+	if r.Total != nil {
+		args["total"] = *r.Total
+	}
+	if r.Limit != nil {
+		args["limit"] = *r.Limit
+	}
+}
+
+// Check reports whether the arguments of a /query method response are a
+// consistent answer to req: the paging fields have the right types, the
+// total is present if it was asked for and covers the page, and no more IDs
+// are returned than the request's or the response's limit.
+func Check(req Request, args map[string]any) error {
+	if state, ok := args["queryState"].(string); !ok || state == "" {
+		return fmt.Errorf("queryState must be a non-empty string")
+	}
+	if _, ok := args["canCalculateChanges"].(bool); !ok {
+		return fmt.Errorf("canCalculateChanges must be a boolean")
+	}
+	if _, ok := args["position"]; !ok {
+		return fmt.Errorf("position is missing")
+	}
+	position, err := intArg(args, "position", 0)
+	if err != nil {
+		return err
+	}
+	ids, ok := stringList(args["ids"])
+	if !ok {
+		return fmt.Errorf("ids must be an array of strings")
+	}
+
+	if _, ok := args["total"]; ok {
+		total, err := intArg(args, "total", 0)
+		if err != nil {
+			return err
+		}
+		if len(ids) > 0 && position+len(ids) > total {
+			return fmt.Errorf("%d ids from position %d exceed the total of %d", len(ids), position, total)
+		}
+	} else if req.CalculateTotal {
+		return fmt.Errorf("total is missing but calculateTotal was requested")
+	}
+
+	if req.Limit != nil && len(ids) > *req.Limit {
+		return fmt.Errorf("%d ids exceed the requested limit of %d", len(ids), *req.Limit)
+	}
+	if _, ok := args["limit"]; ok {
+		limit, err := intArg(args, "limit", 0)
+		if err != nil {
+			return err
+		}
+		if len(ids) > limit {
+			return fmt.Errorf("%d ids exceed the returned limit of %d", len(ids), limit)
+		}
+	}
+	return nil
+}
+
+// intArg reads an optional integer argument no less than minimum, as JSON
+// decodes it or as a plugin builds it
+func intArg(args map[string]any, name string, minimum int) (int, error) {
+	value, ok := args[name]
+	if !ok {
+		return 0, nil
+	}
+	var f float64
+	switch v := value.(type) {
+	case float64:
+		f = v
+	case int:
+		f = float64(v)
+	case int64:
+		f = float64(v)
+	default:
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	if f != math.Trunc(f) || math.Abs(f) > 1<<53 {
+		return 0, fmt.Errorf("%s must be an integer", name)
+	}
+	if f < float64(minimum) {
+		return 0, fmt.Errorf("%s must not be negative", name)
+	}
+	return int(f), nil
+}
+
+// stringList reads an array of strings, as JSON decodes it or as a plugin
+// builds it
+func stringList(value any) ([]string, bool) {
+	switch v := value.(type) {
+	case []string:
+		return v, true
+	case []any:
+		ids := make([]string, 0, len(v))
+		for _, item := range v {
+			id, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			ids = append(ids, id)
+		}
+		return ids, true
+	}
+	return nil, false
+}
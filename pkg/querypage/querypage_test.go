@@ -0,0 +1,160 @@
+package querypage
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func decode(t *testing.T, args string) map[string]any {
+	t.Helper()
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(args), &decoded); err != nil {
+		t.Fatalf("invalid test args: %v", err)
+	}
+	return decoded
+}
+
+func TestIsQuery(t *testing.T) {
+	for method, want := range map[string]bool{
+		"Email/query":        true,
+		"Email/queryChanges": false,
+		"Email/get":          false,
+		"/query":             false,
+	} {
+		if got := IsQuery(method); got != want {
+			t.Errorf("IsQuery(%q) = %v, want %v", method, got, want)
+		}
+	}
+}
+
+func TestParseRequest(t *testing.T) {
+	req, err := ParseRequest(decode(t, `{"accountId":"a1","position":-5,"anchorOffset":-1,"limit":10,"calculateTotal":true}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if req.Position != -5 || req.AnchorOffset != -1 || req.Limit == nil || *req.Limit != 10 || !req.CalculateTotal {
+		t.Errorf("unexpected request %+v", req)
+	}
+
+	req, err = ParseRequest(decode(t, `{"anchor":"M2","limit":null}`))
+	if err != nil || req.Anchor != "M2" || req.Limit != nil {
+		t.Errorf("unexpected request %+v, %v", req, err)
+	}
+}
+
+func TestParseRequest_Invalid(t *testing.T) {
+	tests := []struct {
+		args string
+		want string
+	}{
+		{`{"position":1.5}`, "position must be an integer"},
+		{`{"position":"1"}`, "position must be an integer"},
+		{`{"anchor":""}`, "anchor must be"},
+		{`{"anchorOffset":true}`, "anchorOffset must be an integer"},
+		{`{"limit":-1}`, "limit must not be negative"},
+		{`{"calculateTotal":"yes"}`, "calculateTotal must be a boolean"},
+	}
+	for _, tt := range tests {
+		if _, err := ParseRequest(decode(t, tt.args)); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseRequest(%s) = %v, want an error containing %q", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	ids := []string{"M0", "M1", "M2", "M3", "M4"}
+	limit := func(n int) *int { return &n }
+	tests := []struct {
+		name     string
+		req      Request
+		maxLimit int
+		position int
+		ids      []string
+		limit    *int
+	}{
+		{"everything", Request{}, 0, 0, ids, nil},
+		{"position and limit", Request{Position: 1, Limit: limit(2)}, 0, 1, []string{"M1", "M2"}, nil},
+		{"negative position", Request{Position: -2}, 0, 3, []string{"M3", "M4"}, nil},
+		{"negative position before the start", Request{Position: -9, Limit: limit(1)}, 0, 0, []string{"M0"}, nil},
+		{"position past the end", Request{Position: 9}, 0, 5, []string{}, nil},
+		{"anchor", Request{Anchor: "M3", AnchorOffset: -1, Limit: limit(2)}, 0, 2, []string{"M2", "M3"}, nil},
+		{"anchor offset before the start", Request{Anchor: "M1", AnchorOffset: -3}, 0, 0, ids, nil},
+		{"clamped to the maximum", Request{Limit: limit(4)}, 3, 0, []string{"M0", "M1", "M2"}, limit(3)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := Page(tt.req, ids, tt.maxLimit)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if page.Position != tt.position || !reflect.DeepEqual(page.IDs, tt.ids) || !reflect.DeepEqual(page.Limit, tt.limit) {
+				t.Errorf("got position %d, ids %v and limit %v", page.Position, page.IDs, page.Limit)
+			}
+			if page.Total != nil {
+				t.Errorf("expected no total, got %d", *page.Total)
+			}
+		})
+	}
+}
+
+func TestPage_TotalAndMissingAnchor(t *testing.T) {
+	page, err := Page(Request{CalculateTotal: true, Limit: new(int)}, []string{"M0", "M1"}, 0)
+	if err != nil || page.Total == nil || *page.Total != 2 || len(page.IDs) != 0 {
+		t.Errorf("unexpected page %+v, %v", page, err)
+	}
+
+	if _, err := Page(Request{Anchor: "M9"}, []string{"M0"}, 0); !errors.Is(err, ErrAnchorNotFound) {
+		t.Errorf("expected ErrAnchorNotFound, got %v", err)
+	}
+}
+
+func TestApplyThenCheck(t *testing.T) {
+	req := Request{Position: 1, CalculateTotal: true}
+	page, err := Page(req, []string{"M0", "M1", "M2"}, 0)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	page.QueryState = "q1"
+	args := map[string]any{"accountId": "a1"}
+	page.Apply(args)
+
+	if args["position"] != 1 || args["total"] != 3 || args["canCalculateChanges"] != false {
+		t.Errorf("unexpected args %v", args)
+	}
+	if _, ok := args["limit"]; ok {
+		t.Error("expected no limit when the page was not clamped")
+	}
+	if err := Check(req, args); err != nil {
+		t.Errorf("unexpected failure %v", err)
+	}
+}
+
+func TestCheck_Failures(t *testing.T) {
+	limit := 2
+	tests := []struct {
+		name string
+		req  Request
+		args string
+		want string
+	}{
+		{"no queryState", Request{}, `{"canCalculateChanges":false,"position":0,"ids":[]}`, "queryState"},
+		{"no canCalculateChanges", Request{}, `{"queryState":"q","position":0,"ids":[]}`, "canCalculateChanges"},
+		{"no position", Request{}, `{"queryState":"q","canCalculateChanges":false,"ids":[]}`, "position is missing"},
+		{"negative position", Request{}, `{"queryState":"q","canCalculateChanges":false,"position":-1,"ids":[]}`, "position must not be negative"},
+		{"ids not strings", Request{}, `{"queryState":"q","canCalculateChanges":false,"position":0,"ids":[1]}`, "ids must be"},
+		{"no total", Request{CalculateTotal: true}, `{"queryState":"q","canCalculateChanges":false,"position":0,"ids":[]}`, "total is missing"},
+		{"page past the total", Request{}, `{"queryState":"q","canCalculateChanges":false,"position":2,"ids":["a","b"],"total":3}`, "exceed the total"},
+		{"over the requested limit", Request{Limit: &limit}, `{"queryState":"q","canCalculateChanges":false,"position":0,"ids":["a","b","c"]}`, "requested limit"},
+		{"over the returned limit", Request{}, `{"queryState":"q","canCalculateChanges":false,"position":0,"ids":["a","b"],"limit":1}`, "returned limit"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.req, decode(t, tt.args)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Check() = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
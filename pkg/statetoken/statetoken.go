@@ -0,0 +1,131 @@
+// Package statetoken is the state part of the plugin contract: the opaque
+// state strings plugins return from /get, /query and /set and accept back
+// in /changes and /queryChanges (RFC 8620 sections 5.2 and 5.6). A token
+// carries the account it belongs to, the plugin's modification sequence and
+// when it was issued, with a checksum, so core can reject a corrupted,
+// foreign or expired token with cannotCalculateChanges before the plugin
+// sees it.
+//
+//	state := statetoken.Encode(statetoken.Token{AccountID: accountID, ModSeq: modSeq, IssuedAt: time.Now()})
+//	...
+//	token, err := statetoken.Decode(args["sinceState"].(string))
+//	changes := changesSince(token.ModSeq)
+//
+// The checksum is unkeyed, so it only detects accidental corruption such as
+// a truncated or mangled string. It gives no integrity: anyone can encode a
+// token, or change one and recompute its checksum. Plugins must still scope
+// what they return to the account they were invoked for, and treat the
+// modification sequence as untrusted input.
+package statetoken
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// version is the token format version, the first byte of every token
+const version = 1
+
+// headerSize is the version, issue time and modification sequence;
+// checksumSize the checksum that ends a token
+const (
+	headerSize   = 1 + 8 + 8
+	checksumSize = 8
+)
+
+var (
+	// ErrInvalid is returned for a token that is malformed, of another
+	// format, or fails its checksum
+	ErrInvalid = errors.New("state token is invalid")
+	// ErrWrongAccount is returned for a token issued for another account
+	ErrWrongAccount = errors.New("state token is for another account")
+	// ErrExpired is returned for a token older than the maximum age
+	ErrExpired = errors.New("state token has expired")
+)
+
+// Token is the content of a state token
+type Token struct {
+	AccountID string
+	// ModSeq is the plugin's modification sequence the state stands for
+	ModSeq   uint64
+	IssuedAt time.Time
+}
+
+// Encode returns the opaque state string for t. IssuedAt is kept to the
+// second.
+func Encode(t Token) string {
+	data := make([]byte, headerSize, headerSize+len(t.AccountID)+checksumSize)
+	data[0] = version
+	binary.BigEndian.PutUint64(data[1:9], uint64(t.IssuedAt.Unix()))
+	binary.BigEndian.PutUint64(data[9:17], t.ModSeq)
+	data = append(data, t.AccountID...)
+	data = append(data, checksum(data)...)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reads a state string written by Encode. The error wraps
+// ErrInvalid.
+func Decode(state string) (Token, error) {
+	data, err := base64.RawURLEncoding.DecodeString(state)
+	if err != nil || len(data) < headerSize+checksumSize {
+		return Token{}, ErrInvalid
+	}
+	body, sum := data[:len(data)-checksumSize], data[len(data)-checksumSize:]
+	if data[0] != version {
+		return Token{}, fmt.Errorf("%w: version %d", ErrInvalid, data[0])
+	}
+	if !bytes.Equal(sum, checksum(body)) {
+		return Token{}, fmt.Errorf("%w: checksum mismatch", ErrInvalid)
+	}
+	return Token{
+		AccountID: string(body[headerSize:]),
+		ModSeq:    binary.BigEndian.Uint64(body[9:17]),
+		IssuedAt:  time.Unix(int64(binary.BigEndian.Uint64(body[1:9])), 0).UTC(),
+	}, nil
+}
+
+// Verify decodes state and checks that it was issued for accountID and,
+// when maxAge is positive, no more than maxAge before now
+func Verify(state, accountID string, now time.Time, maxAge time.Duration) (Token, error) {
+	token, err := Decode(state)
+	if err != nil {
+		return Token{}, err
+	}
+	if token.AccountID != accountID {
+		return Token{}, ErrWrongAccount
+	}
+	if maxAge > 0 && now.Sub(token.IssuedAt) > maxAge {
+		return Token{}, ErrExpired
+	}
+	return token, nil
+}
+
+// SinceArgument returns the argument of method that holds a state token to
+// report changes since: sinceState for /changes methods, sinceQueryState
+// for /queryChanges methods, and "" for any other method
+func SinceArgument(method string) string {
+	slash := strings.LastIndex(method, "/")
+	if slash <= 0 {
+		return ""
+	}
+	switch method[slash+1:] {
+	case "changes":
+		return "sinceState"
+	case "queryChanges":
+		return "sinceQueryState"
+	}
+	return ""
+}
+
+// checksum is the first bytes of the SHA-256 of a token's body. It is not a
+// MAC; see the package documentation.
+func checksum(body []byte) []byte {
+	sum := sha256.Sum256(body)
+	return sum[:checksumSize]
+}
@@ -0,0 +1,79 @@
+package statetoken
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var issued = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func TestEncodeDecode_RoundTrip(t *testing.T) {
+	want := Token{AccountID: "user-123", ModSeq: 42, IssuedAt: issued}
+
+	got, err := Decode(Encode(want))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	valid := Encode(Token{AccountID: "user-123", ModSeq: 42, IssuedAt: issued})
+	corrupted := []byte(valid)
+	corrupted[len(corrupted)/2] ^= 1
+
+	for name, state := range map[string]string{
+		"empty":       "",
+		"not base64":  "not a token!",
+		"too short":   "AQ",
+		"corrupted":   string(corrupted),
+		"other state": "s-1234",
+	} {
+		if _, err := Decode(state); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: expected ErrInvalid, got %v", name, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	state := Encode(Token{AccountID: "user-123", ModSeq: 42, IssuedAt: issued})
+	tests := []struct {
+		name    string
+		account string
+		now     time.Time
+		maxAge  time.Duration
+		want    error
+	}{
+		{"current", "user-123", issued.Add(time.Hour), 24 * time.Hour, nil},
+		{"no maximum age", "user-123", issued.Add(1000 * time.Hour), 0, nil},
+		{"another account", "user-456", issued, 0, ErrWrongAccount},
+		{"expired", "user-123", issued.Add(25 * time.Hour), 24 * time.Hour, ErrExpired},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := Verify(state, tt.account, tt.now, tt.maxAge)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+			if err == nil && token.ModSeq != 42 {
+				t.Errorf("unexpected token %+v", token)
+			}
+		})
+	}
+}
+
+func TestSinceArgument(t *testing.T) {
+	for method, want := range map[string]string{
+		"Email/changes":      "sinceState",
+		"Email/queryChanges": "sinceQueryState",
+		"Email/get":          "",
+		"changes":            "",
+	} {
+		if got := SinceArgument(method); got != want {
+			t.Errorf("SinceArgument(%q) = %q, want %q", method, got, want)
+		}
+	}
+}
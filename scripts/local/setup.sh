@@ -0,0 +1,51 @@
+#!/usr/bin/env bash
+#
+# Creates the DynamoDB table and blob bucket in the local stand-ins started
+# from docker-compose.yml, matching terraform/modules/jmap-service.
+#
+# Usage: ./setup.sh
+#
+# Prerequisites:
+#   - docker compose -f scripts/local/docker-compose.yml up -d
+#   - AWS CLI installed
+#
+
+set -euo pipefail
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+set -a
+# shellcheck source=local.env
+source "${SCRIPT_DIR}/local.env"
+set +a
+
+DYNAMODB_ENDPOINT="http://localhost:8000"
+S3_ENDPOINT="http://localhost:9000"
+
+if aws dynamodb describe-table --endpoint-url "$DYNAMODB_ENDPOINT" --table-name "$DYNAMODB_TABLE" >/dev/null 2>&1; then
+    echo "Table $DYNAMODB_TABLE already exists"
+else
+    echo "Creating table $DYNAMODB_TABLE..."
+    aws dynamodb create-table \
+        --endpoint-url "$DYNAMODB_ENDPOINT" \
+        --table-name "$DYNAMODB_TABLE" \
+        --billing-mode PAY_PER_REQUEST \
+        --attribute-definitions \
+            AttributeName=pk,AttributeType=S \
+            AttributeName=sk,AttributeType=S \
+            AttributeName=gsi1pk,AttributeType=S \
+            AttributeName=gsi1sk,AttributeType=S \
+        --key-schema AttributeName=pk,KeyType=HASH AttributeName=sk,KeyType=RANGE \
+        --global-secondary-indexes \
+            'IndexName=gsi1,KeySchema=[{AttributeName=gsi1pk,KeyType=HASH},{AttributeName=gsi1sk,KeyType=RANGE}],Projection={ProjectionType=ALL}' \
+        --stream-specification StreamEnabled=true,StreamViewType=NEW_AND_OLD_IMAGES \
+        >/dev/null
+fi
+
+if aws s3api head-bucket --endpoint-url "$S3_ENDPOINT" --bucket "$BLOB_BUCKET" >/dev/null 2>&1; then
+    echo "Bucket $BLOB_BUCKET already exists"
+else
+    echo "Creating bucket $BLOB_BUCKET..."
+    aws s3api create-bucket --endpoint-url "$S3_ENDPOINT" --bucket "$BLOB_BUCKET" >/dev/null
+fi
+
+echo "Local environment ready"
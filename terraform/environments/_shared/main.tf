@@ -75,8 +75,29 @@ module "jmap_service" {
   lambda_timeout                        = var.lambda_timeout
   domain_name                           = var.domain_name
   signed_url_expiry_seconds             = var.signed_url_expiry_seconds
+  signed_url_ipv4_prefix                = var.signed_url_ipv4_prefix
+  signed_url_ipv6_prefix                = var.signed_url_ipv6_prefix
+  blob_cache_size                       = var.blob_cache_size
+  blob_cache_ttl_seconds                = var.blob_cache_ttl_seconds
+  blob_scanning_enabled                 = var.blob_scanning_enabled
+  upload_progress_events                = var.upload_progress_events
+  blob_tag_keys                         = var.blob_tag_keys
+  blob_content_sniffing                 = var.blob_content_sniffing
+  blob_download_regions                 = var.blob_download_regions
+  blob_access_point_accounts            = var.blob_access_point_accounts
   cloudfront_signing_key_rotation_phase = var.cloudfront_signing_key_rotation_phase
   cloudfront_signing_key_max_age_days   = var.cloudfront_signing_key_max_age_days
+  log_level                             = var.log_level
+  log_level_refresh_seconds             = var.log_level_refresh_seconds
+  log_debug_principals                  = var.log_debug_principals
+  log_sample_percent                    = var.log_sample_percent
+  idempotency_ttl_seconds               = var.idempotency_ttl_seconds
+  otel_metrics_enabled                  = var.otel_metrics_enabled
+  tracing_backend                       = var.tracing_backend
+  tracing_otlp_endpoint                 = var.tracing_otlp_endpoint
+  tracing_otlp_headers                  = var.tracing_otlp_headers
+  canary_account_id                     = var.canary_account_id
+  canary_schedule                       = var.canary_schedule
   alarm_sns_topic_arn                   = var.alarm_sns_topic_arn
   test_user_emails                      = var.test_user_emails
 }
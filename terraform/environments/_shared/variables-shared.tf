@@ -43,6 +43,138 @@ variable "signed_url_expiry_seconds" {
   default     = 300
 }
 
+variable "signed_url_ipv4_prefix" {
+  description = "Prefix length of the requester's IPv4 range that signed URLs are bound to (0 leaves them unbound)"
+  type        = number
+  default     = 0
+}
+
+variable "signed_url_ipv6_prefix" {
+  description = "Prefix length of the requester's IPv6 range that signed URLs are bound to (0 leaves them unbound)"
+  type        = number
+  default     = 0
+}
+
+variable "blob_cache_size" {
+  description = "Number of blob records blob-download keeps in memory per Lambda instance (0 disables the cache)"
+  type        = number
+  default     = 0
+}
+
+variable "blob_cache_ttl_seconds" {
+  description = "How long blob-download reuses a cached blob record before reading it again"
+  type        = number
+  default     = 30
+}
+
+variable "blob_access_point_accounts" {
+  description = "Account IDs given their own S3 Access Point, limited to the account's prefix, which uploads and Blob/allocate URLs for the account go through"
+  type        = list(string)
+  default     = []
+}
+
+variable "blob_download_regions" {
+  description = "JSON object of replica region domains and the countries each serves, e.g. {\"domains\": {\"eu-west-1\": \"eu.cdn.example.com\"}, \"countries\": {\"DE\": \"eu-west-1\"}}; empty serves every download from the primary distribution"
+  type        = string
+  default     = ""
+}
+
+variable "blob_content_sniffing" {
+  description = "Check each allocated blob's declared content type against its first bytes on confirm: off, flag (record and flag mismatches) or correct (also replace the declared type)"
+  type        = string
+  default     = "off"
+
+  validation {
+    condition     = contains(["off", "flag", "correct"], var.blob_content_sniffing)
+    error_message = "blob_content_sniffing must be off, flag or correct"
+  }
+}
+
+variable "upload_progress_events" {
+  description = "Publish a blob.upload.part event for each part of a multipart upload when Blob/complete assembles it"
+  type        = bool
+  default     = false
+}
+
+variable "blob_tag_keys" {
+  description = "Extra S3 tag keys (at most 7, e.g. Source, Retention) clients may set on blobs with Blob/allocate or X-Tag-{Key} upload headers, for lifecycle rules to key on"
+  type        = list(string)
+  default     = []
+}
+
+variable "blob_scanning_enabled" {
+  description = "Publish a blob.scan.requested event for each confirmed blob, for a scanner plugin to report a verdict on"
+  type        = bool
+  default     = false
+}
+
+variable "log_level" {
+  description = "Initial log level for all Lambda functions (DEBUG, INFO, WARN or ERROR)"
+  type        = string
+  default     = "INFO"
+}
+
+variable "log_level_refresh_seconds" {
+  description = "How often Lambda functions re-read the log level SSM parameter (0 uses log_level only)"
+  type        = number
+  default     = 0
+}
+
+variable "log_debug_principals" {
+  description = "Cognito subs and IAM role ARNs that may request debug logging for a single request with the X-Debug-Log header"
+  type        = list(string)
+  default     = []
+}
+
+variable "otel_metrics_enabled" {
+  description = "Export jmap-api's OpenTelemetry metrics through the ADOT collector"
+  type        = bool
+  default     = false
+}
+
+variable "tracing_backend" {
+  description = "Where Lambda functions send traces: xray (through the ADOT collector) or otlp (straight to tracing_otlp_endpoint)"
+  type        = string
+  default     = "xray"
+}
+
+variable "tracing_otlp_endpoint" {
+  description = "OTLP gRPC endpoint for traces when tracing_backend is otlp, e.g. https://api.honeycomb.io:443"
+  type        = string
+  default     = ""
+}
+
+variable "tracing_otlp_headers" {
+  description = "Headers sent with OTLP traces, such as API keys, when tracing_backend is otlp"
+  type        = map(string)
+  default     = {}
+  sensitive   = true
+}
+
+variable "log_sample_percent" {
+  description = "Percentage of jmap-api requests whose method calls and responses are logged in full, with email addresses and content redacted (0 disables)"
+  type        = number
+  default     = 0
+}
+
+variable "idempotency_ttl_seconds" {
+  description = "How long jmap-api keeps responses to replay for requests repeating an Idempotency-Key (0 ignores the header)"
+  type        = number
+  default     = 86400
+}
+
+variable "canary_account_id" {
+  description = "Account the canary calls Core/ping on. It doesn't need to be provisioned."
+  type        = string
+  default     = "canary"
+}
+
+variable "canary_schedule" {
+  description = "EventBridge schedule expression for the canary"
+  type        = string
+  default     = "rate(5 minutes)"
+}
+
 variable "cloudfront_signing_key_rotation_phase" {
   description = "CloudFront signing key rotation phase: 'normal', 'rotating', or 'complete'"
   type        = string
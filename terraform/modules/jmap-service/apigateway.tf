@@ -2,13 +2,17 @@
 
 locals {
   openapi_body = templatefile("${path.module}/openapi.yaml", {
-    cognito_user_pool_arn       = aws_cognito_user_pool.main.arn
-    aws_region                  = var.aws_region
-    get_jmap_session_lambda_arn = aws_lambda_function.get_jmap_session.arn
-    jmap_api_lambda_arn         = aws_lambda_function.jmap_api.arn
-    blob_upload_lambda_arn      = aws_lambda_function.blob_upload.arn
-    blob_download_lambda_arn    = aws_lambda_function.blob_download.arn
-    blob_delete_lambda_arn      = aws_lambda_function.blob_delete.arn
+    cognito_user_pool_arn        = aws_cognito_user_pool.main.arn
+    aws_region                   = var.aws_region
+    get_jmap_session_lambda_arn  = aws_lambda_function.get_jmap_session.arn
+    jmap_api_lambda_arn          = aws_lambda_function.jmap_api.arn
+    blob_upload_lambda_arn       = aws_lambda_function.blob_upload.arn
+    blob_download_lambda_arn     = aws_lambda_function.blob_download.arn
+    blob_delete_lambda_arn       = aws_lambda_function.blob_delete.arn
+    account_admin_lambda_arn     = aws_lambda_function.account_admin.arn
+    event_replay_lambda_arn      = aws_lambda_function.event_replay.arn
+    health_lambda_arn            = aws_lambda_function.health.arn
+    apikey_authorizer_lambda_arn = aws_lambda_function.apikey_authorizer.arn
   })
 }
 
@@ -0,0 +1,64 @@
+# Blob Metadata Encryption
+#
+# When blob_metadata_kms_key_arn is set, blob records' content types and
+# parent tags are envelope-encrypted with data keys from that key. Lambdas
+# that write blob records generate data keys; those that read them decrypt.
+
+locals {
+  blob_metadata_encryption_enabled = var.blob_metadata_kms_key_arn != ""
+}
+
+data "aws_iam_policy_document" "blob_metadata_kms" {
+  count = local.blob_metadata_encryption_enabled ? 1 : 0
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "kms:GenerateDataKey",
+      "kms:Decrypt"
+    ]
+    resources = [var.blob_metadata_kms_key_arn]
+  }
+}
+
+resource "aws_iam_role_policy" "jmap_api_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-jmap-api-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.jmap_api_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
+
+resource "aws_iam_role_policy" "blob_upload_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-upload-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.blob_upload_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
+
+resource "aws_iam_role_policy" "blob_download_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-download-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.blob_download_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
+
+resource "aws_iam_role_policy" "account_export_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-account-export-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.account_export_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
+
+resource "aws_iam_role_policy" "account_import_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-account-import-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
+
+resource "aws_iam_role_policy" "account_admin_blob_metadata_kms" {
+  count  = local.blob_metadata_encryption_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-account-admin-blob-metadata-kms-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.blob_metadata_kms[0].json
+}
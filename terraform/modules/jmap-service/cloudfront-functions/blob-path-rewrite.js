@@ -1,7 +1,10 @@
 // CloudFront function to rewrite /blobs/* paths for S3 origin
 // Strips the /blobs prefix so /blobs/accountId/blobId becomes /accountId/blobId
-// Also handles composite blobIds with byte ranges: /blobs/accountId/blobId,start,end
-// Extracts range and adds Range header for partial content requests
+// Ranged downloads carry their inclusive byte range in the range query
+// parameter (?range=start-end), checked against the blob by blob-download and
+// covered by the URL's signature; it becomes the Range header for S3.
+// URLs signed before ranges moved to the query string carry the range in a
+// composite blobId instead: /blobs/accountId/blobId,start,end
 function handler(event) {
     var request = event.request;
 
@@ -10,6 +13,17 @@ function handler(event) {
         request.uri = request.uri.substring(6); // Remove '/blobs' (6 chars)
     }
 
+    // Signed range from blob-download: copy it into the Range header
+    var range = request.querystring['range'];
+    if (range) {
+        // Only the form blob-download produces; anything else is dropped
+        if (/^\d+-\d+$/.test(range.value)) {
+            request.headers['range'] = { value: 'bytes=' + range.value };
+        }
+        delete request.querystring['range'];
+        return request;
+    }
+
     // Check for range suffix in blobId: /accountId/blobId,start,end
     var lastSlash = request.uri.lastIndexOf('/');
     if (lastSlash >= 0) {
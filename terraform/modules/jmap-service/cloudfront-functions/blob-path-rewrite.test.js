@@ -16,10 +16,11 @@ vm.runInContext(functionCode, vm.createContext(context));
 const handler = context.handler;
 
 // Helper to create a mock CloudFront event
-function createEvent(uri) {
+function createEvent(uri, querystring) {
     return {
         request: {
             uri: uri,
+            querystring: querystring || {},
             headers: {}
         }
     };
@@ -43,6 +44,37 @@ describe('blob-path-rewrite CloudFront function', () => {
         });
     });
 
+    describe('signed range query parameter', () => {
+        test('copies the range into the Range header', () => {
+            const event = createEvent('/blobs/acct123/blob456', { range: { value: '1024-5119' } });
+            const result = handler(event);
+
+            expect(result.uri).toBe('/acct123/blob456');
+            expect(result.headers['range']).toEqual({ value: 'bytes=1024-5119' });
+            expect(result.querystring['range']).toBeUndefined();
+        });
+
+        test('keeps other query parameters', () => {
+            const event = createEvent('/blobs/acct123/blob456', {
+                range: { value: '0-99' },
+                'response-content-disposition': { value: 'attachment' }
+            });
+            const result = handler(event);
+
+            expect(result.headers['range']).toEqual({ value: 'bytes=0-99' });
+            expect(result.querystring['response-content-disposition']).toEqual({ value: 'attachment' });
+        });
+
+        test('drops a malformed range', () => {
+            const event = createEvent('/blobs/acct123/blob456', { range: { value: '0-99,200-299' } });
+            const result = handler(event);
+
+            expect(result.uri).toBe('/acct123/blob456');
+            expect(result.headers['range']).toBeUndefined();
+            expect(result.querystring['range']).toBeUndefined();
+        });
+    });
+
     describe('range extraction from composite blobId', () => {
         test('extracts range from composite blobId and adds Range header', () => {
             const event = createEvent('/blobs/acct123/blob456,0,999');
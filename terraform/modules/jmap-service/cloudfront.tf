@@ -38,6 +38,7 @@ resource "aws_cloudfront_function" "jmap_redirect" {
 
 # CloudFront Function for blob path rewrite
 # Strips /blobs prefix so /blobs/accountId/blobId becomes /accountId/blobId for S3
+# and turns the signed range query parameter into a Range header
 resource "aws_cloudfront_function" "blob_path_rewrite" {
   name    = "blob-path-rewrite-${var.environment}"
   runtime = "cloudfront-js-2.0"
@@ -153,8 +154,8 @@ resource "aws_cloudfront_distribution" "api" {
     cached_methods         = ["GET", "HEAD"]
     compress               = true
 
-    # Use managed cache policy for S3 origin
-    cache_policy_id = data.aws_cloudfront_cache_policy.caching_optimized.id
+    # Cache keyed on the signed response-content-disposition override
+    cache_policy_id = aws_cloudfront_cache_policy.blobs.id
 
     # Require signed URLs
     trusted_key_groups = [aws_cloudfront_key_group.blob_signing.id]
@@ -226,6 +227,33 @@ data "aws_cloudfront_cache_policy" "caching_optimized" {
   name = "Managed-CachingOptimized"
 }
 
+# Blob downloads: as Managed-CachingOptimized, but forwarding and keying on
+# the response-content-disposition query parameter S3 uses to name a download
+resource "aws_cloudfront_cache_policy" "blobs" {
+  name        = "jmap-blobs-${var.environment}"
+  default_ttl = 86400
+  max_ttl     = 31536000
+  min_ttl     = 1
+
+  parameters_in_cache_key_and_forwarded_to_origin {
+    enable_accept_encoding_brotli = true
+    enable_accept_encoding_gzip   = true
+
+    cookies_config {
+      cookie_behavior = "none"
+    }
+    headers_config {
+      header_behavior = "none"
+    }
+    query_strings_config {
+      query_string_behavior = "whitelist"
+      query_strings {
+        items = ["response-content-disposition"]
+      }
+    }
+  }
+}
+
 data "aws_cloudfront_origin_request_policy" "all_viewer_except_host_header" {
   name = "Managed-AllViewerExceptHostHeader"
 }
@@ -29,6 +29,8 @@ locals {
     blob-cleanup     = aws_cloudwatch_log_group.blob_cleanup_logs.arn
     blob-confirm     = aws_cloudwatch_log_group.blob_confirm_logs.arn
     core-echo        = aws_cloudwatch_log_group.core_echo_logs.arn
+    account-export   = aws_cloudwatch_log_group.account_export_logs.arn
+    account-import   = aws_cloudwatch_log_group.account_import_logs.arn
   }
 
   # Map of detector names to their resources for alarm aggregation
@@ -41,6 +43,8 @@ locals {
     aws_cloudwatch_log_anomaly_detector.blob_cleanup_anomaly.detector_name,
     aws_cloudwatch_log_anomaly_detector.blob_confirm_anomaly.detector_name,
     aws_cloudwatch_log_anomaly_detector.core_echo_anomaly.detector_name,
+    aws_cloudwatch_log_anomaly_detector.account_export_anomaly.detector_name,
+    aws_cloudwatch_log_anomaly_detector.account_import_anomaly.detector_name,
   ]
 }
 
@@ -6,6 +6,7 @@
 # - DynamoDB operations (capacity, throttling)
 # - S3 blob storage (operations, storage usage)
 # - Dead letter queues
+# - JMAP method calls (EMF metrics from jmap-api)
 # - Recent activity logs and errors
 
 locals {
@@ -344,7 +345,8 @@ resource "aws_cloudwatch_dashboard" "main" {
             period = 60
             metrics = [
               ["AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", aws_sqs_queue.blob_cleanup_dlq.name, { label = "blob-cleanup-dlq", color = "#d62728" }],
-              [".", ".", ".", aws_sqs_queue.blob_confirm_dlq.name, { label = "blob-confirm-dlq", color = "#ff7f0e" }]
+              [".", ".", ".", aws_sqs_queue.blob_confirm_dlq.name, { label = "blob-confirm-dlq", color = "#ff7f0e" }],
+              [".", ".", ".", aws_sqs_queue.dlq_parked.name, { label = "dlq-parked", color = "#8c564b" }]
             ]
             view = "timeSeries"
           }
@@ -420,6 +422,63 @@ resource "aws_cloudwatch_dashboard" "main" {
             view = "table"
           }
         }
+      ],
+
+      # Section Header: JMAP Methods
+      [
+        {
+          type   = "text"
+          x      = 0
+          y      = 58
+          width  = 24
+          height = 1
+          properties = {
+            markdown = "## JMAP Methods"
+          }
+        }
+      ],
+
+      # Section 9: JMAP Method Calls (y=59)
+      [
+        {
+          type   = "metric"
+          x      = 0
+          y      = 59
+          width  = 12
+          height = 6
+          properties = {
+            title  = "Method Calls & Errors"
+            region = var.aws_region
+            period = 300
+            metrics = [
+              [{ expression = "SEARCH('{JMAPService/${var.environment},Method,Plugin} MetricName=\"Invocations\"', 'Sum', 300)", id = "calls", label = "" }],
+              [{ expression = "SEARCH('{JMAPService/${var.environment},Method,Plugin} MetricName=\"Errors\"', 'Sum', 300)", id = "errors", label = "" }]
+            ]
+            view = "timeSeries"
+          }
+        },
+        {
+          type   = "metric"
+          x      = 12
+          y      = 59
+          width  = 12
+          height = 6
+          properties = {
+            title  = "Method Latency (p99)"
+            region = var.aws_region
+            period = 300
+            metrics = [
+              [{ expression = "SEARCH('{JMAPService/${var.environment},Method,Plugin} MetricName=\"Latency\"', 'p99', 300)", id = "latency", label = "" }]
+            ]
+            view = "timeSeries"
+            yAxis = {
+              left = {
+                label     = "Milliseconds"
+                showUnits = false
+              }
+            }
+          }
+        }
       ]
     )
   })
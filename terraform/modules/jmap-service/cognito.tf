@@ -111,3 +111,12 @@ resource "aws_cognito_user_pool_domain" "main" {
   domain       = "jmap-service-${var.environment}"
   user_pool_id = aws_cognito_user_pool.main.id
 }
+
+# Group whose members may use the Cognito admin routes (/admin/*). Users are
+# added to it out of band, e.g. with admin-add-user-to-group.
+resource "aws_cognito_user_group" "admins" {
+  count        = var.admin_cognito_group != "" ? 1 : 0
+  name         = var.admin_cognito_group
+  user_pool_id = aws_cognito_user_pool.main.id
+  description  = "Members may call the account admin API"
+}
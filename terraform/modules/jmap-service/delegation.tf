@@ -0,0 +1,68 @@
+# Plugin Delegation Tokens
+#
+# jmap-api signs a short-lived token into each plugin invocation. Plugins
+# present it when calling back into the IAM endpoints, which accept it in
+# place of registry trust for that one account.
+
+# =============================================================================
+# Signing Key
+# =============================================================================
+
+resource "random_password" "delegation_key" {
+  length  = 64
+  special = false
+}
+
+resource "aws_secretsmanager_secret" "delegation_key" {
+  name        = "${local.resource_prefix}-delegation-key-${var.environment}"
+  description = "HMAC key for plugin delegation tokens (auto-generated)"
+
+  tags = {
+    Name        = "${local.resource_prefix}-delegation-key-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_secretsmanager_secret_version" "delegation_key" {
+  secret_id     = aws_secretsmanager_secret.delegation_key.id
+  secret_string = random_password.delegation_key.result
+}
+
+# =============================================================================
+# IAM - Read Access for Signing and Verifying Lambdas
+# =============================================================================
+
+data "aws_iam_policy_document" "delegation_key_read" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "secretsmanager:GetSecretValue"
+    ]
+    resources = [aws_secretsmanager_secret.delegation_key.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "jmap_api_delegation_key" {
+  name   = "${local.resource_prefix}-jmap-api-delegation-key-${var.environment}"
+  role   = aws_iam_role.jmap_api_execution.id
+  policy = data.aws_iam_policy_document.delegation_key_read.json
+}
+
+resource "aws_iam_role_policy" "blob_upload_delegation_key" {
+  name   = "${local.resource_prefix}-blob-upload-delegation-key-${var.environment}"
+  role   = aws_iam_role.blob_upload_execution.id
+  policy = data.aws_iam_policy_document.delegation_key_read.json
+}
+
+resource "aws_iam_role_policy" "blob_download_delegation_key" {
+  name   = "${local.resource_prefix}-blob-download-delegation-key-${var.environment}"
+  role   = aws_iam_role.blob_download_execution.id
+  policy = data.aws_iam_policy_document.delegation_key_read.json
+}
+
+resource "aws_iam_role_policy" "blob_delete_delegation_key" {
+  name   = "${local.resource_prefix}-blob-delete-delegation-key-${var.environment}"
+  role   = aws_iam_role.blob_delete_execution.id
+  policy = data.aws_iam_policy_document.delegation_key_read.json
+}
@@ -26,6 +26,17 @@ resource "aws_dynamodb_table" "jmap_data" {
     type = "S"
   }
 
+  # GSI attributes for blobs allocated with indexed metadata
+  attribute {
+    name = "gsi2pk"
+    type = "S"
+  }
+
+  attribute {
+    name = "gsi2sk"
+    type = "S"
+  }
+
   # GSI for querying pending blob allocations across all accounts
   # Enables efficient cleanup of expired pending allocations
   global_secondary_index {
@@ -35,6 +46,22 @@ resource "aws_dynamodb_table" "jmap_data" {
     projection_type = "ALL"
   }
 
+  # GSI for finding an account's blobs by indexed metadata key and value
+  # Serves Blob/queryByMetadata, which only needs the blob IDs
+  global_secondary_index {
+    name               = "gsi2"
+    hash_key           = "gsi2pk"
+    range_key          = "gsi2sk"
+    projection_type    = "INCLUDE"
+    non_key_attributes = ["blobId", "status", "deletedAt"]
+  }
+
+  # Expire idle rate limit buckets
+  ttl {
+    attribute_name = "ttl"
+    enabled        = true
+  }
+
   stream_enabled   = true
   stream_view_type = "NEW_AND_OLD_IMAGES"
 
@@ -28,6 +28,34 @@ data "aws_iam_policy_document" "cloudwatch_metrics" {
   }
 }
 
+# IAM policy for publishing plugin events to eventbridge, sns and webhook targets
+data "aws_iam_policy_document" "event_bus_publish" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "events:PutEvents"
+    ]
+    resources = ["arn:aws:events:*:${data.aws_caller_identity.current.account_id}:event-bus/*"]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "sns:Publish"
+    ]
+    resources = ["arn:aws:sns:*:${data.aws_caller_identity.current.account_id}:*"]
+  }
+
+  # Webhook signing secrets must be named jmap-webhook-*
+  statement {
+    effect = "Allow"
+    actions = [
+      "secretsmanager:GetSecretValue"
+    ]
+    resources = ["arn:aws:secretsmanager:*:${data.aws_caller_identity.current.account_id}:secret:jmap-webhook-*"]
+  }
+}
+
 # IAM role for get-jmap-session Lambda function
 resource "aws_iam_role" "get_jmap_session_execution" {
   name               = "${local.resource_prefix}-get-jmap-session-execution-${var.environment}"
@@ -125,8 +153,12 @@ data "aws_iam_policy_document" "jmap_api_dynamodb" {
       "dynamodb:TransactWriteItems", # For Blob/allocate transactions
       "dynamodb:UpdateItem",         # Required for Update operations within transactions
       "dynamodb:PutItem",            # Required for Put operations within transactions
+      "dynamodb:DeleteItem",         # Releases Idempotency-Key claims
+    ]
+    resources = [
+      aws_dynamodb_table.jmap_data.arn,
+      "${aws_dynamodb_table.jmap_data.arn}/index/gsi2", # Blob/queryByMetadata
     ]
-    resources = [aws_dynamodb_table.jmap_data.arn]
   }
 }
 
@@ -165,8 +197,9 @@ data "aws_iam_policy_document" "jmap_api_s3_presign" {
       "s3:UploadPart",
       "s3:CompleteMultipartUpload",
       "s3:AbortMultipartUpload",
+      "s3:ListMultipartUploadParts",
     ]
-    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+    resources = concat(["${aws_s3_bucket.blobs.arn}/*"], local.blob_access_point_objects)
   }
 }
 
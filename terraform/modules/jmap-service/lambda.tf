@@ -19,11 +19,23 @@ resource "aws_lambda_function" "get_jmap_session" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT    = var.environment
       API_DOMAIN     = var.domain_name
       DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
 
+      # Authorizer claim holding the account ID
+      ACCOUNT_ID_CLAIM = var.account_id_claim
+
+      # Browser origins allowed by CORS
+      CORS_ALLOWED_ORIGINS = join(",", var.cors_allowed_origins)
+
+      # Per-account-type features
+      ACCOUNT_TYPE_FEATURES = local.account_type_features_json
+
+      # Longest a long-polling session request is held
+      SESSION_MAX_WAIT_SECONDS = tostring(var.session_max_wait_seconds)
+
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
       OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
@@ -41,7 +53,7 @@ resource "aws_lambda_function" "get_jmap_session" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -90,19 +102,71 @@ resource "aws_lambda_function" "jmap_api" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT    = var.environment
       API_DOMAIN     = var.domain_name
       DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
 
+      # Authorizer claim holding the account ID
+      ACCOUNT_ID_CLAIM = var.account_id_claim
+
+      # Browser origins allowed by CORS
+      CORS_ALLOWED_ORIGINS = join(",", var.cors_allowed_origins)
+
+      # Key for plugin delegation tokens
+      DELEGATION_SECRET_ARN = aws_secretsmanager_secret.delegation_key.arn
+
       # Blob/allocate configuration
       BLOB_BUCKET                   = aws_s3_bucket.blobs.bucket
       MAX_SIZE_UPLOAD_PUT           = tostring(var.max_size_upload_put)
       MAX_PENDING_ALLOCATIONS       = tostring(var.max_pending_allocations)
       ALLOCATION_URL_EXPIRY_SECONDS = tostring(var.allocation_url_expiry_seconds)
+      BLOB_ACCESS_POINTS            = local.blob_access_points
+      UPLOAD_PROGRESS_EVENTS        = tostring(var.upload_progress_events)
+      BLOB_TAG_KEYS                 = join(",", var.blob_tag_keys)
+      QUOTA_GRACE_PERCENT           = tostring(var.quota_grace_percent)
+      QUOTA_GRACE_PERIOD_SECONDS    = tostring(var.quota_grace_period_seconds)
+
+      # Optional envelope encryption of blob record metadata
+      BLOB_METADATA_KMS_KEY_ARN = var.blob_metadata_kms_key_arn
+      BLOB_ENCRYPTED_ATTRIBUTES = join(",", var.blob_encrypted_attributes)
+
+      # Namespace of per-method EMF metrics
+      METRIC_NAMESPACE = "JMAPService/${var.environment}"
+
+      # OTel metrics (dispatcher, plugin and presign latency) via the collector
+      OTEL_METRICS_EXPORTER = var.otel_metrics_enabled ? "otlp" : "none"
+
+      # Percentage of requests whose method calls are logged, redacted
+      LOG_SAMPLE_PERCENT = tostring(var.log_sample_percent)
+
+      # Reject a request with any invalid method call before running it
+      JMAP_STRICT_VALIDATION = tostring(var.jmap_strict_validation)
+
+      # Strongly consistent plugin registry loads
+      REGISTRY_CONSISTENT_READ = tostring(var.registry_consistent_read)
+
+      # Oldest state token passed to a plugin's /changes method
+      STATE_TOKEN_MAX_AGE_SECONDS = tostring(var.state_token_max_age_seconds)
+
+      # Responses kept for Idempotency-Key replay
+      IDEMPOTENCY_TTL_SECONDS = tostring(var.idempotency_ttl_seconds)
 
       # Dispatcher configuration
       JMAP_DISPATCHER_PARALLELISM = tostring(var.jmap_dispatcher_parallelism)
+      PLUGIN_PREWARM              = tostring(var.plugin_prewarm)
+
+      # How often per-plugin latency statistics are flushed
+      PLUGIN_LATENCY_FLUSH_SECONDS = tostring(var.plugin_latency_flush_seconds)
+
+      # Rate limiting configuration
+      RATE_LIMIT_PER_SECOND = tostring(var.rate_limit_per_second)
+      RATE_LIMIT_BURST      = tostring(var.rate_limit_burst)
+      RATE_LIMIT_TIERS      = jsonencode(var.rate_limit_tiers)
+      CONCURRENCY_LIMIT     = tostring(var.concurrency_limit)
+
+      # Per-account-type features
+      ACCOUNT_TYPE_FEATURES = local.account_type_features_json
 
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
@@ -121,7 +185,7 @@ resource "aws_lambda_function" "jmap_api" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -131,6 +195,7 @@ resource "aws_lambda_function" "jmap_api" {
     aws_iam_role_policy.jmap_api_dynamodb,
     aws_iam_role_policy.jmap_api_lambda_invoke,
     aws_iam_role_policy.jmap_api_s3_presign,
+    aws_iam_role_policy.jmap_api_delegation_key,
     aws_cloudwatch_log_group.jmap_api_logs
   ]
 
@@ -0,0 +1,277 @@
+# Lambda function for account-admin (/admin-iam/*)
+# Administrative account operations such as suspension (IAM auth only, restricted to admin_principals)
+# Backfills existing S3 objects as blobs when blob_backfill_source_buckets is set.
+
+locals {
+  blob_backfill_enabled = length(var.blob_backfill_source_buckets) > 0
+}
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "account_admin_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-account-admin-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-admin-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-admin"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "account_admin_execution" {
+  name               = "${local.resource_prefix}-account-admin-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-admin-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-admin"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "account_admin_basic_execution" {
+  role       = aws_iam_role.account_admin_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "account_admin_xray_access" {
+  role       = aws_iam_role.account_admin_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "account_admin_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-account-admin-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (create, list and update account META# records, query blob usage, import jobs, aliases)
+data "aws_iam_policy_document" "account_admin_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem",
+      "dynamodb:ConditionCheckItem",
+      "dynamodb:Query",
+      "dynamodb:Scan"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "account_admin_dynamodb" {
+  name   = "${local.resource_prefix}-account-admin-dynamodb-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.account_admin_dynamodb.json
+}
+
+# IAM policy for S3 access (copy backfilled objects into the blob bucket),
+# only when backfill source buckets are configured
+data "aws_iam_policy_document" "account_admin_s3" {
+  count = local.blob_backfill_enabled ? 1 : 0
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:GetObject",
+      "s3:GetObjectTagging"
+    ]
+    resources = [for bucket in var.blob_backfill_source_buckets : "arn:aws:s3:::${bucket}/*"]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:PutObject",
+      "s3:PutObjectTagging"
+    ]
+    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "account_admin_s3" {
+  count  = local.blob_backfill_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-account-admin-s3-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.account_admin_s3[0].json
+}
+
+# IAM policy for SQS access (SendMessage to plugin event queues)
+data "aws_iam_policy_document" "account_admin_sqs" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+    ]
+    resources = [
+      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*"
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "account_admin_sqs" {
+  name   = "${local.resource_prefix}-account-admin-sqs-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.account_admin_sqs.json
+}
+
+# IAM policy for EventBridge access (PutEvents to plugin event buses)
+resource "aws_iam_role_policy" "account_admin_events" {
+  name   = "${local.resource_prefix}-account-admin-events-${var.environment}"
+  role   = aws_iam_role.account_admin_execution.id
+  policy = data.aws_iam_policy_document.event_bus_publish.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "account_admin" {
+  filename         = "${path.module}/../../../build/account-admin/lambda.zip"
+  function_name    = "${local.resource_prefix}-account-admin-${var.environment}"
+  role             = aws_iam_role.account_admin_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/account-admin/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = var.lambda_timeout
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT         = var.environment
+      DYNAMODB_TABLE      = aws_dynamodb_table.jmap_data.name
+      ADMIN_PRINCIPALS    = join(",", var.admin_principals)
+      ADMIN_COGNITO_GROUP = var.admin_cognito_group
+      QUOTA_TIERS         = jsonencode(var.quota_tiers)
+      DEFAULT_QUOTA_BYTES = tostring(var.default_quota_bytes)
+
+      # Blob bucket backfilled objects are copied into; empty disables backfill
+      BLOB_BUCKET = local.blob_backfill_enabled ? aws_s3_bucket.blobs.bucket : ""
+
+      # Backfilled blob records are written as blob-upload writes them
+      BLOB_METADATA_KMS_KEY_ARN = var.blob_metadata_kms_key_arn
+      BLOB_ENCRYPTED_ATTRIBUTES = join(",", var.blob_encrypted_attributes)
+      BLOB_SCANNING_ENABLED     = tostring(var.blob_scanning_enabled)
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-account-admin-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.account_admin_basic_execution,
+    aws_iam_role_policy_attachment.account_admin_xray_access,
+    aws_iam_role_policy.account_admin_cloudwatch_metrics,
+    aws_iam_role_policy.account_admin_dynamodb,
+    aws_iam_role_policy.account_admin_s3,
+    aws_cloudwatch_log_group.account_admin_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-admin-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-admin"
+  }
+}
+
+# API Gateway permission to invoke account-admin Lambda
+resource "aws_lambda_permission" "account_admin_apigw" {
+  statement_id  = "AllowAPIGatewayInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.account_admin.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_api_gateway_rest_api.api.execution_arn}/*"
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "account_admin_errors" {
+  name           = "${local.resource_prefix}-account-admin-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.account_admin_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "AccountAdminErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for account-admin Lambda errors
+resource "aws_cloudwatch_metric_alarm" "account_admin_errors" {
+  alarm_name          = "${local.resource_prefix}-account-admin-errors-${var.environment}"
+  alarm_description   = "Alerts when account-admin Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.account_admin.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-admin-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for account-admin Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "account_admin_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.account_admin_logs.arn]
+  detector_name        = "${local.resource_prefix}-account-admin-anomaly-${var.environment}"
+  enabled              = var.anomaly_detection_enabled
+  evaluation_frequency = local.anomaly_evaluation_frequency
+}
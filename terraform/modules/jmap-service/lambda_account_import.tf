@@ -0,0 +1,343 @@
+# Lambda function for account-import (DynamoDB Streams trigger)
+# Restores Account/export archives into accounts for import jobs started via the admin API
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "account_import_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-account-import-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-import"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "account_import_execution" {
+  name               = "${local.resource_prefix}-account-import-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-import"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "account_import_basic_execution" {
+  role       = aws_iam_role.account_import_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "account_import_xray_access" {
+  role       = aws_iam_role.account_import_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "account_import_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-account-import-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (job/blob records, plugin registry + read stream)
+data "aws_iam_policy_document" "account_import_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:PutItem",
+      "dynamodb:Query",
+      "dynamodb:TransactWriteItems",
+      "dynamodb:UpdateItem"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetRecords",
+      "dynamodb:GetShardIterator",
+      "dynamodb:DescribeStream",
+      "dynamodb:ListStreams"
+    ]
+    resources = ["${aws_dynamodb_table.jmap_data.arn}/stream/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "account_import_dynamodb" {
+  name   = "${local.resource_prefix}-account-import-dynamodb-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.account_import_dynamodb.json
+}
+
+# IAM policy for S3 access (ranged reads of the archive + writing restored blobs)
+data "aws_iam_policy_document" "account_import_s3" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:GetObject",
+      "s3:PutObject",
+      "s3:PutObjectTagging"
+    ]
+    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "account_import_s3" {
+  name   = "${local.resource_prefix}-account-import-s3-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.account_import_s3.json
+}
+
+# IAM policy for Lambda invocation (account.import plugin callbacks)
+data "aws_iam_policy_document" "account_import_lambda_invoke" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "lambda:InvokeFunction"
+    ]
+    # Allow invoking any Lambda - plugins will be external
+    resources = ["*"]
+  }
+}
+
+resource "aws_iam_role_policy" "account_import_lambda_invoke" {
+  name   = "${local.resource_prefix}-account-import-lambda-invoke-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.account_import_lambda_invoke.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "account_import" {
+  filename         = "${path.module}/../../../build/account-import/lambda.zip"
+  function_name    = "${local.resource_prefix}-account-import-${var.environment}"
+  role             = aws_iam_role.account_import_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/account-import/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 900 # Imports yield and resume before this runs out
+  memory_size      = 1024
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+      BLOB_BUCKET    = aws_s3_bucket.blobs.bucket
+
+      # Optional envelope encryption of blob record metadata
+      BLOB_METADATA_KMS_KEY_ARN = var.blob_metadata_kms_key_arn
+      BLOB_ENCRYPTED_ATTRIBUTES = join(",", var.blob_encrypted_attributes)
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-account-import-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.account_import_basic_execution,
+    aws_iam_role_policy_attachment.account_import_xray_access,
+    aws_iam_role_policy.account_import_cloudwatch_metrics,
+    aws_iam_role_policy.account_import_dynamodb,
+    aws_iam_role_policy.account_import_s3,
+    aws_iam_role_policy.account_import_lambda_invoke,
+    aws_cloudwatch_log_group.account_import_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-import"
+  }
+}
+
+# SQS Dead Letter Queue for failed stream processing
+resource "aws_sqs_queue" "account_import_dlq" {
+  name                      = "${local.resource_prefix}-account-import-dlq-${var.environment}"
+  message_retention_seconds = 1209600 # 14 days
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-dlq-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-import"
+  }
+}
+
+# IAM policy for SQS DLQ access
+data "aws_iam_policy_document" "account_import_sqs" {
+  statement {
+    effect    = "Allow"
+    actions   = ["sqs:SendMessage"]
+    resources = [aws_sqs_queue.account_import_dlq.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "account_import_sqs" {
+  name   = "${local.resource_prefix}-account-import-sqs-${var.environment}"
+  role   = aws_iam_role.account_import_execution.id
+  policy = data.aws_iam_policy_document.account_import_sqs.json
+}
+
+# DynamoDB Streams event source mapping
+resource "aws_lambda_event_source_mapping" "account_import_stream" {
+  event_source_arn  = aws_dynamodb_table.jmap_data.stream_arn
+  function_name     = aws_lambda_function.account_import.arn
+  starting_position = "LATEST"
+  batch_size        = 1
+
+  # Only retry failed batches for a limited time
+  maximum_retry_attempts = 3
+
+  # Filter to only invoke for import jobs that have become pending
+  # (created, resumed after failure, or yielded before the timeout)
+  filter_criteria {
+    filter {
+      pattern = jsonencode({
+        eventName = ["INSERT", "MODIFY"]
+        dynamodb = {
+          NewImage = {
+            sk     = { S = [{ "prefix" = "IMPORT#" }] }
+            status = { S = ["pending"] }
+          }
+        }
+      })
+    }
+  }
+
+  # Send failed events to DLQ
+  destination_config {
+    on_failure {
+      destination_arn = aws_sqs_queue.account_import_dlq.arn
+    }
+  }
+
+  depends_on = [aws_iam_role_policy.account_import_sqs]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-stream-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "account_import_errors" {
+  name           = "${local.resource_prefix}-account-import-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.account_import_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "AccountImportErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for account-import Lambda errors
+resource "aws_cloudwatch_metric_alarm" "account_import_errors" {
+  alarm_name          = "${local.resource_prefix}-account-import-errors-${var.environment}"
+  alarm_description   = "Alerts when account-import Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.account_import.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for account-import Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "account_import_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.account_import_logs.arn]
+  detector_name        = "${local.resource_prefix}-account-import-anomaly-${var.environment}"
+  enabled              = var.anomaly_detection_enabled
+  evaluation_frequency = local.anomaly_evaluation_frequency
+}
+
+# CloudWatch Alarm for account-import DLQ messages
+resource "aws_cloudwatch_metric_alarm" "account_import_dlq" {
+  alarm_name          = "${local.resource_prefix}-account-import-dlq-${var.environment}"
+  alarm_description   = "Alerts when account-import DLQ has messages (failed stream processing)"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "ApproximateNumberOfMessagesVisible"
+  namespace           = "AWS/SQS"
+  period              = 300
+  statistic           = "Maximum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    QueueName = aws_sqs_queue.account_import_dlq.name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-import-dlq-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
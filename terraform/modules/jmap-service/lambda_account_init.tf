@@ -52,13 +52,15 @@ resource "aws_iam_role_policy" "account_init_cloudwatch_metrics" {
   policy = data.aws_iam_policy_document.cloudwatch_metrics.json
 }
 
-# IAM policy for DynamoDB access (PutItem for account META# record, Query for plugin registry)
+# IAM policy for DynamoDB access (transaction writing the account META# and
+# outbox records, GetItem for the quota tiers config)
 data "aws_iam_policy_document" "account_init_dynamodb" {
   statement {
     effect = "Allow"
     actions = [
-      "dynamodb:PutItem",
-      "dynamodb:Query",
+      "dynamodb:GetItem",
+      "dynamodb:PutItem", # Required for Put operations within transactions
+      "dynamodb:TransactWriteItems",
     ]
     resources = [aws_dynamodb_table.jmap_data.arn]
   }
@@ -70,13 +72,14 @@ resource "aws_iam_role_policy" "account_init_dynamodb" {
   policy = data.aws_iam_policy_document.account_init_dynamodb.json
 }
 
-# IAM policy for Cognito access (AdminUpdateUserAttributes)
+# IAM policy for Cognito access (AdminUpdateUserAttributes, AdminListGroupsForUser for quota tiers)
 # Note: Using constructed ARN to avoid dependency cycle with cognito.tf
 data "aws_iam_policy_document" "account_init_cognito" {
   statement {
     effect = "Allow"
     actions = [
       "cognito-idp:AdminUpdateUserAttributes",
+      "cognito-idp:AdminListGroupsForUser",
     ]
     resources = [
       "arn:aws:cognito-idp:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:userpool/*"
@@ -90,25 +93,6 @@ resource "aws_iam_role_policy" "account_init_cognito" {
   policy = data.aws_iam_policy_document.account_init_cognito.json
 }
 
-# IAM policy for SQS access (SendMessage to plugin event queues)
-data "aws_iam_policy_document" "account_init_sqs" {
-  statement {
-    effect = "Allow"
-    actions = [
-      "sqs:SendMessage",
-    ]
-    resources = [
-      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*"
-    ]
-  }
-}
-
-resource "aws_iam_role_policy" "account_init_sqs" {
-  name   = "${local.resource_prefix}-account-init-sqs-${var.environment}"
-  role   = aws_iam_role.account_init_execution.id
-  policy = data.aws_iam_policy_document.account_init_sqs.json
-}
-
 # =============================================================================
 # Lambda Function
 # =============================================================================
@@ -133,10 +117,11 @@ resource "aws_lambda_function" "account_init" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT         = var.environment
       DYNAMODB_TABLE      = aws_dynamodb_table.jmap_data.name
       DEFAULT_QUOTA_BYTES = tostring(var.default_quota_bytes)
+      QUOTA_TIERS         = jsonencode(var.quota_tiers)
 
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
@@ -155,7 +140,7 @@ resource "aws_lambda_function" "account_init" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -164,7 +149,6 @@ resource "aws_lambda_function" "account_init" {
     aws_iam_role_policy.account_init_cloudwatch_metrics,
     aws_iam_role_policy.account_init_dynamodb,
     aws_iam_role_policy.account_init_cognito,
-    aws_iam_role_policy.account_init_sqs,
     aws_cloudwatch_log_group.account_init_logs
   ]
 
@@ -0,0 +1,195 @@
+# Lambda function for account-reaper (scheduled inactive account check)
+# Flags accounts unused beyond the inactivity threshold, publishes
+# account.inactive, and optionally suspends them or schedules their deletion
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "account_reaper_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-account-reaper-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-reaper-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-reaper"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "account_reaper_execution" {
+  name               = "${local.resource_prefix}-account-reaper-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-reaper-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-reaper"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "account_reaper_basic_execution" {
+  role       = aws_iam_role.account_reaper_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "account_reaper_xray_access" {
+  role       = aws_iam_role.account_reaper_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for DynamoDB access (scan META# records, flag accounts and
+# write account.inactive to the outbox in one transaction)
+data "aws_iam_policy_document" "account_reaper_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Scan",
+      "dynamodb:TransactWriteItems",
+      "dynamodb:UpdateItem",
+      "dynamodb:PutItem",
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "account_reaper_dynamodb" {
+  name   = "${local.resource_prefix}-account-reaper-dynamodb-${var.environment}"
+  role   = aws_iam_role.account_reaper_execution.id
+  policy = data.aws_iam_policy_document.account_reaper_dynamodb.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "account_reaper" {
+  filename         = "${path.module}/../../../build/account-reaper/lambda.zip"
+  function_name    = "${local.resource_prefix}-account-reaper-${var.environment}"
+  role             = aws_iam_role.account_reaper_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/account-reaper/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 900 # Scans every account META# record
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT                             = var.environment
+      DYNAMODB_TABLE                          = aws_dynamodb_table.jmap_data.name
+      INACTIVE_ACCOUNT_AFTER_SECONDS          = tostring(var.inactive_account_after_days * 86400)
+      INACTIVE_ACCOUNT_ACTION                 = var.inactive_account_action
+      INACTIVE_ACCOUNT_DELETION_DELAY_SECONDS = tostring(var.inactive_account_deletion_delay_days * 86400)
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-account-reaper-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.account_reaper_basic_execution,
+    aws_iam_role_policy_attachment.account_reaper_xray_access,
+    aws_iam_role_policy.account_reaper_dynamodb,
+    aws_cloudwatch_log_group.account_reaper_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-reaper-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "account-reaper"
+  }
+}
+
+# =============================================================================
+# EventBridge Schedule
+# =============================================================================
+
+resource "aws_cloudwatch_event_rule" "account_reaper_schedule" {
+  name                = "${local.resource_prefix}-account-reaper-schedule-${var.environment}"
+  description         = "Flag inactive accounts daily"
+  schedule_expression = "rate(1 day)"
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-reaper-schedule-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_cloudwatch_event_target" "account_reaper_target" {
+  rule      = aws_cloudwatch_event_rule.account_reaper_schedule.name
+  target_id = "AccountReaper"
+  arn       = aws_lambda_function.account_reaper.arn
+}
+
+resource "aws_lambda_permission" "account_reaper_eventbridge" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.account_reaper.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.account_reaper_schedule.arn
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Alarm for account-reaper Lambda errors
+resource "aws_cloudwatch_metric_alarm" "account_reaper_errors" {
+  alarm_name          = "${local.resource_prefix}-account-reaper-errors-${var.environment}"
+  alarm_description   = "Alerts when account-reaper Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 86400
+  statistic           = "Sum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.account_reaper.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-account-reaper-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
@@ -0,0 +1,196 @@
+# Lambda function for apikey-authorizer (API Gateway Lambda authorizer)
+# Validates API keys on the key-authenticated routes and checks their scopes
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "apikey_authorizer_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-apikey-authorizer-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-apikey-authorizer-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "apikey-authorizer"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "apikey_authorizer_execution" {
+  name               = "${local.resource_prefix}-apikey-authorizer-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-apikey-authorizer-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "apikey-authorizer"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "apikey_authorizer_basic_execution" {
+  role       = aws_iam_role.apikey_authorizer_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "apikey_authorizer_xray_access" {
+  role       = aws_iam_role.apikey_authorizer_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "apikey_authorizer_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-apikey-authorizer-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.apikey_authorizer_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (read API key lookup records)
+data "aws_iam_policy_document" "apikey_authorizer_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "apikey_authorizer_dynamodb" {
+  name   = "${local.resource_prefix}-apikey-authorizer-dynamodb-${var.environment}"
+  role   = aws_iam_role.apikey_authorizer_execution.id
+  policy = data.aws_iam_policy_document.apikey_authorizer_dynamodb.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "apikey_authorizer" {
+  filename         = "${path.module}/../../../build/apikey-authorizer/lambda.zip"
+  function_name    = "${local.resource_prefix}-apikey-authorizer-${var.environment}"
+  role             = aws_iam_role.apikey_authorizer_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/apikey-authorizer/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = var.lambda_timeout
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-apikey-authorizer-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.apikey_authorizer_basic_execution,
+    aws_iam_role_policy_attachment.apikey_authorizer_xray_access,
+    aws_iam_role_policy.apikey_authorizer_cloudwatch_metrics,
+    aws_iam_role_policy.apikey_authorizer_dynamodb,
+    aws_cloudwatch_log_group.apikey_authorizer_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-apikey-authorizer-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "apikey-authorizer"
+  }
+}
+
+# API Gateway permission to invoke apikey-authorizer Lambda as an authorizer
+resource "aws_lambda_permission" "apikey_authorizer_apigw" {
+  statement_id  = "AllowAPIGatewayInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.apikey_authorizer.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_api_gateway_rest_api.api.execution_arn}/authorizers/*"
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "apikey_authorizer_errors" {
+  name           = "${local.resource_prefix}-apikey-authorizer-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.apikey_authorizer_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "APIKeyAuthorizerErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for apikey-authorizer Lambda errors
+resource "aws_cloudwatch_metric_alarm" "apikey_authorizer_errors" {
+  alarm_name          = "${local.resource_prefix}-apikey-authorizer-errors-${var.environment}"
+  alarm_description   = "Alerts when apikey-authorizer Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.apikey_authorizer.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-apikey-authorizer-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for apikey-authorizer Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "apikey_authorizer_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.apikey_authorizer_logs.arn]
+  detector_name        = "${local.resource_prefix}-apikey-authorizer-anomaly-${var.environment}"
+  enabled              = var.anomaly_detection_enabled
+  evaluation_frequency = local.anomaly_evaluation_frequency
+}
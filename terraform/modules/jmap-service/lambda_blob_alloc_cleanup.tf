@@ -114,11 +114,12 @@ resource "aws_lambda_function" "blob_alloc_cleanup" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT          = var.environment
       DYNAMODB_TABLE       = aws_dynamodb_table.jmap_data.name
       BLOB_BUCKET          = aws_s3_bucket.blobs.bucket
       CLEANUP_BUFFER_HOURS = tostring(var.allocation_cleanup_buffer_hours)
+      METRIC_NAMESPACE     = "JMAPService/${var.environment}"
 
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
@@ -137,7 +138,7 @@ resource "aws_lambda_function" "blob_alloc_cleanup" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -229,6 +230,34 @@ resource "aws_cloudwatch_metric_alarm" "blob_alloc_cleanup_errors" {
   }
 }
 
+# Alarm when expired allocations are left behind by three consecutive hourly
+# runs, from the per-run metrics the Lambda writes in EMF
+resource "aws_cloudwatch_metric_alarm" "blob_alloc_cleanup_falling_behind" {
+  alarm_name          = "${local.resource_prefix}-blob-alloc-cleanup-falling-behind-${var.environment}"
+  alarm_description   = "blob-alloc-cleanup failed to clean up expired allocations in three consecutive runs"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 3
+  metric_name         = "ItemsErrored"
+  namespace           = "JMAPService/${var.environment}"
+  period              = 3600
+  statistic           = "Sum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    Function = "blob-alloc-cleanup"
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-alloc-cleanup-falling-behind-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
 # CloudWatch Log Anomaly Detector for blob-alloc-cleanup Lambda
 resource "aws_cloudwatch_log_anomaly_detector" "blob_alloc_cleanup_anomaly" {
   log_group_arn_list   = [aws_cloudwatch_log_group.blob_alloc_cleanup_logs.arn]
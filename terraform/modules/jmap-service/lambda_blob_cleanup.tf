@@ -123,10 +123,11 @@ resource "aws_lambda_function" "blob_cleanup" {
   }
 
   environment {
-    variables = {
-      ENVIRONMENT    = var.environment
-      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
-      BLOB_BUCKET    = aws_s3_bucket.blobs.bucket
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT      = var.environment
+      DYNAMODB_TABLE   = aws_dynamodb_table.jmap_data.name
+      BLOB_BUCKET      = aws_s3_bucket.blobs.bucket
+      METRIC_NAMESPACE = "JMAPService/${var.environment}"
 
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
@@ -145,7 +146,7 @@ resource "aws_lambda_function" "blob_cleanup" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -200,8 +201,10 @@ resource "aws_lambda_event_source_mapping" "blob_cleanup_stream" {
   starting_position = "LATEST"
   batch_size        = 10
 
-  # Only retry failed batches for a limited time
-  maximum_retry_attempts = 3
+  # Retry only the records that failed, for a limited time
+  function_response_types        = ["ReportBatchItemFailures"]
+  maximum_retry_attempts         = 3
+  bisect_batch_on_function_error = true
 
   # Filter to only invoke for blob soft-delete transitions
   filter_criteria {
@@ -282,6 +285,34 @@ resource "aws_cloudwatch_metric_alarm" "blob_cleanup_errors" {
   }
 }
 
+# Alarm on a storm of failed deletions, from the per-run metrics the Lambda
+# writes in EMF
+resource "aws_cloudwatch_metric_alarm" "blob_cleanup_error_storm" {
+  alarm_name          = "${local.resource_prefix}-blob-cleanup-error-storm-${var.environment}"
+  alarm_description   = "blob-cleanup failed more than 10 deletions in 5 minutes"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "ItemsErrored"
+  namespace           = "JMAPService/${var.environment}"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 10
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    Function = "blob-cleanup"
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-cleanup-error-storm-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
 # CloudWatch Log Anomaly Detector for blob-cleanup Lambda
 resource "aws_cloudwatch_log_anomaly_detector" "blob_cleanup_anomaly" {
   log_group_arn_list   = [aws_cloudwatch_log_group.blob_cleanup_logs.arn]
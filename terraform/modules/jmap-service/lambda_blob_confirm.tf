@@ -103,6 +103,7 @@ data "aws_iam_policy_document" "blob_confirm_dynamodb" {
       "dynamodb:GetItem",
       "dynamodb:TransactWriteItems",
       "dynamodb:UpdateItem", # Required for Update operations within transactions
+      "dynamodb:PutItem",    # Required for outbox Puts within transactions
     ]
     resources = [aws_dynamodb_table.jmap_data.arn]
   }
@@ -114,13 +115,14 @@ resource "aws_iam_role_policy" "blob_confirm_dynamodb" {
   policy = data.aws_iam_policy_document.blob_confirm_dynamodb.json
 }
 
-# IAM policy for S3 access (tagging and delete)
+# IAM policy for S3 access (tagging, delete, and reading content to sniff)
 data "aws_iam_policy_document" "blob_confirm_s3" {
   statement {
     effect = "Allow"
     actions = [
       "s3:PutObjectTagging",
       "s3:DeleteObject",
+      "s3:GetObject",
     ]
     resources = ["${aws_s3_bucket.blobs.arn}/*"]
   }
@@ -178,11 +180,17 @@ resource "aws_lambda_function" "blob_confirm" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT    = var.environment
       DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
       BLOB_BUCKET    = aws_s3_bucket.blobs.bucket
 
+      # Request a content scan of each confirmed blob
+      BLOB_SCANNING_ENABLED = tostring(var.blob_scanning_enabled)
+
+      # Check declared content types against the content
+      BLOB_CONTENT_SNIFFING = var.blob_content_sniffing
+
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
       OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
@@ -200,7 +208,7 @@ resource "aws_lambda_function" "blob_confirm" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -230,7 +238,7 @@ resource "aws_lambda_permission" "blob_confirm_s3" {
   source_arn    = aws_s3_bucket.blobs.arn
 }
 
-# S3 bucket notification for object creation
+# S3 bucket notification for object creation, and for blob-mirror
 resource "aws_s3_bucket_notification" "blobs_notification" {
   bucket = aws_s3_bucket.blobs.id
 
@@ -239,7 +247,16 @@ resource "aws_s3_bucket_notification" "blobs_notification" {
     events              = ["s3:ObjectCreated:Put", "s3:ObjectCreated:CompleteMultipartUpload"]
   }
 
-  depends_on = [aws_lambda_permission.blob_confirm_s3]
+  # Blobs are mirrored once tagged confirmed, and removed when deleted
+  dynamic "lambda_function" {
+    for_each = local.blob_mirror_enabled ? [1] : []
+    content {
+      lambda_function_arn = aws_lambda_function.blob_mirror[0].arn
+      events              = ["s3:ObjectTagging:Put", "s3:ObjectRemoved:*"]
+    }
+  }
+
+  depends_on = [aws_lambda_permission.blob_confirm_s3, aws_lambda_permission.blob_mirror_s3]
 }
 
 # =============================================================================
@@ -1,4 +1,5 @@
-# Lambda function for blob-delete (DELETE /delete-iam/{accountId}/{blobId})
+# Lambda function for blob-delete (DELETE /delete-iam/{accountId}/{blobId},
+# PUT /scan-iam/{accountId}/{blobId})
 # Marks blobs as deleted by setting deletedAt on DynamoDB record (IAM auth only)
 
 # =============================================================================
@@ -71,6 +72,25 @@ resource "aws_iam_role_policy" "blob_delete_dynamodb" {
   policy = data.aws_iam_policy_document.blob_delete_dynamodb.json
 }
 
+# IAM policy for retagging scanned blobs, so blob-mirror copies their verdicts
+data "aws_iam_policy_document" "blob_delete_s3_retag" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:GetObjectTagging",
+      "s3:PutObjectTagging"
+    ]
+    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "blob_delete_s3_retag" {
+  count  = local.blob_mirror_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-delete-s3-retag-${var.environment}"
+  role   = aws_iam_role.blob_delete_execution.id
+  policy = data.aws_iam_policy_document.blob_delete_s3_retag.json
+}
+
 # =============================================================================
 # Lambda Function
 # =============================================================================
@@ -95,10 +115,19 @@ resource "aws_lambda_function" "blob_delete" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT    = var.environment
       DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
 
+      # Authorizer claim holding the account ID
+      ACCOUNT_ID_CLAIM = var.account_id_claim
+
+      # Key for plugin delegation tokens
+      DELEGATION_SECRET_ARN = aws_secretsmanager_secret.delegation_key.arn
+
+      # Blob bucket retagged after scan verdicts, so blob-mirror copies them
+      BLOB_MIRROR_SOURCE_BUCKET = local.blob_mirror_enabled ? aws_s3_bucket.blobs.id : ""
+
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
       OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
@@ -116,7 +145,7 @@ resource "aws_lambda_function" "blob_delete" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -124,6 +153,8 @@ resource "aws_lambda_function" "blob_delete" {
     aws_iam_role_policy_attachment.blob_delete_xray_access,
     aws_iam_role_policy.blob_delete_cloudwatch_metrics,
     aws_iam_role_policy.blob_delete_dynamodb,
+    aws_iam_role_policy.blob_delete_delegation_key,
+    aws_iam_role_policy.blob_delete_s3_retag,
     aws_cloudwatch_log_group.blob_delete_logs
   ]
 
@@ -52,16 +52,29 @@ resource "aws_iam_role_policy" "blob_download_cloudwatch_metrics" {
   policy = data.aws_iam_policy_document.cloudwatch_metrics.json
 }
 
-# IAM policy for DynamoDB access (read blob records and plugin registry)
+# IAM policy for DynamoDB access (read blob records and plugin registry,
+# increment download usage counters)
 data "aws_iam_policy_document" "blob_download_dynamodb" {
   statement {
     effect = "Allow"
     actions = [
       "dynamodb:GetItem",
-      "dynamodb:Query"
+      "dynamodb:PutItem",
+      "dynamodb:Query",
+      "dynamodb:UpdateItem"
     ]
     resources = [aws_dynamodb_table.jmap_data.arn]
   }
+
+  # Blob records are read from the blob-mirror replica during a failover
+  dynamic "statement" {
+    for_each = var.blob_download_failover ? [1] : []
+    content {
+      effect    = "Allow"
+      actions   = ["dynamodb:GetItem"]
+      resources = [local.blob_mirror_table_arn]
+    }
+  }
 }
 
 resource "aws_iam_role_policy" "blob_download_dynamodb" {
@@ -111,13 +124,46 @@ resource "aws_lambda_function" "blob_download" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT               = var.environment
       DYNAMODB_TABLE            = aws_dynamodb_table.jmap_data.name
       CLOUDFRONT_DOMAIN         = var.domain_name
       CLOUDFRONT_KEY_PAIR_ID    = aws_cloudfront_public_key.blob_signing_current.id
       PRIVATE_KEY_SECRET_ARN    = aws_secretsmanager_secret.cloudfront_private_key.arn
       SIGNED_URL_EXPIRY_SECONDS = tostring(var.signed_url_expiry_seconds)
+      SIGNED_URL_IPV4_PREFIX    = tostring(var.signed_url_ipv4_prefix)
+      SIGNED_URL_IPV6_PREFIX    = tostring(var.signed_url_ipv6_prefix)
+
+      # In-memory cache of blob records
+      BLOB_CACHE_SIZE        = tostring(var.blob_cache_size)
+      BLOB_CACHE_TTL_SECONDS = tostring(var.blob_cache_ttl_seconds)
+
+      # Replica regions serving downloads near their callers
+      BLOB_DOWNLOAD_REGIONS = var.blob_download_regions
+
+      # Serve every download from the blob-mirror replica
+      BLOB_DOWNLOAD_FAILOVER = tostring(var.blob_download_failover)
+      BLOB_MIRROR_DOMAIN     = var.blob_mirror_domain
+      BLOB_MIRROR_REGION     = var.blob_mirror_region
+      BLOB_MIRROR_TABLE      = var.blob_mirror_table
+
+      # Authorizer claim holding the account ID
+      ACCOUNT_ID_CLAIM = var.account_id_claim
+
+      # Browser origins allowed by CORS
+      CORS_ALLOWED_ORIGINS = join(",", var.cors_allowed_origins)
+
+      # Rate limiting configuration
+      RATE_LIMIT_PER_SECOND = tostring(var.rate_limit_per_second)
+      RATE_LIMIT_BURST      = tostring(var.rate_limit_burst)
+      RATE_LIMIT_TIERS      = jsonencode(var.rate_limit_tiers)
+
+      # Optional envelope encryption of blob record metadata
+      BLOB_METADATA_KMS_KEY_ARN = var.blob_metadata_kms_key_arn
+      BLOB_ENCRYPTED_ATTRIBUTES = join(",", var.blob_encrypted_attributes)
+
+      # Key for plugin delegation tokens
+      DELEGATION_SECRET_ARN = aws_secretsmanager_secret.delegation_key.arn
 
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
@@ -136,7 +182,7 @@ resource "aws_lambda_function" "blob_download" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -145,6 +191,7 @@ resource "aws_lambda_function" "blob_download" {
     aws_iam_role_policy.blob_download_cloudwatch_metrics,
     aws_iam_role_policy.blob_download_dynamodb,
     aws_iam_role_policy.blob_download_secrets,
+    aws_iam_role_policy.blob_download_delegation_key,
     aws_cloudwatch_log_group.blob_download_logs
   ]
 
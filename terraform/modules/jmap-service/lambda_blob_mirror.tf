@@ -0,0 +1,291 @@
+# Lambda function for blob-mirror (S3 event trigger for DR mirroring)
+# Copies confirmed blobs and their records to a replica bucket and table in
+# another region, and removes them from the replica when they are deleted.
+# Only deployed when blob_mirror_region is set.
+
+locals {
+  blob_mirror_enabled   = var.blob_mirror_region != ""
+  blob_mirror_table_arn = "arn:aws:dynamodb:${var.blob_mirror_region}:${data.aws_caller_identity.current.account_id}:table/${var.blob_mirror_table}"
+}
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "blob_mirror_logs" {
+  count             = local.blob_mirror_enabled ? 1 : 0
+  name              = "/aws/lambda/${local.resource_prefix}-blob-mirror-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "blob-mirror"
+  }
+}
+
+# =============================================================================
+# Dead Letter Queue
+# =============================================================================
+
+resource "aws_sqs_queue" "blob_mirror_dlq" {
+  count                     = local.blob_mirror_enabled ? 1 : 0
+  name                      = "${local.resource_prefix}-blob-mirror-dlq-${var.environment}"
+  message_retention_seconds = 1209600 # 14 days
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-dlq-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "blob-mirror"
+  }
+}
+
+# CloudWatch Alarm for DLQ depth
+resource "aws_cloudwatch_metric_alarm" "blob_mirror_dlq_depth" {
+  count               = local.blob_mirror_enabled ? 1 : 0
+  alarm_name          = "${local.resource_prefix}-blob-mirror-dlq-depth-${var.environment}"
+  alarm_description   = "Alerts when blob-mirror DLQ has messages"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "ApproximateNumberOfMessagesVisible"
+  namespace           = "AWS/SQS"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    QueueName = aws_sqs_queue.blob_mirror_dlq[0].name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-dlq-depth-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "blob_mirror_execution" {
+  count              = local.blob_mirror_enabled ? 1 : 0
+  name               = "${local.resource_prefix}-blob-mirror-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "blob-mirror"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "blob_mirror_basic_execution" {
+  count      = local.blob_mirror_enabled ? 1 : 0
+  role       = aws_iam_role.blob_mirror_execution[0].name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "blob_mirror_xray_access" {
+  count      = local.blob_mirror_enabled ? 1 : 0
+  role       = aws_iam_role.blob_mirror_execution[0].name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for DynamoDB access (read primary records, write replica records)
+data "aws_iam_policy_document" "blob_mirror_dynamodb" {
+  statement {
+    effect    = "Allow"
+    actions   = ["dynamodb:GetItem"]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:DeleteItem"
+    ]
+    resources = [local.blob_mirror_table_arn]
+  }
+}
+
+resource "aws_iam_role_policy" "blob_mirror_dynamodb" {
+  count  = local.blob_mirror_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-mirror-dynamodb-${var.environment}"
+  role   = aws_iam_role.blob_mirror_execution[0].id
+  policy = data.aws_iam_policy_document.blob_mirror_dynamodb.json
+}
+
+# IAM policy for S3 access (read source objects and tags, write the replica)
+data "aws_iam_policy_document" "blob_mirror_s3" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:GetObject",
+      "s3:GetObjectTagging"
+    ]
+    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "s3:PutObject",
+      "s3:PutObjectTagging",
+      "s3:DeleteObject"
+    ]
+    resources = ["arn:aws:s3:::${var.blob_mirror_bucket}/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "blob_mirror_s3" {
+  count  = local.blob_mirror_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-mirror-s3-${var.environment}"
+  role   = aws_iam_role.blob_mirror_execution[0].id
+  policy = data.aws_iam_policy_document.blob_mirror_s3.json
+}
+
+# IAM policy for SQS DLQ access
+data "aws_iam_policy_document" "blob_mirror_sqs" {
+  count = local.blob_mirror_enabled ? 1 : 0
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+    ]
+    resources = [aws_sqs_queue.blob_mirror_dlq[0].arn]
+  }
+}
+
+resource "aws_iam_role_policy" "blob_mirror_sqs" {
+  count  = local.blob_mirror_enabled ? 1 : 0
+  name   = "${local.resource_prefix}-blob-mirror-sqs-${var.environment}"
+  role   = aws_iam_role.blob_mirror_execution[0].id
+  policy = data.aws_iam_policy_document.blob_mirror_sqs[0].json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "blob_mirror" {
+  count            = local.blob_mirror_enabled ? 1 : 0
+  filename         = "${path.module}/../../../build/blob-mirror/lambda.zip"
+  function_name    = "${local.resource_prefix}-blob-mirror-${var.environment}"
+  role             = aws_iam_role.blob_mirror_execution[0].arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/blob-mirror/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = var.lambda_timeout
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  # Dead letter queue for failed invocations
+  dead_letter_config {
+    target_arn = aws_sqs_queue.blob_mirror_dlq[0].arn
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+      BLOB_BUCKET    = aws_s3_bucket.blobs.bucket
+
+      # DR replica confirmed blobs are copied to
+      BLOB_MIRROR_REGION = var.blob_mirror_region
+      BLOB_MIRROR_BUCKET = var.blob_mirror_bucket
+      BLOB_MIRROR_TABLE  = var.blob_mirror_table
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-blob-mirror-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.blob_mirror_basic_execution,
+    aws_iam_role_policy_attachment.blob_mirror_xray_access,
+    aws_iam_role_policy.blob_mirror_dynamodb,
+    aws_iam_role_policy.blob_mirror_s3,
+    aws_iam_role_policy.blob_mirror_sqs,
+    aws_cloudwatch_log_group.blob_mirror_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "blob-mirror"
+  }
+}
+
+# Permission for S3 to invoke the Lambda
+resource "aws_lambda_permission" "blob_mirror_s3" {
+  count         = local.blob_mirror_enabled ? 1 : 0
+  statement_id  = "AllowS3Invoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.blob_mirror[0].function_name
+  principal     = "s3.amazonaws.com"
+  source_arn    = aws_s3_bucket.blobs.arn
+}
+
+# CloudWatch Alarm for blob-mirror Lambda errors
+resource "aws_cloudwatch_metric_alarm" "blob_mirror_errors" {
+  count               = local.blob_mirror_enabled ? 1 : 0
+  alarm_name          = "${local.resource_prefix}-blob-mirror-errors-${var.environment}"
+  alarm_description   = "Alerts when blob-mirror Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.blob_mirror[0].function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-blob-mirror-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
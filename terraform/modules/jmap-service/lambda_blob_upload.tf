@@ -52,12 +52,16 @@ resource "aws_iam_role_policy" "blob_upload_cloudwatch_metrics" {
   policy = data.aws_iam_policy_document.cloudwatch_metrics.json
 }
 
-# IAM policy for DynamoDB access (write blob records and read plugin registry)
+# IAM policy for DynamoDB access (reserve quota and write blob records in
+# transactions, write rate limit buckets, read account META# and plugin registry)
 data "aws_iam_policy_document" "blob_upload_dynamodb" {
   statement {
     effect = "Allow"
     actions = [
+      "dynamodb:GetItem",
       "dynamodb:PutItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem",
       "dynamodb:Query"
     ]
     resources = [aws_dynamodb_table.jmap_data.arn]
@@ -78,7 +82,7 @@ data "aws_iam_policy_document" "blob_upload_s3" {
       "s3:PutObject",
       "s3:PutObjectTagging"
     ]
-    resources = ["${aws_s3_bucket.blobs.arn}/*"]
+    resources = concat(["${aws_s3_bucket.blobs.arn}/*"], local.blob_access_point_objects)
   }
 }
 
@@ -112,11 +116,44 @@ resource "aws_lambda_function" "blob_upload" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT    = var.environment
       DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
       BLOB_BUCKET    = aws_s3_bucket.blobs.bucket
 
+      # Per-account access points uploads are written through
+      BLOB_ACCESS_POINTS = local.blob_access_points
+
+      # Largest upload accepted, advertised as maxSizeUpload
+      MAX_SIZE_UPLOAD = tostring(var.max_size_upload)
+
+      # Request a content scan of each confirmed blob
+      BLOB_SCANNING_ENABLED = tostring(var.blob_scanning_enabled)
+
+      # Extra S3 tag keys uploads may set with X-Tag-{Key} headers
+      BLOB_TAG_KEYS = join(",", var.blob_tag_keys)
+
+      # Authorizer claim holding the account ID
+      ACCOUNT_ID_CLAIM = var.account_id_claim
+
+      # Browser origins allowed by CORS
+      CORS_ALLOWED_ORIGINS = join(",", var.cors_allowed_origins)
+
+      # Optional envelope encryption of blob record metadata
+      BLOB_METADATA_KMS_KEY_ARN = var.blob_metadata_kms_key_arn
+      BLOB_ENCRYPTED_ATTRIBUTES = join(",", var.blob_encrypted_attributes)
+
+      # Key for plugin delegation tokens
+      DELEGATION_SECRET_ARN = aws_secretsmanager_secret.delegation_key.arn
+
+      # Rate limiting configuration
+      RATE_LIMIT_PER_SECOND = tostring(var.rate_limit_per_second)
+      RATE_LIMIT_BURST      = tostring(var.rate_limit_burst)
+      RATE_LIMIT_TIERS      = jsonencode(var.rate_limit_tiers)
+
+      # Per-account-type features
+      ACCOUNT_TYPE_FEATURES = local.account_type_features_json
+
       # ADOT Collector Configuration
       OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
       OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
@@ -134,7 +171,7 @@ resource "aws_lambda_function" "blob_upload" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
@@ -143,6 +180,7 @@ resource "aws_lambda_function" "blob_upload" {
     aws_iam_role_policy.blob_upload_cloudwatch_metrics,
     aws_iam_role_policy.blob_upload_dynamodb,
     aws_iam_role_policy.blob_upload_s3,
+    aws_iam_role_policy.blob_upload_delegation_key,
     aws_cloudwatch_log_group.blob_upload_logs
   ]
 
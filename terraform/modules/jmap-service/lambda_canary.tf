@@ -0,0 +1,177 @@
+# Lambda function for canary
+# Calls Core/ping through the IAM-authenticated API on a schedule and
+# publishes success and latency metrics, alarming when pings fail
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "canary_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-canary-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-canary-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "canary"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+# The role is registered as an IAM client principal in plugins.tf
+resource "aws_iam_role" "canary_execution" {
+  name               = "${local.resource_prefix}-canary-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-canary-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "canary"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "canary_basic_execution" {
+  role       = aws_iam_role.canary_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# IAM policy for API Gateway (JMAP requests for the canary account only)
+data "aws_iam_policy_document" "canary_api_invoke" {
+  statement {
+    effect  = "Allow"
+    actions = ["execute-api:Invoke"]
+    resources = [
+      "${aws_api_gateway_rest_api.api.execution_arn}/*/POST/jmap-iam/${var.canary_account_id}",
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "canary_api_invoke" {
+  name   = "${local.resource_prefix}-canary-api-invoke-${var.environment}"
+  role   = aws_iam_role.canary_execution.id
+  policy = data.aws_iam_policy_document.canary_api_invoke.json
+}
+
+# IAM policy for CloudWatch Metrics (publish canary metrics)
+data "aws_iam_policy_document" "canary_cloudwatch" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "cloudwatch:PutMetricData"
+    ]
+    resources = ["*"]
+    condition {
+      test     = "StringEquals"
+      variable = "cloudwatch:namespace"
+      values   = ["JMAPService/${var.environment}"]
+    }
+  }
+}
+
+resource "aws_iam_role_policy" "canary_cloudwatch" {
+  name   = "${local.resource_prefix}-canary-cloudwatch-${var.environment}"
+  role   = aws_iam_role.canary_execution.id
+  policy = data.aws_iam_policy_document.canary_cloudwatch.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "canary" {
+  filename         = "${path.module}/../../../build/canary/lambda.zip"
+  function_name    = "${local.resource_prefix}-canary-${var.environment}"
+  role             = aws_iam_role.canary_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/canary/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 30
+  memory_size      = 128
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      API_URL           = "https://${var.domain_name}"
+      CANARY_ACCOUNT_ID = var.canary_account_id
+      METRIC_NAMESPACE  = "JMAPService/${var.environment}"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.canary_basic_execution,
+    aws_iam_role_policy.canary_api_invoke,
+    aws_iam_role_policy.canary_cloudwatch,
+    aws_cloudwatch_log_group.canary_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-canary-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "canary"
+  }
+}
+
+# =============================================================================
+# EventBridge Schedule
+# =============================================================================
+
+resource "aws_cloudwatch_event_rule" "canary" {
+  name                = "${local.resource_prefix}-canary-${var.environment}"
+  description         = "Scheduled end-to-end Core/ping canary"
+  schedule_expression = var.canary_schedule
+
+  tags = {
+    Name        = "${local.resource_prefix}-canary-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_cloudwatch_event_target" "canary" {
+  rule      = aws_cloudwatch_event_rule.canary.name
+  target_id = "canary-lambda"
+  arn       = aws_lambda_function.canary.arn
+}
+
+resource "aws_lambda_permission" "canary_eventbridge" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.canary.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.canary.arn
+}
+
+# =============================================================================
+# CloudWatch Alarm for Canary Failures
+# =============================================================================
+
+# Missing data is breaching: a canary that stops running is a failure too
+resource "aws_cloudwatch_metric_alarm" "canary_failed" {
+  alarm_name          = "${local.resource_prefix}-canary-failed-${var.environment}"
+  alarm_description   = "Core/ping canary failed or stopped reporting"
+  comparison_operator = "LessThanThreshold"
+  evaluation_periods  = 3
+  datapoints_to_alarm = 2
+  metric_name         = "CanarySuccess"
+  namespace           = "JMAPService/${var.environment}"
+  period              = 300
+  statistic           = "Minimum"
+  threshold           = 1
+  treat_missing_data  = "breaching"
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-canary-failed-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
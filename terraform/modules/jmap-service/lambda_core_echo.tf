@@ -76,7 +76,7 @@ resource "aws_lambda_function" "core_echo" {
   }
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       ENVIRONMENT = var.environment
 
       # ADOT Collector Configuration
@@ -96,7 +96,7 @@ resource "aws_lambda_function" "core_echo" {
 
       # Resource attributes for better trace identification
       OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
-    }
+    })
   }
 
   depends_on = [
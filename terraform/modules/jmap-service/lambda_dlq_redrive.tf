@@ -0,0 +1,290 @@
+# Lambda function for dlq-redrive (scheduled redrive of the blob DLQs)
+# Sends blob-confirm and blob-cleanup dead letters back through their
+# handlers, and parks those that cannot be redriven
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "dlq_redrive_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-dlq-redrive-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "dlq-redrive"
+  }
+}
+
+# =============================================================================
+# Parked Message Queue
+# =============================================================================
+
+# Dead letters that were invalid or kept failing, for an operator to inspect
+resource "aws_sqs_queue" "dlq_parked" {
+  name                      = "${local.resource_prefix}-dlq-parked-${var.environment}"
+  message_retention_seconds = 1209600 # 14 days
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-parked-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "dlq-redrive"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "dlq_redrive_execution" {
+  name               = "${local.resource_prefix}-dlq-redrive-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "dlq-redrive"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "dlq_redrive_basic_execution" {
+  role       = aws_iam_role.dlq_redrive_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "dlq_redrive_xray_access" {
+  role       = aws_iam_role.dlq_redrive_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for SQS access (read and delete dead letters, park messages)
+data "aws_iam_policy_document" "dlq_redrive_sqs" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:ReceiveMessage",
+      "sqs:DeleteMessage",
+    ]
+    resources = [
+      aws_sqs_queue.blob_confirm_dlq.arn,
+      aws_sqs_queue.blob_cleanup_dlq.arn,
+    ]
+  }
+
+  statement {
+    effect    = "Allow"
+    actions   = ["sqs:SendMessage"]
+    resources = [aws_sqs_queue.dlq_parked.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "dlq_redrive_sqs" {
+  name   = "${local.resource_prefix}-dlq-redrive-sqs-${var.environment}"
+  role   = aws_iam_role.dlq_redrive_execution.id
+  policy = data.aws_iam_policy_document.dlq_redrive_sqs.json
+}
+
+# IAM policy for DynamoDB Streams access (read failed blob-cleanup batches)
+data "aws_iam_policy_document" "dlq_redrive_streams" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetShardIterator",
+      "dynamodb:GetRecords",
+    ]
+    resources = [aws_dynamodb_table.jmap_data.stream_arn]
+  }
+}
+
+resource "aws_iam_role_policy" "dlq_redrive_streams" {
+  name   = "${local.resource_prefix}-dlq-redrive-streams-${var.environment}"
+  role   = aws_iam_role.dlq_redrive_execution.id
+  policy = data.aws_iam_policy_document.dlq_redrive_streams.json
+}
+
+# IAM policy for Lambda access (invoke the handlers dead letters came from)
+data "aws_iam_policy_document" "dlq_redrive_lambda" {
+  statement {
+    effect  = "Allow"
+    actions = ["lambda:InvokeFunction"]
+    resources = [
+      aws_lambda_function.blob_confirm.arn,
+      aws_lambda_function.blob_cleanup.arn,
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "dlq_redrive_lambda" {
+  name   = "${local.resource_prefix}-dlq-redrive-lambda-${var.environment}"
+  role   = aws_iam_role.dlq_redrive_execution.id
+  policy = data.aws_iam_policy_document.dlq_redrive_lambda.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "dlq_redrive" {
+  filename         = "${path.module}/../../../build/dlq-redrive/lambda.zip"
+  function_name    = "${local.resource_prefix}-dlq-redrive-${var.environment}"
+  role             = aws_iam_role.dlq_redrive_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/dlq-redrive/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 300 # Invokes blob-confirm and blob-cleanup once per message
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT              = var.environment
+      BLOB_BUCKET              = aws_s3_bucket.blobs.bucket
+      BLOB_CONFIRM_DLQ_URL     = aws_sqs_queue.blob_confirm_dlq.url
+      BLOB_CLEANUP_DLQ_URL     = aws_sqs_queue.blob_cleanup_dlq.url
+      DLQ_PARKED_QUEUE_URL     = aws_sqs_queue.dlq_parked.url
+      BLOB_CONFIRM_FUNCTION    = aws_lambda_function.blob_confirm.function_name
+      BLOB_CLEANUP_FUNCTION    = aws_lambda_function.blob_cleanup.function_name
+      DYNAMODB_STREAM_ARN      = aws_dynamodb_table.jmap_data.stream_arn
+      DLQ_REDRIVE_MAX_ATTEMPTS = tostring(var.dlq_redrive_max_attempts)
+      METRIC_NAMESPACE         = "JMAPService/${var.environment}"
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-dlq-redrive-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.dlq_redrive_basic_execution,
+    aws_iam_role_policy_attachment.dlq_redrive_xray_access,
+    aws_iam_role_policy.dlq_redrive_sqs,
+    aws_iam_role_policy.dlq_redrive_streams,
+    aws_iam_role_policy.dlq_redrive_lambda,
+    aws_cloudwatch_log_group.dlq_redrive_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "dlq-redrive"
+  }
+}
+
+# =============================================================================
+# EventBridge Schedule
+# =============================================================================
+
+resource "aws_cloudwatch_event_rule" "dlq_redrive_schedule" {
+  name                = "${local.resource_prefix}-dlq-redrive-schedule-${var.environment}"
+  description         = "Redrive the blob-confirm and blob-cleanup DLQs every 15 minutes"
+  schedule_expression = "rate(15 minutes)"
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-schedule-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_cloudwatch_event_target" "dlq_redrive_target" {
+  rule      = aws_cloudwatch_event_rule.dlq_redrive_schedule.name
+  target_id = "DLQRedrive"
+  arn       = aws_lambda_function.dlq_redrive.arn
+}
+
+resource "aws_lambda_permission" "dlq_redrive_eventbridge" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.dlq_redrive.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.dlq_redrive_schedule.arn
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Alarm for parked messages, per dead letter queue
+resource "aws_cloudwatch_metric_alarm" "dlq_redrive_parked" {
+  for_each = toset(["blob-confirm", "blob-cleanup"])
+
+  alarm_name          = "${local.resource_prefix}-dlq-redrive-parked-${each.key}-${var.environment}"
+  alarm_description   = "Alerts when dlq-redrive parks ${each.key} dead letters that need investigation"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "DLQMessagesParked"
+  namespace           = "JMAPService/${var.environment}"
+  period              = 900
+  statistic           = "Sum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    Queue = each.key
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-parked-${each.key}-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Alarm for dlq-redrive Lambda errors
+resource "aws_cloudwatch_metric_alarm" "dlq_redrive_errors" {
+  alarm_name          = "${local.resource_prefix}-dlq-redrive-errors-${var.environment}"
+  alarm_description   = "Alerts when dlq-redrive Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 900
+  statistic           = "Sum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.dlq_redrive.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-dlq-redrive-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
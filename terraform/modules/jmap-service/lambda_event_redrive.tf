@@ -0,0 +1,245 @@
+# Lambda function for event-redrive (scheduled redrive of dead-lettered events)
+# Resends plugin events that the publisher could not send after retrying
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "event_redrive_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-event-redrive-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-redrive-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-redrive"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "event_redrive_execution" {
+  name               = "${local.resource_prefix}-event-redrive-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-redrive-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-redrive"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "event_redrive_basic_execution" {
+  role       = aws_iam_role.event_redrive_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "event_redrive_xray_access" {
+  role       = aws_iam_role.event_redrive_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "event_redrive_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-event-redrive-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.event_redrive_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (read, update and delete dead letters, load
+# plugin registry)
+data "aws_iam_policy_document" "event_redrive_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Query",
+      "dynamodb:UpdateItem",
+      "dynamodb:DeleteItem",
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "event_redrive_dynamodb" {
+  name   = "${local.resource_prefix}-event-redrive-dynamodb-${var.environment}"
+  role   = aws_iam_role.event_redrive_execution.id
+  policy = data.aws_iam_policy_document.event_redrive_dynamodb.json
+}
+
+# IAM policy for SQS access (resend events to plugin queues)
+data "aws_iam_policy_document" "event_redrive_sqs" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+    ]
+    resources = [
+      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*"
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "event_redrive_sqs" {
+  name   = "${local.resource_prefix}-event-redrive-sqs-${var.environment}"
+  role   = aws_iam_role.event_redrive_execution.id
+  policy = data.aws_iam_policy_document.event_redrive_sqs.json
+}
+
+# IAM policy for EventBridge and SNS access (resend events to plugin buses and topics)
+resource "aws_iam_role_policy" "event_redrive_events" {
+  name   = "${local.resource_prefix}-event-redrive-events-${var.environment}"
+  role   = aws_iam_role.event_redrive_execution.id
+  policy = data.aws_iam_policy_document.event_bus_publish.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "event_redrive" {
+  filename         = "${path.module}/../../../build/event-redrive/lambda.zip"
+  function_name    = "${local.resource_prefix}-event-redrive-${var.environment}"
+  role             = aws_iam_role.event_redrive_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/event-redrive/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 300 # Retries each send with backoff
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-event-redrive-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.event_redrive_basic_execution,
+    aws_iam_role_policy_attachment.event_redrive_xray_access,
+    aws_iam_role_policy.event_redrive_cloudwatch_metrics,
+    aws_iam_role_policy.event_redrive_dynamodb,
+    aws_iam_role_policy.event_redrive_sqs,
+    aws_iam_role_policy.event_redrive_events,
+    aws_cloudwatch_log_group.event_redrive_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-redrive-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-redrive"
+  }
+}
+
+# =============================================================================
+# EventBridge Schedule
+# =============================================================================
+
+resource "aws_cloudwatch_event_rule" "event_redrive_schedule" {
+  name                = "${local.resource_prefix}-event-redrive-schedule-${var.environment}"
+  description         = "Redrive dead-lettered events every 15 minutes"
+  schedule_expression = "rate(15 minutes)"
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-redrive-schedule-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_cloudwatch_event_target" "event_redrive_target" {
+  rule      = aws_cloudwatch_event_rule.event_redrive_schedule.name
+  target_id = "EventRedrive"
+  arn       = aws_lambda_function.event_redrive.arn
+}
+
+resource "aws_lambda_permission" "event_redrive_eventbridge" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.event_redrive.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.event_redrive_schedule.arn
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "event_redrive_errors" {
+  name           = "${local.resource_prefix}-event-redrive-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.event_redrive_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "EventRedriveErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for event-redrive Lambda errors
+resource "aws_cloudwatch_metric_alarm" "event_redrive_errors" {
+  alarm_name          = "${local.resource_prefix}-event-redrive-errors-${var.environment}"
+  alarm_description   = "Alerts when event-redrive Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.event_redrive.function_name
+  }
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-redrive-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for event-redrive Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "event_redrive_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.event_redrive_logs.arn]
+  detector_name        = "${local.resource_prefix}-event-redrive-anomaly-${var.environment}"
+  enabled              = true
+  evaluation_frequency = "FIFTEEN_MIN"
+}
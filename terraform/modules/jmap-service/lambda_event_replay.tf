@@ -0,0 +1,244 @@
+# Lambda function for event-replay (POST /plugin-iam/events/replay)
+# Replays logged events to the calling plugin's registered targets (IAM auth only)
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "event_replay_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-event-replay-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-replay-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-replay"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "event_replay_execution" {
+  name               = "${local.resource_prefix}-event-replay-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-replay-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-replay"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "event_replay_basic_execution" {
+  role       = aws_iam_role.event_replay_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "event_replay_xray_access" {
+  role       = aws_iam_role.event_replay_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "event_replay_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-event-replay-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.event_replay_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (query event log and plugin registry, record callback nonces)
+data "aws_iam_policy_document" "event_replay_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Query",
+      "dynamodb:PutItem"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "event_replay_dynamodb" {
+  name   = "${local.resource_prefix}-event-replay-dynamodb-${var.environment}"
+  role   = aws_iam_role.event_replay_execution.id
+  policy = data.aws_iam_policy_document.event_replay_dynamodb.json
+}
+
+# IAM policy for SQS access (replay events to plugin queues)
+data "aws_iam_policy_document" "event_replay_sqs" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+    ]
+    resources = [
+      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*"
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "event_replay_sqs" {
+  name   = "${local.resource_prefix}-event-replay-sqs-${var.environment}"
+  role   = aws_iam_role.event_replay_execution.id
+  policy = data.aws_iam_policy_document.event_replay_sqs.json
+}
+
+# IAM policy for EventBridge and SNS access (replay events to plugin buses and topics)
+resource "aws_iam_role_policy" "event_replay_events" {
+  name   = "${local.resource_prefix}-event-replay-events-${var.environment}"
+  role   = aws_iam_role.event_replay_execution.id
+  policy = data.aws_iam_policy_document.event_bus_publish.json
+}
+
+# IAM policy for reading plugin callback signing secrets
+# Callback secrets must be named jmap-plugin-callback-*
+data "aws_iam_policy_document" "event_replay_callback_secrets" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "secretsmanager:GetSecretValue",
+    ]
+    resources = ["arn:aws:secretsmanager:*:${data.aws_caller_identity.current.account_id}:secret:jmap-plugin-callback-*"]
+  }
+}
+
+resource "aws_iam_role_policy" "event_replay_callback_secrets" {
+  name   = "${local.resource_prefix}-event-replay-callback-secrets-${var.environment}"
+  role   = aws_iam_role.event_replay_execution.id
+  policy = data.aws_iam_policy_document.event_replay_callback_secrets.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "event_replay" {
+  filename         = "${path.module}/../../../build/event-replay/lambda.zip"
+  function_name    = "${local.resource_prefix}-event-replay-${var.environment}"
+  role             = aws_iam_role.event_replay_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/event-replay/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 29 # API Gateway integration limit
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-event-replay-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.event_replay_basic_execution,
+    aws_iam_role_policy_attachment.event_replay_xray_access,
+    aws_iam_role_policy.event_replay_cloudwatch_metrics,
+    aws_iam_role_policy.event_replay_dynamodb,
+    aws_iam_role_policy.event_replay_sqs,
+    aws_iam_role_policy.event_replay_events,
+    aws_iam_role_policy.event_replay_callback_secrets,
+    aws_cloudwatch_log_group.event_replay_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-replay-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "event-replay"
+  }
+}
+
+# API Gateway permission to invoke event-replay Lambda
+resource "aws_lambda_permission" "event_replay_apigw" {
+  statement_id  = "AllowAPIGatewayInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.event_replay.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_api_gateway_rest_api.api.execution_arn}/*"
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "event_replay_errors" {
+  name           = "${local.resource_prefix}-event-replay-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.event_replay_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "EventReplayErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for event-replay Lambda errors
+resource "aws_cloudwatch_metric_alarm" "event_replay_errors" {
+  alarm_name          = "${local.resource_prefix}-event-replay-errors-${var.environment}"
+  alarm_description   = "Alerts when event-replay Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.event_replay.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-event-replay-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for event-replay Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "event_replay_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.event_replay_logs.arn]
+  detector_name        = "${local.resource_prefix}-event-replay-anomaly-${var.environment}"
+  enabled              = var.anomaly_detection_enabled
+  evaluation_frequency = local.anomaly_evaluation_frequency
+}
@@ -0,0 +1,217 @@
+# Lambda function for health (GET /health/ready)
+# Checks DynamoDB, the plugin registry, the blob bucket and Secrets Manager
+# for uptime monitors and post-deploy smoke tests
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "health_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-health-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-health-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "health"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "health_execution" {
+  name               = "${local.resource_prefix}-health-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-health-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "health"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "health_basic_execution" {
+  role       = aws_iam_role.health_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "health_xray_access" {
+  role       = aws_iam_role.health_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "health_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-health-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.health_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for the dependency checks. Reads only: a missing health item,
+# plugin records, the blob bucket's existence and the delegation secret's
+# metadata.
+data "aws_iam_policy_document" "health_checks" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetItem",
+      "dynamodb:Query"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+
+  statement {
+    effect    = "Allow"
+    actions   = ["s3:ListBucket"]
+    resources = [aws_s3_bucket.blobs.arn]
+  }
+
+  statement {
+    effect    = "Allow"
+    actions   = ["secretsmanager:DescribeSecret"]
+    resources = [aws_secretsmanager_secret.delegation_key.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "health_checks" {
+  name   = "${local.resource_prefix}-health-checks-${var.environment}"
+  role   = aws_iam_role.health_execution.id
+  policy = data.aws_iam_policy_document.health_checks.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "health" {
+  filename         = "${path.module}/../../../build/health/lambda.zip"
+  function_name    = "${local.resource_prefix}-health-${var.environment}"
+  role             = aws_iam_role.health_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/health/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = var.lambda_timeout
+  memory_size      = var.lambda_memory_size
+
+  # The endpoint is unauthenticated; bound what polling it can cost
+  reserved_concurrent_executions = 2
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT           = var.environment
+      DYNAMODB_TABLE        = aws_dynamodb_table.jmap_data.name
+      BLOB_BUCKET           = aws_s3_bucket.blobs.bucket
+      DELEGATION_SECRET_ARN = aws_secretsmanager_secret.delegation_key.arn
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-health-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.health_basic_execution,
+    aws_iam_role_policy_attachment.health_xray_access,
+    aws_iam_role_policy.health_cloudwatch_metrics,
+    aws_iam_role_policy.health_checks,
+    aws_cloudwatch_log_group.health_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-health-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "health"
+  }
+}
+
+# Permission for API Gateway to invoke the Lambda
+resource "aws_lambda_permission" "health_apigw" {
+  statement_id  = "AllowAPIGatewayInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.health.function_name
+  principal     = "apigateway.amazonaws.com"
+  source_arn    = "${aws_api_gateway_rest_api.api.execution_arn}/*"
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "health_errors" {
+  name           = "${local.resource_prefix}-health-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.health_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "HealthErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for health Lambda errors
+resource "aws_cloudwatch_metric_alarm" "health_errors" {
+  alarm_name          = "${local.resource_prefix}-health-errors-${var.environment}"
+  alarm_description   = "Alerts when health Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.health.function_name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-health-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for health Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "health_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.health_logs.arn]
+  detector_name        = "${local.resource_prefix}-health-anomaly-${var.environment}"
+  enabled              = var.anomaly_detection_enabled
+  evaluation_frequency = local.anomaly_evaluation_frequency
+}
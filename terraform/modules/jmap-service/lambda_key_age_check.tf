@@ -95,10 +95,10 @@ resource "aws_lambda_function" "key_age_check" {
   memory_size      = 128 # Minimal memory for simple metric publishing
 
   environment {
-    variables = {
+    variables = merge(local.logging_environment, local.tracing_environment, {
       SSM_PARAMETER_NAME = aws_ssm_parameter.cloudfront_key_created_at.name
       METRIC_NAMESPACE   = "JMAPService/${var.environment}"
-    }
+    })
   }
 
   depends_on = [
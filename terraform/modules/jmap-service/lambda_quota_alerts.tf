@@ -0,0 +1,279 @@
+# Lambda function for quota-alerts (DynamoDB Streams trigger)
+# Publishes quota.warning and quota.exceeded events when an account's remaining quota crosses a threshold,
+# and quota.warning events for allocations in the quota grace period, which it ends once usage is back within quota
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "quota_alerts_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-quota-alerts-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "quota-alerts"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "quota_alerts_execution" {
+  name               = "${local.resource_prefix}-quota-alerts-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "quota-alerts"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "quota_alerts_basic_execution" {
+  role       = aws_iam_role.quota_alerts_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "quota_alerts_xray_access" {
+  role       = aws_iam_role.quota_alerts_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "quota_alerts_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-quota-alerts-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.quota_alerts_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (event log, dead letters, plugin registry,
+# ending quota grace periods + read stream)
+data "aws_iam_policy_document" "quota_alerts_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:PutItem",
+      "dynamodb:UpdateItem",
+      "dynamodb:Query"
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:GetRecords",
+      "dynamodb:GetShardIterator",
+      "dynamodb:DescribeStream",
+      "dynamodb:ListStreams"
+    ]
+    resources = ["${aws_dynamodb_table.jmap_data.arn}/stream/*"]
+  }
+}
+
+resource "aws_iam_role_policy" "quota_alerts_dynamodb" {
+  name   = "${local.resource_prefix}-quota-alerts-dynamodb-${var.environment}"
+  role   = aws_iam_role.quota_alerts_execution.id
+  policy = data.aws_iam_policy_document.quota_alerts_dynamodb.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "quota_alerts" {
+  filename         = "${path.module}/../../../build/quota-alerts/lambda.zip"
+  function_name    = "${local.resource_prefix}-quota-alerts-${var.environment}"
+  role             = aws_iam_role.quota_alerts_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/quota-alerts/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 30
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT    = var.environment
+      DYNAMODB_TABLE = aws_dynamodb_table.jmap_data.name
+
+      QUOTA_ALERT_THRESHOLDS = join(",", var.quota_alert_thresholds)
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-quota-alerts-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.quota_alerts_basic_execution,
+    aws_iam_role_policy_attachment.quota_alerts_xray_access,
+    aws_iam_role_policy.quota_alerts_cloudwatch_metrics,
+    aws_iam_role_policy.quota_alerts_dynamodb,
+    aws_iam_role_policy.quota_alerts_sqs,
+    aws_iam_role_policy.quota_alerts_events,
+    aws_cloudwatch_log_group.quota_alerts_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "quota-alerts"
+  }
+}
+
+# SQS Dead Letter Queue for stream records that could not be processed
+resource "aws_sqs_queue" "quota_alerts_dlq" {
+  name                      = "${local.resource_prefix}-quota-alerts-dlq-${var.environment}"
+  message_retention_seconds = 1209600 # 14 days
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-dlq-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "quota-alerts"
+  }
+}
+
+# IAM policy for SQS access (SendMessage to plugin event queues and the DLQ)
+data "aws_iam_policy_document" "quota_alerts_sqs" {
+  statement {
+    effect  = "Allow"
+    actions = ["sqs:SendMessage"]
+    resources = [
+      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*",
+      aws_sqs_queue.quota_alerts_dlq.arn
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "quota_alerts_sqs" {
+  name   = "${local.resource_prefix}-quota-alerts-sqs-${var.environment}"
+  role   = aws_iam_role.quota_alerts_execution.id
+  policy = data.aws_iam_policy_document.quota_alerts_sqs.json
+}
+
+# IAM policy for EventBridge access (PutEvents to plugin event buses)
+resource "aws_iam_role_policy" "quota_alerts_events" {
+  name   = "${local.resource_prefix}-quota-alerts-events-${var.environment}"
+  role   = aws_iam_role.quota_alerts_execution.id
+  policy = data.aws_iam_policy_document.event_bus_publish.json
+}
+
+# DynamoDB Streams event source mapping
+resource "aws_lambda_event_source_mapping" "quota_alerts_stream" {
+  event_source_arn  = aws_dynamodb_table.jmap_data.stream_arn
+  function_name     = aws_lambda_function.quota_alerts.arn
+  starting_position = "LATEST"
+  batch_size        = 10
+
+  # Retry only the records that failed, with backoff through the retry window
+  function_response_types        = ["ReportBatchItemFailures"]
+  maximum_retry_attempts         = 10
+  maximum_record_age_in_seconds  = 86400
+  bisect_batch_on_function_error = true
+
+  # Filter to only invoke for account META# updates
+  filter_criteria {
+    filter {
+      pattern = jsonencode({
+        eventName = ["MODIFY"]
+        dynamodb = {
+          NewImage = {
+            sk = { S = ["META#"] }
+          }
+        }
+      })
+    }
+  }
+
+  # Send records that exhaust their retries to the DLQ
+  destination_config {
+    on_failure {
+      destination_arn = aws_sqs_queue.quota_alerts_dlq.arn
+    }
+  }
+
+  depends_on = [aws_iam_role_policy.quota_alerts_sqs]
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-stream-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "quota_alerts_errors" {
+  name           = "${local.resource_prefix}-quota-alerts-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.quota_alerts_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "QuotaAlertsErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for quota-alerts DLQ messages
+resource "aws_cloudwatch_metric_alarm" "quota_alerts_dlq" {
+  alarm_name          = "${local.resource_prefix}-quota-alerts-dlq-${var.environment}"
+  alarm_description   = "Alerts when quota-alerts DLQ has messages (unpublished quota events)"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "ApproximateNumberOfMessagesVisible"
+  namespace           = "AWS/SQS"
+  period              = 300
+  statistic           = "Maximum"
+  threshold           = 0
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    QueueName = aws_sqs_queue.quota_alerts_dlq.name
+  }
+
+  alarm_actions = [var.alarm_sns_topic_arn]
+  ok_actions    = [var.alarm_sns_topic_arn]
+
+  tags = {
+    Name        = "${local.resource_prefix}-quota-alerts-dlq-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
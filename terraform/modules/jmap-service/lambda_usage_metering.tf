@@ -0,0 +1,247 @@
+# Lambda function for usage-metering (scheduled usage aggregation)
+# Publishes usage.report and usage.threshold events per account for billing
+
+# =============================================================================
+# CloudWatch Log Group
+# =============================================================================
+
+resource "aws_cloudwatch_log_group" "usage_metering_logs" {
+  name              = "/aws/lambda/${local.resource_prefix}-usage-metering-${var.environment}"
+  retention_in_days = var.log_retention_days
+
+  tags = {
+    Name        = "${local.resource_prefix}-usage-metering-logs-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "usage-metering"
+  }
+}
+
+# =============================================================================
+# IAM Role and Policies
+# =============================================================================
+
+resource "aws_iam_role" "usage_metering_execution" {
+  name               = "${local.resource_prefix}-usage-metering-execution-${var.environment}"
+  assume_role_policy = data.aws_iam_policy_document.lambda_assume_role.json
+
+  tags = {
+    Name        = "${local.resource_prefix}-usage-metering-execution-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "usage-metering"
+  }
+}
+
+# Attach AWS managed policy for basic Lambda execution
+resource "aws_iam_role_policy_attachment" "usage_metering_basic_execution" {
+  role       = aws_iam_role.usage_metering_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+# Attach AWS managed policy for X-Ray tracing
+resource "aws_iam_role_policy_attachment" "usage_metering_xray_access" {
+  role       = aws_iam_role.usage_metering_execution.name
+  policy_arn = "arn:aws:iam::aws:policy/AWSXRayDaemonWriteAccess"
+}
+
+# IAM policy for CloudWatch Metrics
+resource "aws_iam_role_policy" "usage_metering_cloudwatch_metrics" {
+  name   = "${local.resource_prefix}-usage-metering-cloudwatch-metrics-${var.environment}"
+  role   = aws_iam_role.usage_metering_execution.id
+  policy = data.aws_iam_policy_document.cloudwatch_metrics.json
+}
+
+# IAM policy for DynamoDB access (scan accounts, read counters, save metering
+# state, load plugin registry)
+data "aws_iam_policy_document" "usage_metering_dynamodb" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "dynamodb:Scan",
+      "dynamodb:GetItem",
+      "dynamodb:PutItem",
+      "dynamodb:Query",
+    ]
+    resources = [aws_dynamodb_table.jmap_data.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "usage_metering_dynamodb" {
+  name   = "${local.resource_prefix}-usage-metering-dynamodb-${var.environment}"
+  role   = aws_iam_role.usage_metering_execution.id
+  policy = data.aws_iam_policy_document.usage_metering_dynamodb.json
+}
+
+# IAM policy for SQS access (publish usage events to plugin queues)
+data "aws_iam_policy_document" "usage_metering_sqs" {
+  statement {
+    effect = "Allow"
+    actions = [
+      "sqs:SendMessage",
+    ]
+    resources = [
+      "arn:aws:sqs:${data.aws_region.current.id}:${data.aws_caller_identity.current.account_id}:jmap-service-*"
+    ]
+  }
+}
+
+resource "aws_iam_role_policy" "usage_metering_sqs" {
+  name   = "${local.resource_prefix}-usage-metering-sqs-${var.environment}"
+  role   = aws_iam_role.usage_metering_execution.id
+  policy = data.aws_iam_policy_document.usage_metering_sqs.json
+}
+
+# IAM policy for EventBridge access (PutEvents to plugin event buses)
+resource "aws_iam_role_policy" "usage_metering_events" {
+  name   = "${local.resource_prefix}-usage-metering-events-${var.environment}"
+  role   = aws_iam_role.usage_metering_execution.id
+  policy = data.aws_iam_policy_document.event_bus_publish.json
+}
+
+# =============================================================================
+# Lambda Function
+# =============================================================================
+
+resource "aws_lambda_function" "usage_metering" {
+  filename         = "${path.module}/../../../build/usage-metering/lambda.zip"
+  function_name    = "${local.resource_prefix}-usage-metering-${var.environment}"
+  role             = aws_iam_role.usage_metering_execution.arn
+  handler          = "bootstrap"
+  source_code_hash = filebase64sha256("${path.module}/../../../build/usage-metering/lambda.zip")
+  runtime          = "provided.al2023"
+  architectures    = ["arm64"]
+  timeout          = 300 # Scans every account
+  memory_size      = var.lambda_memory_size
+
+  # Add ADOT Collector layer for OpenTelemetry sidecar
+  layers = [local.adot_layer_arn]
+
+  # Enable X-Ray tracing (ADOT Collector exports to X-Ray)
+  tracing_config {
+    mode = "Active"
+  }
+
+  environment {
+    variables = merge(local.logging_environment, local.tracing_environment, {
+      ENVIRONMENT      = var.environment
+      DYNAMODB_TABLE   = aws_dynamodb_table.jmap_data.name
+      USAGE_THRESHOLDS = join(",", var.usage_thresholds)
+
+      # ADOT Collector Configuration
+      OPENTELEMETRY_COLLECTOR_CONFIG_URI = "file:///var/task/collector.yaml"
+      OPENTELEMETRY_EXTENSION_LOG_LEVEL  = "error"
+
+      # OpenTelemetry SDK Configuration
+      OTEL_SERVICE_NAME   = "${local.resource_prefix}-usage-metering-${var.environment}"
+      OTEL_TRACES_SAMPLER = "always_on"
+
+      # CRITICAL: Include xray propagator for Lambda context extraction
+      OTEL_PROPAGATORS = "tracecontext,baggage,xray"
+
+      # OTLP Exporter Configuration (points to ADOT Collector)
+      OTEL_EXPORTER_OTLP_ENDPOINT = "http://localhost:4317"
+      OTEL_EXPORTER_OTLP_PROTOCOL = "grpc"
+
+      # Resource attributes for better trace identification
+      OTEL_RESOURCE_ATTRIBUTES = "service.version=1.0.0"
+    })
+  }
+
+  depends_on = [
+    aws_iam_role_policy_attachment.usage_metering_basic_execution,
+    aws_iam_role_policy_attachment.usage_metering_xray_access,
+    aws_iam_role_policy.usage_metering_cloudwatch_metrics,
+    aws_iam_role_policy.usage_metering_dynamodb,
+    aws_iam_role_policy.usage_metering_sqs,
+    aws_iam_role_policy.usage_metering_events,
+    aws_cloudwatch_log_group.usage_metering_logs
+  ]
+
+  tags = {
+    Name        = "${local.resource_prefix}-usage-metering-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+    Function    = "usage-metering"
+  }
+}
+
+# =============================================================================
+# EventBridge Schedule
+# =============================================================================
+
+resource "aws_cloudwatch_event_rule" "usage_metering_schedule" {
+  name                = "${local.resource_prefix}-usage-metering-schedule-${var.environment}"
+  description         = "Schedule usage metering every hour"
+  schedule_expression = "rate(1 hour)"
+
+  tags = {
+    Name        = "${local.resource_prefix}-usage-metering-schedule-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+resource "aws_cloudwatch_event_target" "usage_metering_target" {
+  rule      = aws_cloudwatch_event_rule.usage_metering_schedule.name
+  target_id = "UsageMetering"
+  arn       = aws_lambda_function.usage_metering.arn
+}
+
+resource "aws_lambda_permission" "usage_metering_eventbridge" {
+  statement_id  = "AllowEventBridgeInvoke"
+  action        = "lambda:InvokeFunction"
+  function_name = aws_lambda_function.usage_metering.function_name
+  principal     = "events.amazonaws.com"
+  source_arn    = aws_cloudwatch_event_rule.usage_metering_schedule.arn
+}
+
+# =============================================================================
+# CloudWatch Monitoring
+# =============================================================================
+
+# CloudWatch Log Metric Filter for errors
+resource "aws_cloudwatch_log_metric_filter" "usage_metering_errors" {
+  name           = "${local.resource_prefix}-usage-metering-errors-${var.environment}"
+  log_group_name = aws_cloudwatch_log_group.usage_metering_logs.name
+  pattern        = "[timestamp, request_id, level = ERROR*, ...]"
+
+  metric_transformation {
+    name      = "UsageMeteringErrorCount"
+    namespace = "JMAPService/${var.environment}"
+    value     = "1"
+    unit      = "Count"
+  }
+}
+
+# CloudWatch Alarm for usage-metering Lambda errors
+resource "aws_cloudwatch_metric_alarm" "usage_metering_errors" {
+  alarm_name          = "${local.resource_prefix}-usage-metering-errors-${var.environment}"
+  alarm_description   = "Alerts when usage-metering Lambda has errors"
+  comparison_operator = "GreaterThanThreshold"
+  evaluation_periods  = 1
+  metric_name         = "Errors"
+  namespace           = "AWS/Lambda"
+  period              = 300
+  statistic           = "Sum"
+  threshold           = 1
+  treat_missing_data  = "notBreaching"
+
+  dimensions = {
+    FunctionName = aws_lambda_function.usage_metering.function_name
+  }
+
+  tags = {
+    Name        = "${local.resource_prefix}-usage-metering-errors-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+# CloudWatch Log Anomaly Detector for usage-metering Lambda
+resource "aws_cloudwatch_log_anomaly_detector" "usage_metering_anomaly" {
+  log_group_arn_list   = [aws_cloudwatch_log_group.usage_metering_logs.arn]
+  detector_name        = "${local.resource_prefix}-usage-metering-anomaly-${var.environment}"
+  enabled              = true
+  evaluation_frequency = "FIFTEEN_MIN"
+}
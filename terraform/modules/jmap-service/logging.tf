@@ -0,0 +1,80 @@
+# Log Level Control
+#
+# Every Lambda starts at log_level. When log_level_refresh_seconds is set,
+# they also re-read the level from an SSM parameter on that interval, so it
+# can be raised in production without a deployment:
+#   aws ssm put-parameter --name <name> --value DEBUG --overwrite
+
+locals {
+  log_level_refresh_enabled = var.log_level_refresh_seconds > 0
+
+  # Environment shared by all Lambda functions
+  logging_environment = {
+    LOG_LEVEL                 = var.log_level
+    LOG_LEVEL_PARAMETER       = local.log_level_refresh_enabled ? aws_ssm_parameter.log_level.name : ""
+    LOG_LEVEL_REFRESH_SECONDS = tostring(var.log_level_refresh_seconds)
+    LOG_DEBUG_PRINCIPALS      = join(",", var.log_debug_principals)
+  }
+
+  # Execution roles that read the log level parameter
+  logging_roles = {
+    get-jmap-session   = aws_iam_role.get_jmap_session_execution.id
+    health             = aws_iam_role.health_execution.id
+    canary             = aws_iam_role.canary_execution.id
+    jmap-api           = aws_iam_role.jmap_api_execution.id
+    account-admin      = aws_iam_role.account_admin_execution.id
+    account-export     = aws_iam_role.account_export_execution.id
+    account-import     = aws_iam_role.account_import_execution.id
+    account-init       = aws_iam_role.account_init_execution.id
+    account-reaper     = aws_iam_role.account_reaper_execution.id
+    apikey-authorizer  = aws_iam_role.apikey_authorizer_execution.id
+    blob-alloc-cleanup = aws_iam_role.blob_alloc_cleanup_execution.id
+    blob-cleanup       = aws_iam_role.blob_cleanup_execution.id
+    blob-confirm       = aws_iam_role.blob_confirm_execution.id
+    blob-delete        = aws_iam_role.blob_delete_execution.id
+    blob-download      = aws_iam_role.blob_download_execution.id
+    blob-upload        = aws_iam_role.blob_upload_execution.id
+    core-echo          = aws_iam_role.core_echo_execution.id
+    dlq-redrive        = aws_iam_role.dlq_redrive_execution.id
+    event-redrive      = aws_iam_role.event_redrive_execution.id
+    event-replay       = aws_iam_role.event_replay_execution.id
+    key-age-check      = aws_iam_role.key_age_check_execution.id
+    outbox-publisher   = aws_iam_role.outbox_publisher_execution.id
+    quota-alerts       = aws_iam_role.quota_alerts_execution.id
+    usage-metering     = aws_iam_role.usage_metering_execution.id
+  }
+}
+
+resource "aws_ssm_parameter" "log_level" {
+  name        = "/${local.resource_prefix}/${var.environment}/log-level"
+  type        = "String"
+  value       = var.log_level
+  description = "Log level re-read by Lambda functions when log level refresh is enabled"
+
+  # Changed at runtime to raise or lower verbosity
+  lifecycle {
+    ignore_changes = [value]
+  }
+
+  tags = {
+    Name        = "${local.resource_prefix}-log-level-${var.environment}"
+    Environment = var.environment
+    Service     = "jmap-service"
+  }
+}
+
+data "aws_iam_policy_document" "log_level_read" {
+  statement {
+    effect    = "Allow"
+    actions   = ["ssm:GetParameter"]
+    resources = [aws_ssm_parameter.log_level.arn]
+  }
+}
+
+resource "aws_iam_role_policy" "log_level_read" {
+  for_each = local.log_level_refresh_enabled ? local.logging_roles : {}
+
+  name   = "${local.resource_prefix}-${each.key}-log-level-${var.environment}"
+  role   = each.value
+  policy = data.aws_iam_policy_document.log_level_read.json
+}
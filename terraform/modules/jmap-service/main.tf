@@ -31,4 +31,13 @@ locals {
 
   # Construct ARN dynamically using current region
   adot_layer_arn = "arn:aws:lambda:${data.aws_region.current.id}:${local.adot_account_id}:layer:${local.adot_layer_name}:${local.adot_layer_version}"
+
+  # ACCOUNT_TYPE_FEATURES uses the Go field names; unset options are null
+  account_type_features_json = jsonencode({
+    for account_type, f in var.account_type_features : account_type => {
+      multipart    = f.multipart
+      maxBlobSize  = f.max_blob_size
+      capabilities = f.capabilities
+    }
+  })
 }
@@ -48,6 +48,11 @@ output "api_endpoint" {
   value       = "https://${var.domain_name}/health"
 }
 
+output "health_ready_endpoint" {
+  description = "Readiness endpoint checking the service's dependencies"
+  value       = "https://${var.domain_name}/health/ready"
+}
+
 # Cognito outputs
 output "cognito_user_pool_id" {
   description = "ID of the Cognito User Pool"
@@ -14,7 +14,7 @@ resource "aws_dynamodb_table_item" "core_plugin" {
       M = {
         "urn:ietf:params:jmap:core" = {
           M = {
-            maxSizeUpload         = { N = "10000000" }
+            maxSizeUpload         = { N = tostring(var.max_size_upload) }
             maxConcurrentUpload   = { N = "4" }
             maxSizeRequest        = { N = "10000000" }
             maxConcurrentRequests = { N = "4" }
@@ -30,6 +30,9 @@ resource "aws_dynamodb_table_item" "core_plugin" {
             maxPendingAllocations = { N = tostring(var.max_pending_allocations) }
           }
         }
+        "https://jmap.rrod.net/extensions/account-export" = {
+          M = {}
+        }
       }
     }
     methods = {
@@ -43,7 +46,7 @@ resource "aws_dynamodb_table_item" "core_plugin" {
       }
     }
     clientPrincipals = {
-      L = [for arn in concat(var.iam_client_principals, [aws_iam_role.e2e_test_client.arn]) : { S = arn }]
+      L = [for arn in concat(var.iam_client_principals, [aws_iam_role.e2e_test_client.arn, aws_iam_role.canary_execution.arn]) : { S = arn }]
     }
     registeredAt = { S = "2025-01-17T00:00:00Z" }
     version      = { S = "1.0.0" }
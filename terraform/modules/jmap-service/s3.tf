@@ -38,6 +38,60 @@ data "aws_iam_policy_document" "blobs_cloudfront_access" {
       values   = [aws_cloudfront_distribution.api.arn]
     }
   }
+
+  # Delegate access control to this account's access points, whose own
+  # policies limit each to one account's prefix
+  dynamic "statement" {
+    for_each = length(var.blob_access_point_accounts) > 0 ? [1] : []
+    content {
+      sid    = "DelegateToAccessPoints"
+      effect = "Allow"
+
+      principals {
+        type        = "AWS"
+        identifiers = ["*"]
+      }
+
+      actions   = ["s3:*"]
+      resources = [aws_s3_bucket.blobs.arn, "${aws_s3_bucket.blobs.arn}/*"]
+
+      condition {
+        test     = "StringEquals"
+        variable = "s3:DataAccessPointAccount"
+        values   = [data.aws_caller_identity.current.account_id]
+      }
+    }
+  }
+
+  # The writers' roles may only write an access point account's prefix
+  # through that account's access point, so their credentials cannot reach
+  # the prefix straight through the bucket
+  dynamic "statement" {
+    for_each = toset(var.blob_access_point_accounts)
+    content {
+      sid    = "AccessPointOnly${substr(sha1(statement.value), 0, 24)}"
+      effect = "Deny"
+
+      principals {
+        type        = "AWS"
+        identifiers = [aws_iam_role.blob_upload_execution.arn, aws_iam_role.jmap_api_execution.arn]
+      }
+
+      actions = [
+        "s3:PutObject",
+        "s3:PutObjectTagging",
+        "s3:AbortMultipartUpload",
+        "s3:ListMultipartUploadParts",
+      ]
+      resources = ["${aws_s3_bucket.blobs.arn}/${statement.value}/*"]
+
+      condition {
+        test     = "StringNotEquals"
+        variable = "s3:DataAccessPointArn"
+        values   = [aws_s3_access_point.account[statement.value].arn]
+      }
+    }
+  }
 }
 
 resource "aws_s3_bucket_policy" "blobs" {
@@ -74,10 +128,10 @@ resource "aws_s3_bucket_cors_configuration" "blobs" {
   bucket = aws_s3_bucket.blobs.id
 
   cors_rule {
-    allowed_headers = ["Content-Type", "Content-Length"]
+    allowed_headers = ["Content-Type", "Content-Length", "x-amz-checksum-sha256"]
     allowed_methods = ["PUT"]
     allowed_origins = var.cors_allowed_origins
-    expose_headers  = ["ETag"]
+    expose_headers  = ["ETag", "x-amz-checksum-sha256"]
     max_age_seconds = 3600
   }
 }
@@ -125,3 +179,57 @@ resource "aws_s3_bucket_lifecycle_configuration" "blobs" {
   }
 
 }
+
+# Per-account access points. Uploads and presigned upload URLs for these
+# accounts go through their access point, whose policy only allows objects
+# under the account's prefix. Names are derived from a hash, as account IDs
+# may hold characters access point names cannot.
+resource "aws_s3_access_point" "account" {
+  for_each = toset(var.blob_access_point_accounts)
+
+  bucket = aws_s3_bucket.blobs.id
+  name   = "jmap-${substr(sha1(each.value), 0, 24)}-${var.environment}"
+
+  public_access_block_configuration {
+    block_public_acls       = true
+    block_public_policy     = true
+    ignore_public_acls      = true
+    restrict_public_buckets = true
+  }
+}
+
+data "aws_iam_policy_document" "blobs_access_point" {
+  for_each = aws_s3_access_point.account
+
+  statement {
+    sid    = "AccountPrefixOnly"
+    effect = "Allow"
+
+    principals {
+      type        = "AWS"
+      identifiers = [aws_iam_role.blob_upload_execution.arn, aws_iam_role.jmap_api_execution.arn]
+    }
+
+    actions = [
+      "s3:PutObject",
+      "s3:PutObjectTagging",
+      "s3:AbortMultipartUpload",
+      "s3:ListMultipartUploadParts",
+    ]
+    resources = ["${each.value.arn}/object/${each.key}/*"]
+  }
+}
+
+resource "aws_s3control_access_point_policy" "account" {
+  for_each = aws_s3_access_point.account
+
+  access_point_arn = each.value.arn
+  policy           = data.aws_iam_policy_document.blobs_access_point[each.key].json
+}
+
+locals {
+  # Account ID to access point ARN, for BLOB_ACCESS_POINTS
+  blob_access_points = jsonencode({ for account, point in aws_s3_access_point.account : account => point.arn })
+  # Object ARNs of every access point, for the writers' IAM policies
+  blob_access_point_objects = [for point in aws_s3_access_point.account : "${point.arn}/object/*"]
+}
@@ -0,0 +1,22 @@
+# Tracing Backend
+#
+# By default every Lambda sends traces through the ADOT collector to X-Ray.
+# With tracing_backend = "otlp" they export straight to tracing_otlp_endpoint
+# instead, for Jaeger, Tempo, Honeycomb and other OTLP backends. The
+# traces-specific variables take precedence over OTEL_EXPORTER_OTLP_ENDPOINT,
+# which still points metrics at the collector.
+
+locals {
+  tracing_otlp = var.tracing_backend == "otlp"
+
+  # Environment shared by all Lambda functions; the OTLP variables are only
+  # set for the otlp backend. The headers are sensitive, which hides the
+  # functions' environment in plans.
+  tracing_environment = merge(
+    { TRACING_BACKEND = var.tracing_backend },
+    { for name, value in {
+      OTEL_EXPORTER_OTLP_TRACES_ENDPOINT = var.tracing_otlp_endpoint
+      OTEL_EXPORTER_OTLP_TRACES_HEADERS  = join(",", [for header, header_value in var.tracing_otlp_headers : "${header}=${header_value}"])
+    } : name => value if local.tracing_otlp },
+  )
+}
@@ -25,6 +25,98 @@ variable "log_retention_days" {
   }
 }
 
+variable "log_level" {
+  description = "Initial log level for all Lambda functions (DEBUG, INFO, WARN or ERROR)"
+  type        = string
+  default     = "INFO"
+
+  validation {
+    condition     = contains(["DEBUG", "INFO", "WARN", "ERROR"], var.log_level)
+    error_message = "Log level must be DEBUG, INFO, WARN or ERROR"
+  }
+}
+
+variable "log_level_refresh_seconds" {
+  description = "How often Lambda functions re-read the log level SSM parameter (0 uses log_level only)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.log_level_refresh_seconds >= 0
+    error_message = "Log level refresh interval must not be negative"
+  }
+}
+
+variable "log_debug_principals" {
+  description = "Cognito subs and IAM role ARNs that may request debug logging for a single request with the X-Debug-Log header"
+  type        = list(string)
+  default     = []
+}
+
+variable "otel_metrics_enabled" {
+  description = "Export jmap-api's OpenTelemetry metrics through the ADOT collector"
+  type        = bool
+  default     = false
+}
+
+variable "tracing_backend" {
+  description = "Where Lambda functions send traces: xray (through the ADOT collector) or otlp (straight to tracing_otlp_endpoint)"
+  type        = string
+  default     = "xray"
+
+  validation {
+    condition     = contains(["xray", "otlp"], var.tracing_backend)
+    error_message = "Tracing backend must be xray or otlp"
+  }
+}
+
+variable "tracing_otlp_endpoint" {
+  description = "OTLP gRPC endpoint for traces when tracing_backend is otlp, e.g. https://api.honeycomb.io:443"
+  type        = string
+  default     = ""
+}
+
+variable "tracing_otlp_headers" {
+  description = "Headers sent with OTLP traces, such as API keys, when tracing_backend is otlp"
+  type        = map(string)
+  default     = {}
+  sensitive   = true
+}
+
+variable "log_sample_percent" {
+  description = "Percentage of jmap-api requests whose method calls and responses are logged in full, with email addresses and content redacted (0 disables)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.log_sample_percent >= 0 && var.log_sample_percent <= 100
+    error_message = "Log sample percentage must be between 0 and 100"
+  }
+}
+
+variable "idempotency_ttl_seconds" {
+  description = "How long jmap-api keeps responses to replay for requests repeating an Idempotency-Key (0 ignores the header)"
+  type        = number
+  default     = 86400 # 1 day
+
+  validation {
+    condition     = var.idempotency_ttl_seconds >= 0 && var.idempotency_ttl_seconds <= 604800
+    error_message = "Idempotency TTL must be between 0 and 604800 seconds (7 days)"
+  }
+}
+
+variable "canary_account_id" {
+  description = "Account the canary calls Core/ping on. It doesn't need to be provisioned."
+  type        = string
+  default     = "canary"
+}
+
+variable "canary_schedule" {
+  description = "EventBridge schedule expression for the canary"
+  type        = string
+  default     = "rate(5 minutes)"
+}
+
 variable "lambda_memory_size" {
   description = "Lambda memory size in MB"
   type        = number
@@ -75,6 +167,127 @@ variable "signed_url_expiry_seconds" {
   }
 }
 
+variable "signed_url_ipv4_prefix" {
+  description = "Prefix length of the requester's IPv4 range that signed URLs are bound to (0 leaves them unbound)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.signed_url_ipv4_prefix >= 0 && var.signed_url_ipv4_prefix <= 32
+    error_message = "IPv4 prefix length must be between 0 and 32"
+  }
+}
+
+variable "signed_url_ipv6_prefix" {
+  description = "Prefix length of the requester's IPv6 range that signed URLs are bound to (0 leaves them unbound)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.signed_url_ipv6_prefix >= 0 && var.signed_url_ipv6_prefix <= 128
+    error_message = "IPv6 prefix length must be between 0 and 128"
+  }
+}
+
+variable "blob_cache_size" {
+  description = "Number of blob records blob-download keeps in memory per Lambda instance (0 disables the cache)"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.blob_cache_size >= 0 && var.blob_cache_size <= 100000
+    error_message = "Blob cache size must be between 0 and 100000"
+  }
+}
+
+variable "blob_cache_ttl_seconds" {
+  description = "How long blob-download reuses a cached blob record before reading it again"
+  type        = number
+  default     = 30
+
+  validation {
+    condition     = var.blob_cache_ttl_seconds >= 1 && var.blob_cache_ttl_seconds <= 3600
+    error_message = "Blob cache TTL must be between 1 and 3600 seconds"
+  }
+}
+
+variable "blob_access_point_accounts" {
+  description = "Account IDs given their own S3 Access Point, limited to the account's prefix, which uploads and Blob/allocate URLs for the account go through"
+  type        = list(string)
+  default     = []
+}
+
+variable "blob_download_regions" {
+  description = "JSON object of replica region domains and the countries each serves, e.g. {\"domains\": {\"eu-west-1\": \"eu.cdn.example.com\"}, \"countries\": {\"DE\": \"eu-west-1\"}}; empty serves every download from the primary distribution"
+  type        = string
+  default     = ""
+}
+
+variable "blob_mirror_region" {
+  description = "Region of the DR replica confirmed blobs are mirrored to. Empty disables mirroring"
+  type        = string
+  default     = ""
+}
+
+variable "blob_mirror_bucket" {
+  description = "S3 bucket in blob_mirror_region that blob-mirror copies confirmed blobs to; created outside this module"
+  type        = string
+  default     = ""
+}
+
+variable "blob_mirror_table" {
+  description = "DynamoDB table in blob_mirror_region that blob-mirror copies blob records to; created outside this module"
+  type        = string
+  default     = ""
+}
+
+variable "blob_mirror_domain" {
+  description = "CloudFront domain serving blob_mirror_bucket under /blobs/*, used by blob-download during a failover"
+  type        = string
+  default     = ""
+}
+
+variable "blob_backfill_source_buckets" {
+  description = "S3 buckets account-admin may backfill existing objects from as blobs. Empty disables the backfill route"
+  type        = list(string)
+  default     = []
+}
+
+variable "blob_download_failover" {
+  description = "Serve every download from the blob mirror: read blob records from blob_mirror_table and sign URLs for blob_mirror_domain"
+  type        = bool
+  default     = false
+}
+
+variable "blob_content_sniffing" {
+  description = "Check each allocated blob's declared content type against its first bytes on confirm: off, flag (record and flag mismatches) or correct (also replace the declared type)"
+  type        = string
+  default     = "off"
+
+  validation {
+    condition     = contains(["off", "flag", "correct"], var.blob_content_sniffing)
+    error_message = "blob_content_sniffing must be off, flag or correct"
+  }
+}
+
+variable "upload_progress_events" {
+  description = "Publish a blob.upload.part event for each part of a multipart upload when Blob/complete assembles it"
+  type        = bool
+  default     = false
+}
+
+variable "blob_tag_keys" {
+  description = "Extra S3 tag keys (at most 7, e.g. Source, Retention) clients may set on blobs with Blob/allocate or X-Tag-{Key} upload headers, for lifecycle rules to key on"
+  type        = list(string)
+  default     = []
+}
+
+variable "blob_scanning_enabled" {
+  description = "Publish a blob.scan.requested event for each confirmed blob, for a scanner plugin to report a verdict on"
+  type        = bool
+  default     = false
+}
+
 variable "cloudfront_signing_key_rotation_phase" {
   description = "CloudFront signing key rotation phase: 'normal', 'rotating', or 'complete'"
   type        = string
@@ -98,6 +311,18 @@ variable "iam_client_principals" {
   default     = []
 }
 
+variable "admin_principals" {
+  description = "IAM role ARNs authorized to call the account admin API (/admin-iam/*). Empty denies all admin access."
+  type        = list(string)
+  default     = []
+}
+
+variable "admin_cognito_group" {
+  description = "Cognito group whose members may call the admin API through /admin/* with a user token. Empty denies all Cognito admin access."
+  type        = string
+  default     = ""
+}
+
 # PUT Upload Extension Variables
 
 variable "allocation_url_expiry_seconds" {
@@ -122,6 +347,61 @@ variable "allocation_cleanup_buffer_hours" {
   }
 }
 
+variable "dlq_redrive_max_attempts" {
+  description = "Runs of dlq-redrive (every 15 minutes) that try a blob-confirm or blob-cleanup dead letter before parking it for investigation"
+  type        = number
+  default     = 5
+
+  validation {
+    condition     = var.dlq_redrive_max_attempts >= 1 && var.dlq_redrive_max_attempts <= 100
+    error_message = "DLQ redrive attempts must be between 1 and 100"
+  }
+}
+
+variable "inactive_account_after_days" {
+  description = "Days without use after which account-reaper flags an account inactive and publishes account.inactive"
+  type        = number
+  default     = 365
+
+  validation {
+    condition     = var.inactive_account_after_days >= 1 && var.inactive_account_after_days <= 3650
+    error_message = "Inactive account threshold must be between 1 and 3650 days"
+  }
+}
+
+variable "inactive_account_action" {
+  description = "What account-reaper does to an inactive account besides flagging it: flag (nothing more), suspend, or schedule-deletion"
+  type        = string
+  default     = "flag"
+
+  validation {
+    condition     = contains(["flag", "suspend", "schedule-deletion"], var.inactive_account_action)
+    error_message = "Inactive account action must be flag, suspend or schedule-deletion"
+  }
+}
+
+variable "inactive_account_deletion_delay_days" {
+  description = "Days ahead of flagging that account-reaper records deletionScheduledAt, for the schedule-deletion action"
+  type        = number
+  default     = 30
+
+  validation {
+    condition     = var.inactive_account_deletion_delay_days >= 0 && var.inactive_account_deletion_delay_days <= 365
+    error_message = "Inactive account deletion delay must be between 0 and 365 days"
+  }
+}
+
+variable "max_size_upload" {
+  description = "Maximum blob size for traditional uploads in bytes, advertised as maxSizeUpload"
+  type        = number
+  default     = 10000000 # 10 MB
+
+  validation {
+    condition     = var.max_size_upload >= 1000 && var.max_size_upload <= 10485760
+    error_message = "Max upload size must be between 1 KB and 10 MiB, the API Gateway payload limit"
+  }
+}
+
 variable "max_size_upload_put" {
   description = "Maximum blob size for PUT upload in bytes"
   type        = number
@@ -155,6 +435,99 @@ variable "jmap_dispatcher_parallelism" {
   }
 }
 
+variable "plugin_latency_flush_seconds" {
+  description = "How often each jmap-api instance flushes its per-plugin latency statistics to EMF and to DynamoDB for the admin API. Set to 0 to stop tracking plugin latency."
+  type        = number
+  default     = 60
+
+  validation {
+    condition     = var.plugin_latency_flush_seconds >= 0 && var.plugin_latency_flush_seconds <= 3600
+    error_message = "Plugin latency flush interval must be between 0 and 3600 seconds"
+  }
+}
+
+variable "jmap_strict_validation" {
+  description = "Check every method call of a JMAP request (structure, method, capability, accountId and result references) before running any, and reject the whole request with one problem response if a call fails"
+  type        = bool
+  default     = false
+}
+
+variable "registry_consistent_read" {
+  description = "Load the plugin registry in jmap-api with strongly consistent reads, so a cold start sees plugin registrations made just before it, at twice the read cost"
+  type        = bool
+  default     = false
+}
+
+variable "state_token_max_age_seconds" {
+  description = "Oldest state token, in seconds, jmap-api passes to a plugin /changes or /queryChanges method that takes state tokens; older tokens get cannotCalculateChanges. Zero lets tokens last forever."
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.state_token_max_age_seconds >= 0 && var.state_token_max_age_seconds <= 31536000
+    error_message = "State token maximum age must be between 0 and 31536000 seconds"
+  }
+}
+
+variable "session_max_wait_seconds" {
+  description = "Longest, in seconds, get-jmap-session holds a long-polling request (?state=...&wait=N) waiting for the session state to change. Zero disables long polling. Must stay under the API Gateway integration timeout and lambda_timeout."
+  type        = number
+  default     = 20
+
+  validation {
+    condition     = var.session_max_wait_seconds >= 0 && var.session_max_wait_seconds <= 25
+    error_message = "Session maximum wait must be between 0 and 25 seconds"
+  }
+}
+
+variable "plugin_prewarm" {
+  description = "Open connections to every registered plugin Lambda during jmap-api cold start, so the first plugin call does not pay for connection setup"
+  type        = bool
+  default     = false
+}
+
+variable "rate_limit_per_second" {
+  description = "Sustained requests per second allowed per account and per IAM principal on the JMAP API, upload and download endpoints. Set to 0 to disable rate limiting."
+  type        = number
+  default     = 20
+
+  validation {
+    condition     = var.rate_limit_per_second >= 0
+    error_message = "Rate limit must not be negative"
+  }
+}
+
+variable "rate_limit_burst" {
+  description = "Maximum burst of requests allowed per account and per IAM principal before rate limiting applies"
+  type        = number
+  default     = 100
+
+  validation {
+    condition     = var.rate_limit_burst >= 1 && floor(var.rate_limit_burst) == var.rate_limit_burst
+    error_message = "Rate limit burst must be a whole number of at least 1"
+  }
+}
+
+variable "rate_limit_tiers" {
+  description = "Per-account limits by quota tier, replacing rate_limit_per_second and rate_limit_burst for accounts in that tier. A rate of 0 leaves the tier unlimited. IAM principal limits are unchanged."
+  type = map(object({
+    rate  = number
+    burst = number
+  }))
+  default = {}
+
+  validation {
+    condition     = alltrue([for l in values(var.rate_limit_tiers) : l.rate >= 0 && (l.rate == 0 || l.burst >= 1)])
+    error_message = "Tier rate limits must not be negative, and need a burst of at least 1"
+  }
+}
+
+variable "concurrency_limit" {
+  description = "Limit each account's in-flight JMAP API requests to the maxConcurrentRequests declared in the core capability"
+  type        = bool
+  default     = false
+}
+
 variable "default_quota_bytes" {
   description = "Default storage quota for new accounts in bytes"
   type        = number
@@ -166,12 +539,84 @@ variable "default_quota_bytes" {
   }
 }
 
+variable "quota_tiers" {
+  description = "Quota tier presets: tier name to quota bytes. Users in a Cognito group with a tier's name get that tier's quota on first login."
+  type        = map(number)
+  default     = {}
+
+  validation {
+    condition     = alltrue([for q in values(var.quota_tiers) : q > 0])
+    error_message = "Quota tier sizes must be positive"
+  }
+}
+
+variable "account_type_features" {
+  description = "Features per account type: whether Blob/allocate multipart is allowed, the maximum blob size in bytes, and the capabilities offered (empty offers all). Account types without an entry are unrestricted."
+  type = map(object({
+    multipart     = optional(bool)
+    max_blob_size = optional(number)
+    capabilities  = optional(list(string))
+  }))
+  default = {}
+}
+
+variable "usage_thresholds" {
+  description = "Percentages of quota at which usage-metering publishes a usage.threshold event"
+  type        = list(number)
+  default     = [80, 100]
+}
+
+variable "quota_alert_thresholds" {
+  description = "Percentages of quota remaining at which quota-alerts publishes a quota.warning event; 0 publishes quota.exceeded"
+  type        = list(number)
+  default     = [10, 0]
+
+  validation {
+    condition     = length(var.quota_alert_thresholds) > 0 && alltrue([for t in var.quota_alert_thresholds : t >= 0 && t < 100])
+    error_message = "quota_alert_thresholds must list at least one percentage from 0 to 99"
+  }
+}
+
+variable "quota_grace_percent" {
+  description = "Percentage of an account's quota Blob/allocate may go over during the quota grace period. 0 disables grace"
+  type        = number
+  default     = 0
+
+  validation {
+    condition     = var.quota_grace_percent >= 0 && var.quota_grace_percent <= 100
+    error_message = "Quota grace percent must be between 0 and 100"
+  }
+}
+
+variable "quota_grace_period_seconds" {
+  description = "How long an account may stay over quota, from the first allocation that takes it over, before allocations over quota are rejected"
+  type        = number
+  default     = 604800
+
+  validation {
+    condition     = var.quota_grace_period_seconds >= 3600 && var.quota_grace_period_seconds <= 7776000
+    error_message = "Quota grace period must be between 3600 (1 hour) and 7776000 (90 days) seconds"
+  }
+}
+
 variable "cors_allowed_origins" {
-  description = "Origins allowed for CORS PUT uploads"
+  description = "Origins allowed for CORS requests from browser clients, including PUT uploads"
   type        = list(string)
   default     = ["*"]
 }
 
+variable "blob_metadata_kms_key_arn" {
+  description = "KMS key ARN for envelope encryption of blob record metadata. Empty stores it in plaintext"
+  type        = string
+  default     = ""
+}
+
+variable "blob_encrypted_attributes" {
+  description = "Blob record attributes encrypted when blob_metadata_kms_key_arn is set"
+  type        = list(string)
+  default     = ["contentType", "parent", "name"]
+}
+
 # CloudWatch Alarm Configuration
 
 variable "alarm_sns_topic_arn" {
@@ -208,3 +653,9 @@ variable "test_user_emails" {
     error_message = "All test user emails must be valid email addresses."
   }
 }
+
+variable "account_id_claim" {
+  description = "Authorizer claim holding the account ID on user endpoints, for OIDC providers other than Cognito"
+  type        = string
+  default     = "sub"
+}